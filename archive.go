@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+func runArchive(args []string) (err error) {
+	var include, exclude patternList
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	format := fs.String("format", "", "tar or zip, by default zip for an output ending with .zip and tar otherwise")
+	sd := fs.Bool("sd", false, "Store the security descriptor of each file and directory")
+	fs.Var(&include, "include", "Only archive files matching the pattern (repeatable)")
+	fs.Var(&exclude, "exclude", "Skip files and directories matching the pattern (repeatable)")
+	useRegex := fs.Bool("regex", false, "Treat -include and -exclude patterns as regular expressions")
+	maxDepth := fs.Int("maxdepth", 0, "Maximum directory depth to descend, 0 for no limit")
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return fmt.Errorf("Usage: archive [-format tar|zip] [-sd] [filters] //host/share/path [output]")
+	}
+	t, err := parseTarget(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	output := "-"
+	if fs.NArg() == 2 {
+		output = fs.Arg(1)
+	}
+	opts := &smb.ArchiveOptions{SecurityDescriptors: *sd}
+	switch {
+	case *format == "zip", *format == "" && strings.HasSuffix(strings.ToLower(output), ".zip"):
+		opts.Format = smb.ArchiveZip
+	case *format == "tar", *format == "":
+		opts.Format = smb.ArchiveTar
+	default:
+		return fmt.Errorf("Unknown archive format %s", *format)
+	}
+	if output == "-" && *jsonOutput {
+		return fmt.Errorf("JSON output requires writing the archive to a file")
+	}
+
+	filter, err := newDownloadFilter(include, exclude, *useRegex)
+	if err != nil {
+		return err
+	}
+	filter.maxDepth = *maxDepth
+	opts.Filter = func(rel string, file *smb.SharedFile) bool {
+		if file.IsDir {
+			return filter.enterDir(rel, strings.Count(rel, "/")+1)
+		}
+		return filter.wantFile(rel, file)
+	}
+	failed := 0
+	opts.OnError = func(rel string, err error) error {
+		fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", rel, err)
+		failed++
+		return nil
+	}
+	opts.Progress = func(rel string, file *smb.SharedFile) {
+		if *jsonOutput {
+			emit(newFileRecord(t, file))
+			return
+		}
+		// The archive may be written to stdout
+		fmt.Fprintln(os.Stderr, rel)
+	}
+
+	conn, err := connectShare(t)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var w io.Writer = os.Stdout
+	if output != "-" {
+		out, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if e := out.Close(); err == nil {
+				err = e
+			}
+		}()
+		w = out
+	}
+	if err = conn.Archive(w, t.share, t.path, opts); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files or directories could not be archived", failed)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc/mstsch"
+)
+
+// Definition of a task running a command once as SYSTEM. The trigger lies in
+// the past and is only there to make the task valid, the task is started
+// explicitly.
+const atexecTaskXML = `<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <Triggers>
+    <CalendarTrigger>
+      <StartBoundary>2015-07-15T20:35:13</StartBoundary>
+      <Enabled>true</Enabled>
+      <ScheduleByDay>
+        <DaysInterval>1</DaysInterval>
+      </ScheduleByDay>
+    </CalendarTrigger>
+  </Triggers>
+  <Principals>
+    <Principal id="LocalSystem">
+      <UserId>S-1-5-18</UserId>
+      <RunLevel>HighestAvailable</RunLevel>
+    </Principal>
+  </Principals>
+  <Settings>
+    <MultipleInstancesPolicy>IgnoreNew</MultipleInstancesPolicy>
+    <DisallowStartIfOnBatteries>false</DisallowStartIfOnBatteries>
+    <StopIfGoingOnBatteries>false</StopIfGoingOnBatteries>
+    <AllowHardTerminate>true</AllowHardTerminate>
+    <RunOnlyIfNetworkAvailable>false</RunOnlyIfNetworkAvailable>
+    <IdleSettings>
+      <StopOnIdleEnd>true</StopOnIdleEnd>
+      <RestartOnIdle>false</RestartOnIdle>
+    </IdleSettings>
+    <AllowStartOnDemand>true</AllowStartOnDemand>
+    <Enabled>true</Enabled>
+    <Hidden>true</Hidden>
+    <RunOnlyIfIdle>false</RunOnlyIfIdle>
+    <WakeToRun>false</WakeToRun>
+    <ExecutionTimeLimit>P3D</ExecutionTimeLimit>
+    <Priority>7</Priority>
+  </Settings>
+  <Actions Context="LocalSystem">
+    <Exec>
+      <Command>%s</Command>
+      <Arguments>%s</Arguments>
+    </Exec>
+  </Actions>
+</Task>
+`
+
+// taskXML returns the definition of a task running a program with arguments
+func taskXML(program, args string) string {
+	escape := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	return fmt.Sprintf(atexecTaskXML, escape(program), escape(args))
+}
+
+// shellArgs returns the arguments of cmd.exe running a command, with its
+// output redirected to a file when output is not empty. It is shared with
+// wmiexec.
+func shellArgs(command, output string) string {
+	if output == "" {
+		return "/C " + command
+	}
+	return fmt.Sprintf(`/C %s > %s 2>&1`, command, output)
+}
+
+// readOutput reads the output file of a task once the command has finished
+// writing it, which is detected by opening the file without sharing write
+// access. It returns nil if the file did not appear before the timeout.
+func readOutput(conn *smb.Connection, path string, wait time.Duration) ([]byte, error) {
+	opts := smb.NewCreateReqOpts()
+	opts.ShareAccess = smb.FileShareRead
+	deadline := time.Now().Add(wait)
+	for {
+		f, err := conn.OpenFileExt("ADMIN$", path, opts)
+		if err == nil {
+			var buf bytes.Buffer
+			_, err = io.Copy(&buf, f)
+			f.CloseFile()
+			return buf.Bytes(), err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("No output after %s: %s", wait, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func runAtexec(args []string) error {
+	fs := flag.NewFlagSet("atexec", flag.ExitOnError)
+	name := fs.String("name", "", "Task name, random by default")
+	wait := fs.Duration("wait", 30*time.Second, "Time to wait for the output of the command")
+	noOutput := fs.Bool("no-output", false, "Do not capture the output of the command")
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		return fmt.Errorf("Usage: atexec [-name task] [-wait duration] [-no-output] <host> <command...>")
+	}
+	host := fs.Arg(0)
+	command := strings.Join(fs.Args()[1:], " ")
+	if *name == "" {
+		var err error
+		if *name, err = randomServiceName(); err != nil {
+			return err
+		}
+	}
+	output := ""
+	if !*noOutput {
+		output = `Temp\` + *name + ".tmp"
+	}
+
+	conn, err := connect(host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	bind, err := bindPrivacy(conn, mstsch.MSRPCTschPipe, mstsch.MSRPCUuidTsch, mstsch.MSRPCTschMajorVersion, mstsch.MSRPCTschMinorVersion)
+	if err != nil {
+		return err
+	}
+	rpccon := mstsch.NewRPCCon(bind)
+
+	cmdArgs := shellArgs(command, "")
+	if output != "" {
+		cmdArgs = shellArgs(command, `%windir%\`+output)
+	}
+	path, err := rpccon.RegisterTask(`\`+*name, taskXML("cmd.exe", cmdArgs), mstsch.TaskCreate)
+	if err != nil {
+		return fmt.Errorf("Failed to register task %s: %s", *name, err)
+	}
+	if path == "" {
+		path = `\` + *name
+	}
+	defer func() {
+		if err := rpccon.Delete(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to delete task %s: %s\n", path, err)
+		}
+	}()
+	fmt.Fprintf(os.Stderr, "Registered task %s running cmd.exe %s\n", path, cmdArgs)
+	if _, err = rpccon.Run(path); err != nil {
+		return fmt.Errorf("Failed to run task %s: %s", path, err)
+	}
+
+	var data []byte
+	if output != "" {
+		if data, err = readOutput(conn, output, *wait); err != nil {
+			return err
+		}
+		if err = conn.DeleteFile("ADMIN$", output); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove ADMIN$\\%s: %s\n", output, err)
+		}
+	}
+	if *jsonOutput {
+		return emit(execRecord{Task: path, Command: command, Output: string(data), Status: "ok"})
+	}
+	os.Stdout.Write(data)
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestTaskXML(t *testing.T) {
+	def := taskXML("cmd.exe", shellArgs(`echo "a" & dir`, `%windir%\Temp\x.tmp`))
+	var task struct {
+		Command   string `xml:"Actions>Exec>Command"`
+		Arguments string `xml:"Actions>Exec>Arguments"`
+	}
+	// encoding/xml refuses documents declaring another encoding than UTF-8
+	def = strings.Replace(def, `encoding="UTF-16"`, `encoding="UTF-8"`, 1)
+	if err := xml.Unmarshal([]byte(def), &task); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if task.Command != "cmd.exe" {
+		t.Fatalf("Fail: %s", task.Command)
+	}
+	if task.Arguments != `/C echo "a" & dir > %windir%\Temp\x.tmp 2>&1` {
+		t.Fatalf("Fail: %s", task.Arguments)
+	}
+	if shellArgs("whoami", "") != "/C whoami" {
+		t.Fatal("Fail")
+	}
+}
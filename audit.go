@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ericblavier/go-smb/gss"
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/spnego"
+)
+
+// SMB2 and 3 dialects in ascending order
+var auditDialects = []uint16{smb.DialectSmb_2_0_2, smb.DialectSmb_2_1, smb.DialectSmb_3_0, smb.DialectSmb_3_0_2, smb.DialectSmb_3_1_1}
+
+// Dialect names accepted as min_dialect in a policy
+var auditDialectNames = map[string]uint16{
+	"2.0.2": smb.DialectSmb_2_0_2,
+	"2.1":   smb.DialectSmb_2_1,
+	"3.0":   smb.DialectSmb_3_0,
+	"3.0.2": smb.DialectSmb_3_0_2,
+	"3.1.1": smb.DialectSmb_3_1_1,
+}
+
+// auditPolicy is the baseline hosts are checked against. Settings left out of
+// a policy file keep their defaults.
+type auditPolicy struct {
+	AllowSMB1         bool   `json:"allow_smb1"`
+	RequireSigning    bool   `json:"require_signing"`
+	RequireEncryption bool   `json:"require_encryption"`
+	AllowNullSession  bool   `json:"allow_null_session"`
+	AllowGuest        bool   `json:"allow_guest"`
+	MinDialect        string `json:"min_dialect"` // Empty to not check the dialects
+	RequireKerberos   bool   `json:"require_kerberos"`
+}
+
+var defaultAuditPolicy = auditPolicy{RequireSigning: true}
+
+// loadAuditPolicy reads a JSON policy file over the default policy
+func loadAuditPolicy(name string) (p auditPolicy, err error) {
+	p = defaultAuditPolicy
+	if name == "" {
+		return
+	}
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(buf, &p); err != nil {
+		return p, fmt.Errorf("Invalid policy %s: %s", name, err)
+	}
+	if _, found := auditDialectNames[p.MinDialect]; p.MinDialect != "" && !found {
+		return p, fmt.Errorf("Invalid min_dialect %s. Expecting 2.0.2, 2.1, 3.0, 3.0.2 or 3.1.1", p.MinDialect)
+	}
+	return
+}
+
+// Security settings observed on a host
+type auditFacts struct {
+	SMB1            bool     `json:"smb1"`
+	SigningEnabled  bool     `json:"signing_enabled"`
+	SigningRequired bool     `json:"signing_required"`
+	Encryption      bool     `json:"encryption"`
+	MinDialect      uint16   `json:"min_dialect"`
+	MaxDialect      uint16   `json:"max_dialect"`
+	NullSession     bool     `json:"null_session"`
+	Guest           bool     `json:"guest"`
+	Kerberos        bool     `json:"kerberos"` // Kerberos is announced besides NTLM
+	MechTypes       []string `json:"mech_types"`
+	// Observations of the NTLM authentication with a random account
+	AuthFindings []auditFinding `json:"auth_findings,omitempty"`
+}
+
+// An smb.AuthFinding
+type auditFinding struct {
+	ID      string `json:"id"`
+	Summary string `json:"summary"`
+	Details string `json:"details"`
+}
+
+// Result of comparing one setting with the policy
+type auditCheck struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Result string `json:"result"` // PASS, FAIL or INFO when the policy does not cover it
+}
+
+// Report of a single host
+type auditReport struct {
+	Host   string       `json:"host"`
+	Facts  *auditFacts  `json:"facts,omitempty"`
+	Checks []auditCheck `json:"checks,omitempty"`
+	Pass   bool         `json:"pass"`
+	Error  string       `json:"error,omitempty"`
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// evaluateAudit compares the facts of a host with the policy
+func evaluateAudit(facts *auditFacts, p auditPolicy) (checks []auditCheck, pass bool) {
+	pass = true
+	add := func(name, value string, checked, ok bool) {
+		result := "INFO"
+		if checked {
+			result = "PASS"
+			if !ok {
+				result = "FAIL"
+				pass = false
+			}
+		}
+		checks = append(checks, auditCheck{Name: name, Value: value, Result: result})
+	}
+
+	add("SMB1 enabled", yesNo(facts.SMB1), !p.AllowSMB1, !facts.SMB1)
+	add("Signing supported", yesNo(facts.SigningEnabled), false, true)
+	add("Signing required", yesNo(facts.SigningRequired), p.RequireSigning, facts.SigningRequired)
+	add("Encryption supported", yesNo(facts.Encryption), p.RequireEncryption, facts.Encryption)
+	min := auditDialectNames[p.MinDialect]
+	add("Dialect range", getDialectName(facts.MinDialect)+" - "+getDialectName(facts.MaxDialect), min != 0, facts.MinDialect >= min)
+	add("Null session allowed", yesNo(facts.NullSession), !p.AllowNullSession, !facts.NullSession)
+	add("Guest session allowed", yesNo(facts.Guest), !p.AllowGuest, !facts.Guest)
+	auth := "NTLM only"
+	if facts.Kerberos {
+		auth = "Kerberos"
+	}
+	add("Authentication", auth, p.RequireKerberos, facts.Kerberos)
+	return
+}
+
+// auditHost gathers the security settings of a host
+func auditHost(host string) (facts *auditFacts, err error) {
+	opts := smb.ProbeOptions{Port: *port}
+	res, err := smb.Probe(host, opts)
+	if err != nil {
+		return
+	}
+	facts = &auditFacts{
+		SigningEnabled:  res.SigningEnabled,
+		SigningRequired: res.SigningRequired,
+		Encryption:      res.EncryptionSupported,
+		MaxDialect:      res.Dialect,
+		MechTypes:       []string{},
+	}
+	for _, oid := range res.MechTypes {
+		facts.MechTypes = append(facts.MechTypes, oid.String())
+		if oid.Equal(gss.KerberosSSPMechTypeOid) || oid.Equal(gss.MsKerberosOid) {
+			facts.Kerberos = true
+		}
+	}
+
+	// The lowest dialect is found by offering one dialect at a time
+	facts.MinDialect = res.Dialect
+	for _, dialect := range auditDialects {
+		if dialect >= res.Dialect {
+			break
+		}
+		opts.Dialects = []uint16{dialect}
+		if _, err := smb.Probe(host, opts); err == nil {
+			facts.MinDialect = dialect
+			break
+		}
+	}
+
+	if facts.SMB1, err = smb.ProbeSMB1(host, opts); err != nil {
+		return nil, err
+	}
+
+	conn, err := smb.NewConnection(smb.Options{
+		Host:      host,
+		Port:      *port,
+		Initiator: &spnego.NTLMInitiator{NullSession: true},
+	})
+	if err == nil {
+		facts.NullSession = true
+		conn.Close()
+	}
+
+	// A random account only gets a session from servers mapping bad logons to guest
+	random := make([]byte, 8)
+	if _, err = rand.Read(random); err != nil {
+		return nil, err
+	}
+	conn, err = smb.NewConnection(smb.Options{
+		Host: host,
+		Port: *port,
+		Initiator: &spnego.NTLMInitiator{
+			User:     hex.EncodeToString(random),
+			Password: hex.EncodeToString(random),
+		},
+		AuthDiagnostics: true,
+		OnAuthFinding: func(f smb.AuthFinding) {
+			facts.AuthFindings = append(facts.AuthFindings, auditFinding{ID: f.ID, Summary: f.Summary, Details: f.Details})
+		},
+	})
+	if err == nil {
+		facts.Guest = conn.IsGuestSession()
+		conn.Close()
+	}
+	return facts, nil
+}
+
+func runAudit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	policyFile := fs.String("policy", "", "JSON file with the policy baseline, see TEST_USAGE.md")
+	asJSON := fs.Bool("json", *jsonOutput, "Print one JSON record per host")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		return fmt.Errorf("Usage: audit [-policy file] [-json] <host> [host...]")
+	}
+	policy, err := loadAuditPolicy(*policyFile)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, host := range fs.Args() {
+		report := auditReport{Host: host}
+		facts, err := auditHost(host)
+		if err != nil {
+			report.Error = err.Error()
+		} else {
+			report.Facts = facts
+			report.Checks, report.Pass = evaluateAudit(facts, policy)
+		}
+		if !report.Pass {
+			failed++
+		}
+		if *asJSON {
+			emit(report)
+			continue
+		}
+		fmt.Printf("%s\n", host)
+		if report.Error != "" {
+			fmt.Printf("  Error: %s\n", report.Error)
+			continue
+		}
+		for _, check := range report.Checks {
+			fmt.Printf("  %-24s %-24s %s\n", check.Name, check.Value, check.Result)
+		}
+		for _, finding := range report.Facts.AuthFindings {
+			fmt.Printf("  Finding: %s. %s\n", finding.Summary, finding.Details)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d hosts failed the audit", failed, fs.NArg())
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+func TestEvaluateAudit(t *testing.T) {
+	facts := &auditFacts{
+		SigningEnabled:  true,
+		SigningRequired: true,
+		MinDialect:      smb.DialectSmb_2_1,
+		MaxDialect:      smb.DialectSmb_3_1_1,
+	}
+	results := func(checks []auditCheck) map[string]string {
+		m := make(map[string]string)
+		for _, check := range checks {
+			m[check.Name] = check.Result
+		}
+		return m
+	}
+
+	checks, pass := evaluateAudit(facts, defaultAuditPolicy)
+	if !pass {
+		t.Fatalf("Fail: %+v", checks)
+	}
+	r := results(checks)
+	if r["Encryption supported"] != "INFO" || r["Dialect range"] != "INFO" || r["Signing required"] != "PASS" {
+		t.Fatalf("Fail: %+v", checks)
+	}
+
+	facts.SMB1, facts.Guest = true, true
+	checks, pass = evaluateAudit(facts, defaultAuditPolicy)
+	r = results(checks)
+	if pass || r["SMB1 enabled"] != "FAIL" || r["Guest session allowed"] != "FAIL" || r["Null session allowed"] != "PASS" {
+		t.Fatalf("Fail: %+v", checks)
+	}
+
+	strict := auditPolicy{AllowSMB1: true, AllowGuest: true, MinDialect: "3.0", RequireKerberos: true}
+	checks, pass = evaluateAudit(facts, strict)
+	r = results(checks)
+	if pass || r["Dialect range"] != "FAIL" || r["Authentication"] != "FAIL" || r["SMB1 enabled"] != "INFO" {
+		t.Fatalf("Fail: %+v", checks)
+	}
+	facts.MinDialect, facts.Kerberos = smb.DialectSmb_3_0, true
+	if checks, pass = evaluateAudit(facts, strict); !pass {
+		t.Fatalf("Fail: %+v", checks)
+	}
+}
+
+func TestLoadAuditPolicy(t *testing.T) {
+	p, err := loadAuditPolicy("")
+	if err != nil || p != defaultAuditPolicy {
+		t.Fatal("Fail")
+	}
+	name := filepath.Join(t.TempDir(), "policy.json")
+	os.WriteFile(name, []byte(`{"require_encryption": true, "min_dialect": "3.1.1"}`), 0600)
+	if p, err = loadAuditPolicy(name); err != nil || !p.RequireEncryption || !p.RequireSigning || p.MinDialect != "3.1.1" {
+		t.Fatalf("Fail: %+v %v", p, err)
+	}
+	os.WriteFile(name, []byte(`{"min_dialect": "1.0"}`), 0600)
+	if _, err = loadAuditPolicy(name); err == nil {
+		t.Fatal("Fail")
+	}
+}
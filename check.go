@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+// Statuses of a finding
+const (
+	findingVulnerable    = "vulnerable"     // Confirmed by the server's response
+	findingLikely        = "likely"         // Affected build, the patch level cannot be determined remotely
+	findingPossible      = "possible"       // Affected configuration but unknown build
+	findingNotVulnerable = "not_vulnerable" // Required feature absent or build not affected
+	findingError         = "error"
+)
+
+// Outcome of a vulnerability check against a host
+type checkFinding struct {
+	Host    string `json:"host"`
+	Check   string `json:"check"`
+	CVE     string `json:"cve"`
+	Status  string `json:"status"`
+	Details string `json:"details"`
+}
+
+// Windows builds shipping the vulnerable SMB 3.1.1 compression code
+var (
+	smbGhostBuilds = map[int]string{18362: "1903", 18363: "1909"}
+	smbleedBuilds  = map[int]string{18362: "1903", 18363: "1909", 19041: "2004"}
+)
+
+// A vulnerability check
+type vulnCheck struct {
+	name string
+	cve  string
+}
+
+var vulnChecks = []vulnCheck{
+	{"ms17-010", "CVE-2017-0144"},
+	{"smbghost", "CVE-2020-0796"},
+	{"smbleed", "CVE-2020-1206"},
+}
+
+// evaluateCompression rates a host against a compression vulnerability from
+// the negotiated dialect and compression algorithms and the build reported
+// in the NTLM challenge, 0 if unknown
+func evaluateCompression(dialect uint16, algorithms []uint16, build int, builds map[int]string) (status, details string) {
+	if dialect != smb.DialectSmb_3_1_1 || len(algorithms) == 0 {
+		return findingNotVulnerable, "SMB 3.1.1 compression is not supported"
+	}
+	if build == 0 {
+		return findingPossible, "SMB 3.1.1 compression is supported but the build is unknown"
+	}
+	version, found := builds[build]
+	if !found {
+		return findingNotVulnerable, fmt.Sprintf("Build %d is not affected", build)
+	}
+	return findingLikely, fmt.Sprintf("Windows 10 %s (build %d) with SMB 3.1.1 compression, the patch level cannot be determined remotely", version, build)
+}
+
+// serverBuild returns the build number from the NTLM challenge of a session
+// setup with the global credentials, or 0 if it is unavailable
+func serverBuild(host string) int {
+	conn, err := connect(host)
+	if err != nil {
+		return 0
+	}
+	defer conn.Close()
+	info := conn.GetTargetInfo()
+	if info == nil {
+		return 0
+	}
+	return int(info.OS >> 16 & 0xffff)
+}
+
+// checkHost runs the selected checks against a host
+func checkHost(host string, selected map[string]bool) (findings []checkFinding) {
+	opts := smb.ProbeOptions{Port: *port}
+	var (
+		probe    *smb.ProbeResult
+		probeErr error
+		build    = -1
+	)
+	for _, check := range vulnChecks {
+		if !selected[check.name] {
+			continue
+		}
+		finding := checkFinding{Host: host, Check: check.name, CVE: check.cve}
+		if check.name == "ms17-010" {
+			res, err := smb.CheckMS17010(host, opts)
+			switch {
+			case err != nil:
+				finding.Status, finding.Details = findingError, err.Error()
+			case !res.SMB1Enabled:
+				finding.Status, finding.Details = findingNotVulnerable, "SMB1 is disabled"
+			case res.Vulnerable:
+				finding.Status, finding.Details = findingVulnerable, "PeekNamedPipe on FID 0 returned STATUS_INSUFF_SERVER_RESOURCES"
+			default:
+				finding.Status, finding.Details = findingNotVulnerable, fmt.Sprintf("PeekNamedPipe on FID 0 returned 0x%08x", res.Status)
+			}
+			findings = append(findings, finding)
+			continue
+		}
+
+		// The compression checks share a single probe and session setup
+		if probe == nil && probeErr == nil {
+			compressOpts := opts
+			compressOpts.Compression = true
+			probe, probeErr = smb.Probe(host, compressOpts)
+		}
+		if probeErr != nil {
+			finding.Status, finding.Details = findingError, probeErr.Error()
+			findings = append(findings, finding)
+			continue
+		}
+		if build == -1 {
+			build = 0
+			if probe.Dialect == smb.DialectSmb_3_1_1 && len(probe.CompressionAlgorithms) > 0 {
+				build = serverBuild(host)
+			}
+		}
+		builds := smbGhostBuilds
+		if check.name == "smbleed" {
+			builds = smbleedBuilds
+		}
+		finding.Status, finding.Details = evaluateCompression(probe.Dialect, probe.CompressionAlgorithms, build, builds)
+		findings = append(findings, finding)
+	}
+	return
+}
+
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	checks := fs.String("checks", "ms17-010,smbghost,smbleed", "Comma separated list of checks to run")
+	asJSON := fs.Bool("json", *jsonOutput, "Print one JSON record per finding")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		return fmt.Errorf("Usage: check [-checks list] [-json] <host> [host...]")
+	}
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(*checks, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, check := range vulnChecks {
+			found = found || check.name == name
+		}
+		if !found {
+			return fmt.Errorf("Unknown check %s", name)
+		}
+		selected[name] = true
+	}
+
+	affected := 0
+	for _, host := range fs.Args() {
+		for _, finding := range checkHost(host, selected) {
+			if finding.Status == findingVulnerable || finding.Status == findingLikely {
+				affected++
+			}
+			if *asJSON {
+				emit(finding)
+				continue
+			}
+			fmt.Printf("%-20s %-10s %-14s %-15s %s\n", finding.Host, finding.Check, finding.CVE, finding.Status, finding.Details)
+		}
+	}
+	if affected > 0 {
+		return fmt.Errorf("%d vulnerable or likely vulnerable findings", affected)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+func TestEvaluateCompression(t *testing.T) {
+	lz := []uint16{smb.CompressionLZNT1}
+	tests := []struct {
+		dialect    uint16
+		algorithms []uint16
+		build      int
+		builds     map[int]string
+		status     string
+	}{
+		{smb.DialectSmb_3_0_2, lz, 18362, smbGhostBuilds, findingNotVulnerable},
+		{smb.DialectSmb_3_1_1, nil, 18362, smbGhostBuilds, findingNotVulnerable},
+		{smb.DialectSmb_3_1_1, lz, 0, smbGhostBuilds, findingPossible},
+		{smb.DialectSmb_3_1_1, lz, 18363, smbGhostBuilds, findingLikely},
+		{smb.DialectSmb_3_1_1, lz, 19041, smbGhostBuilds, findingNotVulnerable},
+		{smb.DialectSmb_3_1_1, lz, 19041, smbleedBuilds, findingLikely},
+		{smb.DialectSmb_3_1_1, lz, 17763, smbleedBuilds, findingNotVulnerable},
+	}
+	for _, tt := range tests {
+		if status, _ := evaluateCompression(tt.dialect, tt.algorithms, tt.build, tt.builds); status != tt.status {
+			t.Fatalf("Fail: %+v got %s", tt, status)
+		}
+	}
+}
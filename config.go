@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default location of the configuration file below the home directory
+const defaultConfigFile = ".gosmb/config.yaml"
+
+// Environment variable selecting a profile when -profile is not given
+const profileEnv = "GOSMB_PROFILE"
+
+// A named set of global flag values and hosts from the configuration file
+type profile struct {
+	name        string
+	settings    map[string]string // Values of global flags by flag name
+	hosts       []string          // Hosts the commands run against, like -targets
+	credentials string            // Credentials file, see readCredentials
+}
+
+var (
+	// Hosts of the selected profile, used when -targets is not given
+	profileHosts []string
+	// Global flags given on the command line rather than set from a profile
+	explicitFlags = make(map[string]bool)
+)
+
+// yamlLine is a non-empty line of a configuration file without its comment
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// stripComment removes a # comment that is not part of a quoted string
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseYAMLScalar parses a plain, single quoted or double quoted scalar
+func parseYAMLScalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		return strconv.Unquote(s)
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'"):
+		return "", fmt.Errorf("Unterminated string %s", s)
+	}
+	return s, nil
+}
+
+// parseYAMLValue parses the value following a key, which is a scalar or a
+// flow sequence such as [a, b]
+func parseYAMLValue(s string) (any, error) {
+	if !strings.HasPrefix(s, "[") {
+		return parseYAMLScalar(s)
+	}
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("Unterminated list %s", s)
+	}
+	items := []string{}
+	for _, item := range strings.Split(s[1:len(s)-1], ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		v, err := parseYAMLScalar(item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+// parseYAMLBlock parses the mapping or sequence of the lines starting at pos
+// with the given indentation and returns the position after it
+func parseYAMLBlock(lines []yamlLine, pos, indent int) (value any, next int, err error) {
+	if strings.HasPrefix(lines[pos].text, "- ") || lines[pos].text == "-" {
+		items := []string{}
+		for ; pos < len(lines) && lines[pos].indent == indent; pos++ {
+			line := lines[pos]
+			if !strings.HasPrefix(line.text, "-") {
+				return nil, pos, fmt.Errorf("Line %d: expecting a list item", line.number)
+			}
+			item, err := parseYAMLScalar(strings.TrimPrefix(line.text, "-"))
+			if err != nil {
+				return nil, pos, fmt.Errorf("Line %d: %s", line.number, err)
+			}
+			items = append(items, item)
+		}
+		if pos < len(lines) && lines[pos].indent > indent {
+			return nil, pos, fmt.Errorf("Line %d: unexpected indentation", lines[pos].number)
+		}
+		return items, pos, nil
+	}
+
+	mapping := map[string]any{}
+	for pos < len(lines) && lines[pos].indent == indent {
+		line := lines[pos]
+		key, rest, found := strings.Cut(line.text, ":")
+		if !found || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+			return nil, pos, fmt.Errorf("Line %d: expecting key: value", line.number)
+		}
+		if key, err = parseYAMLScalar(key); err != nil {
+			return nil, pos, fmt.Errorf("Line %d: %s", line.number, err)
+		}
+		if _, dup := mapping[key]; dup {
+			return nil, pos, fmt.Errorf("Line %d: duplicate key %s", line.number, key)
+		}
+		pos++
+		if rest = strings.TrimSpace(rest); rest != "" {
+			if mapping[key], err = parseYAMLValue(rest); err != nil {
+				return nil, pos, fmt.Errorf("Line %d: %s", line.number, err)
+			}
+			continue
+		}
+		// A nested block or, for lists, items at the same indentation
+		if pos < len(lines) && (lines[pos].indent > indent || lines[pos].indent == indent && strings.HasPrefix(lines[pos].text, "-")) {
+			if mapping[key], pos, err = parseYAMLBlock(lines, pos, lines[pos].indent); err != nil {
+				return nil, pos, err
+			}
+			continue
+		}
+		mapping[key] = ""
+	}
+	if pos < len(lines) && lines[pos].indent > indent {
+		return nil, pos, fmt.Errorf("Line %d: unexpected indentation", lines[pos].number)
+	}
+	return mapping, pos, nil
+}
+
+// parseYAML parses the subset of YAML used by the configuration file:
+// nested mappings, lists of scalars in block or flow style, quoted and plain
+// scalars, and comments
+func parseYAML(buf []byte) (map[string]any, error) {
+	var lines []yamlLine
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for n := 1; scanner.Scan(); n++ {
+		raw := scanner.Text()
+		if strings.HasPrefix(strings.TrimLeft(raw, " "), "\t") {
+			return nil, fmt.Errorf("Line %d: tabs are not allowed for indentation", n)
+		}
+		text := strings.TrimRight(stripComment(raw), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		lines = append(lines, yamlLine{number: n, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return map[string]any{}, nil
+	}
+	value, pos, err := parseYAMLBlock(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if pos < len(lines) {
+		return nil, fmt.Errorf("Line %d: unexpected indentation", lines[pos].number)
+	}
+	mapping, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("Expecting a mapping at the top level")
+	}
+	return mapping, nil
+}
+
+// keychainSecret reads a password stored under a service and account in the
+// macOS keychain or, elsewhere, the Secret Service through secret-tool
+func keychainSecret(service, account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "windows":
+		return "", fmt.Errorf("The OS keychain is not supported on Windows, use an env: reference instead")
+	default:
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Failed to read %s/%s from the keychain: %s", service, account, err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// resolveValue replaces env:NAME with the value of an environment variable
+// and keychain:service/account with a secret from the OS keychain
+func resolveValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		v, found := os.LookupEnv(name)
+		if !found {
+			return "", fmt.Errorf("Environment variable %s is not set", name)
+		}
+		return v, nil
+	case strings.HasPrefix(value, "keychain:"):
+		service, account, found := strings.Cut(strings.TrimPrefix(value, "keychain:"), "/")
+		if !found || service == "" || account == "" {
+			return "", fmt.Errorf("Invalid reference %s. Expecting keychain:service/account", value)
+		}
+		return keychainSecret(service, account)
+	}
+	return value, nil
+}
+
+// expandHome replaces a leading ~/ with the home directory
+func expandHome(name string) string {
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(name, "~/") {
+		return filepath.Join(home, name[2:])
+	}
+	return name
+}
+
+// readCredentials reads a credentials file in the format of smbclient -A
+// with username, password and domain lines such as "username = alice". The
+// values may be env: or keychain: references.
+func readCredentials(name string) (map[string]string, error) {
+	buf, err := os.ReadFile(expandHome(name))
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]string{"username": "user", "user": "user", "password": "pass", "domain": "domain", "workgroup": "domain"}
+	settings := make(map[string]string)
+	for n, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		flagName, known := keys[strings.ToLower(strings.TrimSpace(key))]
+		if !found || !known {
+			return nil, fmt.Errorf("%s line %d: expecting username, password or domain = value", name, n+1)
+		}
+		if settings[flagName], err = resolveValue(strings.TrimSpace(value)); err != nil {
+			return nil, err
+		}
+	}
+	return settings, nil
+}
+
+// parseProfile reads a profile of the configuration file. The keys are the
+// names of the global flags besides hosts and credentials.
+func parseProfile(name string, value any) (*profile, error) {
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("Profile %s is not a mapping", name)
+	}
+	p := &profile{name: name, settings: make(map[string]string)}
+	for key, v := range fields {
+		switch key {
+		case "hosts":
+			switch hosts := v.(type) {
+			case []string:
+				p.hosts = hosts
+			case string:
+				p.hosts = strings.Fields(strings.ReplaceAll(hosts, ",", " "))
+			default:
+				return nil, fmt.Errorf("Profile %s: hosts must be a list", name)
+			}
+		case "credentials":
+			if p.credentials, ok = v.(string); !ok {
+				return nil, fmt.Errorf("Profile %s: credentials must be a file name", name)
+			}
+		case "profile", "config":
+			return nil, fmt.Errorf("Profile %s: %s cannot be set in a profile", name, key)
+		default:
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("Profile %s: %s must be a single value", name, key)
+			}
+			if flag.Lookup(key) == nil {
+				return nil, fmt.Errorf("Profile %s: unknown option %s", name, key)
+			}
+			p.settings[key] = s
+		}
+	}
+	return p, nil
+}
+
+// loadConfig reads the configuration file and returns the named profile, or
+// the default profile of the file when name is empty. A nil profile is
+// returned when no profile is selected.
+func loadConfig(file, name string) (*profile, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	config, err := parseYAML(buf)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid configuration %s: %s", file, err)
+	}
+	if name == "" {
+		name, _ = config["default"].(string)
+		if name == "" {
+			return nil, nil
+		}
+	}
+	profiles, _ := config["profiles"].(map[string]any)
+	value, found := profiles[name]
+	if !found {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("No profile %s in %s, available profiles: %s", name, file, strings.Join(names, ", "))
+	}
+	return parseProfile(name, value)
+}
+
+// applySettings sets the flags of fs to the values of settings, resolving
+// env: and keychain: references, except for the flags in explicit
+func applySettings(fs *flag.FlagSet, settings map[string]string, explicit map[string]bool) error {
+	for name, value := range settings {
+		if explicit[name] {
+			continue
+		}
+		value, err := resolveValue(value)
+		if err != nil {
+			return err
+		}
+		if err = fs.Set(name, value); err != nil {
+			return fmt.Errorf("Invalid value %q for %s: %s", value, name, err)
+		}
+	}
+	return nil
+}
+
+// applyProfile sets the global flags not given on the command line from the
+// selected profile and from the credentials file. Flags given on the
+// command line take precedence over the credentials file, which takes
+// precedence over the profile.
+func applyProfile() error {
+	explicit := explicitFlags
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	name := *profileName
+	if name == "" {
+		name = os.Getenv(profileEnv)
+	}
+	file := *configFile
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		file = filepath.Join(home, defaultConfigFile)
+	}
+	var p *profile
+	if _, err := os.Stat(file); err == nil || name != "" || *configFile != "" {
+		var err error
+		if p, err = loadConfig(file, name); err != nil {
+			return err
+		}
+	}
+
+	credentials := *credentialsFile
+	if p != nil {
+		if err := applySettings(flag.CommandLine, p.settings, explicit); err != nil {
+			return fmt.Errorf("Profile %s: %s", p.name, err)
+		}
+		if !explicit["targets"] {
+			profileHosts = p.hosts
+		}
+		if credentials == "" {
+			credentials = p.credentials
+		}
+	}
+	if credentials != "" {
+		settings, err := readCredentials(credentials)
+		if err != nil {
+			return err
+		}
+		if err = applySettings(flag.CommandLine, settings, explicit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
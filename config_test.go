@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testConfig = `# Profiles of the lab
+default: lab
+profiles:
+  lab:
+    hosts: [10.0.0.5, 10.0.0.6]
+    user: administrator
+    pass: env:GOSMB_TEST_PASS
+    domain: "CORP"   # NetBIOS domain
+    signing: required
+  dmz:
+    hosts:
+      - 192.168.1.10
+      - '192.168.1.11'
+    credentials: dmz.creds
+    threads: 4
+`
+
+func TestParseYAML(t *testing.T) {
+	config, err := parseYAML([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles := config["profiles"].(map[string]any)
+	lab := profiles["lab"].(map[string]any)
+	dmz := profiles["dmz"].(map[string]any)
+	if config["default"] != "lab" || lab["domain"] != "CORP" || lab["pass"] != "env:GOSMB_TEST_PASS" {
+		t.Fatalf("Fail: %+v", config)
+	}
+	if !reflect.DeepEqual(lab["hosts"], []string{"10.0.0.5", "10.0.0.6"}) || !reflect.DeepEqual(dmz["hosts"], []string{"192.168.1.10", "192.168.1.11"}) {
+		t.Fatalf("Fail: %+v %+v", lab["hosts"], dmz["hosts"])
+	}
+
+	for _, invalid := range []string{
+		"a: 1\n  b: 2\n",
+		"a: 1\na: 2\n",
+		"a\n",
+		"a: [1, 2\n",
+		"a: \"open\n",
+		"a:\n\tb: 1\n",
+		"- a\n",
+	} {
+		if _, err = parseYAML([]byte(invalid)); err == nil {
+			t.Fatalf("Fail: %q", invalid)
+		}
+	}
+}
+
+func TestResolveValue(t *testing.T) {
+	t.Setenv("GOSMB_TEST_PASS", "Secret#1")
+	if v, err := resolveValue("env:GOSMB_TEST_PASS"); err != nil || v != "Secret#1" {
+		t.Fatalf("Fail: %s %v", v, err)
+	}
+	if v, err := resolveValue("plain"); err != nil || v != "plain" {
+		t.Fatalf("Fail: %s %v", v, err)
+	}
+	if _, err := resolveValue("env:GOSMB_TEST_MISSING"); err == nil {
+		t.Fatal("Fail")
+	}
+	if _, err := resolveValue("keychain:service"); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := loadConfig(file, "")
+	if err != nil || p.name != "lab" || p.settings["signing"] != "required" || len(p.hosts) != 2 {
+		t.Fatalf("Fail: %+v %v", p, err)
+	}
+	p, err = loadConfig(file, "dmz")
+	if err != nil || p.credentials != "dmz.creds" || p.settings["threads"] != "4" {
+		t.Fatalf("Fail: %+v %v", p, err)
+	}
+	if _, err = loadConfig(file, "prod"); err == nil {
+		t.Fatal("Fail")
+	}
+
+	// Options must be global flags
+	if err = os.WriteFile(file, []byte("profiles:\n  bad:\n    passwd: x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = loadConfig(file, "bad"); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestReadCredentials(t *testing.T) {
+	t.Setenv("GOSMB_TEST_PASS", "Secret#1")
+	file := filepath.Join(t.TempDir(), "creds")
+	if err := os.WriteFile(file, []byte("username = alice\npassword = env:GOSMB_TEST_PASS\n# comment\ndomain = CORP\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := readCredentials(file)
+	if err != nil || !reflect.DeepEqual(settings, map[string]string{"user": "alice", "pass": "Secret#1", "domain": "CORP"}) {
+		t.Fatalf("Fail: %+v %v", settings, err)
+	}
+	if err = os.WriteFile(file, []byte("user alice\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readCredentials(file); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestApplySettings(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	user := fs.String("user", "", "")
+	threads := fs.Int("threads", 10, "")
+	err := applySettings(fs, map[string]string{"user": "alice", "threads": "4"}, map[string]bool{"threads": true})
+	if err != nil || *user != "alice" || *threads != 10 {
+		t.Fatalf("Fail: %s %d %v", *user, *threads, err)
+	}
+	if err = applySettings(fs, map[string]string{"threads": "many"}, nil); err == nil {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+// patternList collects the values of a repeatable flag
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// A compiled include or exclude pattern
+type pathMatcher func(rel string) bool
+
+// compilePattern compiles a glob or, with useRegex, a regular expression.
+// Globs without a slash are matched case insensitively against the name of a
+// file while other globs and regular expressions are matched against the
+// slash separated path relative to the downloaded directory.
+func compilePattern(pattern string, useRegex bool) (pathMatcher, error) {
+	if useRegex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	pattern = strings.ToLower(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("Invalid pattern %s: %s", pattern, err)
+	}
+	byName := !strings.Contains(pattern, "/")
+	return func(rel string) bool {
+		rel = strings.ToLower(rel)
+		if byName {
+			rel = path.Base(rel)
+		}
+		ok, _ := path.Match(pattern, rel)
+		return ok
+	}, nil
+}
+
+// downloadFilter selects the files of a recursive download
+type downloadFilter struct {
+	include  []pathMatcher
+	exclude  []pathMatcher
+	maxDepth int       // 0 for no limit
+	maxSize  uint64    // 0 for no limit
+	newer    time.Time // Zero for no limit
+}
+
+func newDownloadFilter(include, exclude []string, useRegex bool) (f *downloadFilter, err error) {
+	f = &downloadFilter{}
+	for _, p := range include {
+		m, err := compilePattern(p, useRegex)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, m)
+	}
+	for _, p := range exclude {
+		m, err := compilePattern(p, useRegex)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, m)
+	}
+	return
+}
+
+func (f *downloadFilter) excluded(rel string) bool {
+	for _, m := range f.exclude {
+		if m(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// enterDir reports whether a directory at the given depth below the root is
+// descended into
+func (f *downloadFilter) enterDir(rel string, depth int) bool {
+	return (f.maxDepth == 0 || depth < f.maxDepth) && !f.excluded(rel)
+}
+
+// wantFile reports whether a file is downloaded
+func (f *downloadFilter) wantFile(rel string, file *smb.SharedFile) bool {
+	if f.maxSize != 0 && file.Size > f.maxSize {
+		return false
+	}
+	if !f.newer.IsZero() && !file.Modified().After(f.newer) {
+		return false
+	}
+	if f.excluded(rel) {
+		return false
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, m := range f.include {
+		if m(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSize parses a size with an optional K, M or G suffix
+func parseSize(s string) (uint64, error) {
+	multiplier := uint64(1)
+	switch {
+	case strings.HasSuffix(strings.ToUpper(s), "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(strings.ToUpper(s), "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(strings.ToUpper(s), "G"):
+		multiplier = 1 << 30
+	}
+	digits := s
+	if multiplier != 1 {
+		digits = s[:len(s)-1]
+	}
+	n, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid size %s", s)
+	}
+	return n * multiplier, nil
+}
+
+// parseNewer parses a date, a timestamp or an age such as 36h or 7d relative
+// to now
+func parseNewer(s string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("Invalid age %s", s)
+		}
+		return now.AddDate(0, 0, -n), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("Invalid time %s. Expecting a date or an age such as 36h or 7d", s)
+	}
+	return now.Add(-d), nil
+}
+
+// downloadTree recursively downloads the directory t into local and returns
+// the number of files and directories that could not be downloaded. Local
+// directories are only created for directories containing selected files.
+func downloadTree(conn *smb.Connection, t target, local string, filter *downloadFilter) (failed int, err error) {
+	share := t.share
+	var walk func(dir, rel, local string, depth int) (bool, error)
+	walk = func(dir, rel, local string, depth int) (made bool, err error) {
+		files, err := conn.ListDirectory(share, dir, "*")
+		if err != nil {
+			return
+		}
+		for i := range files {
+			file := &files[i]
+			if file.Name == "." || file.Name == ".." {
+				continue
+			}
+			if strings.ContainsAny(file.Name, `/\`) {
+				fmt.Fprintf(os.Stderr, "Skipping %s: invalid name\n", file.FullPath)
+				continue
+			}
+			childRel := path.Join(rel, file.Name)
+			childLocal := filepath.Join(local, file.Name)
+			if file.IsDir {
+				if file.IsJunction || !filter.enterDir(childRel, depth+1) {
+					continue
+				}
+				childMade, err := walk(file.FullPath, childRel, childLocal, depth+1)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to download %s: %s\n", file.FullPath, err)
+					failed++
+				}
+				made = made || childMade
+				continue
+			}
+			if !filter.wantFile(childRel, file) {
+				continue
+			}
+			if !made {
+				if err = os.MkdirAll(local, 0755); err != nil {
+					return
+				}
+				made = true
+			}
+			if err := downloadFile(conn, share, file, childLocal); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to download %s: %s\n", file.FullPath, err)
+				failed++
+				continue
+			}
+			if *jsonOutput {
+				record := newFileRecord(t, file)
+				record.Local = childLocal
+				emit(record)
+			} else {
+				fmt.Println(childRel)
+			}
+		}
+		if made {
+			// Set the directory times last since creating its entries updates them
+			err = os.Chtimes(local, time.Time{}, lastWriteTime(files, "."))
+		}
+		return
+	}
+	_, err = walk(t.path, "", local, 0)
+	return
+}
+
+// lastWriteTime returns the modification time of the named entry of a
+// directory listing
+func lastWriteTime(files []smb.SharedFile, name string) time.Time {
+	for i := range files {
+		if files[i].Name == name {
+			return files[i].Modified()
+		}
+	}
+	return time.Time{}
+}
+
+// downloadFile downloads a file and sets its local times to the remote ones
+func downloadFile(conn *smb.Connection, share string, file *smb.SharedFile, local string) (err error) {
+	out, err := os.Create(local)
+	if err != nil {
+		return
+	}
+	err = conn.RetrieveFile(share, file.FullPath, 0, out.Write)
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(local)
+		return
+	}
+	return os.Chtimes(local, file.Accessed(), file.Modified())
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+func TestDownloadFilter(t *testing.T) {
+	f, err := newDownloadFilter([]string{"*.DOCX", "scripts/*.ps1"}, []string{"~$*", "Archive"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.maxSize = 1000
+	file := &smb.SharedFile{Size: 10}
+	for _, test := range []struct {
+		rel  string
+		want bool
+	}{
+		{"report.docx", true},
+		{"dir/Report.Docx", true},
+		{"dir/~$report.docx", false},
+		{"scripts/run.ps1", true},
+		{"other/scripts/run.ps1", false},
+		{"notes.txt", false},
+	} {
+		if f.wantFile(test.rel, file) != test.want {
+			t.Fatalf("Fail: %s", test.rel)
+		}
+	}
+	if f.wantFile("big.docx", &smb.SharedFile{Size: 1001}) {
+		t.Fatal("Fail")
+	}
+	if f.enterDir("dir/archive", 1) || !f.enterDir("dir/current", 1) {
+		t.Fatal("Fail")
+	}
+	f.maxDepth = 2
+	if !f.enterDir("a", 1) || f.enterDir("a/b", 2) {
+		t.Fatal("Fail")
+	}
+
+	f, err = newDownloadFilter([]string{`^logs/.*\.log$`}, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.wantFile("logs/app.log", file) || f.wantFile("old/logs/app.log", file) {
+		t.Fatal("Fail")
+	}
+	if _, err = newDownloadFilter([]string{"[a-"}, nil, false); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestParseSizeAndNewer(t *testing.T) {
+	for in, expected := range map[string]uint64{"512": 512, "10k": 10 << 10, "3M": 3 << 20, "1G": 1 << 30} {
+		if n, err := parseSize(in); err != nil || n != expected {
+			t.Fatalf("Fail: %s", in)
+		}
+	}
+	if _, err := parseSize("M"); err == nil {
+		t.Fatal("Fail")
+	}
+
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.Local)
+	for in, expected := range map[string]time.Time{
+		"2024-05-01": time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local),
+		"7d":         now.AddDate(0, 0, -7),
+		"36h":        now.Add(-36 * time.Hour),
+	} {
+		if ts, err := parseNewer(in, now); err != nil || !ts.Equal(expected) {
+			t.Fatalf("Fail: %s %v", in, ts)
+		}
+	}
+	if _, err := parseNewer("yesterday", now); err == nil {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/ericblavier/go-smb/smb/dcerpc/mslsad"
+)
+
+// Return codes of LsarLookupSids2 when only some or none of the SIDs map to
+// an account
+const (
+	statusSomeNotMapped uint32 = 0x00000107
+	statusNoneMapped    uint32 = 0xc0000073
+)
+
+// Record of an account printed in JSON mode
+type accountRecord struct {
+	Name   string `json:"name"` // DOMAIN\name
+	RID    uint32 `json:"rid"`
+	SID    string `json:"sid,omitempty"`
+	Type   string `json:"type"`   // User, Group, Alias, ...
+	Source string `json:"source"` // samr or lsa
+}
+
+// lsaAccounts converts the result of looking up the SIDs of a domain to
+// account records, skipping the SIDs that did not map to an account
+func lsaAccounts(res mslsad.SidTranslations) (accounts []accountRecord) {
+	for _, name := range res.TranslatedNames {
+		if name.Use == mslsad.SidTypeUnknown || name.Use == mslsad.SidTypeInvalid || name.Name == "" {
+			continue
+		}
+		account := accountRecord{
+			Name:   name.Name,
+			SID:    name.Sid,
+			Type:   strings.TrimPrefix(mslsad.SidNameUseMap[name.Use], "SidType"),
+			Source: "lsa",
+		}
+		if name.DomainIndex >= 0 && int(name.DomainIndex) < len(res.ReferencedDomains) {
+			account.Name = res.ReferencedDomains[name.DomainIndex].Name + `\` + name.Name
+		}
+		fmt.Sscan(name.Sid[strings.LastIndex(name.Sid, "-")+1:], &account.RID)
+		accounts = append(accounts, account)
+	}
+	return
+}
+
+// samrUsers enumerates the users of the account domain over SAMR
+func samrUsers(conn *smb.Connection) (accounts []accountRecord, err error) {
+	rpccon, domainHandle, domainName, err := openAccountDomain(conn)
+	if err != nil {
+		return
+	}
+	users, err := rpccon.SamrEnumDomainUsers(domainHandle, 0, 0)
+	if err != nil {
+		return
+	}
+	for _, user := range users {
+		accounts = append(accounts, accountRecord{
+			Name:   domainName + `\` + user.Name,
+			RID:    user.RelativeId,
+			Type:   "User",
+			Source: "samr",
+		})
+	}
+	return
+}
+
+// lsaCycleRIDs looks up the SIDs of the account domain with RIDs from start
+// to end in batches, waiting delay between the lookups
+func lsaCycleRIDs(conn *smb.Connection, start, end, batch uint32, delay time.Duration) (accounts []accountRecord, err error) {
+	share := "IPC$"
+	if err = conn.TreeConnect(share); err != nil {
+		return
+	}
+	f, err := conn.OpenFile(share, mslsad.MSRPCLsaRpcPipe)
+	if err != nil {
+		return
+	}
+	defer f.CloseFile()
+	bind, err := dcerpc.Bind(f, mslsad.MSRPCUuidLsaRpc, mslsad.MSRPCLsaRpcMajorVersion, mslsad.MSRPCLsaRpcMinorVersion, dcerpc.MSRPCUuidNdr)
+	if err != nil {
+		return
+	}
+	rpccon := mslsad.NewRPCCon(bind)
+	info, err := rpccon.GetAccountDomainInfo()
+	if err != nil {
+		return
+	}
+	domainSid := info.Sid.ToString()
+
+	for first := start; first <= end; first += batch {
+		if first != start && delay > 0 {
+			time.Sleep(delay)
+		}
+		var sids []string
+		for rid := first; rid <= end && rid < first+batch; rid++ {
+			sids = append(sids, fmt.Sprintf("%s-%d", domainSid, rid))
+		}
+		res, err := rpccon.LsarLookupSids2(mslsad.LsapLookupWksta, sids)
+		if err != nil {
+			return accounts, err
+		}
+		if res.ReturnCode != 0 && res.ReturnCode != statusSomeNotMapped && res.ReturnCode != statusNoneMapped {
+			return accounts, fmt.Errorf("LsarLookupSids2 failed with status 0x%08x", res.ReturnCode)
+		}
+		accounts = append(accounts, lsaAccounts(res)...)
+	}
+	return
+}
+
+func runEnumusers(args []string) error {
+	fs := flag.NewFlagSet("enumusers", flag.ExitOnError)
+	method := fs.String("method", "auto", "samr, lsa or auto to use LSA RID cycling when SAMR enumeration is denied")
+	start := fs.Uint("start", 500, "First RID looked up by LSA RID cycling")
+	end := fs.Uint("end", 4000, "Last RID looked up by LSA RID cycling")
+	batch := fs.Uint("batch", 100, "Number of SIDs per LSA lookup")
+	delay := fs.Duration("delay", 0, "Time to wait between LSA lookups")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Usage: enumusers [-method samr|lsa|auto] [-start rid] [-end rid] [-batch n] [-delay duration] <host>")
+	}
+	if *method != "samr" && *method != "lsa" && *method != "auto" {
+		return fmt.Errorf("Invalid method %s", *method)
+	}
+	if *batch == 0 || *start > *end {
+		return fmt.Errorf("Invalid RID range or batch size")
+	}
+
+	conn, err := connect(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var accounts []accountRecord
+	if *method != "lsa" {
+		accounts, err = samrUsers(conn)
+		if err != nil && *method == "auto" {
+			fmt.Fprintf(os.Stderr, "SAMR enumeration failed, falling back to LSA RID cycling: %s\n", err)
+		}
+	}
+	if *method == "lsa" || *method == "auto" && err != nil {
+		accounts, err = lsaCycleRIDs(conn, uint32(*start), uint32(*end), uint32(*batch), *delay)
+	}
+	if err != nil && len(accounts) == 0 {
+		return err
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Enumeration stopped early: %s\n", err)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].RID < accounts[j].RID })
+	for _, account := range accounts {
+		if *jsonOutput {
+			emit(account)
+			continue
+		}
+		fmt.Printf("  %-8d %-10s %s\n", account.RID, account.Type, account.Name)
+	}
+	return nil
+}
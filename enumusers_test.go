@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/dcerpc/mslsad"
+)
+
+func TestLSAAccounts(t *testing.T) {
+	res := mslsad.SidTranslations{
+		ReferencedDomains: []mslsad.DomainTranslation{{Name: "CORP", Sid: "S-1-5-21-1-2-3"}},
+		TranslatedNames: []mslsad.SidNameTranslation{
+			{Use: mslsad.SidTypeUser, Name: "Administrator", Sid: "S-1-5-21-1-2-3-500", DomainIndex: 0},
+			{Use: mslsad.SidTypeUnknown, Name: "", Sid: "S-1-5-21-1-2-3-503", DomainIndex: -1},
+			{Use: mslsad.SidTypeGroup, Name: "Domain Admins", Sid: "S-1-5-21-1-2-3-512", DomainIndex: 0},
+		},
+	}
+	want := []accountRecord{
+		{Name: `CORP\Administrator`, RID: 500, SID: "S-1-5-21-1-2-3-500", Type: "User", Source: "lsa"},
+		{Name: `CORP\Domain Admins`, RID: 512, SID: "S-1-5-21-1-2-3-512", Type: "Group", Source: "lsa"},
+	}
+	if got := lsaAccounts(res); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Fail: %+v", got)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/ericblavier/go-smb/smb/dcerpc/mseven"
+)
+
+// Names of the event types of MS-EVEN Section 2.2.3
+var eventTypes = map[uint16]string{
+	mseven.EventLogSuccess:      "Success",
+	mseven.EventLogErrorType:    "Error",
+	mseven.EventLogWarningType:  "Warning",
+	mseven.EventLogInformation:  "Information",
+	mseven.EventLogAuditSuccess: "AuditSuccess",
+	mseven.EventLogAuditFailure: "AuditFailure",
+}
+
+// Record of an event printed in JSON mode
+type eventRecord struct {
+	Record   uint32    `json:"record"`
+	Time     time.Time `json:"time"`
+	EventID  uint16    `json:"event_id"`
+	Type     string    `json:"type"`
+	Category uint16    `json:"category"`
+	Source   string    `json:"source"`
+	Computer string    `json:"computer"`
+	User     string    `json:"user,omitempty"`
+	Strings  []string  `json:"strings,omitempty"`
+}
+
+func newEventRecord(r *mseven.EventLogRecord) eventRecord {
+	record := eventRecord{
+		Record:   r.RecordNumber,
+		Time:     r.TimeGenerated,
+		EventID:  r.Code(),
+		Type:     eventTypes[r.EventType],
+		Category: r.EventCategory,
+		Source:   r.SourceName,
+		Computer: r.ComputerName,
+		Strings:  r.Strings,
+	}
+	if record.Type == "" {
+		record.Type = fmt.Sprintf("0x%x", r.EventType)
+	}
+	if r.UserSid != nil {
+		record.User = r.UserSid.ToString()
+	}
+	return record
+}
+
+// eventFilter selects events by field. An event matches when every field
+// matches one of its values.
+type eventFilter map[string][]string
+
+// Fields an event can be filtered on
+var eventFilterFields = []string{"eventid", "type", "source", "computer", "user", "text"}
+
+// parseEventFilters parses filters of the form Field=value[,value...]
+func parseEventFilters(filters []string) (eventFilter, error) {
+	f := eventFilter{}
+	for _, filter := range filters {
+		key, value, found := strings.Cut(filter, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		known := false
+		for _, field := range eventFilterFields {
+			known = known || key == field
+		}
+		if !found || !known {
+			return nil, fmt.Errorf("Invalid filter %s. Expecting Field=value with Field one of EventID, Type, Source, Computer, User or Text", filter)
+		}
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			if key == "eventid" {
+				if _, err := strconv.ParseUint(v, 10, 16); err != nil {
+					return nil, fmt.Errorf("Invalid event id %s", v)
+				}
+			}
+			f[key] = append(f[key], v)
+		}
+	}
+	return f, nil
+}
+
+func (f eventFilter) match(r *eventRecord) bool {
+	for key, values := range f {
+		matched := false
+		for _, v := range values {
+			switch key {
+			case "eventid":
+				matched = strconv.Itoa(int(r.EventID)) == v
+			case "type":
+				matched = strings.EqualFold(r.Type, v)
+			case "source":
+				matched = strings.EqualFold(r.Source, v)
+			case "computer":
+				matched = strings.EqualFold(r.Computer, v)
+			case "user":
+				matched = strings.EqualFold(r.User, v)
+			case "text":
+				matched = strings.Contains(strings.ToLower(strings.Join(r.Strings, " ")), strings.ToLower(v))
+			}
+			if matched {
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func printEvent(r *eventRecord) {
+	if *jsonOutput {
+		emit(r)
+		return
+	}
+	user := r.User
+	if user == "" {
+		user = "-"
+	}
+	fmt.Printf("%s  %-5d %-12s %s  %s  %s\n", r.Time.Format(time.DateTime), r.EventID, r.Type, r.Source, user, strings.Join(r.Strings, " | "))
+}
+
+func bindEventLog(conn *smb.Connection) (*mseven.RPCCon, error) {
+	share := "IPC$"
+	if err := conn.TreeConnect(share); err != nil {
+		return nil, err
+	}
+	f, err := conn.OpenFile(share, mseven.MSRPCEventLogPipe)
+	if err != nil {
+		return nil, err
+	}
+	bind, err := dcerpc.Bind(f, mseven.MSRPCUuidEventLog, mseven.MSRPCEventLogMajorVersion, mseven.MSRPCEventLogMinorVersion, dcerpc.MSRPCUuidNdr)
+	if err != nil {
+		f.CloseFile()
+		return nil, err
+	}
+	return mseven.NewRPCCon(bind), nil
+}
+
+// eventTail reads the records of an event log that are added over time
+type eventTail struct {
+	rpccon *mseven.RPCCon
+	handle []byte
+	next   uint32 // Number of the next record to read
+}
+
+// bounds returns the numbers of the oldest record and of the record after
+// the newest one
+func (t *eventTail) bounds() (oldest, end uint32, err error) {
+	if oldest, err = t.rpccon.OldestRecord(t.handle); err != nil {
+		return
+	}
+	count, err := t.rpccon.NumberOfRecords(t.handle)
+	return oldest, oldest + count, err
+}
+
+// read returns the records from next up to the newest one
+func (t *eventTail) read() (records []mseven.EventLogRecord, err error) {
+	oldest, end, err := t.bounds()
+	if err != nil {
+		return
+	}
+	if t.next < oldest {
+		// The records were overwritten or the log was cleared
+		t.next = oldest
+	}
+	for t.next < end {
+		batch, err := t.rpccon.ReadEventLog(t.handle, mseven.EventLogSeekRead|mseven.EventLogForwardsRead, t.next)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return records, err
+		}
+		for _, r := range batch {
+			if r.RecordNumber >= t.next {
+				records = append(records, r)
+				t.next = r.RecordNumber + 1
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+	}
+	return
+}
+
+func runEventlog(args []string) error {
+	if len(args) < 1 || args[0] != "tail" {
+		return fmt.Errorf("Usage: eventlog tail [-n count] [-f] [-interval duration] [-filter Field=value]... <host> <log>")
+	}
+	var filters patternList
+	fs := flag.NewFlagSet("eventlog tail", flag.ExitOnError)
+	count := fs.Uint("n", 10, "Number of the newest records to print before following")
+	follow := fs.Bool("f", false, "Keep printing new records as they are written")
+	interval := fs.Duration("interval", 2*time.Second, "Time between queries for new records with -f")
+	fs.Var(&filters, "filter", "Only print events with a field matching a value, e.g. EventID=4624,4625 (repeatable, fields: EventID, Type, Source, Computer, User, Text)")
+	fs.Parse(args[1:])
+	if fs.NArg() != 2 {
+		return fmt.Errorf("Usage: eventlog tail [-n count] [-f] [-interval duration] [-filter Field=value]... <host> <log>")
+	}
+	filter, err := parseEventFilters(filters)
+	if err != nil {
+		return err
+	}
+
+	conn, err := connect(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	rpccon, err := bindEventLog(conn)
+	if err != nil {
+		return err
+	}
+	handle, err := rpccon.OpenEventLog(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	tail := &eventTail{rpccon: rpccon, handle: handle}
+	defer func() {
+		rpccon.CloseEventLog(tail.handle)
+	}()
+	oldest, end, err := tail.bounds()
+	if err != nil {
+		return err
+	}
+	tail.next = oldest
+	// Without filters only the last records are read while with filters the
+	// whole log is read and the last matching records printed
+	if len(filter) == 0 && end-oldest > uint32(*count) {
+		tail.next = end - uint32(*count)
+	}
+	records, err := tail.read()
+	if err != nil {
+		return err
+	}
+	var matched []eventRecord
+	for i := range records {
+		if r := newEventRecord(&records[i]); filter.match(&r) {
+			matched = append(matched, r)
+		}
+	}
+	if len(matched) > int(*count) {
+		matched = matched[len(matched)-int(*count):]
+	}
+	for i := range matched {
+		printEvent(&matched[i])
+	}
+
+	for *follow {
+		time.Sleep(*interval)
+		records, err := tail.read()
+		if err == mseven.ResponseCodeMap[mseven.StatusEventlogFileChanged] {
+			// The log was cleared, reopen it to read the new records
+			rpccon.CloseEventLog(tail.handle)
+			if tail.handle, err = rpccon.OpenEventLog(fs.Arg(1)); err != nil {
+				return err
+			}
+			tail.next = 0
+			continue
+		}
+		for i := range records {
+			if r := newEventRecord(&records[i]); filter.match(&r) {
+				printEvent(&r)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestEventFilter(t *testing.T) {
+	filter, err := parseEventFilters([]string{"EventID=4624,4625", "type=auditsuccess", "Text=admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := eventRecord{EventID: 4624, Type: "AuditSuccess", Strings: []string{"S-1-5-18", "Administrator"}}
+	if !filter.match(&r) {
+		t.Fatal("Fail")
+	}
+	r.EventID = 4634
+	if filter.match(&r) {
+		t.Fatal("Fail")
+	}
+	r.EventID, r.Strings = 4625, []string{"guest"}
+	if filter.match(&r) {
+		t.Fatal("Fail")
+	}
+	if empty, _ := parseEventFilters(nil); !empty.match(&r) {
+		t.Fatal("Fail")
+	}
+
+	for _, invalid := range []string{"EventID", "Level=2", "EventID=x"} {
+		if _, err = parseEventFilters([]string{invalid}); err == nil {
+			t.Fatalf("Fail: %s", invalid)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc/msscmr"
+)
+
+// Time to wait for the service binary to create its named pipe
+const execPipeTimeout = 30 * time.Second
+
+// Record of a command run by exec, atexec or wmiexec printed in JSON mode
+type execRecord struct {
+	Service string `json:"service,omitempty"`
+	Task    string `json:"task,omitempty"`
+	PID     uint32 `json:"pid,omitempty"`
+	Command string `json:"command"`
+	Output  string `json:"output,omitempty"`
+	Status  string `json:"status"`
+}
+
+// quoteArg quotes a command line argument the way CommandLineToArgvW parses
+// it
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"") {
+		return arg
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	slashes := 0
+	for _, c := range arg {
+		switch c {
+		case '\\':
+			slashes++
+			continue
+		case '"':
+			// Backslashes before a quote are escaped along with the quote
+			b.WriteString(strings.Repeat(`\`, 2*slashes+1))
+		default:
+			b.WriteString(strings.Repeat(`\`, slashes))
+		}
+		slashes = 0
+		b.WriteRune(c)
+	}
+	b.WriteString(strings.Repeat(`\`, 2*slashes))
+	b.WriteByte('"')
+	return b.String()
+}
+
+// serviceCommandLine builds the binary path of a service from a program and
+// its arguments
+func serviceCommandLine(program string, args []string) string {
+	parts := []string{quoteArg(program)}
+	for _, arg := range args {
+		parts = append(parts, quoteArg(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// randomServiceName returns a service name unlikely to collide with an
+// existing service
+func randomServiceName() (string, error) {
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return "smb" + hex.EncodeToString(random), nil
+}
+
+// relayPipe copies stdin to the pipe in the background and the pipe to
+// stdout until the other end closes the pipe
+func relayPipe(pipe io.ReadWriter, stdin io.Reader, stdout io.Writer) error {
+	if stdin != nil {
+		go io.Copy(pipe, stdin)
+	}
+	_, err := io.Copy(stdout, pipe)
+	return err
+}
+
+// openPipe opens a named pipe, retrying until the service has created it or
+// the timeout passes
+func openPipe(conn *smb.Connection, name string) (p *smb.Pipe, err error) {
+	deadline := time.Now().Add(execPipeTimeout)
+	for {
+		p, err = conn.OpenPipe(name)
+		if err == nil || time.Now().After(deadline) {
+			return
+		}
+		if err != smb.StatusMap[smb.StatusObjectNameNotFound] && err != smb.StatusMap[smb.StatusPipeNotAvailable] {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// removeBinary deletes the uploaded service binary, retrying while the
+// exiting process still holds it open
+func removeBinary(conn *smb.Connection, path string) {
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = conn.DeleteFile("ADMIN$", path); err == nil {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+	fmt.Fprintf(os.Stderr, "Failed to remove ADMIN$\\%s: %s\n", path, err)
+}
+
+func runExec(args []string) error {
+	fs := flag.NewFlagSet("exec", flag.ExitOnError)
+	binary := fs.String("binary", "", "Local service binary uploaded to ADMIN$ and run")
+	binPath := fs.String("binpath", "", "Program already on the host to run instead of uploading a binary")
+	name := fs.String("name", "", "Service name, random by default")
+	pipe := fs.String("pipe", "", "Named pipe created by the service to relay stdin and stdout over")
+	keep := fs.Bool("keep", false, "Leave the service and the uploaded binary on the host")
+	fs.Parse(args)
+	if fs.NArg() < 1 || (*binary == "") == (*binPath == "") {
+		return fmt.Errorf("Usage: exec -binary file|-binpath program [-name service] [-pipe name] [-keep] <host> [args...]")
+	}
+	host := fs.Arg(0)
+	if *name == "" {
+		var err error
+		if *name, err = randomServiceName(); err != nil {
+			return err
+		}
+	}
+
+	conn, err := connect(host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	program := *binPath
+	if *binary != "" {
+		in, err := os.Open(*binary)
+		if err != nil {
+			return err
+		}
+		remote := *name + filepath.Ext(*binary)
+		err = conn.PutFile("ADMIN$", remote, 0, in.Read)
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("Failed to upload %s to ADMIN$: %s", *binary, err)
+		}
+		if !*keep {
+			defer removeBinary(conn, remote)
+		}
+		program = `%SystemRoot%\` + remote
+	}
+	command := serviceCommandLine(program, fs.Args()[1:])
+
+	rpccon, err := bindServiceManager(conn)
+	if err != nil {
+		return err
+	}
+	err = rpccon.CreateService(*name, msscmr.ServiceWin32OwnProcess, msscmr.ServiceDemandStart, msscmr.ServiceErrorIgnore, command, "", "", *name, false)
+	if err != nil {
+		return fmt.Errorf("Failed to create service %s: %s", *name, err)
+	}
+	if !*keep {
+		defer func() {
+			if err := rpccon.DeleteService(*name); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to delete service %s: %s\n", *name, err)
+			}
+		}()
+	}
+	fmt.Fprintf(os.Stderr, "Created service %s running %s\n", *name, command)
+
+	// The start request only returns once the service reports that it is
+	// running, so it runs concurrently with the relay
+	started := make(chan error, 1)
+	go func() {
+		started <- rpccon.StartService(*name, nil)
+	}()
+
+	var output bytes.Buffer
+	var stdout io.Writer = os.Stdout
+	if *jsonOutput {
+		stdout = &output
+	}
+	var relayErr error
+	if *pipe != "" {
+		var p *smb.Pipe
+		if p, relayErr = openPipe(conn, *pipe); relayErr != nil {
+			relayErr = fmt.Errorf("Failed to open pipe %s: %s", *pipe, relayErr)
+		} else {
+			relayErr = relayPipe(p, os.Stdin, stdout)
+			p.Close()
+		}
+	}
+
+	// Programs that are not services are killed when they fail to report
+	// running in time, which is expected when running a plain executable.
+	// The cleanup must also wait for the start request on the shared binding.
+	err = <-started
+	if relayErr != nil {
+		return relayErr
+	}
+	if err != nil && !errors.Is(err, msscmr.ServiceResponseCodeMap[msscmr.ErrorServiceRequestTimeout]) {
+		return fmt.Errorf("Failed to start service %s: %s", *name, err)
+	}
+	if *jsonOutput {
+		return emit(execRecord{Service: *name, Command: command, Output: output.String(), Status: "ok"})
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestServiceCommandLine(t *testing.T) {
+	cases := []struct {
+		program string
+		args    []string
+		want    string
+	}{
+		{`%SystemRoot%\svc.exe`, nil, `%SystemRoot%\svc.exe`},
+		{`C:\Program Files\app.exe`, []string{"-v"}, `"C:\Program Files\app.exe" -v`},
+		{"cmd.exe", []string{"/c", "echo hi > C:\\out dir\\"}, `cmd.exe /c "echo hi > C:\out dir\\"`},
+		{"app.exe", []string{`say "hi"`, ""}, `app.exe "say \"hi\"" ""`},
+		{"app.exe", []string{`a\"b`}, `app.exe "a\\\"b"`},
+	}
+	for _, c := range cases {
+		if got := serviceCommandLine(c.program, c.args); got != c.want {
+			t.Fatalf("Fail: %q %q: %s != %s", c.program, c.args, got, c.want)
+		}
+	}
+}
+
+// A pipe returning canned output and recording the input
+type fakePipe struct {
+	io.Reader
+	in bytes.Buffer
+}
+
+func (p *fakePipe) Write(b []byte) (int, error) {
+	return p.in.Write(b)
+}
+
+func TestRelayPipe(t *testing.T) {
+	pipe := &fakePipe{Reader: strings.NewReader("output\n")}
+	var stdout bytes.Buffer
+	if err := relayPipe(pipe, nil, &stdout); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if stdout.String() != "output\n" {
+		t.Fatalf("Fail: %q", stdout.String())
+	}
+}
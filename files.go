@@ -0,0 +1,464 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb"
+)
+
+const timeFormat = "Mon Jan _2 15:04:05 2006"
+
+// Record of a remote file printed in JSON mode
+type fileRecord struct {
+	Path     string    `json:"path"` // As //host/share/path
+	Name     string    `json:"name"`
+	Dir      bool      `json:"dir"`
+	Hidden   bool      `json:"hidden,omitempty"`
+	ReadOnly bool      `json:"readonly,omitempty"`
+	Size     uint64    `json:"size"`
+	Created  time.Time `json:"created"`
+	Accessed time.Time `json:"accessed"`
+	Modified time.Time `json:"modified"`
+	Changed  time.Time `json:"changed"`
+	Local    string    `json:"local,omitempty"` // Destination of a download
+}
+
+// newFileRecord describes a file of a directory listing of the share of t
+func newFileRecord(t target, file *smb.SharedFile) fileRecord {
+	t.path = file.FullPath
+	return fileRecord{
+		Path:     t.String(),
+		Name:     file.Name,
+		Dir:      file.IsDir,
+		Hidden:   file.IsHidden,
+		ReadOnly: file.IsReadOnly,
+		Size:     file.Size,
+		Created:  file.Created(),
+		Accessed: file.Accessed(),
+		Modified: file.Modified(),
+		Changed:  file.Changed(),
+	}
+}
+
+// targetArgs parses the flags of a subcommand taking exactly n targets as
+// arguments
+func targetArgs(name string, args []string, n int) (targets []target, err error) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != n {
+		return nil, fmt.Errorf("Expected %d arguments but got %d", n, fs.NArg())
+	}
+	for _, arg := range fs.Args() {
+		t, err := parseTarget(arg)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return
+}
+
+func runLs(args []string) error {
+	targets, err := targetArgs("ls", args, 1)
+	if err != nil {
+		return err
+	}
+	t := targets[0]
+	dir, pattern := t.path, "*"
+	if strings.ContainsAny(t.base(), "*?") {
+		pattern = t.base()
+		dir = strings.TrimSuffix(strings.TrimSuffix(t.path, pattern), `\`)
+	}
+
+	conn, err := connectShare(t)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	files, err := conn.ListDirectory(t.share, dir, pattern)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if *jsonOutput {
+			if file.Name != "." && file.Name != ".." {
+				emit(newFileRecord(t, &file))
+			}
+			continue
+		}
+		attr := "A"
+		if file.IsDir {
+			attr = "D"
+		}
+		if file.IsHidden {
+			attr += "H"
+		}
+		if file.IsReadOnly {
+			attr += "R"
+		}
+		fmt.Printf("  %-40s %-3s %12d  %s\n", file.Name, attr, file.Size, msdtyp.FiletimeToTime(file.LastWriteTime).Format(timeFormat))
+	}
+	return nil
+}
+
+func runGet(args []string) (err error) {
+	var include, exclude patternList
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	recursive := fs.Bool("r", false, "Recursively download a directory")
+	fs.Var(&include, "include", "Only download files matching the pattern (repeatable, requires -r)")
+	fs.Var(&exclude, "exclude", "Skip files and directories matching the pattern (repeatable, requires -r)")
+	useRegex := fs.Bool("regex", false, "Treat -include and -exclude patterns as regular expressions")
+	maxDepth := fs.Int("maxdepth", 0, "Maximum directory depth to descend, 0 for no limit")
+	maxSize := fs.String("maxsize", "", "Skip files larger than the size, e.g. 10M")
+	newer := fs.String("newer", "", "Only download files modified after a date (2006-01-02) or within an age (36h, 7d)")
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return fmt.Errorf("Usage: get [-r [filters]] //host/share/path [local path]")
+	}
+	t, err := parseTarget(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	local := t.base()
+	if local == "" {
+		local = t.share
+	}
+	if fs.NArg() == 2 {
+		local = fs.Arg(1)
+	}
+
+	var filter *downloadFilter
+	if *recursive {
+		if filter, err = newDownloadFilter(include, exclude, *useRegex); err != nil {
+			return err
+		}
+		filter.maxDepth = *maxDepth
+		if *maxSize != "" {
+			if filter.maxSize, err = parseSize(*maxSize); err != nil {
+				return err
+			}
+		}
+		if *newer != "" {
+			if filter.newer, err = parseNewer(*newer, time.Now()); err != nil {
+				return err
+			}
+		}
+	}
+
+	conn, err := connectShare(t)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if *recursive {
+		failed, err := downloadTree(conn, t, local, filter)
+		if err == nil && failed > 0 {
+			err = fmt.Errorf("%d files or directories could not be downloaded", failed)
+		}
+		return err
+	}
+
+	out, err := os.Create(local)
+	if err != nil {
+		return err
+	}
+	err = conn.RetrieveFile(t.share, t.path, 0, out.Write)
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	return emitDone("get", t.String())
+}
+
+func runPut(args []string) error {
+	fs := flag.NewFlagSet("put", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("Usage: put <local file> //host/share/path")
+	}
+	t, err := parseTarget(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if t.path == "" || strings.HasSuffix(fs.Arg(1), "/") || strings.HasSuffix(fs.Arg(1), `\`) {
+		// Upload into the directory with the local name
+		t.path = strings.TrimPrefix(t.path+`\`+filepath.Base(fs.Arg(0)), `\`)
+	}
+
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	conn, err := connectShare(t)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = conn.PutFile(t.share, t.path, 0, in.Read); err != nil {
+		return err
+	}
+	return emitDone("put", t.String())
+}
+
+func runRm(args []string) error {
+	targets, err := targetArgs("rm", args, 1)
+	if err != nil {
+		return err
+	}
+	conn, err := connectShare(targets[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = conn.DeleteFile(targets[0].share, targets[0].path); err != nil {
+		return err
+	}
+	return emitDone("rm", targets[0].String())
+}
+
+func runMkdir(args []string) error {
+	fs := flag.NewFlagSet("mkdir", flag.ExitOnError)
+	parents := fs.Bool("p", false, "Create missing parent directories")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Usage: mkdir [-p] //host/share/path")
+	}
+	t, err := parseTarget(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	conn, err := connectShare(t)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if *parents {
+		err = conn.MkdirAll(t.share, t.path)
+	} else {
+		err = conn.Mkdir(t.share, t.path)
+	}
+	if err != nil {
+		return err
+	}
+	return emitDone("mkdir", t.String())
+}
+
+func runRmdir(args []string) error {
+	targets, err := targetArgs("rmdir", args, 1)
+	if err != nil {
+		return err
+	}
+	conn, err := connectShare(targets[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = conn.DeleteDir(targets[0].share, targets[0].path); err != nil {
+		return err
+	}
+	return emitDone("rmdir", targets[0].String())
+}
+
+func runCat(args []string) error {
+	targets, err := targetArgs("cat", args, 1)
+	if err != nil {
+		return err
+	}
+	conn, err := connectShare(targets[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.RetrieveFile(targets[0].share, targets[0].path, 0, os.Stdout.Write)
+}
+
+func runStat(args []string) error {
+	targets, err := targetArgs("stat", args, 1)
+	if err != nil {
+		return err
+	}
+	t := targets[0]
+	conn, err := connectShare(t)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	fm, err := conn.Stat(t.share, t.path)
+	if err != nil {
+		return err
+	}
+	kind := "file"
+	if fm.Attributes&smb.FileAttrDirectory != 0 {
+		kind = "directory"
+	}
+	if *jsonOutput {
+		return emit(struct {
+			fileRecord
+			Attributes uint32 `json:"attributes"`
+		}{
+			fileRecord: fileRecord{
+				Path:     t.String(),
+				Name:     t.base(),
+				Dir:      kind == "directory",
+				Hidden:   fm.Attributes&smb.FileAttrHidden != 0,
+				ReadOnly: fm.Attributes&smb.FileAttrReadonly != 0,
+				Size:     fm.EndOfFile,
+				Created:  fm.Created(),
+				Accessed: fm.Accessed(),
+				Modified: fm.Modified(),
+				Changed:  fm.Changed(),
+			},
+			Attributes: fm.Attributes,
+		})
+	}
+	fmt.Printf("  Path:       %s\n", t)
+	fmt.Printf("  Type:       %s\n", kind)
+	fmt.Printf("  Size:       %d\n", fm.EndOfFile)
+	fmt.Printf("  Attributes: 0x%08x\n", fm.Attributes)
+	for _, ts := range []struct {
+		name string
+		t    time.Time
+	}{
+		{"Created", fm.Created()},
+		{"Accessed", fm.Accessed()},
+		{"Modified", fm.Modified()},
+		{"Changed", fm.Changed()},
+	} {
+		fmt.Printf("  %-11s %s\n", ts.name+":", ts.t.Format(timeFormat))
+	}
+	return nil
+}
+
+func runMv(args []string) error {
+	fs := flag.NewFlagSet("mv", flag.ExitOnError)
+	force := fs.Bool("f", false, "Replace an existing destination")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("Usage: mv [-f] //host/share/path //host/share/newpath")
+	}
+	src, err := parseTarget(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	dst, err := parseTarget(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(src.host, dst.host) || !strings.EqualFold(src.share, dst.share) {
+		return fmt.Errorf("Files can only be moved within a share")
+	}
+	conn, err := connectShare(src)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = conn.Rename(src.share, src.path, dst.path, *force); err != nil {
+		return err
+	}
+	return emitDone("mv", dst.String())
+}
+
+// Layouts accepted for the timestamps of touch, in local time unless the
+// layout has a zone
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseTimestamp parses a timestamp given on the command line. An empty
+// string returns the zero Time which leaves the timestamp unchanged.
+func parseTimestamp(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid timestamp %s. Expecting YYYY-MM-DD [hh:mm:ss] or RFC 3339", s)
+}
+
+func runTouch(args []string) error {
+	fs := flag.NewFlagSet("touch", flag.ExitOnError)
+	all := fs.String("all", "", "Set all four timestamps to this time")
+	createdStr := fs.String("created", "", "Creation time")
+	modifiedStr := fs.String("modified", "", "Last write time")
+	accessedStr := fs.String("accessed", "", "Last access time")
+	changedStr := fs.String("changed", "", "Change time")
+	ref := fs.String("ref", "", "Copy the timestamps of another file //host/share/path on the same host")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Usage: touch [-all time] [-created time] [-modified time] [-accessed time] [-changed time] [-ref //host/share/path] //host/share/path")
+	}
+	t, err := parseTarget(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var times [4]time.Time // Created, modified, accessed and changed
+	if times[0], err = parseTimestamp(*all); err != nil {
+		return err
+	}
+	times[1], times[2], times[3] = times[0], times[0], times[0]
+	for i, s := range []string{*createdStr, *modifiedStr, *accessedStr, *changedStr} {
+		if s == "" {
+			continue
+		}
+		if times[i], err = parseTimestamp(s); err != nil {
+			return err
+		}
+	}
+
+	var refTarget target
+	if *ref != "" {
+		if refTarget, err = parseTarget(*ref); err != nil {
+			return err
+		}
+		if !strings.EqualFold(refTarget.host, t.host) {
+			return fmt.Errorf("The reference file must be on the same host")
+		}
+	}
+
+	conn, err := connectShare(t)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if *ref != "" {
+		if err = conn.TreeConnect(refTarget.share); err != nil {
+			return err
+		}
+		fm, err := conn.Stat(refTarget.share, refTarget.path)
+		if err != nil {
+			return err
+		}
+		// Timestamps given explicitly take precedence over the reference
+		for i, ts := range []time.Time{fm.Created(), fm.Modified(), fm.Accessed(), fm.Changed()} {
+			if times[i].IsZero() {
+				times[i] = ts
+			}
+		}
+	}
+	if times == [4]time.Time{} {
+		// Like touch, default to updating the write and access times
+		now := time.Now()
+		times[1], times[2] = now, now
+	}
+
+	if err = conn.SetFileTimes(t.share, t.path, times[0], times[1], times[2], times[3]); err != nil {
+		return err
+	}
+	return emitDone("touch", t.String())
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	ts, err := parseTimestamp("")
+	if err != nil || !ts.IsZero() {
+		t.Fatalf("Fail: %v %v", ts, err)
+	}
+	ts, err = parseTimestamp("2021-03-04T10:20:30Z")
+	if err != nil || !ts.Equal(time.Date(2021, 3, 4, 10, 20, 30, 0, time.UTC)) {
+		t.Fatalf("Fail: %v %v", ts, err)
+	}
+	ts, err = parseTimestamp("2021-03-04 10:20:30")
+	if err != nil || !ts.Equal(time.Date(2021, 3, 4, 10, 20, 30, 0, time.Local)) {
+		t.Fatalf("Fail: %v %v", ts, err)
+	}
+	ts, err = parseTimestamp("2021-03-04")
+	if err != nil || !ts.Equal(time.Date(2021, 3, 4, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("Fail: %v %v", ts, err)
+	}
+	if _, err = parseTimestamp("yesterday"); err == nil {
+		t.Fatal("Fail")
+	}
+}
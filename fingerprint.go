@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+// Names of the SMB 3.1.1 encryption ciphers
+var cipherNames = map[uint16]string{
+	smb.AES128CCM: "AES-128-CCM",
+	smb.AES128GCM: "AES-128-GCM",
+	smb.AES256CCM: "AES-256-CCM",
+	smb.AES256GCM: "AES-256-GCM",
+}
+
+// Fingerprint of a host printed as a row or, in JSON mode, as a record
+type fingerprintRecord struct {
+	Host            string `json:"host"`
+	ComputerName    string `json:"computer_name,omitempty"`
+	DomainName      string `json:"domain_name,omitempty"`
+	DnsComputerName string `json:"dns_computer_name,omitempty"`
+	DnsDomainName   string `json:"dns_domain_name,omitempty"`
+	OSVersion       string `json:"os_version,omitempty"`
+	OSBuild         int    `json:"os_build,omitempty"`
+	Dialect         string `json:"dialect,omitempty"`
+	Signing         string `json:"signing,omitempty"` // required, enabled or disabled
+	Encryption      string `json:"encryption,omitempty"`
+	ClockSkew       string `json:"clock_skew,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+func newFingerprintRecord(host string, res *smb.FingerprintResult) fingerprintRecord {
+	record := fingerprintRecord{Host: host, Dialect: getDialectName(res.Dialect), Signing: "disabled", Encryption: "no"}
+	switch {
+	case res.SigningRequired:
+		record.Signing = "required"
+	case res.SigningEnabled:
+		record.Signing = "enabled"
+	}
+	if name, found := cipherNames[res.Cipher]; found {
+		record.Encryption = name
+	} else if res.EncryptionSupported {
+		record.Encryption = "yes"
+	}
+	if !res.SystemTime.IsZero() {
+		record.ClockSkew = res.ClockSkew.String()
+	}
+	if info := res.TargetInfo; info != nil {
+		record.ComputerName = info.NBComputerName
+		record.DomainName = info.NBDomainName
+		record.DnsComputerName = info.DnsComputerName
+		record.DnsDomainName = info.DnsDomainName
+		record.OSVersion = info.GuessedOSVersion
+		record.OSBuild = int(info.OS >> 16 & 0xffff)
+	}
+	return record
+}
+
+// orDash returns "-" for empty table cells
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func printFingerprint(r *fingerprintRecord) {
+	if *jsonOutput {
+		emit(r)
+		return
+	}
+	if r.Error != "" {
+		fmt.Printf("%-20s error: %s\n", r.Host, r.Error)
+		return
+	}
+	build := "-"
+	if r.OSBuild != 0 {
+		build = fmt.Sprint(r.OSBuild)
+	}
+	fmt.Printf("%-20s %-16s %-16s %-24s %-6s %-10s %-9s %-12s %s\n", r.Host, orDash(r.ComputerName), orDash(r.DomainName), orDash(r.DnsDomainName), build, r.Dialect, r.Signing, r.Encryption, orDash(r.ClockSkew))
+}
+
+func runFingerprint(args []string) error {
+	fs := flag.NewFlagSet("fingerprint", flag.ExitOnError)
+	wait := fs.Duration("wait", 5*time.Second, "Time limit for connecting and fingerprinting each host")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		return fmt.Errorf("Usage: fingerprint [-wait duration] <host> [host...]")
+	}
+	if *threads < 1 {
+		return fmt.Errorf("-threads must be at least 1")
+	}
+	hosts := fs.Args()
+
+	// Hosts are fingerprinted concurrently and printed in the order given
+	records := make([]fingerprintRecord, len(hosts))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, *threads)
+	for i, host := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			res, err := smb.Fingerprint(host, smb.ProbeOptions{Port: *port, Timeout: *wait})
+			if err != nil {
+				records[i] = fingerprintRecord{Host: host, Error: err.Error()}
+				return
+			}
+			records[i] = newFingerprintRecord(host, res)
+		}()
+	}
+	wg.Wait()
+
+	if !*jsonOutput {
+		fmt.Printf("%-20s %-16s %-16s %-24s %-6s %-10s %-9s %-12s %s\n", "HOST", "NAME", "DOMAIN", "DNS DOMAIN", "BUILD", "DIALECT", "SIGNING", "ENCRYPTION", "SKEW")
+	}
+	failed := 0
+	for i := range records {
+		if records[i].Error != "" {
+			failed++
+		}
+		printFingerprint(&records[i])
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d hosts could not be fingerprinted", failed, len(hosts))
+	}
+	return nil
+}
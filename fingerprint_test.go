@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+func TestNewFingerprintRecord(t *testing.T) {
+	res := &smb.FingerprintResult{
+		ProbeResult: smb.ProbeResult{
+			Dialect:             smb.DialectSmb_3_1_1,
+			SigningEnabled:      true,
+			EncryptionSupported: true,
+			Cipher:              smb.AES128GCM,
+			SystemTime:          time.Now(),
+		},
+		ClockSkew: -90 * time.Second,
+		TargetInfo: &smb.TargetInfo{
+			NBComputerName:   "FS01",
+			NBDomainName:     "CORP",
+			OS:               10 | 20348<<16,
+			GuessedOSVersion: "Windows NT 10.0 Build 20348",
+		},
+	}
+	r := newFingerprintRecord("10.0.0.5", res)
+	if r.Signing != "enabled" || r.Encryption != "AES-128-GCM" || r.Dialect != "SMB 3.1.1" || r.ClockSkew != "-1m30s" {
+		t.Fatalf("Fail: %+v", r)
+	}
+	if r.ComputerName != "FS01" || r.DomainName != "CORP" || r.OSBuild != 20348 {
+		t.Fatalf("Fail: %+v", r)
+	}
+
+	// Without a challenge or server time
+	r = newFingerprintRecord("10.0.0.6", &smb.FingerprintResult{ProbeResult: smb.ProbeResult{Dialect: smb.DialectSmb_2_1, SigningRequired: true}})
+	if r.Signing != "required" || r.Encryption != "no" || r.ClockSkew != "" || r.OSBuild != 0 {
+		t.Fatalf("Fail: %+v", r)
+	}
+}
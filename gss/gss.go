@@ -1,6 +1,8 @@
 package gss
 
 import (
+	"fmt"
+
 	"github.com/jfjallid/gofork/encoding/asn1"
 
 	"github.com/ericblavier/go-smb/smb/encoder"
@@ -157,3 +159,28 @@ func (g *gsswrapped) MarshalBinary(meta *encoder.Metadata) ([]byte, error) {
 	buf[0] = 0xa1
 	return buf, nil
 }
+
+// DecodeToken decodes a SPNEGO token into a *NegTokenInit or *NegTokenResp
+// according to its tag. It is meant for tools and fuzzing and must not panic
+// on any input.
+func DecodeToken(buf []byte) (token any, err error) {
+	if len(buf) == 0 {
+		return nil, fmt.Errorf("Empty SPNEGO token")
+	}
+	switch buf[0] {
+	case 0x60:
+		init := &NegTokenInit{}
+		err = init.UnmarshalBinary(buf, nil)
+		token = init
+	case 0xa1:
+		resp := &NegTokenResp{}
+		err = resp.UnmarshalBinary(buf, nil)
+		token = resp
+	default:
+		return nil, fmt.Errorf("Unknown SPNEGO token tag 0x%x", buf[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return
+}
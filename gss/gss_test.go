@@ -0,0 +1,51 @@
+package gss
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jfjallid/gofork/encoding/asn1"
+)
+
+func newTestTokens(t testing.TB) (init, resp []byte) {
+	init, err := NewNegTokenInit([]asn1.ObjectIdentifier{NtLmSSPMechTypeOid}, []byte("NTLMSSP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NegTokenResp{State: 1, SupportedMech: NtLmSSPMechTypeOid, ResponseToken: []byte("challenge")}
+	resp, err = r.MarshalBinary(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestDecodeToken(t *testing.T) {
+	init, resp := newTestTokens(t)
+	token, err := DecodeToken(init)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if n, ok := token.(*NegTokenInit); !ok || !bytes.Equal(n.Data.MechToken, []byte("NTLMSSP")) {
+		t.Fatalf("Fail: %+v", token)
+	}
+	token, err = DecodeToken(resp)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if r, ok := token.(*NegTokenResp); !ok || !bytes.Equal(r.ResponseToken, []byte("challenge")) {
+		t.Fatalf("Fail: %+v", token)
+	}
+	if _, err = DecodeToken([]byte{0x30, 0x00}); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func FuzzDecodeToken(f *testing.F) {
+	init, resp := newTestTokens(f)
+	f.Add(init)
+	f.Add(resp)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		DecodeToken(data)
+	})
+}
@@ -0,0 +1,477 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package hive parses raw Windows registry hive files (regf) such as the ones
+// produced by BaseRegSaveKey and retrieved over SMB, and extracts the local
+// account hashes, LSA secrets and cached domain credentials stored in the SAM,
+// SECURITY and SYSTEM hives.
+package hive
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/jfjallid/golog"
+)
+
+var (
+	log = golog.Get("github.com/ericblavier/go-smb/hive")
+	le  = binary.LittleEndian
+)
+
+// ErrNotFound is returned when a key or value does not exist in the hive
+var ErrNotFound = errors.New("Registry key or value not found in hive")
+
+const (
+	baseBlockSize    = 4096
+	bigDataSegment   = 16344
+	keyCompName      = 0x0020
+	valueCompName    = 0x0001
+	dataInlineFlag   = 0x80000000
+	noCellOffset     = 0xffffffff
+	maxListRecursion = 8
+)
+
+// Hive is an in-memory registry hive file
+type Hive struct {
+	buf          []byte
+	rootCell     uint32
+	MajorVersion uint32
+	MinorVersion uint32
+	// FileName is the (possibly truncated) name stored in the base block
+	FileName string
+}
+
+// Key is a key node (nk) in a hive
+type Key struct {
+	h           *Hive
+	Name        string
+	LastWrite   time.Time
+	subKeyCount uint32
+	subKeyList  uint32
+	valueCount  uint32
+	valueList   uint32
+	classOffset uint32
+	classLength uint16
+}
+
+// Value is a key value (vk) in a hive. Type holds the registry data type, e.g.
+// REG_SZ (1) or REG_BINARY (3)
+type Value struct {
+	Name string
+	Type uint32
+	Data []byte
+}
+
+// Open parses the base block of a raw hive file. The buffer is kept and
+// referenced by all keys and values read from the hive.
+func Open(buf []byte) (h *Hive, err error) {
+	if len(buf) < baseBlockSize {
+		err = fmt.Errorf("Buffer to small for registry hive")
+		log.Errorln(err)
+		return
+	}
+	if string(buf[:4]) != "regf" {
+		err = fmt.Errorf("Invalid registry hive signature")
+		log.Errorln(err)
+		return
+	}
+	h = &Hive{
+		buf:          buf,
+		MajorVersion: le.Uint32(buf[0x14:]),
+		MinorVersion: le.Uint32(buf[0x18:]),
+		rootCell:     le.Uint32(buf[0x24:]),
+		FileName:     strings.TrimRight(decodeUTF16(buf[0x30:0x70]), "\x00"),
+	}
+	if h.MajorVersion != 1 {
+		err = fmt.Errorf("Unsupported registry hive version %d.%d", h.MajorVersion, h.MinorVersion)
+		log.Errorln(err)
+		return nil, err
+	}
+	return
+}
+
+// cell returns the data of the cell at offset, relative to the start of the
+// hive bins
+func (h *Hive) cell(offset uint32) ([]byte, error) {
+	pos := uint64(offset) + baseBlockSize
+	if offset == noCellOffset || pos+4 > uint64(len(h.buf)) {
+		return nil, fmt.Errorf("Invalid cell offset 0x%x in registry hive", offset)
+	}
+	size := int32(le.Uint32(h.buf[pos:]))
+	if size < 0 {
+		size = -size
+	}
+	if size < 4 || pos+uint64(size) > uint64(len(h.buf)) {
+		return nil, fmt.Errorf("Invalid cell size at offset 0x%x in registry hive", offset)
+	}
+	return h.buf[pos+4 : pos+uint64(size)], nil
+}
+
+// Root returns the root key of the hive
+func (h *Hive) Root() (*Key, error) {
+	return h.key(h.rootCell)
+}
+
+// Key returns the key at the backslash separated path relative to the root
+// key. Lookups are case-insensitive.
+func (h *Hive) Key(path string) (k *Key, err error) {
+	k, err = h.Root()
+	if err != nil {
+		return
+	}
+	for _, name := range strings.Split(strings.Trim(path, "\\"), "\\") {
+		if name == "" {
+			continue
+		}
+		k, err = k.SubKey(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// Value returns the named value of the key at path. Use an empty name for the
+// default value.
+func (h *Hive) Value(path, name string) (*Value, error) {
+	k, err := h.Key(path)
+	if err != nil {
+		return nil, err
+	}
+	return k.Value(name)
+}
+
+func (h *Hive) key(offset uint32) (k *Key, err error) {
+	buf, err := h.cell(offset)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if len(buf) < 76 || string(buf[:2]) != "nk" {
+		err = fmt.Errorf("Invalid key node at offset 0x%x in registry hive", offset)
+		log.Errorln(err)
+		return
+	}
+	flags := le.Uint16(buf[2:])
+	nameLen := int(le.Uint16(buf[72:]))
+	if 76+nameLen > len(buf) {
+		err = fmt.Errorf("Buffer to small for key node name")
+		log.Errorln(err)
+		return
+	}
+	k = &Key{
+		h:           h,
+		LastWrite:   msdtyp.FiletimeToTime(le.Uint64(buf[4:])),
+		subKeyCount: le.Uint32(buf[20:]),
+		subKeyList:  le.Uint32(buf[28:]),
+		valueCount:  le.Uint32(buf[36:]),
+		valueList:   le.Uint32(buf[40:]),
+		classOffset: le.Uint32(buf[48:]),
+		classLength: le.Uint16(buf[74:]),
+	}
+	k.Name = decodeName(buf[76:76+nameLen], flags&keyCompName != 0)
+	return
+}
+
+// ClassName returns the class name of the key, if any
+func (k *Key) ClassName() (string, error) {
+	if k.classLength == 0 || k.classOffset == noCellOffset {
+		return "", nil
+	}
+	buf, err := k.h.cell(k.classOffset)
+	if err != nil {
+		log.Errorln(err)
+		return "", err
+	}
+	if int(k.classLength) > len(buf) {
+		err = fmt.Errorf("Buffer to small for key class name")
+		log.Errorln(err)
+		return "", err
+	}
+	return decodeUTF16(buf[:k.classLength]), nil
+}
+
+// SubKeys returns all subkeys of the key
+func (k *Key) SubKeys() (keys []*Key, err error) {
+	if k.subKeyCount == 0 {
+		return
+	}
+	offsets, err := k.h.subKeyOffsets(k.subKeyList, 0)
+	if err != nil {
+		return
+	}
+	for _, offset := range offsets {
+		var sk *Key
+		sk, err = k.h.key(offset)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, sk)
+	}
+	return
+}
+
+// SubKey returns the direct subkey with the specified name
+func (k *Key) SubKey(name string) (*Key, error) {
+	keys, err := k.SubKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, sk := range keys {
+		if strings.EqualFold(sk.Name, name) {
+			return sk, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// SubKeyNames returns the names of all subkeys of the key
+func (k *Key) SubKeyNames() (names []string, err error) {
+	keys, err := k.SubKeys()
+	if err != nil {
+		return
+	}
+	for _, sk := range keys {
+		names = append(names, sk.Name)
+	}
+	return
+}
+
+func (h *Hive) subKeyOffsets(offset uint32, depth int) (offsets []uint32, err error) {
+	if depth > maxListRecursion {
+		err = fmt.Errorf("Too deeply nested subkey index in registry hive")
+		log.Errorln(err)
+		return
+	}
+	buf, err := h.cell(offset)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if len(buf) < 4 {
+		err = fmt.Errorf("Buffer to small for subkey list")
+		log.Errorln(err)
+		return
+	}
+	count := int(le.Uint16(buf[2:]))
+	sig := string(buf[:2])
+	stride := 4
+	if sig == "lf" || sig == "lh" {
+		stride = 8
+	} else if sig != "li" && sig != "ri" {
+		err = fmt.Errorf("Unknown subkey list signature (%q) in registry hive", sig)
+		log.Errorln(err)
+		return
+	}
+	if 4+count*stride > len(buf) {
+		err = fmt.Errorf("Buffer to small for subkey list")
+		log.Errorln(err)
+		return
+	}
+	for i := 0; i < count; i++ {
+		item := le.Uint32(buf[4+i*stride:])
+		if sig != "ri" {
+			offsets = append(offsets, item)
+			continue
+		}
+		var sub []uint32
+		sub, err = h.subKeyOffsets(item, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, sub...)
+	}
+	return
+}
+
+// Values returns all values of the key
+func (k *Key) Values() (values []*Value, err error) {
+	if k.valueCount == 0 {
+		return
+	}
+	buf, err := k.h.cell(k.valueList)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if int(k.valueCount)*4 > len(buf) {
+		err = fmt.Errorf("Buffer to small for value list")
+		log.Errorln(err)
+		return
+	}
+	for i := 0; i < int(k.valueCount); i++ {
+		var v *Value
+		v, err = k.h.value(le.Uint32(buf[i*4:]))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return
+}
+
+// Value returns the value with the specified name. Use an empty name for the
+// default value.
+func (k *Key) Value(name string) (*Value, error) {
+	values, err := k.Values()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		if strings.EqualFold(v.Name, name) {
+			return v, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (h *Hive) value(offset uint32) (v *Value, err error) {
+	buf, err := h.cell(offset)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if len(buf) < 20 || string(buf[:2]) != "vk" {
+		err = fmt.Errorf("Invalid value node at offset 0x%x in registry hive", offset)
+		log.Errorln(err)
+		return
+	}
+	nameLen := int(le.Uint16(buf[2:]))
+	size := le.Uint32(buf[4:])
+	dataOffset := le.Uint32(buf[8:])
+	flags := le.Uint16(buf[16:])
+	if 20+nameLen > len(buf) {
+		err = fmt.Errorf("Buffer to small for value node name")
+		log.Errorln(err)
+		return
+	}
+	v = &Value{
+		Name: decodeName(buf[20:20+nameLen], flags&valueCompName != 0),
+		Type: le.Uint32(buf[12:]),
+	}
+
+	switch {
+	case size&dataInlineFlag != 0:
+		size &^= dataInlineFlag
+		if size > 4 {
+			err = fmt.Errorf("Invalid inline data size for value %s", v.Name)
+			log.Errorln(err)
+			return nil, err
+		}
+		v.Data = make([]byte, size)
+		copy(v.Data, buf[8:8+size])
+	case size == 0:
+		v.Data = []byte{}
+	case size > bigDataSegment && h.MinorVersion > 3:
+		v.Data, err = h.bigData(dataOffset, size)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		var data []byte
+		data, err = h.cell(dataOffset)
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+		if int(size) > len(data) {
+			err = fmt.Errorf("Buffer to small for data of value %s", v.Name)
+			log.Errorln(err)
+			return nil, err
+		}
+		v.Data = data[:size]
+	}
+	return
+}
+
+// bigData reassembles value data stored in a big data (db) record
+func (h *Hive) bigData(offset, size uint32) (data []byte, err error) {
+	buf, err := h.cell(offset)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if len(buf) < 8 || string(buf[:2]) != "db" {
+		err = fmt.Errorf("Invalid big data record at offset 0x%x in registry hive", offset)
+		log.Errorln(err)
+		return
+	}
+	count := int(le.Uint16(buf[2:]))
+	list, err := h.cell(le.Uint32(buf[4:]))
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if count*4 > len(list) {
+		err = fmt.Errorf("Buffer to small for big data segment list")
+		log.Errorln(err)
+		return
+	}
+	for i := 0; i < count && uint32(len(data)) < size; i++ {
+		var segment []byte
+		segment, err = h.cell(le.Uint32(list[i*4:]))
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+		remaining := int(size) - len(data)
+		if len(segment) > bigDataSegment {
+			segment = segment[:bigDataSegment]
+		}
+		if len(segment) > remaining {
+			segment = segment[:remaining]
+		}
+		data = append(data, segment...)
+	}
+	if uint32(len(data)) != size {
+		err = fmt.Errorf("Big data record is truncated")
+		log.Errorln(err)
+		return nil, err
+	}
+	return
+}
+
+func decodeName(buf []byte, compressed bool) string {
+	if !compressed {
+		return decodeUTF16(buf)
+	}
+	// Compressed names are stored as Latin-1
+	r := make([]rune, len(buf))
+	for i, b := range buf {
+		r[i] = rune(b)
+	}
+	return string(r)
+}
+
+func decodeUTF16(buf []byte) string {
+	s := make([]uint16, len(buf)/2)
+	for i := range s {
+		s[i] = le.Uint16(buf[i*2:])
+	}
+	return string(utf16.Decode(s))
+}
@@ -0,0 +1,320 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package hive
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"unicode/utf16"
+)
+
+// hiveBuilder assembles a minimal hive file with a single hive bin
+type hiveBuilder struct {
+	bin []byte
+}
+
+func (b *hiveBuilder) cell(data []byte) uint32 {
+	if b.bin == nil {
+		b.bin = append([]byte("hbin"), make([]byte, 28)...)
+	}
+	offset := uint32(len(b.bin))
+	size := (len(data) + 4 + 7) &^ 7
+	b.bin = le.AppendUint32(b.bin, uint32(-int32(size)))
+	b.bin = append(b.bin, data...)
+	b.bin = append(b.bin, make([]byte, size-4-len(data))...)
+	return offset
+}
+
+func (b *hiveBuilder) value(name string, typ uint32, data []byte) uint32 {
+	buf := []byte("vk")
+	buf = le.AppendUint16(buf, uint16(len(name)))
+	if len(data) <= 4 {
+		buf = le.AppendUint32(buf, uint32(len(data))|dataInlineFlag)
+		inline := make([]byte, 4)
+		copy(inline, data)
+		buf = append(buf, inline...)
+	} else {
+		buf = le.AppendUint32(buf, uint32(len(data)))
+		buf = le.AppendUint32(buf, b.cell(data))
+	}
+	buf = le.AppendUint32(buf, typ)
+	buf = le.AppendUint16(buf, valueCompName)
+	buf = le.AppendUint16(buf, 0)
+	buf = append(buf, name...)
+	return b.cell(buf)
+}
+
+func (b *hiveBuilder) key(name, class string, subKeys, values []uint32) uint32 {
+	subList, valueList, classOffset := uint32(noCellOffset), uint32(noCellOffset), uint32(noCellOffset)
+	if len(subKeys) > 0 {
+		list := []byte("lh")
+		list = le.AppendUint16(list, uint16(len(subKeys)))
+		for _, sk := range subKeys {
+			list = le.AppendUint32(list, sk)
+			list = le.AppendUint32(list, 0)
+		}
+		subList = b.cell(list)
+	}
+	if len(values) > 0 {
+		list := []byte{}
+		for _, v := range values {
+			list = le.AppendUint32(list, v)
+		}
+		valueList = b.cell(list)
+	}
+	if class != "" {
+		classOffset = b.cell(utf16le(class))
+	}
+	buf := []byte("nk")
+	buf = le.AppendUint16(buf, keyCompName)
+	buf = append(buf, make([]byte, 16)...)
+	buf = le.AppendUint32(buf, uint32(len(subKeys)))
+	buf = le.AppendUint32(buf, 0)
+	buf = le.AppendUint32(buf, subList)
+	buf = le.AppendUint32(buf, noCellOffset)
+	buf = le.AppendUint32(buf, uint32(len(values)))
+	buf = le.AppendUint32(buf, valueList)
+	buf = le.AppendUint32(buf, noCellOffset)
+	buf = le.AppendUint32(buf, classOffset)
+	buf = append(buf, make([]byte, 20)...)
+	buf = le.AppendUint16(buf, uint16(len(name)))
+	buf = le.AppendUint16(buf, uint16(len(class)*2))
+	buf = append(buf, name...)
+	return b.cell(buf)
+}
+
+func (b *hiveBuilder) hive(t *testing.T, root uint32) *Hive {
+	le.PutUint32(b.bin[8:], uint32(len(b.bin)))
+	base := make([]byte, baseBlockSize)
+	copy(base, "regf")
+	le.PutUint32(base[0x14:], 1)
+	le.PutUint32(base[0x18:], 5)
+	le.PutUint32(base[0x24:], root)
+	le.PutUint32(base[0x28:], uint32(len(b.bin)))
+	h, err := Open(append(base, b.bin...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func utf16le(s string) []byte {
+	buf := []byte{}
+	for _, r := range utf16.Encode([]rune(s)) {
+		buf = le.AppendUint16(buf, r)
+	}
+	return buf
+}
+
+func encryptAES(t *testing.T, key, buf, iv []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]byte, len(buf))
+	if iv != nil {
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, buf)
+		return out
+	}
+	for i := 0; i < len(buf); i += aes.BlockSize {
+		block.Encrypt(out[i:i+aes.BlockSize], buf[i:i+aes.BlockSize])
+	}
+	return out
+}
+
+// lsaSecretAES is the inverse of decryptLSASecretAES
+func lsaSecretAES(t *testing.T, key, blob []byte) []byte {
+	seed := bytes.Repeat([]byte{0x5a}, 32)
+	h := sha256.New()
+	h.Write(key)
+	for i := 0; i < 1000; i++ {
+		h.Write(seed)
+	}
+	buf := make([]byte, 28)
+	buf = append(buf, seed...)
+	return append(buf, encryptAES(t, h.Sum(nil), blob, nil)...)
+}
+
+var testBootKey, _ = hex.DecodeString("00112233445566778899aabbccddeeff")
+
+func TestBootKey(t *testing.T) {
+	scrambled := make([]byte, 16)
+	for i, p := range bootKeyPermutation {
+		scrambled[p] = testBootKey[i]
+	}
+	b := &hiveBuilder{}
+	lsaKeys := []uint32{}
+	for i, name := range bootKeyClassKeys {
+		lsaKeys = append(lsaKeys, b.key(name, hex.EncodeToString(scrambled[i*4:i*4+4]), nil, nil))
+	}
+	lsa := b.key("Lsa", "", lsaKeys, nil)
+	control := b.key("Control", "", []uint32{lsa}, nil)
+	cs := b.key("ControlSet001", "", []uint32{control}, nil)
+	sel := b.key("Select", "", nil, []uint32{b.value("Current", 4, []byte{1, 0, 0, 0})})
+	h := b.hive(t, b.key("ROOT", "", []uint32{cs, sel}, nil))
+
+	k, err := h.Key("controlset001\\CONTROL\\lsa\\Skew1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	class, err := k.ClassName()
+	if err != nil || class != hex.EncodeToString(scrambled[4:8]) {
+		t.Fatal("Fail")
+	}
+	if _, err = h.Key("ControlSet002"); err != ErrNotFound {
+		t.Fatal("Fail")
+	}
+	bootKey, err := BootKey(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bootKey, testBootKey) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestDumpSAM(t *testing.T) {
+	samKey := bytes.Repeat([]byte{0x42}, 16)
+	salt := bytes.Repeat([]byte{0x17}, 16)
+	ntHash, _ := hex.DecodeString("8846f7eaee8fb117ad06bdd830b7586c")
+	rid := uint32(500)
+
+	f := make([]byte, 0x68)
+	f = le.AppendUint32(f, 2)
+	f = le.AppendUint32(f, 64)
+	f = le.AppendUint32(f, 16)
+	f = le.AppendUint32(f, 32)
+	f = append(f, salt...)
+	f = append(f, encryptAES(t, testBootKey, append(append([]byte{}, samKey...), make([]byte, 16)...), salt)...)
+
+	// Apply the RID DES layer
+	k := le.AppendUint32(nil, rid)
+	block1, _ := des.NewCipher(plusOddParity([]byte{k[0], k[1], k[2], k[3], k[0], k[1], k[2]}))
+	block2, _ := des.NewCipher(plusOddParity([]byte{k[3], k[0], k[1], k[2], k[3], k[0], k[1]}))
+	obfuscated := make([]byte, 16)
+	block1.Encrypt(obfuscated[:8], ntHash[:8])
+	block2.Encrypt(obfuscated[8:], ntHash[8:])
+	encNT := []byte{0, 0, 2, 0, 0x10, 0, 0, 0}
+	encNT = append(encNT, salt...)
+	encNT = append(encNT, encryptAES(t, samKey, obfuscated, salt)...)
+	encLM := []byte{0, 0, 2, 0}
+	name := utf16le("Administrator")
+
+	v := make([]byte, userAccountVHeaderSize)
+	data := append(append(append([]byte{}, name...), encLM...), encNT...)
+	le.PutUint32(v[12:], 0)
+	le.PutUint32(v[16:], uint32(len(name)))
+	le.PutUint32(v[13*12:], uint32(len(name)))
+	le.PutUint32(v[13*12+4:], uint32(len(encLM)))
+	le.PutUint32(v[14*12:], uint32(len(name)+len(encLM)))
+	le.PutUint32(v[14*12+4:], uint32(len(encNT)))
+	v = append(v, data...)
+
+	b := &hiveBuilder{}
+	user := b.key("000001F4", "", nil, []uint32{b.value("V", 3, v)})
+	names := b.key("Names", "", nil, nil)
+	users := b.key("Users", "", []uint32{user, names}, nil)
+	account := b.key("Account", "", []uint32{users}, []uint32{b.value("F", 3, f)})
+	domains := b.key("Domains", "", []uint32{account}, nil)
+	sam := b.key("SAM", "", []uint32{domains}, nil)
+	h := b.hive(t, b.key("ROOT", "", []uint32{sam}, nil))
+
+	accounts, err := DumpSAM(h, testBootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 {
+		t.Fatal("Fail")
+	}
+	if accounts[0].String() != "Administrator:500:aad3b435b51404eeaad3b435b51404ee:8846f7eaee8fb117ad06bdd830b7586c:::" {
+		t.Fatal("Fail")
+	}
+}
+
+func TestDumpLSASecretsAndCache(t *testing.T) {
+	lsaKey := bytes.Repeat([]byte{0x33}, 32)
+	nlkm := make([]byte, 64)
+	for i := range nlkm {
+		nlkm[i] = byte(i)
+	}
+	iv := bytes.Repeat([]byte{0x61}, 16)
+	cacheHash, _ := hex.DecodeString("f4d1c6b4e8a3d3e6c1b2a39485766758")
+
+	ekList := make([]byte, 96)
+	copy(ekList[52:], lsaKey)
+	secretBlob := le.AppendUint32(nil, uint32(len(nlkm)))
+	secretBlob = append(secretBlob, make([]byte, 12)...)
+	secretBlob = append(secretBlob, nlkm...)
+
+	user, domain, dnsDomain := utf16le("bob"), utf16le("CORP"), utf16le("corp.local")
+	plain := append([]byte{}, cacheHash...)
+	plain = append(plain, make([]byte, 0x48-16)...)
+	plain = append(plain, user...)
+	plain = append(plain, make([]byte, pad4(len(user))-len(user))...)
+	plain = append(plain, domain...)
+	plain = append(plain, dnsDomain...)
+	plain = append(plain, make([]byte, 16-len(plain)%16)...)
+	record := make([]byte, 96)
+	le.PutUint16(record[0:], uint16(len(user)))
+	le.PutUint16(record[2:], uint16(len(domain)))
+	le.PutUint32(record[48:], 1)
+	le.PutUint16(record[60:], uint16(len(dnsDomain)))
+	copy(record[64:], iv)
+	record = append(record, encryptAES(t, nlkm[16:32], plain, iv)...)
+
+	b := &hiveBuilder{}
+	currVal := b.key("CurrVal", "", nil, []uint32{b.value("", 0, lsaSecretAES(t, lsaKey, secretBlob))})
+	secret := b.key("NL$KM", "", []uint32{currVal}, nil)
+	secrets := b.key("Secrets", "", []uint32{secret}, nil)
+	ek := b.key("PolEKList", "", nil, []uint32{b.value("", 0, lsaSecretAES(t, testBootKey, ekList))})
+	policy := b.key("Policy", "", []uint32{ek, secrets}, nil)
+	cache := b.key("Cache", "", nil, []uint32{
+		b.value("NL$Control", 3, make([]byte, 8)),
+		b.value("NL$1", 3, record),
+		b.value("NL$2", 3, make([]byte, 96)),
+	})
+	h := b.hive(t, b.key("ROOT", "", []uint32{policy, cache}, nil))
+
+	result, err := DumpLSASecrets(h, testBootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].Name != "NL$KM" || !bytes.Equal(result[0].Secret, nlkm) {
+		t.Fatal("Fail")
+	}
+
+	creds, err := DumpCachedCredentials(h, testBootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds) != 1 {
+		t.Fatal("Fail")
+	}
+	if creds[0].String() != "corp.local/bob:$DCC2$10240#bob#f4d1c6b4e8a3d3e6c1b2a39485766758" {
+		t.Fatal("Fail")
+	}
+}
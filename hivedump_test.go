@@ -0,0 +1,18 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHiveList(t *testing.T) {
+	names, err := parseHiveList("sam, SYSTEM,Software,SAM")
+	if err != nil || !reflect.DeepEqual(names, []string{"SAM", "SYSTEM", "SOFTWARE"}) {
+		t.Fatalf("Fail: %v %v", names, err)
+	}
+	for _, invalid := range []string{"", "SAM,", `..\SAM`, "SYSTEM\\Select"} {
+		if _, err = parseHiveList(invalid); err == nil {
+			t.Fatalf("Fail: %s", invalid)
+		}
+	}
+}
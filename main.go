@@ -4,240 +4,128 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
-	"github.com/ericblavier/go-smb/smb"
-	"github.com/ericblavier/go-smb/spnego"
 	"github.com/jfjallid/golog"
 )
 
-func main() {
-	var host = flag.String("host", "127.0.0.1", "Target host IP address")
-	var port = flag.Int("port", 445, "Target port (default: 445)")
-	var username = flag.String("user", "", "Username (optional for negotiate test)")
-	var password = flag.String("pass", "", "Password (optional for negotiate test)")
-	var domain = flag.String("domain", "", "Domain (optional for negotiate test)")
-	var debug = flag.Bool("debug", false, "Enable debug logging")
-	var showDialects = flag.Bool("show-dialects", true, "Show supported SMB dialects")
-
-	flag.Parse()
-
-	// Set up logging
-	logger := golog.Get("smb-test")
-	if *debug {
-		logger.Infoln("Debug logging enabled")
-	}
-
-	fmt.Printf("=== SMBv1/SMBv2 Negotiation Test ===\n")
-	fmt.Printf("Target: %s:%d\n", *host, *port)
-	fmt.Printf("Debug: %v\n", *debug)
-	fmt.Println("=====================================")
-
-	// Show supported dialects if requested
-	if *showDialects {
-		showSupportedDialects()
-	}
-
-	// Test 1: Basic connection and negotiation (anonymous)
-	if err := testNegotiation(*host, *port, logger); err != nil {
-		logger.Errorln("Negotiation test failed:", err)
-		// Continue to test with credentials if provided
-	} else {
-		fmt.Println("✅ Anonymous negotiation successful!")
-	}
-
-	// Test 2: If credentials provided, test authentication
-	if *username != "" {
-		if err := testAuthentication(*host, *port, *username, *password, *domain, logger); err != nil {
-			logger.Errorln("Authentication test failed:", err)
-			os.Exit(1)
-		}
-	}
-
-	fmt.Println("\n✅ All tests completed!")
+// A subcommand of the CLI
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
 }
 
-func testNegotiation(host string, port int, logger *golog.MyLogger) error {
-	fmt.Println("\n🔄 Testing SMB Protocol Negotiation...")
-
-	// Create SMB connection with null session for negotiation test
-	options := smb.Options{
-		Host: host,
-		Port: port,
-		Initiator: &spnego.NTLMInitiator{
-			User:     "",
-			Password: "",
-			Domain:   "",
-		},
-	}
-
-	session, err := smb.NewConnection(options)
-	if err != nil {
-		return fmt.Errorf("failed to create connection: %v", err)
-	}
-	defer session.Close()
-
-	logger.Infof("✅ SMB connection established to %s:%d", host, port)
-
-	// Show detailed negotiation results
-	showNegotiationResult(session)
-
-	return nil
+var commands = []command{
+	{"negotiate", "negotiate <host>", runNegotiate},
+	{"fingerprint", "fingerprint [-wait duration] <host> [host...]", runFingerprint},
+	{"ls", "ls //host/share[/dir][/pattern]", runLs},
+	{"get", "get [-r [filters]] //host/share/path [local path]", runGet},
+	{"put", "put <local file> //host/share/path", runPut},
+	{"rm", "rm //host/share/path", runRm},
+	{"mkdir", "mkdir [-p] //host/share/path", runMkdir},
+	{"rmdir", "rmdir //host/share/path", runRmdir},
+	{"cat", "cat //host/share/path", runCat},
+	{"stat", "stat //host/share/path", runStat},
+	{"mv", "mv [-f] //host/share/path //host/share/newpath", runMv},
+	{"touch", "touch [-all time] [-created time] [-modified time] [-accessed time] [-changed time] [-ref //host/share/path] //host/share/path", runTouch},
+	{"sync", "sync [-push|-pull] [-mirror] [-hash] [-exclude glob]... <local dir> //host/share/path", runSync},
+	{"archive", "archive [-format tar|zip] [-sd] [filters] //host/share/path [output]", runArchive},
+	{"watch", "watch [-r] [-events list] [-poll] [-interval duration] //host/share/path", runWatch},
+	{"shares", "shares [-json] [-write] [-rap] <host>", runShares},
+	{"reg", `reg query|add|delete|save \\host\KEY [switches]`, runReg},
+	{"svc", "svc list|query|start|stop|create|delete [flags] <host> [service]", runSvc},
+	{"spray", "spray -users <file> [flags] <host> [host...]", runSpray},
+	{"audit", "audit [-policy file] [-json] <host> [host...]", runAudit},
+	{"check", "check [-checks list] [-json] <host> [host...]", runCheck},
+	{"secrets", "secrets [-sam] [-lsa] [-ntds [-ntds-user user]] <host>", runSecrets},
+	{"exec", "exec -binary file|-binpath program [-name service] [-pipe name] [-keep] <host> [args...]", runExec},
+	{"atexec", "atexec [-name task] [-wait duration] [-no-output] <host> <command...>", runAtexec},
+	{"wmiexec", "wmiexec [-dir path] [-wait duration] [-no-output] <host> <command...>", runWmiexec},
+	{"pipes", "pipes [-probe=false] [-wordlist file] [-open pipe] <host>", runPipes},
+	{"spider", "spider [-shares list] [-name regex]... [-content regex]... [-secrets] [-exclude glob]... [-max-size size] [-depth n] <host>", runSpider},
+	{"search", "search [-scope path]... [-catalog name] [-max n] <host> <words...>", runSearch},
+	{"gpp", "gpp [-share name] <dc>", runGPP},
+	{"enumusers", "enumusers [-method samr|lsa|auto] [-start rid] [-end rid] [-batch n] [-delay duration] <host>", runEnumusers},
+	{"eventlog", "eventlog tail [-n count] [-f] [-interval duration] [-filter Field=value]... <host> <log>", runEventlog},
+	{"hivedump", "hivedump [-hives list] [-o dir] [-no-parse] <host>", runHivedump},
+	{"nbtlookup", "nbtlookup [-name name [-suffix hex] [-broadcast]] [-wait duration] <host>", runNbtlookup},
+	{"capture", "capture [-listen addr] [-o file] [-name name] [-workgroup name]", runCapture},
 }
 
-func testAuthentication(host string, port int, username, password, domain string, logger *golog.MyLogger) error {
-	fmt.Println("\n🔐 Testing SMB Authentication...")
-
-	// Create SMB connection with credentials
-	options := smb.Options{
-		Host: host,
-		Port: port,
-		Initiator: &spnego.NTLMInitiator{
-			User:     username,
-			Password: password,
-			Domain:   domain,
-		},
-	}
-
-	session, err := smb.NewConnection(options)
-	if err != nil {
-		return fmt.Errorf("failed to create authenticated connection: %v", err)
-	}
-	defer session.Close()
-
-	logger.Info("✅ SMB session established successfully")
-
-	// Check authentication status
-	if session.IsAuthenticated() {
-		fmt.Printf("✅ Login successful as %s\n", session.GetAuthUsername())
-	} else {
-		return fmt.Errorf("authentication failed")
-	}
-
-	// Show detailed results
-	showNegotiationResult(session)
+// Global flags shared by all subcommands
+var (
+	port            = flag.Int("port", 445, "Target port")
+	username        = flag.String("user", "", "Username, leave empty for a null session")
+	password        = flag.String("pass", "", "Password")
+	domain          = flag.String("domain", "", "Domain")
+	debug           = flag.Bool("debug", false, "Enable debug logging")
+	jsonOutput      = flag.Bool("json", false, "Print results as JSON lines for all commands")
+	targetsFile     = flag.String("targets", "", "Run the command against each host listed in the file, substituting {host} in its arguments")
+	threads         = flag.Int("threads", 10, "Number of hosts handled concurrently with -targets")
+	hostTimeout     = flag.Duration("timeout", 5*time.Minute, "Time limit per host with -targets, 0 for no limit")
+	netbiosName     = flag.String("netbios-name", "", "Called NetBIOS name of the server with -port 139, looked up with a node status request when empty")
+	signing         = flag.String("signing", "default", "Message signing policy: default, required or disabled")
+	disableSMB1     = flag.Bool("disable-smb1", false, "Never send a SMB1 NEGOTIATE, which trips the IDS rules of some networks")
+	profileName     = flag.String("profile", "", "Profile of the configuration file supplying default flag values and hosts, $GOSMB_PROFILE when empty")
+	configFile      = flag.String("config", "", "Configuration file with the profiles (default ~/.gosmb/config.yaml)")
+	credentialsFile = flag.String("credentials", "", "File with username, password and domain lines as used by smbclient -A")
+	recordFile      = flag.String("record", "", "Append the frames of the connection with their times to a transcript file for reproducing problems with -replay")
+	replayFile      = flag.String("replay", "", "Serve the connection from a transcript recorded with -record instead of connecting to the host")
+)
 
-	// Try to connect to IPC$ share to test basic functionality
-	fmt.Println("📁 Testing IPC$ share connection...")
-	err = session.TreeConnect("IPC$")
-	if err != nil {
-		return fmt.Errorf("failed to connect to IPC$ share: %v", err)
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <command> [args]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s\n", cmd.usage)
 	}
-	defer session.TreeDisconnect("IPC$")
-
-	fmt.Println("✅ IPC$ share connection successful")
-
-	return nil
+	fmt.Fprintf(flag.CommandLine.Output(), "\nFlags:\n")
+	flag.PrintDefaults()
 }
 
-func showSupportedDialects() {
-	fmt.Println("\n📋 SMB Protocol Dialects Overview")
-	fmt.Println("==================================")
-
-	fmt.Println("\n🔄 Dialects advertised in SMB1 Negotiate Request:")
-	smb1Dialects := []struct {
-		index       int
-		name        string
-		description string
-	}{
-		{0, "PC NETWORK PROGRAM 1.0", "Original SMB protocol"},
-		{1, "LANMAN1.0", "LAN Manager 1.0"},
-		{2, "Windows for Workgroups 3.1a", "Windows for Workgroups"},
-		{3, "LM1.2X002", "LAN Manager 1.2"},
-		{4, "LANMAN2.1", "LAN Manager 2.1"},
-		{5, "NT LM 0.12", "SMBv1 (NT LAN Manager)"},
-		{6, "SMB 2.002", "SMB 2.0.2"},
-		{7, "SMB 2.100", "SMB 2.1.0"},
-		{8, "SMB 2.???", "SMB 2.x wildcard"},
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
 	}
 
-	for _, dialect := range smb1Dialects {
-		var category string
-		if dialect.index <= 5 {
-			category = "SMBv1"
-		} else {
-			category = "SMBv2"
+	if *debug {
+		for _, name := range []string{"smb", "smb/dcerpc", "spnego", "smbserver"} {
+			golog.Set("github.com/ericblavier/go-smb/"+name, name, golog.LevelDebug, golog.LstdFlags|golog.Lshortfile, golog.DefaultOutput, golog.DefaultErrOutput)
 		}
-		fmt.Printf("   [%d] %s %-25s (%s)\n", dialect.index, category, dialect.name, dialect.description)
-	}
-
-	fmt.Println("\n🔄 SMBv2+ Dialects supported:")
-	smb2Dialects := []struct {
-		hex         string
-		name        string
-		description string
-		features    string
-	}{
-		{"0x0202", "SMB 2.0.2", "SMB 2.0.2", "Basic SMBv2, introduced with Vista/2008"},
-		{"0x0210", "SMB 2.1.0", "SMB 2.1.0", "Improved with Windows 7/2008R2"},
-		{"0x0300", "SMB 3.0.0", "SMB 3.0.0", "Encryption, Windows 8/2012"},
-		{"0x0302", "SMB 3.0.2", "SMB 3.0.2", "Enhanced encryption, Windows 8.1/2012R2"},
-		{"0x0311", "SMB 3.1.1", "SMB 3.1.1", "Latest features, Windows 10/2016+"},
-		{"0x02FF", "SMB 2.???", "SMB 2.x Wildcard", "Multi-protocol negotiation"},
 	}
 
-	for _, dialect := range smb2Dialects {
-		fmt.Printf("   %s %-12s - %s\n", dialect.hex, dialect.name, dialect.features)
+	if err := applyProfile(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(2)
 	}
 
-	fmt.Println("\n💡 Negotiation Process:")
-	fmt.Println("   1. Client sends SMB1 negotiate with all dialects above")
-	fmt.Println("   2. Server responds with selected dialect or SMB2 response")
-	fmt.Println("   3. If SMBv2 selected, client continues with SMBv2 protocol")
-	fmt.Println("")
-}
-
-func showNegotiationResult(session *smb.Connection) {
-	fmt.Println("\n🎯 Negotiation Result:")
-
-	// Get detailed signing information
-	signingSupported := getSigningInfo(session, "supported")
-	signingRequired := getSigningInfo(session, "required")
-
-	// Display SMB Signing status
-	fmt.Printf("   🔐 SMB Signing Supported: %s\n", formatYesNo(signingSupported))
-	fmt.Printf("   🔐 SMB Signing Required: %s\n", formatYesNo(signingRequired))
-
-	// Show authentication status
-	if session.IsAuthenticated() {
-		fmt.Printf("   👤 Authenticated as: %s\n", session.GetAuthUsername())
-	} else {
-		fmt.Println("   👤 Authentication: Anonymous/Null session")
-	}
-}
-
-func getSigningInfo(session *smb.Connection, infoType string) bool {
-	switch infoType {
-	case "required":
-		return session.IsSigningRequired()
-	case "supported":
-		return session.IsSigningSupported()
-	default:
-		return false
-	}
-}
-
-func formatYesNo(value bool) string {
-	if value {
-		return "✅ Yes"
-	}
-	return "❌ No"
-}
-
-func getDialectName(dialect uint16) string {
-	switch dialect {
-	case 0x0202:
-		return "SMB 2.0.2"
-	case 0x0210:
-		return "SMB 2.1.0"
-	case 0x0300:
-		return "SMB 3.0.0"
-	case 0x0302:
-		return "SMB 3.0.2"
-	case 0x0311:
-		return "SMB 3.1.1"
-	case 0x02FF:
-		return "SMB 2.???"
-	default:
-		return "Unknown"
+	name := flag.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		run := cmd.run
+		if *targetsFile != "" || len(profileHosts) > 0 {
+			run = func(args []string) error {
+				return runTargets(append([]string{name}, args...))
+			}
+		}
+		if err := run(flag.Args()[1:]); err != nil {
+			if *jsonOutput {
+				emit(struct {
+					Command string `json:"command"`
+					Error   string `json:"error"`
+				}{name, err.Error()})
+			}
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			os.Exit(1)
+		}
+		return
 	}
+	fmt.Fprintf(os.Stderr, "Unknown command: %s\n", name)
+	usage()
+	os.Exit(2)
 }
@@ -0,0 +1,269 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package msdtyp
+
+import "fmt"
+
+// MS-DTYP Section 2.4.3 ACCESS_MASK
+type AccessMask uint32
+
+// Generic and standard access rights shared by all object types
+const (
+	GenericRead          AccessMask = 0x80000000
+	GenericWrite         AccessMask = 0x40000000
+	GenericExecute       AccessMask = 0x20000000
+	GenericAll           AccessMask = 0x10000000
+	MaximumAllowed       AccessMask = 0x02000000
+	AccessSystemSecurity AccessMask = 0x01000000
+	Synchronize          AccessMask = 0x00100000
+	WriteOwner           AccessMask = 0x00080000
+	WriteDACL            AccessMask = 0x00040000
+	ReadControl          AccessMask = 0x00020000
+	Delete               AccessMask = 0x00010000
+
+	StandardRightsRequired AccessMask = 0x000F0000
+	StandardRightsRead     AccessMask = ReadControl
+	StandardRightsWrite    AccessMask = ReadControl
+	StandardRightsExecute  AccessMask = ReadControl
+
+	genericRightsMask AccessMask = 0xF0000000
+)
+
+// MS-SMB2 Section 2.2.13.1.1 File_Pipe_Printer_Access_Mask
+const (
+	FileReadData        AccessMask = 0x00000001
+	FileWriteData       AccessMask = 0x00000002
+	FileAppendData      AccessMask = 0x00000004
+	FileReadEA          AccessMask = 0x00000008
+	FileWriteEA         AccessMask = 0x00000010
+	FileExecute         AccessMask = 0x00000020
+	FileDeleteChild     AccessMask = 0x00000040
+	FileReadAttributes  AccessMask = 0x00000080
+	FileWriteAttributes AccessMask = 0x00000100
+
+	FileGenericRead    AccessMask = 0x00120089
+	FileGenericWrite   AccessMask = 0x00120116
+	FileGenericExecute AccessMask = 0x001200A0
+	FileAllAccess      AccessMask = 0x001F01FF
+)
+
+// MS-RRP Section 2.2.3 REGSAM
+const (
+	KeyQueryValue       AccessMask = 0x00000001
+	KeySetValue         AccessMask = 0x00000002
+	KeyCreateSubKey     AccessMask = 0x00000004
+	KeyEnumerateSubKeys AccessMask = 0x00000008
+	KeyNotify           AccessMask = 0x00000010
+	KeyCreateLink       AccessMask = 0x00000020
+	KeyWow6464Key       AccessMask = 0x00000100
+	KeyWow6432Key       AccessMask = 0x00000200
+
+	KeyRead      AccessMask = 0x00020019
+	KeyWrite     AccessMask = 0x00020006
+	KeyExecute   AccessMask = 0x00020019
+	KeyAllAccess AccessMask = 0x000F003F
+)
+
+// MS-SCMR Section 3.1.4 Service access rights
+const (
+	ServiceQueryConfig         AccessMask = 0x00000001
+	ServiceChangeConfig        AccessMask = 0x00000002
+	ServiceQueryStatus         AccessMask = 0x00000004
+	ServiceEnumerateDependents AccessMask = 0x00000008
+	ServiceStart               AccessMask = 0x00000010
+	ServiceStop                AccessMask = 0x00000020
+	ServicePauseContinue       AccessMask = 0x00000040
+	ServiceInterrogate         AccessMask = 0x00000080
+	ServiceUserDefinedControl  AccessMask = 0x00000100
+
+	ServiceAllAccess AccessMask = 0x000F01FF
+)
+
+// MS-DTYP Section 2.4.3 GENERIC_MAPPING
+// Specific rights that each generic right maps to for a given object type
+type GenericMapping struct {
+	GenericRead    AccessMask
+	GenericWrite   AccessMask
+	GenericExecute AccessMask
+	GenericAll     AccessMask
+}
+
+var FileGenericMapping = GenericMapping{
+	GenericRead:    FileGenericRead,
+	GenericWrite:   FileGenericWrite,
+	GenericExecute: FileGenericExecute,
+	GenericAll:     FileAllAccess,
+}
+
+var RegistryGenericMapping = GenericMapping{
+	GenericRead:    KeyRead,
+	GenericWrite:   KeyWrite,
+	GenericExecute: KeyExecute,
+	GenericAll:     KeyAllAccess,
+}
+
+var ServiceGenericMapping = GenericMapping{
+	GenericRead:    StandardRightsRead | ServiceQueryConfig | ServiceQueryStatus | ServiceInterrogate | ServiceEnumerateDependents,
+	GenericWrite:   StandardRightsWrite | ServiceChangeConfig,
+	GenericExecute: StandardRightsExecute | ServiceStart | ServiceStop | ServicePauseContinue | ServiceUserDefinedControl,
+	GenericAll:     ServiceAllAccess,
+}
+
+type accessRight struct {
+	mask AccessMask
+	name string
+}
+
+// Rights are listed in the order they are rendered
+var standardRights = []accessRight{
+	{Delete, AccessMaskDelete},
+	{ReadControl, AccessMaskReadControl},
+	{WriteDACL, AccessMaskWriteDACL},
+	{WriteOwner, AccessMaskWriteOwner},
+	{Synchronize, AccessMaskSynchronize},
+	{AccessSystemSecurity, AccessMaskAccessSystemSecurity},
+	{MaximumAllowed, AccessMaskMaximumAllowed},
+}
+
+var genericRights = []accessRight{
+	{GenericRead, AccessMaskGenericRead},
+	{GenericWrite, AccessMaskGenericWrite},
+	{GenericExecute, AccessMaskGenericExecute},
+	{GenericAll, AccessMaskGenericAll},
+}
+
+var fileRights = []accessRight{
+	{FileReadData, "FILE_READ_DATA"},
+	{FileWriteData, "FILE_WRITE_DATA"},
+	{FileAppendData, "FILE_APPEND_DATA"},
+	{FileReadEA, "FILE_READ_EA"},
+	{FileWriteEA, "FILE_WRITE_EA"},
+	{FileExecute, "FILE_EXECUTE"},
+	{FileDeleteChild, "FILE_DELETE_CHILD"},
+	{FileReadAttributes, "FILE_READ_ATTRIBUTES"},
+	{FileWriteAttributes, "FILE_WRITE_ATTRIBUTES"},
+}
+
+var registryRights = []accessRight{
+	{KeyQueryValue, "KEY_QUERY_VALUE"},
+	{KeySetValue, "KEY_SET_VALUE"},
+	{KeyCreateSubKey, "KEY_CREATE_SUB_KEY"},
+	{KeyEnumerateSubKeys, "KEY_ENUMERATE_SUB_KEYS"},
+	{KeyNotify, "KEY_NOTIFY"},
+	{KeyCreateLink, "KEY_CREATE_LINK"},
+	{KeyWow6464Key, "KEY_WOW64_64KEY"},
+	{KeyWow6432Key, "KEY_WOW64_32KEY"},
+}
+
+var serviceRights = []accessRight{
+	{ServiceQueryConfig, "SERVICE_QUERY_CONFIG"},
+	{ServiceChangeConfig, "SERVICE_CHANGE_CONFIG"},
+	{ServiceQueryStatus, "SERVICE_QUERY_STATUS"},
+	{ServiceEnumerateDependents, "SERVICE_ENUMERATE_DEPENDENTS"},
+	{ServiceStart, "SERVICE_START"},
+	{ServiceStop, "SERVICE_STOP"},
+	{ServicePauseContinue, "SERVICE_PAUSE_CONTINUE"},
+	{ServiceInterrogate, "SERVICE_INTERROGATE"},
+	{ServiceUserDefinedControl, "SERVICE_USER_DEFINED_CONTROL"},
+}
+
+// MapGeneric replaces any generic rights in the mask with the specific and
+// standard rights they map to according to the supplied mapping.
+func (m AccessMask) MapGeneric(mapping GenericMapping) AccessMask {
+	res := m &^ genericRightsMask
+	if m&GenericRead != 0 {
+		res |= mapping.GenericRead
+	}
+	if m&GenericWrite != 0 {
+		res |= mapping.GenericWrite
+	}
+	if m&GenericExecute != 0 {
+		res |= mapping.GenericExecute
+	}
+	if m&GenericAll != 0 {
+		res |= mapping.GenericAll
+	}
+	return res
+}
+
+// Has reports whether all bits in rights are set in the mask
+func (m AccessMask) Has(rights AccessMask) bool {
+	return m&rights == rights
+}
+
+// DecodeGeneric returns the names of the generic and standard rights in the
+// mask without interpreting the object specific bits.
+func (m AccessMask) DecodeGeneric() []string {
+	return m.decode(nil, 0, "")
+}
+
+// DecodeFile maps generic rights using the file mapping and returns the
+// names of the resulting file, pipe or directory access rights.
+func (m AccessMask) DecodeFile() []string {
+	return m.MapGeneric(FileGenericMapping).decode(fileRights, FileAllAccess, "FILE_ALL_ACCESS")
+}
+
+// DecodeRegistry maps generic rights using the registry mapping and returns
+// the names of the resulting registry key access rights.
+func (m AccessMask) DecodeRegistry() []string {
+	return m.MapGeneric(RegistryGenericMapping).decode(registryRights, KeyAllAccess, "KEY_ALL_ACCESS")
+}
+
+// DecodeService maps generic rights using the service mapping and returns
+// the names of the resulting service access rights.
+func (m AccessMask) DecodeService() []string {
+	return m.MapGeneric(ServiceGenericMapping).decode(serviceRights, ServiceAllAccess, "SERVICE_ALL_ACCESS")
+}
+
+// decode renders the mask as a list of right names. If every bit of allAccess
+// is set, the composite name is used instead of listing the individual rights.
+// Specific bits without a known name are rendered as hex.
+func (m AccessMask) decode(specific []accessRight, allAccess AccessMask, allAccessName string) (rights []string) {
+	rights = []string{}
+	remaining := m
+	if allAccess != 0 && m.Has(allAccess) {
+		rights = append(rights, allAccessName)
+		remaining &^= allAccess
+	}
+	for _, r := range specific {
+		if remaining&r.mask != 0 {
+			rights = append(rights, r.name)
+			remaining &^= r.mask
+		}
+	}
+	for _, r := range standardRights {
+		if remaining&r.mask != 0 {
+			rights = append(rights, r.name)
+			remaining &^= r.mask
+		}
+	}
+	for _, r := range genericRights {
+		if remaining&r.mask != 0 {
+			rights = append(rights, r.name)
+			remaining &^= r.mask
+		}
+	}
+	if remaining != 0 {
+		rights = append(rights, fmt.Sprintf("0x%08x", uint32(remaining)))
+	}
+	return
+}
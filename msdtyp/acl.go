@@ -0,0 +1,194 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package msdtyp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Positions of the ACE groups of a canonical DACL
+const (
+	aceOrderExplicitDeny = iota
+	aceOrderExplicitAllow
+	aceOrderInherited
+)
+
+// NewACE creates an ACE and computes its size from the SID
+func NewACE(aceType, aceFlags byte, mask uint32, sid *SID) ACE {
+	return ACE{
+		Header: ACEHeader{
+			Type:  aceType,
+			Flags: aceFlags,
+			Size:  uint16(8 + 8 + 4*len(sid.SubAuthorities)),
+		},
+		Mask: mask,
+		Sid:  *sid,
+	}
+}
+
+// NewPACL creates a revision 2 ACL holding the ACEs
+func NewPACL(aces []ACE) *PACL {
+	acl := &PACL{AclRevision: 2, ACLS: aces}
+	acl.updateSize()
+	return acl
+}
+
+// IsInherited reports whether the ACE was inherited from a parent object
+func (self *ACE) IsInherited() bool {
+	return self.Header.Flags&InheritedAce != 0
+}
+
+// IsDeny reports whether the ACE denies access
+func (self *ACE) IsDeny() bool {
+	switch self.Header.Type {
+	case AccessDeniedAceType, AccessDeniedObjectAceType, AccessDeniedCallbackAceType, AccessDeniedCallbackObjectAceType:
+		return true
+	}
+	return false
+}
+
+func (self *ACE) canonicalOrder() int {
+	if self.IsInherited() {
+		return aceOrderInherited
+	}
+	if self.IsDeny() {
+		return aceOrderExplicitDeny
+	}
+	return aceOrderExplicitAllow
+}
+
+// Recompute AceCount and AclSize after the ACEs have been modified
+func (self *PACL) updateSize() {
+	size := 8
+	for _, ace := range self.ACLS {
+		size += int(ace.Header.Size)
+	}
+	self.AclSize = uint16(size)
+	self.AceCount = uint32(len(self.ACLS))
+}
+
+// IsCanonical reports whether the ACEs are in Windows canonical order:
+// explicit deny ACEs, then explicit allow ACEs and finally inherited ACEs.
+func (self *PACL) IsCanonical() bool {
+	last := aceOrderExplicitDeny
+	for i := range self.ACLS {
+		order := self.ACLS[i].canonicalOrder()
+		if order < last {
+			return false
+		}
+		last = order
+	}
+	return true
+}
+
+// Canonicalize reorders the ACEs into canonical order. The relative order of
+// ACEs within each group, including the inherited ACEs, is preserved.
+func (self *PACL) Canonicalize() {
+	sort.SliceStable(self.ACLS, func(i, j int) bool {
+		return self.ACLS[i].canonicalOrder() < self.ACLS[j].canonicalOrder()
+	})
+	self.updateSize()
+}
+
+// InsertACE adds the ACE at the end of its canonical group, i.e., an explicit
+// deny ACE after the existing explicit deny ACEs and an explicit allow ACE
+// before the first inherited ACE.
+func (self *PACL) InsertACE(ace ACE) {
+	order := ace.canonicalOrder()
+	pos := len(self.ACLS)
+	for i := range self.ACLS {
+		if self.ACLS[i].canonicalOrder() > order {
+			pos = i
+			break
+		}
+	}
+	aces := make([]ACE, 0, len(self.ACLS)+1)
+	aces = append(aces, self.ACLS[:pos]...)
+	aces = append(aces, ace)
+	self.ACLS = append(aces, self.ACLS[pos:]...)
+	self.updateSize()
+}
+
+// RemoveACE removes the ACE at index
+func (self *PACL) RemoveACE(index int) error {
+	if index < 0 || index >= len(self.ACLS) {
+		return fmt.Errorf("ACE index %d out of range", index)
+	}
+	self.ACLS = append(self.ACLS[:index:index], self.ACLS[index+1:]...)
+	self.updateSize()
+	return nil
+}
+
+// RemoveACEs removes the ACEs of the SID and returns the number of removed
+// ACEs. Inherited ACEs are only removed if explicitOnly is false.
+func (self *PACL) RemoveACEs(sid *SID, explicitOnly bool) int {
+	aces := make([]ACE, 0, len(self.ACLS))
+	for _, ace := range self.ACLS {
+		if ace.Sid.Equal(sid) && (!explicitOnly || !ace.IsInherited()) {
+			continue
+		}
+		aces = append(aces, ace)
+	}
+	removed := len(self.ACLS) - len(aces)
+	self.ACLS = aces
+	self.updateSize()
+	return removed
+}
+
+// EffectiveAccess computes the access mask granted by the DACL to a user
+// with the specified SIDs, e.g., the user SID followed by its group SIDs. The
+// ACEs are evaluated in order as described in MS-DTYP Section 2.5.3.2 where a
+// right denied by an earlier ACE cannot be granted by a later one. Generic
+// rights are not mapped and ACEs with InheritOnlyAce set are ignored. A nil
+// DACL grants GENERIC_ALL.
+func (self *PACL) EffectiveAccess(sids ...*SID) uint32 {
+	if self == nil {
+		return uint32(GenericAll)
+	}
+	var granted, denied uint32
+	for i := range self.ACLS {
+		ace := &self.ACLS[i]
+		if ace.Header.Flags&InheritOnlyAce != 0 {
+			continue
+		}
+		if ace.Header.Type != AccessAllowedAceType && ace.Header.Type != AccessDeniedAceType {
+			continue
+		}
+		match := false
+		for _, sid := range sids {
+			if ace.Sid.Equal(sid) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		if ace.Header.Type == AccessDeniedAceType {
+			denied |= ace.Mask &^ granted
+		} else {
+			granted |= ace.Mask &^ denied
+		}
+	}
+	return granted
+}
@@ -0,0 +1,69 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package msdtyp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// GuidFromString converts a GUID in the string form
+// xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx, optionally surrounded by braces, to
+// its 16 byte wire format (MS-DTYP Section 2.3.4.2)
+func GuidFromString(s string) (guid []byte, err error) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	parts := strings.Split(s, "-")
+	if len(parts) != 5 || len(parts[0]) != 8 || len(parts[1]) != 4 || len(parts[2]) != 4 || len(parts[3]) != 4 || len(parts[4]) != 12 {
+		return nil, fmt.Errorf("Invalid GUID format: %s", s)
+	}
+	buf, err := hex.DecodeString(strings.Join(parts, ""))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid GUID format: %s", s)
+	}
+	// Data1, Data2 and Data3 are little-endian and Data4 is a byte array
+	guid = make([]byte, 16)
+	le.PutUint32(guid, be.Uint32(buf[:4]))
+	le.PutUint16(guid[4:], be.Uint16(buf[4:6]))
+	le.PutUint16(guid[6:], be.Uint16(buf[6:8]))
+	copy(guid[8:], buf[8:])
+	return
+}
+
+// MustGuidFromString is GuidFromString for constant GUIDs and panics on
+// invalid input
+func MustGuidFromString(s string) []byte {
+	guid, err := GuidFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return guid
+}
+
+// GuidToString converts a 16 byte GUID in wire format to its string form.
+// An empty string is returned if guid is not 16 bytes.
+func GuidToString(guid []byte) string {
+	if len(guid) != 16 {
+		return ""
+	}
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x", le.Uint32(guid[:4]), le.Uint16(guid[4:6]), le.Uint16(guid[6:8]), guid[8:10], guid[10:])
+}
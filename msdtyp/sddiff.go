@@ -0,0 +1,194 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package msdtyp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ACEChange describes an ACE whose access mask or flags differ between two
+// security descriptors while the type, trustee and inheritance are the same.
+type ACEChange struct {
+	Old ACE
+	New ACE
+}
+
+// ACLDiff lists the ACEs added, removed and modified between two ACLs
+type ACLDiff struct {
+	Added    []ACE
+	Removed  []ACE
+	Modified []ACEChange
+}
+
+// SDDiff is the result of comparing two security descriptors
+type SDDiff struct {
+	OwnerChanged   bool
+	OldOwner       *SID
+	NewOwner       *SID
+	GroupChanged   bool
+	OldGroup       *SID
+	NewGroup       *SID
+	ControlChanged bool
+	OldControl     uint16
+	NewControl     uint16
+	Dacl           ACLDiff
+	Sacl           ACLDiff
+}
+
+// Empty reports whether no differences were found
+func (self *ACLDiff) Empty() bool {
+	return len(self.Added) == 0 && len(self.Removed) == 0 && len(self.Modified) == 0
+}
+
+// Empty reports whether the two security descriptors were equivalent
+func (self *SDDiff) Empty() bool {
+	return !self.OwnerChanged && !self.GroupChanged && !self.ControlChanged && self.Dacl.Empty() && self.Sacl.Empty()
+}
+
+// Diff compares the security descriptor a with the later snapshot b and
+// reports changed owner, group and control flags along with added, removed
+// and modified ACEs in the DACL and SACL. Either argument may be nil.
+func Diff(a, b *SecurityDescriptor) *SDDiff {
+	if a == nil {
+		a = &SecurityDescriptor{}
+	}
+	if b == nil {
+		b = &SecurityDescriptor{}
+	}
+	d := &SDDiff{
+		OldOwner:   a.OwnerSid,
+		NewOwner:   b.OwnerSid,
+		OldGroup:   a.GroupSid,
+		NewGroup:   b.GroupSid,
+		OldControl: a.Control,
+		NewControl: b.Control,
+	}
+	d.OwnerChanged = !a.OwnerSid.Equal(b.OwnerSid)
+	d.GroupChanged = !a.GroupSid.Equal(b.GroupSid)
+	d.ControlChanged = a.Control != b.Control
+	d.Dacl = DiffACL(a.Dacl, b.Dacl)
+	d.Sacl = DiffACL(a.Sacl, b.Sacl)
+	return d
+}
+
+// DiffACL compares two ACLs. ACEs are first paired with identical entries so
+// that reordering is not reported as a change. The remaining ACEs with the
+// same type, trustee and inheritance are reported as modified, and whatever
+// is left over as added or removed.
+func DiffACL(a, b *PACL) (d ACLDiff) {
+	var oldAces, newAces []ACE
+	if a != nil {
+		oldAces = a.ACLS
+	}
+	if b != nil {
+		newAces = b.ACLS
+	}
+	oldUsed := make([]bool, len(oldAces))
+	newUsed := make([]bool, len(newAces))
+
+	for i := range newAces {
+		for j := range oldAces {
+			if !oldUsed[j] && aceEqual(&oldAces[j], &newAces[i]) {
+				oldUsed[j] = true
+				newUsed[i] = true
+				break
+			}
+		}
+	}
+	for i := range newAces {
+		if newUsed[i] {
+			continue
+		}
+		for j := range oldAces {
+			if !oldUsed[j] && aceSameTrustee(&oldAces[j], &newAces[i]) {
+				oldUsed[j] = true
+				newUsed[i] = true
+				d.Modified = append(d.Modified, ACEChange{Old: oldAces[j], New: newAces[i]})
+				break
+			}
+		}
+	}
+	for j := range oldAces {
+		if !oldUsed[j] {
+			d.Removed = append(d.Removed, oldAces[j])
+		}
+	}
+	for i := range newAces {
+		if !newUsed[i] {
+			d.Added = append(d.Added, newAces[i])
+		}
+	}
+	return
+}
+
+func aceSameTrustee(a, b *ACE) bool {
+	return a.Header.Type == b.Header.Type && a.IsInherited() == b.IsInherited() && a.Sid.Equal(&b.Sid)
+}
+
+func aceEqual(a, b *ACE) bool {
+	return aceSameTrustee(a, b) && a.Header.Flags == b.Header.Flags && a.Mask == b.Mask
+}
+
+func formatACE(a *ACE) string {
+	aceType, ok := AceTypeMap[a.Header.Type]
+	if !ok {
+		aceType = fmt.Sprintf("0x%02x", a.Header.Type)
+	}
+	return fmt.Sprintf("%s %s mask=0x%08x flags=%s", aceType, a.Sid.String(), a.Mask, ParseAceFlags(a.Header.Flags))
+}
+
+func (self *ACLDiff) write(b *strings.Builder, name string) {
+	for i := range self.Removed {
+		fmt.Fprintf(b, "%s - %s\n", name, formatACE(&self.Removed[i]))
+	}
+	for i := range self.Added {
+		fmt.Fprintf(b, "%s + %s\n", name, formatACE(&self.Added[i]))
+	}
+	for i := range self.Modified {
+		fmt.Fprintf(b, "%s ~ %s -> mask=0x%08x flags=%s\n", name, formatACE(&self.Modified[i].Old), self.Modified[i].New.Mask, ParseAceFlags(self.Modified[i].New.Header.Flags))
+	}
+}
+
+// String renders the differences with one line per change
+func (self *SDDiff) String() string {
+	var b strings.Builder
+	if self.OwnerChanged {
+		fmt.Fprintf(&b, "Owner: %s -> %s\n", sidOrNone(self.OldOwner), sidOrNone(self.NewOwner))
+	}
+	if self.GroupChanged {
+		fmt.Fprintf(&b, "Group: %s -> %s\n", sidOrNone(self.OldGroup), sidOrNone(self.NewGroup))
+	}
+	if self.ControlChanged {
+		fmt.Fprintf(&b, "Control: 0x%04x -> 0x%04x\n", self.OldControl, self.NewControl)
+	}
+	self.Dacl.write(&b, "DACL")
+	self.Sacl.write(&b, "SACL")
+	return b.String()
+}
+
+func sidOrNone(s *SID) string {
+	if s == nil {
+		return "<none>"
+	}
+	return s.String()
+}
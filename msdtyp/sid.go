@@ -0,0 +1,287 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package msdtyp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Identifier authorities of well-known SIDs
+const (
+	NullSidAuthority        uint64 = 0
+	WorldSidAuthority       uint64 = 1
+	LocalSidAuthority       uint64 = 2
+	CreatorSidAuthority     uint64 = 3
+	NtAuthority             uint64 = 5
+	AppPackageAuthority     uint64 = 15
+	MandatoryLabelAuthority uint64 = 16
+)
+
+// MS-DTYP Section 2.4.2 limits a SID to 15 sub authorities
+const MaxSubAuthorities = 15
+
+// WellKnownSIDs maps the string form of well-known SIDs to friendly names
+// (MS-DTYP Section 2.4.2.4)
+var WellKnownSIDs = map[string]string{
+	"S-1-0-0":      "Null SID",
+	"S-1-1-0":      "Everyone",
+	"S-1-2-0":      "Local",
+	"S-1-2-1":      "Console Logon",
+	"S-1-3-0":      "Creator Owner",
+	"S-1-3-1":      "Creator Group",
+	"S-1-3-2":      "Creator Owner Server",
+	"S-1-3-3":      "Creator Group Server",
+	"S-1-3-4":      "Owner Rights",
+	"S-1-5-1":      "Dialup",
+	"S-1-5-2":      "Network",
+	"S-1-5-3":      "Batch",
+	"S-1-5-4":      "Interactive",
+	"S-1-5-6":      "Service",
+	"S-1-5-7":      "Anonymous Logon",
+	"S-1-5-8":      "Proxy",
+	"S-1-5-9":      "Enterprise Domain Controllers",
+	"S-1-5-10":     "Principal Self",
+	"S-1-5-11":     "Authenticated Users",
+	"S-1-5-12":     "Restricted Code",
+	"S-1-5-13":     "Terminal Server User",
+	"S-1-5-14":     "Remote Interactive Logon",
+	"S-1-5-15":     "This Organization",
+	"S-1-5-17":     "IUSR",
+	"S-1-5-18":     "Local System",
+	"S-1-5-19":     "Local Service",
+	"S-1-5-20":     "Network Service",
+	"S-1-5-32":     "Builtin",
+	"S-1-5-32-544": "Administrators",
+	"S-1-5-32-545": "Users",
+	"S-1-5-32-546": "Guests",
+	"S-1-5-32-547": "Power Users",
+	"S-1-5-32-548": "Account Operators",
+	"S-1-5-32-549": "Server Operators",
+	"S-1-5-32-550": "Print Operators",
+	"S-1-5-32-551": "Backup Operators",
+	"S-1-5-32-552": "Replicator",
+	"S-1-5-32-554": "Pre-Windows 2000 Compatible Access",
+	"S-1-5-32-555": "Remote Desktop Users",
+	"S-1-5-32-556": "Network Configuration Operators",
+	"S-1-5-32-557": "Incoming Forest Trust Builders",
+	"S-1-5-32-558": "Performance Monitor Users",
+	"S-1-5-32-559": "Performance Log Users",
+	"S-1-5-32-560": "Windows Authorization Access Group",
+	"S-1-5-32-561": "Terminal Server License Servers",
+	"S-1-5-32-562": "Distributed COM Users",
+	"S-1-5-32-568": "IIS_IUSRS",
+	"S-1-5-32-569": "Cryptographic Operators",
+	"S-1-5-32-573": "Event Log Readers",
+	"S-1-5-32-574": "Certificate Service DCOM Access",
+	"S-1-5-32-575": "RDS Remote Access Servers",
+	"S-1-5-32-576": "RDS Endpoint Servers",
+	"S-1-5-32-577": "RDS Management Servers",
+	"S-1-5-32-578": "Hyper-V Administrators",
+	"S-1-5-32-579": "Access Control Assistance Operators",
+	"S-1-5-32-580": "Remote Management Users",
+	"S-1-5-32-583": "Device Owners",
+	"S-1-5-64-10":  "NTLM Authentication",
+	"S-1-5-64-14":  "SChannel Authentication",
+	"S-1-5-64-21":  "Digest Authentication",
+	"S-1-5-80-0":   "All Services",
+	"S-1-5-113":    "Local Account",
+	"S-1-5-114":    "Local Account and member of Administrators group",
+	"S-1-15-2-1":   "All Application Packages",
+	"S-1-15-2-2":   "All Restricted Application Packages",
+	"S-1-16-0":     "Untrusted Mandatory Level",
+	"S-1-16-4096":  "Low Mandatory Level",
+	"S-1-16-8192":  "Medium Mandatory Level",
+	"S-1-16-8448":  "Medium Plus Mandatory Level",
+	"S-1-16-12288": "High Mandatory Level",
+	"S-1-16-16384": "System Mandatory Level",
+	"S-1-16-20480": "Protected Process Mandatory Level",
+	"S-1-16-28672": "Secure Process Mandatory Level",
+}
+
+// WellKnownDomainRIDs maps the relative identifiers of well-known accounts
+// and groups in a domain (S-1-5-21-x-y-z-RID) to friendly names
+var WellKnownDomainRIDs = map[uint32]string{
+	500: "Administrator",
+	501: "Guest",
+	502: "krbtgt",
+	503: "DefaultAccount",
+	504: "WDAGUtilityAccount",
+	512: "Domain Admins",
+	513: "Domain Users",
+	514: "Domain Guests",
+	515: "Domain Computers",
+	516: "Domain Controllers",
+	517: "Cert Publishers",
+	518: "Schema Admins",
+	519: "Enterprise Admins",
+	520: "Group Policy Creator Owners",
+	521: "Read-only Domain Controllers",
+	522: "Cloneable Domain Controllers",
+	525: "Protected Users",
+	526: "Key Admins",
+	527: "Enterprise Key Admins",
+	553: "RAS and IAS Servers",
+	571: "Allowed RODC Password Replication Group",
+	572: "Denied RODC Password Replication Group",
+}
+
+// NewSID creates a SID from an identifier authority and its sub authorities
+func NewSID(authority uint64, subAuthorities ...uint32) *SID {
+	auth := make([]byte, 8)
+	binary.BigEndian.PutUint64(auth, authority)
+	return &SID{
+		Revision:       1,
+		NumAuth:        byte(len(subAuthorities)),
+		Authority:      auth[2:],
+		SubAuthorities: append([]uint32{}, subAuthorities...),
+	}
+}
+
+// ParseSID parses the string form of a SID, e.g., S-1-5-21-1-2-3-500. The
+// identifier authority may be written in decimal or in hexadecimal with a 0x
+// prefix as described in MS-DTYP Section 2.4.2.1.
+func ParseSID(s string) (sid *SID, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) < 3 || !strings.EqualFold(parts[0], "S") {
+		return nil, fmt.Errorf("Invalid SID representation: %s", s)
+	}
+	rev, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil || rev != 1 {
+		return nil, fmt.Errorf("Invalid SID revision: %s", s)
+	}
+	var auth uint64
+	if strings.HasPrefix(strings.ToLower(parts[2]), "0x") {
+		auth, err = strconv.ParseUint(parts[2][2:], 16, 48)
+	} else {
+		auth, err = strconv.ParseUint(parts[2], 10, 48)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SID identifier authority: %s", s)
+	}
+	if len(parts)-3 > MaxSubAuthorities {
+		return nil, fmt.Errorf("Too many sub authorities in SID: %s", s)
+	}
+	subAuths := make([]uint32, 0, len(parts)-3)
+	for _, part := range parts[3:] {
+		var subAuth uint64
+		subAuth, err = strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid SID sub authority: %s", s)
+		}
+		subAuths = append(subAuths, uint32(subAuth))
+	}
+	return NewSID(auth, subAuths...), nil
+}
+
+// IdentifierAuthority returns the 48 bit identifier authority of the SID
+func (self *SID) IdentifierAuthority() uint64 {
+	var auth uint64
+	for _, b := range self.Authority {
+		auth = auth<<8 | uint64(b)
+	}
+	return auth
+}
+
+// String returns the string form of the SID. Identifier authorities that do
+// not fit in 32 bits are written in hexadecimal.
+func (self *SID) String() string {
+	auth := self.IdentifierAuthority()
+	var b strings.Builder
+	if auth >= 1<<32 {
+		fmt.Fprintf(&b, "S-%d-0x%012X", self.Revision, auth)
+	} else {
+		fmt.Fprintf(&b, "S-%d-%d", self.Revision, auth)
+	}
+	for _, subAuth := range self.SubAuthorities {
+		fmt.Fprintf(&b, "-%d", subAuth)
+	}
+	return b.String()
+}
+
+// Equal reports whether two SIDs are identical
+func (self *SID) Equal(other *SID) bool {
+	if self == nil || other == nil {
+		return self == other
+	}
+	if self.Revision != other.Revision || self.IdentifierAuthority() != other.IdentifierAuthority() || len(self.SubAuthorities) != len(other.SubAuthorities) {
+		return false
+	}
+	for i := range self.SubAuthorities {
+		if self.SubAuthorities[i] != other.SubAuthorities[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsDomainSID reports whether the SID belongs to an account domain, i.e.,
+// it has the form S-1-5-21-x-y-z with an optional RID.
+func (self *SID) IsDomainSID() bool {
+	n := len(self.SubAuthorities)
+	return self.IdentifierAuthority() == NtAuthority && (n == 4 || n == 5) && self.SubAuthorities[0] == 21
+}
+
+// RID returns the last sub authority of the SID, which is the relative
+// identifier for account SIDs
+func (self *SID) RID() uint32 {
+	if len(self.SubAuthorities) == 0 {
+		return 0
+	}
+	return self.SubAuthorities[len(self.SubAuthorities)-1]
+}
+
+// Domain returns the SID of the domain the account SID belongs to by
+// removing the RID
+func (self *SID) Domain() (*SID, error) {
+	if len(self.SubAuthorities) < 2 {
+		return nil, fmt.Errorf("SID %s has no domain part", self.String())
+	}
+	return NewSID(self.IdentifierAuthority(), self.SubAuthorities[:len(self.SubAuthorities)-1]...), nil
+}
+
+// WithRID returns a new SID with rid appended to the sub authorities, e.g.,
+// the SID of a domain account from the domain SID
+func (self *SID) WithRID(rid uint32) *SID {
+	subAuths := append(append([]uint32{}, self.SubAuthorities...), rid)
+	return NewSID(self.IdentifierAuthority(), subAuths...)
+}
+
+// Name returns the friendly name of a well-known SID or a well-known account
+// of a domain, or an empty string if the SID is not well-known
+func (self *SID) Name() string {
+	if name, found := WellKnownSIDs[self.String()]; found {
+		return name
+	}
+	if self.IsDomainSID() && len(self.SubAuthorities) == 5 {
+		return WellKnownDomainRIDs[self.RID()]
+	}
+	return ""
+}
+
+// IsWellKnown reports whether the SID is a well-known SID or a well-known
+// account of a domain
+func (self *SID) IsWellKnown() bool {
+	return self.Name() != ""
+}
@@ -26,7 +26,9 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"time"
 
+	"github.com/ericblavier/go-smb/smb/encoder"
 	"github.com/jfjallid/golog"
 )
 
@@ -142,7 +144,7 @@ const (
 
 var accessMaskMap = map[uint32]string{
 	0x80000000: AccessMaskGenericRead,
-	0x4000000:  AccessMaskGenericWrite,
+	0x40000000: AccessMaskGenericWrite,
 	0x20000000: AccessMaskGenericExecute,
 	0x10000000: AccessMaskGenericAll,
 	0x02000000: AccessMaskMaximumAllowed,
@@ -154,6 +156,15 @@ var accessMaskMap = map[uint32]string{
 	0x00010000: AccessMaskDelete,
 }
 
+// FILETIME sentinels used for values that never expire
+const (
+	FiletimeNever    uint64 = 0x7FFFFFFFFFFFFFFF
+	FiletimeInfinite uint64 = 0xFFFFFFFFFFFFFFFF
+)
+
+// Number of 100-nanosecond intervals between 1601-01-01 and 1970-01-01
+const filetimeUnixOffset = 116444736000000000
+
 type ReturnCode struct {
 	uint32
 }
@@ -267,6 +278,13 @@ func ReadRPCUnicodeStrArray(r *bytes.Reader, nullTerminated bool) (items []strin
 		return
 	}
 
+	// Each string structure takes 8 bytes
+	err = encoder.CheckCount(uint64(count), 8, r.Len())
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
 	// Need to keep track of strings that are empty and should be skipped
 	readStrAtPos := make([]bool, count)
 	for i := 0; i < int(count); i++ {
@@ -662,6 +680,12 @@ func ReadSID(r *bytes.Reader) (s *SID, err error) {
 		return
 	}
 
+	if s.NumAuth > 15 {
+		err = fmt.Errorf("SID with %d sub authorities exceeds the maximum of 15", s.NumAuth)
+		log.Errorln(err)
+		return
+	}
+
 	s.Authority = make([]byte, 6)
 	err = binary.Read(r, le, &s.Authority)
 	if err != nil {
@@ -765,6 +789,12 @@ func readACE(r *bytes.Reader) (a *ACE, err error) {
 	}
 	a.Sid = *sid
 
+	if int(a.Header.Size) < 16+4*len(sid.SubAuthorities) {
+		err = fmt.Errorf("ACE size %d is smaller than its content", a.Header.Size)
+		log.Errorln(err)
+		return
+	}
+
 	return
 }
 
@@ -837,6 +867,16 @@ func readPACL(r *bytes.Reader) (p *PACL, err error) {
 		return
 	}
 
+	// Each ACE takes at least 16 bytes of the input and of the ACL
+	err = encoder.CheckCount(uint64(p.AceCount), 16, r.Len())
+	if err == nil {
+		err = encoder.CheckCount(uint64(p.AceCount), 16, int(p.AclSize)-8)
+	}
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
 	p.ACLS = make([]ACE, p.AceCount)
 	for i := range p.ACLS {
 		var ace *ACE
@@ -994,3 +1034,45 @@ func (self *Filetime) ToString() string {
 	t := ConvertFromFiletime(self)
 	return t.String()
 }
+
+// Uint64 returns the FILETIME as a single 64-bit value
+func (self *Filetime) Uint64() uint64 {
+	return uint64(self.HighDateTime)<<32 | uint64(self.LowDateTime)
+}
+
+// ToTime converts the FILETIME to a time.Time. Zero and the never sentinels
+// are returned as the zero Time.
+func (self *Filetime) ToTime() time.Time {
+	return FiletimeToTime(self.Uint64())
+}
+
+// FromTime sets the FILETIME from a time.Time
+func (self *Filetime) FromTime(t time.Time) {
+	ft := TimeToFiletime(t)
+	self.LowDateTime = uint32(ft)
+	self.HighDateTime = uint32(ft >> 32)
+}
+
+// IsNever reports whether the FILETIME holds one of the sentinels used for
+// values that never expire, e.g., the AccountExpires field of a SAM account
+func (self *Filetime) IsNever() bool {
+	return self.Uint64() >= FiletimeNever
+}
+
+// Uint64 returns the FILETIME as a single 64-bit value
+func (self *PFiletime) Uint64() uint64 {
+	return uint64(self.HighDateTime)<<32 | uint64(self.LowDateTime)
+}
+
+// ToTime converts the FILETIME to a time.Time. Zero and the never sentinels
+// are returned as the zero Time.
+func (self *PFiletime) ToTime() time.Time {
+	return FiletimeToTime(self.Uint64())
+}
+
+// FromTime sets the FILETIME from a time.Time
+func (self *PFiletime) FromTime(t time.Time) {
+	ft := TimeToFiletime(t)
+	self.LowDateTime = uint32(ft)
+	self.HighDateTime = uint32(ft >> 32)
+}
@@ -0,0 +1,643 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package msdtyp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestSID(t *testing.T) {
+	correctSidBytes, err := hex.DecodeString("01020000000000052000000020020000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sid := SID{
+		Revision:       0x1,
+		NumAuth:        2,
+		Authority:      []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x5},
+		SubAuthorities: []uint32{32, 544},
+	}
+
+	sidBytes, err := sid.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Compare(sidBytes, correctSidBytes) != 0 {
+		t.Fatal("Marshalled bytes of sid structure does not match correct serialization")
+	}
+
+	sid2 := SID{}
+
+	err = sid2.UnmarshalBinary(correctSidBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sid2.Revision != 0x1 {
+		t.Fail()
+	}
+	if sid2.NumAuth != 2 {
+		t.Fail()
+	}
+	if bytes.Compare(sid2.Authority, []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x5}) != 0 {
+		t.Fail()
+	}
+	if sid2.SubAuthorities[0] != 32 {
+		t.Fail()
+	}
+	if sid2.SubAuthorities[1] != 544 {
+		t.Fail()
+	}
+}
+
+func TestACE(t *testing.T) {
+	correctAceBytes, err := hex.DecodeString("000218000900060001020000000000052000000020020000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid := SID{
+		Revision:       0x1,
+		NumAuth:        2,
+		Authority:      []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x5},
+		SubAuthorities: []uint32{32, 544},
+	}
+	ace := ACE{
+		Header: ACEHeader{
+			Type:  0,
+			Flags: 0x2,
+			Size:  24,
+		},
+		Mask: 0x00060009,
+		Sid:  sid,
+	}
+	aceBytes, err := ace.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Compare(aceBytes, correctAceBytes) != 0 {
+		t.Fail()
+	}
+
+	ace2 := ACE{}
+
+	err = ace2.UnmarshalBinary(correctAceBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ace2.Header.Type != 0 {
+		t.Fail()
+	}
+	if ace2.Header.Flags != 0x2 {
+		t.Fail()
+	}
+	if ace2.Header.Size != 24 {
+		t.Fail()
+	}
+	if ace2.Mask != 0x00060009 {
+		t.Fail()
+	}
+
+	if ace2.Sid.Revision != 0x1 {
+		t.Fail()
+	}
+	if ace2.Sid.NumAuth != 2 {
+		t.Fail()
+	}
+	if bytes.Compare(ace2.Sid.Authority, []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x5}) != 0 {
+		t.Fail()
+	}
+	if ace2.Sid.SubAuthorities[0] != 32 {
+		t.Fail()
+	}
+	if ace2.Sid.SubAuthorities[1] != 544 {
+		t.Fail()
+	}
+
+	otherAceCorrectBytes, err := hex.DecodeString("001218000000060001020000000000052000000020020000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherAce := ACE{
+		Header: ACEHeader{
+			Type:  0,
+			Flags: 0x12,
+			Size:  24,
+		},
+		Mask: 0x00060000,
+		Sid: SID{
+			Revision:       0x1,
+			NumAuth:        2,
+			Authority:      []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x5},
+			SubAuthorities: []uint32{32, 544},
+		},
+	}
+
+	otherAceBytes, err := otherAce.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Compare(otherAceBytes, otherAceCorrectBytes) != 0 {
+		t.Fail()
+	}
+
+	ace3 := ACE{}
+	err = ace3.UnmarshalBinary(otherAceCorrectBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ace3.Header.Type != 0 {
+		t.Fail()
+	}
+	if ace3.Header.Flags != 0x12 {
+		t.Fail()
+	}
+	if ace3.Header.Size != 24 {
+		t.Fail()
+	}
+	if ace3.Mask != 0x00060000 {
+		t.Fail()
+	}
+
+	if ace3.Sid.Revision != 0x1 {
+		t.Fail()
+	}
+	if ace3.Sid.NumAuth != 2 {
+		t.Fail()
+	}
+	if bytes.Compare(ace3.Sid.Authority, []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x5}) != 0 {
+		t.Fail()
+	}
+	if ace3.Sid.SubAuthorities[0] != 32 {
+		t.Fail()
+	}
+	if ace3.Sid.SubAuthorities[1] != 544 {
+		t.Fail()
+	}
+
+	otherAceCorrectBytes2, err := hex.DecodeString("001214003f000f00010100000000000512000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherAce2 := ACE{
+		Header: ACEHeader{
+			Type:  0,
+			Flags: 0x12,
+			Size:  20,
+		},
+		Mask: 0x000f003f,
+		Sid: SID{
+			Revision:       0x1,
+			NumAuth:        1,
+			Authority:      []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x5},
+			SubAuthorities: []uint32{18},
+		},
+	}
+
+	otherAceBytes2, err := otherAce2.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Compare(otherAceBytes2, otherAceCorrectBytes2) != 0 {
+		t.Fail()
+	}
+
+	ace3 = ACE{}
+	err = ace3.UnmarshalBinary(otherAceCorrectBytes2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ace3.Header.Type != 0 {
+		t.Fail()
+	}
+	if ace3.Header.Flags != 0x12 {
+		t.Fail()
+	}
+	if ace3.Header.Size != 20 {
+		t.Fail()
+	}
+	if ace3.Mask != 0x000f003f {
+		t.Fail()
+	}
+
+	if ace3.Sid.Revision != 0x1 {
+		t.Fail()
+	}
+	if ace3.Sid.NumAuth != 1 {
+		t.Fail()
+	}
+	if bytes.Compare(ace3.Sid.Authority, []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x5}) != 0 {
+		t.Fail()
+	}
+	if ace3.Sid.SubAuthorities[0] != 18 {
+		t.Fail()
+	}
+}
+
+func TestPACL(t *testing.T) {
+	correctPaclBytes, err := hex.DecodeString("0200c40008000000000218000900060001020000000000052000000020020000000218000900060001020000000000052000000020020000000218000900060001020000000000052000000020020000000218000900060001020000000000052000000020020000000218000900060001020000000000052000000020020000000218000900060001020000000000052000000020020000001218000000060001020000000000052000000020020000001214003f000f00010100000000000512000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	standardAce := ACE{
+		Header: ACEHeader{
+			Type:  0,
+			Flags: 0x2,
+			Size:  24,
+		},
+		Mask: 0x00060009,
+		Sid: SID{
+			Revision:       0x1,
+			NumAuth:        2,
+			Authority:      []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x5},
+			SubAuthorities: []uint32{32, 544},
+		},
+	}
+
+	pacl := PACL{
+		AclRevision: 2,
+		AclSize:     196,
+		AceCount:    8,
+		ACLS: []ACE{
+			standardAce,
+			standardAce,
+			standardAce,
+			standardAce,
+			standardAce,
+			standardAce,
+			ACE{
+				Header: ACEHeader{
+					Type:  0,
+					Flags: 0x12,
+					Size:  24,
+				},
+				Mask: 0x00060000,
+				Sid:  standardAce.Sid,
+			},
+			ACE{
+				Header: ACEHeader{
+					Type:  0,
+					Flags: 0x12,
+					Size:  20,
+				},
+				Mask: 0x000f003f,
+				Sid: SID{
+					Revision:       1,
+					NumAuth:        1,
+					Authority:      []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x5},
+					SubAuthorities: []uint32{18},
+				},
+			},
+		},
+	}
+
+	paclBytes, err := pacl.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Compare(paclBytes, correctPaclBytes) != 0 {
+		t.Fatal("Marshalled bytes did not match correct serialization")
+	}
+
+	pacl2 := PACL{}
+	err = pacl2.UnmarshalBinary(correctPaclBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pacl2.AclRevision != 2 {
+		t.Fail()
+	}
+	if pacl2.AclSize != 196 {
+		t.Fail()
+	}
+	if pacl2.AceCount != 8 {
+		t.Fail()
+	}
+}
+
+func TestParseSID(t *testing.T) {
+	sid, err := ParseSID("S-1-5-21-1004336348-1177238915-682003330-512")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sid.String() != "S-1-5-21-1004336348-1177238915-682003330-512" {
+		t.Fatal("Fail")
+	}
+	if !sid.IsDomainSID() || sid.RID() != 512 || sid.Name() != "Domain Admins" || !sid.IsWellKnown() {
+		t.Fatal("Fail")
+	}
+	domain, err := sid.Domain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domain.String() != "S-1-5-21-1004336348-1177238915-682003330" || domain.IsWellKnown() {
+		t.Fatal("Fail")
+	}
+	if !domain.WithRID(512).Equal(sid) {
+		t.Fatal("Fail")
+	}
+	buf, err := sid.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sid2 SID
+	err = sid2.UnmarshalBinary(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sid2.Equal(sid) || sid2.ToString() != sid.String() {
+		t.Fatal("Fail")
+	}
+
+	sid, err = ParseSID("S-1-5-32-544")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sid.Name() != "Administrators" || sid.IsDomainSID() {
+		t.Fatal("Fail")
+	}
+
+	sid, err = ParseSID("S-1-0x123456789ABC-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sid.String() != "S-1-0x123456789ABC-1" || sid.IsWellKnown() {
+		t.Fatal("Fail")
+	}
+
+	for _, s := range []string{"", "S-1", "X-1-5", "S-2-5-32", "S-1-5-abc", "S-1-5-1-2-3-4-5-6-7-8-9-10-11-12-13-14-15-16"} {
+		if _, err = ParseSID(s); err == nil {
+			t.Fatalf("Fail: %s", s)
+		}
+	}
+}
+
+func TestCanonicalACL(t *testing.T) {
+	admins, _ := ParseSID("S-1-5-32-544")
+	users, _ := ParseSID("S-1-5-32-545")
+	everyone, _ := ParseSID("S-1-1-0")
+
+	acl := NewPACL([]ACE{
+		NewACE(AccessAllowedAceType, 0, 0x1, users),
+		NewACE(AccessAllowedAceType, InheritedAce, 0xf003f, admins),
+		NewACE(AccessDeniedAceType, 0, 0x2, users),
+	})
+	if acl.IsCanonical() {
+		t.Fatal("Fail")
+	}
+	acl.Canonicalize()
+	if !acl.IsCanonical() || acl.ACLS[0].Header.Type != AccessDeniedAceType || !acl.ACLS[2].IsInherited() {
+		t.Fatal("Fail")
+	}
+
+	acl.InsertACE(NewACE(AccessAllowedAceType, 0, 0x20019, everyone))
+	if !acl.IsCanonical() || !acl.ACLS[2].Sid.Equal(everyone) {
+		t.Fatal("Fail")
+	}
+	acl.InsertACE(NewACE(AccessDeniedAceType, 0, 0x10000, everyone))
+	if !acl.IsCanonical() || !acl.ACLS[1].Sid.Equal(everyone) || acl.AceCount != 5 {
+		t.Fatal("Fail")
+	}
+	buf, err := acl.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != int(acl.AclSize) {
+		t.Fatal("Fail")
+	}
+
+	// Users is denied 0x2 and DELETE through Everyone but granted 0x1 and read
+	if acl.EffectiveAccess(users, everyone) != 0x1|0x20019&^0x10000&^0x2 {
+		t.Fatal("Fail")
+	}
+	if acl.EffectiveAccess(admins) != 0xf003f {
+		t.Fatal("Fail")
+	}
+
+	if acl.RemoveACEs(users, true) != 2 || acl.AceCount != 3 {
+		t.Fatal("Fail")
+	}
+	if acl.RemoveACEs(admins, true) != 0 || acl.RemoveACEs(admins, false) != 1 {
+		t.Fatal("Fail")
+	}
+	if acl.RemoveACE(5) == nil || acl.RemoveACE(0) != nil || len(acl.ACLS) != 1 {
+		t.Fatal("Fail")
+	}
+}
+
+func TestFiletime(t *testing.T) {
+	// 2020-01-01T00:00:00Z
+	var ft uint64 = 0x01D5C03669050000
+	tm := FiletimeToTime(ft)
+	if !tm.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatal("Fail")
+	}
+	if TimeToFiletime(tm) != ft {
+		t.Fatal("Fail")
+	}
+	f := Filetime{}
+	f.FromTime(tm)
+	if f.Uint64() != ft || !f.ToTime().Equal(tm) {
+		t.Fatal("Fail")
+	}
+
+	// 1601 epoch and dates before 1970
+	old := time.Date(1900, 6, 1, 12, 0, 0, 0, time.UTC)
+	if !FiletimeToTime(TimeToFiletime(old)).Equal(old) {
+		t.Fatal("Fail")
+	}
+	if TimeToFiletime(time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)) != 0 {
+		t.Fatal("Fail")
+	}
+
+	// Sentinels
+	if !FiletimeToTime(0).IsZero() || TimeToFiletime(time.Time{}) != 0 {
+		t.Fatal("Fail")
+	}
+	if !FiletimeToTime(FiletimeNever).IsZero() || !FiletimeToTime(FiletimeInfinite).IsZero() {
+		t.Fatal("Fail")
+	}
+	f = Filetime{LowDateTime: 0xffffffff, HighDateTime: 0x7fffffff}
+	if !f.IsNever() {
+		t.Fatal("Fail")
+	}
+}
+
+func TestAccessMaskDecode(t *testing.T) {
+	// GENERIC_READ on a file maps to FILE_GENERIC_READ
+	rights := AccessMask(0x80000000).DecodeFile()
+	expected := []string{"FILE_READ_DATA", "FILE_READ_EA", "FILE_READ_ATTRIBUTES", "READ_CONTROL", "SYNCHRONIZE"}
+	if len(rights) != len(expected) {
+		t.Fatal("Fail")
+	}
+	for i := range rights {
+		if rights[i] != expected[i] {
+			t.Fatal("Fail")
+		}
+	}
+
+	rights = AccessMask(0x10000000 | 0x01000000).DecodeFile()
+	if len(rights) != 2 || rights[0] != "FILE_ALL_ACCESS" || rights[1] != "ACCESS_SYSTEM_SECURITY" {
+		t.Fatal("Fail")
+	}
+
+	rights = AccessMask(0x000F003F).DecodeRegistry()
+	if len(rights) != 1 || rights[0] != "KEY_ALL_ACCESS" {
+		t.Fatal("Fail")
+	}
+
+	if AccessMask(0x20000000).MapGeneric(ServiceGenericMapping) != 0x00020170 {
+		t.Fatal("Fail")
+	}
+	rights = AccessMask(0x00000014 | 0x00400000).DecodeService()
+	if len(rights) != 3 || rights[0] != "SERVICE_QUERY_STATUS" || rights[1] != "SERVICE_START" || rights[2] != "0x00400000" {
+		t.Fatal("Fail")
+	}
+
+	rights = AccessMask(0x40000000).DecodeGeneric()
+	if len(rights) != 1 || rights[0] != "GENERIC_WRITE" {
+		t.Fatal("Fail")
+	}
+}
+
+func TestSecurityDescriptorDiff(t *testing.T) {
+	admins, _ := ParseSID("S-1-5-32-544")
+	users, _ := ParseSID("S-1-5-32-545")
+	system, _ := ParseSID("S-1-5-18")
+	everyone, _ := ParseSID("S-1-1-0")
+
+	sdA := &SecurityDescriptor{
+		OwnerSid: admins,
+		GroupSid: system,
+		Dacl: NewPACL([]ACE{
+			NewACE(AccessAllowedAceType, 0, 0x001F01FF, system),
+			NewACE(AccessAllowedAceType, 0, 0x00120089, users),
+			NewACE(AccessAllowedAceType, InheritedAce, 0x00120089, everyone),
+		}),
+	}
+	sdB := &SecurityDescriptor{
+		OwnerSid: users,
+		GroupSid: system,
+		Dacl: NewPACL([]ACE{
+			NewACE(AccessAllowedAceType, 0, 0x001301BF, users),
+			NewACE(AccessAllowedAceType, 0, 0x001F01FF, system),
+			NewACE(AccessDeniedAceType, 0, 0x00010000, everyone),
+		}),
+	}
+
+	if !Diff(sdA, sdA).Empty() {
+		t.Fatal("Fail")
+	}
+
+	d := Diff(sdA, sdB)
+	if !d.OwnerChanged || d.GroupChanged || d.ControlChanged {
+		t.Fatal("Fail")
+	}
+	if len(d.Dacl.Modified) != 1 || !d.Dacl.Modified[0].New.Sid.Equal(users) || d.Dacl.Modified[0].New.Mask != 0x001301BF {
+		t.Fatal("Fail")
+	}
+	if len(d.Dacl.Removed) != 1 || !d.Dacl.Removed[0].IsInherited() {
+		t.Fatal("Fail")
+	}
+	if len(d.Dacl.Added) != 1 || !d.Dacl.Added[0].IsDeny() {
+		t.Fatal("Fail")
+	}
+	if !d.Sacl.Empty() || d.String() == "" {
+		t.Fatal("Fail")
+	}
+}
+
+func FuzzUnmarshalSecurityDescriptor(f *testing.F) {
+	for _, seed := range []string{
+		"01000480480000005800000000000000140000000200340002000000001214003f000f000101000000000005120000000012180000000600010200000000000520000000200200000102000000000005200000002002000001010000000000051200000000000000",
+		"0200c40008000000000218000900060001020000000000052000000020020000001214003f000f00010100000000000512000000",
+		"01020000000000052000000020020000",
+		"0400000000000000040000004100420043000000",
+	} {
+		buf, err := hex.DecodeString(seed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		(&SecurityDescriptor{}).UnmarshalBinary(data)
+		(&PACL{}).UnmarshalBinary(data)
+		(&ACE{}).UnmarshalBinary(data)
+		(&SID{}).UnmarshalBinary(data)
+		ReadConformantVaryingString(bytes.NewReader(data), true)
+		ReadConformantVaryingArray(bytes.NewReader(data))
+		ReadRPCUnicodeStrArray(bytes.NewReader(data), true)
+	})
+}
+
+func TestUnmarshalHugeCounts(t *testing.T) {
+	// ACL claiming 0xffffffff ACEs
+	pacl := PACL{}
+	if err := pacl.UnmarshalBinary([]byte{0x02, 0x00, 0x08, 0x00, 0xff, 0xff, 0xff, 0xff}); err == nil {
+		t.Fatal("Fail")
+	}
+	// Conformant varying string with an actual count of 0xffffffff
+	buf := []byte{0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0x41, 0x00}
+	if _, err := ReadConformantVaryingString(bytes.NewReader(buf), true); err == nil {
+		t.Fatal("Fail")
+	}
+
+	// A SID with more sub authorities than allowed
+	sid := append([]byte{0x01, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05}, make([]byte, 16*4)...)
+	if err := (&SID{}).UnmarshalBinary(sid); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestGuid(t *testing.T) {
+	guid, err := GuidFromString("{8a885d04-1ceb-11c9-9fe8-08002b104860}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x04, 0x5d, 0x88, 0x8a, 0xeb, 0x1c, 0xc9, 0x11, 0x9f, 0xe8, 0x08, 0x00, 0x2b, 0x10, 0x48, 0x60}
+	if !bytes.Equal(guid, expected) {
+		t.Fatalf("Fail: %x", guid)
+	}
+	if GuidToString(guid) != "8a885d04-1ceb-11c9-9fe8-08002b104860" {
+		t.Fatal("Fail")
+	}
+	for _, s := range []string{"", "8a885d04-1ceb-11c9-9fe8", "8a885d041ceb11c99fe808002b104860", "8a885d04-1ceb-11c9-9fe8-08002b10486g"} {
+		if _, err = GuidFromString(s); err == nil {
+			t.Fatalf("Fail: %s", s)
+		}
+	}
+	if GuidToString(guid[:15]) != "" {
+		t.Fatal("Fail")
+	}
+}
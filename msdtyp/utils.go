@@ -31,6 +31,8 @@ import (
 	"strings"
 	"time"
 	"unicode/utf16"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
 )
 
 func FromUnicodeString(buf []byte) (res string, err error) {
@@ -94,6 +96,16 @@ func StripNullByte(s string) string {
 	return s
 }
 
+// checkConformantVarying validates the counts of a conformant and varying
+// string or array, where the transmitted elements must fit within the max
+// count
+func checkConformantVarying(maxCount, offset, actualCount uint32) error {
+	if offset > maxCount || actualCount > maxCount-offset {
+		return fmt.Errorf("Actual count %d at offset %d exceeds max count %d", actualCount, offset, maxCount)
+	}
+	return nil
+}
+
 // Borrowed from NDR but modified to support edge case where the unicode string is NOT terminated
 // with a null byte
 func ReadConformantVaryingString(r *bytes.Reader, nullTerminated bool) (s string, err error) {
@@ -119,6 +131,11 @@ func ReadConformantVaryingString(r *bytes.Reader, nullTerminated bool) (s string
 		log.Errorln(err)
 		return
 	}
+	err = checkConformantVarying(maxCount, offset, actualCount)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
 	if offset > 0 {
 		_, err = r.Seek(int64(offset), io.SeekCurrent)
 		if err != nil {
@@ -128,6 +145,11 @@ func ReadConformantVaryingString(r *bytes.Reader, nullTerminated bool) (s string
 	}
 
 	if actualCount > 0 {
+		err = encoder.CheckCount(uint64(actualCount), 2, r.Len())
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
 		// Read the unicode string
 		unc := make([]byte, actualCount*2)
 		err = binary.Read(r, le, unc)
@@ -330,6 +352,11 @@ func ReadConformantVaryingArray(r *bytes.Reader) (data []byte, maxLength uint32,
 		return
 	}
 
+	err = checkConformantVarying(maxLength, offset, actualCount)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
 	if offset > 0 {
 		_, err = r.Seek(int64(offset), io.SeekCurrent)
 		if err != nil {
@@ -339,6 +366,11 @@ func ReadConformantVaryingArray(r *bytes.Reader) (data []byte, maxLength uint32,
 	}
 
 	if actualCount > 0 {
+		err = encoder.CheckCount(uint64(actualCount), 1, r.Len())
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
 		data = make([]byte, actualCount)
 		err = binary.Read(r, le, &data)
 		if err != nil {
@@ -474,18 +506,42 @@ func ConvertStrToSID(s string) (sid *SID, err error) {
 }
 
 func ConvertToFiletime(t time.Time) uint64 {
-	// Credit to https://github.com/Azure/go-ntlmssp/blob/master/unicode.go for logic
-	ft := uint64(t.UnixNano()) / 100
-	ft += 116444736000000000 // add time between unix & windows offset
-	return ft
+	return TimeToFiletime(t)
 }
 
 func ConvertFromFiletime(t *Filetime) time.Time {
-	var ft uint64
-	ft = (uint64(t.HighDateTime) << 32) | (uint64(t.LowDateTime))
-	ft -= 116444736000000000 // remove time between unix & windows offset
-	ft *= 100
-	return time.Unix(0, int64(ft))
+	return t.ToTime()
+}
+
+// FiletimeToTime converts a FILETIME, the number of 100-nanosecond intervals
+// since January 1, 1601 (UTC), to a time.Time. Zero and the never/infinite
+// sentinels are returned as the zero Time.
+func FiletimeToTime(ft uint64) time.Time {
+	if ft == 0 || ft >= FiletimeNever {
+		return time.Time{}
+	}
+	d := int64(ft) - filetimeUnixOffset
+	secs := d / 10000000
+	rem := d % 10000000
+	if rem < 0 {
+		secs--
+		rem += 10000000
+	}
+	return time.Unix(secs, rem*100)
+}
+
+// TimeToFiletime converts a time.Time to a FILETIME. The zero Time and times
+// before 1601 are returned as 0.
+func TimeToFiletime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	// Credit to https://github.com/Azure/go-ntlmssp/blob/master/unicode.go for logic
+	secs := t.Unix() + filetimeUnixOffset/10000000
+	if secs < 0 {
+		return 0
+	}
+	return uint64(secs)*10000000 + uint64(t.Nanosecond()/100)
 }
 
 func ParseAccessMask(mask uint32) []string {
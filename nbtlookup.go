@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/netbios"
+)
+
+// Record of a name registered by a node printed in JSON mode
+type nbtNameRecord struct {
+	Host   string `json:"host"`
+	Name   string `json:"name"`
+	Suffix string `json:"suffix"`
+	Group  bool   `json:"group"`
+	Active bool   `json:"active"`
+	Type   string `json:"type"`
+	MAC    string `json:"mac,omitempty"`
+}
+
+// Record of an address a name resolved to printed in JSON mode
+type nbtAddressRecord struct {
+	Name   string `json:"name"`
+	Suffix string `json:"suffix"`
+	IP     string `json:"ip"`
+}
+
+// parseSuffix parses the suffix of a name given in hex, e.g. 20 or <1C>
+func parseSuffix(s string) (byte, error) {
+	v, err := strconv.ParseUint(strings.Trim(s, "<>"), 16, 8)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid NetBIOS suffix %s. Expecting a hex byte such as 20", s)
+	}
+	return byte(v), nil
+}
+
+// calledName returns the called name of the NetBIOS session request on port
+// 139, asking the host for its file server name unless set by the flag
+func calledName(host string) string {
+	if *netbiosName != "" {
+		return *netbiosName
+	}
+	status, err := netbios.QueryNodeStatus(host, 2*time.Second)
+	if err != nil || status.ServerName() == "" {
+		return netbios.DefaultCalledName
+	}
+	return status.ServerName()
+}
+
+func printNodeStatus(host string, status *netbios.NodeStatus) {
+	for _, e := range status.Names {
+		if *jsonOutput {
+			emit(nbtNameRecord{Host: host, Name: e.Name, Suffix: fmt.Sprintf("%02X", e.Suffix), Group: e.IsGroup(), Active: e.IsActive(), Type: e.Type(), MAC: status.MAC.String()})
+			continue
+		}
+		kind := "UNIQUE"
+		if e.IsGroup() {
+			kind = "GROUP"
+		}
+		state := "Inactive"
+		if e.IsActive() {
+			state = "Active"
+		}
+		fmt.Printf("  %-15s <%02X>  %-6s  %-8s  %s\n", e.Name, e.Suffix, kind, state, e.Type())
+	}
+	if !*jsonOutput && status.MAC != nil {
+		fmt.Printf("  MAC Address = %s\n", strings.ToUpper(strings.ReplaceAll(status.MAC.String(), ":", "-")))
+	}
+}
+
+func runNbtlookup(args []string) error {
+	fs := flag.NewFlagSet("nbtlookup", flag.ExitOnError)
+	name := fs.String("name", "", "Resolve this name instead of listing the names of the host")
+	suffix := fs.String("suffix", "20", "Suffix of the name to resolve in hex, e.g. 00, 1C or 20")
+	broadcast := fs.Bool("broadcast", false, "Broadcast the name query, the host being a broadcast address such as 192.168.1.255")
+	wait := fs.Duration("wait", 2*time.Second, "Time to wait for responses")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *broadcast && *name == "" {
+		return fmt.Errorf("Usage: nbtlookup [-name name [-suffix hex] [-broadcast]] [-wait duration] <host>")
+	}
+	host := fs.Arg(0)
+
+	if *name == "" {
+		status, err := netbios.QueryNodeStatus(host, *wait)
+		if err != nil {
+			return err
+		}
+		printNodeStatus(host, status)
+		return nil
+	}
+
+	s, err := parseSuffix(*suffix)
+	if err != nil {
+		return err
+	}
+	ips, err := netbios.QueryName(host, *name, s, *broadcast, *wait)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve %s<%02X>: %s", *name, s, err)
+	}
+	for _, ip := range ips {
+		if *jsonOutput {
+			emit(nbtAddressRecord{Name: strings.ToUpper(*name), Suffix: fmt.Sprintf("%02X", s), IP: ip.String()})
+		} else {
+			fmt.Printf("%s %s<%02X>\n", ip, strings.ToUpper(*name), s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+func TestParseSuffix(t *testing.T) {
+	for s, want := range map[string]byte{"20": 0x20, "<1C>": 0x1c, "0": 0} {
+		if v, err := parseSuffix(s); err != nil || v != want {
+			t.Fatalf("Fail: %s %x %v", s, v, err)
+		}
+	}
+	if _, err := parseSuffix("1FF"); err == nil {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,468 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package netbios implements the parts of NetBIOS over TCP/IP (RFC 1001 and
+// RFC 1002) needed to reach SMB servers when DNS is not available: name
+// queries and node status requests of the name service, and the session
+// request sent before SMB on port 139.
+package netbios
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jfjallid/golog"
+)
+
+var (
+	log = golog.Get("github.com/ericblavier/go-smb/netbios")
+	be  = binary.BigEndian
+)
+
+const (
+	NameServicePort    = 137
+	SessionServicePort = 139
+)
+
+// Suffixes, the 16th byte of a NetBIOS name, of the common name types
+const (
+	SuffixWorkstation         byte = 0x00
+	SuffixMessenger           byte = 0x03
+	SuffixDomainMasterBrowser byte = 0x1b
+	SuffixDomainControllers   byte = 0x1c
+	SuffixMasterBrowser       byte = 0x1d
+	SuffixBrowserElection     byte = 0x1e
+	SuffixFileServer          byte = 0x20
+)
+
+// Name flags of RFC 1002 Section 4.2.18
+const (
+	NameFlagGroup      uint16 = 0x8000
+	NameFlagOwnerType  uint16 = 0x6000
+	NameFlagDeregister uint16 = 0x1000
+	NameFlagConflict   uint16 = 0x0800
+	NameFlagActive     uint16 = 0x0400
+	NameFlagPermanent  uint16 = 0x0200
+	nameFlagOwnerShift        = 13
+	maxNameLength             = 15
+	encodedNameLength         = 32
+	headerSize                = 12
+	nodeStatusNameSize        = 18
+	nodeStatusMACSize         = 6
+	flagResponse       uint16 = 0x8000
+	flagRecursion      uint16 = 0x0100
+	flagBroadcast      uint16 = 0x0010
+	rcodeMask          uint16 = 0x000f
+	rcodeNameError     uint16 = 3
+	rrTypeNB           uint16 = 0x0020
+	rrTypeNBSTAT       uint16 = 0x0021
+	rrClassIN          uint16 = 0x0001
+)
+
+// Owner node types of a name
+var OwnerTypeMap = map[uint16]string{
+	0: "B-node",
+	1: "P-node",
+	2: "M-node",
+	3: "H-node",
+}
+
+// Descriptions of the name types of a unique and a group name by suffix
+var uniqueNameTypes = map[byte]string{
+	SuffixWorkstation:         "Workstation Service",
+	SuffixMessenger:           "Messenger Service",
+	SuffixDomainMasterBrowser: "Domain Master Browser",
+	SuffixMasterBrowser:       "Master Browser",
+	SuffixFileServer:          "File Server Service",
+}
+
+var groupNameTypes = map[byte]string{
+	SuffixWorkstation:       "Domain Name",
+	SuffixDomainControllers: "Domain Controllers",
+	SuffixBrowserElection:   "Browser Service Elections",
+}
+
+// ErrNameNotFound is returned when no node answers for a queried name
+var ErrNameNotFound = errors.New("NetBIOS name not found")
+
+// EncodeName returns the first level encoding of a name with the given
+// suffix as a label of RFC 1001 Section 14.1, followed by the empty label
+// ending the name. Names are upper cased and padded with spaces, except for
+// the wildcard name "*" which is padded with zeros.
+func EncodeName(name string, suffix byte) []byte {
+	raw := make([]byte, maxNameLength+1)
+	pad := byte(' ')
+	if name == "*" {
+		pad = 0
+	}
+	for i := range maxNameLength {
+		raw[i] = pad
+	}
+	copy(raw[:maxNameLength], strings.ToUpper(name))
+	raw[maxNameLength] = suffix
+
+	buf := make([]byte, 0, encodedNameLength+2)
+	buf = append(buf, encodedNameLength)
+	for _, c := range raw {
+		buf = append(buf, 'A'+c>>4, 'A'+c&0x0f)
+	}
+	return append(buf, 0)
+}
+
+// DecodeName decodes a name encoded by EncodeName at the start of buf and
+// returns the name without padding, its suffix and the number of bytes read.
+// A scope following the name is skipped.
+func DecodeName(buf []byte) (name string, suffix byte, n int, err error) {
+	if len(buf) < encodedNameLength+2 || buf[0] != encodedNameLength {
+		return "", 0, 0, fmt.Errorf("Invalid encoded NetBIOS name")
+	}
+	raw := make([]byte, maxNameLength+1)
+	for i := range raw {
+		hi, lo := buf[1+2*i]-'A', buf[2+2*i]-'A'
+		if hi > 0x0f || lo > 0x0f {
+			return "", 0, 0, fmt.Errorf("Invalid encoded NetBIOS name")
+		}
+		raw[i] = hi<<4 | lo
+	}
+	n = 1 + encodedNameLength
+	for buf[n] != 0 {
+		n += 1 + int(buf[n])
+		if n >= len(buf) {
+			return "", 0, 0, fmt.Errorf("Invalid encoded NetBIOS name scope")
+		}
+	}
+	return strings.TrimRight(string(raw[:maxNameLength]), " \x00"), raw[maxNameLength], n + 1, nil
+}
+
+// NameEntry is a name registered by a node as returned by a node status request
+type NameEntry struct {
+	Name   string
+	Suffix byte
+	Flags  uint16
+}
+
+func (self NameEntry) IsGroup() bool {
+	return self.Flags&NameFlagGroup != 0
+}
+
+func (self NameEntry) IsActive() bool {
+	return self.Flags&NameFlagActive != 0
+}
+
+// OwnerType returns the node type of the owner of the name, e.g. "H-node"
+func (self NameEntry) OwnerType() string {
+	return OwnerTypeMap[(self.Flags&NameFlagOwnerType)>>nameFlagOwnerShift]
+}
+
+// Type describes the name type from its suffix, e.g. "File Server Service"
+func (self NameEntry) Type() string {
+	types := uniqueNameTypes
+	if self.IsGroup() {
+		types = groupNameTypes
+	}
+	if t, ok := types[self.Suffix]; ok {
+		return t
+	}
+	return fmt.Sprintf("Unknown <%02X>", self.Suffix)
+}
+
+// NodeStatus is the reply to a node status request
+type NodeStatus struct {
+	Names []NameEntry
+	MAC   net.HardwareAddr // Unit ID of the node, zero for Samba
+}
+
+// ServerName returns the unique name registered by the file server of the
+// node, which is the called name of a session request, or an empty string
+// when the node does not run the file server service
+func (self *NodeStatus) ServerName() string {
+	for _, e := range self.Names {
+		if e.Suffix == SuffixFileServer && !e.IsGroup() {
+			return e.Name
+		}
+	}
+	return ""
+}
+
+// Domain returns the group name of the workgroup or domain of the node
+func (self *NodeStatus) Domain() string {
+	for _, e := range self.Names {
+		if e.Suffix == SuffixWorkstation && e.IsGroup() {
+			return e.Name
+		}
+	}
+	return ""
+}
+
+// Header of a name service packet of RFC 1002 Section 4.2.1.1
+type header struct {
+	TrnID   uint16
+	Flags   uint16
+	QDCount uint16
+	ANCount uint16
+	NSCount uint16
+	ARCount uint16
+}
+
+// A name query or node status request with a single question
+type request struct {
+	header
+	Name  []byte // Encoded by EncodeName
+	Type  uint16
+	Class uint16
+}
+
+func (self *request) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, headerSize, headerSize+len(self.Name)+4)
+	be.PutUint16(buf[0:], self.TrnID)
+	be.PutUint16(buf[2:], self.Flags)
+	be.PutUint16(buf[4:], self.QDCount)
+	be.PutUint16(buf[6:], self.ANCount)
+	be.PutUint16(buf[8:], self.NSCount)
+	be.PutUint16(buf[10:], self.ARCount)
+	buf = append(buf, self.Name...)
+	buf = be.AppendUint16(buf, self.Type)
+	buf = be.AppendUint16(buf, self.Class)
+	return buf, nil
+}
+
+// A response holding a single answer resource record
+type response struct {
+	header
+	Name   string
+	Suffix byte
+	Type   uint16
+	Class  uint16
+	TTL    uint32
+	RData  []byte
+}
+
+func (self *response) UnmarshalBinary(buf []byte) error {
+	if len(buf) < headerSize {
+		return fmt.Errorf("NetBIOS name service response too short")
+	}
+	self.TrnID = be.Uint16(buf[0:])
+	self.Flags = be.Uint16(buf[2:])
+	self.QDCount = be.Uint16(buf[4:])
+	self.ANCount = be.Uint16(buf[6:])
+	self.NSCount = be.Uint16(buf[8:])
+	self.ARCount = be.Uint16(buf[10:])
+	if self.Flags&flagResponse == 0 {
+		return fmt.Errorf("NetBIOS name service packet is not a response")
+	}
+	if self.Flags&rcodeMask != 0 || self.ANCount == 0 {
+		// Negative responses may carry no answer
+		return nil
+	}
+	name, suffix, n, err := DecodeName(buf[headerSize:])
+	if err != nil {
+		return err
+	}
+	self.Name, self.Suffix = name, suffix
+	offset := headerSize + n
+	if len(buf) < offset+10 {
+		return fmt.Errorf("NetBIOS name service response too short")
+	}
+	self.Type = be.Uint16(buf[offset:])
+	self.Class = be.Uint16(buf[offset+2:])
+	self.TTL = be.Uint32(buf[offset+4:])
+	length := int(be.Uint16(buf[offset+8:]))
+	offset += 10
+	if len(buf) < offset+length {
+		return fmt.Errorf("NetBIOS name service response too short")
+	}
+	self.RData = buf[offset : offset+length]
+	return nil
+}
+
+// Err returns the error of a negative response
+func (self *response) Err() error {
+	switch rcode := self.Flags & rcodeMask; rcode {
+	case 0:
+		if self.ANCount == 0 {
+			return ErrNameNotFound
+		}
+		return nil
+	case rcodeNameError:
+		return ErrNameNotFound
+	default:
+		return fmt.Errorf("NetBIOS name service error %d", rcode)
+	}
+}
+
+// parseAddresses parses the NB_FLAGS and NB_ADDRESS entries of the answer of
+// a name query
+func parseAddresses(rdata []byte) (ips []net.IP) {
+	for i := 0; i+6 <= len(rdata); i += 6 {
+		ips = append(ips, net.IPv4(rdata[i+2], rdata[i+3], rdata[i+4], rdata[i+5]))
+	}
+	return
+}
+
+// parseNodeStatus parses the answer of a node status request
+func parseNodeStatus(rdata []byte) (*NodeStatus, error) {
+	if len(rdata) < 1 {
+		return nil, fmt.Errorf("Empty NetBIOS node status")
+	}
+	count := int(rdata[0])
+	if len(rdata) < 1+count*nodeStatusNameSize {
+		return nil, fmt.Errorf("NetBIOS node status too short for %d names", count)
+	}
+	status := &NodeStatus{}
+	for i := range count {
+		e := rdata[1+i*nodeStatusNameSize:]
+		status.Names = append(status.Names, NameEntry{
+			Name:   strings.TrimRight(string(e[:maxNameLength]), " \x00"),
+			Suffix: e[maxNameLength],
+			Flags:  be.Uint16(e[maxNameLength+1:]),
+		})
+	}
+	if stats := rdata[1+count*nodeStatusNameSize:]; len(stats) >= nodeStatusMACSize {
+		status.MAC = net.HardwareAddr(bytes.Clone(stats[:nodeStatusMACSize]))
+	}
+	return status, nil
+}
+
+// nameServiceAddr adds the name service port to a host without a port
+func nameServiceAddr(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, fmt.Sprint(NameServicePort))
+}
+
+// exchange sends a request to addr and calls handle with each response to
+// it until handle returns true or the timeout expires. Broadcast requests
+// are answered by every node owning the name.
+func exchange(addr string, req *request, timeout time.Duration, handle func(res *response, from net.Addr) bool) error {
+	raddr, err := net.ResolveUDPAddr("udp4", nameServiceAddr(addr))
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	id := make([]byte, 2)
+	if _, err = rand.Read(id); err != nil {
+		return err
+	}
+	req.TrnID = be.Uint16(id)
+	req.QDCount = 1
+	pkt, err := req.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if _, err = conn.WriteTo(pkt, raddr); err != nil {
+		return err
+	}
+	if err = conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		var res response
+		if err = res.UnmarshalBinary(buf[:n]); err != nil {
+			log.Debugf("Ignoring invalid response from %s: %s\n", from, err)
+			continue
+		}
+		if res.TrnID != req.TrnID {
+			continue
+		}
+		if handle(&res, from) {
+			return nil
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// QueryName resolves a NetBIOS name with the given suffix by asking the name
+// server at addr, e.g. a WINS server or the node itself, or by broadcasting
+// the query when broadcast is set and addr is a broadcast address. The
+// addresses of all the nodes answering within the timeout are returned for
+// a broadcast query.
+func QueryName(addr, name string, suffix byte, broadcast bool, timeout time.Duration) (ips []net.IP, err error) {
+	if len(name) > maxNameLength {
+		return nil, fmt.Errorf("NetBIOS name %s longer than %d characters", name, maxNameLength)
+	}
+	req := &request{Name: EncodeName(name, suffix), Type: rrTypeNB, Class: rrClassIN}
+	req.Flags = flagRecursion
+	if broadcast {
+		req.Flags |= flagBroadcast
+	}
+	var resErr error
+	err = exchange(addr, req, timeout, func(res *response, from net.Addr) bool {
+		if resErr = res.Err(); resErr != nil {
+			return !broadcast
+		}
+		if res.Type != rrTypeNB {
+			return false
+		}
+		ips = append(ips, parseAddresses(res.RData)...)
+		return !broadcast
+	})
+	if isTimeout(err) {
+		err = nil
+		if len(ips) == 0 {
+			err = ErrNameNotFound
+		}
+	} else if err == nil && len(ips) == 0 {
+		err = resErr
+	}
+	return
+}
+
+// QueryNodeStatus asks the node at addr for the names it registered and its
+// MAC address
+func QueryNodeStatus(addr string, timeout time.Duration) (status *NodeStatus, err error) {
+	req := &request{Name: EncodeName("*", SuffixWorkstation), Type: rrTypeNBSTAT, Class: rrClassIN}
+	var parseErr error
+	err = exchange(addr, req, timeout, func(res *response, from net.Addr) bool {
+		if res.Type != rrTypeNBSTAT {
+			return false
+		}
+		status, parseErr = parseNodeStatus(res.RData)
+		return true
+	})
+	if isTimeout(err) {
+		return nil, fmt.Errorf("No NetBIOS node status response from %s", addr)
+	} else if err != nil {
+		return nil, err
+	}
+	return status, parseErr
+}
@@ -0,0 +1,158 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package netbios
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestEncodeName(t *testing.T) {
+	// Example of RFC 1001 Section 14.1
+	buf := EncodeName("Fred", ' ')
+	if string(buf[1:33]) != "EGFCEFEECACACACACACACACACACACACA" || buf[0] != 32 || buf[33] != 0 {
+		t.Fatalf("Fail: %s", buf)
+	}
+	name, suffix, n, err := DecodeName(EncodeName("server1", SuffixFileServer))
+	if err != nil || name != "SERVER1" || suffix != SuffixFileServer || n != 34 {
+		t.Fatalf("Fail: %q %x %d %v", name, suffix, n, err)
+	}
+	// The wildcard name is padded with zeros
+	if buf = EncodeName("*", 0); string(buf[1:5]) != "CKAA" || string(buf[31:33]) != "AA" {
+		t.Fatalf("Fail: %s", buf)
+	}
+	if _, _, _, err = DecodeName([]byte{32, 'Z'}); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+// nodeStatusAnswer builds the RDATA of a node status response
+func nodeStatusAnswer(names []NameEntry, mac []byte) []byte {
+	rdata := []byte{byte(len(names))}
+	for _, e := range names {
+		name := []byte("               ")
+		copy(name, e.Name)
+		rdata = append(rdata, name...)
+		rdata = append(rdata, e.Suffix)
+		rdata = be.AppendUint16(rdata, e.Flags)
+	}
+	rdata = append(rdata, mac...)
+	return append(rdata, make([]byte, 40)...)
+}
+
+func TestParseNodeStatus(t *testing.T) {
+	names := []NameEntry{
+		{Name: "SERVER1", Suffix: SuffixWorkstation, Flags: NameFlagActive | 0x6000},
+		{Name: "CORP", Suffix: SuffixWorkstation, Flags: NameFlagActive | NameFlagGroup},
+		{Name: "SERVER1", Suffix: SuffixFileServer, Flags: NameFlagActive},
+		{Name: "CORP", Suffix: SuffixDomainControllers, Flags: NameFlagActive | NameFlagGroup},
+	}
+	mac := []byte{0x00, 0x15, 0x5d, 0x01, 0x02, 0x03}
+	status, err := parseNodeStatus(nodeStatusAnswer(names, mac))
+	if err != nil || len(status.Names) != 4 || !bytes.Equal(status.MAC, mac) {
+		t.Fatalf("Fail: %+v %v", status, err)
+	}
+	if status.ServerName() != "SERVER1" || status.Domain() != "CORP" {
+		t.Fatalf("Fail: %+v", status)
+	}
+	if status.Names[0].OwnerType() != "H-node" || status.Names[0].Type() != "Workstation Service" || status.Names[3].Type() != "Domain Controllers" {
+		t.Fatalf("Fail: %+v", status.Names)
+	}
+	if _, err = parseNodeStatus([]byte{2, 'A'}); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+// serveNameService answers a single request on a local UDP socket with the
+// answer built by reply and returns the address of the socket
+func serveNameService(t *testing.T, reply func(req []byte) []byte) string {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		conn.WriteTo(reply(buf[:n]), from)
+	}()
+	return conn.LocalAddr().String()
+}
+
+// answer builds a response to req with a single resource record
+func answer(req []byte, rcode uint16, rrType uint16, rdata []byte) []byte {
+	res := bytes.Clone(req[:headerSize])
+	be.PutUint16(res[2:], flagResponse|rcode)
+	be.PutUint16(res[4:], 0)
+	if rcode != 0 {
+		return res
+	}
+	be.PutUint16(res[6:], 1)
+	res = append(res, req[headerSize:headerSize+34]...)
+	res = be.AppendUint16(res, rrType)
+	res = be.AppendUint16(res, rrClassIN)
+	res = be.AppendUint32(res, 300000)
+	res = be.AppendUint16(res, uint16(len(rdata)))
+	return append(res, rdata...)
+}
+
+func TestQueryName(t *testing.T) {
+	addr := serveNameService(t, func(req []byte) []byte {
+		name, suffix, _, err := DecodeName(req[headerSize:])
+		if err != nil || name != "DC01" || suffix != SuffixFileServer || be.Uint16(req[headerSize+34:]) != rrTypeNB {
+			return answer(req, rcodeNameError, 0, nil)
+		}
+		return answer(req, 0, rrTypeNB, []byte{0x60, 0x00, 10, 0, 0, 5})
+	})
+	ips, err := QueryName(addr, "dc01", SuffixFileServer, false, time.Second)
+	if err != nil || len(ips) != 1 || !ips[0].Equal(net.IPv4(10, 0, 0, 5)) {
+		t.Fatalf("Fail: %v %v", ips, err)
+	}
+
+	addr = serveNameService(t, func(req []byte) []byte {
+		return answer(req, rcodeNameError, 0, nil)
+	})
+	if _, err = QueryName(addr, "missing", SuffixFileServer, false, time.Second); err != ErrNameNotFound {
+		t.Fatalf("Fail: %v", err)
+	}
+}
+
+func TestQueryNodeStatus(t *testing.T) {
+	names := []NameEntry{{Name: "FS01", Suffix: SuffixFileServer, Flags: NameFlagActive}}
+	mac := []byte{1, 2, 3, 4, 5, 6}
+	addr := serveNameService(t, func(req []byte) []byte {
+		name, _, _, err := DecodeName(req[headerSize:])
+		if err != nil || name != "*" || be.Uint16(req[headerSize+34:]) != rrTypeNBSTAT {
+			return answer(req, rcodeNameError, 0, nil)
+		}
+		return answer(req, 0, rrTypeNBSTAT, nodeStatusAnswer(names, mac))
+	})
+	status, err := QueryNodeStatus(addr, time.Second)
+	if err != nil || status.ServerName() != "FS01" || !bytes.Equal(status.MAC, mac) {
+		t.Fatalf("Fail: %+v %v", status, err)
+	}
+}
@@ -0,0 +1,110 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package netbios
+
+import (
+	"fmt"
+	"io"
+	"net"
+)
+
+// Session service packet types of RFC 1002 Section 4.3.1
+const (
+	SessionMessage          byte = 0x00
+	SessionRequest          byte = 0x81
+	SessionPositiveResponse byte = 0x82
+	SessionNegativeResponse byte = 0x83
+	SessionRetargetResponse byte = 0x84
+	SessionKeepAlive        byte = 0x85
+)
+
+// DefaultCalledName is accepted as called name by Windows and Samba servers
+// in place of their own name
+const DefaultCalledName = "*SMBSERVER"
+
+// Error codes of a negative session response
+var SessionErrorMap = map[byte]error{
+	0x80: fmt.Errorf("Not listening on called name"),
+	0x81: fmt.Errorf("Not listening for calling name"),
+	0x82: fmt.Errorf("Called name not present"),
+	0x83: fmt.Errorf("Called name present, but insufficient resources"),
+	0x8f: fmt.Errorf("Unspecified error"),
+}
+
+// RetargetError is returned when the server redirects the session to another
+// address
+type RetargetError struct {
+	IP   net.IP
+	Port uint16
+}
+
+func (self *RetargetError) Error() string {
+	return fmt.Sprintf("NetBIOS session retargeted to %s", net.JoinHostPort(self.IP.String(), fmt.Sprint(self.Port)))
+}
+
+// RequestSession sends a session request for the called name of the server
+// and the calling name of the client over a new connection to the session
+// service, and waits for the positive response after which SMB messages can
+// be exchanged.
+func RequestSession(conn io.ReadWriter, calledName, callingName string) error {
+	if len(calledName) > maxNameLength || len(callingName) > maxNameLength {
+		return fmt.Errorf("NetBIOS names are limited to %d characters", maxNameLength)
+	}
+	called := EncodeName(calledName, SuffixFileServer)
+	calling := EncodeName(callingName, SuffixWorkstation)
+	pkt := []byte{SessionRequest, 0}
+	pkt = be.AppendUint16(pkt, uint16(len(called)+len(calling)))
+	pkt = append(pkt, called...)
+	pkt = append(pkt, calling...)
+	if _, err := conn.Write(pkt); err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	body := make([]byte, be.Uint16(head[2:]))
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return err
+	}
+	switch head[0] {
+	case SessionPositiveResponse:
+		return nil
+	case SessionNegativeResponse:
+		if len(body) < 1 {
+			return fmt.Errorf("NetBIOS session request rejected")
+		}
+		if err, ok := SessionErrorMap[body[0]]; ok {
+			return fmt.Errorf("NetBIOS session request rejected: %s", err)
+		}
+		return fmt.Errorf("NetBIOS session request rejected with error 0x%x", body[0])
+	case SessionRetargetResponse:
+		if len(body) < 6 {
+			return fmt.Errorf("Invalid NetBIOS session retarget response")
+		}
+		return &RetargetError{IP: net.IPv4(body[0], body[1], body[2], body[3]), Port: be.Uint16(body[4:])}
+	default:
+		return fmt.Errorf("Unexpected NetBIOS session response type 0x%x", head[0])
+	}
+}
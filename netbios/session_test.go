@@ -0,0 +1,67 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package netbios
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+// serveSession reads a session request on the server end of a pipe, checks
+// the called name and writes the response
+func serveSession(t *testing.T, res []byte) net.Conn {
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	go func() {
+		defer server.Close()
+		req := make([]byte, 4+68)
+		if _, err := io.ReadFull(server, req); err != nil {
+			return
+		}
+		name, suffix, _, err := DecodeName(req[4:])
+		if req[0] != SessionRequest || err != nil || name != "FS01" || suffix != SuffixFileServer {
+			res = []byte{SessionNegativeResponse, 0, 0, 1, 0x82}
+		}
+		server.Write(res)
+	}()
+	return client
+}
+
+func TestRequestSession(t *testing.T) {
+	conn := serveSession(t, []byte{SessionPositiveResponse, 0, 0, 0})
+	if err := RequestSession(conn, "fs01", "CLIENT"); err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+
+	conn = serveSession(t, []byte{SessionPositiveResponse, 0, 0, 0})
+	if err := RequestSession(conn, DefaultCalledName, "CLIENT"); err == nil || !bytes.Contains([]byte(err.Error()), []byte("Called name not present")) {
+		t.Fatalf("Fail: %v", err)
+	}
+
+	conn = serveSession(t, []byte{SessionRetargetResponse, 0, 0, 6, 10, 0, 0, 7, 0, 139})
+	err := RequestSession(conn, "FS01", "CLIENT")
+	if retarget, ok := err.(*RetargetError); !ok || !retarget.IP.Equal(net.IPv4(10, 0, 0, 7)) || retarget.Port != 139 {
+		t.Fatalf("Fail: %v", err)
+	}
+}
@@ -65,6 +65,7 @@ type Client struct {
 	session        *Session
 	neg            *Negotiate
 	TargetSPN      string
+	RequestSeal    bool             // Negotiate message confidentiality, e.g., for DCERPC packet privacy
 	channelBinding *channelBindings // Reserved for future use
 
 }
@@ -96,6 +97,10 @@ func (c *Client) Negotiate() ([]byte, error) {
 		req.NegotiateFlags |= FlgNegOEMWorkstationSupplied
 	}
 
+	if c.RequestSeal {
+		req.NegotiateFlags |= FlgNegSeal | FlgNegAlwaysSign
+	}
+
 	req.NegotiateFlags |= FlgNegKeyExch
 	req.Version = le.Uint64(version)
 	c.neg = &req
@@ -506,32 +506,32 @@ func (self *Authenticate) UnmarshalBinary(buf []byte, meta *encoder.Metadata) er
 		self.EncryptedRandomSessionKeyLen)
 
 	// Sanity check that none of the offsets + lengths points outside buffer
-	if (self.LmChallengeResponseBufferOffset + uint32(self.LmChallengeResponseLen)) > uint32(bufLen) {
+	if uint64(self.LmChallengeResponseBufferOffset)+uint64(self.LmChallengeResponseLen) > uint64(bufLen) {
 		err := fmt.Errorf("Custom length field offset is outside buffer")
 		log.Errorln(err)
 		return err
 	}
-	if (self.NtChallengResponseBufferOffset + uint32(self.NtChallengeResponseLen)) > uint32(bufLen) {
+	if uint64(self.NtChallengResponseBufferOffset)+uint64(self.NtChallengeResponseLen) > uint64(bufLen) {
 		err := fmt.Errorf("Custom length field offset is outside buffer")
 		log.Errorln(err)
 		return err
 	}
-	if (self.DomainNameBufferOffset + uint32(self.DomainNameLen)) > uint32(bufLen) {
+	if uint64(self.DomainNameBufferOffset)+uint64(self.DomainNameLen) > uint64(bufLen) {
 		err := fmt.Errorf("Custom length field offset is outside buffer")
 		log.Errorln(err)
 		return err
 	}
-	if (self.UserNameBufferOffset + uint32(self.UserNameLen)) > uint32(bufLen) {
+	if uint64(self.UserNameBufferOffset)+uint64(self.UserNameLen) > uint64(bufLen) {
 		err := fmt.Errorf("Custom length field offset is outside buffer")
 		log.Errorln(err)
 		return err
 	}
-	if (self.WorkstationBufferOffset + uint32(self.WorkstationLen)) > uint32(bufLen) {
+	if uint64(self.WorkstationBufferOffset)+uint64(self.WorkstationLen) > uint64(bufLen) {
 		err := fmt.Errorf("Custom length field offset is outside buffer")
 		log.Errorln(err)
 		return err
 	}
-	if (self.EncryptedRandomSessionKeyBufferOffset + uint32(self.EncryptedRandomSessionKeyLen)) > uint32(bufLen) {
+	if uint64(self.EncryptedRandomSessionKeyBufferOffset)+uint64(self.EncryptedRandomSessionKeyLen) > uint64(bufLen) {
 		err := fmt.Errorf("Custom length field offset is outside buffer")
 		log.Errorln(err)
 		return err
@@ -688,6 +688,9 @@ func (s *AvPairSlice) UnmarshalBinary(buf []byte, meta *encoder.Metadata) error
 	if !ok {
 		return errors.New(fmt.Sprintf("Cannot unmarshal field '%s'. Missing offset\n", meta.CurrField))
 	}
+	if o > uint64(len(meta.ParentBuf)) || l > uint64(len(meta.ParentBuf))-o {
+		return fmt.Errorf("AvPair list out of bounds")
+	}
 	for i := l; i > 0; {
 		var avPair AvPair
 		err := encoder.Unmarshal(meta.ParentBuf[o:o+i], &avPair)
@@ -696,9 +699,35 @@ func (s *AvPairSlice) UnmarshalBinary(buf []byte, meta *encoder.Metadata) error
 		}
 		slice = append(slice, avPair)
 		size := avPair.Size()
+		if size > i {
+			return fmt.Errorf("AvPair out of bounds")
+		}
 		o += size
 		i -= size
 	}
 	*s = slice
 	return nil
 }
+
+// DecodeMessage decodes an NTLM message into a *Negotiate, *Challenge or
+// *Authenticate according to its MessageType. It is meant for tools and
+// fuzzing and must not panic on any input.
+func DecodeMessage(buf []byte) (msg any, err error) {
+	if len(buf) < 12 || string(buf[:8]) != Signature {
+		return nil, fmt.Errorf("Not an NTLM message")
+	}
+	switch le.Uint32(buf[8:12]) {
+	case TypeNtLmNegotiate:
+		msg = &Negotiate{}
+	case TypeNtLmChallenge:
+		msg = &Challenge{TargetInfo: new(AvPairSlice)}
+	case TypeNtLmAuthenticate:
+		msg = &Authenticate{}
+	default:
+		return nil, fmt.Errorf("Unknown NTLM message type %d", le.Uint32(buf[8:12]))
+	}
+	if err = encoder.Unmarshal(buf, msg); err != nil {
+		return nil, err
+	}
+	return
+}
@@ -1 +1,63 @@
 package ntlmssp
+
+import (
+	"testing"
+)
+
+func TestDecodeMessage(t *testing.T) {
+	s := newTestServer()
+	c := &Client{User: "alice", Password: "Passw0rd!"}
+	nmsg, err := c.Negotiate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmsg, err := s.Challenge(nmsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	amsg, err := c.Authenticate(cmsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := DecodeMessage(nmsg); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	} else if _, ok := msg.(*Negotiate); !ok {
+		t.Fatalf("Fail: %T", msg)
+	}
+	if msg, err := DecodeMessage(cmsg); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	} else if _, ok := msg.(*Challenge); !ok {
+		t.Fatalf("Fail: %T", msg)
+	}
+	if msg, err := DecodeMessage(amsg); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	} else if a, ok := msg.(*Authenticate); !ok || len(a.NtChallengeResponse) == 0 {
+		t.Fatalf("Fail: %T", msg)
+	}
+	if _, err := DecodeMessage([]byte("NTLMSSP")); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func FuzzDecodeMessage(f *testing.F) {
+	s := newTestServer()
+	c := &Client{User: "alice", Password: "Passw0rd!"}
+	nmsg, err := c.Negotiate()
+	if err != nil {
+		f.Fatal(err)
+	}
+	cmsg, err := s.Challenge(nmsg)
+	if err != nil {
+		f.Fatal(err)
+	}
+	amsg, err := c.Authenticate(cmsg)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(nmsg)
+	f.Add(cmsg)
+	f.Add(amsg)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		DecodeMessage(data)
+	})
+}
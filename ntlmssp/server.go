@@ -0,0 +1,248 @@
+// Copyright (c) 2016 Hiroshi Ioka. All rights reserved.
+// Copyright (c) 2023 Jimmy Fjällid for derivative changes
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//   - Redistributions of source code must retain the above copyright
+//
+// notice, this list of conditions and the following disclaimer.
+//   - Redistributions in binary form must reproduce the above
+//
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+package ntlmssp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+var (
+	ErrLogonFailure = errors.New("Logon failure")
+	ErrUnknownUser  = errors.New("Unknown user")
+)
+
+// Server implements the acceptor side of NTLM authentication. Only NTLMv2
+// responses are accepted.
+type Server struct {
+	ComputerName  string // NetBIOS name of the server
+	Domain        string // NetBIOS domain name, also sent as the TargetName
+	DnsDomainName string
+	// Lookup returns the NT hash of user or false if the account is unknown
+	Lookup func(user string) (hash []byte, ok bool)
+	// Capture is called by Authenticate with the response of every logon
+	// naming a user, before the response is verified
+	Capture func(r *ChallengeResponse)
+
+	neg             *Negotiate
+	serverChallenge []byte
+	session         *Session
+}
+
+// Challenge parses the NEGOTIATE message nmsg and returns the CHALLENGE
+// message to send to the client
+func (s *Server) Challenge(nmsg []byte) (cmsg []byte, err error) {
+	neg := Negotiate{}
+	if err = encoder.Unmarshal(nmsg, &neg); err != nil {
+		log.Debugln(err)
+		return
+	}
+	if !bytes.Equal(neg.Signature, []byte(Signature)) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	if neg.MessageType != TypeNtLmNegotiate {
+		return nil, fmt.Errorf("invalid message type")
+	}
+	s.neg = &neg
+	s.session = nil
+
+	s.serverChallenge = make([]byte, 8)
+	if _, err = rand.Read(s.serverChallenge); err != nil {
+		return
+	}
+
+	chall := NewChallenge()
+	chall.NegotiateFlags |= neg.NegotiateFlags & (FlgNegSign | FlgNegSeal | FlgNegAlwaysSign | FlgNegKeyExch)
+	chall.ServerChallenge = le.Uint64(s.serverChallenge)
+	chall.Version = le.Uint64(version)
+	chall.TargetName = encoder.ToUnicode(s.Domain)
+
+	timestamp := make([]byte, 8)
+	le.PutUint64(timestamp, ConvertToFileTime(time.Now()))
+	dnsComputerName := strings.ToLower(s.ComputerName)
+	if s.DnsDomainName != "" {
+		dnsComputerName += "." + s.DnsDomainName
+	}
+	chall.TargetInfo = &AvPairSlice{
+		{AvID: MsvAvNbDomainName, Value: encoder.ToUnicode(s.Domain)},
+		{AvID: MsvAvNbComputerName, Value: encoder.ToUnicode(s.ComputerName)},
+		{AvID: MsvAvDnsDomainName, Value: encoder.ToUnicode(s.DnsDomainName)},
+		{AvID: MsvAvDnsComputerName, Value: encoder.ToUnicode(dnsComputerName)},
+		{AvID: MsvAvTimestamp, Value: timestamp},
+		{AvID: MsvAvEOL},
+	}
+	return encoder.Marshal(&chall)
+}
+
+// Authenticate verifies the AUTHENTICATE message amsg against the challenge
+// returned by Challenge. A message without user name and responses is an
+// anonymous logon and succeeds with a session for which IsAnonymous is set.
+// ErrUnknownUser is returned when Lookup does not know the user, which
+// allows the caller to fall back to a guest logon.
+func (s *Server) Authenticate(amsg []byte) (err error) {
+	if s.serverChallenge == nil {
+		return fmt.Errorf("Authenticate called before Challenge")
+	}
+	auth := Authenticate{}
+	if err = encoder.Unmarshal(amsg, &auth); err != nil {
+		log.Debugln(err)
+		return
+	}
+	if !bytes.Equal(auth.Signature, []byte(Signature)) {
+		return fmt.Errorf("invalid signature")
+	}
+	if auth.MessageType != TypeNtLmAuthenticate {
+		return fmt.Errorf("invalid message type")
+	}
+
+	user, err := encoder.FromUnicodeString(auth.UserName)
+	if err != nil {
+		return
+	}
+	domain, err := encoder.FromUnicodeString(auth.DomainName)
+	if err != nil {
+		return
+	}
+
+	session := new(Session)
+	session.user = user
+	session.negotiateFlags = auth.NegotiateFlags
+
+	if user == "" && len(auth.NtChallengeResponse) == 0 {
+		session.anonymous = true
+		s.session = session
+		return nil
+	}
+	if s.Capture != nil && user != "" {
+		workstation, _ := encoder.FromUnicodeString(auth.Workstation)
+		s.Capture(&ChallengeResponse{
+			User:            user,
+			Domain:          domain,
+			Workstation:     workstation,
+			ServerChallenge: bytes.Clone(s.serverChallenge),
+			LmResponse:      bytes.Clone(auth.LmChallengeResponse),
+			NtResponse:      bytes.Clone(auth.NtChallengeResponse),
+		})
+	}
+
+	// MS-NLMP Section 2.2.2.8 NTProofStr followed by a NTLMv2_CLIENT_CHALLENGE
+	// of at least 28 bytes. Shorter responses are NTLMv1 which is refused.
+	response := auth.NtChallengeResponse
+	if len(response) < 16+28 {
+		return ErrLogonFailure
+	}
+	hash, ok := s.Lookup(user)
+	if !ok {
+		return ErrUnknownUser
+	}
+
+	var ntowf []byte
+	for _, d := range []string{domain, ""} {
+		key := Ntowfv2Hash(user, d, hash)
+		h := hmac.New(md5.New, key)
+		h.Write(s.serverChallenge)
+		h.Write(response[16:])
+		if hmac.Equal(h.Sum(nil), response[:16]) {
+			ntowf = key
+			break
+		}
+	}
+	if ntowf == nil {
+		return ErrLogonFailure
+	}
+
+	h := hmac.New(md5.New, ntowf)
+	h.Write(response[:16])
+	sessionBaseKey := h.Sum(nil)
+
+	if auth.NegotiateFlags&FlgNegKeyExch != 0 && len(auth.EncryptedRandomSessionKey) == 16 {
+		cipher, err := rc4.NewCipher(sessionBaseKey)
+		if err != nil {
+			return err
+		}
+		session.exportedSessionKey = make([]byte, 16)
+		cipher.XORKeyStream(session.exportedSessionKey, auth.EncryptedRandomSessionKey)
+	} else {
+		session.exportedSessionKey = sessionBaseKey
+	}
+
+	flags := auth.NegotiateFlags
+	session.clientSigningKey = signKey(flags, session.exportedSessionKey, true)
+	session.serverSigningKey = signKey(flags, session.exportedSessionKey, false)
+
+	session.clientHandle, err = rc4.NewCipher(sealKey(flags, session.exportedSessionKey, true))
+	if err != nil {
+		return
+	}
+	session.serverHandle, err = rc4.NewCipher(sealKey(flags, session.exportedSessionKey, false))
+	if err != nil {
+		return
+	}
+
+	s.session = session
+	return nil
+}
+
+// Session returns the session established by Authenticate
+func (s *Server) Session() *Session {
+	return s.session
+}
+
+// ChallengeResponse is the response of a client to the challenge of a
+// Server, which can be cracked offline to recover the password
+type ChallengeResponse struct {
+	User            string
+	Domain          string
+	Workstation     string
+	ServerChallenge []byte
+	LmResponse      []byte
+	NtResponse      []byte
+}
+
+// IsV2 reports whether NtResponse is a NTLMv2 response. NTLMv1 responses
+// are 24 bytes.
+func (r *ChallengeResponse) IsV2() bool {
+	return len(r.NtResponse) > 24
+}
+
+// Hashcat formats the response as a NetNTLMv2 hash for hashcat mode 5600,
+// or as a NetNTLMv1 hash for mode 5500
+func (r *ChallengeResponse) Hashcat() string {
+	if r.IsV2() {
+		return fmt.Sprintf("%s::%s:%x:%x:%x", r.User, r.Domain, r.ServerChallenge, r.NtResponse[:16], r.NtResponse[16:])
+	}
+	return fmt.Sprintf("%s::%s:%x:%x:%x", r.User, r.Domain, r.LmResponse, r.NtResponse, r.ServerChallenge)
+}
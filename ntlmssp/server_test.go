@@ -0,0 +1,139 @@
+package ntlmssp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func newTestServer() *Server {
+	return &Server{
+		ComputerName: "FS01",
+		Domain:       "CORP",
+		Lookup: func(user string) ([]byte, bool) {
+			if user != "alice" {
+				return nil, false
+			}
+			return Ntowfv1("Passw0rd!"), true
+		},
+	}
+}
+
+func authenticate(t *testing.T, s *Server, c *Client) error {
+	nmsg, err := c.Negotiate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmsg, err := s.Challenge(nmsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	amsg, err := c.Authenticate(cmsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.Authenticate(amsg)
+}
+
+func TestServerAuthenticate(t *testing.T) {
+	s := newTestServer()
+	c := &Client{User: "alice", Password: "Passw0rd!"}
+	if err := authenticate(t, s, c); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if s.Session().User() != "alice" || s.Session().IsAnonymous() {
+		t.Fatalf("Fail: %+v", s.Session())
+	}
+	if !bytes.Equal(s.Session().SessionKey(), c.Session().SessionKey()) {
+		t.Fatal("Fail")
+	}
+
+	// The acceptor's signatures must verify on the client side
+	sum, _ := s.Session().Sum([]byte("message"), 0)
+	if ok, _ := c.Session().CheckSum(sum, []byte("message"), 0); !ok {
+		t.Fatal("Fail")
+	}
+}
+
+func TestServerAuthenticateHash(t *testing.T) {
+	s := newTestServer()
+	c := &Client{User: "alice", Hash: Ntowfv1("Passw0rd!"), Domain: "other"}
+	if err := authenticate(t, s, c); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+}
+
+func TestServerAuthenticateFailure(t *testing.T) {
+	s := newTestServer()
+	if err := authenticate(t, s, &Client{User: "alice", Password: "wrong"}); err != ErrLogonFailure {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if err := authenticate(t, s, &Client{User: "bob", Password: "Passw0rd!"}); err != ErrUnknownUser {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if err := s.Authenticate([]byte("NTLMSSP\x00")); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestServerAuthenticateAnonymous(t *testing.T) {
+	s := newTestServer()
+	if err := authenticate(t, s, &Client{NullSession: true}); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if !s.Session().IsAnonymous() {
+		t.Fatal("Fail")
+	}
+}
+
+func TestServerCapture(t *testing.T) {
+	s := newTestServer()
+	var captured *ChallengeResponse
+	s.Capture = func(r *ChallengeResponse) {
+		captured = r
+	}
+	c := &Client{User: "bob", Password: "Summer2024", Domain: "CORP", Workstation: "WS01"}
+	if err := authenticate(t, s, c); err != ErrUnknownUser {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if captured == nil || !captured.IsV2() || captured.User != "bob" || captured.Domain != "CORP" || captured.Workstation != "WS01" {
+		t.Fatalf("Fail: %+v", captured)
+	}
+
+	// The captured response must verify against the password of the client
+	fields := strings.Split(captured.Hashcat(), ":")
+	if len(fields) != 6 || fields[0] != "bob" || fields[1] != "" || fields[2] != "CORP" {
+		t.Fatalf("Fail: %s", captured.Hashcat())
+	}
+	challenge, _ := hex.DecodeString(fields[3])
+	proof, _ := hex.DecodeString(fields[4])
+	blob, _ := hex.DecodeString(fields[5])
+	h := hmac.New(md5.New, Ntowfv2("Summer2024", "bob", "CORP"))
+	h.Write(challenge)
+	h.Write(blob)
+	if !bytes.Equal(h.Sum(nil), proof) {
+		t.Fatal("Fail")
+	}
+
+	captured = nil
+	if err := authenticate(t, s, &Client{NullSession: true}); err != nil || captured != nil {
+		t.Fatalf("Fail: %+v %+v", err, captured)
+	}
+}
+
+func TestChallengeResponseHashcatV1(t *testing.T) {
+	r := ChallengeResponse{
+		User:            "u",
+		Domain:          "D",
+		ServerChallenge: []byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88},
+		LmResponse:      bytes.Repeat([]byte{0xaa}, 24),
+		NtResponse:      bytes.Repeat([]byte{0xbb}, 24),
+	}
+	want := "u::D:" + strings.Repeat("aa", 24) + ":" + strings.Repeat("bb", 24) + ":1122334455667788"
+	if r.IsV2() || r.Hashcat() != want {
+		t.Fatalf("Fail: %s", r.Hashcat())
+	}
+}
@@ -34,6 +34,7 @@ import (
 
 type Session struct {
 	isClientSide       bool
+	anonymous          bool
 	user               string
 	negotiateFlags     uint32
 	exportedSessionKey []byte
@@ -54,6 +55,12 @@ func (s *Session) SessionKey() []byte {
 	return s.exportedSessionKey
 }
 
+// IsAnonymous reports whether the session was established by an anonymous
+// logon without a session key
+func (s *Session) IsAnonymous() bool {
+	return s.anonymous
+}
+
 type InfoMap struct {
 	NbComputerName  string
 	NbDomainName    string
@@ -167,3 +174,31 @@ func (s *Session) Unseal(dst, ciphertext []byte, seqNum uint32) ([]byte, uint32,
 
 	return ret, seqNum, nil
 }
+
+// Encrypt applies the outbound sealing key stream to plaintext without
+// producing a signature. It is intended for protocols such as DCERPC where
+// the encrypted part of a message differs from the part covered by the
+// signature. The signature should be calculated with Sum afterwards, as the
+// RC4 handle is shared between encryption and signing.
+func (s *Session) Encrypt(dst, plaintext []byte) []byte {
+	ret, ciphertext := sliceForAppend(dst, len(plaintext))
+	if s.isClientSide {
+		s.clientHandle.XORKeyStream(ciphertext, plaintext)
+	} else {
+		s.serverHandle.XORKeyStream(ciphertext, plaintext)
+	}
+	return ret
+}
+
+// Decrypt applies the inbound sealing key stream to ciphertext without
+// verifying a signature. The signature should be verified with CheckSum
+// afterwards.
+func (s *Session) Decrypt(dst, ciphertext []byte) []byte {
+	ret, plaintext := sliceForAppend(dst, len(ciphertext))
+	if s.isClientSide {
+		s.serverHandle.XORKeyStream(plaintext, ciphertext)
+	} else {
+		s.clientHandle.XORKeyStream(plaintext, ciphertext)
+	}
+	return ret
+}
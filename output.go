@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Encoder for the records printed with the global -json flag
+var jsonEncoder = json.NewEncoder(os.Stdout)
+
+// emit prints a record as a single line of JSON
+func emit(record any) error {
+	return jsonEncoder.Encode(record)
+}
+
+// Record of a completed operation that has no other output
+type opRecord struct {
+	Op     string `json:"op"`
+	Target string `json:"target"`
+	Status string `json:"status"`
+}
+
+// emitDone reports the success of an operation in JSON mode
+func emitDone(op, target string) error {
+	if !*jsonOutput {
+		return nil
+	}
+	return emit(opRecord{Op: op, Target: target, Status: "ok"})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc/msrrp"
+)
+
+func TestJSONOutput(t *testing.T) {
+	var buf bytes.Buffer
+	stdout := jsonEncoder
+	jsonEncoder = json.NewEncoder(&buf)
+	*jsonOutput = true
+	defer func() { jsonEncoder, *jsonOutput = stdout, false }()
+
+	emitDone("rm", "//host/share/file.txt")
+	printRegValue(`HKLM\SOFTWARE`, "Blob", msrrp.RegBinary, []byte{0xde, 0xad})
+	tgt := target{host: "host", share: "share"}
+	emit(newFileRecord(tgt, &smb.SharedFile{Name: "b.txt", FullPath: `a\b.txt`, Size: 3}))
+
+	expected := []string{
+		`{"op":"rm","target":"//host/share/file.txt","status":"ok"}`,
+		`{"key":"HKLM\\SOFTWARE","name":"Blob","type":"REG_BINARY","data":"DEAD"}`,
+	}
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("Fail: %s", buf.String())
+	}
+	for i, line := range expected {
+		if string(lines[i]) != line {
+			t.Fatalf("Fail: %s", lines[i])
+		}
+	}
+	var record fileRecord
+	if err := json.Unmarshal(lines[2], &record); err != nil || record.Path != "//host/share/a/b.txt" || record.Size != 3 {
+		t.Fatalf("Fail: %s", lines[2])
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+// Record of a named pipe printed in JSON mode
+type pipeRecord struct {
+	Name   string `json:"name"`
+	Listed bool   `json:"listed"` // Returned by the directory query on IPC$
+	Probed bool   `json:"probed"` // Found by opening it
+}
+
+// mergePipes combines the listed and probed pipes sorted by name. Pipe names
+// are case insensitive.
+func mergePipes(listed, probed []string) []pipeRecord {
+	records := make(map[string]*pipeRecord)
+	get := func(name string) *pipeRecord {
+		key := strings.ToLower(name)
+		if records[key] == nil {
+			records[key] = &pipeRecord{Name: name}
+		}
+		return records[key]
+	}
+	for _, name := range listed {
+		get(name).Listed = true
+	}
+	for _, name := range probed {
+		get(name).Probed = true
+	}
+	res := make([]pipeRecord, 0, len(records))
+	for _, record := range records {
+		res = append(res, *record)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return strings.ToLower(res[i].Name) < strings.ToLower(res[j].Name)
+	})
+	return res
+}
+
+func runPipes(args []string) error {
+	fs := flag.NewFlagSet("pipes", flag.ExitOnError)
+	probe := fs.Bool("probe", true, "Probe the known pipes besides listing IPC$")
+	wordlist := fs.String("wordlist", "", "File with additional pipe names to probe, one per line")
+	open := fs.String("open", "", "Open the pipe and relay stdin to it and its output to stdout")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Usage: pipes [-probe=false] [-wordlist file] [-open pipe] <host>")
+	}
+
+	conn, err := connect(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if *open != "" {
+		p, err := conn.OpenPipe(*open)
+		if err != nil {
+			return fmt.Errorf("Failed to open pipe %s: %s", *open, err)
+		}
+		defer p.Close()
+		return relayPipe(p, os.Stdin, os.Stdout)
+	}
+
+	listed, err := conn.ListPipes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list IPC$: %s\n", err)
+	}
+	var probed []string
+	if *probe || *wordlist != "" {
+		var names []string
+		if *probe {
+			names = append(names, smb.KnownPipes...)
+		}
+		if *wordlist != "" {
+			extra, err := readLines(*wordlist)
+			if err != nil {
+				return err
+			}
+			names = append(names, extra...)
+		}
+		if probed, err = conn.ProbePipes(names); err != nil {
+			return err
+		}
+	}
+
+	for _, record := range mergePipes(listed, probed) {
+		if *jsonOutput {
+			emit(record)
+			continue
+		}
+		source := "listed"
+		switch {
+		case record.Listed && record.Probed:
+			source = "listed, probed"
+		case record.Probed:
+			source = "probed"
+		}
+		fmt.Printf("  %-40s %s\n", record.Name, source)
+	}
+	return nil
+}
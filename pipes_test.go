@@ -0,0 +1,19 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergePipes(t *testing.T) {
+	got := mergePipes([]string{"srvsvc", "Winreg", "custom"}, []string{"winreg", "lsarpc"})
+	want := []pipeRecord{
+		{Name: "custom", Listed: true},
+		{Name: "lsarpc", Probed: true},
+		{Name: "srvsvc", Listed: true},
+		{Name: "Winreg", Listed: true, Probed: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Fail: %+v", got)
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/ericblavier/go-smb/smb/dcerpc/msrrp"
+)
+
+// Registry value types by the names used by reg.exe
+var regTypeNames = map[string]uint32{
+	"REG_SZ":               msrrp.RegSz,
+	"REG_EXPAND_SZ":        msrrp.RegExpandSz,
+	"REG_MULTI_SZ":         msrrp.RegMultiSz,
+	"REG_DWORD":            msrrp.RegDword,
+	"REG_DWORD_BIG_ENDIAN": msrrp.RegDwordBigEndian,
+	"REG_QWORD":            msrrp.RegQword,
+	"REG_BINARY":           msrrp.RegBinary,
+}
+
+// Switches of each reg operation and whether they take an argument
+var regSwitches = map[string]map[string]bool{
+	"query":  {"v": true, "ve": false, "s": false},
+	"add":    {"v": true, "ve": false, "t": true, "s": true, "d": true, "f": false},
+	"delete": {"v": true, "ve": false, "va": false, "f": false},
+	"save":   {"y": false},
+}
+
+// regArgs holds the positional arguments and switches of a reg operation
+type regArgs struct {
+	args     []string
+	switches map[string]string
+}
+
+func (a regArgs) has(name string) bool {
+	_, ok := a.switches[name]
+	return ok
+}
+
+// parseRegArgs parses reg.exe style arguments where switches start with a
+// slash, e.g. /v Name /f
+func parseRegArgs(op string, args []string) (res regArgs, err error) {
+	known, ok := regSwitches[op]
+	if !ok {
+		return res, fmt.Errorf("Unknown reg operation %s", op)
+	}
+	res.switches = make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "/") || strings.HasPrefix(args[i], "//") {
+			res.args = append(res.args, args[i])
+			continue
+		}
+		name := strings.ToLower(args[i][1:])
+		takesArg, ok := known[name]
+		if !ok {
+			return res, fmt.Errorf("Invalid switch %s for reg %s", args[i], op)
+		}
+		if _, dup := res.switches[name]; dup {
+			return res, fmt.Errorf("Switch %s given more than once", args[i])
+		}
+		if takesArg {
+			if i+1 >= len(args) {
+				return res, fmt.Errorf("Switch %s requires an argument", args[i])
+			}
+			i++
+			res.switches[name] = args[i]
+		} else {
+			res.switches[name] = ""
+		}
+	}
+	if res.has("v") && (res.has("ve") || res.has("va")) || res.has("ve") && res.has("va") {
+		return res, fmt.Errorf("Only one of /v, /ve and /va may be given")
+	}
+	return
+}
+
+// parseRegKey parses a \\host\HKLM\path key into the host and registry path
+func parseRegKey(s string) (host, key string, err error) {
+	t, err := parseTarget(s)
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid key %s. Expecting \\\\host\\ROOT\\path", s)
+	}
+	key = t.share
+	if t.path != "" {
+		key += `\` + t.path
+	}
+	if _, _, err = msrrp.ParseKeyPath(key); err != nil {
+		return "", "", err
+	}
+	return t.host, key, nil
+}
+
+// confirm asks a yes/no question on stdin. The question goes to stderr in
+// JSON mode to keep stdout parseable.
+func confirm(question string) bool {
+	out := os.Stdout
+	if *jsonOutput {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "%s (Yes/No)? ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// bindRegistry binds to the winreg pipe of an established connection
+func bindRegistry(conn *smb.Connection) (*msrrp.Client, error) {
+	share := "IPC$"
+	if err := conn.TreeConnect(share); err != nil {
+		return nil, err
+	}
+	f, err := conn.OpenFile(share, msrrp.MSRRPPipe)
+	if err != nil {
+		return nil, err
+	}
+	bind, err := dcerpc.Bind(f, msrrp.MSRRPUuid, msrrp.MSRRPMajorVersion, msrrp.MSRRPMinorVersion, msrrp.NDRUuid)
+	if err != nil {
+		f.CloseFile()
+		return nil, err
+	}
+	return msrrp.NewClient(bind), nil
+}
+
+func runReg(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("Usage: reg query|add|delete|save \\\\host\\KEY [switches]")
+	}
+	op := strings.ToLower(args[0])
+	parsed, err := parseRegArgs(op, args[1:])
+	if err != nil {
+		return err
+	}
+	expected := 1
+	if op == "save" {
+		expected = 2
+	}
+	if len(parsed.args) != expected {
+		return fmt.Errorf("Expected %d arguments but got %d", expected, len(parsed.args))
+	}
+	host, key, err := parseRegKey(parsed.args[0])
+	if err != nil {
+		return err
+	}
+
+	conn, err := connect(host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client, err := bindRegistry(conn)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	switch op {
+	case "query":
+		return regQuery(client, key, parsed)
+	case "add":
+		return regAdd(client, key, parsed)
+	case "delete":
+		return regDelete(client, key, parsed)
+	default:
+		return regSave(conn, client, key, parsed.args[1], parsed.has("y"))
+	}
+}
+
+// regValueName returns the value selected by /v or /ve
+func regValueName(a regArgs) (name string, ok bool) {
+	if a.has("ve") {
+		return "", true
+	}
+	name, ok = a.switches["v"]
+	return
+}
+
+// regTypeName returns the reg.exe name of a value type
+func regTypeName(dataType uint32) string {
+	if dataType == msrrp.RegNone {
+		return "REG_NONE"
+	}
+	for name, t := range regTypeNames {
+		if t == dataType {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%x", dataType)
+}
+
+// formatRegValue formats a decoded value the way reg.exe prints it
+func formatRegValue(name string, dataType uint32, value any) string {
+	if name == "" {
+		name = "(Default)"
+	}
+	var data string
+	switch d := value.(type) {
+	case string:
+		data = d
+	case []string:
+		data = strings.Join(d, `\0`)
+	case uint32:
+		data = fmt.Sprintf("0x%x", d)
+	case uint64:
+		data = fmt.Sprintf("0x%x", d)
+	case []byte:
+		data = strings.ToUpper(hex.EncodeToString(d))
+	}
+	return fmt.Sprintf("    %s    %s    %s", name, regTypeName(dataType), data)
+}
+
+// Record of a registry value or subkey printed in JSON mode
+type regRecord struct {
+	Key    string `json:"key"`
+	Name   string `json:"name,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Data   any    `json:"data,omitempty"`
+	Subkey string `json:"subkey,omitempty"`
+}
+
+// printRegValue prints a single value of a key
+func printRegValue(key, name string, dataType uint32, value any) {
+	if !*jsonOutput {
+		fmt.Println(formatRegValue(name, dataType, value))
+		return
+	}
+	if b, ok := value.([]byte); ok {
+		value = strings.ToUpper(hex.EncodeToString(b))
+	}
+	emit(regRecord{Key: key, Name: name, Type: regTypeName(dataType), Data: value})
+}
+
+// printRegValues prints the values of a key returned by an enumeration
+func printRegValues(key string, values []msrrp.ValueInfo) {
+	for _, v := range values {
+		value, err := v.Data()
+		if err != nil {
+			value = v.Value
+		}
+		printRegValue(key, v.Name, v.Type, value)
+	}
+}
+
+// regDone reports the success of a change to the registry
+func regDone(op, key string) error {
+	if *jsonOutput {
+		return emitDone("reg "+op, key)
+	}
+	fmt.Println("The operation completed successfully.")
+	return nil
+}
+
+// parseRegData converts the /d argument of reg add to the Go type expected
+// by SetValue for the value type
+func parseRegData(dataType uint32, data, separator string) (any, error) {
+	switch dataType {
+	case msrrp.RegSz, msrrp.RegExpandSz:
+		return data, nil
+	case msrrp.RegMultiSz:
+		if data == "" {
+			return []string{}, nil
+		}
+		return strings.Split(data, separator), nil
+	case msrrp.RegDword, msrrp.RegDwordBigEndian, msrrp.RegQword:
+		bitSize := 32
+		if dataType == msrrp.RegQword {
+			bitSize = 64
+		}
+		base := 10
+		if strings.HasPrefix(strings.ToLower(data), "0x") {
+			base, data = 16, data[2:]
+		}
+		n, err := strconv.ParseUint(data, base, bitSize)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid number %s for %s", data, regTypeName(dataType))
+		}
+		if dataType == msrrp.RegQword {
+			return n, nil
+		}
+		return uint32(n), nil
+	case msrrp.RegBinary:
+		b, err := hex.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid hex data for REG_BINARY: %s", err)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("Unsupported value type %s", regTypeName(dataType))
+}
+
+func regQuery(client *msrrp.Client, key string, a regArgs) error {
+	name, byName := regValueName(a)
+	if a.has("s") {
+		// Walk the subtree, optionally only printing values with the given name
+		found := false
+		err := client.WalkKey(key, func(path string, values []msrrp.ValueInfo, err error) error {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+				return nil
+			}
+			if byName {
+				var matches []msrrp.ValueInfo
+				for _, v := range values {
+					if strings.EqualFold(v.Name, name) {
+						matches = append(matches, v)
+					}
+				}
+				if len(matches) == 0 {
+					return nil
+				}
+				values = matches
+			}
+			found = true
+			if *jsonOutput {
+				printRegValues(path, values)
+				return nil
+			}
+			fmt.Println(path)
+			printRegValues(path, values)
+			fmt.Println()
+			return nil
+		})
+		if err == nil && !found {
+			err = fmt.Errorf("The system was unable to find the specified registry key or value")
+		}
+		return err
+	}
+
+	if byName {
+		value, dataType, err := client.GetValue(key, name)
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			printRegValue(key, name, dataType, value)
+			return nil
+		}
+		fmt.Printf("%s\n%s\n\n", key, formatRegValue(name, dataType, value))
+		return nil
+	}
+
+	hKey, err := client.OpenKey(key)
+	if err != nil {
+		return err
+	}
+	values, err := client.RPCCon().EnumValues(hKey)
+	if err != nil {
+		return err
+	}
+	names, err := client.SubKeyNames(key)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	if *jsonOutput {
+		printRegValues(key, values)
+		for _, name := range names {
+			emit(regRecord{Key: key, Subkey: name})
+		}
+		return nil
+	}
+	fmt.Println(key)
+	printRegValues(key, values)
+	fmt.Println()
+	for _, name := range names {
+		fmt.Printf("%s\\%s\n", key, name)
+	}
+	return nil
+}
+
+func regAdd(client *msrrp.Client, key string, a regArgs) error {
+	name, byName := regValueName(a)
+	if !byName && (a.has("t") || a.has("d") || a.has("s")) {
+		return fmt.Errorf("/t, /d and /s require /v or /ve")
+	}
+	var (
+		dataType uint32 = msrrp.RegSz
+		value    any
+	)
+	if byName {
+		if t, ok := a.switches["t"]; ok {
+			if dataType, ok = regTypeNames[strings.ToUpper(t)]; !ok {
+				return fmt.Errorf("Unsupported value type %s", t)
+			}
+		}
+		separator, ok := a.switches["s"]
+		if !ok {
+			separator = `\0`
+		}
+		var err error
+		if value, err = parseRegData(dataType, a.switches["d"], separator); err != nil {
+			return err
+		}
+	}
+
+	if _, err := client.CreateKey(key); err != nil {
+		return err
+	}
+	if !byName {
+		return regDone("add", key)
+	}
+	if !a.has("f") {
+		if _, _, err := client.GetValue(key, name); err == nil && !confirm(fmt.Sprintf("Value %s exists, overwrite", name)) {
+			return fmt.Errorf("The operation was cancelled by the user")
+		}
+	}
+	if err := client.SetValue(key, name, value, dataType); err != nil {
+		return err
+	}
+	return regDone("add", key)
+}
+
+// deleteRegTree deletes a key including all of its subkeys
+func deleteRegTree(client *msrrp.Client, key string) error {
+	names, err := client.SubKeyNames(key)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err = deleteRegTree(client, key+`\`+name); err != nil {
+			return err
+		}
+	}
+	return client.DeleteKey(key)
+}
+
+func regDelete(client *msrrp.Client, key string, a regArgs) (err error) {
+	name, byName := regValueName(a)
+	switch {
+	case byName:
+		if !a.has("f") && !confirm(fmt.Sprintf("Delete the registry value %s", name)) {
+			return fmt.Errorf("The operation was cancelled by the user")
+		}
+		err = client.DeleteValue(key, name)
+	case a.has("va"):
+		if !a.has("f") && !confirm(fmt.Sprintf("Delete all values under the registry key %s", key)) {
+			return fmt.Errorf("The operation was cancelled by the user")
+		}
+		var names []string
+		if names, err = client.ValueNames(key); err != nil {
+			return
+		}
+		for _, name := range names {
+			if err = client.DeleteValue(key, name); err != nil {
+				return
+			}
+		}
+	default:
+		if !a.has("f") && !confirm(fmt.Sprintf("Permanently delete the registry key %s", key)) {
+			return fmt.Errorf("The operation was cancelled by the user")
+		}
+		err = deleteRegTree(client, key)
+	}
+	if err == nil {
+		err = regDone("delete", key)
+	}
+	return
+}
+
+// saveHive is SaveHive that only reports a saved file left on the server as
+// the hive itself was retrieved
+func saveHive(conn *smb.Connection, client *msrrp.Client, key string) ([]byte, error) {
+	data, err := client.SaveHive(conn, key)
+	var cleanupErr *msrrp.CleanupError
+	if errors.As(err, &cleanupErr) {
+		fmt.Fprintln(os.Stderr, err)
+		err = nil
+	}
+	return data, err
+}
+
+func regSave(conn *smb.Connection, client *msrrp.Client, key, local string, overwrite bool) error {
+	if _, err := os.Stat(local); err == nil && !overwrite && !confirm(fmt.Sprintf("File %s already exists. Overwrite", local)) {
+		return fmt.Errorf("The operation was cancelled by the user")
+	}
+	data, err := saveHive(conn, client, key)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(local, data, 0600); err != nil {
+		return err
+	}
+	return regDone("save", key)
+}
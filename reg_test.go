@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/dcerpc/msrrp"
+)
+
+func TestParseRegArgs(t *testing.T) {
+	a, err := parseRegArgs("add", []string{`\\host\HKLM\Software\Test`, "/v", "Name", "/T", "REG_DWORD", "/d", "0x10", "/f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.args) != 1 || a.switches["v"] != "Name" || a.switches["t"] != "REG_DWORD" || a.switches["d"] != "0x10" || !a.has("f") {
+		t.Fatalf("Fail: %+v", a)
+	}
+	host, key, err := parseRegKey(a.args[0])
+	if err != nil || host != "host" || key != `HKLM\Software\Test` {
+		t.Fatalf("Fail: %s %s %v", host, key, err)
+	}
+	if _, _, err = parseRegKey("//host/HKXX/Software"); err == nil {
+		t.Fatal("Fail")
+	}
+
+	for _, args := range [][]string{
+		{"//host/HKLM", "/v"},
+		{"//host/HKLM", "/x"},
+		{"//host/HKLM", "/v", "a", "/ve"},
+		{"//host/HKLM", "/f", "/f"},
+	} {
+		if _, err = parseRegArgs("delete", args); err == nil {
+			t.Fatalf("Fail: %v", args)
+		}
+	}
+}
+
+func TestParseRegData(t *testing.T) {
+	for _, test := range []struct {
+		dataType uint32
+		data     string
+		expected any
+	}{
+		{msrrp.RegSz, "text", "text"},
+		{msrrp.RegMultiSz, `a\0b`, []string{"a", "b"}},
+		{msrrp.RegDword, "0x10", uint32(16)},
+		{msrrp.RegDword, "10", uint32(10)},
+		{msrrp.RegQword, "0xffffffffff", uint64(0xffffffffff)},
+		{msrrp.RegBinary, "00ff", []byte{0, 0xff}},
+	} {
+		value, err := parseRegData(test.dataType, test.data, `\0`)
+		if err != nil || !reflect.DeepEqual(value, test.expected) {
+			t.Fatalf("Fail: %v %v", value, err)
+		}
+	}
+	if _, err := parseRegData(msrrp.RegDword, "0x100000000", `\0`); err == nil {
+		t.Fatal("Fail")
+	}
+	if line := formatRegValue("", msrrp.RegDword, uint32(16)); line != "    (Default)    REG_DWORD    0x10" {
+		t.Fatalf("Fail: %s", line)
+	}
+}
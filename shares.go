@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/ericblavier/go-smb/smb/dcerpc/mssrvs"
+	"github.com/ericblavier/go-smb/smb/rap"
+	"github.com/ericblavier/go-smb/spnego"
+)
+
+// A share and the access granted to the current credentials
+type shareInfo struct {
+	Host    string `json:"host"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Comment string `json:"comment"`
+	Hidden  bool   `json:"hidden"`
+	Connect bool   `json:"connect"`
+	Read    bool   `json:"read"`
+	Write   *bool  `json:"write,omitempty"` // Only set when probed
+}
+
+// access summarizes the probed access as a short string for the table output
+func (s shareInfo) access() string {
+	if !s.Connect {
+		return "NO ACCESS"
+	}
+	var rights []string
+	if s.Read {
+		rights = append(rights, "READ")
+	}
+	if s.Write != nil && *s.Write {
+		rights = append(rights, "WRITE")
+	}
+	if len(rights) == 0 {
+		return "CONNECT"
+	}
+	return strings.Join(rights, ",")
+}
+
+// enumShares lists the shares of the server through the srvsvc pipe
+func enumShares(conn *smb.Connection, host string) ([]mssrvs.NetShare, error) {
+	share := "IPC$"
+	if err := conn.TreeConnect(share); err != nil {
+		return nil, err
+	}
+	defer conn.TreeDisconnect(share)
+	f, err := conn.OpenFile(share, mssrvs.MSRPCSrvSvcPipe)
+	if err != nil {
+		return nil, err
+	}
+	defer f.CloseFile()
+
+	bind, err := dcerpc.Bind(f, mssrvs.MSRPCUuidSrvSvc, mssrvs.MSRPCSrvSvcMajorVersion, mssrvs.MSRPCSrvSvcMinorVersion, dcerpc.MSRPCUuidNdr)
+	if err != nil {
+		return nil, err
+	}
+	return mssrvs.NewRPCCon(bind).NetShareEnumAll(host)
+}
+
+func runShares(args []string) error {
+	fs := flag.NewFlagSet("shares", flag.ExitOnError)
+	asJSON := fs.Bool("json", *jsonOutput, "Print one JSON record per share")
+	write := fs.Bool("write", false, "Probe for write access by creating and removing a directory in each share")
+	useRAP := fs.Bool("rap", false, "List the shares with RAP over SMB1 for devices lacking srvsvc. Access is not probed")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Usage: shares [-json] [-write] [-rap] <host>")
+	}
+	host := fs.Arg(0)
+	if *useRAP {
+		return runSharesRAP(host, *asJSON)
+	}
+
+	conn, err := connect(host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	shares, err := enumShares(conn, host)
+	if err != nil {
+		return err
+	}
+	result := make([]shareInfo, 0, len(shares))
+	for _, share := range shares {
+		info := shareInfo{Host: host, Name: share.Name, Type: share.Type, Comment: share.Comment, Hidden: share.Hidden}
+		// Only disk shares can hold a probe directory
+		probeWrite := *write && share.TypeId == mssrvs.StypeDisktree
+		access, err := conn.CheckShareAccess(share.Name, probeWrite)
+		if err != nil {
+			return err
+		}
+		info.Connect, info.Read = access.Connect, access.Read
+		if probeWrite {
+			info.Write = &access.Write
+		}
+		result = append(result, info)
+	}
+
+	if *asJSON {
+		for _, info := range result {
+			if err = emit(info); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	fmt.Printf("  %-20s %-18s %-12s %s\n", "Name", "Type", "Access", "Comment")
+	for _, info := range result {
+		fmt.Printf("  %-20s %-18s %-12s %s\n", info.Name, info.Type, info.access(), info.Comment)
+	}
+	return nil
+}
+
+// runSharesRAP lists the shares of an SMB1 only device with the Remote
+// Administration Protocol
+func runSharesRAP(host string, asJSON bool) error {
+	opts := smb.LanmanOptions{ProbeOptions: smb.ProbeOptions{Port: *port, Timeout: 30 * time.Second}}
+	if *username != "" {
+		opts.Initiator = &spnego.NTLMInitiator{User: *username, Password: *password, Domain: *domain}
+	}
+	session, err := smb.DialLanman(host, opts)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	shares, err := rap.NewClient(session).NetShareEnum()
+	if err == rap.Error(rap.ErrorMoreData) {
+		fmt.Fprintf(os.Stderr, "Only the first %d shares fit in the response\n", len(shares))
+	} else if err != nil {
+		return err
+	}
+
+	if !asJSON {
+		fmt.Printf("  %-20s %-18s %s\n", "Name", "Type", "Comment")
+	}
+	for _, share := range shares {
+		info := shareInfo{Host: host, Name: share.Name, Type: mssrvs.ShareTypeMap[uint32(share.Type)], Comment: share.Comment}
+		info.Hidden = strings.HasSuffix(share.Name, "$")
+		if asJSON {
+			if err = emit(info); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Printf("  %-20s %-18s %s\n", info.Name, info.Type, info.Comment)
+	}
+	return nil
+}
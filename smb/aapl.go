@@ -0,0 +1,268 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// Apple SMB2 extensions negotiated by macOS clients with the AAPL create
+// context and implemented by macOS file sharing and Samba with vfs_fruit.
+// Not part of MS-SMB2.
+const CreateContextAAPL = "AAPL"
+
+// AAPL create context commands
+const (
+	AAPLServerQuery uint32 = 1
+	AAPLResolveId   uint32 = 2
+)
+
+// AAPL server query request and reply bitmap
+const (
+	AAPLServerCaps uint64 = 0x01
+	AAPLVolumeCaps uint64 = 0x02
+	AAPLModelInfo  uint64 = 0x04
+)
+
+// AAPL client and server capabilities
+const (
+	AAPLSupportsReadDirAttr uint64 = 0x01 // Directory listings carry the macOS attributes of the entries
+	AAPLSupportsOSXCopyfile uint64 = 0x02
+	AAPLUnixBased           uint64 = 0x04
+	AAPLSupportsNFSAce      uint64 = 0x08
+)
+
+// AAPL volume capabilities
+const (
+	AAPLSupportResolveId uint64 = 0x01
+	AAPLCaseSensitive    uint64 = 0x02
+	AAPLSupportsFullSync uint64 = 0x04
+)
+
+// Named streams holding the resource fork and the Finder info of a file on
+// macOS servers
+const (
+	AFPResourceStream = "AFP_Resource"
+	AFPInfoStream     = "AFP_AfpInfo"
+)
+
+// AAPLServerInfo is the reply of a macOS server to the AAPL server query
+type AAPLServerInfo struct {
+	ServerCaps uint64
+	VolumeCaps uint64
+	Model      string // E.g., MacSamba or the model of the Mac
+}
+
+// MacOSAttributes are returned by macOS servers with readdir attributes in
+// place of the EA size, short name and reserved fields of
+// FILE_ID_BOTH_DIR_INFORMATION
+type MacOSAttributes struct {
+	MaxAccess        uint32
+	ResourceForkSize uint64
+	FinderInfo       []byte // Compressed Finder info, 16 bytes
+	UnixMode         uint16
+}
+
+// AfpInfo is the content of the AFP_AfpInfo stream. The fields are big
+// endian.
+type AfpInfo struct {
+	BackupTime uint32
+	FinderInfo []byte // 32 bytes
+	ProDOSInfo []byte // 6 bytes
+}
+
+const afpInfoSignature = 0x41465000 // "AFP\0"
+const afpInfoSize = 60
+
+func (self *AfpInfo) MarshalBinary() ([]byte, error) {
+	if len(self.FinderInfo) > 32 || len(self.ProDOSInfo) > 6 {
+		return nil, fmt.Errorf("Finder or ProDOS info too large for AfpInfo")
+	}
+	buf := make([]byte, afpInfoSize)
+	binary.BigEndian.PutUint32(buf, afpInfoSignature)
+	binary.BigEndian.PutUint32(buf[4:], 0x00010000) // Version
+	binary.BigEndian.PutUint32(buf[12:], self.BackupTime)
+	copy(buf[16:48], self.FinderInfo)
+	copy(buf[48:54], self.ProDOSInfo)
+	return buf, nil
+}
+
+func (self *AfpInfo) UnmarshalBinary(buf []byte) error {
+	if len(buf) < afpInfoSize {
+		return fmt.Errorf("Buffer too small for AfpInfo")
+	}
+	if binary.BigEndian.Uint32(buf) != afpInfoSignature {
+		return fmt.Errorf("Invalid AfpInfo signature")
+	}
+	self.BackupTime = binary.BigEndian.Uint32(buf[12:])
+	self.FinderInfo = buf[16:48]
+	self.ProDOSInfo = buf[48:54]
+	return nil
+}
+
+// ResourceForkPath returns the path of the stream holding the resource fork
+// of a file on a macOS server
+func ResourceForkPath(path string) string {
+	return path + ":" + AFPResourceStream
+}
+
+// FinderInfoPath returns the path of the stream holding the AfpInfo of a
+// file on a macOS server
+func FinderInfoPath(path string) string {
+	return path + ":" + AFPInfoStream
+}
+
+// IsResourceFork reports whether the stream is the resource fork of a file
+// on a macOS server
+func (self *FileStream) IsResourceFork() bool {
+	return strings.EqualFold(strings.TrimSuffix(self.Name, ":$DATA"), ":"+AFPResourceStream)
+}
+
+// newAAPLServerQuery returns the AAPL create context asking for the server
+// and volume capabilities and the model
+func newAAPLServerQuery() CreateContext {
+	data := binary.LittleEndian.AppendUint32(nil, AAPLServerQuery)
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = binary.LittleEndian.AppendUint64(data, AAPLServerCaps|AAPLVolumeCaps|AAPLModelInfo)
+	data = binary.LittleEndian.AppendUint64(data, AAPLSupportsReadDirAttr)
+	return CreateContext{Name: CreateContextAAPL, Data: data}
+}
+
+// parseAAPLServerQuery decodes the reply to the AAPL server query
+func parseAAPLServerQuery(buf []byte) (info *AAPLServerInfo, err error) {
+	if len(buf) < 16 {
+		return nil, fmt.Errorf("Buffer too small for AAPL server query reply")
+	}
+	if cmd := binary.LittleEndian.Uint32(buf); cmd != AAPLServerQuery {
+		return nil, fmt.Errorf("Unexpected AAPL command in reply: %d", cmd)
+	}
+	bitmap := binary.LittleEndian.Uint64(buf[8:16])
+	buf = buf[16:]
+	info = &AAPLServerInfo{}
+	for _, field := range []struct {
+		bit   uint64
+		value *uint64
+	}{{AAPLServerCaps, &info.ServerCaps}, {AAPLVolumeCaps, &info.VolumeCaps}} {
+		if bitmap&field.bit == 0 {
+			continue
+		}
+		if len(buf) < 8 {
+			return nil, fmt.Errorf("Buffer too small for AAPL server query reply")
+		}
+		*field.value = binary.LittleEndian.Uint64(buf)
+		buf = buf[8:]
+	}
+	if bitmap&AAPLModelInfo != 0 {
+		// Four bytes of padding precede the length of the model string
+		if len(buf) < 8 {
+			return nil, fmt.Errorf("Buffer too small for AAPL model info")
+		}
+		modelLen := binary.LittleEndian.Uint32(buf[4:8])
+		if uint64(modelLen) > uint64(len(buf)-8) {
+			return nil, fmt.Errorf("AAPL model string exceeds the reply")
+		}
+		info.Model, err = encoder.FromUnicodeString(buf[8 : 8+modelLen])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// AAPLServerInfo returns the reply of the server to the AAPL server query or
+// nil if Options.MacOSExtensions is not set or the server did not reply
+func (c *Connection) AAPLServerInfo() *AAPLServerInfo {
+	return c.aapl.Load()
+}
+
+// aaplContexts returns the create contexts to send on CREATE until the
+// server replies to the AAPL server query
+func (c *Connection) aaplContexts() []CreateContext {
+	if !c.options.MacOSExtensions || c.aapl.Load() != nil {
+		return nil
+	}
+	return []CreateContext{newAAPLServerQuery()}
+}
+
+// handleAAPL records the reply of the server to the AAPL server query if the
+// CREATE response carries one
+func (c *Connection) handleAAPL(res *CreateRes) {
+	if !c.options.MacOSExtensions || c.aapl.Load() != nil || res.CreateContextsLength == 0 {
+		return
+	}
+	ctxs, err := res.CreateContexts()
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+	data, ok := findCreateContext(ctxs, CreateContextAAPL)
+	if !ok {
+		return
+	}
+	info, err := parseAAPLServerQuery(data)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+	log.Debugf("AAPL server caps 0x%x, volume caps 0x%x, model %q\n", info.ServerCaps, info.VolumeCaps, info.Model)
+	c.aapl.CompareAndSwap(nil, info)
+}
+
+// readDirAttr reports whether directory listings carry the macOS attributes
+// of the entries
+func (c *Connection) readDirAttr() bool {
+	info := c.aapl.Load()
+	return info != nil && info.ServerCaps&AAPLSupportsReadDirAttr != 0
+}
+
+// macOSDirectoryInformation converts an entry of FILE_ID_BOTH_DIR_INFORMATION
+// returned with readdir attributes to FILE_BOTH_DIR_INFORMATION and the
+// macOS attributes
+func (self *FileIdBothDirectoryInformationStruct) macOSDirectoryInformation() (FileBothDirectoryInformationStruct, *MacOSAttributes) {
+	fs := FileBothDirectoryInformationStruct{
+		NextEntryOffset: self.NextEntryOffset,
+		FileIndex:       self.FileIndex,
+		CreationTime:    self.CreationTime,
+		LastAccessTime:  self.LastAccessTime,
+		LastWriteTime:   self.LastWriteTime,
+		ChangeTime:      self.ChangeTime,
+		EndOfFile:       self.EndOfFile,
+		AllocationSize:  self.AllocationSize,
+		FileAttributes:  self.FileAttributes,
+		FileNameLength:  self.FileNameLength,
+		EaSize:          self.EaSize,
+		ShortNameLength: self.ShortNameLength,
+		ShortName:       self.ShortName,
+		FileName:        self.FileName,
+	}
+	return fs, &MacOSAttributes{
+		MaxAccess:        self.EaSize,
+		ResourceForkSize: binary.LittleEndian.Uint64(self.ShortName[:8]),
+		FinderInfo:       self.ShortName[8:24],
+		UnixMode:         self.Reserved2,
+	}
+}
@@ -0,0 +1,199 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+func TestCreateContexts(t *testing.T) {
+	ctxs := []CreateContext{{Name: "MxAc"}, {Name: "AAPL", Data: []byte{1, 2, 3}}, {Name: "QFid"}}
+	buf := marshalCreateContexts(ctxs)
+	if binary.LittleEndian.Uint32(buf) != 24 || binary.LittleEndian.Uint32(buf[24:]) != 32 {
+		t.Fatalf("Fail: %x", buf)
+	}
+	res, err := parseCreateContexts(buf)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if len(res) != 3 || res[0].Name != "MxAc" || len(res[0].Data) != 0 || res[1].Name != "AAPL" || !bytes.Equal(res[1].Data, ctxs[1].Data) || res[2].Name != "QFid" {
+		t.Fatalf("Fail: %+v", res)
+	}
+	if _, err = parseCreateContexts(buf[:40]); err == nil {
+		t.Fatal("Fail")
+	}
+
+	req := CreateReq{NameOffset: 120, NameLength: 6, Buffer: encoder.ToUnicode("a:b")}
+	req.SetCreateContexts(ctxs[:1])
+	if req.CreateContextsOffset != 128 || int(req.CreateContextsLength) != len(req.Buffer)-8 {
+		t.Fatalf("Fail: %+v", req)
+	}
+}
+
+// newAAPLReply returns the reply of Samba with vfs_fruit to the AAPL server
+// query
+func newAAPLReply(serverCaps, volumeCaps uint64, model string) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, AAPLServerQuery)
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	buf = binary.LittleEndian.AppendUint64(buf, AAPLServerCaps|AAPLVolumeCaps|AAPLModelInfo)
+	buf = binary.LittleEndian.AppendUint64(buf, serverCaps)
+	buf = binary.LittleEndian.AppendUint64(buf, volumeCaps)
+	u := encoder.ToUnicode(model)
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(u)))
+	return append(buf, u...)
+}
+
+func TestParseAAPLServerQuery(t *testing.T) {
+	reply := newAAPLReply(AAPLSupportsReadDirAttr|AAPLUnixBased, AAPLCaseSensitive, "MacSamba")
+	info, err := parseAAPLServerQuery(reply)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if *info != (AAPLServerInfo{AAPLSupportsReadDirAttr | AAPLUnixBased, AAPLCaseSensitive, "MacSamba"}) {
+		t.Fatalf("Fail: %+v", info)
+	}
+	for _, n := range []int{0, 20, 36, len(reply) - 1} {
+		if _, err = parseAAPLServerQuery(reply[:n]); err == nil {
+			t.Fatalf("Fail: %d", n)
+		}
+	}
+}
+
+func TestAfpInfo(t *testing.T) {
+	in := AfpInfo{BackupTime: 0x80000000, FinderInfo: []byte("TEXTttxt"), ProDOSInfo: make([]byte, 6)}
+	buf, err := in.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if !bytes.Equal(buf[:8], []byte{'A', 'F', 'P', 0, 0, 1, 0, 0}) {
+		t.Fatalf("Fail: %x", buf)
+	}
+	var out AfpInfo
+	if err = out.UnmarshalBinary(buf); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if out.BackupTime != in.BackupTime || !bytes.HasPrefix(out.FinderInfo, in.FinderInfo) || len(out.FinderInfo) != 32 {
+		t.Fatalf("Fail: %+v", out)
+	}
+	if err = out.UnmarshalBinary(buf[:59]); err == nil {
+		t.Fatal("Fail")
+	}
+	if ResourceForkPath(`dir\file`) != `dir\file:AFP_Resource` || FinderInfoPath("file") != "file:AFP_AfpInfo" {
+		t.Fatal("Fail")
+	}
+	stream := FileStream{Name: ":AFP_Resource:$DATA"}
+	if !stream.IsResourceFork() {
+		t.Fatal("Fail")
+	}
+}
+
+// serveAAPLListing answers the CREATE, QUERY_DIRECTORY and CLOSE requests of
+// ListDirectory like a macOS server. The AAPL context of each CREATE is sent
+// on contexts.
+func serveAAPLListing(server net.Conn, entry []byte, contexts chan<- []CreateContext) {
+	listed := false
+	for {
+		buf, err := readTestFrame(server)
+		if err != nil {
+			return
+		}
+		var h Header
+		if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+			return
+		}
+		hdr := Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       h.Command,
+			Credits:       1,
+			Flags:         SMB2_FLAGS_SERVER_TO_REDIR,
+			MessageID:     h.MessageID,
+			Signature:     make([]byte, 16),
+		}
+		var res interface{}
+		switch h.Command {
+		case CommandCreate:
+			offset := binary.LittleEndian.Uint32(buf[112:])
+			length := binary.LittleEndian.Uint32(buf[116:])
+			ctxs, _ := parseCreateContexts(buf[offset : offset+length])
+			contexts <- ctxs
+			cr := &CreateRes{Header: hdr, StructureSize: 89, FileId: make([]byte, 16)}
+			if _, ok := findCreateContext(ctxs, CreateContextAAPL); ok {
+				cr.Buffer = marshalCreateContexts([]CreateContext{
+					{Name: CreateContextAAPL, Data: newAAPLReply(AAPLSupportsReadDirAttr, 0, "MacBookPro18,3")},
+				})
+			}
+			res = cr
+		case CommandQueryDirectory:
+			if listed {
+				// Same size as the ERROR response body
+				hdr.Status = StatusNoMoreFiles
+				res = &QueryDirectoryRes{Header: hdr, StructureSize: 9, Buffer: []byte{0}}
+				break
+			}
+			listed = true
+			// FILE_BOTH_DIR_INFORMATION entries would not be parsed
+			if buf[66] != FileIdBothDirectoryInformation {
+				return
+			}
+			res = &QueryDirectoryRes{Header: hdr, StructureSize: 9, Buffer: entry}
+		case CommandClose:
+			res = &CloseRes{Header: hdr, StructureSize: 60}
+		}
+		if err = writeTestFrame(server, res); err != nil {
+			return
+		}
+	}
+}
+
+func TestAAPLReadDirAttr(t *testing.T) {
+	name := encoder.ToUnicode("file.txt")
+	shortName := binary.LittleEndian.AppendUint64(nil, 512)
+	shortName = append(shortName, []byte("TEXTttxt\x00\x00\x00\x00\x00\x00\x00\x00")...)
+	entry, err := encoder.Marshal(FileIdBothDirectoryInformationStruct{
+		EndOfFile:       10,
+		EaSize:          0x1f01ff,
+		ShortNameLength: 24,
+		ShortName:       shortName,
+		Reserved2:       0o100644,
+		FileName:        name,
+	})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+
+	c, server := newTestConnection(t, Options{MacOSExtensions: true})
+	c.maxTransactSize = 65536
+	contexts := make(chan []CreateContext, 2)
+	go serveAAPLListing(server, entry, contexts)
+	files, err := c.ListDirectory("share", "", "*")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if ctxs := <-contexts; len(ctxs) != 1 || ctxs[0].Name != CreateContextAAPL {
+		t.Fatalf("Fail: %+v", ctxs)
+	}
+	info := c.AAPLServerInfo()
+	if info == nil || info.Model != "MacBookPro18,3" || info.ServerCaps != AAPLSupportsReadDirAttr {
+		t.Fatalf("Fail: %+v", info)
+	}
+	if len(files) != 1 || files[0].Name != "file.txt" || files[0].Size != 10 || files[0].MacOS == nil {
+		t.Fatalf("Fail: %+v", files)
+	}
+	macOS := files[0].MacOS
+	if macOS.MaxAccess != 0x1f01ff || macOS.ResourceForkSize != 512 || string(macOS.FinderInfo[:8]) != "TEXTttxt" || macOS.UnixMode != 0o100644 {
+		t.Fatalf("Fail: %+v", macOS)
+	}
+
+	// The query is not repeated once answered
+	if _, err = c.ListDirectory("share", "", "*"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if ctxs := <-contexts; len(ctxs) != 0 {
+		t.Fatalf("Fail: %+v", ctxs)
+	}
+}
@@ -0,0 +1,166 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// MS-SMB2 Section 2.2.13.2.5 SMB2_CREATE_QUERY_MAXIMAL_ACCESS_REQUEST
+const CreateContextMaximalAccess = "MxAc"
+
+// AccessDeniedError is returned by OpenFileExt in place of the
+// StatusAccessDenied error of StatusMap when Options.AccessDeniedDiagnostics
+// is set. It tells what was requested and what would have been granted.
+type AccessDeniedError struct {
+	Share         string
+	Path          string
+	DesiredAccess uint32
+	// Access granted when opening with MAXIMUM_ALLOWED, valid if
+	// GrantedKnown is set
+	GrantedAccess uint32
+	GrantedKnown  bool
+	// Security descriptor of the root of the share. Nil when it can't be
+	// read.
+	ShareSecurity *FileSecurityInformation
+}
+
+func (e *AccessDeniedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: opening %s\\%s with %s",
+		StatusMap[StatusAccessDenied], e.Share, e.Path, strings.Join(accessMaskNames(e.DesiredAccess), "|"))
+	if e.GrantedKnown {
+		fmt.Fprintf(&b, ", granted %s", strings.Join(accessMaskNames(e.GrantedAccess), "|"))
+		if missing := e.DesiredAccess &^ e.GrantedAccess &^ FAccMaskMaximumAllowed; missing != 0 {
+			fmt.Fprintf(&b, ", missing %s", strings.Join(accessMaskNames(missing), "|"))
+		}
+	} else {
+		b.WriteString(", no access granted")
+	}
+	if e.ShareSecurity != nil {
+		fmt.Fprintf(&b, ", share owned by %s", e.ShareSecurity.OwnerSID)
+		for _, ace := range e.ShareSecurity.Access {
+			fmt.Fprintf(&b, ", %s allowed %s", ace.SID, strings.Join(ace.Permissions, "|"))
+		}
+	}
+	return b.String()
+}
+
+// Unwrap returns the StatusAccessDenied error of StatusMap
+func (e *AccessDeniedError) Unwrap() error {
+	return StatusMap[StatusAccessDenied]
+}
+
+// Names of the file specific access rights, the others are in accessMaskMap
+var fileAccessMaskMap = map[uint32]string{
+	FAccMaskFileReadData:        "FILE_READ_DATA",
+	FAccMaskFileWriteData:       "FILE_WRITE_DATA",
+	FAccMaskFileAppendData:      "FILE_APPEND_DATA",
+	FAccMaskFileReadEA:          "FILE_READ_EA",
+	FAccMaskFileWriteEA:         "FILE_WRITE_EA",
+	FAccMaskFileExecute:         "FILE_EXECUTE",
+	FAccMaskFileDeleteChild:     "FILE_DELETE_CHILD",
+	FAccMaskFileReadAttributes:  "FILE_READ_ATTRIBUTES",
+	FAccMaskFileWriteAttributes: "FILE_WRITE_ATTRIBUTES",
+}
+
+// accessMaskNames returns the names of the bits of an access mask
+func accessMaskNames(mask uint32) (names []string) {
+	for bit := uint32(1); bit != 0; bit <<= 1 {
+		if mask&bit == 0 {
+			continue
+		}
+		if name, ok := fileAccessMaskMap[bit]; ok {
+			names = append(names, name)
+		} else if name, ok := accessMaskMap[bit]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("0x%x", bit))
+		}
+	}
+	if len(names) == 0 {
+		names = []string{"0"}
+	}
+	return
+}
+
+// MaximalAccess returns the access the server would grant to the session
+// for the open according to the MxAc create context of the CREATE response.
+// ok is false unless the context was requested in CreateReqOpts and
+// answered successfully.
+func (f *File) MaximalAccess() (access uint32, ok bool) {
+	data, found := findCreateContext(f.createContexts, CreateContextMaximalAccess)
+	// MS-SMB2 Section 2.2.14.2.5 SMB2_CREATE_QUERY_MAXIMAL_ACCESS_RESPONSE
+	if !found || len(data) < 8 || binary.LittleEndian.Uint32(data) != StatusOk {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(data[4:]), true
+}
+
+// MaximalAccess opens a file or directory with MAXIMUM_ALLOWED and returns
+// the access the server grants to the session
+func (s *Connection) MaximalAccess(share, path string) (access uint32, err error) {
+	opts := s.createReqOpts()
+	opts.DesiredAccess = FAccMaskMaximumAllowed
+	opts.ShareAccess = FileShareRead | FileShareWrite | FileShareDelete
+	opts.CreateContexts = []CreateContext{{Name: CreateContextMaximalAccess}}
+	f, err := s.createFile(share, path, opts)
+	if err != nil {
+		return
+	}
+	defer f.CloseFile()
+	access, ok := f.MaximalAccess()
+	if !ok {
+		return 0, fmt.Errorf("The server did not answer the MxAc create context")
+	}
+	return
+}
+
+// diagnoseAccessDenied explains why opening a file with desiredAccess was
+// denied
+func (s *Connection) diagnoseAccessDenied(share, path string, desiredAccess uint32) error {
+	e := &AccessDeniedError{Share: share, Path: path, DesiredAccess: desiredAccess}
+	access, err := s.MaximalAccess(share, path)
+	if err == nil {
+		e.GrantedAccess = access
+		e.GrantedKnown = true
+	} else {
+		log.Debugf("Failed to query the maximal access to %s: %v\n", path, err)
+	}
+
+	opts := s.createReqOpts()
+	opts.DesiredAccess = FAccMaskReadControl
+	opts.ShareAccess = FileShareRead | FileShareWrite | FileShareDelete
+	root, err := s.createFile(share, "", opts)
+	if err != nil {
+		log.Debugf("Failed to open the root of %s: %v\n", share, err)
+		return e
+	}
+	defer root.CloseFile()
+	if e.ShareSecurity, err = root.QueryInfoSecurity(root.transactSize()); err != nil {
+		log.Debugf("Failed to read the security descriptor of %s: %v\n", share, err)
+	}
+	return e
+}
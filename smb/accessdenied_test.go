@@ -0,0 +1,124 @@
+package smb
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+const testGrantedAccess = FAccMaskFileReadData | FAccMaskFileReadAttributes | FAccMaskReadControl | FAccMaskSynchronize
+
+// serveAccessDenied denies every CREATE except those asking for
+// MAXIMUM_ALLOWED, which are granted testGrantedAccess, and those asking for
+// READ_CONTROL on the root of the share when sdReadable is set
+func serveAccessDenied(server net.Conn, sdReadable bool) {
+	for {
+		buf, err := readTestFrame(server)
+		if err != nil {
+			return
+		}
+		var h Header
+		if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+			return
+		}
+		hdr := Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       h.Command,
+			Credits:       1,
+			Flags:         SMB2_FLAGS_SERVER_TO_REDIR,
+			MessageID:     h.MessageID,
+			Signature:     make([]byte, 16),
+		}
+		var res interface{}
+		switch h.Command {
+		case CommandCreate:
+			desired := binary.LittleEndian.Uint32(buf[88:])
+			nameLength := binary.LittleEndian.Uint16(buf[110:])
+			switch {
+			case desired == FAccMaskMaximumAllowed:
+				data := binary.LittleEndian.AppendUint32(nil, StatusOk)
+				data = binary.LittleEndian.AppendUint32(data, testGrantedAccess)
+				contexts := marshalCreateContexts([]CreateContext{{Name: CreateContextMaximalAccess, Data: data}})
+				res = &CreateRes{Header: hdr, StructureSize: 89, FileId: make([]byte, 16), Buffer: contexts}
+			case desired == FAccMaskReadControl && nameLength == 0 && sdReadable:
+				res = &CreateRes{Header: hdr, StructureSize: 89, FileId: make([]byte, 16)}
+			default:
+				hdr.Status = StatusAccessDenied
+				res = &CreateRes{Header: hdr, StructureSize: 9}
+			}
+		case CommandQueryInfo:
+			sd, _ := encoder.Marshal(&SecurityDescriptor{
+				Revision:    1,
+				Control:     SecurityDescriptorFlagSR,
+				OwnerSid:    &SID{Revision: 1, NumAuth: 2, Authority: []byte{0, 0, 0, 0, 0, 5}, SubAuthorities: []uint32{32, 544}},
+				OffsetGroup: 1,
+				GroupSid:    &SID{Revision: 1, NumAuth: 1, Authority: []byte{0, 0, 0, 0, 0, 5}, SubAuthorities: []uint32{18}},
+				Dacl: &PACL{AclRevision: 2, AclSize: 28, ACLS: []ACE{{
+					Header: ACEHeader{Type: AccessAllowedAceType, Size: 20},
+					Mask:   FAccMaskGenericRead,
+					Sid:    SID{Revision: 1, NumAuth: 1, Authority: []byte{0, 0, 0, 0, 0, 1}, SubAuthorities: []uint32{0}},
+				}}},
+			})
+			res = &QueryInfoRes{Header: hdr, StructureSize: 9, OutputBufferOffset: 72, OutputBufferLength: uint32(len(sd)), Buffer: sd}
+		case CommandClose:
+			res = &CloseRes{Header: hdr, StructureSize: 60}
+		}
+		if err = writeTestFrame(server, res); err != nil {
+			return
+		}
+	}
+}
+
+func TestAccessDeniedDiagnostics(t *testing.T) {
+	for _, sdReadable := range []bool{false, true} {
+		c, server := newTestConnection(t, Options{AccessDeniedDiagnostics: true})
+		c.credits.Store(100)
+		c.maxTransactSize = 65536
+		go serveAccessDenied(server, sdReadable)
+
+		opts := NewCreateReqOpts()
+		opts.DesiredAccess = FAccMaskFileReadData | FAccMaskFileWriteData
+		_, err := c.OpenFileExt("share", `dir\file.txt`, opts)
+		if !errors.Is(err, StatusMap[StatusAccessDenied]) {
+			t.Fatalf("Fail: %+v", err)
+		}
+		var e *AccessDeniedError
+		if !errors.As(err, &e) {
+			t.Fatalf("Fail: %+v", err)
+		}
+		if !e.GrantedKnown || e.GrantedAccess != testGrantedAccess || e.Path != `dir\file.txt` {
+			t.Fatalf("Fail: %+v", e)
+		}
+		if !strings.Contains(e.Error(), "missing FILE_WRITE_DATA") {
+			t.Fatalf("Fail: %s", e)
+		}
+		if sdReadable != (e.ShareSecurity != nil) {
+			t.Fatalf("Fail: %+v", e.ShareSecurity)
+		}
+		if sdReadable && (e.ShareSecurity.OwnerSID != "S-1-5-32-544" || !strings.Contains(e.Error(), "S-1-1-0 allowed")) {
+			t.Fatalf("Fail: %s", e)
+		}
+	}
+}
+
+func TestAccessDeniedWithoutDiagnostics(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.credits.Store(100)
+	go serveAccessDenied(server, true)
+	_, err := c.OpenFile("share", "file.txt")
+	if err != StatusMap[StatusAccessDenied] {
+		t.Fatalf("Fail: %+v", err)
+	}
+}
+
+func TestAccessMaskNames(t *testing.T) {
+	names := strings.Join(accessMaskNames(testGrantedAccess|0x200), "|")
+	if names != "FILE_READ_DATA|FILE_READ_ATTRIBUTES|0x200|READ_CONTROL|SYNCHRONIZE" {
+		t.Fatal(names)
+	}
+}
@@ -0,0 +1,247 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Shares created by Windows for remote administration
+const (
+	ShareAdmin = "ADMIN$" // Shares the SystemRoot directory
+	ShareIPC   = "IPC$"   // Holds the named pipes
+)
+
+// Directory shared as ADMIN$ on default Windows installations
+const DefaultSystemRoot = `C:\Windows`
+
+// DriveShare returns the administrative share of a drive, e.g., C$ for C
+func DriveShare(drive byte) (string, error) {
+	if drive >= 'a' && drive <= 'z' {
+		drive -= 'a' - 'A'
+	}
+	if drive < 'A' || drive > 'Z' {
+		return "", fmt.Errorf("Invalid drive letter %q", drive)
+	}
+	return string(drive) + "$", nil
+}
+
+// shareDrive returns the drive of an administrative drive share
+func shareDrive(share string) (drive byte, ok bool) {
+	if len(share) != 2 || share[1] != '$' {
+		return 0, false
+	}
+	s, err := DriveShare(share[0])
+	if err != nil {
+		return 0, false
+	}
+	return s[0], true
+}
+
+// cleanSharePath returns p relative to the root of a share, separated by
+// backslashes, with . and .. elements resolved. Paths escaping the root are
+// rejected.
+func cleanSharePath(p string) (string, error) {
+	var elems []string
+	for _, e := range strings.FieldsFunc(p, func(r rune) bool { return r == '\\' || r == '/' }) {
+		switch e {
+		case ".":
+		case "..":
+			if len(elems) == 0 {
+				return "", fmt.Errorf("Path %s escapes the root", p)
+			}
+			elems = elems[:len(elems)-1]
+		default:
+			elems = append(elems, e)
+		}
+	}
+	return strings.Join(elems, `\`), nil
+}
+
+// splitLocalPath splits a local path of a Windows server, e.g.,
+// C:\Windows\Temp\x or \\?\C:\Windows, into its drive and the path relative
+// to the root of the drive
+func splitLocalPath(local string) (drive byte, rel string, err error) {
+	local = strings.ReplaceAll(local, "/", `\`)
+	local = strings.TrimPrefix(local, `\\?\`)
+	if len(local) < 2 || local[1] != ':' || (len(local) > 2 && local[2] != '\\') {
+		return 0, "", fmt.Errorf("Invalid local path %s. Expecting an absolute path such as C:\\Windows", local)
+	}
+	share, err := DriveShare(local[0])
+	if err != nil {
+		return
+	}
+	if rel, err = cleanSharePath(local[2:]); err != nil {
+		return
+	}
+	return share[0], rel, nil
+}
+
+// hasPathPrefix reports whether rel is dir or below dir, ignoring case as
+// Windows does, and returns the remainder
+func hasPathPrefix(rel, dir string) (rest string, ok bool) {
+	if dir == "" {
+		return rel, true
+	}
+	if len(rel) < len(dir) || !strings.EqualFold(rel[:len(dir)], dir) {
+		return "", false
+	}
+	if len(rel) == len(dir) {
+		return "", true
+	}
+	if rel[len(dir)] != '\\' {
+		return "", false
+	}
+	return rel[len(dir)+1:], true
+}
+
+// PathMap translates the local paths of a Windows server to paths on its
+// administrative shares and back, such as C:\Windows\Temp\x to ADMIN$ and
+// Temp\x or to C$ and Windows\Temp\x
+type PathMap struct {
+	SystemRoot  string // Local path shared as ADMIN$. Defaults to DefaultSystemRoot
+	PreferAdmin bool   // Map paths below SystemRoot to ADMIN$ instead of the drive share
+}
+
+func (self PathMap) systemRoot() (drive byte, rel string, err error) {
+	root := self.SystemRoot
+	if root == "" {
+		root = DefaultSystemRoot
+	}
+	return splitLocalPath(root)
+}
+
+// ToShare returns the share holding the local path and the path relative
+// to the share
+func (self PathMap) ToShare(local string) (share, rel string, err error) {
+	drive, rel, err := splitLocalPath(local)
+	if err != nil {
+		return
+	}
+	if self.PreferAdmin {
+		rootDrive, root, err := self.systemRoot()
+		if err != nil {
+			return "", "", err
+		}
+		if rest, ok := hasPathPrefix(rel, root); ok && drive == rootDrive {
+			return ShareAdmin, rest, nil
+		}
+	}
+	share, _ = DriveShare(drive)
+	return
+}
+
+// ToLocal returns the local path of a path on ADMIN$ or on an
+// administrative drive share
+func (self PathMap) ToLocal(share, rel string) (local string, err error) {
+	if rel, err = cleanSharePath(rel); err != nil {
+		return
+	}
+	var drive byte
+	if strings.EqualFold(share, ShareAdmin) {
+		var root string
+		if drive, root, err = self.systemRoot(); err != nil {
+			return
+		}
+		rel = strings.TrimPrefix(root+`\`+rel, `\`)
+		rel = strings.TrimSuffix(rel, `\`)
+	} else if d, ok := shareDrive(share); ok {
+		drive = d
+	} else {
+		return "", fmt.Errorf("Share %s is not an administrative share with a known local path", share)
+	}
+	return string(drive) + `:\` + rel, nil
+}
+
+// ToUNC returns the UNC path of the local path on host, e.g.,
+// \\host\C$\Windows\Temp\x
+func (self PathMap) ToUNC(host, local string) (string, error) {
+	share, rel, err := self.ToShare(local)
+	if err != nil {
+		return "", err
+	}
+	return JoinUNC(host, share, rel), nil
+}
+
+// FromUNC returns the host and the local path of a UNC path on an
+// administrative share
+func (self PathMap) FromUNC(unc string) (host, local string, err error) {
+	host, share, rel, err := SplitUNC(unc)
+	if err != nil {
+		return
+	}
+	local, err = self.ToLocal(share, rel)
+	return
+}
+
+// SplitUNC splits a UNC path such as \\host\share\dir\file, or
+// //host/share/dir/file, into the host, the share and the path relative to
+// the share
+func SplitUNC(unc string) (host, share, rel string, err error) {
+	s := strings.ReplaceAll(unc, "/", `\`)
+	if strings.HasPrefix(s, `\\?\UNC\`) {
+		s = `\\` + s[len(`\\?\UNC\`):]
+	}
+	if !strings.HasPrefix(s, `\\`) {
+		return "", "", "", fmt.Errorf("Invalid UNC path %s. Expecting \\\\host\\share\\path", unc)
+	}
+	parts := strings.SplitN(s[2:], `\`, 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", fmt.Errorf("Invalid UNC path %s. Expecting \\\\host\\share\\path", unc)
+	}
+	host, share = parts[0], parts[1]
+	if len(parts) == 3 {
+		rel, err = cleanSharePath(parts[2])
+	}
+	return
+}
+
+// JoinUNC returns the UNC path of rel on the share of host
+func JoinUNC(host, share, rel string) string {
+	unc := `\\` + host + `\` + share
+	if rel = strings.Trim(strings.ReplaceAll(rel, "/", `\`), `\`); rel != "" {
+		unc += `\` + rel
+	}
+	return unc
+}
+
+// TreeConnectDrive connects to the administrative share of a drive, e.g.,
+// C$ for C, and returns the share
+func (s *Connection) TreeConnectDrive(drive byte) (share string, err error) {
+	if share, err = DriveShare(drive); err != nil {
+		return
+	}
+	err = s.TreeConnect(share)
+	return
+}
+
+// TreeConnectLocal connects to the administrative share holding a local
+// path of the server and returns the share and the path relative to it
+func (s *Connection) TreeConnectLocal(m PathMap, local string) (share, rel string, err error) {
+	if share, rel, err = m.ToShare(local); err != nil {
+		return
+	}
+	err = s.TreeConnect(share)
+	return
+}
@@ -0,0 +1,86 @@
+package smb
+
+import "testing"
+
+func TestPathMapToShare(t *testing.T) {
+	for _, test := range []struct {
+		m          PathMap
+		local      string
+		share, rel string
+	}{
+		{PathMap{}, `C:\Windows\Temp\x`, "C$", `Windows\Temp\x`},
+		{PathMap{}, `c:/Users/../Windows/`, "C$", "Windows"},
+		{PathMap{}, `D:\`, "D$", ""},
+		{PathMap{}, `\\?\E:\data`, "E$", "data"},
+		{PathMap{PreferAdmin: true}, `C:\Windows\Temp\x`, ShareAdmin, `Temp\x`},
+		{PathMap{PreferAdmin: true}, `C:\WINDOWS`, ShareAdmin, ""},
+		{PathMap{PreferAdmin: true}, `C:\WindowsApps\x`, "C$", `WindowsApps\x`},
+		{PathMap{PreferAdmin: true, SystemRoot: `D:\WinNT`}, `D:\winnt\system32`, ShareAdmin, "system32"},
+		{PathMap{PreferAdmin: true, SystemRoot: `D:\WinNT`}, `C:\WinNT\system32`, "C$", `WinNT\system32`},
+	} {
+		share, rel, err := test.m.ToShare(test.local)
+		if err != nil {
+			t.Fatalf("Fail: %s %+v", test.local, err)
+		}
+		if share != test.share || rel != test.rel {
+			t.Fatalf("Fail: %s mapped to %s %s", test.local, share, rel)
+		}
+	}
+	for _, local := range []string{`Windows\Temp`, `C:Windows`, `1:\x`, `C:\..\x`, ""} {
+		if _, _, err := (PathMap{}).ToShare(local); err == nil {
+			t.Fatalf("Fail: %s", local)
+		}
+	}
+}
+
+func TestPathMapToLocal(t *testing.T) {
+	for _, test := range []struct {
+		m          PathMap
+		share, rel string
+		local      string
+	}{
+		{PathMap{}, "C$", `Windows\Temp\x`, `C:\Windows\Temp\x`},
+		{PathMap{}, "d$", "", `D:\`},
+		{PathMap{}, ShareAdmin, `Temp/x`, `C:\Windows\Temp\x`},
+		{PathMap{}, "admin$", "", `C:\Windows`},
+		{PathMap{SystemRoot: `D:\`}, ShareAdmin, `Temp`, `D:\Temp`},
+	} {
+		local, err := test.m.ToLocal(test.share, test.rel)
+		if err != nil {
+			t.Fatalf("Fail: %+v", err)
+		}
+		if local != test.local {
+			t.Fatalf("Fail: %s %s mapped to %s", test.share, test.rel, local)
+		}
+	}
+	if _, err := (PathMap{}).ToLocal("share", "x"); err == nil {
+		t.Fatal("Fail")
+	}
+	if _, err := (PathMap{}).ToLocal("C$", `..\x`); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestUNC(t *testing.T) {
+	m := PathMap{PreferAdmin: true}
+	unc, err := m.ToUNC("host", `C:\Windows\Temp\x`)
+	if err != nil || unc != `\\host\ADMIN$\Temp\x` {
+		t.Fatalf("Fail: %s %+v", unc, err)
+	}
+	host, local, err := m.FromUNC(unc)
+	if err != nil || host != "host" || local != `C:\Windows\Temp\x` {
+		t.Fatalf("Fail: %s %s %+v", host, local, err)
+	}
+	host, share, rel, err := SplitUNC(`\\?\UNC\10.0.0.1\C$\dir\.\file`)
+	if err != nil || host != "10.0.0.1" || share != "C$" || rel != `dir\file` {
+		t.Fatalf("Fail: %s %s %s %+v", host, share, rel, err)
+	}
+	if JoinUNC("host", "share", "") != `\\host\share` || JoinUNC("host", "share", `/a/b/`) != `\\host\share\a\b` {
+		t.Fatal("Fail")
+	}
+	for _, unc := range []string{`host\share`, `\\host`, `\\\share`} {
+		if _, _, _, err = SplitUNC(unc); err == nil {
+			t.Fatalf("Fail: %s", unc)
+		}
+	}
+}
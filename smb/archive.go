@@ -0,0 +1,263 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// Format of the archive written by Archive
+type ArchiveFormat int
+
+const (
+	ArchiveTar ArchiveFormat = iota
+	ArchiveZip
+)
+
+// PAX records of tar entries holding what the tar header can't. The creation
+// time uses the record libarchive reads.
+const (
+	PAXCreationTime       = "LIBARCHIVE.creationtime"
+	PAXSecurityDescriptor = "SMB.securitydescriptor" // Base64 self-relative security descriptor
+)
+
+// Prefix of the comment of zip entries holding the base64 security
+// descriptor
+const ZipSecurityDescriptorComment = "SMB.securitydescriptor="
+
+// Size of the buffer for the security descriptor of an archived entry
+const archiveSecurityBufferSize = 65536
+
+// ArchiveOptions controls what Archive stores and how it reports progress
+type ArchiveOptions struct {
+	// Format of the archive, tar by default
+	Format ArchiveFormat
+	// Store the owner, group and DACL of each entry in the archive, as a PAX
+	// record for tar and as the comment of the entry for zip
+	SecurityDescriptors bool
+	// Called with the slash separated path relative to the archived directory
+	// of each entry. Entries for which it returns false are skipped,
+	// including the contents of directories. nil archives everything.
+	Filter func(rel string, file *SharedFile) bool
+	// Called after an entry has been written
+	Progress func(rel string, file *SharedFile)
+	// Called when an entry can't be listed or read. Returning nil skips the
+	// entry while an error aborts the archive. nil aborts on the first error.
+	// A file that fails after its header has been written always aborts.
+	OnError func(rel string, err error) error
+}
+
+// An archive being written entry by entry
+type archiveWriter interface {
+	writeEntry(rel string, file *SharedFile, sd []byte, content io.Reader) error
+	Close() error
+}
+
+type tarArchive struct {
+	*tar.Writer
+}
+
+func paxTime(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
+
+func (self *tarArchive) writeEntry(rel string, file *SharedFile, sd []byte, content io.Reader) error {
+	hdr := &tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       rel,
+		Size:       int64(file.Size),
+		Mode:       0644,
+		ModTime:    file.Modified(),
+		AccessTime: file.Accessed(),
+		ChangeTime: file.Changed(),
+		Format:     tar.FormatPAX,
+		PAXRecords: map[string]string{},
+	}
+	if file.IsDir {
+		hdr.Typeflag, hdr.Name, hdr.Size, hdr.Mode = tar.TypeDir, rel+"/", 0, 0755
+	}
+	if file.IsReadOnly {
+		hdr.Mode &^= 0222
+	}
+	if created := file.Created(); !created.IsZero() {
+		hdr.PAXRecords[PAXCreationTime] = paxTime(created)
+	}
+	if sd != nil {
+		hdr.PAXRecords[PAXSecurityDescriptor] = base64.StdEncoding.EncodeToString(sd)
+	}
+	if err := self.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if content == nil {
+		return nil
+	}
+	n, err := io.Copy(self.Writer, content)
+	if err == nil && n != hdr.Size {
+		err = fmt.Errorf("File %s changed size while archiving", rel)
+	}
+	return err
+}
+
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (self *zipArchive) writeEntry(rel string, file *SharedFile, sd []byte, content io.Reader) error {
+	hdr := &zip.FileHeader{
+		Name:     rel,
+		Method:   zip.Deflate,
+		Modified: file.Modified(),
+	}
+	mode := fs.FileMode(0644)
+	if file.IsDir {
+		hdr.Name, hdr.Method, mode = rel+"/", zip.Store, fs.ModeDir|0755
+	}
+	if file.IsReadOnly {
+		mode &^= 0222
+	}
+	hdr.SetMode(mode)
+	if sd != nil {
+		hdr.Comment = ZipSecurityDescriptorComment + base64.StdEncoding.EncodeToString(sd)
+	}
+	w, err := self.CreateHeader(hdr)
+	if err != nil || content == nil {
+		return err
+	}
+	_, err = io.Copy(w, content)
+	return err
+}
+
+// Archive walks the directory dir of a share and streams its files and
+// directories into a tar or zip archive written to w, keeping their
+// timestamps. Assumes a tree connect is already performed.
+func (s *Connection) Archive(w io.Writer, share, dir string, opts *ArchiveOptions) (err error) {
+	if opts == nil {
+		opts = &ArchiveOptions{}
+	}
+	dir = strings.Trim(strings.ReplaceAll(dir, `/`, `\`), `\`)
+
+	var aw archiveWriter
+	switch opts.Format {
+	case ArchiveTar:
+		aw = &tarArchive{tar.NewWriter(w)}
+	case ArchiveZip:
+		aw = &zipArchive{zip.NewWriter(w)}
+	default:
+		return fmt.Errorf("Unknown archive format %d", opts.Format)
+	}
+
+	fail := func(rel string, err error) error {
+		if opts.OnError == nil {
+			return err
+		}
+		return opts.OnError(rel, err)
+	}
+
+	var walk func(dir, rel string) error
+	walk = func(dir, rel string) error {
+		files, err := s.ListDirectory(share, dir, "*")
+		if err != nil {
+			return fail(rel, err)
+		}
+		for i := range files {
+			file := &files[i]
+			if file.Name == "." || file.Name == ".." || file.IsJunction {
+				continue
+			}
+			childRel := path.Join(rel, file.Name)
+			if opts.Filter != nil && !opts.Filter(childRel, file) {
+				continue
+			}
+			if err = s.archiveEntry(aw, share, childRel, file, opts); err != nil {
+				if err, ok := err.(archiveAbort); ok {
+					return err.error
+				}
+				if err = fail(childRel, err); err != nil {
+					return err
+				}
+				continue
+			}
+			if opts.Progress != nil {
+				opts.Progress(childRel, file)
+			}
+			if file.IsDir {
+				if err = walk(file.FullPath, childRel); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	err = walk(dir, "")
+	if e := aw.Close(); err == nil {
+		err = e
+	}
+	return
+}
+
+// An error after the header of an entry has been written, which leaves the
+// archive unusable
+type archiveAbort struct {
+	error
+}
+
+// archiveEntry writes a file or directory to the archive
+func (s *Connection) archiveEntry(aw archiveWriter, share, rel string, file *SharedFile, opts *ArchiveOptions) error {
+	var f *File
+	var err error
+	if !file.IsDir || opts.SecurityDescriptors {
+		createOpts := s.createReqOpts()
+		createOpts.ShareAccess = FileShareRead | FileShareWrite | FileShareDelete
+		if file.IsDir {
+			createOpts.DesiredAccess = FAccMaskFileReadAttributes | FAccMaskReadControl | FAccMaskSynchronize
+		}
+		if f, err = s.OpenFileExt(share, file.FullPath, createOpts); err != nil {
+			return err
+		}
+		defer f.CloseFile()
+	}
+
+	var sd []byte
+	if opts.SecurityDescriptors {
+		if sd, err = f.QuerySecurityDescriptor(archiveSecurityBufferSize); err != nil {
+			return err
+		}
+	}
+	var content io.Reader
+	if !file.IsDir {
+		content = f
+	}
+	if err = aw.writeEntry(rel, file, sd, content); err != nil {
+		return archiveAbort{err}
+	}
+	return nil
+}
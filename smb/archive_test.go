@@ -0,0 +1,90 @@
+package smb
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+func testArchiveFiles() (dir, file *SharedFile) {
+	created := msdtyp.TimeToFiletime(time.Date(2020, 1, 2, 3, 4, 5, 600, time.UTC))
+	modified := msdtyp.TimeToFiletime(time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC))
+	dir = &SharedFile{Name: "docs", IsDir: true, CreationTime: created, LastWriteTime: modified, LastAccessTime: modified, ChangeTime: modified}
+	file = &SharedFile{Name: "a.txt", Size: 5, IsReadOnly: true, CreationTime: created, LastWriteTime: modified, LastAccessTime: modified, ChangeTime: modified}
+	return
+}
+
+func TestTarArchive(t *testing.T) {
+	dir, file := testArchiveFiles()
+	sd := []byte{1, 0, 4, 0x80}
+	var buf bytes.Buffer
+	aw := &tarArchive{tar.NewWriter(&buf)}
+	if err := aw.writeEntry("docs", dir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.writeEntry("docs/a.txt", file, sd, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.writeEntry("docs/b.txt", file, nil, strings.NewReader("hi")); err == nil {
+		t.Fatal("Fail")
+	}
+
+	r := tar.NewReader(&buf)
+	hdr, err := r.Next()
+	if err != nil || hdr.Typeflag != tar.TypeDir || hdr.Name != "docs/" || !hdr.ModTime.Equal(dir.Modified()) {
+		t.Fatalf("Fail: %+v %v", hdr, err)
+	}
+	hdr, err = r.Next()
+	if err != nil || hdr.Name != "docs/a.txt" || hdr.Mode != 0444 || !hdr.ModTime.Equal(file.Modified()) || !hdr.AccessTime.Equal(file.Accessed()) {
+		t.Fatalf("Fail: %+v %v", hdr, err)
+	}
+	if hdr.PAXRecords[PAXCreationTime] != "1577934245.000000600" || hdr.PAXRecords[PAXSecurityDescriptor] != base64.StdEncoding.EncodeToString(sd) {
+		t.Fatalf("Fail: %+v", hdr.PAXRecords)
+	}
+	if data, err := io.ReadAll(r); err != nil || string(data) != "hello" {
+		t.Fatalf("Fail: %q %v", data, err)
+	}
+}
+
+func TestZipArchive(t *testing.T) {
+	dir, file := testArchiveFiles()
+	sd := []byte{1, 0, 4, 0x80}
+	var buf bytes.Buffer
+	aw := &zipArchive{zip.NewWriter(&buf)}
+	if err := aw.writeEntry("docs", dir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.writeEntry("docs/a.txt", file, sd, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil || len(r.File) != 2 {
+		t.Fatalf("Fail: %v", err)
+	}
+	if r.File[0].Name != "docs/" || !r.File[0].Mode().IsDir() {
+		t.Fatalf("Fail: %+v", r.File[0].FileHeader)
+	}
+	f := r.File[1]
+	if f.Name != "docs/a.txt" || f.Mode().Perm() != 0444 || !f.Modified.Equal(file.Modified()) || f.Comment != ZipSecurityDescriptorComment+base64.StdEncoding.EncodeToString(sd) {
+		t.Fatalf("Fail: %+v", f.FileHeader)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if data, err := io.ReadAll(rc); err != nil || string(data) != "hello" {
+		t.Fatalf("Fail: %q %v", data, err)
+	}
+}
@@ -0,0 +1,170 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ericblavier/go-smb/ntlmssp"
+)
+
+// Kinds of AuthFinding
+const (
+	FindingSigningNotRequired = "signing-not-required" // NTLM authentications can be relayed to the server
+	FindingNTLMFlagsStripped  = "ntlm-flags-stripped"  // The challenge lacks security flags of the client's NTLM negotiate
+	FindingEPAAbsent          = "epa-absent"           // The NTLM authentication is not bound to the server
+	FindingNTLMv1             = "ntlmv1-accepted"      // The server accepts NTLMv1 rather than NTLMv2
+)
+
+// AuthFinding is a security relevant observation of the negotiation and
+// authentication with a server, recorded when Options.AuthDiagnostics is set
+type AuthFinding struct {
+	ID      string // One of the Finding constants
+	Summary string
+	Details string
+	Flags   uint32 // NTLM negotiate flags that were stripped for FindingNTLMFlagsStripped
+}
+
+func (f AuthFinding) String() string {
+	return fmt.Sprintf("%s: %s", f.Summary, f.Details)
+}
+
+// NTLM negotiate flags that only a server or a man in the middle downgrading
+// the session security would refuse
+var ntlmSecurityFlags = []struct {
+	flag uint32
+	name string
+}{
+	{ntlmssp.FlgNegSign, "NTLMSSP_NEGOTIATE_SIGN"},
+	{ntlmssp.FlgNegSeal, "NTLMSSP_NEGOTIATE_SEAL"},
+	{ntlmssp.FlgNegAlwaysSign, "NTLMSSP_NEGOTIATE_ALWAYS_SIGN"},
+	{ntlmssp.FlgNeg128, "NTLMSSP_NEGOTIATE_128"},
+	{ntlmssp.FlgNegKeyExch, "NTLMSSP_NEGOTIATE_KEY_EXCH"},
+}
+
+// signingFinding returns the finding for the security mode of a negotiate
+// response, nil if the server requires signing
+func signingFinding(securityMode uint16) *AuthFinding {
+	if securityMode&SecurityModeSigningRequired != 0 {
+		return nil
+	}
+	details := "The server signs messages only if the client requires it, so authentications relayed to it are not detected"
+	if securityMode&SecurityModeSigningEnabled == 0 {
+		details = "The server does not support signing, so authentications relayed to it are not detected"
+	}
+	return &AuthFinding{ID: FindingSigningNotRequired, Summary: "Signing not required", Details: details}
+}
+
+// ntlmFindings compares the NTLM negotiate message of the client with the
+// challenge of the server
+func ntlmFindings(negotiate *ntlmssp.Negotiate, challenge *ntlmssp.Challenge) (findings []AuthFinding) {
+	var stripped uint32
+	var names []string
+	for _, f := range ntlmSecurityFlags {
+		if negotiate.NegotiateFlags&f.flag != 0 && challenge.NegotiateFlags&f.flag == 0 {
+			stripped |= f.flag
+			names = append(names, f.name)
+		}
+	}
+	if stripped != 0 {
+		findings = append(findings, AuthFinding{
+			ID:      FindingNTLMFlagsStripped,
+			Summary: "NTLM flags stripped",
+			Details: fmt.Sprintf("The challenge does not grant %s requested by the client", strings.Join(names, ", ")),
+			Flags:   stripped,
+		})
+	}
+
+	var v1 []string
+	if negotiate.NegotiateFlags&ntlmssp.FlgNegExtendedSessionSecurity != 0 && challenge.NegotiateFlags&ntlmssp.FlgNegExtendedSessionSecurity == 0 {
+		v1 = append(v1, "The challenge selects NTLMv1 session security as extended session security is not granted")
+	}
+	if challenge.NegotiateFlags&ntlmssp.FlgNegLmKey != 0 {
+		v1 = append(v1, "The challenge requests the LAN Manager session key")
+	}
+	if challenge.NegotiateFlags&ntlmssp.FlgNegTargetInfo == 0 || challenge.TargetInfo == nil {
+		v1 = append(v1, "The challenge has no target info, without which NTLMv2 responses can't be computed")
+	}
+	if v1 != nil {
+		findings = append(findings, AuthFinding{ID: FindingNTLMv1, Summary: "NTLMv1 accepted", Details: strings.Join(v1, ". ")})
+	}
+
+	var epa []string
+	timestamp := false
+	if challenge.TargetInfo != nil {
+		for _, av := range *challenge.TargetInfo {
+			if av.AvID == ntlmssp.MsvAvTimestamp {
+				timestamp = true
+			}
+		}
+	}
+	if !timestamp {
+		epa = append(epa, "The challenge has no timestamp so the server does not verify the MIC protecting the channel bindings and target name")
+	}
+	// Mirrors ntlmssp.Client, which sends a target name to newer builds only
+	if build := (challenge.Version >> 16) & 0xffff; build <= 6003 {
+		epa = append(epa, "The server is too old to validate the target name of the authentication")
+	}
+	if epa != nil {
+		findings = append(findings, AuthFinding{ID: FindingEPAAbsent, Summary: "Extended protection absent", Details: strings.Join(epa, ". ")})
+	}
+	return
+}
+
+// recordAuthFinding records a finding for AuthFindings and passes it to
+// Options.OnAuthFinding
+func (c *Connection) recordAuthFinding(f AuthFinding) {
+	log.Debugf("Authentication finding: %s\n", f)
+	c.authFindings = append(c.authFindings, f)
+	if c.options.OnAuthFinding != nil {
+		c.options.OnAuthFinding(f)
+	}
+}
+
+// diagnoseAuth records the findings of the first session setup round trip.
+// challenge is nil unless the server answered with an NTLM challenge.
+func (c *Connection) diagnoseAuth(req *SessionSetup1Req, challenge *ntlmssp.Challenge) {
+	if !c.options.AuthDiagnostics {
+		return
+	}
+	if f := signingFinding(c.securityMode); f != nil {
+		c.recordAuthFinding(*f)
+	}
+	if challenge == nil || req.SecurityBlob == nil {
+		return
+	}
+	negotiate := ntlmssp.Negotiate{}
+	if err := c.unmarshal(req.SecurityBlob.Data.MechToken, &negotiate); err != nil {
+		log.Debugf("Failed to decode the NTLM negotiate message: %s\n", err)
+		return
+	}
+	for _, f := range ntlmFindings(&negotiate, challenge) {
+		c.recordAuthFinding(f)
+	}
+}
+
+// AuthFindings returns the findings of the last session setup when
+// Options.AuthDiagnostics is set
+func (c *Connection) AuthFindings() []AuthFinding {
+	return c.authFindings
+}
@@ -0,0 +1,129 @@
+package smb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ericblavier/go-smb/gss"
+	"github.com/ericblavier/go-smb/ntlmssp"
+	"github.com/ericblavier/go-smb/smb/encoder"
+	"github.com/ericblavier/go-smb/spnego"
+	"github.com/jfjallid/gofork/encoding/asn1"
+)
+
+func TestNTLMFindings(t *testing.T) {
+	negotiate := &ntlmssp.Negotiate{NegotiateFlags: ntlmssp.FlgNegSign | ntlmssp.FlgNeg128 | ntlmssp.FlgNegKeyExch | ntlmssp.FlgNegExtendedSessionSecurity | ntlmssp.FlgNegTargetInfo}
+	challenge := ntlmssp.NewChallenge()
+	challenge.NegotiateFlags = negotiate.NegotiateFlags
+	// Windows 10.0 build 20348
+	challenge.Version = 10 | 20348<<16 | 15<<56
+	challenge.TargetInfo = &ntlmssp.AvPairSlice{
+		{AvID: ntlmssp.MsvAvTimestamp, Value: make([]byte, 8)},
+		{AvID: ntlmssp.MsvAvEOL},
+	}
+	if findings := ntlmFindings(negotiate, &challenge); len(findings) != 0 {
+		t.Fatalf("Fail: %+v", findings)
+	}
+
+	challenge.NegotiateFlags = ntlmssp.FlgNeg128 | ntlmssp.FlgNegLmKey | ntlmssp.FlgNegTargetInfo
+	challenge.Version = 6 | 1<<8 | 7601<<16
+	challenge.TargetInfo = &ntlmssp.AvPairSlice{{AvID: ntlmssp.MsvAvEOL}}
+	findings := ntlmFindings(negotiate, &challenge)
+	if len(findings) != 3 {
+		t.Fatalf("Fail: %+v", findings)
+	}
+	if findings[0].ID != FindingNTLMFlagsStripped || findings[0].Flags != ntlmssp.FlgNegSign|ntlmssp.FlgNegKeyExch {
+		t.Fatalf("Fail: %+v", findings[0])
+	}
+	if findings[1].ID != FindingNTLMv1 || findings[2].ID != FindingEPAAbsent {
+		t.Fatalf("Fail: %+v", findings)
+	}
+
+	if signingFinding(SecurityModeSigningEnabled|SecurityModeSigningRequired) != nil {
+		t.Fatal("Fail")
+	}
+	if f := signingFinding(SecurityModeSigningEnabled); f == nil || f.ID != FindingSigningNotRequired {
+		t.Fatal("Fail")
+	}
+}
+
+func TestAuthDiagnostics(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	neg := NewNegotiateRes()
+	neg.Header.ProtocolID = []byte(ProtocolSmb2)
+	neg.Header.StructureSize = 64
+	neg.Header.Command = CommandNegotiate
+	neg.Header.Signature = make([]byte, 16)
+	neg.StructureSize = 65
+	neg.SecurityMode = SecurityModeSigningEnabled
+	neg.DialectRevision = DialectSmb_2_1
+	neg.ServerGuid = make([]byte, 16)
+	neg.SecurityBlob = &gss.NegTokenInit{
+		OID:  gss.SpnegoOid,
+		Data: gss.NegTokenInitData{MechTypes: []asn1.ObjectIdentifier{gss.NtLmSSPMechTypeOid}},
+	}
+
+	// A challenge without signing, key exchange and timestamp
+	challenge := ntlmssp.NewChallenge()
+	challenge.Version = 10 | 20348<<16 | 15<<56
+	challenge.TargetInfo = &ntlmssp.AvPairSlice{
+		{AvID: ntlmssp.MsvAvNbComputerName, Value: encoder.ToUnicode("FS01")},
+		{AvID: ntlmssp.MsvAvEOL},
+	}
+	token, err := encoder.Marshal(&challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, err := NewSessionSetup1Res()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.Command = CommandSessionSetup
+	ss.Status = StatusMoreProcessingRequired
+	ss.MessageID = 1
+	ss.SecurityBlob.State = gss.GssStateAcceptIncomplete
+	ss.SecurityBlob.SupportedMech = gss.NtLmSSPMechTypeOid
+	ss.SecurityBlob.ResponseToken = token
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err = readTestFrame(conn); err != nil {
+			return
+		}
+		writeTestFrame(conn, &neg)
+		if _, err = readTestFrame(conn); err != nil {
+			return
+		}
+		writeTestFrame(conn, &ss)
+		// The authentication fails as the connection is closed
+		readTestFrame(conn)
+	}()
+
+	var found []AuthFinding
+	_, err = NewConnection(Options{
+		Host:            "127.0.0.1",
+		Port:            l.Addr().(*net.TCPAddr).Port,
+		DisableSMB1:     true,
+		Initiator:       &spnego.NTLMInitiator{User: "user", Password: "pass"},
+		AuthDiagnostics: true,
+		OnAuthFinding:   func(f AuthFinding) { found = append(found, f) },
+	})
+	if err == nil {
+		t.Fatal("Fail")
+	}
+	if len(found) != 3 || found[0].ID != FindingSigningNotRequired || found[1].ID != FindingNTLMFlagsStripped || found[2].ID != FindingEPAAbsent {
+		t.Fatalf("Fail: %+v", found)
+	}
+	if found[1].Flags != ntlmssp.FlgNegSign|ntlmssp.FlgNegKeyExch {
+		t.Fatalf("Fail: %+v", found[1])
+	}
+}
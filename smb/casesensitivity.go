@@ -0,0 +1,226 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// MS-FSCC Section 2.5.1 FileSystemAttributes of FILE_FS_ATTRIBUTE_INFORMATION
+const (
+	FileCaseSensitiveSearch uint32 = 0x00000001
+	FileCasePreservedNames  uint32 = 0x00000002
+)
+
+// MS-FSCC Section 2.4.8 FILE_CASE_SENSITIVE_INFORMATION Flags
+const FileCsFlagCaseSensitiveDir uint32 = 0x00000001
+
+// CaseSensitivity describes how a server compares the names in a directory
+type CaseSensitivity struct {
+	SensitiveSearch bool // The file system supports case sensitive names
+	PreservedNames  bool // The file system preserves the case of names
+	Directory       bool // Case sensitivity is enabled on the directory, e.g., with fsutil on NTFS
+	Sensitive       bool // Opening an entry by its name in another case failed
+}
+
+// SetInfo sends a SET_INFO request for the information class of the info
+// type with buf as its input, e.g., FileBasicInformation of OInfoFile
+func (f *File) SetInfo(infoType, infoClass byte, buf []byte) (err error) {
+	if f.fd == nil {
+		return fmt.Errorf("Can't operate on a closed file")
+	}
+	req, err := f.NewSetInfoReq(f.share, f.fd)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+	req.InfoType = infoType
+	req.FileInfoClass = infoClass
+	req.Buffer = buf
+	resBuf, err := f.sendrecv(req)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+	var h Header
+	if err = f.unmarshal(resBuf, &h); err != nil {
+		log.Debugln(err)
+		return
+	}
+	if h.Status != StatusOk {
+		status, found := StatusMap[f.queryInfoStatus(h.Status)]
+		if !found {
+			err = fmt.Errorf("Received unknown SMB Header status for SetInfo response: 0x%x\n", h.Status)
+			log.Errorln(err)
+			return
+		}
+		log.Debugf("Failed SetInfo with NT Status Error: %v\n", status)
+		return status
+	}
+	return
+}
+
+// FileSystemAttributes returns the attributes of the file system holding
+// the file, e.g., FileCaseSensitiveSearch
+func (f *File) FileSystemAttributes() (attributes uint32, err error) {
+	buf, err := f.QueryInfo(OInfoFilesystem, FileFsAttributeInformation, 1024)
+	if err != nil {
+		return
+	}
+	if len(buf) < 4 {
+		return 0, fmt.Errorf("Buffer too small for FILE_FS_ATTRIBUTE_INFORMATION")
+	}
+	return binary.LittleEndian.Uint32(buf), nil
+}
+
+// CaseSensitive reports whether case sensitivity is enabled on the
+// directory. Only NTFS supports it, other file systems fail with the
+// StatusInvalidInfoClass error of StatusMap.
+func (f *File) CaseSensitive() (bool, error) {
+	buf, err := f.QueryInfo(OInfoFile, FileCaseSensitiveInformation, 4)
+	if err != nil {
+		return false, err
+	}
+	if len(buf) < 4 {
+		return false, fmt.Errorf("Buffer too small for FILE_CASE_SENSITIVE_INFORMATION")
+	}
+	return binary.LittleEndian.Uint32(buf)&FileCsFlagCaseSensitiveDir != 0, nil
+}
+
+// SetCaseSensitive enables or disables case sensitivity on the directory.
+// The directory must be empty and opened with FAccMaskFileWriteAttributes.
+func (f *File) SetCaseSensitive(enabled bool) error {
+	var flags uint32
+	if enabled {
+		flags = FileCsFlagCaseSensitiveDir
+	}
+	return f.SetInfo(OInfoFile, FileCaseSensitiveInformation, binary.LittleEndian.AppendUint32(nil, flags))
+}
+
+// swapCase returns name with the case of its letters inverted
+func swapCase(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, name)
+}
+
+// joinPath joins a directory of a share and a name
+func joinPath(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	return dir + `\` + name
+}
+
+// ProbeCaseSensitivity determines whether the server compares the names in
+// a directory of a share case sensitively, as Samba does by default for
+// some configurations and NTFS for directories with case sensitivity
+// enabled. An entry of the directory is opened by its name in another case.
+// If the directory has no such entry, a temporary file is created for the
+// probe, which requires write access.
+func (s *Connection) ProbeCaseSensitivity(share, dir string) (cs CaseSensitivity, err error) {
+	dir = strings.Trim(strings.ReplaceAll(dir, `/`, `\`), `\`)
+	opts := s.createReqOpts()
+	opts.DesiredAccess = FAccMaskFileReadAttributes | FAccMaskSynchronize
+	opts.ShareAccess = FileShareRead | FileShareWrite | FileShareDelete
+	opts.CreateOpts = FileDirectoryFile
+	d, err := s.OpenFileExt(share, dir, opts)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+	defer d.CloseFile()
+	attributes, err := d.FileSystemAttributes()
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+	cs.SensitiveSearch = attributes&FileCaseSensitiveSearch != 0
+	cs.PreservedNames = attributes&FileCasePreservedNames != 0
+	if cs.Directory, err = d.CaseSensitive(); err != nil {
+		if !isUnsupportedInfoClass(err) && err != StatusMap[StatusAccessDenied] {
+			return
+		}
+		err = nil
+	}
+
+	files, err := s.ListDirectory(share, dir, "*")
+	if err != nil {
+		return
+	}
+	var name string
+	for _, file := range files {
+		if file.Name != "." && file.Name != ".." && swapCase(file.Name) != file.Name {
+			name = file.Name
+			break
+		}
+	}
+	if name == "" {
+		// Closing the temporary file deletes it
+		random := make([]byte, 8)
+		if _, err = rand.Read(random); err != nil {
+			return
+		}
+		name = fmt.Sprintf("case-probe-%x.tmp", random)
+		opts := s.createReqOpts()
+		opts.DesiredAccess = FAccMaskDelete | FAccMaskFileReadAttributes | FAccMaskSynchronize
+		opts.ShareAccess = FileShareRead | FileShareWrite | FileShareDelete
+		opts.CreateDisp = FileCreate
+		opts.CreateOpts = FileNonDirectoryFile | FileDeleteOnClose
+		f, err := s.OpenFileExt(share, joinPath(dir, name), opts)
+		if err != nil {
+			return cs, fmt.Errorf("Failed to create a file to probe case sensitivity: %w", err)
+		}
+		defer f.CloseFile()
+	}
+
+	opts = s.createReqOpts()
+	opts.DesiredAccess = FAccMaskFileReadAttributes | FAccMaskSynchronize
+	opts.ShareAccess = FileShareRead | FileShareWrite | FileShareDelete
+	f, err := s.OpenFileExt(share, joinPath(dir, swapCase(name)), opts)
+	if f != nil {
+		f.CloseFile()
+	}
+	switch err {
+	case nil:
+	case StatusMap[StatusObjectNameNotFound]:
+		cs.Sensitive = true
+		err = nil
+	default:
+		// Any other failure means that the name was found, e.g., a sharing
+		// violation or denied access
+		if !isStatus(err) {
+			return
+		}
+		log.Debugf("Probing %s: %s\n", swapCase(name), err)
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,125 @@
+package smb
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// serveCaseProbe answers the requests of ProbeCaseSensitivity for a
+// directory holding "ReadMe.txt". A sensitive server only opens the file by
+// its exact name. The flags of each SET_INFO are sent on setInfo.
+func serveCaseProbe(server net.Conn, sensitive bool, setInfo chan<- uint32) {
+	listed := false
+	for {
+		buf, err := readTestFrame(server)
+		if err != nil {
+			return
+		}
+		var h Header
+		if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+			return
+		}
+		hdr := Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       h.Command,
+			Credits:       1,
+			Flags:         SMB2_FLAGS_SERVER_TO_REDIR,
+			MessageID:     h.MessageID,
+			Signature:     make([]byte, 16),
+		}
+		var res interface{}
+		switch h.Command {
+		case CommandCreate:
+			offset := binary.LittleEndian.Uint16(buf[108:])
+			length := binary.LittleEndian.Uint16(buf[110:])
+			name, _ := encoder.FromUnicodeString(buf[offset : offset+length])
+			if sensitive && name == `dir\rEADmE.TXT` {
+				hdr.Status = StatusObjectNameNotFound
+				res = &CreateRes{Header: hdr, StructureSize: 9}
+				break
+			}
+			res = &CreateRes{Header: hdr, StructureSize: 89, FileId: make([]byte, 16)}
+		case CommandQueryInfo:
+			var attributes uint32 = FileCasePreservedNames
+			if sensitive {
+				attributes |= FileCaseSensitiveSearch
+			}
+			out := binary.LittleEndian.AppendUint32(nil, attributes)
+			if buf[67] == FileCaseSensitiveInformation {
+				if !sensitive {
+					hdr.Status = StatusInvalidInfoClass
+					res = &QueryInfoRes{Header: hdr, StructureSize: 9, Buffer: []byte{0}}
+					break
+				}
+				out = binary.LittleEndian.AppendUint32(nil, FileCsFlagCaseSensitiveDir)
+			}
+			res = &QueryInfoRes{Header: hdr, StructureSize: 9, OutputBufferOffset: 72, OutputBufferLength: uint32(len(out)), Buffer: out}
+		case CommandSetInfo:
+			var req SetInfoReq
+			if err = encoder.Unmarshal(buf, &req); err != nil {
+				return
+			}
+			setInfo <- binary.LittleEndian.Uint32(req.Buffer)
+			res = &SetInfoRes{Header: hdr, StructureSize: 2}
+		case CommandQueryDirectory:
+			if listed {
+				hdr.Status = StatusNoMoreFiles
+				res = &QueryDirectoryRes{Header: hdr, StructureSize: 9, Buffer: []byte{0}}
+				break
+			}
+			listed = true
+			entry, _ := encoder.Marshal(FileBothDirectoryInformationStruct{
+				ShortName: make([]byte, 24),
+				FileName:  encoder.ToUnicode("ReadMe.txt"),
+			})
+			res = &QueryDirectoryRes{Header: hdr, StructureSize: 9, Buffer: entry}
+		case CommandClose:
+			res = &CloseRes{Header: hdr, StructureSize: 60}
+		}
+		if err = writeTestFrame(server, res); err != nil {
+			return
+		}
+	}
+}
+
+func TestProbeCaseSensitivity(t *testing.T) {
+	for _, sensitive := range []bool{false, true} {
+		c, server := newTestConnection(t, Options{})
+		c.credits.Store(100)
+		c.maxTransactSize = 65536
+		go serveCaseProbe(server, sensitive, nil)
+		cs, err := c.ProbeCaseSensitivity("share", "/dir/")
+		if err != nil {
+			t.Fatalf("Fail: %+v", err)
+		}
+		want := CaseSensitivity{SensitiveSearch: sensitive, PreservedNames: true, Directory: sensitive, Sensitive: sensitive}
+		if cs != want {
+			t.Fatalf("Fail: %+v", cs)
+		}
+	}
+}
+
+func TestSetCaseSensitive(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.credits.Store(100)
+	setInfo := make(chan uint32, 1)
+	go serveCaseProbe(server, true, setInfo)
+	f, err := c.OpenFile("share", "dir")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer f.CloseFile()
+	if enabled, err := f.CaseSensitive(); err != nil || !enabled {
+		t.Fatalf("Fail: %v %+v", enabled, err)
+	}
+	if err = f.SetCaseSensitive(true); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if flags := <-setInfo; flags != FileCsFlagCaseSensitiveDir {
+		t.Fatalf("Fail: %x", flags)
+	}
+}
@@ -0,0 +1,94 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+// Statuses of requests rejected by the replay detection of the server
+const (
+	StatusFileNotAvailable  uint32 = 0xc0000467 // Stale ChannelSequence or a replayed CREATE still in progress
+	StatusDuplicateObjectId uint32 = 0xc000022a // The CreateGuid of a replayed CREATE is in use by another open
+)
+
+// IsReplayRejected reports whether err is a status returned by a server
+// that rejected a request or a replay of it, e.g., because its
+// ChannelSequence is older than the one of a request already received on
+// another channel. Unlike other failures the outcome of the original
+// request is still unknown.
+func IsReplayRejected(err error) bool {
+	return err == StatusMap[StatusFileNotAvailable] || err == StatusMap[StatusDuplicateObjectId]
+}
+
+// replayable reports whether a command may be sent again with
+// SMB2_FLAGS_REPLAY_OPERATIONS
+func replayable(command uint16) bool {
+	switch command {
+	case CommandCreate, CommandWrite, CommandSetInfo, CommandIOCtl, CommandLock:
+		return true
+	}
+	return false
+}
+
+// ChannelSequence returns the ChannelSequence sent in the header of SMB 3.x
+// requests. Servers compare it to the one of the open to tell outdated
+// requests from replays.
+func (s *Session) ChannelSequence() uint16 {
+	return uint16(s.channelSequence.Load())
+}
+
+// SetChannelSequence sets the ChannelSequence, e.g., to continue with the
+// value of the connection replaced by a reconnect
+func (s *Session) SetChannelSequence(seq uint16) {
+	s.channelSequence.Store(uint32(seq))
+}
+
+// BeginReplay prepares resending requests whose outcome is unknown after the
+// failure of the connection they were sent on, e.g., WRITEs to a persistent
+// handle reopened on a new connection. The ChannelSequence is incremented
+// once such that the server accepts the replays in place of the originals
+// and the replayable requests sent until EndReplay are flagged with
+// SMB2_FLAGS_REPLAY_OPERATIONS. It has no effect before SMB 3.0.
+func (c *Connection) BeginReplay() {
+	if c.dialect < DialectSmb_3_0 || c.replaying.Swap(true) {
+		return
+	}
+	seq := uint16(c.channelSequence.Add(1))
+	log.Debugf("Replaying requests with ChannelSequence %d\n", seq)
+}
+
+// EndReplay stops flagging requests as replays
+func (c *Connection) EndReplay() {
+	c.replaying.Store(false)
+}
+
+// setChannelSequence sets the ChannelSequence and replay flag of an SMB 3.x
+// request header
+func (c *Connection) setChannelSequence(h *Header) {
+	if c.dialect < DialectSmb_3_0 {
+		return
+	}
+	// The Status field of requests holds the ChannelSequence followed by
+	// two reserved bytes
+	h.Status = uint32(c.ChannelSequence())
+	if c.replaying.Load() && replayable(h.Command) {
+		h.Flags |= SMB2_FLAGS_REPLAY_OPERATIONS
+	}
+}
@@ -0,0 +1,94 @@
+package smb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// serveChannelSequence answers CREATE and CLOSE requests and sends their
+// headers on headers. A CREATE with a ChannelSequence below minSequence is
+// rejected like a server that received a newer request on another channel.
+func serveChannelSequence(server net.Conn, minSequence uint16, headers chan<- Header) {
+	for {
+		buf, err := readTestFrame(server)
+		if err != nil {
+			return
+		}
+		var h Header
+		if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+			return
+		}
+		headers <- h
+		hdr := Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       h.Command,
+			Credits:       1,
+			Flags:         SMB2_FLAGS_SERVER_TO_REDIR,
+			MessageID:     h.MessageID,
+			Signature:     make([]byte, 16),
+		}
+		var res interface{}
+		switch h.Command {
+		case CommandCreate:
+			if uint16(h.Status) < minSequence {
+				hdr.Status = StatusFileNotAvailable
+				res = &CreateRes{Header: hdr, StructureSize: 9}
+				break
+			}
+			res = &CreateRes{Header: hdr, StructureSize: 89, FileId: make([]byte, 16)}
+		case CommandClose:
+			res = &CloseRes{Header: hdr, StructureSize: 60}
+		}
+		if err = writeTestFrame(server, res); err != nil {
+			return
+		}
+	}
+}
+
+func TestChannelSequence(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.credits.Store(100)
+	c.dialect = DialectSmb_3_1_1
+	headers := make(chan Header, 10)
+	go serveChannelSequence(server, 1, headers)
+
+	// The original request is rejected once a newer one has been seen
+	if _, err := c.OpenFile("share", "file.txt"); !IsReplayRejected(err) {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if h := <-headers; h.Status != 0 || h.Flags&SMB2_FLAGS_REPLAY_OPERATIONS != 0 {
+		t.Fatalf("Fail: %+v", h)
+	}
+
+	// Replays carry the incremented ChannelSequence and the replay flag,
+	// except for commands that are never replayed
+	c.BeginReplay()
+	c.BeginReplay()
+	f, err := c.OpenFile("share", "file.txt")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if h := <-headers; h.Status != 1 || h.Flags&SMB2_FLAGS_REPLAY_OPERATIONS == 0 {
+		t.Fatalf("Fail: %+v", h)
+	}
+	f.CloseFile()
+	if h := <-headers; h.Command != CommandClose || h.Status != 1 || h.Flags&SMB2_FLAGS_REPLAY_OPERATIONS != 0 {
+		t.Fatalf("Fail: %+v", h)
+	}
+
+	c.EndReplay()
+	if f, err = c.OpenFile("share", "file.txt"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if h := <-headers; h.Status != 1 || h.Flags&SMB2_FLAGS_REPLAY_OPERATIONS != 0 {
+		t.Fatalf("Fail: %+v", h)
+	}
+	f.CloseFile()
+	<-headers
+	if c.ChannelSequence() != 1 {
+		t.Fatalf("Fail: %d", c.ChannelSequence())
+	}
+}
@@ -0,0 +1,217 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+const (
+	SMB1CommandTransaction      byte = 0x25
+	SMB1CommandSessionSetupAndX byte = 0x73
+	SMB1CommandTreeConnectAndX  byte = 0x75
+
+	// STATUS_INSUFF_SERVER_RESOURCES returned for a PeekNamedPipe on FID 0 by
+	// servers missing the MS17-010 update
+	StatusInsuffServerResources uint32 = 0xc0000205
+
+	// NT status codes and long names, but neither unicode nor extended security
+	smb1CheckFlags2 uint16 = 0x4001
+)
+
+// MS17010Result is the outcome of CheckMS17010
+type MS17010Result struct {
+	SMB1Enabled bool
+	Vulnerable  bool
+	Status      uint32 // Status of the PeekNamedPipe request
+}
+
+// smb1Exchange sends a SMB1 request and returns the response after checking
+// that it is a SMB1 response to the same command
+func smb1Exchange(conn net.Conn, header SMB1Header, words, data []byte) (res []byte, err error) {
+	hBuf, err := encoder.Marshal(header)
+	if err != nil {
+		return
+	}
+	var w bytes.Buffer
+	binary.Write(&w, binary.BigEndian, uint32(len(hBuf)+3+len(words)+len(data)))
+	w.Write(hBuf)
+	w.WriteByte(byte(len(words) / 2))
+	w.Write(words)
+	binary.Write(&w, binary.LittleEndian, uint16(len(data)))
+	w.Write(data)
+	if _, err = w.WriteTo(conn); err != nil {
+		return
+	}
+	res, err = readPacket(conn)
+	if err != nil {
+		return
+	}
+	if len(res) < 35 || string(res[:4]) != ProtocolSmb || res[4] != header.Command {
+		return nil, fmt.Errorf("Invalid SMB1 response to command 0x%x", header.Command)
+	}
+	return
+}
+
+// CheckMS17010 tests whether host is missing the MS17-010 update without
+// exploiting it. An anonymous SMB1 session is connected to IPC$ and a
+// PeekNamedPipe transaction is sent for FID 0, which unpatched servers answer
+// with STATUS_INSUFF_SERVER_RESOURCES instead of an access or handle error.
+// Servers that don't accept SMB1 are reported as not vulnerable. The Dialects
+// of opts are ignored.
+func CheckMS17010(host string, opts ProbeOptions) (res *MS17010Result, err error) {
+	conn, _, err := dialProbe(host, &opts)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	res = &MS17010Result{}
+
+	s := &Session{}
+	req, err := s.NewSMB1NegotiateReq()
+	if err != nil {
+		return nil, err
+	}
+	header := req.Header
+	header.Flags2 = smb1CheckFlags2
+	var dialect bytes.Buffer
+	dialect.WriteByte(0x2)
+	dialect.WriteString("NT LM 0.12\x00")
+	packet, err := smb1Exchange(conn, header, nil, dialect.Bytes())
+	if err != nil {
+		// The connection is dropped by servers that don't speak SMB1
+		log.Debugln(err)
+		return res, nil
+	}
+	defer encoder.PutBuffer(packet)
+	var negRes SMB1NegotiateRes
+	if err = negRes.UnmarshalBinary(packet, nil); err != nil {
+		return nil, err
+	}
+	if negRes.Header.Status != StatusOk || negRes.DialectIndex != 0 {
+		return res, nil
+	}
+	res.SMB1Enabled = true
+
+	if err = smb1AnonymousSessionSetup(conn, &header, negRes.SessionKey); err != nil {
+		return nil, err
+	}
+	if err = smb1TreeConnect(conn, &header, host, "IPC$"); err != nil {
+		return nil, err
+	}
+
+	// SMB_COM_TRANSACTION with a TRANS_PEEK_NMPIPE on FID 0
+	name := "\\PIPE\\\x00"
+	offset := uint16(32 + 1 + 32 + 2 + len(name))
+	var words, data bytes.Buffer
+	binary.Write(&words, binary.LittleEndian, uint16(0))      // TotalParameterCount
+	binary.Write(&words, binary.LittleEndian, uint16(0))      // TotalDataCount
+	binary.Write(&words, binary.LittleEndian, uint16(0xffff)) // MaxParameterCount
+	binary.Write(&words, binary.LittleEndian, uint16(0xffff)) // MaxDataCount
+	words.Write([]byte{0, 0})                                 // MaxSetupCount and Reserved1
+	binary.Write(&words, binary.LittleEndian, uint16(0))      // Flags
+	binary.Write(&words, binary.LittleEndian, uint32(0))      // Timeout
+	binary.Write(&words, binary.LittleEndian, uint16(0))      // Reserved2
+	binary.Write(&words, binary.LittleEndian, uint16(0))      // ParameterCount
+	binary.Write(&words, binary.LittleEndian, offset)         // ParameterOffset
+	binary.Write(&words, binary.LittleEndian, uint16(0))      // DataCount
+	binary.Write(&words, binary.LittleEndian, offset)         // DataOffset
+	words.Write([]byte{2, 0})                                 // SetupCount and Reserved3
+	binary.Write(&words, binary.LittleEndian, uint16(0x23))   // TRANS_PEEK_NMPIPE
+	binary.Write(&words, binary.LittleEndian, uint16(0))      // FID
+	data.WriteString(name)
+	header.Command = SMB1CommandTransaction
+	transRes, err := smb1Exchange(conn, header, words.Bytes(), data.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer encoder.PutBuffer(transRes)
+	res.Status = binary.LittleEndian.Uint32(transRes[5:9])
+	res.Vulnerable = res.Status == StatusInsuffServerResources
+	return
+}
+
+// smb1AnonymousSessionSetup sets up an anonymous session with a
+// SMB_COM_SESSION_SETUP_ANDX without extended security and sets the UID of
+// header
+func smb1AnonymousSessionSetup(conn net.Conn, header *SMB1Header, sessionKey uint32) error {
+	var words, data bytes.Buffer
+	words.Write([]byte{0xff, 0, 0, 0})                      // No AndX command
+	binary.Write(&words, binary.LittleEndian, uint16(4356)) // MaxBufferSize
+	binary.Write(&words, binary.LittleEndian, uint16(10))   // MaxMpxCount
+	binary.Write(&words, binary.LittleEndian, uint16(0))    // VcNumber
+	binary.Write(&words, binary.LittleEndian, sessionKey)
+	binary.Write(&words, binary.LittleEndian, uint16(0))          // OEMPasswordLen
+	binary.Write(&words, binary.LittleEndian, uint16(0))          // UnicodePasswordLen
+	binary.Write(&words, binary.LittleEndian, uint32(0))          // Reserved
+	binary.Write(&words, binary.LittleEndian, uint32(0x00000040)) // CAP_NT_STATUS
+	data.WriteString("\x00\x00go-smb\x00go-smb\x00")              // Account, domain, native OS and LAN manager
+	header.Command = SMB1CommandSessionSetupAndX
+	setupRes, err := smb1Exchange(conn, *header, words.Bytes(), data.Bytes())
+	if err != nil {
+		return err
+	}
+	defer encoder.PutBuffer(setupRes)
+	if err = smb1Status(setupRes, "Anonymous session setup"); err != nil {
+		return err
+	}
+	header.UID = binary.LittleEndian.Uint16(setupRes[28:30])
+	return nil
+}
+
+// smb1TreeConnect connects to a share with a SMB_COM_TREE_CONNECT_ANDX
+// without Unicode strings and sets the TID of header
+func smb1TreeConnect(conn net.Conn, header *SMB1Header, host, share string) error {
+	var words, data bytes.Buffer
+	words.Write([]byte{0xff, 0, 0, 0})
+	binary.Write(&words, binary.LittleEndian, uint16(0)) // Flags
+	binary.Write(&words, binary.LittleEndian, uint16(1)) // PasswordLength
+	data.WriteString("\x00\\\\" + host + "\\" + share + "\x00?????\x00")
+	header.Command = SMB1CommandTreeConnectAndX
+	treeRes, err := smb1Exchange(conn, *header, words.Bytes(), data.Bytes())
+	if err != nil {
+		return err
+	}
+	defer encoder.PutBuffer(treeRes)
+	if err = smb1Status(treeRes, "Tree connect to "+share); err != nil {
+		return err
+	}
+	header.TID = binary.LittleEndian.Uint16(treeRes[24:26])
+	return nil
+}
+
+// smb1Status returns an error if the status of a SMB1 response is not OK
+func smb1Status(packet []byte, operation string) error {
+	status := binary.LittleEndian.Uint32(packet[5:9])
+	if status == StatusOk {
+		return nil
+	}
+	if err, found := StatusMap[status]; found {
+		return fmt.Errorf("%s failed: %s", operation, err)
+	}
+	return fmt.Errorf("%s failed with status 0x%x", operation, status)
+}
@@ -0,0 +1,79 @@
+package smb
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// smb1TestResponse builds a SMB1 response with the given status and words
+func smb1TestResponse(command byte, status uint32, words int) []byte {
+	res := make([]byte, 32+1+2*words+2)
+	copy(res, ProtocolSmb)
+	res[4] = command
+	binary.LittleEndian.PutUint32(res[5:9], status)
+	binary.LittleEndian.PutUint16(res[24:26], 7) // TID
+	binary.LittleEndian.PutUint16(res[28:30], 9) // UID
+	res[32] = byte(words)
+	return res
+}
+
+func TestCheckMS17010(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	serve := func(peekStatus uint32, fail chan<- string) {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for _, command := range []byte{SMB1CommandNegotiate, SMB1CommandSessionSetupAndX, SMB1CommandTreeConnectAndX, SMB1CommandTransaction} {
+			req, err := readTestFrame(conn)
+			if err != nil || len(req) < 35 || req[4] != command {
+				fail <- "unexpected request"
+				return
+			}
+			status, words := uint32(StatusOk), 3
+			switch command {
+			case SMB1CommandNegotiate:
+				words = 17
+			case SMB1CommandTreeConnectAndX:
+				if binary.LittleEndian.Uint16(req[28:30]) != 9 {
+					fail <- "UID not set"
+					return
+				}
+			case SMB1CommandTransaction:
+				if binary.LittleEndian.Uint16(req[24:26]) != 7 || req[32] != 16 {
+					fail <- "invalid transaction"
+					return
+				}
+				status, words = peekStatus, 0
+			}
+			res := smb1TestResponse(command, status, words)
+			conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(res))), res...))
+		}
+		fail <- ""
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	opts := ProbeOptions{Port: port, Timeout: 5 * time.Second}
+
+	for status, vulnerable := range map[uint32]bool{StatusInsuffServerResources: true, StatusAccessDenied: false} {
+		fail := make(chan string, 1)
+		go serve(status, fail)
+		res, err := CheckMS17010("127.0.0.1", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg := <-fail; msg != "" {
+			t.Fatal(msg)
+		}
+		if !res.SMB1Enabled || res.Vulnerable != vulnerable || res.Status != status {
+			t.Fatalf("Fail: %+v", res)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import "time"
+
+// Largest difference between the clocks of a client and a KDC accepted by
+// Kerberos with the default configuration of Active Directory
+const MaxKerberosClockSkew = 5 * time.Minute
+
+// clockSkew returns serverTime minus local rounded to the second, or false
+// when the server did not send its time
+func clockSkew(serverTime, local time.Time) (time.Duration, bool) {
+	if serverTime.IsZero() {
+		return 0, false
+	}
+	return serverTime.Sub(local).Round(time.Second), true
+}
+
+// recordServerTime records the time sent by the server in the negotiate
+// response with the local time it was received at
+func (c *Connection) recordServerTime(serverTime time.Time) {
+	c.serverTime = serverTime
+	c.negotiatedAt = time.Now()
+	if skew, ok := c.ClockSkew(); ok {
+		log.Debugf("Clock skew with the server: %v\n", skew)
+	}
+}
+
+// ServerTime returns the time of the server when it sent the negotiate
+// response. It is zero when the server did not send its time.
+func (c *Connection) ServerTime() time.Time {
+	return c.serverTime
+}
+
+// ClockSkew returns the time of the server minus the local time, measured
+// when the negotiate response was received. ok is false when the server did
+// not send its time. Kerberos authentication fails when the skew with the
+// KDC, usually in sync with the server, exceeds MaxKerberosClockSkew.
+func (c *Connection) ClockSkew() (skew time.Duration, ok bool) {
+	return clockSkew(c.serverTime, c.negotiatedAt)
+}
@@ -0,0 +1,27 @@
+package smb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockSkew(t *testing.T) {
+	c := &Connection{Session: &Session{}}
+	if _, ok := c.ClockSkew(); ok {
+		t.Fatal("Fail")
+	}
+	c.recordServerTime(time.Time{})
+	if _, ok := c.ClockSkew(); ok || !c.ServerTime().IsZero() {
+		t.Fatal("Fail")
+	}
+
+	serverTime := time.Now().Add(-7 * time.Minute)
+	c.recordServerTime(serverTime)
+	skew, ok := c.ClockSkew()
+	if !ok || skew != -7*time.Minute || !c.ServerTime().Equal(serverTime) {
+		t.Fatalf("Fail: %v %v", skew, ok)
+	}
+	if skew.Abs() <= MaxKerberosClockSkew {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,169 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	"github.com/ericblavier/go-smb/smb/compression"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+const (
+	defaultCompressionThreshold = 4096
+	// Samples with a higher entropy in bits per byte are assumed to be
+	// compressed or encrypted already
+	compressionEntropyLimit = 7.0
+	compressionSampleSize   = 4096
+	compressionHeaderSize   = 16
+)
+
+// CompressionStats counts the bytes handled by SMB 3.1.1 compression so
+// that its benefit can be validated
+type CompressionStats struct {
+	CompressedBytes     uint64 // Size of the messages sent compressed, before compression
+	CompressedWireBytes uint64 // Size of the messages sent compressed, after compression
+	PassthroughBytes    uint64 // Size of the messages sent uncompressed while compression was negotiated
+	ReceivedWireBytes   uint64 // Size of the compressed messages received
+	DecompressedBytes   uint64 // Size of the compressed messages received, after decompression
+}
+
+type compressionCounters struct {
+	compressed     atomic.Uint64
+	compressedWire atomic.Uint64
+	passthrough    atomic.Uint64
+	receivedWire   atomic.Uint64
+	decompressed   atomic.Uint64
+}
+
+// CompressionStats returns the compression counters of the connection
+func (c *Connection) CompressionStats() CompressionStats {
+	return CompressionStats{
+		CompressedBytes:     c.compressionStats.compressed.Load(),
+		CompressedWireBytes: c.compressionStats.compressedWire.Load(),
+		PassthroughBytes:    c.compressionStats.passthrough.Load(),
+		ReceivedWireBytes:   c.compressionStats.receivedWire.Load(),
+		DecompressedBytes:   c.compressionStats.decompressed.Load(),
+	}
+}
+
+func (c *Connection) compressionThreshold() int {
+	if c.options.CompressionThreshold > 0 {
+		return c.options.CompressionThreshold
+	}
+	return defaultCompressionThreshold
+}
+
+// compress returns the message in pkt as an unchained compressed message if
+// compression was negotiated and is expected to pay off. The SMB2 header is
+// left uncompressed. Otherwise pkt is returned as is.
+func (c *Connection) compress(pkt net.Buffers) net.Buffers {
+	if c.compressionId == CompressionNone {
+		return pkt
+	}
+	size := 0
+	// The largest segment holds the payload in case of e.g., WRITE requests
+	sample := pkt[0][64:]
+	for _, p := range pkt {
+		size += len(p)
+		if len(p) > len(sample) {
+			sample = p
+		}
+	}
+	if size < c.compressionThreshold() || compression.Entropy(sample, compressionSampleSize) > compressionEntropyLimit {
+		c.compressionStats.passthrough.Add(uint64(size))
+		return pkt
+	}
+
+	src := encoder.GetBuffer(size)
+	for _, p := range pkt {
+		src = append(src, p...)
+	}
+	defer encoder.PutBuffer(src)
+
+	hdr, err := encoder.Marshal(CompressionTransformHeader{
+		ProtocolID:                    0x424D53FC,
+		OriginalCompressedSegmentSize: uint32(size - 64),
+		CompressionAlgorithm:          c.compressionId,
+		Offset:                        64,
+	})
+	if err != nil {
+		log.Errorln(err)
+		c.compressionStats.passthrough.Add(uint64(size))
+		return pkt
+	}
+	buf := append(encoder.GetBuffer(size), hdr...)
+	buf = append(buf, src[:64]...)
+	buf = compression.CompressLZ77(buf, src[64:])
+	if len(buf) >= size {
+		encoder.PutBuffer(buf)
+		c.compressionStats.passthrough.Add(uint64(size))
+		return pkt
+	}
+	c.compressionStats.compressed.Add(uint64(size))
+	c.compressionStats.compressedWire.Add(uint64(len(buf)))
+	return net.Buffers{buf}
+}
+
+// decompress returns the message contained in an unchained compressed
+// message in a pooled buffer. The caller keeps ownership of buf.
+func (c *Connection) decompress(buf []byte) ([]byte, error) {
+	if len(buf) < compressionHeaderSize {
+		return nil, fmt.Errorf("Compressed message is too short")
+	}
+	var hdr CompressionTransformHeader
+	if err := c.unmarshal(buf[:compressionHeaderSize], &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Flags != 0 {
+		return nil, fmt.Errorf("Chained compression was not negotiated")
+	}
+	if hdr.CompressionAlgorithm != c.compressionId || c.compressionId == CompressionNone {
+		return nil, fmt.Errorf("Unexpected compression algorithm (%d)", hdr.CompressionAlgorithm)
+	}
+	if uint64(hdr.Offset) > uint64(len(buf)-compressionHeaderSize) {
+		return nil, fmt.Errorf("Invalid offset of compressed data")
+	}
+	// MS-SMB2 Section 3.2.5.1.10
+	if hdr.OriginalCompressedSegmentSize > max(c.maxReadSize, c.maxWriteSize, c.maxTransactSize) {
+		return nil, fmt.Errorf("Compressed segment size of %d exceeds the negotiated limits", hdr.OriginalCompressedSegmentSize)
+	}
+
+	uncompressed := buf[compressionHeaderSize : compressionHeaderSize+hdr.Offset]
+	dst := append(encoder.GetBuffer(len(uncompressed)+int(hdr.OriginalCompressedSegmentSize)), uncompressed...)
+	out, err := compression.DecompressLZ77(dst, buf[compressionHeaderSize+hdr.Offset:], int(hdr.OriginalCompressedSegmentSize))
+	if err != nil {
+		// DecompressLZ77 returns no buffer on errors
+		encoder.PutBuffer(dst)
+		return nil, err
+	}
+	if len(out) != len(uncompressed)+int(hdr.OriginalCompressedSegmentSize) || len(out) < 64 {
+		encoder.PutBuffer(out)
+		return nil, fmt.Errorf("Decompressed message has an invalid size")
+	}
+	c.compressionStats.receivedWire.Add(uint64(len(buf)))
+	c.compressionStats.decompressed.Add(uint64(len(out)))
+	return out, nil
+}
@@ -0,0 +1,94 @@
+package smb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/compression"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+func TestCompression(t *testing.T) {
+	c, server := newTestConnection(t, Options{Compression: true})
+	c.compressionId = CompressionLZ77
+	c.maxWriteSize = 65536
+	c.credits.Store(100)
+
+	// The server decompresses WRITE requests and sends compressed responses
+	received := make(chan []byte, 2)
+	go func() {
+		for {
+			buf, err := readTestFrame(server)
+			if err != nil {
+				close(received)
+				return
+			}
+			if string(buf[:4]) == ProtocolCompressed {
+				size := int(binary.LittleEndian.Uint32(buf[4:8]))
+				buf, err = compression.DecompressLZ77(append([]byte{}, buf[16:80]...), buf[80:], size)
+				if err != nil {
+					close(received)
+					return
+				}
+			}
+			var req WriteReq
+			if err = encoder.Unmarshal(buf, &req); err != nil {
+				close(received)
+				return
+			}
+			received <- req.Buffer
+			resBuf, _ := encoder.Marshal(WriteRes{
+				Header: Header{
+					ProtocolID:    []byte(ProtocolSmb2),
+					StructureSize: 64,
+					Command:       CommandWrite,
+					Credits:       req.CreditCharge,
+					MessageID:     req.MessageID,
+					Signature:     make([]byte, 16),
+				},
+				StructureSize: 17,
+				Count:         req.Length,
+			})
+			hdr, _ := encoder.Marshal(CompressionTransformHeader{
+				ProtocolID:                    0x424D53FC,
+				OriginalCompressedSegmentSize: uint32(len(resBuf) - 64),
+				CompressionAlgorithm:          CompressionLZ77,
+				Offset:                        64,
+			})
+			res := compression.CompressLZ77(append(hdr, resBuf[:64]...), resBuf[64:])
+			size := binary.BigEndian.AppendUint32(nil, uint32(len(res)))
+			if _, err = server.Write(append(size, res...)); err != nil {
+				close(received)
+				return
+			}
+		}
+	}()
+
+	f := &File{Connection: c, fd: make([]byte, 16), share: "share"}
+	text := bytes.Repeat([]byte("compressible "), 1000)
+	random := make([]byte, 10000)
+	rand.Read(random)
+	for _, data := range [][]byte{text, random} {
+		n, err := f.WriteFile(data, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(data) || !bytes.Equal(<-received, data) {
+			t.Fatal("Fail")
+		}
+	}
+
+	stats := c.CompressionStats()
+	if stats.CompressedBytes < uint64(len(text)) || stats.CompressedWireBytes >= stats.CompressedBytes/4 {
+		t.Fatalf("Fail: %+v", stats)
+	}
+	// Random data is not worth compressing
+	if stats.PassthroughBytes < uint64(len(random)) || stats.PassthroughBytes > uint64(len(random))+200 {
+		t.Fatalf("Fail: %+v", stats)
+	}
+	if stats.ReceivedWireBytes == 0 || stats.DecompressedBytes != 2*80 {
+		t.Fatalf("Fail: %+v", stats)
+	}
+}
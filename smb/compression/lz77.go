@@ -0,0 +1,255 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package compression implements the Plain LZ77 algorithm from MS-XCA used
+// for SMB 3.1.1 compression, together with a cheap estimate of how well data
+// compresses.
+package compression
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	maxMatchOffset = 8192
+	minMatchLength = 3
+	hashBits       = 14
+)
+
+func hash3(b []byte) uint32 {
+	return (uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])) * 2654435761 >> (32 - hashBits)
+}
+
+// CompressLZ77 appends the Plain LZ77 compressed form of src to dst
+// according to MS-XCA Section 2.3.
+func CompressLZ77(dst, src []byte) []byte {
+	var table [1 << hashBits]int32
+	var flags uint32
+	var flagCount uint
+	lastLengthHalfByte := 0
+
+	flagPos := len(dst)
+	dst = append(dst, 0, 0, 0, 0)
+	for pos := 0; pos < len(src); {
+		matchLength, matchOffset := 0, 0
+		if pos+minMatchLength <= len(src) {
+			h := hash3(src[pos:])
+			if cand := int(table[h]) - 1; cand >= 0 && pos-cand <= maxMatchOffset {
+				for pos+matchLength < len(src) && src[cand+matchLength] == src[pos+matchLength] {
+					matchLength++
+				}
+				matchOffset = pos - cand
+			}
+			table[h] = int32(pos + 1)
+		}
+
+		if matchLength >= minMatchLength {
+			// Remember the skipped positions for later matches
+			for i := pos + 1; i < pos+matchLength && i+minMatchLength <= len(src); i++ {
+				table[hash3(src[i:])] = int32(i + 1)
+			}
+			pos += matchLength
+			length := matchLength - minMatchLength
+			token := uint16((matchOffset - 1) << 3)
+			if length < 7 {
+				dst = binary.LittleEndian.AppendUint16(dst, token|uint16(length))
+			} else {
+				dst = binary.LittleEndian.AppendUint16(dst, token|7)
+				length -= 7
+				nibble := byte(min(length, 15))
+				if lastLengthHalfByte == 0 {
+					lastLengthHalfByte = len(dst)
+					dst = append(dst, nibble)
+				} else {
+					dst[lastLengthHalfByte] |= nibble << 4
+					lastLengthHalfByte = 0
+				}
+				if length >= 15 {
+					length -= 15
+					if length < 255 {
+						dst = append(dst, byte(length))
+					} else {
+						dst = append(dst, 255)
+						length += 7 + 15
+						if length < 1<<16 {
+							dst = binary.LittleEndian.AppendUint16(dst, uint16(length))
+						} else {
+							dst = binary.LittleEndian.AppendUint16(dst, 0)
+							dst = binary.LittleEndian.AppendUint32(dst, uint32(length))
+						}
+					}
+				}
+			}
+			flags = flags<<1 | 1
+		} else {
+			dst = append(dst, src[pos])
+			pos++
+			flags <<= 1
+		}
+		flagCount++
+		if flagCount == 32 {
+			binary.LittleEndian.PutUint32(dst[flagPos:], flags)
+			flagCount = 0
+			flagPos = len(dst)
+			dst = append(dst, 0, 0, 0, 0)
+		}
+	}
+	// The unused flags are set which marks the end of the stream
+	flags = flags<<(32-flagCount) | (1<<(32-flagCount) - 1)
+	binary.LittleEndian.PutUint32(dst[flagPos:], flags)
+	return dst
+}
+
+// DecompressLZ77 appends the decompressed form of the Plain LZ77 compressed
+// src to dst according to MS-XCA Section 2.4. Decompression fails if the
+// output would grow beyond maxSize bytes.
+func DecompressLZ77(dst, src []byte, maxSize int) ([]byte, error) {
+	var flags uint32
+	var flagCount uint
+	lastLengthHalfByte := -1
+	base := len(dst)
+	pos := 0
+
+	for {
+		if flagCount == 0 {
+			if pos+4 > len(src) {
+				return dst, nil
+			}
+			flags = binary.LittleEndian.Uint32(src[pos:])
+			pos += 4
+			flagCount = 32
+		}
+		flagCount--
+		if flags&(1<<flagCount) == 0 {
+			if pos == len(src) {
+				return dst, nil
+			}
+			if len(dst)-base >= maxSize {
+				return nil, fmt.Errorf("Decompressed data exceeds %d bytes", maxSize)
+			}
+			dst = append(dst, src[pos])
+			pos++
+			continue
+		}
+
+		if pos == len(src) {
+			return dst, nil
+		}
+		if pos+2 > len(src) {
+			return nil, fmt.Errorf("Truncated LZ77 match")
+		}
+		token := binary.LittleEndian.Uint16(src[pos:])
+		pos += 2
+		length := int(token & 7)
+		offset := int(token>>3) + 1
+		if length == 7 {
+			if lastLengthHalfByte < 0 {
+				if pos >= len(src) {
+					return nil, fmt.Errorf("Truncated LZ77 match")
+				}
+				length = int(src[pos] & 15)
+				lastLengthHalfByte = pos
+				pos++
+			} else {
+				length = int(src[lastLengthHalfByte] >> 4)
+				lastLengthHalfByte = -1
+			}
+			if length == 15 {
+				if pos >= len(src) {
+					return nil, fmt.Errorf("Truncated LZ77 match")
+				}
+				length = int(src[pos])
+				pos++
+				if length == 255 {
+					if pos+2 > len(src) {
+						return nil, fmt.Errorf("Truncated LZ77 match")
+					}
+					length = int(binary.LittleEndian.Uint16(src[pos:]))
+					pos += 2
+					if length == 0 {
+						if pos+4 > len(src) {
+							return nil, fmt.Errorf("Truncated LZ77 match")
+						}
+						length = int(binary.LittleEndian.Uint32(src[pos:]))
+						pos += 4
+					}
+					if length < 15+7 {
+						return nil, fmt.Errorf("Invalid LZ77 match length")
+					}
+					length -= 15 + 7
+				}
+				length += 15
+			}
+			length += 7
+		}
+		length += minMatchLength
+
+		if offset > len(dst)-base {
+			return nil, fmt.Errorf("LZ77 match offset outside of the decompressed data")
+		}
+		if length > maxSize-(len(dst)-base) {
+			return nil, fmt.Errorf("Decompressed data exceeds %d bytes", maxSize)
+		}
+		// Matches may overlap the data they produce so copy byte by byte
+		start := len(dst) - offset
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+}
+
+// Entropy estimates the information content of data in bits per byte by
+// looking at up to sampleSize bytes spread evenly over data. Values close to
+// 8 indicate data that is already compressed or encrypted.
+func Entropy(data []byte, sampleSize int) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var counts [256]int
+	n := 0
+	if len(data) <= sampleSize {
+		for _, b := range data {
+			counts[b]++
+		}
+		n = len(data)
+	} else {
+		// Sample short runs rather than single bytes to stay cache friendly
+		const run = 16
+		step := len(data) / (sampleSize / run)
+		for off := 0; off+run <= len(data) && n < sampleSize; off += step {
+			for _, b := range data[off : off+run] {
+				counts[b]++
+			}
+			n += run
+		}
+	}
+	var e float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(n)
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
@@ -0,0 +1,71 @@
+package compression
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+func TestCompressLZ77(t *testing.T) {
+	for _, test := range []struct {
+		in  []byte
+		out string
+	}{
+		{[]byte("abc"), "ffffff1f616263"},
+		{[]byte("abcabcabc"), "ffffff1f6162631300"},
+		{bytes.Repeat([]byte("abc"), 100), "ffffff1f61626317000fff2601"},
+	} {
+		out := CompressLZ77(nil, test.in)
+		if hex.EncodeToString(out) != test.out {
+			t.Fatalf("Fail: %x", out)
+		}
+		dec, err := DecompressLZ77(nil, out, len(test.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dec, test.in) {
+			t.Fatal("Fail")
+		}
+	}
+}
+
+func TestDecompressLZ77(t *testing.T) {
+	random := make([]byte, 70000)
+	rand.Read(random)
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 3000)
+	for _, in := range [][]byte{{}, random, text, append(text[:1000:1000], random...), make([]byte, 200000)} {
+		out := CompressLZ77(nil, in)
+		dec, err := DecompressLZ77(nil, out, len(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dec, in) {
+			t.Fatal("Fail")
+		}
+	}
+
+	// The output size is limited
+	out := CompressLZ77(nil, text)
+	if _, err := DecompressLZ77(nil, out, len(text)-1); err == nil {
+		t.Fatal("Fail")
+	}
+	// Matches can't reference data before the start of the output
+	if _, err := DecompressLZ77(nil, []byte{0xff, 0xff, 0xff, 0xff, 0x08, 0x00}, 100); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	random := make([]byte, 1<<20)
+	rand.Read(random)
+	if e := Entropy(random, 4096); e < 7.5 {
+		t.Fatalf("Fail: %f", e)
+	}
+	if e := Entropy(make([]byte, 1<<20), 4096); e != 0 {
+		t.Fatalf("Fail: %f", e)
+	}
+	if e := Entropy(bytes.Repeat([]byte("abcd"), 1000), 4096); e != 2 {
+		t.Fatalf("Fail: %f", e)
+	}
+}
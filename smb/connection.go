@@ -35,10 +35,14 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ericblavier/go-smb/gss"
+	"github.com/ericblavier/go-smb/netbios"
 	"github.com/ericblavier/go-smb/smb/encoder"
 	"golang.org/x/net/proxy"
 )
@@ -47,14 +51,28 @@ type requestResponse struct {
 	msgId        uint64
 	asyncId      uint64
 	creditCharge uint16
-	pkt          []byte // Request packet
+	pkt          net.Buffers // Request packet
+	dst          []byte      // Optional destination for the data of a READ response
+	streamed     int         // Number of bytes of READ data written directly to dst
 	recv         chan []byte
 	err          error
 }
 
+// Number of independently locked parts of outstandingRequests. Must be a
+// power of two.
+const outstandingShards = 16
+
+// outstandingRequests maps message ids to requests awaiting a response. The
+// map is sharded by message id such that goroutines sharing a connection
+// rarely wait for each other.
 type outstandingRequests struct {
+	shards [outstandingShards]outstandingShard
+}
+
+type outstandingShard struct {
 	m        sync.Mutex
 	requests map[uint64]*requestResponse
+	_        [40]byte // Keep shards on separate cache lines
 }
 
 type Connection struct {
@@ -66,13 +84,18 @@ type Connection struct {
 	capabilities              uint32
 	cipherId                  uint16
 	signingId                 uint16 // For windows 11 and windows server 2022 and later
+	compressionId             uint16 // Negotiated compression algorithm, if any
+	compressionStats          compressionCounters
 	wdone                     chan struct{}
 	rdone                     chan struct{}
-	write                     chan []byte
+	write                     chan net.Buffers
 	werr                      chan error
 	m                         sync.Mutex
 	err                       error
 	useProxy                  bool
+	quirks                    Quirks                         // Detected quirks of the server
+	aapl                      atomic.Pointer[AAPLServerInfo] // Reply to the AAPL server query
+	throttle                  throttleState                  // Reduction of the in-flight windows
 	_useSession               int32
 }
 
@@ -105,7 +128,8 @@ func (conn *Connection) runSender() {
 		case <-conn.wdone:
 			return
 		case pkt := <-conn.write:
-			_, err := conn.conn.Write(pkt)
+			// Sent with a vectored write when supported by the connection
+			_, err := pkt.WriteTo(conn.conn)
 
 			conn.werr <- err
 		}
@@ -127,7 +151,7 @@ func readPacket(conn net.Conn) (packet []byte, err error) {
 		return
 	}
 
-	packet = make([]byte, size)
+	packet = encoder.GetBuffer(int(size))[:size]
 	l, err := io.ReadFull(conn, packet)
 	if err != nil {
 		log.Errorln(err)
@@ -141,6 +165,113 @@ func readPacket(conn net.Conn) (packet []byte, err error) {
 	return
 }
 
+// Size of the SMB2 header and the fixed part of a READ response
+const readResponseDataOffset = 64 + 16
+
+/*
+Read a packet from the wire. Successful READ responses to requests with a
+destination buffer are streamed such that the file data is read directly into
+the destination rather than into the packet. In that case the data is
+returned as payload and excluded from the packet.
+*/
+func (c *Connection) readPacketStreamed() (packet, payload []byte, err error) {
+	var size uint32
+	if err = binary.Read(c.conn, binary.BigEndian, &size); err != nil {
+		if !errors.Is(err, net.ErrClosed) {
+			log.Debugf("Error reading packet: %s\n", err)
+		}
+		return
+	}
+
+	if size > 0x00FFFFFF {
+		log.Errorln("Error: Invalid NetBIOS Session message")
+		// Don't return the error, instead try to read the next packet
+		return
+	}
+
+	if size <= readResponseDataOffset {
+		packet = encoder.GetBuffer(int(size))[:size]
+		_, err = io.ReadFull(c.conn, packet)
+		return
+	}
+
+	var head [readResponseDataOffset]byte
+	if _, err = io.ReadFull(c.conn, head[:64]); err != nil {
+		return
+	}
+	dst := c.streamDestination(head[:64])
+	if dst != nil {
+		if _, err = io.ReadFull(c.conn, head[64:]); err != nil {
+			return
+		}
+		dataOffset := uint32(head[66])
+		dataLength := binary.LittleEndian.Uint32(head[68:72])
+		if dataOffset == readResponseDataOffset && dataLength > 0 && dataLength <= uint32(len(dst)) && dataLength <= size-readResponseDataOffset {
+			payload = dst[:dataLength]
+			if _, err = io.ReadFull(c.conn, payload); err != nil {
+				return
+			}
+			packet = encoder.GetBuffer(int(size - dataLength))[:size-dataLength]
+			copy(packet, head[:])
+			_, err = io.ReadFull(c.conn, packet[readResponseDataOffset:])
+			return
+		}
+		packet = encoder.GetBuffer(int(size))[:size]
+		copy(packet, head[:])
+		_, err = io.ReadFull(c.conn, packet[readResponseDataOffset:])
+		return
+	}
+
+	packet = encoder.GetBuffer(int(size))[:size]
+	copy(packet, head[:64])
+	_, err = io.ReadFull(c.conn, packet[64:])
+	return
+}
+
+// verifiesSignature reports whether the signature of a response must be
+// verified before it is accepted
+func (c *Connection) verifiesSignature(encrypted bool) bool {
+	if c.dialect == DialectSmb_3_1_1 {
+		return !encrypted && c.sessionFlags&(SessionFlagIsGuest|SessionFlagIsNull) == 0
+	}
+	return c.Session.isSigningRequired.Load()
+}
+
+// streamDestination returns the destination buffer of the outstanding READ
+// request that the header is a successful response to, if any. Responses
+// that must be verified are not streamed, such that the destination never
+// holds data with an invalid signature.
+func (c *Connection) streamDestination(hdr []byte) []byte {
+	if string(hdr[:4]) != ProtocolSmb2 {
+		return nil
+	}
+	if c.useSession() && c.verifiesSignature(false) {
+		return nil
+	}
+	status := binary.LittleEndian.Uint32(hdr[8:12])
+	command := binary.LittleEndian.Uint16(hdr[12:14])
+	nextCommand := binary.LittleEndian.Uint32(hdr[20:24])
+	if command != CommandRead || status != StatusOk || nextCommand != 0 {
+		return nil
+	}
+	rr, ok := c.outstandingRequests.get(binary.LittleEndian.Uint64(hdr[24:32]))
+	if !ok {
+		return nil
+	}
+	return rr.dst
+}
+
+// rejectResponse fails the request that data claims to respond to, such that
+// its caller does not wait for a response that will never be accepted
+func (c *Connection) rejectResponse(msgId uint64, data []byte, err error) {
+	log.Errorln(err)
+	encoder.PutBuffer(data)
+	if rr, ok := c.outstandingRequests.pop(msgId); ok {
+		rr.err = err
+		rr.recv <- nil
+	}
+}
+
 /*
 Read packets from the wire. If the message id matches that of the
 outstandingRequests map, clear the packet from the map and forward the
@@ -150,7 +281,7 @@ func (c *Connection) runReceiver() {
 	var err error
 	var encrypted bool
 	for {
-		data, err := readPacket(c.conn)
+		data, payload, err := c.readPacketStreamed()
 		if err != nil {
 			// Error is handled at the end of the method.
 			break
@@ -169,6 +300,15 @@ func (c *Connection) runReceiver() {
 		case ProtocolSmb:
 		case ProtocolSmb2:
 		case ProtocolTransformHdr:
+		case ProtocolCompressed:
+			compressed := data
+			data, err = c.decompress(compressed)
+			encoder.PutBuffer(compressed)
+			if err != nil {
+				log.Errorf("Skip: Failed to decompress packet with error: %s\n", err)
+				continue
+			}
+			protID = data[0:4]
 		}
 
 		var h Header
@@ -177,7 +317,7 @@ func (c *Connection) runReceiver() {
 			switch string(protID) {
 			case ProtocolTransformHdr:
 				tHdr := NewTransformHeader()
-				if err = encoder.Unmarshal(data[:52], &tHdr); err != nil {
+				if err = c.unmarshal(data[:52], &tHdr); err != nil {
 					log.Errorln("Skip: Failed to decode transform header of packet")
 					continue
 				}
@@ -199,9 +339,22 @@ func (c *Connection) runReceiver() {
 				}
 				encrypted = true
 
+				fallthrough
+			case ProtocolCompressed:
+				// Encrypted messages may be compressed as well
+				if string(data[0:4]) == ProtocolCompressed {
+					compressed := data
+					data, err = c.decompress(compressed)
+					encoder.PutBuffer(compressed)
+					if err != nil {
+						log.Errorf("Skip: Failed to decompress packet with error: %s\n", err)
+						continue
+					}
+				}
+
 				fallthrough
 			case ProtocolSmb2:
-				if err = encoder.Unmarshal(data[:64], &h); err != nil {
+				if err = c.unmarshal(data[:64], &h); err != nil {
 					log.Errorln("Skip: Failed to decode header of packet")
 					continue
 				}
@@ -221,22 +374,16 @@ func (c *Connection) runReceiver() {
 			   If dialect is 3.1.1, If message is not encrypted check message signature.
 			   If dialect is NOT 3.1.1, check signing only if required
 			*/
-			if ((c.dialect == DialectSmb_3_1_1) && !encrypted && (c.sessionFlags&(SessionFlagIsGuest|SessionFlagIsNull) == 0)) || ((c.dialect != DialectSmb_3_1_1) && c.Session.isSigningRequired.Load()) {
+			if c.verifiesSignature(encrypted) {
 				// When server responds with StatusPending, the packet signature is the same as on the
 				// last packet and the signing flag is not set
 				if h.Status != StatusPending {
 					if (h.Flags & SMB2_FLAGS_SIGNED) != SMB2_FLAGS_SIGNED {
-						err = fmt.Errorf("Skip: Signing is required but PDU is not signed")
-						log.Errorln(err)
-						// Perhaps crash here instead of continuing to wait for a proper package?
+						c.rejectResponse(h.MessageID, data, fmt.Errorf("Signing is required but PDU is not signed"))
+						continue
+					} else if !c.verify(data) {
+						c.rejectResponse(h.MessageID, data, fmt.Errorf("Signing is required and invalid signature found"))
 						continue
-					} else {
-						if !c.verify(data) {
-							err = fmt.Errorf("Skip: Signing is required and invalid signature found")
-							log.Errorln(err)
-							// Perhaps crash here instead of continuing to wait for a proper package?
-							continue
-						}
 					}
 				}
 			}
@@ -248,7 +395,7 @@ func (c *Connection) runReceiver() {
 				// So we don't care about unmarshalling the packet into a SMBv1 header and only pop MessageID 0
 				// from outstandingRequests
 			} else {
-				if err = encoder.Unmarshal(data[:64], &h); err != nil {
+				if err = c.unmarshal(data[:64], &h); err != nil {
 					fmt.Println("Skip: Failed to decode header of packet")
 					continue
 				}
@@ -260,9 +407,15 @@ func (c *Connection) runReceiver() {
 			}
 		}
 
+		if string(data[0:4]) != ProtocolSmb {
+			// Interim responses grant credits as well
+			c.credits.Add(int64(h.Credits))
+		}
+
 		rr, ok := c.outstandingRequests.pop(h.MessageID)
 		if !ok {
 			fmt.Printf("Message Id (%d) not found in outstanding packets!\n", h.MessageID)
+			encoder.PutBuffer(data)
 			continue
 		}
 		if h.Status == StatusPending {
@@ -275,7 +428,10 @@ func (c *Connection) runReceiver() {
 			binary.LittleEndian.PutUint32(asyncIdBytes[4:], h.TreeID)
 			rr.asyncId = binary.LittleEndian.Uint64(asyncIdBytes)
 			c.outstandingRequests.set(h.MessageID, rr)
+			// The interim response carries nothing else of interest
+			encoder.PutBuffer(data)
 		} else {
+			rr.streamed = len(payload)
 			rr.recv <- data
 		}
 	}
@@ -297,36 +453,62 @@ func (c *Connection) runReceiver() {
 	close(c.wdone)
 }
 
+// writePacket writes the request packet to w, e.g., to update a hash
+func (rr *requestResponse) writePacket(w io.Writer) {
+	for _, p := range rr.pkt {
+		w.Write(p)
+	}
+}
+
 func newOutstandingRequests() *outstandingRequests {
-	return &outstandingRequests{
-		requests: make(map[uint64]*requestResponse, 0),
+	r := &outstandingRequests{}
+	for i := range r.shards {
+		r.shards[i].requests = make(map[uint64]*requestResponse)
 	}
+	return r
+}
+
+func (r *outstandingRequests) shard(msgId uint64) *outstandingShard {
+	return &r.shards[msgId&(outstandingShards-1)]
 }
 
 func (r *outstandingRequests) pop(msgId uint64) (rr *requestResponse, ok bool) {
-	r.m.Lock()
-	defer r.m.Unlock()
-	rr, ok = r.requests[msgId]
+	s := r.shard(msgId)
+	s.m.Lock()
+	defer s.m.Unlock()
+	rr, ok = s.requests[msgId]
 	if !ok {
 		return
 	}
-	delete(r.requests, msgId)
+	delete(s.requests, msgId)
+
+	return
+}
 
+func (r *outstandingRequests) get(msgId uint64) (rr *requestResponse, ok bool) {
+	s := r.shard(msgId)
+	s.m.Lock()
+	defer s.m.Unlock()
+	rr, ok = s.requests[msgId]
 	return
 }
 
 func (r *outstandingRequests) set(msgId uint64, rr *requestResponse) {
-	r.m.Lock()
-	defer r.m.Unlock()
-	r.requests[msgId] = rr
+	s := r.shard(msgId)
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.requests[msgId] = rr
 }
 
 func (r *outstandingRequests) shutdown(err error) {
-	r.m.Lock()
-	defer r.m.Unlock()
-	for _, rr := range r.requests {
-		rr.err = err
-		close(rr.recv)
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.m.Lock()
+		for _, rr := range s.requests {
+			rr.err = err
+			close(rr.recv)
+		}
+		s.m.Unlock()
 	}
 }
 
@@ -340,7 +522,7 @@ func NewConnection(opt Options) (c *Connection, err error) {
 		outstandingRequests: newOutstandingRequests(),
 		rdone:               make(chan struct{}, 1),
 		wdone:               make(chan struct{}, 1),
-		write:               make(chan []byte, 1),
+		write:               make(chan net.Buffers, 1),
 		werr:                make(chan error, 1),
 	}
 
@@ -350,13 +532,14 @@ func NewConnection(opt Options) (c *Connection, err error) {
 		isSigningDisabled: opt.DisableSigning,
 		clientGuid:        make([]byte, 16),
 		securityMode:      0,
-		messageID:         0,
 		sessionID:         0,
 		dialect:           0,
 		options:           opt,
 		trees:             make(map[string]uint32),
 	}
 	c.Session.isSigningRequired.Store(opt.RequireMessageSigning)
+	// The client starts out with a single credit
+	c.Session.credits.Store(1)
 
 	if opt.ProxyDialer != nil {
 		c.useProxy = true
@@ -374,6 +557,14 @@ func NewConnection(opt Options) (c *Connection, err error) {
 		}
 	}
 
+	if opt.Port == netbios.SessionServicePort {
+		if err = c.requestNetBIOSSession(opt); err != nil {
+			log.Errorln(err)
+			c.conn.Close()
+			return nil, err
+		}
+	}
+
 	// SMB Dialects other than 3.x requires clientGuid to be zero
 	if !opt.ForceSMB2 {
 		_, err = rand.Read(c.Session.clientGuid)
@@ -415,24 +606,53 @@ func NewConnection(opt Options) (c *Connection, err error) {
 	return c, nil
 }
 
-func (c *Connection) makeRequestResponse(buf []byte) (rr *requestResponse, err error) {
+// requestNetBIOSSession sends the NetBIOS session request that precedes the
+// SMB messages on port 139
+func (c *Connection) requestNetBIOSSession(opt Options) error {
+	called := opt.NetBIOSName
+	if called == "" {
+		called = netbios.DefaultCalledName
+	}
+	calling := opt.Workstation
+	if calling == "" {
+		hostname, _ := os.Hostname()
+		calling, _, _ = strings.Cut(hostname, ".")
+	}
+	if len(calling) > 15 {
+		calling = calling[:15]
+	}
+	if opt.DialTimeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(opt.DialTimeout))
+		defer c.conn.SetDeadline(time.Time{})
+	}
+	log.Debugf("Requesting NetBIOS session with called name %s\n", called)
+	return netbios.RequestSession(c.conn, called, calling)
+}
+
+func (c *Connection) makeRequestResponse(pkt net.Buffers, dst []byte) (rr *requestResponse, err error) {
 	var h1 SMB1Header
 	var h Header
 	var smb1 bool
 	var creditCharge uint16
 	var messageID uint64
 
+	// The headers are expected to be contained in the first segment
+	if len(pkt) > 1 && len(pkt[0]) < 64 {
+		pkt = net.Buffers{bytes.Join(pkt, nil)}
+	}
+	buf := pkt[0]
+
 	if buf[0] == 0xff {
 		// SMB1 header
 		smb1 = true
-		err = encoder.Unmarshal(buf[:32], &h1)
+		err = c.unmarshal(buf[:32], &h1)
 		if err != nil {
 			log.Debugln(err)
 			return
 		}
 	} else {
 		// SMB2 header
-		err = encoder.Unmarshal(buf[:64], &h)
+		err = c.unmarshal(buf[:64], &h)
 		if err != nil {
 			log.Debugln(err)
 			log.Noticeln(err)
@@ -442,18 +662,19 @@ func (c *Connection) makeRequestResponse(buf []byte) (rr *requestResponse, err e
 	//NOTE Perhaps support Cancel requests?
 
 	// Make sure the same messageID is not used twice. Might result in wasted messageIDs though.
-	c.lock.Lock()
-	messageID = c.messageID
 	if !smb1 {
-		h.MessageID = messageID
 		creditCharge = h.CreditCharge
-		c.messageID += uint64(h.CreditCharge)
 	} else {
 		// Assumed to be the SMB1 Negotiate Request
 		creditCharge = 1
-		c.messageID += 1
 	}
-	c.lock.Unlock()
+	messageID = c.messageID.Add(uint64(creditCharge)) - uint64(creditCharge)
+	h.MessageID = messageID
+	if !smb1 {
+		c.setChannelSequence(&h)
+	}
+	// A credit charge of 0 from SMB 2.0.2 still consumes one credit
+	c.credits.Add(-int64(max(creditCharge, 1)))
 
 	if !smb1 {
 		hBuf, err := encoder.Marshal(h)
@@ -467,17 +688,21 @@ func (c *Connection) makeRequestResponse(buf []byte) (rr *requestResponse, err e
 	if c.Session != nil {
 		if h.Command != CommandSessionSetup {
 			if c.Session.sessionFlags&SessionFlagEncryptData != 0 {
-				buf, err = c.encrypt(buf)
+				// Messages are compressed before they are encrypted
+				pkt = c.compress(pkt)
+				// Encryption requires the complete message
+				buf, err = c.encrypt(bytes.Join(pkt, nil))
 				if err != nil {
 					log.Errorln(err)
 					return
 				}
+				pkt = net.Buffers{buf}
 			} else if !c.Session.isSigningDisabled || (c.dialect == DialectSmb_3_1_1) {
 				// Must sign or encrypt with SMB 3.1.1
 				// TODO fix this control to check if encryption is performed instead.
 				if c.Session.sessionFlags&(SessionFlagIsGuest|SessionFlagIsNull) == 0 {
 					if c.signer != nil {
-						buf, err = c.sign(buf)
+						err = c.signBuffers(pkt)
 						if err != nil {
 							log.Errorln(err)
 							return
@@ -485,13 +710,18 @@ func (c *Connection) makeRequestResponse(buf []byte) (rr *requestResponse, err e
 					}
 				}
 			}
+			if c.Session.sessionFlags&SessionFlagEncryptData == 0 {
+				// Messages are compressed after they are signed
+				pkt = c.compress(pkt)
+			}
 		}
 	}
 
 	rr = &requestResponse{
 		msgId:        messageID,
 		creditCharge: creditCharge,
-		pkt:          buf,
+		pkt:          pkt,
+		dst:          dst,
 		recv:         make(chan []byte, 1),
 	}
 	c.outstandingRequests.set(messageID, rr)
@@ -499,20 +729,41 @@ func (c *Connection) makeRequestResponse(buf []byte) (rr *requestResponse, err e
 	return
 }
 
+// sendrecv sends a request and waits for its response. Requests rejected
+// with a throttling status are sent again after a backoff.
 func (c *Connection) sendrecv(req interface{}) (buf []byte, err error) {
-	rr, err := c.send(req)
+	buf, _, err = c.sendrecvInto(req, nil)
+	return
+}
+
+// sendrecvInto sends a READ request and lets the receiver write the returned
+// data directly into dst instead of the response buffer when possible. The
+// number of bytes written to dst is returned along with the response.
+func (c *Connection) sendrecvInto(req interface{}, dst []byte) (buf []byte, streamed int, err error) {
+	rr, err := c.sendInto(req, dst)
 	if err != nil {
 		return
 	}
-	return c.recv(rr)
+	buf, err = c.recv(rr)
+	if err != nil {
+		return
+	}
+	// The request has been written once a response arrives
+	encoder.ReleaseBuffers(rr.pkt)
+	return c.retryThrottled(req, dst, buf, rr.streamed)
 }
 
 func (c *Connection) send(req interface{}) (rr *requestResponse, err error) {
+	return c.sendInto(req, nil)
+}
+
+func (c *Connection) sendInto(req interface{}, dst []byte) (rr *requestResponse, err error) {
 
 	c.m.Lock()
-	defer c.m.Unlock()
-	if c.err != nil {
-		return nil, c.err
+	err = c.err
+	c.m.Unlock()
+	if err != nil {
+		return nil, err
 	}
 
 	select {
@@ -522,26 +773,35 @@ func (c *Connection) send(req interface{}) (rr *requestResponse, err error) {
 		//Do nothing
 	}
 
-	buf, err := encoder.Marshal(req)
+	// Encoding and signing happen before taking the connection lock such
+	// that concurrent requests only serialize on writing to the wire.
+	// Large payloads are referenced rather than copied into the packet
+	pkt, err := encoder.MarshalBuffers(req)
 	if err != nil {
 		log.Debugln(err)
 		return nil, err
 	}
 
-	rr, err = c.makeRequestResponse(buf)
+	rr, err = c.makeRequestResponse(pkt, dst)
 	if err != nil {
 		log.Debugln(err)
 		return nil, err
 	}
 
-	b := new(bytes.Buffer)
-	if err = binary.Write(b, binary.BigEndian, uint32(len(rr.pkt))); err != nil {
-		log.Debugln(err)
-		return
+	size := 0
+	for _, p := range rr.pkt {
+		size += len(p)
 	}
+	// Prepend the NetBIOS session header. A new slice is required as
+	// writing consumes the buffers.
+	out := make(net.Buffers, 0, len(rr.pkt)+1)
+	out = append(out, binary.BigEndian.AppendUint32(make([]byte, 0, 4), uint32(size)))
+	out = append(out, rr.pkt...)
 
+	c.m.Lock()
+	defer c.m.Unlock()
 	select {
-	case c.write <- append(b.Bytes(), rr.pkt...):
+	case c.write <- out:
 		select {
 		case err = <-c.werr:
 			if err != nil {
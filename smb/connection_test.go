@@ -0,0 +1,134 @@
+package smb
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// lockedRequests is the single mutex map that outstandingRequests replaced,
+// kept as a baseline for the benchmarks
+type lockedRequests struct {
+	m        sync.Mutex
+	requests map[uint64]*requestResponse
+}
+
+func (r *lockedRequests) set(msgId uint64, rr *requestResponse) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.requests[msgId] = rr
+}
+
+func (r *lockedRequests) pop(msgId uint64) (rr *requestResponse, ok bool) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	rr, ok = r.requests[msgId]
+	delete(r.requests, msgId)
+	return
+}
+
+func TestOutstandingRequests(t *testing.T) {
+	r := newOutstandingRequests()
+	for i := uint64(0); i < 100; i++ {
+		r.set(i, &requestResponse{msgId: i, recv: make(chan []byte, 1)})
+	}
+	for i := uint64(0); i < 100; i += 2 {
+		if rr, ok := r.pop(i); !ok || rr.msgId != i {
+			t.Fatal("Fail")
+		}
+	}
+	if _, ok := r.get(10); ok {
+		t.Fatal("Fail")
+	}
+	if rr, ok := r.get(11); !ok || rr.msgId != 11 {
+		t.Fatal("Fail")
+	}
+	rr, _ := r.get(99)
+	r.shutdown(nil)
+	if _, ok := <-rr.recv; ok {
+		t.Fatal("Fail")
+	}
+}
+
+func BenchmarkOutstandingRequests(b *testing.B) {
+	b.Run("sharded", func(b *testing.B) {
+		r := newOutstandingRequests()
+		var msgId atomic.Uint64
+		rr := &requestResponse{}
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				id := msgId.Add(1)
+				r.set(id, rr)
+				r.pop(id)
+			}
+		})
+	})
+	b.Run("single", func(b *testing.B) {
+		r := &lockedRequests{requests: make(map[uint64]*requestResponse)}
+		var msgId atomic.Uint64
+		rr := &requestResponse{}
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				id := msgId.Add(1)
+				r.set(id, rr)
+				r.pop(id)
+			}
+		})
+	})
+}
+
+func BenchmarkMakeRequestResponse(b *testing.B) {
+	c := &Connection{
+		outstandingRequests: newOutstandingRequests(),
+		Session:             &Session{trees: make(map[string]uint32)},
+	}
+	req := c.NewLogoffReq()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			pkt, err := encoder.MarshalBuffers(&req)
+			if err != nil {
+				b.Fatal(err)
+			}
+			rr, err := c.makeRequestResponse(pkt, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			c.outstandingRequests.pop(rr.msgId)
+		}
+	})
+}
+
+// BenchmarkSend measures concurrent requests sent on a single connection to
+// a server that discards them. SetParallelism runs many more goroutines than
+// CPUs as when e.g., a connection is shared by a worker pool.
+func BenchmarkSend(b *testing.B) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go io.Copy(io.Discard, server)
+	c := &Connection{
+		conn:                client,
+		outstandingRequests: newOutstandingRequests(),
+		rdone:               make(chan struct{}, 1),
+		wdone:               make(chan struct{}, 1),
+		write:               make(chan net.Buffers, 1),
+		werr:                make(chan error, 1),
+		Session:             &Session{trees: make(map[string]uint32)},
+	}
+	go c.runSender()
+	b.SetParallelism(16)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := c.NewLogoffReq()
+			rr, err := c.send(req)
+			if err != nil {
+				b.Fatal(err)
+			}
+			c.outstandingRequests.pop(rr.msgId)
+		}
+	})
+}
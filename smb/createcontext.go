@@ -0,0 +1,122 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// MS-SMB2 Section 2.2.13.2 SMB2_CREATE_CONTEXT
+type CreateContext struct {
+	Name string // Usually a four character tag
+	Data []byte
+}
+
+// marshalCreateContexts encodes a chain of create contexts. Each context
+// and its data start on an 8 byte boundary.
+func marshalCreateContexts(ctxs []CreateContext) []byte {
+	var buf []byte
+	for i, ctx := range ctxs {
+		start := len(buf)
+		dataOffset := 0
+		if len(ctx.Data) > 0 {
+			dataOffset = 16 + len(ctx.Name) + (8-len(ctx.Name)%8)%8
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, 0) // Next, set below
+		buf = binary.LittleEndian.AppendUint16(buf, 16)
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(ctx.Name)))
+		buf = binary.LittleEndian.AppendUint16(buf, 0)
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(dataOffset))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(ctx.Data)))
+		buf = append(buf, ctx.Name...)
+		if len(ctx.Data) > 0 {
+			buf = append(buf, make([]byte, start+dataOffset-len(buf))...)
+			buf = append(buf, ctx.Data...)
+		}
+		if i < len(ctxs)-1 {
+			buf = append(buf, make([]byte, (8-(len(buf)-start)%8)%8)...)
+			binary.LittleEndian.PutUint32(buf[start:], uint32(len(buf)-start))
+		}
+	}
+	return buf
+}
+
+// parseCreateContexts decodes a chain of create contexts
+func parseCreateContexts(buf []byte) (ctxs []CreateContext, err error) {
+	for len(buf) > 0 {
+		if len(buf) < 16 {
+			return nil, fmt.Errorf("Buffer too small for SMB2_CREATE_CONTEXT")
+		}
+		next := binary.LittleEndian.Uint32(buf)
+		nameOffset := uint64(binary.LittleEndian.Uint16(buf[4:6]))
+		nameLen := uint64(binary.LittleEndian.Uint16(buf[6:8]))
+		dataOffset := uint64(binary.LittleEndian.Uint16(buf[10:12]))
+		dataLen := uint64(binary.LittleEndian.Uint32(buf[12:16]))
+		end := uint64(len(buf))
+		if next != 0 {
+			end = uint64(next)
+		}
+		if end > uint64(len(buf)) || nameOffset+nameLen > end || dataOffset+dataLen > end {
+			return nil, fmt.Errorf("Create context exceeds the SMB2_CREATE_CONTEXT buffer")
+		}
+		ctxs = append(ctxs, CreateContext{
+			Name: string(buf[nameOffset : nameOffset+nameLen]),
+			Data: buf[dataOffset : dataOffset+dataLen],
+		})
+		if next == 0 {
+			break
+		}
+		buf = buf[next:]
+	}
+	return
+}
+
+// findCreateContext returns the data of the named create context
+func findCreateContext(ctxs []CreateContext, name string) ([]byte, bool) {
+	for _, ctx := range ctxs {
+		if ctx.Name == name {
+			return ctx.Data, true
+		}
+	}
+	return nil, false
+}
+
+// SetCreateContexts appends the create contexts to the request after the
+// file name
+func (self *CreateReq) SetCreateContexts(ctxs []CreateContext) {
+	if len(ctxs) == 0 {
+		return
+	}
+	buf := self.Buffer[:self.NameLength]
+	buf = append(buf, make([]byte, (8-len(buf)%8)%8)...)
+	self.CreateContextsOffset = uint32(self.NameOffset) + uint32(len(buf))
+	contexts := marshalCreateContexts(ctxs)
+	self.CreateContextsLength = uint32(len(contexts))
+	self.Buffer = append(buf, contexts...)
+}
+
+// CreateContexts returns the create contexts of the response
+func (self *CreateRes) CreateContexts() ([]CreateContext, error) {
+	return parseCreateContexts(self.Buffer)
+}
@@ -0,0 +1,189 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/ericblavier/go-smb/smb/crypto/ccm"
+	"github.com/ericblavier/go-smb/smb/crypto/cmac"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// The pure functions below implement the MS-SMB2 Section 3.1.4 signing, key
+// derivation and transform encryption without any connection state so that
+// they can be checked against the published example vectors. The session
+// code builds its signers and ciphers from the same functions.
+
+// SessionKeys holds the keys derived from a session key as seen by the
+// client. The server encrypts with the DecryptionKey and decrypts with the
+// EncryptionKey.
+type SessionKeys struct {
+	SigningKey     []byte
+	EncryptionKey  []byte // Client to server
+	DecryptionKey  []byte // Server to client
+	ApplicationKey []byte
+}
+
+// DeriveKey is the SP800-108 KDF in counter mode with HMAC-SHA256 of MS-SMB2
+// Section 3.1.4.2. Only key lengths of 128 and 256 bits are supported.
+func DeriveKey(key, label, context []byte, bits uint32) ([]byte, error) {
+	if bits != 128 && bits != 256 {
+		return nil, fmt.Errorf("Unsupported key length of %d bits", bits)
+	}
+	return kdf(key, label, context, bits), nil
+}
+
+// DeriveSessionKeys derives the keys of a session for the dialect.
+// SMB 2.0.2 and 2.1 sign with the session key itself and have no encryption.
+// The preauthHash and cipherId are only used for SMB 3.1.1 and the cipherId
+// must be one of AES128CCM, AES128GCM, AES256CCM or AES256GCM.
+func DeriveSessionKeys(dialect uint16, sessionKey, preauthHash []byte, cipherId uint16) (keys SessionKeys, err error) {
+	switch dialect {
+	case DialectSmb_2_0_2, DialectSmb_2_1:
+		keys.SigningKey = sessionKey
+	case DialectSmb_3_0, DialectSmb_3_0_2:
+		keys.SigningKey = kdf(sessionKey, []byte("SMB2AESCMAC\x00"), []byte("SmbSign\x00"), 128)
+		keys.EncryptionKey = kdf(sessionKey, []byte("SMB2AESCCM\x00"), []byte("ServerIn \x00"), 128)
+		keys.DecryptionKey = kdf(sessionKey, []byte("SMB2AESCCM\x00"), []byte("ServerOut\x00"), 128)
+		keys.ApplicationKey = kdf(sessionKey, []byte("SMB2APP\x00"), []byte("SmbRpc\x00"), 128)
+	case DialectSmb_3_1_1:
+		var l uint32
+		switch cipherId {
+		case AES128CCM, AES128GCM:
+			l = 128
+		case AES256CCM, AES256GCM:
+			l = 256
+		default:
+			return keys, fmt.Errorf("Cipher algorithm (%d) not implemented", cipherId)
+		}
+		keys.SigningKey = kdf(sessionKey, []byte("SMBSigningKey\x00"), preauthHash, 128)
+		keys.EncryptionKey = kdf(sessionKey, []byte("SMBC2SCipherKey\x00"), preauthHash, l)
+		keys.DecryptionKey = kdf(sessionKey, []byte("SMBS2CCipherKey\x00"), preauthHash, l)
+		keys.ApplicationKey = kdf(sessionKey, []byte("SMBAppKey\x00"), preauthHash, 128)
+	default:
+		return keys, fmt.Errorf("Unknown dialect 0x%x", dialect)
+	}
+	return
+}
+
+// newSigner returns the MAC used to sign messages of the dialect
+func newSigner(dialect uint16, key []byte) (hash.Hash, error) {
+	if dialect <= DialectSmb_2_1 {
+		return hmac.New(sha256.New, key), nil
+	}
+	return cmac.New(key)
+}
+
+// SignMessage returns the 16 byte signature of an SMB2 message signed with
+// the signing key of the dialect. The signature field of msg is treated as
+// zero and msg is left unmodified.
+func SignMessage(dialect uint16, key, msg []byte) ([]byte, error) {
+	if len(msg) < 64 {
+		return nil, fmt.Errorf("Message too short to sign: %d bytes", len(msg))
+	}
+	h, err := newSigner(dialect, key)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(msg[:48])
+	h.Write(make([]byte, 16))
+	h.Write(msg[64:])
+	return h.Sum(nil)[:16], nil
+}
+
+// newCipher returns the AEAD of the cipher used for transform encryption
+func newCipher(cipherId uint16, key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	switch cipherId {
+	case AES128GCM, AES256GCM:
+		return cipher.NewGCMWithNonceSize(block, 12)
+	case AES128CCM, AES256CCM:
+		return ccm.NewCCMWithNonceAndTagSizes(block, 11, 16)
+	default:
+		return nil, fmt.Errorf("Cipher algorithm (%d) not implemented", cipherId)
+	}
+}
+
+// sealMessage encrypts msg into a message with a TRANSFORM_HEADER. The
+// nonce must be NonceSize bytes.
+func sealMessage(aead cipher.AEAD, nonce []byte, sessionId uint64, msg []byte) ([]byte, error) {
+	tHdr := NewTransformHeader()
+	copy(tHdr.Nonce, nonce)
+	tHdr.OriginalMessageSize = uint32(len(msg))
+	tHdr.SessionId = sessionId
+	tHdrBytes, err := encoder.Marshal(tHdr)
+	if err != nil {
+		return nil, err
+	}
+	// The transform header after the signature is the additional data
+	ciphertext := aead.Seal(nil, nonce, msg, tHdrBytes[20:52])
+	copy(tHdrBytes[4:20], ciphertext[len(ciphertext)-16:])
+	return append(tHdrBytes, ciphertext[:len(ciphertext)-16]...), nil
+}
+
+// openMessage decrypts a message with a TRANSFORM_HEADER
+func openMessage(aead cipher.AEAD, buf []byte) ([]byte, error) {
+	if len(buf) < 52 {
+		return nil, fmt.Errorf("Encrypted message too short: %d bytes", len(buf))
+	}
+	tHdr := NewTransformHeader()
+	if err := encoder.Unmarshal(buf[:52], &tHdr); err != nil {
+		return nil, err
+	}
+	ciphertext := append(buf[52:], tHdr.Signature...)
+	return aead.Open(ciphertext[:0], tHdr.Nonce[:aead.NonceSize()], ciphertext, buf[20:52])
+}
+
+// EncryptMessage encrypts an SMB2 message with the cipher and returns it
+// with a TRANSFORM_HEADER. The nonce is 11 bytes for CCM and 12 bytes for
+// GCM and must never be reused with the same key.
+func EncryptMessage(cipherId uint16, key, nonce []byte, sessionId uint64, msg []byte) ([]byte, error) {
+	aead, err := newCipher(cipherId, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("Nonce must be %d bytes", aead.NonceSize())
+	}
+	return sealMessage(aead, nonce, sessionId, msg)
+}
+
+// DecryptMessage decrypts a message with a TRANSFORM_HEADER and returns the
+// SMB2 message
+func DecryptMessage(cipherId uint16, key, buf []byte) ([]byte, error) {
+	aead, err := newCipher(cipherId, key)
+	if err != nil {
+		return nil, err
+	}
+	return openMessage(aead, bytes.Clone(buf))
+}
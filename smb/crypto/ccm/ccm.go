@@ -28,7 +28,6 @@ https://xilinx.github.io/Vitis_Libraries/security/2020.1/_images/CCM_encryption.
 */
 
 import (
-	"bytes"
 	"crypto/cipher"
 	"crypto/subtle"
 	"fmt"
@@ -220,7 +219,7 @@ func (self *ccm) Open(dst, nonce, ciphertext, additionalData []byte) (result []b
 
 	// The AEAD interface Open function states that the plaintext should be appended
 	// to the dst variable, so need to make some extra room
-	result, plaintext := extendSliceForAppend(dst, len(ciphertext)-self.mac.Size())
+	result, plaintext := extendSliceForAppend(dst, len(ciphertext)-self.tagSize)
 
 	// From A.1
 	// n + q = 15
@@ -250,7 +249,7 @@ func (self *ccm) Open(dst, nonce, ciphertext, additionalData []byte) (result []b
 	subtle.XORBytes(mac, mac, s0)
 
 	// Check if calculated tag matches provided tag
-	if bytes.Compare(mac, ciphertext[len(plaintext):]) != 0 {
+	if subtle.ConstantTimeCompare(mac[:self.tagSize], ciphertext[len(plaintext):]) != 1 {
 		err := fmt.Errorf("Invalid authentication tag on ciphertext")
 		log.Errorln(err)
 		return nil, err
@@ -24,6 +24,7 @@ package ccm
 import (
 	"bytes"
 	"crypto/aes"
+	"encoding/hex"
 	//"fmt"
 	"testing"
 )
@@ -64,3 +65,28 @@ func TestCCM(t *testing.T) {
 		t.Fatal("Plaintext does not match original message")
 	}
 }
+
+// RFC 3610 Packet Vector #1
+func TestCCMVector(t *testing.T) {
+	key, _ := hex.DecodeString("c0c1c2c3c4c5c6c7c8c9cacbcccdcecf")
+	nonce, _ := hex.DecodeString("00000003020100a0a1a2a3a4a5")
+	aad, _ := hex.DecodeString("0001020304050607")
+	msg, _ := hex.DecodeString("08090a0b0c0d0e0f101112131415161718191a1b1c1d1e")
+	expected, _ := hex.DecodeString("588c979a61c663d2f066d0c2c0f989806d5f6b61dac38417e8d12cfdf926e0")
+	ciph, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cMAC, err := NewCCMWithNonceAndTagSizes(ciph, len(nonce), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := cMAC.Seal(nil, nonce, msg, aad)
+	if !bytes.Equal(ciphertext, expected) {
+		t.Fatalf("Fail: %x", ciphertext)
+	}
+	plaintext, err := cMAC.Open(nil, nonce, ciphertext, aad)
+	if err != nil || !bytes.Equal(plaintext, msg) {
+		t.Fatalf("Fail: %+v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	buf, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// Example of the "Encryption in SMB 3.0: A protocol perspective" Open
+// Specifications blog post
+func TestDeriveSessionKeysSmb30(t *testing.T) {
+	sessionKey := mustDecodeHex(t, "b4546771b515f766a86735532dd6c4f0")
+	keys, err := DeriveSessionKeys(DialectSmb_3_0, sessionKey, nil, 0)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	for _, v := range []struct {
+		key      []byte
+		expected string
+	}{
+		{keys.EncryptionKey, "261b72350558f2e9dcf613070383edbf"},
+		{keys.DecryptionKey, "8fe2b57ec34d2db5b1a9727f526bbdb5"},
+		{keys.ApplicationKey, "77432f808ce99156b5bc6a3676d730d1"},
+	} {
+		if hex.EncodeToString(v.key) != v.expected {
+			t.Fatalf("Fail: %x != %s", v.key, v.expected)
+		}
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	key := mustDecodeHex(t, "b4546771b515f766a86735532dd6c4f0")
+	derived, err := DeriveKey(key, []byte("SMB2APP\x00"), []byte("SmbRpc\x00"), 128)
+	if err != nil || hex.EncodeToString(derived) != "77432f808ce99156b5bc6a3676d730d1" {
+		t.Fatalf("Fail: %x %+v", derived, err)
+	}
+	if derived, err = DeriveKey(key, nil, nil, 256); err != nil || len(derived) != 32 {
+		t.Fatalf("Fail: %x %+v", derived, err)
+	}
+	if _, err = DeriveKey(key, nil, nil, 192); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestSignMessage(t *testing.T) {
+	sessionKey := []byte("rmLENcQdFiTWfNPB")
+	pkt := mustDecodeHex(t, "fe534d42400001000000000001007f00090000000000000003000000000000000000000000000000020000007bfba3f4000000000000000000000000000000000900000048000900a1073005a0030a0100")
+	orig := bytes.Clone(pkt)
+	for _, v := range []struct {
+		dialect  uint16
+		expected string
+	}{
+		{DialectSmb_2_1, "cbdf0846d22823713b17831022646c5a"},   // HMAC-SHA256
+		{DialectSmb_3_0_2, "041393e756a048c9092c4e52dc703719"}, // AES-CMAC
+	} {
+		keys, err := DeriveSessionKeys(v.dialect, sessionKey, nil, 0)
+		if err != nil {
+			t.Fatalf("Fail: %+v", err)
+		}
+		sig, err := SignMessage(v.dialect, keys.SigningKey, pkt)
+		if err != nil {
+			t.Fatalf("Fail: %+v", err)
+		}
+		if hex.EncodeToString(sig) != v.expected || !bytes.Equal(pkt, orig) {
+			t.Fatalf("Fail: %x != %s", sig, v.expected)
+		}
+
+		// The signature field does not affect the signature
+		signed := bytes.Clone(pkt)
+		copy(signed[48:64], sig)
+		if sig2, _ := SignMessage(v.dialect, keys.SigningKey, signed); !bytes.Equal(sig, sig2) {
+			t.Fatal("Fail")
+		}
+	}
+}
+
+// TREE_CONNECT request encrypted by Windows with SMB 3.1.1 and AES-128-GCM
+func TestEncryptMessage(t *testing.T) {
+	sessionKey := mustDecodeHex(t, "7786b3244dc6c9a2fe248f283d1bfd9c")
+	preauth := mustDecodeHex(t, "c43c196e433c1af4b9851781b5d75b9a88a9c906ab3ad91a5534eae1f5f1bee8e40123d01c1e6e66e7de85b8a3fe5b259ec601643a12d77da2766d3411d72b44")
+	pkt := mustDecodeHex(t, "fe534d424000010000000000030001000800000000000000030000000000000000000000000000002d00000000f4000073d393583485c691b5a2c3c247a30af60900000048002e005c005c004400450053004b0054004f0050002d00410049004700300043003100440032005c004900500043002400")
+	encPkt := mustDecodeHex(t, "fd534d423dc67abf69d28813787809d56b45ba1fa0e51adb8ef5a1990446dfa30000000076000000000001000000000000000000a072f47625bc2bf582258bd85f4e5f216052bf7e5d209beb5b50065205c347e0bbb4caac101ef4d3769233b436f4b270c43f15f067dedbe3fdacf9595ce16d3851f013f22972277bae3bf5acee4591d16004880c2b90c3c2ccbfefb94f8525e814e4c42570e40d2af1e75ef90350b17c85c8d359a48c")
+
+	keys, err := DeriveSessionKeys(DialectSmb_3_1_1, sessionKey, preauth, AES128GCM)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	plaintext, err := DecryptMessage(AES128GCM, keys.EncryptionKey, encPkt)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if !bytes.Equal(pkt, plaintext) {
+		t.Fatalf("Fail: %x", plaintext)
+	}
+
+	// The same nonce must reproduce the message byte for byte
+	ciphertext, err := EncryptMessage(AES128GCM, keys.EncryptionKey, encPkt[20:32], 0, pkt)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if !bytes.Equal(encPkt, ciphertext) {
+		t.Fatalf("Fail: %x", ciphertext)
+	}
+
+	// Tampering is detected
+	encPkt[60] ^= 1
+	if _, err = DecryptMessage(AES128GCM, keys.EncryptionKey, encPkt); err == nil {
+		t.Fatal("Fail")
+	}
+	if _, err = DecryptMessage(AES128GCM, keys.EncryptionKey, encPkt[:40]); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestEncryptMessageRoundTrip(t *testing.T) {
+	msg := []byte("fe534d42 message body")
+	for _, cipherId := range []uint16{AES128CCM, AES128GCM, AES256CCM, AES256GCM} {
+		keys, err := DeriveSessionKeys(DialectSmb_3_1_1, []byte("YELLOW SUBMARINE"), make([]byte, 64), cipherId)
+		if err != nil {
+			t.Fatalf("Fail: %+v", err)
+		}
+		nonce := make([]byte, 12)
+		if cipherId == AES128CCM || cipherId == AES256CCM {
+			nonce = nonce[:11]
+		}
+		buf, err := EncryptMessage(cipherId, keys.EncryptionKey, nonce, 0x1122, msg)
+		if err != nil {
+			t.Fatalf("Fail: %+v", err)
+		}
+		plaintext, err := DecryptMessage(cipherId, keys.EncryptionKey, buf)
+		if err != nil || !bytes.Equal(plaintext, msg) {
+			t.Fatalf("Fail: %d %+v", cipherId, err)
+		}
+		if _, err = EncryptMessage(cipherId, keys.EncryptionKey, make([]byte, 16), 0, msg); err == nil {
+			t.Fatal("Fail")
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dcerpc
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/ericblavier/go-smb/ntlmssp"
+	"github.com/ericblavier/go-smb/smb"
+)
+
+// MS-RPCE Section 2.2.1.1.8 Authentication Levels
+const (
+	AuthLevelDefault      uint8 = 0
+	AuthLevelNone         uint8 = 1
+	AuthLevelConnect      uint8 = 2
+	AuthLevelCall         uint8 = 3
+	AuthLevelPkt          uint8 = 4
+	AuthLevelPktIntegrity uint8 = 5
+	AuthLevelPktPrivacy   uint8 = 6
+)
+
+// MS-RPCE Section 2.2.1.1.7 Security Providers
+const (
+	AuthTypeNone         uint8 = 0
+	AuthTypeGSSNegotiate uint8 = 9
+	AuthTypeWinNT        uint8 = 10 // NTLM
+	AuthTypeGSSKerberos  uint8 = 16
+)
+
+// Size of the sec_trailer that precedes the auth_value of an authenticated PDU
+const secTrailerSize int = 8
+
+// Size of an NTLM message signature
+const ntlmSignatureSize int = 16
+
+// Auth padding is applied so that the sec_trailer starts on a 16 byte boundary
+const authPadAlignment int = 16
+
+type authContext struct {
+	authType  uint8
+	authLevel uint8
+	contextId uint32
+	ntlm      *ntlmssp.Client
+	sendSeq   uint32
+	recvSeq   uint32
+}
+
+// BindAuth performs a DCERPC bind that is authenticated with NTLM at the
+// requested authentication level. For levels above AuthLevelConnect, every
+// request and response on the returned ServiceBind is signed, and for
+// AuthLevelPktPrivacy also encrypted.
+// The client must be a freshly created ntlmssp.Client that has not yet been
+// used for any authentication.
+func BindAuth(f *smb.File, interface_uuid string, majorVersion, minorVersion uint16, transfer_uuid string, authLevel uint8, client *ntlmssp.Client) (bind *ServiceBind, err error) {
+	log.Debugln("In BindAuth")
+	if f == nil {
+		return nil, fmt.Errorf("File argument cannot be nil")
+	}
+	if !f.IsOpen() {
+		return nil, fmt.Errorf("File must be opened before calling Bind")
+	}
+	return bindAuth(&pipeTransport{f: f}, interface_uuid, majorVersion, minorVersion, transfer_uuid, authLevel, client)
+}
+
+// BindAuthTCP performs a DCERPC bind over an established TCP connection that
+// is authenticated with NTLM at the requested authentication level.
+// See BindAuth for details.
+func BindAuthTCP(conn net.Conn, interface_uuid string, majorVersion, minorVersion uint16, transfer_uuid string, authLevel uint8, client *ntlmssp.Client) (bind *ServiceBind, err error) {
+	log.Debugln("In BindAuthTCP")
+	if conn == nil {
+		return nil, fmt.Errorf("Connection argument cannot be nil")
+	}
+	return bindAuth(NewTCPTransport(conn), interface_uuid, majorVersion, minorVersion, transfer_uuid, authLevel, client)
+}
+
+func bindAuth(t Transport, interface_uuid string, majorVersion, minorVersion uint16, transfer_uuid string, authLevel uint8, client *ntlmssp.Client) (bind *ServiceBind, err error) {
+	if client == nil {
+		return nil, fmt.Errorf("NTLM client argument cannot be nil")
+	}
+	if authLevel < AuthLevelConnect || authLevel > AuthLevelPktPrivacy {
+		return nil, fmt.Errorf("Unsupported authentication level: %d", authLevel)
+	}
+	if authLevel == AuthLevelPktPrivacy {
+		client.RequestSeal = true
+	}
+	auth := &authContext{
+		authType:  AuthTypeWinNT,
+		authLevel: authLevel,
+		contextId: 0,
+		ntlm:      client,
+	}
+	return bindInterface(t, interface_uuid, majorVersion, minorVersion, transfer_uuid, auth)
+}
+
+func (self *authContext) trailer(padLength int) SecTrailer {
+	return SecTrailer{
+		AuthType:      self.authType,
+		AuthLevel:     self.authLevel,
+		AuthPadLength: byte(padLength),
+		AuthContextId: self.contextId,
+	}
+}
+
+// newAuth3Req builds the third leg of the authentication handshake carrying
+// the NTLM Authenticate message.
+func (self *authContext) newAuth3Req(callId uint32, token []byte) *Auth3Req {
+	header := newHeader()
+	header.Type = PacketTypeAuth3
+	header.CallId = callId
+	header.FragLength = uint16(PDUHeaderCommonSize + 4 + secTrailerSize + len(token))
+	header.AuthLength = uint16(len(token))
+	return &Auth3Req{
+		Header:     header,
+		SecTrailer: self.trailer(0),
+		AuthValue:  token,
+	}
+}
+
+// wrapRequest encodes a request PDU and, depending on the authentication
+// level, appends a sec_trailer and signature and encrypts the stub data.
+func (self *authContext) wrapRequest(req *RequestReq) (pdu []byte, err error) {
+	hdrLen := req.headerLength()
+	if self.authLevel < AuthLevelPktIntegrity {
+		req.FragLength = uint16(len(req.Buffer) + hdrLen)
+		return req.MarshalBinary()
+	}
+
+	stubLen := len(req.Buffer)
+	padLength := (authPadAlignment - (stubLen % authPadAlignment)) % authPadAlignment
+	req.Buffer = append(req.Buffer, make([]byte, padLength)...)
+	req.FragLength = uint16(hdrLen + len(req.Buffer) + secTrailerSize + ntlmSignatureSize)
+	req.AuthLength = uint16(ntlmSignatureSize)
+
+	pdu, err = req.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	trailer := self.trailer(padLength)
+	tBuf, err := trailer.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	pdu = append(pdu, tBuf...)
+
+	session := self.ntlm.Session()
+	if session == nil {
+		return nil, fmt.Errorf("NTLM authentication has not been completed")
+	}
+	body := pdu[hdrLen : hdrLen+len(req.Buffer)]
+	var sealed []byte
+	if self.authLevel == AuthLevelPktPrivacy {
+		// The stub is encrypted first and the signature is then calculated
+		// over the entire PDU with the plaintext stub.
+		sealed = session.Encrypt(nil, body)
+	}
+	signature, seq := session.Sum(pdu, self.sendSeq)
+	if len(signature) != ntlmSignatureSize {
+		return nil, fmt.Errorf("Failed to calculate NTLM signature for DCERPC request")
+	}
+	self.sendSeq = seq
+	if sealed != nil {
+		copy(body, sealed)
+	}
+	pdu = append(pdu, signature...)
+
+	return
+}
+
+// unwrapResponse verifies and decrypts a response fragment and returns its
+// stub data with any auth padding removed.
+func (self *authContext) unwrapResponse(pdu []byte, header *Header) (stub []byte, err error) {
+	fragLength := int(header.FragLength)
+	authLength := int(header.AuthLength)
+	if fragLength > len(pdu) {
+		return nil, fmt.Errorf("DCERPC response fragment is truncated")
+	}
+	if authLength == 0 {
+		if self.authLevel >= AuthLevelPktIntegrity {
+			return nil, fmt.Errorf("Expected an authenticated DCERPC response but no auth verifier was present")
+		}
+		return pdu[24:fragLength], nil
+	}
+
+	trailerOffset := fragLength - authLength - secTrailerSize
+	if trailerOffset < 24 {
+		return nil, fmt.Errorf("Invalid auth length %d in DCERPC response", authLength)
+	}
+	var trailer SecTrailer
+	err = trailer.UnmarshalBinary(pdu[trailerOffset:])
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if int(trailer.AuthPadLength) > trailerOffset-24 {
+		return nil, fmt.Errorf("Invalid auth pad length %d in DCERPC response", trailer.AuthPadLength)
+	}
+	if self.authLevel < AuthLevelPktIntegrity {
+		return pdu[24 : trailerOffset-int(trailer.AuthPadLength)], nil
+	}
+
+	session := self.ntlm.Session()
+	signed := make([]byte, fragLength-authLength)
+	copy(signed, pdu[:fragLength-authLength])
+	body := signed[24:trailerOffset]
+	if self.authLevel == AuthLevelPktPrivacy {
+		session.Decrypt(body[:0], body)
+	}
+	ok, _ := session.CheckSum(pdu[fragLength-authLength:fragLength], signed, self.recvSeq)
+	if !ok {
+		return nil, fmt.Errorf("Invalid signature on DCERPC response")
+	}
+	self.recvSeq++
+
+	return body[:len(body)-int(trailer.AuthPadLength)], nil
+}
+
+func (self *authContext) sessionKey() []byte {
+	session := self.ntlm.Session()
+	if session == nil {
+		return nil
+	}
+	return session.SessionKey()
+}
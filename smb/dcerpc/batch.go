@@ -0,0 +1,122 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package dcerpc
+
+import (
+	"fmt"
+)
+
+// Max number of requests of a batch that are sent before waiting for a
+// response
+var BatchWindow = 16
+
+// A request to send as part of a batch
+type BatchRequest struct {
+	Opnum  uint16
+	Object []byte // Optional object UUID
+	Buffer []byte
+}
+
+// The response to a BatchRequest. Err is set if the server responded with a
+// fault for the call.
+type BatchResponse struct {
+	Buffer []byte
+	Err    error
+}
+
+// MakeBatchRequest sends the requests back-to-back without waiting for each
+// response, keeping at most BatchWindow calls outstanding, and matches the
+// responses to the requests by call ID. This saves a round trip per request on
+// high latency links. The responses are returned in the order of the
+// requests. A fault for one call does not abort the batch, but a transport
+// error does.
+func (sb *ServiceBind) MakeBatchRequest(reqs []BatchRequest) (responses []BatchResponse, err error) {
+	responses = make([]BatchResponse, len(reqs))
+	if len(reqs) == 0 {
+		return
+	}
+	window := BatchWindow
+	if window < 1 {
+		window = 1
+	}
+
+	pending := make(map[uint32]int) // CallId to index of request
+	next := 0
+	for next < len(reqs) || len(pending) > 0 {
+		for next < len(reqs) && len(pending) < window {
+			req := reqs[next]
+			if req.Object != nil && len(req.Object) != 16 {
+				err = fmt.Errorf("Object UUID must be 16 bytes")
+				return
+			}
+			callId := sb.callId.Add(1)
+			var buf []byte
+			buf, err = sb.newRequestPDU(callId, req.Opnum, req.Object, req.Buffer)
+			if err != nil {
+				log.Errorln(err)
+				return
+			}
+			err = sb.t.Write(buf)
+			if err != nil {
+				log.Errorln(err)
+				return
+			}
+			pending[callId] = next
+			next++
+		}
+
+		var responseBuffer []byte
+		responseBuffer, err = sb.t.Read(int(sb.maxFragReceiveSize))
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		header, stub, e := sb.decodeResponseFragment(responseBuffer)
+		index, found := pending[header.CallId]
+		if !found {
+			if e != nil {
+				err = e
+			} else {
+				err = fmt.Errorf("Received response with unexpected CallId %d in batch", header.CallId)
+			}
+			log.Errorln(err)
+			return
+		}
+		if e != nil {
+			log.Debugf("Call %d of batch failed: %s\n", index, e)
+			responses[index] = BatchResponse{Err: e}
+			delete(pending, header.CallId)
+			continue
+		}
+		if len(stub) > MaxResponseSize-len(responses[index].Buffer) {
+			// The remaining fragments can't be skipped so the batch is aborted
+			err = fmt.Errorf("DCERPC response exceeds the limit of %d bytes", MaxResponseSize)
+			log.Errorln(err)
+			return
+		}
+		responses[index].Buffer = append(responses[index].Buffer, stub...)
+		if (header.Flags & PfcLastFrag) == PfcLastFrag {
+			delete(pending, header.CallId)
+		}
+	}
+	return
+}
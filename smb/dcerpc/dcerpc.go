@@ -31,24 +31,26 @@ package dcerpc
 
 import (
 	"encoding/binary"
-	"encoding/hex"
 	"fmt"
-	"regexp"
-	"strconv"
-	"strings"
+	"net"
 	"sync/atomic"
 
+	"github.com/ericblavier/go-smb/msdtyp"
 	"github.com/ericblavier/go-smb/smb"
 	"github.com/jfjallid/golog"
 )
 
 var (
 	MSRPCUuidNdr                  = "8a885d04-1ceb-11c9-9fe8-08002b104860" // NDR Transfer Syntax version 2.0
-	re           regexp.Regexp    = *regexp.MustCompile(`([\dA-Fa-f]{8})-([\dA-Fa-f]{4})-([\dA-Fa-f]{4})-([\dA-Fa-f]{4})-([\dA-Fa-f]{4})([\dA-Fa-f]{8})`)
 	le           binary.ByteOrder = binary.LittleEndian
 	log                           = golog.Get("github.com/ericblavier/go-smb/smb/dcerpc")
 )
 
+// MaxResponseSize limits the size of a response reassembled from multiple
+// fragments, such that a hostile or buggy server cannot make the client
+// allocate excessive amounts of memory
+var MaxResponseSize = 64 * 1024 * 1024
+
 const (
 	ErrorSuccess         uint32 = 0x00000000
 	ErrorAccessDenied    uint32 = 0x00000005
@@ -71,6 +73,10 @@ const (
 	PacketTypeFault    uint8 = 3
 	PacketTypeBind     uint8 = 11
 	PacketTypeBindAck  uint8 = 12
+	PacketTypeBindNak  uint8 = 13
+	PacketTypeAlterCtx uint8 = 14
+	PacketTypeAlterRes uint8 = 15
+	PacketTypeAuth3    uint8 = 16
 )
 
 // C706 Section 12.6.3.1 PFC Flags
@@ -119,68 +125,15 @@ func newHeader() Header {
 	}
 }
 
-func uuid_to_bin(uuid string) ([]byte, error) {
-	//log.Debugln("In uuid_to_bin")
-
-	if !strings.ContainsRune(uuid, '-') {
-		return hex.DecodeString(uuid)
-	}
-
-	// Assume Variant 2 UUID
-	matches := re.FindAllStringSubmatch(uuid, -1)
-	if (len(matches) == 0) || (len(matches[0]) != 7) {
-		return nil, fmt.Errorf("Failed to parse UUID v2 string")
-	}
-	uuid1, uuid2, uuid3, uuid4, uuid5, uuid6 := matches[0][1], matches[0][2], matches[0][3], matches[0][4], matches[0][5], matches[0][6]
-	buf := make([]byte, 0)
-	n, err := strconv.ParseUint(uuid1, 16, 32)
-	if err != nil {
-		return nil, err
-	}
-	buf = binary.LittleEndian.AppendUint32(buf, uint32(n))
-	n, err = strconv.ParseUint(uuid2, 16, 16)
-	if err != nil {
-		return nil, err
-	}
-
-	buf = binary.LittleEndian.AppendUint16(buf, uint16(n))
-	n, err = strconv.ParseUint(uuid3, 16, 16)
-	if err != nil {
-		return nil, err
-	}
-
-	buf = binary.LittleEndian.AppendUint16(buf, uint16(n))
-	n, err = strconv.ParseUint(uuid4, 16, 16)
-	if err != nil {
-		return nil, err
-	}
-
-	buf = binary.BigEndian.AppendUint16(buf, uint16(n))
-	n, err = strconv.ParseUint(uuid5, 16, 16)
-	if err != nil {
-		return nil, err
-	}
-
-	buf = binary.BigEndian.AppendUint16(buf, uint16(n))
-	n, err = strconv.ParseUint(uuid6, 16, 32)
-	if err != nil {
-		return nil, err
-	}
-
-	buf = binary.BigEndian.AppendUint32(buf, uint32(n))
-
-	return buf, nil
-}
-
 func newBindReq(callId uint32, interface_uuid string, majorVersion, minorVersion uint16, transfer_uuid string, maxTransmitSize, maxRecvSize uint16) (req *BindReq, err error) {
 	log.Debugln("In newBindReq")
 
-	srsv_uuid, err := uuid_to_bin(interface_uuid)
+	srsv_uuid, err := msdtyp.GuidFromString(interface_uuid)
 	if err != nil {
 		log.Errorln(err)
 		return
 	}
-	ndr_uuid, err := uuid_to_bin(transfer_uuid)
+	ndr_uuid, err := msdtyp.GuidFromString(transfer_uuid)
 	if err != nil {
 		log.Errorln(err)
 		return
@@ -238,6 +191,19 @@ func Bind(f *smb.File, interface_uuid string, majorVersion, minorVersion uint16,
 	if !f.IsOpen() {
 		return nil, fmt.Errorf("File must be opened before calling Bind")
 	}
+	return bindInterface(&pipeTransport{f: f}, interface_uuid, majorVersion, minorVersion, transfer_uuid, nil)
+}
+
+// BindTCP performs a DCERPC bind over an established TCP connection.
+func BindTCP(conn net.Conn, interface_uuid string, majorVersion, minorVersion uint16, transfer_uuid string) (bind *ServiceBind, err error) {
+	log.Debugln("In BindTCP")
+	if conn == nil {
+		return nil, fmt.Errorf("Connection argument cannot be nil")
+	}
+	return bindInterface(NewTCPTransport(conn), interface_uuid, majorVersion, minorVersion, transfer_uuid, nil)
+}
+
+func bindInterface(t Transport, interface_uuid string, majorVersion, minorVersion uint16, transfer_uuid string, auth *authContext) (sb *ServiceBind, err error) {
 	callId := atomic.Uint32{}
 	maxFragRxSize := uint16(4280)
 	maxFragTxSize := uint16(4280)
@@ -246,23 +212,39 @@ func Bind(f *smb.File, interface_uuid string, majorVersion, minorVersion uint16,
 		return
 	}
 
-	buf, err := bindReq.MarshalBinary()
-	if err != nil {
-		return
+	var authToken []byte
+	if auth != nil {
+		authToken, err = auth.ntlm.Negotiate()
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		bindReq.FragLength += uint16(secTrailerSize + len(authToken))
+		bindReq.AuthLength = uint16(len(authToken))
 	}
 
-	ioCtlReq, err := f.NewIoCTLReq(smb.FsctlPipeTransceive, buf)
+	buf, err := bindReq.MarshalBinary()
 	if err != nil {
 		return
 	}
+	if auth != nil {
+		trailer := auth.trailer(0)
+		var tBuf []byte
+		tBuf, err = trailer.MarshalBinary()
+		if err != nil {
+			return
+		}
+		buf = append(buf, tBuf...)
+		buf = append(buf, authToken...)
+	}
 
-	ioCtlRes, err := f.WriteIoCtlReq(ioCtlReq)
+	resBuf, err := t.Transceive(buf)
 	if err != nil {
 		return
 	}
 
 	var bindRes BindRes
-	err = bindRes.UnmarshalBinary(ioCtlRes.Buffer)
+	err = bindRes.UnmarshalBinary(resBuf)
 	if err != nil {
 		return
 	}
@@ -295,136 +277,179 @@ func Bind(f *smb.File, interface_uuid string, majorVersion, minorVersion uint16,
 		return nil, fmt.Errorf("Server did not approve bind request with reason: \"%s\"\n", errMsg)
 	}
 
+	if auth != nil {
+		if bindRes.AuthLength == 0 || int(bindRes.FragLength) > len(resBuf) || int(bindRes.AuthLength) > int(bindRes.FragLength) {
+			return nil, fmt.Errorf("Server did not respond with a valid auth verifier in the bind ack")
+		}
+		challenge := resBuf[bindRes.FragLength-bindRes.AuthLength : bindRes.FragLength]
+		var authenticate []byte
+		authenticate, err = auth.ntlm.Authenticate(challenge)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		auth3 := auth.newAuth3Req(bindReq.CallId, authenticate)
+		buf, err = auth3.MarshalBinary()
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		// The server does not respond to the AUTH3 PDU so it is written
+		// instead of transceived.
+		err = t.Write(buf)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+
 	return &ServiceBind{
 		callId:              &callId,
-		f:                   f,
+		t:                   t,
 		maxFragReceiveSize:  bindRes.MaxSendFragSize,
 		maxFragTransmitSize: bindRes.MaxRecvFragSize,
+		auth:                auth,
 	}, nil
 }
 
+// GetSessionKey returns the session key of the DCERPC layer authentication if
+// the bind was authenticated, and otherwise the SMB session key.
 func (sb *ServiceBind) GetSessionKey() (sessionKey []byte) {
-	return sb.f.GetSessionKey()
+	if sb.auth != nil {
+		return sb.auth.sessionKey()
+	}
+	return sb.t.SessionKey()
 }
 
 func (sb *ServiceBind) MakeIoCtlRequest(opcode uint16, innerBuf []byte) (result []byte, err error) {
+	return sb.makeRequest(opcode, nil, innerBuf)
+}
+
+// MakeObjectRequest sends a request to the object identified by the object
+// UUID, e.g., the IPID of a DCOM interface pointer.
+func (sb *ServiceBind) MakeObjectRequest(opcode uint16, object []byte, innerBuf []byte) (result []byte, err error) {
+	if len(object) != 16 {
+		return nil, fmt.Errorf("Object UUID must be 16 bytes")
+	}
+	return sb.makeRequest(opcode, object, innerBuf)
+}
+
+func (sb *ServiceBind) makeRequest(opcode uint16, object []byte, innerBuf []byte) (result []byte, err error) {
 	callId := sb.callId.Add(1)
-	fragmentedResponse := false
+	buf, err := sb.newRequestPDU(callId, opcode, object, innerBuf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
 
+	responseBuffer, err := sb.t.Transceive(buf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
 	for {
 		var resHeader Header
-		var responseBuffer []byte
-		if !fragmentedResponse {
-			var req *RequestReq
-			req, err = newRequestReq(callId, opcode)
-			if err != nil {
-				log.Errorln(err)
-				return
-			}
-
-			req.Buffer = make([]byte, len(innerBuf))
-			copy(req.Buffer, innerBuf)
-			req.FragLength = uint16(len(innerBuf) + 24) // Includes header size
-
-			// Encode DCERPC Request
-			var buf []byte
-			buf, err = req.MarshalBinary()
-			if err != nil {
-				log.Errorln(err)
-				return
-			}
-
-			var ioCtlReq *smb.IoCtlReq
-			ioCtlReq, err = sb.f.NewIoCTLReq(smb.FsctlPipeTransceive, buf)
-			if err != nil {
-				log.Errorln(err)
-				return
-			}
-
-			//NOTE Might be a problem with exceeding a max payload size of 65536 for
-			// servers that do not support multi-credit requests
-			var ioCtlRes smb.IoCtlRes
-			// Send DCERPC request inside SMB IoCTL Request
-			ioCtlRes, err = sb.f.WriteIoCtlReq(ioCtlReq)
-			if err != nil {
-				log.Errorln(err)
-				return
-			}
-			responseBuffer = ioCtlRes.Buffer
-		} else {
-			var n int
-			responseBuffer = make([]byte, sb.maxFragReceiveSize+16) // 16 bytes overhead of read request
-			n, err = sb.f.ReadFile(responseBuffer, 0)
-			if err != nil {
-				log.Errorln(err)
-				return
-			}
-			responseBuffer = responseBuffer[:n]
-		}
-
-		if len(responseBuffer) < PDUHeaderCommonSize {
-			err = fmt.Errorf("Read/IoCtl response on DCERPC fragment was smaller than the DCERPC header size")
-			log.Errorln(err)
-			return
-		}
-
-		// Unmarshal DCERPC Request response
-		err = resHeader.UnmarshalBinary(responseBuffer[:PDUHeaderCommonSize])
+		var stub []byte
+		resHeader, stub, err = sb.decodeResponseFragment(responseBuffer)
 		if err != nil {
 			log.Errorln(err)
 			return
 		}
-
 		if resHeader.CallId != callId {
 			err = fmt.Errorf("Incorrect CallId on response. Sent %d and received %d\n", callId, resHeader.CallId)
 			log.Errorln(err)
 			return
 		}
-
-		if resHeader.Type == PacketTypeFault {
-			if len(responseBuffer) >= (PDUHeaderCommonSize + 12) {
-				returnCode := binary.LittleEndian.Uint32(responseBuffer[PDUHeaderCommonSize+8:])
-				status, found := responseCodeMap[returnCode]
-				if !found {
-					err = fmt.Errorf("DCERPC Fault PDU received with status: 0x%x", returnCode)
-					log.Errorln(err)
-					return
-				}
-				err = fmt.Errorf("DCERPC Fault PDU received with status: %s", status)
-				log.Errorln(err)
-				return
-			} else {
-				err = fmt.Errorf("DCERPC Fault PDU received but incomplete: %+v, full buffer: %x", resHeader, responseBuffer)
-			}
+		if len(stub) > MaxResponseSize-len(result) {
+			err = fmt.Errorf("DCERPC response exceeds the limit of %d bytes", MaxResponseSize)
 			log.Errorln(err)
-			return
-		} else if resHeader.Type != PacketTypeResponse {
-			err = fmt.Errorf("DCERPC Unexpected PDU received with type: %d", resHeader.Type)
-			log.Errorln(err)
-			return
+			return nil, err
 		}
-
-		if len(responseBuffer) < int(resHeader.FragLength) {
-			err = fmt.Errorf("DCERPC response fragment is less that specified fragment lengh. Received %d bytes from ReadRequest, but FragLength field specifies %d bytes!", len(responseBuffer), resHeader.FragLength)
-			log.Errorln(err)
-			return
+		result = append(result, stub...)
+		if (resHeader.Flags & PfcLastFrag) == PfcLastFrag {
+			break
 		}
 
-		// Time to unpack the Response PDU
-		var reqRes RequestRes
-		err = reqRes.UnmarshalBinary(responseBuffer)
+		// Request the next fragment
+		responseBuffer, err = sb.t.Read(int(sb.maxFragReceiveSize))
 		if err != nil {
 			log.Errorln(err)
 			return
 		}
-		result = append(result, reqRes.Buffer...)
-		if (reqRes.Flags & PfcLastFrag) == PfcLastFrag {
-			break
+	}
+
+	return
+}
+
+// Encode a Request PDU, signed or sealed if the bind was authenticated
+func (sb *ServiceBind) newRequestPDU(callId uint32, opcode uint16, object []byte, innerBuf []byte) (buf []byte, err error) {
+	req, err := newRequestReq(callId, opcode)
+	if err != nil {
+		return
+	}
+	if object != nil {
+		req.Flags |= PfcObjectUUID
+		req.ObjectUuid = object
+	}
+
+	req.Buffer = make([]byte, len(innerBuf))
+	copy(req.Buffer, innerBuf)
+	req.FragLength = uint16(len(innerBuf) + req.headerLength()) // Includes header size
+
+	// Encode DCERPC Request
+	if sb.auth != nil {
+		return sb.auth.wrapRequest(req)
+	}
+	return req.MarshalBinary()
+}
+
+// Decode a response fragment and return its header along with the stub data
+// it carries. Fault PDUs are returned as an error together with the header so
+// that the failed call can be identified.
+func (sb *ServiceBind) decodeResponseFragment(responseBuffer []byte) (resHeader Header, stub []byte, err error) {
+	if len(responseBuffer) < PDUHeaderCommonSize {
+		err = fmt.Errorf("Read/IoCtl response on DCERPC fragment was smaller than the DCERPC header size")
+		return
+	}
+
+	// Unmarshal DCERPC Request response
+	err = resHeader.UnmarshalBinary(responseBuffer[:PDUHeaderCommonSize])
+	if err != nil {
+		return
+	}
+
+	if resHeader.Type == PacketTypeFault {
+		if len(responseBuffer) >= (PDUHeaderCommonSize + 12) {
+			returnCode := binary.LittleEndian.Uint32(responseBuffer[PDUHeaderCommonSize+8:])
+			status, found := responseCodeMap[returnCode]
+			if !found {
+				err = fmt.Errorf("DCERPC Fault PDU received with status: 0x%x", returnCode)
+				return
+			}
+			err = fmt.Errorf("DCERPC Fault PDU received with status: %s", status)
+		} else {
+			err = fmt.Errorf("DCERPC Fault PDU received but incomplete: %+v, full buffer: %x", resHeader, responseBuffer)
 		}
+		return
+	} else if resHeader.Type != PacketTypeResponse {
+		err = fmt.Errorf("DCERPC Unexpected PDU received with type: %d", resHeader.Type)
+		return
+	}
 
-		fragmentedResponse = true
-		// Request the next fragment
+	if len(responseBuffer) < int(resHeader.FragLength) {
+		err = fmt.Errorf("DCERPC response fragment is less that specified fragment lengh. Received %d bytes from ReadRequest, but FragLength field specifies %d bytes!", len(responseBuffer), resHeader.FragLength)
+		return
 	}
 
-	return
+	// Time to unpack the Response PDU
+	var reqRes RequestRes
+	err = reqRes.UnmarshalBinary(responseBuffer)
+	if err != nil {
+		return
+	}
+	if sb.auth != nil {
+		stub, err = sb.auth.unwrapResponse(responseBuffer, &reqRes.Header)
+		return
+	}
+	return resHeader, reqRes.Buffer, nil
 }
@@ -24,6 +24,7 @@ package dcerpc
 import (
 	"bytes"
 	"encoding/hex"
+	"sync/atomic"
 
 	"testing"
 )
@@ -127,3 +128,149 @@ func TestBindRes(t *testing.T) {
 		t.Fatal("Fail")
 	}
 }
+
+func TestBindResAlignedSecAddr(t *testing.T) {
+	// The secondary address ends on a 4-byte boundary so no padding follows
+	resPkt, err := hex.DecodeString("05000c03100000004000000001000000b810b810d75400000a005c504950455c616263000100000000000000045d888aeb1cc9119fe808002b10486002000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res BindRes
+	err = res.UnmarshalBinary(resPkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res.SecAddr, []byte("\\PIPE\\abc\x00")) {
+		t.Fatalf("Fail: %q", res.SecAddr)
+	}
+	if res.ResultList.Results != 1 || res.ResultList.Items[0].Result != acceptance || res.ResultList.Items[0].TransferSyntax.Version != 2 {
+		t.Fatalf("Fail: %+v", res.ResultList)
+	}
+}
+
+func TestEpmTower(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("050013000d74c0d8cce5d0404a92b4d074faa6ba2801000200010013000d045d888aeb1cc9119fe808002b10486002000200000001000b0200000001000702000000010009040000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tower, err := newTcpTower("ccd8c074-d0e5-4a40-92b4-d074faa6ba28", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tower, pkt) {
+		t.Fatal("Fail")
+	}
+
+	pkt, err = hex.DecodeString("050013000d74c0d8cce5d0404a92b4d074faa6ba2801000200010013000d045d888aeb1cc9119fe808002b10486002000200000001000b020000000100070200c3510100090400c0a80101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := tcpPortFromTower(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != 50001 {
+		t.Fatal("Fail")
+	}
+}
+
+// Transport that records written PDUs and returns canned response fragments
+type mockTransport struct {
+	written   [][]byte
+	responses [][]byte
+}
+
+func (self *mockTransport) Transceive(pdu []byte) ([]byte, error) {
+	self.written = append(self.written, pdu)
+	return self.Read(0)
+}
+
+func (self *mockTransport) Write(pdu []byte) error {
+	self.written = append(self.written, pdu)
+	return nil
+}
+
+func (self *mockTransport) Read(maxSize int) ([]byte, error) {
+	res := self.responses[0]
+	self.responses = self.responses[1:]
+	return res, nil
+}
+
+func (self *mockTransport) SessionKey() []byte {
+	return nil
+}
+
+func TestMakeBatchRequest(t *testing.T) {
+	var responses [][]byte
+	// Call 2 is answered first, call 1 in two fragments and call 3 with a fault
+	for _, s := range []string{
+		"05000203100000001c000000020000000400000000000000bbbbbbbb",
+		"05000201100000001a000000010000000200000000000000aaaa",
+		"05000202100000001a000000010000000200000000000000aaaa",
+		"0500030310000000200000000300000000000000000000000200011c00000000",
+	} {
+		pkt, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, pkt)
+	}
+	mt := &mockTransport{responses: responses}
+	callId := atomic.Uint32{}
+	sb := &ServiceBind{callId: &callId, t: mt, maxFragReceiveSize: 4280}
+
+	res, err := sb.MakeBatchRequest([]BatchRequest{{Opnum: 1}, {Opnum: 2}, {Opnum: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mt.written) != 3 || len(res) != 3 {
+		t.Fatal("Fail")
+	}
+	if !bytes.Equal(res[0].Buffer, []byte{0xaa, 0xaa, 0xaa, 0xaa}) || res[0].Err != nil {
+		t.Fatal("Fail")
+	}
+	if !bytes.Equal(res[1].Buffer, []byte{0xbb, 0xbb, 0xbb, 0xbb}) || res[1].Err != nil {
+		t.Fatal("Fail")
+	}
+	if res[2].Err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	var responses [][]byte
+	// Call 1 is answered in two fragments of 2 bytes each
+	for _, s := range []string{
+		"05000201100000001a000000010000000200000000000000aaaa",
+		"05000202100000001a000000010000000200000000000000aaaa",
+	} {
+		pkt, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, pkt)
+	}
+	defer func(size int) { MaxResponseSize = size }(MaxResponseSize)
+	MaxResponseSize = 3
+
+	callId := atomic.Uint32{}
+	sb := &ServiceBind{callId: &callId, t: &mockTransport{responses: responses}, maxFragReceiveSize: 4280}
+	if _, err := sb.MakeIoCtlRequest(1, nil); err == nil {
+		t.Fatal("Fail")
+	}
+
+	callId.Store(0)
+	sb.t = &mockTransport{responses: responses}
+	if _, err := sb.MakeBatchRequest([]BatchRequest{{Opnum: 1}}); err == nil {
+		t.Fatal("Fail")
+	}
+
+	MaxResponseSize = 4
+	callId.Store(0)
+	sb.t = &mockTransport{responses: responses}
+	res, err := sb.MakeIoCtlRequest(1, nil)
+	if err != nil || len(res) != 4 {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,238 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dcerpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+const (
+	MSRPCUuidEpm                = "e1af8308-5d1f-11c9-91a4-08002b14a0fa"
+	MSRPCEpmMajorVersion uint16 = 3
+	MSRPCEpmMinorVersion uint16 = 0
+	// TCP port of the endpoint mapper
+	EpmPort = 135
+)
+
+// MSRPC Endpoint Mapper Operations
+const (
+	EpmEptMap uint16 = 3
+)
+
+// C706 Appendix I Protocol identifiers of tower floors
+const (
+	epmProtocolUuid  byte = 0x0d
+	epmProtocolNcacn byte = 0x0b
+	epmProtocolTcp   byte = 0x07
+	epmProtocolIp    byte = 0x09
+)
+
+const (
+	EpmStatusOk            uint32 = 0x00000000
+	EpmStatusNotRegistered uint32 = 0x16c9a0d6 // There are no more endpoints available from the endpoint mapper
+)
+
+// C706 Section 2.10 ept_map
+type EptMapReq struct {
+	Tower     []byte
+	MaxTowers uint32
+}
+
+type EptMapRes struct {
+	Towers [][]byte
+	Status uint32
+}
+
+func (self *EptMapReq) MarshalBinary() (res []byte, err error) {
+	w := bytes.NewBuffer(res)
+	// Object ptr to the nil UUID
+	binary.Write(w, le, uint32(1))
+	w.Write(make([]byte, 16))
+	// Map tower ptr
+	binary.Write(w, le, uint32(2))
+	binary.Write(w, le, uint32(len(self.Tower))) // MaxCount
+	binary.Write(w, le, uint32(len(self.Tower))) // tower_length
+	w.Write(self.Tower)
+	w.Write(make([]byte, (4-len(self.Tower)%4)%4))
+	// Entry handle
+	w.Write(make([]byte, 20))
+	binary.Write(w, le, self.MaxTowers)
+	return w.Bytes(), nil
+}
+
+func (self *EptMapReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of EptMapReq")
+}
+
+func (self *EptMapRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of EptMapRes")
+}
+
+func (self *EptMapRes) UnmarshalBinary(buf []byte) (err error) {
+	if len(buf) < 40 {
+		return fmt.Errorf("Buffer to small for EptMapRes")
+	}
+	r := bytes.NewReader(buf[20:]) // Skip the entry handle
+	var numTowers, maxCount, offset, actualCount uint32
+	binary.Read(r, le, &numTowers)
+	binary.Read(r, le, &maxCount)
+	binary.Read(r, le, &offset)
+	err = binary.Read(r, le, &actualCount)
+	if err != nil {
+		return
+	}
+	if int(actualCount)*4 > r.Len() {
+		return fmt.Errorf("Buffer to small for EptMapRes")
+	}
+	ptrs := make([]uint32, actualCount)
+	binary.Read(r, le, ptrs)
+	for _, ptr := range ptrs {
+		if ptr == 0 {
+			continue
+		}
+		var towerMax, towerLength uint32
+		binary.Read(r, le, &towerMax)
+		err = binary.Read(r, le, &towerLength)
+		if err != nil {
+			return
+		}
+		if int(towerLength) > r.Len() {
+			return fmt.Errorf("Buffer to small for tower in EptMapRes")
+		}
+		tower := make([]byte, towerLength)
+		r.Read(tower)
+		r.Seek(int64((4-towerLength%4)%4), 1)
+		self.Towers = append(self.Towers, tower)
+	}
+	return binary.Read(r, le, &self.Status)
+}
+
+func appendFloor(buf []byte, lhs, rhs []byte) []byte {
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(lhs)))
+	buf = append(buf, lhs...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(rhs)))
+	return append(buf, rhs...)
+}
+
+// newTcpTower builds a protocol tower for the interface over ncacn_ip_tcp
+func newTcpTower(interface_uuid string, majorVersion, minorVersion uint16) (tower []byte, err error) {
+	ifUuid, err := msdtyp.GuidFromString(interface_uuid)
+	if err != nil {
+		return
+	}
+	ndrUuid, err := msdtyp.GuidFromString(MSRPCUuidNdr)
+	if err != nil {
+		return
+	}
+	tower = binary.LittleEndian.AppendUint16(nil, 5) // Floor count
+	lhs := append([]byte{epmProtocolUuid}, ifUuid...)
+	lhs = binary.LittleEndian.AppendUint16(lhs, majorVersion)
+	tower = appendFloor(tower, lhs, binary.LittleEndian.AppendUint16(nil, minorVersion))
+	lhs = append([]byte{epmProtocolUuid}, ndrUuid...)
+	lhs = binary.LittleEndian.AppendUint16(lhs, 2)
+	tower = appendFloor(tower, lhs, []byte{0, 0})
+	tower = appendFloor(tower, []byte{epmProtocolNcacn}, []byte{0, 0})
+	tower = appendFloor(tower, []byte{epmProtocolTcp}, []byte{0, 0})
+	tower = appendFloor(tower, []byte{epmProtocolIp}, []byte{0, 0, 0, 0})
+	return
+}
+
+// tcpPortFromTower returns the port of the TCP floor of a protocol tower
+func tcpPortFromTower(tower []byte) (port int, err error) {
+	if len(tower) < 2 {
+		return 0, fmt.Errorf("Buffer to small for protocol tower")
+	}
+	floors := int(le.Uint16(tower))
+	buf := tower[2:]
+	for i := 0; i < floors; i++ {
+		if len(buf) < 2 {
+			break
+		}
+		lhsLen := int(le.Uint16(buf))
+		if len(buf) < 2+lhsLen+2 {
+			break
+		}
+		lhs := buf[2 : 2+lhsLen]
+		rhsLen := int(le.Uint16(buf[2+lhsLen:]))
+		if len(buf) < 4+lhsLen+rhsLen {
+			break
+		}
+		rhs := buf[4+lhsLen : 4+lhsLen+rhsLen]
+		if lhsLen == 1 && lhs[0] == epmProtocolTcp && rhsLen == 2 {
+			// The port is in big endian byte order
+			return int(binary.BigEndian.Uint16(rhs)), nil
+		}
+		buf = buf[4+lhsLen+rhsLen:]
+	}
+	return 0, fmt.Errorf("No TCP floor found in protocol tower")
+}
+
+// EpmMapTCP asks the endpoint mapper listening on the other end of conn,
+// usually port 135, for the dynamic TCP port of the interface.
+func EpmMapTCP(conn net.Conn, interface_uuid string, majorVersion, minorVersion uint16) (port int, err error) {
+	log.Debugln("In EpmMapTCP")
+	sb, err := BindTCP(conn, MSRPCUuidEpm, MSRPCEpmMajorVersion, MSRPCEpmMinorVersion, MSRPCUuidNdr)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	tower, err := newTcpTower(interface_uuid, majorVersion, minorVersion)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	req := EptMapReq{Tower: tower, MaxTowers: 4}
+	innerBuf, err := req.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	buffer, err := sb.MakeIoCtlRequest(EpmEptMap, innerBuf)
+	if err != nil {
+		return
+	}
+	var res EptMapRes
+	err = res.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if res.Status != EpmStatusOk {
+		if res.Status == EpmStatusNotRegistered {
+			return 0, fmt.Errorf("There are no more endpoints available from the endpoint mapper")
+		}
+		return 0, fmt.Errorf("Received unknown EPM return code for ept_map response: 0x%x", res.Status)
+	}
+	for _, t := range res.Towers {
+		port, err = tcpPortFromTower(t)
+		if err == nil {
+			return
+		}
+	}
+	return 0, fmt.Errorf("The endpoint mapper did not return a TCP endpoint")
+}
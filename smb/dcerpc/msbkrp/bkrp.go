@@ -0,0 +1,158 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package msbkrp implements the BackuprKey method of the BackupKey Remote
+// Protocol used to retrieve the DPAPI domain backup public key and to have a
+// domain controller unwrap DPAPI secrets protected with the domain backup key.
+//
+// The server rejects requests that are not sent over a DCERPC binding that is
+// authenticated with packet privacy, so the ServiceBind should be created with
+// dcerpc.BindAuth and dcerpc.AuthLevelPktPrivacy.
+package msbkrp
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/jfjallid/golog"
+)
+
+var (
+	log                  = golog.Get("github.com/ericblavier/go-smb/smb/dcerpc/msbkrp")
+	le  binary.ByteOrder = binary.LittleEndian
+)
+
+const (
+	MSRPCUuidBkrp                = "3dde7c30-165d-11d1-ab8f-00805f14db40"
+	MSRPCBkrpPipe                = "protected_storage"
+	MSRPCBkrpMajorVersion uint16 = 1
+	MSRPCBkrpMinorVersion uint16 = 0
+)
+
+// MSRPC BackupKey Remote Protocol Operations
+const (
+	BkrpBackuprKey uint16 = 0
+)
+
+// MS-BKRP Section 3.1.4.1 action agent GUIDs in their NDR wire format
+var (
+	// 7f752b10-178e-11d1-ab8f-00805f14db40
+	BackupKeyBackupGuid = []byte{0x10, 0x2b, 0x75, 0x7f, 0x8e, 0x17, 0xd1, 0x11, 0xab, 0x8f, 0x00, 0x80, 0x5f, 0x14, 0xdb, 0x40}
+	// 7fe94d50-178e-11d1-ab8f-00805f14db40
+	BackupKeyRestoreGuidWin2k = []byte{0x50, 0x4d, 0xe9, 0x7f, 0x8e, 0x17, 0xd1, 0x11, 0xab, 0x8f, 0x00, 0x80, 0x5f, 0x14, 0xdb, 0x40}
+	// 47270c64-2fc7-499b-ac5b-0d2b5a6b4b1d
+	BackupKeyRestoreGuid = []byte{0x64, 0x0c, 0x27, 0x47, 0xc7, 0x2f, 0x9b, 0x49, 0xac, 0x5b, 0x0d, 0x2b, 0x5a, 0x6b, 0x4b, 0x1d}
+	// 018ff48a-eaba-40c6-8f6d-4a3ae7a5d5f6
+	BackupKeyRetrieveBackupKeyGuid = []byte{0x8a, 0xf4, 0x8f, 0x01, 0xba, 0xea, 0xc6, 0x40, 0x8f, 0x6d, 0x4a, 0x3a, 0xe7, 0xa5, 0xd5, 0xf6}
+)
+
+const (
+	ErrorSuccess          uint32 = 0x00000000 // The operation completed successfully
+	ErrorFileNotFound     uint32 = 0x00000002 // The system cannot find the file specified.
+	ErrorAccessDenied     uint32 = 0x00000005 // Access is denied
+	ErrorInvalidData      uint32 = 0x0000000d // The data is invalid.
+	ErrorNotSupported     uint32 = 0x00000032 // The request is not supported.
+	ErrorInvalidParameter uint32 = 0x00000057 // The parameter is incorrect.
+	ErrorInvalidAccess    uint32 = 0x0000000c // The access code is invalid.
+	NteBadData            uint32 = 0x80090005 // Bad Data.
+	NteBadKeyState        uint32 = 0x8009000b // Key not valid for use in specified state.
+)
+
+var ResponseCodeMap = map[uint32]error{
+	ErrorSuccess:          fmt.Errorf("The operation completed successfully"),
+	ErrorFileNotFound:     fmt.Errorf("The system cannot find the file specified"),
+	ErrorAccessDenied:     fmt.Errorf("Access is denied"),
+	ErrorInvalidData:      fmt.Errorf("The data is invalid"),
+	ErrorNotSupported:     fmt.Errorf("The request is not supported"),
+	ErrorInvalidParameter: fmt.Errorf("The parameter is incorrect"),
+	ErrorInvalidAccess:    fmt.Errorf("The access code is invalid"),
+	NteBadData:            fmt.Errorf("Bad Data"),
+	NteBadKeyState:        fmt.Errorf("Key not valid for use in specified state"),
+}
+
+func NewRPCCon(sb *dcerpc.ServiceBind) *RPCCon {
+	return &RPCCon{sb}
+}
+
+// BackuprKey performs the operation identified by actionAgent on the input
+// data and returns the output data of the server.
+func (sb *RPCCon) BackuprKey(actionAgent, dataIn []byte, param uint32) (dataOut []byte, err error) {
+	log.Debugln("In BackuprKey")
+	innerReq := BackuprKeyReq{
+		ActionAgent: actionAgent,
+		DataIn:      dataIn,
+		Param:       param,
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(BkrpBackuprKey, innerBuf)
+	if err != nil {
+		return
+	}
+
+	if len(buffer) < 12 {
+		return nil, fmt.Errorf("Server response to BackuprKey was too small. Expected at atleast 12 bytes")
+	}
+
+	var resp BackuprKeyRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	if resp.ReturnCode != ErrorSuccess {
+		status, found := ResponseCodeMap[resp.ReturnCode]
+		if !found {
+			err = fmt.Errorf("Received unknown BKRP return code for BackuprKey response: 0x%x", resp.ReturnCode)
+			log.Errorln(err)
+			return
+		}
+		err = status
+		log.Errorln(err)
+		return
+	}
+
+	return resp.DataOut, nil
+}
+
+// RetrieveBackupKey retrieves the DER encoded X.509 certificate holding the
+// public part of the domain's DPAPI backup key. It can be parsed with
+// x509.ParseCertificate.
+func (sb *RPCCon) RetrieveBackupKey() (cert []byte, err error) {
+	return sb.BackuprKey(BackupKeyRetrieveBackupKeyGuid, nil, 0)
+}
+
+// RestoreBackupKey asks the domain controller to decrypt a secret that was
+// wrapped with the public DPAPI domain backup key, e.g., the domain backup
+// key blob of a user's DPAPI master key file, and returns the unwrapped secret.
+func (sb *RPCCon) RestoreBackupKey(wrappedSecret []byte) (secret []byte, err error) {
+	if len(wrappedSecret) == 0 {
+		return nil, fmt.Errorf("Wrapped secret cannot be empty")
+	}
+	return sb.BackuprKey(BackupKeyRestoreGuid, wrappedSecret, 0)
+}
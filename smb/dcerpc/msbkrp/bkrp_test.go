@@ -0,0 +1,91 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package msbkrp
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"testing"
+)
+
+func TestBackuprKeyReq(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("8af48f01baeac6408f6d4a3ae7a5d5f6000000000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkt2, err := hex.DecodeString("640c2747c72f9b49ac5b0d2b5a6b4b1d0500000001020304050000000500000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := BackuprKeyReq{ActionAgent: BackupKeyRetrieveBackupKeyGuid}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pkt, buf) {
+		t.Fatal("Fail")
+	}
+
+	req = BackuprKeyReq{ActionAgent: BackupKeyRestoreGuid, DataIn: []byte{1, 2, 3, 4, 5}}
+	buf, err = req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pkt2, buf) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestBackuprKeyRes(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("0000020006000000308203013082000006000000" + "00000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp BackuprKeyRes
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(resp.DataOut) != "308203013082" {
+		t.Fatal("Fail")
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		t.Fatal("Fail")
+	}
+
+	pkt, err = hex.DecodeString("000000000000000005000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = BackuprKeyRes{}
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.DataOut != nil || resp.ReturnCode != ErrorAccessDenied {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,149 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//
+// The marshal/unmarshal of requests and responses according to the NDR syntax
+// has been implemented on a per RPC request basis and not in any complete way.
+// As such, for each new functionality, a manual marshal and unmarshal method
+// has to be written for the relevant messages. This makes it a bit easier to
+// define the message structs but more of the heavy lifting has to be performed
+// by the marshal/unmarshal functions.
+
+package msbkrp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+)
+
+type RPCCon struct {
+	*dcerpc.ServiceBind
+}
+
+// MS-BKRP Section 3.1.4.1 BackuprKey
+type BackuprKeyReq struct {
+	ActionAgent []byte // 16 byte GUID
+	DataIn      []byte
+	Param       uint32
+}
+
+type BackuprKeyRes struct {
+	DataOut    []byte
+	ReturnCode uint32
+}
+
+func (self *BackuprKeyReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for BackuprKeyReq")
+	if len(self.ActionAgent) != 16 {
+		return nil, fmt.Errorf("ActionAgent must be a 16 byte GUID")
+	}
+	w := bytes.NewBuffer(res)
+	w.Write(self.ActionAgent)
+
+	// pDataIn
+	err = binary.Write(w, le, uint32(len(self.DataIn))) // MaxCount
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	w.Write(self.DataIn)
+	padd := (4 - (len(self.DataIn) % 4)) % 4
+	w.Write(make([]byte, padd))
+
+	err = binary.Write(w, le, uint32(len(self.DataIn))) // cbDataIn
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Write(w, le, self.Param)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	return w.Bytes(), nil
+}
+
+func (self *BackuprKeyReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of BackuprKeyReq")
+}
+
+func (self *BackuprKeyRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of BackuprKeyRes")
+}
+
+func (self *BackuprKeyRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for BackuprKeyRes")
+	if len(buf) < 12 {
+		return fmt.Errorf("Buffer to small for BackuprKeyRes")
+	}
+	r := bytes.NewReader(buf)
+	var refId uint32
+	err = binary.Read(r, le, &refId)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if refId != 0 {
+		var maxCount uint32
+		err = binary.Read(r, le, &maxCount)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		if int(maxCount) > r.Len() {
+			return fmt.Errorf("Invalid size of ppDataOut in BackuprKeyRes")
+		}
+		self.DataOut = make([]byte, maxCount)
+		_, err = io.ReadFull(r, self.DataOut)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		padd := (4 - (int(maxCount) % 4)) % 4
+		_, err = r.Seek(int64(padd), io.SeekCurrent)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	var cbDataOut uint32
+	err = binary.Read(r, le, &cbDataOut)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if int(cbDataOut) < len(self.DataOut) {
+		self.DataOut = self.DataOut[:cbDataOut]
+	}
+	err = binary.Read(r, le, &self.ReturnCode)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,658 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package msdcom implements the basics of the Distributed Component Object
+// Model (DCOM) Remote Protocol: object activation through the
+// IRemoteSCMActivator interface, object exporter queries through the
+// IObjectExporter (IOXIDResolver) interface, OBJREF parsing and management of
+// interface pointers through IRemUnknown. It serves as the foundation for
+// DCOM based protocols such as WMI.
+//
+// DCOM is reached over TCP (ncacn_ip_tcp) rather than named pipes, first
+// through the endpoint mapper port and then through the dynamic port of the
+// object exporter hosting the activated object.
+package msdcom
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/ntlmssp"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/ericblavier/go-smb/spnego"
+	"github.com/jfjallid/golog"
+	"golang.org/x/net/proxy"
+)
+
+var (
+	log                  = golog.Get("github.com/ericblavier/go-smb/smb/dcerpc/msdcom")
+	le  binary.ByteOrder = binary.LittleEndian
+)
+
+const (
+	MSRPCUuidObjectExporter                    = "99fcfec4-5260-101b-bbcb-00aa0021347a"
+	MSRPCObjectExporterMajorVersion     uint16 = 0
+	MSRPCObjectExporterMinorVersion     uint16 = 0
+	MSRPCUuidRemoteSCMActivator                = "000001a0-0000-0000-c000-000000000046"
+	MSRPCRemoteSCMActivatorMajorVersion uint16 = 0
+	MSRPCRemoteSCMActivatorMinorVersion uint16 = 0
+	MSRPCUuidRemUnknown                        = "00000131-0000-0000-c000-000000000046"
+	MSRPCRemUnknownMajorVersion         uint16 = 0
+	MSRPCRemUnknownMinorVersion         uint16 = 0
+	// TCP port of the endpoint mapper and the object resolver
+	EndpointMapperPort = 135
+)
+
+// MSRPC IObjectExporter Operations
+const (
+	ObjectExporterResolveOxid  uint16 = 0
+	ObjectExporterSimplePing   uint16 = 1
+	ObjectExporterComplexPing  uint16 = 2
+	ObjectExporterServerAlive  uint16 = 3
+	ObjectExporterResolveOxid2 uint16 = 4
+	ObjectExporterServerAlive2 uint16 = 5
+)
+
+// MSRPC IRemoteSCMActivator Operations
+const (
+	RemoteSCMActivatorRemoteGetClassObject uint16 = 3
+	RemoteSCMActivatorRemoteCreateInstance uint16 = 4
+)
+
+// MSRPC IRemUnknown Operations
+const (
+	RemUnknownRemQueryInterface uint16 = 3
+	RemUnknownRemAddRef         uint16 = 4
+	RemUnknownRemRelease        uint16 = 5
+)
+
+// MS-DCOM Section 2.2.18.1 OBJREF signature and flags
+const (
+	ObjRefSignature uint32 = 0x574f454d // MEOW
+	ObjRefStandard  uint32 = 0x00000001
+	ObjRefHandler   uint32 = 0x00000002
+	ObjRefCustom    uint32 = 0x00000004
+	ObjRefExtended  uint32 = 0x00000008
+)
+
+// MS-DCOM Section 2.2.19.3 RPC protocol sequence identifiers (wTowerId)
+const (
+	ProtseqNcacnIpTcp uint16 = 0x0007
+	ProtseqNcacnNp    uint16 = 0x000f
+	ProtseqNcacnHttp  uint16 = 0x001f
+)
+
+const (
+	MshCtxDifferentMachine uint32 = 2
+	ImpLevelIdentify       uint32 = 2
+	ImpLevelImpersonate    uint32 = 3
+)
+
+// Well known IIDs and CLSIDs in their NDR wire format
+var (
+	IidIUnknown                  = msdtyp.MustGuidFromString("00000000-0000-0000-c000-000000000046")
+	IidIRemUnknown               = msdtyp.MustGuidFromString(MSRPCUuidRemUnknown)
+	IidIRemUnknown2              = msdtyp.MustGuidFromString("00000143-0000-0000-c000-000000000046")
+	IidIActivationPropertiesIn   = msdtyp.MustGuidFromString("000001a2-0000-0000-c000-000000000046")
+	IidIActivationPropertiesOut  = msdtyp.MustGuidFromString("000001a3-0000-0000-c000-000000000046")
+	ClsidActivationContextInfo   = msdtyp.MustGuidFromString("000001a5-0000-0000-c000-000000000046")
+	ClsidActivationPropertiesIn  = msdtyp.MustGuidFromString("00000338-0000-0000-c000-000000000046")
+	ClsidActivationPropertiesOut = msdtyp.MustGuidFromString("00000339-0000-0000-c000-000000000046")
+	ClsidInstantiationInfo       = msdtyp.MustGuidFromString("000001ab-0000-0000-c000-000000000046")
+	ClsidPropsOutInfo            = msdtyp.MustGuidFromString("00000339-0000-0000-c000-000000000046")
+	ClsidScmReplyInfo            = msdtyp.MustGuidFromString("000001b6-0000-0000-c000-000000000046")
+	ClsidScmRequestInfo          = msdtyp.MustGuidFromString("000001aa-0000-0000-c000-000000000046")
+	ClsidSecurityInfo            = msdtyp.MustGuidFromString("000001a6-0000-0000-c000-000000000046")
+	ClsidServerLocationInfo      = msdtyp.MustGuidFromString("000001a4-0000-0000-c000-000000000046")
+)
+
+const (
+	SOk                  uint32 = 0x00000000 // The operation completed successfully
+	SFalse               uint32 = 0x00000001 // The operation completed successfully with a false result
+	ENoInterface         uint32 = 0x80004002 // No such interface supported
+	EFail                uint32 = 0x80004005 // Unspecified error
+	RegdbEClassNotReg    uint32 = 0x80040154 // Class not registered
+	CoEServerExecFailure uint32 = 0x80080005 // Server execution failed
+	RpcEDisconnected     uint32 = 0x80010108 // The object invoked has disconnected from its clients
+	RpcEInvalidIpid      uint32 = 0x80010113 // The requested object does not exist
+	EAccessDenied        uint32 = 0x80070005 // Access is denied
+	EOutOfMemory         uint32 = 0x8007000e // Ran out of memory
+	EInvalidArg          uint32 = 0x80070057 // One or more arguments are invalid
+)
+
+var ResponseCodeMap = map[uint32]error{
+	SOk:                  fmt.Errorf("The operation completed successfully"),
+	SFalse:               fmt.Errorf("The operation completed successfully with a false result"),
+	ENoInterface:         fmt.Errorf("No such interface supported"),
+	EFail:                fmt.Errorf("Unspecified error"),
+	RegdbEClassNotReg:    fmt.Errorf("Class not registered"),
+	CoEServerExecFailure: fmt.Errorf("Server execution failed"),
+	RpcEDisconnected:     fmt.Errorf("The object invoked has disconnected from its clients"),
+	RpcEInvalidIpid:      fmt.Errorf("The requested object does not exist"),
+	EAccessDenied:        fmt.Errorf("Access is denied"),
+	EOutOfMemory:         fmt.Errorf("Ran out of memory"),
+	EInvalidArg:          fmt.Errorf("One or more arguments are invalid"),
+}
+
+func hresultToError(op string, hresult uint32) error {
+	status, found := ResponseCodeMap[hresult]
+	if !found {
+		return fmt.Errorf("Received unknown DCOM return code for %s response: 0x%x", op, hresult)
+	}
+	return status
+}
+
+func NewRPCCon(sb *dcerpc.ServiceBind) *RPCCon {
+	return &RPCCon{sb}
+}
+
+// ServerAlive2 queries the object resolver for its COM version and the
+// string and security bindings it can be reached through. It can be used
+// without authentication.
+func (sb *RPCCon) ServerAlive2() (res *ServerAlive2Res, err error) {
+	log.Debugln("In ServerAlive2")
+	buffer, err := sb.MakeIoCtlRequest(ObjectExporterServerAlive2, nil)
+	if err != nil {
+		return
+	}
+
+	res = &ServerAlive2Res{}
+	err = res.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if res.ReturnCode != SOk {
+		err = hresultToError("ServerAlive2", res.ReturnCode)
+		log.Errorln(err)
+	}
+	return
+}
+
+// ResolveOxid2 returns the bindings of the object exporter identified by oxid
+func (sb *RPCCon) ResolveOxid2(oxid uint64) (res *ResolveOxid2Res, err error) {
+	log.Debugln("In ResolveOxid2")
+	innerReq := ResolveOxid2Req{
+		Oxid:              oxid,
+		RequestedProtseqs: []uint16{ProtseqNcacnIpTcp},
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(ObjectExporterResolveOxid2, innerBuf)
+	if err != nil {
+		return
+	}
+
+	res = &ResolveOxid2Res{}
+	err = res.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if res.ReturnCode != SOk {
+		err = hresultToError("ResolveOxid2", res.ReturnCode)
+		log.Errorln(err)
+	}
+	return
+}
+
+// RemoteCreateInstance activates an object of the class clsid and returns
+// interface pointers for the requested iids together with the object exporter
+// information needed to call them.
+func (sb *RPCCon) RemoteCreateInstance(clsid []byte, iids [][]byte) (propsOut *PropsOutInfo, scmReply *ScmReplyInfo, err error) {
+	log.Debugln("In RemoteCreateInstance")
+	actProperties, err := marshalActivationPropertiesIn(clsid, iids)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	innerReq := RemoteCreateInstanceReq{
+		OrpcThis:      newOrpcThis(),
+		ActProperties: actProperties,
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(RemoteSCMActivatorRemoteCreateInstance, innerBuf)
+	if err != nil {
+		return
+	}
+
+	var resp RemoteCreateInstanceRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != SOk {
+		err = hresultToError("RemoteCreateInstance", resp.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+
+	return parseActivationPropertiesOut(resp.ActProperties)
+}
+
+// Options used to establish DCOM connections
+type Options struct {
+	Host string
+	// Credentials used to authenticate every DCERPC binding. Only the
+	// exported fields are used.
+	Initiator *spnego.NTLMInitiator
+	// Defaults to dcerpc.AuthLevelPktPrivacy
+	AuthLevel   uint8
+	DialTimeout time.Duration
+	ProxyDialer proxy.Dialer
+}
+
+// Information about an object exporter needed to call the objects it exports
+type oxidEntry struct {
+	bindings       *DualStringArray
+	ipidRemUnknown []byte
+}
+
+// Connection keeps track of the object exporters and DCERPC bindings used
+// to call interfaces of activated DCOM objects.
+type Connection struct {
+	opts  Options
+	mu    sync.Mutex
+	oxids map[uint64]*oxidEntry
+	binds map[string]*dcerpc.ServiceBind
+	conns []net.Conn
+}
+
+// InterfacePointer is a reference to an interface of a remote DCOM object
+type InterfacePointer struct {
+	Iid  []byte
+	Std  StdObjRef
+	conn *Connection
+}
+
+func NewConnection(opts Options) (c *Connection, err error) {
+	if opts.Host == "" {
+		return nil, fmt.Errorf("Missing required option: Host")
+	}
+	if opts.Initiator == nil {
+		return nil, fmt.Errorf("Missing required option: Initiator")
+	}
+	if opts.AuthLevel == 0 {
+		opts.AuthLevel = dcerpc.AuthLevelPktPrivacy
+	}
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	return &Connection{
+		opts:  opts,
+		oxids: make(map[uint64]*oxidEntry),
+		binds: make(map[string]*dcerpc.ServiceBind),
+	}, nil
+}
+
+// Close closes all TCP connections opened by the Connection
+func (c *Connection) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+	c.conns = nil
+	c.binds = make(map[string]*dcerpc.ServiceBind)
+}
+
+func (c *Connection) dial(port int) (conn net.Conn, err error) {
+	addr := net.JoinHostPort(c.opts.Host, strconv.Itoa(port))
+	if c.opts.ProxyDialer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), c.opts.DialTimeout)
+		defer cancel()
+		conn, err = c.opts.ProxyDialer.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, c.opts.DialTimeout)
+	}
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	c.conns = append(c.conns, conn)
+	return
+}
+
+func (c *Connection) newNTLMClient() *ntlmssp.Client {
+	i := c.opts.Initiator
+	return &ntlmssp.Client{
+		User:        i.User,
+		Password:    i.Password,
+		Hash:        i.Hash,
+		Domain:      i.Domain,
+		LocalUser:   i.LocalUser,
+		Workstation: i.Workstation,
+		TargetSPN:   i.TargetSPN,
+	}
+}
+
+// bind creates an authenticated binding to the interface iid on the
+// specified TCP port.
+func (c *Connection) bind(port int, iid []byte) (sb *dcerpc.ServiceBind, err error) {
+	conn, err := c.dial(port)
+	if err != nil {
+		return
+	}
+	sb, err = dcerpc.BindAuthTCP(conn, msdtyp.GuidToString(iid), 0, 0, dcerpc.MSRPCUuidNdr, c.opts.AuthLevel, c.newNTLMClient())
+	if err != nil {
+		log.Errorln(err)
+	}
+	return
+}
+
+// ServerAlive2 calls IObjectExporter::ServerAlive2 on the object resolver
+func (c *Connection) ServerAlive2() (res *ServerAlive2Res, err error) {
+	c.mu.Lock()
+	conn, err := c.dial(EndpointMapperPort)
+	c.mu.Unlock()
+	if err != nil {
+		return
+	}
+	sb, err := dcerpc.BindTCP(conn, MSRPCUuidObjectExporter, MSRPCObjectExporterMajorVersion, MSRPCObjectExporterMinorVersion, dcerpc.MSRPCUuidNdr)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return NewRPCCon(sb).ServerAlive2()
+}
+
+// CreateInstance activates an object of the class clsid on the remote host
+// and returns an interface pointer for the interface iid.
+func (c *Connection) CreateInstance(clsid, iid []byte) (ip *InterfacePointer, err error) {
+	log.Debugln("In CreateInstance")
+	c.mu.Lock()
+	sb, err := c.bind(EndpointMapperPort, msdtyp.MustGuidFromString(MSRPCUuidRemoteSCMActivator))
+	c.mu.Unlock()
+	if err != nil {
+		return
+	}
+	propsOut, scmReply, err := NewRPCCon(sb).RemoteCreateInstance(clsid, [][]byte{iid})
+	if err != nil {
+		return
+	}
+	if len(propsOut.IntfData) == 0 || propsOut.IntfData[0] == nil {
+		return nil, fmt.Errorf("RemoteCreateInstance did not return an interface pointer")
+	}
+	if len(propsOut.Results) > 0 && propsOut.Results[0] != SOk {
+		err = hresultToError("RemoteCreateInstance", propsOut.Results[0])
+		log.Errorln(err)
+		return
+	}
+
+	c.mu.Lock()
+	c.oxids[scmReply.Oxid] = &oxidEntry{
+		bindings:       scmReply.OxidBindings,
+		ipidRemUnknown: scmReply.IpidRemUnknown,
+	}
+	c.mu.Unlock()
+
+	return c.InterfaceFromObjRef(propsOut.IntfData[0])
+}
+
+// InterfaceFromObjRef creates an interface pointer from a marshaled OBJREF,
+// e.g., one returned as an [out] MInterfacePointer by a DCOM method.
+func (c *Connection) InterfaceFromObjRef(buf []byte) (ip *InterfacePointer, err error) {
+	var objRef ObjRef
+	err = objRef.UnmarshalBinary(buf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if objRef.Std == nil {
+		return nil, fmt.Errorf("Unsupported OBJREF type for an interface pointer: %d", objRef.Flags)
+	}
+	c.mu.Lock()
+	if _, found := c.oxids[objRef.Std.Oxid]; !found && objRef.ResAddr != nil && len(objRef.ResAddr.StringBindings) > 0 {
+		c.oxids[objRef.Std.Oxid] = &oxidEntry{bindings: objRef.ResAddr}
+	}
+	c.mu.Unlock()
+	return &InterfacePointer{Iid: objRef.Iid, Std: *objRef.Std, conn: c}, nil
+}
+
+// resolveOxid returns the object exporter information for oxid, asking the
+// object resolver for it if it is not already known.
+func (c *Connection) resolveOxid(oxid uint64) (entry *oxidEntry, err error) {
+	entry, found := c.oxids[oxid]
+	if found && entry.ipidRemUnknown != nil {
+		return
+	}
+	sb, err := c.bind(EndpointMapperPort, msdtyp.MustGuidFromString(MSRPCUuidObjectExporter))
+	if err != nil {
+		return
+	}
+	res, err := NewRPCCon(sb).ResolveOxid2(oxid)
+	if err != nil {
+		return
+	}
+	entry = &oxidEntry{bindings: res.OxidBindings, ipidRemUnknown: res.IpidRemUnknown}
+	c.oxids[oxid] = entry
+	return
+}
+
+// tcpPort returns the port of the first ncacn_ip_tcp string binding. The host
+// part of the binding is ignored in favor of the host of the connection as
+// the server may report names or addresses that are not reachable.
+func (self *DualStringArray) tcpPort() (port int, err error) {
+	portRe := regexp.MustCompile(`\[(\d+)\]$`)
+	for _, sb := range self.StringBindings {
+		if sb.TowerId != ProtseqNcacnIpTcp {
+			continue
+		}
+		m := portRe.FindStringSubmatch(sb.NetworkAddr)
+		if m == nil {
+			continue
+		}
+		return strconv.Atoi(m[1])
+	}
+	return 0, fmt.Errorf("No ncacn_ip_tcp string binding found")
+}
+
+// serviceBind returns a binding to the interface iid of the object exporter
+// oxid, creating one if needed.
+func (c *Connection) serviceBind(oxid uint64, iid []byte) (sb *dcerpc.ServiceBind, err error) {
+	key := fmt.Sprintf("%016x-%x", oxid, iid)
+	sb, found := c.binds[key]
+	if found {
+		return
+	}
+	entry, err := c.resolveOxid(oxid)
+	if err != nil {
+		return
+	}
+	if entry.bindings == nil {
+		return nil, fmt.Errorf("No bindings known for OXID 0x%x", oxid)
+	}
+	port, err := entry.bindings.tcpPort()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	sb, err = c.bind(port, iid)
+	if err != nil {
+		return
+	}
+	c.binds[key] = sb
+	return
+}
+
+// Connection returns the DCOM connection the interface pointer belongs to
+func (self *InterfacePointer) Connection() *Connection {
+	return self.conn
+}
+
+// Call invokes the method opnum of the interface with the NDR encoded
+// arguments in innerBuf. The ORPCTHIS is prepended to the arguments and the
+// ORPCTHAT is removed from the returned result.
+func (self *InterfacePointer) Call(opnum uint16, innerBuf []byte) (result []byte, err error) {
+	c := self.conn
+	if c == nil {
+		return nil, fmt.Errorf("Interface pointer is not associated with a connection")
+	}
+	c.mu.Lock()
+	sb, err := c.serviceBind(self.Std.Oxid, self.Iid)
+	c.mu.Unlock()
+	if err != nil {
+		return
+	}
+	return callObject(sb, self.Std.Ipid, opnum, innerBuf)
+}
+
+func callObject(sb *dcerpc.ServiceBind, ipid []byte, opnum uint16, innerBuf []byte) (result []byte, err error) {
+	orpcThis := newOrpcThis()
+	w := bytes.NewBuffer(nil)
+	err = orpcThis.writeTo(w)
+	if err != nil {
+		return
+	}
+	w.Write(innerBuf)
+
+	buffer, err := sb.MakeObjectRequest(opnum, ipid, w.Bytes())
+	if err != nil {
+		return
+	}
+	r := bytes.NewReader(buffer)
+	_, err = readOrpcThat(r)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return buffer[len(buffer)-r.Len():], nil
+}
+
+// remUnknown returns the binding and IPID of the IRemUnknown interface of the
+// object exporter of the interface pointer.
+func (self *InterfacePointer) remUnknown() (sb *dcerpc.ServiceBind, ipid []byte, err error) {
+	c := self.conn
+	if c == nil {
+		return nil, nil, fmt.Errorf("Interface pointer is not associated with a connection")
+	}
+	entry, err := c.resolveOxid(self.Std.Oxid)
+	if err != nil {
+		return
+	}
+	sb, err = c.serviceBind(self.Std.Oxid, IidIRemUnknown)
+	return sb, entry.ipidRemUnknown, err
+}
+
+// QueryInterface asks the object for another of its interfaces
+func (self *InterfacePointer) QueryInterface(iid []byte) (ip *InterfacePointer, err error) {
+	log.Debugln("In QueryInterface")
+	self.conn.mu.Lock()
+	sb, ipidRemUnknown, err := self.remUnknown()
+	self.conn.mu.Unlock()
+	if err != nil {
+		return
+	}
+	innerReq := RemQueryInterfaceReq{
+		OrpcThis: newOrpcThis(),
+		Ipid:     self.Std.Ipid,
+		Refs:     5,
+		Iids:     [][]byte{iid},
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	buffer, err := sb.MakeObjectRequest(RemUnknownRemQueryInterface, ipidRemUnknown, innerBuf)
+	if err != nil {
+		return
+	}
+	var resp RemQueryInterfaceRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != SOk {
+		err = hresultToError("RemQueryInterface", resp.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	if len(resp.Results) != 1 {
+		return nil, fmt.Errorf("Unexpected number of results from RemQueryInterface")
+	}
+	if resp.Results[0].Result != SOk {
+		err = hresultToError("RemQueryInterface", resp.Results[0].Result)
+		log.Errorln(err)
+		return
+	}
+	return &InterfacePointer{Iid: iid, Std: resp.Results[0].Std, conn: self.conn}, nil
+}
+
+// Release releases the public references held on the interface pointer. The
+// interface pointer must not be used after it has been released.
+func (self *InterfacePointer) Release() (err error) {
+	log.Debugln("In Release")
+	self.conn.mu.Lock()
+	sb, ipidRemUnknown, err := self.remUnknown()
+	self.conn.mu.Unlock()
+	if err != nil {
+		return
+	}
+	refs := self.Std.PublicRefs
+	if refs == 0 {
+		refs = 1
+	}
+	innerReq := RemReleaseReq{
+		OrpcThis:      newOrpcThis(),
+		InterfaceRefs: []RemInterfaceRef{{Ipid: self.Std.Ipid, PublicRefs: refs}},
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	buffer, err := sb.MakeObjectRequest(RemUnknownRemRelease, ipidRemUnknown, innerBuf)
+	if err != nil {
+		return
+	}
+	var resp RemReleaseRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != SOk {
+		err = hresultToError("RemRelease", resp.ReturnCode)
+		log.Errorln(err)
+	}
+	return
+}
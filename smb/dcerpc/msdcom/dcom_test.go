@@ -0,0 +1,144 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package msdcom
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+func TestGuidFromString(t *testing.T) {
+	pkt, err := hex.DecodeString("a001000000000000c000000000000046")
+	if err != nil {
+		t.Fatal(err)
+	}
+	guid, err := msdtyp.GuidFromString(MSRPCUuidRemoteSCMActivator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(guid, pkt) {
+		t.Fatal("Fail")
+	}
+	if msdtyp.GuidToString(guid) != MSRPCUuidRemoteSCMActivator {
+		t.Fatal("Fail")
+	}
+}
+
+func TestServerAlive2Res(t *testing.T) {
+	pkt, err := hex.DecodeString("05000700000002000b0000000b000700070061005b0031005d00000000000a00ffff0000000000000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res ServerAlive2Res
+	err = res.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ComVersion.MajorVersion != 5 || res.ComVersion.MinorVersion != 7 || res.ReturnCode != SOk {
+		t.Fatal("Fail")
+	}
+	if res.OrBindings == nil || len(res.OrBindings.StringBindings) != 1 || len(res.OrBindings.SecurityBindings) != 1 {
+		t.Fatal("Fail")
+	}
+	if res.OrBindings.StringBindings[0].TowerId != ProtseqNcacnIpTcp || res.OrBindings.StringBindings[0].NetworkAddr != "a[1]" {
+		t.Fatal("Fail")
+	}
+	port, err := res.OrBindings.tcpPort()
+	if err != nil || port != 1 {
+		t.Fatal("Fail")
+	}
+}
+
+func TestObjRefStandard(t *testing.T) {
+	objRef := ObjRef{
+		Flags: ObjRefStandard,
+		Iid:   IidIUnknown,
+		Std: &StdObjRef{
+			PublicRefs: 5,
+			Oxid:       0x1122334455667788,
+			Oid:        0x0102030405060708,
+			Ipid:       IidIRemUnknown2,
+		},
+		ResAddr: &DualStringArray{
+			StringBindings:   []StringBinding{{TowerId: ProtseqNcacnIpTcp, NetworkAddr: "host[49667]"}},
+			SecurityBindings: []SecurityBinding{{AuthnSvc: 0x0a, AuthzSvc: 0xffff}},
+		},
+	}
+	buf, err := objRef.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res ObjRef
+	err = res.UnmarshalBinary(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Flags != ObjRefStandard || !bytes.Equal(res.Iid, IidIUnknown) || res.Std == nil || res.ResAddr == nil {
+		t.Fatal("Fail")
+	}
+	if res.Std.PublicRefs != 5 || res.Std.Oxid != objRef.Std.Oxid || res.Std.Oid != objRef.Std.Oid || !bytes.Equal(res.Std.Ipid, objRef.Std.Ipid) {
+		t.Fatal("Fail")
+	}
+	port, err := res.ResAddr.tcpPort()
+	if err != nil || port != 49667 {
+		t.Fatal("Fail")
+	}
+}
+
+func TestActivationPropertiesIn(t *testing.T) {
+	clsid := ClsidScmRequestInfo
+	buf, err := marshalActivationPropertiesIn(clsid, [][]byte{IidIUnknown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var objRef ObjRef
+	err = objRef.UnmarshalBinary(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objRef.Flags != ObjRefCustom || !bytes.Equal(objRef.Iid, IidIActivationPropertiesIn) || !bytes.Equal(objRef.Clsid, ClsidActivationPropertiesIn) {
+		t.Fatal("Fail")
+	}
+	// The total size of the activation blob is the first field
+	if len(objRef.ObjectData) < 8 || int(le.Uint32(objRef.ObjectData)) != len(objRef.ObjectData)-8 {
+		t.Fatal("Fail")
+	}
+}
+
+func TestTypeSerialize(t *testing.T) {
+	ndr := []byte{1, 2, 3, 4, 5}
+	buf := typeSerialize(ndr)
+	if len(buf)%8 != 0 {
+		t.Fatal("Fail")
+	}
+	res, err := typeDeserialize(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res[:len(ndr)], ndr) {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,1127 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//
+// The marshal/unmarshal of requests and responses according to the NDR syntax
+// has been implemented on a per RPC request basis and not in any complete way.
+// As such, for each new functionality, a manual marshal and unmarshal method
+// has to be written for the relevant messages. This makes it a bit easier to
+// define the message structs but more of the heavy lifting has to be performed
+// by the marshal/unmarshal functions.
+
+package msdcom
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+)
+
+type RPCCon struct {
+	*dcerpc.ServiceBind
+}
+
+// MS-DCOM Section 2.2.11 COMVERSION
+type ComVersion struct {
+	MajorVersion uint16
+	MinorVersion uint16
+}
+
+// MS-DCOM Section 2.2.13.1 ORPCTHIS
+type OrpcThis struct {
+	Version  ComVersion
+	Flags    uint32
+	Reserved uint32
+	Cid      []byte // 16 byte causality id
+}
+
+// MS-DCOM Section 2.2.21.1 ORPC_EXTENT
+type OrpcExtent struct {
+	Id   []byte
+	Data []byte
+}
+
+// MS-DCOM Section 2.2.13.2 ORPCTHAT
+type OrpcThat struct {
+	Flags      uint32
+	Extensions []OrpcExtent
+}
+
+// MS-DCOM Section 2.2.19.3 STRINGBINDING
+type StringBinding struct {
+	TowerId     uint16
+	NetworkAddr string
+}
+
+// MS-DCOM Section 2.2.19.4 SECURITYBINDING
+type SecurityBinding struct {
+	AuthnSvc  uint16
+	AuthzSvc  uint16
+	PrincName string
+}
+
+// MS-DCOM Section 2.2.19.2 DUALSTRINGARRAY
+type DualStringArray struct {
+	StringBindings   []StringBinding
+	SecurityBindings []SecurityBinding
+}
+
+// MS-DCOM Section 2.2.18.2 STDOBJREF
+type StdObjRef struct {
+	Flags      uint32
+	PublicRefs uint32
+	Oxid       uint64
+	Oid        uint64
+	Ipid       []byte // 16 bytes
+}
+
+// MS-DCOM Section 2.2.18 OBJREF. Only the fields relevant for the type of
+// object reference indicated by Flags are set.
+type ObjRef struct {
+	Flags      uint32
+	Iid        []byte
+	Std        *StdObjRef       // OBJREF_STANDARD, OBJREF_HANDLER and OBJREF_EXTENDED
+	ResAddr    *DualStringArray // OBJREF_STANDARD, OBJREF_HANDLER and OBJREF_EXTENDED
+	Clsid      []byte           // OBJREF_HANDLER and OBJREF_CUSTOM
+	ObjectData []byte           // OBJREF_CUSTOM
+}
+
+// MS-DCOM Section 3.1.2.5.2.3.2 IObjectExporter::ServerAlive2
+type ServerAlive2Res struct {
+	ComVersion ComVersion
+	OrBindings *DualStringArray
+	ReturnCode uint32
+}
+
+// MS-DCOM Section 3.1.2.5.1.4 IObjectExporter::ResolveOxid2
+type ResolveOxid2Req struct {
+	Oxid              uint64
+	RequestedProtseqs []uint16
+}
+
+type ResolveOxid2Res struct {
+	OxidBindings   *DualStringArray
+	IpidRemUnknown []byte
+	AuthnHint      uint32
+	ComVersion     ComVersion
+	ReturnCode     uint32
+}
+
+// MS-DCOM Section 3.1.2.5.2.3.2 IRemoteSCMActivator::RemoteCreateInstance
+type RemoteCreateInstanceReq struct {
+	OrpcThis OrpcThis
+	// Marshaled OBJREF_CUSTOM holding the activation properties
+	ActProperties []byte
+}
+
+type RemoteCreateInstanceRes struct {
+	OrpcThat      OrpcThat
+	ActProperties []byte
+	ReturnCode    uint32
+}
+
+// MS-DCOM Section 2.2.22.2.7 PropsOutInfo
+type PropsOutInfo struct {
+	Iids     [][]byte
+	Results  []uint32
+	IntfData [][]byte // Marshaled OBJREF for each interface
+}
+
+// MS-DCOM Section 2.2.22.2.8.2 customREMOTE_REPLY_SCM_INFO
+type ScmReplyInfo struct {
+	Oxid           uint64
+	OxidBindings   *DualStringArray
+	IpidRemUnknown []byte
+	AuthnHint      uint32
+	ServerVersion  ComVersion
+}
+
+// MS-DCOM Section 2.2.22.3 REMQIRESULT
+type RemQIResult struct {
+	Result uint32
+	Std    StdObjRef
+}
+
+// MS-DCOM Section 2.2.22.4 REMINTERFACEREF
+type RemInterfaceRef struct {
+	Ipid        []byte
+	PublicRefs  uint32
+	PrivateRefs uint32
+}
+
+// MS-DCOM Section 3.1.1.5.6.1.1 IRemUnknown::RemQueryInterface
+type RemQueryInterfaceReq struct {
+	OrpcThis OrpcThis
+	Ipid     []byte
+	Refs     uint32
+	Iids     [][]byte
+}
+
+type RemQueryInterfaceRes struct {
+	OrpcThat   OrpcThat
+	Results    []RemQIResult
+	ReturnCode uint32
+}
+
+// MS-DCOM Section 3.1.1.5.6.1.3 IRemUnknown::RemRelease
+type RemReleaseReq struct {
+	OrpcThis      OrpcThis
+	InterfaceRefs []RemInterfaceRef
+}
+
+type RemReleaseRes struct {
+	OrpcThat   OrpcThat
+	ReturnCode uint32
+}
+
+func newOrpcThis() OrpcThis {
+	cid := make([]byte, 16)
+	rand.Read(cid)
+	return OrpcThis{
+		Version: ComVersion{MajorVersion: 5, MinorVersion: 7},
+		Cid:     cid,
+	}
+}
+
+func alignWriter(w *bytes.Buffer, n int) {
+	if pad := (n - (w.Len() % n)) % n; pad > 0 {
+		w.Write(make([]byte, pad))
+	}
+}
+
+func alignReader(r *bytes.Reader, n int64) (err error) {
+	pos := r.Size() - int64(r.Len())
+	if pad := (n - (pos % n)) % n; pad > 0 {
+		_, err = r.Seek(pad, io.SeekCurrent)
+	}
+	return
+}
+
+func readBytes(r *bytes.Reader, n int) (buf []byte, err error) {
+	if n < 0 || n > r.Len() {
+		return nil, fmt.Errorf("Buffer too small to read %d bytes", n)
+	}
+	buf = make([]byte, n)
+	_, err = io.ReadFull(r, buf)
+	return
+}
+
+func (self *OrpcThis) writeTo(w *bytes.Buffer) (err error) {
+	if len(self.Cid) != 16 {
+		return fmt.Errorf("ORPCTHIS cid must be 16 bytes")
+	}
+	binary.Write(w, le, self.Version.MajorVersion)
+	binary.Write(w, le, self.Version.MinorVersion)
+	binary.Write(w, le, self.Flags)
+	binary.Write(w, le, self.Reserved)
+	w.Write(self.Cid)
+	// No extensions
+	return binary.Write(w, le, uint32(0))
+}
+
+func (self *OrpcThis) MarshalBinary() (res []byte, err error) {
+	w := bytes.NewBuffer(res)
+	err = self.writeTo(w)
+	if err != nil {
+		return
+	}
+	return w.Bytes(), nil
+}
+
+func readOrpcThat(r *bytes.Reader) (res OrpcThat, err error) {
+	err = binary.Read(r, le, &res.Flags)
+	if err != nil {
+		return
+	}
+	var extPtr uint32
+	err = binary.Read(r, le, &extPtr)
+	if err != nil || extPtr == 0 {
+		return
+	}
+	// ORPC_EXTENT_ARRAY
+	var size, reserved, extentPtr uint32
+	binary.Read(r, le, &size)
+	binary.Read(r, le, &reserved)
+	err = binary.Read(r, le, &extentPtr)
+	if err != nil || extentPtr == 0 {
+		return
+	}
+	var maxCount uint32
+	err = binary.Read(r, le, &maxCount)
+	if err != nil {
+		return
+	}
+	if int(maxCount)*4 > r.Len() {
+		return res, fmt.Errorf("Invalid number of ORPC extents")
+	}
+	ptrs := make([]uint32, maxCount)
+	for i := range ptrs {
+		binary.Read(r, le, &ptrs[i])
+	}
+	for _, ptr := range ptrs {
+		if ptr == 0 {
+			continue
+		}
+		var ext OrpcExtent
+		var dataMax, dataSize uint32
+		err = binary.Read(r, le, &dataMax)
+		if err != nil {
+			return
+		}
+		ext.Id, err = readBytes(r, 16)
+		if err != nil {
+			return
+		}
+		err = binary.Read(r, le, &dataSize)
+		if err != nil {
+			return
+		}
+		ext.Data, err = readBytes(r, int(dataMax))
+		if err != nil {
+			return
+		}
+		if dataSize < dataMax {
+			ext.Data = ext.Data[:dataSize]
+		}
+		res.Extensions = append(res.Extensions, ext)
+	}
+	return
+}
+
+// Parse the string and security bindings of a DUALSTRINGARRAY from its
+// entries, where securityOffset is the index of the first security binding.
+func parseDualStringArray(entries []uint16, securityOffset uint16) (res *DualStringArray, err error) {
+	if int(securityOffset) > len(entries) {
+		return nil, fmt.Errorf("Invalid security offset in DUALSTRINGARRAY")
+	}
+	res = &DualStringArray{}
+	readString := func(items []uint16) (s string, n int, err error) {
+		end := 0
+		for end < len(items) && items[end] != 0 {
+			end++
+		}
+		if end == len(items) {
+			return "", 0, fmt.Errorf("Unterminated string in DUALSTRINGARRAY")
+		}
+		buf := make([]byte, end*2)
+		for i := 0; i < end; i++ {
+			le.PutUint16(buf[i*2:], items[i])
+		}
+		s, err = msdtyp.FromUnicodeString(buf)
+		return s, end + 1, err
+	}
+
+	strs := entries[:securityOffset]
+	for len(strs) > 0 && strs[0] != 0 {
+		var sb StringBinding
+		sb.TowerId = strs[0]
+		var n int
+		sb.NetworkAddr, n, err = readString(strs[1:])
+		if err != nil {
+			return
+		}
+		res.StringBindings = append(res.StringBindings, sb)
+		strs = strs[1+n:]
+	}
+	secs := entries[securityOffset:]
+	for len(secs) > 1 && secs[0] != 0 {
+		var sb SecurityBinding
+		sb.AuthnSvc = secs[0]
+		sb.AuthzSvc = secs[1]
+		var n int
+		sb.PrincName, n, err = readString(secs[2:])
+		if err != nil {
+			return
+		}
+		res.SecurityBindings = append(res.SecurityBindings, sb)
+		secs = secs[2+n:]
+	}
+	return
+}
+
+// entries returns the aStringArray of the DUALSTRINGARRAY and the offset of
+// the security bindings.
+func (self *DualStringArray) entries() (entries []uint16, securityOffset uint16) {
+	appendString := func(s string) {
+		buf := msdtyp.ToUnicode(s)
+		for i := 0; i+1 < len(buf); i += 2 {
+			entries = append(entries, le.Uint16(buf[i:]))
+		}
+		entries = append(entries, 0)
+	}
+	for _, sb := range self.StringBindings {
+		entries = append(entries, sb.TowerId)
+		appendString(sb.NetworkAddr)
+	}
+	if len(self.StringBindings) == 0 {
+		entries = append(entries, 0)
+	}
+	entries = append(entries, 0)
+	securityOffset = uint16(len(entries))
+	for _, sb := range self.SecurityBindings {
+		entries = append(entries, sb.AuthnSvc, sb.AuthzSvc)
+		appendString(sb.PrincName)
+	}
+	if len(self.SecurityBindings) == 0 {
+		entries = append(entries, 0)
+	}
+	entries = append(entries, 0)
+	return
+}
+
+// Read a DUALSTRINGARRAY that is not NDR encoded, e.g., as part of an OBJREF
+func readDualStringArray(r *bytes.Reader) (res *DualStringArray, err error) {
+	var numEntries, securityOffset uint16
+	binary.Read(r, le, &numEntries)
+	err = binary.Read(r, le, &securityOffset)
+	if err != nil {
+		return
+	}
+	return readDualStringArrayEntries(r, numEntries, securityOffset)
+}
+
+// Read a conformant NDR encoded DUALSTRINGARRAY
+func readNdrDualStringArray(r *bytes.Reader) (res *DualStringArray, err error) {
+	var maxCount uint32
+	err = binary.Read(r, le, &maxCount)
+	if err != nil {
+		return
+	}
+	res, err = readDualStringArray(r)
+	if err != nil {
+		return
+	}
+	err = alignReader(r, 4)
+	return
+}
+
+func readDualStringArrayEntries(r *bytes.Reader, numEntries, securityOffset uint16) (res *DualStringArray, err error) {
+	if int(numEntries)*2 > r.Len() {
+		return nil, fmt.Errorf("Invalid number of entries in DUALSTRINGARRAY")
+	}
+	entries := make([]uint16, numEntries)
+	err = binary.Read(r, le, entries)
+	if err != nil {
+		return
+	}
+	return parseDualStringArray(entries, securityOffset)
+}
+
+func (self *DualStringArray) writeTo(w *bytes.Buffer) {
+	entries, securityOffset := self.entries()
+	binary.Write(w, le, uint16(len(entries)))
+	binary.Write(w, le, securityOffset)
+	binary.Write(w, le, entries)
+}
+
+func readStdObjRef(r *bytes.Reader) (res *StdObjRef, err error) {
+	res = &StdObjRef{}
+	binary.Read(r, le, &res.Flags)
+	binary.Read(r, le, &res.PublicRefs)
+	binary.Read(r, le, &res.Oxid)
+	err = binary.Read(r, le, &res.Oid)
+	if err != nil {
+		return
+	}
+	res.Ipid, err = readBytes(r, 16)
+	return
+}
+
+func (self *StdObjRef) writeTo(w *bytes.Buffer) (err error) {
+	if len(self.Ipid) != 16 {
+		return fmt.Errorf("STDOBJREF ipid must be 16 bytes")
+	}
+	binary.Write(w, le, self.Flags)
+	binary.Write(w, le, self.PublicRefs)
+	binary.Write(w, le, self.Oxid)
+	binary.Write(w, le, self.Oid)
+	w.Write(self.Ipid)
+	return
+}
+
+func (self *ObjRef) MarshalBinary() (res []byte, err error) {
+	if len(self.Iid) != 16 {
+		return nil, fmt.Errorf("OBJREF iid must be 16 bytes")
+	}
+	w := bytes.NewBuffer(res)
+	binary.Write(w, le, ObjRefSignature)
+	binary.Write(w, le, self.Flags)
+	w.Write(self.Iid)
+	switch self.Flags {
+	case ObjRefStandard, ObjRefHandler:
+		if self.Std == nil {
+			return nil, fmt.Errorf("OBJREF is missing the STDOBJREF")
+		}
+		err = self.Std.writeTo(w)
+		if err != nil {
+			return
+		}
+		if self.Flags == ObjRefHandler {
+			if len(self.Clsid) != 16 {
+				return nil, fmt.Errorf("OBJREF_HANDLER clsid must be 16 bytes")
+			}
+			w.Write(self.Clsid)
+		}
+		resAddr := self.ResAddr
+		if resAddr == nil {
+			resAddr = &DualStringArray{}
+		}
+		resAddr.writeTo(w)
+	case ObjRefCustom:
+		if len(self.Clsid) != 16 {
+			return nil, fmt.Errorf("OBJREF_CUSTOM clsid must be 16 bytes")
+		}
+		w.Write(self.Clsid)
+		binary.Write(w, le, uint32(0)) // cbExtension
+		binary.Write(w, le, uint32(len(self.ObjectData)+8))
+		w.Write(self.ObjectData)
+	default:
+		return nil, fmt.Errorf("Marshal of OBJREF with flags %d is not supported", self.Flags)
+	}
+	return w.Bytes(), nil
+}
+
+func (self *ObjRef) UnmarshalBinary(buf []byte) (err error) {
+	if len(buf) < 24 {
+		return fmt.Errorf("Buffer to small for OBJREF")
+	}
+	r := bytes.NewReader(buf)
+	var signature uint32
+	binary.Read(r, le, &signature)
+	if signature != ObjRefSignature {
+		return fmt.Errorf("Invalid OBJREF signature: 0x%x", signature)
+	}
+	binary.Read(r, le, &self.Flags)
+	self.Iid, err = readBytes(r, 16)
+	if err != nil {
+		return
+	}
+	switch self.Flags {
+	case ObjRefStandard, ObjRefHandler, ObjRefExtended:
+		self.Std, err = readStdObjRef(r)
+		if err != nil {
+			return
+		}
+		if self.Flags == ObjRefHandler {
+			self.Clsid, err = readBytes(r, 16)
+			if err != nil {
+				return
+			}
+		} else if self.Flags == ObjRefExtended {
+			// Skip the Signature1 field
+			_, err = r.Seek(4, io.SeekCurrent)
+			if err != nil {
+				return
+			}
+		}
+		self.ResAddr, err = readDualStringArray(r)
+	case ObjRefCustom:
+		self.Clsid, err = readBytes(r, 16)
+		if err != nil {
+			return
+		}
+		var cbExtension, size uint32
+		binary.Read(r, le, &cbExtension)
+		err = binary.Read(r, le, &size)
+		if err != nil {
+			return
+		}
+		self.ObjectData = make([]byte, r.Len())
+		_, err = io.ReadFull(r, self.ObjectData)
+	default:
+		return fmt.Errorf("Unsupported OBJREF flags: %d", self.Flags)
+	}
+	return
+}
+
+func (self *ServerAlive2Res) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for ServerAlive2Res")
+	if len(buf) < 16 {
+		return fmt.Errorf("Buffer to small for ServerAlive2Res")
+	}
+	r := bytes.NewReader(buf)
+	binary.Read(r, le, &self.ComVersion.MajorVersion)
+	binary.Read(r, le, &self.ComVersion.MinorVersion)
+	var ptr uint32
+	err = binary.Read(r, le, &ptr)
+	if err != nil {
+		return
+	}
+	if ptr != 0 {
+		self.OrBindings, err = readNdrDualStringArray(r)
+		if err != nil {
+			return
+		}
+	}
+	// Skip pReserved
+	_, err = r.Seek(4, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+	return binary.Read(r, le, &self.ReturnCode)
+}
+
+func (self *ServerAlive2Res) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of ServerAlive2Res")
+}
+
+func (self *ResolveOxid2Req) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for ResolveOxid2Req")
+	w := bytes.NewBuffer(res)
+	binary.Write(w, le, self.Oxid)
+	binary.Write(w, le, uint16(len(self.RequestedProtseqs)))
+	alignWriter(w, 4)
+	binary.Write(w, le, uint32(len(self.RequestedProtseqs))) // MaxCount
+	binary.Write(w, le, self.RequestedProtseqs)
+	return w.Bytes(), nil
+}
+
+func (self *ResolveOxid2Req) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of ResolveOxid2Req")
+}
+
+func (self *ResolveOxid2Res) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of ResolveOxid2Res")
+}
+
+func (self *ResolveOxid2Res) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for ResolveOxid2Res")
+	if len(buf) < 32 {
+		return fmt.Errorf("Buffer to small for ResolveOxid2Res")
+	}
+	r := bytes.NewReader(buf)
+	var ptr uint32
+	err = binary.Read(r, le, &ptr)
+	if err != nil {
+		return
+	}
+	if ptr != 0 {
+		self.OxidBindings, err = readNdrDualStringArray(r)
+		if err != nil {
+			return
+		}
+	}
+	self.IpidRemUnknown, err = readBytes(r, 16)
+	if err != nil {
+		return
+	}
+	binary.Read(r, le, &self.AuthnHint)
+	binary.Read(r, le, &self.ComVersion.MajorVersion)
+	binary.Read(r, le, &self.ComVersion.MinorVersion)
+	return binary.Read(r, le, &self.ReturnCode)
+}
+
+func (self *RemoteCreateInstanceReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for RemoteCreateInstanceReq")
+	w := bytes.NewBuffer(res)
+	err = self.OrpcThis.writeTo(w)
+	if err != nil {
+		return
+	}
+	binary.Write(w, le, uint32(0)) // pUnkOuter
+	// pActProperties
+	binary.Write(w, le, uint32(1)) // ReferentId
+	writeMInterfacePointer(w, self.ActProperties)
+	return w.Bytes(), nil
+}
+
+func (self *RemoteCreateInstanceReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of RemoteCreateInstanceReq")
+}
+
+func (self *RemoteCreateInstanceRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of RemoteCreateInstanceRes")
+}
+
+func (self *RemoteCreateInstanceRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for RemoteCreateInstanceRes")
+	if len(buf) < 16 {
+		return fmt.Errorf("Buffer to small for RemoteCreateInstanceRes")
+	}
+	self.ReturnCode = le.Uint32(buf[len(buf)-4:])
+	r := bytes.NewReader(buf[:len(buf)-4])
+	self.OrpcThat, err = readOrpcThat(r)
+	if err != nil {
+		return
+	}
+	var ptr uint32
+	err = binary.Read(r, le, &ptr)
+	if err != nil || ptr == 0 {
+		return
+	}
+	self.ActProperties, err = readMInterfacePointer(r)
+	return
+}
+
+// MS-DCOM Section 2.2.14 MInterfacePointer encoded as a pointer referent
+func writeMInterfacePointer(w *bytes.Buffer, data []byte) {
+	binary.Write(w, le, uint32(len(data))) // MaxCount
+	binary.Write(w, le, uint32(len(data))) // ulCntData
+	w.Write(data)
+	alignWriter(w, 4)
+}
+
+func readMInterfacePointer(r *bytes.Reader) (data []byte, err error) {
+	var maxCount, cntData uint32
+	binary.Read(r, le, &maxCount)
+	err = binary.Read(r, le, &cntData)
+	if err != nil {
+		return
+	}
+	if cntData > maxCount {
+		return nil, fmt.Errorf("Invalid size of MInterfacePointer")
+	}
+	data, err = readBytes(r, int(cntData))
+	if err != nil {
+		return
+	}
+	err = alignReader(r, 4)
+	return
+}
+
+func (self *RemQueryInterfaceReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for RemQueryInterfaceReq")
+	if len(self.Ipid) != 16 {
+		return nil, fmt.Errorf("IPID must be 16 bytes")
+	}
+	w := bytes.NewBuffer(res)
+	err = self.OrpcThis.writeTo(w)
+	if err != nil {
+		return
+	}
+	w.Write(self.Ipid)
+	binary.Write(w, le, self.Refs)
+	binary.Write(w, le, uint16(len(self.Iids)))
+	alignWriter(w, 4)
+	binary.Write(w, le, uint32(len(self.Iids))) // MaxCount
+	for _, iid := range self.Iids {
+		if len(iid) != 16 {
+			return nil, fmt.Errorf("IID must be 16 bytes")
+		}
+		w.Write(iid)
+	}
+	return w.Bytes(), nil
+}
+
+func (self *RemQueryInterfaceReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of RemQueryInterfaceReq")
+}
+
+func (self *RemQueryInterfaceRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of RemQueryInterfaceRes")
+}
+
+func (self *RemQueryInterfaceRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for RemQueryInterfaceRes")
+	if len(buf) < 16 {
+		return fmt.Errorf("Buffer to small for RemQueryInterfaceRes")
+	}
+	self.ReturnCode = le.Uint32(buf[len(buf)-4:])
+	r := bytes.NewReader(buf[:len(buf)-4])
+	self.OrpcThat, err = readOrpcThat(r)
+	if err != nil {
+		return
+	}
+	var ptr, maxCount uint32
+	err = binary.Read(r, le, &ptr)
+	if err != nil || ptr == 0 {
+		return
+	}
+	err = binary.Read(r, le, &maxCount)
+	if err != nil {
+		return
+	}
+	if int(maxCount)*48 > r.Len() {
+		return fmt.Errorf("Invalid number of REMQIRESULT items")
+	}
+	self.Results = make([]RemQIResult, maxCount)
+	for i := range self.Results {
+		err = alignReader(r, 8)
+		if err != nil {
+			return
+		}
+		binary.Read(r, le, &self.Results[i].Result)
+		err = alignReader(r, 8)
+		if err != nil {
+			return
+		}
+		var std *StdObjRef
+		std, err = readStdObjRef(r)
+		if err != nil {
+			return
+		}
+		self.Results[i].Std = *std
+	}
+	return
+}
+
+func (self *RemReleaseReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for RemReleaseReq")
+	w := bytes.NewBuffer(res)
+	err = self.OrpcThis.writeTo(w)
+	if err != nil {
+		return
+	}
+	binary.Write(w, le, uint16(len(self.InterfaceRefs)))
+	alignWriter(w, 4)
+	binary.Write(w, le, uint32(len(self.InterfaceRefs))) // MaxCount
+	for _, ref := range self.InterfaceRefs {
+		if len(ref.Ipid) != 16 {
+			return nil, fmt.Errorf("IPID must be 16 bytes")
+		}
+		w.Write(ref.Ipid)
+		binary.Write(w, le, ref.PublicRefs)
+		binary.Write(w, le, ref.PrivateRefs)
+	}
+	return w.Bytes(), nil
+}
+
+func (self *RemReleaseReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of RemReleaseReq")
+}
+
+func (self *RemReleaseRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of RemReleaseRes")
+}
+
+func (self *RemReleaseRes) UnmarshalBinary(buf []byte) (err error) {
+	if len(buf) < 12 {
+		return fmt.Errorf("Buffer to small for RemReleaseRes")
+	}
+	self.ReturnCode = le.Uint32(buf[len(buf)-4:])
+	self.OrpcThat, err = readOrpcThat(bytes.NewReader(buf[:len(buf)-4]))
+	return
+}
+
+// MS-RPCE Section 2.2.6 Type Serialization Version 1. Wraps the NDR encoded
+// data with the common and private headers and pads it to 8 bytes.
+func typeSerialize(ndr []byte) []byte {
+	pad := (8 - (len(ndr) % 8)) % 8
+	w := bytes.NewBuffer(make([]byte, 0, 16+len(ndr)+pad))
+	w.Write([]byte{0x01, 0x10, 0x08, 0x00}) // Version, Endianness, CommonHeaderLength
+	binary.Write(w, le, uint32(0xcccccccc)) // Filler
+	binary.Write(w, le, uint32(len(ndr)+pad))
+	binary.Write(w, le, uint32(0xcccccccc)) // Filler
+	w.Write(ndr)
+	w.Write(make([]byte, pad))
+	return w.Bytes()
+}
+
+// Returns the NDR encoded data of a type serialized buffer
+func typeDeserialize(buf []byte) (ndr []byte, err error) {
+	if len(buf) < 16 {
+		return nil, fmt.Errorf("Buffer to small for type serialization header")
+	}
+	if buf[0] != 1 || buf[1] != 0x10 {
+		return nil, fmt.Errorf("Unsupported type serialization version or endianness")
+	}
+	length := int(le.Uint32(buf[8:12]))
+	if 16+length > len(buf) {
+		return nil, fmt.Errorf("Invalid object buffer length in type serialization header")
+	}
+	return buf[16 : 16+length], nil
+}
+
+// marshalActivationPropertiesIn creates the ActivationPropertiesIn blob for a
+// RemoteCreateInstance request of the class clsid requesting the interfaces
+// iids.
+func marshalActivationPropertiesIn(clsid []byte, iids [][]byte) (res []byte, err error) {
+	if len(clsid) != 16 {
+		return nil, fmt.Errorf("CLSID must be 16 bytes")
+	}
+	if len(iids) == 0 {
+		return nil, fmt.Errorf("At least one IID must be requested")
+	}
+
+	// InstantiationInfoData
+	w := bytes.NewBuffer(nil)
+	w.Write(clsid)
+	binary.Write(w, le, uint32(0))         // classCtx
+	binary.Write(w, le, uint32(0))         // actvflags
+	binary.Write(w, le, uint32(0))         // fIsSurrogate
+	binary.Write(w, le, uint32(len(iids))) // cIID
+	binary.Write(w, le, uint32(0))         // instFlag
+	binary.Write(w, le, uint32(1))         // pIID ReferentId
+	thisSize := 16 + 52 + 16*len(iids)
+	thisSize += (8 - (thisSize % 8)) % 8
+	binary.Write(w, le, uint32(thisSize))
+	binary.Write(w, le, uint16(5)) // clientCOMVersion
+	binary.Write(w, le, uint16(7))
+	binary.Write(w, le, uint32(len(iids))) // MaxCount
+	for _, iid := range iids {
+		if len(iid) != 16 {
+			return nil, fmt.Errorf("IID must be 16 bytes")
+		}
+		w.Write(iid)
+	}
+	instantiationInfo := typeSerialize(w.Bytes())
+
+	// ActivationContextInfoData with all fields set to zero
+	activationContextInfo := typeSerialize(make([]byte, 24))
+
+	// LocationInfoData with all fields set to zero
+	locationInfo := typeSerialize(make([]byte, 16))
+
+	// ScmRequestInfoData
+	w = bytes.NewBuffer(nil)
+	binary.Write(w, le, uint32(0))        // pdwReserved
+	binary.Write(w, le, uint32(1))        // remoteRequest ReferentId
+	binary.Write(w, le, ImpLevelIdentify) // ClientImpLevel
+	binary.Write(w, le, uint16(1))        // cRequestedProtseqs
+	alignWriter(w, 4)
+	binary.Write(w, le, uint32(2)) // pRequestedProtseqs ReferentId
+	binary.Write(w, le, uint32(1)) // MaxCount
+	binary.Write(w, le, ProtseqNcacnIpTcp)
+	scmRequestInfo := typeSerialize(w.Bytes())
+
+	props := [][]byte{instantiationInfo, activationContextInfo, locationInfo, scmRequestInfo}
+	clsids := [][]byte{ClsidInstantiationInfo, ClsidActivationContextInfo, ClsidServerLocationInfo, ClsidScmRequestInfo}
+	propsLen := 0
+	for _, prop := range props {
+		propsLen += len(prop)
+	}
+
+	// CustomHeader
+	headerSize := 16 + 48 + 4 + 16*len(props) + 4 + 4*len(props)
+	headerSize += (8 - (headerSize % 8)) % 8
+	totalSize := headerSize + propsLen
+	w = bytes.NewBuffer(nil)
+	binary.Write(w, le, uint32(totalSize))
+	binary.Write(w, le, uint32(headerSize))
+	binary.Write(w, le, uint32(0))              // dwReserved
+	binary.Write(w, le, MshCtxDifferentMachine) // destCtx
+	binary.Write(w, le, uint32(len(props)))     // cIfs
+	w.Write(make([]byte, 16))                   // classInfoClsid
+	binary.Write(w, le, uint32(1))              // pclsid ReferentId
+	binary.Write(w, le, uint32(2))              // pSizes ReferentId
+	binary.Write(w, le, uint32(0))              // pdwReserved
+	binary.Write(w, le, uint32(len(clsids)))    // MaxCount
+	for _, c := range clsids {
+		w.Write(c)
+	}
+	binary.Write(w, le, uint32(len(props))) // MaxCount
+	for _, prop := range props {
+		binary.Write(w, le, uint32(len(prop)))
+	}
+	customHeader := typeSerialize(w.Bytes())
+
+	// ACTIVATION_BLOB
+	w = bytes.NewBuffer(nil)
+	binary.Write(w, le, uint32(totalSize)) // dwSize
+	binary.Write(w, le, uint32(0))         // dwReserved
+	w.Write(customHeader)
+	for _, prop := range props {
+		w.Write(prop)
+	}
+
+	objRef := ObjRef{
+		Flags:      ObjRefCustom,
+		Iid:        IidIActivationPropertiesIn,
+		Clsid:      ClsidActivationPropertiesIn,
+		ObjectData: w.Bytes(),
+	}
+	return objRef.MarshalBinary()
+}
+
+// parseActivationPropertiesOut extracts the PropsOutInfo and ScmReplyInfo
+// from the ActivationPropertiesOut returned by RemoteCreateInstance.
+func parseActivationPropertiesOut(buf []byte) (propsOut *PropsOutInfo, scmReply *ScmReplyInfo, err error) {
+	var objRef ObjRef
+	err = objRef.UnmarshalBinary(buf)
+	if err != nil {
+		return
+	}
+	if objRef.Flags != ObjRefCustom || !bytes.Equal(objRef.Clsid, ClsidActivationPropertiesOut) {
+		return nil, nil, fmt.Errorf("Expected an OBJREF_CUSTOM with ActivationPropertiesOut")
+	}
+	blob := objRef.ObjectData
+	if len(blob) < 8 {
+		return nil, nil, fmt.Errorf("ACTIVATION_BLOB is truncated")
+	}
+	blob = blob[8:]
+	ndr, err := typeDeserialize(blob)
+	if err != nil {
+		return
+	}
+	r := bytes.NewReader(ndr)
+	var totalSize, headerSize, dwReserved, destCtx, cIfs uint32
+	binary.Read(r, le, &totalSize)
+	binary.Read(r, le, &headerSize)
+	binary.Read(r, le, &dwReserved)
+	binary.Read(r, le, &destCtx)
+	err = binary.Read(r, le, &cIfs)
+	if err != nil {
+		return
+	}
+	// Skip classInfoClsid and the pclsid, pSizes and pdwReserved pointers
+	_, err = r.Seek(16+12, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+	var maxCount uint32
+	binary.Read(r, le, &maxCount)
+	if maxCount != cIfs || int(cIfs)*20 > r.Len() {
+		return nil, nil, fmt.Errorf("Invalid number of properties in CustomHeader")
+	}
+	clsids := make([][]byte, cIfs)
+	for i := range clsids {
+		clsids[i], _ = readBytes(r, 16)
+	}
+	binary.Read(r, le, &maxCount)
+	sizes := make([]uint32, cIfs)
+	err = binary.Read(r, le, sizes)
+	if err != nil {
+		return
+	}
+	if int(headerSize) > len(blob) {
+		return nil, nil, fmt.Errorf("Invalid CustomHeader headerSize")
+	}
+
+	offset := int(headerSize)
+	for i, clsid := range clsids {
+		if offset+int(sizes[i]) > len(blob) {
+			return nil, nil, fmt.Errorf("Activation property is out of bounds")
+		}
+		prop := blob[offset : offset+int(sizes[i])]
+		offset += int(sizes[i])
+		if bytes.Equal(clsid, ClsidPropsOutInfo) {
+			propsOut, err = parsePropsOutInfo(prop)
+		} else if bytes.Equal(clsid, ClsidScmReplyInfo) {
+			scmReply, err = parseScmReplyInfo(prop)
+		}
+		if err != nil {
+			return
+		}
+	}
+	if propsOut == nil || scmReply == nil {
+		return nil, nil, fmt.Errorf("ActivationPropertiesOut is missing PropsOutInfo or ScmReplyInfo")
+	}
+	return
+}
+
+func parsePropsOutInfo(buf []byte) (res *PropsOutInfo, err error) {
+	ndr, err := typeDeserialize(buf)
+	if err != nil {
+		return
+	}
+	r := bytes.NewReader(ndr)
+	var cIfs, piidPtr, phresultsPtr, ppIntfDataPtr uint32
+	binary.Read(r, le, &cIfs)
+	binary.Read(r, le, &piidPtr)
+	binary.Read(r, le, &phresultsPtr)
+	err = binary.Read(r, le, &ppIntfDataPtr)
+	if err != nil {
+		return
+	}
+	if int(cIfs)*24 > r.Len() {
+		return nil, fmt.Errorf("Invalid number of interfaces in PropsOutInfo")
+	}
+	res = &PropsOutInfo{}
+	var maxCount uint32
+	if piidPtr != 0 {
+		binary.Read(r, le, &maxCount)
+		res.Iids = make([][]byte, cIfs)
+		for i := range res.Iids {
+			res.Iids[i], err = readBytes(r, 16)
+			if err != nil {
+				return
+			}
+		}
+	}
+	if phresultsPtr != 0 {
+		binary.Read(r, le, &maxCount)
+		res.Results = make([]uint32, cIfs)
+		err = binary.Read(r, le, res.Results)
+		if err != nil {
+			return
+		}
+	}
+	if ppIntfDataPtr != 0 {
+		binary.Read(r, le, &maxCount)
+		ptrs := make([]uint32, cIfs)
+		err = binary.Read(r, le, ptrs)
+		if err != nil {
+			return
+		}
+		res.IntfData = make([][]byte, cIfs)
+		for i, ptr := range ptrs {
+			if ptr == 0 {
+				continue
+			}
+			res.IntfData[i], err = readMInterfacePointer(r)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func parseScmReplyInfo(buf []byte) (res *ScmReplyInfo, err error) {
+	ndr, err := typeDeserialize(buf)
+	if err != nil {
+		return
+	}
+	r := bytes.NewReader(ndr)
+	var reservedPtr, remoteReplyPtr uint32
+	binary.Read(r, le, &reservedPtr)
+	err = binary.Read(r, le, &remoteReplyPtr)
+	if err != nil {
+		return
+	}
+	if reservedPtr != 0 {
+		_, err = r.Seek(4, io.SeekCurrent)
+		if err != nil {
+			return
+		}
+	}
+	if remoteReplyPtr == 0 {
+		return nil, fmt.Errorf("ScmReplyInfo does not contain a remote reply")
+	}
+	res = &ScmReplyInfo{}
+	err = alignReader(r, 8)
+	if err != nil {
+		return
+	}
+	var bindingsPtr uint32
+	binary.Read(r, le, &res.Oxid)
+	binary.Read(r, le, &bindingsPtr)
+	res.IpidRemUnknown, err = readBytes(r, 16)
+	if err != nil {
+		return
+	}
+	binary.Read(r, le, &res.AuthnHint)
+	binary.Read(r, le, &res.ServerVersion.MajorVersion)
+	err = binary.Read(r, le, &res.ServerVersion.MinorVersion)
+	if err != nil {
+		return
+	}
+	if bindingsPtr != 0 {
+		res.OxidBindings, err = readNdrDualStringArray(r)
+	}
+	return
+}
@@ -0,0 +1,494 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package msdrsr implements a small subset of the Directory Replication
+// Service (DRS) Remote Protocol, enough to replicate the secret attributes of
+// selected accounts from a domain controller (DCSync).
+//
+// The replicated secrets are only returned over a DCERPC binding that is
+// authenticated with packet privacy, so the ServiceBind should be created with
+// dcerpc.BindAuth and dcerpc.AuthLevelPktPrivacy.
+package msdrsr
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/jfjallid/golog"
+)
+
+var (
+	log                  = golog.Get("github.com/ericblavier/go-smb/smb/dcerpc/msdrsr")
+	le  binary.ByteOrder = binary.LittleEndian
+)
+
+const (
+	MSRPCUuidDrsr                = "e3514235-4b06-11d1-ab04-00c04fc2dcd2"
+	MSRPCDrsrPipe                = "lsass"
+	MSRPCDrsrMajorVersion uint16 = 4
+	MSRPCDrsrMinorVersion uint16 = 0
+)
+
+// NTDSAPI client GUID used as puuidClientDsa by non-DC clients
+const NtdsapiClientGuid = "e24d201a-4fd6-11d1-a3da-0000f875ae0d"
+
+// MSRPC Directory Replication Service (drsuapi) Operations
+const (
+	DrsBind                 uint16 = 0
+	DrsUnbind               uint16 = 1
+	DrsGetNCChanges         uint16 = 3
+	DrsCrackNames           uint16 = 12
+	DrsDomainControllerInfo uint16 = 16
+)
+
+// MS-DRSR Section 5.39 DRS_EXTENSIONS_INT flags
+const (
+	DrsExtBase                     uint32 = 0x00000001
+	DrsExtAsyncRepl                uint32 = 0x00000002
+	DrsExtRemoveApi                uint32 = 0x00000004
+	DrsExtMoveReqV2                uint32 = 0x00000008
+	DrsExtGetChgDeflate            uint32 = 0x00000010
+	DrsExtDcInfoV1                 uint32 = 0x00000020
+	DrsExtRestoreUsnOptimization   uint32 = 0x00000040
+	DrsExtAddEntry                 uint32 = 0x00000080
+	DrsExtKccExecute               uint32 = 0x00000100
+	DrsExtAddEntryV2               uint32 = 0x00000200
+	DrsExtLinkedValueReplication   uint32 = 0x00000400
+	DrsExtDcInfoV2                 uint32 = 0x00000800
+	DrsExtInstanceTypeNotReqOnMod  uint32 = 0x00001000
+	DrsExtCryptoBind               uint32 = 0x00002000
+	DrsExtGetReplInfo              uint32 = 0x00004000
+	DrsExtStrongEncryption         uint32 = 0x00008000
+	DrsExtDcInfoVFFFFFFFF          uint32 = 0x00010000
+	DrsExtTransitiveMembership     uint32 = 0x00020000
+	DrsExtAddSidHistory            uint32 = 0x00040000
+	DrsExtPostBeta3                uint32 = 0x00080000
+	DrsExtGetChgReqV5              uint32 = 0x00100000
+	DrsExtGetMemberships2          uint32 = 0x00200000
+	DrsExtGetChgReqV6              uint32 = 0x00400000
+	DrsExtNonDomainNcs             uint32 = 0x00800000
+	DrsExtGetChgReqV8              uint32 = 0x01000000
+	DrsExtGetChgReplyV5            uint32 = 0x02000000
+	DrsExtGetChgReplyV6            uint32 = 0x04000000
+	DrsExtWhistlerBeta3            uint32 = 0x08000000
+	DrsExtW2K3Deflate              uint32 = 0x10000000
+	DrsExtGetChgReqV10             uint32 = 0x20000000
+	DrsExtReservedForWin2kOrDotnet uint32 = 0x40000000
+)
+
+// MS-DRSR Section 5.41 DRS_OPTIONS
+const (
+	DrsAsyncOp          uint32 = 0x00000001
+	DrsGetChanges       uint32 = 0x00000004
+	DrsUpdateNotify     uint32 = 0x00000008
+	DrsWritRep          uint32 = 0x00000010
+	DrsInitSync         uint32 = 0x00000020
+	DrsPerSync          uint32 = 0x00000040
+	DrsMailRep          uint32 = 0x00000080
+	DrsGetAnc           uint32 = 0x00000800
+	DrsSyncByName       uint32 = 0x00004000
+	DrsFullSyncNow      uint32 = 0x00008000
+	DrsGetNcSize        uint32 = 0x00001000
+	DrsSpecialSecretPro uint32 = 0x00000400
+)
+
+// MS-DRSR Section 4.1.10.2.22 EXOP_REQ codes
+const (
+	ExopFsmoReqRoleOwner    uint32 = 1
+	ExopFsmoReqRidAlloc     uint32 = 2
+	ExopFsmoRidReqRoleOwner uint32 = 3
+	ExopFsmoReqPdc          uint32 = 4
+	ExopFsmoAbandonRole     uint32 = 5
+	ExopReplObj             uint32 = 6
+	ExopReplSecrets         uint32 = 7
+)
+
+// MS-DRSR Section 4.1.10.2.21 EXOP_ERR codes
+const (
+	ExopErrSuccess             uint32 = 1
+	ExopErrUnknownOp           uint32 = 2
+	ExopErrFsmoNotOwner        uint32 = 3
+	ExopErrUpdateErr           uint32 = 4
+	ExopErrException           uint32 = 5
+	ExopErrUnknownCaller       uint32 = 6
+	ExopErrRidAllocError       uint32 = 7
+	ExopErrFsmoOwnerDeleted    uint32 = 8
+	ExopErrFsmoPendingOp       uint32 = 9
+	ExopErrMismatch            uint32 = 10
+	ExopErrCouldntContact      uint32 = 11
+	ExopErrFsmoRefusingRoles   uint32 = 12
+	ExopErrDirError            uint32 = 13
+	ExopErrFsmoMissingSettings uint32 = 14
+	ExopErrAccessDenied        uint32 = 15
+	ExopErrParamError          uint32 = 16
+)
+
+// MS-DRSR Section 4.1.4.1.3 DS_NAME_FORMAT
+const (
+	DsUnknownName                        uint32 = 0
+	DsFqdn1779Name                       uint32 = 1
+	DsNT4AccountName                     uint32 = 2
+	DsDisplayName                        uint32 = 3
+	DsUniqueIdName                       uint32 = 6
+	DsCanonicalName                      uint32 = 7
+	DsUserPrincipalName                  uint32 = 8
+	DsCanonicalNameEx                    uint32 = 9
+	DsServicePrincipalName               uint32 = 10
+	DsSidOrSidHistoryName                uint32 = 11
+	DsDnsDomainName                      uint32 = 12
+	DsNameFormatNT4AccountNameSansDomain uint32 = 0xfffffff2 // DS_NT4_ACCOUNT_NAME_SANS_DOMAIN
+)
+
+// MS-DRSR Section 4.1.4.1.5 DS_NAME_ERROR
+const (
+	DsNameNoError                   uint32 = 0
+	DsNameErrorResolving            uint32 = 1
+	DsNameErrorNotFound             uint32 = 2
+	DsNameErrorNotUnique            uint32 = 3
+	DsNameErrorNoMapping            uint32 = 4
+	DsNameErrorDomainOnly           uint32 = 5
+	DsNameErrorNoSyntacticalMapping uint32 = 6
+	DsNameErrorTrustReferral        uint32 = 7
+)
+
+var DsNameErrorMap = map[uint32]error{
+	DsNameNoError:                   fmt.Errorf("The name was resolved"),
+	DsNameErrorResolving:            fmt.Errorf("A generic processing error occurred"),
+	DsNameErrorNotFound:             fmt.Errorf("The name cannot be found or the caller does not have permission to access the name"),
+	DsNameErrorNotUnique:            fmt.Errorf("The input name is mapped to more than one output name"),
+	DsNameErrorNoMapping:            fmt.Errorf("The input name was found, but the associated output format cannot be found"),
+	DsNameErrorDomainOnly:           fmt.Errorf("The input name was found, but not the associated output format"),
+	DsNameErrorNoSyntacticalMapping: fmt.Errorf("A syntactical mapping cannot be performed on the client without transmitting over the network"),
+	DsNameErrorTrustReferral:        fmt.Errorf("The name is from an external trusted forest"),
+}
+
+const (
+	ErrorSuccess             uint32 = 0x00000000 // The operation completed successfully
+	ErrorAccessDenied        uint32 = 0x00000005 // Access is denied
+	ErrorInvalidParameter    uint32 = 0x00000057 // One of the function parameters is not valid.
+	ErrorDsDraBadDn          uint32 = 0x000020f7 // The distinguished name specified for this replication operation is invalid.
+	ErrorDsDraBadNc          uint32 = 0x000020f8 // The naming context specified for this replication operation is invalid.
+	ErrorDsDraAccessDenied   uint32 = 0x00002105 // Replication access was denied.
+	ErrorDsDraInternalError  uint32 = 0x00002108 // The replication operation encountered a database error.
+	ErrorDsDraSourceDisabled uint32 = 0x0000210e // The source destination for the replication operation is disabled.
+	ErrorDsDraObjectNotFound uint32 = 0x00002129 // The replication operation failed to locate the object.
+)
+
+var ResponseCodeMap = map[uint32]error{
+	ErrorSuccess:             fmt.Errorf("The operation completed successfully"),
+	ErrorAccessDenied:        fmt.Errorf("Access is denied"),
+	ErrorInvalidParameter:    fmt.Errorf("One of the function parameters is not valid"),
+	ErrorDsDraBadDn:          fmt.Errorf("The distinguished name specified for this replication operation is invalid"),
+	ErrorDsDraBadNc:          fmt.Errorf("The naming context specified for this replication operation is invalid"),
+	ErrorDsDraAccessDenied:   fmt.Errorf("Replication access was denied"),
+	ErrorDsDraInternalError:  fmt.Errorf("The replication operation encountered a database error"),
+	ErrorDsDraSourceDisabled: fmt.Errorf("The source destination for the replication operation is disabled"),
+	ErrorDsDraObjectNotFound: fmt.Errorf("The replication operation failed to locate the object"),
+}
+
+func NewRPCCon(sb *dcerpc.ServiceBind) *RPCCon {
+	return &RPCCon{sb}
+}
+
+func returnCodeToError(op string, returnCode uint32) error {
+	status, found := ResponseCodeMap[returnCode]
+	if !found {
+		return fmt.Errorf("Received unknown DRSR return code for %s response: 0x%x", op, returnCode)
+	}
+	return status
+}
+
+// DRSBind creates a DRS context handle. If the server reports a replication
+// epoch that differs from the one sent by the client, the bind is repeated
+// with the server's epoch as required for subsequent replication requests.
+func (sb *RPCCon) DRSBind() (handle *DrsHandle, err error) {
+	log.Debugln("In DRSBind")
+	clientDsa, err := msdtyp.GuidFromString(NtdsapiClientGuid)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	innerReq := DrsBindReq{
+		ClientDsa: clientDsa,
+		ClientExts: DrsExtensionsInt{
+			Flags:   DrsExtGetChgReqV6 | DrsExtGetChgReplyV6 | DrsExtGetChgReqV8 | DrsExtStrongEncryption,
+			ExtCaps: 0xffffffff,
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		var innerBuf []byte
+		innerBuf, err = innerReq.MarshalBinary()
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+
+		var buffer []byte
+		buffer, err = sb.MakeIoCtlRequest(DrsBind, innerBuf)
+		if err != nil {
+			return
+		}
+
+		var resp DrsBindRes
+		err = resp.UnmarshalBinary(buffer)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		if resp.ReturnCode != ErrorSuccess {
+			err = returnCodeToError("DRSBind", resp.ReturnCode)
+			log.Errorln(err)
+			return
+		}
+		handle = &DrsHandle{Handle: resp.Handle, ServerExtensions: resp.ServerExts}
+		if resp.ServerExts == nil || resp.ServerExts.ReplEpoch == innerReq.ClientExts.ReplEpoch {
+			break
+		}
+		if i == 0 {
+			log.Debugf("Server replication epoch is %d so rebinding\n", resp.ServerExts.ReplEpoch)
+			err = sb.DRSUnbind(handle)
+			if err != nil {
+				return
+			}
+			innerReq.ClientExts.ReplEpoch = resp.ServerExts.ReplEpoch
+		}
+	}
+
+	return
+}
+
+func (sb *RPCCon) DRSUnbind(handle *DrsHandle) (err error) {
+	log.Debugln("In DRSUnbind")
+	if handle == nil {
+		return fmt.Errorf("Cannot unbind a nil DrsHandle")
+	}
+	innerReq := DrsUnbindReq{Handle: handle.Handle}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(DrsUnbind, innerBuf)
+	if err != nil {
+		return
+	}
+
+	var resp DrsUnbindRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		err = returnCodeToError("DRSUnbind", resp.ReturnCode)
+		log.Errorln(err)
+	}
+	return
+}
+
+// DRSCrackNames translates the names from the offered format to the desired
+// format. Per item failures are reported in the Status of each result item.
+func (sb *RPCCon) DRSCrackNames(handle *DrsHandle, formatOffered, formatDesired uint32, names []string) (items []DsNameResultItem, err error) {
+	log.Debugln("In DRSCrackNames")
+	if handle == nil {
+		return nil, fmt.Errorf("DrsHandle cannot be nil")
+	}
+	innerReq := DrsCrackNamesReq{
+		Handle:        handle.Handle,
+		FormatOffered: formatOffered,
+		FormatDesired: formatDesired,
+		Names:         names,
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(DrsCrackNames, innerBuf)
+	if err != nil {
+		return
+	}
+
+	var resp DrsCrackNamesRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		err = returnCodeToError("DRSCrackNames", resp.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+
+	return resp.Items, nil
+}
+
+// DRSDomainControllerInfo retrieves information about the domain controllers
+// of the specified domain using info level 2.
+func (sb *RPCCon) DRSDomainControllerInfo(handle *DrsHandle, domain string) (items []DsDomainControllerInfo2, err error) {
+	log.Debugln("In DRSDomainControllerInfo")
+	if handle == nil {
+		return nil, fmt.Errorf("DrsHandle cannot be nil")
+	}
+	innerReq := DrsDomainControllerInfoReq{
+		Handle:    handle.Handle,
+		Domain:    domain,
+		InfoLevel: 2,
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(DrsDomainControllerInfo, innerBuf)
+	if err != nil {
+		return
+	}
+
+	var resp DrsDomainControllerInfoRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		err = returnCodeToError("DRSDomainControllerInfo", resp.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+
+	return resp.Items, nil
+}
+
+func (sb *RPCCon) DRSGetNCChanges(req *DrsGetNCChangesReq) (res *DrsGetNCChangesRes, err error) {
+	log.Debugln("In DRSGetNCChanges")
+	innerBuf, err := req.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(DrsGetNCChanges, innerBuf)
+	if err != nil {
+		return
+	}
+
+	res = &DrsGetNCChangesRes{}
+	err = res.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if res.ReturnCode != ErrorSuccess {
+		err = returnCodeToError("DRSGetNCChanges", res.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	if res.ExtendedRet != ExopErrSuccess {
+		err = fmt.Errorf("DRSGetNCChanges extended operation failed with code: %d", res.ExtendedRet)
+		log.Errorln(err)
+		return
+	}
+
+	return
+}
+
+// LookupObjectGuid resolves an account name in any format understood by
+// DRSCrackNames to the GUID of the object, together with the DNS name of
+// the domain the object belongs to.
+func (sb *RPCCon) LookupObjectGuid(handle *DrsHandle, formatOffered uint32, name string) (guid []byte, domain string, err error) {
+	items, err := sb.DRSCrackNames(handle, formatOffered, DsUniqueIdName, []string{name})
+	if err != nil {
+		return
+	}
+	if len(items) != 1 {
+		return nil, "", fmt.Errorf("Unexpected number of items in DRSCrackNames response")
+	}
+	if items[0].Status != DsNameNoError {
+		status, found := DsNameErrorMap[items[0].Status]
+		if !found {
+			status = fmt.Errorf("Unknown DS_NAME_ERROR: %d", items[0].Status)
+		}
+		return nil, "", fmt.Errorf("Failed to translate name %s: %v", name, status)
+	}
+	guid, err = msdtyp.GuidFromString(items[0].Name)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return guid, items[0].Domain, nil
+}
+
+// DCSync replicates the secret attributes of the account with the specified
+// name from the domain controller. The name is translated with DRSCrackNames
+// from the specified format, e.g., DsNT4AccountName for "DOMAIN\user" or
+// DsUserPrincipalName for "user@domain.local".
+func (sb *RPCCon) DCSync(handle *DrsHandle, formatOffered uint32, name string) (account *ReplicatedAccount, err error) {
+	log.Debugln("In DCSync")
+	if handle == nil {
+		return nil, fmt.Errorf("DrsHandle cannot be nil")
+	}
+	objectGuid, domain, err := sb.LookupObjectGuid(handle, formatOffered, name)
+	if err != nil {
+		return
+	}
+
+	if handle.NtdsDsaObjectGuid == nil {
+		var dcs []DsDomainControllerInfo2
+		dcs, err = sb.DRSDomainControllerInfo(handle, domain)
+		if err != nil {
+			return
+		}
+		if len(dcs) == 0 {
+			return nil, fmt.Errorf("No domain controllers returned for domain %s", domain)
+		}
+		handle.NtdsDsaObjectGuid = dcs[0].NtdsDsaObjectGuid
+	}
+
+	req := DrsGetNCChangesReq{
+		Handle:          handle.Handle,
+		DsaObjDest:      handle.NtdsDsaObjectGuid,
+		InvocIdSrc:      handle.NtdsDsaObjectGuid,
+		NC:              DsName{Guid: objectGuid},
+		Flags:           DrsInitSync | DrsWritRep,
+		MaxObjects:      1,
+		ExtendedOp:      ExopReplObj,
+		PartialAttrSet:  DCSyncAttributes,
+		PrefixTableDest: DCSyncPrefixTable,
+	}
+	res, err := sb.DRSGetNCChanges(&req)
+	if err != nil {
+		return
+	}
+	if len(res.Objects) == 0 {
+		return nil, fmt.Errorf("DRSGetNCChanges did not return any objects")
+	}
+
+	return newReplicatedAccount(&res.Objects[0].EntInf, res.PrefixTableSrc, sb.GetSessionKey())
+}
@@ -0,0 +1,206 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package msdrsr
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rc4"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+
+	"testing"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+func TestDrsBindReq(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("010000001a204de2d64fd111a3da0000f875ae0d020000003400000034000000008040050000000000000000000000000000000000000000000000000000000000000000000000000000000000000000ffffffff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientDsa, err := msdtyp.GuidFromString(NtdsapiClientGuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := DrsBindReq{
+		ClientDsa: clientDsa,
+		ClientExts: DrsExtensionsInt{
+			Flags:   DrsExtGetChgReqV6 | DrsExtGetChgReplyV6 | DrsExtGetChgReqV8 | DrsExtStrongEncryption,
+			ExtCaps: 0xffffffff,
+		},
+	}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(pkt, buf) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestDrsBindRes(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("010002001c0000001c000000ff7fffff83c5ab2d7e0f2f4ab2e8bbd2a3ccc2f3e80300000a00000000000000a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d400000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp DrsBindRes
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ServerExts == nil {
+		t.Fatal("Fail")
+	}
+	if resp.ServerExts.Flags != 0xffff7fff {
+		t.Fatal("Fail")
+	}
+	if resp.ServerExts.Pid != 1000 {
+		t.Fatal("Fail")
+	}
+	if resp.ServerExts.ReplEpoch != 10 {
+		t.Fatal("Fail")
+	}
+	if hex.EncodeToString(resp.Handle) != "00000000a1b2c3d4e5f60718293a4b5c6d7e8f90" {
+		t.Fatal("Fail")
+	}
+	if resp.ReturnCode != 0xd4c3b2a1 {
+		t.Fatal("Fail")
+	}
+}
+
+func TestGuidString(t *testing.T) {
+	guid, err := msdtyp.GuidFromString("{" + NtdsapiClientGuid + "}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(guid) != "1a204de2d64fd111a3da0000f875ae0d" {
+		t.Fatal("Fail")
+	}
+	if msdtyp.GuidToString(guid) != NtdsapiClientGuid {
+		t.Fatal("Fail")
+	}
+}
+
+func TestOidFromAttid(t *testing.T) {
+	tests := map[uint32]string{
+		AttrTypUserAccountControl: OidUserAccountControl,
+		AttrTypUnicodePwd:         OidUnicodePwd,
+		AttrTypObjectSid:          OidObjectSid,
+		AttrTypSAMAccountName:     OidSAMAccountName,
+		AttrTypUserPrincipalName:  OidUserPrincipalName,
+	}
+	for attid, expected := range tests {
+		oid, err := oidFromAttid(DCSyncPrefixTable, attid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if oid != expected {
+			t.Fatalf("Fail: 0x%x resolved to %s", attid, oid)
+		}
+	}
+	_, err := oidFromAttid(DCSyncPrefixTable, 0x00010001)
+	if err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestDecryptAttributeValue(t *testing.T) {
+	sessionKey, _ := hex.DecodeString("00112233445566778899aabbccddeeff")
+	salt, _ := hex.DecodeString("0f0e0d0c0b0a09080706050403020100")
+	data, _ := hex.DecodeString("8846f7eaee8fb117ad06bdd830b7586c")
+
+	plaintext := binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(data))
+	plaintext = append(plaintext, data...)
+	key := md5.Sum(append(append([]byte{}, sessionKey...), salt...))
+	cipher, err := rc4.NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := append([]byte{}, salt...)
+	value = append(value, make([]byte, len(plaintext))...)
+	cipher.XORKeyStream(value[16:], plaintext)
+
+	res, err := decryptAttributeValue(sessionKey, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, data) {
+		t.Fatal("Fail")
+	}
+
+	value[len(value)-1] ^= 0xff
+	_, err = decryptAttributeValue(sessionKey, value)
+	if err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestParseUserProperties(t *testing.T) {
+	key, _ := hex.DecodeString("0123456789abcdef0123456789abcdef")
+	kerb := make([]byte, 24+24)
+	le.PutUint16(kerb[0:], 4)                                       // Revision
+	le.PutUint16(kerb[4:], 1)                                       // CredentialCount
+	le.PutUint32(kerb[24+8:], 4096)                                 // IterationCount
+	le.PutUint32(kerb[24+12:], uint32(KerbKeyTypeAes128CtsHmacSha)) // KeyType
+	le.PutUint32(kerb[24+16:], uint32(len(key)))                    // KeyLength
+	le.PutUint32(kerb[24+20:], uint32(len(kerb)))                   // KeyOffset
+	kerb = append(kerb, key...)
+
+	name := msdtyp.ToUnicode("Primary:Kerberos-Newer-Keys")
+	value := []byte(hex.EncodeToString(kerb))
+	buf := make([]byte, 0x70)
+	le.PutUint16(buf[0x6c:], 0x50)
+	le.PutUint16(buf[0x6e:], 1)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(name)))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(value)))
+	buf = binary.LittleEndian.AppendUint16(buf, 0)
+	buf = append(buf, name...)
+	buf = append(buf, value...)
+
+	props, err := parseUserProperties(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ok := props["Primary:Kerberos-Newer-Keys"]
+	if !ok {
+		t.Fatal("Fail")
+	}
+	keys, err := parseKerberosNewerKeys(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatal("Fail")
+	}
+	if keys[0].KeyType != KerbKeyTypeAes128CtsHmacSha || keys[0].IterationCount != 4096 {
+		t.Fatal("Fail")
+	}
+	if !bytes.Equal(keys[0].Key, key) {
+		t.Fatal("Fail")
+	}
+}
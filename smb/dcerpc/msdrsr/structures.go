@@ -0,0 +1,1226 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// The marshal/unmarshal of requests and responses according to the NDR syntax
+// has been implemented on a per RPC request basis and not in any complete way.
+// As such, for each new functionality, a manual marshal and unmarshal method
+// has to be written for the relevant messages. This makes it a bit easier to
+// define the message structs but more of the heavy lifting has to be performed
+// by the marshal/unmarshal functions.
+
+package msdrsr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+)
+
+type RPCCon struct {
+	*dcerpc.ServiceBind
+}
+
+// DrsHandle is a bound DRS context handle together with the state learned
+// from the server during the bind.
+type DrsHandle struct {
+	Handle           []byte // 20 byte context handle
+	ServerExtensions *DrsExtensionsInt
+	// GUID of the NTDS Settings object of the DC. Looked up on demand since it
+	// is required for replication requests.
+	NtdsDsaObjectGuid []byte
+}
+
+// MS-DRSR Section 5.39 DRS_EXTENSIONS_INT
+type DrsExtensionsInt struct {
+	Flags         uint32
+	SiteObjGuid   []byte // 16 bytes
+	Pid           uint32
+	ReplEpoch     uint32
+	FlagsExt      uint32
+	ConfigObjGuid []byte // 16 bytes
+	ExtCaps       uint32
+}
+
+/*
+MS-DRSR Section 4.1.3.1
+
+	ULONG IDL_DRSBind(
+	  [in] handle_t rpc_handle,
+	  [in, unique] UUID* puuidClientDsa,
+	  [in, unique] DRS_EXTENSIONS* pextClient,
+	  [out] DRS_EXTENSIONS** ppextServer,
+	  [out, ref] DRS_HANDLE* phDrs
+	);
+*/
+type DrsBindReq struct {
+	ClientDsa  []byte // 16 bytes
+	ClientExts DrsExtensionsInt
+}
+
+type DrsBindRes struct {
+	ServerExts *DrsExtensionsInt
+	Handle     []byte
+	ReturnCode uint32
+}
+
+/*
+MS-DRSR Section 4.1.25.1
+
+	ULONG IDL_DRSUnbind(
+	  [in, out, ref] DRS_HANDLE* phDrs
+	);
+*/
+type DrsUnbindReq struct {
+	Handle []byte
+}
+
+type DrsUnbindRes struct {
+	Handle     []byte
+	ReturnCode uint32
+}
+
+/*
+MS-DRSR Section 4.1.4.1.2
+
+	typedef struct {
+	  ULONG CodePage;
+	  ULONG LocaleId;
+	  DWORD dwFlags;
+	  DWORD formatOffered;
+	  DWORD formatDesired;
+	  [range(1,10000)] DWORD cNames;
+	  [string, size_is(cNames)] WCHAR** rpNames;
+	} DRS_MSG_CRACKREQ_V1;
+*/
+type DrsCrackNamesReq struct {
+	Handle        []byte
+	CodePage      uint32
+	LocaleId      uint32
+	Flags         uint32
+	FormatOffered uint32
+	FormatDesired uint32
+	Names         []string
+}
+
+// MS-DRSR Section 4.1.4.1.4 DS_NAME_RESULT_ITEMW
+type DsNameResultItem struct {
+	Status uint32
+	Domain string
+	Name   string
+}
+
+type DrsCrackNamesRes struct {
+	OutVersion uint32
+	Items      []DsNameResultItem
+	ReturnCode uint32
+}
+
+/*
+MS-DRSR Section 4.1.5.1.1
+
+	typedef struct {
+	  [string, unique] WCHAR* Domain;
+	  DWORD InfoLevel;
+	} DRS_MSG_DCINFOREQ_V1;
+*/
+type DrsDomainControllerInfoReq struct {
+	Handle    []byte
+	Domain    string
+	InfoLevel uint32
+}
+
+// MS-DRSR Section 4.1.5.1.4 DS_DOMAIN_CONTROLLER_INFO_2W
+type DsDomainControllerInfo2 struct {
+	NetbiosName        string
+	DnsHostName        string
+	SiteName           string
+	SiteObjectName     string
+	ComputerObjectName string
+	ServerObjectName   string
+	NtdsDsaObjectName  string
+	IsPdc              bool
+	DsEnabled          bool
+	IsGc               bool
+	SiteObjectGuid     []byte
+	ComputerObjectGuid []byte
+	ServerObjectGuid   []byte
+	NtdsDsaObjectGuid  []byte
+}
+
+type DrsDomainControllerInfoRes struct {
+	OutVersion uint32
+	Items      []DsDomainControllerInfo2
+	ReturnCode uint32
+}
+
+/*
+MS-DRSR Section 5.50
+
+	typedef struct {
+	  unsigned long structLen;
+	  unsigned long SidLen;
+	  GUID Guid;
+	  NT4SID Sid;
+	  unsigned long NameLen;
+	  [range(0, 10485761)] [size_is(NameLen + 1)] WCHAR StringName[];
+	} DSNAME;
+*/
+type DsName struct {
+	Guid       []byte // 16 bytes
+	Sid        []byte // Up to 28 bytes
+	StringName string
+}
+
+// MS-DRSR Section 5.209 USN_VECTOR
+type UsnVector struct {
+	UsnHighObjUpdate  int64
+	UsnReserved       int64
+	UsnHighPropUpdate int64
+}
+
+// MS-DRSR Section 5.14 PrefixTableEntry
+type PrefixTableEntry struct {
+	Ndx    uint32
+	Prefix []byte // BER encoded OID prefix
+}
+
+/*
+MS-DRSR Section 4.1.10.2.5
+
+	typedef struct {
+	  UUID uuidDsaObjDest;
+	  UUID uuidInvocIdSrc;
+	  [ref] DSNAME* pNC;
+	  USN_VECTOR usnvecFrom;
+	  [unique] UPTODATE_VECTOR_V1_EXT* pUpToDateVecDest;
+	  ULONG ulFlags;
+	  ULONG cMaxObjects;
+	  ULONG cMaxBytes;
+	  ULONG ulExtendedOp;
+	  ULARGE_INTEGER liFsmoInfo;
+	  [unique] PARTIAL_ATTR_VECTOR_V1_EXT* pPartialAttrSet;
+	  [unique] PARTIAL_ATTR_VECTOR_V1_EXT* pPartialAttrSetEx;
+	  SCHEMA_PREFIX_TABLE PrefixTableDest;
+	} DRS_MSG_GETCHGREQ_V8;
+
+The up-to-date vector and the extended partial attribute set are always
+sent as NULL pointers.
+*/
+type DrsGetNCChangesReq struct {
+	Handle          []byte
+	DsaObjDest      []byte // 16 bytes
+	InvocIdSrc      []byte // 16 bytes
+	NC              DsName
+	UsnVecFrom      UsnVector
+	Flags           uint32
+	MaxObjects      uint32
+	MaxBytes        uint32
+	ExtendedOp      uint32
+	FsmoInfo        uint64
+	PartialAttrSet  []uint32
+	PrefixTableDest []PrefixTableEntry
+}
+
+// MS-DRSR Section 5.9 ATTR with the values of the ATTRVALBLOCK flattened
+type Attr struct {
+	AttrTyp uint32
+	Values  [][]byte
+}
+
+// MS-DRSR Section 5.61 ENTINF
+type EntInf struct {
+	Name  *DsName
+	Flags uint32
+	Attrs []Attr
+}
+
+// MS-DRSR Section 5.162 PROPERTY_META_DATA_EXT
+type PropertyMetaDataExt struct {
+	Version        uint32
+	TimeChanged    int64
+	DsaOriginating []byte
+	UsnOriginating int64
+}
+
+// MS-DRSR Section 5.171 REPLENTINFLIST
+type ReplEntInfList struct {
+	EntInf     EntInf
+	IsNCPrefix bool
+	ParentGuid []byte
+	MetaData   []PropertyMetaDataExt
+}
+
+/*
+MS-DRSR Section 4.1.10.2.11
+
+	typedef struct {
+	  UUID uuidDsaObjSrc;
+	  UUID uuidInvocIdSrc;
+	  [unique] DSNAME* pNC;
+	  USN_VECTOR usnvecFrom;
+	  USN_VECTOR usnvecTo;
+	  [unique] UPTODATE_VECTOR_V2_EXT* pUpToDateVecSrc;
+	  SCHEMA_PREFIX_TABLE PrefixTableSrc;
+	  ULONG ulExtendedRet;
+	  ULONG cNumObjects;
+	  ULONG cNumBytes;
+	  [unique] REPLENTINFLIST* pObjects;
+	  BOOL fMoreData;
+	  ULONG cNumNcSizeObjects;
+	  ULONG cNumNcSizeValues;
+	  [range(0,1048576)] DWORD cNumValues;
+	  [size_is(cNumValues)] REPLVALINF_V1* rgValues;
+	  DWORD dwDRSError;
+	} DRS_MSG_GETCHGREPLY_V6;
+
+Linked value replication data (rgValues) is not parsed.
+*/
+type DrsGetNCChangesRes struct {
+	OutVersion       uint32
+	DsaObjSrc        []byte
+	InvocIdSrc       []byte
+	NC               *DsName
+	UsnVecFrom       UsnVector
+	UsnVecTo         UsnVector
+	PrefixTableSrc   []PrefixTableEntry
+	ExtendedRet      uint32
+	NumObjects       uint32
+	NumBytes         uint32
+	Objects          []ReplEntInfList
+	MoreData         bool
+	NumNcSizeObjects uint32
+	NumNcSizeValues  uint32
+	NumValues        uint32
+	DRSError         uint32
+	ReturnCode       uint32
+}
+
+// Helpers for NDR alignment relative to the start of the stub data
+
+func alignWriter(w *bytes.Buffer, n int) {
+	if pad := (n - (w.Len() % n)) % n; pad != 0 {
+		w.Write(make([]byte, pad))
+	}
+}
+
+func alignReader(r *bytes.Reader, n int64) (err error) {
+	pos := r.Size() - int64(r.Len())
+	if pad := (n - (pos % n)) % n; pad != 0 {
+		_, err = r.Seek(pad, io.SeekCurrent)
+	}
+	return
+}
+
+func readUint32(r *bytes.Reader) (v uint32, err error) {
+	err = binary.Read(r, le, &v)
+	return
+}
+
+func readBytes(r *bytes.Reader, n int) (buf []byte, err error) {
+	if n < 0 || n > r.Len() {
+		return nil, fmt.Errorf("Cannot read %d bytes from buffer with only %d bytes remaining", n, r.Len())
+	}
+	buf = make([]byte, n)
+	_, err = io.ReadFull(r, buf)
+	return
+}
+
+func (self *DrsExtensionsInt) MarshalBinary() (res []byte, err error) {
+	w := bytes.NewBuffer(res)
+	siteGuid := self.SiteObjGuid
+	if siteGuid == nil {
+		siteGuid = make([]byte, 16)
+	}
+	configGuid := self.ConfigObjGuid
+	if configGuid == nil {
+		configGuid = make([]byte, 16)
+	}
+	binary.Write(w, le, self.Flags)
+	w.Write(siteGuid)
+	binary.Write(w, le, self.Pid)
+	binary.Write(w, le, self.ReplEpoch)
+	binary.Write(w, le, self.FlagsExt)
+	w.Write(configGuid)
+	binary.Write(w, le, self.ExtCaps)
+	return w.Bytes(), nil
+}
+
+// The server may return a shorter structure so only the fields that are
+// present are decoded. The buffer holds the rgb bytes following cb.
+func (self *DrsExtensionsInt) UnmarshalBinary(buf []byte) (err error) {
+	if len(buf) < 4 {
+		return fmt.Errorf("Buffer to small for DrsExtensionsInt")
+	}
+	self.Flags = le.Uint32(buf)
+	if len(buf) >= 20 {
+		self.SiteObjGuid = make([]byte, 16)
+		copy(self.SiteObjGuid, buf[4:20])
+	}
+	if len(buf) >= 24 {
+		self.Pid = le.Uint32(buf[20:])
+	}
+	if len(buf) >= 28 {
+		self.ReplEpoch = le.Uint32(buf[24:])
+	}
+	if len(buf) >= 32 {
+		self.FlagsExt = le.Uint32(buf[28:])
+	}
+	if len(buf) >= 48 {
+		self.ConfigObjGuid = make([]byte, 16)
+		copy(self.ConfigObjGuid, buf[32:48])
+	}
+	if len(buf) >= 52 {
+		self.ExtCaps = le.Uint32(buf[48:])
+	}
+	return
+}
+
+func (self *DrsBindReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for DrsBindReq")
+	if len(self.ClientDsa) != 16 {
+		return nil, fmt.Errorf("ClientDsa must be a 16 byte UUID")
+	}
+	w := bytes.NewBuffer(res)
+
+	// puuidClientDsa
+	binary.Write(w, le, uint32(1)) // ReferentId
+	w.Write(self.ClientDsa)
+
+	extBuf, err := self.ClientExts.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	// pextClient
+	binary.Write(w, le, uint32(2))           // ReferentId
+	binary.Write(w, le, uint32(len(extBuf))) // MaxCount
+	binary.Write(w, le, uint32(len(extBuf))) // cb
+	w.Write(extBuf)
+
+	return w.Bytes(), nil
+}
+
+func (self *DrsBindReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of DrsBindReq")
+}
+
+func (self *DrsBindRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of DrsBindRes")
+}
+
+func (self *DrsBindRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for DrsBindRes")
+	if len(buf) < 28 {
+		return fmt.Errorf("Buffer to small for DrsBindRes")
+	}
+	r := bytes.NewReader(buf)
+	refId, err := readUint32(r)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if refId != 0 {
+		// Skip MaxCount
+		_, err = r.Seek(4, io.SeekCurrent)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		var cb uint32
+		cb, err = readUint32(r)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		var extBuf []byte
+		extBuf, err = readBytes(r, int(cb))
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		self.ServerExts = &DrsExtensionsInt{}
+		err = self.ServerExts.UnmarshalBinary(extBuf)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		err = alignReader(r, 4)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	self.Handle, err = readBytes(r, 20)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	self.ReturnCode, err = readUint32(r)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return
+}
+
+func (self *DrsUnbindReq) MarshalBinary() (res []byte, err error) {
+	if len(self.Handle) != 20 {
+		return nil, fmt.Errorf("Invalid DRS handle")
+	}
+	return append([]byte{}, self.Handle...), nil
+}
+
+func (self *DrsUnbindReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of DrsUnbindReq")
+}
+
+func (self *DrsUnbindRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of DrsUnbindRes")
+}
+
+func (self *DrsUnbindRes) UnmarshalBinary(buf []byte) (err error) {
+	if len(buf) < 24 {
+		return fmt.Errorf("Buffer to small for DrsUnbindRes")
+	}
+	self.Handle = make([]byte, 20)
+	copy(self.Handle, buf[:20])
+	self.ReturnCode = le.Uint32(buf[20:])
+	return
+}
+
+func (self *DrsCrackNamesReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for DrsCrackNamesReq")
+	if len(self.Handle) != 20 {
+		return nil, fmt.Errorf("Invalid DRS handle")
+	}
+	if len(self.Names) == 0 {
+		return nil, fmt.Errorf("At least one name must be specified")
+	}
+	w := bytes.NewBuffer(res)
+	w.Write(self.Handle)
+	binary.Write(w, le, uint32(1)) // dwInVersion
+	binary.Write(w, le, uint32(1)) // Union switch
+	binary.Write(w, le, self.CodePage)
+	binary.Write(w, le, self.LocaleId)
+	binary.Write(w, le, self.Flags)
+	binary.Write(w, le, self.FormatOffered)
+	binary.Write(w, le, self.FormatDesired)
+	binary.Write(w, le, uint32(len(self.Names)))
+	refId := uint32(1)
+	binary.Write(w, le, refId) // rpNames
+	refId++
+	binary.Write(w, le, uint32(len(self.Names))) // MaxCount
+	for range self.Names {
+		binary.Write(w, le, refId)
+		refId++
+	}
+	for _, name := range self.Names {
+		_, err = msdtyp.WriteConformantVaryingString(w, name, true)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	return w.Bytes(), nil
+}
+
+func (self *DrsCrackNamesReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of DrsCrackNamesReq")
+}
+
+func (self *DrsCrackNamesRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of DrsCrackNamesRes")
+}
+
+func (self *DrsCrackNamesRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for DrsCrackNamesRes")
+	if len(buf) < 16 {
+		return fmt.Errorf("Buffer to small for DrsCrackNamesRes")
+	}
+	self.ReturnCode = le.Uint32(buf[len(buf)-4:])
+	r := bytes.NewReader(buf[:len(buf)-4])
+	self.OutVersion, err = readUint32(r)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	// Skip union switch
+	_, err = r.Seek(4, io.SeekCurrent)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	resultPtr, err := readUint32(r)
+	if err != nil || resultPtr == 0 {
+		return
+	}
+	count, err := readUint32(r)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	itemsPtr, err := readUint32(r)
+	if err != nil || itemsPtr == 0 {
+		return
+	}
+	maxCount, err := readUint32(r)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if maxCount < count || int(count)*12 > r.Len() {
+		return fmt.Errorf("Invalid number of items in DrsCrackNamesRes")
+	}
+	type itemPtrs struct{ domain, name uint32 }
+	ptrs := make([]itemPtrs, count)
+	self.Items = make([]DsNameResultItem, count)
+	for i := range self.Items {
+		self.Items[i].Status, _ = readUint32(r)
+		ptrs[i].domain, _ = readUint32(r)
+		ptrs[i].name, err = readUint32(r)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	for i := range self.Items {
+		if ptrs[i].domain != 0 {
+			self.Items[i].Domain, err = msdtyp.ReadConformantVaryingString(r, true)
+			if err != nil {
+				log.Errorln(err)
+				return
+			}
+		}
+		if ptrs[i].name != 0 {
+			self.Items[i].Name, err = msdtyp.ReadConformantVaryingString(r, true)
+			if err != nil {
+				log.Errorln(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+func (self *DrsDomainControllerInfoReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for DrsDomainControllerInfoReq")
+	if len(self.Handle) != 20 {
+		return nil, fmt.Errorf("Invalid DRS handle")
+	}
+	w := bytes.NewBuffer(res)
+	w.Write(self.Handle)
+	binary.Write(w, le, uint32(1)) // dwInVersion
+	binary.Write(w, le, uint32(1)) // Union switch
+	refId := uint32(1)
+	_, err = msdtyp.WriteConformantVaryingStringPtr(w, self.Domain, &refId, true)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	binary.Write(w, le, self.InfoLevel)
+	return w.Bytes(), nil
+}
+
+func (self *DrsDomainControllerInfoReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of DrsDomainControllerInfoReq")
+}
+
+func (self *DrsDomainControllerInfoRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of DrsDomainControllerInfoRes")
+}
+
+func (self *DrsDomainControllerInfoRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for DrsDomainControllerInfoRes")
+	if len(buf) < 16 {
+		return fmt.Errorf("Buffer to small for DrsDomainControllerInfoRes")
+	}
+	self.ReturnCode = le.Uint32(buf[len(buf)-4:])
+	r := bytes.NewReader(buf[:len(buf)-4])
+	self.OutVersion, err = readUint32(r)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if self.OutVersion != 2 {
+		return fmt.Errorf("Unsupported DCINFOREPLY version %d", self.OutVersion)
+	}
+	// Skip union switch
+	_, err = r.Seek(4, io.SeekCurrent)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	count, err := readUint32(r)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	itemsPtr, err := readUint32(r)
+	if err != nil || itemsPtr == 0 {
+		return
+	}
+	maxCount, err := readUint32(r)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if maxCount < count || int(count)*104 > r.Len() {
+		return fmt.Errorf("Invalid number of items in DrsDomainControllerInfoRes")
+	}
+	strPtrs := make([][7]uint32, count)
+	self.Items = make([]DsDomainControllerInfo2, count)
+	for i := range self.Items {
+		item := &self.Items[i]
+		for j := 0; j < 7; j++ {
+			strPtrs[i][j], _ = readUint32(r)
+		}
+		var v uint32
+		v, _ = readUint32(r)
+		item.IsPdc = v != 0
+		v, _ = readUint32(r)
+		item.DsEnabled = v != 0
+		v, _ = readUint32(r)
+		item.IsGc = v != 0
+		item.SiteObjectGuid, _ = readBytes(r, 16)
+		item.ComputerObjectGuid, _ = readBytes(r, 16)
+		item.ServerObjectGuid, _ = readBytes(r, 16)
+		item.NtdsDsaObjectGuid, err = readBytes(r, 16)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	for i := range self.Items {
+		item := &self.Items[i]
+		fields := []*string{&item.NetbiosName, &item.DnsHostName, &item.SiteName, &item.SiteObjectName, &item.ComputerObjectName, &item.ServerObjectName, &item.NtdsDsaObjectName}
+		for j, field := range fields {
+			if strPtrs[i][j] == 0 {
+				continue
+			}
+			*field, err = msdtyp.ReadConformantVaryingString(r, true)
+			if err != nil {
+				log.Errorln(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+func (self *DsName) structLen() uint32 {
+	return uint32(56 + (len(msdtyp.ToUnicode(self.StringName)) + 2))
+}
+
+// Encode the DSNAME as the referent of a pointer, i.e., including the
+// conformance but not the ReferentId.
+func (self *DsName) writeTo(w *bytes.Buffer) (err error) {
+	if len(self.Sid) > 28 {
+		return fmt.Errorf("DsName Sid can at most be 28 bytes")
+	}
+	guid := self.Guid
+	if guid == nil {
+		guid = make([]byte, 16)
+	} else if len(guid) != 16 {
+		return fmt.Errorf("DsName Guid must be 16 bytes")
+	}
+	name := msdtyp.ToUnicode(self.StringName)
+	nameLen := uint32(len(name) / 2)
+
+	alignWriter(w, 4)
+	binary.Write(w, le, nameLen+1) // MaxCount
+	binary.Write(w, le, self.structLen())
+	binary.Write(w, le, uint32(len(self.Sid)))
+	w.Write(guid)
+	sid := make([]byte, 28)
+	copy(sid, self.Sid)
+	w.Write(sid)
+	binary.Write(w, le, nameLen)
+	w.Write(name)
+	w.Write([]byte{0, 0})
+	alignWriter(w, 4)
+	return
+}
+
+func readDsName(r *bytes.Reader) (res *DsName, err error) {
+	err = alignReader(r, 4)
+	if err != nil {
+		return
+	}
+	maxCount, err := readUint32(r)
+	if err != nil {
+		return
+	}
+	// Skip structLen
+	_, err = r.Seek(4, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+	sidLen, err := readUint32(r)
+	if err != nil {
+		return
+	}
+	res = &DsName{}
+	res.Guid, err = readBytes(r, 16)
+	if err != nil {
+		return
+	}
+	sid, err := readBytes(r, 28)
+	if err != nil {
+		return
+	}
+	if sidLen > 28 {
+		return nil, fmt.Errorf("Invalid SidLen in DSNAME")
+	}
+	res.Sid = sid[:sidLen]
+	nameLen, err := readUint32(r)
+	if err != nil {
+		return
+	}
+	if nameLen >= maxCount && maxCount != 0 {
+		return nil, fmt.Errorf("Invalid NameLen in DSNAME")
+	}
+	name, err := readBytes(r, int(maxCount)*2)
+	if err != nil {
+		return
+	}
+	res.StringName, err = msdtyp.FromUnicodeString(name[:nameLen*2])
+	if err != nil {
+		return
+	}
+	err = alignReader(r, 4)
+	return
+}
+
+func (self *DrsGetNCChangesReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for DrsGetNCChangesReq")
+	if len(self.Handle) != 20 {
+		return nil, fmt.Errorf("Invalid DRS handle")
+	}
+	if len(self.DsaObjDest) != 16 || len(self.InvocIdSrc) != 16 {
+		return nil, fmt.Errorf("DsaObjDest and InvocIdSrc must be 16 byte UUIDs")
+	}
+	w := bytes.NewBuffer(res)
+	w.Write(self.Handle)
+	binary.Write(w, le, uint32(8)) // dwInVersion
+	binary.Write(w, le, uint32(8)) // Union switch
+	// The union arm contains 8 byte aligned members
+	alignWriter(w, 8)
+	w.Write(self.DsaObjDest)
+	w.Write(self.InvocIdSrc)
+	refId := uint32(1)
+	binary.Write(w, le, refId) // pNC
+	refId++
+	alignWriter(w, 8)
+	binary.Write(w, le, self.UsnVecFrom.UsnHighObjUpdate)
+	binary.Write(w, le, self.UsnVecFrom.UsnReserved)
+	binary.Write(w, le, self.UsnVecFrom.UsnHighPropUpdate)
+	binary.Write(w, le, uint32(0)) // pUpToDateVecDest
+	binary.Write(w, le, self.Flags)
+	binary.Write(w, le, self.MaxObjects)
+	binary.Write(w, le, self.MaxBytes)
+	binary.Write(w, le, self.ExtendedOp)
+	alignWriter(w, 8)
+	binary.Write(w, le, self.FsmoInfo)
+	if len(self.PartialAttrSet) > 0 {
+		binary.Write(w, le, refId) // pPartialAttrSet
+		refId++
+	} else {
+		binary.Write(w, le, uint32(0))
+	}
+	binary.Write(w, le, uint32(0)) // pPartialAttrSetEx
+	binary.Write(w, le, uint32(len(self.PrefixTableDest)))
+	if len(self.PrefixTableDest) > 0 {
+		binary.Write(w, le, refId) // pPrefixEntry
+		refId++
+	} else {
+		binary.Write(w, le, uint32(0))
+	}
+
+	// Deferred pointers
+	err = self.NC.writeTo(w)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if len(self.PartialAttrSet) > 0 {
+		binary.Write(w, le, uint32(len(self.PartialAttrSet))) // MaxCount
+		binary.Write(w, le, uint32(1))                        // dwVersion
+		binary.Write(w, le, uint32(0))                        // dwReserved1
+		binary.Write(w, le, uint32(len(self.PartialAttrSet)))
+		for _, attr := range self.PartialAttrSet {
+			binary.Write(w, le, attr)
+		}
+	}
+	if len(self.PrefixTableDest) > 0 {
+		binary.Write(w, le, uint32(len(self.PrefixTableDest))) // MaxCount
+		for _, entry := range self.PrefixTableDest {
+			binary.Write(w, le, entry.Ndx)
+			binary.Write(w, le, uint32(len(entry.Prefix)))
+			binary.Write(w, le, refId)
+			refId++
+		}
+		for _, entry := range self.PrefixTableDest {
+			binary.Write(w, le, uint32(len(entry.Prefix))) // MaxCount
+			w.Write(entry.Prefix)
+			alignWriter(w, 4)
+		}
+	}
+
+	return w.Bytes(), nil
+}
+
+func (self *DrsGetNCChangesReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of DrsGetNCChangesReq")
+}
+
+func (self *DrsGetNCChangesRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of DrsGetNCChangesRes")
+}
+
+func readUsnVector(r *bytes.Reader, v *UsnVector) (err error) {
+	err = binary.Read(r, le, &v.UsnHighObjUpdate)
+	if err != nil {
+		return
+	}
+	err = binary.Read(r, le, &v.UsnReserved)
+	if err != nil {
+		return
+	}
+	return binary.Read(r, le, &v.UsnHighPropUpdate)
+}
+
+func (self *DrsGetNCChangesRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for DrsGetNCChangesRes")
+	if len(buf) < 152 {
+		return fmt.Errorf("Buffer to small for DrsGetNCChangesRes")
+	}
+	self.ReturnCode = le.Uint32(buf[len(buf)-4:])
+	r := bytes.NewReader(buf[:len(buf)-4])
+	self.OutVersion, err = readUint32(r)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if self.OutVersion != 6 {
+		return fmt.Errorf("Unsupported GETCHGREPLY version %d", self.OutVersion)
+	}
+	// Skip union switch and align to 8 bytes
+	_, err = r.Seek(4, io.SeekCurrent)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	alignReader(r, 8)
+	self.DsaObjSrc, _ = readBytes(r, 16)
+	self.InvocIdSrc, _ = readBytes(r, 16)
+	ncPtr, _ := readUint32(r)
+	alignReader(r, 8)
+	readUsnVector(r, &self.UsnVecFrom)
+	readUsnVector(r, &self.UsnVecTo)
+	upToDatePtr, _ := readUint32(r)
+	prefixCount, _ := readUint32(r)
+	prefixPtr, _ := readUint32(r)
+	self.ExtendedRet, _ = readUint32(r)
+	self.NumObjects, _ = readUint32(r)
+	self.NumBytes, _ = readUint32(r)
+	objectsPtr, _ := readUint32(r)
+	moreData, _ := readUint32(r)
+	self.MoreData = moreData != 0
+	self.NumNcSizeObjects, _ = readUint32(r)
+	self.NumNcSizeValues, _ = readUint32(r)
+	self.NumValues, _ = readUint32(r)
+	// Skip rgValues ptr
+	readUint32(r)
+	self.DRSError, err = readUint32(r)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	// Deferred pointers
+	if ncPtr != 0 {
+		self.NC, err = readDsName(r)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	if upToDatePtr != 0 {
+		err = skipUpToDateVectorV2(r)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	if prefixPtr != 0 {
+		self.PrefixTableSrc, err = readPrefixTable(r, prefixCount)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	if objectsPtr != 0 {
+		self.Objects, err = readReplEntInfList(r)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+
+	return
+}
+
+func skipUpToDateVectorV2(r *bytes.Reader) (err error) {
+	err = alignReader(r, 4)
+	if err != nil {
+		return
+	}
+	// Skip MaxCount
+	_, err = r.Seek(4, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+	err = alignReader(r, 8)
+	if err != nil {
+		return
+	}
+	// Skip dwVersion and dwReserved1
+	_, err = r.Seek(8, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+	numCursors, err := readUint32(r)
+	if err != nil {
+		return
+	}
+	// Skip dwReserved2 and the UPTODATE_CURSOR_V2 entries of 32 bytes each
+	_, err = readBytes(r, 4+int(numCursors)*32)
+	return
+}
+
+func readPrefixTable(r *bytes.Reader, count uint32) (entries []PrefixTableEntry, err error) {
+	maxCount, err := readUint32(r)
+	if err != nil {
+		return
+	}
+	if maxCount < count || int(count)*12 > r.Len() {
+		return nil, fmt.Errorf("Invalid number of prefix table entries")
+	}
+	ptrs := make([]uint32, count)
+	entries = make([]PrefixTableEntry, count)
+	lengths := make([]uint32, count)
+	for i := range entries {
+		entries[i].Ndx, _ = readUint32(r)
+		lengths[i], _ = readUint32(r)
+		ptrs[i], err = readUint32(r)
+		if err != nil {
+			return
+		}
+	}
+	for i := range entries {
+		if ptrs[i] == 0 {
+			continue
+		}
+		var n uint32
+		n, err = readUint32(r)
+		if err != nil {
+			return
+		}
+		if n != lengths[i] {
+			return nil, fmt.Errorf("Prefix table entry length mismatch")
+		}
+		entries[i].Prefix, err = readBytes(r, int(n))
+		if err != nil {
+			return
+		}
+		err = alignReader(r, 4)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// readReplEntInfList reads the linked list of replicated objects. Since the
+// pointer to the next entry is the first member of the structure, the rest of
+// the list is encoded before the deferred members of the current entry.
+func readReplEntInfList(r *bytes.Reader) (list []ReplEntInfList, err error) {
+	err = alignReader(r, 4)
+	if err != nil {
+		return
+	}
+	nextPtr, _ := readUint32(r)
+	namePtr, _ := readUint32(r)
+	var entry ReplEntInfList
+	entry.EntInf.Flags, _ = readUint32(r)
+	attrCount, _ := readUint32(r)
+	attrPtr, _ := readUint32(r)
+	isNCPrefix, _ := readUint32(r)
+	entry.IsNCPrefix = isNCPrefix != 0
+	parentGuidPtr, _ := readUint32(r)
+	metaDataPtr, err := readUint32(r)
+	if err != nil {
+		return
+	}
+
+	var rest []ReplEntInfList
+	if nextPtr != 0 {
+		rest, err = readReplEntInfList(r)
+		if err != nil {
+			return
+		}
+	}
+	if namePtr != 0 {
+		entry.EntInf.Name, err = readDsName(r)
+		if err != nil {
+			return
+		}
+	}
+	if attrPtr != 0 {
+		entry.EntInf.Attrs, err = readAttrs(r, attrCount)
+		if err != nil {
+			return
+		}
+	}
+	if parentGuidPtr != 0 {
+		entry.ParentGuid, err = readBytes(r, 16)
+		if err != nil {
+			return
+		}
+	}
+	if metaDataPtr != 0 {
+		entry.MetaData, err = readPropertyMetaDataExtVector(r)
+		if err != nil {
+			return
+		}
+	}
+
+	list = append([]ReplEntInfList{entry}, rest...)
+	return
+}
+
+func readAttrs(r *bytes.Reader, count uint32) (attrs []Attr, err error) {
+	maxCount, err := readUint32(r)
+	if err != nil {
+		return
+	}
+	if maxCount < count || int(count)*12 > r.Len() {
+		return nil, fmt.Errorf("Invalid number of attributes in ATTRBLOCK")
+	}
+	attrs = make([]Attr, count)
+	valCounts := make([]uint32, count)
+	valPtrs := make([]uint32, count)
+	for i := range attrs {
+		attrs[i].AttrTyp, _ = readUint32(r)
+		valCounts[i], _ = readUint32(r)
+		valPtrs[i], err = readUint32(r)
+		if err != nil {
+			return
+		}
+	}
+	for i := range attrs {
+		if valPtrs[i] == 0 {
+			continue
+		}
+		maxCount, err = readUint32(r)
+		if err != nil {
+			return
+		}
+		if maxCount < valCounts[i] || int(valCounts[i])*8 > r.Len() {
+			return nil, fmt.Errorf("Invalid number of values in ATTRVALBLOCK")
+		}
+		lengths := make([]uint32, valCounts[i])
+		ptrs := make([]uint32, valCounts[i])
+		for j := range lengths {
+			lengths[j], _ = readUint32(r)
+			ptrs[j], err = readUint32(r)
+			if err != nil {
+				return
+			}
+		}
+		attrs[i].Values = make([][]byte, valCounts[i])
+		for j := range lengths {
+			if ptrs[j] == 0 {
+				continue
+			}
+			var n uint32
+			n, err = readUint32(r)
+			if err != nil {
+				return
+			}
+			if n != lengths[j] {
+				return nil, fmt.Errorf("ATTRVAL length mismatch")
+			}
+			attrs[i].Values[j], err = readBytes(r, int(n))
+			if err != nil {
+				return
+			}
+			err = alignReader(r, 4)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func readPropertyMetaDataExtVector(r *bytes.Reader) (items []PropertyMetaDataExt, err error) {
+	err = alignReader(r, 4)
+	if err != nil {
+		return
+	}
+	maxCount, err := readUint32(r)
+	if err != nil {
+		return
+	}
+	err = alignReader(r, 8)
+	if err != nil {
+		return
+	}
+	count, err := readUint32(r)
+	if err != nil {
+		return
+	}
+	if maxCount < count || int(count)*40 > r.Len() {
+		return nil, fmt.Errorf("Invalid number of entries in PROPERTY_META_DATA_EXT_VECTOR")
+	}
+	items = make([]PropertyMetaDataExt, count)
+	for i := range items {
+		err = alignReader(r, 8)
+		if err != nil {
+			return
+		}
+		items[i].Version, _ = readUint32(r)
+		alignReader(r, 8)
+		binary.Read(r, le, &items[i].TimeChanged)
+		items[i].DsaOriginating, _ = readBytes(r, 16)
+		err = binary.Read(r, le, &items[i].UsnOriginating)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,456 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package msdrsr
+
+import (
+	"crypto/des"
+	"crypto/md5"
+	"crypto/rc4"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+// OIDs of the replicated account attributes
+const (
+	OidUserPrincipalName       = "1.2.840.113556.1.4.656"
+	OidSAMAccountName          = "1.2.840.113556.1.4.221"
+	OidUnicodePwd              = "1.2.840.113556.1.4.90"
+	OidDBCSPwd                 = "1.2.840.113556.1.4.55"
+	OidNtPwdHistory            = "1.2.840.113556.1.4.94"
+	OidLmPwdHistory            = "1.2.840.113556.1.4.160"
+	OidSupplementalCredentials = "1.2.840.113556.1.4.125"
+	OidObjectSid               = "1.2.840.113556.1.4.146"
+	OidUserAccountControl      = "1.2.840.113556.1.4.8"
+	OidPwdLastSet              = "1.2.840.113556.1.4.96"
+)
+
+// ATTRTYP values of the account attributes using prefix index 9 which maps
+// to the OID prefix 1.2.840.113556.1.4 in DCSyncPrefixTable.
+const (
+	AttrTypUserPrincipalName       uint32 = 0x00090290
+	AttrTypSAMAccountName          uint32 = 0x000900dd
+	AttrTypUnicodePwd              uint32 = 0x0009005a
+	AttrTypDBCSPwd                 uint32 = 0x00090037
+	AttrTypNtPwdHistory            uint32 = 0x0009005e
+	AttrTypLmPwdHistory            uint32 = 0x000900a0
+	AttrTypSupplementalCredentials uint32 = 0x0009007d
+	AttrTypObjectSid               uint32 = 0x00090092
+	AttrTypUserAccountControl      uint32 = 0x00090008
+	AttrTypPwdLastSet              uint32 = 0x00090060
+)
+
+// Prefix table sent with replication requests so that the server can
+// interpret the ATTRTYP values of the partial attribute set.
+var DCSyncPrefixTable = []PrefixTableEntry{
+	{Ndx: 9, Prefix: []byte{0x2a, 0x86, 0x48, 0x86, 0xf7, 0x14, 0x01, 0x04}},
+}
+
+// Attributes requested when replicating a single account
+var DCSyncAttributes = []uint32{
+	AttrTypUserPrincipalName,
+	AttrTypSAMAccountName,
+	AttrTypUnicodePwd,
+	AttrTypDBCSPwd,
+	AttrTypNtPwdHistory,
+	AttrTypLmPwdHistory,
+	AttrTypSupplementalCredentials,
+	AttrTypObjectSid,
+	AttrTypUserAccountControl,
+	AttrTypPwdLastSet,
+}
+
+// Kerberos key types found in the supplementalCredentials attribute
+const (
+	KerbKeyTypeDesCbcCrc        int32 = 1
+	KerbKeyTypeDesCbcMd5        int32 = 3
+	KerbKeyTypeAes128CtsHmacSha int32 = 17
+	KerbKeyTypeAes256CtsHmacSha int32 = 18
+	KerbKeyTypeRc4Hmac          int32 = 23
+)
+
+var KerbKeyTypeMap = map[int32]string{
+	KerbKeyTypeDesCbcCrc:        "des-cbc-crc",
+	KerbKeyTypeDesCbcMd5:        "des-cbc-md5",
+	KerbKeyTypeAes128CtsHmacSha: "aes128-cts-hmac-sha1-96",
+	KerbKeyTypeAes256CtsHmacSha: "aes256-cts-hmac-sha1-96",
+	KerbKeyTypeRc4Hmac:          "rc4-hmac",
+}
+
+type KerberosKey struct {
+	KeyType        int32
+	IterationCount uint32
+	Key            []byte
+}
+
+// ReplicatedAccount holds the decrypted secrets of an account replicated
+// with DCSync.
+type ReplicatedAccount struct {
+	SAMAccountName     string
+	UserPrincipalName  string
+	Sid                *msdtyp.SID
+	Rid                uint32
+	UserAccountControl uint32
+	PwdLastSet         msdtyp.Filetime
+	NTHash             []byte
+	LMHash             []byte
+	NTHashHistory      [][]byte
+	LMHashHistory      [][]byte
+	// Raw values of the USER_PROPERTY entries in supplementalCredentials
+	// keyed by property name, e.g., "Primary:Kerberos-Newer-Keys"
+	SupplementalCredentials map[string][]byte
+	KerberosKeys            []KerberosKey
+	ClearTextPassword       string
+}
+
+// MS-DRSR Section 5.16.4 OidFromAttid
+func oidFromAttid(prefixTable []PrefixTableEntry, attr uint32) (oid string, err error) {
+	upperWord := attr >> 16
+	lowerWord := attr & 0xffff
+	var prefix []byte
+	found := false
+	for _, entry := range prefixTable {
+		if entry.Ndx == upperWord {
+			prefix = entry.Prefix
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("No prefix table entry found for ATTRTYP 0x%x", attr)
+	}
+	binaryOid := make([]byte, len(prefix), len(prefix)+2)
+	copy(binaryOid, prefix)
+	if lowerWord < 128 {
+		binaryOid = append(binaryOid, byte(lowerWord))
+	} else {
+		if lowerWord >= 32768 {
+			lowerWord -= 32768
+		}
+		binaryOid = append(binaryOid, byte(((lowerWord/128)%128)+128), byte(lowerWord%128))
+	}
+	return decodeBerOid(binaryOid)
+}
+
+// decodeBerOid converts the BER encoded value of an OBJECT IDENTIFIER to its
+// dotted string representation.
+func decodeBerOid(buf []byte) (oid string, err error) {
+	if len(buf) == 0 {
+		return "", fmt.Errorf("Empty OID")
+	}
+	var sb strings.Builder
+	sb.WriteString(strconv.Itoa(int(buf[0] / 40)))
+	sb.WriteByte('.')
+	sb.WriteString(strconv.Itoa(int(buf[0] % 40)))
+	var value uint64
+	for i := 1; i < len(buf); i++ {
+		value = (value << 7) | uint64(buf[i]&0x7f)
+		if buf[i]&0x80 == 0 {
+			sb.WriteByte('.')
+			sb.WriteString(strconv.FormatUint(value, 10))
+			value = 0
+		} else if i == len(buf)-1 {
+			return "", fmt.Errorf("Truncated OID")
+		}
+	}
+	return sb.String(), nil
+}
+
+// MS-DRSR Section 4.1.10.6.22 Secret attribute decryption.
+// The value consists of a 16 byte salt followed by an RC4 encrypted CRC32
+// checksum and the attribute data. The RC4 key is derived from the session
+// key of the RPC connection and the salt.
+func decryptAttributeValue(sessionKey, value []byte) (res []byte, err error) {
+	if len(sessionKey) == 0 {
+		return nil, fmt.Errorf("No session key available to decrypt secret attribute")
+	}
+	if len(value) < 20 {
+		return nil, fmt.Errorf("Encrypted attribute value is too short")
+	}
+	h := md5.New()
+	h.Write(sessionKey)
+	h.Write(value[:16])
+	cipher, err := rc4.NewCipher(h.Sum(nil))
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	plaintext := make([]byte, len(value)-16)
+	cipher.XORKeyStream(plaintext, value[16:])
+	checksum := le.Uint32(plaintext[:4])
+	res = plaintext[4:]
+	if crc32.ChecksumIEEE(res) != checksum {
+		return nil, fmt.Errorf("Checksum mismatch when decrypting secret attribute")
+	}
+	return
+}
+
+// MS-SAMR Section 2.2.11.1.2
+func plusOddParity(input []byte) []byte {
+	output := make([]byte, 8)
+	output[0] = input[0] >> 0x01
+	output[1] = ((input[0] & 0x01) << 6) | (input[1] >> 2)
+	output[2] = ((input[1] & 0x03) << 5) | (input[2] >> 3)
+	output[3] = ((input[2] & 0x07) << 4) | (input[3] >> 4)
+	output[4] = ((input[3] & 0x0f) << 3) | (input[4] >> 5)
+	output[5] = ((input[4] & 0x1f) << 2) | (input[5] >> 6)
+	output[6] = ((input[5] & 0x3f) << 1) | (input[6] >> 7)
+	output[7] = input[6] & 0x7f
+	for i := 0; i < 8; i++ {
+		if (bits.OnesCount(uint(output[i])) % 2) == 0 {
+			output[i] = (output[i] << 1) | 0x1
+		} else {
+			output[i] = (output[i] << 1) & 0xfe
+		}
+	}
+	return output
+}
+
+// removeRidEncryption removes the DES layer keyed with the RID of the account
+// from one or more concatenated 16 byte hashes.
+func removeRidEncryption(data []byte, rid uint32) (hashes [][]byte, err error) {
+	if len(data)%16 != 0 {
+		return nil, fmt.Errorf("Encrypted hash data must be a multiple of 16 bytes")
+	}
+	ridBytes := make([]byte, 4)
+	le.PutUint32(ridBytes, rid)
+	desSrc1 := make([]byte, 7)
+	desSrc2 := make([]byte, 7)
+	shift1 := []int{0, 1, 2, 3, 0, 1, 2}
+	shift2 := []int{3, 0, 1, 2, 3, 0, 1}
+	for i := 0; i < 7; i++ {
+		desSrc1[i] = ridBytes[shift1[i]]
+		desSrc2[i] = ridBytes[shift2[i]]
+	}
+	dc1, err := des.NewCipher(plusOddParity(desSrc1))
+	if err != nil {
+		log.Errorf("Failed to initialize first DES cipher with error: %v\n", err)
+		return
+	}
+	dc2, err := des.NewCipher(plusOddParity(desSrc2))
+	if err != nil {
+		log.Errorf("Failed to initialize second DES cipher with error: %v\n", err)
+		return
+	}
+	for i := 0; i < len(data); i += 16 {
+		hash := make([]byte, 16)
+		dc1.Decrypt(hash[:8], data[i:i+8])
+		dc2.Decrypt(hash[8:], data[i+8:i+16])
+		hashes = append(hashes, hash)
+	}
+	return
+}
+
+// MS-SAMR Section 2.2.10.1 USER_PROPERTIES
+func parseUserProperties(buf []byte) (props map[string][]byte, err error) {
+	props = make(map[string][]byte)
+	// Reserved1, Length, Reserved2, Reserved3 and Reserved4 precede the
+	// property signature
+	if len(buf) < 0x70 {
+		// Accounts without supplemental credentials only contain the header
+		return
+	}
+	if le.Uint16(buf[0x6c:0x6e]) != 0x50 {
+		return nil, fmt.Errorf("Invalid USER_PROPERTIES signature")
+	}
+	count := int(le.Uint16(buf[0x6e:0x70]))
+	offset := 0x70
+	for i := 0; i < count; i++ {
+		if offset+6 > len(buf) {
+			return nil, fmt.Errorf("USER_PROPERTY is truncated")
+		}
+		nameLen := int(le.Uint16(buf[offset:]))
+		valueLen := int(le.Uint16(buf[offset+2:]))
+		offset += 6
+		if offset+nameLen+valueLen > len(buf) {
+			return nil, fmt.Errorf("USER_PROPERTY is truncated")
+		}
+		var name string
+		name, err = msdtyp.FromUnicodeString(buf[offset : offset+nameLen])
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		offset += nameLen
+		var value []byte
+		value, err = hex.DecodeString(string(buf[offset : offset+valueLen]))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode value of USER_PROPERTY %s: %v", name, err)
+		}
+		offset += valueLen
+		props[name] = value
+	}
+	return
+}
+
+// MS-SAMR Section 2.2.10.6 KERB_STORED_CREDENTIAL_NEW
+func parseKerberosNewerKeys(buf []byte) (keys []KerberosKey, err error) {
+	if len(buf) < 24 {
+		return nil, fmt.Errorf("KERB_STORED_CREDENTIAL_NEW is truncated")
+	}
+	if le.Uint16(buf[:2]) != 4 {
+		return nil, fmt.Errorf("Unsupported KERB_STORED_CREDENTIAL_NEW revision %d", le.Uint16(buf[:2]))
+	}
+	count := int(le.Uint16(buf[4:6]))
+	offset := 24
+	for i := 0; i < count; i++ {
+		if offset+24 > len(buf) {
+			return nil, fmt.Errorf("KERB_KEY_DATA_NEW is truncated")
+		}
+		key := KerberosKey{
+			IterationCount: le.Uint32(buf[offset+8:]),
+			KeyType:        int32(le.Uint32(buf[offset+12:])),
+		}
+		keyLen := int(le.Uint32(buf[offset+16:]))
+		keyOffset := int(le.Uint32(buf[offset+20:]))
+		if keyOffset+keyLen > len(buf) {
+			return nil, fmt.Errorf("Kerberos key is out of bounds")
+		}
+		key.Key = make([]byte, keyLen)
+		copy(key.Key, buf[keyOffset:keyOffset+keyLen])
+		keys = append(keys, key)
+		offset += 24
+	}
+	return
+}
+
+func newReplicatedAccount(entInf *EntInf, prefixTable []PrefixTableEntry, sessionKey []byte) (account *ReplicatedAccount, err error) {
+	attrs := make(map[string][]byte)
+	for _, attr := range entInf.Attrs {
+		if len(attr.Values) == 0 {
+			continue
+		}
+		var oid string
+		oid, err = oidFromAttid(prefixTable, attr.AttrTyp)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		attrs[oid] = attr.Values[0]
+	}
+
+	account = &ReplicatedAccount{}
+	if val, ok := attrs[OidObjectSid]; ok {
+		account.Sid = &msdtyp.SID{}
+		err = account.Sid.UnmarshalBinary(val)
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+		if len(account.Sid.SubAuthorities) == 0 {
+			return nil, fmt.Errorf("Replicated objectSid has no sub authorities")
+		}
+		account.Rid = account.Sid.SubAuthorities[len(account.Sid.SubAuthorities)-1]
+	}
+	if val, ok := attrs[OidSAMAccountName]; ok {
+		account.SAMAccountName, err = msdtyp.FromUnicodeString(val)
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+	}
+	if val, ok := attrs[OidUserPrincipalName]; ok {
+		account.UserPrincipalName, err = msdtyp.FromUnicodeString(val)
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+	}
+	if val, ok := attrs[OidUserAccountControl]; ok && len(val) >= 4 {
+		account.UserAccountControl = le.Uint32(val)
+	}
+	if val, ok := attrs[OidPwdLastSet]; ok && len(val) >= 8 {
+		account.PwdLastSet.LowDateTime = le.Uint32(val)
+		account.PwdLastSet.HighDateTime = le.Uint32(val[4:])
+	}
+
+	decryptHashes := func(oid string) (hashes [][]byte, err error) {
+		val, ok := attrs[oid]
+		if !ok {
+			return
+		}
+		plaintext, err := decryptAttributeValue(sessionKey, val)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		return removeRidEncryption(plaintext, account.Rid)
+	}
+	hashes, err := decryptHashes(OidUnicodePwd)
+	if err != nil {
+		return nil, err
+	}
+	if len(hashes) > 0 {
+		account.NTHash = hashes[0]
+	}
+	hashes, err = decryptHashes(OidDBCSPwd)
+	if err != nil {
+		return nil, err
+	}
+	if len(hashes) > 0 {
+		account.LMHash = hashes[0]
+	}
+	account.NTHashHistory, err = decryptHashes(OidNtPwdHistory)
+	if err != nil {
+		return nil, err
+	}
+	account.LMHashHistory, err = decryptHashes(OidLmPwdHistory)
+	if err != nil {
+		return nil, err
+	}
+
+	if val, ok := attrs[OidSupplementalCredentials]; ok {
+		var plaintext []byte
+		plaintext, err = decryptAttributeValue(sessionKey, val)
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+		account.SupplementalCredentials, err = parseUserProperties(plaintext)
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+		if keys, ok := account.SupplementalCredentials["Primary:Kerberos-Newer-Keys"]; ok {
+			account.KerberosKeys, err = parseKerberosNewerKeys(keys)
+			if err != nil {
+				log.Errorln(err)
+				return nil, err
+			}
+		}
+		if cleartext, ok := account.SupplementalCredentials["Primary:CLEARTEXT"]; ok {
+			account.ClearTextPassword, err = msdtyp.FromUnicodeString(cleartext)
+			if err != nil {
+				log.Errorln(err)
+				return nil, err
+			}
+		}
+	}
+
+	return
+}
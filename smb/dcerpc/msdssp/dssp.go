@@ -0,0 +1,183 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package msdssp implements DsRolerGetPrimaryDomainInformation of the
+// Directory Services Setup Remote Protocol (MS-DSSP) which is reachable over
+// the lsarpc named pipe. It reveals the domain membership, the flat, DNS and
+// forest names of the domain and the role of the target (e.g., domain
+// controller) without requiring LDAP connectivity.
+package msdssp
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/jfjallid/golog"
+)
+
+var (
+	log                  = golog.Get("github.com/ericblavier/go-smb/smb/dcerpc/msdssp")
+	le  binary.ByteOrder = binary.LittleEndian
+)
+
+const (
+	MSRPCUuidDssetup                = "3919286A-B10C-11D0-9BA8-00C04FD92EF5"
+	MSRPCDssetupPipe                = "lsarpc"
+	MSRPCDssetupMajorVersion uint16 = 0
+	MSRPCDssetupMinorVersion uint16 = 0
+)
+
+// MSRPC Directory Services Setup Remote Protocol (dssetup) Operations
+const (
+	DsRolerGetPrimaryDomainInformation uint16 = 0
+)
+
+// MS-DSSP Section 2.2.3 DSROLE_PRIMARY_DOMAIN_INFO_LEVEL
+const (
+	DsRolePrimaryDomainInfoBasic uint16 = 1
+	DsRoleUpgradeStatus          uint16 = 2
+	DsRoleOperationState         uint16 = 3
+)
+
+// MS-DSSP Section 2.2.1 DSROLE_MACHINE_ROLE
+const (
+	DsRoleStandaloneWorkstation   uint16 = 0
+	DsRoleMemberWorkstation       uint16 = 1
+	DsRoleStandaloneServer        uint16 = 2
+	DsRoleMemberServer            uint16 = 3
+	DsRoleBackupDomainController  uint16 = 4
+	DsRolePrimaryDomainController uint16 = 5
+)
+
+var MachineRoleMap = map[uint16]string{
+	DsRoleStandaloneWorkstation:   "Standalone workstation",
+	DsRoleMemberWorkstation:       "Member workstation",
+	DsRoleStandaloneServer:        "Standalone server",
+	DsRoleMemberServer:            "Member server",
+	DsRoleBackupDomainController:  "Backup domain controller",
+	DsRolePrimaryDomainController: "Primary domain controller",
+}
+
+// MS-DSSP Section 2.2.5 DSROLER_PRIMARY_DOMAIN_INFO_BASIC Flags
+const (
+	DsRolePrimaryDsRunning         uint32 = 0x00000001
+	DsRolePrimaryDsMixedMode       uint32 = 0x00000002
+	DsRoleUpgradeInProgress        uint32 = 0x00000004
+	DsRolePrimaryDsReadonly        uint32 = 0x00000008
+	DsRolePrimaryDomainGuidPresent uint32 = 0x01000000
+)
+
+// MS-DSSP Section 2.2.2 DSROLE_OPERATION_STATE
+const (
+	DsRoleOperationIdle       uint16 = 0
+	DsRoleOperationActive     uint16 = 1
+	DsRoleOperationNeedReboot uint16 = 2
+)
+
+// MS-DSSP Section 2.2.4 DSROLE_SERVER_STATE
+const (
+	DsRoleServerUnknown uint16 = 0
+	DsRoleServerPrimary uint16 = 1
+	DsRoleServerBackup  uint16 = 2
+)
+
+const (
+	ErrorSuccess          uint32 = 0x0  // The operation completed successfully
+	ErrorAccessDenied     uint32 = 0x5  // Access is denied
+	ErrorNotEnoughMemory  uint32 = 0x8  // Not enough storage is available to process this command.
+	ErrorInvalidParameter uint32 = 0x57 // One of the function parameters is not valid.
+)
+
+var ResponseCodeMap = map[uint32]error{
+	ErrorSuccess:          fmt.Errorf("The operation completed successfully"),
+	ErrorAccessDenied:     fmt.Errorf("Access is denied"),
+	ErrorNotEnoughMemory:  fmt.Errorf("Not enough storage is available to process this command."),
+	ErrorInvalidParameter: fmt.Errorf("One of the function parameters is not valid."),
+}
+
+func NewRPCCon(sb *dcerpc.ServiceBind) *RPCCon {
+	return &RPCCon{sb}
+}
+
+// GetPrimaryDomainInformation retrieves the information of the requested
+// level. The result is a *DsRolerPrimaryDomainInfoBasic,
+// *DsRoleUpgradeStatusInfo or *DsRoleOperationStateInfo depending on level.
+func (sb *RPCCon) GetPrimaryDomainInformation(level uint16) (info DsRolerPrimaryDomainInformation, err error) {
+	log.Debugln("In GetPrimaryDomainInformation")
+	if level < DsRolePrimaryDomainInfoBasic || level > DsRoleOperationState {
+		return nil, fmt.Errorf("Only levels 1 to 3 are valid")
+	}
+	innerReq := DsRolerGetPrimaryDomainInformationReq{InfoLevel: level}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(DsRolerGetPrimaryDomainInformation, innerBuf)
+	if err != nil {
+		return
+	}
+
+	if len(buffer) < 8 {
+		return nil, fmt.Errorf("Server response to DsRolerGetPrimaryDomainInformation was too small. Expected at atleast 8 bytes")
+	}
+
+	var resp DsRolerGetPrimaryDomainInformationRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	if resp.ReturnCode != ErrorSuccess {
+		status, found := ResponseCodeMap[resp.ReturnCode]
+		if !found {
+			err = fmt.Errorf("Received unknown DSSP return code for DsRolerGetPrimaryDomainInformation response: 0x%x", resp.ReturnCode)
+			log.Errorln(err)
+			return
+		}
+		err = status
+		log.Errorln(err)
+		return
+	}
+	if resp.DomainInfo == nil {
+		return nil, fmt.Errorf("Server did not return any domain information")
+	}
+
+	return resp.DomainInfo, nil
+}
+
+// GetPrimaryDomainInfoBasic returns the machine role, domain names and domain
+// GUID of the target
+func (sb *RPCCon) GetPrimaryDomainInfoBasic() (info *DsRolerPrimaryDomainInfoBasic, err error) {
+	res, err := sb.GetPrimaryDomainInformation(DsRolePrimaryDomainInfoBasic)
+	if err != nil {
+		return
+	}
+	info, ok := res.(*DsRolerPrimaryDomainInfoBasic)
+	if !ok {
+		return nil, fmt.Errorf("Unexpected information level in DsRolerGetPrimaryDomainInformation response")
+	}
+	return
+}
@@ -0,0 +1,89 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package msdssp
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"testing"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+func TestDsRolerGetPrimaryDomainInformationReq(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	req := DsRolerGetPrimaryDomainInformationReq{InfoLevel: DsRolePrimaryDomainInfoBasic}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, []byte{1, 0}) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestDsRolerGetPrimaryDomainInformationRes(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("0000020001000000050000000300000104000200080002000c0002007856341234127856010203040506070805000000000000000500000043004f0052005000000000000b000000000000000b00000063006f00720070002e006c006f00630061006c00000000000b000000000000000b00000063006f00720070002e006c006f00630061006c000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp DsRolerGetPrimaryDomainInformationRes
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		t.Fatal("Fail")
+	}
+	info, ok := resp.DomainInfo.(*DsRolerPrimaryDomainInfoBasic)
+	if !ok {
+		t.Fatal("Fail")
+	}
+	if info.MachineRole != DsRolePrimaryDomainController || !info.IsDomainController() || !info.IsDomainMember() {
+		t.Fatal("Fail")
+	}
+	if info.Flags&DsRolePrimaryDsRunning == 0 {
+		t.Fatal("Fail")
+	}
+	if info.DomainNameFlat != "CORP" || info.DomainNameDns != "corp.local" || info.DomainForestName != "corp.local" {
+		t.Fatal("Fail")
+	}
+	if msdtyp.GuidToString(info.DomainGuid) != "12345678-1234-5678-0102-030405060708" {
+		t.Fatal("Fail")
+	}
+
+	pkt, err = hex.DecodeString("0000000005000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = DsRolerGetPrimaryDomainInformationRes{}
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.DomainInfo != nil || resp.ReturnCode != ErrorAccessDenied {
+		t.Fatal("Fail")
+	}
+}
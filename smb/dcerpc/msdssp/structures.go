@@ -0,0 +1,240 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// The marshal/unmarshal of requests and responses according to the NDR syntax
+// has been implemented on a per RPC request basis and not in any complete way.
+// As such, for each new functionality, a manual marshal and unmarshal method
+// has to be written for the relevant messages. This makes it a bit easier to
+// define the message structs but more of the heavy lifting has to be performed
+// by the marshal/unmarshal functions.
+
+package msdssp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+)
+
+type RPCCon struct {
+	*dcerpc.ServiceBind
+}
+
+/*
+DWORD DsRolerGetPrimaryDomainInformation(
+[in] handle_t hBinding,
+[in] DSROLE_PRIMARY_DOMAIN_INFO_LEVEL InfoLevel,
+[out, switch_is(InfoLevel)] PDSROLER_PRIMARY_DOMAIN_INFORMATION* DomainInfo
+);
+*/
+type DsRolerGetPrimaryDomainInformationReq struct {
+	InfoLevel uint16
+}
+
+type DsRolerGetPrimaryDomainInformationRes struct {
+	DomainInfo DsRolerPrimaryDomainInformation
+	ReturnCode uint32
+}
+
+// DsRolerPrimaryDomainInformation is the DSROLER_PRIMARY_DOMAIN_INFORMATION
+// union
+type DsRolerPrimaryDomainInformation interface {
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary([]byte) error
+}
+
+// MS-DSSP Section 2.2.5
+type DsRolerPrimaryDomainInfoBasic struct {
+	MachineRole      uint16
+	Flags            uint32
+	DomainNameFlat   string
+	DomainNameDns    string
+	DomainForestName string
+	DomainGuid       []byte // 16 bytes
+}
+
+// MS-DSSP Section 2.2.6
+type DsRoleUpgradeStatusInfo struct {
+	OperationState      uint32
+	PreviousServerState uint16
+}
+
+// MS-DSSP Section 2.2.7
+type DsRoleOperationStateInfo struct {
+	OperationState uint16
+}
+
+// IsDomainController reports whether the machine is a primary or backup
+// domain controller
+func (self *DsRolerPrimaryDomainInfoBasic) IsDomainController() bool {
+	return self.MachineRole == DsRolePrimaryDomainController || self.MachineRole == DsRoleBackupDomainController
+}
+
+// IsDomainMember reports whether the machine is joined to a domain
+func (self *DsRolerPrimaryDomainInfoBasic) IsDomainMember() bool {
+	return self.MachineRole != DsRoleStandaloneWorkstation && self.MachineRole != DsRoleStandaloneServer
+}
+
+func (self *DsRolerGetPrimaryDomainInformationReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for DsRolerGetPrimaryDomainInformationReq")
+	return binary.LittleEndian.AppendUint16(res, self.InfoLevel), nil
+}
+
+func (self *DsRolerGetPrimaryDomainInformationReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of DsRolerGetPrimaryDomainInformationReq")
+}
+
+func (self *DsRolerGetPrimaryDomainInformationRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of DsRolerGetPrimaryDomainInformationRes")
+}
+
+func (self *DsRolerGetPrimaryDomainInformationRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for DsRolerGetPrimaryDomainInformationRes")
+	if len(buf) < 8 {
+		return fmt.Errorf("Buffer to small for DsRolerGetPrimaryDomainInformationRes")
+	}
+	self.ReturnCode = le.Uint32(buf[len(buf)-4:])
+	r := bytes.NewReader(buf[:len(buf)-4])
+	var refId uint32
+	err = binary.Read(r, le, &refId)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if refId == 0 {
+		return
+	}
+	var level uint16
+	err = binary.Read(r, le, &level)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	// Align to the union arm
+	_, err = r.Seek(2, io.SeekCurrent)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	switch level {
+	case DsRolePrimaryDomainInfoBasic:
+		info := &DsRolerPrimaryDomainInfoBasic{}
+		err = info.readFrom(r)
+		self.DomainInfo = info
+	case DsRoleUpgradeStatus:
+		info := &DsRoleUpgradeStatusInfo{}
+		err = binary.Read(r, le, &info.OperationState)
+		if err == nil {
+			err = binary.Read(r, le, &info.PreviousServerState)
+		}
+		self.DomainInfo = info
+	case DsRoleOperationState:
+		info := &DsRoleOperationStateInfo{}
+		err = binary.Read(r, le, &info.OperationState)
+		self.DomainInfo = info
+	default:
+		err = fmt.Errorf("Unknown DSROLE_PRIMARY_DOMAIN_INFO_LEVEL %d", level)
+	}
+	if err != nil {
+		log.Errorln(err)
+	}
+	return
+}
+
+func (self *DsRolerPrimaryDomainInfoBasic) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of DsRolerPrimaryDomainInfoBasic")
+}
+
+func (self *DsRolerPrimaryDomainInfoBasic) UnmarshalBinary(buf []byte) error {
+	return self.readFrom(bytes.NewReader(buf))
+}
+
+func (self *DsRolerPrimaryDomainInfoBasic) readFrom(r *bytes.Reader) (err error) {
+	err = binary.Read(r, le, &self.MachineRole)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	_, err = r.Seek(2, io.SeekCurrent)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Read(r, le, &self.Flags)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	ptrs := make([]uint32, 3)
+	err = binary.Read(r, le, &ptrs)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	self.DomainGuid = make([]byte, 16)
+	_, err = io.ReadFull(r, self.DomainGuid)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	names := []*string{&self.DomainNameFlat, &self.DomainNameDns, &self.DomainForestName}
+	for i, ptr := range ptrs {
+		if ptr == 0 {
+			continue
+		}
+		*names[i], err = msdtyp.ReadConformantVaryingString(r, true)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	return
+}
+
+func (self *DsRoleUpgradeStatusInfo) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of DsRoleUpgradeStatusInfo")
+}
+
+func (self *DsRoleUpgradeStatusInfo) UnmarshalBinary(buf []byte) (err error) {
+	if len(buf) < 6 {
+		return fmt.Errorf("Buffer to small for DsRoleUpgradeStatusInfo")
+	}
+	self.OperationState = le.Uint32(buf)
+	self.PreviousServerState = le.Uint16(buf[4:])
+	return
+}
+
+func (self *DsRoleOperationStateInfo) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of DsRoleOperationStateInfo")
+}
+
+func (self *DsRoleOperationStateInfo) UnmarshalBinary(buf []byte) (err error) {
+	if len(buf) < 2 {
+		return fmt.Errorf("Buffer to small for DsRoleOperationStateInfo")
+	}
+	self.OperationState = le.Uint16(buf)
+	return
+}
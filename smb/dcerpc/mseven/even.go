@@ -0,0 +1,297 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package mseven implements a client for the legacy EventLog Remoting
+// Protocol (MS-EVEN) which is available on hosts and appliances that do not
+// expose the newer EVEN6 interface. Records are returned in the classic
+// EVENTLOGRECORD format.
+package mseven
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/jfjallid/golog"
+)
+
+var (
+	log                  = golog.Get("github.com/ericblavier/go-smb/smb/dcerpc/mseven")
+	le  binary.ByteOrder = binary.LittleEndian
+)
+
+const (
+	MSRPCUuidEventLog                = "82273FDC-E32A-18C3-3F78-827929DC23EA"
+	MSRPCEventLogPipe                = "eventlog"
+	MSRPCEventLogMajorVersion uint16 = 0
+	MSRPCEventLogMinorVersion uint16 = 0
+)
+
+// MSRPC EventLog Remoting Protocol (eventlog) Operations
+const (
+	ElfrCloseEL         uint16 = 2
+	ElfrNumberOfRecords uint16 = 4
+	ElfrOldestRecord    uint16 = 5
+	ElfrOpenELW         uint16 = 7
+	ElfrReadELW         uint16 = 10
+)
+
+// MS-EVEN Section 3.1.4.7 ReadFlags
+const (
+	EventLogSequentialRead uint32 = 0x1
+	EventLogSeekRead       uint32 = 0x2
+	EventLogForwardsRead   uint32 = 0x4
+	EventLogBackwardsRead  uint32 = 0x8
+)
+
+// MS-EVEN Section 2.2.3 EventType
+const (
+	EventLogSuccess      uint16 = 0x0000
+	EventLogErrorType    uint16 = 0x0001
+	EventLogWarningType  uint16 = 0x0002
+	EventLogInformation  uint16 = 0x0004
+	EventLogAuditSuccess uint16 = 0x0008
+	EventLogAuditFailure uint16 = 0x0010
+)
+
+// MaxBatchBuff is the largest buffer a server accepts in ElfrReadELW
+const MaxBatchBuff uint32 = 0x0007ffff
+
+// DefaultReadSize is the buffer size used by ReadEventLog
+const DefaultReadSize uint32 = 0x10000
+
+const (
+	StatusSuccess             uint32 = 0x00000000 // The operation completed successfully
+	StatusInvalidHandle       uint32 = 0xC0000008 // The handle is invalid
+	StatusInvalidParameter    uint32 = 0xC000000D // One of the function parameters is not valid.
+	StatusEndOfFile           uint32 = 0xC0000011 // The end of the event log has been reached
+	StatusAccessDenied        uint32 = 0xC0000022 // Access is denied
+	StatusBufferTooSmall      uint32 = 0xC0000023 // The buffer is too small to contain the next record
+	StatusObjectNameNotFound  uint32 = 0xC0000034 // The event log does not exist
+	StatusEventlogFileCorrupt uint32 = 0xC000018E // The event log file is corrupt
+	StatusEventlogFileChanged uint32 = 0xC0000197 // The event log was cleared since it was opened
+)
+
+var ResponseCodeMap = map[uint32]error{
+	StatusSuccess:             fmt.Errorf("The operation completed successfully"),
+	StatusInvalidHandle:       fmt.Errorf("The handle is invalid"),
+	StatusInvalidParameter:    fmt.Errorf("One of the function parameters is not valid."),
+	StatusEndOfFile:           fmt.Errorf("The end of the event log has been reached"),
+	StatusAccessDenied:        fmt.Errorf("Access is denied"),
+	StatusBufferTooSmall:      fmt.Errorf("The buffer is too small to contain the next record"),
+	StatusObjectNameNotFound:  fmt.Errorf("The event log does not exist"),
+	StatusEventlogFileCorrupt: fmt.Errorf("The event log file is corrupt"),
+	StatusEventlogFileChanged: fmt.Errorf("The event log was cleared since it was opened"),
+}
+
+func NewRPCCon(sb *dcerpc.ServiceBind) *RPCCon {
+	return &RPCCon{sb}
+}
+
+func returnCodeError(returnCode uint32, call string) (err error) {
+	status, found := ResponseCodeMap[returnCode]
+	if !found {
+		err = fmt.Errorf("Received unknown EVEN return code for %s response: 0x%x", call, returnCode)
+		log.Errorln(err)
+		return
+	}
+	return status
+}
+
+// OpenEventLog opens a handle to the event log with the specified name, e.g.,
+// Application, System or Security.
+func (sb *RPCCon) OpenEventLog(moduleName string) (handle []byte, err error) {
+	log.Debugln("In OpenEventLog")
+	innerReq := ElfrOpenELWReq{
+		ModuleName:   moduleName,
+		MajorVersion: 1,
+		MinorVersion: 1,
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(ElfrOpenELW, innerBuf)
+	if err != nil {
+		return
+	}
+
+	if len(buffer) < 24 {
+		return nil, fmt.Errorf("Server response to ElfrOpenELW was too small. Expected at atleast 24 bytes")
+	}
+
+	returnCode := le.Uint32(buffer[20:])
+	if returnCode != StatusSuccess {
+		err = returnCodeError(returnCode, "ElfrOpenELW")
+		log.Errorln(err)
+		return
+	}
+	return buffer[:20], nil
+}
+
+// CloseEventLog closes a handle returned by OpenEventLog
+func (sb *RPCCon) CloseEventLog(handle []byte) (err error) {
+	log.Debugln("In CloseEventLog")
+	innerReq := ElfrCloseELReq{LogHandle: handle}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(ElfrCloseEL, innerBuf)
+	if err != nil {
+		return
+	}
+
+	if len(buffer) < 24 {
+		return fmt.Errorf("Server response to ElfrCloseEL was too small. Expected at atleast 24 bytes")
+	}
+
+	returnCode := le.Uint32(buffer[20:])
+	if returnCode != StatusSuccess {
+		err = returnCodeError(returnCode, "ElfrCloseEL")
+		log.Errorln(err)
+	}
+	return
+}
+
+// ElfrNumberOfRecords and ElfrOldestRecord share the same request and
+// response layout
+func (sb *RPCCon) queryRecordNumber(handle []byte, opnum uint16, call string) (count uint32, err error) {
+	innerReq := ElfrNumberOfRecordsReq{LogHandle: handle}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(opnum, innerBuf)
+	if err != nil {
+		return
+	}
+
+	var resp ElfrNumberOfRecordsRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	if resp.ReturnCode != StatusSuccess {
+		err = returnCodeError(resp.ReturnCode, call)
+		log.Errorln(err)
+		return
+	}
+	return resp.NumberOfRecords, nil
+}
+
+// NumberOfRecords returns the number of records in the event log
+func (sb *RPCCon) NumberOfRecords(handle []byte) (count uint32, err error) {
+	log.Debugln("In NumberOfRecords")
+	return sb.queryRecordNumber(handle, ElfrNumberOfRecords, "ElfrNumberOfRecords")
+}
+
+// OldestRecord returns the record number of the oldest record in the event
+// log
+func (sb *RPCCon) OldestRecord(handle []byte) (recordNumber uint32, err error) {
+	log.Debugln("In OldestRecord")
+	return sb.queryRecordNumber(handle, ElfrOldestRecord, "ElfrOldestRecord")
+}
+
+// ReadEventLogRaw performs a single ElfrReadELW call and returns the raw
+// buffer of EVENTLOGRECORD structures. If the buffer is too small to hold the
+// next record, StatusBufferTooSmall is mapped to an error and minBytesNeeded
+// holds the required size.
+func (sb *RPCCon) ReadEventLogRaw(handle []byte, flags, recordOffset, bufSize uint32) (buf []byte, minBytesNeeded uint32, err error) {
+	log.Debugln("In ReadEventLogRaw")
+	if bufSize > MaxBatchBuff {
+		bufSize = MaxBatchBuff
+	}
+	innerReq := ElfrReadELWReq{
+		LogHandle:           handle,
+		ReadFlags:           flags,
+		RecordOffset:        recordOffset,
+		NumberOfBytesToRead: bufSize,
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(ElfrReadELW, innerBuf)
+	if err != nil {
+		return
+	}
+
+	var resp ElfrReadELWRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	if resp.ReturnCode != StatusSuccess {
+		err = returnCodeError(resp.ReturnCode, "ElfrReadELW")
+		if resp.ReturnCode != StatusEndOfFile && resp.ReturnCode != StatusBufferTooSmall {
+			log.Errorln(err)
+		}
+		return nil, resp.MinNumberOfBytesNeeded, err
+	}
+	return resp.Buffer, 0, nil
+}
+
+// ReadEventLog reads the next batch of records from the event log. Use
+// EventLogSequentialRead|EventLogForwardsRead to read from the oldest record
+// or EventLogSeekRead with a recordOffset to start at a specific record.
+// io.EOF is returned when there are no more records.
+func (sb *RPCCon) ReadEventLog(handle []byte, flags, recordOffset uint32) (records []EventLogRecord, err error) {
+	log.Debugln("In ReadEventLog")
+	buf, minBytesNeeded, err := sb.ReadEventLogRaw(handle, flags, recordOffset, DefaultReadSize)
+	if err == ResponseCodeMap[StatusBufferTooSmall] && minBytesNeeded > 0 {
+		buf, _, err = sb.ReadEventLogRaw(handle, flags, recordOffset, minBytesNeeded)
+	}
+	if err == ResponseCodeMap[StatusEndOfFile] {
+		return nil, io.EOF
+	} else if err != nil {
+		return
+	}
+	return ParseEventLogRecords(buf)
+}
+
+// ReadAllEvents reads every record of the event log starting with the oldest
+func (sb *RPCCon) ReadAllEvents(handle []byte) (records []EventLogRecord, err error) {
+	for {
+		var batch []EventLogRecord
+		batch, err = sb.ReadEventLog(handle, EventLogSequentialRead|EventLogForwardsRead, 0)
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return
+		}
+		records = append(records, batch...)
+	}
+}
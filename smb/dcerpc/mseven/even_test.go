@@ -0,0 +1,88 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mseven
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"testing"
+)
+
+func TestElfrOpenELWReq(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("0000000010001000010000000800000000000000080000005300650063007500720069007400790000000000000000000100000001000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := ElfrOpenELWReq{ModuleName: "Security", MajorVersion: 1, MinorVersion: 1}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pkt, buf) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestElfrReadELWRes(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("b4000000b40000004c664c652a00000000f1536501f15365581b0040040002000000000000000000800000000c0000007400000004000000ac0000005300650072007600690063006500200043006f006e00740072006f006c0020004d0061006e00610067006500720000004400430030003100000000000101000000000005120000005000720069006e0074002000530070006f006f006c00650072000000720075006e006e0069006e0067000000deadbeefb4000000b40000000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp ElfrReadELWRes
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ReturnCode != StatusSuccess || len(resp.Buffer) != 0xb4 {
+		t.Fatal("Fail")
+	}
+	records, err := ParseEventLogRecords(resp.Buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatal("Fail")
+	}
+	r := records[0]
+	if r.RecordNumber != 42 || r.Code() != 7000 || r.EventType != EventLogInformation {
+		t.Fatal("Fail")
+	}
+	if r.TimeGenerated.Unix() != 1700000000 || r.TimeWritten.Unix() != 1700000001 {
+		t.Fatal("Fail")
+	}
+	if r.SourceName != "Service Control Manager" || r.ComputerName != "DC01" {
+		t.Fatal("Fail")
+	}
+	if r.UserSid == nil || r.UserSid.ToString() != "S-1-5-18" {
+		t.Fatal("Fail")
+	}
+	if len(r.Strings) != 2 || r.Strings[0] != "Print Spooler" || r.Strings[1] != "running" {
+		t.Fatal("Fail")
+	}
+	if !bytes.Equal(r.Data, []byte{0xde, 0xad, 0xbe, 0xef}) {
+		t.Fatal("Fail")
+	}
+}
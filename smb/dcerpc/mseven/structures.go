@@ -0,0 +1,355 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// The marshal/unmarshal of requests and responses according to the NDR syntax
+// has been implemented on a per RPC request basis and not in any complete way.
+// As such, for each new functionality, a manual marshal and unmarshal method
+// has to be written for the relevant messages. This makes it a bit easier to
+// define the message structs but more of the heavy lifting has to be performed
+// by the marshal/unmarshal functions.
+
+package mseven
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+)
+
+type RPCCon struct {
+	*dcerpc.ServiceBind
+}
+
+// Signature of an EVENTLOGRECORD ("LfLe")
+const eventLogRecordSignature uint32 = 0x654c664c
+
+const eventLogRecordHeaderSize = 56
+
+// MS-EVEN Section 3.1.4.3 ElfrOpenELW
+type ElfrOpenELWReq struct {
+	UNCServerName string // Ignored by the server and always sent as a NULL ptr
+	ModuleName    string
+	RegModuleName string // MUST be empty
+	MajorVersion  uint32
+	MinorVersion  uint32
+}
+
+// MS-EVEN Section 3.1.4.21 ElfrCloseEL
+type ElfrCloseELReq struct {
+	LogHandle []byte
+}
+
+// MS-EVEN Section 3.1.4.10 ElfrNumberOfRecords and 3.1.4.11 ElfrOldestRecord
+type ElfrNumberOfRecordsReq struct {
+	LogHandle []byte
+}
+
+type ElfrNumberOfRecordsRes struct {
+	NumberOfRecords uint32
+	ReturnCode      uint32
+}
+
+// MS-EVEN Section 3.1.4.7 ElfrReadELW
+type ElfrReadELWReq struct {
+	LogHandle           []byte
+	ReadFlags           uint32
+	RecordOffset        uint32
+	NumberOfBytesToRead uint32
+}
+
+type ElfrReadELWRes struct {
+	Buffer                 []byte
+	NumberOfBytesRead      uint32
+	MinNumberOfBytesNeeded uint32
+	ReturnCode             uint32
+}
+
+// MS-EVEN Section 2.2.3 EVENTLOGRECORD
+type EventLogRecord struct {
+	RecordNumber        uint32
+	TimeGenerated       time.Time
+	TimeWritten         time.Time
+	EventID             uint32
+	EventType           uint16
+	EventCategory       uint16
+	ClosingRecordNumber uint32
+	SourceName          string
+	ComputerName        string
+	UserSid             *msdtyp.SID
+	Strings             []string
+	Data                []byte
+}
+
+// Code returns the event identifier as displayed by the Event Viewer, i.e.,
+// the EventID without the severity, customer and facility bits.
+func (self *EventLogRecord) Code() uint16 {
+	return uint16(self.EventID)
+}
+
+func (self *ElfrOpenELWReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for ElfrOpenELWReq")
+	w := bytes.NewBuffer(res)
+	refId := uint32(1)
+
+	// UNCServerName is a unique ptr that the server ignores
+	_, err = w.Write([]byte{0, 0, 0, 0})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	_, err = msdtyp.WriteRPCUnicodeStrPtr(w, self.ModuleName, &refId)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	_, err = msdtyp.WriteRPCUnicodeStrPtr(w, self.RegModuleName, &refId)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Write(w, le, self.MajorVersion)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Write(w, le, self.MinorVersion)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return w.Bytes(), nil
+}
+
+func (self *ElfrOpenELWReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of ElfrOpenELWReq")
+}
+
+func (self *ElfrCloseELReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for ElfrCloseELReq")
+	if len(self.LogHandle) != 20 {
+		return nil, fmt.Errorf("LogHandle must be a 20 byte context handle")
+	}
+	return append(res, self.LogHandle...), nil
+}
+
+func (self *ElfrCloseELReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of ElfrCloseELReq")
+}
+
+func (self *ElfrNumberOfRecordsReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for ElfrNumberOfRecordsReq")
+	if len(self.LogHandle) != 20 {
+		return nil, fmt.Errorf("LogHandle must be a 20 byte context handle")
+	}
+	return append(res, self.LogHandle...), nil
+}
+
+func (self *ElfrNumberOfRecordsReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of ElfrNumberOfRecordsReq")
+}
+
+func (self *ElfrNumberOfRecordsRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of ElfrNumberOfRecordsRes")
+}
+
+func (self *ElfrNumberOfRecordsRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for ElfrNumberOfRecordsRes")
+	if len(buf) < 8 {
+		return fmt.Errorf("Buffer to small for ElfrNumberOfRecordsRes")
+	}
+	self.NumberOfRecords = le.Uint32(buf)
+	self.ReturnCode = le.Uint32(buf[4:])
+	return
+}
+
+func (self *ElfrReadELWReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for ElfrReadELWReq")
+	if len(self.LogHandle) != 20 {
+		return nil, fmt.Errorf("LogHandle must be a 20 byte context handle")
+	}
+	res = append(res, self.LogHandle...)
+	res = binary.LittleEndian.AppendUint32(res, self.ReadFlags)
+	res = binary.LittleEndian.AppendUint32(res, self.RecordOffset)
+	res = binary.LittleEndian.AppendUint32(res, self.NumberOfBytesToRead)
+	return
+}
+
+func (self *ElfrReadELWReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of ElfrReadELWReq")
+}
+
+func (self *ElfrReadELWRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of ElfrReadELWRes")
+}
+
+func (self *ElfrReadELWRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for ElfrReadELWRes")
+	if len(buf) < 16 {
+		return fmt.Errorf("Buffer to small for ElfrReadELWRes")
+	}
+	r := bytes.NewReader(buf)
+	var maxCount uint32
+	err = binary.Read(r, le, &maxCount)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if int(maxCount)+12 > r.Len() {
+		return fmt.Errorf("Invalid size of Buffer in ElfrReadELWRes")
+	}
+	data := make([]byte, maxCount)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	padd := (4 - (int(maxCount) % 4)) % 4
+	_, err = r.Seek(int64(padd), io.SeekCurrent)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Read(r, le, &self.NumberOfBytesRead)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Read(r, le, &self.MinNumberOfBytesNeeded)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Read(r, le, &self.ReturnCode)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if self.NumberOfBytesRead > maxCount {
+		return fmt.Errorf("Invalid NumberOfBytesRead in ElfrReadELWRes")
+	}
+	self.Buffer = data[:self.NumberOfBytesRead]
+	return
+}
+
+// ParseEventLogRecords parses a buffer of consecutive EVENTLOGRECORD
+// structures as returned by ElfrReadELW
+func ParseEventLogRecords(buf []byte) (records []EventLogRecord, err error) {
+	for len(buf) > 0 {
+		if len(buf) < 8 {
+			return nil, fmt.Errorf("Buffer to small for EventLogRecord")
+		}
+		length := le.Uint32(buf)
+		if length < eventLogRecordHeaderSize || int(length) > len(buf) {
+			return nil, fmt.Errorf("Invalid length of EventLogRecord")
+		}
+		var record EventLogRecord
+		err = record.UnmarshalBinary(buf[:length])
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+		records = append(records, record)
+		buf = buf[length:]
+	}
+	return
+}
+
+func (self *EventLogRecord) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of EventLogRecord")
+}
+
+func (self *EventLogRecord) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for EventLogRecord")
+	if len(buf) < eventLogRecordHeaderSize {
+		return fmt.Errorf("Buffer to small for EventLogRecord")
+	}
+	if le.Uint32(buf[4:]) != eventLogRecordSignature {
+		return fmt.Errorf("Invalid EventLogRecord signature")
+	}
+	self.RecordNumber = le.Uint32(buf[8:])
+	self.TimeGenerated = time.Unix(int64(le.Uint32(buf[12:])), 0)
+	self.TimeWritten = time.Unix(int64(le.Uint32(buf[16:])), 0)
+	self.EventID = le.Uint32(buf[20:])
+	self.EventType = le.Uint16(buf[24:])
+	numStrings := int(le.Uint16(buf[26:]))
+	self.EventCategory = le.Uint16(buf[28:])
+	self.ClosingRecordNumber = le.Uint32(buf[32:])
+	stringOffset := le.Uint32(buf[36:])
+	sidLength := le.Uint32(buf[40:])
+	sidOffset := le.Uint32(buf[44:])
+	dataLength := le.Uint32(buf[48:])
+	dataOffset := le.Uint32(buf[52:])
+
+	var n int
+	self.SourceName, n = readNullTerminatedString(buf[eventLogRecordHeaderSize:])
+	self.ComputerName, _ = readNullTerminatedString(buf[eventLogRecordHeaderSize+n:])
+
+	if sidLength > 0 {
+		if uint64(sidOffset)+uint64(sidLength) > uint64(len(buf)) {
+			return fmt.Errorf("Invalid UserSid offset in EventLogRecord")
+		}
+		self.UserSid = &msdtyp.SID{}
+		err = self.UserSid.UnmarshalBinary(buf[sidOffset : sidOffset+sidLength])
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+
+	if numStrings > 0 {
+		if int(stringOffset) > len(buf) {
+			return fmt.Errorf("Invalid StringOffset in EventLogRecord")
+		}
+		strs := buf[stringOffset:]
+		for i := 0; i < numStrings && len(strs) > 0; i++ {
+			s, n := readNullTerminatedString(strs)
+			self.Strings = append(self.Strings, s)
+			strs = strs[n:]
+		}
+	}
+
+	if dataLength > 0 {
+		if uint64(dataOffset)+uint64(dataLength) > uint64(len(buf)) {
+			return fmt.Errorf("Invalid DataOffset in EventLogRecord")
+		}
+		self.Data = append([]byte{}, buf[dataOffset:dataOffset+dataLength]...)
+	}
+	return
+}
+
+// readNullTerminatedString decodes a null terminated UTF-16LE string and
+// returns the number of bytes consumed including the terminator
+func readNullTerminatedString(buf []byte) (s string, n int) {
+	for n = 0; n+1 < len(buf); n += 2 {
+		if buf[n] == 0 && buf[n+1] == 0 {
+			s, _ = msdtyp.FromUnicodeString(buf[:n])
+			return s, n + 2
+		}
+	}
+	s, _ = msdtyp.FromUnicodeString(buf[:n])
+	return s, len(buf)
+}
@@ -0,0 +1,435 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package msfsrvp implements a client for the File Server Remote VSS
+// Protocol (MS-FSRVP) used to create application consistent shadow copies of
+// file shares on a remote file server and to expose them as new shares.
+//
+// The protocol is served over the FssagentRpc named pipe. Windows servers
+// require the caller to be a member of the Administrators or Backup Operators
+// group on the file server.
+package msfsrvp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/jfjallid/golog"
+)
+
+var (
+	log                  = golog.Get("github.com/ericblavier/go-smb/smb/dcerpc/msfsrvp")
+	le  binary.ByteOrder = binary.LittleEndian
+)
+
+const (
+	MSRPCUuidFsrvp                = "a8e0653c-2744-4389-a61d-7373df8b2292"
+	MSRPCFsrvpPipe                = "FssagentRpc"
+	MSRPCFsrvpMajorVersion uint16 = 1
+	MSRPCFsrvpMinorVersion uint16 = 0
+)
+
+// MSRPC File Server Remote VSS Protocol Operations
+const (
+	FsrvpGetSupportedVersion           uint16 = 0
+	FsrvpSetContext                    uint16 = 1
+	FsrvpStartShadowCopySet            uint16 = 2
+	FsrvpAddToShadowCopySet            uint16 = 3
+	FsrvpCommitShadowCopySet           uint16 = 4
+	FsrvpExposeShadowCopySet           uint16 = 5
+	FsrvpRecoveryCompleteShadowCopySet uint16 = 6
+	FsrvpAbortShadowCopySet            uint16 = 7
+	FsrvpIsPathSupported               uint16 = 8
+	FsrvpIsPathShadowCopied            uint16 = 9
+	FsrvpGetShareMapping               uint16 = 10
+	FsrvpDeleteShareMapping            uint16 = 11
+	FsrvpPrepareShadowCopySet          uint16 = 12
+)
+
+// MS-FSRVP Section 2.2.1.1 Protocol versions
+const (
+	FsrvpRpcVersion1 uint32 = 0x00000001
+	FsrvpRpcVersion2 uint32 = 0x00000002
+)
+
+// MS-FSRVP Section 2.2.2.2 Shadow copy contexts
+const (
+	FsrvpCtxBackup          uint32 = 0x00000000
+	FsrvpCtxFileShareBackup uint32 = 0x00000010
+	FsrvpCtxNasRollback     uint32 = 0x00000019
+	FsrvpCtxAppRollback     uint32 = 0x00000009
+	// Can be combined with any of the contexts to have the shadow copies
+	// made writable during recovery
+	FsrvpAttrAutoRecovery uint32 = 0x00400000
+)
+
+// Default timeout in milliseconds for CommitShadowCopySet,
+// ExposeShadowCopySet and PrepareShadowCopySet
+const DefaultTimeout uint32 = 60 * 1000
+
+const (
+	ErrorSuccess                  uint32 = 0x00000000 // The operation completed successfully
+	ErrorAccessDenied             uint32 = 0x00000005 // Access is denied
+	ErrorInvalidParameter         uint32 = 0x00000057 // The parameter is incorrect
+	FsrvpEWaitTimeout             uint32 = 0x00000102 // The wait for shadow copy commit or expose operation has timed out
+	EAccessDenied                 uint32 = 0x80070005 // Access is denied
+	EInvalidArg                   uint32 = 0x80070057 // One or more arguments are invalid
+	FsrvpEBadState                uint32 = 0x80042301 // A method call was invalid because of the state of the server
+	FsrvpEShadowCopySetInProgress uint32 = 0x80042316 // A call was made to either SetContext or StartShadowCopySet while the creation of another shadow copy set is in progress
+	FsrvpENotSupported            uint32 = 0x8004230c // The file store that contains the share to be shadow copied is not supported by the server
+	FsrvpEObjectNotFound          uint32 = 0x80042308 // The specified object does not exist
+	FsrvpEUnsupportedContext      uint32 = 0x8004231c // The context value specified is invalid
+	FsrvpEShadowCopySetIdMismatch uint32 = 0x80042501 // The provided ShadowCopySetId does not exist
+	FsrvpEWaitFailed              uint32 = 0xffffffff // The wait for shadow copy commit or expose operation has failed
+)
+
+var ResponseCodeMap = map[uint32]error{
+	ErrorSuccess:                  fmt.Errorf("The operation completed successfully"),
+	ErrorAccessDenied:             fmt.Errorf("Access is denied"),
+	ErrorInvalidParameter:         fmt.Errorf("The parameter is incorrect"),
+	FsrvpEWaitTimeout:             fmt.Errorf("The wait for shadow copy commit or expose operation has timed out"),
+	EAccessDenied:                 fmt.Errorf("Access is denied"),
+	EInvalidArg:                   fmt.Errorf("One or more arguments are invalid"),
+	FsrvpEBadState:                fmt.Errorf("A method call was invalid because of the state of the server"),
+	FsrvpEShadowCopySetInProgress: fmt.Errorf("The creation of another shadow copy set is in progress"),
+	FsrvpENotSupported:            fmt.Errorf("The file store that contains the share to be shadow copied is not supported by the server"),
+	FsrvpEObjectNotFound:          fmt.Errorf("The specified object does not exist"),
+	FsrvpEUnsupportedContext:      fmt.Errorf("The context value specified is invalid"),
+	FsrvpEShadowCopySetIdMismatch: fmt.Errorf("The provided ShadowCopySetId does not exist"),
+	FsrvpEWaitFailed:              fmt.Errorf("The wait for shadow copy commit or expose operation has failed"),
+}
+
+func NewRPCCon(sb *dcerpc.ServiceBind) *RPCCon {
+	return &RPCCon{sb}
+}
+
+func returnCodeToError(op string, code uint32) error {
+	status, found := ResponseCodeMap[code]
+	if !found {
+		return fmt.Errorf("Received unknown FSRVP return code for %s response: 0x%x", op, code)
+	}
+	return status
+}
+
+func newGuid() []byte {
+	guid := make([]byte, 16)
+	rand.Read(guid)
+	guid[7] = (guid[7] & 0x0f) | 0x40 // Version 4
+	guid[8] = (guid[8] & 0x3f) | 0x80 // Variant
+	return guid
+}
+
+// call performs a request whose response only contains a return code
+func (sb *RPCCon) call(op string, opnum uint16, innerBuf []byte) (err error) {
+	buffer, err := sb.MakeIoCtlRequest(opnum, innerBuf)
+	if err != nil {
+		return
+	}
+	if len(buffer) < 4 {
+		return fmt.Errorf("Server response to %s was too small. Expected at atleast 4 bytes", op)
+	}
+	returnCode := le.Uint32(buffer[len(buffer)-4:])
+	if returnCode != ErrorSuccess {
+		err = returnCodeToError(op, returnCode)
+		log.Errorln(err)
+	}
+	return
+}
+
+// GetSupportedVersion returns the minimum and maximum protocol versions
+// supported by the server
+func (sb *RPCCon) GetSupportedVersion() (minVersion, maxVersion uint32, err error) {
+	log.Debugln("In GetSupportedVersion")
+	buffer, err := sb.MakeIoCtlRequest(FsrvpGetSupportedVersion, nil)
+	if err != nil {
+		return
+	}
+	var resp GetSupportedVersionRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		err = returnCodeToError("GetSupportedVersion", resp.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	return resp.MinVersion, resp.MaxVersion, nil
+}
+
+// SetContext sets the context, e.g., FsrvpCtxFileShareBackup, of the next
+// shadow copy set
+func (sb *RPCCon) SetContext(context uint32) (err error) {
+	log.Debugln("In SetContext")
+	innerBuf := make([]byte, 4)
+	le.PutUint32(innerBuf, context)
+	return sb.call("SetContext", FsrvpSetContext, innerBuf)
+}
+
+// StartShadowCopySet starts a new shadow copy set and returns its id
+func (sb *RPCCon) StartShadowCopySet() (shadowCopySetId []byte, err error) {
+	log.Debugln("In StartShadowCopySet")
+	buffer, err := sb.MakeIoCtlRequest(FsrvpStartShadowCopySet, newGuid())
+	if err != nil {
+		return
+	}
+	var resp GuidRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		err = returnCodeToError("StartShadowCopySet", resp.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	return resp.Guid, nil
+}
+
+// AddToShadowCopySet adds the share, specified as a UNC path such as
+// \\server\share, to the shadow copy set and returns the id of the shadow copy
+func (sb *RPCCon) AddToShadowCopySet(shadowCopySetId []byte, shareName string) (shadowCopyId []byte, err error) {
+	log.Debugln("In AddToShadowCopySet")
+	innerReq := AddToShadowCopySetReq{
+		ClientShadowCopyId: newGuid(),
+		ShadowCopySetId:    shadowCopySetId,
+		ShareName:          shareName,
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	buffer, err := sb.MakeIoCtlRequest(FsrvpAddToShadowCopySet, innerBuf)
+	if err != nil {
+		return
+	}
+	var resp GuidRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		err = returnCodeToError("AddToShadowCopySet", resp.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	return resp.Guid, nil
+}
+
+func (sb *RPCCon) setOperation(op string, opnum uint16, shadowCopySetId []byte, timeout uint32, withTimeout bool) (err error) {
+	log.Debugf("In %s\n", op)
+	if len(shadowCopySetId) != 16 {
+		return fmt.Errorf("ShadowCopySetId must be a 16 byte GUID")
+	}
+	innerBuf := append([]byte{}, shadowCopySetId...)
+	if withTimeout {
+		innerBuf = binary.LittleEndian.AppendUint32(innerBuf, timeout)
+	}
+	return sb.call(op, opnum, innerBuf)
+}
+
+// PrepareShadowCopySet waits for the shadow copy set to be prepared. Only
+// supported by servers implementing FsrvpRpcVersion2.
+func (sb *RPCCon) PrepareShadowCopySet(shadowCopySetId []byte, timeout uint32) error {
+	return sb.setOperation("PrepareShadowCopySet", FsrvpPrepareShadowCopySet, shadowCopySetId, timeout, true)
+}
+
+// CommitShadowCopySet creates the shadow copies of the set
+func (sb *RPCCon) CommitShadowCopySet(shadowCopySetId []byte, timeout uint32) error {
+	return sb.setOperation("CommitShadowCopySet", FsrvpCommitShadowCopySet, shadowCopySetId, timeout, true)
+}
+
+// ExposeShadowCopySet exposes the shadow copies of the set as shares
+func (sb *RPCCon) ExposeShadowCopySet(shadowCopySetId []byte, timeout uint32) error {
+	return sb.setOperation("ExposeShadowCopySet", FsrvpExposeShadowCopySet, shadowCopySetId, timeout, true)
+}
+
+// RecoveryCompleteShadowCopySet completes the shadow copy set
+func (sb *RPCCon) RecoveryCompleteShadowCopySet(shadowCopySetId []byte) error {
+	return sb.setOperation("RecoveryCompleteShadowCopySet", FsrvpRecoveryCompleteShadowCopySet, shadowCopySetId, 0, false)
+}
+
+// AbortShadowCopySet aborts the creation of the shadow copy set
+func (sb *RPCCon) AbortShadowCopySet(shadowCopySetId []byte) error {
+	return sb.setOperation("AbortShadowCopySet", FsrvpAbortShadowCopySet, shadowCopySetId, 0, false)
+}
+
+// IsPathSupported checks if the share, specified as a UNC path, can be
+// shadow copied and returns the name of the server owning the share
+func (sb *RPCCon) IsPathSupported(shareName string) (supported bool, ownerMachineName string, err error) {
+	log.Debugln("In IsPathSupported")
+	innerReq := ShareNameReq{ShareName: shareName}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	buffer, err := sb.MakeIoCtlRequest(FsrvpIsPathSupported, innerBuf)
+	if err != nil {
+		return
+	}
+	var resp IsPathSupportedRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		err = returnCodeToError("IsPathSupported", resp.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	return resp.SupportedByThisProvider, resp.OwnerMachineName, nil
+}
+
+// IsPathShadowCopied checks if the share, specified as a UNC path, has a
+// shadow copy
+func (sb *RPCCon) IsPathShadowCopied(shareName string) (present bool, compatibility int32, err error) {
+	log.Debugln("In IsPathShadowCopied")
+	innerReq := ShareNameReq{ShareName: shareName}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	buffer, err := sb.MakeIoCtlRequest(FsrvpIsPathShadowCopied, innerBuf)
+	if err != nil {
+		return
+	}
+	var resp IsPathShadowCopiedRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		err = returnCodeToError("IsPathShadowCopied", resp.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	return resp.ShadowCopyPresent, resp.ShadowCopyCompatibility, nil
+}
+
+// GetShareMapping returns the mapping between the share and its exposed
+// shadow copy
+func (sb *RPCCon) GetShareMapping(shadowCopyId, shadowCopySetId []byte, shareName string) (mapping *ShareMapping1, err error) {
+	log.Debugln("In GetShareMapping")
+	innerReq := GetShareMappingReq{
+		ShadowCopyId:    shadowCopyId,
+		ShadowCopySetId: shadowCopySetId,
+		ShareName:       shareName,
+		Level:           1,
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	buffer, err := sb.MakeIoCtlRequest(FsrvpGetShareMapping, innerBuf)
+	if err != nil {
+		return
+	}
+	var resp GetShareMappingRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		err = returnCodeToError("GetShareMapping", resp.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	if resp.ShareMapping == nil {
+		return nil, fmt.Errorf("GetShareMapping did not return a share mapping")
+	}
+	return resp.ShareMapping, nil
+}
+
+// DeleteShareMapping deletes the shadow copy of the share and removes the
+// share exposing it
+func (sb *RPCCon) DeleteShareMapping(shadowCopySetId, shadowCopyId []byte, shareName string) (err error) {
+	log.Debugln("In DeleteShareMapping")
+	innerReq := DeleteShareMappingReq{
+		ShadowCopySetId: shadowCopySetId,
+		ShadowCopyId:    shadowCopyId,
+		ShareName:       shareName,
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return sb.call("DeleteShareMapping", FsrvpDeleteShareMapping, innerBuf)
+}
+
+// CreateShadowCopy performs the complete sequence of calls to create and
+// expose a shadow copy of a share, specified as a UNC path, and returns the
+// mapping to the share exposing the shadow copy. The shadow copy set is
+// aborted if any step before the commit fails.
+func (sb *RPCCon) CreateShadowCopy(shareName string, context uint32) (mapping *ShareMapping1, err error) {
+	_, maxVersion, err := sb.GetSupportedVersion()
+	if err != nil {
+		return
+	}
+	err = sb.SetContext(context)
+	if err != nil {
+		return
+	}
+	setId, err := sb.StartShadowCopySet()
+	if err != nil {
+		return
+	}
+	shadowCopyId, err := sb.AddToShadowCopySet(setId, shareName)
+	if err != nil {
+		sb.AbortShadowCopySet(setId)
+		return
+	}
+	if maxVersion >= FsrvpRpcVersion2 {
+		err = sb.PrepareShadowCopySet(setId, DefaultTimeout)
+		if err != nil {
+			sb.AbortShadowCopySet(setId)
+			return
+		}
+	}
+	err = sb.CommitShadowCopySet(setId, DefaultTimeout)
+	if err != nil {
+		sb.AbortShadowCopySet(setId)
+		return
+	}
+	err = sb.ExposeShadowCopySet(setId, DefaultTimeout)
+	if err != nil {
+		return
+	}
+	mapping, err = sb.GetShareMapping(shadowCopyId, setId, shareName)
+	if err != nil {
+		return
+	}
+	err = sb.RecoveryCompleteShadowCopySet(setId)
+	return
+}
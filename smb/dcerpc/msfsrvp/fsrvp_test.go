@@ -0,0 +1,84 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package msfsrvp
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"testing"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+func TestAddToShadowCopySetReq(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f0600000000000000060000005c005c0061005c0062000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := AddToShadowCopySetReq{
+		ClientShadowCopyId: pkt[:16],
+		ShadowCopySetId:    pkt[16:32],
+		ShareName:          `\\a\b`,
+	}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pkt, buf) {
+		t.Fatal("Fail")
+	}
+
+	req.ShadowCopySetId = nil
+	_, err = req.MarshalBinary()
+	if err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestGetShareMappingRes(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("0100000000000200101112131415161718191a1b1c1d1e1f000102030405060708090a0b0c0d0e0f040002000800020044332211bbaad9010600000000000000060000005c005c0061005c00620000000a000000000000000a0000005c005c0061005c00620040007b0078007d00000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp GetShareMappingRes
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ReturnCode != ErrorSuccess || resp.ShareMapping == nil {
+		t.Fatal("Fail")
+	}
+	m := resp.ShareMapping
+	if msdtyp.GuidToString(m.ShadowCopyId) != "03020100-0504-0706-0809-0a0b0c0d0e0f" {
+		t.Fatal("Fail")
+	}
+	if m.ShareNameUNC != `\\a\b` || m.ShadowCopyShareName != `\\a\b@{x}` {
+		t.Fatal("Fail")
+	}
+	if m.CreationTimestamp.LowDateTime != 0x11223344 || m.CreationTimestamp.HighDateTime != 0x01d9aabb {
+		t.Fatal("Fail")
+	}
+}
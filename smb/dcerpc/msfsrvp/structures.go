@@ -0,0 +1,329 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// The marshal/unmarshal of requests and responses according to the NDR syntax
+// has been implemented on a per RPC request basis and not in any complete way.
+// As such, for each new functionality, a manual marshal and unmarshal method
+// has to be written for the relevant messages. This makes it a bit easier to
+// define the message structs but more of the heavy lifting has to be performed
+// by the marshal/unmarshal functions.
+
+package msfsrvp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+)
+
+type RPCCon struct {
+	*dcerpc.ServiceBind
+}
+
+// MS-FSRVP Section 3.1.4.1 GetSupportedVersion
+type GetSupportedVersionRes struct {
+	MinVersion uint32
+	MaxVersion uint32
+	ReturnCode uint32
+}
+
+// Response of StartShadowCopySet and AddToShadowCopySet
+type GuidRes struct {
+	Guid       []byte
+	ReturnCode uint32
+}
+
+// MS-FSRVP Section 3.1.4.4 AddToShadowCopySet
+type AddToShadowCopySetReq struct {
+	ClientShadowCopyId []byte
+	ShadowCopySetId    []byte
+	ShareName          string
+}
+
+// Request of IsPathSupported and IsPathShadowCopied
+type ShareNameReq struct {
+	ShareName string
+}
+
+// MS-FSRVP Section 3.1.4.8 IsPathSupported
+type IsPathSupportedRes struct {
+	SupportedByThisProvider bool
+	OwnerMachineName        string
+	ReturnCode              uint32
+}
+
+// MS-FSRVP Section 3.1.4.9 IsPathShadowCopied
+type IsPathShadowCopiedRes struct {
+	ShadowCopyPresent       bool
+	ShadowCopyCompatibility int32
+	ReturnCode              uint32
+}
+
+// MS-FSRVP Section 3.1.4.10 GetShareMapping
+type GetShareMappingReq struct {
+	ShadowCopyId    []byte
+	ShadowCopySetId []byte
+	ShareName       string
+	Level           uint32
+}
+
+// MS-FSRVP Section 2.2.3.1 FSSAGENT_SHARE_MAPPING_1
+type ShareMapping1 struct {
+	ShadowCopySetId     []byte
+	ShadowCopyId        []byte
+	ShareNameUNC        string
+	ShadowCopyShareName string
+	CreationTimestamp   msdtyp.Filetime
+}
+
+type GetShareMappingRes struct {
+	ShareMapping *ShareMapping1
+	ReturnCode   uint32
+}
+
+// MS-FSRVP Section 3.1.4.11 DeleteShareMapping
+type DeleteShareMappingReq struct {
+	ShadowCopySetId []byte
+	ShadowCopyId    []byte
+	ShareName       string
+}
+
+func writeGuid(w io.Writer, name string, guid []byte) error {
+	if len(guid) != 16 {
+		return fmt.Errorf("%s must be a 16 byte GUID", name)
+	}
+	_, err := w.Write(guid)
+	return err
+}
+
+func (self *GetSupportedVersionRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of GetSupportedVersionRes")
+}
+
+func (self *GetSupportedVersionRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for GetSupportedVersionRes")
+	if len(buf) < 12 {
+		return fmt.Errorf("Buffer to small for GetSupportedVersionRes")
+	}
+	self.MinVersion = le.Uint32(buf)
+	self.MaxVersion = le.Uint32(buf[4:])
+	self.ReturnCode = le.Uint32(buf[8:])
+	return
+}
+
+func (self *GuidRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of GuidRes")
+}
+
+func (self *GuidRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for GuidRes")
+	if len(buf) < 20 {
+		return fmt.Errorf("Buffer to small for GuidRes")
+	}
+	self.Guid = make([]byte, 16)
+	copy(self.Guid, buf[:16])
+	self.ReturnCode = le.Uint32(buf[16:])
+	return
+}
+
+func (self *AddToShadowCopySetReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for AddToShadowCopySetReq")
+	w := bytes.NewBuffer(res)
+	err = writeGuid(w, "ClientShadowCopyId", self.ClientShadowCopyId)
+	if err != nil {
+		return
+	}
+	err = writeGuid(w, "ShadowCopySetId", self.ShadowCopySetId)
+	if err != nil {
+		return
+	}
+	_, err = msdtyp.WriteConformantVaryingString(w, self.ShareName, true)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return w.Bytes(), nil
+}
+
+func (self *AddToShadowCopySetReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of AddToShadowCopySetReq")
+}
+
+func (self *ShareNameReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for ShareNameReq")
+	w := bytes.NewBuffer(res)
+	_, err = msdtyp.WriteConformantVaryingString(w, self.ShareName, true)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return w.Bytes(), nil
+}
+
+func (self *ShareNameReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of ShareNameReq")
+}
+
+func (self *IsPathSupportedRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of IsPathSupportedRes")
+}
+
+func (self *IsPathSupportedRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for IsPathSupportedRes")
+	if len(buf) < 12 {
+		return fmt.Errorf("Buffer to small for IsPathSupportedRes")
+	}
+	r := bytes.NewReader(buf)
+	var supported, refId uint32
+	binary.Read(r, le, &supported)
+	self.SupportedByThisProvider = supported != 0
+	err = binary.Read(r, le, &refId)
+	if err != nil {
+		return
+	}
+	if refId != 0 {
+		self.OwnerMachineName, err = msdtyp.ReadConformantVaryingString(r, true)
+		if err != nil {
+			return
+		}
+	}
+	return binary.Read(r, le, &self.ReturnCode)
+}
+
+func (self *IsPathShadowCopiedRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of IsPathShadowCopiedRes")
+}
+
+func (self *IsPathShadowCopiedRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for IsPathShadowCopiedRes")
+	if len(buf) < 12 {
+		return fmt.Errorf("Buffer to small for IsPathShadowCopiedRes")
+	}
+	self.ShadowCopyPresent = le.Uint32(buf) != 0
+	self.ShadowCopyCompatibility = int32(le.Uint32(buf[4:]))
+	self.ReturnCode = le.Uint32(buf[8:])
+	return
+}
+
+func (self *GetShareMappingReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for GetShareMappingReq")
+	w := bytes.NewBuffer(res)
+	err = writeGuid(w, "ShadowCopyId", self.ShadowCopyId)
+	if err != nil {
+		return
+	}
+	err = writeGuid(w, "ShadowCopySetId", self.ShadowCopySetId)
+	if err != nil {
+		return
+	}
+	_, err = msdtyp.WriteConformantVaryingString(w, self.ShareName, true)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Write(w, le, self.Level)
+	if err != nil {
+		return
+	}
+	return w.Bytes(), nil
+}
+
+func (self *GetShareMappingReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of GetShareMappingReq")
+}
+
+func (self *GetShareMappingRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of GetShareMappingRes")
+}
+
+func (self *GetShareMappingRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for GetShareMappingRes")
+	if len(buf) < 12 {
+		return fmt.Errorf("Buffer to small for GetShareMappingRes")
+	}
+	r := bytes.NewReader(buf)
+	var level, refId uint32
+	binary.Read(r, le, &level)
+	err = binary.Read(r, le, &refId)
+	if err != nil {
+		return
+	}
+	if level == 1 && refId != 0 {
+		if r.Len() < 52 {
+			return fmt.Errorf("Buffer to small for FSSAGENT_SHARE_MAPPING_1")
+		}
+		m := &ShareMapping1{
+			ShadowCopySetId: make([]byte, 16),
+			ShadowCopyId:    make([]byte, 16),
+		}
+		r.Read(m.ShadowCopySetId)
+		r.Read(m.ShadowCopyId)
+		var uncPtr, shadowPtr uint32
+		binary.Read(r, le, &uncPtr)
+		binary.Read(r, le, &shadowPtr)
+		err = m.CreationTimestamp.FromReader(r)
+		if err != nil {
+			return
+		}
+		if uncPtr != 0 {
+			m.ShareNameUNC, err = msdtyp.ReadConformantVaryingString(r, true)
+			if err != nil {
+				return
+			}
+		}
+		if shadowPtr != 0 {
+			m.ShadowCopyShareName, err = msdtyp.ReadConformantVaryingString(r, true)
+			if err != nil {
+				return
+			}
+		}
+		self.ShareMapping = m
+	}
+	return binary.Read(r, le, &self.ReturnCode)
+}
+
+func (self *DeleteShareMappingReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for DeleteShareMappingReq")
+	w := bytes.NewBuffer(res)
+	err = writeGuid(w, "ShadowCopySetId", self.ShadowCopySetId)
+	if err != nil {
+		return
+	}
+	err = writeGuid(w, "ShadowCopyId", self.ShadowCopyId)
+	if err != nil {
+		return
+	}
+	_, err = msdtyp.WriteConformantVaryingString(w, self.ShareName, true)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return w.Bytes(), nil
+}
+
+func (self *DeleteShareMappingReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of DeleteShareMappingReq")
+}
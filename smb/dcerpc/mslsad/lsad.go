@@ -191,8 +191,8 @@ func (sb *RPCCon) LsarCloseHandle(handle []byte) (err error) {
 
 func (sb *RPCCon) LsarQueryInformationPolicy(policyHandle []byte, informationClass uint16) (res LsaprPolicyInformation, err error) {
 	log.Debugln("In LsarQueryInformationPolicy")
-	if informationClass != PolicyPrimaryDomainInformation {
-		err = fmt.Errorf("Currently, only informationClass PolicyPrimaryDomainInformation (%d) is supported", PolicyPrimaryDomainInformation)
+	if informationClass != PolicyPrimaryDomainInformation && informationClass != PolicyAccountDomainInformation {
+		err = fmt.Errorf("Currently, only informationClass PolicyPrimaryDomainInformation (%d) and PolicyAccountDomainInformation (%d) are supported", PolicyPrimaryDomainInformation, PolicyAccountDomainInformation)
 		return
 	}
 
@@ -815,3 +815,22 @@ func (sb *RPCCon) GetPrimaryDomainInfo() (domainInfo *LsaprPolicyPrimaryDomInfo,
 	domainInfo = res.(*LsaprPolicyPrimaryDomInfo)
 	return
 }
+
+// GetAccountDomainInfo returns the name and SID of the account domain of the
+// server, i.e., the domain of a domain controller or the local accounts of a
+// member server
+func (sb *RPCCon) GetAccountDomainInfo() (domainInfo *LsaprPolicyPrimaryDomInfo, err error) {
+	policyHandle, err := sb.LsarOpenPolicy2("")
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	defer sb.LsarCloseHandle(policyHandle)
+	res, err := sb.LsarQueryInformationPolicy(policyHandle, PolicyAccountDomainInformation)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	domainInfo = res.(*LsaprPolicyPrimaryDomInfo)
+	return
+}
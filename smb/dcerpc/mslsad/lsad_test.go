@@ -97,6 +97,18 @@ func TestLsarQueryInformationPolicyRes(t *testing.T) {
 	if info.Sid.ToString() != "S-1-5-21-1023064509-695355555-2046574917" {
 		t.Fatal("Fail")
 	}
+
+	// The account domain information has the same layout
+	pkt, _ = hex.DecodeString("00000200050000000c000e00040002000800020007000000000000000600000053004b0059004e004500540004000000010400000000000515000000bdb9fa3ca34872294541fc7900000000")
+	resp = LsarQueryInformationPolicyRes{}
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, ok := resp.PolicyInformation.(*LsaprPolicyPrimaryDomInfo)
+	if !ok || info.Name != "SKYNET" {
+		t.Fatal("Fail")
+	}
 	return
 }
 
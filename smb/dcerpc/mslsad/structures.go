@@ -184,6 +184,8 @@ type LsaprPolicyInformation interface {
 }
 
 // MS-LSAD Section 2.2.4.5
+// Also used for the LSAPR_POLICY_ACCOUNT_DOM_INFO of Section 2.2.4.6 which
+// has the same layout
 type LsaprPolicyPrimaryDomInfo struct {
 	Name string
 	Sid  *msdtyp.SID
@@ -620,7 +622,7 @@ func (self *LsarQueryInformationPolicyRes) UnmarshalBinary(buf []byte) (err erro
 	var informationPolicy uint16
 	informationPolicy = uint16(val)
 	switch informationPolicy {
-	case PolicyPrimaryDomainInformation:
+	case PolicyPrimaryDomainInformation, PolicyAccountDomainInformation:
 		var info LsaprPolicyPrimaryDomInfo
 		err = info.fromReader(r)
 		if err != nil {
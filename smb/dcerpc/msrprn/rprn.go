@@ -0,0 +1,204 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package msrprn implements the printer driver methods of the Print System
+// Remote Protocol (MS-RPRN) served by the spooler over the spoolss named pipe:
+// enumeration of installed printer drivers and driver installation with
+// RpcAddPrinterDriverEx.
+package msrprn
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/jfjallid/golog"
+)
+
+var (
+	log                  = golog.Get("github.com/ericblavier/go-smb/smb/dcerpc/msrprn")
+	le  binary.ByteOrder = binary.LittleEndian
+)
+
+const (
+	MSRPCUuidSpoolss                = "12345678-1234-ABCD-EF00-0123456789AB"
+	MSRPCSpoolssPipe                = "spoolss"
+	MSRPCSpoolssMajorVersion uint16 = 1
+	MSRPCSpoolssMinorVersion uint16 = 0
+)
+
+// MSRPC Print System Remote Protocol (spoolss) Operations
+const (
+	RpcEnumPrinterDrivers uint16 = 10
+	RpcAddPrinterDriverEx uint16 = 89
+)
+
+// MS-RPRN Section 2.2.4.4 Environment names
+const (
+	EnvironmentX64   = "Windows x64"
+	EnvironmentX86   = "Windows NT x86"
+	EnvironmentARM64 = "Windows ARM64"
+)
+
+// MS-RPRN Section 3.1.4.4.8 dwFileCopyFlags
+const (
+	APDStrictUpgrade              uint32 = 0x00000001
+	APDStrictDowngrade            uint32 = 0x00000002
+	APDCopyAllFiles               uint32 = 0x00000004
+	APDCopyNewFiles               uint32 = 0x00000008
+	APDCopyFromDirectory          uint32 = 0x00000010
+	APDDontCopyFilesToClusterNode uint32 = 0x00001000
+	APDCopyToAllSpoolers          uint32 = 0x00002000
+	APDInstallWarnedDriver        uint32 = 0x00008000
+	APDReturnBlockingStatusCode   uint32 = 0x00010000
+)
+
+const (
+	ErrorSuccess                       uint32 = 0x0   // The operation completed successfully
+	ErrorFileNotFound                  uint32 = 0x2   // The system cannot find the file specified.
+	ErrorPathNotFound                  uint32 = 0x3   // The system cannot find the path specified.
+	ErrorAccessDenied                  uint32 = 0x5   // Access is denied
+	ErrorBadNetpath                    uint32 = 0x35  // The network path was not found.
+	ErrorInvalidParameter              uint32 = 0x57  // One of the function parameters is not valid.
+	ErrorInsufficientBuffer            uint32 = 0x7a  // The data area passed to a system call is too small.
+	ErrorInvalidLevel                  uint32 = 0x7c  // The information level is invalid.
+	ErrorPrinterDriverAlreadyInstalled uint32 = 0x703 // The specified printer driver is already installed.
+	ErrorUnknownPrinterDriver          uint32 = 0x705 // The printer driver is unknown.
+	ErrorInvalidEnvironment            uint32 = 0x70a // The environment specified is invalid.
+	ErrorPrinterDriverBlocked          uint32 = 0xbd5 // The printer driver is known to be unreliable.
+	ErrorPrinterDriverWarned           uint32 = 0xbdf // The printer driver is known to harm the system.
+)
+
+var ResponseCodeMap = map[uint32]error{
+	ErrorSuccess:                       fmt.Errorf("The operation completed successfully"),
+	ErrorFileNotFound:                  fmt.Errorf("The system cannot find the file specified."),
+	ErrorPathNotFound:                  fmt.Errorf("The system cannot find the path specified."),
+	ErrorAccessDenied:                  fmt.Errorf("Access is denied"),
+	ErrorBadNetpath:                    fmt.Errorf("The network path was not found."),
+	ErrorInvalidParameter:              fmt.Errorf("One of the function parameters is not valid."),
+	ErrorInsufficientBuffer:            fmt.Errorf("The data area passed to a system call is too small."),
+	ErrorInvalidLevel:                  fmt.Errorf("The information level is invalid."),
+	ErrorPrinterDriverAlreadyInstalled: fmt.Errorf("The specified printer driver is already installed."),
+	ErrorUnknownPrinterDriver:          fmt.Errorf("The printer driver is unknown."),
+	ErrorInvalidEnvironment:            fmt.Errorf("The environment specified is invalid."),
+	ErrorPrinterDriverBlocked:          fmt.Errorf("The printer driver is known to be unreliable."),
+	ErrorPrinterDriverWarned:           fmt.Errorf("The printer driver is known to harm the system."),
+}
+
+func NewRPCCon(sb *dcerpc.ServiceBind) *RPCCon {
+	return &RPCCon{sb}
+}
+
+func returnCodeError(returnCode uint32, call string) (err error) {
+	status, found := ResponseCodeMap[returnCode]
+	if !found {
+		err = fmt.Errorf("Received unknown RPRN return code for %s response: 0x%x", call, returnCode)
+		log.Errorln(err)
+		return
+	}
+	return status
+}
+
+// EnumPrinterDrivers lists the printer drivers installed for the specified
+// environment, e.g., EnvironmentX64. An empty serverName targets the server
+// of the binding and an empty environment selects the native environment of
+// the server. Only levels 1 and 2 are supported.
+func (sb *RPCCon) EnumPrinterDrivers(serverName, environment string, level uint32) (drivers []DriverInfo, err error) {
+	log.Debugln("In EnumPrinterDrivers")
+	if level != 1 && level != 2 {
+		return nil, fmt.Errorf("Only levels 1 and 2 are supported")
+	}
+	innerReq := RpcEnumPrinterDriversReq{
+		Name:        serverName,
+		Environment: environment,
+		Level:       level,
+	}
+	// The first call retrieves the required buffer size
+	for i := 0; i < 2; i++ {
+		var innerBuf []byte
+		innerBuf, err = innerReq.MarshalBinary()
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+
+		var buffer []byte
+		buffer, err = sb.MakeIoCtlRequest(RpcEnumPrinterDrivers, innerBuf)
+		if err != nil {
+			return
+		}
+
+		var resp RpcEnumPrinterDriversRes
+		err = resp.UnmarshalBinary(buffer)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+
+		if resp.ReturnCode == ErrorInsufficientBuffer && i == 0 {
+			innerReq.BufSize = resp.Needed
+			continue
+		}
+		if resp.ReturnCode != ErrorSuccess {
+			err = returnCodeError(resp.ReturnCode, "RpcEnumPrinterDrivers")
+			log.Errorln(err)
+			return
+		}
+		return ParseDriverInfo(resp.Drivers, level, resp.Returned)
+	}
+	return nil, returnCodeError(ErrorInsufficientBuffer, "RpcEnumPrinterDrivers")
+}
+
+// AddPrinterDriverEx installs a printer driver described by a level 2
+// DRIVER_INFO structure. The driver files are referenced by paths that are
+// accessible from the server, typically in the printer driver directory or
+// a UNC path combined with APDCopyFromDirectory.
+func (sb *RPCCon) AddPrinterDriverEx(serverName string, driver *DriverInfo, fileCopyFlags uint32) (err error) {
+	log.Debugln("In AddPrinterDriverEx")
+	innerReq := RpcAddPrinterDriverExReq{
+		Name:          serverName,
+		Level:         2,
+		DriverInfo:    driver,
+		FileCopyFlags: fileCopyFlags,
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(RpcAddPrinterDriverEx, innerBuf)
+	if err != nil {
+		return
+	}
+
+	if len(buffer) < 4 {
+		return fmt.Errorf("Server response to RpcAddPrinterDriverEx was too small. Expected at atleast 4 bytes")
+	}
+
+	returnCode := le.Uint32(buffer)
+	if returnCode != ErrorSuccess {
+		err = returnCodeError(returnCode, "RpcAddPrinterDriverEx")
+		log.Errorln(err)
+	}
+	return
+}
@@ -0,0 +1,87 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package msrprn
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"testing"
+)
+
+func TestRpcAddPrinterDriverExReq(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("000000000200000002000000000002000300000001000200020002000300020004000200050002000c000000000000000c0000005400650073007400200044007200690076006500720000000c000000000000000c000000570069006e0064006f0077007300200078003600340000002b000000000000002b00000043003a005c00570069006e0064006f00770073005c00530079007300740065006d00330032005c00440072006900760065007200530074006f00720065005c0075006e0069006400720076002e0064006c006c000000000010000000000000001000000043003a005c006400720076005c0064006100740061002e0067007000640000002d000000000000002d00000043003a005c00570069006e0064006f00770073005c00530079007300740065006d00330032005c00440072006900760065007200530074006f00720065005c0075006e006900640072007600750069002e0064006c006c000000000014800000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := RpcAddPrinterDriverExReq{
+		Level: 2,
+		DriverInfo: &DriverInfo{
+			Version:     3,
+			Name:        "Test Driver",
+			Environment: EnvironmentX64,
+			DriverPath:  "C:\\Windows\\System32\\DriverStore\\unidrv.dll",
+			DataFile:    "C:\\drv\\data.gpd",
+			ConfigFile:  "C:\\Windows\\System32\\DriverStore\\unidrvui.dll",
+		},
+		FileCopyFlags: APDCopyAllFiles | APDCopyFromDirectory | APDInstallWarnedDriver,
+	}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pkt, buf) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestRpcEnumPrinterDriversRes(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("00000200ba00000004000000180000005a000000720000008a000000a00000004d006900630072006f0073006f00660074002000580050005300200044006f00630075006d0065006e00740020005700720069007400650072002000760034000000570069006e0064006f0077007300200078003600340000006d007800640077006400720076002e0064006c006c00000075006e0069006400720076002e00670070006400000075006e006900640072007600750069002e0064006c006c0000000000ba0000000100000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp RpcEnumPrinterDriversRes
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ReturnCode != ErrorSuccess || resp.Returned != 1 || resp.Needed != 0xba {
+		t.Fatal("Fail")
+	}
+	drivers, err := ParseDriverInfo(resp.Drivers, 2, resp.Returned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drivers) != 1 {
+		t.Fatal("Fail")
+	}
+	d := drivers[0]
+	if d.Version != 4 || d.Name != "Microsoft XPS Document Writer v4" || d.Environment != EnvironmentX64 {
+		t.Fatal("Fail")
+	}
+	if d.DriverPath != "mxdwdrv.dll" || d.DataFile != "unidrv.gpd" || d.ConfigFile != "unidrvui.dll" {
+		t.Fatal("Fail")
+	}
+}
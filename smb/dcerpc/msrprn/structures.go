@@ -0,0 +1,304 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// The marshal/unmarshal of requests and responses according to the NDR syntax
+// has been implemented on a per RPC request basis and not in any complete way.
+// As such, for each new functionality, a manual marshal and unmarshal method
+// has to be written for the relevant messages. This makes it a bit easier to
+// define the message structs but more of the heavy lifting has to be performed
+// by the marshal/unmarshal functions.
+
+package msrprn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+)
+
+type RPCCon struct {
+	*dcerpc.ServiceBind
+}
+
+// DriverInfo holds the fields of DRIVER_INFO_1 and DRIVER_INFO_2. Only Name
+// is set for level 1.
+type DriverInfo struct {
+	Version     uint32
+	Name        string
+	Environment string
+	DriverPath  string
+	DataFile    string
+	ConfigFile  string
+}
+
+/*
+DWORD RpcEnumPrinterDrivers(
+[in, string, unique] STRING_HANDLE pName,
+[in, string, unique] wchar_t* pEnvironment,
+[in] DWORD Level,
+[in, out, unique, size_is(cbBuf), disable_consistency_check] BYTE* pDrivers,
+[in] DWORD cbBuf,
+[out] DWORD* pcbNeeded,
+[out] DWORD* pcReturned
+);
+*/
+type RpcEnumPrinterDriversReq struct {
+	Name        string
+	Environment string
+	Level       uint32
+	BufSize     uint32
+}
+
+type RpcEnumPrinterDriversRes struct {
+	Drivers    []byte
+	Needed     uint32
+	Returned   uint32
+	ReturnCode uint32
+}
+
+/*
+DWORD RpcAddPrinterDriverEx(
+[in, string, unique] STRING_HANDLE pName,
+[in] DRIVER_CONTAINER* pDriverContainer,
+[in] DWORD dwFileCopyFlags
+);
+*/
+type RpcAddPrinterDriverExReq struct {
+	Name          string
+	Level         uint32 // Only level 2 is supported
+	DriverInfo    *DriverInfo
+	FileCopyFlags uint32
+}
+
+func (self *RpcEnumPrinterDriversReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for RpcEnumPrinterDriversReq")
+	w := bytes.NewBuffer(res)
+	refId := uint32(0x20000)
+
+	_, err = msdtyp.WriteConformantVaryingStringPtr(w, self.Name, &refId, true)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	_, err = msdtyp.WriteConformantVaryingStringPtr(w, self.Environment, &refId, true)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Write(w, le, self.Level)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if self.BufSize > 0 {
+		_, err = msdtyp.WriteConformantArrayPtr(w, make([]byte, self.BufSize), &refId)
+	} else {
+		_, err = w.Write([]byte{0, 0, 0, 0})
+	}
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Write(w, le, self.BufSize)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return w.Bytes(), nil
+}
+
+func (self *RpcEnumPrinterDriversReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of RpcEnumPrinterDriversReq")
+}
+
+func (self *RpcEnumPrinterDriversRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of RpcEnumPrinterDriversRes")
+}
+
+func (self *RpcEnumPrinterDriversRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for RpcEnumPrinterDriversRes")
+	if len(buf) < 16 {
+		return fmt.Errorf("Buffer to small for RpcEnumPrinterDriversRes")
+	}
+	r := bytes.NewReader(buf)
+	var refId uint32
+	err = binary.Read(r, le, &refId)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if refId != 0 {
+		var maxCount uint32
+		err = binary.Read(r, le, &maxCount)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		if int(maxCount)+12 > r.Len() {
+			return fmt.Errorf("Invalid size of pDrivers in RpcEnumPrinterDriversRes")
+		}
+		self.Drivers = make([]byte, maxCount)
+		_, err = io.ReadFull(r, self.Drivers)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		padd := (4 - (int(maxCount) % 4)) % 4
+		_, err = r.Seek(int64(padd), io.SeekCurrent)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	err = binary.Read(r, le, &self.Needed)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Read(r, le, &self.Returned)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Read(r, le, &self.ReturnCode)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return
+}
+
+func (self *RpcAddPrinterDriverExReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for RpcAddPrinterDriverExReq")
+	if self.Level != 2 {
+		return nil, fmt.Errorf("Only level 2 is supported for RpcAddPrinterDriverEx")
+	}
+	if self.DriverInfo == nil {
+		return nil, fmt.Errorf("DriverInfo cannot be nil")
+	}
+	w := bytes.NewBuffer(res)
+	refId := uint32(0x20000)
+
+	_, err = msdtyp.WriteConformantVaryingStringPtr(w, self.Name, &refId, true)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	// DRIVER_CONTAINER with the Level, the union discriminant and a ptr to
+	// RPC_DRIVER_INFO_2
+	info := self.DriverInfo
+	fixed := []uint32{self.Level, self.Level, refId, info.Version}
+	refId++
+	strs := []string{info.Name, info.Environment, info.DriverPath, info.DataFile, info.ConfigFile}
+	for _, s := range strs {
+		if s == "" {
+			fixed = append(fixed, 0)
+			continue
+		}
+		fixed = append(fixed, refId)
+		refId++
+	}
+	err = binary.Write(w, le, fixed)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	for _, s := range strs {
+		if s == "" {
+			continue
+		}
+		_, err = msdtyp.WriteConformantVaryingString(w, s, true)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+
+	err = binary.Write(w, le, self.FileCopyFlags)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return w.Bytes(), nil
+}
+
+func (self *RpcAddPrinterDriverExReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of RpcAddPrinterDriverExReq")
+}
+
+// ParseDriverInfo parses count custom marshaled DRIVER_INFO_1 or
+// DRIVER_INFO_2 structures (MS-RPRN Section 2.2.2.4) where each string is
+// referenced by an offset relative to the start of its structure.
+func ParseDriverInfo(buf []byte, level, count uint32) (drivers []DriverInfo, err error) {
+	size := 4
+	if level == 2 {
+		size = 24
+	} else if level != 1 {
+		return nil, fmt.Errorf("Only levels 1 and 2 are supported")
+	}
+	if uint64(count)*uint64(size) > uint64(len(buf)) {
+		return nil, fmt.Errorf("Buffer to small for %d DRIVER_INFO_%d structures", count, level)
+	}
+	for i := 0; i < int(count); i++ {
+		base := i * size
+		var d DriverInfo
+		if level == 1 {
+			d.Name, err = readOffsetString(buf, base, le.Uint32(buf[base:]))
+			if err != nil {
+				return nil, err
+			}
+			drivers = append(drivers, d)
+			continue
+		}
+		d.Version = le.Uint32(buf[base:])
+		fields := []*string{&d.Name, &d.Environment, &d.DriverPath, &d.DataFile, &d.ConfigFile}
+		for j, field := range fields {
+			*field, err = readOffsetString(buf, base, le.Uint32(buf[base+4+j*4:]))
+			if err != nil {
+				return nil, err
+			}
+		}
+		drivers = append(drivers, d)
+	}
+	return
+}
+
+// readOffsetString reads a null terminated UTF-16LE string at base+offset
+func readOffsetString(buf []byte, base int, offset uint32) (s string, err error) {
+	if offset == 0 {
+		return
+	}
+	start := base + int(offset)
+	if start >= len(buf) {
+		return "", fmt.Errorf("Invalid string offset in DRIVER_INFO structure")
+	}
+	end := start
+	for end+1 < len(buf) && (buf[end] != 0 || buf[end+1] != 0) {
+		end += 2
+	}
+	return msdtyp.FromUnicodeString(buf[start:end])
+}
@@ -0,0 +1,125 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package msrrp
+
+import (
+	"fmt"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+// Control flags of the DACL that must survive a rewrite of the DACL
+const daclControlFlags = msdtyp.SecurityDescriptorFlagDI | msdtyp.SecurityDescriptorFlagPD
+
+// GrantAccess adds an access allowed ACE for the SID to the DACL of the key
+// at the given path. If the DACL already has an explicit access allowed ACE
+// for the SID with the same flags, the mask is added to that ACE instead.
+// aceFlags controls inheritance of the ACE to subkeys, e.g.
+// msdtyp.ContainerInheritAce. Inherited ACEs are left untouched.
+func (c *Client) GrantAccess(path, sid string, mask uint32, aceFlags byte) (err error) {
+	ace, err := NewAce(sid, mask, msdtyp.AccessAllowedAceType, aceFlags&^msdtyp.InheritedAce)
+	if err != nil {
+		return
+	}
+	return c.updateDacl(path, func(dacl []msdtyp.ACE) []msdtyp.ACE {
+		return grantAce(dacl, *ace)
+	})
+}
+
+// RevokeAccess removes all explicit ACEs for the SID from the DACL of the key
+// at the given path. ACEs inherited from a parent key are not affected.
+func (c *Client) RevokeAccess(path, sid string) (err error) {
+	s, err := msdtyp.ConvertStrToSID(sid)
+	if err != nil {
+		return
+	}
+	return c.updateDacl(path, func(dacl []msdtyp.ACE) []msdtyp.ACE {
+		return revokeAces(dacl, s)
+	})
+}
+
+// SetOwner changes the owner of the key at the given path. The key must be
+// opened with WRITE_OWNER access, which usually requires the
+// SeTakeOwnershipPrivilege or SeRestorePrivilege unless the SID is the caller.
+func (c *Client) SetOwner(path, sid string) (err error) {
+	owner, err := msdtyp.ConvertStrToSID(sid)
+	if err != nil {
+		return
+	}
+	hKey, err := c.OpenKey(path)
+	if err != nil {
+		return
+	}
+	sd, err := NewSecurityDescriptor(msdtyp.SecurityDescriptorFlagSR, owner, nil, nil, nil)
+	if err != nil {
+		return
+	}
+	return c.rpc.SetKeySecurity(hKey, sd)
+}
+
+// Read the DACL of the key, apply fn to the ACEs and write the result back
+// along with the inheritance related control flags of the original DACL.
+func (c *Client) updateDacl(path string, fn func([]msdtyp.ACE) []msdtyp.ACE) (err error) {
+	hKey, err := c.OpenKey(path)
+	if err != nil {
+		return
+	}
+	sd, err := c.rpc.GetKeySecurityExt(hKey, DACLSecurityInformation)
+	if err != nil {
+		return
+	}
+	var aces []msdtyp.ACE
+	if sd.Dacl != nil {
+		aces = sd.Dacl.ACLS
+	} else if sd.Control&msdtyp.SecurityDescriptorFlagDP == 0 {
+		// A missing DACL grants everyone full access, so editing it would
+		// restrict access to the listed SIDs only
+		err = fmt.Errorf("Key (%s) has no DACL", path)
+		return
+	}
+	newSd, err := NewSecurityDescriptor(msdtyp.SecurityDescriptorFlagSR|sd.Control&daclControlFlags, nil, nil, NewACL(fn(aces)), nil)
+	if err != nil {
+		return
+	}
+	return c.rpc.SetKeySecurity(hKey, newSd)
+}
+
+// Add an access allowed ACE in canonical position of the DACL, or merge it
+// into an existing explicit ACE for the same SID and flags
+func grantAce(dacl []msdtyp.ACE, ace msdtyp.ACE) []msdtyp.ACE {
+	for i := range dacl {
+		if !dacl[i].IsInherited() && dacl[i].Header.Type == ace.Header.Type && dacl[i].Header.Flags == ace.Header.Flags && dacl[i].Sid.Equal(&ace.Sid) {
+			dacl[i].Mask |= ace.Mask
+			return dacl
+		}
+	}
+	acl := msdtyp.NewPACL(dacl)
+	acl.InsertACE(ace)
+	return acl.ACLS
+}
+
+// Remove the explicit ACEs of the SID
+func revokeAces(dacl []msdtyp.ACE, sid *msdtyp.SID) []msdtyp.ACE {
+	acl := msdtyp.NewPACL(dacl)
+	acl.RemoveACEs(sid, true)
+	return acl.ACLS
+}
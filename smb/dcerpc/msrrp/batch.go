@@ -0,0 +1,186 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package msrrp
+
+import (
+	"fmt"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+)
+
+// Max number of values enumerated by EnumValues in a single batch
+const maxBatchValues = 1 << 20
+
+// Result of a single value query in QueryValues
+type QueryValueResult struct {
+	Name string
+	Type uint32
+	Data []byte
+	Err  error
+}
+
+// QueryValues queries the named values of a key using a single batch of
+// pipelined requests instead of one round trip per value. Values that are
+// larger than the initial buffer are queried again one by one.
+func (r *RPCCon) QueryValues(hKey []byte, names []string) (results []QueryValueResult, err error) {
+	log.Debugln("In QueryValues")
+	reqs := make([]dcerpc.BatchRequest, len(names))
+	for i, name := range names {
+		name = msdtyp.NullTerminate(name)
+		req := BaseRegQueryValueReq{
+			HKey:      hKey,
+			ValueName: RRPUnicodeStr{MaxLength: uint16(len(name)), S: name},
+			Type:      1024,
+			MaxLen:    1024,
+		}
+		reqs[i].Opnum = BaseRegQueryValue
+		reqs[i].Buffer, err = req.MarshalBinary()
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+
+	responses, err := r.MakeBatchRequest(reqs)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	results = make([]QueryValueResult, len(names))
+	for i, response := range responses {
+		results[i].Name = names[i]
+		if response.Err != nil {
+			results[i].Err = response.Err
+			continue
+		}
+		res := BaseRegQueryValueRes{}
+		err = res.UnmarshalBinary(response.Buffer)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		switch res.ReturnCode {
+		case ErrorSuccess:
+			results[i].Type = res.Type
+			results[i].Data = res.Data
+		case ErrorMoreData:
+			results[i].Data, results[i].Type, results[i].Err = r.QueryValue2(hKey, names[i])
+		default:
+			results[i].Err = returnCodeError(res.ReturnCode, "BaseRegQueryValue")
+		}
+	}
+	return
+}
+
+// EnumValues returns all values of a key like GetKeyValues, but enumerates
+// them using a single batch of pipelined requests.
+func (r *RPCCon) EnumValues(hKey []byte) (items []ValueInfo, err error) {
+	log.Debugln("In EnumValues")
+	info, err := r.QueryKeyInfo(hKey)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	// Every value costs a request so don't trust the server with the count
+	if info.Values > maxBatchValues {
+		err = fmt.Errorf("Key reports %d values which exceeds the batch limit of %d", info.Values, maxBatchValues)
+		log.Errorln(err)
+		return
+	}
+	reqs := make([]dcerpc.BatchRequest, info.Values)
+	for i := range reqs {
+		req := BaseRegEnumValueReq{
+			HKey:    hKey,
+			Index:   uint32(i),
+			NameIn:  RRPUnicodeStr{MaxLength: 4096},
+			Type:    1024,
+			MaxLen:  4096,
+			DataLen: 0,
+		}
+		reqs[i].Opnum = BaseRegEnumValue
+		reqs[i].Buffer, err = req.MarshalBinary()
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+
+	responses, err := r.MakeBatchRequest(reqs)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	items = make([]ValueInfo, 0, len(responses))
+	for i, response := range responses {
+		if response.Err != nil {
+			return nil, response.Err
+		}
+		res := BaseRegEnumValueRes{}
+		err = res.UnmarshalBinary(response.Buffer)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		var value *ValueInfo
+		switch res.ReturnCode {
+		case ErrorSuccess:
+			typeName, found := RegValueTypeMap[res.Type]
+			if !found {
+				typeName = "<Unknown>"
+			}
+			value = &ValueInfo{
+				Name:     res.NameOut.S,
+				Type:     res.Type,
+				TypeName: typeName,
+				ValueLen: res.DataLen,
+				Value:    res.Data,
+			}
+		case ErrorMoreData:
+			value, err = r.EnumValue(hKey, uint32(i))
+			if err != nil {
+				return
+			}
+		case ErrorNoMoreItems:
+			// Values were deleted while enumerating
+			return
+		default:
+			err = returnCodeError(res.ReturnCode, "BaseRegEnumValue")
+			log.Errorln(err)
+			return
+		}
+		value.Name = msdtyp.StripNullByte(value.Name)
+		items = append(items, *value)
+	}
+	return
+}
+
+func returnCodeError(code uint32, call string) error {
+	status, found := ReturnCodeMap[code]
+	if !found {
+		return fmt.Errorf("Received unknown return code in %s response: 0x%x", call, code)
+	}
+	return status
+}
@@ -0,0 +1,82 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package msrrp
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// Keys under HKLM\SYSTEM\CurrentControlSet\Control\Lsa whose class names hold
+// the scrambled boot key, in order
+var BootKeyClassKeys = []string{"JD", "Skew1", "GBG", "Data"}
+
+var bootKeyPermutation = []int{8, 5, 4, 2, 11, 9, 13, 3, 0, 6, 1, 12, 14, 10, 15, 7}
+
+// BootKeyFromClassNames derives the boot key (syskey) from the hex encoded
+// class names of the JD, Skew1, GBG and Data keys.
+func BootKeyFromClassNames(classNames []string) (bootKey []byte, err error) {
+	if len(classNames) != len(BootKeyClassKeys) {
+		err = fmt.Errorf("Expected %d class names to derive the boot key, got %d", len(BootKeyClassKeys), len(classNames))
+		return
+	}
+	scrambled := make([]byte, 0, 16)
+	for i, name := range classNames {
+		var b []byte
+		b, err = hex.DecodeString(name)
+		if err != nil || len(b) != 4 {
+			err = fmt.Errorf("Invalid class name (%s) of Lsa\\%s key", name, BootKeyClassKeys[i])
+			return
+		}
+		scrambled = append(scrambled, b...)
+	}
+	bootKey = make([]byte, 16)
+	for i, j := range bootKeyPermutation {
+		bootKey[i] = scrambled[j]
+	}
+	return
+}
+
+// GetBootKey reads the class names of the JD, Skew1, GBG and Data keys under
+// HKLM\SYSTEM\CurrentControlSet\Control\Lsa and derives the boot key used to
+// protect the SAM and LSA secrets.
+func (c *Client) GetBootKey() (bootKey []byte, err error) {
+	classNames := make([]string, 0, len(BootKeyClassKeys))
+	for _, name := range BootKeyClassKeys {
+		path := "HKLM\\SYSTEM\\CurrentControlSet\\Control\\Lsa\\" + name
+		var hKey []byte
+		hKey, err = c.OpenKey(path)
+		if err != nil {
+			log.Errorf("Failed to open %s: %s\n", path, err)
+			return
+		}
+		var info *KeyInfo
+		info, err = c.rpc.QueryKeyInfo(hKey)
+		c.CloseKey(path)
+		if err != nil {
+			log.Errorf("Failed to query class name of %s: %s\n", path, err)
+			return
+		}
+		classNames = append(classNames, info.ClassName)
+	}
+	return BootKeyFromClassNames(classNames)
+}
@@ -0,0 +1,424 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package msrrp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+)
+
+// Names accepted as the first component of a registry path
+var rootKeyNames = map[string]byte{
+	"HKCR":                     HKEYClassesRoot,
+	"HKEY_CLASSES_ROOT":        HKEYClassesRoot,
+	"HKCU":                     HKEYCurrentUser,
+	"HKEY_CURRENT_USER":        HKEYCurrentUser,
+	"HKLM":                     HKEYLocalMachine,
+	"HKEY_LOCAL_MACHINE":       HKEYLocalMachine,
+	"HKU":                      HKEYUsers,
+	"HKEY_USERS":               HKEYUsers,
+	"HKCC":                     HKEYCurrentConfig,
+	"HKEY_CURRENT_CONFIG":      HKEYCurrentConfig,
+	"HKPD":                     HKEYPerformanceData,
+	"HKEY_PERFORMANCE_DATA":    HKEYPerformanceData,
+	"HKPT":                     HKEYPerformanceText,
+	"HKEY_PERFORMANCE_TEXT":    HKEYPerformanceText,
+	"HKPN":                     HKEYPerformanceNlsText,
+	"HKEY_PERFORMANCE_NLSTEXT": HKEYPerformanceNlsText,
+}
+
+var RootKeyNameMap = map[byte]string{
+	HKEYClassesRoot:        "HKCR",
+	HKEYCurrentUser:        "HKCU",
+	HKEYLocalMachine:       "HKLM",
+	HKEYUsers:              "HKU",
+	HKEYCurrentConfig:      "HKCC",
+	HKEYPerformanceData:    "HKPD",
+	HKEYPerformanceText:    "HKPT",
+	HKEYPerformanceNlsText: "HKPN",
+}
+
+// Client is a path based wrapper around the RPCCon that keeps track of the
+// key handles it opens. Root keys are opened on first use and every handle is
+// cached until Close is called, so repeated operations on the same key only
+// cost a single round trip.
+type Client struct {
+	rpc   *RPCCon
+	view  uint32
+	roots map[byte][]byte
+	keys  map[string]map[uint32][]byte // Handles by path and desired access
+}
+
+func NewClient(sb *dcerpc.ServiceBind) *Client {
+	return &Client{
+		rpc:   NewRPCCon(sb),
+		roots: make(map[byte][]byte),
+		keys:  make(map[string]map[uint32][]byte),
+	}
+}
+
+// SetView selects the registry view used by all path based methods on x64
+// servers. Use PermKeyWow6464Key for the 64-bit view, PermKeyWow6432Key for
+// the 32-bit view or 0 for the default view of the registry service, which is
+// the 64-bit view on x64 servers.
+func (c *Client) SetView(view uint32) error {
+	if view != 0 && view != PermKeyWow6464Key && view != PermKeyWow6432Key {
+		return fmt.Errorf("Invalid registry view 0x%x", view)
+	}
+	c.view = view
+	return nil
+}
+
+// RPCCon gives access to the opnum level API for operations not covered by
+// the Client, e.g. using a handle returned by OpenKey.
+func (c *Client) RPCCon() *RPCCon {
+	return c.rpc
+}
+
+// ParseKeyPath splits a path such as "HKLM\SYSTEM\CurrentControlSet" into
+// the root key and the path of the subkey relative to it.
+func ParseKeyPath(path string) (root byte, subkey string, err error) {
+	path = strings.Trim(strings.ReplaceAll(path, "/", "\\"), "\\")
+	rootName, subkey, _ := strings.Cut(path, "\\")
+	root, found := rootKeyNames[strings.ToUpper(rootName)]
+	if !found {
+		err = fmt.Errorf("Unknown root key (%s) in registry path", rootName)
+		return
+	}
+	subkey = strings.Trim(subkey, "\\")
+	return
+}
+
+// Cache key for a path. Registry key names are case insensitive.
+func cacheKey(root byte, subkey string) string {
+	return fmt.Sprintf("%d\\%s", root, strings.ToLower(subkey))
+}
+
+func (c *Client) openRoot(root byte) (handle []byte, err error) {
+	if handle, found := c.roots[root]; found {
+		return handle, nil
+	}
+	handle, err = c.rpc.OpenBaseKey(root)
+	if err != nil {
+		return
+	}
+	c.roots[root] = handle
+	return
+}
+
+// OpenKey returns a handle to the key at the given path in the view selected
+// by SetView. The handle is owned by the Client and must not be closed by the
+// caller.
+func (c *Client) OpenKey(path string) (handle []byte, err error) {
+	return c.OpenKeyExt(path, PermMaximumAllowed|c.view)
+}
+
+// OpenKeyExt is like OpenKey but opens the key with the given desired access,
+// which may include PermKeyWow6464Key or PermKeyWow6432Key to select a view.
+func (c *Client) OpenKeyExt(path string, desiredAccess uint32) (handle []byte, err error) {
+	if desiredAccess == 0 {
+		desiredAccess = PermMaximumAllowed
+	}
+	root, subkey, err := ParseKeyPath(path)
+	if err != nil {
+		return
+	}
+	hRoot, err := c.openRoot(root)
+	if err != nil || subkey == "" {
+		return hRoot, err
+	}
+	key := cacheKey(root, subkey)
+	if handle, found := c.keys[key][desiredAccess]; found {
+		return handle, nil
+	}
+	handle, err = c.rpc.OpenSubKeyExt(hRoot, subkey, 0, desiredAccess)
+	if err != nil {
+		return
+	}
+	c.cacheHandle(key, desiredAccess, handle)
+	return
+}
+
+func (c *Client) cacheHandle(key string, desiredAccess uint32, handle []byte) {
+	if c.keys[key] == nil {
+		c.keys[key] = make(map[uint32][]byte)
+	}
+	c.keys[key][desiredAccess] = handle
+}
+
+func (c *Client) closeHandles(key string) (err error) {
+	for _, handle := range c.keys[key] {
+		if e := c.rpc.CloseKeyHandle(handle); e != nil && err == nil {
+			err = e
+		}
+	}
+	delete(c.keys, key)
+	return
+}
+
+// CloseKey releases the cached handle of the key at the given path and of any
+// of its subkeys.
+func (c *Client) CloseKey(path string) (err error) {
+	root, subkey, err := ParseKeyPath(path)
+	if err != nil {
+		return
+	}
+	key := cacheKey(root, subkey)
+	prefix := key + "\\"
+	if subkey == "" {
+		prefix = key
+	}
+	for k := range c.keys {
+		if k == key || strings.HasPrefix(k, prefix) {
+			if e := c.closeHandles(k); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return
+}
+
+// Close releases all handles opened by the Client. The underlying
+// ServiceBind is left open.
+func (c *Client) Close() (err error) {
+	for k := range c.keys {
+		if e := c.closeHandles(k); e != nil && err == nil {
+			err = e
+		}
+	}
+	for k, handle := range c.roots {
+		delete(c.roots, k)
+		if e := c.rpc.CloseKeyHandle(handle); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// CreateKey creates the key at the given path in the view selected by
+// SetView, including any missing parent keys, and reports whether the key was
+// newly created.
+func (c *Client) CreateKey(path string) (created bool, err error) {
+	return c.CreateKeyExt(path, PermMaximumAllowed|c.view)
+}
+
+// CreateKeyExt is like CreateKey but creates the key with the given desired
+// access, which may include PermKeyWow6464Key or PermKeyWow6432Key to select a
+// view.
+func (c *Client) CreateKeyExt(path string, desiredAccess uint32) (created bool, err error) {
+	if desiredAccess == 0 {
+		desiredAccess = PermMaximumAllowed
+	}
+	root, subkey, err := ParseKeyPath(path)
+	if err != nil {
+		return
+	}
+	if subkey == "" {
+		err = fmt.Errorf("Can't create a root key")
+		return
+	}
+	hRoot, err := c.openRoot(root)
+	if err != nil {
+		return
+	}
+	handle, disposition, err := c.rpc.CreateKey(hRoot, subkey, "", 0, desiredAccess, nil)
+	if err != nil {
+		return
+	}
+	key := cacheKey(root, subkey)
+	if _, found := c.keys[key][desiredAccess]; found {
+		c.rpc.CloseKeyHandle(handle)
+	} else {
+		c.cacheHandle(key, desiredAccess, handle)
+	}
+	return disposition == RegCreatedNewKey, nil
+}
+
+// DeleteKey deletes the key at the given path. The key must not have any
+// subkeys.
+func (c *Client) DeleteKey(path string) (err error) {
+	root, subkey, err := ParseKeyPath(path)
+	if err != nil {
+		return
+	}
+	if subkey == "" {
+		err = fmt.Errorf("Can't delete a root key")
+		return
+	}
+	parent, name := "", subkey
+	if i := strings.LastIndex(subkey, "\\"); i >= 0 {
+		parent, name = subkey[:i], subkey[i+1:]
+	}
+	err = c.CloseKey(path)
+	if err != nil {
+		return
+	}
+	hParent, err := c.OpenKey(RootKeyNameMap[root] + "\\" + parent)
+	if err != nil {
+		return
+	}
+	return c.rpc.DeleteKey(hParent, name)
+}
+
+func (c *Client) DeleteValue(path, name string) (err error) {
+	hKey, err := c.OpenKey(path)
+	if err != nil {
+		return
+	}
+	return c.rpc.DeleteValue(hKey, name)
+}
+
+// GetValue returns the decoded data and type of a value. See QueryValueExt
+// for the Go types used for each registry value type.
+func (c *Client) GetValue(path, name string) (value any, dataType uint32, err error) {
+	hKey, err := c.OpenKey(path)
+	if err != nil {
+		return
+	}
+	return c.rpc.QueryValueExt(hKey, name)
+}
+
+func valueTypeError(path, name string, dataType uint32, expected string) error {
+	typeName, found := RegValueTypeMap[dataType]
+	if !found {
+		typeName = "<Unknown>"
+	}
+	return fmt.Errorf("Registry value (%s\\%s) is of type %s and not %s", path, name, typeName, expected)
+}
+
+// GetStringValue returns a REG_SZ or REG_EXPAND_SZ value. Environment
+// variables in REG_EXPAND_SZ values are not expanded.
+func (c *Client) GetStringValue(path, name string) (s string, err error) {
+	value, dataType, err := c.GetValue(path, name)
+	if err != nil {
+		return
+	}
+	if dataType != RegSz && dataType != RegExpandSz {
+		err = valueTypeError(path, name, dataType, "a string")
+		return
+	}
+	return value.(string), nil
+}
+
+func (c *Client) GetMultiStringValue(path, name string) (items []string, err error) {
+	value, dataType, err := c.GetValue(path, name)
+	if err != nil {
+		return
+	}
+	if dataType != RegMultiSz {
+		err = valueTypeError(path, name, dataType, "a multi string")
+		return
+	}
+	return value.([]string), nil
+}
+
+func (c *Client) GetDWordValue(path, name string) (d uint32, err error) {
+	value, dataType, err := c.GetValue(path, name)
+	if err != nil {
+		return
+	}
+	if dataType != RegDword && dataType != RegDwordBigEndian {
+		err = valueTypeError(path, name, dataType, "a DWORD")
+		return
+	}
+	return value.(uint32), nil
+}
+
+func (c *Client) GetQWordValue(path, name string) (q uint64, err error) {
+	value, dataType, err := c.GetValue(path, name)
+	if err != nil {
+		return
+	}
+	if dataType != RegQword {
+		err = valueTypeError(path, name, dataType, "a QWORD")
+		return
+	}
+	return value.(uint64), nil
+}
+
+// GetValues queries several values of the key at the given path in a single
+// batch of pipelined requests. See RPCCon.QueryValues.
+func (c *Client) GetValues(path string, names []string) (results []QueryValueResult, err error) {
+	hKey, err := c.OpenKey(path)
+	if err != nil {
+		return
+	}
+	return c.rpc.QueryValues(hKey, names)
+}
+
+// GetBinaryValue returns the raw data of a value regardless of its type.
+func (c *Client) GetBinaryValue(path, name string) (data []byte, err error) {
+	hKey, err := c.OpenKey(path)
+	if err != nil {
+		return
+	}
+	data, _, err = c.rpc.QueryValue2(hKey, name)
+	return
+}
+
+// SetValue sets a value of the key at the given path. See RPCCon.SetValue for
+// the Go types expected for each registry value type.
+func (c *Client) SetValue(path, name string, value any, dataType uint32) (err error) {
+	hKey, err := c.OpenKey(path)
+	if err != nil {
+		return
+	}
+	return c.rpc.SetValue(hKey, name, value, dataType)
+}
+
+// FlushKey writes all changes of the key at the given path to disk on the
+// server.
+func (c *Client) FlushKey(path string) (err error) {
+	hKey, err := c.OpenKey(path)
+	if err != nil {
+		return
+	}
+	return c.rpc.FlushKey(hKey)
+}
+
+// GetVersion returns the version of the registry server using the handle of
+// the key at the given path.
+func (c *Client) GetVersion(path string) (version uint32, err error) {
+	hKey, err := c.OpenKey(path)
+	if err != nil {
+		return
+	}
+	return c.rpc.GetVersion(hKey)
+}
+
+func (c *Client) SubKeyNames(path string) (names []string, err error) {
+	hKey, err := c.OpenKey(path)
+	if err != nil {
+		return
+	}
+	return c.rpc.GetSubKeyNames(hKey, "")
+}
+
+func (c *Client) ValueNames(path string) (names []string, err error) {
+	hKey, err := c.OpenKey(path)
+	if err != nil {
+		return
+	}
+	return c.rpc.GetValueNames(hKey)
+}
@@ -0,0 +1,116 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package msrrp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+// Access mask used to open keys for BaseRegSaveKey (KEY_READ)
+const permKeyRead = PermReadControl | PermKeyQueryValue | PermKeyEnumerateSubKeys | PermKeyNotify
+
+// CleanupError is returned by SaveHive and SaveHiveExt together with the
+// downloaded hive when the saved file could not be deleted from the server.
+// The hive data is complete and the file has to be removed by other means.
+type CleanupError struct {
+	Share string
+	Path  string
+	Err   error
+}
+
+func (self *CleanupError) Error() string {
+	return fmt.Sprintf("Failed to delete saved hive %s\\%s: %s", self.Share, self.Path, self.Err)
+}
+
+func (self *CleanupError) Unwrap() error {
+	return self.Err
+}
+
+// SaveHive saves the key at the given path, e.g. HKLM\SAM, to a randomly
+// named file in the Windows temp directory of the server, downloads it over
+// the ADMIN$ share of conn and then deletes the remote file. The returned
+// bytes are the raw registry hive file.
+func (c *Client) SaveHive(conn *smb.Connection, path string) (data []byte, err error) {
+	buf := make([]byte, 8)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return
+	}
+	name := hex.EncodeToString(buf) + ".tmp"
+
+	// Relative paths given to BaseRegSaveKey are resolved from the System32
+	// directory of the server
+	return c.SaveHiveExt(conn, path, "..\\Temp\\"+name, smb.ShareAdmin, "Temp\\"+name)
+}
+
+// SaveHiveExt saves the key at the given path to filename as seen by the
+// server, downloads it from sharePath on share and then deletes the file. The
+// remote file is removed even if the download fails. If only the removal
+// fails, the hive is returned along with a *CleanupError.
+func (c *Client) SaveHiveExt(conn *smb.Connection, path, filename, share, sharePath string) (data []byte, err error) {
+	root, subkey, err := ParseKeyPath(path)
+	if err != nil {
+		return
+	}
+	hRoot, err := c.openRoot(root)
+	if err != nil {
+		return
+	}
+	hKey := hRoot
+	if subkey != "" {
+		hKey, err = c.rpc.OpenSubKeyExt(hRoot, subkey, RegOptionBackupRestore, permKeyRead|c.view)
+		if err != nil {
+			return
+		}
+		defer c.rpc.CloseKeyHandle(hKey)
+	}
+
+	err = c.rpc.RegSaveKey(hKey, filename, "")
+	if err != nil {
+		err = fmt.Errorf("Failed to save %s to %s: %s", path, filename, err)
+		log.Errorln(err)
+		return
+	}
+	defer func() {
+		e := conn.DeleteFile(share, sharePath)
+		if e != nil {
+			e = &CleanupError{Share: share, Path: sharePath, Err: e}
+			log.Errorln(e)
+			if err == nil {
+				err = e
+			}
+		}
+	}()
+
+	var b bytes.Buffer
+	err = conn.RetrieveFile(share, sharePath, 0, b.Write)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return b.Bytes(), nil
+}
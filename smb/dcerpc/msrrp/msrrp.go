@@ -53,6 +53,13 @@ const (
 
 const PermKeyNotify uint32 = 0x00000010
 
+// Upper bound of the capacity preallocated from counts reported by the server
+const maxPreallocCount = 1024
+
+// MaxValueSize limits the size of registry values requested from the server
+// when it reports that a value does not fit in the initial buffer
+var MaxValueSize = 16 * 1024 * 1024
+
 // MS-DTYP Section 2.4.3 ACCESS_MASK
 const (
 	PermGenericRead          uint32 = 0x80000000
@@ -119,39 +126,45 @@ var RegValueTypeMap = map[uint32]string{
 
 // MS-RRP Section 2.2.6 Common Error Codes
 const (
-	ErrorSuccess            uint32 = 0x00000000 // Error success
-	ErrorFileNotFound       uint32 = 0x00000002
-	ErrorAccessDenied       uint32 = 0x00000005 // Access is denied.
-	ErrorOutOfMemory        uint32 = 0x0000000E // Not enough storage available to complete the operation
-	ErrorWriteProtect       uint32 = 0x00000013 // A read or write operation was attempted on the volume after it was dismounted.
-	ErrorNotReady           uint32 = 0x00000015 // The service is not ready. Calls can be repeated at a later time.
-	ErrorInvalidParameter   uint32 = 0x00000057 // The parameter is incorrect.
-	ErrorCallNotImplemented uint32 = 0x00000078 // The method is not valid.
-	ErrorBadPathName        uint32 = 0x000000A1
-	ErrorBusy               uint32 = 0x000000AA // The requested resource is busy.
-	ErrorAlreadyExists      uint32 = 0x000000B7 // File already exists.
-	ErrorMoreData           uint32 = 0x000000EA // The size of the buffer is not large enough to hold the requested data.
-	WaitTimeout             uint32 = 0x00000102 // The wait operation timed out.
-	ErrorNoMoreItems        uint32 = 0x00000103 // No more data is available
-	ErrorKeyDeleted         uint32 = 0x000003FA // An illegal operation was attempted on a registry key that is pending delete.
+	ErrorSuccess              uint32 = 0x00000000 // Error success
+	ErrorFileNotFound         uint32 = 0x00000002
+	ErrorAccessDenied         uint32 = 0x00000005 // Access is denied.
+	ErrorOutOfMemory          uint32 = 0x0000000E // Not enough storage available to complete the operation
+	ErrorWriteProtect         uint32 = 0x00000013 // A read or write operation was attempted on the volume after it was dismounted.
+	ErrorNotReady             uint32 = 0x00000015 // The service is not ready. Calls can be repeated at a later time.
+	ErrorInvalidParameter     uint32 = 0x00000057 // The parameter is incorrect.
+	ErrorCallNotImplemented   uint32 = 0x00000078 // The method is not valid.
+	ErrorBadPathName          uint32 = 0x000000A1
+	ErrorBusy                 uint32 = 0x000000AA // The requested resource is busy.
+	ErrorAlreadyExists        uint32 = 0x000000B7 // File already exists.
+	ErrorMoreData             uint32 = 0x000000EA // The size of the buffer is not large enough to hold the requested data.
+	WaitTimeout               uint32 = 0x00000102 // The wait operation timed out.
+	ErrorNoMoreItems          uint32 = 0x00000103 // No more data is available
+	ErrorKeyDeleted           uint32 = 0x000003FA // An illegal operation was attempted on a registry key that is pending delete.
+	ErrorShutdownInProgress   uint32 = 0x0000045B // A system shutdown is in progress.
+	ErrorNoShutdownInProgress uint32 = 0x0000045C // Unable to abort the system shutdown because no shutdown was in progress.
+	ErrorPrivilegeNotHeld     uint32 = 0x00000522 // A required privilege is not held by the client.
 )
 
 var ReturnCodeMap = map[uint32]error{
-	ErrorSuccess:            fmt.Errorf("ERROR_SUCCESS"),
-	ErrorFileNotFound:       fmt.Errorf("ERROR_FILE_NOT_FOUND"),
-	ErrorAccessDenied:       fmt.Errorf("ERROR_ACCESS_DENIED"),
-	ErrorOutOfMemory:        fmt.Errorf("ERROR_OUT_OF_MEMORY"),
-	ErrorWriteProtect:       fmt.Errorf("ERROR_WRITE_PROCTED"),
-	ErrorNotReady:           fmt.Errorf("ERROR_NOT_READY"),
-	ErrorInvalidParameter:   fmt.Errorf("ERROR_INVALID_PARAMETER"),
-	ErrorCallNotImplemented: fmt.Errorf("ERROR_CALL_NOT_IMPLEMENTED"),
-	ErrorBadPathName:        fmt.Errorf("ERROR_BAD_PATH_NAME"),
-	ErrorBusy:               fmt.Errorf("ERROR_BUSY"),
-	ErrorAlreadyExists:      fmt.Errorf("ERROR_ALREADY_EXISTS"),
-	ErrorMoreData:           fmt.Errorf("ERROR_MORE_DATA"),
-	WaitTimeout:             fmt.Errorf("WAIT_TIMEOUT"),
-	ErrorNoMoreItems:        fmt.Errorf("ERROR_NO_MORE_ITEMS"),
-	ErrorKeyDeleted:         fmt.Errorf("ERROR_KEY_DELETED"),
+	ErrorSuccess:              fmt.Errorf("ERROR_SUCCESS"),
+	ErrorFileNotFound:         fmt.Errorf("ERROR_FILE_NOT_FOUND"),
+	ErrorAccessDenied:         fmt.Errorf("ERROR_ACCESS_DENIED"),
+	ErrorOutOfMemory:          fmt.Errorf("ERROR_OUT_OF_MEMORY"),
+	ErrorWriteProtect:         fmt.Errorf("ERROR_WRITE_PROCTED"),
+	ErrorNotReady:             fmt.Errorf("ERROR_NOT_READY"),
+	ErrorInvalidParameter:     fmt.Errorf("ERROR_INVALID_PARAMETER"),
+	ErrorCallNotImplemented:   fmt.Errorf("ERROR_CALL_NOT_IMPLEMENTED"),
+	ErrorBadPathName:          fmt.Errorf("ERROR_BAD_PATH_NAME"),
+	ErrorBusy:                 fmt.Errorf("ERROR_BUSY"),
+	ErrorAlreadyExists:        fmt.Errorf("ERROR_ALREADY_EXISTS"),
+	ErrorMoreData:             fmt.Errorf("ERROR_MORE_DATA"),
+	WaitTimeout:               fmt.Errorf("WAIT_TIMEOUT"),
+	ErrorNoMoreItems:          fmt.Errorf("ERROR_NO_MORE_ITEMS"),
+	ErrorKeyDeleted:           fmt.Errorf("ERROR_KEY_DELETED"),
+	ErrorShutdownInProgress:   fmt.Errorf("ERROR_SHUTDOWN_IN_PROGRESS"),
+	ErrorNoShutdownInProgress: fmt.Errorf("ERROR_NO_SHUTDOWN_IN_PROGRESS"),
+	ErrorPrivilegeNotHeld:     fmt.Errorf("ERROR_PRIVILEGE_NOT_HELD"),
 }
 
 // MS-RRP Section 2.2.9 Security information
@@ -164,37 +177,40 @@ const (
 
 // MS-RRP Section 3.1.5. OP Codes
 const (
-	OpenClassesRoot             uint16 = 0  // Called by the client. In response, the server opens the HKEYClassesRoot predefined key and returns a handle to the HKEYClassesRoot key.
-	OpenCurrentUser             uint16 = 1  // Called by the client. In response, the server opens the HKEYCurrentUser predefined key and returns a handle to the HKEYCurrentUser key.
-	OpenLocalMachine            uint16 = 2  // Called by the client. In response, the server opens the HKEYLocalMachine predefined key and returns a handle to the HKEYLocalMachine key.
-	OpenPerformanceData         uint16 = 3  // Called by the client. In response, the server opens the HKEYPerformanceData predefined key and returns a handle to the HKEYPerformanceData key.
-	OpenUsers                   uint16 = 4  // Called by the client. In response, the server opens the HKEYUsers predefined key and returns a handle to the HKEYUsers key.
-	BaseRegCloseKey             uint16 = 5  // Called by the client. In response, the server releases a handle to the specified registry key.
-	BaseRegCreateKey            uint16 = 6  // Called by the client. In response, the server creates the specified registry key. If the key already exists in the registry, the function opens it.
-	BaseRegDeleteKey            uint16 = 7  // Called by the client. In response, the server deletes the specified subkey.
-	BaseRegDeleteValue          uint16 = 8  // Called by the client. In response, the server removes a named value from the specified registry key.
-	BaseRegEnumKey              uint16 = 9  // Called by the client. In response, the server returns the requested subkey.
-	BaseRegEnumValue            uint16 = 10 // Called by the client. In response, the server enumerates the values for the specified open registry key.
-	BaseRegFlushKey             uint16 = 11 // Called by the client. In response, the server writes all the attributes of the specified open registry key into the registry.
-	BaseRegGetKeySecurity       uint16 = 12 // Called by the client. In response, the server returns a copy of the security descriptor that protects the specified open registry key.
-	BaseRegLoadKey              uint16 = 13 // Called by the client. In response, the server creates a subkey under HKEYUsers or HKEYLocalMachine and stores registration information from a specified file in that subkey.
-	BaseRegOpenKey              uint16 = 15 // Called by the client. In response, the server opens the specified key for access, returning a handle to it.
-	BaseRegQueryInfoKey         uint16 = 16 // Called by the client. In response, the server returns relevant information about the key that corresponds to the specified key handle.
-	BaseRegQueryValue           uint16 = 17 // Called by the client. In response, the server returns the data that is associated with the default value of a specified registry open key.
-	BaseRegReplaceKey           uint16 = 18 // Called by the client. In response, the server MUST read the registry information from the specified file and replace the specified key with the content of the file, so that when the system is restarted, the key and subkeys have the same values as those in the specified file.
-	BaseRegRestoreKey           uint16 = 19 // Called by the client. In response, the server reads the registry information in a specified file and copies it over the specified key. The registry information can take the form of a key and multiple levels of subkeys.
-	BaseRegSaveKey              uint16 = 20 // Called by the client. In response, the server saves the specified key and all its subkeys and values to a new file.
-	BaseRegSetKeySecurity       uint16 = 21 // Called by the client. In response, the server sets the security descriptor that protects the specified open registry key.
-	BaseRegSetValue             uint16 = 22 // Called by the client. In response, the server sets the data for the default value of a specified registry key. The data MUST be a text string.
-	BaseRegUnLoadKey            uint16 = 23 // Called by the client. In response, the server removes the specified discrete body of keys, subkeys, and values that are rooted at the top of the registry hierarchy.
-	BaseRegGetVersion           uint16 = 26 // Called by the client. In response, the server returns the version to which a registry key is connected.
-	OpenCurrentConfig           uint16 = 27 // Called by the client. In response, the server attempts to open the HKEY_CURRENT_CONFIG predefined key and returns a handle to the HKEY_CURRENT_CONFIG key.
-	BaseRegQueryMultipleValues  uint16 = 29 // Called by the client. In response, the server returns the type and data for a list of value names that are associated with the specified registry key.
-	BaseRegSaveKeyEx            uint16 = 31 // Called by the client. In response, the server saves the specified key and all its subkeys and values to a new file.
-	OpenPerformanceText         uint16 = 32 // Called by the client. In response, the server opens the HKEY_PERFORMANCE_TEXT predefined key and returns a handle to the HKEY_PERFORMANCE_TEXT key.
-	OpenPerformanceNlsText      uint16 = 33 // Called by the client. In response, the server opens the HKEY_PERFORMANCE_NLSTEXT predefined key and returns a handle to the HKEY_PERFORMANCE_NLSTEXT key.
-	BaseRegQueryMultipleValues2 uint16 = 34 // Called by the client. In response, the server returns the type and data for a list of value names that are associated with the specified registry key.
-	BaseRegDeleteKeyEx          uint16 = 35 // Called by the client. In response, the server deletes the specified subkey. This function differs from BaseRegDeleteKey in that either 32-bit or 64-bit keys can be deleted, regardless of what kind of application is running.
+	OpenClassesRoot              uint16 = 0  // Called by the client. In response, the server opens the HKEYClassesRoot predefined key and returns a handle to the HKEYClassesRoot key.
+	OpenCurrentUser              uint16 = 1  // Called by the client. In response, the server opens the HKEYCurrentUser predefined key and returns a handle to the HKEYCurrentUser key.
+	OpenLocalMachine             uint16 = 2  // Called by the client. In response, the server opens the HKEYLocalMachine predefined key and returns a handle to the HKEYLocalMachine key.
+	OpenPerformanceData          uint16 = 3  // Called by the client. In response, the server opens the HKEYPerformanceData predefined key and returns a handle to the HKEYPerformanceData key.
+	OpenUsers                    uint16 = 4  // Called by the client. In response, the server opens the HKEYUsers predefined key and returns a handle to the HKEYUsers key.
+	BaseRegCloseKey              uint16 = 5  // Called by the client. In response, the server releases a handle to the specified registry key.
+	BaseRegCreateKey             uint16 = 6  // Called by the client. In response, the server creates the specified registry key. If the key already exists in the registry, the function opens it.
+	BaseRegDeleteKey             uint16 = 7  // Called by the client. In response, the server deletes the specified subkey.
+	BaseRegDeleteValue           uint16 = 8  // Called by the client. In response, the server removes a named value from the specified registry key.
+	BaseRegEnumKey               uint16 = 9  // Called by the client. In response, the server returns the requested subkey.
+	BaseRegEnumValue             uint16 = 10 // Called by the client. In response, the server enumerates the values for the specified open registry key.
+	BaseRegFlushKey              uint16 = 11 // Called by the client. In response, the server writes all the attributes of the specified open registry key into the registry.
+	BaseRegGetKeySecurity        uint16 = 12 // Called by the client. In response, the server returns a copy of the security descriptor that protects the specified open registry key.
+	BaseRegLoadKey               uint16 = 13 // Called by the client. In response, the server creates a subkey under HKEYUsers or HKEYLocalMachine and stores registration information from a specified file in that subkey.
+	BaseRegOpenKey               uint16 = 15 // Called by the client. In response, the server opens the specified key for access, returning a handle to it.
+	BaseRegQueryInfoKey          uint16 = 16 // Called by the client. In response, the server returns relevant information about the key that corresponds to the specified key handle.
+	BaseRegQueryValue            uint16 = 17 // Called by the client. In response, the server returns the data that is associated with the default value of a specified registry open key.
+	BaseRegReplaceKey            uint16 = 18 // Called by the client. In response, the server MUST read the registry information from the specified file and replace the specified key with the content of the file, so that when the system is restarted, the key and subkeys have the same values as those in the specified file.
+	BaseRegRestoreKey            uint16 = 19 // Called by the client. In response, the server reads the registry information in a specified file and copies it over the specified key. The registry information can take the form of a key and multiple levels of subkeys.
+	BaseRegSaveKey               uint16 = 20 // Called by the client. In response, the server saves the specified key and all its subkeys and values to a new file.
+	BaseRegSetKeySecurity        uint16 = 21 // Called by the client. In response, the server sets the security descriptor that protects the specified open registry key.
+	BaseRegSetValue              uint16 = 22 // Called by the client. In response, the server sets the data for the default value of a specified registry key. The data MUST be a text string.
+	BaseRegUnLoadKey             uint16 = 23 // Called by the client. In response, the server removes the specified discrete body of keys, subkeys, and values that are rooted at the top of the registry hierarchy.
+	BaseInitiateSystemShutdown   uint16 = 24 // Called by the client. In response, the server initiates a shutdown and optional reboot of the system.
+	BaseAbortSystemShutdown      uint16 = 25 // Called by the client. In response, the server stops a system shutdown that was initiated by BaseInitiateSystemShutdown or BaseInitiateSystemShutdownEx.
+	BaseRegGetVersion            uint16 = 26 // Called by the client. In response, the server returns the version to which a registry key is connected.
+	OpenCurrentConfig            uint16 = 27 // Called by the client. In response, the server attempts to open the HKEY_CURRENT_CONFIG predefined key and returns a handle to the HKEY_CURRENT_CONFIG key.
+	BaseRegQueryMultipleValues   uint16 = 29 // Called by the client. In response, the server returns the type and data for a list of value names that are associated with the specified registry key.
+	BaseInitiateSystemShutdownEx uint16 = 30 // Called by the client. In response, the server initiates a shutdown and optional reboot of the system, recording the reason for the shutdown.
+	BaseRegSaveKeyEx             uint16 = 31 // Called by the client. In response, the server saves the specified key and all its subkeys and values to a new file.
+	OpenPerformanceText          uint16 = 32 // Called by the client. In response, the server opens the HKEY_PERFORMANCE_TEXT predefined key and returns a handle to the HKEY_PERFORMANCE_TEXT key.
+	OpenPerformanceNlsText       uint16 = 33 // Called by the client. In response, the server opens the HKEY_PERFORMANCE_NLSTEXT predefined key and returns a handle to the HKEY_PERFORMANCE_NLSTEXT key.
+	BaseRegQueryMultipleValues2  uint16 = 34 // Called by the client. In response, the server returns the type and data for a list of value names that are associated with the specified registry key.
+	BaseRegDeleteKeyEx           uint16 = 35 // Called by the client. In response, the server deletes the specified subkey. This function differs from BaseRegDeleteKey in that either 32-bit or 64-bit keys can be deleted, regardless of what kind of application is running.
 )
 
 // Enum of base keys
@@ -205,6 +221,8 @@ const (
 	HKEYPerformanceData
 	HKEYUsers
 	HKEYCurrentConfig
+	HKEYPerformanceText
+	HKEYPerformanceNlsText
 )
 
 const (
@@ -217,6 +235,30 @@ const (
 	RegOpenedExistingKey uint32 = 0x02
 )
 
+// Shutdown reason codes for BaseInitiateSystemShutdownEx. A major and a minor
+// reason are combined with the optional flags.
+const (
+	ShutdownReasonMajorOther           uint32 = 0x00000000
+	ShutdownReasonMajorHardware        uint32 = 0x00010000
+	ShutdownReasonMajorOperatingSystem uint32 = 0x00020000
+	ShutdownReasonMajorSoftware        uint32 = 0x00030000
+	ShutdownReasonMajorApplication     uint32 = 0x00040000
+	ShutdownReasonMinorOther           uint32 = 0x00000000
+	ShutdownReasonMinorMaintenance     uint32 = 0x00000001
+	ShutdownReasonMinorInstallation    uint32 = 0x00000002
+	ShutdownReasonMinorUpgrade         uint32 = 0x00000003
+	ShutdownReasonMinorReconfig        uint32 = 0x00000004
+	ShutdownReasonMinorSecurityFix     uint32 = 0x00000012
+	ShutdownReasonFlagPlanned          uint32 = 0x80000000
+)
+
+// MS-RRP Section 3.1.5.30 BaseRegSaveKeyEx Flags
+const (
+	RegStandardFormat uint32 = 0x01 // Save in a format compatible with older versions of Windows
+	RegLatestFormat   uint32 = 0x02 // Save in the latest hive format
+	RegNoCompression  uint32 = 0x04 // Save without compressing the hive
+)
+
 type RPCCon struct {
 	*dcerpc.ServiceBind
 }
@@ -243,6 +285,12 @@ func (r *RPCCon) OpenBaseKey(baseName byte) (handle []byte, err error) {
 		opCode = OpenUsers
 	case HKEYCurrentConfig:
 		opCode = OpenCurrentConfig
+	case HKEYPerformanceData:
+		opCode = OpenPerformanceData
+	case HKEYPerformanceText:
+		opCode = OpenPerformanceText
+	case HKEYPerformanceNlsText:
+		opCode = OpenPerformanceNlsText
 	default:
 		err = fmt.Errorf("NOT Implemented base key!")
 		return
@@ -471,8 +519,9 @@ func (r *RPCCon) EnumKey(hKey []byte, index uint32) (info *KeyInfo, err error) {
 	}
 
 	info = &KeyInfo{
-		KeyName:   res.NameOut.S,
-		ClassName: res.ClassOut.S,
+		KeyName:       res.NameOut.S,
+		ClassName:     res.ClassOut.S,
+		LastWriteTime: res.LastWriteTime.ToTime(),
 	}
 	return
 }
@@ -511,6 +560,11 @@ func (r *RPCCon) EnumValue(hKey []byte, index uint32) (value *ValueInfo, err err
 
 	if res.ReturnCode == ErrorMoreData {
 		log.Debugln("EnumValue failed with ERROR_MORE_DATA. Making another request with a larger buffer.")
+		if res.DataLen > uint32(MaxValueSize) {
+			err = fmt.Errorf("Registry value of %d bytes exceeds the limit of %d bytes", res.DataLen, MaxValueSize)
+			log.Errorln(err)
+			return
+		}
 		// Make another request with the correct buffer size
 		req.MaxLen = res.DataLen
 		reqBuf, err = req.MarshalBinary()
@@ -536,7 +590,9 @@ func (r *RPCCon) EnumValue(hKey []byte, index uint32) (value *ValueInfo, err err
 			log.Debugf("EnumValue failed with ERROR_MORE_DATA. Here is the response: %+v\n", res)
 		}
 		err = ReturnCodeMap[res.ReturnCode]
-		log.Errorf("EnumValue failed with return code: %s\n", err.Error())
+		if res.ReturnCode != ErrorNoMoreItems {
+			log.Errorf("EnumValue failed with return code: %s\n", err.Error())
+		}
 		return
 	}
 
@@ -554,6 +610,38 @@ func (r *RPCCon) EnumValue(hKey []byte, index uint32) (value *ValueInfo, err err
 	return
 }
 
+// Opnum 11
+func (r *RPCCon) FlushKey(hKey []byte) (err error) {
+	req := BaseRegFlushKeyReq{
+		HKey: hKey,
+	}
+
+	log.Debugf("Trying to flush registry key handle (0x%x)\n", hKey)
+	reqBuf, err := req.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := r.MakeIoCtlRequest(BaseRegFlushKey, reqBuf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	if len(buffer) < 4 {
+		err = fmt.Errorf("Response to BaseRegFlushKey was too short")
+		log.Errorln(err)
+		return
+	}
+	returnCode := binary.LittleEndian.Uint32(buffer[:4])
+	if returnCode != ErrorSuccess {
+		err = ReturnCodeMap[returnCode]
+		log.Errorln(err)
+	}
+	return
+}
+
 func NewAce(sidStr string, mask uint32, aceType, aceFlags byte) (ace *msdtyp.ACE, err error) {
 	sid, err := msdtyp.ConvertStrToSID(sidStr)
 	if err != nil {
@@ -707,8 +795,9 @@ func (r *RPCCon) QueryKeyInfo(hKey []byte) (info *KeyInfo, err error) {
 		Values:          res.Values,
 		MaxValueNameLen: res.MaxValueNameLen,
 		MaxValueLen:     res.MaxValueLen,
+		LastWriteTime:   res.LastWriteTime.ToTime(),
 	}
-	info.ClassName = info.ClassName[:len(info.ClassName)-1] // Remove null byte
+	info.ClassName = msdtyp.StripNullByte(info.ClassName) // Remove null byte
 
 	return
 }
@@ -720,6 +809,14 @@ func (r *RPCCon) QueryValueExt(hKey []byte, name string) (result any, dataType u
 		log.Errorln(err)
 		return
 	}
+	result, err = decodeValue(data, dataType)
+	return
+}
+
+// Decode the data of a registry value into a Go type based on the value type.
+// Strings are returned as string, REG_MULTI_SZ as []string, DWORDs as uint32,
+// QWORDs as uint64 and everything else as []byte.
+func decodeValue(data []byte, dataType uint32) (result any, err error) {
 	switch dataType {
 	case RegNone:
 		result = data
@@ -731,7 +828,7 @@ func (r *RPCCon) QueryValueExt(hKey []byte, name string) (result any, dataType u
 			return
 		}
 		// Optionally remove null terminator
-		if s[len(s)-1] == 0x00 {
+		if len(s) > 0 && s[len(s)-1] == 0x00 {
 			s = s[:len(s)-1]
 		}
 		result = s
@@ -773,6 +870,11 @@ func (r *RPCCon) QueryValueExt(hKey []byte, name string) (result any, dataType u
 	return
 }
 
+// Data returns the value decoded the same way as QueryValueExt
+func (v *ValueInfo) Data() (any, error) {
+	return decodeValue(v.Value, v.Type)
+}
+
 func (r *RPCCon) QueryValue2(hKey []byte, name string) (result []byte, dataType uint32, err error) {
 	// If I send the parameter Data (lpData) as nil and the DataLen(lpcbData) and MaxSize(lpcbLen) to 0
 	// The server will respond with the size of the requested value in the lpcbData parameter.
@@ -809,6 +911,11 @@ func (r *RPCCon) QueryValue2(hKey []byte, name string) (result []byte, dataType
 
 	if res.ReturnCode == ErrorMoreData {
 		log.Debugln("EnumValue failed with ERROR_MORE_DATA. Making another request with a larger buffer.")
+		if res.DataLen > uint32(MaxValueSize) {
+			err = fmt.Errorf("Registry value of %d bytes exceeds the limit of %d bytes", res.DataLen, MaxValueSize)
+			log.Errorln(err)
+			return
+		}
 		// Make another request with the correct buffer size
 		req.MaxLen = res.DataLen
 		reqBuf, err = req.MarshalBinary()
@@ -868,52 +975,65 @@ func (r *RPCCon) QueryValueString(hKey []byte, name string) (result string, err
 }
 
 func (r *RPCCon) RegSaveKey(hKey []byte, filename string, owner string) (err error) {
-	var ownerSid *msdtyp.SID
-	var acl *msdtyp.PACL
+	sa, err := newSaveKeySecurityAttributes(owner)
+	if err != nil {
+		return
+	}
+	req := BaseRegSaveKeyReq{
+		HKey:               hKey,
+		FileName:           RRPUnicodeStr{MaxLength: uint16(len(filename)), S: filename},
+		SecurityAttributes: *sa,
+	}
 
-	// If owner is empty, use a default DACL and owner for the registry dump on disk
-	if owner != "" {
-		ownerSid, err = msdtyp.ConvertStrToSID(owner)
-		if err != nil {
-			log.Errorln(err)
-			return
-		}
-		adminMask := PermGenericRead | PermGenericWrite | PermWriteDacl | PermDelete
-		var adminAce *msdtyp.ACE
-		adminAce, err = NewAce(owner, adminMask, msdtyp.AccessAllowedAceType, msdtyp.ContainerInheritAce)
-		if err != nil {
-			log.Errorln(err)
-			return
-		}
-		acl = NewACL([]msdtyp.ACE{*adminAce})
+	log.Debugf("Trying to save reg key to file (%s)\n", filename)
+	reqBuf, err := req.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
 	}
-	sd, err := NewSecurityDescriptor(msdtyp.SecurityDescriptorFlagSR, ownerSid, nil, acl, nil)
+
+	buffer, err := r.MakeIoCtlRequest(BaseRegSaveKey, reqBuf)
+	if err != nil {
+		return
+	}
+
+	res := ReturnCode{}
+	err = res.UnmarshalBinary(buffer)
 	if err != nil {
 		log.Errorln(err)
 		return
 	}
-	rd := RpcSecurityDescriptor{
-		SecurityDescriptor: sd,
+
+	if res.uint32 != ErrorSuccess {
+		err = ReturnCodeMap[res.uint32]
 	}
 
-	sa := &RpcSecurityAttributes{
-		SecurityDescriptor: rd,
-		InheritHandle:      0,
+	return
+}
+
+// Opnum 31
+// Same as RegSaveKey but with flags controlling the format of the saved hive,
+// e.g. RegLatestFormat|RegNoCompression
+func (r *RPCCon) RegSaveKeyEx(hKey []byte, filename string, owner string, flags uint32) (err error) {
+	sa, err := newSaveKeySecurityAttributes(owner)
+	if err != nil {
+		return
 	}
-	req := BaseRegSaveKeyReq{
+	req := BaseRegSaveKeyExReq{
 		HKey:               hKey,
 		FileName:           RRPUnicodeStr{MaxLength: uint16(len(filename)), S: filename},
 		SecurityAttributes: *sa,
+		Flags:              flags,
 	}
 
-	log.Debugf("Trying to save reg key to file (%s)\n", filename)
+	log.Debugf("Trying to save reg key to file (%s) with flags (0x%x)\n", filename, flags)
 	reqBuf, err := req.MarshalBinary()
 	if err != nil {
 		log.Errorln(err)
 		return
 	}
 
-	buffer, err := r.MakeIoCtlRequest(BaseRegSaveKey, reqBuf)
+	buffer, err := r.MakeIoCtlRequest(BaseRegSaveKeyEx, reqBuf)
 	if err != nil {
 		return
 	}
@@ -932,6 +1052,41 @@ func (r *RPCCon) RegSaveKey(hKey []byte, filename string, owner string) (err err
 	return
 }
 
+// Security attributes of the file created by RegSaveKey/RegSaveKeyEx
+func newSaveKeySecurityAttributes(owner string) (sa *RpcSecurityAttributes, err error) {
+	var ownerSid *msdtyp.SID
+	var acl *msdtyp.PACL
+
+	// If owner is empty, use a default DACL and owner for the registry dump on disk
+	if owner != "" {
+		ownerSid, err = msdtyp.ConvertStrToSID(owner)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		adminMask := PermGenericRead | PermGenericWrite | PermWriteDacl | PermDelete
+		var adminAce *msdtyp.ACE
+		adminAce, err = NewAce(owner, adminMask, msdtyp.AccessAllowedAceType, msdtyp.ContainerInheritAce)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		acl = NewACL([]msdtyp.ACE{*adminAce})
+	}
+	sd, err := NewSecurityDescriptor(msdtyp.SecurityDescriptorFlagSR, ownerSid, nil, acl, nil)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	sa = &RpcSecurityAttributes{
+		SecurityDescriptor: RpcSecurityDescriptor{
+			SecurityDescriptor: sd,
+		},
+		InheritHandle: 0,
+	}
+	return
+}
+
 func (r *RPCCon) GetKeySecurity(hKey []byte) (sd *msdtyp.SecurityDescriptor, err error) {
 	return r.GetKeySecurityExt(hKey, OwnerSecurityInformation|GroupSecurityInformation|DACLSecurityInformation)
 }
@@ -1051,7 +1206,7 @@ func (r *RPCCon) GetSubKeyNamesExt(hKey []byte, subkey string, opts, desiredAcce
 		log.Errorln(err)
 		return
 	}
-	names = make([]string, 0, res.SubKeys)
+	names = make([]string, 0, min(res.SubKeys, maxPreallocCount))
 
 	var res2 *KeyInfo
 	for i := uint32(0); i < res.SubKeys; i++ {
@@ -1075,14 +1230,14 @@ func (r *RPCCon) GetKeyValues(hKey []byte) (items []ValueInfo, err error) {
 		return
 	}
 
-	items = make([]ValueInfo, 0, res.Values)
+	items = make([]ValueInfo, 0, min(res.Values, maxPreallocCount))
 	for i := uint32(0); i < res.Values; i++ {
 		value, err := r.EnumValue(hKey, i)
 		if err != nil {
 			log.Errorln(err)
 			return nil, err
 		}
-		value.Name = value.Name[:len(value.Name)-1]
+		value.Name = msdtyp.StripNullByte(value.Name)
 		items = append(items, *value)
 	}
 	return
@@ -1095,15 +1250,14 @@ func (r *RPCCon) GetValueNames(hKey []byte) (names []string, err error) {
 		return
 	}
 
-	names = make([]string, 0, res.Values)
+	names = make([]string, 0, min(res.Values, maxPreallocCount))
 	for i := uint32(0); i < res.Values; i++ {
 		value, err := r.EnumValue(hKey, i)
 		if err != nil {
 			log.Errorln(err)
 			return nil, err
 		}
-		name := value.Name
-		names = append(names, name[:len(name)-1])
+		names = append(names, msdtyp.StripNullByte(value.Name))
 	}
 	return
 }
@@ -1112,7 +1266,7 @@ func (r *RPCCon) SetValue(hKey []byte, name string, value any, dataType uint32)
 	name = msdtyp.NullTerminate(name)
 	var data []byte
 	switch dataType {
-	case RegSz:
+	case RegSz, RegExpandSz:
 		s, ok := value.(string)
 		if !ok {
 			err = fmt.Errorf("Provided value is not of type string")
@@ -1120,7 +1274,6 @@ func (r *RPCCon) SetValue(hKey []byte, name string, value any, dataType uint32)
 			return
 		}
 		data = msdtyp.ToUnicode(msdtyp.NullTerminate(s))
-	//case RegExpandSz:
 	case RegBinary:
 		b, ok := value.([]byte)
 		if !ok {
@@ -1148,7 +1301,14 @@ func (r *RPCCon) SetValue(hKey []byte, name string, value any, dataType uint32)
 		data = make([]byte, 4)
 		binary.BigEndian.PutUint32(data, d)
 	//case RegLink:
-	//case RegMultiSz:
+	case RegMultiSz:
+		ss, ok := value.([]string)
+		if !ok {
+			err = fmt.Errorf("Provided value is not of type []string")
+			log.Errorln(err)
+			return
+		}
+		data = toUnicodeStrArray(ss)
 	case RegQword:
 		d, ok := value.(uint64)
 		if !ok {
@@ -1196,3 +1356,124 @@ func (r *RPCCon) SetValue(hKey []byte, name string, value any, dataType uint32)
 
 	return
 }
+
+// Opnum 26
+// Returns the version of the registry server that hKey is connected to.
+// Windows servers always report version 5.
+func (r *RPCCon) GetVersion(hKey []byte) (version uint32, err error) {
+	req := BaseRegGetVersionReq{
+		HKey: hKey,
+	}
+
+	log.Debugf("Trying to get registry version for key handle (0x%x)\n", hKey)
+	reqBuf, err := req.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := r.MakeIoCtlRequest(BaseRegGetVersion, reqBuf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	res := BaseRegGetVersionRes{}
+	err = res.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	if res.ReturnCode != ErrorSuccess {
+		err = ReturnCodeMap[res.ReturnCode]
+		log.Errorln(err)
+		return
+	}
+	version = res.Version
+	return
+}
+
+// Opnum 30
+// Initiate a shutdown of the remote system after timeout seconds, during which
+// a message is shown to logged on users. If force is set, applications with
+// unsaved changes are closed without asking. Requires the
+// SeRemoteShutdownPrivilege on the server.
+func (r *RPCCon) InitiateSystemShutdown(message string, timeout uint32, force, reboot bool, reason uint32) (err error) {
+	req := BaseInitiateSystemShutdownExReq{
+		Message:             message,
+		Timeout:             timeout,
+		ForceAppsClosed:     force,
+		RebootAfterShutdown: reboot,
+		Reason:              reason,
+	}
+
+	log.Debugf("Trying to initiate system shutdown (reboot: %v) with timeout (%d)\n", reboot, timeout)
+	reqBuf, err := req.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := r.MakeIoCtlRequest(BaseInitiateSystemShutdownEx, reqBuf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	res := ReturnCode{}
+	err = res.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	if res.uint32 != ErrorSuccess {
+		status, found := ReturnCodeMap[res.uint32]
+		if !found {
+			err = fmt.Errorf("Received unknown return code in BaseInitiateSystemShutdownEx response: 0x%x\n", res.uint32)
+			log.Errorln(err)
+			return
+		}
+		err = status
+	}
+	return
+}
+
+// Opnum 25
+// Abort a shutdown that was previously initiated and is still within its
+// timeout
+func (r *RPCCon) AbortSystemShutdown() (err error) {
+	req := BaseAbortSystemShutdownReq{}
+
+	log.Debugln("Trying to abort system shutdown")
+	reqBuf, err := req.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := r.MakeIoCtlRequest(BaseAbortSystemShutdown, reqBuf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	res := ReturnCode{}
+	err = res.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	if res.uint32 != ErrorSuccess {
+		status, found := ReturnCodeMap[res.uint32]
+		if !found {
+			err = fmt.Errorf("Received unknown return code in BaseAbortSystemShutdown response: 0x%x\n", res.uint32)
+			log.Errorln(err)
+			return
+		}
+		err = status
+	}
+	return
+}
@@ -25,9 +25,23 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing/fstest"
+	"time"
 
 	"testing"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/ericblavier/go-smb/smb/replay"
+	"github.com/ericblavier/go-smb/smbserver"
+	"github.com/ericblavier/go-smb/spnego"
 )
 
 // Possible to define an init function that is run before all tests?
@@ -185,18 +199,18 @@ func TestSetKeySecurityReq(t *testing.T) {
 		PermKeySetValue |
 		PermKeyQueryValue
 
-	sAce, err := NewAce(systemSIDStr, systemMask, AccessAllowedAceType, ContainerInheritAce|InheritedAce)
+	sAce, err := NewAce(systemSIDStr, systemMask, msdtyp.AccessAllowedAceType, msdtyp.ContainerInheritAce|msdtyp.InheritedAce)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	adminMask := PermWriteDacl | PermReadControl
-	aAce, err := NewAce(adminSIDStr, adminMask, AccessAllowedAceType, ContainerInheritAce|InheritedAce)
+	aAce, err := NewAce(adminSIDStr, adminMask, msdtyp.AccessAllowedAceType, msdtyp.ContainerInheritAce|msdtyp.InheritedAce)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	sd, err := NewSecurityDescriptor(SecurityDescriptorFlagSR, nil, nil, NewACL([]ACE{*sAce, *aAce}), nil)
+	sd, err := NewSecurityDescriptor(msdtyp.SecurityDescriptorFlagSR, nil, nil, NewACL([]msdtyp.ACE{*sAce, *aAce}), nil)
 
 	req := BaseRegSetKeySecurityReq{
 		HKey:                hKey,
@@ -285,7 +299,7 @@ func TestGetKeySecurityRes(t *testing.T) {
 
 	sd := *res.SecurityDescriptorOut.SecurityDescriptor
 
-	if sd.Control != SecurityDescriptorFlagSR|SecurityDescriptorFlagDP {
+	if sd.Control != msdtyp.SecurityDescriptorFlagSR|msdtyp.SecurityDescriptorFlagDP {
 		t.Error("Fail")
 	}
 	if !bytes.Equal(sd.OwnerSid.Authority, []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x5}) {
@@ -538,7 +552,7 @@ func TestQueryValueRes(t *testing.T) {
 		t.Error("Fail")
 	}
 
-	name, err := FromUnicode(res.Data)
+	name, err := msdtyp.FromUnicode(res.Data)
 	if !bytes.Equal(name, []byte(".\\Administrator\x00")) {
 		t.Error("Fail")
 	}
@@ -569,17 +583,17 @@ func TestSaveKeyReq(t *testing.T) {
 	name := "C:\\windows\\temp\\sUFmxyV.log"
 	adminSIDStr := "S-1-5-32-544"
 	adminMask := PermGenericRead | PermGenericWrite | PermWriteDacl | PermDelete
-	aAce, err := NewAce(adminSIDStr, adminMask, AccessAllowedAceType, ContainerInheritAce)
+	aAce, err := NewAce(adminSIDStr, adminMask, msdtyp.AccessAllowedAceType, msdtyp.ContainerInheritAce)
 	if err != nil {
 		t.Fatal(err)
 	}
-	ownerSid, err := convertStrToSID(adminSIDStr)
+	ownerSid, err := msdtyp.ConvertStrToSID(adminSIDStr)
 	if err != nil {
 		t.Fatal(err)
 	}
-	acl := NewACL([]ACE{*aAce})
+	acl := NewACL([]msdtyp.ACE{*aAce})
 
-	sd, err := NewSecurityDescriptor(SecurityDescriptorFlagSR, ownerSid, nil, acl, nil)
+	sd, err := NewSecurityDescriptor(msdtyp.SecurityDescriptorFlagSR, ownerSid, nil, acl, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -637,3 +651,454 @@ func TestSaveKeyRes(t *testing.T) {
 		t.Error("Fail")
 	}
 }
+
+func TestParseKeyPath(t *testing.T) {
+	root, subkey, err := ParseKeyPath("HKEY_LOCAL_MACHINE\\SYSTEM\\CurrentControlSet\\Control\\")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != HKEYLocalMachine || subkey != "SYSTEM\\CurrentControlSet\\Control" {
+		t.Fatal("Fail")
+	}
+
+	root, subkey, err = ParseKeyPath("hku")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != HKEYUsers || subkey != "" {
+		t.Fatal("Fail")
+	}
+
+	_, _, err = ParseKeyPath("HKXX\\Software")
+	if err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestUnicodeStrArray(t *testing.T) {
+	items := []string{"first", "second"}
+	buf := toUnicodeStrArray(items)
+	if len(buf) != (len("first")+len("second")+3)*2 {
+		t.Fatal("Fail")
+	}
+	res, err := fromUnicodeStrArray(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0] != "first" || res[1] != "second" {
+		t.Fatal("Fail")
+	}
+}
+
+func TestValueInfoData(t *testing.T) {
+	value := ValueInfo{Type: RegExpandSz, Value: msdtyp.ToUnicode("%SystemRoot%\x00")}
+	data, err := value.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.(string) != "%SystemRoot%" {
+		t.Fatal("Fail")
+	}
+
+	value = ValueInfo{Type: RegDword, Value: []byte{0x01, 0x02, 0x00, 0x00}}
+	data, err = value.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.(uint32) != 0x201 {
+		t.Fatal("Fail")
+	}
+}
+
+func TestBaseRegGetVersionRes(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("0500000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := BaseRegGetVersionRes{}
+	err = res.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Version != 5 || res.ReturnCode != ErrorSuccess {
+		t.Fatal("Fail")
+	}
+}
+
+func TestBaseRegSaveKeyExReq(t *testing.T) {
+	hKey, err := hex.DecodeString("000000008c77795a6df29c48bd0d2948540acbab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa, err := newSaveKeySecurityAttributes("S-1-5-32-544")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "..\\Temp\\hive.tmp"
+	req := BaseRegSaveKeyReq{
+		HKey:               hKey,
+		FileName:           RRPUnicodeStr{MaxLength: uint16(len(name)), S: name},
+		SecurityAttributes: *sa,
+	}
+	reqEx := BaseRegSaveKeyExReq{
+		HKey:               hKey,
+		FileName:           req.FileName,
+		SecurityAttributes: *sa,
+		Flags:              RegLatestFormat | RegNoCompression,
+	}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bufEx, err := reqEx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf)%4 != 0 || !bytes.Equal(append(buf, 0x06, 0x00, 0x00, 0x00), bufEx) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestBaseInitiateSystemShutdownExReq(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("000000000100000018001800020000000c000000000000000c0000004d00610069006e00740065006e0061006e006300650000001e0000000101000003000380")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := BaseInitiateSystemShutdownExReq{
+		Message:             "Maintenance",
+		Timeout:             30,
+		ForceAppsClosed:     true,
+		RebootAfterShutdown: true,
+		Reason:              ShutdownReasonMajorSoftware | ShutdownReasonMinorUpgrade | ShutdownReasonFlagPlanned,
+	}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pkt, buf) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestPerfDataBlock(t *testing.T) {
+	// Synthetic block with a Memory object without instances and a Processor
+	// object with two instances
+	pkt, err := hex.DecodeString("5000450052004600010000000100000001000000b00100006800000002000000ffffffffea070a00050010000c001e002d00f401000000006400000000000000c8000000000000002c010000000000000a0000005800000048004f0053005400000000000000000078000000680000004000000004000000000000000500000000000000640000000100000000000000ffffffff0000000005000000000000000a00000000000000280000001800000000000000190000000000000000000000640000000001010008000000080000001000000000000000d204000000000000d00000006800000040000000ee00000000000000ef00000000000000640000000100000000000000020000000000000005000000000000000a0000000000000028000000060000000000000007000000000000000000000064000000000541200800000008000000200000000000000000000000000000001800000004000000300000000000000010000000000000006f0000000000000028000000000000000000000001000000180000000e0000005f0054006f00740061006c00000000001000000000000000de00000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := PerfDataBlock{}
+	err = block.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.SystemName != "HOST" || block.SystemTime.Year() != 2026 || block.PerfFreq != 200 {
+		t.Fatal("Fail")
+	}
+	if len(block.Objects) != 2 {
+		t.Fatal("Fail")
+	}
+
+	memory := block.Objects[0]
+	if memory.NameIndex != 4 || len(memory.Instances) != 1 || memory.Instances[0].Name != "" {
+		t.Fatal("Fail")
+	}
+	value, err := memory.Instances[0].Value(memory.Counter(24))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 1234 {
+		t.Fatal("Fail")
+	}
+
+	processor := block.Objects[1]
+	if processor.NameIndex != 238 || len(processor.Instances) != 2 || processor.Instances[1].Name != "_Total" {
+		t.Fatal("Fail")
+	}
+	value, err = processor.Instances[1].Value(processor.Counter(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 222 {
+		t.Fatal("Fail")
+	}
+}
+
+func TestClientSetView(t *testing.T) {
+	c := NewClient(nil)
+	if err := c.SetView(PermKeyWow6432Key); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetView(PermKeyWow6432Key | PermKeyWow6464Key); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestBootKeyFromClassNames(t *testing.T) {
+	bootKey, err := BootKeyFromClassNames([]string{"1b3c6d2a", "9f8e7d6c", "55aa33cc", "0123abcd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(bootKey) != "558e9f6dccaa232a1b7d3c01ab33cd6c" {
+		t.Fatal("Fail")
+	}
+	_, err = BootKeyFromClassNames([]string{"1b3c6d2a", "9f8e7d6c", "55aa33cc"})
+	if err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestGrantRevokeAce(t *testing.T) {
+	system, err := NewAce("S-1-5-18", PermKeyQueryValue, msdtyp.AccessAllowedAceType, msdtyp.ContainerInheritAce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inherited, err := NewAce("S-1-5-32-544", PermGenericAll, msdtyp.AccessAllowedAceType, msdtyp.ContainerInheritAce|msdtyp.InheritedAce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := NewAce("S-1-5-32-545", PermKeyQueryValue, msdtyp.AccessAllowedAceType, msdtyp.ContainerInheritAce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dacl := grantAce([]msdtyp.ACE{*system, *inherited}, *users)
+	if len(dacl) != 3 || msdtyp.ConvertSIDtoStr(&dacl[1].Sid) != "S-1-5-32-545" {
+		t.Fatal("Fail")
+	}
+
+	users.Mask = PermKeySetValue
+	dacl = grantAce(dacl, *users)
+	if len(dacl) != 3 || dacl[1].Mask != PermKeyQueryValue|PermKeySetValue {
+		t.Fatal("Fail")
+	}
+
+	usersSid, _ := msdtyp.ParseSID("S-1-5-32-545")
+	dacl = revokeAces(dacl, usersSid)
+	if len(dacl) != 2 {
+		t.Fatal("Fail")
+	}
+	// Inherited ACEs are kept
+	adminsSid, _ := msdtyp.ParseSID("S-1-5-32-544")
+	dacl = revokeAces(dacl, adminsSid)
+	if len(dacl) != 2 {
+		t.Fatal("Fail")
+	}
+}
+
+// startHiveServer serves a mock winreg next to an ADMIN$ share and returns
+// the port of the server. save is called by BaseRegSaveKey.
+func startHiveServer(t *testing.T, admin smbserver.Backend, save func() error) int {
+	handle := func(call *dcerpc.Call, in *dcerpc.NDRReader, out *dcerpc.NDRWriter) error {
+		out.ContextHandle(call.Association.NewHandle(nil))
+		out.Uint32(ErrorSuccess)
+		return nil
+	}
+	winreg := dcerpc.NewServer()
+	err := winreg.Register(&dcerpc.Interface{
+		UUID:         MSRRPUuid,
+		MajorVersion: MSRRPMajorVersion,
+		MinorVersion: MSRRPMinorVersion,
+		Operations: map[uint16]dcerpc.Operation{
+			OpenLocalMachine: handle,
+			BaseRegOpenKey:   handle,
+			BaseRegCloseKey: func(call *dcerpc.Call, in *dcerpc.NDRReader, out *dcerpc.NDRWriter) error {
+				call.Association.CloseHandle(in.ContextHandle())
+				out.ContextHandle(make([]byte, 20))
+				out.Uint32(ErrorSuccess)
+				return nil
+			},
+			BaseRegSaveKey: func(call *dcerpc.Call, in *dcerpc.NDRReader, out *dcerpc.NDRWriter) error {
+				if err := save(); err != nil {
+					return err
+				}
+				out.Uint32(ErrorSuccess)
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	srv, err := smbserver.NewServer(smbserver.Options{
+		Shares:   map[string]smbserver.Backend{"ADMIN$": admin},
+		Pipes:    map[string]*dcerpc.Server{MSRRPPipe: winreg},
+		Accounts: map[string]string{"alice": "Passw0rd!"},
+	})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// dialHiveClient connects a Client to the winreg pipe of the server and
+// connects the ADMIN$ share
+func dialHiveClient(t *testing.T, opt smb.Options) (*Client, *smb.Connection) {
+	opt.Host = "127.0.0.1"
+	opt.Initiator = &spnego.NTLMInitiator{User: "alice", Password: "Passw0rd!"}
+	opt.DialTimeout = 5 * time.Second
+	conn, err := smb.NewConnection(opt)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	for _, share := range []string{"IPC$", "ADMIN$"} {
+		if err = conn.TreeConnect(share); err != nil {
+			t.Fatalf("Fail: %+v", err)
+		}
+	}
+	f, err := conn.OpenFile("IPC$", MSRRPPipe)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	t.Cleanup(func() { f.CloseFile() })
+	bind, err := dcerpc.Bind(f, MSRRPUuid, MSRRPMajorVersion, MSRRPMinorVersion, dcerpc.MSRPCUuidNdr)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	return NewClient(bind), conn
+}
+
+func newHiveClient(t *testing.T, admin smbserver.Backend, save func() error) (*Client, *smb.Connection) {
+	return dialHiveClient(t, smb.Options{Port: startHiveServer(t, admin, save)})
+}
+
+func TestSaveHive(t *testing.T) {
+	hive := []byte("regf hive data")
+	dir := t.TempDir()
+	admin, err := smbserver.Dir(dir)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	saved := filepath.Join(dir, "SAM.tmp")
+	client, conn := newHiveClient(t, admin, func() error {
+		return os.WriteFile(saved, hive, 0600)
+	})
+	data, err := client.SaveHiveExt(conn, `HKLM\SAM`, `C:\Windows\SAM.tmp`, "ADMIN$", "SAM.tmp")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if !bytes.Equal(data, hive) {
+		t.Fatalf("Fail: %q", data)
+	}
+	if _, err = os.Stat(saved); !os.IsNotExist(err) {
+		t.Fatal("Fail: the saved hive was not deleted")
+	}
+}
+
+func TestSaveHiveCleanupError(t *testing.T) {
+	// The read-only share allows the download but not the removal
+	hive := []byte("regf hive data")
+	admin := smbserver.FS(fstest.MapFS{"SAM.tmp": {Data: hive}})
+	client, conn := newHiveClient(t, admin, func() error { return nil })
+	data, err := client.SaveHiveExt(conn, `HKLM\SAM`, `C:\Windows\SAM.tmp`, "ADMIN$", "SAM.tmp")
+	var cleanupErr *CleanupError
+	if !errors.As(err, &cleanupErr) || cleanupErr.Share != "ADMIN$" || cleanupErr.Path != "SAM.tmp" || cleanupErr.Err == nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if !bytes.Equal(data, hive) {
+		t.Fatalf("Fail: %q", data)
+	}
+
+	// A failed save is not a cleanup error
+	client, conn = newHiveClient(t, admin, func() error { return dcerpc.FaultAccessDenied })
+	if _, err = client.SaveHiveExt(conn, `HKLM\SAM`, `C:\Windows\SAM.tmp`, "ADMIN$", "SAM.tmp"); err == nil || errors.As(err, &cleanupErr) {
+		t.Fatalf("Fail: %+v", err)
+	}
+}
+
+var update = flag.Bool("update", false, "Record the transcripts of testdata against a local smbserver")
+
+// TestSaveHiveGolden replays the winreg and ADMIN$ traffic of SaveHiveExt
+func TestSaveHiveGolden(t *testing.T) {
+	hive := []byte("regf hive data")
+	path := filepath.Join("testdata", "save_hive.txt")
+	opt := smb.Options{Port: 445, DisableSigning: true}
+	if *update {
+		admin := smbserver.FS(fstest.MapFS{"SAM.tmp": {Data: hive}})
+		opt.Port = startHiveServer(t, admin, func() error { return nil })
+		r := &replay.Recorder{}
+		opt.ProxyDialer = r
+		client, conn := dialHiveClient(t, opt)
+		client.SaveHiveExt(conn, `HKLM\SAM`, `C:\Windows\SAM.tmp`, "ADMIN$", "SAM.tmp")
+		if err := r.Transcript().Save(path); err != nil {
+			t.Fatalf("Fail: %+v", err)
+		}
+		opt.Port = 445
+	}
+	transcript, err := replay.LoadTranscript(path)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	r := replay.NewReplayer(transcript)
+	opt.ProxyDialer = r
+	client, conn := dialHiveClient(t, opt)
+	// The read-only share refuses to delete the hive
+	data, err := client.SaveHiveExt(conn, `HKLM\SAM`, `C:\Windows\SAM.tmp`, "ADMIN$", "SAM.tmp")
+	var cleanupErr *CleanupError
+	if !errors.As(err, &cleanupErr) || !bytes.Equal(data, hive) {
+		t.Fatalf("Fail: %q %+v", data, err)
+	}
+	if err = r.Err(); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+}
+
+func FuzzUnmarshalResponses(f *testing.F) {
+	for _, seed := range []string{
+		"0a000004000002000002000000000000050000004e004c002400310000000000040002000300000008000200a800000000000000a800000000000000",
+		"00000200001000006400000000100000000000006400000001000480480000005800000000000000140000000200340002000000001214003f000f000101000000000005120000000012180000000600010200000000000520000000200200000102000000000005200000002002000001010000000000051200000000000000",
+		"5000450052004600010000000100000001000000b00100006800000002000000ffffffffea070a00050010000c001e002d00f401000000006400000000000000c8000000000000002c010000000000000a000000580000004800",
+	} {
+		buf, err := hex.DecodeString(seed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for opnum := uint16(0); opnum <= BaseRegDeleteKeyEx; opnum++ {
+			DecodeResponse(opnum, data)
+		}
+		(&PerfDataBlock{}).UnmarshalBinary(data)
+	})
+}
+
+func TestFiletime(t *testing.T) {
+	tm := time.Date(2020, 1, 1, 0, 0, 0, 100, time.UTC)
+	ft := Filetime{}
+	ft.FromTime(tm)
+	pft := PFiletime{}
+	pft.FromTime(tm)
+	if ft.HighDateTime != 0x01D5C036 || ft.LowDateTime != 0x69050001 || !ft.ToTime().Equal(tm) || !pft.ToTime().Equal(tm) {
+		t.Fatalf("Fail: %+v", ft)
+	}
+	// The zero Time is a zero FILETIME and the never sentinels a zero Time
+	ft.FromTime(time.Time{})
+	pft.FromTime(time.Time{})
+	if ft != (Filetime{}) || pft != (PFiletime{}) || !ft.ToTime().IsZero() {
+		t.Fatalf("Fail: %+v", ft)
+	}
+	for _, never := range []uint64{msdtyp.FiletimeNever, msdtyp.FiletimeInfinite} {
+		ft = Filetime{LowDateTime: uint32(never), HighDateTime: uint32(never >> 32)}
+		pft = PFiletime{LowDateTime: uint32(never), HighDateTime: uint32(never >> 32)}
+		if !ft.ToTime().IsZero() || !pft.ToTime().IsZero() {
+			t.Fatal("Fail")
+		}
+		ft.FromTime(ft.ToTime())
+		if ft != (Filetime{}) {
+			t.Fatalf("Fail: %+v", ft)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package msrrp
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+const (
+	perfDataBlockSize                = 88
+	perfObjectTypeSize               = 64
+	perfInstanceDefinitionSize       = 24
+	perfNoInstances            int32 = -1
+	maxPerfDataSize                  = 64 * 1024 * 1024
+)
+
+// PERF_DATA_BLOCK as returned when querying HKEY_PERFORMANCE_DATA
+type PerfDataBlock struct {
+	Version         uint32
+	Revision        uint32
+	SystemTime      time.Time
+	PerfTime        int64
+	PerfFreq        int64
+	PerfTime100nSec int64
+	SystemName      string
+	Objects         []PerfObject
+}
+
+// PERF_OBJECT_TYPE with its counter definitions and instances. Objects
+// without instances, e.g. Memory, have a single instance with an empty name.
+type PerfObject struct {
+	NameIndex      uint32 // Index into the Counter names, e.g. 238 for Processor
+	HelpIndex      uint32
+	DetailLevel    uint32
+	DefaultCounter int32
+	CodePage       uint32
+	PerfTime       int64
+	PerfFreq       int64
+	Counters       []PerfCounterDefinition
+	Instances      []PerfInstance
+}
+
+// PERF_COUNTER_DEFINITION
+type PerfCounterDefinition struct {
+	NameIndex     uint32
+	HelpIndex     uint32
+	DefaultScale  int32
+	DetailLevel   uint32
+	CounterType   uint32
+	CounterSize   uint32
+	CounterOffset uint32
+}
+
+// PERF_INSTANCE_DEFINITION and the counter block of the instance
+type PerfInstance struct {
+	Name                   string
+	UniqueID               int32
+	ParentObjectTitleIndex uint32
+	ParentObjectInstance   uint32
+	Data                   []byte // PERF_COUNTER_BLOCK
+}
+
+// Value returns the raw value of a counter of the object for the instance.
+// Counters of 4 or 8 bytes are supported.
+func (self *PerfInstance) Value(counter *PerfCounterDefinition) (uint64, error) {
+	end := uint64(counter.CounterOffset) + uint64(counter.CounterSize)
+	if end > uint64(len(self.Data)) {
+		return 0, fmt.Errorf("Counter data out of bounds of counter block")
+	}
+	switch counter.CounterSize {
+	case 4:
+		return uint64(le.Uint32(self.Data[counter.CounterOffset:])), nil
+	case 8:
+		return le.Uint64(self.Data[counter.CounterOffset:]), nil
+	}
+	return 0, fmt.Errorf("Unsupported counter size %d", counter.CounterSize)
+}
+
+// Counter returns the definition of the counter with the given name index
+func (self *PerfObject) Counter(nameIndex uint32) *PerfCounterDefinition {
+	for i := range self.Counters {
+		if self.Counters[i].NameIndex == nameIndex {
+			return &self.Counters[i]
+		}
+	}
+	return nil
+}
+
+func (self *PerfDataBlock) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary for PerfDataBlock")
+}
+
+func (self *PerfDataBlock) UnmarshalBinary(buf []byte) (err error) {
+	if len(buf) < perfDataBlockSize {
+		return fmt.Errorf("Buffer to small for PerfDataBlock")
+	}
+	signature, err := msdtyp.FromUnicodeString(buf[:8])
+	if err != nil {
+		return
+	}
+	if signature != "PERF" {
+		return fmt.Errorf("Invalid signature of PerfDataBlock")
+	}
+	if le.Uint32(buf[8:]) != 1 {
+		return fmt.Errorf("Big endian PerfDataBlock is not supported")
+	}
+	self.Version = le.Uint32(buf[12:])
+	self.Revision = le.Uint32(buf[16:])
+	totalLength := le.Uint32(buf[20:])
+	headerLength := le.Uint32(buf[24:])
+	numObjects := le.Uint32(buf[28:])
+	// SYSTEMTIME
+	st := make([]int, 8)
+	for i := range st {
+		st[i] = int(le.Uint16(buf[36+i*2:]))
+	}
+	self.SystemTime = time.Date(st[0], time.Month(st[1]), st[3], st[4], st[5], st[6], st[7]*int(time.Millisecond), time.UTC)
+	self.PerfTime = int64(le.Uint64(buf[56:]))
+	self.PerfFreq = int64(le.Uint64(buf[64:]))
+	self.PerfTime100nSec = int64(le.Uint64(buf[72:]))
+	nameLength := le.Uint32(buf[80:])
+	nameOffset := le.Uint32(buf[84:])
+
+	if uint64(totalLength) > uint64(len(buf)) || headerLength > totalLength {
+		return fmt.Errorf("Invalid length of PerfDataBlock")
+	}
+	buf = buf[:totalLength]
+	if nameLength > 0 {
+		if uint64(nameOffset)+uint64(nameLength) > uint64(len(buf)) {
+			return fmt.Errorf("Invalid SystemName offset in PerfDataBlock")
+		}
+		self.SystemName, err = perfString(buf[nameOffset : nameOffset+nameLength])
+		if err != nil {
+			return
+		}
+	}
+
+	offset := headerLength
+	self.Objects = make([]PerfObject, 0, min(numObjects, uint32(len(buf)/perfObjectTypeSize)))
+	for i := uint32(0); i < numObjects; i++ {
+		if uint64(offset)+perfObjectTypeSize > uint64(len(buf)) {
+			return fmt.Errorf("Buffer to small for PerfObject")
+		}
+		objLength := le.Uint32(buf[offset:])
+		if objLength < perfObjectTypeSize || uint64(offset)+uint64(objLength) > uint64(len(buf)) {
+			return fmt.Errorf("Invalid length of PerfObject")
+		}
+		obj := PerfObject{}
+		err = obj.unmarshal(buf[offset : offset+objLength])
+		if err != nil {
+			return
+		}
+		self.Objects = append(self.Objects, obj)
+		offset += objLength
+	}
+	return
+}
+
+// Decode a PERF_OBJECT_TYPE where buf holds TotalByteLength bytes
+func (self *PerfObject) unmarshal(buf []byte) (err error) {
+	definitionLength := le.Uint32(buf[4:])
+	headerLength := le.Uint32(buf[8:])
+	self.NameIndex = le.Uint32(buf[12:])
+	self.HelpIndex = le.Uint32(buf[20:])
+	self.DetailLevel = le.Uint32(buf[28:])
+	numCounters := le.Uint32(buf[32:])
+	self.DefaultCounter = int32(le.Uint32(buf[36:]))
+	numInstances := int32(le.Uint32(buf[40:]))
+	self.CodePage = le.Uint32(buf[44:])
+	self.PerfTime = int64(le.Uint64(buf[48:]))
+	self.PerfFreq = int64(le.Uint64(buf[56:]))
+
+	if uint64(definitionLength) > uint64(len(buf)) || headerLength > definitionLength {
+		return fmt.Errorf("Invalid definition length of PerfObject")
+	}
+
+	offset := headerLength
+	self.Counters = make([]PerfCounterDefinition, 0, min(numCounters, definitionLength/40))
+	for i := uint32(0); i < numCounters; i++ {
+		if offset+40 > definitionLength {
+			return fmt.Errorf("Buffer to small for PerfCounterDefinition")
+		}
+		length := le.Uint32(buf[offset:])
+		if length < 40 {
+			return fmt.Errorf("Invalid length of PerfCounterDefinition")
+		}
+		self.Counters = append(self.Counters, PerfCounterDefinition{
+			NameIndex:     le.Uint32(buf[offset+4:]),
+			HelpIndex:     le.Uint32(buf[offset+12:]),
+			DefaultScale:  int32(le.Uint32(buf[offset+20:])),
+			DetailLevel:   le.Uint32(buf[offset+24:]),
+			CounterType:   le.Uint32(buf[offset+28:]),
+			CounterSize:   le.Uint32(buf[offset+32:]),
+			CounterOffset: le.Uint32(buf[offset+36:]),
+		})
+		offset += length
+	}
+
+	offset = definitionLength
+	if numInstances == perfNoInstances {
+		var data []byte
+		data, _, err = perfCounterBlock(buf, offset)
+		if err != nil {
+			return
+		}
+		self.Instances = []PerfInstance{{Data: data}}
+		return
+	}
+
+	for i := int32(0); i < numInstances; i++ {
+		if uint64(offset)+perfInstanceDefinitionSize > uint64(len(buf)) {
+			return fmt.Errorf("Buffer to small for PerfInstance")
+		}
+		length := le.Uint32(buf[offset:])
+		nameOffset := le.Uint32(buf[offset+16:])
+		nameLength := le.Uint32(buf[offset+20:])
+		if length < perfInstanceDefinitionSize || uint64(offset)+uint64(length) > uint64(len(buf)) {
+			return fmt.Errorf("Invalid length of PerfInstance")
+		}
+		instance := PerfInstance{
+			ParentObjectTitleIndex: le.Uint32(buf[offset+4:]),
+			ParentObjectInstance:   le.Uint32(buf[offset+8:]),
+			UniqueID:               int32(le.Uint32(buf[offset+12:])),
+		}
+		if nameLength > 0 {
+			if uint64(nameOffset)+uint64(nameLength) > uint64(length) {
+				return fmt.Errorf("Invalid name offset of PerfInstance")
+			}
+			instance.Name, err = perfString(buf[offset+nameOffset : offset+nameOffset+nameLength])
+			if err != nil {
+				return
+			}
+		}
+		var next uint32
+		instance.Data, next, err = perfCounterBlock(buf, offset+length)
+		if err != nil {
+			return
+		}
+		self.Instances = append(self.Instances, instance)
+		offset = next
+	}
+	return
+}
+
+// Read the PERF_COUNTER_BLOCK at offset and return it along with the offset
+// of the data that follows
+func perfCounterBlock(buf []byte, offset uint32) (data []byte, next uint32, err error) {
+	if uint64(offset)+4 > uint64(len(buf)) {
+		err = fmt.Errorf("Buffer to small for PerfCounterBlock")
+		return
+	}
+	length := le.Uint32(buf[offset:])
+	if length < 4 || uint64(offset)+uint64(length) > uint64(len(buf)) {
+		err = fmt.Errorf("Invalid length of PerfCounterBlock")
+		return
+	}
+	next = offset + length
+	return buf[offset:next], next, nil
+}
+
+// Decode a null terminated UTF-16 string with an even length
+func perfString(buf []byte) (string, error) {
+	s, err := msdtyp.FromUnicodeString(buf[:len(buf)&^1])
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0x00 {
+			return s[:i], nil
+		}
+	}
+	return s, nil
+}
+
+// QueryPerformanceData queries HKEY_PERFORMANCE_DATA with a value name such
+// as "Global", "Costly" or a space separated list of object indexes, e.g.
+// "238 4" for the Processor and Memory objects.
+//
+// The server does not report the required size when the buffer is too small
+// for performance data, so the request is repeated with a growing buffer.
+func (c *Client) QueryPerformanceData(objects string) (block *PerfDataBlock, err error) {
+	hKey, err := c.openRoot(HKEYPerformanceData)
+	if err != nil {
+		return
+	}
+
+	name := msdtyp.NullTerminate(objects)
+	req := BaseRegQueryValueReq{
+		HKey:      hKey,
+		ValueName: RRPUnicodeStr{MaxLength: uint16(len(name)), S: name},
+		MaxLen:    64 * 1024,
+	}
+	res := BaseRegQueryValueRes{}
+	for {
+		var reqBuf, buffer []byte
+		reqBuf, err = req.MarshalBinary()
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		buffer, err = c.rpc.MakeIoCtlRequest(BaseRegQueryValue, reqBuf)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		res = BaseRegQueryValueRes{}
+		err = res.UnmarshalBinary(buffer)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		if res.ReturnCode != ErrorMoreData {
+			break
+		}
+		if req.MaxLen >= maxPerfDataSize {
+			err = fmt.Errorf("Performance data for (%s) is larger than %d bytes", objects, maxPerfDataSize)
+			log.Errorln(err)
+			return
+		}
+		req.MaxLen *= 2
+		log.Debugf("Performance data did not fit, retrying with a buffer of %d bytes\n", req.MaxLen)
+	}
+
+	if res.ReturnCode != ErrorSuccess {
+		status, found := ReturnCodeMap[res.ReturnCode]
+		if !found {
+			err = fmt.Errorf("Received unknown return code in BaseRegQueryValue response: 0x%x\n", res.ReturnCode)
+			log.Errorln(err)
+			return
+		}
+		err = status
+		return
+	}
+
+	block = &PerfDataBlock{}
+	err = block.UnmarshalBinary(res.Data)
+	return
+}
+
+// PerformanceNames returns the English names of performance objects and
+// counters keyed by their index, e.g. 238 -> "Processor". Pass "Help" instead
+// of "Counter" to get the help texts.
+func (c *Client) PerformanceNames(valueName string) (names map[uint32]string, err error) {
+	hKey, err := c.openRoot(HKEYPerformanceText)
+	if err != nil {
+		return
+	}
+	value, _, err := c.rpc.QueryValue2(hKey, valueName)
+	if err != nil {
+		return
+	}
+	items, err := fromUnicodeStrArray(value)
+	if err != nil {
+		return
+	}
+	names = make(map[uint32]string, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		index, e := strconv.ParseUint(items[i], 10, 32)
+		if e != nil {
+			continue
+		}
+		names[uint32(index)] = items[i+1]
+	}
+	return
+}
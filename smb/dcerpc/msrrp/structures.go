@@ -23,9 +23,11 @@ package msrrp
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/ericblavier/go-smb/msdtyp"
 )
@@ -50,6 +52,30 @@ type PFiletime struct {
 	HighDateTime uint32
 }
 
+// ToTime converts the FILETIME to a time.Time
+func (self *Filetime) ToTime() time.Time {
+	return msdtyp.FiletimeToTime(uint64(self.HighDateTime)<<32 | uint64(self.LowDateTime))
+}
+
+// FromTime sets the FILETIME from a time.Time
+func (self *Filetime) FromTime(t time.Time) {
+	ft := msdtyp.TimeToFiletime(t)
+	self.LowDateTime = uint32(ft)
+	self.HighDateTime = uint32(ft >> 32)
+}
+
+// ToTime converts the FILETIME to a time.Time
+func (self *PFiletime) ToTime() time.Time {
+	return msdtyp.FiletimeToTime(uint64(self.HighDateTime)<<32 | uint64(self.LowDateTime))
+}
+
+// FromTime sets the FILETIME from a time.Time
+func (self *PFiletime) FromTime(t time.Time) {
+	ft := msdtyp.TimeToFiletime(t)
+	self.LowDateTime = uint32(ft)
+	self.HighDateTime = uint32(ft >> 32)
+}
+
 // Shared struct, not all fields are used for every response type
 type KeyInfo struct {
 	KeyName         string
@@ -60,6 +86,7 @@ type KeyInfo struct {
 	Values          uint32
 	MaxValueNameLen uint32
 	MaxValueLen     uint32
+	LastWriteTime   time.Time
 }
 
 type ValueInfo struct {
@@ -202,6 +229,11 @@ type BaseRegEnumValueRes struct {
 	ReturnCode uint32
 }
 
+// Opnum 11
+type BaseRegFlushKeyReq struct {
+	HKey []byte
+}
+
 // Opnum 12
 type BaseRegGetKeySecurityReq struct {
 	HKey                 []byte
@@ -282,11 +314,47 @@ type BaseRegSetValueReq struct {
 	DataLen   uint32 // How many bytes are transmitted in Data. E.g., ActualSize
 }
 
+// Opnum 25
+type BaseAbortSystemShutdownReq struct {
+	// ServerName is always sent as a null ptr
+}
+
+// Opnum 26
+type BaseRegGetVersionReq struct {
+	HKey []byte
+}
+
+type BaseRegGetVersionRes struct {
+	Version    uint32
+	ReturnCode uint32
+}
+
+// Opnum 30
+type BaseInitiateSystemShutdownExReq struct {
+	// ServerName is always sent as a null ptr
+	Message             string // Optional, encoded as a ptr to an RRP_UNICODE_STRING
+	Timeout             uint32 // Seconds before the shutdown
+	ForceAppsClosed     bool
+	RebootAfterShutdown bool
+	Reason              uint32
+}
+
+// Opnum 31
+type BaseRegSaveKeyExReq struct {
+	HKey               []byte
+	FileName           RRPUnicodeStr
+	SecurityAttributes RpcSecurityAttributes
+	Flags              uint32
+}
+
 func (self *ReturnCode) MarshalBinary() ([]byte, error) {
 	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary for ReturnCode")
 }
 
 func (self *ReturnCode) UnmarshalBinary(buf []byte) error {
+	if len(buf) < 4 {
+		return fmt.Errorf("Buffer to small for ReturnCode")
+	}
 	self.uint32 = le.Uint32(buf)
 	return nil
 }
@@ -1055,6 +1123,20 @@ func (self *BaseRegGetKeySecurityRes) UnmarshalBinary(buf []byte) (err error) {
 	return nil
 }
 
+// Opnum 11
+func (self *BaseRegFlushKeyReq) MarshalBinary() (ret []byte, err error) {
+	if len(self.HKey) != 20 {
+		err = fmt.Errorf("Invalid length of HKey in BaseRegFlushKeyReq")
+		log.Errorln(err)
+		return
+	}
+	return append(ret, self.HKey...), nil
+}
+
+func (self *BaseRegFlushKeyReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary for BaseRegFlushKeyReq")
+}
+
 // Opnum 15
 func (self *BaseRegOpenKeyReq) MarshalBinary() (ret []byte, err error) {
 	if len(self.HKey) != 20 {
@@ -1372,6 +1454,24 @@ func (self *BaseRegSaveKeyReq) UnmarshalBinary(buf []byte) error {
 	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary for BaseRegSaveKeyReq")
 }
 
+// Opnum 31
+func (self *BaseRegSaveKeyExReq) MarshalBinary() (ret []byte, err error) {
+	req := BaseRegSaveKeyReq{
+		HKey:               self.HKey,
+		FileName:           self.FileName,
+		SecurityAttributes: self.SecurityAttributes,
+	}
+	ret, err = req.MarshalBinary()
+	if err != nil {
+		return
+	}
+	return binary.LittleEndian.AppendUint32(ret, self.Flags), nil
+}
+
+func (self *BaseRegSaveKeyExReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary for BaseRegSaveKeyExReq")
+}
+
 // Opnum 21
 func (self *BaseRegSetKeySecurityReq) MarshalBinary() (ret []byte, err error) {
 	if len(self.HKey) != 20 {
@@ -1611,3 +1711,132 @@ func (self *BaseRegSetValueReq) MarshalBinary() (ret []byte, err error) {
 func (self *BaseRegSetValueReq) UnmarshalBinary(buf []byte) error {
 	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary for BaseRegSetValueReq")
 }
+
+// Opnum 25
+func (self *BaseAbortSystemShutdownReq) MarshalBinary() ([]byte, error) {
+	// Null ptr for ServerName
+	return []byte{0, 0, 0, 0}, nil
+}
+
+func (self *BaseAbortSystemShutdownReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary for BaseAbortSystemShutdownReq")
+}
+
+// Opnum 26
+func (self *BaseRegGetVersionReq) MarshalBinary() (ret []byte, err error) {
+	if len(self.HKey) != 20 {
+		err = fmt.Errorf("Invalid length of HKey in BaseRegGetVersionReq")
+		log.Errorln(err)
+		return
+	}
+	return append(ret, self.HKey...), nil
+}
+
+func (self *BaseRegGetVersionReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary for BaseRegGetVersionReq")
+}
+
+func (self *BaseRegGetVersionRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary for BaseRegGetVersionRes")
+}
+
+func (self *BaseRegGetVersionRes) UnmarshalBinary(buf []byte) error {
+	if len(buf) < 8 {
+		return fmt.Errorf("Buffer to small for BaseRegGetVersionRes")
+	}
+	self.Version = le.Uint32(buf)
+	self.ReturnCode = le.Uint32(buf[4:])
+	return nil
+}
+
+// Opnum 30
+func (self *BaseInitiateSystemShutdownExReq) MarshalBinary() (ret []byte, err error) {
+	w := bytes.NewBuffer(ret)
+	// Null ptr for ServerName
+	err = binary.Write(w, le, uint32(0))
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	refId := uint32(1)
+	if self.Message == "" {
+		err = binary.Write(w, le, uint32(0))
+	} else {
+		err = binary.Write(w, le, refId)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		refId++
+		msg := RRPUnicodeStr{S: self.Message}
+		err = writeRRPUnicodeStr(w, le, &msg, &refId, false)
+	}
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	var force, reboot byte
+	if self.ForceAppsClosed {
+		force = 1
+	}
+	if self.RebootAfterShutdown {
+		reboot = 1
+	}
+	err = binary.Write(w, le, self.Timeout)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	_, err = w.Write([]byte{force, reboot, 0, 0}) // Padded to 4 bytes
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Write(w, le, self.Reason)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return w.Bytes(), nil
+}
+
+func (self *BaseInitiateSystemShutdownExReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary for BaseInitiateSystemShutdownExReq")
+}
+
+// DecodeResponse decodes the stub data of a response to the operation opnum
+// into its response struct, e.g., *BaseRegEnumKeyRes, or into a *ReturnCode
+// for operations that only return a status. It is meant for tools and
+// fuzzing and must not panic on any input.
+func DecodeResponse(opnum uint16, buf []byte) (res encoding.BinaryUnmarshaler, err error) {
+	switch opnum {
+	case OpenClassesRoot, OpenCurrentUser, OpenLocalMachine, OpenPerformanceData, OpenUsers,
+		BaseRegOpenKey, OpenCurrentConfig, OpenPerformanceText, OpenPerformanceNlsText:
+		res = &OpenKeyRes{}
+	case BaseRegCreateKey:
+		res = &BaseRegCreateKeyRes{}
+	case BaseRegEnumKey:
+		res = &BaseRegEnumKeyRes{}
+	case BaseRegEnumValue:
+		res = &BaseRegEnumValueRes{}
+	case BaseRegGetKeySecurity:
+		res = &BaseRegGetKeySecurityRes{}
+	case BaseRegQueryInfoKey:
+		res = &BaseRegQueryInfoKeyRes{}
+	case BaseRegQueryValue:
+		res = &BaseRegQueryValueRes{}
+	case BaseRegGetVersion:
+		res = &BaseRegGetVersionRes{}
+	case BaseRegDeleteKey, BaseRegDeleteValue, BaseRegFlushKey, BaseRegSaveKey, BaseRegSetValue,
+		BaseRegSetKeySecurity, BaseRegSaveKeyEx, BaseRegDeleteKeyEx:
+		res = &ReturnCode{}
+	default:
+		return nil, fmt.Errorf("Unsupported MS-RRP operation %d", opnum)
+	}
+	if err = res.UnmarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	return
+}
@@ -24,10 +24,12 @@ package msrrp
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"unicode/utf16"
 
 	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/encoder"
 )
 
 //Always nullTerminate NewUnicodeStrings
@@ -64,6 +66,16 @@ func fromUnicodeStrArray(buf []byte) (result []string, err error) {
 	return
 }
 
+// Encode a list of strings as a REG_MULTI_SZ value where each string is null
+// terminated and the list is terminated by an empty string
+func toUnicodeStrArray(items []string) []byte {
+	var buf []byte
+	for _, item := range items {
+		buf = append(buf, msdtyp.ToUnicode(msdtyp.NullTerminate(item))...)
+	}
+	return append(buf, 0, 0)
+}
+
 func readConformantVaryingString(r *bytes.Reader) (s string, err error) {
 	// Read the Max count
 	var maxCount uint32
@@ -90,6 +102,11 @@ func readConformantVaryingString(r *bytes.Reader) (s string, err error) {
 		log.Errorln(err)
 		return
 	}
+	if offset > maxCount || actualCount > maxCount-offset {
+		err = fmt.Errorf("Actual count %d at offset %d exceeds max count %d", actualCount, offset, maxCount)
+		log.Errorln(err)
+		return
+	}
 	if offset > 0 {
 		_, err = r.Seek(int64(offset)*2, io.SeekCurrent)
 		if err != nil {
@@ -99,6 +116,11 @@ func readConformantVaryingString(r *bytes.Reader) (s string, err error) {
 	}
 
 	if actualCount > 0 {
+		err = encoder.CheckCount(uint64(actualCount), 2, r.Len())
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
 		// Read the unicode string
 		unc := make([]byte, actualCount*2)
 		err = binary.Read(r, le, unc)
@@ -0,0 +1,160 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package msrrp
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+// SkipKey can be returned by a WalkFunc to skip the subkeys of the current key.
+var SkipKey = errors.New("skip this key")
+
+// WalkFunc is called by WalkKey for every key in the tree. If the key could
+// not be opened or enumerated, e.g. due to access denied, err is set and
+// values is nil. Returning nil or SkipKey in that case skips the subtree and
+// continues the walk, while any other error aborts it. For readable keys,
+// returning SkipKey skips the subkeys of the key.
+type WalkFunc func(path string, values []ValueInfo, err error) error
+
+// KeyNode is a key in a tree captured by Snapshot.
+type KeyNode struct {
+	Name    string
+	Path    string
+	Values  []ValueInfo
+	SubKeys []*KeyNode
+	Err     error // Set if the key could not be read
+}
+
+// WalkKey recursively walks the key at the given path and its subkeys in
+// depth first order, calling fn for each key. The handles used by the walk are
+// closed as soon as the key has been visited and are not cached by the Client.
+func (c *Client) WalkKey(path string, fn WalkFunc) (err error) {
+	root, subkey, err := ParseKeyPath(path)
+	if err != nil {
+		return
+	}
+	hRoot, err := c.openRoot(root)
+	if err != nil {
+		return
+	}
+	err = c.walk(hRoot, RootKeyNameMap[root], subkey, fn)
+	if err == SkipKey {
+		err = nil
+	}
+	return
+}
+
+func (c *Client) walk(hRoot []byte, rootName, subkey string, fn WalkFunc) (err error) {
+	path := rootName
+	if subkey != "" {
+		path += "\\" + subkey
+	}
+	hKey := hRoot
+	if subkey != "" {
+		hKey, err = c.rpc.OpenSubKeyExt(hRoot, subkey, 0, PermKeyQueryValue|PermKeyEnumerateSubKeys|c.view)
+		if err != nil {
+			return skipOnNil(fn(path, nil, err))
+		}
+		defer c.rpc.CloseKeyHandle(hKey)
+	}
+
+	values, err := c.rpc.EnumValues(hKey)
+	if err != nil {
+		return skipOnNil(fn(path, nil, err))
+	}
+	err = fn(path, values, nil)
+	if err != nil {
+		return
+	}
+
+	names, err := c.enumSubKeys(hKey)
+	if err != nil {
+		return skipOnNil(fn(path, nil, err))
+	}
+	for _, name := range names {
+		childKey := name
+		if subkey != "" {
+			childKey = subkey + "\\" + name
+		}
+		err = c.walk(hRoot, rootName, childKey, fn)
+		if err == SkipKey {
+			err = nil
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func skipOnNil(err error) error {
+	if err == nil {
+		return SkipKey
+	}
+	return err
+}
+
+// Subkeys are enumerated by index until the server reports that there are no
+// more items instead of relying on the count from QueryKeyInfo, which may
+// change while enumerating.
+func (c *Client) enumSubKeys(hKey []byte) (names []string, err error) {
+	for i := uint32(0); ; i++ {
+		var info *KeyInfo
+		info, err = c.rpc.EnumKey(hKey, i)
+		if err == ReturnCodeMap[ErrorNoMoreItems] {
+			return names, nil
+		} else if err != nil {
+			return
+		}
+		names = append(names, msdtyp.StripNullByte(info.KeyName))
+	}
+}
+
+// Snapshot captures the key at the given path and all its subkeys and values.
+// Subtrees that could not be read are included with Err set.
+func (c *Client) Snapshot(path string) (tree *KeyNode, err error) {
+	nodes := make(map[string]*KeyNode)
+	err = c.WalkKey(path, func(keyPath string, values []ValueInfo, err error) error {
+		if node, found := nodes[keyPath]; found {
+			// Subkeys could not be enumerated after the values were read
+			node.Err = err
+			return nil
+		}
+		node := &KeyNode{
+			Name:   keyPath[strings.LastIndex(keyPath, "\\")+1:],
+			Path:   keyPath,
+			Values: values,
+			Err:    err,
+		}
+		if tree == nil {
+			tree = node
+		} else if parent, found := nodes[keyPath[:strings.LastIndex(keyPath, "\\")]]; found {
+			parent.SubKeys = append(parent.SubKeys, node)
+		}
+		nodes[keyPath] = node
+		return nil
+	})
+	return
+}
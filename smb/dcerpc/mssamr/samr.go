@@ -1702,7 +1702,16 @@ func (sb *RPCCon) QueryUserAllInfo(domainHandle *SamrHandle, userRid uint32) (in
 	defer sb.SamrCloseHandle(userHandle)
 
 	result, err := sb.SamrGetUserInfo2(userHandle, UserAllInformation)
-	info = result.(*SamprUserAllInformation)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	info, ok := result.(*SamprUserAllInformation)
+	if !ok {
+		err = fmt.Errorf("SamrQueryInformationUser2 returned an unexpected information class")
+		log.Errorln(err)
+		return
+	}
 
 	return
 }
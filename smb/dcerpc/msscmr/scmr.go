@@ -71,6 +71,16 @@ const (
 	ServiceInteractiveProcess uint32 = 0x00000100
 )
 
+// Win32 services of either type, for use with EnumServicesStatus
+const ServiceWin32 uint32 = ServiceWin32OwnProcess | ServiceWin32ShareProcess
+
+// MS-SCMR Section 3.1.4.14 REnumServicesStatusW dwServiceState
+const (
+	ServiceActive   uint32 = 0x00000001
+	ServiceInactive uint32 = 0x00000002
+	ServiceStateAll uint32 = 0x00000003
+)
+
 var ServiceTypeStatusMap = map[uint32]string{
 	ServiceKernelDriver:                                  "SERVICE_KERNEL_DRIVER",
 	ServiceFileSystemDriver:                              "SERVICE_FILE_SYSTEM_DRIVER",
@@ -947,12 +957,12 @@ func (sb *RPCCon) CreateService(
 		// When Argc is 0 I need to marshal 0x00000000 for Argc and same for Argv e.g., 4 bytes combined of 0s
 
 		ssBuf, err2 := ssReq.MarshalBinary()
-		if err != nil {
+		if err2 != nil {
 			return err2
 		}
 
 		buffer, err2 := sb.MakeIoCtlRequest(SvcCtlRStartServiceW, ssBuf)
-		if err != nil {
+		if err2 != nil {
 			return err2
 		}
 
@@ -1074,11 +1084,12 @@ func (sb *RPCCon) EnumServicesStatus(serviceType, serviceState uint32) (result [
 	if res.ReturnCode != ErrorMoreData {
 		status, found := ServiceResponseCodeMap[res.ReturnCode]
 		if !found {
-			log.Errorf("Received unknown return code for REnumServicesStatus: 0x%x\n", res.ReturnCode)
+			err = fmt.Errorf("Received unknown return code for REnumServicesStatus: 0x%x\n", res.ReturnCode)
+			log.Errorln(err)
 			return
 		}
 		log.Errorf("Failed to enumerate services status with error (return value: 0x%x): %v\n", res.ReturnCode, status)
-		return
+		return nil, status
 	}
 
 	log.Debugf("Bytes needed: %d\n", res.BytesNeeded)
@@ -1108,11 +1119,12 @@ func (sb *RPCCon) EnumServicesStatus(serviceType, serviceState uint32) (result [
 	if res.ReturnCode != ErrorSuccess {
 		status, found := ServiceResponseCodeMap[res.ReturnCode]
 		if !found {
-			log.Errorf("Received unknown return code for REnumServicesStatus: 0x%x\n", res.ReturnCode)
+			err = fmt.Errorf("Received unknown return code for REnumServicesStatus: 0x%x\n", res.ReturnCode)
+			log.Errorln(err)
 			return
 		}
 		log.Errorf("Failed to enumerate services status with error (return value: 0x%x): %v\n", res.ReturnCode, status)
-		return
+		return nil, status
 	}
 
 	log.Debugf("Bytes needed: %d\n", res.BytesNeeded)
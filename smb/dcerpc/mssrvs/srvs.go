@@ -307,11 +307,21 @@ func (sb *RPCCon) NetShareEnumAll(host string) (res []NetShare, err error) {
 		return nil, responseCode
 	}
 
-	res = make([]NetShare, response.TotalEntries)
 	var ctr1 *ShareInfoContainer1
-	ctr1 = response.InfoStruct.ShareInfo.(*ShareInfoContainer1)
+	ok := false
+	if response.InfoStruct != nil {
+		ctr1, ok = response.InfoStruct.ShareInfo.(*ShareInfoContainer1)
+	}
+	if !ok || ctr1 == nil {
+		err = fmt.Errorf("NetShareEnumAll returned an unexpected share info level")
+		log.Errorln(err)
+		return
+	}
+	// TotalEntries is the number of shares on the server which may differ from
+	// the number of entries actually returned
+	res = make([]NetShare, len(ctr1.Buffer))
 
-	for i := 0; i < int(response.TotalEntries); i++ {
+	for i := 0; i < len(ctr1.Buffer); i++ {
 		res[i].Name = ctr1.Buffer[i].Name
 		res[i].Comment = ctr1.Buffer[i].Comment
 
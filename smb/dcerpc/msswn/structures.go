@@ -0,0 +1,326 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// The marshal/unmarshal of requests and responses according to the NDR syntax
+// has been implemented on a per RPC request basis and not in any complete way.
+// As such, for each new functionality, a manual marshal and unmarshal method
+// has to be written for the relevant messages. This makes it a bit easier to
+// define the message structs but more of the heavy lifting has to be performed
+// by the marshal/unmarshal functions.
+
+package msswn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+)
+
+type RPCCon struct {
+	*dcerpc.ServiceBind
+}
+
+// Size of an encoded WITNESS_INTERFACE_INFO
+const interfaceInfoSize = 552
+
+// MS-SWN Section 2.2.2.5 WITNESS_INTERFACE_INFO
+type InterfaceInfo struct {
+	GroupName string
+	Version   uint32
+	State     uint16
+	IPv4      net.IP
+	IPv6      net.IP
+	Flags     uint32
+}
+
+// MS-SWN Section 3.1.4.1 WitnessrGetInterfaceList
+type GetInterfaceListRes struct {
+	Interfaces []InterfaceInfo
+	ReturnCode uint32
+}
+
+// MS-SWN Section 3.1.4.2 WitnessrRegister
+type RegisterReq struct {
+	Version            uint32
+	NetName            string
+	IpAddress          string
+	ClientComputerName string
+}
+
+// MS-SWN Section 3.1.4.5 WitnessrRegisterEx
+type RegisterExReq struct {
+	Version            uint32
+	NetName            string
+	ShareName          string
+	IpAddress          string
+	ClientComputerName string
+	Flags              uint32
+	KeepAliveTimeout   uint32
+}
+
+// Response of WitnessrRegister and WitnessrRegisterEx
+type RegisterRes struct {
+	ContextHandle []byte
+	ReturnCode    uint32
+}
+
+// MS-SWN Section 2.2.2.1 RESOURCE_CHANGE
+type ResourceChange struct {
+	ChangeType   uint32
+	ResourceName string
+}
+
+// MS-SWN Section 2.2.2.2 IPADDR_INFO
+type IPAddrInfo struct {
+	Flags uint32
+	IPv4  net.IP
+	IPv6  net.IP
+}
+
+// MS-SWN Section 2.2.2.3 IPADDR_INFO_LIST
+type IPAddrInfoList struct {
+	Addresses []IPAddrInfo
+}
+
+// Notification is the decoded RESP_ASYNC_NOTIFY. ResourceChanges is set for
+// WitnessNotifyResourceChange and IPAddrLists for the other message types.
+type Notification struct {
+	MessageType     uint32
+	ResourceChanges []ResourceChange
+	IPAddrLists     []IPAddrInfoList
+}
+
+// MS-SWN Section 3.1.4.4 WitnessrAsyncNotify
+type AsyncNotifyRes struct {
+	Notification *Notification
+	ReturnCode   uint32
+}
+
+func (self *GetInterfaceListRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of GetInterfaceListRes")
+}
+
+func (self *GetInterfaceListRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for GetInterfaceListRes")
+	if len(buf) < 8 {
+		return fmt.Errorf("Buffer to small for GetInterfaceListRes")
+	}
+	r := bytes.NewReader(buf)
+	var refId uint32
+	err = binary.Read(r, le, &refId)
+	if err != nil {
+		return
+	}
+	if refId != 0 {
+		var count, arrayPtr uint32
+		binary.Read(r, le, &count)
+		err = binary.Read(r, le, &arrayPtr)
+		if err != nil {
+			return
+		}
+		if arrayPtr != 0 {
+			var maxCount uint32
+			err = binary.Read(r, le, &maxCount)
+			if err != nil {
+				return
+			}
+			if int(maxCount)*interfaceInfoSize > r.Len() {
+				return fmt.Errorf("Buffer to small for WITNESS_INTERFACE_INFO array")
+			}
+			for i := uint32(0); i < maxCount; i++ {
+				entry := make([]byte, interfaceInfoSize)
+				r.Read(entry)
+				var info InterfaceInfo
+				info.GroupName, err = msdtyp.FromUnicodeString(entry[:520])
+				if err != nil {
+					return
+				}
+				info.GroupName = strings.TrimRight(info.GroupName, "\x00")
+				info.Version = le.Uint32(entry[520:])
+				info.State = le.Uint16(entry[524:])
+				// The addresses are in network byte order
+				info.IPv4 = net.IP(append([]byte{}, entry[528:532]...))
+				info.IPv6 = net.IP(append([]byte{}, entry[532:548]...))
+				info.Flags = le.Uint32(entry[548:])
+				self.Interfaces = append(self.Interfaces, info)
+			}
+		}
+	}
+	return binary.Read(r, le, &self.ReturnCode)
+}
+
+func (self *RegisterReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for RegisterReq")
+	w := bytes.NewBuffer(res)
+	refId := uint32(1)
+	binary.Write(w, le, self.Version)
+	for _, s := range []string{self.NetName, self.IpAddress, self.ClientComputerName} {
+		_, err = msdtyp.WriteConformantVaryingStringPtr(w, s, &refId, true)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	return w.Bytes(), nil
+}
+
+func (self *RegisterReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of RegisterReq")
+}
+
+func (self *RegisterExReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for RegisterExReq")
+	w := bytes.NewBuffer(res)
+	refId := uint32(1)
+	binary.Write(w, le, self.Version)
+	for _, s := range []string{self.NetName, self.ShareName, self.IpAddress, self.ClientComputerName} {
+		_, err = msdtyp.WriteConformantVaryingStringPtr(w, s, &refId, true)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	binary.Write(w, le, self.Flags)
+	binary.Write(w, le, self.KeepAliveTimeout)
+	return w.Bytes(), nil
+}
+
+func (self *RegisterExReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of RegisterExReq")
+}
+
+func (self *RegisterRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of RegisterRes")
+}
+
+func (self *RegisterRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for RegisterRes")
+	if len(buf) < 24 {
+		return fmt.Errorf("Buffer to small for RegisterRes")
+	}
+	self.ContextHandle = make([]byte, 20)
+	copy(self.ContextHandle, buf[:20])
+	self.ReturnCode = le.Uint32(buf[20:])
+	return
+}
+
+func (self *AsyncNotifyRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of AsyncNotifyRes")
+}
+
+func (self *AsyncNotifyRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for AsyncNotifyRes")
+	if len(buf) < 8 {
+		return fmt.Errorf("Buffer to small for AsyncNotifyRes")
+	}
+	r := bytes.NewReader(buf)
+	var refId uint32
+	err = binary.Read(r, le, &refId)
+	if err != nil {
+		return
+	}
+	if refId != 0 {
+		var length, numMessages, bufPtr uint32
+		n := &Notification{}
+		binary.Read(r, le, &n.MessageType)
+		binary.Read(r, le, &length)
+		binary.Read(r, le, &numMessages)
+		err = binary.Read(r, le, &bufPtr)
+		if err != nil {
+			return
+		}
+		if bufPtr != 0 {
+			var maxCount uint32
+			err = binary.Read(r, le, &maxCount)
+			if err != nil {
+				return
+			}
+			if maxCount < length || int(maxCount) > r.Len() {
+				return fmt.Errorf("Invalid size of MessageBuffer in AsyncNotifyRes")
+			}
+			msgBuf := make([]byte, maxCount)
+			_, err = io.ReadFull(r, msgBuf)
+			if err != nil {
+				return
+			}
+			r.Seek(int64((4-maxCount%4)%4), io.SeekCurrent)
+			err = n.parseMessages(msgBuf[:length], numMessages)
+			if err != nil {
+				return
+			}
+		}
+		self.Notification = n
+	}
+	return binary.Read(r, le, &self.ReturnCode)
+}
+
+func (self *Notification) parseMessages(buf []byte, count uint32) (err error) {
+	for i := uint32(0); i < count; i++ {
+		if len(buf) < 8 {
+			return fmt.Errorf("Buffer to small for notification message")
+		}
+		length := int(le.Uint32(buf))
+		if length < 8 || length > len(buf) {
+			return fmt.Errorf("Invalid length of notification message")
+		}
+		msg := buf[:length]
+		buf = buf[length:]
+		switch self.MessageType {
+		case WitnessNotifyResourceChange:
+			var rc ResourceChange
+			rc.ChangeType = le.Uint32(msg[4:])
+			rc.ResourceName, err = msdtyp.FromUnicodeString(msg[8:])
+			if err != nil {
+				return
+			}
+			rc.ResourceName = strings.TrimRight(rc.ResourceName, "\x00")
+			self.ResourceChanges = append(self.ResourceChanges, rc)
+		case WitnessNotifyClientMove, WitnessNotifyShareMove, WitnessNotifyIPChange:
+			if length < 12 {
+				return fmt.Errorf("Buffer to small for IPADDR_INFO_LIST")
+			}
+			instances := int(le.Uint32(msg[8:]))
+			if 12+instances*24 > length {
+				return fmt.Errorf("Buffer to small for IPADDR_INFO_LIST")
+			}
+			var list IPAddrInfoList
+			for j := 0; j < instances; j++ {
+				entry := msg[12+j*24 : 12+(j+1)*24]
+				list.Addresses = append(list.Addresses, IPAddrInfo{
+					Flags: le.Uint32(entry),
+					IPv4:  net.IP(append([]byte{}, entry[4:8]...)),
+					IPv6:  net.IP(append([]byte{}, entry[8:24]...)),
+				})
+			}
+			self.IPAddrLists = append(self.IPAddrLists, list)
+		default:
+			return fmt.Errorf("Unknown witness notification type: %d", self.MessageType)
+		}
+	}
+	return
+}
@@ -0,0 +1,295 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package msswn implements a client for the Service Witness Protocol
+// (MS-SWN) used by SMB3 clients of clustered and Scale-Out file servers to
+// be notified when a resource, such as a network name or an IP address,
+// changes state and when the client is asked to move its connection to
+// another cluster node.
+//
+// The Witness service is only reachable over ncacn_ip_tcp on a dynamic port
+// that is resolved through the endpoint mapper with dcerpc.EpmMapTCP. The
+// binding must be authenticated, e.g., with dcerpc.BindAuthTCP.
+//
+// WitnessrAsyncNotify blocks until the server has a notification for the
+// registration, so it should be called on a binding that is not used for
+// anything else in the meantime.
+package msswn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/jfjallid/golog"
+)
+
+var (
+	log                  = golog.Get("github.com/ericblavier/go-smb/smb/dcerpc/msswn")
+	le  binary.ByteOrder = binary.LittleEndian
+)
+
+const (
+	MSRPCUuidWitness                = "ccd8c074-d0e5-4a40-92b4-d074faa6ba28"
+	MSRPCWitnessMajorVersion uint16 = 1
+	MSRPCWitnessMinorVersion uint16 = 1
+)
+
+// MSRPC Service Witness Protocol Operations
+const (
+	WitnessrGetInterfaceList uint16 = 0
+	WitnessrRegister         uint16 = 1
+	WitnessrUnRegister       uint16 = 2
+	WitnessrAsyncNotify      uint16 = 3
+	WitnessrRegisterEx       uint16 = 4
+)
+
+// MS-SWN Section 2.2.1.1 Protocol versions
+const (
+	WitnessV1 uint32 = 0x00010001
+	WitnessV2 uint32 = 0x00020000
+)
+
+// MS-SWN Section 2.2.2.5 WITNESS_INTERFACE_INFO State
+const (
+	InterfaceStateUnknown     uint16 = 0x0000
+	InterfaceStateAvailable   uint16 = 0x0001
+	InterfaceStateUnavailable uint16 = 0x00ff
+)
+
+// MS-SWN Section 2.2.2.5 WITNESS_INTERFACE_INFO Flags
+const (
+	InterfaceFlagIPv4      uint32 = 0x00000001
+	InterfaceFlagIPv6      uint32 = 0x00000002
+	InterfaceFlagWitnessIf uint32 = 0x00000004
+)
+
+// MS-SWN Section 3.1.4.5 WitnessrRegisterEx Flags
+const (
+	WitnessRegisterNone           uint32 = 0x00000000
+	WitnessRegisterIPNotification uint32 = 0x00000001
+)
+
+// MS-SWN Section 2.2.2.4 RESP_ASYNC_NOTIFY MessageType
+const (
+	WitnessNotifyResourceChange uint32 = 1
+	WitnessNotifyClientMove     uint32 = 2
+	WitnessNotifyShareMove      uint32 = 3
+	WitnessNotifyIPChange       uint32 = 4
+)
+
+// MS-SWN Section 2.2.2.1 RESOURCE_CHANGE ChangeType
+const (
+	ResourceStateUnknown     uint32 = 0x00000000
+	ResourceStateAvailable   uint32 = 0x00000001
+	ResourceStateUnavailable uint32 = 0x000000ff
+)
+
+// MS-SWN Section 2.2.2.2 IPADDR_INFO Flags
+const (
+	IPAddrV4      uint32 = 0x00000001
+	IPAddrV6      uint32 = 0x00000002
+	IPAddrOnline  uint32 = 0x00000008
+	IPAddrOffline uint32 = 0x00000010
+)
+
+const (
+	ErrorSuccess           uint32 = 0x00000000 // The operation completed successfully
+	ErrorAccessDenied      uint32 = 0x00000005 // Access is denied
+	ErrorInvalidParameter  uint32 = 0x00000057 // The parameter is incorrect
+	ErrorNoMoreItems       uint32 = 0x00000103 // No more data is available
+	ErrorAlreadyExists     uint32 = 0x000000b7 // Cannot create a file when that file already exists
+	ErrorNotFound          uint32 = 0x00000490 // Element not found
+	ErrorConnectionAborted uint32 = 0x000004d4 // The network connection was aborted by the local system
+	ErrorRevisionMismatch  uint32 = 0x0000051a // Indicates two revision levels are incompatible
+	ErrorTimeout           uint32 = 0x000005b4 // This operation returned because the timeout period expired
+	ErrorInvalidState      uint32 = 0x0000139f // The group or resource is not in the correct state to perform the requested operation
+)
+
+var ResponseCodeMap = map[uint32]error{
+	ErrorSuccess:           fmt.Errorf("The operation completed successfully"),
+	ErrorAccessDenied:      fmt.Errorf("Access is denied"),
+	ErrorInvalidParameter:  fmt.Errorf("The parameter is incorrect"),
+	ErrorNoMoreItems:       fmt.Errorf("No more data is available"),
+	ErrorAlreadyExists:     fmt.Errorf("A registration already exists"),
+	ErrorNotFound:          fmt.Errorf("Element not found"),
+	ErrorConnectionAborted: fmt.Errorf("The network connection was aborted by the local system"),
+	ErrorRevisionMismatch:  fmt.Errorf("Indicates two revision levels are incompatible"),
+	ErrorTimeout:           fmt.Errorf("This operation returned because the timeout period expired"),
+	ErrorInvalidState:      fmt.Errorf("The group or resource is not in the correct state to perform the requested operation"),
+}
+
+func NewRPCCon(sb *dcerpc.ServiceBind) *RPCCon {
+	return &RPCCon{sb}
+}
+
+func returnCodeToError(op string, code uint32) error {
+	status, found := ResponseCodeMap[code]
+	if !found {
+		return fmt.Errorf("Received unknown SWN return code for %s response: 0x%x", op, code)
+	}
+	return status
+}
+
+// GetInterfaceList returns the interfaces of the cluster nodes that a client
+// can use to register for notifications
+func (sb *RPCCon) GetInterfaceList() (interfaces []InterfaceInfo, err error) {
+	log.Debugln("In GetInterfaceList")
+	buffer, err := sb.MakeIoCtlRequest(WitnessrGetInterfaceList, nil)
+	if err != nil {
+		return
+	}
+	var resp GetInterfaceListRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		err = returnCodeToError("WitnessrGetInterfaceList", resp.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	return resp.Interfaces, nil
+}
+
+// Register registers for resource change notifications of the network name
+// using protocol version WitnessV1. ipAddress is the address of the cluster
+// node the client is connected to.
+func (sb *RPCCon) Register(netName, ipAddress, clientComputerName string) (handle []byte, err error) {
+	log.Debugln("In Register")
+	innerReq := RegisterReq{
+		Version:            WitnessV1,
+		NetName:            netName,
+		IpAddress:          ipAddress,
+		ClientComputerName: clientComputerName,
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return sb.register("WitnessrRegister", WitnessrRegister, innerBuf)
+}
+
+// RegisterEx registers for notifications of the network name and share using
+// protocol version WitnessV2. keepAliveTimeout is the number of seconds the
+// server waits before completing a pending AsyncNotify with ErrorTimeout.
+func (sb *RPCCon) RegisterEx(netName, shareName, ipAddress, clientComputerName string, flags, keepAliveTimeout uint32) (handle []byte, err error) {
+	log.Debugln("In RegisterEx")
+	innerReq := RegisterExReq{
+		Version:            WitnessV2,
+		NetName:            netName,
+		ShareName:          shareName,
+		IpAddress:          ipAddress,
+		ClientComputerName: clientComputerName,
+		Flags:              flags,
+		KeepAliveTimeout:   keepAliveTimeout,
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return sb.register("WitnessrRegisterEx", WitnessrRegisterEx, innerBuf)
+}
+
+func (sb *RPCCon) register(op string, opnum uint16, innerBuf []byte) (handle []byte, err error) {
+	buffer, err := sb.MakeIoCtlRequest(opnum, innerBuf)
+	if err != nil {
+		return
+	}
+	var resp RegisterRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		err = returnCodeToError(op, resp.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	return resp.ContextHandle, nil
+}
+
+// UnRegister removes the registration identified by the context handle
+func (sb *RPCCon) UnRegister(handle []byte) (err error) {
+	log.Debugln("In UnRegister")
+	if len(handle) != 20 {
+		return fmt.Errorf("Context handle must be 20 bytes")
+	}
+	buffer, err := sb.MakeIoCtlRequest(WitnessrUnRegister, handle)
+	if err != nil {
+		return
+	}
+	if len(buffer) < 4 {
+		return fmt.Errorf("Server response to WitnessrUnRegister was too small. Expected at atleast 4 bytes")
+	}
+	returnCode := le.Uint32(buffer)
+	if returnCode != ErrorSuccess {
+		err = returnCodeToError("WitnessrUnRegister", returnCode)
+		log.Errorln(err)
+	}
+	return
+}
+
+// AsyncNotify waits for the next notification of the registration. The call
+// returns ErrorTimeout from ResponseCodeMap when the keep alive timeout of a
+// RegisterEx registration expires without any notification.
+func (sb *RPCCon) AsyncNotify(handle []byte) (notification *Notification, err error) {
+	log.Debugln("In AsyncNotify")
+	if len(handle) != 20 {
+		return nil, fmt.Errorf("Context handle must be 20 bytes")
+	}
+	buffer, err := sb.MakeIoCtlRequest(WitnessrAsyncNotify, handle)
+	if err != nil {
+		return
+	}
+	var resp AsyncNotifyRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if resp.ReturnCode != ErrorSuccess {
+		err = returnCodeToError("WitnessrAsyncNotify", resp.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	if resp.Notification == nil {
+		return nil, fmt.Errorf("WitnessrAsyncNotify did not return a notification")
+	}
+	return resp.Notification, nil
+}
+
+// IPAddresses returns the IPv4 and IPv6 addresses of the interface
+func (self *InterfaceInfo) IPAddresses() (addrs []net.IP) {
+	if self.Flags&InterfaceFlagIPv4 != 0 {
+		addrs = append(addrs, self.IPv4)
+	}
+	if self.Flags&InterfaceFlagIPv6 != 0 {
+		addrs = append(addrs, self.IPv6)
+	}
+	return
+}
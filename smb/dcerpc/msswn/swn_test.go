@@ -0,0 +1,91 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package msswn
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"testing"
+)
+
+func TestRegisterExReq(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("000002000100000003000000000000000300000046005300000000000200000005000000000000000500000064006100740061000000000003000000090000000000000009000000310030002e0030002e0030002e003100000000000400000003000000000000000300000050004300000000000100000078000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := RegisterExReq{
+		Version:            WitnessV2,
+		NetName:            "FS",
+		ShareName:          "data",
+		IpAddress:          "10.0.0.1",
+		ClientComputerName: "PC",
+		Flags:              WitnessRegisterIPNotification,
+		KeepAliveTimeout:   120,
+	}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pkt, buf) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestAsyncNotifyRes(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("00000200010000000e00000001000000040002000e0000000e000000ff000000460053000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp AsyncNotifyRes
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ReturnCode != ErrorSuccess || resp.Notification == nil || len(resp.Notification.ResourceChanges) != 1 {
+		t.Fatal("Fail")
+	}
+	rc := resp.Notification.ResourceChanges[0]
+	if rc.ChangeType != ResourceStateUnavailable || rc.ResourceName != "FS" {
+		t.Fatal("Fail")
+	}
+
+	pkt, err = hex.DecodeString("000002000200000024000000010000000400020024000000240000000000000001000000090000000a0000020000000000000000000000000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = AsyncNotifyRes{}
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Notification == nil || resp.Notification.MessageType != WitnessNotifyClientMove || len(resp.Notification.IPAddrLists) != 1 {
+		t.Fatal("Fail")
+	}
+	addrs := resp.Notification.IPAddrLists[0].Addresses
+	if len(addrs) != 1 || addrs[0].Flags != IPAddrV4|IPAddrOnline || addrs[0].IPv4.String() != "10.0.0.2" {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,233 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//
+// The marshal/unmarshal of requests and responses according to the NDR syntax
+// has been implemented on a per RPC request basis and not in any complete way.
+// As such, for each new functionality, a manual marshal and unmarshal method
+// has to be written for the relevant messages. This makes it a bit easier to
+// define the message structs but more of the heavy lifting has to be performed
+// by the marshal/unmarshal functions.
+
+package mstsch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+)
+
+type RPCCon struct {
+	*dcerpc.ServiceBind
+}
+
+// MS-TSCH Section 3.2.5.4.2 SchRpcRegisterTask
+// No security descriptor or credentials are sent, so the task gets the
+// default security descriptor and runs as the principal of the XML.
+type SchRpcRegisterTaskReq struct {
+	Path      string // Optional
+	XML       string
+	Flags     uint32
+	LogonType uint32
+}
+
+type SchRpcRegisterTaskRes struct {
+	ActualPath string
+	ReturnCode uint32
+}
+
+// MS-TSCH Section 3.2.5.4.13 SchRpcRun
+// The task is run without arguments, flags or a session id.
+type SchRpcRunReq struct {
+	Path string
+}
+
+type SchRpcRunRes struct {
+	Guid       []byte // 16 byte GUID
+	ReturnCode uint32
+}
+
+// MS-TSCH Section 3.2.5.4.14 SchRpcDelete
+type SchRpcDeleteReq struct {
+	Path string
+}
+
+func (self *SchRpcRegisterTaskReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for SchRpcRegisterTaskReq")
+	if self.XML == "" {
+		return nil, fmt.Errorf("Invalid XML. Cannot be empty!")
+	}
+	w := bytes.NewBuffer(res)
+	refId := uint32(1)
+
+	_, err = msdtyp.WriteConformantVaryingStringPtr(w, self.Path, &refId, true)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	// Skip ReferentId ptr because this is not a unique ptr
+	_, err = msdtyp.WriteConformantVaryingString(w, self.XML, true)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Write(w, le, self.Flags)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	// NULL ptr for the security descriptor
+	err = binary.Write(w, le, uint32(0))
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Write(w, le, self.LogonType)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	// cCreds followed by a NULL ptr for pCreds
+	_, err = w.Write(make([]byte, 8))
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	return w.Bytes(), nil
+}
+
+func (self *SchRpcRegisterTaskReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of SchRpcRegisterTaskReq")
+}
+
+func (self *SchRpcRegisterTaskRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of SchRpcRegisterTaskRes")
+}
+
+func (self *SchRpcRegisterTaskRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for SchRpcRegisterTaskRes")
+	if len(buf) < 12 {
+		return fmt.Errorf("Buffer to small for SchRpcRegisterTaskRes")
+	}
+	// The HRESULT follows the error info, which is only parsed as far as
+	// needed to reach it, so it is read from the end
+	self.ReturnCode = le.Uint32(buf[len(buf)-4:])
+
+	r := bytes.NewReader(buf[:len(buf)-4])
+	var refId uint32
+	err = binary.Read(r, le, &refId)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if refId != 0 {
+		self.ActualPath, err = msdtyp.ReadConformantVaryingString(r, true)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	return
+}
+
+func (self *SchRpcRunReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for SchRpcRunReq")
+	if self.Path == "" {
+		return nil, fmt.Errorf("Invalid Path. Cannot be empty!")
+	}
+	w := bytes.NewBuffer(res)
+
+	// Skip ReferentId ptr because this is not a unique ptr
+	_, err = msdtyp.WriteConformantVaryingString(w, self.Path, true)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	// cArgs, NULL ptr for pArgs, flags, sessionId and NULL ptr for user
+	_, err = w.Write(make([]byte, 20))
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	return w.Bytes(), nil
+}
+
+func (self *SchRpcRunReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of SchRpcRunReq")
+}
+
+func (self *SchRpcRunRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of SchRpcRunRes")
+}
+
+func (self *SchRpcRunRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for SchRpcRunRes")
+	if len(buf) < 20 {
+		return fmt.Errorf("Buffer to small for SchRpcRunRes")
+	}
+	r := bytes.NewReader(buf)
+	self.Guid = make([]byte, 16)
+	_, err = io.ReadFull(r, self.Guid)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Read(r, le, &self.ReturnCode)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	return
+}
+
+func (self *SchRpcDeleteReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for SchRpcDeleteReq")
+	if self.Path == "" {
+		return nil, fmt.Errorf("Invalid Path. Cannot be empty!")
+	}
+	w := bytes.NewBuffer(res)
+
+	// Skip ReferentId ptr because this is not a unique ptr
+	_, err = msdtyp.WriteConformantVaryingString(w, self.Path, true)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	// Flags are reserved and must be 0
+	err = binary.Write(w, le, uint32(0))
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	return w.Bytes(), nil
+}
+
+func (self *SchRpcDeleteReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of SchRpcDeleteReq")
+}
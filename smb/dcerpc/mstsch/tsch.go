@@ -0,0 +1,209 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package mstsch implements a subset of the ITaskSchedulerService interface
+// of the Task Scheduler Service Remoting Protocol, enough to register, run
+// and delete a task.
+//
+// The server rejects requests that are not sent over a DCERPC binding that is
+// authenticated with packet privacy, so the ServiceBind should be created with
+// dcerpc.BindAuth and dcerpc.AuthLevelPktPrivacy.
+package mstsch
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/jfjallid/golog"
+)
+
+var (
+	log                  = golog.Get("github.com/ericblavier/go-smb/smb/dcerpc/mstsch")
+	le  binary.ByteOrder = binary.LittleEndian
+)
+
+const (
+	MSRPCUuidTsch                = "86D35949-83C9-4044-B424-DB363231FD0C"
+	MSRPCTschPipe                = "atsvc"
+	MSRPCTschMajorVersion uint16 = 1
+	MSRPCTschMinorVersion uint16 = 0
+)
+
+// MSRPC ITaskSchedulerService Operations
+const (
+	TschSchRpcRegisterTask uint16 = 1
+	TschSchRpcRun          uint16 = 12
+	TschSchRpcDelete       uint16 = 13
+)
+
+// MS-TSCH Section 3.2.5.4.2 registration flags
+const (
+	TaskValidateOnly               uint32 = 0x1
+	TaskCreate                     uint32 = 0x2
+	TaskUpdate                     uint32 = 0x4
+	TaskDisable                    uint32 = 0x8
+	TaskDontAddPrincipalAce        uint32 = 0x10
+	TaskIgnoreRegistrationTriggers uint32 = 0x20
+)
+
+// MS-TSCH Section 2.3.9 logon types
+const (
+	TaskLogonNone                       uint32 = 0
+	TaskLogonPassword                   uint32 = 1
+	TaskLogonS4U                        uint32 = 2
+	TaskLogonInteractiveToken           uint32 = 3
+	TaskLogonGroup                      uint32 = 4
+	TaskLogonServiceAccount             uint32 = 5
+	TaskLogonInteractiveTokenOrPassword uint32 = 6
+)
+
+// MS-TSCH Section 3.2.5.4.13 run flags
+const (
+	TaskRunAsSelf            uint32 = 0x1
+	TaskRunIgnoreConstraints uint32 = 0x2
+	TaskRunUseSessionId      uint32 = 0x4
+	TaskRunUserSid           uint32 = 0x8
+)
+
+const (
+	SOk                     uint32 = 0x00000000 // The operation completed successfully
+	EFileNotFound           uint32 = 0x80070002 // The system cannot find the file specified
+	EAccessDenied           uint32 = 0x80070005 // Access is denied
+	EInvalidArg             uint32 = 0x80070057 // The parameter is incorrect
+	EAlreadyExists          uint32 = 0x800700b7 // Cannot create a file when that file already exists
+	SchedEMalformedXML      uint32 = 0x8004131a // The task XML is malformed
+	SchedEInvalidTask       uint32 = 0x8004130e // The object is either an invalid task object or is not a task object
+	SchedEServiceNotRunning uint32 = 0x80041315 // The Task Scheduler service is not running
+)
+
+var ResponseCodeMap = map[uint32]error{
+	SOk:                     fmt.Errorf("The operation completed successfully"),
+	EFileNotFound:           fmt.Errorf("The system cannot find the file specified"),
+	EAccessDenied:           fmt.Errorf("Access is denied"),
+	EInvalidArg:             fmt.Errorf("The parameter is incorrect"),
+	EAlreadyExists:          fmt.Errorf("Cannot create a file when that file already exists"),
+	SchedEMalformedXML:      fmt.Errorf("The task XML is malformed"),
+	SchedEInvalidTask:       fmt.Errorf("The object is either an invalid task object or is not a task object"),
+	SchedEServiceNotRunning: fmt.Errorf("The Task Scheduler service is not running"),
+}
+
+func NewRPCCon(sb *dcerpc.ServiceBind) *RPCCon {
+	return &RPCCon{sb}
+}
+
+// decodeReturnCode maps an HRESULT returned by the server to an error
+func decodeReturnCode(name string, code uint32) error {
+	if code == SOk {
+		return nil
+	}
+	status, found := ResponseCodeMap[code]
+	if !found {
+		err := fmt.Errorf("Received unknown TSCH return code for %s response: 0x%x", name, code)
+		log.Errorln(err)
+		return err
+	}
+	log.Errorln(status)
+	return status
+}
+
+// RegisterTask registers the task defined by the XML at the path, e.g.,
+// \MyTask, and returns the path the server stored the task at. The task runs
+// as the principal defined in the XML.
+func (sb *RPCCon) RegisterTask(path, xml string, flags uint32) (actualPath string, err error) {
+	log.Debugln("In RegisterTask")
+	innerReq := SchRpcRegisterTaskReq{
+		Path:      path,
+		XML:       xml,
+		Flags:     flags,
+		LogonType: TaskLogonNone,
+	}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(TschSchRpcRegisterTask, innerBuf)
+	if err != nil {
+		return
+	}
+
+	var resp SchRpcRegisterTaskRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if err = decodeReturnCode("SchRpcRegisterTask", resp.ReturnCode); err != nil {
+		return
+	}
+	return resp.ActualPath, nil
+}
+
+// Run starts a registered task immediately and returns the GUID of the
+// running instance in its NDR wire format
+func (sb *RPCCon) Run(path string) (guid []byte, err error) {
+	log.Debugln("In Run")
+	innerReq := SchRpcRunReq{Path: path}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(TschSchRpcRun, innerBuf)
+	if err != nil {
+		return
+	}
+
+	var resp SchRpcRunRes
+	err = resp.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if err = decodeReturnCode("SchRpcRun", resp.ReturnCode); err != nil {
+		return
+	}
+	return resp.Guid, nil
+}
+
+// Delete removes a task or an empty folder
+func (sb *RPCCon) Delete(path string) (err error) {
+	log.Debugln("In Delete")
+	innerReq := SchRpcDeleteReq{Path: path}
+	innerBuf, err := innerReq.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	buffer, err := sb.MakeIoCtlRequest(TschSchRpcDelete, innerBuf)
+	if err != nil {
+		return
+	}
+	if len(buffer) < 4 {
+		return fmt.Errorf("Server response to SchRpcDelete was too small. Expected at atleast 4 bytes")
+	}
+	return decodeReturnCode("SchRpcDelete", le.Uint32(buffer))
+}
@@ -0,0 +1,124 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mstsch
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"testing"
+)
+
+func TestSchRpcRegisterTaskReq(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("01000000030000000000000003000000" + "5c0061000000" + "0000" +
+		"03000000000000000300000078003e000000" + "0000" +
+		"02000000" + "00000000" + "00000000" + "0000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := SchRpcRegisterTaskReq{Path: `\a`, XML: "x>", Flags: TaskCreate, LogonType: TaskLogonNone}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pkt, buf) {
+		t.Fatalf("Fail: %x", buf)
+	}
+}
+
+func TestSchRpcRegisterTaskRes(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("00000200030000000000000003000000" + "5c0061000000" + "0000" + "00000000" + "00000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp SchRpcRegisterTaskRes
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ActualPath != `\a` || resp.ReturnCode != SOk {
+		t.Fatalf("Fail: %+v", resp)
+	}
+
+	pkt, err = hex.DecodeString("00000000" + "00000000" + "05000780")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = SchRpcRegisterTaskRes{}
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ActualPath != "" || resp.ReturnCode != EAccessDenied {
+		t.Fatalf("Fail: %+v", resp)
+	}
+}
+
+func TestSchRpcRunReq(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("030000000000000003000000" + "5c0061000000" + "0000" + "0000000000000000000000000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := SchRpcRunReq{Path: `\a`}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pkt, buf) {
+		t.Fatalf("Fail: %x", buf)
+	}
+}
+
+func TestSchRpcRunRes(t *testing.T) {
+	pkt, err := hex.DecodeString("00112233445566778899aabbccddeeff" + "00000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp SchRpcRunRes
+	err = resp.UnmarshalBinary(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(resp.Guid) != "00112233445566778899aabbccddeeff" || resp.ReturnCode != SOk {
+		t.Fatalf("Fail: %+v", resp)
+	}
+}
+
+func TestSchRpcDeleteReq(t *testing.T) {
+	// Simple test to verify that the packet structure is valid
+	pkt, err := hex.DecodeString("030000000000000003000000" + "5c0061000000" + "0000" + "00000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := SchRpcDeleteReq{Path: `\a`}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pkt, buf) {
+		t.Fatalf("Fail: %x", buf)
+	}
+}
@@ -0,0 +1,955 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mswmi
+
+// Encoding and decoding of CIM objects according to MS-WMIO. Only the parts
+// needed to read classes and instances returned by a WMI server, and to
+// create instances used as method parameters, have been implemented.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// MS-WMIO Section 2.2.6 ObjectFlags
+const (
+	ObjectFlagClass      byte = 0x01
+	ObjectFlagInstance   byte = 0x02
+	ObjectFlagDecoration byte = 0x04
+	ObjectFlagPrototype  byte = 0x10
+	ObjectFlagKeyMissing byte = 0x40
+)
+
+// MS-WMIO Section 2.2.1.1 CimType
+const (
+	CimTypeSint16    uint32 = 2
+	CimTypeSint32    uint32 = 3
+	CimTypeReal32    uint32 = 4
+	CimTypeReal64    uint32 = 5
+	CimTypeString    uint32 = 8
+	CimTypeBoolean   uint32 = 11
+	CimTypeObject    uint32 = 13
+	CimTypeSint8     uint32 = 16
+	CimTypeUint8     uint32 = 17
+	CimTypeUint16    uint32 = 18
+	CimTypeUint32    uint32 = 19
+	CimTypeSint64    uint32 = 20
+	CimTypeUint64    uint32 = 21
+	CimTypeDatetime  uint32 = 101
+	CimTypeReference uint32 = 102
+	CimTypeChar16    uint32 = 103
+
+	CimArrayFlag     uint32 = 0x2000
+	CimInheritedFlag uint32 = 0x4000
+)
+
+const (
+	encodingUnitSignature uint32 = 0x12345678
+	heapLengthFlag        uint32 = 0x80000000
+	heapRefDictionaryFlag uint32 = 0x80000000
+	heapRefNone           uint32 = 0xffffffff
+)
+
+// MS-WMIO Section 2.2.26 NdTable flags of a property value
+const (
+	ndValueNull    byte = 0x01
+	ndValueDefault byte = 0x02
+)
+
+// MS-WMIO Section 2.2.82 Dictionary of well known strings referenced from
+// a heap reference with the most significant bit set.
+var dictionaryStrings = []string{
+	"'", "key", "", "read", "write", "volatile", "provider", "dynamic", "cimwin32", "DWORD", "CIMTYPE",
+}
+
+// Qualifier of a class, instance or property
+type Qualifier struct {
+	Name   string
+	Flavor byte
+	Type   uint32
+	Value  interface{}
+}
+
+// Property of a class or instance. Value is nil if the property is NULL.
+type Property struct {
+	Name       string
+	Type       uint32 // CimType without the inherited flag
+	Inherited  bool
+	Order      uint16
+	Qualifiers []Qualifier
+	Value      interface{}
+
+	valueOffset uint32
+	ndFlags     byte
+}
+
+// Method of a class with its input and output parameters described as
+// classes. In and Out are nil for methods without parameters.
+type Method struct {
+	Name string
+	In   *Object
+	Out  *Object
+}
+
+// Object is a decoded CIM class or instance
+type Object struct {
+	Flags      byte
+	ServerName string
+	Namespace  string
+	ClassName  string
+	// Names of the superclasses, with the closest superclass first
+	Derivation []string
+	Qualifiers []Qualifier
+	// Properties ordered by their declaration order
+	Properties []*Property
+	Methods    []Method
+
+	class *classPart
+}
+
+// Decoded ClassPart, kept to be able to encode instances of the class
+type classPart struct {
+	raw        []byte
+	name       string
+	derivation []string
+	qualifiers []Qualifier
+	properties []*Property
+	ndvtLength int
+}
+
+type decoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || d.off+n > len(d.buf) {
+		d.err = fmt.Errorf("Buffer to small for CIM object")
+		return nil
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *decoder) uint8() byte {
+	b := d.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) uint16() uint16 {
+	b := d.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return le.Uint16(b)
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return le.Uint32(b)
+}
+
+// IsClass reports whether the object is a CIM class
+func (self *Object) IsClass() bool {
+	return self.Flags&ObjectFlagClass != 0
+}
+
+// IsInstance reports whether the object is an instance of a CIM class
+func (self *Object) IsInstance() bool {
+	return self.Flags&ObjectFlagInstance != 0
+}
+
+// Property returns the property with the specified name or nil. Property
+// names are compared case insensitively.
+func (self *Object) Property(name string) *Property {
+	for _, p := range self.Properties {
+		if strings.EqualFold(p.Name, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Value returns the value of the named property and whether the property
+// exists.
+func (self *Object) Value(name string) (value interface{}, found bool) {
+	p := self.Property(name)
+	if p == nil {
+		return nil, false
+	}
+	return p.Value, true
+}
+
+// Method returns the method with the specified name or nil
+func (self *Object) Method(name string) *Method {
+	for i := range self.Methods {
+		if strings.EqualFold(self.Methods[i].Name, name) {
+			return &self.Methods[i]
+		}
+	}
+	return nil
+}
+
+// Set updates the value of a property of an instance. The value is
+// validated against the CIM type of the property when the instance is
+// encoded. A nil value makes the property NULL.
+func (self *Object) Set(name string, value interface{}) error {
+	if !self.IsInstance() {
+		return fmt.Errorf("Properties can only be set on instances")
+	}
+	p := self.Property(name)
+	if p == nil {
+		return fmt.Errorf("Property %s not found in class %s", name, self.ClassName)
+	}
+	p.Value = value
+	return nil
+}
+
+// SpawnInstance creates a new instance of the class with the default values
+// of the class properties.
+func (self *Object) SpawnInstance() (inst *Object, err error) {
+	if !self.IsClass() || self.class == nil {
+		return nil, fmt.Errorf("Instances can only be spawned from a class")
+	}
+	inst = &Object{
+		Flags:      ObjectFlagInstance | (self.Flags & ObjectFlagDecoration),
+		ServerName: self.ServerName,
+		Namespace:  self.Namespace,
+		ClassName:  self.ClassName,
+		Derivation: self.Derivation,
+		class:      self.class,
+	}
+	for _, p := range self.class.properties {
+		np := *p
+		inst.Properties = append(inst.Properties, &np)
+	}
+	return
+}
+
+func (self *Object) String() string {
+	var b strings.Builder
+	if self.IsClass() {
+		fmt.Fprintf(&b, "class %s", self.ClassName)
+	} else {
+		fmt.Fprintf(&b, "instance of %s", self.ClassName)
+	}
+	b.WriteString(" {\n")
+	for _, p := range self.Properties {
+		fmt.Fprintf(&b, "\t%s = %v;\n", p.Name, p.Value)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// UnmarshalBinary decodes a MS-WMIO EncodingUnit
+func (self *Object) UnmarshalBinary(buf []byte) (err error) {
+	if len(buf) < 9 {
+		return fmt.Errorf("Buffer to small for EncodingUnit")
+	}
+	if le.Uint32(buf) != encodingUnitSignature {
+		return fmt.Errorf("Invalid EncodingUnit signature: 0x%x", le.Uint32(buf))
+	}
+	length := le.Uint32(buf[4:])
+	if int(length) > len(buf)-8 {
+		return fmt.Errorf("Buffer to small for EncodingUnit")
+	}
+	return self.unmarshalObjectBlock(buf[8 : 8+length])
+}
+
+// MarshalBinary encodes an instance as a MS-WMIO EncodingUnit
+func (self *Object) MarshalBinary() (res []byte, err error) {
+	if !self.IsInstance() || self.class == nil {
+		return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of CIM classes")
+	}
+	block := []byte{self.Flags & (ObjectFlagInstance | ObjectFlagDecoration)}
+	if self.Flags&ObjectFlagDecoration != 0 {
+		block = append(block, encodeString(self.ServerName)...)
+		block = append(block, encodeString(self.Namespace)...)
+	}
+	block = append(block, self.class.raw...)
+
+	heap := encodeString(self.ClassName)
+	ndLength := ndTableLength(len(self.class.properties))
+	ndvt := make([]byte, self.class.ndvtLength)
+	for _, p := range self.Properties {
+		if p.Value == nil {
+			ndvt[int(p.Order)/4] |= ndValueNull << ((p.Order % 4) * 2)
+			continue
+		}
+		size := valueSize(p.Type)
+		offset := ndLength + int(p.valueOffset)
+		if size == 0 || offset+size > len(ndvt) {
+			return nil, fmt.Errorf("Invalid value table offset for property %s", p.Name)
+		}
+		heap, err = encodeValue(p.Type, p.Value, ndvt[offset:offset+size], heap)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode property %s: %s", p.Name, err)
+		}
+	}
+
+	w := bytes.NewBuffer(nil)
+	binary.Write(w, le, uint32(0)) // EncodingLength
+	w.WriteByte(0)                 // InstanceFlags
+	binary.Write(w, le, uint32(0)) // InstanceClassName
+	w.Write(ndvt)
+	binary.Write(w, le, uint32(4)) // Empty InstanceQualifierSet
+	w.WriteByte(1)                 // No InstancePropQualifierSet
+	binary.Write(w, le, uint32(len(heap))|heapLengthFlag)
+	w.Write(heap)
+	instance := w.Bytes()
+	le.PutUint32(instance, uint32(len(instance)))
+	block = append(block, instance...)
+
+	res = make([]byte, 8, 8+len(block))
+	le.PutUint32(res, encodingUnitSignature)
+	le.PutUint32(res[4:], uint32(len(block)))
+	res = append(res, block...)
+	return
+}
+
+func (self *Object) unmarshalObjectBlock(buf []byte) (err error) {
+	d := &decoder{buf: buf}
+	self.Flags = d.uint8()
+	if d.err != nil {
+		return d.err
+	}
+	if self.Flags&ObjectFlagDecoration != 0 {
+		var n int
+		self.ServerName, n, err = decodeEncodedString(buf[d.off:])
+		if err != nil {
+			return
+		}
+		d.off += n
+		self.Namespace, n, err = decodeEncodedString(buf[d.off:])
+		if err != nil {
+			return
+		}
+		d.off += n
+	}
+
+	switch {
+	case self.Flags&ObjectFlagClass != 0:
+		// Skip the ClassAndMethodsPart of the parent class
+		var n int
+		_, n, err = decodeClassPart(buf[d.off:])
+		if err != nil {
+			return
+		}
+		d.off += n
+		_, n, err = decodeMethodsPart(buf[d.off:])
+		if err != nil {
+			return
+		}
+		d.off += n
+
+		var cp *classPart
+		cp, n, err = decodeClassPart(buf[d.off:])
+		if err != nil {
+			return
+		}
+		d.off += n
+		self.Methods, _, err = decodeMethodsPart(buf[d.off:])
+		if err != nil {
+			return
+		}
+		self.setClass(cp)
+		self.Properties = cp.properties
+	case self.Flags&ObjectFlagInstance != 0:
+		var cp *classPart
+		var n int
+		cp, n, err = decodeClassPart(buf[d.off:])
+		if err != nil {
+			return
+		}
+		d.off += n
+		self.setClass(cp)
+		err = self.decodeInstance(buf[d.off:])
+	default:
+		return fmt.Errorf("Unsupported CIM object flags: 0x%x", self.Flags)
+	}
+	return
+}
+
+func (self *Object) setClass(cp *classPart) {
+	self.class = cp
+	self.ClassName = cp.name
+	self.Derivation = cp.derivation
+	self.Qualifiers = cp.qualifiers
+}
+
+// MS-WMIO Section 2.2.53 InstanceType following the CurrentClass
+func (self *Object) decodeInstance(buf []byte) (err error) {
+	cp := self.class
+	d := &decoder{buf: buf}
+	length := d.uint32()
+	if d.err != nil || int(length) > len(buf) {
+		return fmt.Errorf("Buffer to small for InstanceType")
+	}
+	d.buf = buf[:length]
+	d.uint8()  // InstanceFlags
+	d.uint32() // InstanceClassName
+	ndvt := d.bytes(cp.ndvtLength)
+	qualifierSet := d.bytes(int(d.uint32()) - 4)
+	var propQualifierSets [][]byte
+	if d.uint8() == 2 {
+		for range cp.properties {
+			propQualifierSets = append(propQualifierSets, d.bytes(int(d.uint32())-4))
+		}
+	}
+	heapLength := d.uint32() &^ heapLengthFlag
+	heap := d.bytes(int(heapLength))
+	if d.err != nil {
+		return d.err
+	}
+
+	if len(qualifierSet) > 0 {
+		var qualifiers []Qualifier
+		qualifiers, err = decodeQualifiers(qualifierSet, heap)
+		if err != nil {
+			return
+		}
+		self.Qualifiers = append(append([]Qualifier{}, self.Qualifiers...), qualifiers...)
+	}
+
+	ndLength := ndTableLength(len(cp.properties))
+	for i, cprop := range cp.properties {
+		p := *cprop
+		p.ndFlags = (ndvt[int(p.Order)/4] >> ((p.Order % 4) * 2)) & 0x3
+		switch {
+		case p.ndFlags&ndValueNull != 0:
+			p.Value = nil
+		case p.ndFlags&ndValueDefault != 0:
+			// Keep the default value of the class
+		default:
+			size := valueSize(p.Type)
+			offset := ndLength + int(p.valueOffset)
+			if size == 0 || offset+size > len(ndvt) {
+				return fmt.Errorf("Invalid value table offset for property %s", p.Name)
+			}
+			p.Value, err = decodeValue(p.Type, ndvt[offset:offset+size], heap)
+			if err != nil {
+				return
+			}
+		}
+		if i < len(propQualifierSets) && len(propQualifierSets[i]) > 0 {
+			var qualifiers []Qualifier
+			qualifiers, err = decodeQualifiers(propQualifierSets[i], heap)
+			if err != nil {
+				return
+			}
+			p.Qualifiers = append(append([]Qualifier{}, p.Qualifiers...), qualifiers...)
+		}
+		self.Properties = append(self.Properties, &p)
+	}
+	return
+}
+
+// MS-WMIO Section 2.2.15 ClassPart
+func decodeClassPart(buf []byte) (cp *classPart, n int, err error) {
+	d := &decoder{buf: buf}
+	length := d.uint32()
+	if d.err != nil || length < 13 || int(length) > len(buf) {
+		return nil, 0, fmt.Errorf("Buffer to small for ClassPart")
+	}
+	d.buf = buf[:length]
+	cp = &classPart{raw: buf[:length]}
+	d.uint8() // ReservedOctet
+	classNameRef := d.uint32()
+	cp.ndvtLength = int(d.uint32())
+
+	derivationList := d.bytes(int(d.uint32()) - 4)
+	qualifierSet := d.bytes(int(d.uint32()) - 4)
+	propertyCount := int(d.uint32())
+	lookupTable := d.bytes(propertyCount * 8)
+	ndvt := d.bytes(cp.ndvtLength)
+	heapLength := d.uint32() &^ heapLengthFlag
+	heap := d.bytes(int(heapLength))
+	if d.err != nil {
+		return nil, 0, d.err
+	}
+
+	cp.name, err = heapString(heap, classNameRef)
+	if err != nil {
+		return
+	}
+	for len(derivationList) > 0 {
+		var s string
+		var sLen int
+		s, sLen, err = decodeEncodedString(derivationList)
+		if err != nil {
+			return
+		}
+		if len(derivationList) < sLen+4 {
+			return nil, 0, fmt.Errorf("Buffer to small for DerivationList")
+		}
+		cp.derivation = append(cp.derivation, s)
+		derivationList = derivationList[sLen+4:]
+	}
+	cp.qualifiers, err = decodeQualifiers(qualifierSet, heap)
+	if err != nil {
+		return
+	}
+
+	ndLength := ndTableLength(propertyCount)
+	if ndLength > len(ndvt) {
+		return nil, 0, fmt.Errorf("Buffer to small for NdTable")
+	}
+	for i := 0; i < propertyCount; i++ {
+		p := &Property{}
+		p.Name, err = heapString(heap, le.Uint32(lookupTable[i*8:]))
+		if err != nil {
+			return
+		}
+		infoRef := le.Uint32(lookupTable[i*8+4:])
+		if int(infoRef)+18 > len(heap) {
+			return nil, 0, fmt.Errorf("Invalid PropertyInfo reference for property %s", p.Name)
+		}
+		info := heap[infoRef:]
+		p.Type = le.Uint32(info) &^ CimInheritedFlag
+		p.Inherited = le.Uint32(info)&CimInheritedFlag != 0
+		p.Order = le.Uint16(info[4:])
+		p.valueOffset = le.Uint32(info[6:])
+		// Skip ClassOfOrigin
+		qsLength := int(le.Uint32(info[14:]))
+		if qsLength < 4 || 14+qsLength > len(info) {
+			return nil, 0, fmt.Errorf("Buffer to small for PropertyQualifierSet")
+		}
+		p.Qualifiers, err = decodeQualifiers(info[18:14+qsLength], heap)
+		if err != nil {
+			return
+		}
+		if int(p.Order)/4 >= ndLength {
+			return nil, 0, fmt.Errorf("Invalid declaration order for property %s", p.Name)
+		}
+		p.ndFlags = (ndvt[int(p.Order)/4] >> ((p.Order % 4) * 2)) & 0x3
+		if p.ndFlags&ndValueNull == 0 {
+			size := valueSize(p.Type)
+			offset := ndLength + int(p.valueOffset)
+			if size == 0 || offset+size > len(ndvt) {
+				return nil, 0, fmt.Errorf("Invalid value table offset for property %s", p.Name)
+			}
+			p.Value, err = decodeValue(p.Type, ndvt[offset:offset+size], heap)
+			if err != nil {
+				return
+			}
+		}
+		cp.properties = append(cp.properties, p)
+	}
+	sort.Slice(cp.properties, func(i, j int) bool {
+		return cp.properties[i].Order < cp.properties[j].Order
+	})
+	return cp, int(length), nil
+}
+
+// MS-WMIO Section 2.2.38 MethodsPart
+func decodeMethodsPart(buf []byte) (methods []Method, n int, err error) {
+	d := &decoder{buf: buf}
+	length := d.uint32()
+	if d.err != nil || length < 8 || int(length) > len(buf) {
+		return nil, 0, fmt.Errorf("Buffer to small for MethodsPart")
+	}
+	d.buf = buf[:length]
+	count := int(d.uint16())
+	d.uint16() // MethodCountPadding
+	descriptions := d.bytes(count * 24)
+	heapLength := d.uint32() &^ heapLengthFlag
+	heap := d.bytes(int(heapLength))
+	if d.err != nil {
+		return nil, 0, d.err
+	}
+	for i := 0; i < count; i++ {
+		desc := descriptions[i*24:]
+		var m Method
+		m.Name, err = heapString(heap, le.Uint32(desc))
+		if err != nil {
+			return
+		}
+		m.In, err = decodeMethodSignature(heap, le.Uint32(desc[16:]))
+		if err != nil {
+			return
+		}
+		m.Out, err = decodeMethodSignature(heap, le.Uint32(desc[20:]))
+		if err != nil {
+			return
+		}
+		methods = append(methods, m)
+	}
+	return methods, int(length), nil
+}
+
+// MS-WMIO Section 2.2.70 MethodSignatureBlock
+func decodeMethodSignature(heap []byte, ref uint32) (obj *Object, err error) {
+	if ref == heapRefNone {
+		return nil, nil
+	}
+	if int(ref)+4 > len(heap) {
+		return nil, fmt.Errorf("Invalid MethodSignature reference")
+	}
+	length := le.Uint32(heap[ref:])
+	if length == 0 {
+		return nil, nil
+	}
+	if int(ref)+4+int(length) > len(heap) {
+		return nil, fmt.Errorf("Buffer to small for MethodSignatureBlock")
+	}
+	obj = &Object{}
+	err = obj.unmarshalObjectBlock(heap[ref+4 : ref+4+length])
+	return
+}
+
+// MS-WMIO Section 2.2.59 QualifierSet without the leading EncodingLength
+func decodeQualifiers(buf []byte, heap []byte) (qualifiers []Qualifier, err error) {
+	for len(buf) > 0 {
+		if len(buf) < 9 {
+			return nil, fmt.Errorf("Buffer to small for Qualifier")
+		}
+		var q Qualifier
+		q.Name, err = heapString(heap, le.Uint32(buf))
+		if err != nil {
+			return
+		}
+		q.Flavor = buf[4]
+		q.Type = le.Uint32(buf[5:]) &^ CimInheritedFlag
+		size := valueSize(q.Type)
+		if size == 0 || len(buf) < 9+size {
+			return nil, fmt.Errorf("Buffer to small for value of qualifier %s", q.Name)
+		}
+		q.Value, err = decodeValue(q.Type, buf[9:9+size], heap)
+		if err != nil {
+			return
+		}
+		qualifiers = append(qualifiers, q)
+		buf = buf[9+size:]
+	}
+	return
+}
+
+func ndTableLength(propertyCount int) int {
+	return (propertyCount*2 + 7) / 8
+}
+
+// valueSize returns the size of an encoded value in a value table or 0 for
+// unknown types.
+func valueSize(cimType uint32) int {
+	if cimType&CimArrayFlag != 0 {
+		return 4
+	}
+	switch cimType {
+	case CimTypeSint8, CimTypeUint8:
+		return 1
+	case CimTypeSint16, CimTypeUint16, CimTypeChar16, CimTypeBoolean:
+		return 2
+	case CimTypeSint32, CimTypeUint32, CimTypeReal32:
+		return 4
+	case CimTypeSint64, CimTypeUint64, CimTypeReal64:
+		return 8
+	case CimTypeString, CimTypeDatetime, CimTypeReference, CimTypeObject:
+		return 4
+	}
+	return 0
+}
+
+func decodeValue(cimType uint32, buf []byte, heap []byte) (value interface{}, err error) {
+	if cimType&CimArrayFlag == 0 {
+		return decodeScalar(cimType, buf, heap)
+	}
+	ref := le.Uint32(buf)
+	if ref == heapRefNone {
+		return nil, nil
+	}
+	if int(ref)+4 > len(heap) {
+		return nil, fmt.Errorf("Invalid array reference")
+	}
+	elemType := cimType &^ CimArrayFlag
+	size := valueSize(elemType)
+	count := int(le.Uint32(heap[ref:]))
+	items := heap[ref+4:]
+	if size == 0 || count*size > len(items) {
+		return nil, fmt.Errorf("Buffer to small for array of CIM type %d", elemType)
+	}
+	values := make([]interface{}, count)
+	for i := range values {
+		values[i], err = decodeScalar(elemType, items[i*size:(i+1)*size], heap)
+		if err != nil {
+			return
+		}
+	}
+	return values, nil
+}
+
+func decodeScalar(cimType uint32, buf []byte, heap []byte) (value interface{}, err error) {
+	switch cimType {
+	case CimTypeSint8:
+		return int8(buf[0]), nil
+	case CimTypeUint8:
+		return buf[0], nil
+	case CimTypeSint16:
+		return int16(le.Uint16(buf)), nil
+	case CimTypeUint16, CimTypeChar16:
+		return le.Uint16(buf), nil
+	case CimTypeSint32:
+		return int32(le.Uint32(buf)), nil
+	case CimTypeUint32:
+		return le.Uint32(buf), nil
+	case CimTypeSint64:
+		return int64(le.Uint64(buf)), nil
+	case CimTypeUint64:
+		return le.Uint64(buf), nil
+	case CimTypeReal32:
+		return math.Float32frombits(le.Uint32(buf)), nil
+	case CimTypeReal64:
+		return math.Float64frombits(le.Uint64(buf)), nil
+	case CimTypeBoolean:
+		return le.Uint16(buf) != 0, nil
+	case CimTypeString, CimTypeDatetime, CimTypeReference:
+		return heapString(heap, le.Uint32(buf))
+	case CimTypeObject:
+		ref := le.Uint32(buf)
+		if ref == heapRefNone {
+			return nil, nil
+		}
+		if int(ref)+4 > len(heap) {
+			return nil, fmt.Errorf("Invalid embedded object reference")
+		}
+		length := le.Uint32(heap[ref:])
+		if int(ref)+4+int(length) > len(heap) {
+			return nil, fmt.Errorf("Buffer to small for embedded object")
+		}
+		obj := &Object{}
+		err = obj.unmarshalObjectBlock(heap[ref+4 : ref+4+length])
+		return obj, err
+	}
+	return nil, fmt.Errorf("Unsupported CIM type %d", cimType)
+}
+
+func heapString(heap []byte, ref uint32) (s string, err error) {
+	if ref == heapRefNone {
+		return "", nil
+	}
+	if ref&heapRefDictionaryFlag != 0 {
+		idx := int(ref &^ heapRefDictionaryFlag)
+		if idx >= len(dictionaryStrings) {
+			return "", fmt.Errorf("Unknown dictionary string reference %d", idx)
+		}
+		return dictionaryStrings[idx], nil
+	}
+	if int(ref) >= len(heap) {
+		return "", fmt.Errorf("Invalid heap reference 0x%x", ref)
+	}
+	s, _, err = decodeEncodedString(heap[ref:])
+	return
+}
+
+// MS-WMIO Section 2.2.78 Encoded-String. Returns the string and the number of
+// bytes consumed including the flag and the null terminator.
+func decodeEncodedString(buf []byte) (s string, n int, err error) {
+	if len(buf) == 0 {
+		return "", 0, fmt.Errorf("Buffer to small for Encoded-String")
+	}
+	switch buf[0] {
+	case 0:
+		end := bytes.IndexByte(buf[1:], 0)
+		if end < 0 {
+			return "", 0, fmt.Errorf("Unterminated Encoded-String")
+		}
+		runes := make([]rune, end)
+		for i, c := range buf[1 : 1+end] {
+			runes[i] = rune(c)
+		}
+		return string(runes), end + 2, nil
+	case 1:
+		var chars []uint16
+		for i := 1; i+1 < len(buf); i += 2 {
+			c := le.Uint16(buf[i:])
+			if c == 0 {
+				return string(utf16.Decode(chars)), i + 2, nil
+			}
+			chars = append(chars, c)
+		}
+		return "", 0, fmt.Errorf("Unterminated Encoded-String")
+	}
+	return "", 0, fmt.Errorf("Invalid Encoded-String flag: %d", buf[0])
+}
+
+func encodeString(s string) []byte {
+	compressed := true
+	for _, c := range s {
+		if c > 0xff {
+			compressed = false
+			break
+		}
+	}
+	if compressed {
+		res := []byte{0}
+		for _, c := range s {
+			res = append(res, byte(c))
+		}
+		return append(res, 0)
+	}
+	res := []byte{1}
+	for _, c := range utf16.Encode([]rune(s)) {
+		res = binary.LittleEndian.AppendUint16(res, c)
+	}
+	return append(res, 0, 0)
+}
+
+// encodeValue writes the encoded value into dst and appends any referenced
+// data to the heap.
+func encodeValue(cimType uint32, value interface{}, dst []byte, heap []byte) ([]byte, error) {
+	if cimType&CimArrayFlag == 0 {
+		return encodeScalar(cimType, value, dst, heap)
+	}
+	var items []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		items = v
+	case []string:
+		for _, s := range v {
+			items = append(items, s)
+		}
+	default:
+		return nil, fmt.Errorf("Expected a slice for an array value, got %T", value)
+	}
+	elemType := cimType &^ CimArrayFlag
+	size := valueSize(elemType)
+	ref := len(heap)
+	le.PutUint32(dst, uint32(ref))
+	heap = binary.LittleEndian.AppendUint32(heap, uint32(len(items)))
+	heap = append(heap, make([]byte, size*len(items))...)
+	var err error
+	for i, item := range items {
+		elem := make([]byte, size)
+		heap, err = encodeScalar(elemType, item, elem, heap)
+		if err != nil {
+			return nil, err
+		}
+		copy(heap[ref+4+i*size:], elem)
+	}
+	return heap, nil
+}
+
+func encodeScalar(cimType uint32, value interface{}, dst []byte, heap []byte) ([]byte, error) {
+	switch cimType {
+	case CimTypeString, CimTypeDatetime, CimTypeReference:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("Expected a string value, got %T", value)
+		}
+		le.PutUint32(dst, uint32(len(heap)))
+		return append(heap, encodeString(s)...), nil
+	case CimTypeBoolean:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("Expected a bool value, got %T", value)
+		}
+		if b {
+			le.PutUint16(dst, 0xffff)
+		} else {
+			le.PutUint16(dst, 0)
+		}
+		return heap, nil
+	case CimTypeReal32, CimTypeReal64:
+		var f float64
+		switch v := value.(type) {
+		case float32:
+			f = float64(v)
+		case float64:
+			f = v
+		default:
+			return nil, fmt.Errorf("Expected a float value, got %T", value)
+		}
+		if cimType == CimTypeReal32 {
+			le.PutUint32(dst, math.Float32bits(float32(f)))
+		} else {
+			le.PutUint64(dst, math.Float64bits(f))
+		}
+		return heap, nil
+	case CimTypeObject:
+		obj, ok := value.(*Object)
+		if !ok {
+			return nil, fmt.Errorf("Expected an *Object value, got %T", value)
+		}
+		buf, err := obj.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		// Strip the EncodingUnit signature, keeping the length prefixed ObjectBlock
+		le.PutUint32(dst, uint32(len(heap)))
+		return append(heap, buf[4:]...), nil
+	}
+
+	var n uint64
+	switch v := value.(type) {
+	case int:
+		n = uint64(v)
+	case int8:
+		n = uint64(v)
+	case int16:
+		n = uint64(v)
+	case int32:
+		n = uint64(v)
+	case int64:
+		n = uint64(v)
+	case uint:
+		n = uint64(v)
+	case uint8:
+		n = uint64(v)
+	case uint16:
+		n = uint64(v)
+	case uint32:
+		n = uint64(v)
+	case uint64:
+		n = v
+	default:
+		return nil, fmt.Errorf("Expected an integer value, got %T", value)
+	}
+	switch valueSize(cimType) {
+	case 1:
+		dst[0] = byte(n)
+	case 2:
+		le.PutUint16(dst, uint16(n))
+	case 4:
+		le.PutUint32(dst, uint32(n))
+	case 8:
+		le.PutUint64(dst, n)
+	default:
+		return nil, fmt.Errorf("Unsupported CIM type %d", cimType)
+	}
+	return heap, nil
+}
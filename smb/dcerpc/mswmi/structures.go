@@ -0,0 +1,389 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+// The marshal/unmarshal of requests and responses according to the NDR syntax
+// has been implemented on a per RPC request basis and not in any complete way.
+// As such, for each new functionality, a manual marshal and unmarshal method
+// has to be written for the relevant messages. This makes it a bit easier to
+// define the message structs but more of the heavy lifting has to be performed
+// by the marshal/unmarshal functions.
+
+package mswmi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+// The ORPCTHIS and ORPCTHAT of the calls are handled by
+// msdcom.InterfacePointer.Call so the structs only contain the method
+// specific parameters.
+
+// MS-WMI Section 3.1.4.1.4 IWbemLevel1Login::NTLMLogin
+type NTLMLoginReq struct {
+	NetworkResource string
+	PreferredLocale string
+	Flags           int32
+}
+
+type NTLMLoginRes struct {
+	Namespace  []byte // OBJREF of the IWbemServices interface
+	ReturnCode uint32
+}
+
+// MS-WMI Section 3.1.4.3.20 IWbemServices::ExecQuery
+type ExecQueryReq struct {
+	QueryLanguage string
+	Query         string
+	Flags         int32
+}
+
+type ExecQueryRes struct {
+	Enum       []byte // OBJREF of the IEnumWbemClassObject interface
+	ReturnCode uint32
+}
+
+// MS-WMI Section 3.1.4.3.4 IWbemServices::GetObject
+type GetObjectReq struct {
+	ObjectPath string
+	Flags      int32
+}
+
+type GetObjectRes struct {
+	Object     []byte // OBJREF of the IWbemClassObject
+	CallResult []byte
+	ReturnCode uint32
+}
+
+// MS-WMI Section 3.1.4.3.24 IWbemServices::ExecMethod
+type ExecMethodReq struct {
+	ObjectPath string
+	MethodName string
+	Flags      int32
+	InParams   []byte // OBJREF of the IWbemClassObject or nil
+}
+
+type ExecMethodRes struct {
+	OutParams  []byte // OBJREF of the IWbemClassObject
+	CallResult []byte
+	ReturnCode uint32
+}
+
+// MS-WMI Section 3.1.4.4.2 IEnumWbemClassObject::Next
+type EnumNextReq struct {
+	Timeout int32
+	Count   uint32
+}
+
+type EnumNextRes struct {
+	Objects    [][]byte // OBJREFs of the IWbemClassObjects
+	Returned   uint32
+	ReturnCode uint32
+}
+
+func alignWriter(w *bytes.Buffer, n int) {
+	if pad := (n - w.Len()%n) % n; pad > 0 {
+		w.Write(make([]byte, pad))
+	}
+}
+
+func alignReader(r *bytes.Reader, n int64) (err error) {
+	offset := r.Size() - int64(r.Len())
+	if pad := (n - offset%n) % n; pad > 0 {
+		_, err = r.Seek(pad, 1)
+	}
+	return
+}
+
+// MS-OAUT Section 2.2.23.2 BSTR encoded as a unique pointer to a
+// FLAGGED_WORD_BLOB. The string is null terminated.
+func writeBSTR(w *bytes.Buffer, s string, refId *uint32) {
+	data := utf16.Encode([]rune(s + "\x00"))
+	binary.Write(w, le, *refId)
+	*refId++
+	binary.Write(w, le, uint32(len(data))) // MaxCount
+	binary.Write(w, le, uint32(len(data)*2))
+	binary.Write(w, le, uint32(len(data)))
+	binary.Write(w, le, data)
+	alignWriter(w, 4)
+}
+
+// Write an interface pointer as a unique pointer to an MInterfacePointer
+func writeInterfacePointer(w *bytes.Buffer, objRef []byte, refId *uint32) {
+	if objRef == nil {
+		binary.Write(w, le, uint32(0))
+		return
+	}
+	binary.Write(w, le, *refId)
+	*refId++
+	binary.Write(w, le, uint32(len(objRef))) // MaxCount
+	binary.Write(w, le, uint32(len(objRef))) // ulCntData
+	w.Write(objRef)
+	alignWriter(w, 4)
+}
+
+func readMInterfacePointer(r *bytes.Reader) (data []byte, err error) {
+	var maxCount, cntData uint32
+	binary.Read(r, le, &maxCount)
+	err = binary.Read(r, le, &cntData)
+	if err != nil {
+		return
+	}
+	if cntData > maxCount || int(cntData) > r.Len() {
+		return nil, fmt.Errorf("Invalid size of MInterfacePointer")
+	}
+	data = make([]byte, cntData)
+	_, err = r.Read(data)
+	if err != nil {
+		return
+	}
+	err = alignReader(r, 4)
+	return
+}
+
+// Read a unique pointer to an interface pointer
+func readInterfacePointer(r *bytes.Reader) (data []byte, err error) {
+	var ptr uint32
+	err = binary.Read(r, le, &ptr)
+	if err != nil || ptr == 0 {
+		return
+	}
+	return readMInterfacePointer(r)
+}
+
+// Read an [in, out, unique] pointer to an interface pointer
+func readInterfacePointerPtr(r *bytes.Reader) (data []byte, err error) {
+	var ptr uint32
+	err = binary.Read(r, le, &ptr)
+	if err != nil || ptr == 0 {
+		return
+	}
+	return readInterfacePointer(r)
+}
+
+func (self *NTLMLoginReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for NTLMLoginReq")
+	w := bytes.NewBuffer(res)
+	refId := uint32(1)
+	_, err = msdtyp.WriteConformantVaryingStringPtr(w, self.NetworkResource, &refId, true)
+	if err != nil {
+		return
+	}
+	_, err = msdtyp.WriteConformantVaryingStringPtr(w, self.PreferredLocale, &refId, true)
+	if err != nil {
+		return
+	}
+	binary.Write(w, le, self.Flags)
+	writeInterfacePointer(w, nil, &refId) // pCtx
+	return w.Bytes(), nil
+}
+
+func (self *NTLMLoginReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of NTLMLoginReq")
+}
+
+func (self *NTLMLoginRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of NTLMLoginRes")
+}
+
+func (self *NTLMLoginRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for NTLMLoginRes")
+	if len(buf) < 8 {
+		return fmt.Errorf("Buffer to small for NTLMLoginRes")
+	}
+	r := bytes.NewReader(buf)
+	self.Namespace, err = readInterfacePointer(r)
+	if err != nil {
+		return
+	}
+	return binary.Read(r, le, &self.ReturnCode)
+}
+
+func (self *ExecQueryReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for ExecQueryReq")
+	w := bytes.NewBuffer(res)
+	refId := uint32(1)
+	writeBSTR(w, self.QueryLanguage, &refId)
+	writeBSTR(w, self.Query, &refId)
+	binary.Write(w, le, self.Flags)
+	writeInterfacePointer(w, nil, &refId) // pCtx
+	return w.Bytes(), nil
+}
+
+func (self *ExecQueryReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of ExecQueryReq")
+}
+
+func (self *ExecQueryRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of ExecQueryRes")
+}
+
+func (self *ExecQueryRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for ExecQueryRes")
+	if len(buf) < 8 {
+		return fmt.Errorf("Buffer to small for ExecQueryRes")
+	}
+	r := bytes.NewReader(buf)
+	self.Enum, err = readInterfacePointer(r)
+	if err != nil {
+		return
+	}
+	return binary.Read(r, le, &self.ReturnCode)
+}
+
+func (self *GetObjectReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for GetObjectReq")
+	w := bytes.NewBuffer(res)
+	refId := uint32(1)
+	writeBSTR(w, self.ObjectPath, &refId)
+	binary.Write(w, le, self.Flags)
+	writeInterfacePointer(w, nil, &refId) // pCtx
+	// ppObject must be non-null to receive the object
+	binary.Write(w, le, refId)
+	refId++
+	writeInterfacePointer(w, nil, &refId)
+	writeInterfacePointer(w, nil, &refId) // ppCallResult
+	return w.Bytes(), nil
+}
+
+func (self *GetObjectReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of GetObjectReq")
+}
+
+func (self *GetObjectRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of GetObjectRes")
+}
+
+func (self *GetObjectRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for GetObjectRes")
+	if len(buf) < 12 {
+		return fmt.Errorf("Buffer to small for GetObjectRes")
+	}
+	r := bytes.NewReader(buf)
+	self.Object, err = readInterfacePointerPtr(r)
+	if err != nil {
+		return
+	}
+	self.CallResult, err = readInterfacePointerPtr(r)
+	if err != nil {
+		return
+	}
+	return binary.Read(r, le, &self.ReturnCode)
+}
+
+func (self *ExecMethodReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for ExecMethodReq")
+	w := bytes.NewBuffer(res)
+	refId := uint32(1)
+	writeBSTR(w, self.ObjectPath, &refId)
+	writeBSTR(w, self.MethodName, &refId)
+	binary.Write(w, le, self.Flags)
+	writeInterfacePointer(w, nil, &refId) // pCtx
+	writeInterfacePointer(w, self.InParams, &refId)
+	// ppOutParams must be non-null to receive the output parameters
+	binary.Write(w, le, refId)
+	refId++
+	writeInterfacePointer(w, nil, &refId)
+	writeInterfacePointer(w, nil, &refId) // ppCallResult
+	return w.Bytes(), nil
+}
+
+func (self *ExecMethodReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of ExecMethodReq")
+}
+
+func (self *ExecMethodRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of ExecMethodRes")
+}
+
+func (self *ExecMethodRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for ExecMethodRes")
+	if len(buf) < 12 {
+		return fmt.Errorf("Buffer to small for ExecMethodRes")
+	}
+	r := bytes.NewReader(buf)
+	self.OutParams, err = readInterfacePointerPtr(r)
+	if err != nil {
+		return
+	}
+	self.CallResult, err = readInterfacePointerPtr(r)
+	if err != nil {
+		return
+	}
+	return binary.Read(r, le, &self.ReturnCode)
+}
+
+func (self *EnumNextReq) MarshalBinary() (res []byte, err error) {
+	log.Debugln("In MarshalBinary for EnumNextReq")
+	res = make([]byte, 8)
+	le.PutUint32(res, uint32(self.Timeout))
+	le.PutUint32(res[4:], self.Count)
+	return
+}
+
+func (self *EnumNextReq) UnmarshalBinary(buf []byte) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of EnumNextReq")
+}
+
+func (self *EnumNextRes) MarshalBinary() ([]byte, error) {
+	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of EnumNextRes")
+}
+
+func (self *EnumNextRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for EnumNextRes")
+	if len(buf) < 20 {
+		return fmt.Errorf("Buffer to small for EnumNextRes")
+	}
+	r := bytes.NewReader(buf)
+	var maxCount, offset, actualCount uint32
+	binary.Read(r, le, &maxCount)
+	binary.Read(r, le, &offset)
+	err = binary.Read(r, le, &actualCount)
+	if err != nil {
+		return
+	}
+	if int(actualCount)*4 > r.Len() {
+		return fmt.Errorf("Buffer to small for EnumNextRes")
+	}
+	ptrs := make([]uint32, actualCount)
+	err = binary.Read(r, le, ptrs)
+	if err != nil {
+		return
+	}
+	for _, ptr := range ptrs {
+		if ptr == 0 {
+			continue
+		}
+		var objRef []byte
+		objRef, err = readMInterfacePointer(r)
+		if err != nil {
+			return
+		}
+		self.Objects = append(self.Objects, objRef)
+	}
+	binary.Read(r, le, &self.Returned)
+	return binary.Read(r, le, &self.ReturnCode)
+}
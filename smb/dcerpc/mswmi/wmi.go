@@ -0,0 +1,484 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package mswmi implements a client for the Windows Management
+// Instrumentation Remote Protocol (MS-WMI) on top of DCOM. It supports
+// logging in to a namespace, executing WQL queries, retrieving objects and
+// executing methods, e.g., Win32_Process.Create. Returned CIM objects are
+// decoded according to MS-WMIO.
+package mswmi
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/dcerpc/msdcom"
+	"github.com/jfjallid/golog"
+)
+
+var (
+	log                  = golog.Get("github.com/ericblavier/go-smb/smb/dcerpc/mswmi")
+	le  binary.ByteOrder = binary.LittleEndian
+)
+
+const (
+	ClsidStrWbemLevel1Login          = "8bc3f05e-d86b-11d0-a075-00c04fb68820"
+	ClsidStrWbemClassObject          = "4590f812-1d3a-11d0-891f-00aa004b2e24"
+	IidStrIWbemLevel1Login           = "f309ad18-d86a-11d0-a075-00c04fb68820"
+	IidStrIWbemServices              = "9556dc99-828c-11cf-a37e-00aa003240c7"
+	IidStrIEnumWbemClassObject       = "027947e1-d731-11ce-a357-000000000001"
+	IidStrIWbemClassObject           = "dc12a681-737f-11cf-884d-00aa004b2e24"
+	IidStrIWbemCallResult            = "44aca675-e8fc-11d0-a07c-00c04fb68820"
+	DefaultNamespace                 = "//./root/cimv2"
+	QueryLanguageWQL                 = "WQL"
+	WbemInfinite               int32 = -1
+)
+
+var (
+	ClsidWbemLevel1Login    = msdtyp.MustGuidFromString(ClsidStrWbemLevel1Login)
+	ClsidWbemClassObject    = msdtyp.MustGuidFromString(ClsidStrWbemClassObject)
+	IidIWbemLevel1Login     = msdtyp.MustGuidFromString(IidStrIWbemLevel1Login)
+	IidIWbemServices        = msdtyp.MustGuidFromString(IidStrIWbemServices)
+	IidIEnumWbemClassObject = msdtyp.MustGuidFromString(IidStrIEnumWbemClassObject)
+	IidIWbemClassObject     = msdtyp.MustGuidFromString(IidStrIWbemClassObject)
+)
+
+// MSRPC IWbemLevel1Login Operations
+const (
+	WbemLevel1LoginEstablishPosition uint16 = 3
+	WbemLevel1LoginRequestChallenge  uint16 = 4
+	WbemLevel1LoginWBEMLogin         uint16 = 5
+	WbemLevel1LoginNTLMLogin         uint16 = 6
+)
+
+// MSRPC IWbemServices Operations
+const (
+	WbemServicesOpenNamespace      uint16 = 3
+	WbemServicesGetObject          uint16 = 6
+	WbemServicesCreateInstanceEnum uint16 = 18
+	WbemServicesExecQuery          uint16 = 20
+	WbemServicesExecMethod         uint16 = 24
+)
+
+// MSRPC IEnumWbemClassObject Operations
+const (
+	EnumWbemClassObjectReset uint16 = 3
+	EnumWbemClassObjectNext  uint16 = 4
+	EnumWbemClassObjectSkip  uint16 = 7
+)
+
+// MS-WMI Section 2.2.3 WBEM_GENERIC_FLAG_TYPE
+const (
+	WbemFlagReturnWbemComplete   int32 = 0x00000000
+	WbemFlagReturnImmediately    int32 = 0x00000010
+	WbemFlagForwardOnly          int32 = 0x00000020
+	WbemFlagDirectRead           int32 = 0x00000200
+	WbemFlagUseAmendedQualifiers int32 = 0x00020000
+	WbemFlagPrototype            int32 = 0x00000002
+	WbemFlagSendStatus           int32 = 0x00000080
+	WbemFlagEnsureLocatable      int32 = 0x00000100
+)
+
+// MS-WMI Section 2.2.11 WBEMSTATUS
+const (
+	WbemSNoError                 uint32 = 0x00000000
+	WbemSFalse                   uint32 = 0x00000001
+	WbemSTimedout                uint32 = 0x00040004
+	WbemEFailed                  uint32 = 0x80041001
+	WbemENotFound                uint32 = 0x80041002
+	WbemEAccessDenied            uint32 = 0x80041003
+	WbemEProviderFailure         uint32 = 0x80041004
+	WbemETypeMismatch            uint32 = 0x80041005
+	WbemEOutOfMemory             uint32 = 0x80041006
+	WbemEInvalidContext          uint32 = 0x80041007
+	WbemEInvalidParameter        uint32 = 0x80041008
+	WbemENotAvailable            uint32 = 0x80041009
+	WbemECriticalError           uint32 = 0x8004100a
+	WbemENotSupported            uint32 = 0x8004100c
+	WbemEInvalidNamespace        uint32 = 0x8004100e
+	WbemEInvalidObject           uint32 = 0x8004100f
+	WbemEInvalidClass            uint32 = 0x80041010
+	WbemEInvalidQuery            uint32 = 0x80041017
+	WbemEInvalidQueryType        uint32 = 0x80041018
+	WbemEInvalidMethod           uint32 = 0x8004102e
+	WbemEInvalidMethodParameters uint32 = 0x8004102f
+	WbemEMethodNotImplemented    uint32 = 0x80041055
+	EAccessDenied                uint32 = 0x80070005
+)
+
+var ResponseCodeMap = map[uint32]error{
+	WbemSNoError:                 fmt.Errorf("The operation completed successfully"),
+	WbemSFalse:                   fmt.Errorf("The operation completed successfully but returned fewer elements than requested"),
+	WbemSTimedout:                fmt.Errorf("The call timed out"),
+	WbemEFailed:                  fmt.Errorf("The call failed"),
+	WbemENotFound:                fmt.Errorf("The object could not be found"),
+	WbemEAccessDenied:            fmt.Errorf("The current user does not have permission to perform the action"),
+	WbemEProviderFailure:         fmt.Errorf("The provider has failed at some time other than during initialization"),
+	WbemETypeMismatch:            fmt.Errorf("A type mismatch occurred"),
+	WbemEOutOfMemory:             fmt.Errorf("There was not enough memory for the operation"),
+	WbemEInvalidContext:          fmt.Errorf("The IWbemContext object is not valid"),
+	WbemEInvalidParameter:        fmt.Errorf("One of the parameters to the call is not correct"),
+	WbemENotAvailable:            fmt.Errorf("The resource, typically a remote server, is not currently available"),
+	WbemECriticalError:           fmt.Errorf("An internal, critical, and unexpected error occurred"),
+	WbemENotSupported:            fmt.Errorf("The feature or operation is not supported"),
+	WbemEInvalidNamespace:        fmt.Errorf("The namespace specified could not be found"),
+	WbemEInvalidObject:           fmt.Errorf("The specified instance is not valid"),
+	WbemEInvalidClass:            fmt.Errorf("The specified class is not valid"),
+	WbemEInvalidQuery:            fmt.Errorf("The query was not syntactically valid"),
+	WbemEInvalidQueryType:        fmt.Errorf("The requested query language is not supported"),
+	WbemEInvalidMethod:           fmt.Errorf("The requested method is not available"),
+	WbemEInvalidMethodParameters: fmt.Errorf("The parameters provided for the method are not valid"),
+	WbemEMethodNotImplemented:    fmt.Errorf("An attempt was made to execute a method not marked with [implemented] in any relevant class"),
+	EAccessDenied:                fmt.Errorf("Access is denied"),
+}
+
+func returnCodeToError(op string, code uint32) error {
+	status, found := ResponseCodeMap[code]
+	if !found {
+		return fmt.Errorf("Received unknown WMI return code for %s response: 0x%x", op, code)
+	}
+	return status
+}
+
+// Services is a client of the IWbemServices interface of a namespace
+type Services struct {
+	ip *msdcom.InterfacePointer
+}
+
+// Enumerator is a client of the IEnumWbemClassObject interface returned by
+// queries
+type Enumerator struct {
+	ip *msdcom.InterfacePointer
+}
+
+// Login activates the WMI service on the host of the DCOM connection and
+// logs in to the namespace, e.g., DefaultNamespace. Authentication is
+// performed as part of the DCERPC bindings of the connection.
+func Login(conn *msdcom.Connection, namespace string) (s *Services, err error) {
+	log.Debugln("In Login")
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	level1, err := conn.CreateInstance(ClsidWbemLevel1Login, IidIWbemLevel1Login)
+	if err != nil {
+		return
+	}
+	defer level1.Release()
+
+	req := NTLMLoginReq{NetworkResource: namespace}
+	innerBuf, err := req.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	buffer, err := level1.Call(WbemLevel1LoginNTLMLogin, innerBuf)
+	if err != nil {
+		return
+	}
+	var res NTLMLoginRes
+	err = res.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if res.ReturnCode != WbemSNoError {
+		err = returnCodeToError("NTLMLogin", res.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	if res.Namespace == nil {
+		return nil, fmt.Errorf("NTLMLogin did not return an IWbemServices interface")
+	}
+	ip, err := conn.InterfaceFromObjRef(res.Namespace)
+	if err != nil {
+		return
+	}
+	return &Services{ip: ip}, nil
+}
+
+// Release releases the IWbemServices interface
+func (self *Services) Release() error {
+	return self.ip.Release()
+}
+
+// ExecQuery executes a WQL query and returns an enumerator of the result.
+// If flags is 0, WbemFlagReturnImmediately | WbemFlagForwardOnly is used.
+func (self *Services) ExecQuery(query string, flags int32) (enum *Enumerator, err error) {
+	log.Debugln("In ExecQuery")
+	if flags == 0 {
+		flags = WbemFlagReturnImmediately | WbemFlagForwardOnly
+	}
+	req := ExecQueryReq{
+		QueryLanguage: QueryLanguageWQL,
+		Query:         query,
+		Flags:         flags,
+	}
+	innerBuf, err := req.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	buffer, err := self.ip.Call(WbemServicesExecQuery, innerBuf)
+	if err != nil {
+		return
+	}
+	var res ExecQueryRes
+	err = res.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if res.ReturnCode != WbemSNoError {
+		err = returnCodeToError("ExecQuery", res.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	if res.Enum == nil {
+		return nil, fmt.Errorf("ExecQuery did not return an IEnumWbemClassObject interface")
+	}
+	ip, err := self.ip.Connection().InterfaceFromObjRef(res.Enum)
+	if err != nil {
+		return
+	}
+	return &Enumerator{ip: ip}, nil
+}
+
+// Query executes a WQL query and returns all resulting objects
+func (self *Services) Query(query string) (objects []*Object, err error) {
+	enum, err := self.ExecQuery(query, 0)
+	if err != nil {
+		return
+	}
+	defer enum.Release()
+	return enum.All()
+}
+
+// GetObject retrieves a class or instance by its object path, e.g.,
+// "Win32_Process" or `Win32_Service.Name="Spooler"`.
+func (self *Services) GetObject(path string) (obj *Object, err error) {
+	log.Debugln("In GetObject")
+	req := GetObjectReq{ObjectPath: path}
+	innerBuf, err := req.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	buffer, err := self.ip.Call(WbemServicesGetObject, innerBuf)
+	if err != nil {
+		return
+	}
+	var res GetObjectRes
+	err = res.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if res.ReturnCode != WbemSNoError {
+		err = returnCodeToError("GetObject", res.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	if res.Object == nil {
+		return nil, fmt.Errorf("GetObject did not return an object")
+	}
+	return objectFromObjRef(res.Object)
+}
+
+// ExecMethod executes a method of a class or instance. The input parameters
+// are an instance spawned from the In class of the method, or nil for
+// methods without input parameters.
+func (self *Services) ExecMethod(path, method string, in *Object) (out *Object, err error) {
+	log.Debugln("In ExecMethod")
+	req := ExecMethodReq{
+		ObjectPath: path,
+		MethodName: method,
+	}
+	if in != nil {
+		req.InParams, err = objRefFromObject(in)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	innerBuf, err := req.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	buffer, err := self.ip.Call(WbemServicesExecMethod, innerBuf)
+	if err != nil {
+		return
+	}
+	var res ExecMethodRes
+	err = res.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if res.ReturnCode != WbemSNoError {
+		err = returnCodeToError("ExecMethod", res.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	if res.OutParams == nil {
+		return nil, nil
+	}
+	return objectFromObjRef(res.OutParams)
+}
+
+// CreateProcess starts a process on the remote host through the Create
+// method of the Win32_Process class. The returnValue is the result of the
+// method where 0 means success.
+func (self *Services) CreateProcess(commandLine, currentDirectory string) (processId, returnValue uint32, err error) {
+	class, err := self.GetObject("Win32_Process")
+	if err != nil {
+		return
+	}
+	method := class.Method("Create")
+	if method == nil || method.In == nil {
+		return 0, 0, fmt.Errorf("Win32_Process.Create method signature not found")
+	}
+	in, err := method.In.SpawnInstance()
+	if err != nil {
+		return
+	}
+	err = in.Set("CommandLine", commandLine)
+	if err != nil {
+		return
+	}
+	if currentDirectory != "" {
+		err = in.Set("CurrentDirectory", currentDirectory)
+		if err != nil {
+			return
+		}
+	}
+	out, err := self.ExecMethod("Win32_Process", "Create", in)
+	if err != nil {
+		return
+	}
+	if out == nil {
+		return 0, 0, fmt.Errorf("Win32_Process.Create did not return any output parameters")
+	}
+	if v, ok := out.Value("ReturnValue"); ok && v != nil {
+		returnValue, _ = v.(uint32)
+	}
+	if v, ok := out.Value("ProcessId"); ok && v != nil {
+		processId, _ = v.(uint32)
+	}
+	return
+}
+
+// Release releases the IEnumWbemClassObject interface
+func (self *Enumerator) Release() error {
+	return self.ip.Release()
+}
+
+// Next retrieves up to count objects waiting at most timeout milliseconds,
+// or WbemInfinite. done is true when the enumeration has completed.
+func (self *Enumerator) Next(timeout int32, count uint32) (objects []*Object, done bool, err error) {
+	log.Debugln("In Next")
+	req := EnumNextReq{Timeout: timeout, Count: count}
+	innerBuf, err := req.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	buffer, err := self.ip.Call(EnumWbemClassObjectNext, innerBuf)
+	if err != nil {
+		return
+	}
+	var res EnumNextRes
+	err = res.UnmarshalBinary(buffer)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	switch res.ReturnCode {
+	case WbemSNoError, WbemSTimedout:
+	case WbemSFalse:
+		done = true
+	default:
+		err = returnCodeToError("IEnumWbemClassObject::Next", res.ReturnCode)
+		log.Errorln(err)
+		return
+	}
+	for _, objRef := range res.Objects {
+		var obj *Object
+		obj, err = objectFromObjRef(objRef)
+		if err != nil {
+			return
+		}
+		objects = append(objects, obj)
+	}
+	return
+}
+
+// All retrieves all remaining objects of the enumeration
+func (self *Enumerator) All() (objects []*Object, err error) {
+	for {
+		var batch []*Object
+		var done bool
+		batch, done, err = self.Next(WbemInfinite, 10)
+		if err != nil {
+			return
+		}
+		objects = append(objects, batch...)
+		if done {
+			return
+		}
+	}
+}
+
+// Decode the CIM object in the OBJREF_CUSTOM of an IWbemClassObject
+func objectFromObjRef(buf []byte) (obj *Object, err error) {
+	var objRef msdcom.ObjRef
+	err = objRef.UnmarshalBinary(buf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if objRef.Flags != msdcom.ObjRefCustom {
+		return nil, fmt.Errorf("Expected an OBJREF_CUSTOM for an IWbemClassObject but got flags %d", objRef.Flags)
+	}
+	obj = &Object{}
+	err = obj.UnmarshalBinary(objRef.ObjectData)
+	if err != nil {
+		log.Errorln(err)
+	}
+	return
+}
+
+// Encode an instance as the OBJREF_CUSTOM of an IWbemClassObject
+func objRefFromObject(obj *Object) (res []byte, err error) {
+	data, err := obj.MarshalBinary()
+	if err != nil {
+		return
+	}
+	objRef := msdcom.ObjRef{
+		Flags:      msdcom.ObjRefCustom,
+		Iid:        IidIWbemClassObject,
+		Clsid:      ClsidWbemClassObject,
+		ObjectData: data,
+	}
+	return objRef.MarshalBinary()
+}
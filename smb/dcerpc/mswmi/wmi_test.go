@@ -0,0 +1,170 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mswmi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+
+	"testing"
+)
+
+func TestNTLMLoginReq(t *testing.T) {
+	pkt, err := hex.DecodeString("010000000f000000000000000f0000002f002f002e002f0072006f006f0074002f00630069006d007600320000000000000000000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := NTLMLoginReq{NetworkResource: DefaultNamespace}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, pkt) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestExecQueryReq(t *testing.T) {
+	pkt, err := hex.DecodeString("0100000004000000080000000400000057005100" + "4c000000" + "020000000200000004000000020000006100000030000000" + "00000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := ExecQueryReq{QueryLanguage: QueryLanguageWQL, Query: "a", Flags: WbemFlagReturnImmediately | WbemFlagForwardOnly}
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, pkt) {
+		t.Fatal("Fail")
+	}
+}
+
+// Build a minimal ClassPart with a string, an uint32 and a boolean property
+func testClassPart() []byte {
+	heap := encodeString("Test_Params")
+	type prop struct {
+		name    string
+		cimType uint32
+		offset  uint32
+	}
+	props := []prop{{"CommandLine", CimTypeString, 0}, {"ProcessId", CimTypeUint32, 4}, {"Hidden", CimTypeBoolean, 8}}
+	lookup := []byte{}
+	for i, p := range props {
+		nameRef := uint32(len(heap))
+		heap = append(heap, encodeString(p.name)...)
+		infoRef := uint32(len(heap))
+		heap = binary.LittleEndian.AppendUint32(heap, p.cimType)
+		heap = binary.LittleEndian.AppendUint16(heap, uint16(i))
+		heap = binary.LittleEndian.AppendUint32(heap, p.offset)
+		heap = binary.LittleEndian.AppendUint32(heap, 0) // ClassOfOrigin
+		heap = binary.LittleEndian.AppendUint32(heap, 4) // Empty qualifier set
+		lookup = binary.LittleEndian.AppendUint32(lookup, nameRef)
+		lookup = binary.LittleEndian.AppendUint32(lookup, infoRef)
+	}
+	ndvt := make([]byte, 11)
+	ndvt[0] = 0x15 // All properties are NULL
+
+	body := []byte{0}                                 // ReservedOctet
+	body = binary.LittleEndian.AppendUint32(body, 0)  // ClassNameRef
+	body = binary.LittleEndian.AppendUint32(body, 11) // NdTableValueTableLength
+	body = binary.LittleEndian.AppendUint32(body, 4)  // Empty DerivationList
+	body = binary.LittleEndian.AppendUint32(body, 4)  // Empty ClassQualifierSet
+	body = binary.LittleEndian.AppendUint32(body, 3)  // PropertyCount
+	body = append(body, lookup...)
+	body = append(body, ndvt...)
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(heap))|0x80000000)
+	body = append(body, heap...)
+	return append(binary.LittleEndian.AppendUint32(nil, uint32(len(body)+4)), body...)
+}
+
+func TestObjectRoundTrip(t *testing.T) {
+	classPart := testClassPart()
+	// MethodsPart without methods and with an empty heap
+	emptyMethods := []byte{12, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x80}
+	block := []byte{ObjectFlagClass}
+	block = append(block, classPart...)
+	block = append(block, emptyMethods...)
+	block = append(block, classPart...)
+	block = append(block, emptyMethods...)
+	buf := binary.LittleEndian.AppendUint32(nil, encodingUnitSignature)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(block)))
+	buf = append(buf, block...)
+
+	var class Object
+	err := class.UnmarshalBinary(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !class.IsClass() || class.ClassName != "Test_Params" || len(class.Properties) != 3 {
+		t.Fatal("Fail")
+	}
+	if v, found := class.Value("commandline"); !found || v != nil {
+		t.Fatal("Fail")
+	}
+
+	inst, err := class.SpawnInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Set("CommandLine", "cmd.exe /c whoami") != nil || inst.Set("ProcessId", uint32(1234)) != nil || inst.Set("Hidden", true) != nil {
+		t.Fatal("Fail")
+	}
+	if inst.Set("Missing", 1) == nil {
+		t.Fatal("Fail")
+	}
+	buf, err = inst.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res Object
+	err = res.UnmarshalBinary(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsInstance() || res.ClassName != "Test_Params" {
+		t.Fatal("Fail")
+	}
+	if v, _ := res.Value("CommandLine"); v != "cmd.exe /c whoami" {
+		t.Fatal("Fail")
+	}
+	if v, _ := res.Value("ProcessId"); v != uint32(1234) {
+		t.Fatal("Fail")
+	}
+	if v, _ := res.Value("Hidden"); v != true {
+		t.Fatal("Fail")
+	}
+}
+
+func TestEncodedString(t *testing.T) {
+	for _, s := range []string{"root\\cimv2", "Ärende", "日本"} {
+		res, n, err := decodeEncodedString(encodeString(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != s || n != len(encodeString(s)) {
+			t.Fatal("Fail")
+		}
+	}
+}
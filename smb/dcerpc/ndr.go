@@ -0,0 +1,244 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dcerpc
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+// NDRWriter encodes NDR 2.0 stub data using the little-endian data
+// representation. It is intended for servers and mock implementations that
+// build responses by hand. Every primitive is aligned to its own size,
+// relative to the start of the stub.
+type NDRWriter struct {
+	buf   []byte
+	refId uint32
+}
+
+// Bytes returns the encoded stub data
+func (self *NDRWriter) Bytes() []byte {
+	return self.buf
+}
+
+// Align pads the stub with zero bytes to a multiple of n
+func (self *NDRWriter) Align(n int) {
+	for len(self.buf)%n != 0 {
+		self.buf = append(self.buf, 0)
+	}
+}
+
+func (self *NDRWriter) Uint8(v uint8) {
+	self.buf = append(self.buf, v)
+}
+
+func (self *NDRWriter) Uint16(v uint16) {
+	self.Align(2)
+	self.buf = binary.LittleEndian.AppendUint16(self.buf, v)
+}
+
+func (self *NDRWriter) Uint32(v uint32) {
+	self.Align(4)
+	self.buf = binary.LittleEndian.AppendUint32(self.buf, v)
+}
+
+func (self *NDRWriter) Uint64(v uint64) {
+	self.Align(8)
+	self.buf = binary.LittleEndian.AppendUint64(self.buf, v)
+}
+
+// Write appends raw bytes without any alignment
+func (self *NDRWriter) Write(p []byte) {
+	self.buf = append(self.buf, p...)
+}
+
+// Pointer encodes the referent id of a unique or full pointer. Null pointers
+// are encoded as 0, otherwise a new referent id is allocated. The referent
+// itself must be encoded by the caller where NDR expects it.
+func (self *NDRWriter) Pointer(notNull bool) {
+	if !notNull {
+		self.Uint32(0)
+		return
+	}
+	self.refId++
+	self.Uint32(self.refId)
+}
+
+// String encodes s as a null-terminated conformant varying UTF-16 string
+// such as a [string] wchar_t*
+func (self *NDRWriter) String(s string) {
+	buf := msdtyp.ToUnicode(msdtyp.NullTerminate(s))
+	count := uint32(len(buf) / 2)
+	self.Uint32(count) // Max count
+	self.Uint32(0)     // Offset
+	self.Uint32(count) // Actual count
+	self.Write(buf)
+	self.Align(4)
+}
+
+// StringPtr encodes a unique pointer to a string, where an empty string is
+// encoded as a null pointer
+func (self *NDRWriter) StringPtr(s string) {
+	self.Pointer(s != "")
+	if s != "" {
+		self.String(s)
+	}
+}
+
+// ContextHandle encodes a 20 byte context handle
+func (self *NDRWriter) ContextHandle(h []byte) {
+	self.Align(4)
+	var handle [20]byte
+	copy(handle[:], h)
+	self.Write(handle[:])
+}
+
+// NewContextHandle returns a random, non-null context handle
+func NewContextHandle() []byte {
+	h := make([]byte, 20)
+	rand.Read(h[4:])
+	return h
+}
+
+// NDRReader decodes NDR 2.0 little-endian stub data. The first decoding
+// error is sticky: later reads return zero values and Err reports it, so a
+// handler can decode all parameters before checking for errors once.
+type NDRReader struct {
+	buf []byte
+	off int
+	err error
+}
+
+func NewNDRReader(buf []byte) *NDRReader {
+	return &NDRReader{buf: buf}
+}
+
+// Err returns the first decoding error
+func (self *NDRReader) Err() error {
+	return self.err
+}
+
+// Len returns the number of unread bytes
+func (self *NDRReader) Len() int {
+	return len(self.buf) - self.off
+}
+
+func (self *NDRReader) Align(n int) {
+	for self.off%n != 0 && self.off < len(self.buf) {
+		self.off++
+	}
+}
+
+// Bytes returns the next n bytes without any alignment
+func (self *NDRReader) Bytes(n int) []byte {
+	if self.err != nil {
+		return nil
+	}
+	if n < 0 || n > self.Len() {
+		self.err = fmt.Errorf("NDR data is truncated")
+		return nil
+	}
+	ret := self.buf[self.off : self.off+n]
+	self.off += n
+	return ret
+}
+
+func (self *NDRReader) Uint8() uint8 {
+	b := self.Bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (self *NDRReader) Uint16() uint16 {
+	self.Align(2)
+	b := self.Bytes(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (self *NDRReader) Uint32() uint32 {
+	self.Align(4)
+	b := self.Bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (self *NDRReader) Uint64() uint64 {
+	self.Align(8)
+	b := self.Bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+// Pointer decodes a referent id and reports whether the pointer is not null
+func (self *NDRReader) Pointer() bool {
+	return self.Uint32() != 0
+}
+
+// String decodes a conformant varying UTF-16 string and strips the
+// terminating null character if present
+func (self *NDRReader) String() string {
+	maxCount := self.Uint32()
+	offset := self.Uint32()
+	actualCount := self.Uint32()
+	if self.err != nil {
+		return ""
+	}
+	if offset > maxCount || actualCount > maxCount-offset || uint64(actualCount)*2 > uint64(self.Len()) {
+		self.err = fmt.Errorf("Invalid conformant varying string")
+		return ""
+	}
+	s, err := msdtyp.FromUnicodeString(self.Bytes(int(actualCount) * 2))
+	if err != nil {
+		self.err = err
+		return ""
+	}
+	self.Align(4)
+	return msdtyp.StripNullByte(s)
+}
+
+// StringPtr decodes a unique pointer to a string, returning an empty string
+// for a null pointer
+func (self *NDRReader) StringPtr() string {
+	if !self.Pointer() {
+		return ""
+	}
+	return self.String()
+}
+
+// ContextHandle decodes a 20 byte context handle
+func (self *NDRReader) ContextHandle() []byte {
+	self.Align(4)
+	return self.Bytes(20)
+}
@@ -0,0 +1,465 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dcerpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+// Fault is an error returned by an Operation to fail the call with a fault
+// PDU carrying the status, which is either a nca_s_* code or a Win32 error
+type Fault uint32
+
+func (self Fault) Error() string {
+	return fmt.Sprintf("DCERPC fault 0x%08x", uint32(self))
+}
+
+// C706 Appendix E and MS-RPCE Section 3.1.1.5.5 fault codes
+const (
+	FaultAccessDenied     Fault = 0x00000005 // ERROR_ACCESS_DENIED
+	FaultBadStubData      Fault = 0x000006f7 // RPC_X_BAD_STUB_DATA
+	FaultUnspecified      Fault = 0x1c000012 // nca_s_fault_unspec
+	FaultContextMismatch  Fault = 0x1c00001a // nca_s_fault_context_mismatch
+	FaultOpRangeError     Fault = 0x1c010002 // nca_s_op_rng_error
+	FaultUnknownInterface Fault = 0x1c010003 // nca_s_unknown_if
+	FaultProtocolError    Fault = 0x1c01000b // nca_s_proto_error
+)
+
+// C706 Section 12.6.3.1 reject reasons of a bind_nak
+const (
+	rejectNotSpecified               uint16 = 0
+	rejectProtocolVersionUnsupported uint16 = 4
+	// MS-RPCE Section 2.2.2.5
+	rejectAuthTypeNotRecognized uint16 = 8
+)
+
+const (
+	// Largest fragment accepted and sent by the server
+	serverMaxFragSize = 4280
+	// C706 Section 12.6.3.1 every implementation supports fragments of
+	// at least this size
+	minFragSize = 1432
+	// Largest request stub reassembled from multiple fragments
+	maxRequestStubSize = 4 * 1024 * 1024
+)
+
+// Operation implements an opnum of an Interface. The stub data of the
+// request is decoded from in and the stub data of the response, including
+// the return value, is encoded to out. A returned Fault fails the call with
+// its status. Other errors fail it with FaultBadStubData when in failed to
+// decode the request and otherwise with FaultUnspecified.
+type Operation func(call *Call, in *NDRReader, out *NDRWriter) error
+
+// Interface is a DCERPC interface served by a Server
+type Interface struct {
+	UUID         string // Abstract syntax, e.g., "4B324FC8-1670-01D3-1278-5A47BF6EE188"
+	MajorVersion uint16
+	MinorVersion uint16
+	Operations   map[uint16]Operation // Operations by opnum
+	uuid         []byte
+}
+
+// Call describes the request being processed by an Operation
+type Call struct {
+	Association *Association
+	Interface   *Interface
+	CallId      uint32
+	ContextId   uint16
+	Opnum       uint16
+	Object      []byte // Object UUID if the request has one
+}
+
+// Server dispatches the requests of the clients of a named pipe, or any
+// other connection oriented transport, to the operations of its registered
+// interfaces. Only unauthenticated binds with the NDR 2.0 transfer syntax
+// are accepted.
+type Server struct {
+	mu          sync.RWMutex
+	interfaces  []*Interface
+	association uint32
+}
+
+func NewServer() *Server {
+	return &Server{}
+}
+
+// Register adds an interface to the server. An interface with the same UUID
+// and major version is replaced.
+func (self *Server) Register(iface *Interface) (err error) {
+	iface.uuid, err = msdtyp.GuidFromString(iface.UUID)
+	if err != nil {
+		return
+	}
+	if len(iface.uuid) != 16 {
+		return fmt.Errorf("Invalid interface UUID %s", iface.UUID)
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for i, registered := range self.interfaces {
+		if bytes.Equal(registered.uuid, iface.uuid) && registered.MajorVersion == iface.MajorVersion {
+			self.interfaces[i] = iface
+			return
+		}
+	}
+	self.interfaces = append(self.interfaces, iface)
+	return
+}
+
+// lookup returns the interface matching an abstract syntax. The client may
+// request a minor version up to the one registered.
+func (self *Server) lookup(syntax SyntaxId) *Interface {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	major, minor := uint16(syntax.Version), uint16(syntax.Version>>16)
+	for _, iface := range self.interfaces {
+		if bytes.Equal(iface.uuid, syntax.UUID) && iface.MajorVersion == major && minor <= iface.MinorVersion {
+			return iface
+		}
+	}
+	return nil
+}
+
+// NewAssociation returns the state of a new client connection. secAddr is
+// the secondary address returned in the bind_ack, e.g., "\PIPE\srvsvc".
+func (self *Server) NewAssociation(secAddr string) *Association {
+	self.mu.Lock()
+	self.association++
+	id := self.association
+	self.mu.Unlock()
+	return &Association{
+		srv:         self,
+		id:          id,
+		secAddr:     secAddr,
+		maxXmitFrag: minFragSize,
+		contexts:    make(map[uint16]*Interface),
+		handles:     make(map[[20]byte]any),
+	}
+}
+
+// Association is the server side state of a client connection: its bound
+// presentation contexts, the context handles it opened and the response
+// fragments waiting to be read. It is not safe for concurrent use.
+type Association struct {
+	srv         *Server
+	id          uint32
+	secAddr     string
+	maxXmitFrag uint16
+	contexts    map[uint16]*Interface
+	handles     map[[20]byte]any
+
+	in      []byte      // Incomplete fragment
+	request *RequestReq // Request being reassembled
+	out     [][]byte    // Response fragments
+}
+
+// NewHandle returns a new context handle referring to v
+func (self *Association) NewHandle(v any) []byte {
+	h := NewContextHandle()
+	self.handles[[20]byte(h)] = v
+	return h
+}
+
+// Handle returns the value referred to by a context handle
+func (self *Association) Handle(h []byte) (v any, ok bool) {
+	if len(h) != 20 {
+		return nil, false
+	}
+	v, ok = self.handles[[20]byte(h)]
+	return
+}
+
+// CloseHandle releases a context handle
+func (self *Association) CloseHandle(h []byte) {
+	if len(h) == 20 {
+		delete(self.handles, [20]byte(h))
+	}
+}
+
+// Write processes the PDUs of p, which may end with an incomplete fragment
+// that is completed by the next Write. The responses are queued for Read.
+// An error is returned for data that is not a valid PDU, after which the
+// connection should be closed.
+func (self *Association) Write(p []byte) error {
+	self.in = append(self.in, p...)
+	for len(self.in) >= PDUHeaderCommonSize {
+		var header Header
+		if err := header.UnmarshalBinary(self.in[:PDUHeaderCommonSize]); err != nil {
+			return err
+		}
+		if header.MajorVersion != 5 || header.Representation&0xf0 != 0x10 {
+			self.in = nil
+			return fmt.Errorf("Unsupported DCERPC version %d or data representation 0x%x", header.MajorVersion, header.Representation)
+		}
+		if int(header.FragLength) < PDUHeaderCommonSize || header.FragLength > serverMaxFragSize {
+			self.in = nil
+			return fmt.Errorf("Invalid DCERPC fragment length %d", header.FragLength)
+		}
+		if len(self.in) < int(header.FragLength) {
+			break
+		}
+		pdu := self.in[:header.FragLength]
+		self.in = self.in[header.FragLength:]
+		if err := self.process(&header, pdu); err != nil {
+			self.in = nil
+			return err
+		}
+	}
+	if len(self.in) == 0 {
+		self.in = nil
+	}
+	return nil
+}
+
+// Read returns the next response fragment, or its first max bytes with more
+// set when it is larger. The rest of the fragment is returned by the next
+// Read. msg is nil when no response is queued.
+func (self *Association) Read(max int) (msg []byte, more bool) {
+	if len(self.out) == 0 {
+		return nil, false
+	}
+	msg = self.out[0]
+	if len(msg) > max {
+		self.out[0] = msg[max:]
+		return msg[:max], true
+	}
+	self.out = self.out[1:]
+	return msg, false
+}
+
+// Pending reports whether a response is queued
+func (self *Association) Pending() bool {
+	return len(self.out) > 0
+}
+
+func (self *Association) process(header *Header, pdu []byte) error {
+	switch header.Type {
+	case PacketTypeBind, PacketTypeAlterCtx:
+		return self.bind(header, pdu)
+	case PacketTypeRequest:
+		return self.handleRequest(header, pdu)
+	case PacketTypeAuth3:
+		// Authenticated binds are refused so there is nothing to complete
+		return nil
+	}
+	log.Debugf("Ignoring DCERPC PDU of type %d\n", header.Type)
+	return nil
+}
+
+func (self *Association) bind(header *Header, pdu []byte) error {
+	var req BindReq
+	if err := req.UnmarshalBinary(pdu); err != nil {
+		return err
+	}
+	if req.AuthLength != 0 || header.MinorVersion > 1 {
+		reason := rejectAuthTypeNotRecognized
+		if header.MinorVersion > 1 {
+			reason = rejectProtocolVersionUnsupported
+		}
+		if header.Type == PacketTypeAlterCtx {
+			self.fault(header.CallId, 0, FaultProtocolError)
+			return nil
+		}
+		return self.bindNak(header.CallId, reason)
+	}
+	if header.Type == PacketTypeBind {
+		if req.MaxRecvFragSize < minFragSize {
+			return self.bindNak(header.CallId, rejectNotSpecified)
+		}
+		self.maxXmitFrag = min(req.MaxRecvFragSize, serverMaxFragSize)
+	}
+
+	ndr, _ := msdtyp.GuidFromString(MSRPCUuidNdr)
+	res := BindRes{
+		Header:          newHeader(),
+		MaxSendFragSize: self.maxXmitFrag,
+		MaxRecvFragSize: serverMaxFragSize,
+		Association:     self.id,
+	}
+	if req.Association != 0 {
+		// Joining an existing association group
+		res.Association = req.Association
+	}
+	res.Type = PacketTypeBindAck
+	res.CallId = header.CallId
+	if header.Type == PacketTypeAlterCtx {
+		res.Type = PacketTypeAlterRes
+	} else {
+		res.SecAddr = []byte(self.secAddr + "\x00")
+	}
+	for _, item := range req.ContextList.Items {
+		result := ContextResItem{Result: providerRejection, Reason: abstractSyntaxNotSupported}
+		iface := self.srv.lookup(item.AbstractSyntax)
+		if iface != nil {
+			result.Reason = proposedTransferSyntaxNotSupported
+			for _, syntax := range item.TransferSyntax {
+				if bytes.Equal(syntax.UUID, ndr) && syntax.Version == 2 {
+					result = ContextResItem{Result: acceptance, TransferSyntax: syntax}
+					self.contexts[item.Id] = iface
+					break
+				}
+			}
+		}
+		res.ResultList.Items = append(res.ResultList.Items, result)
+	}
+	res.ResultList.Results = byte(len(res.ResultList.Items))
+	buf, err := res.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	self.out = append(self.out, buf)
+	return nil
+}
+
+func (self *Association) bindNak(callId uint32, reason uint16) error {
+	res := BindNak{Header: newHeader(), RejectReason: reason, Versions: [][2]byte{{5, 0}}}
+	res.Type = PacketTypeBindNak
+	res.CallId = callId
+	buf, err := res.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	self.out = append(self.out, buf)
+	return nil
+}
+
+func (self *Association) fault(callId uint32, contextId uint16, status Fault) {
+	res := FaultRes{Header: newHeader(), ContextId: contextId, Status: uint32(status)}
+	res.Type = PacketTypeFault
+	res.Flags |= PfcDidNotExecute
+	res.CallId = callId
+	buf, err := res.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	self.out = append(self.out, buf)
+}
+
+// handleRequest reassembles the fragments of a request and calls its
+// operation once the last fragment is received
+func (self *Association) handleRequest(header *Header, pdu []byte) error {
+	var req RequestReq
+	if err := req.UnmarshalBinary(pdu); err != nil {
+		return err
+	}
+	if req.AuthLength != 0 {
+		self.request = nil
+		self.fault(req.CallId, req.ContextId, FaultAccessDenied)
+		return nil
+	}
+	if req.Flags&PfcFirstFrag != 0 {
+		self.request = &req
+	} else if self.request == nil || self.request.CallId != req.CallId || self.request.Opnum != req.Opnum {
+		self.request = nil
+		self.fault(req.CallId, req.ContextId, FaultProtocolError)
+		return nil
+	} else if len(self.request.Buffer)+len(req.Buffer) > maxRequestStubSize {
+		self.request = nil
+		self.fault(req.CallId, req.ContextId, FaultProtocolError)
+		return nil
+	} else {
+		self.request.Buffer = append(self.request.Buffer, req.Buffer...)
+	}
+	if req.Flags&PfcLastFrag == 0 {
+		return nil
+	}
+	call := self.request
+	self.request = nil
+	self.dispatch(call)
+	return nil
+}
+
+func (self *Association) dispatch(req *RequestReq) {
+	iface, ok := self.contexts[req.ContextId]
+	if !ok {
+		self.fault(req.CallId, req.ContextId, FaultUnknownInterface)
+		return
+	}
+	op, ok := iface.Operations[req.Opnum]
+	if !ok {
+		self.fault(req.CallId, req.ContextId, FaultOpRangeError)
+		return
+	}
+	call := &Call{
+		Association: self,
+		Interface:   iface,
+		CallId:      req.CallId,
+		ContextId:   req.ContextId,
+		Opnum:       req.Opnum,
+		Object:      req.ObjectUuid,
+	}
+	in := NewNDRReader(req.Buffer)
+	out := &NDRWriter{}
+	if err := op(call, in, out); err != nil {
+		var fault Fault
+		switch {
+		case errors.As(err, &fault):
+		case in.Err() != nil:
+			fault = FaultBadStubData
+		default:
+			fault = FaultUnspecified
+		}
+		log.Debugf("Opnum %d failed: %v\n", req.Opnum, err)
+		self.fault(req.CallId, req.ContextId, fault)
+		return
+	}
+	self.respond(req, out.Bytes())
+}
+
+// respond queues the response fragments of a call. The stub data of all but
+// the last fragment is a multiple of 8 bytes.
+func (self *Association) respond(req *RequestReq, stub []byte) {
+	chunk := (int(self.maxXmitFrag) - 24) &^ 7
+	first := true
+	for {
+		n := min(len(stub), chunk)
+		res := RequestRes{Header: newHeader(), AllocHint: uint32(len(stub)), ContextId: req.ContextId}
+		res.Type = PacketTypeResponse
+		res.CallId = req.CallId
+		res.Flags = 0
+		if first {
+			res.Flags |= PfcFirstFrag
+		}
+		if n == len(stub) {
+			res.Flags |= PfcLastFrag
+		}
+		res.Buffer = stub[:n]
+		buf, err := res.MarshalBinary()
+		if err != nil {
+			log.Errorln(err)
+			self.fault(req.CallId, req.ContextId, FaultUnspecified)
+			return
+		}
+		self.out = append(self.out, buf)
+		stub = stub[n:]
+		first = false
+		if len(stub) == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,386 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package dcerpc
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+const testUuid = "12345678-1234-abcd-ef00-0123456789ab"
+
+// Transport that passes the PDUs to an association of a Server
+type associationTransport struct {
+	a *Association
+}
+
+func (self *associationTransport) Transceive(pdu []byte) ([]byte, error) {
+	if err := self.a.Write(pdu); err != nil {
+		return nil, err
+	}
+	return self.Read(0)
+}
+
+func (self *associationTransport) Write(pdu []byte) error {
+	return self.a.Write(pdu)
+}
+
+func (self *associationTransport) Read(maxSize int) ([]byte, error) {
+	msg, more := self.a.Read(65536)
+	if msg == nil || more {
+		return nil, fmt.Errorf("No response fragment")
+	}
+	return msg, nil
+}
+
+func (self *associationTransport) SessionKey() []byte {
+	return nil
+}
+
+// newTestServer returns a server of a winreg-like interface where opnum 0
+// opens a key by name, opnum 1 returns the name of an open key repeated n
+// times and opnum 2 closes the key
+func newTestServer(t *testing.T) *Server {
+	srv := NewServer()
+	err := srv.Register(&Interface{
+		UUID:         testUuid,
+		MajorVersion: 1,
+		MinorVersion: 2,
+		Operations: map[uint16]Operation{
+			0: func(call *Call, in *NDRReader, out *NDRWriter) error {
+				name := in.String()
+				if in.Err() != nil {
+					return in.Err()
+				}
+				if name == "denied" {
+					return FaultAccessDenied
+				}
+				out.ContextHandle(call.Association.NewHandle(name))
+				out.Uint32(0)
+				return nil
+			},
+			1: func(call *Call, in *NDRReader, out *NDRWriter) error {
+				h := in.ContextHandle()
+				n := in.Uint32()
+				if in.Err() != nil {
+					return in.Err()
+				}
+				v, ok := call.Association.Handle(h)
+				if !ok {
+					return FaultContextMismatch
+				}
+				out.String(string(bytes.Repeat([]byte(v.(string)), int(n))))
+				out.Uint32(0)
+				return nil
+			},
+			2: func(call *Call, in *NDRReader, out *NDRWriter) error {
+				h := in.ContextHandle()
+				if _, ok := call.Association.Handle(h); !ok {
+					return FaultContextMismatch
+				}
+				call.Association.CloseHandle(h)
+				out.ContextHandle(nil)
+				out.Uint32(0)
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+func TestServerBind(t *testing.T) {
+	srv := newTestServer(t)
+	a := srv.NewAssociation(`\PIPE\test`)
+	req, err := newBindReq(7, testUuid, 1, 1, MSRPCUuidNdr, 4280, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Request the unknown interface on a second context
+	unknown, err := newBindReq(7, "87654321-1234-abcd-ef00-0123456789ab", 1, 0, MSRPCUuidNdr, 4280, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := unknown.ContextList.Items[0]
+	item.Id = 1
+	req.ContextList.Items = append(req.ContextList.Items, item)
+	req.ContextList.Count = 2
+	req.FragLength += 44
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded BindReq
+	if err = decoded.UnmarshalBinary(buf); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ContextList.Count != 2 || decoded.ContextList.Items[1].Id != 1 || decoded.MaxRecvFragSize != 2048 {
+		t.Fatalf("Fail: %+v", decoded)
+	}
+
+	if err = a.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	msg, more := a.Read(65536)
+	if more || a.Pending() {
+		t.Fatal("Fail")
+	}
+	var res BindRes
+	if err = res.UnmarshalBinary(msg); err != nil {
+		t.Fatal(err)
+	}
+	if res.Type != PacketTypeBindAck || res.CallId != 7 || int(res.FragLength) != len(msg) {
+		t.Fatalf("Fail: %+v", res)
+	}
+	if res.MaxSendFragSize != 2048 || res.Association == 0 || string(res.SecAddr) != "\\PIPE\\test\x00" {
+		t.Fatalf("Fail: %+v", res)
+	}
+	if len(res.ResultList.Items) != 2 || res.ResultList.Items[0].Result != acceptance ||
+		res.ResultList.Items[1].Result != providerRejection || res.ResultList.Items[1].Reason != abstractSyntaxNotSupported {
+		t.Fatalf("Fail: %+v", res.ResultList)
+	}
+
+	// A minor version above the registered one is refused
+	req, err = newBindReq(8, testUuid, 1, 3, MSRPCUuidNdr, 4280, 4280)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Type = PacketTypeAlterCtx
+	buf, err = req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	msg, _ = a.Read(65536)
+	if err = res.UnmarshalBinary(msg); err != nil {
+		t.Fatal(err)
+	}
+	if res.Type != PacketTypeAlterRes || res.SecAddrLen != 0 || res.ResultList.Items[0].Result != providerRejection {
+		t.Fatalf("Fail: %+v", res)
+	}
+
+	// Authenticated binds are refused with a bind_nak
+	req, err = newBindReq(9, testUuid, 1, 0, MSRPCUuidNdr, 4280, 4280)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err = req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trailer := SecTrailer{AuthType: 10, AuthLevel: 2}
+	tBuf, err := trailer.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf = append(append(buf, tBuf...), make([]byte, 16)...)
+	le.PutUint16(buf[8:], uint16(len(buf)))
+	le.PutUint16(buf[10:], 16)
+	if err = a.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	msg, _ = a.Read(65536)
+	var nak BindNak
+	if err = nak.UnmarshalBinary(msg); err != nil {
+		t.Fatal(err)
+	}
+	if nak.Type != PacketTypeBindNak || nak.CallId != 9 || nak.RejectReason != rejectAuthTypeNotRecognized || len(nak.Versions) != 1 {
+		t.Fatalf("Fail: %+v", nak)
+	}
+}
+
+func TestServerCalls(t *testing.T) {
+	srv := newTestServer(t)
+	sb, err := bindInterface(&associationTransport{a: srv.NewAssociation(`\PIPE\test`)}, testUuid, 1, 0, MSRPCUuidNdr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NDRWriter{}
+	w.String("HKLM")
+	res, err := sb.MakeIoCtlRequest(0, w.Bytes())
+	if err != nil || len(res) != 24 {
+		t.Fatalf("Fail: %x %v", res, err)
+	}
+	handle := res[:20]
+
+	// The response spans several fragments
+	w = NDRWriter{}
+	w.ContextHandle(handle)
+	w.Uint32(2000)
+	res, err = sb.MakeIoCtlRequest(1, w.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewNDRReader(res)
+	if s := r.String(); s != string(bytes.Repeat([]byte("HKLM"), 2000)) || r.Uint32() != 0 || r.Err() != nil {
+		t.Fatalf("Fail: %d %v", len(s), r.Err())
+	}
+
+	w = NDRWriter{}
+	w.ContextHandle(handle)
+	if _, err = sb.MakeIoCtlRequest(2, w.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	// The handle is closed
+	if _, err = sb.MakeIoCtlRequest(2, w.Bytes()); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	srv := newTestServer(t)
+	a := srv.NewAssociation(`\PIPE\test`)
+	sb, err := bindInterface(&associationTransport{a: a}, testUuid, 1, 0, MSRPCUuidNdr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fault := func(opnum uint16, stub []byte) uint32 {
+		buf, err := sb.newRequestPDU(sb.callId.Add(1), opnum, nil, stub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = a.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		msg, _ := a.Read(65536)
+		var res FaultRes
+		if err = res.UnmarshalBinary(msg); err != nil {
+			t.Fatal(err)
+		}
+		if res.Type != PacketTypeFault || res.CallId != sb.callId.Load() {
+			t.Fatalf("Fail: %+v", res)
+		}
+		return res.Status
+	}
+	w := NDRWriter{}
+	w.String("denied")
+	if status := fault(0, w.Bytes()); status != uint32(FaultAccessDenied) {
+		t.Fatalf("Fail: 0x%x", status)
+	}
+	if status := fault(0, []byte{1, 0}); status != uint32(FaultBadStubData) {
+		t.Fatalf("Fail: 0x%x", status)
+	}
+	if status := fault(9, nil); status != uint32(FaultOpRangeError) {
+		t.Fatalf("Fail: 0x%x", status)
+	}
+
+	// A request on a context that was not bound
+	req, err := newRequestReq(50, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ContextId = 3
+	req.FragLength = 24
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	msg, _ := a.Read(65536)
+	var res FaultRes
+	if err = res.UnmarshalBinary(msg); err != nil || res.Status != uint32(FaultUnknownInterface) || res.ContextId != 3 {
+		t.Fatalf("Fail: %+v %v", res, err)
+	}
+
+	// Invalid PDUs are reported to the transport
+	if err = a.Write(make([]byte, 16)); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestServerFragmentedRequest(t *testing.T) {
+	srv := newTestServer(t)
+	a := srv.NewAssociation(`\PIPE\test`)
+	if _, err := bindInterface(&associationTransport{a: a}, testUuid, 1, 0, MSRPCUuidNdr, nil); err != nil {
+		t.Fatal(err)
+	}
+	w := NDRWriter{}
+	w.String("SOFTWARE")
+	stub := w.Bytes()
+
+	var pdus []byte
+	for i := 0; i < len(stub); i += 8 {
+		req, err := newRequestReq(2, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Flags = 0
+		if i == 0 {
+			req.Flags |= PfcFirstFrag
+		}
+		if i+8 >= len(stub) {
+			req.Flags |= PfcLastFrag
+		}
+		req.Buffer = stub[i:min(i+8, len(stub))]
+		req.FragLength = uint16(24 + len(req.Buffer))
+		buf, err := req.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded RequestReq
+		if err = decoded.UnmarshalBinary(buf); err != nil || !bytes.Equal(decoded.Buffer, req.Buffer) || decoded.Flags != req.Flags {
+			t.Fatalf("Fail: %+v %v", decoded, err)
+		}
+		pdus = append(pdus, buf...)
+	}
+	// The fragments are split across writes at arbitrary positions
+	for len(pdus) > 0 {
+		n := min(len(pdus), 10)
+		if a.Pending() {
+			t.Fatal("Fail")
+		}
+		if err := a.Write(pdus[:n]); err != nil {
+			t.Fatal(err)
+		}
+		pdus = pdus[n:]
+	}
+
+	// The fragment is read in two parts
+	part, more := a.Read(20)
+	if !more || len(part) != 20 {
+		t.Fatal("Fail")
+	}
+	rest, more := a.Read(65536)
+	if more {
+		t.Fatal("Fail")
+	}
+	var res RequestRes
+	if err := res.UnmarshalBinary(append(bytes.Clone(part), rest...)); err != nil {
+		t.Fatal(err)
+	}
+	if res.Type != PacketTypeResponse || res.CallId != 2 || res.Flags != PfcFirstFrag|PfcLastFrag || len(res.Buffer) != 24 {
+		t.Fatalf("Fail: %+v", res)
+	}
+	if _, ok := a.Handle(res.Buffer[:20]); !ok {
+		t.Fatal("Fail")
+	}
+}
@@ -35,8 +35,6 @@ import (
 	"fmt"
 	"io"
 	"sync/atomic"
-
-	"github.com/ericblavier/go-smb/smb"
 )
 
 // Unused
@@ -48,11 +46,13 @@ import (
 type ServiceBind struct {
 	// callId always contains the last used value, so call Add(1) first
 	callId *atomic.Uint32 // Use it with callId.Add(1)
-	f      *smb.File
+	t      Transport
 	// Currently unused, but should probably be respected at some point
 	maxFragTransmitSize uint16 // Max size of fragment the server accepts
 	// Currently unused, but should probably be validated at some point
 	maxFragReceiveSize uint16 // Max size of fragment server should send
+	// Set when the bind was authenticated at the DCERPC layer
+	auth *authContext
 }
 
 // Defined in C706 (DCE 1.1: Remote Procedure Call) section 12.6.3.1 as "common fields"
@@ -165,6 +165,33 @@ type BindRes struct {
 	// Auth verifier? An optional field if AuthLength != 0
 }
 
+/*
+MS-RPCE Section 2.2.2.11
+
+	typedef struct {
+	  u_int8 auth_type;
+	  u_int8 auth_level;
+	  u_int8 auth_pad_length;
+	  u_int8 auth_reserved;
+	  u_int32 auth_context_id;
+	} sec_trailer;
+*/
+type SecTrailer struct {
+	AuthType      byte
+	AuthLevel     byte
+	AuthPadLength byte
+	AuthReserved  byte
+	AuthContextId uint32
+}
+
+// MS-RPCE Section 2.2.2.10 (rpc_auth_3)
+type Auth3Req struct {
+	Header     // 16 Bytes
+	Pad        uint32
+	SecTrailer SecTrailer
+	AuthValue  []byte
+}
+
 // C706 Section 12.6.4.9
 type RequestReq struct { // 24 + optional fields + len of Buffer
 	Header // 16 bytes
@@ -175,10 +202,30 @@ type RequestReq struct { // 24 + optional fields + len of Buffer
 	Opnum     uint16
 	// Optional field object uuid_t
 	// Only present if PfcObjectUUID is set in the header flags
-	Buffer []byte
+	ObjectUuid []byte
+	Buffer     []byte
 	// Auth verifier? An optional field if AuthLength != 0
 }
 
+// C706 Section 12.6.4.7
+type FaultRes struct {
+	Header      // 16 bytes
+	AllocHint   uint32
+	ContextId   uint16
+	CancelCount byte
+	Reserved    byte
+	Status      uint32 // nca_s_* or Win32 error code
+	Reserved2   uint32
+}
+
+// C706 Section 12.6.4.5 (bind_nak)
+type BindNak struct {
+	Header       // 16 bytes
+	RejectReason uint16
+	// Protocol versions supported by the server encoded as major, minor
+	Versions [][2]byte
+}
+
 // C706 Section 12.6.4.10
 type RequestRes struct {
 	Header // 16 bytes
@@ -485,7 +532,52 @@ func (self *BindReq) MarshalBinary() (ret []byte, err error) {
 }
 
 func (self *BindReq) UnmarshalBinary(buf []byte) (err error) {
-	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of BindReq")
+	log.Debugln("In UnmarshalBinary for BindReq")
+	err = self.Header.UnmarshalBinary(buf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if int(self.FragLength) > len(buf) || self.FragLength < 28 {
+		return fmt.Errorf("Invalid FragLength of BindReq")
+	}
+	end := int(self.FragLength)
+	if self.AuthLength != 0 {
+		// Exclude the sec_trailer and auth value
+		end -= 8 + int(self.AuthLength)
+		if end < 28 {
+			return fmt.Errorf("Invalid AuthLength of BindReq")
+		}
+	}
+	self.MaxSendFragSize = le.Uint16(buf[16:18])
+	self.MaxRecvFragSize = le.Uint16(buf[18:20])
+	self.Association = le.Uint32(buf[20:24])
+	self.ContextList = ContextList{Count: buf[24]}
+	offset := 28
+	for i := 0; i < int(self.ContextList.Count); i++ {
+		if offset+24 > end {
+			return fmt.Errorf("Buffer is too small to unmarshal ContextItem")
+		}
+		item := ContextItem{
+			Id:    le.Uint16(buf[offset : offset+2]),
+			Count: buf[offset+2],
+		}
+		item.AbstractSyntax.UUID = append([]byte{}, buf[offset+4:offset+20]...)
+		item.AbstractSyntax.Version = le.Uint32(buf[offset+20 : offset+24])
+		offset += 24
+		if offset+20*int(item.Count) > end {
+			return fmt.Errorf("Buffer is too small to unmarshal TransferSyntax list")
+		}
+		for j := 0; j < int(item.Count); j++ {
+			item.TransferSyntax = append(item.TransferSyntax, SyntaxId{
+				UUID:    append([]byte{}, buf[offset:offset+16]...),
+				Version: le.Uint32(buf[offset+16 : offset+20]),
+			})
+			offset += 20
+		}
+		self.ContextList.Items = append(self.ContextList.Items, item)
+	}
+	return
 }
 
 func readContextResItem(r *bytes.Reader, bo binary.ByteOrder) (res *ContextResItem, err error) {
@@ -547,8 +639,43 @@ func (self *ContextResList) UnmarshalBinary(buf []byte) (err error) {
 	return nil
 }
 
+// MarshalBinary encodes the bind_ack and sets FragLength to the size of the
+// encoded PDU. SecAddrLen is derived from SecAddr.
 func (self *BindRes) MarshalBinary() (ret []byte, err error) {
-	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary for BindRes")
+	log.Debugln("In MarshalBinary for BindRes")
+	if len(self.SecAddr) > 0xffff || len(self.ResultList.Items) > 0xff {
+		return nil, fmt.Errorf("Too large SecAddr or ResultList to marshal BindRes")
+	}
+	self.SecAddrLen = uint16(len(self.SecAddr))
+	ret, err = self.Header.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	ret = binary.LittleEndian.AppendUint16(ret, self.MaxSendFragSize)
+	ret = binary.LittleEndian.AppendUint16(ret, self.MaxRecvFragSize)
+	ret = binary.LittleEndian.AppendUint32(ret, self.Association)
+	ret = binary.LittleEndian.AppendUint16(ret, self.SecAddrLen)
+	ret = append(ret, self.SecAddr...)
+	for len(ret)%4 != 0 {
+		ret = append(ret, 0) // Align to 4-byte boundary
+	}
+	ret = append(ret, byte(len(self.ResultList.Items)), 0, 0, 0)
+	for _, item := range self.ResultList.Items {
+		ret = binary.LittleEndian.AppendUint16(ret, uint16(item.Result))
+		ret = binary.LittleEndian.AppendUint16(ret, uint16(item.Reason))
+		uuid := item.TransferSyntax.UUID
+		if uuid == nil {
+			uuid = make([]byte, 16)
+		} else if len(uuid) != 16 {
+			return nil, fmt.Errorf("TransferSyntax UUID must be 16 bytes")
+		}
+		ret = append(ret, uuid...)
+		ret = binary.LittleEndian.AppendUint32(ret, item.TransferSyntax.Version)
+	}
+	self.FragLength = uint16(len(ret))
+	le.PutUint16(ret[8:10], self.FragLength)
+	return
 }
 
 func (self *BindRes) UnmarshalBinary(buf []byte) (err error) {
@@ -587,7 +714,7 @@ func (self *BindRes) UnmarshalBinary(buf []byte) (err error) {
 		return
 	}
 
-	alignmentBytes := 4 - ((self.SecAddrLen + 2) % 4)
+	alignmentBytes := (4 - ((self.SecAddrLen + 2) % 4)) % 4
 	_, err = r.Seek(int64(alignmentBytes), io.SeekCurrent) // Align to 4-byte boundary
 	if err != nil {
 		log.Errorln(err)
@@ -636,6 +763,16 @@ func (self *RequestReq) MarshalBinary() (ret []byte, err error) {
 		log.Errorln(err)
 		return
 	}
+	if self.Flags&PfcObjectUUID == PfcObjectUUID {
+		if len(self.ObjectUuid) != 16 {
+			return nil, fmt.Errorf("Object UUID must be 16 bytes when PfcObjectUUID is set")
+		}
+		_, err = w.Write(self.ObjectUuid)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
 	_, err = w.Write(self.Buffer)
 	if err != nil {
 		log.Errorln(err)
@@ -644,12 +781,71 @@ func (self *RequestReq) MarshalBinary() (ret []byte, err error) {
 	return w.Bytes(), nil
 }
 
+// headerLength returns the size of the request PDU header including the
+// optional object UUID.
+func (self *RequestReq) headerLength() int {
+	if self.Flags&PfcObjectUUID == PfcObjectUUID {
+		return 40
+	}
+	return 24
+}
+
+// UnmarshalBinary decodes a request PDU. Buffer holds the stub data without
+// any auth padding or verifier.
 func (self *RequestReq) UnmarshalBinary(buf []byte) (err error) {
-	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of RequestReq")
+	log.Debugln("In UnmarshalBinary for RequestReq")
+	err = self.Header.UnmarshalBinary(buf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	hl := self.headerLength()
+	if int(self.FragLength) > len(buf) || int(self.FragLength) < hl {
+		return fmt.Errorf("Invalid FragLength of RequestReq")
+	}
+	end := int(self.FragLength)
+	if self.AuthLength != 0 {
+		end -= 8 + int(self.AuthLength)
+		if end < hl {
+			return fmt.Errorf("Invalid AuthLength of RequestReq")
+		}
+		// Strip the auth padding announced in the sec_trailer
+		padLength := int(buf[end+2])
+		if end-padLength < hl {
+			return fmt.Errorf("Invalid auth padding of RequestReq")
+		}
+		end -= padLength
+	}
+	self.AllocHint = le.Uint32(buf[16:20])
+	self.ContextId = le.Uint16(buf[20:22])
+	self.Opnum = le.Uint16(buf[22:24])
+	self.ObjectUuid = nil
+	if hl == 40 {
+		self.ObjectUuid = append([]byte{}, buf[24:40]...)
+	}
+	self.Buffer = append([]byte{}, buf[hl:end]...)
+	return
 }
 
+// MarshalBinary encodes the response PDU and sets FragLength to the size of
+// the encoded PDU.
 func (self *RequestRes) MarshalBinary() (ret []byte, err error) {
-	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary for RequestRes")
+	log.Debugln("In MarshalBinary for RequestRes")
+	if len(self.Buffer) > 0xffff-24 {
+		return nil, fmt.Errorf("Too large Buffer to marshal RequestRes")
+	}
+	self.FragLength = uint16(24 + len(self.Buffer))
+	self.AuthLength = 0
+	ret, err = self.Header.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	ret = binary.LittleEndian.AppendUint32(ret, self.AllocHint)
+	ret = binary.LittleEndian.AppendUint16(ret, self.ContextId)
+	ret = append(ret, self.CancelCount, self.Reserved)
+	ret = append(ret, self.Buffer...)
+	return
 }
 
 func (self *RequestRes) UnmarshalBinary(buf []byte) (err error) {
@@ -692,3 +888,144 @@ func (self *RequestRes) UnmarshalBinary(buf []byte) (err error) {
 	}
 	return
 }
+
+func (self *FaultRes) MarshalBinary() (ret []byte, err error) {
+	log.Debugln("In MarshalBinary for FaultRes")
+	self.FragLength = 32
+	self.AuthLength = 0
+	ret, err = self.Header.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	ret = binary.LittleEndian.AppendUint32(ret, self.AllocHint)
+	ret = binary.LittleEndian.AppendUint16(ret, self.ContextId)
+	ret = append(ret, self.CancelCount, self.Reserved)
+	ret = binary.LittleEndian.AppendUint32(ret, self.Status)
+	ret = binary.LittleEndian.AppendUint32(ret, self.Reserved2)
+	return
+}
+
+func (self *FaultRes) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for FaultRes")
+	err = self.Header.UnmarshalBinary(buf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if len(buf) < 32 || self.FragLength < 32 {
+		return fmt.Errorf("Buffer is too small to unmarshal FaultRes")
+	}
+	self.AllocHint = le.Uint32(buf[16:20])
+	self.ContextId = le.Uint16(buf[20:22])
+	self.CancelCount = buf[22]
+	self.Reserved = buf[23]
+	self.Status = le.Uint32(buf[24:28])
+	self.Reserved2 = le.Uint32(buf[28:32])
+	return
+}
+
+func (self *BindNak) MarshalBinary() (ret []byte, err error) {
+	log.Debugln("In MarshalBinary for BindNak")
+	if len(self.Versions) > 0xff {
+		return nil, fmt.Errorf("Too many versions to marshal BindNak")
+	}
+	ret, err = self.Header.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	ret = binary.LittleEndian.AppendUint16(ret, self.RejectReason)
+	ret = append(ret, byte(len(self.Versions)))
+	for _, v := range self.Versions {
+		ret = append(ret, v[0], v[1])
+	}
+	self.FragLength = uint16(len(ret))
+	le.PutUint16(ret[8:10], self.FragLength)
+	return
+}
+
+func (self *BindNak) UnmarshalBinary(buf []byte) (err error) {
+	log.Debugln("In UnmarshalBinary for BindNak")
+	err = self.Header.UnmarshalBinary(buf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if len(buf) < 18 {
+		return fmt.Errorf("Buffer is too small to unmarshal BindNak")
+	}
+	self.RejectReason = le.Uint16(buf[16:18])
+	self.Versions = nil
+	if len(buf) < 19 {
+		return
+	}
+	count := int(buf[18])
+	if len(buf) < 19+2*count {
+		return fmt.Errorf("Buffer is too small to unmarshal BindNak versions")
+	}
+	for i := 0; i < count; i++ {
+		self.Versions = append(self.Versions, [2]byte{buf[19+2*i], buf[20+2*i]})
+	}
+	return
+}
+
+func (self *SecTrailer) MarshalBinary() (ret []byte, err error) {
+	ret = []byte{self.AuthType, self.AuthLevel, self.AuthPadLength, self.AuthReserved}
+	ret = binary.LittleEndian.AppendUint32(ret, self.AuthContextId)
+	return
+}
+
+func (self *SecTrailer) UnmarshalBinary(buf []byte) (err error) {
+	if len(buf) < 8 {
+		return fmt.Errorf("Buffer is too small to unmarshal SecTrailer")
+	}
+	self.AuthType = buf[0]
+	self.AuthLevel = buf[1]
+	self.AuthPadLength = buf[2]
+	self.AuthReserved = buf[3]
+	self.AuthContextId = le.Uint32(buf[4:8])
+	return
+}
+
+func (self *Auth3Req) MarshalBinary() (ret []byte, err error) {
+	log.Debugln("In MarshalBinary for Auth3Req")
+	w := bytes.NewBuffer(ret)
+
+	hBuf, err := self.Header.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	_, err = w.Write(hBuf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	err = binary.Write(w, le, self.Pad)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	tBuf, err := self.SecTrailer.MarshalBinary()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	_, err = w.Write(tBuf)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	_, err = w.Write(self.AuthValue)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	return w.Bytes(), nil
+}
+
+func (self *Auth3Req) UnmarshalBinary(buf []byte) (err error) {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of Auth3Req")
+}
@@ -0,0 +1,128 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dcerpc
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+// Transport carries DCERPC PDUs between the client and the server, e.g., over
+// an SMB named pipe or a TCP connection (ncacn_ip_tcp).
+type Transport interface {
+	// Transceive sends a PDU and returns the first response fragment
+	Transceive(pdu []byte) ([]byte, error)
+	// Write sends a PDU that the server does not respond to
+	Write(pdu []byte) error
+	// Read returns the next response fragment of at most maxSize bytes
+	Read(maxSize int) ([]byte, error)
+	// SessionKey returns the session key of the underlying connection, if any
+	SessionKey() []byte
+}
+
+type pipeTransport struct {
+	f *smb.File
+}
+
+func (self *pipeTransport) Transceive(pdu []byte) ([]byte, error) {
+	ioCtlReq, err := self.f.NewIoCTLReq(smb.FsctlPipeTransceive, pdu)
+	if err != nil {
+		return nil, err
+	}
+
+	//NOTE Might be a problem with exceeding a max payload size of 65536 for
+	// servers that do not support multi-credit requests
+	ioCtlRes, err := self.f.WriteIoCtlReq(ioCtlReq)
+	if err != nil {
+		return nil, err
+	}
+	return ioCtlRes.Buffer, nil
+}
+
+func (self *pipeTransport) Write(pdu []byte) error {
+	_, err := self.f.WriteFile(pdu, 0)
+	return err
+}
+
+func (self *pipeTransport) Read(maxSize int) ([]byte, error) {
+	buf := make([]byte, maxSize+16) // 16 bytes overhead of read request
+	n, err := self.f.ReadFile(buf, 0)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func (self *pipeTransport) SessionKey() []byte {
+	return self.f.GetSessionKey()
+}
+
+type tcpTransport struct {
+	conn net.Conn
+}
+
+// NewTCPTransport returns a Transport that sends PDUs over an established
+// TCP connection to an RPC endpoint, e.g., the endpoint mapper on port 135.
+func NewTCPTransport(conn net.Conn) Transport {
+	return &tcpTransport{conn: conn}
+}
+
+func (self *tcpTransport) Transceive(pdu []byte) ([]byte, error) {
+	err := self.Write(pdu)
+	if err != nil {
+		return nil, err
+	}
+	return self.Read(0)
+}
+
+func (self *tcpTransport) Write(pdu []byte) error {
+	_, err := self.conn.Write(pdu)
+	return err
+}
+
+// Read returns exactly one fragment as determined by the frag_length of the
+// PDU header, so maxSize is ignored.
+func (self *tcpTransport) Read(maxSize int) ([]byte, error) {
+	buf := make([]byte, PDUHeaderCommonSize)
+	_, err := io.ReadFull(self.conn, buf)
+	if err != nil {
+		return nil, err
+	}
+	fragLength := int(le.Uint16(buf[8:10]))
+	if fragLength < PDUHeaderCommonSize {
+		return nil, fmt.Errorf("Received DCERPC fragment with invalid length %d", fragLength)
+	}
+	buf = append(buf, make([]byte, fragLength-PDUHeaderCommonSize)...)
+	_, err = io.ReadFull(self.conn, buf[PDUHeaderCommonSize:])
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (self *tcpTransport) SessionKey() []byte {
+	return nil
+}
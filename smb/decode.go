@@ -0,0 +1,114 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smb
+
+import (
+	"fmt"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// messageTypes creates the request and response structs by command
+var messageTypes = map[uint16][2]func() any{
+	CommandNegotiate:      {func() any { return &NegotiateReq{} }, func() any { return &NegotiateRes{} }},
+	CommandSessionSetup:   {func() any { return &SessionSetupReq{} }, func() any { return &SessionSetupRes{} }},
+	CommandLogoff:         {func() any { return &LogoffReq{} }, func() any { return &LogoffRes{} }},
+	CommandTreeConnect:    {func() any { return &TreeConnectReq{} }, func() any { return &TreeConnectRes{} }},
+	CommandTreeDisconnect: {func() any { return &TreeDisconnectReq{} }, func() any { return &TreeDisconnectRes{} }},
+	CommandCreate:         {func() any { return &CreateReq{} }, func() any { return &CreateRes{} }},
+	CommandClose:          {func() any { return &CloseReq{} }, func() any { return &CloseRes{} }},
+	CommandRead:           {func() any { return &ReadReq{} }, func() any { return &ReadRes{} }},
+	CommandWrite:          {func() any { return &WriteReq{} }, func() any { return &WriteRes{} }},
+	CommandIOCtl:          {func() any { return &IoCtlReq{} }, func() any { return &IoCtlRes{} }},
+	CommandQueryDirectory: {func() any { return &QueryDirectoryReq{} }, func() any { return &QueryDirectoryRes{} }},
+	CommandChangeNotify:   {func() any { return &ChangeNotifyReq{} }, func() any { return &ChangeNotifyRes{} }},
+	CommandQueryInfo:      {func() any { return &QueryInfoReq{} }, func() any { return &QueryInfoRes{} }},
+	CommandSetInfo:        {func() any { return &SetInfoReq{} }, func() any { return &SetInfoRes{} }},
+}
+
+// DecodeMessage decodes a single message as received from the wire without
+// the 4 byte session service header. SMB2 messages are decoded into the
+// request or response struct of their command, e.g., *CreateRes, or into a
+// *Header for other commands and error responses. SMB1 negotiate responses
+// are decoded into a *SMB1NegotiateRes and transformed messages into their
+// *TransformHeader or *CompressionTransformHeader.
+//
+// DecodeMessage is meant for tools and fuzzing and must not panic on any
+// input.
+func DecodeMessage(buf []byte) (msg any, err error) {
+	return decodeMessage(buf, encoder.Unmarshal)
+}
+
+// DecodeMessageStrict is DecodeMessage with the strict bounds checking of
+// encoder.UnmarshalStrict
+func DecodeMessageStrict(buf []byte) (msg any, err error) {
+	return decodeMessage(buf, encoder.UnmarshalStrict)
+}
+
+func decodeMessage(buf []byte, unmarshal func([]byte, interface{}) error) (msg any, err error) {
+	if len(buf) < 4 {
+		return nil, fmt.Errorf("Message too short: %d bytes", len(buf))
+	}
+	switch string(buf[:4]) {
+	case ProtocolSmb:
+		res := &SMB1NegotiateRes{}
+		if len(buf) > 4 && buf[4] != SMB1CommandNegotiate {
+			return nil, fmt.Errorf("Unsupported SMB1 command 0x%x", buf[4])
+		}
+		if len(buf) > 9 && buf[9]&0x80 == 0 {
+			return nil, fmt.Errorf("SMB1 requests are not supported")
+		}
+		return res, res.UnmarshalBinary(buf, nil)
+	case ProtocolTransformHdr:
+		msg = &TransformHeader{}
+	case ProtocolCompressed:
+		msg = &CompressionTransformHeader{}
+	case ProtocolSmb2:
+		var h Header
+		if err = unmarshal(buf, &h); err != nil {
+			return
+		}
+		types, found := messageTypes[h.Command]
+		response := h.Flags&SMB2_FLAGS_SERVER_TO_REDIR != 0
+		if !found || (response && isErrorResponse(&h, buf)) {
+			return &h, nil
+		}
+		if response {
+			msg = types[1]()
+		} else {
+			msg = types[0]()
+		}
+	default:
+		return nil, fmt.Errorf("Unknown protocol id %x", buf[:4])
+	}
+	if err = unmarshal(buf, msg); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// isErrorResponse reports whether a response carries the error response of
+// MS-SMB2 Section 2.2.2, which has a StructureSize of 9, rather than the
+// response of its command
+func isErrorResponse(h *Header, buf []byte) bool {
+	return h.Status != StatusOk && (len(buf) < 66 || (buf[64] == 9 && buf[65] == 0))
+}
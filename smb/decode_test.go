@@ -0,0 +1,90 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+func TestDecodeMessage(t *testing.T) {
+	header := newHeader()
+	header.Command = CommandRead
+	header.Flags = SMB2_FLAGS_SERVER_TO_REDIR
+	buf, err := encoder.Marshal(&ReadRes{Header: header, StructureSize: 17, DataOffset: 80, Buffer: []byte("data")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := DecodeMessage(buf)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if res, ok := msg.(*ReadRes); !ok || !bytes.Equal(res.Buffer, []byte("data")) {
+		t.Fatalf("Fail: %+v", msg)
+	}
+
+	// Error responses only decode the header
+	header.Status = StatusAccessDenied
+	buf, err = encoder.Marshal(&header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf = append(buf, 9, 0, 0, 0, 0, 0, 0, 0, 0)
+	msg, err = DecodeMessage(buf)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if h, ok := msg.(*Header); !ok || h.Status != StatusAccessDenied {
+		t.Fatalf("Fail: %+v", msg)
+	}
+
+	header = newHeader()
+	header.Command = CommandClose
+	buf, err = encoder.Marshal(&CloseReq{Header: header, StructureSize: 24, FileId: make([]byte, 16)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, err = DecodeMessage(buf); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if _, ok := msg.(*CloseReq); !ok {
+		t.Fatalf("Fail: %+v", msg)
+	}
+
+	if _, err = DecodeMessage([]byte("\xfeSM")); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestStrictBounds(t *testing.T) {
+	header := newHeader()
+	header.Flags = SMB2_FLAGS_SERVER_TO_REDIR
+	buf, err := encoder.Marshal(&QueryDirectoryRes{Header: header, StructureSize: 9, Buffer: []byte("data")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Point the buffer back into the header
+	binary.LittleEndian.PutUint16(buf[66:], 64)
+
+	defer func() { encoder.UseGenerated = true }()
+	for _, generated := range []bool{true, false} {
+		encoder.UseGenerated = generated
+		if err = encoder.Unmarshal(buf, &QueryDirectoryRes{}); err != nil {
+			t.Fatalf("Fail: %v", err)
+		}
+		if err = encoder.UnmarshalStrict(buf, &QueryDirectoryRes{}); err == nil {
+			t.Fatal("Fail")
+		}
+	}
+
+	// Only the connection with StrictBounds rejects the message
+	lenient, _ := newTestConnection(t, Options{})
+	strict, _ := newTestConnection(t, Options{StrictBounds: true})
+	if err = lenient.unmarshal(buf, &QueryDirectoryRes{}); err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+	if err = strict.unmarshal(buf, &QueryDirectoryRes{}); err == nil {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,157 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Algorithms offered in the negotiate contexts of SMB 3.1.1
+var (
+	offeredHashAlgorithms        = []uint16{SHA512}
+	offeredCiphers               = []uint16{AES128CCM, AES128GCM, AES256CCM, AES256GCM}
+	offeredSigningAlgorithms     = []uint16{AES_CMAC}
+	offeredCompressionAlgorithms = []uint16{CompressionLZ77}
+)
+
+// DowngradeError reports a negotiate response that selected something the
+// client did not offer or whose negotiate contexts are malformed, as sent
+// by a man in the middle stripping the stronger options of the client.
+// Options.OnDowngrade decides whether the negotiation is aborted.
+type DowngradeError struct {
+	Reason      string   // What is inconsistent
+	ContextType uint16   // Negotiate context concerned. 0 for the dialect
+	Offered     []uint16 // Dialects or algorithms offered by the client
+	Selected    []uint16 // Dialects or algorithms selected by the server
+}
+
+func (e *DowngradeError) Error() string {
+	if e.Offered == nil {
+		return fmt.Sprintf("Inconsistent negotiate response: %s", e.Reason)
+	}
+	return fmt.Sprintf("Inconsistent negotiate response: %s, offered %#04x but the server selected %#04x", e.Reason, e.Offered, e.Selected)
+}
+
+// offeredDialects returns the dialects of the SMB2 NEGOTIATE request
+func (s *Session) offeredDialects() []uint16 {
+	if s.options.ForceSMB2 {
+		return []uint16{DialectSmb_2_1}
+	}
+	return []uint16{DialectSmb_3_1_1, DialectSmb_2_1}
+}
+
+// checkDowngrade passes an inconsistency of the negotiate response to
+// Options.OnDowngrade, which aborts the negotiation by returning an error.
+// Without the callback the negotiation is always aborted.
+func (c *Connection) checkDowngrade(e *DowngradeError) error {
+	log.Errorln(e)
+	if c.options.OnDowngrade == nil {
+		return e
+	}
+	return c.options.OnDowngrade(e)
+}
+
+// checkSelected verifies that a context selects exactly one of the offered
+// algorithms. none is a value selected when there is no common algorithm.
+func checkSelected(contextType uint16, offered, selected []uint16, none ...uint16) *DowngradeError {
+	if len(selected) != 1 {
+		return &DowngradeError{Reason: "more than one algorithm selected", ContextType: contextType, Offered: offered, Selected: selected}
+	}
+	if !slices.Contains(offered, selected[0]) && !slices.Contains(none, selected[0]) {
+		return &DowngradeError{Reason: "algorithm not offered", ContextType: contextType, Offered: offered, Selected: selected}
+	}
+	return nil
+}
+
+// validateNegotiateRes checks that the dialect and the algorithms selected
+// by the server were offered by NewNegotiateReq and that each negotiate
+// context of a SMB 3.1.1 response is present at most once and complete.
+func (c *Connection) validateNegotiateRes(res *NegotiateRes) *DowngradeError {
+	dialects := c.offeredDialects()
+	if !slices.Contains(dialects, res.DialectRevision) {
+		return &DowngradeError{Reason: "dialect not offered", Offered: dialects, Selected: []uint16{res.DialectRevision}}
+	}
+	if res.DialectRevision != DialectSmb_3_1_1 {
+		if len(res.ContextList) > 0 {
+			return &DowngradeError{Reason: fmt.Sprintf("negotiate contexts sent with dialect %#04x", res.DialectRevision)}
+		}
+		return nil
+	}
+	if int(res.NegotiateContextCount) != len(res.ContextList) {
+		return &DowngradeError{Reason: fmt.Sprintf("%d of %d negotiate contexts received", len(res.ContextList), res.NegotiateContextCount)}
+	}
+
+	seen := make(map[uint16]bool)
+	for _, context := range res.ContextList {
+		if seen[context.ContextType] {
+			return &DowngradeError{Reason: "duplicate negotiate context", ContextType: context.ContextType}
+		}
+		seen[context.ContextType] = true
+		if int(context.DataLength) != len(context.Data) {
+			return &DowngradeError{Reason: "truncated negotiate context", ContextType: context.ContextType}
+		}
+		var e *DowngradeError
+		var err error
+		switch context.ContextType {
+		case PreauthIntegrityCapabilities:
+			var pic PreauthIntegrityContext
+			if err = c.unmarshal(context.Data, &pic); err == nil {
+				e = checkSelected(context.ContextType, offeredHashAlgorithms, pic.HashAlgorithms)
+			}
+		case EncryptionCapabilities:
+			var ec EncryptionContext
+			if err = c.unmarshal(context.Data, &ec); err == nil {
+				// A cipher of 0 means that no offered cipher is supported
+				e = checkSelected(context.ContextType, offeredCiphers, ec.Ciphers, 0)
+			}
+		case SigningCapabilities:
+			var sc SigningContext
+			if err = c.unmarshal(context.Data, &sc); err == nil {
+				e = checkSelected(context.ContextType, offeredSigningAlgorithms, sc.SigningAlgorithms)
+			}
+		case CompressionCapabilities:
+			if !c.options.Compression {
+				return &DowngradeError{Reason: "compression context not offered", ContextType: context.ContextType}
+			}
+			var cc CompressionContext
+			if err = c.unmarshal(context.Data, &cc); err == nil {
+				for _, algorithm := range cc.CompressionAlgorithms {
+					if algorithm != CompressionNone && !slices.Contains(offeredCompressionAlgorithms, algorithm) {
+						e = &DowngradeError{Reason: "algorithm not offered", ContextType: context.ContextType, Offered: offeredCompressionAlgorithms, Selected: cc.CompressionAlgorithms}
+					}
+				}
+			}
+		}
+		if err != nil {
+			return &DowngradeError{Reason: fmt.Sprintf("malformed negotiate context: %v", err), ContextType: context.ContextType}
+		}
+		if e != nil {
+			return e
+		}
+	}
+	if !seen[PreauthIntegrityCapabilities] {
+		return &DowngradeError{Reason: "missing preauth integrity context", ContextType: PreauthIntegrityCapabilities}
+	}
+	return nil
+}
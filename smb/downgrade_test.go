@@ -0,0 +1,69 @@
+package smb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+func newNegContext(t *testing.T, contextType uint16, data interface{}) NegContext {
+	buf, err := encoder.Marshal(data)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	return NegContext{ContextType: contextType, DataLength: uint16(len(buf)), Data: buf}
+}
+
+func TestValidateNegotiateRes(t *testing.T) {
+	c := &Connection{Session: &Session{}}
+	preauth := newNegContext(t, PreauthIntegrityCapabilities, PreauthIntegrityContext{HashAlgorithmCount: 1, SaltLength: 32, HashAlgorithms: []uint16{SHA512}, Salt: make([]byte, 32)})
+	cipher := func(id uint16) NegContext {
+		return newNegContext(t, EncryptionCapabilities, EncryptionContext{CipherCount: 1, Ciphers: []uint16{id}})
+	}
+	signing := func(id uint16) NegContext {
+		return newNegContext(t, SigningCapabilities, SigningContext{SigningAlgorithmCount: 1, SigningAlgorithms: []uint16{id}})
+	}
+	truncated := cipher(AES128GCM)
+	truncated.Data = truncated.Data[:3]
+
+	for i, v := range []struct {
+		dialect  uint16
+		contexts []NegContext
+		reason   string
+	}{
+		{DialectSmb_3_1_1, []NegContext{preauth, cipher(AES128GCM), signing(AES_CMAC)}, ""},
+		{DialectSmb_3_1_1, []NegContext{preauth, cipher(0)}, ""},
+		{DialectSmb_2_1, nil, ""},
+		{DialectSmb_3_0, nil, "dialect not offered"},
+		{DialectSmb_2_1, []NegContext{preauth}, "negotiate contexts sent with dialect 0x0210"},
+		{DialectSmb_3_1_1, []NegContext{preauth, signing(HMAC_SHA256)}, "algorithm not offered"},
+		{DialectSmb_3_1_1, []NegContext{preauth, cipher(AES128GCM), cipher(AES256GCM)}, "duplicate negotiate context"},
+		{DialectSmb_3_1_1, []NegContext{preauth, truncated}, "truncated negotiate context"},
+		{DialectSmb_3_1_1, []NegContext{cipher(AES128GCM)}, "missing preauth integrity context"},
+	} {
+		res := NegotiateRes{DialectRevision: v.dialect, NegotiateContextCount: uint16(len(v.contexts)), ContextList: v.contexts}
+		e := c.validateNegotiateRes(&res)
+		if v.reason == "" && e != nil || v.reason != "" && (e == nil || e.Reason != v.reason) {
+			t.Fatalf("Fail %d: %v", i, e)
+		}
+	}
+}
+
+func TestCheckDowngrade(t *testing.T) {
+	c := &Connection{Session: &Session{}}
+	e := &DowngradeError{Reason: "dialect not offered", Offered: []uint16{DialectSmb_3_1_1}, Selected: []uint16{DialectSmb_2_1}}
+	var de *DowngradeError
+	if err := c.checkDowngrade(e); !errors.As(err, &de) || de.Selected[0] != DialectSmb_2_1 {
+		t.Fatalf("Fail: %v", err)
+	}
+
+	var reported *DowngradeError
+	c.options.OnDowngrade = func(e *DowngradeError) error {
+		reported = e
+		return nil
+	}
+	if err := c.checkDowngrade(e); err != nil || reported != e {
+		t.Fatalf("Fail: %v", err)
+	}
+}
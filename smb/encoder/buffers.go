@@ -0,0 +1,98 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package encoder
+
+import (
+	"io"
+	"net"
+	"reflect"
+)
+
+// StreamThreshold is the minimum size of a variable length []byte field for
+// MarshalBuffers to reference it rather than copying it into the output.
+var StreamThreshold = 4096
+
+// Buffers receives the output of generated marshal functions. Fixed size
+// fields are appended to Buf while large variable length fields may be kept
+// as separate segments that reference the original slices.
+type Buffers struct {
+	Buf       []byte
+	segments  net.Buffers
+	threshold int // 0 means that payloads are always copied into Buf
+}
+
+// AppendPayload appends a variable length field
+func (self *Buffers) AppendPayload(p []byte) {
+	if self.threshold == 0 || len(p) < self.threshold {
+		self.Buf = append(self.Buf, p...)
+		return
+	}
+	// The first segment always starts at the beginning of Buf such that
+	// ReleaseBuffers finds the backing array.
+	if len(self.Buf) > 0 || len(self.segments) == 0 {
+		self.segments = append(self.segments, self.Buf)
+		// Continue after the flushed segment in the same backing array
+		self.Buf = self.Buf[len(self.Buf):]
+	}
+	self.segments = append(self.segments, p)
+}
+
+// Segments returns all the data written so far
+func (self *Buffers) Segments() net.Buffers {
+	if len(self.Buf) > 0 {
+		self.segments = append(self.segments, self.Buf)
+		self.Buf = self.Buf[len(self.Buf):]
+	}
+	return self.segments
+}
+
+// MarshalBuffers encodes v like Marshal but returns the result as a list of
+// segments. For types with generated code, variable length fields of at least
+// StreamThreshold bytes reference the original slices instead of being
+// copied, so the caller must not modify them until the segments have been
+// consumed. Other types are returned as a single segment. The segments are
+// backed by a pooled buffer that can be returned with ReleaseBuffers.
+func MarshalBuffers(v interface{}) (net.Buffers, error) {
+	typev := reflect.TypeOf(v)
+	if typev != nil && typev.Kind() == reflect.Ptr && !reflect.ValueOf(v).IsNil() {
+		typev = typev.Elem()
+	}
+	if c, ok := lookupGenerated(typev); ok {
+		return c.buffers(v, StreamThreshold)
+	}
+	buf, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return net.Buffers{buf}, nil
+}
+
+// MarshalTo encodes v and writes it to w without assembling large payloads
+// into an intermediate buffer. When w is a *net.TCPConn the segments are
+// written with a single vectored write.
+func MarshalTo(w io.Writer, v interface{}) (int64, error) {
+	bufs, err := MarshalBuffers(v)
+	if err != nil {
+		return 0, err
+	}
+	return bufs.WriteTo(w)
+}
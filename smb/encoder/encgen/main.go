@@ -0,0 +1,613 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+/*
+encgen generates static marshal/unmarshal functions for structs that are
+otherwise encoded by reflection in the encoder package. It is run through
+go:generate from the package declaring the structs:
+
+	//go:generate go run ./encoder/encgen -output encoder_gen.go Header TreeConnectReq
+
+The generated code registers itself with the encoder package which uses it in
+place of reflection for the listed types. Only a subset of the encoder
+features is supported: fields of type uint8, uint16, uint32, uint64, []byte
+(fixed, align or variable length with len/offset tags) and other structs in the
+same list. Unsupported fields are reported as errors so that such types remain
+on the reflection based path.
+
+The generated code follows the semantics of the reflection based encoder,
+including its quirks, so that both produce identical results.
+*/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type fieldKind int
+
+const (
+	kindUint8 fieldKind = iota
+	kindUint16
+	kindUint32
+	kindUint64
+	kindFixed // []byte with fixed tag
+	kindAlign // []byte with align tag
+	kindBytes // variable length []byte
+	kindStruct
+)
+
+var scalarSizes = map[fieldKind]int{
+	kindUint8:  1,
+	kindUint16: 2,
+	kindUint32: 4,
+	kindUint64: 8,
+}
+
+type field struct {
+	name      string
+	kind      fieldKind
+	size      int    // Size of fixed fields or alignment
+	typeName  string // Name of nested struct
+	lenOf     string
+	offsetOf  string
+	bigEndian bool
+}
+
+type structDef struct {
+	name   string
+	fields []*field
+}
+
+type generator struct {
+	buf         bytes.Buffer
+	qualifier   string // Package qualifier for encoder types
+	needsBinary bool
+	needsFmt    bool
+	needsIO     bool
+}
+
+func main() {
+	output := flag.String("output", "encoder_gen.go", "name of the generated file")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: encgen [-output file] Type [Type...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(*output, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "encgen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(output string, typeNames []string) error {
+	pkgName, specs, custom, err := parsePackage(".", output)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool)
+	for _, name := range typeNames {
+		wanted[name] = true
+	}
+
+	defs := make([]*structDef, 0, len(typeNames))
+	for _, name := range typeNames {
+		st, ok := specs[name]
+		if !ok {
+			return fmt.Errorf("struct type %s not found", name)
+		}
+		if custom[name] {
+			return fmt.Errorf("type %s implements MarshalBinary/UnmarshalBinary and cannot be generated", name)
+		}
+		def, err := parseStruct(name, st, wanted)
+		if err != nil {
+			return err
+		}
+		defs = append(defs, def)
+	}
+
+	g := &generator{qualifier: "encoder."}
+	if pkgName == "encoder" {
+		g.qualifier = ""
+	}
+	for _, def := range defs {
+		g.genStruct(def)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by encgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", pkgName)
+	fmt.Fprintf(&out, "import (\n")
+	if g.needsBinary {
+		fmt.Fprintf(&out, "\t\"encoding/binary\"\n")
+	}
+	if g.needsFmt {
+		fmt.Fprintf(&out, "\t\"fmt\"\n")
+	}
+	if g.needsIO {
+		fmt.Fprintf(&out, "\t\"io\"\n")
+	}
+	if pkgName != "encoder" {
+		fmt.Fprintf(&out, "\n\t\"github.com/ericblavier/go-smb/smb/encoder\"\n")
+	}
+	fmt.Fprintf(&out, ")\n\n")
+	fmt.Fprintf(&out, "func init() {\n")
+	for _, def := range defs {
+		fmt.Fprintf(&out, "\t%[2]sRegister((*%[1]s).marshalSMB, (*%[1]s).unmarshalSMB, (*%[1]s).sizeSMB)\n", def.name, g.qualifier)
+	}
+	fmt.Fprintf(&out, "}\n")
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format generated code: %s", err)
+	}
+	return os.WriteFile(output, src, 0644)
+}
+
+// parsePackage returns the package name, all struct types declared in the
+// package and the set of types with custom MarshalBinary/UnmarshalBinary
+// methods.
+func parsePackage(dir, output string) (pkgName string, specs map[string]*ast.StructType, custom map[string]bool, err error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return
+	}
+	specs = make(map[string]*ast.StructType)
+	custom = make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") || filepath.Base(file) == filepath.Base(output) {
+			continue
+		}
+		var f *ast.File
+		f, err = parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			return
+		}
+		pkgName = f.Name.Name
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					ts, ok := spec.(*ast.TypeSpec)
+					if !ok {
+						continue
+					}
+					if st, ok := ts.Type.(*ast.StructType); ok {
+						specs[ts.Name.Name] = st
+					}
+				}
+			case *ast.FuncDecl:
+				if d.Recv == nil || len(d.Recv.List) == 0 {
+					continue
+				}
+				if d.Name.Name != "MarshalBinary" && d.Name.Name != "UnmarshalBinary" {
+					continue
+				}
+				recv := d.Recv.List[0].Type
+				if star, ok := recv.(*ast.StarExpr); ok {
+					recv = star.X
+				}
+				if id, ok := recv.(*ast.Ident); ok {
+					custom[id.Name] = true
+				}
+			}
+		}
+	}
+	if pkgName == "" {
+		err = fmt.Errorf("no Go files found in %s", dir)
+	}
+	return
+}
+
+func parseStruct(name string, st *ast.StructType, wanted map[string]bool) (*structDef, error) {
+	def := &structDef{name: name}
+	names := make(map[string]*field)
+	for _, f := range st.Fields.List {
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(s)
+		}
+		fieldNames := []string{}
+		for _, n := range f.Names {
+			fieldNames = append(fieldNames, n.Name)
+		}
+		if len(fieldNames) == 0 {
+			// Embedded field
+			id, ok := f.Type.(*ast.Ident)
+			if !ok {
+				return nil, fmt.Errorf("%s: unsupported embedded field", name)
+			}
+			fieldNames = append(fieldNames, id.Name)
+		}
+		for _, fieldName := range fieldNames {
+			fd, err := parseField(name, fieldName, f.Type, tag.Get("smb"), wanted)
+			if err != nil {
+				return nil, err
+			}
+			def.fields = append(def.fields, fd)
+			names[fieldName] = fd
+		}
+	}
+
+	for _, fd := range def.fields {
+		for _, ref := range []string{fd.lenOf, fd.offsetOf} {
+			if ref != "" && names[ref] == nil {
+				return nil, fmt.Errorf("%s.%s: tag references unknown field %s", name, fd.name, ref)
+			}
+		}
+	}
+	return def, nil
+}
+
+func parseField(structName, name string, expr ast.Expr, tag string, wanted map[string]bool) (*field, error) {
+	fd := &field{name: name}
+	var fixed, align int
+	var hasFixed, hasAlign bool
+	for _, t := range strings.Split(tag, ",") {
+		if t == "" {
+			continue
+		}
+		tokens := strings.Split(t, ":")
+		switch tokens[0] {
+		case "len", "offset", "count":
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("%s.%s: missing required tag data", structName, name)
+			}
+			switch tokens[0] {
+			case "len":
+				fd.lenOf = tokens[1]
+			case "offset":
+				fd.offsetOf = tokens[1]
+			}
+			// count only applies to slices of uint16, uint32 and structs
+			// which are not supported by the generator.
+		case "be":
+			fd.bigEndian = true
+		case "fixed", "align":
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("%s.%s: missing required tag data", structName, name)
+			}
+			i, err := strconv.Atoi(tokens[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %s", structName, name, err)
+			}
+			if tokens[0] == "fixed" {
+				fixed, hasFixed = i, true
+			} else {
+				align, hasAlign = i, true
+			}
+		default:
+			return nil, fmt.Errorf("%s.%s: unsupported tag %s", structName, name, tokens[0])
+		}
+	}
+
+	switch t := expr.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "uint8", "byte":
+			fd.kind = kindUint8
+		case "uint16":
+			fd.kind = kindUint16
+		case "uint32":
+			fd.kind = kindUint32
+		case "uint64":
+			fd.kind = kindUint64
+		default:
+			if !wanted[t.Name] {
+				return nil, fmt.Errorf("%s.%s: nested type %s must also be generated", structName, name, t.Name)
+			}
+			fd.kind = kindStruct
+			fd.typeName = t.Name
+		}
+	case *ast.ArrayType:
+		elt, ok := t.Elt.(*ast.Ident)
+		if t.Len != nil || !ok || (elt.Name != "byte" && elt.Name != "uint8") {
+			return nil, fmt.Errorf("%s.%s: only []byte slices are supported", structName, name)
+		}
+		switch {
+		case hasFixed:
+			fd.kind = kindFixed
+			fd.size = fixed
+		case hasAlign:
+			if align <= 0 {
+				return nil, fmt.Errorf("%s.%s: invalid alignment %d", structName, name, align)
+			}
+			fd.kind = kindAlign
+			fd.size = align
+		default:
+			fd.kind = kindBytes
+		}
+	default:
+		return nil, fmt.Errorf("%s.%s: unsupported field type", structName, name)
+	}
+
+	// The reflection based encoder only honors len and offset for uint16
+	// and uint32 fields.
+	if fd.kind != kindUint16 && fd.kind != kindUint32 {
+		fd.lenOf, fd.offsetOf = "", ""
+	}
+	if fd.lenOf != "" && fd.offsetOf != "" {
+		return nil, fmt.Errorf("%s.%s: len and offset tags on the same field are not supported", structName, name)
+	}
+	return fd, nil
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// sizeExpr returns the expression for the encoded size of field i. The size
+// of a nil alignment field depends on the size of the preceding fields.
+func (g *generator) sizeExpr(fields []*field, i int) string {
+	fd := fields[i]
+	switch fd.kind {
+	case kindAlign:
+		return fmt.Sprintf("%sAlignLen(self.%s, %s, %d)", g.qualifier, fd.name, g.sumExpr(fields[:i]), fd.size)
+	case kindFixed, kindBytes:
+		return fmt.Sprintf("len(self.%s)", fd.name)
+	case kindStruct:
+		return fmt.Sprintf("self.%s.sizeSMB()", fd.name)
+	default:
+		return strconv.Itoa(scalarSizes[fd.kind])
+	}
+}
+
+// sumExpr returns the expression for the total size of the fields
+func (g *generator) sumExpr(fields []*field) string {
+	constant := 0
+	terms := []string{}
+	for i, fd := range fields {
+		if size, ok := scalarSizes[fd.kind]; ok {
+			constant += size
+		} else {
+			terms = append(terms, g.sizeExpr(fields, i))
+		}
+	}
+	if constant != 0 || len(terms) == 0 {
+		terms = append([]string{strconv.Itoa(constant)}, terms...)
+	}
+	return strings.Join(terms, " + ")
+}
+
+func fieldIndex(def *structDef, name string) int {
+	for i, fd := range def.fields {
+		if fd.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (g *generator) genStruct(def *structDef) {
+	for _, fd := range def.fields {
+		if fd.kind == kindUint16 || fd.kind == kindUint32 || fd.kind == kindUint64 {
+			g.needsBinary = true
+		}
+	}
+	g.printf("\nfunc (self *%s) sizeSMB() int {\n", def.name)
+	g.printf("\treturn %s\n}\n", g.sumExpr(def.fields))
+
+	g.genMarshal(def)
+	g.genUnmarshal(def)
+}
+
+func (g *generator) genMarshal(def *structDef) {
+	g.printf("\nfunc (self *%s) marshalSMB(b *%sBuffers) error {\n", def.name, g.qualifier)
+	for i, fd := range def.fields {
+		switch fd.kind {
+		case kindUint8:
+			g.printf("\tb.Buf = append(b.Buf, self.%s)\n", fd.name)
+		case kindUint16, kindUint32:
+			bits := 16
+			if fd.kind == kindUint32 {
+				bits = 32
+			}
+			value := "self." + fd.name
+			if fd.lenOf != "" {
+				value = fmt.Sprintf("uint%d(%s)", bits, g.sizeExpr(def.fields, fieldIndex(def, fd.lenOf)))
+			} else if fd.offsetOf != "" {
+				targetIdx := fieldIndex(def, fd.offsetOf)
+				value = fmt.Sprintf("uint%d(%s)", bits, g.sumExpr(def.fields[:targetIdx]))
+				if fd.kind == kindUint32 && lengthKnownBefore(def, fd.offsetOf, i) {
+					// An empty buffer is encoded with a zero offset once its
+					// length has been determined.
+					g.printf("\tif %s == 0 {\n", g.sizeExpr(def.fields, targetIdx))
+					g.printf("\t\tb.Buf = binary.%s.AppendUint32(b.Buf, 0)\n", byteOrder(fd))
+					g.printf("\t} else {\n")
+					g.printf("\t\tb.Buf = binary.%s.AppendUint32(b.Buf, %s)\n", byteOrder(fd), value)
+					g.printf("\t}\n")
+					continue
+				}
+			}
+			g.printf("\tb.Buf = binary.%s.AppendUint%d(b.Buf, %s)\n", byteOrder(fd), bits, value)
+		case kindUint64:
+			g.printf("\tb.Buf = binary.%s.AppendUint64(b.Buf, self.%s)\n", byteOrder(fd), fd.name)
+		case kindFixed:
+			g.printf("\tb.Buf = append(b.Buf, self.%s...)\n", fd.name)
+		case kindAlign:
+			g.printf("\tb.Buf = %sAppendAlign(b.Buf, self.%s, %s, %d)\n", g.qualifier, fd.name, g.sumExpr(def.fields[:i]), fd.size)
+		case kindBytes:
+			g.printf("\tb.AppendPayload(self.%s)\n", fd.name)
+		case kindStruct:
+			g.printf("\tif err := self.%s.marshalSMB(b); err != nil {\n\t\treturn err\n\t}\n", fd.name)
+		}
+	}
+	g.printf("\treturn nil\n}\n")
+}
+
+// lengthKnownBefore reports whether the reflection based encoder would have
+// cached the length of target before encoding the field at index idx, either
+// because target was already encoded or because a len tag referenced it.
+func lengthKnownBefore(def *structDef, target string, idx int) bool {
+	for _, fd := range def.fields[:idx] {
+		if fd.name == target || fd.lenOf == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) genUnmarshal(def *structDef) {
+	g.printf("\nfunc (self *%s) unmarshalSMB(buf []byte, strict bool) (n int, err error) {\n", def.name)
+
+	// Decoding stops at the first variable length buffer without a
+	// preceding len tag.
+	stop := len(def.fields)
+	seenLen := make(map[string]bool)
+	for i, fd := range def.fields {
+		if fd.kind == kindBytes && !seenLen[fd.name] {
+			stop = i
+			break
+		}
+		if fd.lenOf != "" {
+			seenLen[fd.lenOf] = true
+		}
+	}
+
+	// Declare variables for len and offset tags referencing variable length
+	// buffers that are decoded later, as those are the only ones used.
+	declared := make(map[string]bool)
+	for i, fd := range def.fields[:stop] {
+		for _, ref := range []struct{ prefix, target string }{{"len", fd.lenOf}, {"off", fd.offsetOf}} {
+			if ref.target == "" {
+				continue
+			}
+			idx := fieldIndex(def, ref.target)
+			if def.fields[idx].kind != kindBytes || idx < i || idx >= stop {
+				continue
+			}
+			v := ref.prefix + ref.target
+			if !declared[v] {
+				g.printf("\tvar %s int\n", v)
+				declared[v] = true
+			}
+		}
+	}
+
+	hasOffset := make(map[string]bool)
+	for i, fd := range def.fields[:stop] {
+		// Bounds are checked once for each run of fixed size fields
+		if fixedSize(fd) && (i == 0 || !fixedSize(def.fields[i-1])) {
+			runSize := 0
+			for _, next := range def.fields[i:stop] {
+				if !fixedSize(next) {
+					break
+				}
+				if next.kind == kindFixed {
+					runSize += next.size
+				} else {
+					runSize += scalarSizes[next.kind]
+				}
+			}
+			g.needBytes(strconv.Itoa(runSize))
+		}
+		switch fd.kind {
+		case kindUint8:
+			g.printf("\tself.%s = buf[n]\n\tn++\n", fd.name)
+		case kindUint16, kindUint32, kindUint64:
+			size := scalarSizes[fd.kind]
+			g.printf("\tself.%s = binary.%s.Uint%d(buf[n:])\n\tn += %d\n", fd.name, byteOrder(fd), size*8, size)
+			if fd.lenOf != "" && declared["len"+fd.lenOf] {
+				g.printf("\tlen%s = int(self.%s)\n", fd.lenOf, fd.name)
+			} else if fd.offsetOf != "" && declared["off"+fd.offsetOf] {
+				g.printf("\toff%s = int(self.%s)\n", fd.offsetOf, fd.name)
+				hasOffset[fd.offsetOf] = true
+			}
+		case kindFixed:
+			g.printf("\tself.%s = make([]byte, %d)\n\tcopy(self.%s, buf[n:])\n\tn += %d\n", fd.name, fd.size, fd.name, fd.size)
+		case kindAlign:
+			g.printf("\tself.%s = []byte{}\n", fd.name)
+			g.printf("\tif len(buf) > n {\n\t\tn += (%d - n%%%d) %% %d\n\t}\n", fd.size, fd.size, fd.size)
+		case kindBytes:
+			g.needsFmt = true
+			if hasOffset[fd.name] {
+				g.printf("\tif off%s != n {\n", fd.name)
+				g.printf("\t\tif off%[1]s > len(buf) || len%[1]s > len(buf)-off%[1]s {\n", fd.name)
+				g.printf("\t\t\treturn n, fmt.Errorf(\"Buffer too small for field %s\")\n\t\t}\n", fd.name)
+				g.printf("\t\tif strict && len%[1]s > 0 && off%[1]s < n {\n", fd.name)
+				g.printf("\t\t\treturn n, fmt.Errorf(\"Data of field %s overlaps preceding fields\")\n\t\t}\n", fd.name)
+				g.printf("\t\tself.%[1]s = make([]byte, len%[1]s)\n\t\tcopy(self.%[1]s, buf[off%[1]s:])\n", fd.name)
+				g.printf("\t} else {\n")
+				g.printf("\t\tif len%s > len(buf)-n {\n\t\t\treturn n, fmt.Errorf(\"Buffer too small for field %s\")\n\t\t}\n", fd.name, fd.name)
+				g.printf("\t\tself.%[1]s = make([]byte, len%[1]s)\n\t\tcopy(self.%[1]s, buf[n:])\n\t\tn += len%[1]s\n", fd.name)
+				g.printf("\t}\n")
+			} else {
+				g.printf("\tif len%s > len(buf)-n {\n\t\treturn n, fmt.Errorf(\"Buffer too small for field %s\")\n\t}\n", fd.name, fd.name)
+				g.printf("\tself.%[1]s = make([]byte, len%[1]s)\n\tcopy(self.%[1]s, buf[n:])\n\tn += len%[1]s\n", fd.name)
+			}
+		case kindStruct:
+			if i > 0 {
+				g.needsIO = true
+				g.printf("\tif n > len(buf) {\n\t\treturn n, io.ErrUnexpectedEOF\n\t}\n")
+			}
+			g.printf("\tvar m%[1]s int\n\tif m%[1]s, err = self.%[1]s.unmarshalSMB(buf[n:], strict); err != nil {\n\t\treturn n, err\n\t}\n\tn += m%[1]s\n", fd.name)
+		}
+	}
+	if stop < len(def.fields) {
+		// Matches the reflection based decoder which requires a preceding
+		// len tag for variable length buffers.
+		g.needsFmt = true
+		g.printf("\treturn n, fmt.Errorf(\"Variable length field missing length reference in struct field: %s\")\n}\n", def.fields[stop].name)
+		return
+	}
+	g.printf("\treturn n, nil\n}\n")
+}
+
+// byteOrder returns the name of the binary.ByteOrder used for a field
+func byteOrder(fd *field) string {
+	if fd.bigEndian {
+		return "BigEndian"
+	}
+	return "LittleEndian"
+}
+
+func fixedSize(fd *field) bool {
+	_, scalar := scalarSizes[fd.kind]
+	return scalar || fd.kind == kindFixed
+}
+
+func (g *generator) needBytes(count string) {
+	g.needsIO = true
+	g.printf("\tif len(buf)-n < %s {\n\t\treturn n, io.ErrUnexpectedEOF\n\t}\n", count)
+}
@@ -46,6 +46,16 @@ import (
 
 var log = golog.Get("github.com/ericblavier/go-smb/smb/encoder")
 
+// CheckCount returns an error if count elements of at least size bytes each
+// cannot fit in the remaining bytes of the input. Decoders call it before
+// allocating memory based on counts read from the wire.
+func CheckCount(count, size uint64, remaining int) error {
+	if remaining < 0 || (size != 0 && count > uint64(remaining)/size) {
+		return fmt.Errorf("Count %d exceeds the remaining %d bytes of input", count, remaining)
+	}
+	return nil
+}
+
 type BinaryMarshallable interface {
 	MarshalBinary(*Metadata) ([]byte, error)
 	UnmarshalBinary([]byte, *Metadata) error
@@ -60,6 +70,26 @@ type Metadata struct {
 	ParentBuf  []byte
 	CurrOffset uint64
 	CurrField  string
+	Strict     bool // Strict bounds checking, see UnmarshalStrict
+}
+
+// StrictBounds reports whether the decoding was started with UnmarshalStrict.
+// Custom decoders use it to apply their own strict checks.
+func (m *Metadata) StrictBounds() bool {
+	return m != nil && m.Strict
+}
+
+// newMetadata creates the metadata for decoding v from buf at the top level
+func newMetadata(v interface{}, buf []byte) *Metadata {
+	return &Metadata{
+		Tags:       &TagMap{},
+		Lens:       make(map[string]uint64),
+		Parent:     v,
+		ParentBuf:  buf,
+		Offsets:    make(map[string]uint64),
+		Counts:     make(map[string]uint64),
+		CurrOffset: 0,
+	}
 }
 
 type TagMap struct {
@@ -94,6 +124,20 @@ func (t TagMap) GetString(key string) (string, error) {
 	return t.Get(key).(string), nil
 }
 
+/*
+parseTags parses the smb struct tag of a field. Besides len, offset, count
+and fixed the following tags control the layout of a struct:
+
+	align:N        []byte padding to the next multiple of N bytes. A nil
+	               field is filled with the required padding when marshalled.
+	if:F=V, if:F!=V
+	               The field is only present when the unsigned integer field F
+	               is (not) equal to V.
+	be             Unsigned integers are encoded in big endian byte order.
+	switch:F       The field is a union struct where the arm with the tag
+	               case:V matching the value of F is encoded. An arm tagged
+	               case:default is used when no other arm matches.
+*/
 func parseTags(sf reflect.StructField) (*TagMap, error) {
 	ret := &TagMap{
 		m:   make(map[string]interface{}),
@@ -118,7 +162,12 @@ func parseTags(sf reflect.StructField) (*TagMap, error) {
 				return nil, err
 			}
 			ret.Set(tokens[0], i)
-		case "asn1":
+		case "if", "switch", "case":
+			if len(tokens) != 2 {
+				return nil, errors.New("Missing required tag data. Expecting key:val")
+			}
+			ret.Set(tokens[0], tokens[1])
+		case "asn1", "be":
 			ret.Set(tokens[0], true)
 		case "omitempty":
 			if len(tokens) != 2 {
@@ -135,6 +184,178 @@ func parseTags(sf reflect.StructField) (*TagMap, error) {
 	return ret, nil
 }
 
+// AlignLen returns the encoded length of the alignment field p located at
+// offset off within its struct. A nil field is encoded as the padding
+// required to align the next field to a multiple of align bytes.
+func AlignLen(p []byte, off, align int) int {
+	if p != nil {
+		return len(p)
+	}
+	return (align - off%align) % align
+}
+
+// AppendAlign appends the alignment field p located at offset off to buf
+func AppendAlign(buf, p []byte, off, align int) []byte {
+	if p != nil {
+		return append(buf, p...)
+	}
+	return append(buf, make([]byte, AlignLen(nil, off, align))...)
+}
+
+// uintField returns the value of the unsigned integer field name of the
+// struct v. Used to resolve the fields referenced by if and switch tags.
+func uintField(v reflect.Value, name string) (uint64, error) {
+	f := v.FieldByName(name)
+	switch f.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return f.Uint(), nil
+	}
+	return 0, fmt.Errorf("Field %s referenced by tag is not an unsigned integer", name)
+}
+
+// isPresent evaluates the "if:Field=Value" or "if:Field!=Value" tag of a
+// field of the struct v. Fields without the tag are always present.
+func isPresent(v reflect.Value, tags *TagMap) (bool, error) {
+	if !tags.Has("if") {
+		return true, nil
+	}
+	cond, err := tags.GetString("if")
+	if err != nil {
+		return false, err
+	}
+	negate := false
+	name, value, ok := strings.Cut(cond, "!=")
+	if ok {
+		negate = true
+	} else if name, value, ok = strings.Cut(cond, "="); !ok {
+		return false, fmt.Errorf("Invalid condition %s. Expecting Field=Value", cond)
+	}
+	want, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		return false, err
+	}
+	got, err := uintField(v, name)
+	if err != nil {
+		return false, err
+	}
+	return (got == want) != negate, nil
+}
+
+// unionArm returns the index of the field of the union struct u with a
+// "case" tag matching sel, falling back to a field tagged "case:default".
+func unionArm(u reflect.Type, sel uint64) (int, error) {
+	if u.Kind() != reflect.Struct {
+		return 0, fmt.Errorf("Union field must be a struct, not %s", u.Kind())
+	}
+	info, err := getStructInfo(u)
+	if err != nil {
+		return 0, err
+	}
+	def := -1
+	for i, f := range info.fields {
+		c, err := f.tags.GetString("case")
+		if err != nil {
+			continue
+		}
+		if c == "default" {
+			def = i
+			continue
+		}
+		val, err := strconv.ParseUint(c, 0, 64)
+		if err != nil {
+			return 0, err
+		}
+		if val == sel {
+			return i, nil
+		}
+	}
+	if def < 0 {
+		return 0, fmt.Errorf("Union %s has no arm for value %d", u.Name(), sel)
+	}
+	return def, nil
+}
+
+// marshalUnion encodes the arm of the union field selected by the field
+// referenced by its switch tag
+func marshalUnion(parent, field reflect.Value, tags *TagMap) ([]byte, error) {
+	name, err := tags.GetString("switch")
+	if err != nil {
+		return nil, err
+	}
+	sel, err := uintField(parent, name)
+	if err != nil {
+		return nil, err
+	}
+	i, err := unionArm(field.Type(), sel)
+	if err != nil {
+		return nil, err
+	}
+	arm := field.Field(i)
+	if arm.Kind() == reflect.Ptr && arm.IsNil() {
+		return nil, fmt.Errorf("Union arm %s selected by %s is nil", field.Type().Field(i).Name, name)
+	}
+	return marshal(arm.Interface(), nil)
+}
+
+// unmarshalUnion decodes the arm of the union field selected by the field
+// referenced by its switch tag. The other arms are left untouched.
+func unmarshalUnion(buf []byte, parent, field reflect.Value, tags *TagMap, meta *Metadata) error {
+	name, err := tags.GetString("switch")
+	if err != nil {
+		return err
+	}
+	sel, err := uintField(parent, name)
+	if err != nil {
+		return err
+	}
+	i, err := unionArm(field.Type(), sel)
+	if err != nil {
+		return err
+	}
+	arm := field.Field(i)
+	switch arm.Kind() {
+	case reflect.Ptr:
+		p := reflect.New(arm.Type().Elem())
+		if _, err = unmarshal(buf, p.Interface(), meta); err != nil {
+			return err
+		}
+		arm.Set(p)
+	case reflect.Struct:
+		_, err = unmarshal(buf, arm.Addr().Interface(), meta)
+		return err
+	default:
+		data, err := unmarshal(buf, arm.Interface(), meta)
+		if err != nil {
+			return err
+		}
+		arm.Set(reflect.ValueOf(data))
+	}
+	return nil
+}
+
+// marshalField encodes field i of the struct v located at offset off within
+// the struct, taking conditional, union and alignment tags into account.
+func marshalField(v reflect.Value, i int, tags *TagMap, off int, meta *Metadata) ([]byte, error) {
+	present, err := isPresent(v, tags)
+	if err != nil || !present {
+		return nil, err
+	}
+	field := v.Field(i)
+	if tags.Has("switch") {
+		return marshalUnion(v, field, tags)
+	}
+	if tags.Has("align") {
+		if p, ok := field.Interface().([]byte); ok && p == nil {
+			align, err := tags.GetInt("align")
+			if err != nil {
+				return nil, err
+			}
+			return AppendAlign(nil, nil, off, align), nil
+		}
+	}
+	return marshal(field.Interface(), meta)
+}
+
 func getOffsetByFieldName(fieldName string, meta *Metadata) (uint64, error) {
 	if meta == nil || meta.Tags == nil || meta.Parent == nil || meta.Lens == nil {
 		return 0, errors.New("Cannot determine field offset. Missing required metadata")
@@ -142,25 +363,28 @@ func getOffsetByFieldName(fieldName string, meta *Metadata) (uint64, error) {
 	var ret uint64
 	var found bool
 	parentvf := reflect.Indirect(reflect.ValueOf(meta.Parent))
+	info, err := getStructInfo(parentvf.Type())
+	if err != nil {
+		return 0, err
+	}
 	// To determine offset, we loop through all fields of the struct, summing lengths of previous elements
 	// until we reach our field
-	for i := 0; i < parentvf.NumField(); i++ {
-		tf := parentvf.Type().Field(i)
-		if tf.Name == fieldName {
+	for i, f := range info.fields {
+		if f.name == fieldName {
 			found = true
 			break
 		}
-		if l, ok := meta.Lens[tf.Name]; ok {
+		if l, ok := meta.Lens[f.name]; ok {
 			// Length of field is in cache
 			ret += l
 		} else {
 			// Not in cache. Must marshal field to determine length. Add to cache after
-			buf, err := Marshal(parentvf.Field(i).Interface())
+			buf, err := marshalField(parentvf, i, f.tags, int(ret), nil)
 			if err != nil {
 				return 0, err
 			}
 			l := uint64(len(buf))
-			meta.Lens[tf.Name] = l
+			meta.Lens[f.name] = l
 			ret += l
 		}
 	}
@@ -190,6 +414,21 @@ func getFieldLengthByName(fieldName string, meta *Metadata) (uint64, error) {
 		return 0, errors.New("Invalid field. Cannot determine length.")
 	}
 
+	sf, _ := parentvf.Type().FieldByName(fieldName)
+	tags, err := fieldTags(parentvf.Type(), sf)
+	if err != nil {
+		return 0, err
+	}
+	if len(sf.Index) == 1 && (tags.Has("if") || tags.Has("switch")) {
+		// Absent fields and unions depend on the values of other fields
+		buf, err := marshalField(parentvf, sf.Index[0], tags, 0, nil)
+		if err != nil {
+			return 0, err
+		}
+		meta.Lens[fieldName] = uint64(len(buf))
+		return uint64(len(buf)), nil
+	}
+
 	bm, ok := field.Interface().(BinaryMarshallable)
 	if ok {
 		// Custom marshallable interface found.
@@ -237,12 +476,21 @@ func getFieldLengthByName(fieldName string, meta *Metadata) (uint64, error) {
 	return ret, nil
 }
 
+// byteOrder returns the byte order of the field described by meta
+func byteOrder(meta *Metadata) binary.ByteOrder {
+	if meta != nil && meta.Tags != nil && meta.Tags.Has("be") {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
 func Marshal(v interface{}) ([]byte, error) {
 	return marshal(v, nil)
 }
 
 func marshal(v interface{}, meta *Metadata) ([]byte, error) {
 	var ret []byte
+	order := byteOrder(meta)
 	typev := reflect.TypeOf(v)
 	valuev := reflect.ValueOf(v)
 
@@ -270,6 +518,10 @@ func marshal(v interface{}, meta *Metadata) ([]byte, error) {
 		typev = valuev.Type()
 	}
 
+	if c, ok := lookupGenerated(typev); ok {
+		return c.marshal(v)
+	}
+
 	w := bytes.NewBuffer(ret)
 	switch typev.Kind() {
 	case reflect.Struct:
@@ -278,17 +530,17 @@ func marshal(v interface{}, meta *Metadata) ([]byte, error) {
 			Lens:   make(map[string]uint64),
 			Parent: v,
 		}
-		for j := 0; j < valuev.NumField(); j++ {
-			tags, err := parseTags(typev.Field(j))
-			if err != nil {
-				return nil, err
-			}
-			m.Tags = tags
-			buf, err := marshal(valuev.Field(j).Interface(), m)
+		info, err := getStructInfo(typev)
+		if err != nil {
+			return nil, err
+		}
+		for j, f := range info.fields {
+			m.Tags = f.tags
+			buf, err := marshalField(valuev, j, f.tags, w.Len(), m)
 			if err != nil {
 				return nil, err
 			}
-			m.Lens[typev.Field(j).Name] = uint64(len(buf))
+			m.Lens[f.name] = uint64(len(buf))
 			if err := binary.Write(w, binary.LittleEndian, buf); err != nil {
 				return nil, err
 			}
@@ -300,15 +552,15 @@ func marshal(v interface{}, meta *Metadata) ([]byte, error) {
 				return nil, err
 			}
 		case reflect.Uint16:
-			if err := binary.Write(w, binary.LittleEndian, v.([]uint16)); err != nil {
+			if err := binary.Write(w, order, v.([]uint16)); err != nil {
 				return nil, err
 			}
 		case reflect.Uint32:
-			if err := binary.Write(w, binary.LittleEndian, v.([]uint32)); err != nil {
+			if err := binary.Write(w, order, v.([]uint32)); err != nil {
 				return nil, err
 			}
 		case reflect.Uint64:
-			if err := binary.Write(w, binary.LittleEndian, v.([]uint64)); err != nil {
+			if err := binary.Write(w, order, v.([]uint64)); err != nil {
 				return nil, err
 			}
 		case reflect.Struct:
@@ -367,7 +619,7 @@ func marshal(v interface{}, meta *Metadata) ([]byte, error) {
 			}
 			data = uint16(l)
 		}
-		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+		if err := binary.Write(w, order, data); err != nil {
 			return nil, err
 		}
 	case reflect.Uint32:
@@ -412,11 +664,11 @@ func marshal(v interface{}, meta *Metadata) ([]byte, error) {
 				return nil, nil
 			}
 		}
-		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+		if err := binary.Write(w, order, data); err != nil {
 			return nil, err
 		}
 	case reflect.Uint64:
-		if err := binary.Write(w, binary.LittleEndian, valuev.Interface().(uint64)); err != nil {
+		if err := binary.Write(w, order, valuev.Interface().(uint64)); err != nil {
 			return nil, err
 		}
 	default:
@@ -428,6 +680,7 @@ func marshal(v interface{}, meta *Metadata) ([]byte, error) {
 }
 
 func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
+	order := byteOrder(meta)
 	typev := reflect.TypeOf(v)
 	valuev := reflect.ValueOf(v)
 
@@ -448,39 +701,51 @@ func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
 	if typev.Kind() == reflect.Ptr {
 		valuev = reflect.ValueOf(v).Elem()
 		typev = valuev.Type()
+		if c, ok := lookupGenerated(typev); ok {
+			n, err := c.unmarshal(buf, v, meta.StrictBounds())
+			if err != nil {
+				return nil, err
+			}
+			if meta != nil {
+				meta.CurrOffset += uint64(n)
+			}
+			return valuev.Interface(), nil
+		}
 	}
 
 	if meta == nil {
-		meta = &Metadata{
-			Tags:       &TagMap{},
-			Lens:       make(map[string]uint64),
-			Parent:     v,
-			ParentBuf:  buf,
-			Offsets:    make(map[string]uint64),
-			Counts:     make(map[string]uint64),
-			CurrOffset: 0,
-		}
+		meta = newMetadata(v, buf)
 	}
 
 	r := bytes.NewBuffer(buf)
 	switch typev.Kind() {
 	case reflect.Struct:
-		m := &Metadata{
-			Tags:       &TagMap{},
-			Lens:       make(map[string]uint64),
-			Parent:     v,
-			ParentBuf:  buf,
-			Offsets:    make(map[string]uint64),
-			Counts:     make(map[string]uint64),
-			CurrOffset: 0,
-		}
-		for i := 0; i < typev.NumField(); i++ {
-			m.CurrField = typev.Field(i).Name
-			tags, err := parseTags(typev.Field(i))
+		m := newMetadata(v, buf)
+		m.Strict = meta.Strict
+		info, err := getStructInfo(typev)
+		if err != nil {
+			return nil, err
+		}
+		for i, f := range info.fields {
+			m.CurrField = f.name
+			if m.CurrOffset > uint64(len(buf)) {
+				return nil, fmt.Errorf("Buffer too small for struct field: %s", m.CurrField)
+			}
+			tags := f.tags
+			m.Tags = tags
+			present, err := isPresent(valuev, tags)
 			if err != nil {
 				return nil, err
 			}
-			m.Tags = tags
+			if !present {
+				continue
+			}
+			if tags.Has("switch") {
+				if err = unmarshalUnion(buf[m.CurrOffset:], valuev, valuev.Field(i), tags, m); err != nil {
+					return nil, err
+				}
+				continue
+			}
 			var data interface{}
 			switch typev.Field(i).Type.Kind() {
 			case reflect.Struct:
@@ -528,7 +793,7 @@ func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
 		return ret, nil
 	case reflect.Uint16:
 		var ret uint16
-		if err := binary.Read(r, binary.LittleEndian, &ret); err != nil {
+		if err := binary.Read(r, order, &ret); err != nil {
 			return nil, err
 		}
 		if meta.Tags.Has("len") {
@@ -555,7 +820,7 @@ func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
 		return ret, nil
 	case reflect.Uint32:
 		var ret uint32
-		if err := binary.Read(r, binary.LittleEndian, &ret); err != nil {
+		if err := binary.Read(r, order, &ret); err != nil {
 			return nil, err
 		}
 		if meta.Tags.Has("len") {
@@ -582,7 +847,7 @@ func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
 		return ret, nil
 	case reflect.Uint64:
 		var ret uint64
-		if err := binary.Read(r, binary.LittleEndian, &ret); err != nil {
+		if err := binary.Read(r, order, &ret); err != nil {
 			return nil, err
 		}
 		if meta.Tags.Has("count") {
@@ -633,7 +898,7 @@ func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
 				if val, ok := meta.Lens[meta.CurrField]; ok {
 					length = int(val)
 				} else {
-					err := fmt.Errorf("Variable length field missing length reference in struct field: " + meta.CurrField)
+					err := fmt.Errorf("Variable length field missing length reference in struct field: %s", meta.CurrField)
 					log.Errorln(err)
 					return nil, err
 				}
@@ -643,6 +908,9 @@ func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
 					// No offset found in map. Use current offset
 					offset = int(meta.CurrOffset)
 				}
+				if err := checkBounds(meta, offset, length); err != nil {
+					return nil, err
+				}
 				if offset != int(meta.CurrOffset) {
 					// Variable length data is relative to parent/outer struct. Reset reader to point to beginning of data
 					r = bytes.NewBuffer(meta.ParentBuf[offset : offset+length])
@@ -651,6 +919,9 @@ func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
 					meta.CurrOffset += uint64(length)
 				}
 			}
+			if err := CheckCount(uint64(length), 1, r.Len()); err != nil {
+				return nil, err
+			}
 			data := make([]byte, length)
 			if err := binary.Read(r, binary.LittleEndian, &data); err != nil {
 				return nil, err
@@ -672,7 +943,7 @@ func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
 					if val, ok := meta.Lens[meta.CurrField]; ok {
 						length = int(val)
 					} else {
-						err := fmt.Errorf("Variable length field missing length reference in struct field: " + meta.CurrField)
+						err := fmt.Errorf("Variable length field missing length reference in struct field: %s", meta.CurrField)
 						log.Errorln(err)
 						return nil, err
 					}
@@ -682,6 +953,9 @@ func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
 						// No offset found in map. Use current offset
 						offset = int(meta.CurrOffset)
 					}
+					if err := checkBounds(meta, offset, length*2); err != nil {
+						return nil, err
+					}
 					if offset != int(meta.CurrOffset) {
 						// Variable length data is relative to parent/outer struct. Reset reader to point to beginning of data
 						r = bytes.NewBuffer(meta.ParentBuf[offset : offset+length*2]) //TODO Should this be x2? Was originally only length
@@ -691,8 +965,11 @@ func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
 					}
 				}
 			}
+			if err := CheckCount(uint64(length), 2, r.Len()); err != nil {
+				return nil, err
+			}
 			data := make([]uint16, length)
-			if err := binary.Read(r, binary.LittleEndian, &data); err != nil {
+			if err := binary.Read(r, order, &data); err != nil {
 				return nil, err
 			}
 			return data, nil
@@ -713,10 +990,13 @@ func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
 				} else {
 					return nil, errors.New("Variable length (uint32) field missing count reference in struct field: " + meta.CurrField)
 				}
+				if err := CheckCount(uint64(count), 4, r.Len()); err != nil {
+					return nil, err
+				}
 				meta.CurrOffset += uint64(count * 4)
 				data = make([]uint32, count)
 			}
-			if err := binary.Read(r, binary.LittleEndian, &data); err != nil {
+			if err := binary.Read(r, order, &data); err != nil {
 				return nil, err
 			}
 			return data, nil
@@ -732,11 +1012,18 @@ func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
 				fmt.Println(err)
 				return nil, err
 			}
+			// Every element takes at least one byte
+			if err := CheckCount(count, 1, len(buf)); err != nil {
+				return nil, err
+			}
 			list := reflect.MakeSlice(typev, 0, int(count))
 			arrayOffset := uint64(0)
 			prevCurrMetaOffset := uint64(0)
 			for i := uint64(0); i < count; i++ {
 				prevCurrMetaOffset = meta.CurrOffset
+				if arrayOffset > uint64(len(buf)) {
+					return nil, fmt.Errorf("Buffer too small for struct field: %s", meta.CurrField)
+				}
 				x := reflect.New(typev.Elem())
 				data, err := unmarshal(buf[arrayOffset:], x.Interface(), meta)
 				if err != nil {
@@ -749,21 +1036,42 @@ func unmarshal(buf []byte, v interface{}, meta *Metadata) (interface{}, error) {
 			return list.Interface(), nil
 
 		default:
-			err := fmt.Errorf("Unmarshal not implemented for slice kind:" + typev.Kind().String())
+			err := fmt.Errorf("Unmarshal not implemented for slice kind: %s", typev.Kind())
 			log.Errorln(err)
 			return nil, err
 		}
 	default:
-		err := fmt.Errorf("Unmarshal not implemented for kind:" + typev.Kind().String())
+		err := fmt.Errorf("Unmarshal not implemented for kind: %s", typev.Kind())
 		log.Errorln(err)
 		return nil, err
 	}
+}
 
-	return nil, nil
-
+// checkBounds validates the location of variable length data that starts at
+// offset within the parent buffer
+func checkBounds(meta *Metadata, offset, length int) error {
+	if offset < 0 || length < 0 || offset > len(meta.ParentBuf) || length > len(meta.ParentBuf)-offset {
+		return fmt.Errorf("Buffer too small for field %s", meta.CurrField)
+	}
+	if meta.Strict && length > 0 && offset < int(meta.CurrOffset) {
+		return fmt.Errorf("Data of field %s overlaps preceding fields", meta.CurrField)
+	}
+	return nil
 }
 
 func Unmarshal(buf []byte, v interface{}) error {
 	_, err := unmarshal(buf, v, nil)
 	return err
 }
+
+// UnmarshalStrict is Unmarshal with strict bounds checking. The decoders
+// reject counts, lengths and offsets that are inconsistent with the rest of
+// the message, e.g., data offsets pointing back into the fixed part of a
+// struct, rather than decoding as much as possible. Input that does not fit
+// in the buffer is always rejected.
+func UnmarshalStrict(buf []byte, v interface{}) error {
+	meta := newMetadata(v, buf)
+	meta.Strict = true
+	_, err := unmarshal(buf, v, meta)
+	return err
+}
@@ -1 +1,227 @@
 package encoder
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type testUnion struct {
+	Small *testSmall `smb:"case:1"`
+	Large *testLarge `smb:"case:2"`
+	Other uint16     `smb:"case:default"`
+}
+
+type testSmall struct {
+	Value uint16
+}
+
+type testLarge struct {
+	Value uint64
+}
+
+type testTagged struct {
+	Level    uint8
+	Flags    uint16
+	Optional uint32    `smb:"if:Flags=1"`
+	Info     testUnion `smb:"switch:Level"`
+	Padding  []byte    `smb:"align:8"`
+	Trailer  uint16    `smb:"if:Flags!=0"`
+}
+
+func TestMarshalTagged(t *testing.T) {
+	v := testTagged{
+		Level:    2,
+		Flags:    1,
+		Optional: 0x11223344,
+		Info:     testUnion{Large: &testLarge{Value: 0x0102030405060708}},
+		Trailer:  0xaabb,
+	}
+	buf, err := Marshal(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		0x02, 0x01, 0x00, 0x44, 0x33, 0x22, 0x11,
+		0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01,
+		0x00, // Padding to 16 bytes
+		0xbb, 0xaa,
+	}
+	if !bytes.Equal(buf, expected) {
+		t.Fatalf("Fail\n%x\n%x", buf, expected)
+	}
+
+	var res testTagged
+	if err = Unmarshal(buf, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Optional != v.Optional || res.Info.Large == nil || res.Info.Large.Value != v.Info.Large.Value || res.Info.Small != nil || res.Trailer != v.Trailer {
+		t.Fatal("Fail")
+	}
+}
+
+func TestMarshalTaggedAbsent(t *testing.T) {
+	v := testTagged{
+		Level:    1,
+		Optional: 0x11223344,
+		Info:     testUnion{Small: &testSmall{Value: 0x0102}},
+		Trailer:  0xaabb,
+	}
+	buf, err := Marshal(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x01, 0x00, 0x00, 0x02, 0x01, 0x00, 0x00, 0x00}
+	if !bytes.Equal(buf, expected) {
+		t.Fatalf("Fail\n%x\n%x", buf, expected)
+	}
+
+	var res testTagged
+	if err = Unmarshal(buf, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Optional != 0 || res.Info.Small == nil || res.Info.Small.Value != 0x0102 || res.Trailer != 0 {
+		t.Fatal("Fail")
+	}
+
+	v.Level = 3
+	v.Info.Other = 0x0304
+	if buf, err = Marshal(&v); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, []byte{0x03, 0x00, 0x00, 0x04, 0x03, 0x00, 0x00, 0x00}) {
+		t.Fatal("Fail")
+	}
+
+	v.Level = 2
+	if _, err = Marshal(&v); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+type testByteOrder struct {
+	Length uint16 `smb:"len:Data,be"`
+	Value  uint32 `smb:"be"`
+	Little uint32
+	Large  uint64 `smb:"be"`
+	Data   []byte
+}
+
+func TestMarshalBigEndian(t *testing.T) {
+	v := testByteOrder{
+		Value:  0x01020304,
+		Little: 0x01020304,
+		Large:  0x0102030405060708,
+		Data:   []byte{0xaa, 0xbb},
+	}
+	buf, err := Marshal(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		0x00, 0x02,
+		0x01, 0x02, 0x03, 0x04,
+		0x04, 0x03, 0x02, 0x01,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0xaa, 0xbb,
+	}
+	if !bytes.Equal(buf, expected) {
+		t.Fatalf("Fail\n%x\n%x", buf, expected)
+	}
+
+	var res testByteOrder
+	if err = Unmarshal(buf, &res); err != nil {
+		t.Fatal(err)
+	}
+	v.Length = 2
+	if res.Length != v.Length || res.Value != v.Value || res.Little != v.Little || res.Large != v.Large || !bytes.Equal(res.Data, v.Data) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	for _, tc := range []struct{ n, c int }{
+		{0, 1024}, {1, 1024}, {1024, 1024}, {1025, 2048}, {65536 + 80, 131072}, {1 << 23, 1 << 23},
+	} {
+		b := GetBuffer(tc.n)
+		if len(b) != 0 || cap(b) != tc.c {
+			t.Fatalf("Fail: GetBuffer(%d) returned cap %d expected %d", tc.n, cap(b), tc.c)
+		}
+		PutBuffer(b)
+	}
+	// Too large for any class
+	if b := GetBuffer(1<<23 + 1); cap(b) != 1<<23+1 {
+		t.Fatal("Fail")
+	}
+	// Buffers not matching a class must not end up in the pool
+	PutBuffer(make([]byte, 10, 1500))
+	PutBuffer(GetBuffer(4096)[16:16])
+	for i := 0; i < 10; i++ {
+		if b := GetBuffer(1500); cap(b) != 2048 {
+			t.Fatal("Fail")
+		}
+		if b := GetBuffer(4000); cap(b) != 4096 {
+			t.Fatal("Fail")
+		}
+	}
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	for _, v := range []interface{}{
+		&testTagged{Level: 2, Flags: 1, Info: testUnion{Large: &testLarge{}}},
+		&testTagged{Level: 1, Info: testUnion{Small: &testSmall{}}},
+		&testByteOrder{Data: []byte{1, 2, 3}},
+	} {
+		buf, err := Marshal(v)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, unmarshal := range []func([]byte, interface{}) error{Unmarshal, UnmarshalStrict} {
+			unmarshal(data, &testTagged{})
+			unmarshal(data, &testByteOrder{})
+		}
+	})
+}
+
+func TestStructInfoCache(t *testing.T) {
+	typ := reflect.TypeOf(testTagged{})
+	info, err := getStructInfo(typ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.fields) != typ.NumField() || info.byName["Info"] != 3 {
+		t.Fatal("Fail")
+	}
+	if cond, err := info.fields[2].tags.GetString("if"); err != nil || cond != "Flags=1" {
+		t.Fatal("Fail")
+	}
+	// The same layout is returned for every lookup
+	cached, err := getStructInfo(typ)
+	if err != nil || cached != info {
+		t.Fatal("Fail")
+	}
+}
+
+func BenchmarkMarshalTagged(b *testing.B) {
+	v := testTagged{
+		Level:    2,
+		Flags:    1,
+		Optional: 0x11223344,
+		Info:     testUnion{Large: &testLarge{Value: 0x0102030405060708}},
+		Trailer:  0xaabb,
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err := Marshal(&v)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var res testTagged
+		if err = Unmarshal(buf, &res); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
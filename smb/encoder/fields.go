@@ -0,0 +1,78 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package encoder
+
+import (
+	"reflect"
+	"sync"
+)
+
+// fieldInfo is the reflected layout of a struct field
+type fieldInfo struct {
+	name string
+	tags *TagMap
+}
+
+// structInfo holds the fields of a struct type such that the smb tags are
+// parsed once per type rather than on every Marshal and Unmarshal
+type structInfo struct {
+	fields []fieldInfo
+	byName map[string]int // Field name to index in fields
+}
+
+var structCache sync.Map // reflect.Type to *structInfo
+
+// getStructInfo returns the cached field layout of the struct type t
+func getStructInfo(t reflect.Type) (*structInfo, error) {
+	if v, ok := structCache.Load(t); ok {
+		return v.(*structInfo), nil
+	}
+	info := &structInfo{
+		fields: make([]fieldInfo, t.NumField()),
+		byName: make(map[string]int, t.NumField()),
+	}
+	for i := range info.fields {
+		sf := t.Field(i)
+		tags, err := parseTags(sf)
+		if err != nil {
+			return nil, err
+		}
+		info.fields[i] = fieldInfo{name: sf.Name, tags: tags}
+		info.byName[sf.Name] = i
+	}
+	v, _ := structCache.LoadOrStore(t, info)
+	return v.(*structInfo), nil
+}
+
+// fieldTags returns the parsed tags of the field sf of the struct type t. The
+// cache only covers direct fields so promoted fields are parsed every time.
+func fieldTags(t reflect.Type, sf reflect.StructField) (*TagMap, error) {
+	if len(sf.Index) == 1 {
+		info, err := getStructInfo(t)
+		if err != nil {
+			return nil, err
+		}
+		return info.fields[sf.Index[0]].tags, nil
+	}
+	return parseTags(sf)
+}
@@ -0,0 +1,105 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package encoder
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+)
+
+// UseGenerated controls whether Marshal and Unmarshal use the static
+// functions registered by code generated with encgen. It can be disabled to
+// force the reflection based encoder, e.g., when verifying generated code.
+var UseGenerated = true
+
+type codec struct {
+	marshal   func(v interface{}) ([]byte, error)
+	buffers   func(v interface{}, threshold int) (net.Buffers, error)
+	unmarshal func(buf []byte, v interface{}, strict bool) (int, error)
+}
+
+// Populated from init functions only, so no locking is required
+var generated = map[reflect.Type]codec{}
+
+// Register installs generated marshal, unmarshal and size functions for the
+// struct type T. It is called from the init function of files produced by
+// encgen and is not meant to be used directly. The unmarshal function must
+// return the number of bytes consumed in the same way as the reflection based
+// decoder so that structs embedding T are decoded identically, and apply the
+// strict bounds checks of UnmarshalStrict when its last argument is true.
+func Register[T any](marshal func(*T, *Buffers) error, unmarshal func(*T, []byte, bool) (int, error), size func(*T) int) {
+	ptr := func(v interface{}) (*T, error) {
+		switch t := v.(type) {
+		case *T:
+			return t, nil
+		case T:
+			return &t, nil
+		}
+		return nil, fmt.Errorf("Generated marshal called with wrong type %T", v)
+	}
+	generated[reflect.TypeOf((*T)(nil)).Elem()] = codec{
+		marshal: func(v interface{}) ([]byte, error) {
+			p, err := ptr(v)
+			if err != nil {
+				return nil, err
+			}
+			b := Buffers{Buf: make([]byte, 0, size(p))}
+			if err = marshal(p, &b); err != nil {
+				return nil, err
+			}
+			return b.Buf, nil
+		},
+		buffers: func(v interface{}, threshold int) (net.Buffers, error) {
+			p, err := ptr(v)
+			if err != nil {
+				return nil, err
+			}
+			// Payloads below the threshold are copied so reserve some room
+			// for those in addition to the fixed size fields.
+			n := size(p)
+			if threshold > 0 && n > 2*threshold {
+				n = 2 * threshold
+			}
+			b := Buffers{Buf: GetBuffer(n), threshold: threshold}
+			if err = marshal(p, &b); err != nil {
+				return nil, err
+			}
+			return b.Segments(), nil
+		},
+		unmarshal: func(buf []byte, v interface{}, strict bool) (int, error) {
+			p, ok := v.(*T)
+			if !ok {
+				return 0, fmt.Errorf("Generated unmarshal called with wrong type %T", v)
+			}
+			return unmarshal(p, buf, strict)
+		},
+	}
+}
+
+func lookupGenerated(t reflect.Type) (c codec, ok bool) {
+	if !UseGenerated {
+		return
+	}
+	c, ok = generated[t]
+	return
+}
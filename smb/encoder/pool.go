@@ -0,0 +1,85 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package encoder
+
+import (
+	"math/bits"
+	"net"
+	"sync"
+)
+
+// Pooled buffers come in power of two size classes from 1 KiB to 8 MiB which
+// covers everything from a negotiate response to a maximum sized READ.
+const (
+	minPoolShift = 10
+	maxPoolShift = 23
+)
+
+var pools [maxPoolShift - minPoolShift + 1]sync.Pool
+
+// poolClass returns the index of the smallest size class that holds n bytes
+// or -1 if n is larger than the largest class.
+func poolClass(n int) int {
+	if n <= 1<<minPoolShift {
+		return 0
+	}
+	shift := bits.Len(uint(n - 1))
+	if shift > maxPoolShift {
+		return -1
+	}
+	return shift - minPoolShift
+}
+
+// GetBuffer returns an empty buffer with a capacity of at least n bytes. The
+// buffer can be handed back with PutBuffer once it is no longer referenced.
+func GetBuffer(n int) []byte {
+	c := poolClass(n)
+	if c < 0 {
+		return make([]byte, 0, n)
+	}
+	if p, ok := pools[c].Get().(*[]byte); ok {
+		return (*p)[:0]
+	}
+	return make([]byte, 0, 1<<(c+minPoolShift))
+}
+
+// PutBuffer returns a buffer to the pool. Buffers that don't match a size
+// class, e.g., because they were resliced or grown, are left to the garbage
+// collector. Neither the buffer nor any slice of it may be used afterwards.
+func PutBuffer(b []byte) {
+	c := poolClass(cap(b))
+	if c < 0 || cap(b) != 1<<(c+minPoolShift) {
+		return
+	}
+	b = b[:0]
+	pools[c].Put(&b)
+}
+
+// ReleaseBuffers returns the buffer backing the segments produced by
+// MarshalBuffers to the pool. Payloads referenced by the segments are owned
+// by the caller and are not affected.
+func ReleaseBuffers(bufs net.Buffers) {
+	if len(bufs) > 0 {
+		PutBuffer(bufs[0])
+	}
+}
@@ -0,0 +1,1663 @@
+// Code generated by encgen. DO NOT EDIT.
+
+package smb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+func init() {
+	encoder.Register((*Header).marshalSMB, (*Header).unmarshalSMB, (*Header).sizeSMB)
+	encoder.Register((*TransformHeader).marshalSMB, (*TransformHeader).unmarshalSMB, (*TransformHeader).sizeSMB)
+	encoder.Register((*NegContext).marshalSMB, (*NegContext).unmarshalSMB, (*NegContext).sizeSMB)
+	encoder.Register((*SessionSetupReq).marshalSMB, (*SessionSetupReq).unmarshalSMB, (*SessionSetupReq).sizeSMB)
+	encoder.Register((*SessionSetupRes).marshalSMB, (*SessionSetupRes).unmarshalSMB, (*SessionSetupRes).sizeSMB)
+	encoder.Register((*LogoffReq).marshalSMB, (*LogoffReq).unmarshalSMB, (*LogoffReq).sizeSMB)
+	encoder.Register((*LogoffRes).marshalSMB, (*LogoffRes).unmarshalSMB, (*LogoffRes).sizeSMB)
+	encoder.Register((*TreeConnectReq).marshalSMB, (*TreeConnectReq).unmarshalSMB, (*TreeConnectReq).sizeSMB)
+	encoder.Register((*TreeConnectRes).marshalSMB, (*TreeConnectRes).unmarshalSMB, (*TreeConnectRes).sizeSMB)
+	encoder.Register((*TreeDisconnectReq).marshalSMB, (*TreeDisconnectReq).unmarshalSMB, (*TreeDisconnectReq).sizeSMB)
+	encoder.Register((*TreeDisconnectRes).marshalSMB, (*TreeDisconnectRes).unmarshalSMB, (*TreeDisconnectRes).sizeSMB)
+	encoder.Register((*CreateReq).marshalSMB, (*CreateReq).unmarshalSMB, (*CreateReq).sizeSMB)
+	encoder.Register((*CreateRes).marshalSMB, (*CreateRes).unmarshalSMB, (*CreateRes).sizeSMB)
+	encoder.Register((*CloseReq).marshalSMB, (*CloseReq).unmarshalSMB, (*CloseReq).sizeSMB)
+	encoder.Register((*CloseRes).marshalSMB, (*CloseRes).unmarshalSMB, (*CloseRes).sizeSMB)
+	encoder.Register((*QueryDirectoryReq).marshalSMB, (*QueryDirectoryReq).unmarshalSMB, (*QueryDirectoryReq).sizeSMB)
+	encoder.Register((*QueryDirectoryRes).marshalSMB, (*QueryDirectoryRes).unmarshalSMB, (*QueryDirectoryRes).sizeSMB)
+	encoder.Register((*FileBothDirectoryInformationStruct).marshalSMB, (*FileBothDirectoryInformationStruct).unmarshalSMB, (*FileBothDirectoryInformationStruct).sizeSMB)
+	encoder.Register((*FileIdBothDirectoryInformationStruct).marshalSMB, (*FileIdBothDirectoryInformationStruct).unmarshalSMB, (*FileIdBothDirectoryInformationStruct).sizeSMB)
+	encoder.Register((*ReadReq).marshalSMB, (*ReadReq).unmarshalSMB, (*ReadReq).sizeSMB)
+	encoder.Register((*ReadRes).marshalSMB, (*ReadRes).unmarshalSMB, (*ReadRes).sizeSMB)
+	encoder.Register((*WriteReq).marshalSMB, (*WriteReq).unmarshalSMB, (*WriteReq).sizeSMB)
+	encoder.Register((*WriteRes).marshalSMB, (*WriteRes).unmarshalSMB, (*WriteRes).sizeSMB)
+	encoder.Register((*SetInfoReq).marshalSMB, (*SetInfoReq).unmarshalSMB, (*SetInfoReq).sizeSMB)
+	encoder.Register((*SetInfoRes).marshalSMB, (*SetInfoRes).unmarshalSMB, (*SetInfoRes).sizeSMB)
+	encoder.Register((*IoCtlReq).marshalSMB, (*IoCtlReq).unmarshalSMB, (*IoCtlReq).sizeSMB)
+	encoder.Register((*IoCtlRes).marshalSMB, (*IoCtlRes).unmarshalSMB, (*IoCtlRes).sizeSMB)
+	encoder.Register((*ChangeNotifyReq).marshalSMB, (*ChangeNotifyReq).unmarshalSMB, (*ChangeNotifyReq).sizeSMB)
+	encoder.Register((*ChangeNotifyRes).marshalSMB, (*ChangeNotifyRes).unmarshalSMB, (*ChangeNotifyRes).sizeSMB)
+	encoder.Register((*SMB1Header).marshalSMB, (*SMB1Header).unmarshalSMB, (*SMB1Header).sizeSMB)
+}
+
+func (self *Header) sizeSMB() int {
+	return 44 + len(self.ProtocolID) + len(self.Signature)
+}
+
+func (self *Header) marshalSMB(b *encoder.Buffers) error {
+	b.Buf = append(b.Buf, self.ProtocolID...)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.CreditCharge)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Status)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Command)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Credits)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Flags)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.NextCommand)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.MessageID)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Reserved)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.TreeID)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.SessionID)
+	b.Buf = append(b.Buf, self.Signature...)
+	return nil
+}
+
+func (self *Header) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	if len(buf)-n < 64 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.ProtocolID = make([]byte, 4)
+	copy(self.ProtocolID, buf[n:])
+	n += 4
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.CreditCharge = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Status = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Command = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Credits = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Flags = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.NextCommand = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.MessageID = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.Reserved = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.TreeID = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.SessionID = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.Signature = make([]byte, 16)
+	copy(self.Signature, buf[n:])
+	n += 16
+	return n, nil
+}
+
+func (self *TransformHeader) sizeSMB() int {
+	return 20 + len(self.Signature) + len(self.Nonce)
+}
+
+func (self *TransformHeader) marshalSMB(b *encoder.Buffers) error {
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.ProtcolID)
+	b.Buf = append(b.Buf, self.Signature...)
+	b.Buf = append(b.Buf, self.Nonce...)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.OriginalMessageSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Reserved)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Flags)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.SessionId)
+	return nil
+}
+
+func (self *TransformHeader) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	if len(buf)-n < 52 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.ProtcolID = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Signature = make([]byte, 16)
+	copy(self.Signature, buf[n:])
+	n += 16
+	self.Nonce = make([]byte, 16)
+	copy(self.Nonce, buf[n:])
+	n += 16
+	self.OriginalMessageSize = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Reserved = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Flags = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.SessionId = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	return n, nil
+}
+
+func (self *NegContext) sizeSMB() int {
+	return 8 + len(self.Data) + encoder.AlignLen(self.Padd, 8+len(self.Data), 8)
+}
+
+func (self *NegContext) marshalSMB(b *encoder.Buffers) error {
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.ContextType)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, uint16(len(self.Data)))
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Reserved)
+	b.AppendPayload(self.Data)
+	b.Buf = encoder.AppendAlign(b.Buf, self.Padd, 8+len(self.Data), 8)
+	return nil
+}
+
+func (self *NegContext) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var lenData int
+	if len(buf)-n < 8 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.ContextType = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.DataLength = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	lenData = int(self.DataLength)
+	self.Reserved = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	if lenData > len(buf)-n {
+		return n, fmt.Errorf("Buffer too small for field Data")
+	}
+	self.Data = make([]byte, lenData)
+	copy(self.Data, buf[n:])
+	n += lenData
+	self.Padd = []byte{}
+	if len(buf) > n {
+		n += (8 - n%8) % 8
+	}
+	return n, nil
+}
+
+func (self *SessionSetupReq) sizeSMB() int {
+	return 24 + self.Header.sizeSMB() + len(self.SecurityBlob)
+}
+
+func (self *SessionSetupReq) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = append(b.Buf, self.Flags)
+	b.Buf = append(b.Buf, self.SecurityMode)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Capabilities)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Channel)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, uint16(24+self.Header.sizeSMB()))
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, uint16(len(self.SecurityBlob)))
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.PreviousSessionID)
+	b.AppendPayload(self.SecurityBlob)
+	return nil
+}
+
+func (self *SessionSetupReq) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var offSecurityBlob int
+	var lenSecurityBlob int
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 24 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Flags = buf[n]
+	n++
+	self.SecurityMode = buf[n]
+	n++
+	self.Capabilities = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Channel = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.SecurityBufferOffset = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	offSecurityBlob = int(self.SecurityBufferOffset)
+	self.SecurityBufferLength = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	lenSecurityBlob = int(self.SecurityBufferLength)
+	self.PreviousSessionID = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	if offSecurityBlob != n {
+		if offSecurityBlob > len(buf) || lenSecurityBlob > len(buf)-offSecurityBlob {
+			return n, fmt.Errorf("Buffer too small for field SecurityBlob")
+		}
+		if strict && lenSecurityBlob > 0 && offSecurityBlob < n {
+			return n, fmt.Errorf("Data of field SecurityBlob overlaps preceding fields")
+		}
+		self.SecurityBlob = make([]byte, lenSecurityBlob)
+		copy(self.SecurityBlob, buf[offSecurityBlob:])
+	} else {
+		if lenSecurityBlob > len(buf)-n {
+			return n, fmt.Errorf("Buffer too small for field SecurityBlob")
+		}
+		self.SecurityBlob = make([]byte, lenSecurityBlob)
+		copy(self.SecurityBlob, buf[n:])
+		n += lenSecurityBlob
+	}
+	return n, nil
+}
+
+func (self *SessionSetupRes) sizeSMB() int {
+	return 8 + self.Header.sizeSMB() + len(self.SecurityBlob)
+}
+
+func (self *SessionSetupRes) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Flags)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, uint16(8+self.Header.sizeSMB()))
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, uint16(len(self.SecurityBlob)))
+	b.AppendPayload(self.SecurityBlob)
+	return nil
+}
+
+func (self *SessionSetupRes) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var offSecurityBlob int
+	var lenSecurityBlob int
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 8 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Flags = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.SecurityBufferOffset = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	offSecurityBlob = int(self.SecurityBufferOffset)
+	self.SecurityBufferLength = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	lenSecurityBlob = int(self.SecurityBufferLength)
+	if offSecurityBlob != n {
+		if offSecurityBlob > len(buf) || lenSecurityBlob > len(buf)-offSecurityBlob {
+			return n, fmt.Errorf("Buffer too small for field SecurityBlob")
+		}
+		if strict && lenSecurityBlob > 0 && offSecurityBlob < n {
+			return n, fmt.Errorf("Data of field SecurityBlob overlaps preceding fields")
+		}
+		self.SecurityBlob = make([]byte, lenSecurityBlob)
+		copy(self.SecurityBlob, buf[offSecurityBlob:])
+	} else {
+		if lenSecurityBlob > len(buf)-n {
+			return n, fmt.Errorf("Buffer too small for field SecurityBlob")
+		}
+		self.SecurityBlob = make([]byte, lenSecurityBlob)
+		copy(self.SecurityBlob, buf[n:])
+		n += lenSecurityBlob
+	}
+	return n, nil
+}
+
+func (self *LogoffReq) sizeSMB() int {
+	return 4 + self.Header.sizeSMB()
+}
+
+func (self *LogoffReq) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Reserved)
+	return nil
+}
+
+func (self *LogoffReq) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 4 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Reserved = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	return n, nil
+}
+
+func (self *LogoffRes) sizeSMB() int {
+	return 4 + self.Header.sizeSMB()
+}
+
+func (self *LogoffRes) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Reserved)
+	return nil
+}
+
+func (self *LogoffRes) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 4 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Reserved = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	return n, nil
+}
+
+func (self *TreeConnectReq) sizeSMB() int {
+	return 8 + self.Header.sizeSMB() + len(self.Path)
+}
+
+func (self *TreeConnectReq) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Reserved)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, uint16(8+self.Header.sizeSMB()))
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, uint16(len(self.Path)))
+	b.AppendPayload(self.Path)
+	return nil
+}
+
+func (self *TreeConnectReq) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var offPath int
+	var lenPath int
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 8 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Reserved = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.PathOffset = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	offPath = int(self.PathOffset)
+	self.PathLength = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	lenPath = int(self.PathLength)
+	if offPath != n {
+		if offPath > len(buf) || lenPath > len(buf)-offPath {
+			return n, fmt.Errorf("Buffer too small for field Path")
+		}
+		if strict && lenPath > 0 && offPath < n {
+			return n, fmt.Errorf("Data of field Path overlaps preceding fields")
+		}
+		self.Path = make([]byte, lenPath)
+		copy(self.Path, buf[offPath:])
+	} else {
+		if lenPath > len(buf)-n {
+			return n, fmt.Errorf("Buffer too small for field Path")
+		}
+		self.Path = make([]byte, lenPath)
+		copy(self.Path, buf[n:])
+		n += lenPath
+	}
+	return n, nil
+}
+
+func (self *TreeConnectRes) sizeSMB() int {
+	return 16 + self.Header.sizeSMB()
+}
+
+func (self *TreeConnectRes) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = append(b.Buf, self.ShareType)
+	b.Buf = append(b.Buf, self.Reserved)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.ShareFlags)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Capabilities)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.MaximalAccess)
+	return nil
+}
+
+func (self *TreeConnectRes) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 16 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.ShareType = buf[n]
+	n++
+	self.Reserved = buf[n]
+	n++
+	self.ShareFlags = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Capabilities = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.MaximalAccess = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	return n, nil
+}
+
+func (self *TreeDisconnectReq) sizeSMB() int {
+	return 4 + self.Header.sizeSMB()
+}
+
+func (self *TreeDisconnectReq) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Reserved)
+	return nil
+}
+
+func (self *TreeDisconnectReq) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 4 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Reserved = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	return n, nil
+}
+
+func (self *TreeDisconnectRes) sizeSMB() int {
+	return 4 + self.Header.sizeSMB()
+}
+
+func (self *TreeDisconnectRes) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Reserved)
+	return nil
+}
+
+func (self *TreeDisconnectRes) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 4 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Reserved = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	return n, nil
+}
+
+func (self *CreateReq) sizeSMB() int {
+	return 56 + self.Header.sizeSMB() + len(self.Buffer)
+}
+
+func (self *CreateReq) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = append(b.Buf, self.SecurityFlags)
+	b.Buf = append(b.Buf, self.RequestedOplockLevel)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.ImpersonationLevel)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.SmbCreateFlags)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.Reserved)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.DesiredAccess)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.FileAttributes)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.ShareAccess)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.CreateDisposition)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.CreateOptions)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.NameOffset)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.NameLength)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.CreateContextsOffset)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.CreateContextsLength)
+	b.AppendPayload(self.Buffer)
+	return nil
+}
+
+func (self *CreateReq) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 56 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.SecurityFlags = buf[n]
+	n++
+	self.RequestedOplockLevel = buf[n]
+	n++
+	self.ImpersonationLevel = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.SmbCreateFlags = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.Reserved = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.DesiredAccess = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.FileAttributes = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.ShareAccess = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.CreateDisposition = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.CreateOptions = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.NameOffset = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.NameLength = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.CreateContextsOffset = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.CreateContextsLength = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	return n, fmt.Errorf("Variable length field missing length reference in struct field: Buffer")
+}
+
+func (self *CreateRes) sizeSMB() int {
+	return 72 + self.Header.sizeSMB() + len(self.FileId) + len(self.Buffer)
+}
+
+func (self *CreateRes) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = append(b.Buf, self.OplockLevel)
+	b.Buf = append(b.Buf, self.Flags)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.CreateAction)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.CreationTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.LastAccessTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.LastWriteTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.ChangeTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.AllocationSize)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.EndOfFile)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.FileAttributes)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Reserved2)
+	b.Buf = append(b.Buf, self.FileId...)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(72+self.Header.sizeSMB()+len(self.FileId)))
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(len(self.Buffer)))
+	b.AppendPayload(self.Buffer)
+	return nil
+}
+
+func (self *CreateRes) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var offBuffer int
+	var lenBuffer int
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 88 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.OplockLevel = buf[n]
+	n++
+	self.Flags = buf[n]
+	n++
+	self.CreateAction = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.CreationTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.LastAccessTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.LastWriteTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.ChangeTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.AllocationSize = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.EndOfFile = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.FileAttributes = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Reserved2 = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.FileId = make([]byte, 16)
+	copy(self.FileId, buf[n:])
+	n += 16
+	self.CreateContextsOffset = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	offBuffer = int(self.CreateContextsOffset)
+	self.CreateContextsLength = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	lenBuffer = int(self.CreateContextsLength)
+	if offBuffer != n {
+		if offBuffer > len(buf) || lenBuffer > len(buf)-offBuffer {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		if strict && lenBuffer > 0 && offBuffer < n {
+			return n, fmt.Errorf("Data of field Buffer overlaps preceding fields")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[offBuffer:])
+	} else {
+		if lenBuffer > len(buf)-n {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[n:])
+		n += lenBuffer
+	}
+	return n, nil
+}
+
+func (self *CloseReq) sizeSMB() int {
+	return 8 + self.Header.sizeSMB() + len(self.FileId)
+}
+
+func (self *CloseReq) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Flags)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Reserved)
+	b.Buf = append(b.Buf, self.FileId...)
+	return nil
+}
+
+func (self *CloseReq) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 24 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Flags = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Reserved = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.FileId = make([]byte, 16)
+	copy(self.FileId, buf[n:])
+	n += 16
+	return n, nil
+}
+
+func (self *CloseRes) sizeSMB() int {
+	return 60 + self.Header.sizeSMB()
+}
+
+func (self *CloseRes) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Flags)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Reserved)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.CreationTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.LastAccessTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.LastWriteTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.ChangeTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.AllocationSize)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.EndOfFile)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.FileAttributes)
+	return nil
+}
+
+func (self *CloseRes) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 60 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Flags = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Reserved = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.CreationTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.LastAccessTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.LastWriteTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.ChangeTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.AllocationSize = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.EndOfFile = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.FileAttributes = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	return n, nil
+}
+
+func (self *QueryDirectoryReq) sizeSMB() int {
+	return 16 + self.Header.sizeSMB() + len(self.FileID) + len(self.Buffer)
+}
+
+func (self *QueryDirectoryReq) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = append(b.Buf, self.FileInformationClass)
+	b.Buf = append(b.Buf, self.Flags)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.FileIndex)
+	b.Buf = append(b.Buf, self.FileID...)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, uint16(16+self.Header.sizeSMB()+len(self.FileID)))
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, uint16(len(self.Buffer)))
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.OutputBufferLength)
+	b.AppendPayload(self.Buffer)
+	return nil
+}
+
+func (self *QueryDirectoryReq) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var offBuffer int
+	var lenBuffer int
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 32 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.FileInformationClass = buf[n]
+	n++
+	self.Flags = buf[n]
+	n++
+	self.FileIndex = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.FileID = make([]byte, 16)
+	copy(self.FileID, buf[n:])
+	n += 16
+	self.FileNameOffset = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	offBuffer = int(self.FileNameOffset)
+	self.FileNameLength = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	lenBuffer = int(self.FileNameLength)
+	self.OutputBufferLength = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	if offBuffer != n {
+		if offBuffer > len(buf) || lenBuffer > len(buf)-offBuffer {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		if strict && lenBuffer > 0 && offBuffer < n {
+			return n, fmt.Errorf("Data of field Buffer overlaps preceding fields")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[offBuffer:])
+	} else {
+		if lenBuffer > len(buf)-n {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[n:])
+		n += lenBuffer
+	}
+	return n, nil
+}
+
+func (self *QueryDirectoryRes) sizeSMB() int {
+	return 8 + self.Header.sizeSMB() + len(self.Buffer)
+}
+
+func (self *QueryDirectoryRes) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, uint16(8+self.Header.sizeSMB()))
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(len(self.Buffer)))
+	b.AppendPayload(self.Buffer)
+	return nil
+}
+
+func (self *QueryDirectoryRes) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var offBuffer int
+	var lenBuffer int
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 8 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.OutputBufferOffset = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	offBuffer = int(self.OutputBufferOffset)
+	self.OutputBufferLength = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	lenBuffer = int(self.OutputBufferLength)
+	if offBuffer != n {
+		if offBuffer > len(buf) || lenBuffer > len(buf)-offBuffer {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		if strict && lenBuffer > 0 && offBuffer < n {
+			return n, fmt.Errorf("Data of field Buffer overlaps preceding fields")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[offBuffer:])
+	} else {
+		if lenBuffer > len(buf)-n {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[n:])
+		n += lenBuffer
+	}
+	return n, nil
+}
+
+func (self *FileBothDirectoryInformationStruct) sizeSMB() int {
+	return 70 + len(self.ShortName) + len(self.FileName)
+}
+
+func (self *FileBothDirectoryInformationStruct) marshalSMB(b *encoder.Buffers) error {
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.NextEntryOffset)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.FileIndex)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.CreationTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.LastAccessTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.LastWriteTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.ChangeTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.EndOfFile)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.AllocationSize)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.FileAttributes)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(len(self.FileName)))
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.EaSize)
+	b.Buf = append(b.Buf, self.ShortNameLength)
+	b.Buf = append(b.Buf, self.Reserved)
+	b.Buf = append(b.Buf, self.ShortName...)
+	b.AppendPayload(self.FileName)
+	return nil
+}
+
+func (self *FileBothDirectoryInformationStruct) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var lenFileName int
+	if len(buf)-n < 94 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.NextEntryOffset = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.FileIndex = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.CreationTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.LastAccessTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.LastWriteTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.ChangeTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.EndOfFile = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.AllocationSize = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.FileAttributes = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.FileNameLength = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	lenFileName = int(self.FileNameLength)
+	self.EaSize = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.ShortNameLength = buf[n]
+	n++
+	self.Reserved = buf[n]
+	n++
+	self.ShortName = make([]byte, 24)
+	copy(self.ShortName, buf[n:])
+	n += 24
+	if lenFileName > len(buf)-n {
+		return n, fmt.Errorf("Buffer too small for field FileName")
+	}
+	self.FileName = make([]byte, lenFileName)
+	copy(self.FileName, buf[n:])
+	n += lenFileName
+	return n, nil
+}
+
+func (self *FileIdBothDirectoryInformationStruct) sizeSMB() int {
+	return 80 + len(self.ShortName) + len(self.FileName)
+}
+
+func (self *FileIdBothDirectoryInformationStruct) marshalSMB(b *encoder.Buffers) error {
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.NextEntryOffset)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.FileIndex)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.CreationTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.LastAccessTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.LastWriteTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.ChangeTime)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.EndOfFile)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.AllocationSize)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.FileAttributes)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(len(self.FileName)))
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.EaSize)
+	b.Buf = append(b.Buf, self.ShortNameLength)
+	b.Buf = append(b.Buf, self.Reserved1)
+	b.Buf = append(b.Buf, self.ShortName...)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Reserved2)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.FileId)
+	b.AppendPayload(self.FileName)
+	return nil
+}
+
+func (self *FileIdBothDirectoryInformationStruct) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var lenFileName int
+	if len(buf)-n < 104 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.NextEntryOffset = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.FileIndex = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.CreationTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.LastAccessTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.LastWriteTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.ChangeTime = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.EndOfFile = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.AllocationSize = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.FileAttributes = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.FileNameLength = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	lenFileName = int(self.FileNameLength)
+	self.EaSize = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.ShortNameLength = buf[n]
+	n++
+	self.Reserved1 = buf[n]
+	n++
+	self.ShortName = make([]byte, 24)
+	copy(self.ShortName, buf[n:])
+	n += 24
+	self.Reserved2 = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.FileId = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	if lenFileName > len(buf)-n {
+		return n, fmt.Errorf("Buffer too small for field FileName")
+	}
+	self.FileName = make([]byte, lenFileName)
+	copy(self.FileName, buf[n:])
+	n += lenFileName
+	return n, nil
+}
+
+func (self *ReadReq) sizeSMB() int {
+	return 32 + self.Header.sizeSMB() + len(self.FileId) + len(self.Buffer)
+}
+
+func (self *ReadReq) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = append(b.Buf, self.Padding)
+	b.Buf = append(b.Buf, self.Flags)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Length)
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.Offset)
+	b.Buf = append(b.Buf, self.FileId...)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.MinimumCount)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Channel)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.RemainingBytes)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.ReadChannelInfoOffset)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.ReadChannelInfoLength)
+	b.AppendPayload(self.Buffer)
+	return nil
+}
+
+func (self *ReadReq) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 48 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Padding = buf[n]
+	n++
+	self.Flags = buf[n]
+	n++
+	self.Length = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Offset = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.FileId = make([]byte, 16)
+	copy(self.FileId, buf[n:])
+	n += 16
+	self.MinimumCount = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Channel = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.RemainingBytes = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.ReadChannelInfoOffset = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.ReadChannelInfoLength = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	return n, fmt.Errorf("Variable length field missing length reference in struct field: Buffer")
+}
+
+func (self *ReadRes) sizeSMB() int {
+	return 16 + self.Header.sizeSMB() + len(self.Buffer)
+}
+
+func (self *ReadRes) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = append(b.Buf, self.DataOffset)
+	b.Buf = append(b.Buf, self.Reserved)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(len(self.Buffer)))
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.DataRemaining)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Reserved2)
+	b.AppendPayload(self.Buffer)
+	return nil
+}
+
+func (self *ReadRes) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var lenBuffer int
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 16 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.DataOffset = buf[n]
+	n++
+	self.Reserved = buf[n]
+	n++
+	self.DataLength = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	lenBuffer = int(self.DataLength)
+	self.DataRemaining = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Reserved2 = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	if lenBuffer > len(buf)-n {
+		return n, fmt.Errorf("Buffer too small for field Buffer")
+	}
+	self.Buffer = make([]byte, lenBuffer)
+	copy(self.Buffer, buf[n:])
+	n += lenBuffer
+	return n, nil
+}
+
+func (self *WriteReq) sizeSMB() int {
+	return 32 + self.Header.sizeSMB() + len(self.FileId) + len(self.Buffer)
+}
+
+func (self *WriteReq) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, uint16(32+self.Header.sizeSMB()+len(self.FileId)))
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(len(self.Buffer)))
+	b.Buf = binary.LittleEndian.AppendUint64(b.Buf, self.Offset)
+	b.Buf = append(b.Buf, self.FileId...)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Channel)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.RemainingBytes)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.WriteChannelInfoOffset)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.WriteChannelInfoLength)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Flags)
+	b.AppendPayload(self.Buffer)
+	return nil
+}
+
+func (self *WriteReq) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var offBuffer int
+	var lenBuffer int
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 48 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.DataOffset = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	offBuffer = int(self.DataOffset)
+	self.Length = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	lenBuffer = int(self.Length)
+	self.Offset = binary.LittleEndian.Uint64(buf[n:])
+	n += 8
+	self.FileId = make([]byte, 16)
+	copy(self.FileId, buf[n:])
+	n += 16
+	self.Channel = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.RemainingBytes = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.WriteChannelInfoOffset = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.WriteChannelInfoLength = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Flags = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	if offBuffer != n {
+		if offBuffer > len(buf) || lenBuffer > len(buf)-offBuffer {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		if strict && lenBuffer > 0 && offBuffer < n {
+			return n, fmt.Errorf("Data of field Buffer overlaps preceding fields")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[offBuffer:])
+	} else {
+		if lenBuffer > len(buf)-n {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[n:])
+		n += lenBuffer
+	}
+	return n, nil
+}
+
+func (self *WriteRes) sizeSMB() int {
+	return 16 + self.Header.sizeSMB()
+}
+
+func (self *WriteRes) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Reserved)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Count)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Remaining)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.WriteChannelInfoOffset)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.WriteChannelInfoLength)
+	return nil
+}
+
+func (self *WriteRes) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 16 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Reserved = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Count = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Remaining = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.WriteChannelInfoOffset = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.WriteChannelInfoLength = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	return n, nil
+}
+
+func (self *SetInfoReq) sizeSMB() int {
+	return 16 + self.Header.sizeSMB() + len(self.FileId) + len(self.Buffer)
+}
+
+func (self *SetInfoReq) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = append(b.Buf, self.InfoType)
+	b.Buf = append(b.Buf, self.FileInfoClass)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(len(self.Buffer)))
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, uint16(16+self.Header.sizeSMB()+len(self.FileId)))
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Reserved)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.AdditionalInformation)
+	b.Buf = append(b.Buf, self.FileId...)
+	b.AppendPayload(self.Buffer)
+	return nil
+}
+
+func (self *SetInfoReq) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var lenBuffer int
+	var offBuffer int
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 32 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.InfoType = buf[n]
+	n++
+	self.FileInfoClass = buf[n]
+	n++
+	self.BufferLength = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	lenBuffer = int(self.BufferLength)
+	self.BufferOffset = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	offBuffer = int(self.BufferOffset)
+	self.Reserved = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.AdditionalInformation = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.FileId = make([]byte, 16)
+	copy(self.FileId, buf[n:])
+	n += 16
+	if offBuffer != n {
+		if offBuffer > len(buf) || lenBuffer > len(buf)-offBuffer {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		if strict && lenBuffer > 0 && offBuffer < n {
+			return n, fmt.Errorf("Data of field Buffer overlaps preceding fields")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[offBuffer:])
+	} else {
+		if lenBuffer > len(buf)-n {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[n:])
+		n += lenBuffer
+	}
+	return n, nil
+}
+
+func (self *SetInfoRes) sizeSMB() int {
+	return 2 + self.Header.sizeSMB()
+}
+
+func (self *SetInfoRes) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	return nil
+}
+
+func (self *SetInfoRes) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 2 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	return n, nil
+}
+
+func (self *IoCtlReq) sizeSMB() int {
+	return 40 + self.Header.sizeSMB() + len(self.FileId) + len(self.Buffer)
+}
+
+func (self *IoCtlReq) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Reserved)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.CtlCode)
+	b.Buf = append(b.Buf, self.FileId...)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(40+self.Header.sizeSMB()+len(self.FileId)))
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(len(self.Buffer)))
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.MaxInputResponse)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.OutputOffset)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.OutputCount)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.MaxOutputResponse)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Flags)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Reserved2)
+	b.AppendPayload(self.Buffer)
+	return nil
+}
+
+func (self *IoCtlReq) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var offBuffer int
+	var lenBuffer int
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 56 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Reserved = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.CtlCode = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.FileId = make([]byte, 16)
+	copy(self.FileId, buf[n:])
+	n += 16
+	self.InputOffset = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	offBuffer = int(self.InputOffset)
+	self.InputCount = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	lenBuffer = int(self.InputCount)
+	self.MaxInputResponse = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.OutputOffset = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.OutputCount = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.MaxOutputResponse = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Flags = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Reserved2 = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	if offBuffer != n {
+		if offBuffer > len(buf) || lenBuffer > len(buf)-offBuffer {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		if strict && lenBuffer > 0 && offBuffer < n {
+			return n, fmt.Errorf("Data of field Buffer overlaps preceding fields")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[offBuffer:])
+	} else {
+		if lenBuffer > len(buf)-n {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[n:])
+		n += lenBuffer
+	}
+	return n, nil
+}
+
+func (self *IoCtlRes) sizeSMB() int {
+	return 32 + self.Header.sizeSMB() + len(self.FileId) + len(self.Buffer)
+}
+
+func (self *IoCtlRes) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Reserved)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.CtlCode)
+	b.Buf = append(b.Buf, self.FileId...)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(32+self.Header.sizeSMB()+len(self.FileId)))
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(len(self.Buffer)))
+	if len(self.Buffer) == 0 {
+		b.Buf = binary.LittleEndian.AppendUint32(b.Buf, 0)
+	} else {
+		b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(32+self.Header.sizeSMB()+len(self.FileId)))
+	}
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(len(self.Buffer)))
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Flags)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Reserved2)
+	b.AppendPayload(self.Buffer)
+	return nil
+}
+
+func (self *IoCtlRes) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var offBuffer int
+	var lenBuffer int
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 48 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Reserved = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.CtlCode = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.FileId = make([]byte, 16)
+	copy(self.FileId, buf[n:])
+	n += 16
+	self.InputOffset = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	offBuffer = int(self.InputOffset)
+	self.InputCount = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	lenBuffer = int(self.InputCount)
+	self.OutputOffset = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	offBuffer = int(self.OutputOffset)
+	self.OutputCount = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	lenBuffer = int(self.OutputCount)
+	self.Flags = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Reserved2 = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	if offBuffer != n {
+		if offBuffer > len(buf) || lenBuffer > len(buf)-offBuffer {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		if strict && lenBuffer > 0 && offBuffer < n {
+			return n, fmt.Errorf("Data of field Buffer overlaps preceding fields")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[offBuffer:])
+	} else {
+		if lenBuffer > len(buf)-n {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[n:])
+		n += lenBuffer
+	}
+	return n, nil
+}
+
+func (self *ChangeNotifyReq) sizeSMB() int {
+	return 16 + self.Header.sizeSMB() + len(self.FileId)
+}
+
+func (self *ChangeNotifyReq) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Flags)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.OutputBufferLength)
+	b.Buf = append(b.Buf, self.FileId...)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.CompletionFilter)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Reserved)
+	return nil
+}
+
+func (self *ChangeNotifyReq) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 32 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.Flags = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.OutputBufferLength = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.FileId = make([]byte, 16)
+	copy(self.FileId, buf[n:])
+	n += 16
+	self.CompletionFilter = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Reserved = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	return n, nil
+}
+
+func (self *ChangeNotifyRes) sizeSMB() int {
+	return 8 + self.Header.sizeSMB() + len(self.Buffer)
+}
+
+func (self *ChangeNotifyRes) marshalSMB(b *encoder.Buffers) error {
+	if err := self.Header.marshalSMB(b); err != nil {
+		return err
+	}
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.StructureSize)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, uint16(8+self.Header.sizeSMB()))
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, uint32(len(self.Buffer)))
+	b.AppendPayload(self.Buffer)
+	return nil
+}
+
+func (self *ChangeNotifyRes) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	var offBuffer int
+	var lenBuffer int
+	var mHeader int
+	if mHeader, err = self.Header.unmarshalSMB(buf[n:], strict); err != nil {
+		return n, err
+	}
+	n += mHeader
+	if len(buf)-n < 8 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.OutputBufferOffset = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	offBuffer = int(self.OutputBufferOffset)
+	self.OutputBufferLength = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	lenBuffer = int(self.OutputBufferLength)
+	if offBuffer != n {
+		if offBuffer > len(buf) || lenBuffer > len(buf)-offBuffer {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		if strict && lenBuffer > 0 && offBuffer < n {
+			return n, fmt.Errorf("Data of field Buffer overlaps preceding fields")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[offBuffer:])
+	} else {
+		if lenBuffer > len(buf)-n {
+			return n, fmt.Errorf("Buffer too small for field Buffer")
+		}
+		self.Buffer = make([]byte, lenBuffer)
+		copy(self.Buffer, buf[n:])
+		n += lenBuffer
+	}
+	return n, nil
+}
+
+func (self *SMB1Header) sizeSMB() int {
+	return 20 + len(self.Protocol) + len(self.SecurityFeatures)
+}
+
+func (self *SMB1Header) marshalSMB(b *encoder.Buffers) error {
+	b.Buf = append(b.Buf, self.Protocol...)
+	b.Buf = append(b.Buf, self.Command)
+	b.Buf = binary.LittleEndian.AppendUint32(b.Buf, self.Status)
+	b.Buf = append(b.Buf, self.Flags)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Flags2)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.PIDHigh)
+	b.Buf = append(b.Buf, self.SecurityFeatures...)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.Reserved)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.TID)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.PIDLow)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.UID)
+	b.Buf = binary.LittleEndian.AppendUint16(b.Buf, self.MID)
+	return nil
+}
+
+func (self *SMB1Header) unmarshalSMB(buf []byte, strict bool) (n int, err error) {
+	if len(buf)-n < 32 {
+		return n, io.ErrUnexpectedEOF
+	}
+	self.Protocol = make([]byte, 4)
+	copy(self.Protocol, buf[n:])
+	n += 4
+	self.Command = buf[n]
+	n++
+	self.Status = binary.LittleEndian.Uint32(buf[n:])
+	n += 4
+	self.Flags = buf[n]
+	n++
+	self.Flags2 = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.PIDHigh = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.SecurityFeatures = make([]byte, 8)
+	copy(self.SecurityFeatures, buf[n:])
+	n += 8
+	self.Reserved = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.TID = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.PIDLow = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.UID = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	self.MID = binary.LittleEndian.Uint16(buf[n:])
+	n += 2
+	return n, nil
+}
@@ -0,0 +1,265 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// fillStruct populates all fields of the struct pointed to by v with
+// deterministic data so that generated and reflection based encoding can be
+// compared.
+func fillStruct(v reflect.Value, seed *byte, varLen int) {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		tag := t.Field(i).Tag.Get("smb")
+		*seed += 7
+		switch f.Kind() {
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f.SetUint(uint64(*seed) * 0x01010101)
+		case reflect.Slice:
+			n := varLen
+			if strings.HasPrefix(tag, "fixed:") {
+				n, _ = strconv.Atoi(strings.TrimPrefix(tag, "fixed:"))
+			} else if strings.HasPrefix(tag, "align:") {
+				// Nil alignment fields are padded automatically
+				if varLen != 0 {
+					f.SetBytes(nil)
+					continue
+				}
+				n = 0
+			}
+			b := make([]byte, n)
+			for j := range b {
+				b[j] = *seed + byte(j)
+			}
+			f.SetBytes(b)
+		case reflect.Struct:
+			fillStruct(f, seed, varLen)
+		}
+	}
+}
+
+// Simple test to verify that the generated encoders produce the same result
+// as the reflection based encoder
+func TestGeneratedEncoder(t *testing.T) {
+	defer func() { encoder.UseGenerated = true }()
+	types := []interface{}{
+		Header{}, TransformHeader{}, NegContext{}, SessionSetupReq{}, SessionSetupRes{},
+		LogoffReq{}, LogoffRes{}, TreeConnectReq{}, TreeConnectRes{}, TreeDisconnectReq{},
+		TreeDisconnectRes{}, CreateReq{}, CreateRes{}, CloseReq{}, CloseRes{}, QueryDirectoryReq{},
+		QueryDirectoryRes{}, FileBothDirectoryInformationStruct{}, FileIdBothDirectoryInformationStruct{},
+		ReadReq{}, ReadRes{}, WriteReq{}, WriteRes{}, SetInfoReq{}, SetInfoRes{}, IoCtlReq{}, IoCtlRes{},
+		SMB1Header{},
+	}
+	for _, varLen := range []int{0, 5} {
+		for _, typ := range types {
+			name := reflect.TypeOf(typ).Name()
+			p := reflect.New(reflect.TypeOf(typ))
+			seed := byte(varLen)
+			fillStruct(p.Elem(), &seed, varLen)
+
+			encoder.UseGenerated = false
+			expected, err := encoder.Marshal(p.Interface())
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			encoder.UseGenerated = true
+			buf, err := encoder.Marshal(p.Elem().Interface())
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			if !bytes.Equal(buf, expected) {
+				t.Fatalf("%s: generated marshal mismatch\n%x\n%x", name, buf, expected)
+			}
+
+			encoder.UseGenerated = false
+			expectedRes := reflect.New(reflect.TypeOf(typ))
+			expectedErr := encoder.Unmarshal(expected, expectedRes.Interface())
+			encoder.UseGenerated = true
+			res := reflect.New(reflect.TypeOf(typ))
+			err = encoder.Unmarshal(expected, res.Interface())
+			if (err == nil) != (expectedErr == nil) {
+				t.Fatalf("%s: generated unmarshal error mismatch: %v vs %v", name, err, expectedErr)
+			}
+			if err == nil && !reflect.DeepEqual(res.Interface(), expectedRes.Interface()) {
+				t.Fatalf("%s: generated unmarshal mismatch\n%+v\n%+v", name, res.Interface(), expectedRes.Interface())
+			}
+		}
+	}
+}
+
+func TestMarshalBuffers(t *testing.T) {
+	data := make([]byte, encoder.StreamThreshold*2)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	req := WriteReq{
+		Header:        Header{ProtocolID: []byte(ProtocolSmb2), StructureSize: 64, Signature: make([]byte, 16)},
+		StructureSize: 49,
+		FileId:        make([]byte, 16),
+		Buffer:        data,
+	}
+	bufs, err := encoder.MarshalBuffers(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	referenced := false
+	for _, p := range bufs {
+		if len(p) > 0 && &p[0] == &data[0] {
+			referenced = true
+		}
+	}
+	if !referenced {
+		t.Fatal("Fail")
+	}
+	buf, err := encoder.Marshal(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bytes.Join(bufs, nil), buf) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestReadPacketStreamed(t *testing.T) {
+	data := make([]byte, 8000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	res := ReadRes{
+		Header: Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       CommandRead,
+			MessageID:     7,
+			Signature:     make([]byte, 16),
+		},
+		StructureSize: 17,
+		DataOffset:    readResponseDataOffset, // Byte sized offsets are not computed by the encoder
+		Buffer:        data,
+	}
+	buf, err := encoder.Marshal(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	c := &Connection{conn: client, outstandingRequests: newOutstandingRequests()}
+	dst := make([]byte, 10000)
+	c.outstandingRequests.set(7, &requestResponse{msgId: 7, dst: dst})
+
+	go func() {
+		size := binary.BigEndian.AppendUint32(nil, uint32(len(buf)))
+		server.Write(append(size, buf...))
+	}()
+
+	packet, payload, err := c.readPacketStreamed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) != len(data) || &payload[0] != &dst[0] || !bytes.Equal(dst[:len(data)], data) {
+		t.Fatal("Fail")
+	}
+	if !bytes.Equal(packet, buf[:readResponseDataOffset]) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestReadPacketNotStreamedWhenSigned(t *testing.T) {
+	data := []byte("data with a forged signature")
+	res := ReadRes{
+		Header: Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       CommandRead,
+			MessageID:     7,
+			Signature:     make([]byte, 16),
+		},
+		StructureSize: 17,
+		DataOffset:    readResponseDataOffset,
+		Buffer:        data,
+	}
+	buf, err := encoder.Marshal(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	c := &Connection{Session: &Session{}, conn: client, outstandingRequests: newOutstandingRequests()}
+	c.enableSession()
+	c.isSigningRequired.Store(true)
+	dst := make([]byte, 100)
+	rr := &requestResponse{msgId: 7, dst: dst, recv: make(chan []byte, 1)}
+	c.outstandingRequests.set(7, rr)
+
+	go func() {
+		size := binary.BigEndian.AppendUint32(nil, uint32(len(buf)))
+		server.Write(append(size, buf...))
+	}()
+
+	// The data is only copied to dst once the signature is verified
+	packet, payload, err := c.readPacketStreamed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload != nil || !bytes.Equal(packet, buf) || !bytes.Equal(dst, make([]byte, 100)) {
+		t.Fatal("Fail")
+	}
+
+	// The request fails instead of waiting for a valid response
+	c.rejectResponse(7, packet, fmt.Errorf("invalid signature"))
+	if _, err = c.recv(rr); err == nil {
+		t.Fatal("Fail")
+	}
+	if _, ok := c.outstandingRequests.get(7); ok {
+		t.Fatal("Fail")
+	}
+}
+
+func TestReadResponseData(t *testing.T) {
+	data := []byte("some file data")
+	res := ReadRes{
+		Header: Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       CommandRead,
+			Signature:     make([]byte, 16),
+		},
+		StructureSize: 17,
+		DataOffset:    readResponseDataOffset,
+		Buffer:        data,
+	}
+	buf, err := encoder.Marshal(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := readResponseData(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) || &b[0] != &buf[readResponseDataOffset] {
+		t.Fatal("Fail")
+	}
+
+	// Data length pointing past the end of the response
+	binary.LittleEndian.PutUint32(buf[68:72], uint32(len(data)+1))
+	if _, err = readResponseData(buf); err == nil {
+		t.Fatal("Fail")
+	}
+	if _, err = readResponseData(buf[:64]); err == nil {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,87 @@
+package smb
+
+import (
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/compression"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+func FuzzUnmarshal(f *testing.F) {
+	header := newHeader()
+	for _, v := range []interface{}{
+		&header,
+		&ReadRes{Header: header, StructureSize: 17, DataOffset: 80, Buffer: []byte("data")},
+		&CreateRes{Header: header, FileId: make([]byte, 16), Buffer: []byte("context")},
+		&SessionSetupRes{Header: header, SecurityBlob: []byte("blob")},
+	} {
+		buf, err := encoder.Marshal(v)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf)
+	}
+	f.Add(append([]byte(ProtocolSmb), make([]byte, 40)...))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, strict := range []bool{false, true} {
+			unmarshal := encoder.Unmarshal
+			if strict {
+				unmarshal = encoder.UnmarshalStrict
+			}
+			for _, v := range []interface{}{
+				&Header{}, &TransformHeader{}, &NegotiateRes{}, &SessionSetupRes{}, &TreeConnectRes{},
+				&CreateRes{}, &CloseRes{}, &QueryDirectoryRes{}, &ReadRes{}, &WriteRes{}, &IoCtlRes{},
+				&SetInfoRes{}, &SessionSetupReq{}, &TreeConnectReq{}, &CreateReq{}, &CloseReq{},
+				&QueryDirectoryReq{}, &ReadReq{}, &WriteReq{}, &SetInfoReq{}, &FileIdBothDirectoryInformationStruct{},
+			} {
+				unmarshal(data, v)
+			}
+			// Custom decoders are called directly as well
+			for _, v := range []encoder.BinaryMarshallable{
+				&QueryInfoRes{}, &QueryInfoReq{}, &NegotiateReq{}, &SecurityDescriptor{}, &PACL{}, &SMB1NegotiateRes{},
+			} {
+				v.UnmarshalBinary(data, &encoder.Metadata{Strict: strict})
+			}
+			readResponseData(data)
+			parseFileStreams(data)
+			parseCreateContexts(data)
+			parseAAPLServerQuery(data)
+			compression.DecompressLZ77(nil, data, 1<<16)
+		}
+	})
+}
+
+func FuzzDecodeMessage(f *testing.F) {
+	header := newHeader()
+	header.Command = CommandRead
+	f.Add([]byte(nil))
+	for _, v := range []interface{}{
+		&ReadReq{Header: header, StructureSize: 49, Length: 4, FileId: make([]byte, 16)},
+		&ReadRes{Header: header, StructureSize: 17, DataOffset: 80, Buffer: []byte("data")},
+	} {
+		buf, err := encoder.Marshal(v)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf)
+		header.Flags = SMB2_FLAGS_SERVER_TO_REDIR
+	}
+	f.Add(append([]byte(ProtocolSmb), make([]byte, 40)...))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, decode := range []func([]byte) (any, error){DecodeMessage, DecodeMessageStrict} {
+			decode(data)
+			if len(data) >= 64 {
+				// Try every command as both request and response
+				for command := range messageTypes {
+					for _, flags := range []byte{0, 1} {
+						buf := append([]byte(ProtocolSmb2), data[4:]...)
+						buf[12], buf[13], buf[16] = byte(command), 0, flags
+						decode(buf)
+					}
+				}
+			}
+		}
+	})
+}
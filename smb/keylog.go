@@ -0,0 +1,79 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// KeyLogEnv names the environment variable with the key log file used when
+// Options.KeyLogFile is empty
+const KeyLogEnv = "SMBKEYLOGFILE"
+
+// Serializes the writes of concurrent connections to the key log files
+var keyLogLock sync.Mutex
+
+// keyLogLine formats the keys of a session as a line of the smb2_seskey_list
+// file of Wireshark, which has the session id in little-endian order as on
+// the wire, the session key and the server to client and client to server
+// cipher keys. The cipher keys are empty without encryption.
+func keyLogLine(sessionID uint64, sessionKey []byte, keys SessionKeys) string {
+	id := binary.LittleEndian.AppendUint64(nil, sessionID)
+	return fmt.Sprintf("\"%s\",\"%s\",\"%s\",\"%s\"\n",
+		hex.EncodeToString(id),
+		hex.EncodeToString(sessionKey),
+		hex.EncodeToString(keys.DecryptionKey),
+		hex.EncodeToString(keys.EncryptionKey))
+}
+
+// keyLogFile returns the key log file of the connection, empty when the keys
+// are not logged
+func (c *Connection) keyLogFile() string {
+	if c.options.KeyLogFile != "" {
+		return c.options.KeyLogFile
+	}
+	return os.Getenv(KeyLogEnv)
+}
+
+// logSessionKeys appends the keys of an authenticated session to the key log
+// file. Failing to do so is logged rather than failing the session setup.
+func (c *Connection) logSessionKeys(sessionKey []byte, keys SessionKeys) {
+	name := c.keyLogFile()
+	if name == "" {
+		return
+	}
+	keyLogLock.Lock()
+	defer keyLogLock.Unlock()
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		log.Errorf("Failed to open the key log file: %s\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err = f.WriteString(keyLogLine(c.sessionID, sessionKey, keys)); err != nil {
+		log.Errorf("Failed to write the key log file: %s\n", err)
+	}
+}
@@ -0,0 +1,37 @@
+package smb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyLog(t *testing.T) {
+	keys := SessionKeys{EncryptionKey: []byte{1, 2}, DecryptionKey: []byte{3, 4}}
+	line := keyLogLine(0x0000a40000000045, []byte{0xaa, 0xbb}, keys)
+	if line != "\"4500000000a40000\",\"aabb\",\"0304\",\"0102\"\n" {
+		t.Fatalf("Fail: %s", line)
+	}
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "keys")
+	t.Setenv(KeyLogEnv, filepath.Join(dir, "env"))
+	c := &Connection{Session: &Session{options: Options{KeyLogFile: name}, sessionID: 1}}
+	c.logSessionKeys([]byte{0xaa}, SessionKeys{})
+	c.sessionID = 2
+	c.logSessionKeys([]byte{0xbb}, keys)
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if string(buf) != "\"0100000000000000\",\"aa\",\"\",\"\"\n\"0200000000000000\",\"bb\",\"0304\",\"0102\"\n" {
+		t.Fatalf("Fail: %s", buf)
+	}
+
+	// The environment variable is used without the option
+	c.options.KeyLogFile = ""
+	c.logSessionKeys([]byte{0xcc}, SessionKeys{})
+	if buf, err = os.ReadFile(filepath.Join(dir, "env")); err != nil || len(buf) == 0 {
+		t.Fatalf("Fail: %+v", err)
+	}
+}
@@ -0,0 +1,271 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/ericblavier/go-smb/gss"
+	"github.com/ericblavier/go-smb/smb/encoder"
+	"github.com/ericblavier/go-smb/spnego"
+)
+
+// Name of the named pipe of the Remote Administration Protocol
+const LanmanPipe = "\\PIPE\\LANMAN"
+
+const (
+	// Extended security negotiation in addition to smb1CheckFlags2
+	smb1FlagsExtendedSecurity uint16 = 0x0800
+	// MS-CIFS 2.2.4.52.2 SecurityMode and Capabilities of the NEGOTIATE
+	// response
+	smb1SecuritySignaturesRequired uint8  = 0x08
+	smb1CapExtendedSecurity        uint32 = 0x80000000
+)
+
+// LanmanOptions are the options of DialLanman
+type LanmanOptions struct {
+	ProbeOptions // Dialects are ignored. The Timeout covers the whole session
+	// Authentication over extended security. The session is anonymous when
+	// nil.
+	Initiator gss.Mechanism
+}
+
+// LanmanSession is a SMB1 session connected to IPC$ for devices that only
+// speak SMB1 and offer the Remote Administration Protocol rather than
+// DCE/RPC services. It sends transactions on \PIPE\LANMAN and is not safe
+// for concurrent use.
+type LanmanSession struct {
+	conn   net.Conn
+	header SMB1Header
+}
+
+// DialLanman connects to host, negotiates the NT LM 0.12 dialect and
+// connects to IPC$ with an anonymous session or one authenticated by
+// opts.Initiator. SMB1 signing is not implemented, so authenticated
+// sessions fail when the server requires signing.
+func DialLanman(host string, opts LanmanOptions) (s *LanmanSession, err error) {
+	conn, _, err := dialProbe(host, &opts.ProbeOptions)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+	anonymous := opts.Initiator == nil || opts.Initiator.IsNullSession()
+
+	req, err := (&Session{}).NewSMB1NegotiateReq()
+	if err != nil {
+		return
+	}
+	s = &LanmanSession{conn: conn, header: req.Header}
+	s.header.Flags2 = smb1CheckFlags2
+	if !anonymous {
+		s.header.Flags2 |= smb1FlagsExtendedSecurity
+	}
+	var dialect bytes.Buffer
+	dialect.WriteByte(0x2)
+	dialect.WriteString("NT LM 0.12\x00")
+	packet, err := smb1Exchange(conn, s.header, nil, dialect.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer encoder.PutBuffer(packet)
+	var negRes SMB1NegotiateRes
+	if err = negRes.UnmarshalBinary(packet, nil); err != nil {
+		return nil, err
+	}
+	if err = smb1Status(packet, "Negotiate"); err != nil {
+		return nil, err
+	}
+	if negRes.DialectIndex != 0 {
+		return nil, fmt.Errorf("The server does not support the NT LM 0.12 dialect of SMB1")
+	}
+
+	if anonymous {
+		err = smb1AnonymousSessionSetup(conn, &s.header, negRes.SessionKey)
+	} else {
+		err = s.sessionSetup(&negRes, opts.Initiator)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = smb1TreeConnect(conn, &s.header, host, "IPC$"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// sessionSetup authenticates with SMB_COM_SESSION_SETUP_ANDX requests with
+// extended security and sets the UID of the header
+func (s *LanmanSession) sessionSetup(negRes *SMB1NegotiateRes, initiator gss.Mechanism) error {
+	if negRes.Capabilities&smb1CapExtendedSecurity == 0 {
+		return fmt.Errorf("The server does not support extended security, only anonymous SMB1 sessions are supported")
+	}
+	client, err := spnego.NewClient([]gss.Mechanism{initiator})
+	if err != nil {
+		return err
+	}
+	token, err := client.InitSecContext(nil)
+	if err != nil {
+		return err
+	}
+	s.header.Command = SMB1CommandSessionSetupAndX
+	for {
+		var words, data bytes.Buffer
+		words.Write([]byte{0xff, 0, 0, 0})                      // No AndX command
+		binary.Write(&words, binary.LittleEndian, uint16(4356)) // MaxBufferSize
+		binary.Write(&words, binary.LittleEndian, uint16(10))   // MaxMpxCount
+		binary.Write(&words, binary.LittleEndian, uint16(0))    // VcNumber
+		binary.Write(&words, binary.LittleEndian, negRes.SessionKey)
+		binary.Write(&words, binary.LittleEndian, uint16(len(token))) // SecurityBlobLength
+		binary.Write(&words, binary.LittleEndian, uint32(0))          // Reserved
+		binary.Write(&words, binary.LittleEndian, uint32(0x80000040)) // CAP_EXTENDED_SECURITY and CAP_NT_STATUS
+		data.Write(token)
+		data.WriteString("go-smb\x00go-smb\x00") // Native OS and LAN manager
+		res, err := smb1Exchange(s.conn, s.header, words.Bytes(), data.Bytes())
+		if err != nil {
+			return err
+		}
+		status := binary.LittleEndian.Uint32(res[5:9])
+		if status != StatusMoreProcessingRequired {
+			if err = smb1Status(res, "Session setup"); err != nil {
+				encoder.PutBuffer(res)
+				return err
+			}
+		}
+		s.header.UID = binary.LittleEndian.Uint16(res[28:30])
+		// MS-CIFS 2.2.4.53.2 Action, SecurityBlobLength and the blob
+		if res[32] < 4 || len(res) < 35+2*int(res[32]) {
+			encoder.PutBuffer(res)
+			return fmt.Errorf("Invalid SMB1 session setup response")
+		}
+		action := binary.LittleEndian.Uint16(res[37:39])
+		blob := res[35+2*int(res[32]):]
+		if n := int(binary.LittleEndian.Uint16(res[39:41])); n <= len(blob) {
+			blob = blob[:n]
+		}
+		if status == StatusOk {
+			encoder.PutBuffer(res)
+			// A guest session (Action bit 0) is not signed
+			if action&1 == 0 && negRes.SecurityMode&smb1SecuritySignaturesRequired != 0 {
+				return fmt.Errorf("The server requires signing, which is not implemented for SMB1")
+			}
+			return nil
+		}
+		token, err = client.InitSecContext(bytes.Clone(blob))
+		encoder.PutBuffer(res)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Transact sends a SMB_COM_TRANSACTION on \PIPE\LANMAN and returns the
+// parameters and data of the response, reassembled when the server splits
+// it over several messages
+func (s *LanmanSession) Transact(params, data []byte, maxParams, maxData uint16) (resParams, resData []byte, err error) {
+	name := LanmanPipe + "\x00"
+	// The bytes follow the header, 14 parameter words and the ByteCount
+	bytesOffset := 32 + 1 + 28 + 2
+	paramOffset := bytesOffset + len(name)
+	paramOffset += (4 - paramOffset%4) % 4
+	dataOffset := paramOffset + len(params)
+	dataOffset += (4 - dataOffset%4) % 4
+
+	var words, bytesBuf bytes.Buffer
+	binary.Write(&words, binary.LittleEndian, uint16(len(params))) // TotalParameterCount
+	binary.Write(&words, binary.LittleEndian, uint16(len(data)))   // TotalDataCount
+	binary.Write(&words, binary.LittleEndian, maxParams)
+	binary.Write(&words, binary.LittleEndian, maxData)
+	words.Write([]byte{0, 0})                            // MaxSetupCount and Reserved1
+	binary.Write(&words, binary.LittleEndian, uint16(0)) // Flags
+	binary.Write(&words, binary.LittleEndian, uint32(0)) // Timeout
+	binary.Write(&words, binary.LittleEndian, uint16(0)) // Reserved2
+	binary.Write(&words, binary.LittleEndian, uint16(len(params)))
+	binary.Write(&words, binary.LittleEndian, uint16(paramOffset))
+	binary.Write(&words, binary.LittleEndian, uint16(len(data)))
+	binary.Write(&words, binary.LittleEndian, uint16(dataOffset))
+	words.Write([]byte{0, 0}) // SetupCount and Reserved3
+	bytesBuf.WriteString(name)
+	bytesBuf.Write(make([]byte, paramOffset-bytesOffset-bytesBuf.Len()))
+	bytesBuf.Write(params)
+	bytesBuf.Write(make([]byte, dataOffset-bytesOffset-bytesBuf.Len()))
+	bytesBuf.Write(data)
+	s.header.Command = SMB1CommandTransaction
+	res, err := smb1Exchange(s.conn, s.header, words.Bytes(), bytesBuf.Bytes())
+	for err == nil {
+		var done bool
+		done, err = addTransactionRes(res, &resParams, &resData)
+		encoder.PutBuffer(res)
+		if done || err != nil {
+			break
+		}
+		if res, err = readPacket(s.conn); err == nil && (len(res) < 35 || res[4] != SMB1CommandTransaction) {
+			err = fmt.Errorf("Invalid SMB1 response to command 0x%x", SMB1CommandTransaction)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return
+}
+
+// addTransactionRes copies the parameters and data of a SMB_COM_TRANSACTION
+// response at their displacement and reports whether all were received
+func addTransactionRes(res []byte, params, data *[]byte) (done bool, err error) {
+	if err = smb1Status(res, "Transaction"); err != nil {
+		return
+	}
+	// MS-CIFS 2.2.4.33.2 SMB_COM_TRANSACTION Response
+	if res[32] < 10 || len(res) < 33+20 {
+		return false, fmt.Errorf("Invalid SMB1 transaction response")
+	}
+	le := binary.LittleEndian
+	w := res[33:]
+	totalParams, totalData := int(le.Uint16(w)), int(le.Uint16(w[2:]))
+	paramCount, paramOffset, paramDisp := int(le.Uint16(w[6:])), int(le.Uint16(w[8:])), int(le.Uint16(w[10:]))
+	dataCount, dataOffset, dataDisp := int(le.Uint16(w[12:])), int(le.Uint16(w[14:])), int(le.Uint16(w[16:]))
+	if paramOffset+paramCount > len(res) || dataOffset+dataCount > len(res) ||
+		paramDisp+paramCount > totalParams || dataDisp+dataCount > totalData {
+		return false, fmt.Errorf("SMB1 transaction response exceeds the message")
+	}
+	if *params == nil {
+		*params = make([]byte, 0, totalParams)
+		*data = make([]byte, 0, totalData)
+	}
+	*params = (*params)[:max(len(*params), paramDisp+paramCount)]
+	copy((*params)[paramDisp:], res[paramOffset:paramOffset+paramCount])
+	*data = (*data)[:max(len(*data), dataDisp+dataCount)]
+	copy((*data)[dataDisp:], res[dataOffset:dataOffset+dataCount])
+	return len(*params) == totalParams && len(*data) == totalData, nil
+}
+
+// Close ends the session by closing the connection
+func (s *LanmanSession) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,94 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// transactionTestResponse builds a SMB_COM_TRANSACTION response holding
+// part of the parameters and data at the given displacements
+func transactionTestResponse(params, data []byte, totalParams, totalData, paramDisp, dataDisp int) []byte {
+	res := smb1TestResponse(SMB1CommandTransaction, StatusOk, 10)
+	res = res[:len(res)-2]
+	paramOffset := len(res) + 2
+	w := res[33:]
+	binary.LittleEndian.PutUint16(w, uint16(totalParams))
+	binary.LittleEndian.PutUint16(w[2:], uint16(totalData))
+	binary.LittleEndian.PutUint16(w[6:], uint16(len(params)))
+	binary.LittleEndian.PutUint16(w[8:], uint16(paramOffset))
+	binary.LittleEndian.PutUint16(w[10:], uint16(paramDisp))
+	binary.LittleEndian.PutUint16(w[12:], uint16(len(data)))
+	binary.LittleEndian.PutUint16(w[14:], uint16(paramOffset+len(params)))
+	binary.LittleEndian.PutUint16(w[16:], uint16(dataDisp))
+	res = binary.LittleEndian.AppendUint16(res, uint16(len(params)+len(data)))
+	res = append(res, params...)
+	return append(res, data...)
+}
+
+func TestLanmanSession(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	fail := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		write := func(res []byte) {
+			conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(res))), res...))
+		}
+		for _, command := range []byte{SMB1CommandNegotiate, SMB1CommandSessionSetupAndX, SMB1CommandTreeConnectAndX, SMB1CommandTransaction} {
+			req, err := readTestFrame(conn)
+			if err != nil || len(req) < 35 || req[4] != command {
+				fail <- "unexpected request"
+				return
+			}
+			switch command {
+			case SMB1CommandNegotiate:
+				write(smb1TestResponse(command, StatusOk, 17))
+			case SMB1CommandTransaction:
+				if binary.LittleEndian.Uint16(req[24:26]) != 7 || binary.LittleEndian.Uint16(req[28:30]) != 9 {
+					fail <- "TID or UID not set"
+					return
+				}
+				// The parameters follow the name of the pipe
+				offset := int(binary.LittleEndian.Uint16(req[33+20:]))
+				if !bytes.Contains(req, []byte(LanmanPipe+"\x00")) || string(req[offset:offset+2]) != "\x00\x00" {
+					fail <- "invalid transaction"
+					return
+				}
+				// The response is split over two messages
+				write(transactionTestResponse([]byte{1, 2}, []byte("abc"), 4, 6, 0, 0))
+				write(transactionTestResponse([]byte{3, 4}, []byte("def"), 4, 6, 2, 3))
+			default:
+				write(smb1TestResponse(command, StatusOk, 3))
+			}
+		}
+		fail <- ""
+	}()
+
+	opts := LanmanOptions{ProbeOptions: ProbeOptions{Port: l.Addr().(*net.TCPAddr).Port, Timeout: 5 * time.Second}}
+	s, err := DialLanman("127.0.0.1", opts)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer s.Close()
+	params, data, err := s.Transact([]byte{0, 0, 'W', 0}, nil, 8, 0xffff)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if msg := <-fail; msg != "" {
+		t.Fatal(msg)
+	}
+	if !bytes.Equal(params, []byte{1, 2, 3, 4}) || string(data) != "abcdef" {
+		t.Fatalf("Fail: %v %q", params, data)
+	}
+}
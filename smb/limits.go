@@ -0,0 +1,67 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Limits on the memory allocated while decoding responses, such that a
+// hostile or buggy server cannot make the client allocate excessive amounts
+// of memory. They apply to all connections and are meant to be adjusted
+// before connecting.
+var (
+	// MaxSecurityBlobSize limits the security buffer of NEGOTIATE and
+	// SESSION_SETUP responses
+	MaxSecurityBlobSize = 65535
+	// MaxDirectoryListingSize limits the total size of the QUERY_DIRECTORY
+	// output buffers received while listing a single directory
+	MaxDirectoryListingSize = 64 * 1024 * 1024
+)
+
+// checkSecurityBlob returns an error if the security buffer of a NEGOTIATE
+// or SESSION_SETUP response exceeds MaxSecurityBlobSize. It is called before
+// the response is decoded.
+func checkSecurityBlob(buf []byte) error {
+	var pos int
+	if len(buf) < 64 {
+		return fmt.Errorf("Response is too short")
+	}
+	switch binary.LittleEndian.Uint16(buf[12:14]) {
+	case CommandNegotiate:
+		pos = 64 + 58
+	case CommandSessionSetup:
+		pos = 64 + 6
+	default:
+		return nil
+	}
+	if len(buf) < pos+2 {
+		// Left to the decoder to reject
+		return nil
+	}
+	if size := int(binary.LittleEndian.Uint16(buf[pos:])); size > MaxSecurityBlobSize {
+		return fmt.Errorf("Security buffer of %d bytes exceeds the limit of %d bytes", size, MaxSecurityBlobSize)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package smb
+
+import (
+	"testing"
+
+	"github.com/ericblavier/go-smb/gss"
+	"github.com/ericblavier/go-smb/smb/encoder"
+	"github.com/jfjallid/gofork/encoding/asn1"
+)
+
+func TestCheckSecurityBlob(t *testing.T) {
+	header := newHeader()
+	header.Command = CommandSessionSetup
+	ssBuf, err := encoder.Marshal(&SessionSetupRes{Header: header, StructureSize: 9, SecurityBlob: make([]byte, 1000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	negRes := NewNegotiateRes()
+	negRes.Header.Command = CommandNegotiate
+	negRes.SecurityBlob = &gss.NegTokenInit{
+		OID:  gss.SpnegoOid,
+		Data: gss.NegTokenInitData{MechTypes: []asn1.ObjectIdentifier{gss.NtLmSSPMechTypeOid}},
+	}
+	negBuf, err := encoder.Marshal(&negRes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(size int) { MaxSecurityBlobSize = size }(MaxSecurityBlobSize)
+	for _, buf := range [][]byte{ssBuf, negBuf} {
+		MaxSecurityBlobSize = 65535
+		if err = checkSecurityBlob(buf); err != nil {
+			t.Fatal(err)
+		}
+		MaxSecurityBlobSize = 10
+		if err = checkSecurityBlob(buf); err == nil {
+			t.Fatal("Fail")
+		}
+	}
+	if err = checkSecurityBlob(ssBuf[:10]); err == nil {
+		t.Fatal("Fail")
+	}
+}
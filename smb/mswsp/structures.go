@@ -0,0 +1,512 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mswsp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// MS-WSP Section 2.2.4 Message types
+const (
+	CPMConnect        uint32 = 0xc8
+	CPMDisconnect     uint32 = 0xc9
+	CPMCreateQuery    uint32 = 0xca
+	CPMFreeCursor     uint32 = 0xcb
+	CPMGetRows        uint32 = 0xcc
+	CPMSetBindings    uint32 = 0xd0
+	CPMGetQueryStatus uint32 = 0xd7
+	CPMFetchValue     uint32 = 0xe4
+)
+
+// Size of the message header
+const headerSize = 16
+
+// Value XORed into the checksum of a message
+const checksumMagic uint32 = 0x59533959
+
+// Client version of a 32-bit client of Windows 7 or later. 64-bit clients set
+// 0x00010000 and receive 64-bit offsets in rows.
+const ClientVersion uint32 = 0x00000109
+
+// Status of CPMGetRowsOut when the last rows were returned
+const DbSEndOfRowset uint32 = 0x00040ec6
+
+// Property sets of CPMConnectIn
+const (
+	DbPropSetFsCiFrmwrkExt   = "A9BD1526-6A80-11D0-8C9D-0020AF1D740E"
+	DbPropSetCiFrmwrkCoreExt = "AFAFACA5-B5D1-11D0-8C62-00C04FC2DB8D"
+	DbPropSetMsIdxsRowsetExt = "AA6EE6B0-E828-11D0-B23E-00AA0047FC01"
+	DbPropSetQueryExt        = "A7AC77ED-F8D7-11CE-A798-0020F8008025"
+)
+
+// Properties of DBPROPSET_FSCIFRMWRK_EXT
+const (
+	DbPropCiCatalogName   uint32 = 0x02
+	DbPropCiIncludeScopes uint32 = 0x03
+	DbPropCiScopeFlags    uint32 = 0x04
+	DbPropCiQueryType     uint32 = 0x07
+)
+
+// Properties of DBPROPSET_CIFRMWRKCORE_EXT
+const DbPropMachine uint32 = 0x02
+
+// Catalog of the Windows Search service
+const SystemIndex = "Windows\\SYSTEMINDEX"
+
+// Scope flags
+const (
+	QueryShallow uint32 = 0x00
+	QueryDeep    uint32 = 0x01
+)
+
+// MS-WSP Section 2.2.1.2 CFullPropSpec ulKind
+const (
+	PrSpecLpwstr uint32 = 0
+	PrSpecPropId uint32 = 1
+)
+
+// MS-WSP Section 2.2.1.17 CRestriction ulType
+const (
+	RTAnd         uint32 = 0x01
+	RTOr          uint32 = 0x02
+	RTNot         uint32 = 0x03
+	RTContent     uint32 = 0x04
+	RTProperty    uint32 = 0x05
+	RTNatLanguage uint32 = 0x08
+)
+
+// MS-WSP Section 2.2.1.3 CContentRestriction _ulGenerateMethod
+const (
+	GenerateMethodExact   uint32 = 0
+	GenerateMethodPrefix  uint32 = 1
+	GenerateMethodInflect uint32 = 2
+)
+
+// MS-WSP Section 2.2.1.5 CPropertyRestriction _relop
+const (
+	PRLT      uint32 = 0x00
+	PRLE      uint32 = 0x01
+	PRGT      uint32 = 0x02
+	PRGE      uint32 = 0x03
+	PREQ      uint32 = 0x04
+	PRNE      uint32 = 0x05
+	PRRE      uint32 = 0x06
+	PRAllBits uint32 = 0x07
+	PRSomeBit uint32 = 0x08
+)
+
+// MS-WSP Section 2.2.1.43 CRowsetProperties _uBooleanOptions
+const (
+	ESequential uint32 = 0x00000001
+	ELocatable  uint32 = 0x00000003
+	EScrollable uint32 = 0x00000007
+)
+
+// MS-WSP Section 2.2.1.1.1 Variant types
+const (
+	VtEmpty    uint16 = 0x0000
+	VtNull     uint16 = 0x0001
+	VtI2       uint16 = 0x0002
+	VtI4       uint16 = 0x0003
+	VtBstr     uint16 = 0x0008
+	VtBool     uint16 = 0x000b
+	VtVariant  uint16 = 0x000c
+	VtUI2      uint16 = 0x0012
+	VtUI4      uint16 = 0x0013
+	VtI8       uint16 = 0x0014
+	VtUI8      uint16 = 0x0015
+	VtLpwstr   uint16 = 0x001f
+	VtFiletime uint16 = 0x0040
+	VtVector   uint16 = 0x1000
+)
+
+// Row status of a column value
+const (
+	StoreStatusOk       byte = 0
+	StoreStatusDeferred byte = 1
+	StoreStatusNull     byte = 2
+)
+
+// Property identifies a property of the index by its property set and id
+type Property struct {
+	Name   string // Canonical name, informational only
+	Guid   string
+	PropId uint32
+}
+
+// Common properties of indexed files
+var (
+	PropItemUrl         = Property{"System.ItemUrl", "49691C90-7E17-101A-A91C-08002B2ECDA9", 9}
+	PropItemPathDisplay = Property{"System.ItemPathDisplay", "E3E0584C-B788-4A5A-BB20-7F5A44C9ACDD", 7}
+	PropFileName        = Property{"System.FileName", "41CF5AE0-F75A-4806-BD87-59C7D9248EB9", 100}
+	PropSize            = Property{"System.Size", "B725F130-47EF-101A-A5F1-02608C9EEBAC", 12}
+	PropDateModified    = Property{"System.DateModified", "B725F130-47EF-101A-A5F1-02608C9EEBAC", 14}
+	PropContents        = Property{"System.Search.Contents", "B725F130-47EF-101A-A5F1-02608C9EEBAC", 19}
+)
+
+// writer builds a message. Alignment is relative to the start of the
+// message including its header.
+type writer struct {
+	buf []byte
+}
+
+func (w *writer) align(n int) {
+	w.buf = append(w.buf, make([]byte, (n-len(w.buf)%n)%n)...)
+}
+
+func (w *writer) u8(v byte) {
+	w.buf = append(w.buf, v)
+}
+
+func (w *writer) u16(v uint16) {
+	w.buf = binary.LittleEndian.AppendUint16(w.buf, v)
+}
+
+func (w *writer) u32(v uint32) {
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, v)
+}
+
+func (w *writer) u64(v uint64) {
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, v)
+}
+
+func (w *writer) guid(s string) {
+	w.buf = append(w.buf, msdtyp.MustGuidFromString(s)...)
+}
+
+// str writes s as UTF-16 with a null terminator
+func (w *writer) str(s string) {
+	w.buf = append(w.buf, encoder.ToUnicode(s+"\x00")...)
+}
+
+// MS-WSP Section 2.2.1.2 CFullPropSpec
+func (w *writer) propSpec(p Property) {
+	w.align(8)
+	w.guid(p.Guid)
+	w.u32(PrSpecPropId)
+	w.u32(p.PropId)
+}
+
+// variant writes v as a CBaseStorageVariant
+func (w *writer) variant(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		w.u16(VtEmpty)
+		w.u16(0)
+	case string:
+		w.u16(VtLpwstr)
+		w.u16(0)
+		w.lpwstr(v)
+	case bstr:
+		w.u16(VtBstr)
+		w.u16(0)
+		w.bstr(string(v))
+	case []string:
+		w.u16(VtVector | VtLpwstr)
+		w.u16(0)
+		w.u32(uint32(len(v)))
+		for _, s := range v {
+			w.align(4)
+			w.lpwstr(s)
+		}
+	case bool:
+		w.u16(VtBool)
+		w.u16(0)
+		if v {
+			w.u16(0xffff)
+		} else {
+			w.u16(0)
+		}
+	case int32:
+		w.u16(VtI4)
+		w.u16(0)
+		w.u32(uint32(v))
+	case uint32:
+		w.u16(VtUI4)
+		w.u16(0)
+		w.u32(v)
+	case []uint32:
+		w.u16(VtVector | VtI4)
+		w.u16(0)
+		w.u32(uint32(len(v)))
+		for _, i := range v {
+			w.u32(i)
+		}
+	case int64:
+		w.u16(VtI8)
+		w.u16(0)
+		w.u64(uint64(v))
+	case uint64:
+		w.u16(VtUI8)
+		w.u16(0)
+		w.u64(v)
+	case time.Time:
+		w.u16(VtFiletime)
+		w.u16(0)
+		w.u64(msdtyp.TimeToFiletime(v))
+	default:
+		return fmt.Errorf("Unsupported variant type %T", v)
+	}
+	return nil
+}
+
+// lpwstr writes the count of characters including the null terminator
+// followed by the string
+func (w *writer) lpwstr(s string) {
+	w.u32(uint32(len(encoder.ToUnicode(s))/2 + 1))
+	w.str(s)
+}
+
+// bstr writes the size in bytes followed by the string
+func (w *writer) bstr(s string) {
+	u := encoder.ToUnicode(s + "\x00")
+	w.u32(uint32(len(u)))
+	w.buf = append(w.buf, u...)
+}
+
+// DbProp is a property of a CDbPropSet
+type DbProp struct {
+	Id    uint32
+	Value interface{}
+}
+
+// DbPropSet is a CDbPropSet
+type DbPropSet struct {
+	Guid  string
+	Props []DbProp
+}
+
+// MS-WSP Section 2.2.1.12 CDbPropSet
+func (w *writer) propSet(set DbPropSet) error {
+	w.guid(set.Guid)
+	w.u32(uint32(len(set.Props)))
+	for _, prop := range set.Props {
+		w.align(4)
+		w.u32(prop.Id)
+		w.u32(0) // DBPROPOPTIONS_REQUIRED
+		w.u32(0) // DBPROPSTATUS_OK
+		// CDbColId of kind DBKIND_GUID_PROPID with a nil GUID
+		w.u32(1)
+		w.align(8)
+		w.buf = append(w.buf, make([]byte, 16)...)
+		w.u32(0)
+		if err := w.variant(prop.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bstr is a string encoded as VT_BSTR rather than VT_LPWSTR
+type bstr string
+
+// Restriction is a node of the restriction tree of a query
+type Restriction interface {
+	marshal(w *writer) error
+}
+
+// MS-WSP Section 2.2.1.3 CContentRestriction
+type ContentRestriction struct {
+	Property Property
+	Phrase   string
+	Lcid     uint32
+	Method   uint32 // One of GenerateMethod*
+}
+
+// MS-WSP Section 2.2.1.4 CNatLanguageRestriction
+type NatLanguageRestriction struct {
+	Property Property
+	Phrase   string
+	Lcid     uint32
+}
+
+// MS-WSP Section 2.2.1.5 CPropertyRestriction
+type PropertyRestriction struct {
+	Relop    uint32
+	Property Property
+	Value    interface{}
+	Lcid     uint32
+}
+
+// MS-WSP Section 2.2.1.6 CNodeRestriction of type RTAnd or RTOr
+type NodeRestriction struct {
+	Type  uint32
+	Nodes []Restriction
+}
+
+// MS-WSP Section 2.2.1.17 RTNot
+type NotRestriction struct {
+	Node Restriction
+}
+
+// restrictionHeader starts a CRestriction with the default weight
+func (w *writer) restrictionHeader(ulType uint32) {
+	w.align(4)
+	w.u32(ulType)
+	w.u32(1000) // Weight
+}
+
+// phrase writes the character count and the phrase without terminator
+func (w *writer) phrase(s string) {
+	u := encoder.ToUnicode(s)
+	w.align(4)
+	w.u32(uint32(len(u) / 2))
+	w.buf = append(w.buf, u...)
+	w.align(4)
+}
+
+func (self *ContentRestriction) marshal(w *writer) error {
+	w.restrictionHeader(RTContent)
+	w.propSpec(self.Property)
+	w.phrase(self.Phrase)
+	w.u32(self.Lcid)
+	w.u32(self.Method)
+	return nil
+}
+
+func (self *NatLanguageRestriction) marshal(w *writer) error {
+	w.restrictionHeader(RTNatLanguage)
+	w.propSpec(self.Property)
+	w.phrase(self.Phrase)
+	w.u32(self.Lcid)
+	return nil
+}
+
+func (self *PropertyRestriction) marshal(w *writer) error {
+	w.restrictionHeader(RTProperty)
+	w.u32(self.Relop)
+	w.propSpec(self.Property)
+	if err := w.variant(self.Value); err != nil {
+		return err
+	}
+	w.align(4)
+	w.u32(self.Lcid)
+	return nil
+}
+
+func (self *NodeRestriction) marshal(w *writer) error {
+	if self.Type != RTAnd && self.Type != RTOr {
+		return fmt.Errorf("Invalid node restriction type %d", self.Type)
+	}
+	w.restrictionHeader(self.Type)
+	w.u32(uint32(len(self.Nodes)))
+	for _, node := range self.Nodes {
+		if err := node.marshal(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *NotRestriction) marshal(w *writer) error {
+	w.restrictionHeader(RTNot)
+	return self.Node.marshal(w)
+}
+
+// FullText returns a restriction matching documents containing all the
+// words of text. Words ending with * match as prefixes.
+func FullText(text string, lcid uint32) Restriction {
+	var nodes []Restriction
+	for _, word := range splitWords(text) {
+		method := GenerateMethodExact
+		if len(word) > 1 && word[len(word)-1] == '*' {
+			word = word[:len(word)-1]
+			method = GenerateMethodPrefix
+		}
+		nodes = append(nodes, &ContentRestriction{Property: PropContents, Phrase: word, Lcid: lcid, Method: method})
+	}
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	return &NodeRestriction{Type: RTAnd, Nodes: nodes}
+}
+
+// splitWords splits text on white space keeping double quoted phrases
+// together
+func splitWords(text string) (words []string) {
+	var word []rune
+	quoted := false
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case (r == ' ' || r == '\t' || r == '\n') && !quoted:
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = word[:0]
+			}
+		default:
+			word = append(word, r)
+		}
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return
+}
+
+// checksum computes the _ulChecksum of a message. The body is summed as
+// 32-bit integers, XORed with a magic value and the message type is
+// subtracted.
+func checksum(msg uint32, body []byte) uint32 {
+	var sum uint32
+	for i := 0; i+4 <= len(body); i += 4 {
+		sum += binary.LittleEndian.Uint32(body[i:])
+	}
+	return (sum ^ checksumMagic) - msg
+}
+
+// needsChecksum reports whether messages of the type carry a checksum
+func needsChecksum(msg uint32) bool {
+	switch msg {
+	case CPMConnect, CPMCreateQuery, CPMSetBindings, CPMGetRows, CPMFetchValue:
+		return true
+	}
+	return false
+}
+
+// newMessage returns a writer holding the header of a message to be
+// completed by finishMessage
+func newMessage(msg uint32) *writer {
+	w := &writer{}
+	w.u32(msg)
+	w.u32(0) // _status
+	w.u32(0) // _ulChecksum
+	w.u32(0) // _ulReserved2
+	return w
+}
+
+// finishMessage pads the message to 4 bytes and sets its checksum
+func (w *writer) finishMessage() []byte {
+	w.align(4)
+	msg := binary.LittleEndian.Uint32(w.buf)
+	if needsChecksum(msg) {
+		binary.LittleEndian.PutUint32(w.buf[8:], checksum(msg, w.buf[headerSize:]))
+	}
+	return w.buf
+}
@@ -0,0 +1,465 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package mswsp implements a client of the Windows Search Protocol (MS-WSP)
+// to run full-text queries against the index of the Windows Search service
+// over the MsFteWds named pipe.
+package mswsp
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/encoder"
+	"github.com/jfjallid/golog"
+)
+
+var log = golog.Get("github.com/ericblavier/go-smb/smb/mswsp")
+
+// Named pipe of the Windows Search service on IPC$
+const MsFteWdsPipe = "MsFteWds"
+
+// Largest response accepted to a message
+const maxResponseSize = 0x10000
+
+// _cbReadBuffer of CPMGetRowsIn, the largest size allowed by MS-WSP
+const readBufferSize = 0x4000
+
+// Offset of the rows in CPMGetRowsOut, leaving room for any seek description
+const rowsOffset = 0x40
+
+// Size of a column in a row: a 16 byte VT_VARIANT, a 4 byte length and a
+// status byte, aligned to 8 bytes
+const columnSize = 24
+
+type transport interface {
+	// Transceive sends a message and returns the response
+	Transceive(msg []byte) ([]byte, error)
+	// Write sends a message that the server does not respond to
+	Write(msg []byte) error
+}
+
+type pipeTransport struct {
+	f *smb.File
+}
+
+func (self *pipeTransport) Transceive(msg []byte) ([]byte, error) {
+	req, err := self.f.NewIoCTLReq(smb.FsctlPipeTransceive, msg)
+	if err != nil {
+		return nil, err
+	}
+	req.MaxOutputResponse = maxResponseSize
+	res, err := self.f.WriteIoCtlReq(req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Buffer, nil
+}
+
+func (self *pipeTransport) Write(msg []byte) error {
+	_, err := self.f.WriteFile(msg, 0)
+	return err
+}
+
+// Client issues queries to the Windows Search service
+type Client struct {
+	t             transport
+	ServerVersion uint32 // Set by Connect
+}
+
+// ConnectOptions are the parameters of CPMConnectIn
+type ConnectOptions struct {
+	Catalog string   // Defaults to SystemIndex
+	Scopes  []string // Paths searched recursively, e.g., C:\Users. The whole catalog if empty.
+	Machine string   // Name of the client machine
+	User    string   // Name of the client user
+}
+
+// Query is a query of the index
+type Query struct {
+	Restriction Restriction
+	Columns     []Property // Defaults to DefaultColumns
+	MaxResults  uint32     // No limit if zero
+	Lcid        uint32     // Defaults to DefaultLcid
+}
+
+// Row holds the values of the columns of a query result in the order of
+// the columns. Values are nil, string, []string, bool, integers, time.Time or
+// the raw bytes of unsupported types.
+type Row []interface{}
+
+// Columns returned by a Query without Columns
+var DefaultColumns = []Property{PropItemUrl, PropSize, PropDateModified}
+
+// Locale of queries without Lcid, en-US
+const DefaultLcid uint32 = 0x0409
+
+// NewClient returns a client sending messages over the MsFteWds pipe opened
+// as f
+func NewClient(f *smb.File) *Client {
+	return &Client{t: &pipeTransport{f: f}}
+}
+
+// call sends the message and returns the whole response after checking its
+// type and status
+func (self *Client) call(w *writer) (res []byte, status uint32, err error) {
+	req := w.finishMessage()
+	msg := binary.LittleEndian.Uint32(req)
+	res, err = self.t.Transceive(req)
+	if err != nil {
+		log.Debugln(err)
+		return nil, 0, err
+	}
+	if len(res) < headerSize {
+		return nil, 0, fmt.Errorf("WSP response too small for message header")
+	}
+	if resMsg := binary.LittleEndian.Uint32(res); resMsg != msg {
+		return nil, 0, fmt.Errorf("Received WSP response of type 0x%x to message 0x%x", resMsg, msg)
+	}
+	status = binary.LittleEndian.Uint32(res[4:])
+	if status&0x80000000 != 0 {
+		return nil, status, fmt.Errorf("WSP message 0x%x failed with status 0x%08x", msg, status)
+	}
+	return res, status, nil
+}
+
+// Connect sends CPMConnectIn to open the catalog. Queries are limited to the
+// scopes of the options.
+func (self *Client) Connect(opts *ConnectOptions) (err error) {
+	log.Debugln("In Connect")
+	if opts == nil {
+		opts = &ConnectOptions{}
+	}
+	catalog := opts.Catalog
+	if catalog == "" {
+		catalog = SystemIndex
+	}
+	fsProps := DbPropSet{Guid: DbPropSetFsCiFrmwrkExt}
+	if len(opts.Scopes) > 0 {
+		flags := make([]uint32, len(opts.Scopes))
+		for i := range flags {
+			flags[i] = QueryDeep
+		}
+		fsProps.Props = append(fsProps.Props,
+			DbProp{DbPropCiIncludeScopes, opts.Scopes},
+			DbProp{DbPropCiScopeFlags, flags},
+		)
+	}
+	fsProps.Props = append(fsProps.Props,
+		DbProp{DbPropCiCatalogName, catalog},
+		DbProp{DbPropCiQueryType, int32(0)}, // CiNormal
+	)
+	coreProps := DbPropSet{Guid: DbPropSetCiFrmwrkCoreExt, Props: []DbProp{{DbPropMachine, bstr(".")}}}
+
+	w := newMessage(CPMConnect)
+	w.u32(ClientVersion)
+	w.u32(1) // _fClientIsRemote
+	blobs := len(w.buf)
+	w.buf = append(w.buf, make([]byte, 24)...) // _cbBlob1, padding, _cbBlob2 and 12 bytes of padding
+	w.str(opts.Machine)
+	w.str(opts.User)
+	w.align(8)
+	start := len(w.buf)
+	w.u32(2) // cPropSets
+	for _, set := range []DbPropSet{fsProps, coreProps} {
+		if err = w.propSet(set); err != nil {
+			return
+		}
+	}
+	binary.LittleEndian.PutUint32(w.buf[blobs:], uint32(len(w.buf)-start))
+	w.align(8)
+	start = len(w.buf)
+	w.u32(2) // cExtPropSet
+	for _, set := range []DbPropSet{fsProps, coreProps} {
+		w.align(4)
+		if err = w.propSet(set); err != nil {
+			return
+		}
+	}
+	binary.LittleEndian.PutUint32(w.buf[blobs+8:], uint32(len(w.buf)-start))
+
+	res, _, err := self.call(w)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if len(res) < headerSize+4 {
+		return fmt.Errorf("WSP response too small for CPMConnectOut")
+	}
+	self.ServerVersion = binary.LittleEndian.Uint32(res[headerSize:])
+	log.Debugf("Connected to catalog %s of WSP server version 0x%x\n", catalog, self.ServerVersion)
+	return nil
+}
+
+// Disconnect sends CPMDisconnect, which has no response
+func (self *Client) Disconnect() error {
+	return self.t.Write(newMessage(CPMDisconnect).finishMessage())
+}
+
+// createQuery sends CPMCreateQueryIn and returns the cursor of the results
+func (self *Client) createQuery(q *Query, columns []Property, lcid uint32) (cursor uint32, err error) {
+	w := newMessage(CPMCreateQuery)
+	size := len(w.buf)
+	w.u32(0) // Size
+	w.u8(1)  // CColumnSetPresent
+	w.align(4)
+	w.u32(uint32(len(columns)))
+	for i := range columns {
+		w.u32(uint32(i)) // Index in the PidMapper
+	}
+	if q.Restriction == nil {
+		w.u8(0) // CRestrictionPresent
+	} else {
+		w.u8(1)
+		w.u8(1) // count
+		w.u8(1) // isPresent
+		if err = q.Restriction.marshal(w); err != nil {
+			return
+		}
+	}
+	w.u8(0) // CSortSetPresent
+	w.u8(0) // CCategorizationSetPresent
+	w.align(4)
+	// CRowsetProperties
+	w.u32(ESequential)
+	w.u32(0) // _ulMaxOpenRows
+	w.u32(0) // _ulMemoryUsage
+	w.u32(q.MaxResults)
+	w.u32(0) // _cCmdTimeout
+	// CPidMapper
+	w.u32(uint32(len(columns)))
+	for _, column := range columns {
+		w.propSpec(column)
+	}
+	w.align(4)
+	w.u32(0) // CColumnGroupArray
+	w.u32(lcid)
+	binary.LittleEndian.PutUint32(w.buf[size:], uint32(len(w.buf)-size))
+
+	res, _, err := self.call(w)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if len(res) < headerSize+12 {
+		return 0, fmt.Errorf("WSP response too small for CPMCreateQueryOut")
+	}
+	return binary.LittleEndian.Uint32(res[headerSize+8:]), nil
+}
+
+// setBindings sends CPMSetBindingsIn binding each column as a VT_VARIANT at
+// columnSize bytes intervals
+func (self *Client) setBindings(cursor uint32, columns []Property) (err error) {
+	w := newMessage(CPMSetBindings)
+	w.u32(cursor)
+	w.u32(uint32(len(columns) * columnSize))
+	size := len(w.buf)
+	w.u32(0) // _cbBindingDesc
+	w.u32(0) // _dummy
+	start := len(w.buf)
+	w.u32(uint32(len(columns)))
+	for i, column := range columns {
+		// MS-WSP Section 2.2.1.22 CTableColumn
+		offset := uint16(i * columnSize)
+		w.propSpec(column)
+		w.u32(uint32(VtVariant))
+		w.u8(0) // AggregateUsed
+		w.u8(1) // ValueUsed
+		w.align(2)
+		w.u16(offset)
+		w.u16(16) // ValueSize
+		w.u8(1)   // StatusUsed
+		w.align(2)
+		w.u16(offset + 20)
+		w.u8(1) // LengthUsed
+		w.align(2)
+		w.u16(offset + 16)
+	}
+	binary.LittleEndian.PutUint32(w.buf[size:], uint32(len(w.buf)-start))
+	_, _, err = self.call(w)
+	if err != nil {
+		log.Errorln(err)
+	}
+	return
+}
+
+// getRows sends CPMGetRowsIn for the next rows of the cursor and reports
+// whether the last rows were returned
+func (self *Client) getRows(cursor uint32, count int) (rows []Row, done bool, err error) {
+	rowWidth := uint32(count * columnSize)
+	w := newMessage(CPMGetRows)
+	w.u32(cursor)
+	w.u32(readBufferSize / rowWidth) // _cRowsToTransfer
+	w.u32(rowWidth)
+	w.u32(12) // _cbSeek
+	w.u32(rowsOffset)
+	w.u32(readBufferSize)
+	w.u32(0) // _ulClientBase
+	w.u32(0) // _fBwdFetch
+	w.u32(1) // eType eRowSeekNext
+	w.u32(0) // _chapt
+	w.u32(0) // _cskip
+	res, status, err := self.call(w)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	if len(res) < headerSize+4 {
+		return nil, false, fmt.Errorf("WSP response too small for CPMGetRowsOut")
+	}
+	returned := binary.LittleEndian.Uint32(res[headerSize:])
+	if uint64(rowsOffset)+uint64(returned)*uint64(rowWidth) > uint64(len(res)) {
+		return nil, false, fmt.Errorf("WSP rows exceed the CPMGetRowsOut message")
+	}
+	for i := uint32(0); i < returned; i++ {
+		buf := res[rowsOffset+i*rowWidth:]
+		row := make(Row, count)
+		for j := range row {
+			col := buf[j*columnSize : (j+1)*columnSize]
+			if col[20] != StoreStatusOk {
+				continue
+			}
+			row[j], err = decodeValue(res, binary.LittleEndian.Uint16(col), col[8:16])
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, status == DbSEndOfRowset || returned == 0, nil
+}
+
+// freeCursor sends CPMFreeCursorIn
+func (self *Client) freeCursor(cursor uint32) error {
+	w := newMessage(CPMFreeCursor)
+	w.u32(cursor)
+	_, _, err := self.call(w)
+	return err
+}
+
+// Query runs the query and returns the matching rows
+func (self *Client) Query(q *Query) (rows []Row, err error) {
+	log.Debugln("In Query")
+	columns := q.Columns
+	if len(columns) == 0 {
+		columns = DefaultColumns
+	}
+	if len(columns)*columnSize > readBufferSize {
+		return nil, fmt.Errorf("Too many columns in WSP query")
+	}
+	lcid := q.Lcid
+	if lcid == 0 {
+		lcid = DefaultLcid
+	}
+	cursor, err := self.createQuery(q, columns, lcid)
+	if err != nil {
+		return
+	}
+	defer self.freeCursor(cursor)
+	if err = self.setBindings(cursor, columns); err != nil {
+		return
+	}
+	for {
+		more, done, err := self.getRows(cursor, len(columns))
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, more...)
+		if done || (q.MaxResults > 0 && len(rows) >= int(q.MaxResults)) {
+			break
+		}
+	}
+	if q.MaxResults > 0 && len(rows) > int(q.MaxResults) {
+		rows = rows[:q.MaxResults]
+	}
+	return
+}
+
+// decodeValue decodes a column value of a row. Pointers are offsets from
+// the start of the message as _ulClientBase is zero.
+func decodeValue(msg []byte, vt uint16, val []byte) (interface{}, error) {
+	switch vt {
+	case VtEmpty, VtNull:
+		return nil, nil
+	case VtI2:
+		return int16(binary.LittleEndian.Uint16(val)), nil
+	case VtUI2:
+		return binary.LittleEndian.Uint16(val), nil
+	case VtI4:
+		return int32(binary.LittleEndian.Uint32(val)), nil
+	case VtUI4:
+		return binary.LittleEndian.Uint32(val), nil
+	case VtI8:
+		return int64(binary.LittleEndian.Uint64(val)), nil
+	case VtUI8:
+		return binary.LittleEndian.Uint64(val), nil
+	case VtBool:
+		return binary.LittleEndian.Uint16(val) != 0, nil
+	case VtFiletime:
+		return msdtyp.FiletimeToTime(binary.LittleEndian.Uint64(val)), nil
+	case VtLpwstr:
+		return readString(msg, binary.LittleEndian.Uint32(val))
+	case VtBstr:
+		ptr := binary.LittleEndian.Uint32(val)
+		if ptr < 4 || uint64(ptr) > uint64(len(msg)) {
+			return nil, fmt.Errorf("WSP BSTR pointer outside of the message")
+		}
+		size := binary.LittleEndian.Uint32(msg[ptr-4:])
+		if uint64(ptr)+uint64(size) > uint64(len(msg)) {
+			return nil, fmt.Errorf("WSP BSTR exceeds the message")
+		}
+		return encoder.FromUnicodeString(msg[ptr : ptr+size])
+	case VtVector | VtLpwstr:
+		count := binary.LittleEndian.Uint32(val)
+		ptr := binary.LittleEndian.Uint32(val[4:])
+		if uint64(ptr)+uint64(count)*4 > uint64(len(msg)) {
+			return nil, fmt.Errorf("WSP vector exceeds the message")
+		}
+		res := make([]string, count)
+		for i := range res {
+			s, err := readString(msg, binary.LittleEndian.Uint32(msg[ptr+uint32(i)*4:]))
+			if err != nil {
+				return nil, err
+			}
+			res[i] = s
+		}
+		return res, nil
+	}
+	log.Debugf("Unsupported WSP variant type 0x%x\n", vt)
+	return append([]byte(nil), val...), nil
+}
+
+// readString reads a null terminated UTF-16 string at offset ptr
+func readString(msg []byte, ptr uint32) (string, error) {
+	if uint64(ptr) > uint64(len(msg)) {
+		return "", fmt.Errorf("WSP string pointer outside of the message")
+	}
+	buf := msg[ptr:]
+	for i := 0; i+1 < len(buf); i += 2 {
+		if buf[i] == 0 && buf[i+1] == 0 {
+			return encoder.FromUnicodeString(buf[:i])
+		}
+	}
+	return "", fmt.Errorf("WSP string is not null terminated")
+}
@@ -0,0 +1,197 @@
+package mswsp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// fakeTransport answers messages like the Windows Search service with the
+// rows of a single query
+type fakeTransport struct {
+	urls      []string
+	modified  time.Time
+	cursor    uint32
+	received  []uint32
+	connectIn []byte
+	rowWidth  uint32
+}
+
+func response(msg, status uint32, body []byte) []byte {
+	res := binary.LittleEndian.AppendUint32(nil, msg)
+	res = binary.LittleEndian.AppendUint32(res, status)
+	res = append(res, make([]byte, 8)...)
+	return append(res, body...)
+}
+
+func (self *fakeTransport) Transceive(req []byte) ([]byte, error) {
+	msg := binary.LittleEndian.Uint32(req)
+	self.received = append(self.received, msg)
+	if needsChecksum(msg) && binary.LittleEndian.Uint32(req[8:]) != checksum(msg, req[headerSize:]) {
+		return response(msg, 0x80070057, nil), nil
+	}
+	switch msg {
+	case CPMConnect:
+		self.connectIn = req
+		return response(msg, 0, binary.LittleEndian.AppendUint32(make([]byte, 0, 8), 0x00010109)), nil
+	case CPMCreateQuery:
+		body := make([]byte, 12)
+		binary.LittleEndian.PutUint32(body[8:], self.cursor)
+		return response(msg, 0, body), nil
+	case CPMSetBindings:
+		if binary.LittleEndian.Uint32(req[16:]) != self.cursor {
+			return response(msg, 0x80004005, nil), nil
+		}
+		self.rowWidth = binary.LittleEndian.Uint32(req[20:])
+		return response(msg, 0, nil), nil
+	case CPMGetRows:
+		return self.rows(req), nil
+	case CPMFreeCursor:
+		return response(msg, 0, make([]byte, 4)), nil
+	}
+	return nil, fmt.Errorf("Unexpected message 0x%x", msg)
+}
+
+// rows returns CPMGetRowsOut with a row per URL holding the URL, its length
+// as size and the modification time
+func (self *fakeTransport) rows(req []byte) []byte {
+	reserved := binary.LittleEndian.Uint32(req[32:])
+	res := response(CPMGetRows, DbSEndOfRowset, nil)
+	res = binary.LittleEndian.AppendUint32(res, uint32(len(self.urls)))
+	res = append(res, make([]byte, int(reserved)-len(res))...)
+	rows := len(res)
+	res = append(res, make([]byte, len(self.urls)*int(self.rowWidth))...)
+	var offsets []int
+	for _, url := range self.urls {
+		offsets = append(offsets, len(res))
+		res = append(res, encoder.ToUnicode(url+"\x00")...)
+	}
+	for i, url := range self.urls {
+		row := res[rows+i*int(self.rowWidth):]
+		binary.LittleEndian.PutUint16(row, VtLpwstr)
+		binary.LittleEndian.PutUint32(row[8:], uint32(offsets[i]))
+		binary.LittleEndian.PutUint16(row[24:], VtUI8)
+		binary.LittleEndian.PutUint64(row[32:], uint64(len(url)))
+		binary.LittleEndian.PutUint16(row[48:], VtFiletime)
+		binary.LittleEndian.PutUint64(row[56:], msdtyp.TimeToFiletime(self.modified))
+	}
+	// The size of the second row is not available
+	row := res[rows+int(self.rowWidth):]
+	row[24+20] = StoreStatusNull
+	return res
+}
+
+func (self *fakeTransport) Write(msg []byte) error {
+	self.received = append(self.received, binary.LittleEndian.Uint32(msg))
+	return nil
+}
+
+func TestChecksum(t *testing.T) {
+	body := []byte{1, 0, 0, 0, 2, 0, 0, 0}
+	if checksum(CPMConnect, body) != (3^0x59533959)-0xc8 {
+		t.Fatal("Fail")
+	}
+	w := newMessage(CPMFreeCursor)
+	w.u32(5)
+	if msg := w.finishMessage(); len(msg) != 20 || binary.LittleEndian.Uint32(msg[8:]) != 0 {
+		t.Fatalf("Fail: %x", msg)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	fake := &fakeTransport{}
+	c := &Client{t: fake}
+	err := c.Connect(&ConnectOptions{Scopes: []string{`C:\Users`}, Machine: "WS01", User: "alice"})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if c.ServerVersion != 0x00010109 {
+		t.Fatalf("Fail: 0x%x", c.ServerVersion)
+	}
+	req := fake.connectIn
+	if binary.LittleEndian.Uint32(req[16:]) != ClientVersion || !bytes.HasPrefix(req[48:], encoder.ToUnicode("WS01\x00alice\x00")) {
+		t.Fatalf("Fail: %x", req)
+	}
+	// The property sets and the extended property sets end the message
+	blob1 := binary.LittleEndian.Uint32(req[24:])
+	blob2 := binary.LittleEndian.Uint32(req[32:])
+	start := len(req) - int(blob2)
+	if start%8 != 0 || binary.LittleEndian.Uint32(req[start:]) != 2 {
+		t.Fatalf("Fail: %d %d", blob1, blob2)
+	}
+	if !bytes.Contains(req, encoder.ToUnicode(SystemIndex)) || !bytes.Contains(req, encoder.ToUnicode(`C:\Users`)) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fake := &fakeTransport{urls: []string{"file:C:/Users/alice/passwords.txt", "file:C:/secret.docx"}, modified: modified, cursor: 7}
+	c := &Client{t: fake}
+	rows, err := c.Query(&Query{Restriction: FullText("password*", 0)})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if fake.rowWidth != 3*columnSize {
+		t.Fatalf("Fail: %d", fake.rowWidth)
+	}
+	if len(rows) != 2 || rows[0][0] != fake.urls[0] || rows[0][1] != uint64(len(fake.urls[0])) || rows[1][0] != fake.urls[1] || rows[1][1] != nil {
+		t.Fatalf("Fail: %+v", rows)
+	}
+	if !rows[0][2].(time.Time).Equal(modified) {
+		t.Fatalf("Fail: %+v", rows[0][2])
+	}
+	expected := []uint32{CPMCreateQuery, CPMSetBindings, CPMGetRows, CPMFreeCursor}
+	if fmt.Sprint(fake.received) != fmt.Sprint(expected) {
+		t.Fatalf("Fail: %x", fake.received)
+	}
+
+	if rows, err = c.Query(&Query{Restriction: FullText("secret", 0), MaxResults: 1}); err != nil || len(rows) != 1 {
+		t.Fatalf("Fail: %+v %+v", rows, err)
+	}
+	if err = c.Disconnect(); err != nil || fake.received[len(fake.received)-1] != CPMDisconnect {
+		t.Fatal("Fail")
+	}
+}
+
+func TestFullText(t *testing.T) {
+	r := FullText(`password "net use" admin*`, DefaultLcid)
+	node, ok := r.(*NodeRestriction)
+	if !ok || node.Type != RTAnd || len(node.Nodes) != 3 {
+		t.Fatalf("Fail: %+v", r)
+	}
+	if phrase := node.Nodes[1].(*ContentRestriction); phrase.Phrase != "net use" || phrase.Method != GenerateMethodExact {
+		t.Fatalf("Fail: %+v", phrase)
+	}
+	if prefix := node.Nodes[2].(*ContentRestriction); prefix.Phrase != "admin" || prefix.Method != GenerateMethodPrefix {
+		t.Fatalf("Fail: %+v", prefix)
+	}
+	w := newMessage(CPMCreateQuery)
+	if err := r.marshal(w); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if binary.LittleEndian.Uint32(w.buf[16:]) != RTAnd || binary.LittleEndian.Uint32(w.buf[24:]) != 3 {
+		t.Fatalf("Fail: %x", w.buf)
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	msg := append(make([]byte, 8), encoder.ToUnicode("abc")...)
+	if _, err := decodeValue(msg, VtLpwstr, []byte{8, 0, 0, 0, 0, 0, 0, 0}); err == nil {
+		t.Fatal("Fail")
+	}
+	if _, err := decodeValue(msg, VtLpwstr, []byte{0xff, 0, 0, 0, 0, 0, 0, 0}); err == nil {
+		t.Fatal("Fail")
+	}
+	if _, err := decodeValue(msg, VtVector|VtLpwstr, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}); err == nil {
+		t.Fatal("Fail")
+	}
+	if v, err := decodeValue(msg, VtBool, []byte{0xff, 0xff, 0, 0, 0, 0, 0, 0}); err != nil || v != true {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,221 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// MS-SMB2 Section 2.2.35 Flags
+const SMB2WatchTree uint16 = 0x0001
+
+// MS-SMB2 Section 2.2.35 CompletionFilter
+const (
+	FileNotifyChangeFileName    uint32 = 0x00000001
+	FileNotifyChangeDirName     uint32 = 0x00000002
+	FileNotifyChangeAttributes  uint32 = 0x00000004
+	FileNotifyChangeSize        uint32 = 0x00000008
+	FileNotifyChangeLastWrite   uint32 = 0x00000010
+	FileNotifyChangeLastAccess  uint32 = 0x00000020
+	FileNotifyChangeCreation    uint32 = 0x00000040
+	FileNotifyChangeEa          uint32 = 0x00000080
+	FileNotifyChangeSecurity    uint32 = 0x00000100
+	FileNotifyChangeStreamName  uint32 = 0x00000200
+	FileNotifyChangeStreamSize  uint32 = 0x00000400
+	FileNotifyChangeStreamWrite uint32 = 0x00000800
+)
+
+// MS-FSCC Section 2.7.1 Action
+const (
+	FileActionAdded                uint32 = 0x00000001
+	FileActionRemoved              uint32 = 0x00000002
+	FileActionModified             uint32 = 0x00000003
+	FileActionRenamedOldName       uint32 = 0x00000004
+	FileActionRenamedNewName       uint32 = 0x00000005
+	FileActionAddedStream          uint32 = 0x00000006
+	FileActionRemovedStream        uint32 = 0x00000007
+	FileActionModifiedStream       uint32 = 0x00000008
+	FileActionRemovedByDelete      uint32 = 0x00000009
+	FileActionIdNotTunnelled       uint32 = 0x0000000a
+	FileActionTunnelledIdCollision uint32 = 0x0000000b
+)
+
+var FileActionMap = map[uint32]string{
+	FileActionAdded:                "added",
+	FileActionRemoved:              "removed",
+	FileActionModified:             "modified",
+	FileActionRenamedOldName:       "renamed from",
+	FileActionRenamedNewName:       "renamed to",
+	FileActionAddedStream:          "stream added",
+	FileActionRemovedStream:        "stream removed",
+	FileActionModifiedStream:       "stream modified",
+	FileActionRemovedByDelete:      "removed by delete",
+	FileActionIdNotTunnelled:       "id not tunnelled",
+	FileActionTunnelledIdCollision: "tunnelled id collision",
+}
+
+// MS-SMB2 Section 2.2.35
+type ChangeNotifyReq struct {
+	Header
+	StructureSize      uint16 // Must be 32
+	Flags              uint16
+	OutputBufferLength uint32
+	FileId             []byte `smb:"fixed:16"`
+	CompletionFilter   uint32
+	Reserved           uint32
+}
+
+// MS-SMB2 Section 2.2.36
+type ChangeNotifyRes struct {
+	Header
+	StructureSize      uint16 // Must be 9
+	OutputBufferOffset uint16 `smb:"offset:Buffer"`
+	OutputBufferLength uint32 `smb:"len:Buffer"`
+	Buffer             []byte
+}
+
+// A change reported by ChangeNotify
+type FileNotifyInformation struct {
+	Action   uint32
+	FileName string // Relative to the watched directory
+}
+
+func (s *Session) NewChangeNotifyReq(share string, fileId []byte, flags uint16, completionFilter uint32, outputBufferLength uint32) (ChangeNotifyReq, error) {
+	header := newHeader()
+	header.Command = CommandChangeNotify
+	header.CreditCharge = calcCreditCharge(outputBufferLength)
+	header.SessionID = s.sessionID
+	header.TreeID = s.trees[share]
+
+	if (s.dialect != DialectSmb_2_0_2) && s.supportsMultiCredit {
+		header.Credits = 127
+		if header.CreditCharge > 127 {
+			header.Credits = header.CreditCharge
+		}
+	}
+
+	return ChangeNotifyReq{
+		Header:             header,
+		StructureSize:      32,
+		Flags:              flags,
+		OutputBufferLength: outputBufferLength,
+		FileId:             fileId,
+		CompletionFilter:   completionFilter,
+	}, nil
+}
+
+// parseFileNotifyInformation parses the chained FILE_NOTIFY_INFORMATION
+// entries of MS-FSCC Section 2.7.1
+func parseFileNotifyInformation(buf []byte) (changes []FileNotifyInformation, err error) {
+	for offset := 0; offset < len(buf); {
+		if len(buf)-offset < 12 {
+			return nil, fmt.Errorf("Truncated FILE_NOTIFY_INFORMATION")
+		}
+		entry := buf[offset:]
+		next := binary.LittleEndian.Uint32(entry)
+		nameLen := binary.LittleEndian.Uint32(entry[8:])
+		if uint64(nameLen) > uint64(len(entry)-12) {
+			return nil, fmt.Errorf("Invalid FILE_NOTIFY_INFORMATION file name length %d", nameLen)
+		}
+		name, err := encoder.FromUnicodeString(entry[12 : 12+nameLen])
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, FileNotifyInformation{
+			Action:   binary.LittleEndian.Uint32(entry[4:]),
+			FileName: name,
+		})
+		if next == 0 {
+			break
+		}
+		if uint64(next) > uint64(len(entry)) {
+			return nil, fmt.Errorf("Invalid FILE_NOTIFY_INFORMATION next entry offset %d", next)
+		}
+		offset += int(next)
+	}
+	return
+}
+
+// OpenDirectoryNotify opens a directory for watching it with ChangeNotify.
+// Assumes a tree connect is already performed.
+func (s *Connection) OpenDirectoryNotify(share, dir string) (*File, error) {
+	opts := s.createReqOpts()
+	opts.DesiredAccess = DAccMaskFileListDirectory | FAccMaskFileReadAttributes | FAccMaskSynchronize
+	opts.ShareAccess = FileShareRead | FileShareWrite | FileShareDelete
+	opts.CreateOpts = FileDirectoryFile
+	return s.OpenFileExt(share, dir, opts)
+}
+
+// ChangeNotify waits until one of the changes selected by completionFilter
+// happens in the directory, or with recursive below it, and returns the
+// changes. The server queues changes between calls while the directory stays
+// open. When more changes happened than fit in bufferSize the status error
+// StatusNotifyEnumDir is returned, and closing the directory from another
+// goroutine returns StatusNotifyCleanup.
+func (f *File) ChangeNotify(completionFilter uint32, recursive bool, bufferSize uint32) (changes []FileNotifyInformation, err error) {
+	if f.fd == nil {
+		return nil, fmt.Errorf("Can't operate on a closed file")
+	}
+	var flags uint16
+	if recursive {
+		flags = SMB2WatchTree
+	}
+	req, err := f.NewChangeNotifyReq(f.share, f.fd, flags, completionFilter, bufferSize)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+
+	buf, err := f.sendrecv(req)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+
+	var h Header
+	if err = f.unmarshal(buf, &h); err != nil {
+		log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(buf))
+		return
+	}
+	if h.Status != StatusOk {
+		status, found := StatusMap[h.Status]
+		if !found {
+			err = fmt.Errorf("Received unknown SMB Header status for ChangeNotify response: 0x%x\n", h.Status)
+			log.Errorln(err)
+			return
+		}
+		log.Debugf("Failed ChangeNotify with NT Status Error: %v\n", status)
+		return nil, status
+	}
+
+	var res ChangeNotifyRes
+	if err = f.unmarshal(buf, &res); err != nil {
+		log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(buf))
+		return
+	}
+	return parseFileNotifyInformation(res.Buffer)
+}
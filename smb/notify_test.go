@@ -0,0 +1,128 @@
+package smb
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// fileNotifyInformation builds a FILE_NOTIFY_INFORMATION entry
+func fileNotifyInformation(action uint32, name string, last bool) []byte {
+	uname := encoder.ToUnicode(name)
+	size := (12 + len(uname) + 3) &^ 3
+	buf := make([]byte, size)
+	if !last {
+		binary.LittleEndian.PutUint32(buf, uint32(size))
+	}
+	binary.LittleEndian.PutUint32(buf[4:], action)
+	binary.LittleEndian.PutUint32(buf[8:], uint32(len(uname)))
+	copy(buf[12:], uname)
+	return buf
+}
+
+func TestParseFileNotifyInformation(t *testing.T) {
+	buf := append(fileNotifyInformation(FileActionRenamedOldName, "a.txt", false), fileNotifyInformation(FileActionRenamedNewName, `dir\b.txt`, true)...)
+	changes, err := parseFileNotifyInformation(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileNotifyInformation{
+		{Action: FileActionRenamedOldName, FileName: "a.txt"},
+		{Action: FileActionRenamedNewName, FileName: `dir\b.txt`},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("Fail: %+v", changes)
+	}
+
+	binary.LittleEndian.PutUint32(buf[8:], 1000)
+	if _, err = parseFileNotifyInformation(buf); err == nil {
+		t.Fatal("Fail")
+	}
+	if _, err = parseFileNotifyInformation(buf[:8]); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestChangeNotify(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.credits.Store(100)
+
+	// The server answers the CREATE and then the CHANGE_NOTIFY requests with
+	// an interim response followed by the changes
+	notify := make(chan ChangeNotifyReq, 2)
+	go func() {
+		for n := 0; ; {
+			buf, err := readTestFrame(server)
+			if err != nil {
+				return
+			}
+			var h Header
+			if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+				return
+			}
+			hdr := Header{
+				ProtocolID:    []byte(ProtocolSmb2),
+				StructureSize: 64,
+				Command:       h.Command,
+				Credits:       1,
+				MessageID:     h.MessageID,
+				Signature:     make([]byte, 16),
+			}
+			var res interface{}
+			switch h.Command {
+			case CommandCreate:
+				res = &CreateRes{Header: hdr, StructureSize: 89, FileId: make([]byte, 16), FileAttributes: FileAttrDirectory}
+			case CommandChangeNotify:
+				var req ChangeNotifyReq
+				if err = encoder.Unmarshal(buf, &req); err != nil {
+					return
+				}
+				notify <- req
+				interim := hdr
+				interim.Status = StatusPending
+				interim.Flags = SMB2_FLAGS_ASYNC_COMMAND
+				interim.Reserved = 1
+				if err = writeTestFrame(server, &ChangeNotifyRes{Header: interim, StructureSize: 9}); err != nil {
+					return
+				}
+				if n++; n == 2 {
+					hdr.Status = StatusNotifyEnumDir
+					res = &ChangeNotifyRes{Header: hdr, StructureSize: 9}
+					break
+				}
+				res = &ChangeNotifyRes{Header: hdr, StructureSize: 9, Buffer: fileNotifyInformation(FileActionAdded, `dir\new.txt`, true)}
+			case CommandClose:
+				res = &CloseRes{Header: hdr, StructureSize: 60}
+			}
+			if err = writeTestFrame(server, res); err != nil {
+				return
+			}
+		}
+	}()
+
+	f, err := c.OpenDirectoryNotify("share", "watched")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.CloseFile()
+	changes, err := f.ChangeNotify(FileNotifyChangeFileName|FileNotifyChangeLastWrite, true, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Action != FileActionAdded || changes[0].FileName != `dir\new.txt` {
+		t.Fatalf("Fail: %+v", changes)
+	}
+	req := <-notify
+	if req.StructureSize != 32 || req.Flags != SMB2WatchTree || req.CompletionFilter != FileNotifyChangeFileName|FileNotifyChangeLastWrite || req.OutputBufferLength != 4096 {
+		t.Fatalf("Fail: %+v", req)
+	}
+
+	if _, err = f.ChangeNotify(FileNotifyChangeFileName, false, 4096); err != StatusMap[StatusNotifyEnumDir] {
+		t.Fatalf("Fail: %v", err)
+	}
+	if req = <-notify; req.Flags != 0 {
+		t.Fatalf("Fail: %+v", req)
+	}
+}
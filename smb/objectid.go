@@ -0,0 +1,214 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// ObjectIdIndex is the index of the object ids of an NTFS volume, which
+// lists them with FileObjectIdInformation
+const ObjectIdIndex = `$Extend\$ObjId:$O:$INDEX_ALLOCATION`
+
+// ObjectId is the FILE_OBJECTID_BUFFER of MS-FSCC Section 2.1.3 with the
+// extended information used by distributed link tracking to find a file that
+// was moved or copied to another volume
+type ObjectId struct {
+	ObjectId      [16]byte // Identifies the file on its volume
+	BirthVolumeId [16]byte // Object id of the volume the file was created on
+	BirthObjectId [16]byte // Object id of the file when it was created
+	DomainId      [16]byte // Reserved, zero
+}
+
+// Size of FILE_OBJECTID_BUFFER
+const objectIdSize = 64
+
+func (self *ObjectId) MarshalBinary() []byte {
+	buf := make([]byte, 0, objectIdSize)
+	buf = append(buf, self.ObjectId[:]...)
+	buf = append(buf, self.BirthVolumeId[:]...)
+	buf = append(buf, self.BirthObjectId[:]...)
+	return append(buf, self.DomainId[:]...)
+}
+
+func (self *ObjectId) UnmarshalBinary(buf []byte) error {
+	if len(buf) < objectIdSize {
+		return fmt.Errorf("Buffer too small for FILE_OBJECTID_BUFFER")
+	}
+	copy(self.ObjectId[:], buf)
+	copy(self.BirthVolumeId[:], buf[16:])
+	copy(self.BirthObjectId[:], buf[32:])
+	copy(self.DomainId[:], buf[48:])
+	return nil
+}
+
+// FileObjectId is the FILE_OBJECTID_INFORMATION of MS-FSCC Section 2.4.31,
+// an entry of the object id index
+type FileObjectId struct {
+	FileReference uint64 // File id of the file on the volume
+	ObjectId
+}
+
+// Size of FILE_OBJECTID_INFORMATION
+const fileObjectIdSize = 8 + objectIdSize
+
+// parseFileObjectIds decodes the FILE_OBJECTID_INFORMATION entries of a
+// QUERY_DIRECTORY response, which follow each other without padding
+func parseFileObjectIds(buf []byte) (ids []FileObjectId, err error) {
+	if len(buf)%fileObjectIdSize != 0 {
+		return nil, fmt.Errorf("Invalid size %d of FILE_OBJECTID_INFORMATION entries", len(buf))
+	}
+	for ; len(buf) > 0; buf = buf[fileObjectIdSize:] {
+		id := FileObjectId{FileReference: binary.LittleEndian.Uint64(buf)}
+		if err = id.ObjectId.UnmarshalBinary(buf[8:]); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+// fsctl sends an FSCTL request with the input and returns its output
+func (f *File) fsctl(code uint32, input []byte) ([]byte, error) {
+	req, err := f.NewIoCTLReq(code, input)
+	if err != nil {
+		return nil, err
+	}
+	res, err := f.WriteIoCtlReq(req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Buffer, nil
+}
+
+// objectIdFsctl sends an FSCTL request returning a FILE_OBJECTID_BUFFER
+func (f *File) objectIdFsctl(code uint32) (*ObjectId, error) {
+	buf, err := f.fsctl(code, nil)
+	if err != nil {
+		return nil, err
+	}
+	id := &ObjectId{}
+	if err = id.UnmarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// GetObjectId returns the object id of the file. A file without one fails
+// with the StatusObjectNameNotFound error of StatusMap and file systems
+// other than NTFS with FsctlStatusInvalidDeviceRequest.
+func (f *File) GetObjectId() (*ObjectId, error) {
+	return f.objectIdFsctl(FsctlGetObjectId)
+}
+
+// CreateOrGetObjectId returns the object id of the file, which the server
+// assigns if the file has none
+func (f *File) CreateOrGetObjectId() (*ObjectId, error) {
+	return f.objectIdFsctl(FsctlCreateOrGetObjectId)
+}
+
+// SetObjectId sets the object id of a file without one, e.g., to preserve
+// the object id of a migrated file. The file must be opened with write
+// access, and the server requires the restore privilege.
+func (f *File) SetObjectId(id *ObjectId) error {
+	_, err := f.fsctl(FsctlSetObjectId, id.MarshalBinary())
+	return err
+}
+
+// DeleteObjectId removes the object id of the file. The file must be opened
+// with write access.
+func (f *File) DeleteObjectId() error {
+	_, err := f.fsctl(FsctlDeleteObjectId, nil)
+	return err
+}
+
+// queryDirectoryInfo returns the output buffer of a QUERY_DIRECTORY request
+// for the information class, nil when there are no more entries
+func (f *File) queryDirectoryInfo(infoClass byte, pattern string, flags byte, bufferSize uint32) ([]byte, error) {
+	if f.fd == nil {
+		return nil, fmt.Errorf("Can't operate on a closed file")
+	}
+	req, err := f.NewQueryDirectoryReq(f.share, pattern, f.fd, infoClass, flags, 0, bufferSize)
+	if err != nil {
+		log.Debugln(err)
+		return nil, err
+	}
+	buf, err := f.sendrecv(req)
+	if err != nil {
+		log.Debugln(err)
+		return nil, err
+	}
+	var res QueryDirectoryRes
+	if err = f.unmarshal(buf, &res); err != nil {
+		log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(buf))
+		return nil, err
+	}
+	if res.Header.Status == StatusNoMoreFiles {
+		return nil, nil
+	} else if res.Header.Status != StatusOk {
+		status, found := StatusMap[res.Header.Status]
+		if !found {
+			err = fmt.Errorf("Received unknown SMB Header status for QueryDirectory response: 0x%x\n", res.Header.Status)
+			log.Errorln(err)
+			return nil, err
+		}
+		log.Debugf("Failed QueryDirectory with NT Status Error: %v\n", status)
+		return nil, status
+	}
+	if res.OutputBufferLength > bufferSize || int(res.OutputBufferLength) > len(res.Buffer) {
+		return nil, fmt.Errorf("QueryDirectory response of %d bytes exceeds the requested %d bytes", res.OutputBufferLength, bufferSize)
+	}
+	return res.Buffer[:res.OutputBufferLength], nil
+}
+
+// ListObjectIds lists the object ids of the volume of a share from its
+// ObjectIdIndex, which requires the share to be the root of an NTFS volume,
+// e.g., C$, and administrative rights. The files are identified by their
+// file id.
+func (s *Connection) ListObjectIds(share string) (ids []FileObjectId, err error) {
+	opts := s.createReqOpts()
+	opts.DesiredAccess = FAccMaskFileReadData | FAccMaskFileReadAttributes | FAccMaskSynchronize
+	opts.ShareAccess = FileShareRead | FileShareWrite | FileShareDelete
+	f, err := s.OpenFileExt(share, ObjectIdIndex, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer f.CloseFile()
+	flags := RestartScans
+	for {
+		buf, err := f.queryDirectoryInfo(FileObjectIdInformation, "*", flags, f.transactSize())
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) == 0 {
+			return ids, nil
+		}
+		page, err := parseFileObjectIds(buf)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, page...)
+		flags = 0
+	}
+}
@@ -0,0 +1,145 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// serveObjectIds answers the object id FSCTLs of a single file and lists
+// the index with a single page of entries
+func serveObjectIds(server net.Conn, index []FileObjectId) {
+	var current *ObjectId
+	for {
+		buf, err := readTestFrame(server)
+		if err != nil {
+			return
+		}
+		var h Header
+		if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+			return
+		}
+		hdr := Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       h.Command,
+			Credits:       1,
+			Flags:         SMB2_FLAGS_SERVER_TO_REDIR,
+			MessageID:     h.MessageID,
+			Signature:     make([]byte, 16),
+		}
+		var res interface{}
+		switch h.Command {
+		case CommandCreate:
+			res = &CreateRes{Header: hdr, StructureSize: 89, FileId: make([]byte, 16)}
+		case CommandIOCtl:
+			var req IoCtlReq
+			if err = encoder.Unmarshal(buf, &req); err != nil {
+				return
+			}
+			var out []byte
+			switch req.CtlCode {
+			case FsctlCreateOrGetObjectId:
+				if current == nil {
+					current = &ObjectId{ObjectId: [16]byte{1, 2, 3}, BirthObjectId: [16]byte{1, 2, 3}}
+				}
+				fallthrough
+			case FsctlGetObjectId:
+				if current == nil {
+					hdr.Status = StatusObjectNameNotFound
+					break
+				}
+				out = current.MarshalBinary()
+			case FsctlSetObjectId:
+				current = &ObjectId{}
+				current.UnmarshalBinary(req.Buffer)
+			case FsctlDeleteObjectId:
+				current = nil
+			}
+			if hdr.Status != StatusOk {
+				res = &QueryInfoRes{Header: hdr, StructureSize: 9, Buffer: []byte{0}}
+				break
+			}
+			res = &IoCtlRes{Header: hdr, StructureSize: 49, CtlCode: req.CtlCode, FileId: make([]byte, 16), Buffer: out}
+		case CommandQueryDirectory:
+			if buf[66] != FileObjectIdInformation || buf[67]&RestartScans == 0 || len(index) == 0 {
+				hdr.Status = StatusNoMoreFiles
+				res = &QueryDirectoryRes{Header: hdr, StructureSize: 9, Buffer: []byte{0}}
+				break
+			}
+			var out []byte
+			for _, e := range index {
+				out = binary.LittleEndian.AppendUint64(out, e.FileReference)
+				out = append(out, e.ObjectId.MarshalBinary()...)
+			}
+			res = &QueryDirectoryRes{Header: hdr, StructureSize: 9, Buffer: out}
+		case CommandClose:
+			res = &CloseRes{Header: hdr, StructureSize: 60}
+		}
+		if err = writeTestFrame(server, res); err != nil {
+			return
+		}
+	}
+}
+
+func TestObjectId(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.credits.Store(100)
+	c.maxTransactSize = 65536
+	go serveObjectIds(server, nil)
+
+	f, err := c.OpenFile("share", "file.txt")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer f.CloseFile()
+	if _, err = f.GetObjectId(); err != StatusMap[StatusObjectNameNotFound] {
+		t.Fatalf("Fail: %+v", err)
+	}
+	created, err := f.CreateOrGetObjectId()
+	if err != nil || created.ObjectId[0] != 1 {
+		t.Fatalf("Fail: %+v %v", created, err)
+	}
+	if err = f.DeleteObjectId(); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	// Preserve the ids of a migrated file
+	migrated := &ObjectId{ObjectId: [16]byte{9}, BirthVolumeId: [16]byte{8}, BirthObjectId: [16]byte{7}}
+	if err = f.SetObjectId(migrated); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	id, err := f.GetObjectId()
+	if err != nil || *id != *migrated {
+		t.Fatalf("Fail: %+v %v", id, err)
+	}
+}
+
+func TestListObjectIds(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.credits.Store(100)
+	c.maxTransactSize = 65536
+	index := []FileObjectId{
+		{FileReference: 0x0001000000000024, ObjectId: ObjectId{ObjectId: [16]byte{1}, BirthVolumeId: [16]byte{2}}},
+		{FileReference: 0x0003000000000101, ObjectId: ObjectId{ObjectId: [16]byte{3}, DomainId: [16]byte{4}}},
+	}
+	go serveObjectIds(server, index)
+
+	ids, err := c.ListObjectIds("share")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if len(ids) != len(index) {
+		t.Fatalf("Fail: %+v", ids)
+	}
+	for i := range index {
+		if ids[i] != index[i] {
+			t.Fatalf("Fail: %+v", ids[i])
+		}
+	}
+	if _, err = parseFileObjectIds(bytes.Repeat([]byte{0}, fileObjectIdSize+1)); err == nil {
+		t.Fatal("Fail")
+	}
+}
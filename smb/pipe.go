@@ -0,0 +1,259 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Named pipes commonly exposed by Windows hosts and services. They are
+// probed by ProbePipes since servers do not always list every pipe on IPC$.
+var KnownPipes = []string{
+	"atsvc", "browser", "cert", "ctx_winstation_api_service", "DAV RPC SERVICE",
+	"efsrpc", "epmapper", "eventlog", "InitShutdown", "keysvc", "lsarpc",
+	"lsass", "LSM_API_service", "msfte", "netdfs", "netlogon", "ntsvcs",
+	"protected_storage", "PSEXESVC", "RemCom_communicaton", "samr",
+	"scerpc", "spoolss", "sql\\query", "srvsvc", "svcctl", "tapsrv",
+	"trkwks", "W32TIME_ALT", "winreg", "wkssvc",
+}
+
+// Named pipe states of MS-FSCC Section 2.4.30
+const (
+	PipeDisconnectedState uint32 = 1
+	PipeListeningState    uint32 = 2
+	PipeConnectedState    uint32 = 3
+	PipeClosingState      uint32 = 4
+)
+
+// Named pipe types and configurations of MS-FSCC Section 2.4.30
+const (
+	PipeByteStreamType uint32 = 0
+	PipeMessageType    uint32 = 1
+
+	PipeInbound    uint32 = 0
+	PipeOutbound   uint32 = 1
+	PipeFullDuplex uint32 = 2
+)
+
+// Pipe is a named pipe opened for reading and writing. It implements
+// io.ReadWriteCloser where Read blocks until the other end writes and
+// returns io.EOF once it has closed the pipe.
+type Pipe struct {
+	*File
+}
+
+// ListPipes lists the named pipes on the IPC$ share with a directory query.
+// Some servers refuse the query or only list part of their pipes.
+func (s *Connection) ListPipes() (pipes []string, err error) {
+	share := "IPC$"
+	if err = s.TreeConnect(share); err != nil {
+		return
+	}
+	files, err := s.ListDirectory(share, "", "*")
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		pipes = append(pipes, file.Name)
+	}
+	return
+}
+
+// pipeExists interprets the result of opening a pipe. A pipe that exists can
+// still refuse the caller or have all its instances in use.
+func pipeExists(err error) bool {
+	return err == nil ||
+		err == StatusMap[StatusAccessDenied] ||
+		err == StatusMap[StatusPipeBusy] ||
+		err == StatusMap[StatusPipeNotAvailable]
+}
+
+// ProbePipes opens each of the named pipes, e.g., KnownPipes, and returns
+// the ones that exist on the server
+func (s *Connection) ProbePipes(names []string) (found []string, err error) {
+	share := "IPC$"
+	if err = s.TreeConnect(share); err != nil {
+		return
+	}
+	opts := s.createReqOpts()
+	opts.DesiredAccess = FAccMaskFileReadAttributes | FAccMaskSynchronize
+	for _, name := range names {
+		f, err := s.OpenFileExt(share, name, opts)
+		if f != nil {
+			f.CloseFile()
+		}
+		if pipeExists(err) {
+			found = append(found, name)
+		} else {
+			log.Debugf("Pipe %s: %s\n", name, err)
+		}
+	}
+	return
+}
+
+// OpenPipe opens a named pipe on the IPC$ share for reading and writing
+func (s *Connection) OpenPipe(name string) (p *Pipe, err error) {
+	opts := s.createReqOpts()
+	opts.DesiredAccess |= FAccMaskFileWriteData | FAccMaskFileAppendData
+	f, err := s.OpenFileExt("IPC$", name, opts)
+	if err != nil {
+		return
+	}
+	return &Pipe{f}, nil
+}
+
+// Read reads the next message or part of it from the pipe
+func (p *Pipe) Read(b []byte) (n int, err error) {
+	n, err = p.ReadFile(b, 0)
+	if err == StatusMap[FsctlStatusPipeDisconnected] || err == StatusMap[FsctlStatusPipeBroken] {
+		err = io.EOF
+	}
+	return
+}
+
+// Write writes b to the pipe
+func (p *Pipe) Write(b []byte) (n int, err error) {
+	return p.WriteFile(b, 0)
+}
+
+// Close closes the handle of the pipe
+func (p *Pipe) Close() error {
+	return p.CloseFile()
+}
+
+// PipePeek is the FSCTL_PIPE_PEEK_REPLY of MS-FSCC Section 2.3.47
+type PipePeek struct {
+	NamedPipeState    uint32 // One of the pipe states, e.g., PipeConnectedState
+	ReadDataAvailable uint32 // Bytes that can be read without blocking
+	NumberOfMessages  uint32 // Messages in the pipe, 0 for a byte stream
+	MessageLength     uint32 // Length of the next message
+	Data              []byte // Start of the data, which is left in the pipe
+}
+
+// Size of FSCTL_PIPE_PEEK_REPLY without Data
+const pipePeekSize = 16
+
+// Peek returns the state of the pipe and up to size bytes of the data it
+// holds without removing them or waiting for the other end to write. The
+// size is capped at what fits in the negotiated MaxTransactSize.
+func (p *Pipe) Peek(size int) (*PipePeek, error) {
+	if p.fd == nil {
+		return nil, fmt.Errorf("Can't operate on a closed file")
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("Invalid negative peek size")
+	}
+	size = min(size, int(p.transactSize())-pipePeekSize)
+	req, err := p.NewIoCTLReq(FsctlPipePeek, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.MaxOutputResponse = uint32(pipePeekSize + size)
+	buf, err := p.sendrecv(req)
+	if err != nil {
+		log.Debugln(err)
+		return nil, err
+	}
+	var res IoCtlRes
+	if err = p.unmarshal(buf, &res); err != nil {
+		log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(buf))
+		return nil, err
+	}
+	// The server truncates the data to MaxOutputResponse with a
+	// StatusBufferOverflow warning
+	if res.Header.Status != StatusOk && res.Header.Status != StatusBufferOverflow {
+		status, found := StatusMap[res.Header.Status]
+		if !found {
+			return nil, fmt.Errorf("Received unknown SMB Header status for PipePeek response: 0x%x\n", res.Header.Status)
+		}
+		log.Debugf("Failed PipePeek with NT Status Error: %v\n", status)
+		return nil, status
+	}
+	if len(res.Buffer) < pipePeekSize {
+		return nil, fmt.Errorf("Buffer too small for FSCTL_PIPE_PEEK_REPLY")
+	}
+	return &PipePeek{
+		NamedPipeState:    binary.LittleEndian.Uint32(res.Buffer),
+		ReadDataAvailable: binary.LittleEndian.Uint32(res.Buffer[4:]),
+		NumberOfMessages:  binary.LittleEndian.Uint32(res.Buffer[8:]),
+		MessageLength:     binary.LittleEndian.Uint32(res.Buffer[12:]),
+		Data:              res.Buffer[pipePeekSize:],
+	}, nil
+}
+
+// Available returns the number of bytes that can be read from the pipe
+// without blocking
+func (p *Pipe) Available() (int, error) {
+	peek, err := p.Peek(0)
+	if err != nil {
+		return 0, err
+	}
+	return int(peek.ReadDataAvailable), nil
+}
+
+// PipeLocalInformation is the FILE_PIPE_LOCAL_INFORMATION of MS-FSCC
+// Section 2.4.30
+type PipeLocalInformation struct {
+	NamedPipeType          uint32 // PipeByteStreamType or PipeMessageType
+	NamedPipeConfiguration uint32 // PipeInbound, PipeOutbound or PipeFullDuplex
+	MaximumInstances       uint32 // 0xffffffff for unlimited instances
+	CurrentInstances       uint32
+	InboundQuota           uint32
+	ReadDataAvailable      uint32
+	OutboundQuota          uint32
+	WriteQuotaAvailable    uint32
+	NamedPipeState         uint32 // One of the pipe states, e.g., PipeConnectedState
+	NamedPipeEnd           uint32 // 0 for the client end, 1 for the server end
+}
+
+// Size of FILE_PIPE_LOCAL_INFORMATION
+const pipeLocalInformationSize = 40
+
+// LocalInformation queries the type, state, instances and quotas of the pipe
+func (p *Pipe) LocalInformation() (*PipeLocalInformation, error) {
+	buf, err := p.QueryInfo(OInfoFile, FilePipeLocalInformation, pipeLocalInformationSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < pipeLocalInformationSize {
+		return nil, fmt.Errorf("Buffer too small for FILE_PIPE_LOCAL_INFORMATION")
+	}
+	field := func(i int) uint32 {
+		return binary.LittleEndian.Uint32(buf[4*i:])
+	}
+	return &PipeLocalInformation{
+		NamedPipeType:          field(0),
+		NamedPipeConfiguration: field(1),
+		MaximumInstances:       field(2),
+		CurrentInstances:       field(3),
+		InboundQuota:           field(4),
+		ReadDataAvailable:      field(5),
+		OutboundQuota:          field(6),
+		WriteQuotaAvailable:    field(7),
+		NamedPipeState:         field(8),
+		NamedPipeEnd:           field(9),
+	}, nil
+}
@@ -0,0 +1,160 @@
+// MIT License
+//
+// # Copyright (c) 2023 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+func TestPipeExists(t *testing.T) {
+	cases := []struct {
+		err    error
+		exists bool
+	}{
+		{nil, true},
+		{StatusMap[StatusAccessDenied], true},
+		{StatusMap[StatusPipeBusy], true},
+		{StatusMap[StatusPipeNotAvailable], true},
+		{StatusMap[StatusObjectNameNotFound], false},
+		{fmt.Errorf("Connection reset"), false},
+	}
+	for _, c := range cases {
+		if pipeExists(c.err) != c.exists {
+			t.Fatalf("Fail: %v", c.err)
+		}
+	}
+}
+
+// servePipe answers the peek and local information queries of a message
+// mode pipe holding a single message
+func servePipe(server net.Conn, message []byte) {
+	for {
+		buf, err := readTestFrame(server)
+		if err != nil {
+			return
+		}
+		var h Header
+		if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+			return
+		}
+		hdr := Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       h.Command,
+			Credits:       1,
+			Flags:         SMB2_FLAGS_SERVER_TO_REDIR,
+			MessageID:     h.MessageID,
+			Signature:     make([]byte, 16),
+		}
+		var res interface{}
+		switch h.Command {
+		case CommandCreate:
+			res = &CreateRes{Header: hdr, StructureSize: 89, FileId: make([]byte, 16)}
+		case CommandIOCtl:
+			var req IoCtlReq
+			if err = encoder.Unmarshal(buf, &req); err != nil || req.CtlCode != FsctlPipePeek {
+				return
+			}
+			out := binary.LittleEndian.AppendUint32(nil, PipeConnectedState)
+			out = binary.LittleEndian.AppendUint32(out, uint32(len(message)))
+			out = binary.LittleEndian.AppendUint32(out, 1)
+			out = binary.LittleEndian.AppendUint32(out, uint32(len(message)))
+			out = append(out, message...)
+			if len(out) > int(req.MaxOutputResponse) {
+				out = out[:req.MaxOutputResponse]
+				hdr.Status = StatusBufferOverflow
+			}
+			res = &IoCtlRes{Header: hdr, StructureSize: 49, CtlCode: req.CtlCode, FileId: make([]byte, 16), Buffer: out}
+		case CommandQueryInfo:
+			if buf[66] != OInfoFile || buf[67] != FilePipeLocalInformation {
+				return
+			}
+			var out []byte
+			for _, v := range []uint32{PipeMessageType, PipeFullDuplex, 0xffffffff, 1, 4096, uint32(len(message)), 4096, 4096, PipeConnectedState, 0} {
+				out = binary.LittleEndian.AppendUint32(out, v)
+			}
+			res = &QueryInfoRes{Header: hdr, StructureSize: 9, OutputBufferOffset: 72, OutputBufferLength: uint32(len(out)), Buffer: out}
+		case CommandClose:
+			res = &CloseRes{Header: hdr, StructureSize: 60}
+		}
+		if err = writeTestFrame(server, res); err != nil {
+			return
+		}
+	}
+}
+
+func TestPipePeek(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.credits.Store(100)
+	c.maxTransactSize = 65536
+	c.trees["IPC$"] = 2
+	message := []byte("bind_ack")
+	go servePipe(server, message)
+
+	p, err := c.OpenPipe("srvsvc")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer p.Close()
+	peek, err := p.Peek(64)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if peek.NamedPipeState != PipeConnectedState || peek.NumberOfMessages != 1 ||
+		peek.MessageLength != uint32(len(message)) || !bytes.Equal(peek.Data, message) {
+		t.Fatalf("Fail: %+v", peek)
+	}
+	// Truncated data is not an error
+	peek, err = p.Peek(4)
+	if err != nil || !bytes.Equal(peek.Data, message[:4]) {
+		t.Fatalf("Fail: %+v %v", peek, err)
+	}
+	if _, err = p.Peek(-1); err == nil {
+		t.Fatal("Fail")
+	}
+	// Larger sizes are capped at the max transact size
+	c.maxTransactSize = pipePeekSize + 2
+	peek, err = p.Peek(1 << 30)
+	if err != nil || !bytes.Equal(peek.Data, message[:2]) {
+		t.Fatalf("Fail: %+v %v", peek, err)
+	}
+	c.maxTransactSize = 65536
+	n, err := p.Available()
+	if err != nil || n != len(message) {
+		t.Fatalf("Fail: %d %v", n, err)
+	}
+	info, err := p.LocalInformation()
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if info.NamedPipeType != PipeMessageType || info.NamedPipeConfiguration != PipeFullDuplex ||
+		info.ReadDataAvailable != uint32(len(message)) || info.NamedPipeState != PipeConnectedState {
+		t.Fatalf("Fail: %+v", info)
+	}
+}
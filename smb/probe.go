@@ -0,0 +1,337 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ericblavier/go-smb/gss"
+	"github.com/ericblavier/go-smb/ntlmssp"
+	"github.com/ericblavier/go-smb/smb/encoder"
+	"github.com/ericblavier/go-smb/spnego"
+	"github.com/jfjallid/gofork/encoding/asn1"
+	"golang.org/x/net/proxy"
+)
+
+// Deadline for a complete probe unless ProbeOptions.Timeout is set
+const defaultProbeTimeout = 2 * time.Second
+
+type ProbeOptions struct {
+	Port        int           // Defaults to 445
+	Timeout     time.Duration // Deadline for connecting and negotiating. Defaults to 2 seconds
+	ProxyDialer proxy.Dialer
+	Dialects    []uint16 // Dialects to offer. Defaults to all SMB 2 and 3 dialects
+	Compression bool     // Offer all compression algorithms for SMB 3.1.1
+}
+
+// ProbeResult describes the server side of a SMB2 negotiation
+type ProbeResult struct {
+	Dialect             uint16
+	SigningEnabled      bool
+	SigningRequired     bool
+	EncryptionSupported bool
+	Cipher              uint16 // Selected cipher for SMB 3.1.1, otherwise 0
+	SigningAlgorithm    uint16 // Selected signing algorithm for SMB 3.1.1, if announced
+	ServerGuid          []byte
+	Capabilities        uint32
+	MaxTransactSize     uint32
+	MaxReadSize         uint32
+	MaxWriteSize        uint32
+	SystemTime          time.Time
+	ServerStartTime     time.Time               // Zero for most servers
+	MechTypes           []asn1.ObjectIdentifier // Authentication mechanisms announced in the negotiate response
+	// Compression algorithms supported by the server for SMB 3.1.1 when
+	// compression was offered
+	CompressionAlgorithms []uint16
+}
+
+// Probe connects to host and performs a single SMB2 NEGOTIATE exchange
+// without setting up a session. It is intended for scanning many hosts and
+// therefore runs without the background goroutines of a Connection and
+// gives up once the deadline passes.
+func Probe(host string, opts ProbeOptions) (res *ProbeResult, err error) {
+	conn, addr, err := dialProbe(host, &opts)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	return negotiateProbe(conn, addr, opts)
+}
+
+// negotiateProbe sends the NEGOTIATE request of a probe over conn and parses
+// the response
+func negotiateProbe(conn net.Conn, addr string, opts ProbeOptions) (res *ProbeResult, err error) {
+	if len(opts.Dialects) == 0 {
+		opts.Dialects = []uint16{DialectSmb_2_0_2, DialectSmb_2_1, DialectSmb_3_0, DialectSmb_3_0_2, DialectSmb_3_1_1}
+	}
+	s := &Session{clientGuid: make([]byte, 16)}
+	if _, err = rand.Read(s.clientGuid); err != nil {
+		return
+	}
+	req, err := s.NewNegotiateReq()
+	if err != nil {
+		return
+	}
+	req.Dialects = opts.Dialects
+	req.DialectCount = uint16(len(opts.Dialects))
+	if opts.Compression {
+		cc := CompressionContext{
+			CompressionAlgorithmCount: 4,
+			CompressionAlgorithms:     []uint16{CompressionLZNT1, CompressionLZ77, CompressionLZ77Huffman, CompressionPatternV1},
+		}
+		ccBuf, err := encoder.Marshal(cc)
+		if err != nil {
+			return nil, err
+		}
+		req.ContextList = append(req.ContextList, NegContext{
+			ContextType: CompressionCapabilities,
+			Data:        ccBuf,
+			DataLength:  uint16(len(ccBuf)),
+			Padd:        make([]byte, (8-(len(ccBuf)%8))%8),
+		})
+		req.NegotiateContextCount = uint16(len(req.ContextList))
+	}
+	buf, err := encoder.Marshal(&req)
+	if err != nil {
+		return
+	}
+	pkt := net.Buffers{binary.BigEndian.AppendUint32(make([]byte, 0, 4), uint32(len(buf))), buf}
+	if _, err = pkt.WriteTo(conn); err != nil {
+		return
+	}
+
+	packet, err := readPacket(conn)
+	if err != nil {
+		return
+	}
+	defer encoder.PutBuffer(packet)
+	if len(packet) < 64 || string(packet[:4]) != ProtocolSmb2 {
+		return nil, fmt.Errorf("Target %s did not respond with a SMB2 negotiate response", addr)
+	}
+	if err = checkSecurityBlob(packet); err != nil {
+		return
+	}
+	negRes := NewNegotiateRes()
+	if err = encoder.Unmarshal(packet, &negRes); err != nil {
+		return
+	}
+	if negRes.Header.Status != StatusOk {
+		if status, found := StatusMap[negRes.Header.Status]; found {
+			return nil, status
+		}
+		return nil, fmt.Errorf("Received unknown SMB Header status for Negotiate response: 0x%x\n", negRes.Header.Status)
+	}
+
+	res = &ProbeResult{
+		Dialect:             negRes.DialectRevision,
+		SigningEnabled:      negRes.SecurityMode&SecurityModeSigningEnabled != 0,
+		SigningRequired:     negRes.SecurityMode&SecurityModeSigningRequired != 0,
+		EncryptionSupported: negRes.Capabilities&GlobalCapEncryption != 0,
+		ServerGuid:          append([]byte(nil), negRes.ServerGuid...),
+		Capabilities:        negRes.Capabilities,
+		MaxTransactSize:     negRes.MaxTransactSize,
+		MaxReadSize:         negRes.MaxReadSize,
+		MaxWriteSize:        negRes.MaxWriteSize,
+		SystemTime:          negRes.ServerSystemTime(),
+		ServerStartTime:     negRes.ServerStartupTime(),
+	}
+	if negRes.SecurityBlob != nil {
+		res.MechTypes = negRes.SecurityBlob.Data.MechTypes
+	}
+	for _, context := range negRes.ContextList {
+		switch context.ContextType {
+		case EncryptionCapabilities:
+			var ec EncryptionContext
+			if encoder.Unmarshal(context.Data, &ec) == nil && len(ec.Ciphers) > 0 {
+				res.Cipher = ec.Ciphers[0]
+				res.EncryptionSupported = res.Cipher != 0
+			}
+		case SigningCapabilities:
+			var sc SigningContext
+			if encoder.Unmarshal(context.Data, &sc) == nil && len(sc.SigningAlgorithms) > 0 {
+				res.SigningAlgorithm = sc.SigningAlgorithms[0]
+			}
+		case CompressionCapabilities:
+			var cc CompressionContext
+			if encoder.Unmarshal(context.Data, &cc) == nil {
+				for _, algorithm := range cc.CompressionAlgorithms {
+					if algorithm != CompressionNone {
+						res.CompressionAlgorithms = append(res.CompressionAlgorithms, algorithm)
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// FingerprintResult describes a host from its negotiate response and the
+// NTLM challenge sent in reply to the first session setup request
+type FingerprintResult struct {
+	ProbeResult
+	ClockSkew  time.Duration // Server time minus local time when the negotiate response was received
+	TargetInfo *TargetInfo   // Nil when the server did not answer with an NTLM challenge
+}
+
+// Fingerprint negotiates like Probe and then sends the first session setup
+// request of an anonymous NTLM authentication to read the computer and
+// domain names and the OS version from the challenge. The authentication is
+// not completed, so no session is established and no logon is recorded.
+func Fingerprint(host string, opts ProbeOptions) (res *FingerprintResult, err error) {
+	conn, addr, err := dialProbe(host, &opts)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	probe, err := negotiateProbe(conn, addr, opts)
+	if err != nil {
+		return
+	}
+	res = &FingerprintResult{ProbeResult: *probe}
+	res.ClockSkew, _ = clockSkew(probe.SystemTime, time.Now())
+
+	spnegoClient, err := spnego.NewClient([]gss.Mechanism{&spnego.NTLMInitiator{NullSession: true}})
+	if err != nil {
+		return
+	}
+	c := &Connection{Session: &Session{}}
+	req, err := c.NewSessionSetup1Req(spnegoClient)
+	if err != nil {
+		return
+	}
+	req.Header.MessageID = 1
+	buf, err := encoder.Marshal(&req)
+	if err != nil {
+		return
+	}
+	pkt := net.Buffers{binary.BigEndian.AppendUint32(make([]byte, 0, 4), uint32(len(buf))), buf}
+	if _, err = pkt.WriteTo(conn); err != nil {
+		return
+	}
+	packet, err := readPacket(conn)
+	if err != nil {
+		return
+	}
+	defer encoder.PutBuffer(packet)
+	if err = checkSecurityBlob(packet); err != nil {
+		return
+	}
+	ssres, err := NewSessionSetup1Res()
+	if err != nil {
+		return
+	}
+	if err = encoder.Unmarshal(packet, &ssres); err != nil {
+		return
+	}
+	if ssres.Header.Status != StatusMoreProcessingRequired {
+		if status, found := StatusMap[ssres.Header.Status]; found {
+			return nil, status
+		}
+		return nil, fmt.Errorf("Received unknown SMB Header status for SessionSetup1 response: 0x%x\n", ssres.Header.Status)
+	}
+	if ssres.SecurityBlob.SupportedMech.Equal(gss.NtLmSSPMechTypeOid) {
+		challenge := ntlmssp.NewChallenge()
+		if err = encoder.Unmarshal(ssres.SecurityBlob.ResponseToken, &challenge); err != nil {
+			return
+		}
+		res.TargetInfo = newTargetInfo(&challenge)
+	}
+	return
+}
+
+// dialProbe connects to host and sets the deadline of the probe on the
+// connection
+func dialProbe(host string, opts *ProbeOptions) (conn net.Conn, addr string, err error) {
+	if opts.Port == 0 {
+		opts.Port = 445
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultProbeTimeout
+	}
+	deadline := time.Now().Add(opts.Timeout)
+	addr = net.JoinHostPort(host, fmt.Sprint(opts.Port))
+
+	if opts.ProxyDialer != nil {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		conn, err = opts.ProxyDialer.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, opts.Timeout)
+	}
+	if err != nil {
+		return
+	}
+	if err = conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+	return
+}
+
+// ProbeSMB1 connects to host and offers only the NT LM 0.12 dialect in a
+// SMB1 NEGOTIATE request to determine whether the server still accepts SMB1.
+// Servers with SMB1 disabled either reject the dialect or close the
+// connection, which is reported as false rather than as an error. The
+// Dialects of opts are ignored.
+func ProbeSMB1(host string, opts ProbeOptions) (enabled bool, err error) {
+	conn, _, err := dialProbe(host, &opts)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	s := &Session{}
+	req, err := s.NewSMB1NegotiateReq()
+	if err != nil {
+		return
+	}
+	req.Dialects = []SMB1Dialect{{BufferFormat: 0x2, DialectString: "NT LM 0.12\x00"}}
+	buf, err := encoder.Marshal(&req)
+	if err != nil {
+		return
+	}
+	pkt := net.Buffers{binary.BigEndian.AppendUint32(make([]byte, 0, 4), uint32(len(buf))), buf}
+	if _, err = pkt.WriteTo(conn); err != nil {
+		return
+	}
+
+	packet, err := readPacket(conn)
+	if err != nil {
+		// The connection is dropped by servers that don't speak SMB1
+		log.Debugln(err)
+		return false, nil
+	}
+	defer encoder.PutBuffer(packet)
+	// SMB1 header of 32 bytes, WordCount and DialectIndex
+	if len(packet) < 35 || string(packet[:4]) != ProtocolSmb {
+		return false, nil
+	}
+	status := binary.LittleEndian.Uint32(packet[5:9])
+	dialectIndex := binary.LittleEndian.Uint16(packet[33:35])
+	return status == StatusOk && packet[32] != 0 && dialectIndex == 0, nil
+}
@@ -0,0 +1,210 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ericblavier/go-smb/gss"
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/ntlmssp"
+	"github.com/ericblavier/go-smb/smb/encoder"
+	"github.com/jfjallid/gofork/encoding/asn1"
+)
+
+func TestProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	guid := []byte("0123456789abcdef")
+	ec, err := encoder.Marshal(&EncryptionContext{CipherCount: 1, Ciphers: []uint16{AES128GCM}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := NewNegotiateRes()
+	res.Header.ProtocolID = []byte(ProtocolSmb2)
+	res.Header.StructureSize = 64
+	res.Header.Command = CommandNegotiate
+	res.Header.Signature = make([]byte, 16)
+	res.StructureSize = 65
+	res.SecurityMode = SecurityModeSigningEnabled | SecurityModeSigningRequired
+	res.DialectRevision = DialectSmb_3_1_1
+	res.ServerGuid = guid
+	res.MaxReadSize = 8388608
+	res.SecurityBlob = &gss.NegTokenInit{
+		OID:  gss.SpnegoOid,
+		Data: gss.NegTokenInitData{MechTypes: []asn1.ObjectIdentifier{gss.NtLmSSPMechTypeOid}},
+	}
+	res.NegotiateContextCount = 1
+	res.ContextList = []NegContext{{ContextType: EncryptionCapabilities, DataLength: uint16(len(ec)), Data: ec}}
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf, err := readTestFrame(conn)
+		if err != nil {
+			return
+		}
+		var req NegotiateReq
+		if err = req.UnmarshalBinary(buf, nil); err != nil || req.DialectCount != 5 {
+			return
+		}
+		writeTestFrame(conn, &res)
+	}()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	r, err := Probe("127.0.0.1", ProbeOptions{Port: port, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Dialect != DialectSmb_3_1_1 || !r.SigningRequired || r.Cipher != AES128GCM || !r.EncryptionSupported {
+		t.Fatalf("Fail: %+v", r)
+	}
+	if !bytes.Equal(r.ServerGuid, guid) || r.MaxReadSize != 8388608 {
+		t.Fatal("Fail")
+	}
+
+	// Nothing listening
+	l.Close()
+	if _, err = Probe("127.0.0.1", ProbeOptions{Port: port, Timeout: time.Second}); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	neg := NewNegotiateRes()
+	neg.Header.ProtocolID = []byte(ProtocolSmb2)
+	neg.Header.StructureSize = 64
+	neg.Header.Command = CommandNegotiate
+	neg.Header.Signature = make([]byte, 16)
+	neg.StructureSize = 65
+	neg.SecurityMode = SecurityModeSigningEnabled
+	neg.DialectRevision = DialectSmb_2_1
+	neg.ServerGuid = make([]byte, 16)
+	serverTime := time.Now().Add(10 * time.Minute)
+	neg.SystemTime = msdtyp.TimeToFiletime(serverTime)
+	neg.SecurityBlob = &gss.NegTokenInit{
+		OID:  gss.SpnegoOid,
+		Data: gss.NegTokenInitData{MechTypes: []asn1.ObjectIdentifier{gss.NtLmSSPMechTypeOid}},
+	}
+
+	challenge := ntlmssp.NewChallenge()
+	// Windows 10.0 build 20348
+	challenge.Version = 10 | 20348<<16 | 15<<56
+	challenge.TargetInfo = &ntlmssp.AvPairSlice{
+		{AvID: ntlmssp.MsvAvNbComputerName, Value: encoder.ToUnicode("FS01")},
+		{AvID: ntlmssp.MsvAvNbDomainName, Value: encoder.ToUnicode("CORP")},
+		{AvID: ntlmssp.MsvAvDnsDomainName, Value: encoder.ToUnicode("corp.local")},
+		{AvID: ntlmssp.MsvAvEOL},
+	}
+	token, err := encoder.Marshal(&challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, err := NewSessionSetup1Res()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.Command = CommandSessionSetup
+	ss.Status = StatusMoreProcessingRequired
+	ss.MessageID = 1
+	ss.SecurityBlob.State = gss.GssStateAcceptIncomplete
+	ss.SecurityBlob.SupportedMech = gss.NtLmSSPMechTypeOid
+	ss.SecurityBlob.ResponseToken = token
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err = readTestFrame(conn); err != nil {
+			return
+		}
+		writeTestFrame(conn, &neg)
+		buf, err := readTestFrame(conn)
+		if err != nil || binary.LittleEndian.Uint16(buf[12:14]) != CommandSessionSetup {
+			return
+		}
+		writeTestFrame(conn, &ss)
+	}()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	r, err := Fingerprint("127.0.0.1", ProbeOptions{Port: port, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Dialect != DialectSmb_2_1 || r.SigningRequired || r.TargetInfo == nil {
+		t.Fatalf("Fail: %+v", r)
+	}
+	if r.TargetInfo.NBComputerName != "FS01" || r.TargetInfo.NBDomainName != "CORP" || r.TargetInfo.DnsDomainName != "corp.local" {
+		t.Fatalf("Fail: %+v", r.TargetInfo)
+	}
+	if r.TargetInfo.GuessedOSVersion != "Windows NT 10.0 Build 20348" {
+		t.Fatalf("Fail: %s", r.TargetInfo.GuessedOSVersion)
+	}
+	if r.ClockSkew < 9*time.Minute || r.ClockSkew > 11*time.Minute {
+		t.Fatalf("Fail: %s", r.ClockSkew)
+	}
+}
+
+func TestProbeSMB1(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// SMB1 header followed by WordCount and DialectIndex
+	res := make([]byte, 35)
+	copy(res, ProtocolSmb)
+	res[4] = 0x72
+	res[32] = 17
+	serve := func(reply []byte) {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err = readTestFrame(conn); err != nil || reply == nil {
+			return
+		}
+		conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(reply))), reply...))
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	opts := ProbeOptions{Port: port, Timeout: 5 * time.Second}
+
+	go serve(res)
+	enabled, err := ProbeSMB1("127.0.0.1", opts)
+	if err != nil || !enabled {
+		t.Fatal("Fail")
+	}
+
+	// Dialect rejected
+	rejected := append([]byte(nil), res...)
+	rejected[33], rejected[34] = 0xff, 0xff
+	go serve(rejected)
+	if enabled, err = ProbeSMB1("127.0.0.1", opts); err != nil || enabled {
+		t.Fatal("Fail")
+	}
+
+	// Connection dropped
+	go serve(nil)
+	if enabled, err = ProbeSMB1("127.0.0.1", opts); err != nil || enabled {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,193 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"encoding/binary"
+	"slices"
+	"strings"
+)
+
+// Quirks are known divergences of a server from Windows that the client
+// works around. They are detected from the NEGOTIATE response and the NTLM
+// challenge and can be set in Options.Quirks for servers that are not
+// detected.
+type Quirks uint32
+
+const (
+	// The server is Samba
+	QuirkSamba Quirks = 1 << iota
+	// The server offers the SMB3 POSIX extensions, which the client never
+	// requests. The negotiate context is ignored.
+	QuirkUnixExtensions
+	// Read, write and transact sizes advertised above 8MiB are capped at
+	// 8MiB, the default of Samba, which rejects larger requests unless
+	// configured otherwise
+	QuirkCapMaxSizes
+	// CREATE reports a missing file with STATUS_NO_SUCH_FILE and a missing
+	// path with STATUS_NOT_A_DIRECTORY. They are mapped to the
+	// STATUS_OBJECT_NAME_NOT_FOUND and STATUS_OBJECT_PATH_NOT_FOUND returned
+	// by Windows.
+	QuirkNotFoundStatus
+	// The server requires signing but allows anonymous sessions, which
+	// can't sign, e.g., to connect to IPC$. Anonymous sessions continue
+	// unsigned rather than fail.
+	QuirkUnsignedAnonymous
+	// The server advertises a MaxTransactSize that is zero, below 64KiB or
+	// not a multiple of 4KiB, and fails larger QUERY_DIRECTORY and
+	// QUERY_INFO responses. Output buffers are limited to 64KiB, or the
+	// advertised size if smaller.
+	QuirkSmallTransact
+	// QUERY_INFO of an unsupported information class fails with
+	// STATUS_NOT_SUPPORTED, STATUS_NOT_IMPLEMENTED, STATUS_INVALID_PARAMETER
+	// or STATUS_INVALID_DEVICE_REQUEST. They are mapped to the
+	// STATUS_INVALID_INFO_CLASS returned by Windows.
+	QuirkInfoClassStatus
+	// Querying FileStreamInformation fails with one of the statuses of
+	// QuirkInfoClassStatus for files without named streams or for
+	// directories. File.Streams returns no streams rather than an error.
+	QuirkStreamsStatus
+)
+
+// QuirksNAS are the quirks of NAS servers such as NetApp, Isilon and EMC
+// that can't be detected from the NEGOTIATE response, to be set in
+// Options.Quirks
+const QuirksNAS = QuirkSmallTransact | QuirkInfoClassStatus | QuirkStreamsStatus
+
+// quirksSamba are the quirks of a server detected as Samba
+const quirksSamba = QuirkSamba | QuirkCapMaxSizes | QuirkNotFoundStatus | QuirkUnsignedAnonymous
+
+// Largest read, write and transact size with QuirkCapMaxSizes
+const quirkMaxSize = 8 * 1024 * 1024
+
+// SMB3 POSIX extensions negotiate context. Not part of MS-SMB2.
+const PosixExtensionsAvailable uint16 = 0x0100
+
+var quirkNames = []string{
+	"samba", "unix-extensions", "cap-max-sizes", "not-found-status", "unsigned-anonymous",
+	"small-transact", "info-class-status", "streams-status",
+}
+
+func (self Quirks) String() string {
+	var names []string
+	for i, name := range quirkNames {
+		if self&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// Quirks returns the quirks of the server that the connection works around,
+// both detected and set in Options.Quirks
+func (c *Connection) Quirks() Quirks {
+	return c.quirks | c.options.Quirks
+}
+
+// detectQuirks records detected quirks unless detection is disabled and
+// applies the ones affecting the negotiated sizes
+func (c *Connection) detectQuirks(q Quirks) {
+	if !c.options.DisableQuirkDetection {
+		c.quirks |= q
+	}
+	if c.Quirks()&QuirkCapMaxSizes != 0 {
+		c.maxReadSize = min(c.maxReadSize, quirkMaxSize)
+		c.maxWriteSize = min(c.maxWriteSize, quirkMaxSize)
+		c.maxTransactSize = min(c.maxTransactSize, quirkMaxSize)
+	}
+}
+
+// isSambaVersion reports whether the version of an NTLM challenge is the
+// one sent by Samba. Samba claims to be version 6.1 with build number 0,
+// which no release of Windows has.
+func isSambaVersion(version uint64) bool {
+	buf := binary.LittleEndian.AppendUint64(nil, version)
+	return buf[0] == 6 && buf[1] == 1 && binary.LittleEndian.Uint16(buf[2:4]) == 0
+}
+
+// createStatus returns the status of a failed CREATE as Windows would have
+// reported it
+func (c *Connection) createStatus(status uint32, createOpts uint32) uint32 {
+	if c.Quirks()&QuirkNotFoundStatus == 0 {
+		return status
+	}
+	switch {
+	case status == StatusNoSuchFile:
+		return StatusObjectNameNotFound
+	case status == StatusNotADirectory && createOpts&FileDirectoryFile == 0:
+		return StatusObjectPathNotFound
+	}
+	return status
+}
+
+// transactQuirks returns the quirks revealed by the MaxTransactSize of a
+// NEGOTIATE response
+func transactQuirks(maxTransactSize uint32) Quirks {
+	if maxTransactSize < 65536 || maxTransactSize%4096 != 0 {
+		return QuirkSmallTransact
+	}
+	return 0
+}
+
+// transactSize returns the output buffer size of QUERY_DIRECTORY and
+// QUERY_INFO requests
+func (c *Connection) transactSize() uint32 {
+	size := uint32(65536)
+	if c.supportsMultiCredit && c.Quirks()&QuirkSmallTransact == 0 {
+		size = c.maxTransactSize
+	}
+	if c.maxTransactSize > 0 {
+		size = min(size, c.maxTransactSize)
+	}
+	return size
+}
+
+// unsupportedInfoClassStatus are the statuses returned instead of
+// STATUS_INVALID_INFO_CLASS with QuirkInfoClassStatus
+var unsupportedInfoClassStatus = []uint32{StatusNotSupported, StatusNotImplemented, StatusInvalidParameter, FsctlStatusInvalidDeviceRequest}
+
+// queryInfoStatus returns the status of a failed QUERY_INFO as Windows
+// would have reported it
+func (c *Connection) queryInfoStatus(status uint32) uint32 {
+	if c.Quirks()&QuirkInfoClassStatus != 0 && slices.Contains(unsupportedInfoClassStatus, status) {
+		return StatusInvalidInfoClass
+	}
+	return status
+}
+
+// isUnsupportedInfoClass reports whether err is STATUS_INVALID_INFO_CLASS or
+// one of the statuses returned instead with QuirkInfoClassStatus
+func isUnsupportedInfoClass(err error) bool {
+	if err == StatusMap[StatusInvalidInfoClass] {
+		return true
+	}
+	for _, status := range unsupportedInfoClassStatus {
+		if err == StatusMap[status] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package smb
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+func TestIsSambaVersion(t *testing.T) {
+	// Version 6.1 build 0 with NTLM revision 15
+	if !isSambaVersion(0x0f00000000000106) {
+		t.Fatal("Fail")
+	}
+	// Windows Server 2022
+	if isSambaVersion(0x0f0000004f7c000a) || isSambaVersion(0) {
+		t.Fatal("Fail")
+	}
+	if s := (QuirkSamba | QuirkNotFoundStatus).String(); s != "samba|not-found-status" {
+		t.Fatalf("Fail: %s", s)
+	}
+}
+
+func TestDetectQuirks(t *testing.T) {
+	for _, v := range []struct {
+		opt      Options
+		detected Quirks
+		quirks   Quirks
+		size     uint32
+	}{
+		{Options{}, quirksSamba, quirksSamba, quirkMaxSize},
+		{Options{}, QuirkUnixExtensions, QuirkUnixExtensions, 16 << 20},
+		{Options{DisableQuirkDetection: true}, quirksSamba, 0, 16 << 20},
+		{Options{DisableQuirkDetection: true, Quirks: QuirkCapMaxSizes}, quirksSamba, QuirkCapMaxSizes, quirkMaxSize},
+	} {
+		c := &Connection{Session: &Session{options: v.opt, maxReadSize: 16 << 20, maxWriteSize: 16 << 20, maxTransactSize: 16 << 20}}
+		c.detectQuirks(v.detected)
+		if c.Quirks() != v.quirks || c.maxReadSize != v.size || c.maxWriteSize != v.size || c.maxTransactSize != v.size {
+			t.Fatalf("Fail: %s %d", c.Quirks(), c.maxReadSize)
+		}
+	}
+}
+
+func TestQuirkNotFoundStatus(t *testing.T) {
+	for _, v := range []struct {
+		quirks     Quirks
+		createOpts uint32
+		status     uint32
+		expected   uint32
+	}{
+		{0, 0, StatusNoSuchFile, StatusNoSuchFile},
+		{QuirkNotFoundStatus, 0, StatusNoSuchFile, StatusObjectNameNotFound},
+		{QuirkNotFoundStatus, 0, StatusNotADirectory, StatusObjectPathNotFound},
+		{QuirkNotFoundStatus, FileDirectoryFile, StatusNotADirectory, StatusNotADirectory},
+		{QuirkNotFoundStatus, 0, StatusAccessDenied, StatusAccessDenied},
+	} {
+		c, server := newTestConnection(t, Options{Quirks: v.quirks})
+		go func() {
+			buf, err := readTestFrame(server)
+			if err != nil {
+				return
+			}
+			var h Header
+			if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+				return
+			}
+			res := Header{
+				ProtocolID:    []byte(ProtocolSmb2),
+				StructureSize: 64,
+				Status:        v.status,
+				Command:       h.Command,
+				Credits:       1,
+				Flags:         SMB2_FLAGS_SERVER_TO_REDIR,
+				MessageID:     h.MessageID,
+				Signature:     make([]byte, 16),
+			}
+			writeTestFrame(server, &res)
+		}()
+		opts := NewCreateReqOpts()
+		opts.CreateOpts = v.createOpts
+		_, err := c.OpenFileExt("share", `dir\file.txt`, opts)
+		if err != StatusMap[v.expected] {
+			t.Fatalf("Fail: %+v", err)
+		}
+	}
+}
+
+func TestQuirkSmallTransact(t *testing.T) {
+	for _, v := range []struct {
+		maxTransactSize uint32
+		quirks          Quirks
+		size            uint32
+	}{
+		{8 << 20, 0, 8 << 20},
+		{0, QuirkSmallTransact, 65536},
+		{65535, QuirkSmallTransact, 65535},
+		{(1 << 20) + 512, QuirkSmallTransact, 65536},
+	} {
+		c := &Connection{Session: &Session{supportsMultiCredit: true, maxTransactSize: v.maxTransactSize}}
+		c.detectQuirks(transactQuirks(v.maxTransactSize))
+		if c.Quirks() != v.quirks || c.transactSize() != v.size {
+			t.Fatalf("Fail: %s %d", c.Quirks(), c.transactSize())
+		}
+	}
+}
+
+// serveQueryInfo answers QUERY_INFO requests with the status and output
+func serveQueryInfo(server net.Conn, status uint32, output []byte) {
+	for {
+		buf, err := readTestFrame(server)
+		if err != nil {
+			return
+		}
+		var h Header
+		if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+			return
+		}
+		hdr := Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Status:        status,
+			Command:       h.Command,
+			Credits:       1,
+			Flags:         SMB2_FLAGS_SERVER_TO_REDIR,
+			MessageID:     h.MessageID,
+			Signature:     make([]byte, 16),
+		}
+		var res interface{} = &hdr
+		if status == StatusOk {
+			res = &QueryInfoRes{Header: hdr, StructureSize: 9, OutputBufferOffset: 72, OutputBufferLength: uint32(len(output)), Buffer: output}
+		}
+		if err = writeTestFrame(server, res); err != nil {
+			return
+		}
+	}
+}
+
+func newStreamInfo(name string, size uint64, last bool) []byte {
+	u := encoder.ToUnicode(name)
+	buf := make([]byte, 24, 24+len(u)+8)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(u)))
+	binary.LittleEndian.PutUint64(buf[8:], size)
+	binary.LittleEndian.PutUint64(buf[16:], size)
+	buf = append(buf, u...)
+	buf = append(buf, make([]byte, (8-len(buf)%8)%8)...)
+	if !last {
+		binary.LittleEndian.PutUint32(buf, uint32(len(buf)))
+	}
+	return buf
+}
+
+func TestStreams(t *testing.T) {
+	output := append(newStreamInfo("::$DATA", 10, false), newStreamInfo(":zone:$DATA", 26, true)...)
+	c, server := newTestConnection(t, Options{})
+	go serveQueryInfo(server, StatusOk, output)
+	f := &File{Connection: c, share: "share", fd: make([]byte, 16)}
+	streams, err := f.Streams()
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if len(streams) != 2 || streams[0] != (FileStream{"::$DATA", 10, 10}) || streams[1].Name != ":zone:$DATA" || streams[1].Size != 26 {
+		t.Fatalf("Fail: %+v", streams)
+	}
+	if _, err = parseFileStreams(output[:30]); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestQuirkInfoClassStatus(t *testing.T) {
+	for _, v := range []struct {
+		quirks   Quirks
+		status   uint32
+		expected error
+		streams  error
+	}{
+		{0, StatusInvalidInfoClass, StatusMap[StatusInvalidInfoClass], StatusMap[StatusInvalidInfoClass]},
+		{0, StatusNotSupported, StatusMap[StatusNotSupported], StatusMap[StatusNotSupported]},
+		{QuirkInfoClassStatus, StatusNotSupported, StatusMap[StatusInvalidInfoClass], StatusMap[StatusInvalidInfoClass]},
+		{QuirksNAS, StatusInvalidParameter, StatusMap[StatusInvalidInfoClass], nil},
+		{QuirksNAS, StatusAccessDenied, StatusMap[StatusAccessDenied], StatusMap[StatusAccessDenied]},
+	} {
+		c, server := newTestConnection(t, Options{Quirks: v.quirks})
+		go serveQueryInfo(server, v.status, nil)
+		f := &File{Connection: c, share: "share", fd: make([]byte, 16)}
+		if _, err := f.QueryInfo(OInfoFile, FileNetworkOpenInformation, 1024); err != v.expected {
+			t.Fatalf("Fail: %+v", err)
+		}
+		if streams, err := f.Streams(); err != v.streams || streams != nil {
+			t.Fatalf("Fail: %+v", err)
+		}
+	}
+}
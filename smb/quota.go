@@ -0,0 +1,218 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+// Special values of the QuotaThreshold and QuotaLimit of a QuotaEntry
+const (
+	QuotaNoLimit     uint64 = 0xffffffffffffffff // No threshold or limit
+	QuotaRemoveEntry uint64 = 0xfffffffffffffffe // Limit removing the quota entry of the user
+)
+
+// QuotaEntry is the FILE_QUOTA_INFORMATION of MS-FSCC Section 2.4.36,
+// the disk usage and limits of a user on a volume
+type QuotaEntry struct {
+	SID            *msdtyp.SID
+	ChangeTime     time.Time // Last change of the entry. Ignored by SetQuota
+	QuotaUsed      uint64    // Bytes used by the files of the user. Ignored by SetQuota
+	QuotaThreshold uint64    // Bytes above which a warning is logged, QuotaNoLimit for none
+	QuotaLimit     uint64    // Bytes above which writes fail, QuotaNoLimit for none
+}
+
+// Size of the fixed part of FILE_QUOTA_INFORMATION
+const quotaEntrySize = 40
+
+// align8 returns n rounded up to a multiple of 8
+func align8(n int) int {
+	return (n + 7) &^ 7
+}
+
+// marshalQuotaEntries encodes a list of FILE_QUOTA_INFORMATION entries, each
+// aligned on 8 bytes
+func marshalQuotaEntries(entries []QuotaEntry) ([]byte, error) {
+	var buf []byte
+	for i, e := range entries {
+		if e.SID == nil {
+			return nil, fmt.Errorf("Missing SID of quota entry %d", i)
+		}
+		sid, err := e.SID.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		start := len(buf)
+		var next uint32
+		if i < len(entries)-1 {
+			next = uint32(align8(quotaEntrySize + len(sid)))
+		}
+		var changeTime uint64
+		if !e.ChangeTime.IsZero() {
+			changeTime = msdtyp.TimeToFiletime(e.ChangeTime)
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, next)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(sid)))
+		buf = binary.LittleEndian.AppendUint64(buf, changeTime)
+		buf = binary.LittleEndian.AppendUint64(buf, e.QuotaUsed)
+		buf = binary.LittleEndian.AppendUint64(buf, e.QuotaThreshold)
+		buf = binary.LittleEndian.AppendUint64(buf, e.QuotaLimit)
+		buf = append(buf, sid...)
+		if next != 0 {
+			buf = append(buf, make([]byte, start+int(next)-len(buf))...)
+		}
+	}
+	return buf, nil
+}
+
+// parseQuotaEntries decodes a list of FILE_QUOTA_INFORMATION entries
+func parseQuotaEntries(buf []byte) (entries []QuotaEntry, err error) {
+	if len(buf) == 0 {
+		return
+	}
+	for offset := 0; ; {
+		if len(buf)-offset < quotaEntrySize {
+			return nil, fmt.Errorf("Buffer too small for FILE_QUOTA_INFORMATION")
+		}
+		entry := buf[offset:]
+		next := binary.LittleEndian.Uint32(entry)
+		sidLength := int(binary.LittleEndian.Uint32(entry[4:]))
+		if sidLength > len(entry)-quotaEntrySize {
+			return nil, fmt.Errorf("Invalid SID length %d of FILE_QUOTA_INFORMATION", sidLength)
+		}
+		e := QuotaEntry{
+			QuotaUsed:      binary.LittleEndian.Uint64(entry[16:]),
+			QuotaThreshold: binary.LittleEndian.Uint64(entry[24:]),
+			QuotaLimit:     binary.LittleEndian.Uint64(entry[32:]),
+		}
+		if changeTime := binary.LittleEndian.Uint64(entry[8:]); changeTime != 0 {
+			e.ChangeTime = msdtyp.FiletimeToTime(changeTime)
+		}
+		if e.SID, err = msdtyp.ReadSID(bytes.NewReader(entry[quotaEntrySize : quotaEntrySize+sidLength])); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+		if next == 0 {
+			break
+		}
+		if int(next) < quotaEntrySize || int(next) > len(entry) {
+			return nil, fmt.Errorf("Invalid NextEntryOffset %d of FILE_QUOTA_INFORMATION", next)
+		}
+		offset += int(next)
+	}
+	return
+}
+
+// newQueryQuotaInfo returns the SMB2_QUERY_QUOTA_INFO of MS-SMB2 Section
+// 2.2.37.1 querying the entries of sids, or all entries without sids
+func newQueryQuotaInfo(restartScan bool, sids []*msdtyp.SID) ([]byte, error) {
+	// FILE_GET_QUOTA_INFORMATION entries of MS-FSCC Section 2.4.37.1
+	var sidList []byte
+	for i, sid := range sids {
+		buf, err := sid.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		start := len(sidList)
+		var next uint32
+		if i < len(sids)-1 {
+			next = uint32(align8(8 + len(buf)))
+		}
+		sidList = binary.LittleEndian.AppendUint32(sidList, next)
+		sidList = binary.LittleEndian.AppendUint32(sidList, uint32(len(buf)))
+		sidList = append(sidList, buf...)
+		if next != 0 {
+			sidList = append(sidList, make([]byte, start+int(next)-len(sidList))...)
+		}
+	}
+	var restart byte
+	if restartScan {
+		restart = 1
+	}
+	// ReturnSingle, RestartScan and Reserved
+	req := []byte{0, restart, 0, 0}
+	req = binary.LittleEndian.AppendUint32(req, uint32(len(sidList)))
+	// No StartSid as the scan is restarted or continued
+	req = binary.LittleEndian.AppendUint32(req, 0)
+	req = binary.LittleEndian.AppendUint32(req, 0)
+	return append(req, sidList...), nil
+}
+
+// QueryQuota returns the quota entries of the users of sids on the volume of
+// the file, or of all users with an entry without sids. Servers not tracking
+// quotas fail with FsctlStatusInvalidDeviceRequest or StatusNotSupported.
+func (f *File) QueryQuota(sids ...*msdtyp.SID) (entries []QuotaEntry, err error) {
+	for restart := true; ; restart = false {
+		var input, buf []byte
+		if input, err = newQueryQuotaInfo(restart, sids); err != nil {
+			return
+		}
+		buf, err = f.queryInfo(OInfoQuota, 0, f.transactSize(), input)
+		if err == StatusMap[StatusNoMoreEntries] {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if len(buf) == 0 {
+			return
+		}
+		var page []QuotaEntry
+		if page, err = parseQuotaEntries(buf); err != nil {
+			return nil, err
+		}
+		entries = append(entries, page...)
+		if len(sids) > 0 {
+			// All requested entries are returned at once
+			return
+		}
+	}
+}
+
+// SetQuota creates, changes or with a QuotaLimit of QuotaRemoveEntry
+// removes the quota entries of users on the volume of the file, which must
+// be opened with FAccMaskFileWriteData. Setting quotas requires
+// administrative rights on the server.
+func (f *File) SetQuota(entries ...QuotaEntry) error {
+	buf, err := marshalQuotaEntries(entries)
+	if err != nil {
+		return err
+	}
+	return f.SetInfo(OInfoQuota, 0, buf)
+}
+
+// OpenQuota opens the root of a share to query and, if write is set, to
+// set the quotas of its volume
+func (s *Connection) OpenQuota(share string, write bool) (*File, error) {
+	opts := s.createReqOpts()
+	opts.DesiredAccess = FAccMaskFileReadData | FAccMaskFileReadAttributes | FAccMaskSynchronize
+	if write {
+		opts.DesiredAccess |= FAccMaskFileWriteData
+	}
+	opts.ShareAccess = FileShareRead | FileShareWrite | FileShareDelete
+	opts.CreateOpts = FileDirectoryFile
+	return s.OpenFileExt(share, "", opts)
+}
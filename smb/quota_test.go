@@ -0,0 +1,139 @@
+package smb
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// serveQuota answers the quota requests of a volume with the entries,
+// keyed by SID
+func serveQuota(server net.Conn, entries map[string]QuotaEntry) {
+	for {
+		buf, err := readTestFrame(server)
+		if err != nil {
+			return
+		}
+		var h Header
+		if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+			return
+		}
+		hdr := Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       h.Command,
+			Credits:       1,
+			Flags:         SMB2_FLAGS_SERVER_TO_REDIR,
+			MessageID:     h.MessageID,
+			Signature:     make([]byte, 16),
+		}
+		var res interface{}
+		switch h.Command {
+		case CommandCreate:
+			res = &CreateRes{Header: hdr, StructureSize: 89, FileId: make([]byte, 16)}
+		case CommandQueryInfo:
+			offset := binary.LittleEndian.Uint16(buf[72:])
+			if buf[66] != OInfoQuota || offset == 0 || buf[offset+1] == 0 {
+				// Only a restarted scan returns entries
+				hdr.Status = StatusNoMoreEntries
+				res = &QueryInfoRes{Header: hdr, StructureSize: 9, Buffer: []byte{0}}
+				break
+			}
+			var list []QuotaEntry
+			for _, e := range entries {
+				list = append(list, e)
+			}
+			out, _ := marshalQuotaEntries(list)
+			res = &QueryInfoRes{Header: hdr, StructureSize: 9, OutputBufferOffset: 72, OutputBufferLength: uint32(len(out)), Buffer: out}
+		case CommandSetInfo:
+			var req SetInfoReq
+			if err = encoder.Unmarshal(buf, &req); err != nil || req.InfoType != OInfoQuota {
+				return
+			}
+			list, err := parseQuotaEntries(req.Buffer)
+			if err != nil {
+				return
+			}
+			for _, e := range list {
+				if e.QuotaLimit == QuotaRemoveEntry {
+					delete(entries, e.SID.String())
+					continue
+				}
+				e.ChangeTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+				entries[e.SID.String()] = e
+			}
+			res = &SetInfoRes{Header: hdr, StructureSize: 2}
+		case CommandClose:
+			res = &CloseRes{Header: hdr, StructureSize: 60}
+		}
+		if err = writeTestFrame(server, res); err != nil {
+			return
+		}
+	}
+}
+
+func TestQuotaEntries(t *testing.T) {
+	alice, _ := msdtyp.ParseSID("S-1-5-21-1-2-3-1001")
+	bob, _ := msdtyp.ParseSID("S-1-5-21-1-2-3-1002")
+	entries := []QuotaEntry{
+		{SID: alice, QuotaUsed: 10, QuotaThreshold: 1 << 20, QuotaLimit: 2 << 20, ChangeTime: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{SID: bob, QuotaThreshold: QuotaNoLimit, QuotaLimit: QuotaNoLimit},
+	}
+	buf, err := marshalQuotaEntries(entries)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	// 40 bytes and a SID of 28 bytes, aligned on 8
+	if binary.LittleEndian.Uint32(buf) != 72 || len(buf) != 72+68 {
+		t.Fatalf("Fail: %x", buf)
+	}
+	parsed, err := parseQuotaEntries(buf)
+	if err != nil || len(parsed) != 2 {
+		t.Fatalf("Fail: %+v %v", parsed, err)
+	}
+	for i := range entries {
+		if parsed[i].SID.String() != entries[i].SID.String() || parsed[i].QuotaUsed != entries[i].QuotaUsed ||
+			parsed[i].QuotaThreshold != entries[i].QuotaThreshold || parsed[i].QuotaLimit != entries[i].QuotaLimit ||
+			!parsed[i].ChangeTime.Equal(entries[i].ChangeTime) {
+			t.Fatalf("Fail: %+v", parsed[i])
+		}
+	}
+	if _, err = parseQuotaEntries(buf[:50]); err == nil {
+		t.Fatal("Fail")
+	}
+	if _, err = marshalQuotaEntries([]QuotaEntry{{}}); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestSetQuota(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.credits.Store(100)
+	c.maxTransactSize = 65536
+	alice, _ := msdtyp.ParseSID("S-1-5-21-1-2-3-1001")
+	bob, _ := msdtyp.ParseSID("S-1-5-21-1-2-3-1002")
+	volume := map[string]QuotaEntry{
+		bob.String(): {SID: bob, QuotaUsed: 100, QuotaThreshold: QuotaNoLimit, QuotaLimit: QuotaNoLimit},
+	}
+	go serveQuota(server, volume)
+
+	f, err := c.OpenQuota("share", true)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer f.CloseFile()
+	if err = f.SetQuota(QuotaEntry{SID: alice, QuotaThreshold: 1 << 30, QuotaLimit: 2 << 30}, QuotaEntry{SID: bob, QuotaLimit: QuotaRemoveEntry}); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	entries, err := f.QueryQuota()
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if len(entries) != 1 || entries[0].SID.String() != alice.String() || entries[0].QuotaLimit != 2<<30 || entries[0].ChangeTime.IsZero() {
+		t.Fatalf("Fail: %+v", entries)
+	}
+}
@@ -0,0 +1,257 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package rap implements the share and server enumeration of the Remote
+// Administration Protocol (MS-RAP) for devices that only speak SMB1 and lack
+// the srvsvc RPC interface.
+package rap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/jfjallid/golog"
+)
+
+var (
+	log                  = golog.Get("github.com/ericblavier/go-smb/smb/rap")
+	le  binary.ByteOrder = binary.LittleEndian
+)
+
+// MS-RAP Section 2.5.1 RAP opcodes
+const (
+	OpNetShareEnum   uint16 = 0
+	OpNetServerEnum2 uint16 = 104
+)
+
+// MS-RAP Section 2.5.14 Share types of NetShareInfo1
+const (
+	ShareTypeDisk       uint16 = 0
+	ShareTypePrintQueue uint16 = 1
+	ShareTypeDevice     uint16 = 2
+	ShareTypeIPC        uint16 = 3
+)
+
+// MS-RAP Section 2.5.5.2.1 Server types of NetServerEnum2
+const (
+	ServerTypeWorkstation      uint32 = 0x00000001
+	ServerTypeServer           uint32 = 0x00000002
+	ServerTypeSQLServer        uint32 = 0x00000004
+	ServerTypeDomainCtrl       uint32 = 0x00000008
+	ServerTypeDomainBakCtrl    uint32 = 0x00000010
+	ServerTypeTimeSource       uint32 = 0x00000020
+	ServerTypeAFP              uint32 = 0x00000040
+	ServerTypeNovell           uint32 = 0x00000080
+	ServerTypeDomainMember     uint32 = 0x00000100
+	ServerTypePrintQServer     uint32 = 0x00000200
+	ServerTypeDialin           uint32 = 0x00000400
+	ServerTypeXenix            uint32 = 0x00000800
+	ServerTypeNT               uint32 = 0x00001000
+	ServerTypeWFW              uint32 = 0x00002000
+	ServerTypeServerNT         uint32 = 0x00008000
+	ServerTypePotentialBrowser uint32 = 0x00010000
+	ServerTypeBackupBrowser    uint32 = 0x00020000
+	ServerTypeMasterBrowser    uint32 = 0x00040000
+	ServerTypeDomainMaster     uint32 = 0x00080000
+	ServerTypeLocalListOnly    uint32 = 0x40000000
+	ServerTypeDomainEnum       uint32 = 0x80000000
+	ServerTypeAll              uint32 = 0xffffffff
+)
+
+// Win32 status codes of RAP responses
+const (
+	ErrorSuccess          uint16 = 0
+	ErrorAccessDenied     uint16 = 5
+	ErrorNotSupported     uint16 = 50
+	ErrorInvalidParameter uint16 = 87
+	ErrorInvalidLevel     uint16 = 124
+	ErrorMoreData         uint16 = 234
+	NerrBrowserNotStarted uint16 = 2114
+)
+
+var errorNames = map[uint16]string{
+	ErrorAccessDenied:     "ERROR_ACCESS_DENIED",
+	ErrorNotSupported:     "ERROR_NOT_SUPPORTED",
+	ErrorInvalidParameter: "ERROR_INVALID_PARAMETER",
+	ErrorInvalidLevel:     "ERROR_INVALID_LEVEL",
+	ErrorMoreData:         "ERROR_MORE_DATA",
+	NerrBrowserNotStarted: "NERR_BrowserNotStarted",
+}
+
+// Error is the Win32 status of a failed RAP request
+type Error uint16
+
+func (self Error) Error() string {
+	if name, ok := errorNames[uint16(self)]; ok {
+		return "RAP request failed with " + name
+	}
+	return fmt.Sprintf("RAP request failed with status %d", uint16(self))
+}
+
+// Size of the receive buffer of the requests
+const receiveBufferSize uint16 = 0xffff
+
+// MS-RAP Section 2.5.14.2 NetShareInfo1 without its padding
+type ShareInfo1 struct {
+	Name    string
+	Type    uint16
+	Comment string
+}
+
+// MS-RAP Section 2.5.5.2.1 NetServerInfo1
+type ServerInfo1 struct {
+	Name         string
+	MajorVersion uint8
+	MinorVersion uint8
+	Type         uint32
+	Comment      string
+}
+
+type transport interface {
+	// Transact sends the parameters and data of a request and returns those
+	// of the response
+	Transact(params, data []byte, maxParams, maxData uint16) ([]byte, []byte, error)
+}
+
+// Client sends RAP requests
+type Client struct {
+	t transport
+}
+
+// NewClient returns a client sending requests over the \PIPE\LANMAN
+// transactions of s
+func NewClient(s *smb.LanmanSession) *Client {
+	return &Client{t: s}
+}
+
+// newRequest encodes the opcode, descriptors and level of a request
+func newRequest(opcode uint16, paramDesc, dataDesc string, level uint16) *bytes.Buffer {
+	var w bytes.Buffer
+	binary.Write(&w, le, opcode)
+	w.WriteString(paramDesc + "\x00")
+	w.WriteString(dataDesc + "\x00")
+	binary.Write(&w, le, level)
+	binary.Write(&w, le, receiveBufferSize)
+	return &w
+}
+
+// enum sends an enumeration request and returns the entries of the
+// response, the size of each being entrySize, and the converter of its
+// pointers. ERROR_MORE_DATA is returned with the entries that fit.
+func (self *Client) enum(params []byte, entrySize int) (data []byte, count int, converter uint16, err error) {
+	resParams, data, err := self.t.Transact(params, nil, 8, receiveBufferSize)
+	if err != nil {
+		return
+	}
+	if len(resParams) < 8 {
+		if len(resParams) >= 2 && le.Uint16(resParams) != ErrorSuccess {
+			return nil, 0, 0, Error(le.Uint16(resParams))
+		}
+		return nil, 0, 0, fmt.Errorf("RAP response parameters too short")
+	}
+	status := le.Uint16(resParams)
+	converter = le.Uint16(resParams[2:])
+	count = int(le.Uint16(resParams[4:]))
+	if status != ErrorSuccess && status != ErrorMoreData {
+		return nil, 0, 0, Error(status)
+	}
+	if count*entrySize > len(data) {
+		return nil, 0, 0, fmt.Errorf("RAP response data too short for %d entries", count)
+	}
+	if status == ErrorMoreData {
+		log.Debugf("Only %d of %d entries fit in the receive buffer\n", count, le.Uint16(resParams[6:]))
+		err = Error(status)
+	}
+	return
+}
+
+// fixedString decodes a null padded OEM string
+func fixedString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// pointerString decodes the null terminated OEM string a pointer of the
+// response data refers to. Only the low 16 bits of the pointer minus the
+// converter are meaningful.
+func pointerString(data []byte, ptr uint32, converter uint16) string {
+	offset := int(uint16(ptr) - converter)
+	if ptr == 0 || offset >= len(data) {
+		return ""
+	}
+	return fixedString(data[offset:])
+}
+
+// NetShareEnum lists the shares of the server. When the list does not fit
+// in a response, the shares that fit are returned with ERROR_MORE_DATA.
+func (self *Client) NetShareEnum() (shares []ShareInfo1, err error) {
+	w := newRequest(OpNetShareEnum, "WrLeh", "B13BWz", 1)
+	data, count, converter, err := self.enum(w.Bytes(), 20)
+	if err != nil && err != Error(ErrorMoreData) {
+		return
+	}
+	for i := 0; i < count; i++ {
+		entry := data[i*20:]
+		shares = append(shares, ShareInfo1{
+			Name:    fixedString(entry[:13]),
+			Type:    le.Uint16(entry[14:]),
+			Comment: pointerString(data, le.Uint32(entry[16:]), converter),
+		})
+	}
+	return
+}
+
+// NetServerEnum2 lists the servers of the given types known to the browser
+// of the domain, or of the primary domain of the server when domain is
+// empty. ServerTypeDomainEnum lists the domains instead. When the list does
+// not fit in a response, the servers that fit are returned with
+// ERROR_MORE_DATA.
+func (self *Client) NetServerEnum2(serverType uint32, domain string) (servers []ServerInfo1, err error) {
+	paramDesc := "WrLehDO"
+	if domain != "" {
+		paramDesc = "WrLehDz"
+	}
+	w := newRequest(OpNetServerEnum2, paramDesc, "B16BBDz", 1)
+	binary.Write(w, le, serverType)
+	if domain != "" {
+		w.WriteString(domain + "\x00")
+	}
+	data, count, converter, err := self.enum(w.Bytes(), 26)
+	if err != nil && err != Error(ErrorMoreData) {
+		return
+	}
+	for i := 0; i < count; i++ {
+		entry := data[i*26:]
+		servers = append(servers, ServerInfo1{
+			Name:         fixedString(entry[:16]),
+			MajorVersion: entry[16],
+			MinorVersion: entry[17],
+			Type:         le.Uint32(entry[18:]),
+			Comment:      pointerString(data, le.Uint32(entry[22:]), converter),
+		})
+	}
+	return
+}
@@ -0,0 +1,81 @@
+package rap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+type fakeTransport struct {
+	params    []byte // Parameters of the last request
+	resParams []byte
+	resData   []byte
+}
+
+func (self *fakeTransport) Transact(params, data []byte, maxParams, maxData uint16) ([]byte, []byte, error) {
+	self.params = params
+	return self.resParams, self.resData, nil
+}
+
+// newResponse returns the parameters of a response
+func newResponse(status, converter, count uint16) []byte {
+	params := binary.LittleEndian.AppendUint16(nil, status)
+	params = binary.LittleEndian.AppendUint16(params, converter)
+	params = binary.LittleEndian.AppendUint16(params, count)
+	return binary.LittleEndian.AppendUint16(params, count+1)
+}
+
+func TestNetShareEnum(t *testing.T) {
+	// The comment of PUBLIC follows the two entries
+	var data []byte
+	for _, share := range []struct {
+		name    string
+		typ     uint16
+		comment uint32
+	}{{"PUBLIC", ShareTypeDisk, 0x00011000 + 40}, {"IPC$", ShareTypeIPC, 0}} {
+		entry := make([]byte, 14)
+		copy(entry, share.name)
+		entry = binary.LittleEndian.AppendUint16(entry, share.typ)
+		data = append(data, binary.LittleEndian.AppendUint32(entry, share.comment)...)
+	}
+	data = append(data, "Public files\x00"...)
+
+	tr := &fakeTransport{resParams: newResponse(ErrorMoreData, 0x1000, 2), resData: data}
+	shares, err := (&Client{t: tr}).NetShareEnum()
+	if err != Error(ErrorMoreData) {
+		t.Fatalf("Fail: %v", err)
+	}
+	want := []ShareInfo1{{"PUBLIC", ShareTypeDisk, "Public files"}, {"IPC$", ShareTypeIPC, ""}}
+	if len(shares) != 2 || shares[0] != want[0] || shares[1] != want[1] {
+		t.Fatalf("Fail: %+v", shares)
+	}
+	if !bytes.HasPrefix(tr.params, []byte("\x00\x00WrLeh\x00B13BWz\x00\x01\x00")) {
+		t.Fatalf("Fail: %q", tr.params)
+	}
+}
+
+func TestNetServerEnum2(t *testing.T) {
+	entry := make([]byte, 16)
+	copy(entry, "NAS")
+	entry = append(entry, 4, 9)
+	entry = binary.LittleEndian.AppendUint32(entry, ServerTypeServer|ServerTypeWorkstation)
+	entry = binary.LittleEndian.AppendUint32(entry, 26)
+	entry = append(entry, "Old NAS\x00"...)
+
+	tr := &fakeTransport{resParams: newResponse(ErrorSuccess, 0, 1), resData: entry}
+	servers, err := (&Client{t: tr}).NetServerEnum2(ServerTypeAll, "WORKGROUP")
+	if err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+	if len(servers) != 1 || servers[0] != (ServerInfo1{"NAS", 4, 9, ServerTypeServer | ServerTypeWorkstation, "Old NAS"}) {
+		t.Fatalf("Fail: %+v", servers)
+	}
+	if !bytes.HasPrefix(tr.params, []byte("\x68\x00WrLehDz\x00B16BBDz\x00\x01\x00\xff\xff\xff\xff\xff\xffWORKGROUP\x00")) {
+		t.Fatalf("Fail: %q", tr.params)
+	}
+
+	tr.resParams = newResponse(NerrBrowserNotStarted, 0, 0)[:2]
+	if _, err = (&Client{t: tr}).NetServerEnum2(ServerTypeDomainEnum, ""); err != Error(NerrBrowserNotStarted) {
+		t.Fatalf("Fail: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// MS-SMB2 Section 2.2.19 Channel of READ and WRITE requests
+const (
+	ChannelNone             uint32 = 0x00000000
+	ChannelRdmaV1           uint32 = 0x00000001
+	ChannelRdmaV1Invalidate uint32 = 0x00000002
+	ChannelRdmaTransform    uint32 = 0x00000003
+)
+
+// Payloads up to this size are sent in the READ and WRITE messages as
+// registering memory for RDMA costs more than copying them
+const rdmaThreshold = 4096
+
+// RDMATransport is implemented by connections over which the server can
+// move the data of READ and WRITE requests with RDMA, such as the
+// connections of smbdirect.Dialer
+type RDMATransport interface {
+	// RegisterBuffer returns the buffer descriptors of buf for the channel
+	// info of a request. release is called once the response is received.
+	RegisterBuffer(buf []byte, remoteWrite bool) (descriptors []byte, release func(), err error)
+	MaxReadWriteSize() int
+}
+
+// rdmaTransport returns the transport to move a payload of size bytes with
+// RDMA, or nil if the payload is sent in the messages
+func (c *Connection) rdmaTransport(size int) RDMATransport {
+	t, ok := c.conn.(RDMATransport)
+	if !ok || size <= rdmaThreshold || c.dialect < DialectSmb_3_0 || t.MaxReadWriteSize() <= rdmaThreshold {
+		return nil
+	}
+	// Data moved with RDMA bypasses the encryption of the messages
+	if c.sessionFlags&SessionFlagEncryptData != 0 {
+		return nil
+	}
+	return t
+}
+
+// setRdmaReadChannel lets the server write the data of req directly to b
+func setRdmaReadChannel(req *ReadReq, t RDMATransport, b []byte) (release func(), err error) {
+	desc, release, err := t.RegisterBuffer(b, true)
+	if err != nil {
+		return
+	}
+	req.Channel = ChannelRdmaV1
+	req.ReadChannelInfoOffset = 0x70
+	req.ReadChannelInfoLength = uint16(len(desc))
+	req.Buffer = desc
+	return
+}
+
+// rdmaWriteReq is a WRITE request whose data is read by the server with
+// RDMA. The Buffer holds the buffer descriptors.
+type rdmaWriteReq struct {
+	WriteReq
+}
+
+// newRdmaWriteReq returns a WRITE request for the server to read data from
+// with RDMA
+func (f *File) newRdmaWriteReq(t RDMATransport, offset uint64, data []byte) (req *rdmaWriteReq, release func(), err error) {
+	desc, release, err := t.RegisterBuffer(data, false)
+	if err != nil {
+		return
+	}
+	w, err := f.NewWriteReq(f.share, f.fd, offset, nil)
+	if err != nil {
+		release()
+		return
+	}
+	// MS-SMB2 Section 3.2.4.7 The credits are charged for the data in RemainingBytes
+	w.CreditCharge = calcCreditCharge(uint32(len(data)))
+	if w.Credits != 0 {
+		w.Credits = w.CreditCharge
+	}
+	w.Channel = ChannelRdmaV1
+	w.RemainingBytes = uint32(len(data))
+	w.WriteChannelInfoOffset = 0x70
+	w.WriteChannelInfoLength = uint16(len(desc))
+	w.Buffer = desc
+	return &rdmaWriteReq{w}, release, nil
+}
+
+func (self *rdmaWriteReq) MarshalBinary(meta *encoder.Metadata) ([]byte, error) {
+	buf, err := encoder.Marshal(&self.WriteReq)
+	if err != nil {
+		return nil, err
+	}
+	// MS-SMB2 Section 2.2.21 DataOffset and Length are 0 as no data follows
+	binary.LittleEndian.PutUint16(buf[66:], 0)
+	binary.LittleEndian.PutUint32(buf[68:], 0)
+	return buf, nil
+}
+
+func (self *rdmaWriteReq) UnmarshalBinary(buf []byte, meta *encoder.Metadata) error {
+	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of rdmaWriteReq")
+}
+
+// rdmaReadCount returns the number of bytes the server wrote with RDMA for
+// a READ response without data
+func rdmaReadCount(buf []byte, size int) (n int, err error) {
+	if len(buf) < readResponseDataOffset {
+		return 0, fmt.Errorf("Read response is too short")
+	}
+	// MS-SMB2 Section 3.3.5.12 DataRemaining is the length of the data
+	n = int(binary.LittleEndian.Uint32(buf[72:76]))
+	if n > size {
+		return 0, fmt.Errorf("Server wrote %d bytes with RDMA to a buffer of %d bytes", n, size)
+	}
+	return
+}
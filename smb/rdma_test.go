@@ -0,0 +1,218 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+	"github.com/ericblavier/go-smb/smb/smbdirect"
+)
+
+// rdmaTestConn is a transport whose registered buffers are accessed by the
+// test server through their tokens
+type rdmaTestConn struct {
+	net.Conn
+	m       sync.Mutex
+	regions map[uint32][]byte
+	next    uint32
+}
+
+func (self *rdmaTestConn) RegisterBuffer(buf []byte, remoteWrite bool) ([]byte, func(), error) {
+	self.m.Lock()
+	defer self.m.Unlock()
+	self.next++
+	token := self.next
+	self.regions[token] = buf
+	desc := smbdirect.BufferDescriptorV1{Token: token, Length: uint32(len(buf))}
+	b, _ := desc.MarshalBinary()
+	return b, func() {
+		self.m.Lock()
+		delete(self.regions, token)
+		self.m.Unlock()
+	}, nil
+}
+
+func (self *rdmaTestConn) MaxReadWriteSize() int {
+	return 1 << 20
+}
+
+func (self *rdmaTestConn) region(desc []byte) []byte {
+	d, err := smbdirect.ParseBufferDescriptors(desc)
+	if err != nil || len(d) != 1 {
+		return nil
+	}
+	self.m.Lock()
+	defer self.m.Unlock()
+	return self.regions[d[0].Token]
+}
+
+// serveRdmaTestFile answers READ and WRITE requests on data, moving the
+// payload through the registered buffers for requests with an RDMA channel
+func serveRdmaTestFile(server net.Conn, conn *rdmaTestConn, data []byte, channels chan<- uint32) {
+	for {
+		buf, err := readTestFrame(server)
+		if err != nil {
+			return
+		}
+		var h Header
+		if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+			return
+		}
+		header := Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       h.Command,
+			Credits:       1,
+			MessageID:     h.MessageID,
+			Signature:     make([]byte, 16),
+		}
+		var res interface{}
+		switch h.Command {
+		case CommandWrite:
+			offset := binary.LittleEndian.Uint64(buf[72:80])
+			channel := binary.LittleEndian.Uint32(buf[96:100])
+			channels <- channel
+			payload := buf[binary.LittleEndian.Uint16(buf[66:]):][:binary.LittleEndian.Uint32(buf[68:])]
+			if channel == ChannelRdmaV1 {
+				if len(payload) != 0 {
+					return
+				}
+				info := binary.LittleEndian.Uint16(buf[104:])
+				payload = conn.region(buf[info:][:binary.LittleEndian.Uint16(buf[106:])])
+				if len(payload) != int(binary.LittleEndian.Uint32(buf[100:])) {
+					return
+				}
+			}
+			copy(data[offset:], payload)
+			res = &WriteRes{Header: header, StructureSize: 17, Count: uint32(len(payload))}
+		case CommandRead:
+			length := binary.LittleEndian.Uint32(buf[68:72])
+			offset := binary.LittleEndian.Uint64(buf[72:80])
+			channel := binary.LittleEndian.Uint32(buf[100:104])
+			channels <- channel
+			r := &ReadRes{Header: header, StructureSize: 17, DataOffset: readResponseDataOffset}
+			chunk := data[offset:min(uint64(len(data)), offset+uint64(length))]
+			if channel == ChannelRdmaV1 {
+				info := binary.LittleEndian.Uint16(buf[108:])
+				r.DataRemaining = uint32(copy(conn.region(buf[info:][:binary.LittleEndian.Uint16(buf[110:])]), chunk))
+			} else {
+				r.Buffer = chunk
+			}
+			res = r
+		default:
+			return
+		}
+		if err = writeTestFrame(server, res); err != nil {
+			return
+		}
+	}
+}
+
+// newRdmaTestConnection is newTestConnection with a transport supporting
+// RDMA
+func newRdmaTestConnection(t *testing.T) (*Connection, *rdmaTestConn, net.Conn) {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	conn := &rdmaTestConn{Conn: client, regions: make(map[uint32][]byte)}
+	c := &Connection{
+		conn:                conn,
+		outstandingRequests: newOutstandingRequests(),
+		rdone:               make(chan struct{}, 1),
+		wdone:               make(chan struct{}, 1),
+		write:               make(chan net.Buffers, 1),
+		werr:                make(chan error, 1),
+	}
+	c.Session = &Session{
+		supportsMultiCredit: true,
+		trees:               map[string]uint32{"share": 1},
+	}
+	go c.runSender()
+	go c.runReceiver()
+	return c, conn, server
+}
+
+func TestRdmaReadWrite(t *testing.T) {
+	c, conn, server := newRdmaTestConnection(t)
+	c.dialect = DialectSmb_3_0_2
+	c.credits.Store(100)
+	c.maxWriteSize = 8192
+	data := make([]byte, 30000)
+	channels := make(chan uint32, 100)
+	go serveRdmaTestFile(server, conn, data, channels)
+
+	f := &File{Connection: c, fd: make([]byte, 16), share: "share"}
+	src := make([]byte, 20000)
+	for i := range src {
+		src[i] = byte(i * 13)
+	}
+	n, err := f.WriteFile(src, 0)
+	if err != nil || n != len(src) {
+		t.Fatalf("Fail: %d %+v", n, err)
+	}
+	if <-channels != ChannelRdmaV1 || !bytes.Equal(data[:len(src)], src) {
+		t.Fatal("Fail")
+	}
+
+	// Payloads up to the threshold are sent in the messages
+	if _, err = f.WriteFile(src[:100], 25000); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if <-channels != ChannelNone || !bytes.Equal(data[25000:25100], src[:100]) {
+		t.Fatal("Fail")
+	}
+
+	dst := make([]byte, len(src))
+	n, err = f.ReadFile(dst, 0)
+	if err != nil || n != len(src) {
+		t.Fatalf("Fail: %d %+v", n, err)
+	}
+	if <-channels != ChannelRdmaV1 || !bytes.Equal(dst, src) {
+		t.Fatal("Fail")
+	}
+
+	// Pipelined writes of 8192 byte chunks, the last of which is sent in the
+	// message
+	clear(data)
+	if _, err = f.WriteAt(src, 100); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	for _, expected := range []uint32{ChannelRdmaV1, ChannelRdmaV1, ChannelNone} {
+		if channel := <-channels; channel != expected {
+			t.Fatalf("Fail: channel %d", channel)
+		}
+	}
+	if !bytes.Equal(data[100:100+len(src)], src) {
+		t.Fatal("Fail")
+	}
+	conn.m.Lock()
+	defer conn.m.Unlock()
+	if len(conn.regions) != 0 {
+		t.Fatalf("Fail: %d registered buffers were not released", len(conn.regions))
+	}
+}
+
+func TestRdmaDisabledWithEncryption(t *testing.T) {
+	c, _, _ := newRdmaTestConnection(t)
+	c.dialect = DialectSmb_3_1_1
+	if c.rdmaTransport(65536) == nil {
+		t.Fatal("Fail")
+	}
+	if c.rdmaTransport(rdmaThreshold) != nil {
+		t.Fatal("Fail")
+	}
+	c.sessionFlags |= SessionFlagEncryptData
+	if c.rdmaTransport(65536) != nil {
+		t.Fatal("Fail")
+	}
+	c.sessionFlags = 0
+	c.dialect = DialectSmb_2_1
+	if c.rdmaTransport(65536) != nil {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,201 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	defaultReadAheadDepth = 4
+	maxReadAheadSize      = 1048576
+)
+
+// readAheadChunk is a READ request issued ahead of the caller
+type readAheadChunk struct {
+	offset uint64
+	buf    []byte
+	n      int
+	err    error
+	done   chan struct{}
+}
+
+// readAhead keeps up to depth READ requests in flight in front of the
+// position of sequential File.Read calls.
+type readAhead struct {
+	depth      int
+	chunkSize  int
+	next       uint64 // Offset expected by the next sequential read
+	sequential bool
+	fetch      uint64 // Offset of the next chunk to prefetch
+	chunks     []*readAheadChunk
+	consumed   int // Bytes of chunks[0] already returned
+	free       [][]byte
+}
+
+func (f *File) newReadAhead() *readAhead {
+	depth := f.options.ReadAheadDepth
+	size := f.options.ReadAheadSize
+	if size <= 0 {
+		size = 65536
+		if f.supportsMultiCredit && f.maxReadSize > 0 {
+			size = min(int(f.maxReadSize), maxReadAheadSize)
+		}
+	}
+	return &readAhead{depth: depth, chunkSize: size}
+}
+
+// reset waits for and drops all prefetched chunks
+func (self *readAhead) reset() {
+	for _, c := range self.chunks {
+		<-c.done
+		self.free = append(self.free, c.buf)
+	}
+	self.chunks = self.chunks[:0]
+	self.consumed = 0
+}
+
+// fill issues READ requests until depth chunks are queued. Fewer are queued
+// while the server throttles the client.
+func (self *readAhead) fill(f *File) {
+	charge := int64(calcCreditCharge(uint32(self.chunkSize)))
+	for len(self.chunks) < f.throttledWindow(self.depth) {
+		if len(self.chunks) > 0 && f.credits.Load() < charge {
+			f.creditsStarved(CommandRead)
+			break
+		}
+		c := &readAheadChunk{offset: self.fetch, done: make(chan struct{})}
+		if n := len(self.free); n > 0 {
+			c.buf, self.free = self.free[n-1], self.free[:n-1]
+		} else {
+			c.buf = make([]byte, self.chunkSize)
+		}
+		go func() {
+			c.n, c.err = f.readFile(c.buf, c.offset)
+			close(c.done)
+		}()
+		self.chunks = append(self.chunks, c)
+		self.fetch += uint64(self.chunkSize)
+	}
+}
+
+// dropReadAhead discards the prefetched data and waits for sequential access
+// to be detected again
+func (f *File) dropReadAhead() {
+	if f.ra != nil {
+		f.ra.reset()
+		f.ra.sequential = false
+	}
+}
+
+// read reads into p from offset off. The first read at an offset is
+// performed directly and only a read continuing where the previous one ended
+// starts prefetching.
+func (self *readAhead) read(f *File, p []byte, off uint64) (n int, err error) {
+	if off != self.next || self.depth <= 0 {
+		self.reset()
+		self.sequential = false
+	}
+	if !self.sequential {
+		n, err = f.ReadAt(p, int64(off))
+		self.next = off + uint64(n)
+		self.sequential = self.depth > 0 && err == nil
+		self.fetch = self.next
+		return
+	}
+
+	self.fill(f)
+	c := self.chunks[0]
+	<-c.done
+	if c.n == 0 {
+		err = c.err
+		if err == nil {
+			err = io.ErrNoProgress
+		}
+		self.reset()
+		self.sequential = false
+		return
+	}
+	n = copy(p, c.buf[self.consumed:c.n])
+	self.consumed += n
+	self.next += uint64(n)
+	if self.consumed == c.n {
+		self.chunks = self.chunks[1:]
+		self.consumed = 0
+		self.free = append(self.free, c.buf)
+		if c.n < len(c.buf) {
+			// A short read means the following chunks start at the wrong
+			// offset so start over from the current position.
+			self.reset()
+			self.fetch = self.next
+		}
+	}
+	return
+}
+
+// Read implements io.Reader. When Options.ReadAheadDepth is positive and
+// sequential access is detected, the following chunks of the file are
+// prefetched so that e.g., io.Copy is not limited by the round trip time of
+// each READ request.
+func (f *File) Read(p []byte) (n int, err error) {
+	if f.fd == nil {
+		return 0, fmt.Errorf("Can't operate on a closed file")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// Buffered writes must be visible to the read
+	if err = f.Flush(); err != nil {
+		return
+	}
+	if f.ra == nil {
+		f.ra = f.newReadAhead()
+	}
+	n, err = f.ra.read(f, p, uint64(f.pos))
+	f.pos += int64(n)
+	return
+}
+
+// Seek implements io.Seeker. Buffered writes are flushed first. Seeking to
+// anywhere but the current position drops any prefetched data on the next
+// Read.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if err := f.Flush(); err != nil {
+		return f.pos, err
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += int64(f.EndOfFile)
+	default:
+		return 0, fmt.Errorf("Invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("Invalid negative offset")
+	}
+	f.pos = offset
+	return offset, nil
+}
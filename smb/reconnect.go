@@ -0,0 +1,74 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// How long a server is remembered to support SMB2 negotiation
+const negotiateCacheTTL = 10 * time.Minute
+
+// Servers that completed a SMB2 negotiation with FastReconnect enabled. The
+// next connection to such a server sends the SMB2 NEGOTIATE request right
+// away instead of starting with a SMB1 multi-protocol negotiation, which
+// saves a round trip for tools that repeatedly cycle through many hosts.
+// Authentication can't be skipped in the same way as NTLM has no session
+// resumption, but Kerberos tickets can be shared, see
+// spnego.KRB5Initiator.CacheTickets.
+var negotiateCache = struct {
+	sync.Mutex
+	expires map[string]time.Time
+}{expires: make(map[string]time.Time)}
+
+func negotiateCacheKey(host string, port int) string {
+	return fmt.Sprintf("%s:%d", host, port)
+}
+
+func negotiateCached(host string, port int) bool {
+	negotiateCache.Lock()
+	defer negotiateCache.Unlock()
+	key := negotiateCacheKey(host, port)
+	expires, ok := negotiateCache.expires[key]
+	if ok && time.Now().After(expires) {
+		delete(negotiateCache.expires, key)
+		return false
+	}
+	return ok
+}
+
+func rememberNegotiate(host string, port int) {
+	negotiateCache.Lock()
+	defer negotiateCache.Unlock()
+	negotiateCache.expires[negotiateCacheKey(host, port)] = time.Now().Add(negotiateCacheTTL)
+}
+
+// forgetNegotiate drops a server from the cache, e.g., after a failed
+// negotiation such that the next attempt starts from scratch.
+func forgetNegotiate(host string, port int) {
+	negotiateCache.Lock()
+	defer negotiateCache.Unlock()
+	delete(negotiateCache.expires, negotiateCacheKey(host, port))
+}
@@ -203,7 +203,7 @@ func (c *Connection) sendSessionSetup1ReqWithToken(token []byte) (responseToken
 		return
 	}
 	var init gss.NegTokenInit
-	err = encoder.Unmarshal(initBytes, &init)
+	err = c.unmarshal(initBytes, &init)
 	if err != nil {
 		log.Errorln(err)
 		return
@@ -236,7 +236,7 @@ func (c *Connection) sendSessionSetup1ReqWithToken(token []byte) (responseToken
 		return
 	}
 
-	if err = encoder.Unmarshal(ssresbuf, &ssres); err != nil {
+	if err = c.unmarshal(ssresbuf, &ssres); err != nil {
 		log.Debugln(err)
 		return
 	}
@@ -268,6 +268,11 @@ func NewRelayConnection(opt Options) (c *Connection, err error) {
 
 	defer l.Close()
 
+	unmarshal := encoder.Unmarshal
+	if opt.StrictBounds {
+		unmarshal = encoder.UnmarshalStrict
+	}
+
 	// Read packets until client has authenticated
 	var activeSession bool
 	var packet []byte
@@ -291,7 +296,7 @@ ClientLoop:
 				outstandingRequests: newOutstandingRequests(),
 				rdone:               make(chan struct{}, 1),
 				wdone:               make(chan struct{}, 1),
-				write:               make(chan []byte, 1),
+				write:               make(chan net.Buffers, 1),
 				werr:                make(chan error, 1),
 			}
 
@@ -326,7 +331,7 @@ ClientLoop:
 				log.Debugln("Received SMB1 packet from client")
 				// SMB1
 				h := SMB1Header{}
-				if err = encoder.Unmarshal(packet[:32], &h); err != nil {
+				if err = unmarshal(packet[:32], &h); err != nil {
 					log.Errorln(err)
 					// Wait for the next client
 					clientConn.Close()
@@ -351,7 +356,7 @@ ClientLoop:
 				log.Debugln("Received SMB2 packet") //hopefully
 				// Assume it's SMB2
 				var h Header
-				if err = encoder.Unmarshal(packet[:64], &h); err != nil {
+				if err = unmarshal(packet[:64], &h); err != nil {
 					log.Errorln("Failed to decode header of packet")
 					// Wait for the next client
 					clientConn.Close()
@@ -369,7 +374,7 @@ ClientLoop:
 				case CommandNegotiate:
 					log.Debugln("Got command negotiate from client")
 					var neg NegotiateReq
-					if err = encoder.Unmarshal(packet, &neg); err != nil {
+					if err = unmarshal(packet, &neg); err != nil {
 						log.Errorln(err)
 						// Wait for the next client
 						clientConn.Close()
@@ -403,7 +408,7 @@ ClientLoop:
 					log.Debugln("Got session setup packet from client")
 
 					req := SessionSetupReq{}
-					if err = encoder.Unmarshal(packet, &req); err != nil {
+					if err = unmarshal(packet, &req); err != nil {
 						log.Errorln(err)
 						// Wait for the next client
 						clientConn.Close()
@@ -413,7 +418,7 @@ ClientLoop:
 					if req.SecurityBlob[0] == 0x60 {
 						// GSS Negotiate Packet
 						negTokenInit := gss.NegTokenInit{}
-						if err := encoder.Unmarshal(req.SecurityBlob, &negTokenInit); err != nil {
+						if err := unmarshal(req.SecurityBlob, &negTokenInit); err != nil {
 							log.Errorln(err)
 							// Wait for the next client
 							clientConn.Close()
@@ -422,7 +427,7 @@ ClientLoop:
 						messageType = negTokenInit.Data.MechToken[len(ntlmssp.Signature) : len(ntlmssp.Signature)+1][0]
 					} else if req.SecurityBlob[0] == 0xa1 {
 						negTokenResp := gss.NegTokenResp{}
-						if err := encoder.Unmarshal(req.SecurityBlob, &negTokenResp); err != nil {
+						if err := unmarshal(req.SecurityBlob, &negTokenResp); err != nil {
 							log.Errorln(err)
 							// Wait for the next client
 							clientConn.Close()
@@ -441,7 +446,7 @@ ClientLoop:
 					case 0x1: // Negotiate
 						log.Debugln("Session setup packet with command Negotiate from client")
 						neg := NewSessionSetup1Req()
-						if err = encoder.Unmarshal(packet, &neg); err != nil {
+						if err = unmarshal(packet, &neg); err != nil {
 							log.Errorln(err)
 							// Wait for the next client
 							clientConn.Close()
@@ -486,7 +491,7 @@ ClientLoop:
 						}
 
 						challenge := ntlmssp.NewChallenge()
-						if err = encoder.Unmarshal(responseToken, &challenge); err != nil {
+						if err = unmarshal(responseToken, &challenge); err != nil {
 							// Perhaps a bit unnecesssary to fail the client just because unmarshal failed?
 							log.Errorln(err)
 							clientConn.Close()
@@ -511,7 +516,7 @@ ClientLoop:
 						neg := SessionSetup2Req{
 							SecurityBlob: &gss.NegTokenResp{},
 						}
-						if err = encoder.Unmarshal(packet, &neg); err != nil {
+						if err = unmarshal(packet, &neg); err != nil {
 							log.Errorln(err)
 							clientConn.Close()
 							c.Close()
@@ -520,7 +525,7 @@ ClientLoop:
 						}
 
 						authenticate := ntlmssp.Authenticate{}
-						if err = encoder.Unmarshal(neg.SecurityBlob.ResponseToken, &authenticate); err != nil {
+						if err = unmarshal(neg.SecurityBlob.ResponseToken, &authenticate); err != nil {
 							log.Errorln(err)
 							clientConn.Close()
 							c.Close()
@@ -546,7 +551,7 @@ ClientLoop:
 
 						log.Debugln("Unmarshalling SessionSetup2 response header")
 						var authResp Header
-						if err := encoder.Unmarshal(ss2resbuf, &authResp); err != nil {
+						if err := unmarshal(ss2resbuf, &authResp); err != nil {
 							log.Errorln(err)
 							log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(ss2resbuf))
 							clientConn.Close()
@@ -588,7 +593,7 @@ ClientLoop:
 
 						log.Debugln("Unmarshalling SessionSetup2 response")
 						ssres2, _ := NewSessionSetup2Res()
-						if err := encoder.Unmarshal(ss2resbuf, &ssres2); err != nil {
+						if err := unmarshal(ss2resbuf, &ssres2); err != nil {
 							log.Errorln(err)
 							return nil, err
 						}
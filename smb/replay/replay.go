@@ -0,0 +1,482 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+// Package replay records the frames exchanged between a client and an SMB
+// server into a transcript and serves a transcript back to the client in
+// place of the server. Both are proxy dialers that are set as
+// smb.Options.ProxyDialer, which allows testing complete protocol flows
+// without a live server and reproducing sessions recorded in the field.
+//
+// Signed and encrypted messages depend on the session key, which the client
+// derives from random values. A session is therefore only replayed past its
+// session setup when it was recorded with signing disabled over SMB 2.x.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Frame is a single message of the session service, including its 4 byte
+// header with the 24-bit length, e.g., an SMB message or a NetBIOS session
+// request
+type Frame struct {
+	Client bool          // Sent by the client
+	Time   time.Duration // Since the connection was dialed, 0 if unknown
+	Data   []byte
+}
+
+// Transcript is the sequence of frames exchanged on one connection
+type Transcript struct {
+	Frames []Frame
+}
+
+// ReadTranscript parses a transcript with a frame per line. Client frames
+// start with "> " and server frames with "< " followed by the frame in hex.
+// The direction may be preceded by the time of the frame, e.g.,
+// "+1.5ms > ...". Empty lines and lines starting with # are ignored.
+func ReadTranscript(r io.Reader) (*Transcript, error) {
+	t := &Transcript{}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<26)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		var offset time.Duration
+		if text[0] == '+' {
+			stamp, rest, _ := strings.Cut(text, " ")
+			d, err := time.ParseDuration(stamp[1:])
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("Invalid time on transcript line %d", line)
+			}
+			offset, text = d, rest
+		}
+		dir, data, ok := strings.Cut(text, " ")
+		if !ok || (dir != ">" && dir != "<") {
+			return nil, fmt.Errorf("Invalid transcript line %d", line)
+		}
+		buf, err := hex.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid transcript line %d: %s", line, err)
+		}
+		if frameLength(buf) != len(buf) {
+			return nil, fmt.Errorf("Invalid frame length on transcript line %d", line)
+		}
+		t.Frames = append(t.Frames, Frame{Client: dir == ">", Time: offset, Data: buf})
+	}
+	return t, s.Err()
+}
+
+// LoadTranscript reads the transcript in the file at path
+func LoadTranscript(path string) (*Transcript, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTranscript(f)
+}
+
+// WriteTo writes the transcript in the format parsed by ReadTranscript
+func (self *Transcript) WriteTo(w io.Writer) (n int64, err error) {
+	bw := bufio.NewWriter(w)
+	for _, f := range self.Frames {
+		var m int
+		m, err = writeFrame(bw, f)
+		n += int64(m)
+		if err != nil {
+			return
+		}
+	}
+	return n, bw.Flush()
+}
+
+// writeFrame writes a line of the transcript format
+func writeFrame(w io.Writer, f Frame) (int, error) {
+	dir := "< "
+	if f.Client {
+		dir = "> "
+	}
+	if f.Time != 0 {
+		return fmt.Fprintf(w, "+%s %s%x\n", f.Time, dir, f.Data)
+	}
+	return fmt.Fprintf(w, "%s%x\n", dir, f.Data)
+}
+
+// Save writes the transcript to the file at path
+func (self *Transcript) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = self.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// frameLength returns the length of the frame that starts buf including the
+// header, or -1 if the header is incomplete
+func frameLength(buf []byte) int {
+	if len(buf) < 4 {
+		return -1
+	}
+	return 4 + int(binary.BigEndian.Uint32(buf)&0xffffff)
+}
+
+// splitFrames appends p to pending and returns the complete frames at the
+// start of it
+func splitFrames(pending *[]byte, p []byte) (frames [][]byte) {
+	*pending = append(*pending, p...)
+	for {
+		n := frameLength(*pending)
+		if n < 0 || len(*pending) < n {
+			return
+		}
+		frames = append(frames, bytes.Clone((*pending)[:n]))
+		*pending = (*pending)[n:]
+	}
+}
+
+// Recorder is a proxy.Dialer that records the frames of the connections it
+// dials into Transcript, with their time since the first connection was
+// dialed
+type Recorder struct {
+	Dialer proxy.Dialer // Used to reach the server. Defaults to proxy.Direct
+	// Receives each frame in the transcript format as it is recorded, e.g.,
+	// a file that keeps the frames if the client crashes or hangs
+	Output io.Writer
+
+	mu         sync.Mutex
+	start      time.Time
+	transcript Transcript
+	err        error
+}
+
+// Err returns the first error writing to Output
+func (self *Recorder) Err() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.err
+}
+
+// Transcript returns a copy of the frames recorded so far
+func (self *Recorder) Transcript() *Transcript {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return &Transcript{Frames: append([]Frame(nil), self.transcript.Frames...)}
+}
+
+func (self *Recorder) Dial(network, addr string) (net.Conn, error) {
+	return self.DialContext(context.Background(), network, addr)
+}
+
+func (self *Recorder) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := self.Dialer
+	if d == nil {
+		d = proxy.Direct
+	}
+	var conn net.Conn
+	var err error
+	if cd, ok := d.(proxy.ContextDialer); ok {
+		conn, err = cd.DialContext(ctx, network, addr)
+	} else {
+		conn, err = d.Dial(network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	self.mu.Lock()
+	if self.start.IsZero() {
+		self.start = time.Now()
+	}
+	self.mu.Unlock()
+	return &recordConn{Conn: conn, r: self}, nil
+}
+
+func (self *Recorder) record(client bool, frames [][]byte) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	offset := time.Since(self.start)
+	for _, data := range frames {
+		f := Frame{Client: client, Time: offset, Data: data}
+		self.transcript.Frames = append(self.transcript.Frames, f)
+		if self.Output != nil && self.err == nil {
+			_, self.err = writeFrame(self.Output, f)
+		}
+	}
+}
+
+type recordConn struct {
+	net.Conn
+	r        *Recorder
+	rmu, wmu sync.Mutex
+	rbuf     []byte
+	wbuf     []byte
+}
+
+func (self *recordConn) Read(p []byte) (n int, err error) {
+	n, err = self.Conn.Read(p)
+	self.rmu.Lock()
+	self.r.record(false, splitFrames(&self.rbuf, p[:n]))
+	self.rmu.Unlock()
+	return
+}
+
+func (self *recordConn) Write(p []byte) (n int, err error) {
+	n, err = self.Conn.Write(p)
+	self.wmu.Lock()
+	self.r.record(true, splitFrames(&self.wbuf, p[:n]))
+	self.wmu.Unlock()
+	return
+}
+
+// Replayer is a proxy.Dialer that returns a connection playing the server
+// side of a transcript. Each frame written by the client is compared to the
+// next client frame of the transcript after which the following server
+// frames are returned by Read. As clients use random values such as
+// challenges and GUIDs, only the type of message is compared unless Strict
+// is set.
+type Replayer struct {
+	Strict bool // Require client frames to match the transcript byte by byte
+	// Delay each server frame by the time that passed since the previous
+	// frame when recorded, divided by Speed, e.g., 1 to reproduce the timing
+	// of the recording. Server frames are returned immediately unless it is
+	// positive or when the transcript has no times.
+	Speed float64
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	t       *Transcript
+	next    int       // Index of the next frame of the transcript
+	pending []delayed // Server frames delayed by Speed
+	rbuf    []byte    // Server data not yet read by the client
+	wbuf    []byte    // Partial client frame
+	dialed  bool
+	closed  bool
+	err     error
+}
+
+// A server frame returned by Read from a point in time
+type delayed struct {
+	at   time.Time
+	data []byte
+}
+
+// NewReplayer returns a Replayer for a single connection serving t
+func NewReplayer(t *Transcript) *Replayer {
+	self := &Replayer{t: t}
+	self.cond = sync.NewCond(&self.mu)
+	return self
+}
+
+// Err returns the first mismatch between the client and the transcript
+func (self *Replayer) Err() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.err
+}
+
+// Done reports whether all frames of the transcript have been replayed
+func (self *Replayer) Done() bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.next == len(self.t.Frames) && len(self.pending) == 0 && len(self.rbuf) == 0
+}
+
+func (self *Replayer) Dial(network, addr string) (net.Conn, error) {
+	return self.DialContext(context.Background(), network, addr)
+}
+
+func (self *Replayer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.dialed {
+		return nil, fmt.Errorf("The transcript has already been replayed")
+	}
+	self.dialed = true
+	self.queueServerFrames()
+	return &replayConn{r: self}, nil
+}
+
+// queueServerFrames makes the server frames that follow the current
+// position available to Read, after their delay if Speed is set
+func (self *Replayer) queueServerFrames() {
+	at := time.Now()
+	for self.next < len(self.t.Frames) && !self.t.Frames[self.next].Client {
+		f := self.t.Frames[self.next]
+		if self.Speed > 0 && self.next > 0 {
+			if gap := f.Time - self.t.Frames[self.next-1].Time; gap > 0 {
+				at = at.Add(time.Duration(float64(gap) / self.Speed))
+			}
+		}
+		self.pending = append(self.pending, delayed{at: at, data: f.Data})
+		self.next++
+	}
+	self.cond.Broadcast()
+}
+
+// release moves the pending frames that are due to rbuf and returns the
+// time until the next one is, 0 if none is pending
+func (self *Replayer) release() time.Duration {
+	now := time.Now()
+	for len(self.pending) > 0 {
+		if wait := self.pending[0].at.Sub(now); wait > 0 {
+			return wait
+		}
+		self.rbuf = append(self.rbuf, self.pending[0].data...)
+		self.pending = self.pending[1:]
+	}
+	return 0
+}
+
+func (self *Replayer) fail(err error) error {
+	if self.err == nil {
+		self.err = err
+	}
+	self.closed = true
+	self.cond.Broadcast()
+	return err
+}
+
+func (self *Replayer) write(p []byte) (int, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.closed {
+		return 0, net.ErrClosed
+	}
+	for _, frame := range splitFrames(&self.wbuf, p) {
+		if self.next == len(self.t.Frames) {
+			return 0, self.fail(fmt.Errorf("Unexpected frame after the end of the transcript: %x", frame[:min(len(frame), 72)]))
+		}
+		expected := self.t.Frames[self.next].Data
+		if !sameFrame(frame, expected, self.Strict) {
+			return 0, self.fail(fmt.Errorf("Frame %d does not match the transcript\n%x\n%x", self.next, frame[:min(len(frame), 72)], expected[:min(len(expected), 72)]))
+		}
+		self.next++
+		self.queueServerFrames()
+	}
+	return len(p), nil
+}
+
+func (self *Replayer) read(p []byte) (n int, err error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for {
+		wait := self.release()
+		if len(self.rbuf) > 0 {
+			break
+		}
+		if self.closed {
+			return 0, io.EOF
+		}
+		if wait > 0 {
+			// The delay of a frame is not interrupted by Close
+			self.mu.Unlock()
+			time.Sleep(wait)
+			self.mu.Lock()
+			continue
+		}
+		if self.next == len(self.t.Frames) {
+			// Nothing more will be sent by the server
+			return 0, io.EOF
+		}
+		self.cond.Wait()
+	}
+	n = copy(p, self.rbuf)
+	self.rbuf = self.rbuf[n:]
+	return
+}
+
+func (self *Replayer) close() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.closed = true
+	self.cond.Broadcast()
+}
+
+// sameFrame compares a client frame to the one of the transcript. Unless
+// strict, SMB messages only need the same protocol and command and other
+// session service packets the same type.
+func sameFrame(frame, expected []byte, strict bool) bool {
+	if strict {
+		return bytes.Equal(frame, expected)
+	}
+	if frame[0] != expected[0] {
+		return false
+	} else if frame[0] != 0 {
+		return true
+	}
+	if len(frame) < 8 || len(expected) < 8 || !bytes.Equal(frame[4:8], expected[4:8]) {
+		return false
+	}
+	switch string(frame[4:8]) {
+	case "\xfeSMB":
+		// The command follows the ProtocolId, StructureSize, CreditCharge
+		// and Status
+		return len(frame) >= 18 && len(expected) >= 18 && bytes.Equal(frame[16:18], expected[16:18])
+	case "\xffSMB":
+		return len(frame) >= 9 && len(expected) >= 9 && frame[8] == expected[8]
+	}
+	// Encrypted and compressed messages can only be compared as a whole
+	return bytes.Equal(frame, expected)
+}
+
+// replayConn is the client side of a connection to a Replayer
+type replayConn struct {
+	r *Replayer
+}
+
+func (self *replayConn) Read(p []byte) (int, error)  { return self.r.read(p) }
+func (self *replayConn) Write(p []byte) (int, error) { return self.r.write(p) }
+
+func (self *replayConn) Close() error {
+	self.r.close()
+	return nil
+}
+
+func (self *replayConn) LocalAddr() net.Addr  { return replayAddr{} }
+func (self *replayConn) RemoteAddr() net.Addr { return replayAddr{} }
+
+// Deadlines are not needed as every read is answered from the transcript
+func (self *replayConn) SetDeadline(t time.Time) error      { return nil }
+func (self *replayConn) SetReadDeadline(t time.Time) error  { return nil }
+func (self *replayConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type replayAddr struct{}
+
+func (replayAddr) Network() string { return "replay" }
+func (replayAddr) String() string  { return "replay" }
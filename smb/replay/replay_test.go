@@ -0,0 +1,284 @@
+package replay
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smbserver"
+	"github.com/ericblavier/go-smb/spnego"
+)
+
+var update = flag.Bool("update", false, "Record the transcripts of testdata against a local smbserver")
+
+// goldenFlows are the client flows of the transcripts in testdata
+var goldenFlows = map[string]func(opt smb.Options) error{
+	"negotiate": func(opt smb.Options) error {
+		opt.ManualLogin = true
+		c, err := smb.NewConnection(opt)
+		if err != nil {
+			return err
+		}
+		c.Close()
+		return nil
+	},
+	"session_setup": func(opt smb.Options) error {
+		c, err := smb.NewConnection(opt)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		if !c.IsAuthenticated() {
+			return fmt.Errorf("Not authenticated")
+		}
+		return nil
+	},
+	"read_write": func(opt smb.Options) error {
+		c, err := smb.NewConnection(opt)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		if err = c.TreeConnect("DATA"); err != nil {
+			return err
+		}
+		defer c.TreeDisconnect("DATA")
+		data := []byte(strings.Repeat("golden ", 1000))
+		r := bytes.NewReader(data)
+		if err = c.PutFile("DATA", "golden.txt", 0, r.Read); err != nil {
+			return err
+		}
+		var b bytes.Buffer
+		if err = c.RetrieveFile("DATA", "golden.txt", 0, b.Write); err != nil {
+			return err
+		}
+		if !bytes.Equal(b.Bytes(), data) {
+			return fmt.Errorf("Read data differs from the written data")
+		}
+		var readme bytes.Buffer
+		if err = c.RetrieveFile("DATA", "readme.txt", 0, readme.Write); err != nil {
+			return err
+		}
+		if readme.String() != "hello world" {
+			return fmt.Errorf("Unexpected content of readme.txt: %q", readme.String())
+		}
+		return c.DeleteFile("DATA", "golden.txt")
+	},
+}
+
+func goldenOptions() smb.Options {
+	return smb.Options{
+		Host:           "127.0.0.1",
+		Port:           445,
+		Initiator:      &spnego.NTLMInitiator{User: "alice", Password: "Passw0rd!"},
+		DisableSigning: true,
+		DialTimeout:    5 * time.Second,
+	}
+}
+
+// record runs flow against a local smbserver and saves the transcript to path
+func record(t *testing.T, path string, flow func(opt smb.Options) error) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("hello world"), 0o644)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	share, err := smbserver.Dir(dir)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	srv, err := smbserver.NewServer(smbserver.Options{
+		Shares:   map[string]smbserver.Backend{"data": share},
+		Accounts: map[string]string{"alice": "Passw0rd!"},
+	})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer srv.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	go srv.Serve(l)
+
+	opt := goldenOptions()
+	opt.Port = l.Addr().(*net.TCPAddr).Port
+	r := &Recorder{}
+	opt.ProxyDialer = r
+	if err = flow(opt); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if err = r.Transcript().Save(path); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	for name, flow := range goldenFlows {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join("testdata", name+".txt")
+			if *update {
+				record(t, path, flow)
+			}
+			transcript, err := LoadTranscript(path)
+			if err != nil {
+				t.Fatalf("Fail: %+v", err)
+			}
+			r := NewReplayer(transcript)
+			opt := goldenOptions()
+			opt.ProxyDialer = r
+			if err = flow(opt); err != nil {
+				t.Fatalf("Fail: %+v", err)
+			}
+			if err = r.Err(); err != nil {
+				t.Fatalf("Fail: %+v", err)
+			}
+			if !r.Done() {
+				t.Fatal("Fail: the transcript was not fully replayed")
+			}
+		})
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	// A TREE_CONNECT request and its response
+	req := append([]byte{0, 0, 0, 64}, smb.ProtocolSmb2...)
+	req = append(req, make([]byte, 60)...)
+	req[16] = byte(smb.CommandTreeConnect)
+	transcript := &Transcript{Frames: []Frame{
+		{Client: true, Data: req},
+		{Client: false, Data: []byte{0, 0, 0, 1, 2}},
+	}}
+	var b bytes.Buffer
+	if _, err := transcript.WriteTo(&b); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	parsed, err := ReadTranscript(&b)
+	if err != nil || len(parsed.Frames) != 2 || !parsed.Frames[0].Client || parsed.Frames[1].Client {
+		t.Fatalf("Fail: %+v %v", parsed, err)
+	}
+
+	r := NewReplayer(parsed)
+	conn, err := r.Dial("tcp", "127.0.0.1:445")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if _, err = r.Dial("tcp", "127.0.0.1:445"); err == nil {
+		t.Fatal("Fail")
+	}
+	// Frames may be written in parts and only the command is compared
+	other := bytes.Clone(req)
+	other[20] = 1
+	if _, err = conn.Write(other[:10]); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if _, err = conn.Write(other[10:]); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	buf := make([]byte, 10)
+	if n, err := conn.Read(buf); err != nil || !bytes.Equal(buf[:n], []byte{0, 0, 0, 1, 2}) {
+		t.Fatalf("Fail: %x %v", buf[:n], err)
+	}
+	if !r.Done() {
+		t.Fatal("Fail")
+	}
+	if _, err = conn.Write([]byte{0, 0, 0, 1, 0}); err == nil || r.Err() == nil {
+		t.Fatal("Fail")
+	}
+
+	// A different command is rejected as well as any change in strict mode
+	other[16] = byte(smb.CommandCreate)
+	r = NewReplayer(parsed)
+	conn, _ = r.Dial("tcp", "127.0.0.1:445")
+	if _, err = conn.Write(other); err == nil || r.Err() == nil {
+		t.Fatal("Fail")
+	}
+	other[16] = byte(smb.CommandTreeConnect)
+	r = NewReplayer(parsed)
+	r.Strict = true
+	conn, _ = r.Dial("tcp", "127.0.0.1:445")
+	if _, err = conn.Write(other); err == nil || r.Err() == nil {
+		t.Fatal("Fail")
+	}
+	if _, err = ReadTranscript(strings.NewReader("> 00000002ab\n")); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestRecordTimes(t *testing.T) {
+	req := append([]byte{0, 0, 0, 64}, smb.ProtocolSmb2...)
+	req = append(req, make([]byte, 60)...)
+	req[16] = byte(smb.CommandEcho)
+	res := []byte{0, 0, 0, 1, 2}
+	transcript := &Transcript{Frames: []Frame{
+		{Client: true, Data: req},
+		{Client: false, Time: 50 * time.Millisecond, Data: res},
+	}}
+	var b bytes.Buffer
+	if _, err := transcript.WriteTo(&b); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if !strings.HasPrefix(b.String(), "> ") || !strings.Contains(b.String(), "\n+50ms < 0000000102\n") {
+		t.Fatalf("Fail: %s", b.String())
+	}
+	parsed, err := ReadTranscript(&b)
+	if err != nil || parsed.Frames[0].Time != 0 || parsed.Frames[1].Time != 50*time.Millisecond {
+		t.Fatalf("Fail: %+v %v", parsed, err)
+	}
+	if _, err = ReadTranscript(strings.NewReader("+1x > 00000000\n")); err == nil {
+		t.Fatal("Fail")
+	}
+
+	// Record a replayed session, which is delayed as recorded
+	replayer := NewReplayer(parsed)
+	replayer.Speed = 1
+	var out bytes.Buffer
+	r := &Recorder{Dialer: replayer, Output: &out}
+	conn, err := r.Dial("tcp", "127.0.0.1:445")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	start := time.Now()
+	if _, err = conn.Write(req); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	buf := make([]byte, 10)
+	if n, err := conn.Read(buf); err != nil || !bytes.Equal(buf[:n], res) {
+		t.Fatalf("Fail: %x %v", buf[:n], err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("Fail: %s", elapsed)
+	}
+	if r.Err() != nil || !replayer.Done() {
+		t.Fatal("Fail")
+	}
+	recorded, err := ReadTranscript(&out)
+	if err != nil || len(recorded.Frames) != 2 {
+		t.Fatalf("Fail: %+v %v", recorded, err)
+	}
+	if gap := recorded.Frames[1].Time - recorded.Frames[0].Time; gap < 50*time.Millisecond || !bytes.Equal(recorded.Frames[1].Data, res) {
+		t.Fatalf("Fail: %+v", recorded.Frames)
+	}
+	if !sameFrames(recorded.Frames, r.Transcript().Frames) {
+		t.Fatal("Fail")
+	}
+}
+
+func sameFrames(a, b []Frame) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Client != b[i].Client || a[i].Time != b[i].Time || !bytes.Equal(a[i].Data, b[i].Data) {
+			return false
+		}
+	}
+	return true
+}
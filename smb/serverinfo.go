@@ -0,0 +1,75 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import "time"
+
+// ServerInfo describes the server and the parameters negotiated with it
+type ServerInfo struct {
+	Dialect         uint16
+	ServerGuid      []byte
+	SecurityMode    uint16 // SecurityModeSigningEnabled and SecurityModeSigningRequired flags
+	Capabilities    uint32 // GlobalCap flags sent by the server
+	MaxReadSize     uint32
+	MaxWriteSize    uint32
+	MaxTransactSize uint32
+	// Cipher selected for SMB 3.1.1, 0 when encryption is not negotiated
+	Cipher uint16
+	// Signing algorithm, HMAC_SHA256 for SMB 2.x and AES_CMAC for SMB 3.x
+	// unless SMB 3.1.1 negotiated another one
+	SigningAlgorithm uint16
+	// Compression algorithm selected for SMB 3.1.1, CompressionNone unless
+	// Options.Compression is set
+	CompressionAlgorithm uint16
+	SystemTime           time.Time // Zero when the server did not send its time
+	ServerStartTime      time.Time // Zero for most servers
+}
+
+// recordNegotiateRes records the description of the server from the
+// negotiate response
+func (c *Connection) recordNegotiateRes(res *NegotiateRes) {
+	c.serverGuid = append([]byte(nil), res.ServerGuid...)
+	c.serverCapabilities = res.Capabilities
+	c.serverStartTime = res.ServerStartupTime()
+	c.recordServerTime(res.ServerSystemTime())
+}
+
+// ServerInfo returns the description of the server and the parameters
+// negotiated with it. The sizes are those used by the connection, which
+// may be lower than advertised because of quirks.
+func (c *Connection) ServerInfo() ServerInfo {
+	return ServerInfo{
+		Dialect:              c.dialect,
+		ServerGuid:           append([]byte(nil), c.serverGuid...),
+		SecurityMode:         c.securityMode,
+		Capabilities:         c.serverCapabilities,
+		MaxReadSize:          c.maxReadSize,
+		MaxWriteSize:         c.maxWriteSize,
+		MaxTransactSize:      c.maxTransactSize,
+		Cipher:               c.cipherId,
+		SigningAlgorithm:     c.signingId,
+		CompressionAlgorithm: c.compressionId,
+		SystemTime:           c.serverTime,
+		ServerStartTime:      c.serverStartTime,
+	}
+}
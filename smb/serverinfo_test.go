@@ -0,0 +1,39 @@
+package smb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+)
+
+func TestServerInfo(t *testing.T) {
+	c := &Connection{Session: &Session{dialect: DialectSmb_3_1_1, securityMode: SecurityModeSigningEnabled, maxReadSize: 65536}, cipherId: AES128GCM, signingId: AES_GMAC}
+	guid := bytes.Repeat([]byte{7}, 16)
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	c.recordNegotiateRes(&NegotiateRes{
+		ServerGuid:      guid,
+		Capabilities:    GlobalCapLargeMTU | GlobalCapLeasing,
+		SystemTime:      msdtyp.TimeToFiletime(time.Now()),
+		ServerStartTime: msdtyp.TimeToFiletime(started),
+	})
+	guid[0] = 0
+
+	info := c.ServerInfo()
+	if info.Dialect != DialectSmb_3_1_1 || info.SecurityMode != SecurityModeSigningEnabled || info.MaxReadSize != 65536 {
+		t.Fatalf("Fail: %+v", info)
+	}
+	if info.Cipher != AES128GCM || info.SigningAlgorithm != AES_GMAC || info.CompressionAlgorithm != CompressionNone {
+		t.Fatalf("Fail: %+v", info)
+	}
+	if !bytes.Equal(info.ServerGuid, bytes.Repeat([]byte{7}, 16)) || info.Capabilities != GlobalCapLargeMTU|GlobalCapLeasing {
+		t.Fatalf("Fail: %+v", info)
+	}
+	if !info.ServerStartTime.Equal(started) || info.SystemTime.IsZero() {
+		t.Fatalf("Fail: %+v", info)
+	}
+	if skew, ok := c.ClockSkew(); !ok || skew != 0 {
+		t.Fatalf("Fail: %v", skew)
+	}
+}
@@ -24,7 +24,6 @@ package smb
 
 import (
 	"bytes"
-	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
 	"crypto/rand"
@@ -42,14 +41,16 @@ import (
 	"time"
 
 	"github.com/ericblavier/go-smb/gss"
+	"github.com/ericblavier/go-smb/msdtyp"
 	"github.com/ericblavier/go-smb/ntlmssp"
-	"github.com/ericblavier/go-smb/smb/crypto/ccm"
-	"github.com/ericblavier/go-smb/smb/crypto/cmac"
 	"github.com/ericblavier/go-smb/smb/encoder"
 	"github.com/ericblavier/go-smb/spnego"
 	"golang.org/x/net/proxy"
 )
 
+// Number of WRITE requests kept in flight unless Options.WriteWindow is set
+const defaultWriteWindow = 8
+
 type File struct {
 	*Connection
 	FileMetadata
@@ -57,6 +58,12 @@ type File struct {
 	fd       []byte
 	share    string
 	filename string
+	pos      int64      // Position used by Read, Write and Seek
+	ra       *readAhead // Created by the first Read
+	wb       []byte     // Data buffered by Write, see SetWriteBuffer
+	wbOff    int64      // File offset of wb
+	// Create contexts of the CREATE response
+	createContexts []CreateContext
 }
 
 type FileMetadata struct {
@@ -69,6 +76,26 @@ type FileMetadata struct {
 	EndOfFile      uint64
 }
 
+// Created returns the CreationTime of the file as a time.Time
+func (self *FileMetadata) Created() time.Time {
+	return msdtyp.FiletimeToTime(self.CreationTime)
+}
+
+// Accessed returns the LastAccessTime of the file as a time.Time
+func (self *FileMetadata) Accessed() time.Time {
+	return msdtyp.FiletimeToTime(self.LastAccessTime)
+}
+
+// Modified returns the LastWriteTime of the file as a time.Time
+func (self *FileMetadata) Modified() time.Time {
+	return msdtyp.FiletimeToTime(self.LastWriteTime)
+}
+
+// Changed returns the ChangeTime of the file as a time.Time
+func (self *FileMetadata) Changed() time.Time {
+	return msdtyp.FiletimeToTime(self.ChangeTime)
+}
+
 // Information extracted from the SessionSetup handshake
 type TargetInfo struct {
 	DnsComputerName  string
@@ -86,10 +113,12 @@ type Session struct {
 	supportsEncryption  bool
 	clientGuid          []byte
 	securityMode        uint16
-	messageID           uint64
-	sessionID           uint64 // Does this need to be atomic?
-	credits             uint64
+	messageID           atomic.Uint64
+	sessionID           uint64       // Does this need to be atomic?
+	credits             atomic.Int64 // Estimate of credits granted but not yet consumed
 	sessionFlags        uint16
+	channelSequence     atomic.Uint32 // ChannelSequence of SMB 3.x requests
+	replaying           atomic.Bool   // Requests are flagged as replays
 	supportsMultiCredit bool
 	//SequenceWindow            uint64
 	maxReadSize               uint32
@@ -101,16 +130,26 @@ type Session struct {
 	// such as to encrypt a password parameter
 	applicationKey []byte // SMB 3.X only
 	signer         hash.Hash
+	signerLock     sync.Mutex // Requests are signed concurrently
 	verifier       hash.Hash
 	encrypter      cipher.AEAD
 	decrypter      cipher.AEAD
 	conn           net.Conn
 	dialect        uint16
+	smb1Dialect    string    // SMBv1 dialect selected by the server with Options.ForceSMB1
+	serverTime     time.Time // SystemTime of the negotiate response
+	negotiatedAt   time.Time // Local time the negotiate response was received
 	options        Options
 	trees          map[string]uint32
 	lock           sync.RWMutex
 	authUsername   string // Combined domain and username as sent in SessionSetup2 request
 	targetInfo     *TargetInfo
+	authFindings   []AuthFinding // Recorded with Options.AuthDiagnostics
+
+	// Description of the server from the negotiate response
+	serverGuid         []byte
+	serverCapabilities uint32
+	serverStartTime    time.Time
 }
 
 type Options struct {
@@ -125,11 +164,68 @@ type Options struct {
 	RequireMessageSigning bool
 	DisableEncryption     bool
 	ForceSMB2             bool
+	DisableSMB1           bool // Negotiate with a SMB2 NEGOTIATE only, never sending a SMB1 NEGOTIATE on the wire
+	ForceSMB1             bool // Offer only SMBv1 dialects. SMBv1 sessions are not implemented, so ManualLogin is required
 	Initiator             gss.Mechanism
 	DialTimeout           time.Duration
 	ProxyDialer           proxy.Dialer
 	RelayPort             int
 	ManualLogin           bool
+	FastReconnect         bool   // Skip the multi-protocol negotiation for servers that recently negotiated SMB2
+	WriteWindow           int    // Max WRITE requests in flight for PutFile and WriteAt. Defaults to 8
+	ReadAheadDepth        int    // Chunks prefetched by File.Read on sequential access. Read-ahead is disabled unless positive
+	ReadAheadSize         int    // Size of each prefetched chunk. Defaults to MaxReadSize capped at 1MiB
+	Compression           bool   // Negotiate SMB 3.1.1 compression with Plain LZ77
+	CompressionThreshold  int    // Messages smaller than this are sent uncompressed. Defaults to 4096
+	NetBIOSName           string // Called name of the NetBIOS session request sent on port 139. Defaults to *SMBSERVER
+	Quirks                Quirks // Server quirks to work around in addition to the detected ones
+	DisableQuirkDetection bool   // Only work around the quirks set in Quirks
+	MacOSExtensions       bool   // Negotiate the Apple extensions of macOS servers with the AAPL create context
+
+	// Backoff when the server is overloaded. Requests rejected with
+	// StatusInsufficientResources or StatusRequestNotAccepted are retried and
+	// fewer requests are kept in flight, as when too few credits are granted.
+	// ThrottleRetries of 0 selects the default of 5 retries. NoThrottleRetry or
+	// any other negative value disables retrying: the throttled request fails
+	// with the status of the server after OnThrottle is called once.
+	ThrottleRetries int                 // Retries of requests rejected by a busy server. Defaults to 5, NoThrottleRetry disables retrying
+	ThrottleBackoff time.Duration       // Delay before the first retry, doubled for each further retry. Defaults to 100ms
+	OnThrottle      func(ThrottleEvent) // Called for each throttling signal, e.g., to log or count them
+
+	// Called when the negotiate response selects a dialect or algorithm
+	// that was not offered or has malformed negotiate contexts. Returning
+	// nil continues the negotiation. Without it the negotiation is aborted
+	// with the DowngradeError.
+	OnDowngrade func(*DowngradeError) error
+
+	// Return an AccessDeniedError with the access granted by the server and
+	// the security descriptor of the share when OpenFileExt is denied access.
+	// Costs up to two additional CREATE requests per denied open.
+	AccessDeniedDiagnostics bool
+
+	// Security QoS of the opens made by the library, such as by OpenFile,
+	// ListDirectory and OpenPipe. Opens with OpenFileExt use the values of
+	// the CreateReqOpts instead.
+	ImpersonationLevel *uint32 // Defaults to ImpersonationLevelImpersonation
+	SecurityFlags      byte    // Reserved by MS-SMB2 and thus 0 unless testing servers
+
+	// Record the security relevant observations of the session setup, such
+	// as what allows relaying NTLM to the server, for AuthFindings. Each
+	// AuthFinding is also passed to OnAuthFinding, which receives them even
+	// when the authentication fails.
+	AuthDiagnostics bool
+	OnAuthFinding   func(AuthFinding)
+
+	// Append the keys of each session to this file in the format of the
+	// smb2_seskey_list file of Wireshark, to decrypt captures of the traffic
+	// of the library when debugging. Defaults to $SMBKEYLOGFILE. Anyone
+	// reading the file can decrypt the sessions.
+	KeyLogFile string
+
+	// Decode the messages of the server with encoder.UnmarshalStrict, which
+	// rejects counts, lengths and offsets that are inconsistent with the rest
+	// of the message rather than decoding as much as possible
+	StrictBounds bool
 }
 
 func validateOptions(opt Options) error {
@@ -142,17 +238,31 @@ func validateOptions(opt Options) error {
 	if opt.Initiator == nil && !opt.ManualLogin {
 		return fmt.Errorf("Initiator empty")
 	}
+	if opt.ForceSMB1 && (opt.DisableSMB1 || opt.ForceSMB2) {
+		return fmt.Errorf("ForceSMB1 can't be combined with DisableSMB1 or ForceSMB2")
+	}
+	if opt.ForceSMB1 && !opt.ManualLogin {
+		return fmt.Errorf("ForceSMB1 requires ManualLogin as SMBv1 sessions are not implemented")
+	}
+	if opt.ImpersonationLevel != nil && *opt.ImpersonationLevel > ImpersonationLevelDelegate {
+		return fmt.Errorf("Invalid ImpersonationLevel: %d", *opt.ImpersonationLevel)
+	}
+	if opt.SecurityFlags&^(SecurityFlagContextTracking|SecurityFlagEffectiveOnly) != 0 {
+		return fmt.Errorf("Invalid SecurityFlags: 0x%x", opt.SecurityFlags)
+	}
 	return nil
 }
 
 type CreateReqOpts struct {
 	OpLockLevel        byte
 	ImpersonationLevel uint32
+	SecurityFlags      byte // Security QoS flags, e.g., SecurityFlagEffectiveOnly
 	DesiredAccess      uint32
 	FileAttr           uint32
 	ShareAccess        uint32
 	CreateDisp         uint32
 	CreateOpts         uint32
+	CreateContexts     []CreateContext
 }
 
 func NewCreateReqOpts() *CreateReqOpts {
@@ -166,6 +276,34 @@ func NewCreateReqOpts() *CreateReqOpts {
 	}
 }
 
+// unmarshal decodes a message from the server, with strict bounds checking
+// if enabled by Options.StrictBounds
+func (s *Session) unmarshal(buf []byte, v interface{}) error {
+	if s.options.StrictBounds {
+		return encoder.UnmarshalStrict(buf, v)
+	}
+	return encoder.Unmarshal(buf, v)
+}
+
+// createReqOpts returns the options of NewCreateReqOpts with the
+// impersonation level and security flags of the session, for the opens
+// made by the library
+func (s *Session) createReqOpts() *CreateReqOpts {
+	opts := NewCreateReqOpts()
+	opts.ImpersonationLevel = s.impersonationLevel()
+	opts.SecurityFlags = s.options.SecurityFlags
+	return opts
+}
+
+// impersonationLevel returns the impersonation level of the opens made by
+// the library
+func (s *Session) impersonationLevel() uint32 {
+	if s.options.ImpersonationLevel != nil {
+		return *s.options.ImpersonationLevel
+	}
+	return ImpersonationLevelImpersonation
+}
+
 func (s *Session) GetSessionKey() []byte {
 	if s.dialect >= DialectSmb_3_0 {
 		return s.applicationKey
@@ -181,6 +319,17 @@ func (s *Session) IsSigningRequired() bool {
 	return s.isSigningRequired.Load()
 }
 
+// GetDialect returns the negotiated SMB dialect
+func (s *Session) GetDialect() uint16 {
+	return s.dialect
+}
+
+// SMB1Dialect returns the SMBv1 dialect selected by the server, e.g.,
+// "NT LM 0.12", when negotiated with Options.ForceSMB1
+func (s *Session) SMB1Dialect() string {
+	return s.smb1Dialect
+}
+
 func (c *Connection) IsSigningSupported() bool {
 	mode := uint16(c.securityMode)
 	return (mode & SecurityModeSigningEnabled) > 0
@@ -194,6 +343,16 @@ func (c *Connection) NegotiateProtocol() error {
 	var rr *requestResponse
 	var negRes NegotiateRes
 
+	if c.options.DisableSMB1 {
+		// Some IDS rules alert on any SMB1 NEGOTIATE
+		return c.negotiateSMB2()
+	}
+	if c.options.FastReconnect && !c.options.ForceSMB1 && negotiateCached(c.options.Host, c.options.Port) {
+		// Skip the multi-protocol negotiation round trip for a server that
+		// is known to support SMB2
+		return c.negotiateSMB2()
+	}
+
 	negReq1, err := c.NewSMB1NegotiateReq()
 	if err != nil {
 		log.Errorln(err)
@@ -218,10 +377,11 @@ func (c *Connection) NegotiateProtocol() error {
 		log.Debugln("Received SMB1 negotiate response, parsing to check supported dialects")
 
 		negRes1SMB := SMB1NegotiateRes{}
-		if err := encoder.Unmarshal(negResBuf, &negRes1SMB); err != nil {
+		if err := c.unmarshal(negResBuf, &negRes1SMB); err != nil {
 			log.Debugf("Error parsing SMB1 negotiate response: %v\nRaw:\n%v\n", err, hex.Dump(negResBuf))
 			return err
 		}
+		c.recordServerTime(negRes1SMB.ServerSystemTime())
 
 		// Check if server selected an SMB2 dialect
 		if negRes1SMB.DialectIndex == 0xFFFF {
@@ -277,6 +437,11 @@ func (c *Connection) NegotiateProtocol() error {
 				"PC NETWORK PROGRAM 1.0", "LANMAN1.0", "Windows for Workgroups 3.1a",
 				"LM1.2X002", "LANMAN2.1", "NT LM 0.12",
 			}
+			if c.options.ForceSMB1 && negRes1SMB.DialectIndex < uint16(len(dialectNames)) {
+				c.smb1Dialect = dialectNames[negRes1SMB.DialectIndex]
+				log.Debugf("Server selected SMBv1 dialect %s\n", c.smb1Dialect)
+				return nil
+			}
 			if negRes1SMB.DialectIndex < uint16(len(dialectNames)) {
 				err = fmt.Errorf("Target %s selected SMBv1 dialect '%s' (index %d), but SMBv1 support is not implemented",
 					c.conn.RemoteAddr().String(), dialectNames[negRes1SMB.DialectIndex], negRes1SMB.DialectIndex)
@@ -291,7 +456,11 @@ func (c *Connection) NegotiateProtocol() error {
 
 	negRes1 := NewNegotiateRes()
 	log.Debugln("Unmarshalling NegotiateProtocol response")
-	if err := encoder.Unmarshal(negResBuf, &negRes1); err != nil {
+	if err := checkSecurityBlob(negResBuf); err != nil {
+		log.Errorln(err)
+		return err
+	}
+	if err := c.unmarshal(negResBuf, &negRes1); err != nil {
 		log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(negResBuf))
 		return err
 	}
@@ -315,11 +484,19 @@ func (c *Connection) NegotiateProtocol() error {
 			err = fmt.Errorf("Server responded to the multi-protocol negotiation with an invalid DialectRevision of 0x%x, but expected a valid SMB2 dialect. Restarting protocol negotiation using SMB2.\n", negRes1.DialectRevision)
 			log.Errorln(err)
 		} else if negRes1.DialectRevision != DialectSmb2_ALL {
+			if negRes1.DialectRevision > DialectSmb_2_1 {
+				// Only SMB 2.002 and SMB 2.100 are offered in the SMB1 NEGOTIATE
+				e := &DowngradeError{Reason: "dialect not offered", Offered: []uint16{DialectSmb_2_0_2, DialectSmb_2_1}, Selected: []uint16{negRes1.DialectRevision}}
+				if err = c.checkDowngrade(e); err != nil {
+					return err
+				}
+			}
 			// Server selected a specific SMB2 dialect - this is the successful case!
 			log.Debugf("Server selected SMB2 dialect 0x%x via multi-protocol negotiation", negRes1.DialectRevision)
 			// Negotiation is complete! The server has selected a valid SMB2 dialect
 			c.dialect = negRes1.DialectRevision
 			c.securityMode = negRes1.SecurityMode
+			c.recordNegotiateRes(&negRes1)
 
 			// Set up basic negotiation completion
 			log.Debugf("Multi-protocol negotiation successful with SMB2 dialect 0x%x", negRes1.DialectRevision)
@@ -375,7 +552,11 @@ func (c *Connection) NegotiateProtocol() error {
 
 		negRes = NewNegotiateRes()
 		log.Debugln("Unmarshalling second NegotiateProtocol response")
-		if err := encoder.Unmarshal(negResBuf, &negRes); err != nil {
+		if err := checkSecurityBlob(negResBuf); err != nil {
+			log.Errorln(err)
+			return err
+		}
+		if err := c.unmarshal(negResBuf, &negRes); err != nil {
 			log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(negResBuf))
 			return err
 		}
@@ -385,6 +566,48 @@ func (c *Connection) NegotiateProtocol() error {
 		return err
 	}
 
+	return c.handleNegotiateRes(rr, negRes, negResBuf)
+}
+
+// negotiateSMB2 negotiates the protocol with a single SMB2 NEGOTIATE request
+func (c *Connection) negotiateSMB2() error {
+	negReq, err := c.NewNegotiateReq()
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	log.Debugln("Sending SMB2 NegotiateProtocol request")
+	rr, err := c.send(negReq)
+	if err != nil {
+		log.Debugln(err)
+		return err
+	}
+
+	negResBuf, err := c.recv(rr)
+	if err != nil {
+		forgetNegotiate(c.options.Host, c.options.Port)
+		log.Debugln(err)
+		return err
+	}
+
+	negRes := NewNegotiateRes()
+	log.Debugln("Unmarshalling NegotiateProtocol response")
+	if err := checkSecurityBlob(negResBuf); err != nil {
+		forgetNegotiate(c.options.Host, c.options.Port)
+		log.Errorln(err)
+		return err
+	}
+	if err := c.unmarshal(negResBuf, &negRes); err != nil {
+		forgetNegotiate(c.options.Host, c.options.Port)
+		log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(negResBuf))
+		return err
+	}
+	return c.handleNegotiateRes(rr, negRes, negResBuf)
+}
+
+// handleNegotiateRes applies the response to a SMB2 NEGOTIATE request sent
+// with rr
+func (c *Connection) handleNegotiateRes(rr *requestResponse, negRes NegotiateRes, negResBuf []byte) (err error) {
 	if negRes.Header.Status != StatusOk {
 		status, found := StatusMap[negRes.Header.Status]
 		if !found {
@@ -395,6 +618,11 @@ func (c *Connection) NegotiateProtocol() error {
 		log.Debugf("NT Status Error: %v\n", status)
 		return status
 	}
+	if e := c.validateNegotiateRes(&negRes); e != nil {
+		if err = c.checkDowngrade(e); err != nil {
+			return err
+		}
+	}
 
 	oid := negRes.SecurityBlob.OID
 	if !oid.Equal(gss.SpnegoOid) {
@@ -418,6 +646,10 @@ func (c *Connection) NegotiateProtocol() error {
 
 	c.securityMode = negRes.SecurityMode
 	c.dialect = negRes.DialectRevision
+	c.recordNegotiateRes(&negRes)
+	if c.options.FastReconnect {
+		rememberNegotiate(c.options.Host, c.options.Port)
+	}
 
 	// Determine whether signing is required
 	mode := uint16(c.securityMode)
@@ -447,6 +679,7 @@ func (c *Connection) NegotiateProtocol() error {
 	c.maxReadSize = negRes.MaxReadSize
 	c.maxWriteSize = negRes.MaxWriteSize
 	c.maxTransactSize = negRes.MaxTransactSize
+	c.detectQuirks(transactQuirks(negRes.MaxTransactSize))
 
 	if c.dialect != DialectSmb_3_1_1 {
 		return nil
@@ -458,7 +691,7 @@ func (c *Connection) NegotiateProtocol() error {
 		switch context.ContextType {
 		case PreauthIntegrityCapabilities:
 			pic := PreauthIntegrityContext{}
-			err = encoder.Unmarshal(context.Data, &pic)
+			err = c.unmarshal(context.Data, &pic)
 			if err != nil {
 				log.Errorln(err)
 				return err
@@ -474,7 +707,7 @@ func (c *Connection) NegotiateProtocol() error {
 			case SHA512:
 				h := sha512.New()
 				h.Write(c.preauthIntegrityHashValue[:])
-				h.Write(rr.pkt)
+				rr.writePacket(h)
 				h.Sum(c.preauthIntegrityHashValue[:0])
 
 				h.Reset()
@@ -489,7 +722,7 @@ func (c *Connection) NegotiateProtocol() error {
 			}
 		case EncryptionCapabilities:
 			ec := EncryptionContext{}
-			err = encoder.Unmarshal(context.Data, &ec)
+			err = c.unmarshal(context.Data, &ec)
 			if err != nil {
 				log.Errorln(err)
 				return err
@@ -501,6 +734,9 @@ func (c *Connection) NegotiateProtocol() error {
 			}
 			c.cipherId = ec.Ciphers[0]
 			switch c.cipherId {
+			case 0:
+				// None of the offered ciphers is supported
+				continue
 			case AES128GCM:
 			case AES256GCM:
 			case AES128CCM:
@@ -514,7 +750,7 @@ func (c *Connection) NegotiateProtocol() error {
 
 		case SigningCapabilities: // Only supported by Windows 11/Window Server 2022 and later
 			sc := SigningContext{}
-			err = encoder.Unmarshal(context.Data, &sc)
+			err = c.unmarshal(context.Data, &sc)
 			if err != nil {
 				log.Errorln(err)
 				return err
@@ -536,6 +772,23 @@ func (c *Connection) NegotiateProtocol() error {
 
 			foundSigningContext = true
 
+		case CompressionCapabilities:
+			cc := CompressionContext{}
+			err = c.unmarshal(context.Data, &cc)
+			if err != nil {
+				log.Errorln(err)
+				return err
+			}
+			// The server lists the offered algorithms it supports
+			for _, algorithm := range cc.CompressionAlgorithms {
+				if algorithm == CompressionLZ77 && c.options.Compression {
+					c.compressionId = algorithm
+				}
+			}
+
+		case PosixExtensionsAvailable:
+			c.detectQuirks(QuirkUnixExtensions)
+
 		default:
 			log.Debugf("Unsupported context type (%d)\n", context.ContextType)
 		}
@@ -548,11 +801,55 @@ func (c *Connection) NegotiateProtocol() error {
 	return nil
 }
 
+// newTargetInfo extracts the names and OS version of the server from an NTLM
+// challenge
+func newTargetInfo(challenge *ntlmssp.Challenge) *TargetInfo {
+	var err error
+	// Extract target info from server Challange
+	versionBuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(versionBuf, challenge.Version)
+	buildNumber := binary.LittleEndian.Uint16(versionBuf[2:4])
+	info := &TargetInfo{
+		OS:               challenge.Version,
+		GuessedOSVersion: fmt.Sprintf("Windows NT %d.%d Build %d", versionBuf[0], versionBuf[1], buildNumber),
+	}
+	if isSambaVersion(challenge.Version) {
+		info.GuessedOSVersion = "Samba"
+	}
+	for _, av := range *challenge.TargetInfo {
+		switch av.AvID {
+		case ntlmssp.MsvAvDnsDomainName:
+			info.DnsDomainName, err = encoder.FromUnicodeString(av.Value)
+			if err != nil {
+				log.Errorf("Failed to decode DNS Domain Name from AV Pair with error: %s\n", err)
+			}
+		case ntlmssp.MsvAvDnsComputerName:
+			info.DnsComputerName, err = encoder.FromUnicodeString(av.Value)
+			if err != nil {
+				log.Errorf("Failed to decode DNS Computer Name from AV Pair with error: %s\n", err)
+			}
+		case ntlmssp.MsvAvNbDomainName:
+			info.NBDomainName, err = encoder.FromUnicodeString(av.Value)
+			if err != nil {
+				log.Errorf("Failed to decode NB Domain Name from AV Pair with error: %s\n", err)
+			}
+		case ntlmssp.MsvAvNbComputerName:
+			info.NBComputerName, err = encoder.FromUnicodeString(av.Value)
+			if err != nil {
+				log.Errorf("Failed to decode NB Computer Name from AV Pair with error: %s\n", err)
+			}
+		default:
+		}
+	}
+	return info
+}
+
 func (c *Connection) SessionSetup() error {
 	// Make sure to reset relevant options to allow multiple logins
 	c.disableSession()
 	c.sessionID = 0
 	c.isAuthenticated = false
+	c.authFindings = nil
 
 	spnegoClient, err := spnego.NewClient([]gss.Mechanism{c.options.Initiator})
 	if err != nil {
@@ -587,54 +884,31 @@ func (c *Connection) SessionSetup() error {
 	}
 
 	log.Debugln("Unmarshalling SessionSetup1 response")
-	if err := encoder.Unmarshal(ssresbuf, &ssres); err != nil {
+	if err := checkSecurityBlob(ssresbuf); err != nil {
+		log.Errorln(err)
+		return err
+	}
+	if err := c.unmarshal(ssresbuf, &ssres); err != nil {
 		log.Debugln(err)
 		return err
 	}
 
 	resp := ssres.SecurityBlob
+	var challenge *ntlmssp.Challenge
 	// Extracting target info only works for NTLMSSP and not for Kerberos
 	if resp.SupportedMech.Equal(gss.NtLmSSPMechTypeOid) {
-		challenge := ntlmssp.NewChallenge()
-		if err := encoder.Unmarshal(resp.ResponseToken, &challenge); err != nil {
+		chall := ntlmssp.NewChallenge()
+		if err := c.unmarshal(resp.ResponseToken, &chall); err != nil {
 			log.Debugln(err)
 			return err
 		}
-
-		// Extract target info from server Challange
-		versionBuf := make([]byte, 8)
-		binary.LittleEndian.PutUint64(versionBuf, challenge.Version)
-		buildNumber := binary.LittleEndian.Uint16(versionBuf[2:4])
-		c.targetInfo = &TargetInfo{
-			OS:               challenge.Version,
-			GuessedOSVersion: fmt.Sprintf("Windows NT %d.%d Build %d", versionBuf[0], versionBuf[1], buildNumber),
-		}
-		for _, av := range *challenge.TargetInfo {
-			switch av.AvID {
-			case ntlmssp.MsvAvDnsDomainName:
-				c.targetInfo.DnsDomainName, err = encoder.FromUnicodeString(av.Value)
-				if err != nil {
-					log.Errorf("Failed to decode DNS Domain Name from AV Pair with error: %s\n", err)
-				}
-			case ntlmssp.MsvAvDnsComputerName:
-				c.targetInfo.DnsComputerName, err = encoder.FromUnicodeString(av.Value)
-				if err != nil {
-					log.Errorf("Failed to decode DNS Computer Name from AV Pair with error: %s\n", err)
-				}
-			case ntlmssp.MsvAvNbDomainName:
-				c.targetInfo.NBDomainName, err = encoder.FromUnicodeString(av.Value)
-				if err != nil {
-					log.Errorf("Failed to decode NB Domain Name from AV Pair with error: %s\n", err)
-				}
-			case ntlmssp.MsvAvNbComputerName:
-				c.targetInfo.NBComputerName, err = encoder.FromUnicodeString(av.Value)
-				if err != nil {
-					log.Errorf("Failed to decode NB Computer Name from AV Pair with error: %s\n", err)
-				}
-			default:
-			}
+		challenge = &chall
+		c.targetInfo = newTargetInfo(challenge)
+		if isSambaVersion(challenge.Version) {
+			c.detectQuirks(quirksSamba)
 		}
 	}
+	c.diagnoseAuth(&ssreq, challenge)
 
 	if (ssres.Header.Status != StatusMoreProcessingRequired) && (ssres.Header.Status != StatusOk) {
 		status, found := StatusMap[ssres.Header.Status]
@@ -655,9 +929,13 @@ func (c *Connection) SessionSetup() error {
 			log.Errorln(err)
 			return err
 		} else if ssres.Flags&SessionFlagIsNull != 0 {
-			err = fmt.Errorf("anonymous account doesn't support signing")
-			log.Errorln(err)
-			return err
+			if c.Quirks()&QuirkUnsignedAnonymous == 0 {
+				err = fmt.Errorf("anonymous account doesn't support signing")
+				log.Errorln(err)
+				return err
+			}
+			log.Debugln("Continuing the anonymous session unsigned although the server requires signing")
+			c.isSigningRequired.Store(false)
 		}
 	}
 
@@ -676,7 +954,7 @@ func (c *Connection) SessionSetup() error {
 		case SHA512:
 			h := sha512.New()
 			h.Write(c.Session.preauthIntegrityHashValue[:])
-			h.Write(rr.pkt)
+			rr.writePacket(h)
 			h.Sum(c.Session.preauthIntegrityHashValue[:0])
 
 			if ssres.Header.Status == StatusMoreProcessingRequired {
@@ -736,7 +1014,11 @@ func (c *Connection) SessionSetup() error {
 		log.Debugln("Unmarshalling SessionSetup2 response header")
 
 		var authResp Header
-		if err := encoder.Unmarshal(ss2resbuf, &authResp); err != nil {
+		if err := checkSecurityBlob(ss2resbuf); err != nil {
+			log.Errorln(err)
+			return err
+		}
+		if err := c.unmarshal(ss2resbuf, &authResp); err != nil {
 			log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(ss2resbuf))
 			return err
 		}
@@ -757,7 +1039,7 @@ func (c *Connection) SessionSetup() error {
 			log.Debugln(err)
 			return err
 		}
-		if err := encoder.Unmarshal(ss2resbuf, &ssres2); err != nil {
+		if err := c.unmarshal(ss2resbuf, &ssres2); err != nil {
 			log.Debugln(err)
 			return err
 		}
@@ -801,6 +1083,7 @@ func (c *Connection) SessionSetup() error {
 				c.Session.signer = hmac.New(sha256.New, sessionKey)
 				c.Session.verifier = hmac.New(sha256.New, sessionKey)
 			}
+			c.logSessionKeys(sessionKey, SessionKeys{})
 		case DialectSmb_3_1_1:
 			switch c.preauthIntegrityHashId {
 			case SHA512:
@@ -809,99 +1092,44 @@ func (c *Connection) SessionSetup() error {
 					// Make sure to only perform the below steps for Kerberos if MoreProcessing was required
 					h := sha512.New()
 					h.Write(c.Session.preauthIntegrityHashValue[:])
-					h.Write(rr.pkt)
+					rr.writePacket(h)
 					h.Sum(c.Session.preauthIntegrityHashValue[:0])
 				}
 			}
 
 			// SMB 3.1.1 requires either signing or encryption of requests, so can't disable signing.
-			// Signingkey is always 128bit
-			signingKey := kdf(sessionKey, []byte("SMBSigningKey\x00"), c.Session.preauthIntegrityHashValue[:], 128)
-
-			switch c.signingId {
-			case AES_CMAC:
-				c.Session.signer, err = cmac.New(signingKey)
-				if err != nil {
-					log.Errorln(err)
-					return err
-				}
-				c.Session.verifier, err = cmac.New(signingKey)
-				if err != nil {
-					log.Errorln(err)
-					return err
-				}
-			default:
+			if c.signingId != AES_CMAC {
 				err = fmt.Errorf("Unknown signing algorithm (%d) not implemented", c.signingId)
 				log.Errorln(err)
 				return err
 			}
-
-			// Determine size of L variable for the KDF
-			var l uint32
-			switch c.cipherId {
-			case AES128GCM:
-				l = 128
-			case AES128CCM:
-				l = 128
-			case AES256CCM:
-				l = 256
-			case AES256GCM:
-				l = 256
-			default:
-				err = fmt.Errorf("Cipher algorithm (%d) not implemented", c.cipherId)
+			keys, err := DeriveSessionKeys(c.dialect, sessionKey, c.Session.preauthIntegrityHashValue[:], c.cipherId)
+			if err != nil {
 				log.Errorln(err)
 				return err
 			}
-
-			encryptionKey := kdf(sessionKey, []byte("SMBC2SCipherKey\x00"), c.Session.preauthIntegrityHashValue[:], l)
-			decryptionKey := kdf(sessionKey, []byte("SMBS2CCipherKey\x00"), c.Session.preauthIntegrityHashValue[:], l)
-
-			switch c.cipherId {
-			case AES128GCM, AES256GCM:
-				ciph, err := aes.NewCipher(encryptionKey)
-				if err != nil {
-					log.Errorln(err)
-					return err
-				}
-				c.Session.encrypter, err = cipher.NewGCMWithNonceSize(ciph, 12)
-				if err != nil {
-					log.Errorln(err)
-					return err
-				}
-
-				ciph, err = aes.NewCipher(decryptionKey)
-				if err != nil {
-					log.Errorln(err)
-					return err
-				}
-				c.Session.decrypter, err = cipher.NewGCMWithNonceSize(ciph, 12)
-				if err != nil {
-					log.Errorln(err)
-					return err
-				}
-				log.Debugln("Initialized encrypter and decrypter with GCM")
-			case AES128CCM, AES256CCM:
-				ciph, err := aes.NewCipher(encryptionKey)
-				if err != nil {
-					log.Errorln(err)
-					return err
-				}
-				c.Session.encrypter, err = ccm.NewCCMWithNonceAndTagSizes(ciph, 11, 16)
-				ciph, err = aes.NewCipher(decryptionKey)
-				if err != nil {
-					log.Errorln(err)
-					return err
-				}
-				c.Session.decrypter, err = ccm.NewCCMWithNonceAndTagSizes(ciph, 11, 16)
-				log.Debugln("Initialized encrypter and decrypter with CCM")
-			default:
-				err = fmt.Errorf("Cipher algorithm (%d) not implemented", c.cipherId)
+			c.Session.signer, err = newSigner(c.dialect, keys.SigningKey)
+			if err != nil {
 				log.Errorln(err)
 				return err
 			}
-
-			// Handle ApplicationKey
-			c.applicationKey = kdf(sessionKey, []byte("SMBAppKey\x00"), c.Session.preauthIntegrityHashValue[:], 128)
+			c.Session.verifier, err = newSigner(c.dialect, keys.SigningKey)
+			if err != nil {
+				log.Errorln(err)
+				return err
+			}
+			c.Session.encrypter, err = newCipher(c.cipherId, keys.EncryptionKey)
+			if err != nil {
+				log.Errorln(err)
+				return err
+			}
+			c.Session.decrypter, err = newCipher(c.cipherId, keys.DecryptionKey)
+			if err != nil {
+				log.Errorln(err)
+				return err
+			}
+			c.applicationKey = keys.ApplicationKey
+			c.logSessionKeys(sessionKey, keys)
 		}
 	}
 
@@ -926,7 +1154,7 @@ func (c *Connection) Logoff() error {
 
 	res := NewLogoffRes()
 	log.Debugln("Unmarshalling Logoff response")
-	if err := encoder.Unmarshal(buf, &res); err != nil {
+	if err := c.unmarshal(buf, &res); err != nil {
 		log.Debugln(err)
 		return err
 	}
@@ -950,26 +1178,40 @@ func (c *Connection) Logoff() error {
 }
 
 func (s *Session) sign(buf []byte) ([]byte, error) {
+	if err := s.signBuffers(net.Buffers{buf}); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// signBuffers signs a message split into segments where the first segment
+// contains the header
+func (s *Session) signBuffers(pkt net.Buffers) error {
+	buf := pkt[0]
 	var hdr Header
-	err := encoder.Unmarshal(buf[:64], &hdr)
+	err := s.unmarshal(buf[:64], &hdr)
 	if err != nil {
 		log.Errorln(err)
-		return nil, err
+		return err
 	}
 	hdr.Flags |= SMB2_FLAGS_SIGNED
 	hdr.Signature = make([]byte, 16)
 	hdrBuf, err := encoder.Marshal(hdr)
 	if err != nil {
 		log.Errorln(err)
-		return nil, err
+		return err
 	}
 	copy(buf[:64], hdrBuf[:64])
+	s.signerLock.Lock()
+	defer s.signerLock.Unlock()
 	h := s.signer
 	h.Reset()
-	h.Write(buf)
+	for _, p := range pkt {
+		h.Write(p)
+	}
 	copy(buf[48:64], h.Sum(nil))
 
-	return buf, nil
+	return nil
 }
 
 func (s *Session) verify(buf []byte) (ok bool) {
@@ -999,31 +1241,11 @@ func (s *Session) encrypt(buf []byte) ([]byte, error) {
 		log.Errorln(err)
 		return nil, err
 	}
-	tHdr := NewTransformHeader()
-	copy(tHdr.Nonce, nonce)
-	tHdr.OriginalMessageSize = uint32(len(buf))
-	tHdr.SessionId = s.sessionID
-	tHdrBytes, err := encoder.Marshal(tHdr)
-	if err != nil {
-		log.Errorln(err)
-		return nil, err
-	}
-	ciphertext := make([]byte, 0)
-	ciphertext = s.encrypter.Seal(nil, nonce, buf, tHdrBytes[20:52])
-	copy(tHdrBytes[4:20], ciphertext[len(ciphertext)-16:])
-	return append(tHdrBytes, ciphertext[:len(ciphertext)-16]...), nil
+	return sealMessage(s.encrypter, nonce, s.sessionID, buf)
 }
 
 func (s *Session) decrypt(buf []byte) ([]byte, error) {
-	tHdr := NewTransformHeader()
-	err := encoder.Unmarshal(buf[:52], &tHdr)
-	if err != nil {
-		log.Errorln(err)
-		return nil, err
-	}
-	ciphertext := append(buf[52:], tHdr.Signature...)
-	// Not sure where it is specified that part of the transform header is used as AdditionalData
-	return s.decrypter.Open(ciphertext[:0], tHdr.Nonce[:s.decrypter.NonceSize()], ciphertext, buf[20:52])
+	return openMessage(s.decrypter, buf)
 }
 
 func (c *Connection) GetAuthUsername() string {
@@ -1058,7 +1280,7 @@ func (c *Connection) TreeConnect(name string) error {
 
 	var resHeader Header
 	log.Debugf("Unmarshalling TreeConnect response Header [%s]\n", name)
-	if err := encoder.Unmarshal(buf[:64], &resHeader); err != nil {
+	if err := c.unmarshal(buf[:64], &resHeader); err != nil {
 		log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(buf))
 		return err
 	}
@@ -1071,7 +1293,7 @@ func (c *Connection) TreeConnect(name string) error {
 	var res TreeConnectRes
 
 	log.Debugf("Unmarshalling TreeConnect response [%s]\n", name)
-	if err := encoder.Unmarshal(buf, &res); err != nil {
+	if err := c.unmarshal(buf, &res); err != nil {
 		log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(buf))
 		return err
 	}
@@ -1087,7 +1309,6 @@ func (c *Connection) TreeConnect(name string) error {
 		return status
 	}
 	c.trees[name] = res.Header.TreeID
-	c.credits += uint64(res.Header.Credits) // Add granted credits
 
 	log.Debugf("Completed TreeConnect [%s]\n", name)
 	return nil
@@ -1126,7 +1347,7 @@ func (c *Connection) TreeDisconnect(name string) error {
 	}
 	log.Debugf("Unmarshalling TreeDisconnect response for [%s]\n", name)
 	var res TreeDisconnectRes
-	if err := encoder.Unmarshal(buf, &res); err != nil {
+	if err := c.unmarshal(buf, &res); err != nil {
 		log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(buf))
 		return err
 	}
@@ -1159,6 +1380,11 @@ func (f *File) CloseFile() error {
 		// Already closed
 		return nil
 	}
+	if f.ra != nil {
+		// Don't close the handle under outstanding prefetches
+		f.ra.reset()
+	}
+	flushErr := f.Flush()
 	log.Debugf("Sending Close request [%s] for fileid [%x]\n", f.share, f.fd)
 	req, err := f.NewCloseReq(f.share, f.fd)
 	if err != nil {
@@ -1171,9 +1397,10 @@ func (f *File) CloseFile() error {
 		log.Debugln(err)
 		return err
 	}
+	defer encoder.PutBuffer(buf)
 	var res CloseRes
 	log.Debugf("Unmarshalling Close response [%s] for fileid [%x]\n", f.share, f.fd)
-	if err := encoder.Unmarshal(buf, &res); err != nil {
+	if err := f.unmarshal(buf, &res); err != nil {
 		log.Debugln(err)
 		return err
 	}
@@ -1190,19 +1417,33 @@ func (f *File) CloseFile() error {
 	}
 	log.Debugf("Close of file completed [%s] fileid [%x]\n", f.share, f.fd)
 	f.fd = nil
-	return nil
+	return flushErr
 }
 
 func (f *File) QueryDirectory(pattern string, flags byte, fileIndex uint32, bufferSize uint32) (sf []SharedFile, err error) {
+	sf, _, err = f.queryDirectory(pattern, flags, fileIndex, bufferSize)
+	return
+}
+
+// queryDirectory returns the files of a QUERY_DIRECTORY response and the size
+// of its output buffer
+func (f *File) queryDirectory(pattern string, flags byte, fileIndex uint32, bufferSize uint32) (sf []SharedFile, size uint32, err error) {
 	if f.fd == nil {
-		return nil, fmt.Errorf("Can't operate on a closed file")
+		return nil, 0, fmt.Errorf("Can't operate on a closed file")
 	}
 	sf = make([]SharedFile, 0)
+	// macOS servers return the attributes negotiated with AAPL only in
+	// FILE_ID_BOTH_DIR_INFORMATION
+	readDirAttr := f.readDirAttr()
+	infoClass := FileBothDirectoryInformation
+	if readDirAttr {
+		infoClass = FileIdBothDirectoryInformation
+	}
 	req, err := f.NewQueryDirectoryReq(
 		f.share,
 		pattern,
 		f.fd,
-		FileBothDirectoryInformation,
+		infoClass,
 		flags,
 		fileIndex,
 		bufferSize,
@@ -1220,9 +1461,9 @@ func (f *File) QueryDirectory(pattern string, flags byte, fileIndex uint32, buff
 
 	var res QueryDirectoryRes
 	log.Debugf("Unmarshalling QueryDirectory response [%s]\n", f.share)
-	if err := encoder.Unmarshal(buf, &res); err != nil {
+	if err := f.unmarshal(buf, &res); err != nil {
 		log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(buf))
-		return sf, err
+		return sf, 0, err
 	}
 
 	if res.Header.Status == StatusNoMoreFiles {
@@ -1245,18 +1486,32 @@ func (f *File) QueryDirectory(pattern string, flags byte, fileIndex uint32, buff
 	if res.OutputBufferLength == 0 {
 		return
 	}
+	if res.OutputBufferLength > bufferSize {
+		err = fmt.Errorf("QueryDirectory response of %d bytes exceeds the requested %d bytes", res.OutputBufferLength, bufferSize)
+		log.Errorln(err)
+		return
+	}
+	size = res.OutputBufferLength
 
 	start, stop := uint32(0), res.OutputBufferLength
 	for {
 		var fs FileBothDirectoryInformationStruct
-		if err = encoder.Unmarshal(res.Buffer[start:stop], &fs); err != nil {
+		var macOS *MacOSAttributes
+		if readDirAttr {
+			var fid FileIdBothDirectoryInformationStruct
+			if err = f.unmarshal(res.Buffer[start:stop], &fid); err != nil {
+				log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(buf))
+				return sf, 0, err
+			}
+			fs, macOS = fid.macOSDirectoryInformation()
+		} else if err = f.unmarshal(res.Buffer[start:stop], &fs); err != nil {
 			log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(buf))
-			return sf, err
+			return sf, 0, err
 		}
 		fileName, err := encoder.FromUnicodeString(fs.FileName[:fs.FileNameLength])
 		if err != nil {
 			log.Debugln(err)
-			return sf, err
+			return sf, 0, err
 		}
 		start += fs.NextEntryOffset
 		if (fileName == ".") || (fileName == "..") {
@@ -1277,6 +1532,7 @@ func (f *File) QueryDirectory(pattern string, flags byte, fileIndex uint32, buff
 			IsDir:          (fs.FileAttributes & FileAttrDirectory) == FileAttrDirectory,
 			IsReadOnly:     (fs.FileAttributes & FileAttrReadonly) == FileAttrReadonly,
 			IsJunction:     (fs.FileAttributes & FileAttrReparsePoint) == FileAttrReparsePoint,
+			MacOS:          macOS,
 		}
 
 		sf = append(sf, sharedFile)
@@ -1287,7 +1543,9 @@ func (f *File) QueryDirectory(pattern string, flags byte, fileIndex uint32, buff
 	return
 }
 
-func (f *File) QueryInfoSecurity(bufferSize uint32) (fs *FileSecurityInformation, err error) {
+// QuerySecurityDescriptor returns the self-relative security descriptor of
+// the file holding its owner, group and DACL
+func (f *File) QuerySecurityDescriptor(bufferSize uint32) (sd []byte, err error) {
 	if f.fd == nil {
 		return nil, fmt.Errorf("Can't operate on a closed file")
 	}
@@ -1316,7 +1574,7 @@ func (f *File) QueryInfoSecurity(bufferSize uint32) (fs *FileSecurityInformation
 
 	var res QueryInfoRes
 	log.Debugf("Unmarshalling QueryInfo response [%s]\n", f.share)
-	if err := encoder.Unmarshal(buf, &res); err != nil {
+	if err := f.unmarshal(buf, &res); err != nil {
 		log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(buf))
 		return nil, err
 	}
@@ -1339,10 +1597,85 @@ func (f *File) QueryInfoSecurity(bufferSize uint32) (fs *FileSecurityInformation
 	if res.OutputBufferLength == 0 {
 		return nil, fmt.Errorf("server response didn't contain any info")
 	}
+	if int(res.OutputBufferLength) > len(res.Buffer) {
+		return nil, fmt.Errorf("security descriptor length %d exceeds the response", res.OutputBufferLength)
+	}
+	return res.Buffer[:res.OutputBufferLength], nil
+}
+
+// QueryInfo returns the output buffer of a QUERY_INFO request for the
+// information class of the info type, e.g., FileStreamInformation of
+// OInfoFile. An unsupported class fails with the StatusInvalidInfoClass
+// error of StatusMap.
+func (f *File) QueryInfo(infoType, infoClass byte, bufferSize uint32) (buf []byte, err error) {
+	return f.queryInfo(infoType, infoClass, bufferSize, nil)
+}
+
+// queryInfo sends a QUERY_INFO request with an input buffer, e.g., the
+// SMB2_QUERY_QUOTA_INFO of OInfoQuota
+func (f *File) queryInfo(infoType, infoClass byte, bufferSize uint32, input []byte) (buf []byte, err error) {
+	if f.fd == nil {
+		return nil, fmt.Errorf("Can't operate on a closed file")
+	}
+	req, err := f.NewQueryInfoReq(f.share, f.fd, infoType, infoClass, 0, 0, bufferSize, input)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+	resBuf, err := f.sendrecv(req)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+	var h Header
+	if err = f.unmarshal(resBuf, &h); err != nil {
+		log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(resBuf))
+		return nil, err
+	}
+	if h.Status != StatusOk {
+		status, found := StatusMap[f.queryInfoStatus(h.Status)]
+		if !found {
+			err = fmt.Errorf("Received unknown SMB Header status for QueryInfo response: 0x%x\n", h.Status)
+			log.Errorln(err)
+			return
+		}
+		log.Debugf("Failed QueryInfo with NT Status Error: %v\n", status)
+		return nil, status
+	}
+	var res QueryInfoRes
+	if err = f.unmarshal(resBuf, &res); err != nil {
+		log.Debugf("Error: %v\nRaw:\n%v\n", err, hex.Dump(resBuf))
+		return nil, err
+	}
+	if int(res.OutputBufferLength) > len(res.Buffer) {
+		return nil, fmt.Errorf("QueryInfo output length %d exceeds the response", res.OutputBufferLength)
+	}
+	return res.Buffer[:res.OutputBufferLength], nil
+}
+
+// Streams lists the data streams of the file, e.g., "::$DATA" for the
+// default stream and ":name:$DATA" for alternate data streams. Directories
+// usually have no streams.
+func (f *File) Streams() (streams []FileStream, err error) {
+	buf, err := f.QueryInfo(OInfoFile, FileStreamInformation, f.transactSize())
+	if err != nil {
+		if f.Quirks()&QuirkStreamsStatus != 0 && isUnsupportedInfoClass(err) {
+			log.Debugf("Server could not enumerate the streams of %s: %v\n", f.filename, err)
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseFileStreams(buf)
+}
+
+func (f *File) QueryInfoSecurity(bufferSize uint32) (fs *FileSecurityInformation, err error) {
+	buf, err := f.QuerySecurityDescriptor(bufferSize)
+	if err != nil {
+		return
+	}
 
-	start, stop := uint32(0), res.OutputBufferLength
 	sd := &SecurityDescriptor{}
-	err = encoder.Unmarshal(res.Buffer[start:stop], sd)
+	err = f.unmarshal(buf, sd)
 	if err != nil {
 		return nil, fmt.Errorf("failed parsing security descriptor: %w", err)
 	}
@@ -1368,7 +1701,7 @@ func (f *File) QueryInfoSecurity(bufferSize uint32) (fs *FileSecurityInformation
 func (s *Connection) ListDirectory(share, dir, pattern string) (files []SharedFile, err error) {
 	req, err := s.NewCreateReq(share, dir,
 		OpLockLevelNone,
-		ImpersonationLevelImpersonation,
+		s.impersonationLevel(),
 		DAccMaskFileListDirectory|DAccMaskFileReadAttributes,
 		FileAttrDirectory,
 		FileShareRead|FileShareWrite,
@@ -1380,6 +1713,7 @@ func (s *Connection) ListDirectory(share, dir, pattern string) (files []SharedFi
 		log.Debugln(err)
 		return
 	}
+	req.SetCreateContexts(s.aaplContexts())
 
 	buf, err := s.sendrecv(req)
 	if err != nil {
@@ -1387,7 +1721,7 @@ func (s *Connection) ListDirectory(share, dir, pattern string) (files []SharedFi
 		return
 	}
 	var h Header
-	if err := encoder.Unmarshal(buf, &h); err != nil {
+	if err := s.unmarshal(buf, &h); err != nil {
 		log.Debugf("Error: %v\nRaw\n%v\n", err, hex.Dump(buf))
 		return files, err
 	}
@@ -1406,21 +1740,20 @@ func (s *Connection) ListDirectory(share, dir, pattern string) (files []SharedFi
 
 	var res CreateRes
 	log.Debugf("Unmarshalling Create response [%s]\n", share)
-	if err := encoder.Unmarshal(buf, &res); err != nil {
+	if err := s.unmarshal(buf, &res); err != nil {
 		log.Debugf("Error: %v\nRaw\n%v\n", err, hex.Dump(buf))
 		return files, err
 	}
+	s.handleAAPL(&res)
 	f := &File{Connection: s, share: share, fd: res.FileId, filename: dir, shareid: s.trees[share]}
 	defer f.CloseFile()
 
-	maxResponseBufferSize := uint32(65536)
-	if s.supportsMultiCredit {
-		maxResponseBufferSize = s.maxTransactSize
-	}
+	maxResponseBufferSize := s.transactSize()
 
 	// QueryDirectory request
+	listed := 0
 	for {
-		moreFiles, err := f.QueryDirectory(pattern, 0, 0, maxResponseBufferSize)
+		moreFiles, size, err := f.queryDirectory(pattern, 0, 0, maxResponseBufferSize)
 		if err != nil {
 			log.Debugln(err)
 			return files, err
@@ -1428,6 +1761,12 @@ func (s *Connection) ListDirectory(share, dir, pattern string) (files []SharedFi
 		if len(moreFiles) == 0 {
 			break
 		}
+		listed += int(size)
+		if listed > MaxDirectoryListingSize {
+			err = fmt.Errorf("Listing of directory %s exceeds the limit of %d bytes", dir, MaxDirectoryListingSize)
+			log.Errorln(err)
+			return files, err
+		}
 		files = append(files, moreFiles...)
 	}
 
@@ -1497,6 +1836,15 @@ func (s *Connection) ListShare(share, dir string, recurse bool) (files []SharedF
 }
 
 func (s *Connection) OpenFileExt(tree string, filepath string, opts *CreateReqOpts) (file *File, err error) {
+	file, err = s.createFile(tree, filepath, opts)
+	if err == StatusMap[StatusAccessDenied] && s.options.AccessDeniedDiagnostics {
+		err = s.diagnoseAccessDenied(tree, filepath, opts.DesiredAccess)
+	}
+	return
+}
+
+// createFile sends a CREATE request for OpenFileExt
+func (s *Connection) createFile(tree string, filepath string, opts *CreateReqOpts) (file *File, err error) {
 	// If tree is not connected, connect to it
 	if _, ok := s.trees[tree]; !ok {
 		err = s.TreeConnect(tree)
@@ -1522,6 +1870,8 @@ func (s *Connection) OpenFileExt(tree string, filepath string, opts *CreateReqOp
 		log.Debugln(err)
 		return
 	}
+	req.SecurityFlags = opts.SecurityFlags
+	req.SetCreateContexts(append(opts.CreateContexts, s.aaplContexts()...))
 
 	buf, err := s.sendrecv(req)
 	if err != nil {
@@ -1530,13 +1880,13 @@ func (s *Connection) OpenFileExt(tree string, filepath string, opts *CreateReqOp
 	}
 
 	var h Header
-	if err := encoder.Unmarshal(buf, &h); err != nil {
+	if err := s.unmarshal(buf, &h); err != nil {
 		log.Debugf("Error: %v\nRaw\n%v\n", err, hex.Dump(buf))
 		return nil, err
 	}
 
 	if h.Status != StatusOk {
-		status, found := StatusMap[h.Status]
+		status, found := StatusMap[s.createStatus(h.Status, opts.CreateOpts)]
 		if !found {
 			err = fmt.Errorf("Received unknown SMB Header status for Create/open file response when opening with special options: 0x%x\n", h.Status)
 			log.Errorln(err)
@@ -1549,10 +1899,16 @@ func (s *Connection) OpenFileExt(tree string, filepath string, opts *CreateReqOp
 
 	var res CreateRes
 	log.Debugf("Unmarshalling Create response [%s]\n", tree)
-	if err := encoder.Unmarshal(buf, &res); err != nil {
+	if err := s.unmarshal(buf, &res); err != nil {
 		log.Debugf("Error: %v\nRaw\n%v\n", err, hex.Dump(buf))
 		return nil, err
 	}
+	s.handleAAPL(&res)
+	contexts, err := res.CreateContexts()
+	if err != nil {
+		log.Debugf("Failed to parse the create contexts of the response: %v\n", err)
+		err = nil
+	}
 
 	//TODO Perhaps change to contain date objects instead of uint32
 	return &File{
@@ -1566,20 +1922,28 @@ func (s *Connection) OpenFileExt(tree string, filepath string, opts *CreateReqOp
 			Attributes:     res.FileAttributes,
 			EndOfFile:      res.EndOfFile,
 		},
-		shareid:  s.trees[tree],
-		fd:       res.FileId,
-		share:    tree,
-		filename: filepath,
+		shareid:        s.trees[tree],
+		fd:             res.FileId,
+		share:          tree,
+		filename:       filepath,
+		createContexts: contexts,
 	}, nil
 
 }
 
 func (s *Connection) OpenFile(tree string, filepath string) (file *File, err error) {
-	return s.OpenFileExt(tree, filepath, NewCreateReqOpts())
+	return s.OpenFileExt(tree, filepath, s.createReqOpts())
 
 }
 
 func (s *Connection) RetrieveFile(share string, filepath string, offset uint64, callback func([]byte) (int, error)) (err error) {
+	return s.RetrieveFileExt(share, filepath, offset, callback, nil)
+}
+
+// RetrieveFileExt downloads a file like RetrieveFile with the chunk size,
+// number of parallel requests, bandwidth and progress reporting controlled
+// by opts. A nil opts selects the defaults.
+func (s *Connection) RetrieveFileExt(share string, filepath string, offset uint64, callback func([]byte) (int, error), opts *TransferOptions) (err error) {
 
 	if callback == nil {
 		err = fmt.Errorf("Must specify a callback function to handle retrieved data.")
@@ -1606,7 +1970,7 @@ func (s *Connection) RetrieveFile(share string, filepath string, offset uint64,
 
 	req, err := s.NewCreateReq(share, filepath,
 		OpLockLevelNone,
-		ImpersonationLevelImpersonation,
+		s.impersonationLevel(),
 		FAccMaskFileReadData|FAccMaskFileReadEA|FAccMaskFileReadAttributes|FAccMaskReadControl|FAccMaskSynchronize,
 		0,
 		FileShareRead|FileShareWrite,
@@ -1626,7 +1990,7 @@ func (s *Connection) RetrieveFile(share string, filepath string, offset uint64,
 	}
 
 	var h Header
-	if err := encoder.Unmarshal(buf, &h); err != nil {
+	if err := s.unmarshal(buf, &h); err != nil {
 		log.Debugf("Error: %v\nRaw\n%v\n", err, hex.Dump(buf))
 		return err
 	}
@@ -1645,7 +2009,7 @@ func (s *Connection) RetrieveFile(share string, filepath string, offset uint64,
 
 	var res CreateRes
 	log.Debugf("Unmarshalling Create response [%s]\n", share)
-	if err := encoder.Unmarshal(buf, &res); err != nil {
+	if err := s.unmarshal(buf, &res); err != nil {
 		log.Debugf("Error: %v\nRaw\n%v\n", err, hex.Dump(buf))
 		return err
 	}
@@ -1663,13 +2027,21 @@ func (s *Connection) RetrieveFile(share string, filepath string, offset uint64,
 	}
 
 	log.Debugln("Sending ReadFile requests")
-	data := make([]byte, s.maxReadSize)
+	if opts == nil {
+		opts = &TransferOptions{}
+	}
+	chunkSize := opts.readChunkSize(s)
+	data := make([]byte, chunkSize)
 	fileSize := res.EndOfFile
+	limiter := newRateLimiter(opts.BandwidthLimit)
 
+	// Parallel requests are issued by the read-ahead of File.Read
+	f.ra = &readAhead{depth: opts.readDepth(s), chunkSize: chunkSize}
+	f.pos = int64(offset)
 	readOffset := offset
 	for readOffset < fileSize {
-		n, err := f.ReadFile(data, readOffset)
-		if err != nil {
+		n, err := f.Read(data)
+		if n == 0 && err != nil {
 			if err == io.EOF {
 				err = fmt.Errorf("Got EOF before finished reading")
 				return err
@@ -1687,12 +2059,30 @@ func (s *Connection) RetrieveFile(share string, filepath string, offset uint64,
 			return err
 		}
 		readOffset += uint64(n)
+		limiter.wait(n)
+		if opts.Progress != nil {
+			opts.Progress(readOffset-offset, fileSize-offset)
+		}
 	}
 
 	return err
 }
 
+// ReadFile sends a single READ request for up to len(b) bytes at offset.
+// Data buffered by Write is flushed first so that it is visible to the read.
 func (f *File) ReadFile(b []byte, offset uint64) (n int, err error) {
+	if f.fd == nil {
+		return 0, fmt.Errorf("Can't operate on a closed file")
+	}
+	if err = f.Flush(); err != nil {
+		return
+	}
+	return f.readFile(b, offset)
+}
+
+// readFile is ReadFile without the flush of buffered writes, for the
+// prefetching goroutines of File.Read
+func (f *File) readFile(b []byte, offset uint64) (n int, err error) {
 	if f.fd == nil {
 		return 0, fmt.Errorf("Can't operate on a closed file")
 	}
@@ -1707,6 +2097,10 @@ func (f *File) ReadFile(b []byte, offset uint64) (n int, err error) {
 	if len(b) > maxReadBufferSize {
 		b = b[:maxReadBufferSize]
 	}
+	rdma := f.rdmaTransport(len(b))
+	if rdma != nil && len(b) > rdma.MaxReadWriteSize() {
+		b = b[:rdma.MaxReadWriteSize()]
+	}
 
 	req, err := f.NewReadReq(f.share, f.fd,
 		//f.MaxReadSize,
@@ -1719,15 +2113,29 @@ func (f *File) ReadFile(b []byte, offset uint64) (n int, err error) {
 		return
 	}
 
-	buf, err := f.sendrecv(req)
+	// The data is read directly into b when possible, either by the server
+	// with RDMA or by the receiver
+	dst := b
+	if rdma != nil {
+		var release func()
+		if release, err = setRdmaReadChannel(&req, rdma, b); err != nil {
+			log.Debugln(err)
+			return
+		}
+		defer release()
+		dst = nil
+	}
+	buf, streamed, err := f.sendrecvInto(req, dst)
 	if err != nil {
 		log.Debugln(err)
 		return
 	}
+	// Nothing refers to the response frame once the data has been copied
+	defer encoder.PutBuffer(buf)
 
 	log.Debugln("Reading response")
 	var h Header
-	if err := encoder.Unmarshal(buf[:64], &h); err != nil {
+	if err := f.unmarshal(buf[:64], &h); err != nil {
 		log.Debugf("Error: %v\nRaw\n%v\n", err, hex.Dump(buf))
 		return n, err
 	}
@@ -1755,24 +2163,21 @@ func (f *File) ReadFile(b []byte, offset uint64) (n int, err error) {
 		return
 	}
 
-	var res ReadRes
-	log.Debugf("Unmarshalling Read response [%s]\n", f.share)
-	if err := encoder.Unmarshal(buf, &res); err != nil {
-		log.Debugln(err)
-		return n, err
+	if streamed > 0 {
+		return streamed, nil
+	}
+	if rdma != nil && len(buf) >= readResponseDataOffset && binary.LittleEndian.Uint32(buf[68:72]) == 0 {
+		return rdmaReadCount(buf, len(b))
 	}
 
-	// An offset to indicate if the file data is the first thing
-	// in the response buffer or if it begins later.
-	bufferOffset := int(res.DataOffset - 64 - 16)
-	if len(res.Buffer) < bufferOffset {
-		err = fmt.Errorf("Returned offset is outside response buffer")
+	// Copy the data straight from the receive buffer into b
+	data, err := readResponseData(buf)
+	if err != nil {
 		log.Debugln(err)
 		return
 	}
-	nCopy := copy(b, res.Buffer[bufferOffset:])
-	n = int(res.DataLength)
-	if nCopy != n {
+	n = copy(b, data)
+	if n != len(data) {
 		err = fmt.Errorf("Failed to copy result data into supplied buffer")
 		log.Debugln(err)
 		return
@@ -1780,7 +2185,43 @@ func (f *File) ReadFile(b []byte, offset uint64) (n int, err error) {
 	return
 }
 
+// ReadAt implements io.ReaderAt by splitting p into READ requests of at most
+// the negotiated MaxReadSize. Data is placed directly into p, which allows
+// streaming files of any size through a single reusable buffer. Data
+// buffered by Write is flushed first.
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("Invalid negative offset")
+	}
+	if err = f.Flush(); err != nil {
+		return
+	}
+	chunkSize := len(p)
+	if f.maxReadSize > 0 && chunkSize > int(f.maxReadSize) {
+		chunkSize = int(f.maxReadSize)
+	}
+	for n < len(p) {
+		var nr int
+		nr, err = f.readFile(p[n:min(len(p), n+chunkSize)], uint64(off)+uint64(n))
+		n += nr
+		if err != nil {
+			return
+		}
+		if nr == 0 {
+			return n, io.EOF
+		}
+	}
+	return
+}
+
 func (s *Connection) PutFile(share string, filepath string, offset uint64, callback func([]byte) (int, error)) (err error) {
+	return s.PutFileExt(share, filepath, offset, callback, nil)
+}
+
+// PutFileExt uploads a file like PutFile with the chunk size, number of
+// parallel requests, bandwidth and progress reporting controlled by opts. A
+// nil opts selects the defaults.
+func (s *Connection) PutFileExt(share string, filepath string, offset uint64, callback func([]byte) (int, error), opts *TransferOptions) (err error) {
 	disconnectFromTree := false
 	// Only disconnect from share if it wasn't already connected.
 	// Otherwise, allow reuse of existing connection.
@@ -1810,7 +2251,7 @@ func (s *Connection) PutFile(share string, filepath string, offset uint64, callb
 
 	req, err := s.NewCreateReq(share, filepath,
 		OpLockLevelNone,
-		ImpersonationLevelImpersonation,
+		s.impersonationLevel(),
 		accessMask,
 		0,
 		FileShareRead|FileShareWrite,
@@ -1830,7 +2271,7 @@ func (s *Connection) PutFile(share string, filepath string, offset uint64, callb
 	}
 
 	var h Header
-	if err := encoder.Unmarshal(buf, &h); err != nil {
+	if err := s.unmarshal(buf, &h); err != nil {
 		log.Debugf("Error: %v\nRaw\n%v\n", err, hex.Dump(buf))
 		return err
 	}
@@ -1849,7 +2290,7 @@ func (s *Connection) PutFile(share string, filepath string, offset uint64, callb
 
 	var res CreateRes
 	log.Debugf("Unmarshalling Create response [%s]\n", share)
-	if err := encoder.Unmarshal(buf, &res); err != nil {
+	if err := s.unmarshal(buf, &res); err != nil {
 		log.Debugf("Error: %v\nRaw\n%v\n", err, hex.Dump(buf))
 		return err
 	}
@@ -1864,33 +2305,45 @@ func (s *Connection) PutFile(share string, filepath string, offset uint64, callb
 
 	log.Debugln("Sending WriteFile requests")
 
-	writeOffset := offset
-	for {
-		outBuffer := make([]byte, s.maxWriteSize)
+	if opts == nil {
+		opts = &TransferOptions{}
+	}
+	limiter := newRateLimiter(opts.BandwidthLimit)
+	var progress func(uint64)
+	if opts.Progress != nil {
+		progress = func(n uint64) { opts.Progress(n, 0) }
+	}
+
+	// The buffer can be reused right away as WRITE requests copy the data
+	outBuffer := make([]byte, opts.writeChunkSize(s))
+	_, err = f.writePipelined(offset, opts.writeWindow(s), func() ([]byte, error) {
 		nr, err := callback(outBuffer)
 		if err != nil {
-			if err == io.EOF {
-				break
+			if err != io.EOF {
+				log.Errorln(err)
 			}
-			log.Errorln(err)
-			return err
-		}
-
-		n, err := f.WriteFile(outBuffer[:nr], writeOffset)
-		if err != nil {
-			log.Debugln(err)
-			return err
+			return nil, err
 		}
-		writeOffset += uint64(n)
+		limiter.wait(nr)
+		return outBuffer[:nr], nil
+	}, progress)
+	if err != nil {
+		log.Debugln(err)
 	}
 
 	return
 }
 
+// WriteFile sends a single WRITE request for up to len(data) bytes at
+// offset. Data buffered by Write is flushed first so that it does not
+// overwrite data.
 func (f *File) WriteFile(data []byte, offset uint64) (n int, err error) {
 	if f.fd == nil {
 		return 0, fmt.Errorf("Can't operate on a closed file")
 	}
+	if err = f.Flush(); err != nil {
+		return
+	}
 	maxWriteBufferSize := 65536
 	if f.supportsMultiCredit {
 		// Reading data in chunks of max 1MiB blocks as f.MaxReadSize seems to cause problems
@@ -1905,11 +2358,23 @@ func (f *File) WriteFile(data []byte, offset uint64) (n int, err error) {
 		data = data[:maxWriteBufferSize]
 	}
 
-	req, err := f.NewWriteReq(f.share, f.fd, offset, data)
-
-	if err != nil {
-		log.Debugln(err)
-		return
+	var req interface{}
+	if rdma := f.rdmaTransport(len(data)); rdma != nil {
+		// The server reads the data with RDMA
+		data = data[:min(len(data), rdma.MaxReadWriteSize())]
+		var release func()
+		req, release, err = f.newRdmaWriteReq(rdma, offset, data)
+		if err != nil {
+			log.Debugln(err)
+			return
+		}
+		defer release()
+	} else {
+		req, err = f.NewWriteReq(f.share, f.fd, offset, data)
+		if err != nil {
+			log.Debugln(err)
+			return
+		}
 	}
 
 	buf, err := f.sendrecv(req)
@@ -1917,10 +2382,15 @@ func (f *File) WriteFile(data []byte, offset uint64) (n int, err error) {
 		log.Debugln(err)
 		return
 	}
+	defer encoder.PutBuffer(buf)
+
+	return f.decodeWriteRes(buf)
+}
 
+func (f *File) decodeWriteRes(buf []byte) (n int, err error) {
 	var res WriteRes
 	log.Debugf("Unmarshalling Write response [%s]\n", f.share)
-	if err := encoder.Unmarshal(buf, &res); err != nil {
+	if err := f.unmarshal(buf, &res); err != nil {
 		log.Debugf("Error: %v\nRaw\n%v\n", err, hex.Dump(buf))
 		return n, err
 	}
@@ -1939,6 +2409,151 @@ func (f *File) WriteFile(data []byte, offset uint64) (n int, err error) {
 	return
 }
 
+type writeResult struct {
+	n      int
+	length int
+	err    error
+}
+
+// writePipelined sends the chunks returned by next as WRITE requests at
+// consecutive offsets starting at offset. Instead of waiting for each
+// response before sending the next request, up to window requests are kept
+// in flight as long as the server has granted enough credits. Responses are
+// handled in the order they arrive and progress, if set, is called with the
+// number of bytes written so far. next signals the end of the data with
+// io.EOF. Data buffered by Write is flushed first so that it does not
+// overwrite the data of the chunks.
+func (f *File) writePipelined(offset uint64, window int, next func() ([]byte, error), progress func(uint64)) (total uint64, err error) {
+	if f.fd == nil {
+		return 0, fmt.Errorf("Can't operate on a closed file")
+	}
+	if err = f.Flush(); err != nil {
+		return
+	}
+	// Prefetched data may be stale after the write
+	f.dropReadAhead()
+	results := make(chan writeResult, window)
+	inflight := 0
+
+	// wait handles the next response and keeps the first error encountered
+	wait := func() {
+		r := <-results
+		inflight--
+		total += uint64(r.n)
+		if r.err == nil && r.n != r.length {
+			r.err = fmt.Errorf("Short write: wrote %d of %d bytes", r.n, r.length)
+		}
+		if r.err != nil && err == nil {
+			err = r.err
+		}
+		if progress != nil {
+			progress(total)
+		}
+	}
+	defer func() {
+		for inflight > 0 {
+			wait()
+		}
+	}()
+
+	for err == nil {
+		var data []byte
+		data, err = next()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+				break
+			}
+			log.Debugln(err)
+			return
+		}
+		if len(data) == 0 {
+			continue
+		}
+		charge := int64(calcCreditCharge(uint32(len(data))))
+		for inflight > 0 && (inflight >= f.throttledWindow(window) || f.credits.Load() < charge) {
+			if f.credits.Load() < charge {
+				f.creditsStarved(CommandWrite)
+			}
+			wait()
+		}
+		if err != nil {
+			break
+		}
+
+		var req interface{}
+		release := func() {}
+		if rdma := f.rdmaTransport(len(data)); rdma != nil && len(data) <= rdma.MaxReadWriteSize() {
+			// The server reads the data with RDMA after next has reused
+			// the chunk, so it is copied like NewWriteReq does
+			req, release, err = f.newRdmaWriteReq(rdma, offset, append([]byte(nil), data...))
+		} else {
+			req, err = f.NewWriteReq(f.share, f.fd, offset, data)
+		}
+		if err != nil {
+			log.Debugln(err)
+			return
+		}
+		var rr *requestResponse
+		rr, err = f.send(req)
+		if err != nil {
+			release()
+			log.Debugln(err)
+			return
+		}
+		if rr == nil {
+			release()
+			err = fmt.Errorf("Remote connection has closed")
+			return
+		}
+		inflight++
+		go func(req interface{}, release func(), rr *requestResponse, length int) {
+			buf, err := f.recv(rr)
+			if err == nil {
+				encoder.ReleaseBuffers(rr.pkt)
+				buf, _, err = f.retryThrottled(req, nil, buf, 0)
+			}
+			release()
+			if err != nil {
+				results <- writeResult{length: length, err: err}
+				return
+			}
+			n, err := f.decodeWriteRes(buf)
+			encoder.PutBuffer(buf)
+			results <- writeResult{n: n, length: length, err: err}
+		}(req, release, rr, len(data))
+		offset += uint64(len(data))
+	}
+	return
+}
+
+// WriteAt implements io.WriterAt by splitting p into WRITE requests of at
+// most the negotiated MaxWriteSize that are sent pipelined. Data buffered by
+// Write is flushed first.
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("Invalid negative offset")
+	}
+	chunkSize := 65536
+	if f.supportsMultiCredit && f.maxWriteSize > 0 {
+		chunkSize = int(f.maxWriteSize)
+	}
+	window := f.options.WriteWindow
+	if window <= 0 {
+		window = defaultWriteWindow
+	}
+	pos := 0
+	written, err := f.writePipelined(uint64(off), window, func() ([]byte, error) {
+		if pos == len(p) {
+			return nil, io.EOF
+		}
+		chunk := p[pos:min(len(p), pos+chunkSize)]
+		pos += len(chunk)
+		return chunk, nil
+	}, nil)
+	return int(written), err
+}
+
 func (f *File) IsDir() bool {
 	return (f.Attributes & FileAttrDirectory) == FileAttrDirectory
 }
@@ -1980,7 +2595,7 @@ func (s *Connection) deleteFileDir(share string, path string, isDir bool) (err e
 
 	req, err := s.NewCreateReq(share, path,
 		OpLockLevelNone,
-		ImpersonationLevelImpersonation,
+		s.impersonationLevel(),
 		accessMask,
 		0,
 		FileShareRead|FileShareWrite|FileShareDelete,
@@ -2000,7 +2615,7 @@ func (s *Connection) deleteFileDir(share string, path string, isDir bool) (err e
 	}
 
 	var h Header
-	if err := encoder.Unmarshal(buf, &h); err != nil {
+	if err := s.unmarshal(buf, &h); err != nil {
 		return err
 	}
 
@@ -2020,7 +2635,7 @@ func (s *Connection) deleteFileDir(share string, path string, isDir bool) (err e
 
 	var res CreateRes
 	log.Debugf("Unmarshalling Create response [%s]\n", share)
-	if err := encoder.Unmarshal(buf, &res); err != nil {
+	if err := s.unmarshal(buf, &res); err != nil {
 		log.Debugln(err)
 		return err
 	}
@@ -2053,7 +2668,7 @@ func (s *Connection) deleteFileDir(share string, path string, isDir bool) (err e
 	}
 
 	var h2 Header
-	if err := encoder.Unmarshal(buf, &h2); err != nil {
+	if err := s.unmarshal(buf, &h2); err != nil {
 		log.Debugln(err)
 		return err
 	}
@@ -2087,7 +2702,7 @@ func (s *Connection) WriteIoCtlReq(req *IoCtlReq) (res IoCtlRes, err error) {
 		return res, err
 	}
 	var h Header
-	if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+	if err = s.unmarshal(buf[:64], &h); err != nil {
 		log.Errorln(err)
 		return res, err
 	}
@@ -2104,7 +2719,7 @@ func (s *Connection) WriteIoCtlReq(req *IoCtlReq) (res IoCtlRes, err error) {
 		return
 	}
 
-	if err = encoder.Unmarshal(buf, &res); err != nil {
+	if err = s.unmarshal(buf, &res); err != nil {
 		log.Errorln(err)
 		return res, err
 	}
@@ -2152,7 +2767,7 @@ func (s *Connection) Mkdir(share string, path string) (err error) {
 
 	req, err := s.NewCreateReq(share, path,
 		OpLockLevelNone,
-		ImpersonationLevelImpersonation,
+		s.impersonationLevel(),
 		DAccMaskGenericAll,
 		0,
 		0,
@@ -2172,7 +2787,7 @@ func (s *Connection) Mkdir(share string, path string) (err error) {
 	}
 
 	var h Header
-	if err := encoder.Unmarshal(buf, &h); err != nil {
+	if err := s.unmarshal(buf, &h); err != nil {
 		log.Debugf("Error: %v\nRaw\n%v\n", err, hex.Dump(buf))
 		return err
 	}
@@ -2194,7 +2809,7 @@ func (s *Connection) Mkdir(share string, path string) (err error) {
 
 	var res CreateRes
 	log.Debugf("Unmarshalling Create response [%s]\n", share)
-	if err := encoder.Unmarshal(buf, &res); err != nil {
+	if err := s.unmarshal(buf, &res); err != nil {
 		log.Debugf("Error: %v\nRaw\n%v\n", err, hex.Dump(buf))
 		return err
 	}
@@ -2235,7 +2850,7 @@ func (s *Connection) MkdirAll(share string, path string) (err error) {
 	}
 
 	// First check if directory already exists
-	createOpts := NewCreateReqOpts()
+	createOpts := s.createReqOpts()
 	createOpts.CreateOpts = 0
 
 	f, err := s.OpenFileExt(share, path, createOpts)
@@ -2277,6 +2892,218 @@ func (s *Connection) MkdirAll(share string, path string) (err error) {
 	return
 }
 
+// Stat returns the metadata of a file or directory
+func (s *Connection) Stat(share string, path string) (fm *FileMetadata, err error) {
+	// Normalize path
+	path = strings.ReplaceAll(path, `/`, `\`)
+	path = strings.Trim(path, `\`)
+
+	opts := s.createReqOpts()
+	opts.DesiredAccess = FAccMaskFileReadAttributes | FAccMaskSynchronize
+	opts.ShareAccess = FileShareRead | FileShareWrite | FileShareDelete
+	f, err := s.OpenFileExt(share, path, opts)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+	fm = &f.FileMetadata
+	err = f.CloseFile()
+	return
+}
+
+// Rename moves a file or directory to newpath within the same share. An
+// existing file at newpath is only replaced if replace is set.
+func (s *Connection) Rename(share string, oldpath string, newpath string, replace bool) (err error) {
+	// Normalize paths
+	oldpath = strings.ReplaceAll(oldpath, `/`, `\`)
+	oldpath = strings.Trim(oldpath, `\`)
+	newpath = strings.ReplaceAll(newpath, `/`, `\`)
+	newpath = strings.Trim(newpath, `\`)
+
+	opts := s.createReqOpts()
+	opts.DesiredAccess = FAccMaskDelete | FAccMaskFileReadAttributes | FAccMaskSynchronize
+	opts.ShareAccess = FileShareRead | FileShareWrite | FileShareDelete
+	f, err := s.OpenFileExt(share, oldpath, opts)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+	defer f.CloseFile()
+
+	sReq, err := s.NewSetInfoReq(share, f.fd)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+	sReq.FileInfoClass = FileRenameInformation
+
+	// MS-FSCC Section 2.4.37.2 FILE_RENAME_INFORMATION_TYPE_2
+	name := encoder.ToUnicode(newpath)
+	buf := make([]byte, 20, 20+len(name))
+	if replace {
+		buf[0] = 1
+	}
+	binary.LittleEndian.PutUint32(buf[16:], uint32(len(name)))
+	sReq.Buffer = append(buf, name...)
+
+	resBuf, err := s.sendrecv(sReq)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+
+	var h Header
+	if err = s.unmarshal(resBuf, &h); err != nil {
+		log.Debugln(err)
+		return
+	}
+
+	if h.Status != StatusOk {
+		status, found := StatusMap[h.Status]
+		if !found {
+			err = fmt.Errorf("Received unknown SMB Header status for SetInfo response when renaming file or directory: 0x%x\n", h.Status)
+			log.Errorln(err)
+			return err
+		}
+		log.Debugf("Failed to rename file or directory with NT Status Error: %v\n", status)
+		return status
+	}
+	return
+}
+
+// SetFileTimes sets the timestamps of a file or directory. Timestamps given
+// as the zero Time are left unchanged.
+func (s *Connection) SetFileTimes(share string, path string, created, modified, accessed, changed time.Time) (err error) {
+	// Normalize path
+	path = strings.ReplaceAll(path, `/`, `\`)
+	path = strings.Trim(path, `\`)
+
+	opts := s.createReqOpts()
+	opts.DesiredAccess = FAccMaskFileWriteAttributes | FAccMaskFileReadAttributes | FAccMaskSynchronize
+	opts.ShareAccess = FileShareRead | FileShareWrite | FileShareDelete
+	f, err := s.OpenFileExt(share, path, opts)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+	defer f.CloseFile()
+
+	sReq, err := s.NewSetInfoReq(share, f.fd)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+	sReq.FileInfoClass = FileBasicInformation
+
+	// MS-FSCC Section 2.4.7 FILE_BASIC_INFORMATION
+	// A time of 0 and FileAttributes of 0 leave the values unchanged
+	buf := make([]byte, 40)
+	binary.LittleEndian.PutUint64(buf[0:], msdtyp.TimeToFiletime(created))
+	binary.LittleEndian.PutUint64(buf[8:], msdtyp.TimeToFiletime(accessed))
+	binary.LittleEndian.PutUint64(buf[16:], msdtyp.TimeToFiletime(modified))
+	binary.LittleEndian.PutUint64(buf[24:], msdtyp.TimeToFiletime(changed))
+	sReq.Buffer = buf
+
+	resBuf, err := s.sendrecv(sReq)
+	if err != nil {
+		log.Debugln(err)
+		return
+	}
+
+	var h Header
+	if err = s.unmarshal(resBuf, &h); err != nil {
+		log.Debugln(err)
+		return
+	}
+
+	if h.Status != StatusOk {
+		status, found := StatusMap[h.Status]
+		if !found {
+			err = fmt.Errorf("Received unknown SMB Header status for SetInfo response when setting file times: 0x%x\n", h.Status)
+			log.Errorln(err)
+			return err
+		}
+		log.Debugf("Failed to set file times with NT Status Error: %v\n", status)
+		return status
+	}
+	return
+}
+
+// ShareAccess describes what the session is allowed to do on a share
+type ShareAccess struct {
+	Connect bool // The tree connect succeeded
+	Read    bool // The root directory of the share could be listed
+	Write   bool // A directory could be created in the root. Only probed on request
+}
+
+// isStatus reports whether err is one of the NT Status errors in StatusMap
+func isStatus(err error) bool {
+	for _, status := range StatusMap {
+		if err == status {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckShareAccess determines the access granted on share by connecting to
+// it and listing its root directory. If write is set, a uniquely named
+// directory is also created in the root and removed again. Denied probes are
+// reported through the returned ShareAccess while any other failure is
+// returned as an error.
+func (s *Connection) CheckShareAccess(share string, write bool) (access ShareAccess, err error) {
+	disconnectFromTree := false
+	if _, ok := s.trees[share]; !ok {
+		disconnectFromTree = true
+	}
+
+	err = s.TreeConnect(share)
+	if err != nil {
+		log.Debugln(err)
+		if isStatus(err) {
+			err = nil
+		}
+		return
+	}
+	access.Connect = true
+	if disconnectFromTree {
+		defer s.TreeDisconnect(share)
+	}
+
+	_, err = s.ListDirectory(share, "", "*")
+	if err != nil {
+		log.Debugln(err)
+		if !isStatus(err) {
+			return
+		}
+		err = nil
+	} else {
+		access.Read = true
+	}
+
+	if !write {
+		return
+	}
+	name := make([]byte, 8)
+	if _, err = rand.Read(name); err != nil {
+		return
+	}
+	dir := fmt.Sprintf("%x", name)
+	err = s.Mkdir(share, dir)
+	if err != nil {
+		log.Debugln(err)
+		if isStatus(err) {
+			err = nil
+		}
+		return
+	}
+	access.Write = true
+	if err = s.DeleteDir(share, dir); err != nil {
+		log.Errorf("Failed to remove probe directory %s on share %s: %s\n", dir, share, err)
+	}
+	return
+}
+
 func (c *Session) IsNullSession() bool {
 	return c.sessionFlags&SessionFlagIsNull == SessionFlagIsNull
 }
@@ -0,0 +1,774 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// newTestConnection returns a connection with an established session and
+// the server side of the transport
+func newTestConnection(t *testing.T, opt Options) (*Connection, net.Conn) {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	c := &Connection{
+		conn:                client,
+		outstandingRequests: newOutstandingRequests(),
+		rdone:               make(chan struct{}, 1),
+		wdone:               make(chan struct{}, 1),
+		write:               make(chan net.Buffers, 1),
+		werr:                make(chan error, 1),
+	}
+	c.Session = &Session{
+		supportsMultiCredit: true,
+		options:             opt,
+		trees:               map[string]uint32{"share": 1},
+	}
+	go c.runSender()
+	go c.runReceiver()
+	return c, server
+}
+
+// readTestFrame reads a request from the server side of the transport
+func readTestFrame(conn net.Conn) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	_, err := io.ReadFull(conn, buf)
+	return buf, err
+}
+
+// writeTestFrame sends a response from the server side of the transport
+func writeTestFrame(conn net.Conn, res interface{}) error {
+	buf, err := encoder.Marshal(res)
+	if err != nil {
+		return err
+	}
+	size := binary.BigEndian.AppendUint32(nil, uint32(len(buf)))
+	_, err = conn.Write(append(size, buf...))
+	return err
+}
+
+func TestWritePipelined(t *testing.T) {
+	const window = 4
+	const chunkSize = 1000
+
+	c, server := newTestConnection(t, Options{WriteWindow: window})
+	c.maxWriteSize = chunkSize
+	c.credits.Store(100)
+
+	data := make([]byte, 2*window*chunkSize)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	received := make([]byte, len(data))
+
+	// The server waits for a full window of requests before responding to
+	// them in reverse order
+	serverErr := make(chan error, 1)
+	go func() {
+		for batch := 0; batch < 2; batch++ {
+			var reqs []WriteReq
+			for len(reqs) < window {
+				buf, err := readTestFrame(server)
+				if err != nil {
+					serverErr <- err
+					return
+				}
+				var req WriteReq
+				if err := encoder.Unmarshal(buf, &req); err != nil {
+					serverErr <- err
+					return
+				}
+				copy(received[req.Offset:], req.Buffer)
+				reqs = append(reqs, req)
+			}
+			for i := len(reqs) - 1; i >= 0; i-- {
+				res := WriteRes{
+					Header: Header{
+						ProtocolID:    []byte(ProtocolSmb2),
+						StructureSize: 64,
+						Command:       CommandWrite,
+						Credits:       reqs[i].CreditCharge,
+						MessageID:     reqs[i].MessageID,
+						Signature:     make([]byte, 16),
+					},
+					StructureSize: 17,
+					Count:         reqs[i].Length,
+				}
+				if err := writeTestFrame(server, &res); err != nil {
+					serverErr <- err
+					return
+				}
+			}
+		}
+		serverErr <- nil
+	}()
+
+	f := &File{Connection: c, fd: make([]byte, 16), share: "share"}
+	n, err := f.WriteAt(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = <-serverErr; err != nil {
+		t.Fatal(err)
+	}
+	if n != len(data) || !bytes.Equal(received, data) {
+		t.Fatal("Fail")
+	}
+	if c.credits.Load() != 100 {
+		t.Fatalf("Fail: %d credits left", c.credits.Load())
+	}
+}
+
+func TestReadAhead(t *testing.T) {
+	const chunkSize = 1000
+
+	c, server := newTestConnection(t, Options{ReadAheadDepth: 3, ReadAheadSize: chunkSize})
+	data := make([]byte, 10*chunkSize+123)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	// The server answers READ requests from data and records their lengths
+	lengths := make(chan uint32, 100)
+	go func() {
+		for {
+			buf, err := readTestFrame(server)
+			if err != nil {
+				close(lengths)
+				return
+			}
+			var req ReadReq
+			if err = encoder.Unmarshal(buf[:64], &req.Header); err != nil {
+				close(lengths)
+				return
+			}
+			req.Length = binary.LittleEndian.Uint32(buf[68:72])
+			req.Offset = binary.LittleEndian.Uint64(buf[72:80])
+			lengths <- req.Length
+			res := ReadRes{
+				Header: Header{
+					ProtocolID:    []byte(ProtocolSmb2),
+					StructureSize: 64,
+					Command:       CommandRead,
+					MessageID:     req.MessageID,
+					Signature:     make([]byte, 16),
+				},
+				StructureSize: 17,
+				DataOffset:    readResponseDataOffset,
+			}
+			if req.Offset >= uint64(len(data)) {
+				res.Header.Status = StatusEndOfFile
+				res.DataOffset = 0
+			} else {
+				res.Buffer = data[req.Offset:min(uint64(len(data)), req.Offset+uint64(req.Length))]
+			}
+			if err = writeTestFrame(server, &res); err != nil {
+				close(lengths)
+				return
+			}
+		}
+	}()
+
+	f := &File{Connection: c, fd: make([]byte, 16), share: "share"}
+	var out bytes.Buffer
+	buf := make([]byte, 300)
+	for {
+		n, err := f.Read(buf)
+		out.Write(buf[:n])
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("Fail")
+	}
+	// Wait for outstanding prefetches before stopping the server
+	f.ra.reset()
+	server.Close()
+
+	// Only the first read is sent with the callers length
+	if l := <-lengths; l != uint32(len(buf)) {
+		t.Fatalf("Fail: first read of %d bytes", l)
+	}
+	for l := range lengths {
+		if l != chunkSize {
+			t.Fatalf("Fail: read of %d bytes", l)
+		}
+	}
+}
+
+func TestWriteBehind(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.maxWriteSize = 1000
+	c.credits.Store(100)
+
+	// The server answers WRITE requests and records their lengths
+	received := make([]byte, 2500)
+	lengths := make(chan uint32, 100)
+	go func() {
+		defer close(lengths)
+		for {
+			buf, err := readTestFrame(server)
+			if err != nil {
+				return
+			}
+			var req WriteReq
+			if err = encoder.Unmarshal(buf, &req); err != nil {
+				return
+			}
+			copy(received[req.Offset:], req.Buffer)
+			lengths <- req.Length
+			res := WriteRes{
+				Header: Header{
+					ProtocolID:    []byte(ProtocolSmb2),
+					StructureSize: 64,
+					Command:       CommandWrite,
+					Credits:       req.CreditCharge,
+					MessageID:     req.MessageID,
+					Signature:     make([]byte, 16),
+				},
+				StructureSize: 17,
+				Count:         req.Length,
+			}
+			if err = writeTestFrame(server, &res); err != nil {
+				return
+			}
+		}
+	}()
+
+	f := &File{Connection: c, fd: make([]byte, 16), share: "share"}
+	if err := f.SetWriteBuffer(0); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, len(received))
+	for i := range data {
+		data[i] = byte(i * 3)
+	}
+	for i := 0; i < len(data); i += 10 {
+		if n, err := f.Write(data[i : i+10]); err != nil || n != 10 {
+			t.Fatal("Fail")
+		}
+	}
+	if len(lengths) != 2 {
+		t.Fatalf("Fail: %d writes before flush", len(lengths))
+	}
+	if err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	var written []uint32
+	for l := range lengths {
+		written = append(written, l)
+	}
+	if len(written) != 3 || written[0] != 1000 || written[1] != 1000 || written[2] != 500 {
+		t.Fatalf("Fail: %v", written)
+	}
+	if !bytes.Equal(received, data) {
+		t.Fatal("Fail")
+	}
+}
+
+// serveTestFile answers READ and WRITE requests from the contents of data
+// until the transport is closed
+func serveTestFile(server net.Conn, data []byte) {
+	for {
+		buf, err := readTestFrame(server)
+		if err != nil {
+			return
+		}
+		var h Header
+		if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+			return
+		}
+		var res interface{}
+		header := Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       h.Command,
+			Credits:       1,
+			MessageID:     h.MessageID,
+			Signature:     make([]byte, 16),
+		}
+		switch h.Command {
+		case CommandWrite:
+			var req WriteReq
+			if err = encoder.Unmarshal(buf, &req); err != nil {
+				return
+			}
+			copy(data[req.Offset:], req.Buffer)
+			res = &WriteRes{Header: header, StructureSize: 17, Count: req.Length}
+		case CommandRead:
+			length := binary.LittleEndian.Uint32(buf[68:72])
+			offset := binary.LittleEndian.Uint64(buf[72:80])
+			r := &ReadRes{Header: header, StructureSize: 17, DataOffset: readResponseDataOffset}
+			if offset >= uint64(len(data)) {
+				r.Header.Status = StatusEndOfFile
+				r.DataOffset = 0
+			} else {
+				r.Buffer = data[offset:min(uint64(len(data)), offset+uint64(length))]
+			}
+			res = r
+		default:
+			return
+		}
+		if err = writeTestFrame(server, res); err != nil {
+			return
+		}
+	}
+}
+
+func TestReadFlushesWriteBuffer(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.maxWriteSize = 1000
+	c.credits.Store(100)
+	go serveTestFile(server, make([]byte, 100))
+
+	f := &File{Connection: c, fd: make([]byte, 16), share: "share"}
+	if err := f.SetWriteBuffer(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("buffered")); err != nil {
+		t.Fatal(err)
+	}
+	// Both ReadAt and ReadFile see the data still buffered by Write
+	buf := make([]byte, 8)
+	if n, err := f.ReadAt(buf, 0); err != nil || string(buf[:n]) != "buffered" {
+		t.Fatalf("Fail: %q %v", buf, err)
+	}
+	if _, err := f.Write([]byte("BUF")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.ReadFile(buf, 8); err != nil || string(buf[:3]) != "BUF" || n != 8 {
+		t.Fatalf("Fail: %q %v", buf, err)
+	}
+}
+
+func TestWriteAtFlushesWriteBuffer(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.maxWriteSize = 1000
+	c.credits.Store(100)
+	data := make([]byte, 10)
+	go serveTestFile(server, data)
+
+	f := &File{Connection: c, fd: make([]byte, 16), share: "share"}
+	if err := f.SetWriteBuffer(0); err != nil {
+		t.Fatal(err)
+	}
+	// The data buffered by Write must not overwrite the later direct writes
+	if _, err := f.Write([]byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("new"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("OLD")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteFile([]byte("NEW"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 6)
+	if n, err := f.ReadAt(buf, 0); err != nil || string(buf[:n]) != "newNEW" {
+		t.Fatalf("Fail: %q %v", buf, err)
+	}
+}
+
+func TestReadAheadAfterWriteAt(t *testing.T) {
+	c, server := newTestConnection(t, Options{ReadAheadDepth: 2, ReadAheadSize: 10})
+	c.credits.Store(100)
+	data := []byte(strings.Repeat("a", 100))
+	go serveTestFile(server, data)
+
+	f := &File{Connection: c, fd: make([]byte, 16), share: "share"}
+	buf := make([]byte, 10)
+	for i := 0; i < 2; i++ {
+		if _, err := f.Read(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.ra == nil || len(f.ra.chunks) == 0 {
+		t.Fatal("Fail: nothing prefetched")
+	}
+	// The chunks prefetched before the write are dropped
+	if _, err := f.WriteAt([]byte(strings.Repeat("b", 30)), 20); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.ra.chunks) != 0 {
+		t.Fatal("Fail")
+	}
+	if n, err := io.ReadFull(f, buf); err != nil || string(buf[:n]) != strings.Repeat("b", 10) {
+		t.Fatalf("Fail: %q %v", buf, err)
+	}
+}
+
+func TestReadAheadDisabled(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	go serveTestFile(server, make([]byte, 100))
+
+	f := &File{Connection: c, fd: make([]byte, 16), share: "share"}
+	buf := make([]byte, 10)
+	for i := 0; i < 3; i++ {
+		if _, err := f.Read(buf); err != nil {
+			t.Fatal(err)
+		}
+		if len(f.ra.chunks) != 0 {
+			t.Fatal("Fail: read-ahead is enabled by default")
+		}
+	}
+}
+
+func TestTransferOptions(t *testing.T) {
+	c := &Connection{Session: &Session{supportsMultiCredit: true, maxReadSize: 8192, maxWriteSize: 4096}}
+	opts := TransferOptions{}
+	if opts.readChunkSize(c) != 8192 || opts.writeChunkSize(c) != 4096 {
+		t.Fatal("Fail")
+	}
+	if opts.readDepth(c) != defaultReadAheadDepth || opts.writeWindow(c) != defaultWriteWindow {
+		t.Fatal("Fail")
+	}
+	opts = TransferOptions{ChunkSize: 100000, Parallelism: 1}
+	if opts.readChunkSize(c) != 8192 || opts.readDepth(c) >= 0 || opts.writeWindow(c) != 1 {
+		t.Fatal("Fail")
+	}
+
+	limiter := newRateLimiter(1000000)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		limiter.wait(10000)
+	}
+	if time.Since(start) < 90*time.Millisecond {
+		t.Fatal("Fail: transfer was not limited")
+	}
+}
+
+func TestFastReconnect(t *testing.T) {
+	c, server := newTestConnection(t, Options{Host: "fastreconnect.test", Port: 445, FastReconnect: true})
+	c.clientGuid = make([]byte, 16)
+	rememberNegotiate("fastreconnect.test", 445)
+
+	res := make(chan error, 1)
+	go func() {
+		res <- c.NegotiateProtocol()
+	}()
+	buf, err := readTestFrame(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The multi-protocol negotiation is skipped
+	if string(buf[:4]) != ProtocolSmb2 || binary.LittleEndian.Uint16(buf[12:14]) != CommandNegotiate {
+		t.Fatalf("Fail: %x", buf[:16])
+	}
+
+	// A failed negotiation removes the server from the cache
+	server.Close()
+	if err = <-res; err == nil {
+		t.Fatal("Fail")
+	}
+	if negotiateCached("fastreconnect.test", 445) {
+		t.Fatal("Fail")
+	}
+}
+
+func TestRename(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.credits.Store(100)
+
+	// The server answers CREATE, SET_INFO and CLOSE requests
+	setInfo := make(chan SetInfoReq, 1)
+	go func() {
+		for {
+			buf, err := readTestFrame(server)
+			if err != nil {
+				return
+			}
+			var h Header
+			if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+				return
+			}
+			hdr := Header{
+				ProtocolID:    []byte(ProtocolSmb2),
+				StructureSize: 64,
+				Command:       h.Command,
+				Credits:       1,
+				MessageID:     h.MessageID,
+				Signature:     make([]byte, 16),
+			}
+			var res interface{}
+			switch h.Command {
+			case CommandCreate:
+				res = &CreateRes{Header: hdr, StructureSize: 89, FileId: make([]byte, 16)}
+			case CommandSetInfo:
+				var req SetInfoReq
+				if err = encoder.Unmarshal(buf, &req); err != nil {
+					return
+				}
+				setInfo <- req
+				res = &SetInfoRes{Header: hdr, StructureSize: 2}
+			case CommandClose:
+				res = &CloseRes{Header: hdr, StructureSize: 60}
+			}
+			if err = writeTestFrame(server, res); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := c.Rename("share", "dir/old.txt", "/dir/new.txt", true); err != nil {
+		t.Fatal(err)
+	}
+	req := <-setInfo
+	name := encoder.ToUnicode(`dir\new.txt`)
+	if req.FileInfoClass != FileRenameInformation || len(req.Buffer) != 20+len(name) {
+		t.Fatalf("Fail: %x", req.Buffer)
+	}
+	if req.Buffer[0] != 1 || binary.LittleEndian.Uint32(req.Buffer[16:20]) != uint32(len(name)) || !bytes.Equal(req.Buffer[20:], name) {
+		t.Fatalf("Fail: %x", req.Buffer)
+	}
+}
+
+func TestSetFileTimes(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.credits.Store(100)
+
+	// The server answers CREATE, SET_INFO and CLOSE requests
+	setInfo := make(chan SetInfoReq, 1)
+	go func() {
+		for {
+			buf, err := readTestFrame(server)
+			if err != nil {
+				return
+			}
+			var h Header
+			if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+				return
+			}
+			hdr := Header{
+				ProtocolID:    []byte(ProtocolSmb2),
+				StructureSize: 64,
+				Command:       h.Command,
+				Credits:       1,
+				MessageID:     h.MessageID,
+				Signature:     make([]byte, 16),
+			}
+			var res interface{}
+			switch h.Command {
+			case CommandCreate:
+				res = &CreateRes{Header: hdr, StructureSize: 89, FileId: make([]byte, 16)}
+			case CommandSetInfo:
+				var req SetInfoReq
+				if err = encoder.Unmarshal(buf, &req); err != nil {
+					return
+				}
+				setInfo <- req
+				res = &SetInfoRes{Header: hdr, StructureSize: 2}
+			case CommandClose:
+				res = &CloseRes{Header: hdr, StructureSize: 60}
+			}
+			if err = writeTestFrame(server, res); err != nil {
+				return
+			}
+		}
+	}()
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	modified := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	if err := c.SetFileTimes("share", "dir/file.txt", created, modified, time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	req := <-setInfo
+	if req.FileInfoClass != FileBasicInformation || len(req.Buffer) != 40 {
+		t.Fatalf("Fail: %x", req.Buffer)
+	}
+	if binary.LittleEndian.Uint64(req.Buffer[0:]) != msdtyp.TimeToFiletime(created) ||
+		binary.LittleEndian.Uint64(req.Buffer[8:]) != 0 ||
+		binary.LittleEndian.Uint64(req.Buffer[16:]) != msdtyp.TimeToFiletime(modified) ||
+		binary.LittleEndian.Uint64(req.Buffer[24:]) != 0 ||
+		binary.LittleEndian.Uint32(req.Buffer[32:]) != 0 {
+		t.Fatalf("Fail: %x", req.Buffer)
+	}
+}
+
+func TestFiletime(t *testing.T) {
+	tm := time.Date(2020, 1, 1, 0, 0, 0, 100, time.UTC)
+	var ft Filetime
+	ft.FromTime(tm)
+	if ft.DwHighDateTime != 0x01D5C036 || ft.DwLowDateTime != 0x69050001 || !ft.ToTime().Equal(tm) {
+		t.Fatalf("Fail: %+v", ft)
+	}
+	// The zero Time is a zero FILETIME and the never sentinels a zero Time
+	ft.FromTime(time.Time{})
+	if ft.DwHighDateTime != 0 || ft.DwLowDateTime != 0 || !ft.ToTime().IsZero() {
+		t.Fatalf("Fail: %+v", ft)
+	}
+	for _, never := range []uint64{msdtyp.FiletimeNever, msdtyp.FiletimeInfinite} {
+		ft = Filetime{DwLowDateTime: uint32(never), DwHighDateTime: uint32(never >> 32)}
+		if !ft.ToTime().IsZero() {
+			t.Fatal("Fail")
+		}
+		ft.FromTime(ft.ToTime())
+		if ft.DwHighDateTime != 0 || ft.DwLowDateTime != 0 {
+			t.Fatalf("Fail: %+v", ft)
+		}
+	}
+}
+
+func TestCheckShareAccess(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.credits.Store(100)
+
+	// The server accepts tree connects to "public" but denies opening its root
+	go func() {
+		for {
+			buf, err := readTestFrame(server)
+			if err != nil {
+				return
+			}
+			var h Header
+			if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+				return
+			}
+			hdr := Header{
+				ProtocolID:    []byte(ProtocolSmb2),
+				StructureSize: 64,
+				Command:       h.Command,
+				Credits:       1,
+				MessageID:     h.MessageID,
+				Signature:     make([]byte, 16),
+			}
+			// SMB2 ERROR response
+			denied := &struct {
+				Header
+				StructureSize uint16
+				Reserved      uint16
+				ByteCount     uint32
+				ErrorData     byte
+			}{StructureSize: 9}
+			var res interface{}
+			switch h.Command {
+			case CommandTreeConnect:
+				var req TreeConnectReq
+				if err = encoder.Unmarshal(buf, &req); err != nil {
+					return
+				}
+				if path, _ := encoder.FromUnicodeString(req.Path); strings.HasSuffix(path, `\public`) {
+					hdr.TreeID = 5
+					res = &TreeConnectRes{Header: hdr, StructureSize: 16}
+				} else {
+					hdr.Status = StatusAccessDenied
+					denied.Header = hdr
+					res = denied
+				}
+			case CommandTreeDisconnect:
+				res = &TreeDisconnectRes{Header: hdr, StructureSize: 4}
+			default:
+				hdr.Status = StatusAccessDenied
+				denied.Header = hdr
+				res = denied
+			}
+			if err = writeTestFrame(server, res); err != nil {
+				return
+			}
+		}
+	}()
+
+	access, err := c.CheckShareAccess("private", true)
+	if err != nil || access != (ShareAccess{}) {
+		t.Fatalf("Fail: %+v %v", access, err)
+	}
+	access, err = c.CheckShareAccess("public", false)
+	if err != nil || access != (ShareAccess{Connect: true}) {
+		t.Fatalf("Fail: %+v %v", access, err)
+	}
+	if _, ok := c.trees["public"]; ok {
+		t.Fatal("Fail")
+	}
+}
+
+func TestCreateSecurityQoS(t *testing.T) {
+	level := ImpersonationLevelIdentification
+	c, server := newTestConnection(t, Options{ImpersonationLevel: &level, SecurityFlags: SecurityFlagEffectiveOnly})
+	c.credits.Store(100)
+
+	// The server records the impersonation level and security flags of
+	// each CREATE
+	type qos struct {
+		level uint32
+		flags byte
+	}
+	creates := make(chan qos, 10)
+	go func() {
+		for {
+			buf, err := readTestFrame(server)
+			if err != nil {
+				return
+			}
+			var h Header
+			if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+				return
+			}
+			creates <- qos{binary.LittleEndian.Uint32(buf[68:]), buf[66]}
+			res := CreateRes{
+				Header: Header{
+					ProtocolID:    []byte(ProtocolSmb2),
+					StructureSize: 64,
+					Command:       CommandCreate,
+					Credits:       1,
+					MessageID:     h.MessageID,
+					Signature:     make([]byte, 16),
+				},
+				StructureSize: 89,
+				FileId:        make([]byte, 16),
+			}
+			if err = writeTestFrame(server, &res); err != nil {
+				return
+			}
+		}
+	}()
+
+	if _, err := c.OpenFile("share", "file"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if q := <-creates; q.level != ImpersonationLevelIdentification || q.flags != SecurityFlagEffectiveOnly {
+		t.Fatalf("Fail: %+v", q)
+	}
+
+	// Opens with CreateReqOpts are not affected by the options
+	opts := NewCreateReqOpts()
+	opts.ImpersonationLevel = ImpersonationLevelAnonymous
+	if _, err := c.OpenFileExt("share", "file", opts); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if q := <-creates; q.level != ImpersonationLevelAnonymous || q.flags != 0 {
+		t.Fatalf("Fail: %+v", q)
+	}
+
+	invalid := ImpersonationLevelDelegate + 1
+	if validateOptions(Options{Host: "host", Port: 445, ManualLogin: true, ImpersonationLevel: &invalid}) == nil {
+		t.Fatal("Fail")
+	}
+	if validateOptions(Options{Host: "host", Port: 445, ManualLogin: true, SecurityFlags: 0x04}) == nil {
+		t.Fatal("Fail")
+	}
+}
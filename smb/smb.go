@@ -32,10 +32,12 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jfjallid/golog"
 
 	"github.com/ericblavier/go-smb/gss"
+	"github.com/ericblavier/go-smb/msdtyp"
 	"github.com/ericblavier/go-smb/smb/encoder"
 	"github.com/ericblavier/go-smb/spnego"
 )
@@ -45,14 +47,20 @@ var log = golog.Get("github.com/ericblavier/go-smb/smb")
 const ProtocolSmb = "\xFFSMB"
 const ProtocolSmb2 = "\xFESMB"
 const ProtocolTransformHdr = "\xFDSMB"
+const ProtocolCompressed = "\xFCSMB"
 
 const SHA512 = 0x001
 
 const (
 	StatusOk                         uint32 = 0x00000000
 	StatusPending                    uint32 = 0x00000103
+	StatusNotifyCleanup              uint32 = 0x0000010b
+	StatusNotifyEnumDir              uint32 = 0x0000010c
 	StatusBufferOverflow             uint32 = 0x80000005
 	StatusNoMoreFiles                uint32 = 0x80000006
+	StatusNoMoreEntries              uint32 = 0x8000001a
+	StatusNotImplemented             uint32 = 0xc0000002
+	StatusInvalidInfoClass           uint32 = 0xc0000003
 	StatusInfoLengthMismatch         uint32 = 0xc0000004
 	StatusInvalidParameter           uint32 = 0xc000000d
 	StatusNoSuchFile                 uint32 = 0xc000000f
@@ -70,6 +78,7 @@ const (
 	StatusPasswordExpired            uint32 = 0xc0000071
 	StatusAccountDisabled            uint32 = 0xc0000072
 	FsctlStatusInsufficientResources uint32 = 0xc000009a //There were insufficient resources to complete the operation.
+	StatusInsufficientResources      uint32 = 0xc000009a // Same as FsctlStatusInsufficientResources
 	StatusPipeNotAvailable           uint32 = 0xc00000ac
 	FsctlStatusInvalidPipeState      uint32 = 0xc00000ad //The named pipe is not in the connected state or not in the full-duplex message mode.
 	StatusPipeBusy                   uint32 = 0xc00000ae
@@ -78,10 +87,13 @@ const (
 	StatusNotSupported               uint32 = 0xc00000bb
 	StatusNetworkNameDeleted         uint32 = 0xc00000c9
 	StatusBadNetworkName             uint32 = 0xc00000cc
+	StatusRequestNotAccepted         uint32 = 0xc00000d0
+	StatusPipeEmpty                  uint32 = 0xc00000d9
 	FsctlStatusInvalidUserBuffer     uint32 = 0xc00000e8 //An exception was raised while accessing a user buffer.
 	StatusDirectoryNotEmpty          uint32 = 0xc0000101
 	StatusNotADirectory              uint32 = 0xc0000103
 	StatusCannotDelete               uint32 = 0xc0000121
+	StatusFileClosed                 uint32 = 0xc0000128
 	FsctlStatusPipeBroken            uint32 = 0xc000014b // The pipe operation has failed because the other end of the pipe has been closed
 	StatusUserSessionDeleted         uint32 = 0xc0000203
 	StatusPasswordMustChange         uint32 = 0xc0000224
@@ -92,8 +104,13 @@ const (
 var StatusMap = map[uint32]error{
 	StatusOk:                         fmt.Errorf("OK"),
 	StatusPending:                    fmt.Errorf("Status Pending"),
+	StatusNotifyCleanup:              fmt.Errorf("The handle watched for changes was closed"),
+	StatusNotifyEnumDir:              fmt.Errorf("Too many changes to report, the directory must be enumerated again"),
 	StatusBufferOverflow:             fmt.Errorf("Response buffer overflow"),
 	StatusNoMoreFiles:                fmt.Errorf("No more files"),
+	StatusNoMoreEntries:              fmt.Errorf("No more entries"),
+	StatusNotImplemented:             fmt.Errorf("Not implemented"),
+	StatusInvalidInfoClass:           fmt.Errorf("Invalid information class"),
 	StatusInfoLengthMismatch:         fmt.Errorf("Insuffient size of response buffer"),
 	StatusInvalidParameter:           fmt.Errorf("Invalid Parameter"),
 	StatusNoSuchFile:                 fmt.Errorf("No such file"),
@@ -120,8 +137,13 @@ var StatusMap = map[uint32]error{
 	StatusPasswordMustChange:         fmt.Errorf("User is required to change password at next logon"),
 	StatusAccountLockedOut:           fmt.Errorf("User account has been locked!"),
 	StatusVirusInfected:              fmt.Errorf("The file contains a virus"),
+	StatusFileNotAvailable:           fmt.Errorf("The file is temporarily not available, the request or its replay was rejected"),
+	StatusDuplicateObjectId:          fmt.Errorf("The CreateGuid is already in use by another open"),
 	StatusFileIsADirectory:           fmt.Errorf("File is a directory!"),
+	StatusFileClosed:                 fmt.Errorf("The file handle is closed"),
 	FsctlStatusPipeDisconnected:      fmt.Errorf("FSCTL_STATUS_PIPE_DISCONNECTED"),
+	StatusPipeEmpty:                  fmt.Errorf("Pipe empty"),
+	StatusRequestNotAccepted:         fmt.Errorf("The server cannot accept more requests at this time"),
 	FsctlStatusInvalidPipeState:      fmt.Errorf("FSCTL_STATUS_INVALID_PIPE_STATE"),
 	FsctlStatusInvalidUserBuffer:     fmt.Errorf("FSCTL_STATUS_INVALID_USER_BUFFER"),
 	FsctlStatusInsufficientResources: fmt.Errorf("FSCTL_STATUS_INSUFFICIENT_RESOURCES"),
@@ -232,6 +254,14 @@ const (
 	ImpersonationLevelDelegate       uint32 = 0x00000003
 )
 
+// MS-SMB Section 2.2.4.64.1 Security QoS flags of the SecurityFlags field.
+// MS-SMB2 reserves the field of the CREATE request, so SMB2 servers are
+// expected to ignore them.
+const (
+	SecurityFlagContextTracking byte = 0x01 // Dynamic rather than static tracking of the security context
+	SecurityFlagEffectiveOnly   byte = 0x02 // Only the enabled privileges and groups of the client are usable
+)
+
 // MS-SMB2 Section 2.2.3.1 Context Type
 const (
 	PreauthIntegrityCapabilities uint16 = 0x0001
@@ -243,6 +273,16 @@ const (
 	SigningCapabilities          uint16 = 0x0008
 )
 
+// MS-SMB2 Section 2.2.3.1.3 Compression algorithms
+const (
+	CompressionNone        uint16 = 0x0000
+	CompressionLZNT1       uint16 = 0x0001
+	CompressionLZ77        uint16 = 0x0002
+	CompressionLZ77Huffman uint16 = 0x0003
+	CompressionPatternV1   uint16 = 0x0004
+	CompressionLZ4         uint16 = 0x0005
+)
+
 // MS-SMB2 Section 2.2.3.1.2 Ciphers
 const (
 	AES128CCM uint16 = 0x0001
@@ -413,6 +453,10 @@ const (
 	// ...
 	FsctlPipeTransceive uint32 = 0x0011C017
 	// ...
+	FsctlSetObjectId         uint32 = 0x00090098
+	FsctlGetObjectId         uint32 = 0x0009009c
+	FsctlDeleteObjectId      uint32 = 0x000900a0
+	FsctlCreateOrGetObjectId uint32 = 0x000900c0
 )
 
 // IOCTL Flags
@@ -489,7 +533,17 @@ const (
 	FileStandardLinkInformation        byte = 0x36 // LOCAL
 	FileIdInformation                  byte = 0x3b // Query
 	FileIdExtdDirectoryInformation     byte = 0x3c // Query
+	FileCaseSensitiveInformation       byte = 0x47 // Query, Set
+
+)
 
+// MS-FSCC Section 2.5 File System Information Classes
+const (
+	FileFsVolumeInformation    byte = 0x01
+	FileFsSizeInformation      byte = 0x03
+	FileFsDeviceInformation    byte = 0x04
+	FileFsAttributeInformation byte = 0x05
+	FileFsFullSizeInformation  byte = 0x07
 )
 
 // MS-DTYP Section 2.4.6 Security_Descriptor Control Flag
@@ -566,7 +620,7 @@ const (
 var (
 	accessMaskMap = map[uint32]string{
 		0x80000000: AccessMaskGenericRead,
-		0x4000000:  AccessMaskGenericWrite,
+		0x40000000: AccessMaskGenericWrite,
 		0x20000000: AccessMaskGenericExecute,
 		0x10000000: AccessMaskGenericAll,
 		0x02000000: AccessMaskMaximumAllowed,
@@ -582,6 +636,8 @@ var (
 // Custom error not part of SMB
 var ErrorNotDir = fmt.Errorf("Not a directory")
 
+//go:generate go run ./encoder/encgen -output encoder_gen.go Header TransformHeader NegContext SessionSetupReq SessionSetupRes LogoffReq LogoffRes TreeConnectReq TreeConnectRes TreeDisconnectReq TreeDisconnectRes CreateReq CreateRes CloseReq CloseRes QueryDirectoryReq QueryDirectoryRes FileBothDirectoryInformationStruct FileIdBothDirectoryInformationStruct ReadReq ReadRes WriteReq WriteRes SetInfoReq SetInfoRes IoCtlReq IoCtlRes ChangeNotifyReq ChangeNotifyRes SMB1Header
+
 type Header struct { // 64 bytes
 	ProtocolID    []byte `smb:"fixed:4"`
 	StructureSize uint16
@@ -608,6 +664,15 @@ type TransformHeader struct { // 52 bytes
 	SessionId           uint64
 }
 
+// MS-SMB2 Section 2.2.42.1 SMB2 COMPRESSION_TRANSFORM_HEADER (unchained)
+type CompressionTransformHeader struct { // 16 bytes
+	ProtocolID                    uint32
+	OriginalCompressedSegmentSize uint32 // Size of the data following Offset after decompression
+	CompressionAlgorithm          uint16
+	Flags                         uint16
+	Offset                        uint32 // Size of the uncompressed data preceding the compressed data
+}
+
 // MS-SMB2 Section 2.2.3
 type NegotiateReq struct {
 	Header
@@ -650,6 +715,18 @@ type NegotiateRes struct {
 	ContextList            []NegContext
 }
 
+// ServerSystemTime returns the SystemTime of the server from the negotiate
+// response
+func (self *NegotiateRes) ServerSystemTime() time.Time {
+	return msdtyp.FiletimeToTime(self.SystemTime)
+}
+
+// ServerStartupTime returns the ServerStartTime from the negotiate response.
+// Most servers leave it as zero which returns the zero Time.
+func (self *NegotiateRes) ServerStartupTime() time.Time {
+	return msdtyp.FiletimeToTime(self.ServerStartTime)
+}
+
 // For SMB 3.1.1
 // MS-SMB2 Section 2.2.3.1
 type NegContext struct {
@@ -673,6 +750,14 @@ type EncryptionContext struct {
 	Ciphers     []uint16
 }
 
+// MS-SMB2 2.2.3.1.3 SMB2_COMPRESSION_CAPABILITIES
+type CompressionContext struct {
+	CompressionAlgorithmCount uint16 `smb:"count:CompressionAlgorithms"`
+	Padding                   uint16
+	Flags                     uint32
+	CompressionAlgorithms     []uint16
+}
+
 // MS-SMB2 2.2.3.1.7 SMB2_SIGNING_CAPABILITIES
 type SigningContext struct {
 	SigningAlgorithmCount uint16 `smb:"count:SigningAlgorithms"`
@@ -771,6 +856,18 @@ type Filetime struct {
 	DwHighDateTime uint32
 }
 
+// ToTime converts the FILETIME to a time.Time
+func (self *Filetime) ToTime() time.Time {
+	return msdtyp.FiletimeToTime(uint64(self.DwHighDateTime)<<32 | uint64(self.DwLowDateTime))
+}
+
+// FromTime sets the FILETIME from a time.Time
+func (self *Filetime) FromTime(t time.Time) {
+	ft := msdtyp.TimeToFiletime(t)
+	self.DwLowDateTime = uint32(ft)
+	self.DwHighDateTime = uint32(ft >> 32)
+}
+
 type CreateReq struct {
 	Header
 	StructureSize        uint16 // Must always be 57 regardless of Buffer size
@@ -877,6 +974,44 @@ type QueryInfoRes struct {
 	Buffer             []byte
 }
 
+// MS-FSCC Section 2.4.49 FILE_STREAM_INFORMATION
+type FileStream struct {
+	Name           string
+	Size           uint64
+	AllocationSize uint64
+}
+
+// parseFileStreams decodes a list of FILE_STREAM_INFORMATION entries
+func parseFileStreams(buf []byte) (streams []FileStream, err error) {
+	for len(buf) > 0 {
+		if len(buf) < 24 {
+			return nil, fmt.Errorf("Buffer too small for FILE_STREAM_INFORMATION")
+		}
+		next := binary.LittleEndian.Uint32(buf)
+		nameLen := binary.LittleEndian.Uint32(buf[4:8])
+		if uint64(nameLen) > uint64(len(buf)-24) {
+			return nil, fmt.Errorf("Stream name exceeds the FILE_STREAM_INFORMATION buffer")
+		}
+		name, err := encoder.FromUnicodeString(buf[24 : 24+nameLen])
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, FileStream{
+			Name:           name,
+			Size:           binary.LittleEndian.Uint64(buf[8:16]),
+			AllocationSize: binary.LittleEndian.Uint64(buf[16:24]),
+		})
+		if next == 0 {
+			break
+		}
+		if uint64(next) > uint64(len(buf)) {
+			return nil, fmt.Errorf("Next entry offset exceeds the FILE_STREAM_INFORMATION buffer")
+		}
+		buf = buf[next:]
+	}
+	return
+}
+
 type SecurityDescriptor struct {
 	Revision    uint16
 	Control     uint16
@@ -958,15 +1093,73 @@ func (self *QueryInfoReq) MarshalBinary(meta *encoder.Metadata) (ret []byte, err
 }
 
 func (self *QueryInfoReq) UnmarshalBinary(buf []byte, meta *encoder.Metadata) (err error) {
-	return fmt.Errorf("NOT IMPLEMENTED UnmarshalBinary of QueryInfoReq")
+	log.Debugln("In UnmarshalBinary for QueryInfoReq")
+	if len(buf) < 104 {
+		return fmt.Errorf("Buffer too small for QueryInfoReq")
+	}
+	err = encoder.Unmarshal(buf[:64], &self.Header)
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	self.StructureSize = binary.LittleEndian.Uint16(buf[64:66])
+	self.InfoType = buf[66]
+	self.FileInfoClass = buf[67]
+	self.OutputBufferLength = binary.LittleEndian.Uint32(buf[68:72])
+	self.InputBufferOffset = binary.LittleEndian.Uint16(buf[72:74])
+	self.Reserved = binary.LittleEndian.Uint16(buf[74:76])
+	self.InputBufferLength = binary.LittleEndian.Uint32(buf[76:80])
+	self.AdditionalInformation = binary.LittleEndian.Uint32(buf[80:84])
+	self.Flags = binary.LittleEndian.Uint32(buf[84:88])
+	self.FileId = buf[88:104]
+
+	self.Buffer = nil
+	if self.InputBufferLength > 0 {
+		offset := int(self.InputBufferOffset)
+		if offset < 104 || offset > len(buf) || uint64(self.InputBufferLength) > uint64(len(buf)-offset) {
+			return fmt.Errorf("Invalid InputBuffer of QueryInfoReq")
+		}
+		self.Buffer = buf[offset : offset+int(self.InputBufferLength)]
+	}
+
+	return nil
 }
 
 func (self *QueryInfoRes) MarshalBinary(meta *encoder.Metadata) (ret []byte, err error) {
-	return nil, fmt.Errorf("NOT IMPLEMENTED MarshalBinary of QueryInfoRes")
+	log.Debugln("In MarshalBinary for QueryInfoRes")
+	buf := make([]byte, 0, 72+len(self.Buffer))
+
+	hBuf, err := encoder.Marshal(self.Header)
+	if err != nil {
+		log.Debugln(err)
+		return nil, err
+	}
+	buf = append(buf, hBuf...)
+	// StructureSize
+	buf = binary.LittleEndian.AppendUint16(buf, self.StructureSize)
+	// OutputBufferOffset
+	outputBufferOffset := uint16(0)
+	if len(self.Buffer) > 0 {
+		outputBufferOffset = 72 // 8 bytes for QueryInfo, 64 for SMB2 Header
+	}
+	buf = binary.LittleEndian.AppendUint16(buf, outputBufferOffset)
+	// OutputBufferLength
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(self.Buffer)))
+	// Buffer
+	buf = append(buf, self.Buffer...)
+	if len(self.Buffer) == 0 {
+		// The structure size includes a single byte of the variable part
+		buf = append(buf, 0)
+	}
+
+	return buf, nil
 }
 
 func (self *QueryInfoRes) UnmarshalBinary(buf []byte, meta *encoder.Metadata) error {
 	log.Debugln("In UnmarshalBinary for QueryInfoRes")
+	if len(buf) < 72 {
+		return fmt.Errorf("Buffer too small for QueryInfoRes")
+	}
 	err := encoder.Unmarshal(buf[:64], &self.Header)
 	if err != nil {
 		log.Errorln(err)
@@ -980,6 +1173,12 @@ func (self *QueryInfoRes) UnmarshalBinary(buf []byte, meta *encoder.Metadata) er
 	self.OutputBufferLength = binary.LittleEndian.Uint32(buf[offset : offset+4])
 
 	offset = int(self.OutputBufferOffset)
+	if offset > len(buf) || uint64(self.OutputBufferLength) > uint64(len(buf)-offset) {
+		return fmt.Errorf("Invalid OutputBuffer of QueryInfoRes")
+	}
+	if meta.StrictBounds() && self.OutputBufferLength > 0 && offset < 72 {
+		return fmt.Errorf("OutputBuffer of QueryInfoRes overlaps the header")
+	}
 	self.Buffer = buf[offset : offset+int(self.OutputBufferLength)]
 
 	return nil
@@ -1114,8 +1313,22 @@ func (self *SecurityDescriptor) UnmarshalBinary(buf []byte, meta *encoder.Metada
 		return
 	}
 
+	if meta.StrictBounds() {
+		for _, offset := range []uint32{self.OffsetOwner, self.OffsetGroup, self.OffsetSacl, self.OffsetDacl} {
+			if offset != 0 && (offset < 20 || offset >= uint32(len(buf))) {
+				err = fmt.Errorf("Invalid offset %d in SecurityDescriptor", offset)
+				log.Errorln(err)
+				return
+			}
+		}
+	}
+
 	if self.OffsetOwner != 0 {
 		_, err = r.Seek(int64(self.OffsetOwner), io.SeekStart)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
 		self.OwnerSid, err = readSID(r)
 		if err != nil {
 			log.Errorln(err)
@@ -1206,6 +1419,12 @@ func readSID(r *bytes.Reader) (s *SID, err error) {
 		return
 	}
 
+	if s.NumAuth > 15 {
+		err = fmt.Errorf("SID with %d sub authorities exceeds the maximum of 15", s.NumAuth)
+		log.Errorln(err)
+		return
+	}
+
 	s.Authority = make([]byte, 6)
 	err = binary.Read(r, binary.LittleEndian, &s.Authority)
 	if err != nil {
@@ -1309,6 +1528,12 @@ func readACE(r *bytes.Reader) (a *ACE, err error) {
 	}
 	a.Sid = *sid
 
+	if int(a.Header.Size) < 16+4*len(sid.SubAuthorities) {
+		err = fmt.Errorf("ACE size %d is smaller than its content", a.Header.Size)
+		log.Errorln(err)
+		return
+	}
+
 	return
 }
 
@@ -1381,6 +1606,16 @@ func readPACL(r *bytes.Reader) (p *PACL, err error) {
 		return
 	}
 
+	// Each ACE takes at least 16 bytes of the input and of the ACL
+	err = encoder.CheckCount(uint64(p.AceCount), 16, r.Len())
+	if err == nil {
+		err = encoder.CheckCount(uint64(p.AceCount), 16, int(p.AclSize)-8)
+	}
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
 	p.ACLS = make([]ACE, p.AceCount)
 	for i := range p.ACLS {
 		var ace *ACE
@@ -1464,6 +1699,27 @@ type FileBothDirectoryInformationStruct struct {
 	FileName        []byte
 }
 
+// MS-FSCC Section 2.4.17 FILE_ID_BOTH_DIR_INFORMATION
+type FileIdBothDirectoryInformationStruct struct {
+	NextEntryOffset uint32
+	FileIndex       uint32
+	CreationTime    uint64
+	LastAccessTime  uint64
+	LastWriteTime   uint64
+	ChangeTime      uint64
+	EndOfFile       uint64
+	AllocationSize  uint64
+	FileAttributes  uint32
+	FileNameLength  uint32 `smb:"len:FileName"`
+	EaSize          uint32
+	ShortNameLength byte
+	Reserved1       byte
+	ShortName       []byte `smb:"fixed:24"`
+	Reserved2       uint16
+	FileId          uint64
+	FileName        []byte
+}
+
 type SharedFile struct {
 	Name           string
 	FullPath       string
@@ -1476,9 +1732,30 @@ type SharedFile struct {
 	LastAccessTime uint64
 	LastWriteTime  uint64
 	ChangeTime     uint64
+	MacOS          *MacOSAttributes // Only set when listing a directory of a macOS server with readdir attributes
 	//FileId          uint64
 }
 
+// Created returns the CreationTime of the file as a time.Time
+func (self *SharedFile) Created() time.Time {
+	return msdtyp.FiletimeToTime(self.CreationTime)
+}
+
+// Accessed returns the LastAccessTime of the file as a time.Time
+func (self *SharedFile) Accessed() time.Time {
+	return msdtyp.FiletimeToTime(self.LastAccessTime)
+}
+
+// Modified returns the LastWriteTime of the file as a time.Time
+func (self *SharedFile) Modified() time.Time {
+	return msdtyp.FiletimeToTime(self.LastWriteTime)
+}
+
+// Changed returns the ChangeTime of the file as a time.Time
+func (self *SharedFile) Changed() time.Time {
+	return msdtyp.FiletimeToTime(self.ChangeTime)
+}
+
 type ReadReq struct {
 	Header
 	StructureSize         uint16 // Must always be 49 regardless of Buffer size
@@ -1506,6 +1783,23 @@ type ReadRes struct {
 	Buffer        []byte
 }
 
+// readResponseData returns the data region of a READ response by slicing it
+// out of buf instead of decoding the response into a ReadRes.
+func readResponseData(buf []byte) ([]byte, error) {
+	if len(buf) < readResponseDataOffset {
+		return nil, fmt.Errorf("Read response is too short")
+	}
+	offset := int(buf[66])
+	length := int(binary.LittleEndian.Uint32(buf[68:72]))
+	if length == 0 {
+		return nil, nil
+	}
+	if offset < readResponseDataOffset || offset > len(buf) || length > len(buf)-offset {
+		return nil, fmt.Errorf("Returned offset is outside response buffer")
+	}
+	return buf[offset : offset+length], nil
+}
+
 type WriteReq struct {
 	Header
 	StructureSize          uint16 // Must always be 49 regardless of Buffer size
@@ -1643,6 +1937,9 @@ func (self *NegotiateReq) MarshalBinary(meta *encoder.Metadata) ([]byte, error)
 
 func (self *NegotiateReq) UnmarshalBinary(buf []byte, meta *encoder.Metadata) error {
 	log.Debugln("In UnmarshalBinary for NegotiateReq")
+	if len(buf) < 100 {
+		return fmt.Errorf("Buffer too small for NegotiateReq")
+	}
 	err := encoder.Unmarshal(buf[:64], &self.Header)
 	if err != nil {
 		log.Errorln(err)
@@ -1653,6 +1950,8 @@ func (self *NegotiateReq) UnmarshalBinary(buf []byte, meta *encoder.Metadata) er
 	offset += 2
 	self.DialectCount = binary.LittleEndian.Uint16(buf[offset : offset+2])
 	offset += 2
+	self.SecurityMode = binary.LittleEndian.Uint16(buf[offset : offset+2])
+	offset += 2
 	// 2 bytes reserved
 	offset += 2
 	self.Capabilities = binary.LittleEndian.Uint32(buf[offset : offset+4])
@@ -1665,6 +1964,9 @@ func (self *NegotiateReq) UnmarshalBinary(buf []byte, meta *encoder.Metadata) er
 	offset += 2
 	// 2 bytes reserved2
 	offset += 2
+	if int(self.DialectCount)*2 > len(buf)-offset {
+		return fmt.Errorf("Invalid DialectCount of NegotiateReq")
+	}
 	for i := 0; i < int(self.DialectCount); i++ {
 		self.Dialects = append(self.Dialects, binary.LittleEndian.Uint16(buf[offset:offset+2]))
 		offset += 2
@@ -1672,6 +1974,9 @@ func (self *NegotiateReq) UnmarshalBinary(buf []byte, meta *encoder.Metadata) er
 
 	offset = int(self.NegotiateContextOffset)
 	for i := 0; i < int(self.NegotiateContextCount); i++ {
+		if offset > len(buf) {
+			return fmt.Errorf("Invalid NegotiateContextOffset of NegotiateReq")
+		}
 		var negContext NegContext
 		err = encoder.Unmarshal(buf[offset:], &negContext)
 		if err != nil {
@@ -1721,16 +2026,7 @@ func (s *Session) NewNegotiateReq() (req NegotiateReq, err error) {
 	header.Command = CommandNegotiate
 	header.CreditCharge = 1
 
-	var dialects []uint16
-
-	if s.options.ForceSMB2 {
-		dialects = []uint16{DialectSmb_2_1}
-	} else {
-		dialects = []uint16{
-			DialectSmb_3_1_1,
-			DialectSmb_2_1,
-		}
-	}
+	dialects := s.offeredDialects()
 
 	req = NegotiateReq{
 		Header:        header,
@@ -1752,8 +2048,8 @@ func (s *Session) NewNegotiateReq() (req NegotiateReq, err error) {
 
 	if !s.options.ForceSMB2 {
 		pic := PreauthIntegrityContext{
-			HashAlgorithmCount: 1,
-			HashAlgorithms:     []uint16{SHA512},
+			HashAlgorithmCount: uint16(len(offeredHashAlgorithms)),
+			HashAlgorithms:     offeredHashAlgorithms,
 			SaltLength:         32,
 			Salt:               make([]byte, 32),
 		}
@@ -1762,12 +2058,12 @@ func (s *Session) NewNegotiateReq() (req NegotiateReq, err error) {
 			return req, err
 		}
 		cc := EncryptionContext{
-			CipherCount: 4,
-			Ciphers:     []uint16{AES128CCM, AES128GCM, AES256CCM, AES256GCM},
+			CipherCount: uint16(len(offeredCiphers)),
+			Ciphers:     offeredCiphers,
 		}
 		sc := SigningContext{
-			SigningAlgorithmCount: 1,
-			SigningAlgorithms:     []uint16{AES_CMAC},
+			SigningAlgorithmCount: uint16(len(offeredSigningAlgorithms)),
+			SigningAlgorithms:     offeredSigningAlgorithms,
 		}
 
 		picBuf, err := encoder.Marshal(pic)
@@ -1811,6 +2107,26 @@ func (s *Session) NewNegotiateReq() (req NegotiateReq, err error) {
 		}
 		req.ContextList = append(req.ContextList, n)
 
+		if s.options.Compression {
+			// Only unchained compression with Plain LZ77 is supported
+			cmc := CompressionContext{
+				CompressionAlgorithmCount: uint16(len(offeredCompressionAlgorithms)),
+				CompressionAlgorithms:     offeredCompressionAlgorithms,
+			}
+			cmcBuf, err := encoder.Marshal(cmc)
+			if err != nil {
+				log.Errorln(err)
+				return NegotiateReq{}, err
+			}
+			n = NegContext{
+				ContextType: CompressionCapabilities,
+				Data:        cmcBuf,
+				DataLength:  uint16(len(cmcBuf)),
+				Padd:        make([]byte, (8-(len(cmcBuf)%8))%8),
+			}
+			req.ContextList = append(req.ContextList, n)
+		}
+
 		req.NegotiateContextCount = uint16(len(req.ContextList))
 	}
 
@@ -1854,7 +2170,7 @@ func (s *Connection) NewSessionSetup1Req(spnegoClient *spnego.Client) (req Sessi
 	}
 
 	var init gss.NegTokenInit
-	err = encoder.Unmarshal(negTokenInitbytes, &init)
+	err = s.unmarshal(negTokenInitbytes, &init)
 	if err != nil {
 		log.Errorln(err)
 		return
@@ -1910,7 +2226,7 @@ func (s *Connection) NewSessionSetup2Req(sc []byte, msg *SessionSetup1Res) (Sess
 	header.SessionID = s.sessionID
 
 	var resp gss.NegTokenResp
-	err := encoder.Unmarshal(sc, &resp)
+	err := s.unmarshal(sc, &resp)
 	if err != nil {
 		log.Errorln(err)
 		return SessionSetup2Req{}, err
@@ -2040,8 +2356,8 @@ func (s *Session) NewCreateReq(share, name string,
 
 	return CreateReq{
 		Header:               header,
-		StructureSize:        57, // Must be 57
-		SecurityFlags:        0,  // Must be 0
+		StructureSize:        57,                      // Must be 57
+		SecurityFlags:        s.options.SecurityFlags, // Should be 0
 		RequestedOplockLevel: opLockLevel,
 		ImpersonationLevel:   impersonationLevel, //Should likely be ImpersonationLevelImpersonation (2)
 		SmbCreateFlags:       0,                  // Must be 0
@@ -2288,7 +2604,7 @@ func (s *Session) NewQueryInfoReq(
 		}
 	}
 
-	return QueryInfoReq{
+	req := QueryInfoReq{
 		Header:                header, //Size 64 bytes
 		StructureSize:         41,
 		InfoType:              infoType,
@@ -2298,5 +2614,11 @@ func (s *Session) NewQueryInfoReq(
 		FileId:                fileId,
 		OutputBufferLength:    outputBufferLength,
 		Buffer:                inputBuffer,
-	}, nil
+	}
+	// Set for requests marshalled without MarshalBinary, which computes them
+	if len(inputBuffer) > 0 {
+		req.InputBufferOffset = 104 // 40 bytes for QueryInfo, 64 for SMB2 Header
+		req.InputBufferLength = uint32(len(inputBuffer))
+	}
+	return req, nil
 }
@@ -25,7 +25,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"time"
 
+	"github.com/ericblavier/go-smb/msdtyp"
 	"github.com/ericblavier/go-smb/smb/encoder"
 )
 
@@ -113,8 +115,18 @@ type SMB1NegotiateRes struct {
 	SecurityBlob []byte // Security blob (NTLM challenge, etc.)
 }
 
+// ServerSystemTime returns the SystemTime of the server from the negotiate
+// response
+func (self *SMB1NegotiateRes) ServerSystemTime() time.Time {
+	return msdtyp.FiletimeToTime(self.SystemTime)
+}
+
+// UnmarshalBinary decodes the parameter words according to WordCount. Only
+// the DialectIndex is decoded unless the server selected the NT LM 0.12
+// dialect, whose response has 17 words. Truncated parameter words are
+// tolerated as some servers send shorter responses.
 func (self *SMB1NegotiateRes) UnmarshalBinary(buf []byte, meta *encoder.Metadata) error {
-	if len(buf) < 37 { // Minimum size: 32 byte header + 5 bytes minimum response
+	if len(buf) < 33 { // 32 byte header and the WordCount
 		return fmt.Errorf("SMB1 negotiate response too short: %d bytes", len(buf))
 	}
 
@@ -122,87 +134,66 @@ func (self *SMB1NegotiateRes) UnmarshalBinary(buf []byte, meta *encoder.Metadata
 	if err := encoder.Unmarshal(buf[:32], &self.Header); err != nil {
 		return fmt.Errorf("failed to unmarshal SMB1 header: %v", err)
 	}
-
-	// Parse negotiate response body
-	offset := 32
-	self.WordCount = buf[offset]
-	offset++
-
+	self.WordCount = buf[32]
 	if self.WordCount == 0 {
 		// No common dialect found
 		self.DialectIndex = 0xFFFF
 		return nil
 	}
 
-	// Parse DialectIndex (required field)
-	if len(buf) < offset+2 {
-		return fmt.Errorf("SMB1 negotiate response missing DialectIndex")
-	}
-	self.DialectIndex = binary.LittleEndian.Uint16(buf[offset : offset+2])
-	offset += 2
-
-	// Parse remaining fields with bounds checking - some servers send shorter responses
-	if len(buf) >= offset+1 {
-		self.SecurityMode = buf[offset]
-		offset++
-	}
-
-	if len(buf) >= offset+2 {
-		self.MaxMpxCount = binary.LittleEndian.Uint16(buf[offset : offset+2])
-		offset += 2
-	}
-
-	if len(buf) >= offset+2 {
-		self.MaxVcCount = binary.LittleEndian.Uint16(buf[offset : offset+2])
-		offset += 2
-	}
-
-	if len(buf) >= offset+4 {
-		self.MaxBufSize = binary.LittleEndian.Uint32(buf[offset : offset+4])
-		offset += 4
+	// The parameter words that are present in the buffer
+	words := buf[33:]
+	if len(words) > 2*int(self.WordCount) {
+		words = words[:2*int(self.WordCount)]
 	}
-
-	if len(buf) >= offset+4 {
-		self.MaxRawSize = binary.LittleEndian.Uint32(buf[offset : offset+4])
-		offset += 4
+	if len(words) < 2 {
+		return fmt.Errorf("SMB1 negotiate response missing DialectIndex")
 	}
-
-	if len(buf) >= offset+4 {
-		self.SessionKey = binary.LittleEndian.Uint32(buf[offset : offset+4])
-		offset += 4
+	le := binary.LittleEndian
+	self.DialectIndex = le.Uint16(words)
+	if self.WordCount < 17 {
+		return nil
 	}
-
-	if len(buf) >= offset+4 {
-		self.Capabilities = binary.LittleEndian.Uint32(buf[offset : offset+4])
-		offset += 4
+	// Parse remaining fields with bounds checking
+	fields := []struct {
+		size int
+		set  func(b []byte)
+	}{
+		{1, func(b []byte) { self.SecurityMode = b[0] }},
+		{2, func(b []byte) { self.MaxMpxCount = le.Uint16(b) }},
+		{2, func(b []byte) { self.MaxVcCount = le.Uint16(b) }},
+		{4, func(b []byte) { self.MaxBufSize = le.Uint32(b) }},
+		{4, func(b []byte) { self.MaxRawSize = le.Uint32(b) }},
+		{4, func(b []byte) { self.SessionKey = le.Uint32(b) }},
+		{4, func(b []byte) { self.Capabilities = le.Uint32(b) }},
+		{8, func(b []byte) { self.SystemTime = le.Uint64(b) }},
+		{2, func(b []byte) { self.TimeZone = int16(le.Uint16(b)) }},
+		{1, func(b []byte) { self.KeyLength = b[0] }},
 	}
-
-	if len(buf) >= offset+8 {
-		self.SystemTime = binary.LittleEndian.Uint64(buf[offset : offset+8])
-		offset += 8
+	offset := 2
+	for _, f := range fields {
+		if len(words) < offset+f.size {
+			return nil
+		}
+		f.set(words[offset : offset+f.size])
+		offset += f.size
 	}
 
-	if len(buf) >= offset+2 {
-		self.TimeZone = int16(binary.LittleEndian.Uint16(buf[offset : offset+2]))
-		offset += 2
+	// Parse ByteCount and SecurityBlob, which follow all the parameter words
+	offset = 33 + 2*int(self.WordCount)
+	if len(buf) < offset+2 {
+		return nil
 	}
-
-	if len(buf) >= offset+1 {
-		self.KeyLength = buf[offset]
-		offset++
+	self.ByteCount = le.Uint16(buf[offset:])
+	offset += 2
+	data := buf[offset:]
+	if len(data) > int(self.ByteCount) {
+		data = data[:self.ByteCount]
 	}
-
-	// Parse ByteCount and SecurityBlob
-	if len(buf) >= offset+2 {
-		self.ByteCount = binary.LittleEndian.Uint16(buf[offset : offset+2])
-		offset += 2
-
-		if self.KeyLength > 0 && len(buf) >= offset+int(self.KeyLength) {
-			self.SecurityBlob = make([]byte, self.KeyLength)
-			copy(self.SecurityBlob, buf[offset:offset+int(self.KeyLength)])
-		}
+	if self.KeyLength > 0 && len(data) >= int(self.KeyLength) {
+		self.SecurityBlob = make([]byte, self.KeyLength)
+		copy(self.SecurityBlob, data[:self.KeyLength])
 	}
-
 	return nil
 }
 
@@ -262,6 +253,11 @@ func (s *Session) NewSMB1NegotiateReq() (req SMB1NegotiateReq, err error) {
 		},
 	}
 
+	if s.options.ForceSMB1 {
+		// Only the SMBv1 dialects
+		dialects = dialects[:6]
+	}
+
 	req = SMB1NegotiateReq{
 		Header:   header,
 		Dialects: dialects,
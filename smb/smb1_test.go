@@ -0,0 +1,114 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func smb1NegotiateResponse(words, data []byte) []byte {
+	buf := append([]byte(ProtocolSmb), SMB1CommandNegotiate)
+	buf = append(buf, make([]byte, 27)...)
+	buf = append(buf, byte(len(words)/2))
+	buf = append(buf, words...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(data)))
+	return append(buf, data...)
+}
+
+func TestSMB1NegotiateRes(t *testing.T) {
+	le := binary.LittleEndian
+	words := le.AppendUint16(nil, 0) // DialectIndex
+	words = append(words, 3)         // SecurityMode
+	words = le.AppendUint16(words, 50)
+	words = le.AppendUint16(words, 1)
+	words = le.AppendUint32(words, 16644)
+	words = le.AppendUint32(words, 65536)
+	words = le.AppendUint32(words, 0x1234)
+	words = le.AppendUint32(words, 0x8000e3fd)
+	words = le.AppendUint64(words, 0x01d00000_00000000)
+	words = le.AppendUint16(words, 0)
+	words = append(words, 8) // KeyLength
+	challenge := []byte("01234567")
+	buf := smb1NegotiateResponse(words, append(bytes.Clone(challenge), "DOMAIN\x00"...))
+
+	var res SMB1NegotiateRes
+	if err := res.UnmarshalBinary(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if res.WordCount != 17 || res.DialectIndex != 0 || res.SessionKey != 0x1234 || res.MaxBufSize != 16644 || !bytes.Equal(res.SecurityBlob, challenge) {
+		t.Fatalf("Fail: %+v", res)
+	}
+
+	// The ByteCount follows the words announced by WordCount, such as the
+	// single word of a core dialect response
+	buf = smb1NegotiateResponse([]byte{2, 0}, []byte{0xff, 0xff, 0xff})
+	res = SMB1NegotiateRes{}
+	if err := res.UnmarshalBinary(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if res.DialectIndex != 2 || res.ByteCount != 0 || res.KeyLength != 0 || res.SecurityBlob != nil {
+		t.Fatalf("Fail: %+v", res)
+	}
+
+	// A KeyLength larger than the ByteCount
+	words[len(words)-1] = 16
+	buf = smb1NegotiateResponse(words, challenge)
+	res = SMB1NegotiateRes{}
+	if err := res.UnmarshalBinary(append(buf, make([]byte, 16)...), nil); err != nil || res.SecurityBlob != nil {
+		t.Fatalf("Fail: %+v %v", res, err)
+	}
+
+	// No common dialect
+	buf = smb1NegotiateResponse(nil, nil)
+	res = SMB1NegotiateRes{}
+	if err := res.UnmarshalBinary(buf, nil); err != nil || res.DialectIndex != 0xffff {
+		t.Fatalf("Fail: %+v %v", res, err)
+	}
+}
+
+func TestDisableSMB1(t *testing.T) {
+	c, server := newTestConnection(t, Options{DisableSMB1: true})
+	c.clientGuid = make([]byte, 16)
+	res := make(chan error, 1)
+	go func() {
+		res <- c.NegotiateProtocol()
+	}()
+	buf, err := readTestFrame(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:4]) != ProtocolSmb2 || binary.LittleEndian.Uint16(buf[12:14]) != CommandNegotiate {
+		t.Fatalf("Fail: %x", buf[:16])
+	}
+	server.Close()
+	<-res
+}
+
+func TestForceSMB1(t *testing.T) {
+	c, server := newTestConnection(t, Options{ForceSMB1: true, ManualLogin: true})
+	res := make(chan error, 1)
+	go func() {
+		res <- c.NegotiateProtocol()
+	}()
+	buf, err := readTestFrame(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:4]) != ProtocolSmb || bytes.Contains(buf, []byte("SMB 2")) || !bytes.Contains(buf, []byte("NT LM 0.12\x00")) {
+		t.Fatalf("Fail: %q", buf)
+	}
+	res1 := smb1NegotiateResponse(binary.LittleEndian.AppendUint16(nil, 5), nil)
+	if _, err = server.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(res1))), res1...)); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-res; err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if c.SMB1Dialect() != "NT LM 0.12" {
+		t.Fatalf("Fail: %s", c.SMB1Dialect())
+	}
+
+	if err = validateOptions(Options{Host: "host", Port: 445, ForceSMB1: true, DisableSMB1: true, ManualLogin: true}); err == nil {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,456 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smbdirect
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Provider is an RDMA capable network stack, such as a binding to
+// libibverbs or to the Network Direct interface of Windows
+type Provider interface {
+	// Dial establishes a reliable connection with addr. The endpoint keeps
+	// receiveDepth receives of receiveSize bytes posted at all times.
+	Dial(ctx context.Context, addr string, receiveDepth, receiveSize int) (Endpoint, error)
+}
+
+// Endpoint is a connected queue pair
+type Endpoint interface {
+	// Send posts msg as an RDMA send and returns once it has completed
+	Send(msg []byte) error
+	// Recv returns the message of the next completed receive
+	Recv() ([]byte, error)
+	// Register registers buf for RDMA reads by the peer, and for RDMA
+	// writes as well when writable is set
+	Register(buf []byte, writable bool) (MemoryRegion, error)
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+	Close() error
+}
+
+// MemoryRegion is a buffer registered with an Endpoint
+type MemoryRegion interface {
+	Token() uint32   // Steering tag of the region, also known as the remote key
+	Address() uint64 // Address of the start of the buffer for the peer
+	Deregister() error
+}
+
+// Dialer establishes SMB Direct connections with a Provider. It is a
+// proxy.Dialer for smb.Options.ProxyDialer.
+type Dialer struct {
+	Provider          Provider
+	ReceiveCredits    int // Receives posted for messages from the server. Defaults to 255
+	MaxSendSize       int // Largest message sent. Defaults to 1364
+	MaxReceiveSize    int // Largest message received. Defaults to 8192
+	MaxFragmentedSize int // Largest SMB message received. Defaults to 1MiB
+}
+
+// Conn is an SMB Direct connection. It is a net.Conn carrying the SMB2
+// messages framed with the 4 byte header of the Direct TCP transport, such
+// that it can replace a TCP connection. Each SMB message written is sent in
+// one or more data transfer messages and the data transfer messages
+// received are reassembled into SMB messages.
+type Conn struct {
+	ep                Endpoint
+	receiveCredits    int
+	maxSendSize       int // Largest data transfer message the peer accepts
+	maxFragmentedSize int // Largest SMB message the peer accepts
+	maxReceiveSize    int // Largest SMB message accepted from the peer
+	maxReadWriteSize  int
+
+	wm   sync.Mutex // Serializes Write
+	wbuf []byte
+	sm   sync.Mutex // Serializes sends
+
+	cm          sync.Mutex
+	cond        *sync.Cond
+	sendCredits int   // Messages the peer is ready to receive
+	peerCredits int   // Receive credits granted to the peer and not yet used
+	err         error // Reason the connection is unusable
+
+	rbuf     []byte
+	msgs     chan []byte
+	dm       sync.Mutex
+	deadline time.Time
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (self *Dialer) Dial(network, addr string) (net.Conn, error) {
+	return self.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to addr with the Provider and negotiates SMB Direct.
+// The network is ignored as the transport is decided by the provider.
+func (self *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if self.Provider == nil {
+		return nil, fmt.Errorf("No RDMA provider for SMB Direct")
+	}
+	c := &Conn{
+		receiveCredits: withDefault(self.ReceiveCredits, DefaultReceiveCredits),
+		maxSendSize:    withDefault(self.MaxSendSize, DefaultMaxSendSize),
+		maxReceiveSize: withDefault(self.MaxFragmentedSize, DefaultMaxFragmentedSize),
+		msgs:           make(chan []byte, 16),
+		done:           make(chan struct{}),
+	}
+	c.cond = sync.NewCond(&c.cm)
+	if c.receiveCredits > 0xffff {
+		return nil, fmt.Errorf("Too many SMB Direct receive credits: %d", c.receiveCredits)
+	}
+	receiveSize := withDefault(self.MaxReceiveSize, DefaultMaxReceiveSize)
+	ep, err := self.Provider.Dial(ctx, addr, c.receiveCredits, receiveSize)
+	if err != nil {
+		return nil, err
+	}
+	c.ep = ep
+	if err = c.negotiate(ctx, receiveSize); err != nil {
+		ep.Close()
+		return nil, err
+	}
+	go c.recvLoop()
+	return c, nil
+}
+
+func withDefault(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+// MS-SMBD Section 3.1.5.2 Negotiates the version and the sizes of the
+// messages with the server
+func (c *Conn) negotiate(ctx context.Context, receiveSize int) (err error) {
+	req := NegotiateReq{
+		MinVersion:        Version1,
+		MaxVersion:        Version1,
+		CreditsRequested:  uint16(c.receiveCredits),
+		PreferredSendSize: uint32(c.maxSendSize),
+		MaxReceiveSize:    uint32(receiveSize),
+		MaxFragmentedSize: uint32(c.maxReceiveSize),
+	}
+	buf, _ := req.MarshalBinary()
+	if err = c.ep.Send(buf); err != nil {
+		return
+	}
+	type result struct {
+		buf []byte
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		buf, err := c.ep.Recv()
+		ch <- result{buf, err}
+	}()
+	var r result
+	select {
+	case r = <-ch:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if r.err != nil {
+		return r.err
+	}
+	var res NegotiateRes
+	if err = res.UnmarshalBinary(r.buf); err != nil {
+		return
+	}
+	if res.Status != 0 {
+		return fmt.Errorf("SMB Direct negotiation failed with status 0x%x", res.Status)
+	}
+	if res.NegotiatedVersion != Version1 {
+		return fmt.Errorf("Server negotiated unsupported SMB Direct version 0x%04x", res.NegotiatedVersion)
+	}
+	if res.CreditsGranted == 0 {
+		return fmt.Errorf("Server granted no SMB Direct credits")
+	}
+	// MS-SMBD Section 3.1.5.2 The server must accept messages of 128 bytes
+	if res.MaxReceiveSize < 128 {
+		return fmt.Errorf("Invalid SMB Direct MaxReceiveSize of server: %d", res.MaxReceiveSize)
+	}
+	if res.PreferredSendSize > uint32(receiveSize) {
+		return fmt.Errorf("Server sends larger SMB Direct messages (%d) than can be received (%d)", res.PreferredSendSize, receiveSize)
+	}
+	if int(res.MaxReceiveSize) < c.maxSendSize {
+		c.maxSendSize = int(res.MaxReceiveSize)
+	}
+	c.maxFragmentedSize = int(res.MaxFragmentedSize)
+	c.maxReadWriteSize = int(res.MaxReadWriteSize)
+	c.sendCredits = int(res.CreditsGranted)
+	log.Debugf("Negotiated SMB Direct with %d credits, MaxSendSize %d and MaxReadWriteSize %d\n", c.sendCredits, c.maxSendSize, c.maxReadWriteSize)
+	return nil
+}
+
+// MaxReadWriteSize is the largest buffer the server reads or writes with
+// RDMA in a single operation
+func (c *Conn) MaxReadWriteSize() int {
+	return c.maxReadWriteSize
+}
+
+// RegisterBuffer registers buf for RDMA access by the server and returns
+// the buffer descriptor to send in the channel info of a READ or WRITE
+// request. The server writes the data of a READ to buf when remoteWrite is
+// set and otherwise reads the data of a WRITE from buf. release must be
+// called once the response has been received.
+func (c *Conn) RegisterBuffer(buf []byte, remoteWrite bool) (descriptors []byte, release func(), err error) {
+	if len(buf) > c.maxReadWriteSize {
+		return nil, nil, fmt.Errorf("Buffer of %d bytes exceeds the SMB Direct MaxReadWriteSize of %d", len(buf), c.maxReadWriteSize)
+	}
+	mr, err := c.ep.Register(buf, remoteWrite)
+	if err != nil {
+		return
+	}
+	desc := BufferDescriptorV1{Offset: mr.Address(), Token: mr.Token(), Length: uint32(len(buf))}
+	descriptors, _ = desc.MarshalBinary()
+	release = func() {
+		if err := mr.Deregister(); err != nil {
+			log.Debugln(err)
+		}
+	}
+	return
+}
+
+// Write sends each complete SMB message in b, prefixed by its 4 byte
+// header, and buffers the rest until it has been written
+func (c *Conn) Write(b []byte) (n int, err error) {
+	c.wm.Lock()
+	defer c.wm.Unlock()
+	c.wbuf = append(c.wbuf, b...)
+	sent := 0
+	for len(c.wbuf)-sent >= 4 {
+		size := int(binary.BigEndian.Uint32(c.wbuf[sent:]) & 0x00FFFFFF)
+		if len(c.wbuf)-sent-4 < size {
+			break
+		}
+		if err = c.sendMessage(c.wbuf[sent+4 : sent+4+size]); err != nil {
+			return 0, err
+		}
+		sent += 4 + size
+	}
+	c.wbuf = c.wbuf[:copy(c.wbuf, c.wbuf[sent:])]
+	return len(b), nil
+}
+
+// sendMessage fragments msg into data transfer messages
+func (c *Conn) sendMessage(msg []byte) error {
+	if len(msg) > c.maxFragmentedSize {
+		return fmt.Errorf("SMB message of %d bytes exceeds the SMB Direct MaxFragmentedSize of %d", len(msg), c.maxFragmentedSize)
+	}
+	fragmentSize := c.maxSendSize - DataTransferHeaderSize
+	for len(msg) > 0 {
+		n := min(len(msg), fragmentSize)
+		if err := c.sendData(msg[:n], uint32(len(msg)-n), true); err != nil {
+			return err
+		}
+		msg = msg[n:]
+	}
+	return nil
+}
+
+// sendData sends a data transfer message once a send credit is available.
+// Without wait nothing is sent when no credit is available. All receive
+// credits used by the peer are granted again.
+func (c *Conn) sendData(data []byte, remaining uint32, wait bool) error {
+	c.cm.Lock()
+	for c.sendCredits == 0 && c.err == nil && wait {
+		c.cond.Wait()
+	}
+	if c.err != nil {
+		err := c.err
+		c.cm.Unlock()
+		return err
+	}
+	if c.sendCredits == 0 {
+		c.cm.Unlock()
+		return nil
+	}
+	c.sendCredits--
+	msg := DataTransfer{
+		CreditsRequested:    uint16(c.receiveCredits),
+		CreditsGranted:      uint16(c.receiveCredits - c.peerCredits),
+		RemainingDataLength: remaining,
+		Data:                data,
+	}
+	c.peerCredits = c.receiveCredits
+	if c.sendCredits == 0 {
+		// The peer must grant credits even if it has nothing to send
+		msg.Flags |= FlagResponseRequested
+	}
+	c.cm.Unlock()
+
+	buf, _ := msg.MarshalBinary()
+	c.sm.Lock()
+	defer c.sm.Unlock()
+	if err := c.ep.Send(buf); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+func (c *Conn) fail(err error) {
+	c.cm.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.cond.Broadcast()
+	c.cm.Unlock()
+}
+
+// recvLoop reassembles the received data transfer messages into SMB
+// messages for Read until the connection fails
+func (c *Conn) recvLoop() {
+	defer close(c.msgs)
+	var msg []byte
+	for {
+		buf, err := c.ep.Recv()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		var dt DataTransfer
+		if err = dt.UnmarshalBinary(buf); err != nil {
+			log.Errorln(err)
+			c.fail(err)
+			return
+		}
+		c.cm.Lock()
+		c.sendCredits += int(dt.CreditsGranted)
+		if c.peerCredits > 0 {
+			c.peerCredits--
+		}
+		// The peer may not be able to send the rest of a message before
+		// more credits are granted
+		starved := c.peerCredits <= c.receiveCredits/2
+		c.cond.Broadcast()
+		c.cm.Unlock()
+		if starved || dt.Flags&FlagResponseRequested != 0 {
+			// Grant credits with an empty message
+			if err = c.sendData(nil, 0, false); err != nil {
+				return
+			}
+		}
+		if len(dt.Data) == 0 {
+			continue
+		}
+		if msg == nil {
+			// The first fragment gives the size of the message
+			size := len(dt.Data) + int(dt.RemainingDataLength)
+			if size > c.maxReceiveSize {
+				c.fail(fmt.Errorf("SMB message of %d bytes exceeds the SMB Direct MaxFragmentedSize of %d", size, c.maxReceiveSize))
+				return
+			}
+			msg = binary.BigEndian.AppendUint32(make([]byte, 0, 4+size), uint32(size))
+		}
+		if len(msg)+len(dt.Data) > cap(msg) || len(msg)+len(dt.Data)+int(dt.RemainingDataLength) != cap(msg) {
+			c.fail(fmt.Errorf("Invalid RemainingDataLength of SMB Direct data transfer message"))
+			return
+		}
+		msg = append(msg, dt.Data...)
+		if dt.RemainingDataLength > 0 {
+			continue
+		}
+		select {
+		case c.msgs <- msg:
+		case <-c.done:
+			return
+		}
+		msg = nil
+	}
+}
+
+// Read returns the received SMB messages, each prefixed by its 4 byte
+// header
+func (c *Conn) Read(b []byte) (n int, err error) {
+	if len(c.rbuf) == 0 {
+		c.dm.Lock()
+		deadline := c.deadline
+		c.dm.Unlock()
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer := time.NewTimer(time.Until(deadline))
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case msg, ok := <-c.msgs:
+			if !ok {
+				c.cm.Lock()
+				err = c.err
+				c.cm.Unlock()
+				if err == nil {
+					err = io.EOF
+				}
+				return 0, err
+			}
+			c.rbuf = msg
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+	n = copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return
+}
+
+func (c *Conn) Close() error {
+	err := net.ErrClosed
+	c.once.Do(func() {
+		c.fail(net.ErrClosed)
+		close(c.done)
+		err = c.ep.Close()
+	})
+	return err
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.ep.LocalAddr()
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.ep.RemoteAddr()
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the deadline of Read. Sends are not subject to a
+// deadline as they complete once the peer has received them.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.dm.Lock()
+	c.deadline = t
+	c.dm.Unlock()
+	return nil
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,240 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package smbdirect implements the SMB2 Remote Direct Memory Access (RDMA)
+// Transport Protocol (MS-SMBD). The framing of SMB messages into SMB Direct
+// data transfer messages is done here while the RDMA operations themselves
+// are left to a pluggable Provider, e.g., a binding to libibverbs, such that
+// the library does not depend on cgo. A Dialer is set as
+// smb.Options.ProxyDialer to run SMB2 over SMB Direct, and READ and WRITE
+// payloads are then moved with RDMA by the server.
+package smbdirect
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/jfjallid/golog"
+)
+
+var (
+	log                  = golog.Get("github.com/ericblavier/go-smb/smb/smbdirect")
+	le  binary.ByteOrder = binary.LittleEndian
+)
+
+// MS-SMBD Section 2.1 TCP port of SMB Direct over iWARP
+const DefaultPort = 5445
+
+// MS-SMBD Section 2.2.1 Protocol version
+const Version1 uint16 = 0x0100
+
+// Sizes of the MS-SMBD Section 2.2 messages
+const (
+	NegotiateRequestSize   = 20
+	NegotiateResponseSize  = 32
+	DataTransferHeaderSize = 24 // The data of a data transfer message is 8 byte aligned
+	BufferDescriptorV1Size = 16
+)
+
+// MS-SMBD Section 2.2.3 Flags of the data transfer message
+const (
+	FlagResponseRequested uint16 = 0x0001
+)
+
+// MS-SMBD Section 3.1.1.1 Default values of the connection parameters
+const (
+	DefaultReceiveCredits    = 255
+	DefaultMaxSendSize       = 1364
+	DefaultMaxReceiveSize    = 8192
+	DefaultMaxFragmentedSize = 1048576
+)
+
+// MS-SMBD Section 2.2.1 SMB Direct Negotiate Request
+type NegotiateReq struct {
+	MinVersion        uint16
+	MaxVersion        uint16
+	CreditsRequested  uint16
+	PreferredSendSize uint32
+	MaxReceiveSize    uint32
+	MaxFragmentedSize uint32
+}
+
+// MS-SMBD Section 2.2.2 SMB Direct Negotiate Response
+type NegotiateRes struct {
+	MinVersion        uint16
+	MaxVersion        uint16
+	NegotiatedVersion uint16
+	CreditsRequested  uint16
+	CreditsGranted    uint16
+	Status            uint32
+	MaxReadWriteSize  uint32
+	PreferredSendSize uint32
+	MaxReceiveSize    uint32
+	MaxFragmentedSize uint32
+}
+
+// MS-SMBD Section 2.2.3 SMB Direct Data Transfer Message. Data is a
+// fragment of an SMB message and RemainingDataLength the number of bytes of
+// the message that follow in later data transfer messages.
+type DataTransfer struct {
+	CreditsRequested    uint16
+	CreditsGranted      uint16
+	Flags               uint16
+	RemainingDataLength uint32
+	Data                []byte
+}
+
+// MS-SMBD Section 2.2.3.1 Buffer Descriptor V1 of a registered memory region
+type BufferDescriptorV1 struct {
+	Offset uint64
+	Token  uint32
+	Length uint32
+}
+
+func (self *NegotiateReq) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, NegotiateRequestSize)
+	le.PutUint16(buf, self.MinVersion)
+	le.PutUint16(buf[2:], self.MaxVersion)
+	// Reserved
+	le.PutUint16(buf[6:], self.CreditsRequested)
+	le.PutUint32(buf[8:], self.PreferredSendSize)
+	le.PutUint32(buf[12:], self.MaxReceiveSize)
+	le.PutUint32(buf[16:], self.MaxFragmentedSize)
+	return buf, nil
+}
+
+func (self *NegotiateReq) UnmarshalBinary(buf []byte) error {
+	if len(buf) < NegotiateRequestSize {
+		return fmt.Errorf("Buffer to small for SMB Direct negotiate request")
+	}
+	self.MinVersion = le.Uint16(buf)
+	self.MaxVersion = le.Uint16(buf[2:])
+	self.CreditsRequested = le.Uint16(buf[6:])
+	self.PreferredSendSize = le.Uint32(buf[8:])
+	self.MaxReceiveSize = le.Uint32(buf[12:])
+	self.MaxFragmentedSize = le.Uint32(buf[16:])
+	return nil
+}
+
+func (self *NegotiateRes) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, NegotiateResponseSize)
+	le.PutUint16(buf, self.MinVersion)
+	le.PutUint16(buf[2:], self.MaxVersion)
+	le.PutUint16(buf[4:], self.NegotiatedVersion)
+	// Reserved
+	le.PutUint16(buf[8:], self.CreditsRequested)
+	le.PutUint16(buf[10:], self.CreditsGranted)
+	le.PutUint32(buf[12:], self.Status)
+	le.PutUint32(buf[16:], self.MaxReadWriteSize)
+	le.PutUint32(buf[20:], self.PreferredSendSize)
+	le.PutUint32(buf[24:], self.MaxReceiveSize)
+	le.PutUint32(buf[28:], self.MaxFragmentedSize)
+	return buf, nil
+}
+
+func (self *NegotiateRes) UnmarshalBinary(buf []byte) error {
+	if len(buf) < NegotiateResponseSize {
+		return fmt.Errorf("Buffer to small for SMB Direct negotiate response")
+	}
+	self.MinVersion = le.Uint16(buf)
+	self.MaxVersion = le.Uint16(buf[2:])
+	self.NegotiatedVersion = le.Uint16(buf[4:])
+	self.CreditsRequested = le.Uint16(buf[8:])
+	self.CreditsGranted = le.Uint16(buf[10:])
+	self.Status = le.Uint32(buf[12:])
+	self.MaxReadWriteSize = le.Uint32(buf[16:])
+	self.PreferredSendSize = le.Uint32(buf[20:])
+	self.MaxReceiveSize = le.Uint32(buf[24:])
+	self.MaxFragmentedSize = le.Uint32(buf[28:])
+	return nil
+}
+
+func (self *DataTransfer) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, DataTransferHeaderSize+len(self.Data))
+	le.PutUint16(buf, self.CreditsRequested)
+	le.PutUint16(buf[2:], self.CreditsGranted)
+	le.PutUint16(buf[4:], self.Flags)
+	// Reserved
+	le.PutUint32(buf[8:], self.RemainingDataLength)
+	if len(self.Data) > 0 {
+		// DataOffset is 0 for messages that only grant credits
+		le.PutUint32(buf[12:], DataTransferHeaderSize)
+	}
+	le.PutUint32(buf[16:], uint32(len(self.Data)))
+	// Padding
+	copy(buf[DataTransferHeaderSize:], self.Data)
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a data transfer message. Data refers to buf
+// rather than a copy of it.
+func (self *DataTransfer) UnmarshalBinary(buf []byte) error {
+	if len(buf) < DataTransferHeaderSize {
+		return fmt.Errorf("Buffer to small for SMB Direct data transfer message")
+	}
+	self.CreditsRequested = le.Uint16(buf)
+	self.CreditsGranted = le.Uint16(buf[2:])
+	self.Flags = le.Uint16(buf[4:])
+	self.RemainingDataLength = le.Uint32(buf[8:])
+	offset := uint64(le.Uint32(buf[12:]))
+	length := uint64(le.Uint32(buf[16:]))
+	self.Data = nil
+	if length == 0 {
+		return nil
+	}
+	if offset < DataTransferHeaderSize || offset%8 != 0 || offset+length > uint64(len(buf)) {
+		return fmt.Errorf("Invalid data offset %d and length %d of SMB Direct data transfer message", offset, length)
+	}
+	self.Data = buf[offset : offset+length]
+	return nil
+}
+
+func (self *BufferDescriptorV1) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, BufferDescriptorV1Size)
+	le.PutUint64(buf, self.Offset)
+	le.PutUint32(buf[8:], self.Token)
+	le.PutUint32(buf[12:], self.Length)
+	return buf, nil
+}
+
+func (self *BufferDescriptorV1) UnmarshalBinary(buf []byte) error {
+	if len(buf) < BufferDescriptorV1Size {
+		return fmt.Errorf("Buffer to small for SMB Direct buffer descriptor")
+	}
+	self.Offset = le.Uint64(buf)
+	self.Token = le.Uint32(buf[8:])
+	self.Length = le.Uint32(buf[12:])
+	return nil
+}
+
+// ParseBufferDescriptors decodes the array of buffer descriptors in the
+// channel info of an SMB2 READ or WRITE request
+func ParseBufferDescriptors(buf []byte) ([]BufferDescriptorV1, error) {
+	if len(buf)%BufferDescriptorV1Size != 0 {
+		return nil, fmt.Errorf("Invalid length %d of SMB Direct buffer descriptors", len(buf))
+	}
+	res := make([]BufferDescriptorV1, len(buf)/BufferDescriptorV1Size)
+	for i := range res {
+		res[i].UnmarshalBinary(buf[i*BufferDescriptorV1Size:])
+	}
+	return res, nil
+}
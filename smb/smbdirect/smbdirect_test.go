@@ -0,0 +1,275 @@
+package smbdirect
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+// testEndpoint is one end of an in-memory queue pair. Closing either end
+// closes both.
+type testEndpoint struct {
+	send    chan<- []byte
+	recv    <-chan []byte
+	closed  chan struct{}
+	once    *sync.Once
+	regions map[uint32][]byte
+}
+
+func (self *testEndpoint) Send(msg []byte) error {
+	select {
+	case self.send <- append([]byte(nil), msg...):
+		return nil
+	case <-self.closed:
+		return net.ErrClosed
+	}
+}
+
+func (self *testEndpoint) Recv() ([]byte, error) {
+	select {
+	case msg := <-self.recv:
+		return msg, nil
+	case <-self.closed:
+		return nil, io.EOF
+	}
+}
+
+func (self *testEndpoint) Register(buf []byte, writable bool) (MemoryRegion, error) {
+	token := uint32(len(self.regions) + 1)
+	self.regions[token] = buf
+	return testRegion{self, token}, nil
+}
+
+func (self *testEndpoint) LocalAddr() net.Addr  { return &net.TCPAddr{} }
+func (self *testEndpoint) RemoteAddr() net.Addr { return &net.TCPAddr{} }
+
+func (self *testEndpoint) Close() error {
+	self.once.Do(func() { close(self.closed) })
+	return nil
+}
+
+type testRegion struct {
+	ep    *testEndpoint
+	token uint32
+}
+
+func (self testRegion) Token() uint32   { return self.token }
+func (self testRegion) Address() uint64 { return 0x1000 }
+func (self testRegion) Deregister() error {
+	delete(self.ep.regions, self.token)
+	return nil
+}
+
+// testProvider connects to a server served by serve
+type testProvider struct {
+	serve func(ep *testEndpoint)
+}
+
+func (self *testProvider) Dial(ctx context.Context, addr string, receiveDepth, receiveSize int) (Endpoint, error) {
+	toServer := make(chan []byte, receiveDepth)
+	toClient := make(chan []byte, receiveDepth)
+	closed, once := make(chan struct{}), &sync.Once{}
+	client := &testEndpoint{send: toServer, recv: toClient, closed: closed, once: once, regions: make(map[uint32][]byte)}
+	server := &testEndpoint{send: toClient, recv: toServer, closed: closed, once: once}
+	go self.serve(server)
+	return client, nil
+}
+
+// echoServer negotiates and echoes each SMB message in fragments of at
+// most maxSend bytes while granting a single credit per message received
+func echoServer(t *testing.T, credits uint16, maxSend int) func(ep *testEndpoint) {
+	return func(ep *testEndpoint) {
+		defer ep.Close()
+		buf, err := ep.Recv()
+		if err != nil {
+			return
+		}
+		var req NegotiateReq
+		if err = req.UnmarshalBinary(buf); err != nil || req.MinVersion != Version1 {
+			t.Errorf("Fail: %+v %+v", req, err)
+			return
+		}
+		res := NegotiateRes{
+			MinVersion:        Version1,
+			MaxVersion:        Version1,
+			NegotiatedVersion: Version1,
+			CreditsRequested:  credits,
+			CreditsGranted:    credits,
+			MaxReadWriteSize:  1 << 20,
+			PreferredSendSize: uint32(maxSend),
+			MaxReceiveSize:    uint32(maxSend),
+			MaxFragmentedSize: 1 << 20,
+		}
+		buf, _ = res.MarshalBinary()
+		ep.Send(buf)
+
+		var msg []byte
+		clientCredits := 0
+		// recv returns the next message and counts the credits it grants
+		recv := func() (dt DataTransfer, ok bool) {
+			buf, err := ep.Recv()
+			if err != nil {
+				return dt, false
+			}
+			if err = dt.UnmarshalBinary(buf); err != nil {
+				t.Errorf("Fail: %+v", err)
+				return dt, false
+			}
+			clientCredits += int(dt.CreditsGranted)
+			return dt, true
+		}
+		// send waits for a credit, requesting more with the last one
+		send := func(dt DataTransfer) bool {
+			for clientCredits == 0 {
+				next, ok := recv()
+				if !ok {
+					return false
+				}
+				if len(next.Data) > 0 {
+					t.Error("Fail: client sent data instead of credits")
+					return false
+				}
+			}
+			clientCredits--
+			dt.CreditsGranted = 1
+			if clientCredits == 0 {
+				dt.Flags = FlagResponseRequested
+			}
+			reply, _ := dt.MarshalBinary()
+			return ep.Send(reply) == nil
+		}
+		for {
+			dt, ok := recv()
+			if !ok {
+				return
+			}
+			if len(dt.Data) == 0 {
+				// Messages granting credits are not part of an SMB message
+				if dt.Flags&FlagResponseRequested != 0 && !send(DataTransfer{}) {
+					return
+				}
+				continue
+			}
+			msg = append(msg, dt.Data...)
+			if dt.RemainingDataLength > 0 {
+				// Grant a credit for each fragment
+				if !send(DataTransfer{}) {
+					return
+				}
+				continue
+			}
+			for len(msg) > 0 {
+				n := min(len(msg), maxSend-DataTransferHeaderSize)
+				if !send(DataTransfer{RemainingDataLength: uint32(len(msg) - n), Data: msg[:n]}) {
+					return
+				}
+				msg = msg[n:]
+			}
+		}
+	}
+}
+
+func TestConnEcho(t *testing.T) {
+	d := &Dialer{Provider: &testProvider{serve: echoServer(t, 2, 128)}, ReceiveCredits: 4}
+	conn, err := d.Dial("tcp", "server:5445")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer conn.Close()
+	if conn.(*Conn).maxSendSize != 128 {
+		t.Fatal("Fail")
+	}
+
+	for _, size := range []int{1, 104, 105, 1000} {
+		msg := make([]byte, size)
+		for i := range msg {
+			msg[i] = byte(i + size)
+		}
+		frame := binary.BigEndian.AppendUint32(nil, uint32(size))
+		frame = append(frame, msg...)
+		// The frame is written in pieces as done by net.Buffers
+		if _, err = conn.Write(frame[:2]); err != nil {
+			t.Fatalf("Fail: %+v", err)
+		}
+		if _, err = conn.Write(frame[2:]); err != nil {
+			t.Fatalf("Fail: %+v", err)
+		}
+		res := make([]byte, len(frame))
+		if _, err = io.ReadFull(conn, res); err != nil {
+			t.Fatalf("Fail: %+v", err)
+		}
+		if !bytes.Equal(res, frame) {
+			t.Fatalf("Fail: echo of %d bytes differs", size)
+		}
+	}
+}
+
+func TestNegotiateRejected(t *testing.T) {
+	serve := func(ep *testEndpoint) {
+		ep.Recv()
+		res := NegotiateRes{MinVersion: Version1, MaxVersion: Version1, Status: 0xc00000bb}
+		buf, _ := res.MarshalBinary()
+		ep.Send(buf)
+	}
+	d := &Dialer{Provider: &testProvider{serve: serve}}
+	if _, err := d.Dial("tcp", "server:5445"); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestDataTransferMarshal(t *testing.T) {
+	dt := DataTransfer{CreditsRequested: 255, CreditsGranted: 3, Flags: FlagResponseRequested, RemainingDataLength: 10, Data: []byte("data")}
+	buf, _ := dt.MarshalBinary()
+	if len(buf) != DataTransferHeaderSize+4 || binary.LittleEndian.Uint32(buf[12:]) != DataTransferHeaderSize {
+		t.Fatal("Fail")
+	}
+	var res DataTransfer
+	if err := res.UnmarshalBinary(buf); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if res.CreditsGranted != 3 || res.Flags != FlagResponseRequested || res.RemainingDataLength != 10 || string(res.Data) != "data" {
+		t.Fatalf("Fail: %+v", res)
+	}
+
+	// Credit only messages carry no data
+	buf, _ = (&DataTransfer{CreditsGranted: 1}).MarshalBinary()
+	if err := res.UnmarshalBinary(buf); err != nil || res.Data != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+
+	binary.LittleEndian.PutUint32(buf[16:], 100)
+	binary.LittleEndian.PutUint32(buf[12:], DataTransferHeaderSize)
+	if err := res.UnmarshalBinary(buf); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestRegisterBuffer(t *testing.T) {
+	d := &Dialer{Provider: &testProvider{serve: echoServer(t, 2, 1364)}}
+	conn, err := d.Dial("tcp", "server:5445")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer conn.Close()
+	c := conn.(*Conn)
+	buf := make([]byte, 8192)
+	desc, release, err := c.RegisterBuffer(buf, true)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	d1, err := ParseBufferDescriptors(desc)
+	if err != nil || len(d1) != 1 || d1[0].Offset != 0x1000 || d1[0].Length != 8192 || d1[0].Token != 1 {
+		t.Fatalf("Fail: %+v %+v", d1, err)
+	}
+	release()
+	if len(c.ep.(*testEndpoint).regions) != 0 {
+		t.Fatal("Fail")
+	}
+	if _, _, err = c.RegisterBuffer(make([]byte, 2<<20), false); err == nil {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,187 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+const (
+	// Retries of a request rejected with a throttling status unless
+	// Options.ThrottleRetries is set
+	defaultThrottleRetries = 5
+	// Delay before the first retry unless Options.ThrottleBackoff is set
+	defaultThrottleBackoff = 100 * time.Millisecond
+	// Longest delay between two retries
+	maxThrottleBackoff = 10 * time.Second
+	// In-flight windows are halved at most this many times
+	maxWindowReduction = 4
+	// Time without throttling after which a window reduction is undone
+	windowRecovery = 5 * time.Second
+)
+
+// ThrottleReason tells what signalled that the server is overloaded
+type ThrottleReason int
+
+const (
+	ThrottleStatus  ThrottleReason = iota // A request was rejected with StatusInsufficientResources or StatusRequestNotAccepted
+	ThrottleCredits                       // The server granted too few credits to send the next request
+)
+
+// NoThrottleRetry set as Options.ThrottleRetries disables retrying: a request
+// rejected with a throttling status fails at once with that status.
+const NoThrottleRetry = -1
+
+func (r ThrottleReason) String() string {
+	if r == ThrottleCredits {
+		return "credits"
+	}
+	return "status"
+}
+
+// ThrottleEvent describes a throttling signal passed to Options.OnThrottle
+type ThrottleEvent struct {
+	Reason    ThrottleReason
+	Command   uint16
+	Status    uint32        // Status of the rejected request for ThrottleStatus
+	Attempt   int           // Number of times the request has been rejected
+	Delay     time.Duration // Wait before the retry. 0 when the request is not retried
+	Reduction int           // Number of times the in-flight windows are halved
+}
+
+// throttleState tracks how much the in-flight windows are reduced
+type throttleState struct {
+	m         sync.Mutex
+	reduction int
+	last      time.Time // Time of the last throttling signal
+}
+
+// throttleStatus returns the status of a response and whether it asks the
+// client to back off
+func throttleStatus(buf []byte) (status uint32, throttled bool) {
+	if len(buf) < 64 || string(buf[:4]) != ProtocolSmb2 {
+		return 0, false
+	}
+	status = binary.LittleEndian.Uint32(buf[8:12])
+	return status, status == StatusInsufficientResources || status == StatusRequestNotAccepted
+}
+
+// reduceWindow halves the in-flight windows once more
+func (c *Connection) reduceWindow() int {
+	c.throttle.m.Lock()
+	defer c.throttle.m.Unlock()
+	c.throttle.reduction = min(c.throttle.reduction+1, maxWindowReduction)
+	c.throttle.last = time.Now()
+	return c.throttle.reduction
+}
+
+// throttledWindow returns window reduced according to the recent throttling
+// signals, but at least 1. Each windowRecovery without a signal undoes one
+// reduction.
+func (c *Connection) throttledWindow(window int) int {
+	c.throttle.m.Lock()
+	defer c.throttle.m.Unlock()
+	if c.throttle.reduction > 0 && time.Since(c.throttle.last) > windowRecovery {
+		c.throttle.reduction--
+		c.throttle.last = time.Now()
+	}
+	return max(window>>c.throttle.reduction, 1)
+}
+
+func (c *Connection) notifyThrottle(e ThrottleEvent) {
+	if c.options.OnThrottle != nil {
+		c.options.OnThrottle(e)
+	}
+}
+
+// creditsStarved records that the next request of a pipeline waits for the
+// server to grant more credits
+func (c *Connection) creditsStarved(command uint16) {
+	e := ThrottleEvent{Reason: ThrottleCredits, Command: command, Reduction: c.reduceWindow()}
+	log.Debugf("Waiting for credits to send command 0x%x\n", command)
+	c.notifyThrottle(e)
+}
+
+// backoff records the throttled response buf to a request and waits before
+// the request is sent again. false is returned once the retries are
+// exhausted or the connection is closed.
+func (c *Connection) backoff(buf []byte, attempt int) bool {
+	// A negative value such as NoThrottleRetry gives up on the first attempt
+	retries := c.options.ThrottleRetries
+	if retries == 0 {
+		retries = defaultThrottleRetries
+	}
+	delay := c.options.ThrottleBackoff
+	if delay <= 0 {
+		delay = defaultThrottleBackoff
+	}
+	delay = min(delay<<(attempt-1), maxThrottleBackoff)
+	status, _ := throttleStatus(buf)
+	e := ThrottleEvent{
+		Reason:    ThrottleStatus,
+		Command:   binary.LittleEndian.Uint16(buf[12:14]),
+		Status:    status,
+		Attempt:   attempt,
+		Reduction: c.reduceWindow(),
+	}
+	if attempt > retries {
+		log.Debugf("Giving up on command 0x%x rejected with status 0x%x\n", e.Command, status)
+		c.notifyThrottle(e)
+		return false
+	}
+	e.Delay = delay
+	log.Debugf("Retrying command 0x%x rejected with status 0x%x in %v\n", e.Command, status, delay)
+	c.notifyThrottle(e)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.wdone:
+		return false
+	}
+}
+
+// retryThrottled sends req again after a backoff as long as its response
+// buf asks the client to back off
+func (c *Connection) retryThrottled(req interface{}, dst, buf []byte, streamed int) ([]byte, int, error) {
+	for attempt := 1; ; attempt++ {
+		if _, throttled := throttleStatus(buf); !throttled || !c.backoff(buf, attempt) {
+			return buf, streamed, nil
+		}
+		encoder.PutBuffer(buf)
+		rr, err := c.sendInto(req, dst)
+		if err != nil {
+			return nil, 0, err
+		}
+		if buf, err = c.recv(rr); err != nil {
+			return nil, 0, err
+		}
+		encoder.ReleaseBuffers(rr.pkt)
+		streamed = rr.streamed
+	}
+}
@@ -0,0 +1,113 @@
+package smb
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// serveThrottled rejects the first n CREATE requests with status
+func serveThrottled(server net.Conn, status uint32, n int) {
+	for {
+		buf, err := readTestFrame(server)
+		if err != nil {
+			return
+		}
+		var h Header
+		if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+			return
+		}
+		hdr := Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       h.Command,
+			Credits:       1,
+			Flags:         SMB2_FLAGS_SERVER_TO_REDIR,
+			MessageID:     h.MessageID,
+			Signature:     make([]byte, 16),
+		}
+		var res interface{}
+		switch h.Command {
+		case CommandCreate:
+			if n > 0 {
+				n--
+				hdr.Status = status
+				res = &CreateRes{Header: hdr, StructureSize: 9}
+				break
+			}
+			res = &CreateRes{Header: hdr, StructureSize: 89, FileId: make([]byte, 16)}
+		case CommandClose:
+			res = &CloseRes{Header: hdr, StructureSize: 60}
+		}
+		if err = writeTestFrame(server, res); err != nil {
+			return
+		}
+	}
+}
+
+func TestThrottleRetry(t *testing.T) {
+	var events []ThrottleEvent
+	c, server := newTestConnection(t, Options{
+		ThrottleBackoff: time.Millisecond,
+		OnThrottle:      func(e ThrottleEvent) { events = append(events, e) },
+	})
+	c.credits.Store(100)
+	go serveThrottled(server, StatusInsufficientResources, 2)
+	f, err := c.OpenFile("share", "file.txt")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	f.CloseFile()
+	want := []ThrottleEvent{
+		{Reason: ThrottleStatus, Command: CommandCreate, Status: StatusInsufficientResources, Attempt: 1, Delay: time.Millisecond, Reduction: 1},
+		{Reason: ThrottleStatus, Command: CommandCreate, Status: StatusInsufficientResources, Attempt: 2, Delay: 2 * time.Millisecond, Reduction: 2},
+	}
+	if len(events) != len(want) || events[0] != want[0] || events[1] != want[1] {
+		t.Fatalf("Fail: %+v", events)
+	}
+	if window := c.throttledWindow(8); window != 2 {
+		t.Fatalf("Fail: window %d", window)
+	}
+
+	// A reduction is undone after some time without throttling
+	c.throttle.last = time.Now().Add(-2 * windowRecovery)
+	if window := c.throttledWindow(8); window != 4 {
+		t.Fatalf("Fail: window %d", window)
+	}
+}
+
+func TestThrottleDefaultRetries(t *testing.T) {
+	var events []ThrottleEvent
+	c, server := newTestConnection(t, Options{
+		ThrottleBackoff: time.Millisecond,
+		OnThrottle:      func(e ThrottleEvent) { events = append(events, e) },
+	})
+	c.credits.Store(100)
+	go serveThrottled(server, StatusRequestNotAccepted, defaultThrottleRetries+1)
+	if _, err := c.OpenFile("share", "file.txt"); err != StatusMap[StatusRequestNotAccepted] {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if len(events) != defaultThrottleRetries+1 || events[defaultThrottleRetries-1].Delay == 0 || events[defaultThrottleRetries].Delay != 0 {
+		t.Fatalf("Fail: %+v", events)
+	}
+}
+
+func TestThrottleGiveUp(t *testing.T) {
+	for _, retries := range []int{NoThrottleRetry, -5} {
+		var events []ThrottleEvent
+		c, server := newTestConnection(t, Options{
+			ThrottleRetries: retries,
+			OnThrottle:      func(e ThrottleEvent) { events = append(events, e) },
+		})
+		c.credits.Store(100)
+		go serveThrottled(server, StatusRequestNotAccepted, 1)
+		if _, err := c.OpenFile("share", "file.txt"); err != StatusMap[StatusRequestNotAccepted] {
+			t.Fatalf("Fail: %+v", err)
+		}
+		if len(events) != 1 || events[0].Status != StatusRequestNotAccepted || events[0].Delay != 0 {
+			t.Fatalf("Fail: %+v", events)
+		}
+	}
+}
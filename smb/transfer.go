@@ -0,0 +1,114 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"time"
+)
+
+// TransferOptions tunes the upload and download helpers RetrieveFileExt and
+// PutFileExt. Zero values select the defaults.
+type TransferOptions struct {
+	// Bytes per READ or WRITE request. Defaults to and is limited by the
+	// negotiated MaxReadSize or MaxWriteSize.
+	ChunkSize int
+	// Requests kept in flight. Defaults to Options.ReadAheadDepth for
+	// downloads and Options.WriteWindow for uploads. 1 waits for each
+	// response before sending the next request.
+	Parallelism int
+	// Maximum transfer rate in bytes per second. 0 means unlimited.
+	BandwidthLimit int64
+	// Called with the number of bytes transferred so far after each chunk.
+	// The total is 0 when unknown, e.g., for uploads.
+	Progress func(transferred, total uint64)
+}
+
+func (self *TransferOptions) readChunkSize(c *Connection) int {
+	size := 65536
+	if c.supportsMultiCredit && c.maxReadSize > 0 {
+		size = int(c.maxReadSize)
+	}
+	if self.ChunkSize > 0 && self.ChunkSize < size {
+		return self.ChunkSize
+	}
+	return size
+}
+
+func (self *TransferOptions) writeChunkSize(c *Connection) int {
+	size := 65536
+	if c.supportsMultiCredit && c.maxWriteSize > 0 {
+		size = int(c.maxWriteSize)
+	}
+	if self.ChunkSize > 0 && self.ChunkSize < size {
+		return self.ChunkSize
+	}
+	return size
+}
+
+// readDepth returns the read-ahead depth. Negative disables read-ahead.
+func (self *TransferOptions) readDepth(c *Connection) int {
+	switch {
+	case self.Parallelism == 1:
+		return -1
+	case self.Parallelism > 1:
+		return self.Parallelism
+	case c.options.ReadAheadDepth != 0:
+		return c.options.ReadAheadDepth
+	}
+	return defaultReadAheadDepth
+}
+
+func (self *TransferOptions) writeWindow(c *Connection) int {
+	switch {
+	case self.Parallelism > 0:
+		return self.Parallelism
+	case c.options.WriteWindow > 0:
+		return c.options.WriteWindow
+	}
+	return defaultWriteWindow
+}
+
+// rateLimiter delays a transfer such that the average rate since the start
+// stays below limit bytes per second
+type rateLimiter struct {
+	limit int64
+	start time.Time
+	total int64
+}
+
+func newRateLimiter(limit int64) *rateLimiter {
+	return &rateLimiter{limit: limit, start: time.Now()}
+}
+
+// wait accounts for n transferred bytes and sleeps until the rate is within
+// the limit
+func (self *rateLimiter) wait(n int) {
+	if self.limit <= 0 {
+		return
+	}
+	self.total += int64(n)
+	due := time.Duration(float64(self.total) / float64(self.limit) * float64(time.Second))
+	if d := due - time.Since(self.start); d > 0 {
+		time.Sleep(d)
+	}
+}
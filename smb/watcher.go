@@ -0,0 +1,330 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of WatchOptions
+const (
+	DefaultWatchFilter       = FileNotifyChangeFileName | FileNotifyChangeDirName | FileNotifyChangeSize | FileNotifyChangeLastWrite
+	DefaultWatchBufferSize   = 65536
+	DefaultWatchPollInterval = 5 * time.Second
+)
+
+type WatchOptions struct {
+	CompletionFilter uint32        // Changes to report. Defaults to DefaultWatchFilter
+	Recursive        bool          // Also watch the subdirectories
+	BufferSize       uint32        // Size of the buffer the server fills with changes. Defaults to DefaultWatchBufferSize
+	PollInterval     time.Duration // Time between directory snapshots when polling. Defaults to DefaultWatchPollInterval
+	ForcePolling     bool          // Compare directory snapshots even if the server supports CHANGE_NOTIFY
+}
+
+// WatchEvent is a change of a watched directory
+type WatchEvent struct {
+	Action   uint32 // One of the FileAction constants
+	FileName string // Relative to the watched directory
+	Polled   bool   // Found by comparing directory snapshots rather than reported by the server
+	Overflow bool   // Changes were lost as more happened than could be reported. Action and FileName are not set
+}
+
+// Watcher reports the changes of a directory. CHANGE_NOTIFY is used when
+// the server supports it and otherwise snapshots of the directory are
+// compared, such that both deliver the same events.
+type Watcher struct {
+	conn  *Connection
+	share string
+	dir   string
+	opts  WatchOptions
+
+	events chan WatchEvent
+	done   chan struct{}
+	once   sync.Once
+
+	m       sync.Mutex
+	file    *File // Watched with CHANGE_NOTIFY unless polling
+	polling bool
+	err     error
+}
+
+// Watch starts watching a directory of a share, which must be connected.
+// The changes are read from Events until Close is called.
+func (s *Connection) Watch(share, dir string, opts WatchOptions) (w *Watcher, err error) {
+	if opts.CompletionFilter == 0 {
+		opts.CompletionFilter = DefaultWatchFilter
+	}
+	if opts.BufferSize == 0 {
+		opts.BufferSize = DefaultWatchBufferSize
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultWatchPollInterval
+	}
+	w = &Watcher{
+		conn:   s,
+		share:  share,
+		dir:    dir,
+		opts:   opts,
+		events: make(chan WatchEvent, 64),
+		done:   make(chan struct{}),
+	}
+	var snapshot map[string]SharedFile
+	if !opts.ForcePolling {
+		w.file, err = s.OpenDirectoryNotify(share, dir)
+		if err != nil && !notifyUnsupported(err) {
+			return nil, err
+		}
+	}
+	if w.file == nil {
+		w.polling = true
+		if snapshot, err = w.snapshot(); err != nil {
+			return nil, err
+		}
+	}
+	go w.run(snapshot)
+	return w, nil
+}
+
+// Events returns the changes of the directory. The channel is closed once
+// the watcher is closed or fails, after which Err returns the failure.
+func (w *Watcher) Events() <-chan WatchEvent {
+	return w.events
+}
+
+// Polling reports whether the changes are found by comparing directory
+// snapshots
+func (w *Watcher) Polling() bool {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.polling
+}
+
+// Err returns the error that stopped the watcher, if any
+func (w *Watcher) Err() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.err
+}
+
+// Close stops watching and closes the directory
+func (w *Watcher) Close() (err error) {
+	w.once.Do(func() {
+		close(w.done)
+		w.m.Lock()
+		defer w.m.Unlock()
+		if w.file != nil {
+			// Completes the pending CHANGE_NOTIFY with StatusNotifyCleanup
+			err = w.file.CloseFile()
+			w.file = nil
+		}
+	})
+	return
+}
+
+// notifyUnsupported reports whether err means the server or the file
+// system does not implement CHANGE_NOTIFY
+func notifyUnsupported(err error) bool {
+	return err == StatusMap[StatusNotSupported] ||
+		err == StatusMap[FsctlStatusInvalidDeviceRequest] ||
+		err == StatusMap[StatusInvalidParameter]
+}
+
+func (w *Watcher) closed() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Watcher) emit(ev WatchEvent) bool {
+	select {
+	case w.events <- ev:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+func (w *Watcher) run(snapshot map[string]SharedFile) {
+	defer close(w.events)
+	var err error
+	if snapshot == nil {
+		snapshot, err = w.notify()
+	}
+	if err == nil && snapshot != nil {
+		err = w.poll(snapshot)
+	}
+	if err != nil && !w.closed() {
+		log.Debugln(err)
+		w.m.Lock()
+		w.err = err
+		w.m.Unlock()
+	}
+}
+
+// notify reports the changes returned by CHANGE_NOTIFY. If the server turns
+// out not to support it the directory is closed and a snapshot is returned
+// to continue by polling.
+func (w *Watcher) notify() (snapshot map[string]SharedFile, err error) {
+	w.m.Lock()
+	f := w.file
+	w.m.Unlock()
+	for f != nil {
+		var changes []FileNotifyInformation
+		changes, err = f.ChangeNotify(w.opts.CompletionFilter, w.opts.Recursive, w.opts.BufferSize)
+		if w.closed() {
+			return nil, nil
+		}
+		if err == StatusMap[StatusNotifyEnumDir] {
+			if !w.emit(WatchEvent{Overflow: true}) {
+				return nil, nil
+			}
+			continue
+		} else if notifyUnsupported(err) {
+			break
+		} else if err != nil {
+			return
+		}
+		for _, change := range changes {
+			if !w.emit(WatchEvent{Action: change.Action, FileName: change.FileName}) {
+				return nil, nil
+			}
+		}
+	}
+
+	log.Debugf("CHANGE_NOTIFY is not supported on %s\\%s, polling instead\n", w.share, w.dir)
+	w.m.Lock()
+	if w.file != nil {
+		w.file.CloseFile()
+		w.file = nil
+	}
+	w.polling = true
+	w.m.Unlock()
+	return w.snapshot()
+}
+
+// poll compares a snapshot of the directory with the previous one at each
+// interval
+func (w *Watcher) poll(prev map[string]SharedFile) error {
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return nil
+		case <-ticker.C:
+		}
+		next, err := w.snapshot()
+		if err != nil {
+			return err
+		}
+		for _, ev := range diffSnapshots(prev, next, w.opts.CompletionFilter) {
+			if !w.emit(ev) {
+				return nil
+			}
+		}
+		prev = next
+	}
+}
+
+// snapshot lists the directory, or the tree below it, by the paths
+// relative to the directory
+func (w *Watcher) snapshot() (map[string]SharedFile, error) {
+	var files []SharedFile
+	var err error
+	if w.opts.Recursive {
+		files, err = w.conn.ListRecurseDirectory(w.share, w.dir, "*")
+	} else {
+		files, err = w.conn.ListDirectory(w.share, w.dir, "*")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list %s\\%s: %s", w.share, w.dir, err)
+	}
+	snapshot := make(map[string]SharedFile, len(files))
+	for _, file := range files {
+		if file.Name == "." || file.Name == ".." {
+			continue
+		}
+		rel := file.FullPath
+		if w.dir != "" {
+			rel = strings.TrimPrefix(rel, w.dir+`\`)
+		}
+		snapshot[rel] = file
+	}
+	return snapshot, nil
+}
+
+// diffSnapshots returns the changes between two snapshots that are
+// selected by the completion filter, ordered by file name
+func diffSnapshots(prev, next map[string]SharedFile, filter uint32) (events []WatchEvent) {
+	// nameFilter returns the filter for the creation and deletion of file
+	nameFilter := func(file SharedFile) uint32 {
+		if file.IsDir {
+			return FileNotifyChangeDirName
+		}
+		return FileNotifyChangeFileName
+	}
+	for name, file := range next {
+		old, found := prev[name]
+		if !found {
+			if filter&nameFilter(file) != 0 {
+				events = append(events, WatchEvent{Action: FileActionAdded, FileName: name, Polled: true})
+			}
+			continue
+		}
+		var changed uint32
+		if old.IsDir != file.IsDir || old.IsHidden != file.IsHidden || old.IsReadOnly != file.IsReadOnly {
+			changed |= FileNotifyChangeAttributes
+		}
+		if old.Size != file.Size {
+			changed |= FileNotifyChangeSize
+		}
+		if old.LastWriteTime != file.LastWriteTime {
+			changed |= FileNotifyChangeLastWrite
+		}
+		if old.LastAccessTime != file.LastAccessTime {
+			changed |= FileNotifyChangeLastAccess
+		}
+		if old.CreationTime != file.CreationTime {
+			changed |= FileNotifyChangeCreation
+		}
+		if changed&filter != 0 {
+			events = append(events, WatchEvent{Action: FileActionModified, FileName: name, Polled: true})
+		}
+	}
+	for name, file := range prev {
+		if _, found := next[name]; !found && filter&nameFilter(file) != 0 {
+			events = append(events, WatchEvent{Action: FileActionRemoved, FileName: name, Polled: true})
+		}
+	}
+	slices.SortFunc(events, func(a, b WatchEvent) int {
+		return strings.Compare(a.FileName, b.FileName)
+	})
+	return
+}
@@ -0,0 +1,199 @@
+package smb
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// testDirectory is the contents of a directory served by serveWatch, by
+// file name and size
+type testDirectory struct {
+	m     sync.Mutex
+	files map[string]uint64
+}
+
+func (self *testDirectory) set(name string, size uint64, present bool) {
+	self.m.Lock()
+	defer self.m.Unlock()
+	if present {
+		self.files[name] = size
+	} else {
+		delete(self.files, name)
+	}
+}
+
+// serveWatch answers CHANGE_NOTIFY with notifyStatus, or with a change of
+// file.txt if it is StatusOk, and lists the directory with a QUERY_DIRECTORY
+// response per file
+func serveWatch(server net.Conn, dir *testDirectory, notifyStatus uint32) {
+	var listing [][]byte
+	listed := false
+	for {
+		buf, err := readTestFrame(server)
+		if err != nil {
+			return
+		}
+		var h Header
+		if err = encoder.Unmarshal(buf[:64], &h); err != nil {
+			return
+		}
+		hdr := Header{
+			ProtocolID:    []byte(ProtocolSmb2),
+			StructureSize: 64,
+			Command:       h.Command,
+			Credits:       1,
+			Flags:         SMB2_FLAGS_SERVER_TO_REDIR,
+			MessageID:     h.MessageID,
+			Signature:     make([]byte, 16),
+		}
+		var res interface{}
+		switch h.Command {
+		case CommandCreate:
+			res = &CreateRes{Header: hdr, StructureSize: 89, FileId: make([]byte, 16)}
+		case CommandChangeNotify:
+			hdr.Status = notifyStatus
+			if notifyStatus != StatusOk {
+				res = &ChangeNotifyRes{Header: hdr, StructureSize: 9, Buffer: []byte{0}}
+				break
+			}
+			name := encoder.ToUnicode("file.txt")
+			info := binary.LittleEndian.AppendUint32(nil, 0)
+			info = binary.LittleEndian.AppendUint32(info, FileActionModified)
+			info = binary.LittleEndian.AppendUint32(info, uint32(len(name)))
+			res = &ChangeNotifyRes{Header: hdr, StructureSize: 9, OutputBufferOffset: 72, Buffer: append(info, name...)}
+		case CommandQueryDirectory:
+			if !listed {
+				listed = true
+				listing = nil
+				dir.m.Lock()
+				for name, size := range dir.files {
+					entry, _ := encoder.Marshal(FileBothDirectoryInformationStruct{
+						EndOfFile: size,
+						ShortName: make([]byte, 24),
+						FileName:  encoder.ToUnicode(name),
+					})
+					listing = append(listing, entry)
+				}
+				dir.m.Unlock()
+			}
+			if len(listing) == 0 {
+				listed = false
+				hdr.Status = StatusNoMoreFiles
+				res = &QueryDirectoryRes{Header: hdr, StructureSize: 9, Buffer: []byte{0}}
+				break
+			}
+			res = &QueryDirectoryRes{Header: hdr, StructureSize: 9, Buffer: listing[0]}
+			listing = listing[1:]
+		case CommandClose:
+			res = &CloseRes{Header: hdr, StructureSize: 60}
+		default:
+			return
+		}
+		if err = writeTestFrame(server, res); err != nil {
+			return
+		}
+	}
+}
+
+func nextWatchEvent(t *testing.T, w *Watcher) WatchEvent {
+	select {
+	case ev, ok := <-w.Events():
+		if !ok {
+			t.Fatalf("Fail: %+v", w.Err())
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("Fail: no event")
+	}
+	return WatchEvent{}
+}
+
+func TestWatchNotify(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.credits.Store(100)
+	c.maxTransactSize = 65536
+	go serveWatch(server, &testDirectory{files: map[string]uint64{}}, StatusOk)
+
+	w, err := c.Watch("share", "dir", WatchOptions{})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer w.Close()
+	ev := nextWatchEvent(t, w)
+	if ev.Action != FileActionModified || ev.FileName != "file.txt" || ev.Polled || w.Polling() {
+		t.Fatalf("Fail: %+v", ev)
+	}
+}
+
+func TestWatchPollingFallback(t *testing.T) {
+	c, server := newTestConnection(t, Options{})
+	c.credits.Store(100)
+	c.maxTransactSize = 65536
+	dir := &testDirectory{files: map[string]uint64{"old.txt": 1, "file.txt": 10}}
+	go serveWatch(server, dir, StatusNotSupported)
+
+	w, err := c.Watch("share", "dir", WatchOptions{PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer w.Close()
+	// Wait for the fallback to take the first snapshot
+	for !w.Polling() {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	dir.m.Lock()
+	dir.files["file.txt"] = 20
+	dir.files["new.txt"] = 0
+	delete(dir.files, "old.txt")
+	dir.m.Unlock()
+	var events []WatchEvent
+	for len(events) < 3 {
+		events = append(events, nextWatchEvent(t, w))
+	}
+	want := []WatchEvent{
+		{Action: FileActionModified, FileName: "file.txt", Polled: true},
+		{Action: FileActionAdded, FileName: "new.txt", Polled: true},
+		{Action: FileActionRemoved, FileName: "old.txt", Polled: true},
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("Fail: %+v", events)
+		}
+	}
+	w.Close()
+	for range w.Events() {
+	}
+	if w.Err() != nil {
+		t.Fatalf("Fail: %+v", w.Err())
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	prev := map[string]SharedFile{
+		"a":   {Name: "a", Size: 1},
+		"b":   {Name: "b", LastWriteTime: 1},
+		"c":   {Name: "c", IsHidden: false},
+		"dir": {Name: "dir", IsDir: true},
+	}
+	next := map[string]SharedFile{
+		"a": {Name: "a", Size: 1},
+		"b": {Name: "b", LastWriteTime: 2},
+		"c": {Name: "c", IsHidden: true},
+		"d": {Name: "d"},
+	}
+	events := diffSnapshots(prev, next, FileNotifyChangeFileName|FileNotifyChangeLastWrite)
+	if len(events) != 2 || events[0].FileName != "b" || events[0].Action != FileActionModified || events[1].FileName != "d" || events[1].Action != FileActionAdded {
+		t.Fatalf("Fail: %+v", events)
+	}
+	events = diffSnapshots(prev, next, FileNotifyChangeDirName|FileNotifyChangeAttributes)
+	if len(events) != 2 || events[0].FileName != "c" || events[1].FileName != "dir" || events[1].Action != FileActionRemoved {
+		t.Fatalf("Fail: %+v", events)
+	}
+}
@@ -0,0 +1,98 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package smb
+
+import (
+	"fmt"
+)
+
+// SetWriteBuffer enables write-behind buffering for Write. Small writes are
+// collected into a buffer of size bytes that is sent once full, on Flush or
+// on CloseFile. A size of 0 selects the negotiated MaxWriteSize and a
+// negative size disables buffering. Any buffered data is flushed first.
+func (f *File) SetWriteBuffer(size int) error {
+	if err := f.Flush(); err != nil {
+		return err
+	}
+	if size == 0 {
+		size = 65536
+		if f.supportsMultiCredit && f.maxWriteSize > 0 {
+			size = int(f.maxWriteSize)
+		}
+	}
+	if size < 0 {
+		f.wb = nil
+	} else {
+		f.wb = make([]byte, 0, size)
+	}
+	return nil
+}
+
+// Write implements io.Writer. Writes are sent right away unless buffering
+// has been enabled with SetWriteBuffer.
+func (f *File) Write(p []byte) (n int, err error) {
+	if f.fd == nil {
+		return 0, fmt.Errorf("Can't operate on a closed file")
+	}
+	// Prefetched data may be stale after the write
+	f.dropReadAhead()
+	for len(p) > 0 {
+		if len(f.wb) == 0 && len(p) >= cap(f.wb) {
+			// Nothing to coalesce with so bypass the buffer
+			var nw int
+			nw, err = f.WriteAt(p, f.pos)
+			n += nw
+			f.pos += int64(nw)
+			return
+		}
+		if len(f.wb) == 0 {
+			f.wbOff = f.pos
+		}
+		c := copy(f.wb[len(f.wb):cap(f.wb)], p)
+		f.wb = f.wb[:len(f.wb)+c]
+		p = p[c:]
+		n += c
+		f.pos += int64(c)
+		if len(f.wb) == cap(f.wb) {
+			if err = f.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Flush sends any data buffered by Write. Data that could not be written
+// stays buffered.
+func (f *File) Flush() error {
+	if len(f.wb) == 0 {
+		return nil
+	}
+	// Detach the buffer so that WriteAt does not flush it again
+	buf := f.wb
+	f.wb = nil
+	n, err := f.WriteAt(buf, f.wbOff)
+	f.wb = buf[:copy(buf, buf[n:])]
+	f.wbOff += int64(n)
+	return err
+}
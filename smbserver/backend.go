@@ -0,0 +1,200 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smbserver
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Backend stores the files of a share. Names are slash separated paths
+// relative to the root of the share that satisfy fs.ValidPath, "." being the
+// root. Errors should wrap fs.ErrNotExist, fs.ErrExist and fs.ErrPermission
+// where they apply so that clients get the matching NT status.
+type Backend interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	// Open opens a regular file for reading
+	Open(name string) (File, error)
+}
+
+// File is a regular file of a Backend opened for reading
+type File interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// WriteBackend is a Backend that accepts modifications. Shares whose Backend
+// is not a WriteBackend are read-only.
+type WriteBackend interface {
+	Backend
+	// OpenFile opens a regular file for reading and writing. flag is a
+	// combination of os.O_CREATE, os.O_EXCL and os.O_TRUNC.
+	OpenFile(name string, flag int) (WriteFile, error)
+	Mkdir(name string) error
+	// Remove removes a file or an empty directory
+	Remove(name string) error
+	// Rename moves a file or directory, replacing newname if it is a file
+	Rename(oldname, newname string) error
+}
+
+// WriteFile is a regular file of a WriteBackend opened for writing
+type WriteFile interface {
+	File
+	io.WriterAt
+	Truncate(size int64) error
+	Sync() error
+}
+
+// FS returns a read-only Backend serving fsys. Files that are not an
+// io.ReaderAt are read through io.Seeker, or are reopened when a client
+// reads backwards.
+func FS(fsys fs.FS) Backend {
+	return fsBackend{fsys: fsys}
+}
+
+type fsBackend struct {
+	fsys fs.FS
+}
+
+func (self fsBackend) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(self.fsys, name)
+}
+
+func (self fsBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(self.fsys, name)
+}
+
+func (self fsBackend) Open(name string) (File, error) {
+	f, err := self.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := f.(File); ok {
+		return r, nil
+	}
+	return &sequentialFile{fsys: self.fsys, name: name, file: f}, nil
+}
+
+// sequentialFile implements io.ReaderAt for a fs.File without it
+type sequentialFile struct {
+	fsys fs.FS
+	name string
+	file fs.File
+	pos  int64
+}
+
+func (self *sequentialFile) ReadAt(p []byte, offset int64) (n int, err error) {
+	if f, ok := self.file.(io.Seeker); ok {
+		if _, err = f.Seek(offset, io.SeekStart); err != nil {
+			return
+		}
+	} else {
+		if offset < self.pos {
+			f, err := self.fsys.Open(self.name)
+			if err != nil {
+				return 0, err
+			}
+			self.file.Close()
+			self.file = f
+			self.pos = 0
+		}
+		skipped, err := io.CopyN(io.Discard, self.file, offset-self.pos)
+		self.pos += skipped
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err = io.ReadFull(self.file, p)
+	self.pos += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return
+}
+
+func (self *sequentialFile) Close() error {
+	return self.file.Close()
+}
+
+// Dir returns a WriteBackend serving the directory tree rooted at dir of the
+// local file system. Symbolic links pointing outside of dir are not
+// followed. The directory stays open until the process exits.
+func Dir(dir string) (WriteBackend, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return dirBackend{root: root}, nil
+}
+
+type dirBackend struct {
+	root *os.Root
+}
+
+func (self dirBackend) Stat(name string) (fs.FileInfo, error) {
+	return self.root.Stat(name)
+}
+
+func (self dirBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(self.root.FS(), name)
+}
+
+func (self dirBackend) Open(name string) (File, error) {
+	return self.root.Open(name)
+}
+
+func (self dirBackend) OpenFile(name string, flag int) (WriteFile, error) {
+	return self.root.OpenFile(name, os.O_RDWR|flag, 0o666)
+}
+
+func (self dirBackend) Mkdir(name string) error {
+	return self.root.Mkdir(name, 0o777)
+}
+
+func (self dirBackend) Remove(name string) error {
+	return self.root.Remove(name)
+}
+
+// Rename resolves the parent directories through the root so that both
+// names are confined to it. os.Root has no Rename before Go 1.25, so a
+// parent directory replaced by a symbolic link between the checks and the
+// rename is not detected.
+func (self dirBackend) Rename(oldname, newname string) error {
+	for _, name := range []string{oldname, newname} {
+		if _, err := self.root.Lstat(name); err != nil && name == oldname {
+			return err
+		}
+		info, err := self.root.Stat(path.Dir(name))
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return &fs.PathError{Op: "rename", Path: name, Err: fs.ErrInvalid}
+		}
+	}
+	dir := self.root.Name()
+	return os.Rename(filepath.Join(dir, filepath.FromSlash(oldname)), filepath.Join(dir, filepath.FromSlash(newname)))
+}
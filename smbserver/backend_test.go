@@ -0,0 +1,76 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smbserver
+
+import (
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// streamFS hides the io.ReaderAt and io.Seeker methods of the files of a
+// fstest.MapFS
+type streamFS struct {
+	fstest.MapFS
+}
+
+type streamFile struct {
+	fs.File
+}
+
+func (self streamFS) Open(name string) (fs.File, error) {
+	f, err := self.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return streamFile{f}, nil
+}
+
+func TestFSSequentialReadAt(t *testing.T) {
+	backend := FS(streamFS{fstest.MapFS{"f": {Data: []byte("0123456789")}}})
+	f, err := backend.Open("f")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer f.Close()
+	if _, ok := f.(*sequentialFile); !ok {
+		t.Fatalf("Fail: %T", f)
+	}
+
+	buf := make([]byte, 4)
+	for _, tc := range []struct {
+		offset int64
+		want   string
+		err    error
+	}{
+		{2, "2345", nil},
+		{8, "89", io.EOF},
+		{0, "0123", nil},
+		{12, "", io.EOF},
+	} {
+		n, err := f.ReadAt(buf, tc.offset)
+		if string(buf[:n]) != tc.want || err != tc.err {
+			t.Fatalf("Fail: offset %d got %q %v", tc.offset, buf[:n], err)
+		}
+	}
+}
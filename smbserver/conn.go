@@ -0,0 +1,406 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smbserver
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+const (
+	// Largest request accepted, which is a WRITE of the maximum size with
+	// room for its header
+	maxRequestSize = 1<<20 + 1<<12
+	maxCredits     = 512
+)
+
+// request is a single SMB2 request of a possibly compounded message
+type request struct {
+	smb.Header
+	buf     []byte // The request including its header
+	session *session
+	tree    *tree
+	fileID  []byte // Open created by a CREATE request for related requests
+}
+
+// response to a request. A nil body on failure is sent as an ERROR response.
+type response struct {
+	smb.Header
+	body   []byte
+	signer *signer // Signs the response when set
+}
+
+func (self *response) fail(status uint32) {
+	self.Status = status
+	self.body = nil
+}
+
+// marshal sets the body to a response structure of the smb package encoded
+// without its header
+func (self *response) marshal(v interface{}) {
+	buf, err := encoder.Marshal(v)
+	if err != nil || len(buf) < 64 {
+		log.Errorf("Failed to marshal response: %v\n", err)
+		self.fail(smb.StatusInvalidParameter)
+		return
+	}
+	self.body = buf[64:]
+}
+
+// newHeader returns a header that can be marshalled as part of a response
+// structure
+func newHeader() smb.Header {
+	return smb.Header{
+		ProtocolID:    []byte(smb.ProtocolSmb2),
+		StructureSize: 64,
+		Signature:     make([]byte, 16),
+	}
+}
+
+type conn struct {
+	srv      *Server
+	nc       net.Conn
+	dialect  uint16
+	sessions map[uint64]*session
+}
+
+func newConn(srv *Server, nc net.Conn) *conn {
+	return &conn{
+		srv:      srv,
+		nc:       nc,
+		sessions: make(map[uint64]*session),
+	}
+}
+
+func (c *conn) serve() {
+	defer c.close()
+	log.Debugf("Client connected from %s\n", c.nc.RemoteAddr())
+	for {
+		if c.srv.opt.IdleTimeout > 0 {
+			c.nc.SetReadDeadline(time.Now().Add(c.srv.opt.IdleTimeout))
+		}
+		pkt, err := readMessage(c.nc)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Debugf("Closing connection from %s: %v\n", c.nc.RemoteAddr(), err)
+			}
+			return
+		}
+		res, err := c.handle(pkt)
+		if err != nil {
+			log.Debugf("Closing connection from %s: %v\n", c.nc.RemoteAddr(), err)
+			return
+		}
+		if res == nil {
+			continue
+		}
+		if err = writeMessage(c.nc, res); err != nil {
+			log.Debugln(err)
+			return
+		}
+	}
+}
+
+func (c *conn) close() {
+	for _, s := range c.sessions {
+		s.close()
+	}
+	c.nc.Close()
+}
+
+// readMessage reads a message prefixed by the 4 byte Direct TCP transport
+// header
+func readMessage(r io.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size>>24 != 0 {
+		return nil, fmt.Errorf("Invalid transport header 0x%08x", size)
+	}
+	if size < 4 || size > maxRequestSize {
+		return nil, fmt.Errorf("Invalid message size %d", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func writeMessage(w io.Writer, buf []byte) error {
+	msg := make([]byte, 4, 4+len(buf))
+	binary.BigEndian.PutUint32(msg, uint32(len(buf)))
+	_, err := w.Write(append(msg, buf...))
+	return err
+}
+
+// handle returns the response to the message pkt, nil if no response is
+// sent, or an error when the connection must be closed
+func (c *conn) handle(pkt []byte) ([]byte, error) {
+	switch string(pkt[:4]) {
+	case smb.ProtocolSmb:
+		return c.handleSMB1Negotiate(pkt)
+	case smb.ProtocolSmb2:
+		if c.dialect == 0 {
+			// The connection must begin with a NEGOTIATE
+			if len(pkt) < 64 || binary.LittleEndian.Uint16(pkt[12:14]) != smb.CommandNegotiate {
+				return nil, fmt.Errorf("Expected a NEGOTIATE request")
+			}
+		}
+		return c.handleSMB2(pkt)
+	}
+	return nil, fmt.Errorf("Unsupported protocol id %x", pkt[:4])
+}
+
+// handleSMB2 processes the requests of a possibly compounded message and
+// returns the compounded responses
+func (c *conn) handleSMB2(pkt []byte) ([]byte, error) {
+	var responses []*response
+	var prev *request
+	for {
+		if len(pkt) < 64 {
+			return nil, fmt.Errorf("Message is too short")
+		}
+		req := &request{}
+		if err := encoder.Unmarshal(pkt[:64], &req.Header); err != nil {
+			return nil, err
+		}
+		if req.StructureSize != 64 || req.Flags&smb.SMB2_FLAGS_SERVER_TO_REDIR != 0 {
+			return nil, fmt.Errorf("Invalid request header")
+		}
+		req.buf = pkt
+		if req.NextCommand != 0 {
+			if req.NextCommand < 64 || req.NextCommand%8 != 0 || int(req.NextCommand) > len(pkt) {
+				return nil, fmt.Errorf("Invalid NextCommand %d", req.NextCommand)
+			}
+			req.buf = pkt[:req.NextCommand]
+		}
+		if req.Flags&smb.SMB2_FLAGS_RELATED_OPERATIONS != 0 && prev != nil {
+			req.SessionID = prev.SessionID
+			req.TreeID = prev.TreeID
+		}
+
+		res := c.dispatch(req, prev)
+		if res != nil {
+			responses = append(responses, res)
+		}
+		if req.NextCommand == 0 {
+			break
+		}
+		pkt = pkt[req.NextCommand:]
+		prev = req
+	}
+	if len(responses) == 0 {
+		return nil, nil
+	}
+
+	var out []byte
+	for i, res := range responses {
+		msg, err := encoder.Marshal(res.Header)
+		if err != nil {
+			return nil, err
+		}
+		if res.body == nil {
+			res.body = errorBody()
+		}
+		msg = append(msg, res.body...)
+		if i < len(responses)-1 {
+			for len(msg)%8 != 0 {
+				msg = append(msg, 0)
+			}
+			binary.LittleEndian.PutUint32(msg[20:24], uint32(len(msg)))
+		}
+		if res.signer != nil {
+			res.signer.sign(msg)
+		}
+		out = append(out, msg...)
+	}
+	return out, nil
+}
+
+// errorBody is the SMB2 ERROR response without error data
+func errorBody() []byte {
+	// StructureSize, ErrorContextCount, Reserved, ByteCount and one byte of
+	// ErrorData
+	return []byte{9, 0, 0, 0, 0, 0, 0, 0, 0}
+}
+
+type handler func(c *conn, req *request, res *response)
+
+var handlers = map[uint16]handler{
+	smb.CommandNegotiate:      (*conn).handleNegotiate,
+	smb.CommandSessionSetup:   (*conn).handleSessionSetup,
+	smb.CommandLogoff:         (*conn).handleLogoff,
+	smb.CommandTreeConnect:    (*conn).handleTreeConnect,
+	smb.CommandTreeDisconnect: (*conn).handleTreeDisconnect,
+	smb.CommandCreate:         (*conn).handleCreate,
+	smb.CommandClose:          (*conn).handleClose,
+	smb.CommandRead:           (*conn).handleRead,
+	smb.CommandEcho:           (*conn).handleEcho,
+	smb.CommandQueryDirectory: (*conn).handleQueryDirectory,
+	smb.CommandQueryInfo:      (*conn).handleQueryInfo,
+	smb.CommandWrite:          (*conn).handleWrite,
+	smb.CommandFlush:          (*conn).handleFlush,
+	smb.CommandSetInfo:        (*conn).handleSetInfo,
+	smb.CommandIOCtl:          (*conn).handleIoctl,
+}
+
+// dispatch verifies the session, tree and signature of req and calls its
+// handler. prev is the preceding request of a compounded message.
+func (c *conn) dispatch(req *request, prev *request) *response {
+	res := &response{Header: newHeader()}
+	res.Command = req.Command
+	res.CreditCharge = req.CreditCharge
+	res.Flags = smb.SMB2_FLAGS_SERVER_TO_REDIR | (req.Flags & smb.SMB2_FLAGS_RELATED_OPERATIONS)
+	res.MessageID = req.MessageID
+	res.SessionID = req.SessionID
+	res.TreeID = req.TreeID
+	res.Credits = min(max(req.Credits, req.CreditCharge, 1), maxCredits)
+
+	if req.Command == smb.CommandCancel {
+		// Every request is completed synchronously, so there is nothing to
+		// cancel and no response is sent
+		return nil
+	}
+	if prev != nil && req.Flags&smb.SMB2_FLAGS_RELATED_OPERATIONS != 0 && prev.session == nil {
+		res.fail(smb.StatusInvalidParameter)
+		return res
+	}
+
+	switch req.Command {
+	case smb.CommandNegotiate, smb.CommandSessionSetup, smb.CommandEcho:
+	default:
+		s, ok := c.sessions[req.SessionID]
+		if !ok || !s.valid {
+			res.fail(smb.StatusUserSessionDeleted)
+			return res
+		}
+		req.session = s
+		if s.signer != nil {
+			signed := req.Flags&smb.SMB2_FLAGS_SIGNED != 0
+			if signed && !s.signer.verify(req.buf) {
+				log.Debugf("Invalid signature of request %d\n", req.MessageID)
+				res.fail(smb.StatusAccessDenied)
+				return res
+			}
+			if !signed && c.srv.opt.RequireSigning {
+				res.fail(smb.StatusAccessDenied)
+				return res
+			}
+			if signed || c.srv.opt.RequireSigning {
+				res.signer = s.signer
+			}
+		}
+	}
+
+	switch req.Command {
+	case smb.CommandNegotiate, smb.CommandSessionSetup, smb.CommandEcho, smb.CommandLogoff, smb.CommandTreeConnect:
+	default:
+		t, ok := req.session.trees[req.TreeID]
+		if !ok {
+			res.fail(smb.StatusNetworkNameDeleted)
+			return res
+		}
+		req.tree = t
+	}
+
+	h, ok := handlers[req.Command]
+	if !ok {
+		log.Debugf("Unsupported command %d\n", req.Command)
+		res.fail(smb.StatusNotSupported)
+		return res
+	}
+	if prev != nil && req.Flags&smb.SMB2_FLAGS_RELATED_OPERATIONS != 0 {
+		relateFileID(req, prev)
+	}
+	h(c, req, res)
+	return res
+}
+
+// relatedFileID is the FileId placeholder of compounded related requests
+var relatedFileID = bytes.Repeat([]byte{0xff}, 16)
+
+// fileIDOffsets are the positions of the FileId in the requests that refer
+// to an open
+var fileIDOffsets = map[uint16]int{
+	smb.CommandClose:          64 + 8,
+	smb.CommandRead:           64 + 16,
+	smb.CommandWrite:          64 + 16,
+	smb.CommandFlush:          64 + 8,
+	smb.CommandSetInfo:        64 + 16,
+	smb.CommandQueryDirectory: 64 + 8,
+	smb.CommandQueryInfo:      64 + 24,
+	smb.CommandIOCtl:          64 + 8,
+}
+
+// relateFileID replaces the FileId placeholder of a related request with the
+// open created by the preceding request
+func relateFileID(req *request, prev *request) {
+	pos, ok := fileIDOffsets[req.Command]
+	if !ok || len(req.buf) < pos+16 || !bytes.Equal(req.buf[pos:pos+16], relatedFileID) {
+		return
+	}
+	if prev.fileID == nil {
+		return
+	}
+	// The request is a copy as the signature was already verified
+	req.buf = bytes.Clone(req.buf)
+	copy(req.buf[pos:pos+16], prev.fileID)
+}
+
+// signer computes HMAC-SHA256 signatures of SMB 2.0.2 and 2.1
+type signer struct {
+	h hash.Hash
+}
+
+func (self *signer) sum(msg []byte) []byte {
+	sig := make([]byte, 16)
+	copy(sig, msg[48:64])
+	copy(msg[48:64], make([]byte, 16))
+	self.h.Reset()
+	self.h.Write(msg)
+	copy(msg[48:64], sig)
+	return self.h.Sum(nil)[:16]
+}
+
+// verify checks the signature of a request
+func (self *signer) verify(msg []byte) bool {
+	return hmac.Equal(self.sum(msg), msg[48:64])
+}
+
+// sign sets the signed flag and the signature of a response
+func (self *signer) sign(msg []byte) {
+	flags := binary.LittleEndian.Uint32(msg[16:20])
+	binary.LittleEndian.PutUint32(msg[16:20], flags|smb.SMB2_FLAGS_SIGNED)
+	copy(msg[48:64], self.sum(msg))
+}
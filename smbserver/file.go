@@ -0,0 +1,672 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smbserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+const (
+	maxOpens = 1024 // Per session
+
+	// Access that would allow modifying a file or its metadata
+	writeAccess = smb.FAccMaskFileWriteData | smb.FAccMaskFileAppendData | smb.FAccMaskFileWriteEA |
+		smb.FAccMaskFileDeleteChild | smb.FAccMaskFileWriteAttributes | smb.FAccMaskDelete |
+		smb.FAccMaskWriteDac | smb.FAccMaskWriteOwner | smb.FAccMaskAccessSystemSecurity |
+		smb.FAccMaskGenericAll | smb.FAccMaskGenericWrite
+	// FILE_GENERIC_READ | FILE_GENERIC_EXECUTE granted on read-only shares
+	readAccess = 0x001200a9
+	// FILE_ALL_ACCESS granted on writable shares
+	fullAccess = 0x001f01ff
+	readData   = smb.FAccMaskFileReadData | smb.FAccMaskGenericRead | smb.FAccMaskGenericAll | smb.FAccMaskMaximumAllowed
+	writeData  = smb.FAccMaskFileWriteData | smb.FAccMaskFileAppendData | smb.FAccMaskGenericWrite | smb.FAccMaskGenericAll
+	deleteData = smb.FAccMaskDelete | smb.FAccMaskGenericAll
+)
+
+type tree struct {
+	id       uint32
+	name     string
+	backend  Backend      // nil for IPC$
+	writable WriteBackend // nil for read-only shares
+}
+
+// maximalAccess is the access granted on the files of the share
+func (t *tree) maximalAccess() uint32 {
+	if t.writable != nil {
+		return fullAccess
+	}
+	return readAccess
+}
+
+type open struct {
+	id            uint64
+	tree          *tree
+	name          string // Path within the share
+	info          fs.FileInfo
+	access        uint32
+	file          File      // nil for directories
+	wfile         WriteFile // Set when file is opened for writing
+	deleteOnClose bool
+	pipe          *dcerpc.Association // Set for named pipes, which have no info
+
+	// Directory enumeration
+	entries []fs.FileInfo
+	names   []string
+	next    int
+}
+
+func (o *open) close() {
+	if o.file != nil {
+		o.file.Close()
+	}
+	if o.deleteOnClose {
+		if err := o.tree.writable.Remove(o.name); err != nil {
+			log.Debugln(err)
+		}
+	}
+}
+
+// refresh updates the metadata of a file that may have been modified
+func (o *open) refresh() {
+	if o.tree.writable == nil {
+		return
+	}
+	if info, err := o.tree.backend.Stat(o.name); err == nil {
+		o.info = info
+	}
+}
+
+// fileID encodes the persistent and volatile parts of the FileId
+func (o *open) fileID() []byte {
+	buf := make([]byte, 16)
+	binary.LittleEndian.PutUint64(buf, o.id)
+	binary.LittleEndian.PutUint64(buf[8:], o.id)
+	return buf
+}
+
+func (s *session) lookupOpen(fileID []byte) (*open, bool) {
+	if len(fileID) != 16 {
+		return nil, false
+	}
+	o, ok := s.opens[binary.LittleEndian.Uint64(fileID[8:])]
+	return o, ok
+}
+
+func (s *session) disconnect(t *tree) {
+	for id, o := range s.opens {
+		if o.tree == t {
+			o.close()
+			delete(s.opens, id)
+		}
+	}
+	delete(s.trees, t.id)
+}
+
+func (c *conn) handleTreeConnect(req *request, res *response) {
+	tc := smb.TreeConnectReq{}
+	if err := encoder.Unmarshal(req.buf, &tc); err != nil {
+		log.Debugln(err)
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	unc, err := encoder.FromUnicodeString(tc.Path)
+	if err != nil {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	name := unc[strings.LastIndex(unc, `\`)+1:]
+
+	t := &tree{name: name}
+	shareType := smb.ShareTypeDisk
+	if strings.EqualFold(name, ipcShare) {
+		shareType = smb.ShareTypePipe
+	} else if backend, ok := c.srv.shares[strings.ToUpper(name)]; ok {
+		t.backend = backend
+		t.writable, _ = backend.(WriteBackend)
+	} else {
+		log.Debugf("Unknown share %s\n", unc)
+		res.fail(smb.StatusBadNetworkName)
+		return
+	}
+	s := req.session
+	s.nextTreeID++
+	t.id = s.nextTreeID
+	s.trees[t.id] = t
+
+	res.TreeID = t.id
+	res.marshal(&smb.TreeConnectRes{
+		Header:        newHeader(),
+		StructureSize: 16,
+		ShareType:     shareType,
+		MaximalAccess: t.maximalAccess(),
+	})
+}
+
+func (c *conn) handleTreeDisconnect(req *request, res *response) {
+	req.session.disconnect(req.tree)
+	res.marshal(&smb.TreeDisconnectRes{Header: newHeader(), StructureSize: 4})
+}
+
+// sharePath converts a path of a SMB request to a path of the share's
+// Backend. Alternate data streams and wildcards are refused.
+func sharePath(name string) (string, bool) {
+	name = strings.Trim(strings.ReplaceAll(name, `\`, "/"), "/")
+	if name == "" {
+		return ".", true
+	}
+	if strings.ContainsAny(name, `:*?"<>|`) || !fs.ValidPath(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// stat looks up name ignoring case when there is no exact match, as SMB
+// paths are case insensitive. The path with the case of the share is
+// returned, which for a missing file is the path of the file to create.
+func stat(backend Backend, name string) (string, fs.FileInfo, error) {
+	info, err := backend.Stat(name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) || name == "." {
+		return name, info, err
+	}
+	dir, base := path.Split(name)
+	dir = strings.TrimSuffix(dir, "/")
+	if dir == "" {
+		dir = "."
+	} else if dir, _, err = stat(backend, dir); err != nil {
+		return name, nil, err
+	}
+	entries, err := backend.ReadDir(dir)
+	if err != nil {
+		return name, nil, err
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Name(), base) {
+			found := path.Join(dir, e.Name())
+			info, err = backend.Stat(found)
+			return found, info, err
+		}
+	}
+	return path.Join(dir, base), nil, fs.ErrNotExist
+}
+
+// errorStatus maps a Backend error to a NT status
+func errorStatus(err error) uint32 {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return smb.StatusObjectNameNotFound
+	case errors.Is(err, fs.ErrExist):
+		return smb.StatusObjectNameCollision
+	case errors.Is(err, fs.ErrPermission):
+		return smb.StatusAccessDenied
+	case errors.Is(err, fs.ErrInvalid):
+		return smb.StatusObjectNameInvalid
+	}
+	return smb.StatusAccessDenied
+}
+
+func (c *conn) handleCreate(req *request, res *response) {
+	// MS-SMB2 Section 2.2.13 the fixed part is 56 bytes
+	buf := req.buf
+	if len(buf) < 64+56 {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	desiredAccess := binary.LittleEndian.Uint32(buf[64+24:])
+	disposition := binary.LittleEndian.Uint32(buf[64+36:])
+	options := binary.LittleEndian.Uint32(buf[64+40:])
+	nameOffset := int(binary.LittleEndian.Uint16(buf[64+44:]))
+	nameLength := int(binary.LittleEndian.Uint16(buf[64+46:]))
+	var name string
+	if nameLength > 0 {
+		if nameOffset < 64+56 || nameLength%2 != 0 || nameOffset+nameLength > len(buf) {
+			res.fail(smb.StatusInvalidParameter)
+			return
+		}
+		var err error
+		if name, err = encoder.FromUnicodeString(buf[nameOffset : nameOffset+nameLength]); err != nil || !utf8.ValidString(name) {
+			res.fail(smb.StatusObjectNameInvalid)
+			return
+		}
+	}
+
+	t := req.tree
+	if t.backend == nil {
+		c.createPipe(req, res, name)
+		return
+	}
+	deleteOnClose := options&smb.FileDeleteOnClose != 0
+	if t.writable == nil && (desiredAccess&writeAccess != 0 || deleteOnClose || disposition != smb.FileOpen && disposition != smb.FileOpenIf) {
+		res.fail(smb.StatusAccessDenied)
+		return
+	}
+	if deleteOnClose && desiredAccess&deleteData == 0 {
+		res.fail(smb.StatusAccessDenied)
+		return
+	}
+	p, ok := sharePath(name)
+	if !ok {
+		res.fail(smb.StatusObjectNameInvalid)
+		return
+	}
+	p, info, err := stat(t.backend, p)
+	action := smb.FileOpened
+	flag := 0
+	if err == nil {
+		switch disposition {
+		case smb.FileCreate:
+			res.fail(smb.StatusObjectNameCollision)
+			return
+		case smb.FileOverwrite, smb.FileOverwriteIf, smb.FileSupersede:
+			if info.IsDir() || p == "." {
+				res.fail(smb.StatusAccessDenied)
+				return
+			}
+			flag = os.O_TRUNC
+			action = smb.FileOverwritten
+			if disposition == smb.FileSupersede {
+				action = smb.FileSuperseded
+			}
+		}
+	} else if errors.Is(err, fs.ErrNotExist) {
+		switch disposition {
+		case smb.FileCreate, smb.FileOpenIf, smb.FileOverwriteIf, smb.FileSupersede:
+			if t.writable == nil {
+				res.fail(smb.StatusAccessDenied)
+				return
+			}
+			action = smb.FileCreated
+		default:
+			res.fail(smb.StatusObjectNameNotFound)
+			return
+		}
+	} else {
+		res.fail(errorStatus(err))
+		return
+	}
+	if info != nil && info.IsDir() && options&smb.FileNonDirectoryFile != 0 {
+		res.fail(smb.StatusFileIsADirectory)
+		return
+	}
+	if info != nil && !info.IsDir() && options&smb.FileDirectoryFile != 0 {
+		res.fail(smb.StatusNotADirectory)
+		return
+	}
+	if deleteOnClose && p == "." {
+		res.fail(smb.StatusCannotDelete)
+		return
+	}
+
+	s := req.session
+	if len(s.opens) >= maxOpens {
+		res.fail(smb.FsctlStatusInsufficientResources)
+		return
+	}
+	o := &open{tree: t, name: p, access: desiredAccess, deleteOnClose: deleteOnClose}
+	isDir := info != nil && info.IsDir() || info == nil && options&smb.FileDirectoryFile != 0
+	switch {
+	case isDir && action == smb.FileCreated:
+		err = t.writable.Mkdir(p)
+	case isDir:
+	case action != smb.FileOpened:
+		o.wfile, err = t.writable.OpenFile(p, os.O_CREATE|flag)
+	case desiredAccess&writeData != 0:
+		o.wfile, err = t.writable.OpenFile(p, 0)
+	case desiredAccess&readData != 0:
+		o.file, err = t.backend.Open(p)
+	}
+	if err != nil {
+		res.fail(errorStatus(err))
+		return
+	}
+	if o.wfile != nil {
+		o.file = o.wfile
+	}
+	if action != smb.FileOpened {
+		if info, err = t.backend.Stat(p); err != nil {
+			o.close()
+			res.fail(errorStatus(err))
+			return
+		}
+	}
+	o.info = info
+	s.nextFileID++
+	o.id = s.nextFileID
+	s.opens[o.id] = o
+	req.fileID = o.fileID()
+
+	a := newAttributes(info, t.writable == nil)
+	res.marshal(&smb.CreateRes{
+		Header:         newHeader(),
+		StructureSize:  89,
+		CreateAction:   action,
+		CreationTime:   a.time,
+		LastAccessTime: a.time,
+		LastWriteTime:  a.time,
+		ChangeTime:     a.time,
+		AllocationSize: a.allocationSize,
+		EndOfFile:      a.size,
+		FileAttributes: a.attributes,
+		FileId:         req.fileID,
+	})
+}
+
+func (c *conn) handleClose(req *request, res *response) {
+	cl := smb.CloseReq{}
+	if err := encoder.Unmarshal(req.buf, &cl); err != nil {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	o, ok := req.session.lookupOpen(cl.FileId)
+	if !ok || o.tree != req.tree {
+		res.fail(smb.StatusFileClosed)
+		return
+	}
+	o.close()
+	delete(req.session.opens, o.id)
+
+	cr := smb.CloseRes{Header: newHeader(), StructureSize: 60}
+	if cl.Flags&1 != 0 && !o.deleteOnClose && o.pipe == nil {
+		// SMB2_CLOSE_FLAG_POSTQUERY_ATTRIB
+		o.refresh()
+		a := newAttributes(o.info, o.tree.writable == nil)
+		cr.Flags = 1
+		cr.CreationTime = a.time
+		cr.LastAccessTime = a.time
+		cr.LastWriteTime = a.time
+		cr.ChangeTime = a.time
+		cr.AllocationSize = a.allocationSize
+		cr.EndOfFile = a.size
+		cr.FileAttributes = a.attributes
+	}
+	res.marshal(&cr)
+}
+
+func (c *conn) handleRead(req *request, res *response) {
+	// MS-SMB2 Section 2.2.19 the fixed part is 48 bytes
+	buf := req.buf
+	if len(buf) < 64+48 {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	length := binary.LittleEndian.Uint32(buf[64+4:])
+	offset := binary.LittleEndian.Uint64(buf[64+8:])
+	minimum := binary.LittleEndian.Uint32(buf[64+32:])
+	o, ok := req.session.lookupOpen(buf[64+16 : 64+32])
+	if !ok || o.tree != req.tree {
+		res.fail(smb.StatusFileClosed)
+		return
+	}
+	if o.pipe != nil {
+		c.readPipe(o, length, res)
+		return
+	}
+	if o.info.IsDir() {
+		res.fail(smb.FsctlStatusInvalidDeviceRequest)
+		return
+	}
+	if o.file == nil || o.access&readData == 0 {
+		res.fail(smb.StatusAccessDenied)
+		return
+	}
+	if length > maxSize(c.dialect) || offset > 1<<62 {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+
+	data := make([]byte, length)
+	n, err := o.file.ReadAt(data, int64(offset))
+	if n == 0 || uint32(n) < minimum {
+		if err != nil && err != io.EOF {
+			log.Debugln(err)
+			res.fail(smb.StatusAccessDenied)
+			return
+		}
+		res.fail(smb.StatusEndOfFile)
+		return
+	}
+	res.marshal(&smb.ReadRes{
+		Header:        newHeader(),
+		StructureSize: 17,
+		// The encoder does not compute offsets stored in a single byte
+		DataOffset: 64 + 16,
+		Buffer:     data[:n],
+	})
+}
+
+// lookupWritable returns the open of a request that modifies a file
+func (c *conn) lookupWritable(req *request, res *response, fileID []byte) (*open, bool) {
+	o, ok := req.session.lookupOpen(fileID)
+	if !ok || o.tree != req.tree {
+		res.fail(smb.StatusFileClosed)
+		return nil, false
+	}
+	if o.tree.writable == nil {
+		res.fail(smb.StatusAccessDenied)
+		return nil, false
+	}
+	return o, true
+}
+
+func (c *conn) handleWrite(req *request, res *response) {
+	wr := smb.WriteReq{}
+	if err := encoder.Unmarshal(req.buf, &wr); err != nil {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	if o, ok := req.session.lookupOpen(wr.FileId); ok && o.tree == req.tree && o.pipe != nil {
+		c.writePipe(o, wr.Buffer, res)
+		return
+	}
+	o, ok := c.lookupWritable(req, res, wr.FileId)
+	if !ok {
+		return
+	}
+	if o.info.IsDir() {
+		res.fail(smb.FsctlStatusInvalidDeviceRequest)
+		return
+	}
+	if o.wfile == nil || o.access&writeData == 0 {
+		res.fail(smb.StatusAccessDenied)
+		return
+	}
+	offset := wr.Offset
+	if offset == 1<<64-1 {
+		// Append to the end of the file
+		o.refresh()
+		offset = uint64(o.info.Size())
+	}
+	if offset > 1<<62 {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	n, err := o.wfile.WriteAt(wr.Buffer, int64(offset))
+	if err != nil {
+		log.Debugln(err)
+		res.fail(errorStatus(err))
+		return
+	}
+	res.marshal(&smb.WriteRes{
+		Header:        newHeader(),
+		StructureSize: 17,
+		Count:         uint32(n),
+	})
+}
+
+func (c *conn) handleFlush(req *request, res *response) {
+	// MS-SMB2 Section 2.2.17 the FileId follows 8 bytes of fixed fields
+	if len(req.buf) < 64+24 {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	o, ok := c.lookupWritable(req, res, req.buf[64+8:64+24])
+	if !ok {
+		return
+	}
+	if o.wfile != nil {
+		if err := o.wfile.Sync(); err != nil {
+			log.Debugln(err)
+			res.fail(errorStatus(err))
+			return
+		}
+	}
+	res.body = []byte{4, 0, 0, 0}
+}
+
+func (c *conn) handleSetInfo(req *request, res *response) {
+	si := smb.SetInfoReq{}
+	if err := encoder.Unmarshal(req.buf, &si); err != nil {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	o, ok := c.lookupWritable(req, res, si.FileId)
+	if !ok {
+		return
+	}
+	if si.InfoType != smb.OInfoFile {
+		res.fail(smb.StatusNotSupported)
+		return
+	}
+
+	var status uint32
+	switch si.FileInfoClass {
+	case smb.FileBasicInformation, smb.FileAllocationInformation:
+		// Timestamps, attributes and allocation are not stored by a Backend
+		if o.access&(smb.FAccMaskFileWriteAttributes|writeData) == 0 {
+			status = smb.StatusAccessDenied
+		}
+	case smb.FileEndOfFileInformation:
+		status = o.truncate(si.Buffer)
+	case smb.FileDispositionInformation:
+		status = o.setDisposition(si.Buffer)
+	case smb.FileRenameInformation:
+		status = o.rename(si.Buffer)
+	default:
+		status = smb.StatusNotSupported
+	}
+	if status != smb.StatusOk {
+		res.fail(status)
+		return
+	}
+	res.marshal(&smb.SetInfoRes{Header: newHeader(), StructureSize: 2})
+}
+
+// truncate handles FILE_END_OF_FILE_INFORMATION, MS-FSCC Section 2.4.13
+func (o *open) truncate(buf []byte) uint32 {
+	if len(buf) < 8 {
+		return smb.StatusInfoLengthMismatch
+	}
+	size := binary.LittleEndian.Uint64(buf)
+	if o.wfile == nil || o.access&writeData == 0 {
+		return smb.StatusAccessDenied
+	}
+	if size > 1<<62 {
+		return smb.StatusInvalidParameter
+	}
+	if err := o.wfile.Truncate(int64(size)); err != nil {
+		log.Debugln(err)
+		return errorStatus(err)
+	}
+	return smb.StatusOk
+}
+
+// setDisposition handles FILE_DISPOSITION_INFORMATION, MS-FSCC Section
+// 2.4.11. Directories must be empty to be deleted.
+func (o *open) setDisposition(buf []byte) uint32 {
+	if len(buf) < 1 {
+		return smb.StatusInfoLengthMismatch
+	}
+	if o.access&deleteData == 0 {
+		return smb.StatusAccessDenied
+	}
+	if buf[0]&1 == 0 {
+		o.deleteOnClose = false
+		return smb.StatusOk
+	}
+	if o.name == "." {
+		return smb.StatusCannotDelete
+	}
+	if o.info.IsDir() {
+		entries, err := o.tree.backend.ReadDir(o.name)
+		if err != nil {
+			return errorStatus(err)
+		}
+		if len(entries) > 0 {
+			return smb.StatusDirectoryNotEmpty
+		}
+	}
+	o.deleteOnClose = true
+	return smb.StatusOk
+}
+
+// rename handles FILE_RENAME_INFORMATION_TYPE_2, MS-FSCC Section 2.4.37.2
+func (o *open) rename(buf []byte) uint32 {
+	if len(buf) < 20 {
+		return smb.StatusInfoLengthMismatch
+	}
+	replace := buf[0]&1 != 0
+	nameLength := int(binary.LittleEndian.Uint32(buf[16:]))
+	if binary.LittleEndian.Uint64(buf[8:]) != 0 || nameLength == 0 || nameLength%2 != 0 || nameLength > len(buf)-20 {
+		return smb.StatusInvalidParameter
+	}
+	if o.access&deleteData == 0 {
+		return smb.StatusAccessDenied
+	}
+	name, err := encoder.FromUnicodeString(buf[20 : 20+nameLength])
+	if err != nil || !utf8.ValidString(name) {
+		return smb.StatusObjectNameInvalid
+	}
+	target, ok := sharePath(name)
+	if !ok || target == "." || o.name == "." {
+		return smb.StatusObjectNameInvalid
+	}
+	requested := target
+	target, info, err := stat(o.tree.backend, target)
+	switch {
+	case err == nil && target == o.name:
+		if path.Base(requested) == path.Base(target) {
+			return smb.StatusOk
+		}
+		// Only the case of the name changes
+		target = path.Join(path.Dir(target), path.Base(requested))
+	case err == nil && (!replace || info.IsDir()):
+		return smb.StatusObjectNameCollision
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return errorStatus(err)
+	}
+	if err = o.tree.writable.Rename(o.name, target); err != nil {
+		log.Debugln(err)
+		return errorStatus(err)
+	}
+	o.name = target
+	return smb.StatusOk
+}
@@ -0,0 +1,171 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smbserver
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+// createPipe opens a named pipe of IPC$ as a new association of the
+// DCERPC server registered for it
+func (c *conn) createPipe(req *request, res *response, name string) {
+	name = strings.Trim(name, `\`)
+	if len(name) > 5 && strings.EqualFold(name[:5], `PIPE\`) {
+		name = name[5:]
+	}
+	rpc, ok := c.srv.pipes[strings.ToLower(name)]
+	if !ok {
+		res.fail(smb.StatusObjectNameNotFound)
+		return
+	}
+	s := req.session
+	if len(s.opens) >= maxOpens {
+		res.fail(smb.FsctlStatusInsufficientResources)
+		return
+	}
+	o := &open{
+		tree:   req.tree,
+		name:   name,
+		access: binary.LittleEndian.Uint32(req.buf[64+24:]),
+		pipe:   rpc.NewAssociation(`\PIPE\` + name),
+	}
+	s.nextFileID++
+	o.id = s.nextFileID
+	s.opens[o.id] = o
+	req.fileID = o.fileID()
+
+	res.marshal(&smb.CreateRes{
+		Header:         newHeader(),
+		StructureSize:  89,
+		CreateAction:   smb.FileOpened,
+		FileAttributes: smb.FileAttrNormal,
+		FileId:         req.fileID,
+	})
+}
+
+// readPipe returns the next response fragment of the association. A
+// fragment larger than length is returned over several reads with
+// STATUS_BUFFER_OVERFLOW.
+func (c *conn) readPipe(o *open, length uint32, res *response) {
+	if length == 0 || length > maxSize(c.dialect) {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	msg, more := o.pipe.Read(int(length))
+	if msg == nil {
+		res.fail(smb.StatusPipeEmpty)
+		return
+	}
+	if more {
+		res.Status = smb.StatusBufferOverflow
+	}
+	res.marshal(&smb.ReadRes{
+		Header:        newHeader(),
+		StructureSize: 17,
+		DataOffset:    64 + 16,
+		Buffer:        msg,
+	})
+}
+
+func (c *conn) writePipe(o *open, buf []byte, res *response) {
+	if err := o.pipe.Write(buf); err != nil {
+		log.Debugln(err)
+		res.fail(smb.FsctlStatusPipeBroken)
+		return
+	}
+	res.marshal(&smb.WriteRes{
+		Header:        newHeader(),
+		StructureSize: 17,
+		Count:         uint32(len(buf)),
+	})
+}
+
+// handleIoctl serves FSCTL_PIPE_TRANSCEIVE, which writes a request to a
+// named pipe and returns the first fragment of its response. MS-SMB2
+// Section 2.2.31.
+func (c *conn) handleIoctl(req *request, res *response) {
+	// The fixed part is 56 bytes
+	buf := req.buf
+	if len(buf) < 64+56 {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	le := binary.LittleEndian
+	ctlCode := le.Uint32(buf[64+4:])
+	fileID := buf[64+8 : 64+24]
+	inputOffset := int(le.Uint32(buf[64+24:]))
+	inputCount := int(le.Uint32(buf[64+28:]))
+	maxOutput := le.Uint32(buf[64+44:])
+	flags := le.Uint32(buf[64+48:])
+	if flags&smb.IoctlIsFsctl == 0 || ctlCode != smb.FsctlPipeTransceive {
+		res.fail(smb.StatusNotSupported)
+		return
+	}
+	if inputCount > 0 && (inputOffset < 64+56 || inputOffset > len(buf) || inputCount > len(buf)-inputOffset) {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	o, ok := req.session.lookupOpen(fileID)
+	if !ok || o.tree != req.tree {
+		res.fail(smb.StatusFileClosed)
+		return
+	}
+	if o.pipe == nil {
+		res.fail(smb.FsctlStatusInvalidDeviceRequest)
+		return
+	}
+	if maxOutput == 0 || maxOutput > maxSize(c.dialect) {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	if o.pipe.Pending() {
+		// Responses of previous requests have not been read
+		res.fail(smb.StatusPipeBusy)
+		return
+	}
+	var input []byte
+	if inputCount > 0 {
+		input = buf[inputOffset : inputOffset+inputCount]
+	}
+	if err := o.pipe.Write(input); err != nil {
+		log.Debugln(err)
+		res.fail(smb.FsctlStatusPipeBroken)
+		return
+	}
+	output, more := o.pipe.Read(int(maxOutput))
+	if more {
+		res.Status = smb.StatusBufferOverflow
+	}
+
+	// The input is not echoed for FSCTL_PIPE_TRANSCEIVE
+	body := make([]byte, 48, 48+len(output))
+	le.PutUint16(body, 49)
+	le.PutUint32(body[4:], ctlCode)
+	copy(body[8:24], fileID)
+	le.PutUint32(body[24:], 64+48)
+	le.PutUint32(body[32:], 64+48)
+	le.PutUint32(body[36:], uint32(len(output)))
+	res.body = append(body, output...)
+}
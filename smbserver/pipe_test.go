@@ -0,0 +1,145 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smbserver
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/ericblavier/go-smb/smb/dcerpc/mssrvs"
+)
+
+// newSrvSvc returns a mock srvsvc serving NetrShareEnum of n shares at
+// level 1
+func newSrvSvc(t *testing.T, n int) *dcerpc.Server {
+	srv := dcerpc.NewServer()
+	err := srv.Register(&dcerpc.Interface{
+		UUID:         mssrvs.MSRPCUuidSrvSvc,
+		MajorVersion: mssrvs.MSRPCSrvSvcMajorVersion,
+		MinorVersion: mssrvs.MSRPCSrvSvcMinorVersion,
+		Operations: map[uint16]dcerpc.Operation{
+			mssrvs.SrvSvcOpNetShareEnumAll: func(call *dcerpc.Call, in *dcerpc.NDRReader, out *dcerpc.NDRWriter) error {
+				in.StringPtr() // ServerName
+				level := in.Uint32()
+				if in.Err() != nil {
+					return in.Err()
+				}
+				if level != 1 {
+					return dcerpc.FaultBadStubData
+				}
+				out.Uint32(1) // Level
+				out.Uint32(1) // Union discriminant
+				out.Pointer(true)
+				out.Uint32(uint32(n)) // EntriesRead
+				out.Pointer(true)
+				out.Uint32(uint32(n)) // Max count
+				for i := 0; i < n; i++ {
+					out.Pointer(true)
+					out.Uint32(mssrvs.StypeDisktree)
+					out.Pointer(true)
+				}
+				for i := 0; i < n; i++ {
+					out.String(fmt.Sprintf("share%d", i))
+					out.String("")
+				}
+				out.Uint32(uint32(n)) // TotalEntries
+				out.Pointer(true)
+				out.Uint32(0) // ResumeHandle
+				out.Uint32(0) // WindowsError
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	return srv
+}
+
+func TestServerNamedPipe(t *testing.T) {
+	port := startServer(t, Options{Pipes: map[string]*dcerpc.Server{"srvsvc": newSrvSvc(t, 300)}})
+	c, err := dial(t, port, alice(), smb.Options{})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer c.Close()
+	if err = c.TreeConnect("IPC$"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if _, err = c.OpenFile("IPC$", "winreg"); err == nil {
+		t.Fatal("Fail")
+	}
+
+	f, err := c.OpenFile("IPC$", mssrvs.MSRPCSrvSvcPipe)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer f.CloseFile()
+	bind, err := dcerpc.Bind(f, mssrvs.MSRPCUuidSrvSvc, mssrvs.MSRPCSrvSvcMajorVersion, mssrvs.MSRPCSrvSvcMinorVersion, dcerpc.MSRPCUuidNdr)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	// The response spans several fragments read from the pipe
+	shares, err := mssrvs.NewRPCCon(bind).NetShareEnumAll("127.0.0.1")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if len(shares) != 300 || shares[0].Name != "share0" || shares[299].Name != "share299" || shares[299].Type != "Disk Drive" {
+		t.Fatalf("Fail: %+v", shares[:1])
+	}
+
+	// Unregistered interfaces are refused
+	f2, err := c.OpenFile("IPC$", `\PIPE\SRVSVC`)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer f2.CloseFile()
+	if _, err = dcerpc.Bind(f2, "338CD001-2244-31F1-AAAA-900038001003", 1, 0, dcerpc.MSRPCUuidNdr); err == nil {
+		t.Fatal("Fail")
+	}
+
+	// Files of a share are not pipes
+	if err = c.TreeConnect("DATA"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	f3, err := c.OpenFile("DATA", "readme.txt")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer f3.CloseFile()
+	if _, err = dcerpc.Bind(f3, mssrvs.MSRPCUuidSrvSvc, mssrvs.MSRPCSrvSvcMajorVersion, mssrvs.MSRPCSrvSvcMinorVersion, dcerpc.MSRPCUuidNdr); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestServerInvalidPipeName(t *testing.T) {
+	for _, name := range []string{"", `a\b`} {
+		if _, err := NewServer(Options{Pipes: map[string]*dcerpc.Server{name: dcerpc.NewServer()}}); err == nil {
+			t.Fatalf("Fail: %q", name)
+		}
+	}
+	if _, err := NewServer(Options{Pipes: map[string]*dcerpc.Server{"srvsvc": nil}}); err == nil {
+		t.Fatal("Fail")
+	}
+}
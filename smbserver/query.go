@@ -0,0 +1,430 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smbserver
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+const (
+	clusterSize = 4096
+	// FILE_CASE_PRESERVED_NAMES | FILE_UNICODE_ON_DISK
+	fileSystemAttributes = 0x00000002 | 0x00000004
+	fileReadOnlyVolume   = 0x00080000
+	fileDeviceDisk       = 0x00000007
+	fileReadOnlyDevice   = 0x00000002
+)
+
+// attributes of a file as reported in SMB responses. fs.FileInfo only holds
+// the modification time, which is used for all the timestamps.
+type attributes struct {
+	time           uint64
+	size           uint64
+	allocationSize uint64
+	attributes     uint32
+	index          uint64
+}
+
+func newAttributes(info fs.FileInfo, readOnly bool) attributes {
+	a := attributes{time: msdtyp.TimeToFiletime(info.ModTime())}
+	if info.IsDir() {
+		a.attributes = smb.FileAttrDirectory
+	} else {
+		a.attributes = smb.FileAttrNormal
+		if readOnly {
+			a.attributes = smb.FileAttrReadonly
+		}
+		a.size = uint64(max(info.Size(), 0))
+		a.allocationSize = (a.size + clusterSize - 1) / clusterSize * clusterSize
+	}
+	return a
+}
+
+// fileIndex derives a stable file id from the path within the share
+func fileIndex(name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return h.Sum64()
+}
+
+// match reports whether name matches the pattern of a QUERY_DIRECTORY
+// request, ignoring case. Besides * and ? the DOS wildcards < > and " of
+// MS-FSA Section 2.1.4.4 are accepted in their simplified meaning.
+func match(pattern, name string) bool {
+	pattern = strings.NewReplacer("<", "*", ">", "?", `"`, ".").Replace(pattern)
+	return matchRunes([]rune(strings.ToLower(pattern)), []rune(strings.ToLower(name)))
+}
+
+func matchRunes(pattern, name []rune) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(name); i >= 0; i-- {
+				if matchRunes(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(name) == 0 {
+				return false
+			}
+		default:
+			if len(name) == 0 || unicode.SimpleFold(pattern[0]) != unicode.SimpleFold(name[0]) && pattern[0] != name[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+// directoryEntry encodes an entry of the FileInformationClass class or
+// returns nil for unsupported classes. MS-FSCC Section 2.4.
+func directoryEntry(class byte, name string, info fs.FileInfo, index uint64, readOnly bool) []byte {
+	fileName := encoder.ToUnicode(name)
+	a := newAttributes(info, readOnly)
+	le := binary.LittleEndian
+	if class == smb.FileNamesInformation {
+		buf := make([]byte, 12, 12+len(fileName))
+		le.PutUint32(buf[8:], uint32(len(fileName)))
+		return append(buf, fileName...)
+	}
+
+	var size int
+	switch class {
+	case smb.FileDirectoryInformation:
+		size = 64
+	case smb.FileFullDirectoryInformation:
+		size = 68
+	case smb.FileIdFullDirectoryInformation:
+		size = 80
+	case smb.FileBothDirectoryInformation:
+		size = 94
+	case smb.FileIdBothDirectoryInformation:
+		size = 104
+	default:
+		return nil
+	}
+	buf := make([]byte, size, size+len(fileName))
+	le.PutUint64(buf[8:], a.time)
+	le.PutUint64(buf[16:], a.time)
+	le.PutUint64(buf[24:], a.time)
+	le.PutUint64(buf[32:], a.time)
+	le.PutUint64(buf[40:], a.size)
+	le.PutUint64(buf[48:], a.allocationSize)
+	le.PutUint32(buf[56:], a.attributes)
+	le.PutUint32(buf[60:], uint32(len(fileName)))
+	// EaSize, ShortNameLength and ShortName are left empty
+	switch class {
+	case smb.FileIdFullDirectoryInformation:
+		le.PutUint64(buf[72:], index)
+	case smb.FileIdBothDirectoryInformation:
+		le.PutUint64(buf[96:], index)
+	}
+	return append(buf, fileName...)
+}
+
+// list reads the entries of the directory matching pattern, preceded by the
+// . and .. entries
+func (o *open) list(pattern string) error {
+	entries, err := o.tree.backend.ReadDir(o.name)
+	if err != nil {
+		return err
+	}
+	o.entries = o.entries[:0]
+	o.names = o.names[:0]
+	o.next = 0
+	parent := o.info
+	if o.name != "." {
+		if info, err := o.tree.backend.Stat(path.Dir(o.name)); err == nil {
+			parent = info
+		}
+	}
+	for i, name := range []string{".", ".."} {
+		if match(pattern, name) {
+			o.names = append(o.names, name)
+			o.entries = append(o.entries, []fs.FileInfo{o.info, parent}[i])
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	for _, e := range entries {
+		if !utf8.ValidString(e.Name()) || !match(pattern, e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		o.names = append(o.names, e.Name())
+		o.entries = append(o.entries, info)
+	}
+	return nil
+}
+
+func (c *conn) handleQueryDirectory(req *request, res *response) {
+	qd := smb.QueryDirectoryReq{}
+	if err := encoder.Unmarshal(req.buf, &qd); err != nil {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	o, ok := req.session.lookupOpen(qd.FileID)
+	if !ok || o.tree != req.tree {
+		res.fail(smb.StatusFileClosed)
+		return
+	}
+	if o.pipe != nil || !o.info.IsDir() {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	if directoryEntry(qd.FileInformationClass, "", o.info, 0, true) == nil {
+		res.fail(smb.StatusNotSupported)
+		return
+	}
+	pattern, err := encoder.FromUnicodeString(qd.Buffer)
+	if err != nil {
+		res.fail(smb.StatusObjectNameInvalid)
+		return
+	}
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	first := o.names == nil || qd.Flags&(smb.RestartScans|smb.Reopen) != 0
+	if first {
+		if err := o.list(pattern); err != nil {
+			res.fail(errorStatus(err))
+			return
+		}
+		if o.names == nil {
+			o.names = []string{}
+		}
+	}
+
+	limit := min(int(qd.OutputBufferLength), int(maxSize(c.dialect)))
+	var buf []byte
+	last := -1
+	for o.next < len(o.names) {
+		entry := directoryEntry(qd.FileInformationClass, o.names[o.next], o.entries[o.next], fileIndex(path.Join(o.name, o.names[o.next])), o.tree.writable == nil)
+		pos := (len(buf) + 7) &^ 7
+		if pos+len(entry) > limit {
+			break
+		}
+		if last >= 0 {
+			binary.LittleEndian.PutUint32(buf[last:], uint32(pos-last))
+		}
+		buf = append(buf, make([]byte, pos-len(buf))...)
+		buf = append(buf, entry...)
+		last = pos
+		o.next++
+		if qd.Flags&smb.ReturnSingleEntry != 0 {
+			break
+		}
+	}
+	if last < 0 {
+		switch {
+		case o.next < len(o.names):
+			res.fail(smb.StatusInfoLengthMismatch)
+		case first && len(o.names) == 0:
+			res.fail(smb.StatusNoSuchFile)
+		default:
+			res.fail(smb.StatusNoMoreFiles)
+		}
+		return
+	}
+	res.marshal(&smb.QueryDirectoryRes{
+		Header:        newHeader(),
+		StructureSize: 9,
+		Buffer:        buf,
+	})
+}
+
+func (c *conn) handleQueryInfo(req *request, res *response) {
+	qi := smb.QueryInfoReq{}
+	if err := encoder.Unmarshal(req.buf, &qi); err != nil {
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	o, ok := req.session.lookupOpen(qi.FileId)
+	if !ok || o.tree != req.tree {
+		res.fail(smb.StatusFileClosed)
+		return
+	}
+	if o.pipe != nil {
+		res.fail(smb.StatusNotSupported)
+		return
+	}
+	o.refresh()
+
+	var buf []byte
+	switch qi.InfoType {
+	case smb.OInfoFile:
+		buf = o.fileInformation(qi.FileInfoClass)
+	case smb.OInfoFilesystem:
+		buf = o.fileSystemInformation(qi.FileInfoClass)
+	}
+	if buf == nil {
+		res.fail(smb.StatusNotSupported)
+		return
+	}
+
+	status := smb.StatusOk
+	if len(buf) > int(qi.OutputBufferLength) {
+		switch qi.FileInfoClass {
+		case smb.FileAllInformation, smb.FileNameInformation:
+			if qi.InfoType == smb.OInfoFile && qi.OutputBufferLength >= 104 {
+				// The variable length file name is truncated
+				status = smb.StatusBufferOverflow
+				buf = buf[:qi.OutputBufferLength]
+				break
+			}
+			fallthrough
+		default:
+			res.fail(smb.StatusInfoLengthMismatch)
+			return
+		}
+	}
+	res.Status = status
+	res.marshal(&smb.QueryInfoRes{
+		Header:        newHeader(),
+		StructureSize: 9,
+		Buffer:        buf,
+	})
+}
+
+// fileInformation encodes the file information class or returns nil for
+// unsupported classes. MS-FSCC Section 2.4.
+func (o *open) fileInformation(class byte) []byte {
+	a := newAttributes(o.info, o.tree.writable == nil)
+	le := binary.LittleEndian
+	basic := make([]byte, 40)
+	for i := 0; i < 32; i += 8 {
+		le.PutUint64(basic[i:], a.time)
+	}
+	le.PutUint32(basic[32:], a.attributes)
+
+	standard := make([]byte, 24)
+	le.PutUint64(standard, a.allocationSize)
+	le.PutUint64(standard[8:], a.size)
+	le.PutUint32(standard[16:], 1) // NumberOfLinks
+	if o.info.IsDir() {
+		standard[21] = 1
+	}
+
+	internal := le.AppendUint64(nil, fileIndex(o.name))
+	name := `\`
+	if o.name != "." {
+		name += strings.ReplaceAll(o.name, "/", `\`)
+	}
+	nameInfo := le.AppendUint32(nil, uint32(2*utf8.RuneCountInString(name)))
+	nameInfo = append(nameInfo[:4], encoder.ToUnicode(name)...)
+	le.PutUint32(nameInfo, uint32(len(nameInfo)-4))
+
+	switch class {
+	case smb.FileBasicInformation:
+		return basic
+	case smb.FileStandardInformation:
+		return standard
+	case smb.FileInternalInformation:
+		return internal
+	case smb.FileEaInformation, smb.FileModeInformation, smb.FileAlignmentInformation:
+		return make([]byte, 4)
+	case smb.FileAccessInformation:
+		return le.AppendUint32(nil, o.access)
+	case smb.FilePositionInformation:
+		return make([]byte, 8)
+	case smb.FileNameInformation:
+		return nameInfo
+	case smb.FileNetworkOpenInformation:
+		buf := append(basic[:32:32], standard[:16]...)
+		buf = le.AppendUint32(buf, a.attributes)
+		return le.AppendUint32(buf, 0)
+	case smb.FileAttributeTagInformation:
+		return le.AppendUint32(le.AppendUint32(nil, a.attributes), 0)
+	case smb.FileAllInformation:
+		buf := append(basic, standard...)
+		buf = append(buf, internal...)
+		buf = append(buf, make([]byte, 4)...) // EaInformation
+		buf = le.AppendUint32(buf, o.access)
+		buf = append(buf, make([]byte, 16)...) // Position, Mode and Alignment
+		return append(buf, nameInfo...)
+	}
+	return nil
+}
+
+// fileSystemInformation encodes the file system information class or
+// returns nil for unsupported classes. MS-FSCC Section 2.5.
+func (o *open) fileSystemInformation(class byte) []byte {
+	le := binary.LittleEndian
+	// The size of a fs.FS is unknown so a full volume of 1TiB is reported
+	const totalUnits = 1 << 40 / clusterSize
+	switch class {
+	case smb.FileFsVolumeInformation:
+		label := encoder.ToUnicode(o.tree.name)
+		buf := make([]byte, 18, 18+len(label))
+		le.PutUint32(buf[8:], uint32(fileIndex(o.tree.name)))
+		le.PutUint32(buf[12:], uint32(len(label)))
+		return append(buf, label...)
+	case smb.FileFsSizeInformation:
+		buf := le.AppendUint64(nil, totalUnits)
+		buf = le.AppendUint64(buf, 0)
+		buf = le.AppendUint32(buf, clusterSize/512)
+		return le.AppendUint32(buf, 512)
+	case smb.FileFsFullSizeInformation:
+		buf := le.AppendUint64(nil, totalUnits)
+		buf = le.AppendUint64(buf, 0)
+		buf = le.AppendUint64(buf, 0)
+		buf = le.AppendUint32(buf, clusterSize/512)
+		return le.AppendUint32(buf, 512)
+	case smb.FileFsDeviceInformation:
+		var characteristics uint32
+		if o.tree.writable == nil {
+			characteristics = fileReadOnlyDevice
+		}
+		return le.AppendUint32(le.AppendUint32(nil, fileDeviceDisk), characteristics)
+	case smb.FileFsAttributeInformation:
+		name := encoder.ToUnicode("NTFS")
+		attributes := uint32(fileSystemAttributes)
+		if o.tree.writable == nil {
+			attributes |= fileReadOnlyVolume
+		}
+		buf := le.AppendUint32(nil, attributes)
+		buf = le.AppendUint32(buf, 255)
+		buf = le.AppendUint32(buf, uint32(len(name)))
+		return append(buf, name...)
+	}
+	return nil
+}
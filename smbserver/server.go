@@ -0,0 +1,245 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package smbserver implements a SMB2 file server. It supports the 2.0.2 and
+// 2.1 dialects, NTLM authentication, guest and anonymous logons, signing and
+// the commands needed to browse, download and upload the files of the shares.
+// Each share is stored by a Backend, which is either read-only, such as any
+// fs.FS wrapped by FS, or a WriteBackend such as a local directory served by
+// Dir. DCERPC interfaces registered on a dcerpc.Server are served on the
+// named pipes of the IPC$ share.
+package smbserver
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jfjallid/golog"
+
+	"github.com/ericblavier/go-smb/ntlmssp"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+)
+
+var log = golog.Get("github.com/ericblavier/go-smb/smbserver")
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Close
+var ErrServerClosed = errors.New("Server closed")
+
+const ipcShare = "IPC$"
+
+// Options configures a Server
+type Options struct {
+	Shares         map[string]Backend // Shares by name, read-only unless the Backend is a WriteBackend
+	Accounts       map[string]string  // Passwords by user name
+	Hashes         map[string][]byte  // NT hashes by user name
+	AllowGuest     bool               // Log on unknown users as guest instead of failing
+	AllowAnonymous bool               // Accept null sessions
+	RequireSigning bool               // Require signed requests from authenticated users
+	ComputerName   string             // NetBIOS name of the server. Defaults to GOSMB
+	Domain         string             // NetBIOS domain name. Defaults to WORKGROUP
+	IdleTimeout    time.Duration      // Close connections idle for longer than this. Zero disables the timeout
+	// Pipes are the DCERPC servers of the named pipes of IPC$ by pipe
+	// name, e.g., "srvsvc". Each open of a pipe is a new association.
+	Pipes map[string]*dcerpc.Server
+	// Capture is called with the NTLM response of every logon naming a
+	// user, e.g., to log it in hashcat format with Hashcat. It is
+	// called concurrently by the goroutines of the connections.
+	Capture func(remote net.Addr, r *ntlmssp.ChallengeResponse)
+	// CaptureOnly fails every logon once its response is captured, turning
+	// the server into a credential capturing canary that serves no files
+	CaptureOnly bool
+}
+
+// Server serves the shares of its Options to SMB2 clients
+type Server struct {
+	opt       Options
+	shares    map[string]Backend
+	pipes     map[string]*dcerpc.Server
+	guid      []byte
+	sessionID atomic.Uint64
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer returns a server for the shares and accounts of opt
+func NewServer(opt Options) (*Server, error) {
+	if opt.ComputerName == "" {
+		opt.ComputerName = "GOSMB"
+	}
+	if opt.Domain == "" {
+		opt.Domain = "WORKGROUP"
+	}
+	s := &Server{
+		opt:       opt,
+		shares:    make(map[string]Backend),
+		pipes:     make(map[string]*dcerpc.Server),
+		guid:      make([]byte, 16),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	for name, backend := range opt.Shares {
+		key := strings.ToUpper(name)
+		if backend == nil {
+			return nil, fmt.Errorf("Missing backend of share %q", name)
+		}
+		if name == "" || strings.ContainsAny(name, `\/`) || key == ipcShare {
+			return nil, fmt.Errorf("Invalid share name %q", name)
+		}
+		if _, ok := s.shares[key]; ok {
+			return nil, fmt.Errorf("Duplicate share name %q", name)
+		}
+		s.shares[key] = backend
+	}
+	for name, rpc := range opt.Pipes {
+		key := strings.ToLower(name)
+		if rpc == nil {
+			return nil, fmt.Errorf("Missing DCERPC server of pipe %q", name)
+		}
+		if name == "" || strings.ContainsAny(name, `\/`) {
+			return nil, fmt.Errorf("Invalid pipe name %q", name)
+		}
+		if _, ok := s.pipes[key]; ok {
+			return nil, fmt.Errorf("Duplicate pipe name %q", name)
+		}
+		s.pipes[key] = rpc
+	}
+	if _, err := rand.Read(s.guid); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// lookup returns the NT hash of an account
+func (s *Server) lookup(user string) ([]byte, bool) {
+	for name, hash := range s.opt.Hashes {
+		if strings.EqualFold(name, user) {
+			return hash, true
+		}
+	}
+	for name, password := range s.opt.Accounts {
+		if strings.EqualFold(name, user) {
+			return ntlmssp.Ntowfv1(password), true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) newAuthenticator(remote net.Addr) *ntlmssp.Server {
+	auth := &ntlmssp.Server{
+		ComputerName: s.opt.ComputerName,
+		Domain:       s.opt.Domain,
+		Lookup:       s.lookup,
+	}
+	if s.opt.Capture != nil {
+		auth.Capture = func(r *ntlmssp.ChallengeResponse) {
+			s.opt.Capture(remote, r)
+		}
+	}
+	return auth
+}
+
+// ListenAndServe listens on the TCP address addr, e.g., ":445", and serves
+// the connections
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until it fails or the server is closed.
+// Each connection is served in its own goroutine.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return ErrServerClosed
+		}
+		s.conns[nc] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			c := newConn(s, nc)
+			c.serve()
+			s.mu.Lock()
+			delete(s.conns, nc)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops the listeners, closes all connections and waits for their
+// goroutines to return
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for nc := range s.conns {
+		nc.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
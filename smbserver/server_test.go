@@ -0,0 +1,315 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smbserver
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ericblavier/go-smb/ntlmssp"
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/spnego"
+)
+
+var testBlob = bytes.Repeat([]byte("0123456789abcdef"), 20000)
+
+func startServer(t *testing.T, opt Options) int {
+	if opt.Shares == nil {
+		opt.Shares = map[string]Backend{
+			"data": FS(fstest.MapFS{
+				"readme.txt":       {Data: []byte("hello world"), ModTime: time.Unix(1700000000, 0)},
+				"docs/big.bin":     {Data: testBlob},
+				"docs/notes.txt":   {Data: []byte("notes")},
+				"docs/sub/a.txt":   {Data: []byte("a")},
+				"empty/.keep.conf": {Data: nil},
+			}),
+		}
+	}
+	if opt.Accounts == nil {
+		opt.Accounts = map[string]string{"alice": "Passw0rd!"}
+	}
+	srv, err := NewServer(opt)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func dial(t *testing.T, port int, initiator *spnego.NTLMInitiator, opt smb.Options) (*smb.Connection, error) {
+	opt.Host = "127.0.0.1"
+	opt.Port = port
+	opt.Initiator = initiator
+	opt.DialTimeout = 5 * time.Second
+	return smb.NewConnection(opt)
+}
+
+func alice() *spnego.NTLMInitiator {
+	return &spnego.NTLMInitiator{User: "alice", Password: "Passw0rd!"}
+}
+
+func TestServerListDirectory(t *testing.T) {
+	port := startServer(t, Options{})
+	c, err := dial(t, port, alice(), smb.Options{})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer c.Close()
+	if err = c.TreeConnect("DATA"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+
+	files, err := c.ListDirectory("DATA", "docs", "*")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+		if f.Name == "big.bin" && (f.IsDir || f.Size != uint64(len(testBlob))) {
+			t.Fatalf("Fail: %+v", f)
+		}
+		if f.Name == "sub" && !f.IsDir {
+			t.Fatalf("Fail: %+v", f)
+		}
+	}
+	sort.Strings(names)
+	if len(names) != 3 || names[0] != "big.bin" || names[1] != "notes.txt" || names[2] != "sub" {
+		t.Fatalf("Fail: %+v", names)
+	}
+
+	files, err = c.ListDirectory("DATA", "docs", "*.TXT")
+	if err != nil || len(files) != 1 || files[0].Name != "notes.txt" {
+		t.Fatalf("Fail: %+v %v", files, err)
+	}
+}
+
+func TestServerRetrieveFile(t *testing.T) {
+	port := startServer(t, Options{})
+	c, err := dial(t, port, alice(), smb.Options{})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer c.Close()
+
+	var buf bytes.Buffer
+	err = c.RetrieveFile("data", `docs\big.bin`, 0, func(b []byte) (int, error) {
+		return buf.Write(b)
+	})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), testBlob) {
+		t.Fatalf("Fail: got %d bytes", buf.Len())
+	}
+
+	fm, err := c.Stat("data", "README.TXT")
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if fm.EndOfFile != 11 || !fm.Modified().Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("Fail: %+v", fm)
+	}
+
+	if _, err = c.Stat("data", "missing.txt"); err == nil {
+		t.Fatal("Fail")
+	}
+	if err = c.TreeConnect("nosuchshare"); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestServerReadOnly(t *testing.T) {
+	port := startServer(t, Options{})
+	c, err := dial(t, port, alice(), smb.Options{})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer c.Close()
+
+	err = c.PutFile("data", "new.txt", 0, func(b []byte) (int, error) {
+		return copy(b, "data"), nil
+	})
+	if err == nil {
+		t.Fatal("Fail")
+	}
+	if err = c.Mkdir("data", "newdir"); err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestServerLogonFailure(t *testing.T) {
+	port := startServer(t, Options{})
+	_, err := dial(t, port, &spnego.NTLMInitiator{User: "alice", Password: "wrong"}, smb.Options{})
+	if err == nil {
+		t.Fatal("Fail")
+	}
+	_, err = dial(t, port, &spnego.NTLMInitiator{User: "bob", Password: "Passw0rd!"}, smb.Options{})
+	if err == nil {
+		t.Fatal("Fail")
+	}
+}
+
+func TestServerGuestAndAnonymous(t *testing.T) {
+	port := startServer(t, Options{})
+	if _, err := dial(t, port, &spnego.NTLMInitiator{NullSession: true}, smb.Options{}); err == nil {
+		t.Fatal("Fail")
+	}
+
+	port = startServer(t, Options{AllowGuest: true, AllowAnonymous: true})
+	c, err := dial(t, port, &spnego.NTLMInitiator{NullSession: true}, smb.Options{})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer c.Close()
+	if err = c.TreeConnect("data"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if _, err = c.ListDirectory("data", "", "*"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+
+	c2, err := dial(t, port, &spnego.NTLMInitiator{User: "bob", Password: "x"}, smb.Options{})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer c2.Close()
+	if _, err = c2.Stat("data", "readme.txt"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+}
+
+func TestServerSigning(t *testing.T) {
+	port := startServer(t, Options{RequireSigning: true})
+	c, err := dial(t, port, alice(), smb.Options{RequireMessageSigning: true})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer c.Close()
+	if !c.IsSigningRequired() {
+		t.Fatal("Fail")
+	}
+	if err = c.TreeConnect("data"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if _, err = c.ListDirectory("data", "docs", "*"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+}
+
+func TestServerWritable(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := Dir(dir)
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	port := startServer(t, Options{Shares: map[string]Backend{"rw": backend}})
+	c, err := dial(t, port, alice(), smb.Options{})
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	defer c.Close()
+	if err = c.TreeConnect("rw"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+
+	if err = c.Mkdir("rw", "sub"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	src := bytes.NewReader(testBlob)
+	if err = c.PutFile("rw", `SUB\upload.bin`, 0, src.Read); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "sub", "upload.bin"))
+	if err != nil || !bytes.Equal(data, testBlob) {
+		t.Fatalf("Fail: %d bytes %v", len(data), err)
+	}
+
+	if err = c.Rename("rw", `sub\upload.bin`, "moved.bin", false); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	var buf bytes.Buffer
+	err = c.RetrieveFile("rw", "moved.bin", 0, buf.Write)
+	if err != nil || !bytes.Equal(buf.Bytes(), testBlob) {
+		t.Fatalf("Fail: %d bytes %v", buf.Len(), err)
+	}
+
+	if err = c.PutFile("rw", `sub\other.txt`, 0, bytes.NewReader([]byte("x")).Read); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if err = c.Rename("rw", `sub\other.txt`, "moved.bin", false); err == nil {
+		t.Fatal("Fail")
+	}
+	if err = c.DeleteDir("rw", "sub"); err == nil {
+		t.Fatal("Fail")
+	}
+	if err = c.DeleteFile("rw", `sub\other.txt`); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if err = c.DeleteDir("rw", "sub"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || entries[0].Name() != "moved.bin" {
+		t.Fatalf("Fail: %+v %v", entries, err)
+	}
+}
+
+func TestServerCaptureOnly(t *testing.T) {
+	var mu sync.Mutex
+	var captured []string
+	port := startServer(t, Options{
+		CaptureOnly: true,
+		Capture: func(remote net.Addr, r *ntlmssp.ChallengeResponse) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !strings.HasPrefix(remote.String(), "127.0.0.1:") {
+				t.Errorf("Fail: %s", remote)
+			}
+			captured = append(captured, r.Hashcat())
+		},
+	})
+	// Valid credentials are captured and refused as well
+	for _, user := range []string{"alice", "bob"} {
+		if _, err := dial(t, port, &spnego.NTLMInitiator{User: user, Password: "Passw0rd!", Domain: "CORP"}, smb.Options{}); err == nil {
+			t.Fatal("Fail")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(captured) != 2 || !strings.HasPrefix(captured[0], "alice::CORP:") || !strings.HasPrefix(captured[1], "bob::CORP:") {
+		t.Fatalf("Fail: %+v", captured)
+	}
+}
@@ -0,0 +1,341 @@
+// MIT License
+//
+// # Copyright (c) 2025 Jimmy Fjällid
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package smbserver
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/jfjallid/gofork/encoding/asn1"
+
+	"github.com/ericblavier/go-smb/gss"
+	"github.com/ericblavier/go-smb/msdtyp"
+	"github.com/ericblavier/go-smb/ntlmssp"
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+const (
+	smb1CommandNegotiate = 0x72
+	dialectWildcard      = "SMB 2.???"
+	dialect202           = "SMB 2.002"
+)
+
+type session struct {
+	id     uint64
+	auth   *ntlmssp.Server // Authentication in progress
+	user   string
+	flags  uint16
+	valid  bool
+	signer *signer
+
+	trees      map[uint32]*tree
+	nextTreeID uint32
+	opens      map[uint64]*open
+	nextFileID uint64
+}
+
+func (s *session) close() {
+	for _, t := range s.trees {
+		s.disconnect(t)
+	}
+}
+
+// handleSMB1Negotiate answers the SMB1 multi-protocol NEGOTIATE of clients
+// that also support SMB2 with a SMB2 NEGOTIATE response
+func (c *conn) handleSMB1Negotiate(pkt []byte) ([]byte, error) {
+	if c.dialect != 0 || len(pkt) < 35 || pkt[4] != smb1CommandNegotiate {
+		return nil, fmt.Errorf("Unexpected SMB1 request")
+	}
+	byteCount := int(binary.LittleEndian.Uint16(pkt[33:35]))
+	if 35+byteCount > len(pkt) {
+		return nil, fmt.Errorf("Invalid ByteCount of SMB1 NEGOTIATE")
+	}
+	var dialect uint16
+	for _, d := range bytes.Split(pkt[35:35+byteCount], []byte{0}) {
+		if len(d) < 2 || d[0] != 0x02 {
+			continue
+		}
+		switch string(d[1:]) {
+		case dialectWildcard:
+			dialect = smb.DialectSmb2_ALL
+		case dialect202:
+			if dialect == 0 {
+				dialect = smb.DialectSmb_2_0_2
+			}
+		}
+	}
+	if dialect == 0 {
+		return nil, fmt.Errorf("Client does not support SMB2")
+	}
+
+	res := &response{Header: newHeader()}
+	res.Command = smb.CommandNegotiate
+	res.Flags = smb.SMB2_FLAGS_SERVER_TO_REDIR
+	res.Credits = 1
+	c.negotiateResponse(res, dialect)
+	if dialect != smb.DialectSmb2_ALL {
+		c.dialect = dialect
+	}
+	msg, err := encoder.Marshal(res.Header)
+	if err != nil {
+		return nil, err
+	}
+	return append(msg, res.body...), nil
+}
+
+func (c *conn) handleNegotiate(req *request, res *response) {
+	if c.dialect != 0 {
+		// A second NEGOTIATE is a protocol violation
+		res.fail(smb.StatusInvalidParameter)
+		c.nc.Close()
+		return
+	}
+	neg := smb.NegotiateReq{}
+	if err := encoder.Unmarshal(req.buf, &neg); err != nil {
+		log.Debugln(err)
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+	var dialect uint16
+	for _, d := range neg.Dialects {
+		if d == smb.DialectSmb_2_1 {
+			dialect = d
+		} else if d == smb.DialectSmb_2_0_2 && dialect == 0 {
+			dialect = d
+		}
+	}
+	if dialect == 0 {
+		log.Debugf("No common dialect in %v\n", neg.Dialects)
+		res.fail(smb.StatusNotSupported)
+		return
+	}
+	c.dialect = dialect
+	c.negotiateResponse(res, dialect)
+}
+
+// maxSize is the MaxReadSize and MaxTransactSize of the dialect
+func maxSize(dialect uint16) uint32 {
+	if dialect == smb.DialectSmb_2_1 {
+		return 1 << 20
+	}
+	return 1 << 16
+}
+
+func (c *conn) negotiateResponse(res *response, dialect uint16) {
+	neg := smb.NewNegotiateRes()
+	neg.Header = newHeader()
+	neg.SecurityMode = smb.SecurityModeSigningEnabled
+	if c.srv.opt.RequireSigning {
+		neg.SecurityMode |= smb.SecurityModeSigningRequired
+	}
+	neg.DialectRevision = dialect
+	neg.ServerGuid = c.srv.guid
+	if dialect == smb.DialectSmb_2_1 {
+		neg.Capabilities = smb.GlobalCapLargeMTU
+	}
+	neg.MaxTransactSize = maxSize(dialect)
+	neg.MaxReadSize = maxSize(dialect)
+	neg.MaxWriteSize = maxSize(dialect)
+	neg.SystemTime = msdtyp.TimeToFiletime(time.Now())
+	neg.SecurityBlob = &gss.NegTokenInit{
+		OID: gss.SpnegoOid,
+		Data: gss.NegTokenInitData{
+			MechTypes: []asn1.ObjectIdentifier{gss.NtLmSSPMechTypeOid},
+		},
+	}
+	res.marshal(&neg)
+}
+
+// securityToken returns the NTLM message of a SESSION_SETUP security buffer,
+// which is either a SPNEGO NegTokenInit or NegTokenResp, or a raw NTLM
+// message. A nil token without error is returned for a NegTokenInit with an
+// optimistic token of another mechanism.
+func securityToken(blob []byte) ([]byte, error) {
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("Empty security buffer")
+	}
+	switch {
+	case bytes.HasPrefix(blob, []byte(ntlmssp.Signature)):
+		return blob, nil
+	case blob[0] == 0x60:
+		init := gss.NegTokenInit{}
+		if err := encoder.Unmarshal(blob, &init); err != nil {
+			return nil, err
+		}
+		supported := false
+		for _, mech := range init.Data.MechTypes {
+			if mech.Equal(gss.NtLmSSPMechTypeOid) {
+				supported = true
+			}
+		}
+		if !supported {
+			return nil, fmt.Errorf("Client does not support NTLM")
+		}
+		if len(init.Data.MechTypes) > 0 && !init.Data.MechTypes[0].Equal(gss.NtLmSSPMechTypeOid) {
+			return nil, nil
+		}
+		return init.Data.MechToken, nil
+	case blob[0] == 0xa1:
+		resp := gss.NegTokenResp{}
+		if err := encoder.Unmarshal(blob, &resp); err != nil {
+			return nil, err
+		}
+		return resp.ResponseToken, nil
+	}
+	return nil, fmt.Errorf("Unknown security buffer")
+}
+
+func (c *conn) handleSessionSetup(req *request, res *response) {
+	ss := smb.SessionSetupReq{}
+	if err := encoder.Unmarshal(req.buf, &ss); err != nil {
+		log.Debugln(err)
+		res.fail(smb.StatusInvalidParameter)
+		return
+	}
+
+	s, ok := c.sessions[req.SessionID]
+	if req.SessionID == 0 {
+		s = &session{
+			id:    c.srv.sessionID.Add(1),
+			trees: make(map[uint32]*tree),
+			opens: make(map[uint64]*open),
+		}
+		c.sessions[s.id] = s
+	} else if !ok {
+		res.fail(smb.StatusUserSessionDeleted)
+		return
+	}
+	res.SessionID = s.id
+
+	token, err := securityToken(ss.SecurityBlob)
+	if err != nil {
+		log.Debugln(err)
+		c.logonFailure(s, res)
+		return
+	}
+	if token == nil {
+		// Ask for the NTLM NEGOTIATE as the optimistic token was of another
+		// mechanism
+		c.sessionSetupResponse(res, s, smb.StatusMoreProcessingRequired, gss.GssStateAcceptIncomplete, nil)
+		return
+	}
+	if len(token) < 12 {
+		c.logonFailure(s, res)
+		return
+	}
+
+	switch binary.LittleEndian.Uint32(token[8:12]) {
+	case ntlmssp.TypeNtLmNegotiate:
+		s.auth = c.srv.newAuthenticator(c.nc.RemoteAddr())
+		challenge, err := s.auth.Challenge(token)
+		if err != nil {
+			log.Debugln(err)
+			c.logonFailure(s, res)
+			return
+		}
+		c.sessionSetupResponse(res, s, smb.StatusMoreProcessingRequired, gss.GssStateAcceptIncomplete, challenge)
+	case ntlmssp.TypeNtLmAuthenticate:
+		if s.auth == nil {
+			c.logonFailure(s, res)
+			return
+		}
+		c.authenticate(s, token, res)
+	default:
+		c.logonFailure(s, res)
+	}
+}
+
+// authenticate completes the logon of session s with the AUTHENTICATE
+// message token
+func (c *conn) authenticate(s *session, token []byte, res *response) {
+	err := s.auth.Authenticate(token)
+	auth := s.auth
+	s.auth = nil
+	s.flags = 0
+	s.signer = nil
+	switch {
+	case c.srv.opt.CaptureOnly:
+		log.Debugln("Refused logon in capture mode")
+		c.logonFailure(s, res)
+		return
+	case err == nil && auth.Session().IsAnonymous():
+		if !c.srv.opt.AllowAnonymous {
+			log.Debugln("Refused anonymous logon")
+			c.logonFailure(s, res)
+			return
+		}
+		s.flags = smb.SessionFlagIsNull
+	case err == nil:
+		s.user = auth.Session().User()
+		s.signer = &signer{h: hmac.New(sha256.New, auth.Session().SessionKey())}
+	case err == ntlmssp.ErrUnknownUser && c.srv.opt.AllowGuest:
+		s.flags = smb.SessionFlagIsGuest
+	default:
+		log.Debugf("Logon failure: %v\n", err)
+		c.logonFailure(s, res)
+		return
+	}
+	s.valid = true
+	log.Debugf("Session %d established for user %q with flags 0x%x\n", s.id, s.user, s.flags)
+
+	c.sessionSetupResponse(res, s, smb.StatusOk, gss.GssStateAcceptCompleted, nil)
+	if s.signer != nil && c.srv.opt.RequireSigning {
+		res.signer = s.signer
+	}
+}
+
+func (c *conn) logonFailure(s *session, res *response) {
+	s.close()
+	delete(c.sessions, s.id)
+	res.fail(smb.StatusLogonFailure)
+}
+
+func (c *conn) sessionSetupResponse(res *response, s *session, status uint32, state asn1.Enumerated, token []byte) {
+	ss := smb.SessionSetup1Res{
+		Header:        newHeader(),
+		StructureSize: 9,
+		Flags:         s.flags,
+		SecurityBlob: &gss.NegTokenResp{
+			State:         state,
+			SupportedMech: gss.NtLmSSPMechTypeOid,
+			ResponseToken: token,
+		},
+	}
+	res.Status = status
+	res.marshal(&ss)
+}
+
+func (c *conn) handleLogoff(req *request, res *response) {
+	req.session.close()
+	delete(c.sessions, req.session.id)
+	res.marshal(&smb.LogoffRes{Header: newHeader(), StructureSize: 4})
+}
+
+func (c *conn) handleEcho(req *request, res *response) {
+	// StructureSize and Reserved
+	res.body = []byte{4, 0, 0, 0}
+}
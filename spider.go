@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc/mssrvs"
+	"github.com/ericblavier/go-smb/smb/encoder"
+)
+
+// Content patterns of -secrets matching common ways credentials end up in
+// scripts and configuration files
+var secretPatterns = []string{
+	`(?i)\b(password|passwd|pwd|pass)\s*[=:]\s*\S+`,
+	`(?i)-(password|pass|p)\s+\S+`,
+	`(?i)connectionstring|data source=.*;\s*(user id|uid)=`,
+	`-----BEGIN( [A-Z]+)? PRIVATE KEY-----`,
+	`\bAKIA[0-9A-Z]{16}\b`,
+	`(?i)\bcpassword="[^"]+"`,
+	`(?i)net use .* /user:`,
+	`(?i)convertto-securestring .*-asplaintext`,
+}
+
+// Bytes of a file inspected to decide whether it is binary
+const binarySniffSize = 8192
+
+// Longest matching line included in a finding
+const maxFindingText = 200
+
+// A file name or line matching a spider pattern
+type spiderFinding struct {
+	Path     string    `json:"path"`
+	Size     uint64    `json:"size"`
+	Modified time.Time `json:"modified"`
+	Match    string    `json:"match"` // name or content
+	Pattern  string    `json:"pattern"`
+	Line     int       `json:"line,omitempty"`
+	Text     string    `json:"text,omitempty"`
+}
+
+// Line of a file matching a content pattern
+type contentMatch struct {
+	pattern string
+	line    int
+	text    string
+}
+
+// compileRegexps compiles regular expressions, matching file names case
+// insensitively when ignoreCase is set
+func compileRegexps(patterns []string, ignoreCase bool) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		if ignoreCase && !strings.HasPrefix(p, "(?i)") {
+			p = "(?i)" + p
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern %s: %s", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// decodeText returns the content of a text file as UTF-8. UTF-16 files with
+// a byte order mark are converted and binary files, which contain NUL bytes
+// in their first bytes, are rejected.
+func decodeText(data []byte) ([]byte, bool) {
+	if bytes.HasPrefix(data, []byte{0xff, 0xfe}) {
+		data = data[2:]
+		s, err := encoder.FromUnicodeString(data[:len(data)&^1])
+		if err != nil {
+			return nil, false
+		}
+		return []byte(s), true
+	}
+	data = bytes.TrimPrefix(data, []byte{0xef, 0xbb, 0xbf})
+	sniff := data
+	if len(sniff) > binarySniffSize {
+		sniff = sniff[:binarySniffSize]
+	}
+	if bytes.IndexByte(sniff, 0) != -1 {
+		return nil, false
+	}
+	return data, true
+}
+
+// scanContent returns the lines of a text matching any of the patterns
+func scanContent(data []byte, patterns []*regexp.Regexp) (matches []contentMatch) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		for _, re := range patterns {
+			if !re.MatchString(line) {
+				continue
+			}
+			text := strings.TrimSpace(line)
+			if len(text) > maxFindingText {
+				text = text[:maxFindingText]
+				for !utf8.ValidString(text) {
+					text = text[:len(text)-1]
+				}
+			}
+			matches = append(matches, contentMatch{pattern: re.String(), line: n, text: text})
+			break
+		}
+	}
+	return
+}
+
+// spider walks shares reporting files whose name or content match
+type spider struct {
+	conn     *smb.Connection
+	names    []*regexp.Regexp
+	contents []*regexp.Regexp
+	filter   *downloadFilter // Exclusions and depth limit
+	maxSize  uint64          // Largest file whose content is scanned
+	findings int
+}
+
+func (s *spider) report(finding spiderFinding) {
+	s.findings++
+	if *jsonOutput {
+		emit(finding)
+		return
+	}
+	if finding.Match == "name" {
+		fmt.Printf("%s (%d bytes, %s)\n", finding.Path, finding.Size, finding.Modified.Format(time.DateTime))
+		return
+	}
+	fmt.Printf("%s:%d: %s\n", finding.Path, finding.Line, finding.Text)
+}
+
+// readFile reads up to maxSize bytes of a file
+func (s *spider) readFile(share, name string) ([]byte, error) {
+	f, err := s.conn.OpenFile(share, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.CloseFile()
+	return io.ReadAll(io.LimitReader(f, int64(s.maxSize)))
+}
+
+// checkFile matches the name and content of a file
+func (s *spider) checkFile(t target, rel string, file *smb.SharedFile) {
+	if s.filter.excluded(rel) {
+		return
+	}
+	t.path = file.FullPath
+	finding := spiderFinding{Path: t.String(), Size: file.Size, Modified: file.Modified()}
+	for _, re := range s.names {
+		if re.MatchString(file.Name) {
+			finding.Match, finding.Pattern = "name", re.String()
+			s.report(finding)
+			break
+		}
+	}
+	if len(s.contents) == 0 || file.Size == 0 || file.Size > s.maxSize {
+		return
+	}
+	data, err := s.readFile(t.share, file.FullPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s: %s\n", finding.Path, err)
+		return
+	}
+	text, ok := decodeText(data)
+	if !ok {
+		return
+	}
+	for _, m := range scanContent(text, s.contents) {
+		finding.Match, finding.Pattern, finding.Line, finding.Text = "content", m.pattern, m.line, m.text
+		s.report(finding)
+	}
+}
+
+// walk spiders a directory of a share
+func (s *spider) walk(t target, dir, rel string, depth int) {
+	files, err := s.conn.ListDirectory(t.share, dir, "*")
+	if err != nil {
+		t.path = dir
+		fmt.Fprintf(os.Stderr, "Failed to list %s: %s\n", t, err)
+		return
+	}
+	for i := range files {
+		file := &files[i]
+		if file.Name == "." || file.Name == ".." {
+			continue
+		}
+		childRel := path.Join(rel, file.Name)
+		if file.IsDir {
+			if !file.IsJunction && s.filter.enterDir(childRel, depth+1) {
+				s.walk(t, file.FullPath, childRel, depth+1)
+			}
+			continue
+		}
+		s.checkFile(t, childRel, file)
+	}
+}
+
+// spiderShares returns the shares to walk, by default the disk shares that
+// are not hidden
+func spiderShares(conn *smb.Connection, host, selected string) ([]string, error) {
+	if selected != "" {
+		return strings.Split(selected, ","), nil
+	}
+	all, err := enumShares(conn, host)
+	if err != nil {
+		return nil, err
+	}
+	var shares []string
+	for _, share := range all {
+		if share.TypeId == mssrvs.StypeDisktree && !share.Hidden {
+			shares = append(shares, share.Name)
+		}
+	}
+	return shares, nil
+}
+
+func runSpider(args []string) error {
+	fs := flag.NewFlagSet("spider", flag.ExitOnError)
+	var names, contents, exclude patternList
+	shareList := fs.String("shares", "", "Comma separated shares to walk, defaults to all disk shares that are not hidden")
+	fs.Var(&names, "name", "Regular expression matched against file names, case insensitive (repeatable)")
+	fs.Var(&contents, "content", "Regular expression matched against the lines of text files (repeatable)")
+	secrets := fs.Bool("secrets", false, "Match the content against built-in patterns for passwords, keys and connection strings")
+	fs.Var(&exclude, "exclude", "Glob of files and directories to skip (repeatable)")
+	maxSizeStr := fs.String("max-size", "1M", "Only scan the content of files up to this size, with an optional K, M or G suffix")
+	depth := fs.Int("depth", 0, "Maximum directory depth, 0 for no limit")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Usage: spider [-shares list] [-name regex]... [-content regex]... [-secrets] [-exclude glob]... [-max-size size] [-depth n] <host>")
+	}
+	if len(names) == 0 && len(contents) == 0 && !*secrets {
+		return fmt.Errorf("At least one of -name, -content or -secrets is required")
+	}
+	host := fs.Arg(0)
+
+	s := &spider{}
+	var err error
+	if s.names, err = compileRegexps(names, true); err != nil {
+		return err
+	}
+	if *secrets {
+		contents = append(contents, secretPatterns...)
+	}
+	if s.contents, err = compileRegexps(contents, false); err != nil {
+		return err
+	}
+	if s.filter, err = newDownloadFilter(nil, exclude, false); err != nil {
+		return err
+	}
+	s.filter.maxDepth = *depth
+	if s.maxSize, err = parseSize(*maxSizeStr); err != nil {
+		return err
+	}
+
+	if s.conn, err = connect(host); err != nil {
+		return err
+	}
+	defer s.conn.Close()
+	shares, err := spiderShares(s.conn, host, *shareList)
+	if err != nil {
+		return err
+	}
+	for _, share := range shares {
+		if err := s.conn.TreeConnect(share); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to connect to %s: %s\n", share, err)
+			continue
+		}
+		s.walk(target{host: host, share: share}, "", "", 0)
+		s.conn.TreeDisconnect(share)
+	}
+	if !*jsonOutput {
+		fmt.Fprintf(os.Stderr, "%d findings in %d shares\n", s.findings, len(shares))
+	}
+	return nil
+}
@@ -22,10 +22,12 @@
 package spnego
 
 import (
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jfjallid/gofork/encoding/asn1"
@@ -33,6 +35,7 @@ import (
 
 	"github.com/ericblavier/go-smb/gss"
 	"github.com/ericblavier/go-smb/krb5ssp"
+	"github.com/jfjallid/gokrb5/v8/client"
 	"github.com/jfjallid/golog"
 )
 
@@ -73,6 +76,31 @@ type KRB5Initiator struct {
 	client *krb5ssp.Client
 	seqNum uint32
 	SPN    string
+	// Share the TGT and service tickets with other initiators using the same
+	// credentials such that reconnecting to a host doesn't require new
+	// ticket requests
+	CacheTickets bool
+}
+
+// Kerberos clients shared by initiators with CacheTickets set. The gokrb5
+// client caches the service tickets it has requested until they expire.
+var krbClientCache = struct {
+	sync.Mutex
+	clients map[[32]byte]*client.Client
+}{clients: make(map[[32]byte]*client.Client)}
+
+func (i *KRB5Initiator) cacheKey() [32]byte {
+	h := sha256.New()
+	for _, s := range []string{strings.ToLower(i.User), strings.ToLower(i.Domain), i.DCIP, i.Password} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	h.Write(i.Hash)
+	h.Write([]byte{0})
+	h.Write(i.AESKey)
+	var key [32]byte
+	h.Sum(key[:0])
+	return key
 }
 
 func (i *KRB5Initiator) SetClient(c *krb5ssp.Client) error {
@@ -81,13 +109,15 @@ func (i *KRB5Initiator) SetClient(c *krb5ssp.Client) error {
 }
 
 func (i *KRB5Initiator) Logoff() {
-	i.client.Destroy()
+	if !i.CacheTickets {
+		// Shared clients are kept for other initiators
+		i.client.Destroy()
+	}
 	i.client = nil
 	return
 }
 
-func (i *KRB5Initiator) initKerberosClient() error {
-	var err error
+func (i *KRB5Initiator) initKerberosClient() (err error) {
 	if i.SPN != "" {
 		parts := strings.Split(i.SPN, "/")
 		if len(parts) < 2 {
@@ -127,6 +157,23 @@ func (i *KRB5Initiator) initKerberosClient() error {
 		i.Domain = parts[1]
 	}
 
+	if i.CacheTickets {
+		key := i.cacheKey()
+		krbClientCache.Lock()
+		defer krbClientCache.Unlock()
+		if c, ok := krbClientCache.clients[key]; ok {
+			log.Debugln("Reusing cached Kerberos client")
+			// Each initiator keeps its own session keys
+			i.client = krb5ssp.NewClient(c)
+			return nil
+		}
+		defer func() {
+			if err == nil {
+				krbClientCache.clients[key] = i.client.Client
+			}
+		}()
+	}
+
 	i.client, err = krb5ssp.InitKerberosClient(i.User, i.Domain, i.Password, i.Hash, i.AESKey, i.DCIP, i.SPN, i.DialTimout, i.ProxyDialer, i.DnsHost, i.DnsTCP)
 	return err
 }
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc/mssamr"
+	"github.com/ericblavier/go-smb/spnego"
+)
+
+// Outcome of a single authentication attempt
+type sprayResult struct {
+	Time   time.Time `json:"time"`
+	Host   string    `json:"host"`
+	Domain string    `json:"domain,omitempty"`
+	User   string    `json:"user"`
+	Status string    `json:"status"`
+	Valid  bool      `json:"valid"` // The password or hash is correct
+	Error  string    `json:"error,omitempty"`
+}
+
+// Results of session setup that confirm the password although no session
+// was established
+var sprayValidStatus = map[uint32]string{
+	smb.StatusPasswordExpired:    "password_expired",
+	smb.StatusPasswordMustChange: "password_must_change",
+}
+
+// Other results of session setup worth telling apart
+var sprayFailedStatus = map[uint32]string{
+	smb.StatusLogonFailure:       "logon_failure",
+	smb.StatusAccountLockedOut:   "locked_out",
+	smb.StatusAccountDisabled:    "account_disabled",
+	smb.StatusAccountRestriction: "account_restriction",
+}
+
+// sprayer tests one credential against a list of users and hosts while
+// keeping the number of failed attempts per user within a budget
+type sprayer struct {
+	users     []string
+	hosts     []string
+	budget    int           // Failed attempts allowed per user
+	threshold int           // Lockout threshold of the domain, 0 if unknown
+	delay     time.Duration // Pause between attempts
+	jitter    time.Duration // Random extra pause of up to jitter
+	verbose   bool          // Report failed attempts as well
+	// Abort once a locked out account is seen, since it usually means that
+	// the lockout policy is stricter than assumed
+	stopOnLockout bool
+
+	login       func(host, user string) sprayResult
+	badPwdCount func(user string) (int, error) // nil if not obtainable
+	sleep       func(time.Duration)
+	report      func(sprayResult)
+}
+
+// run performs the spray and returns the number of valid credentials found
+func (s *sprayer) run() (valid int, err error) {
+	failures := make(map[string]int)
+	skipped := make(map[string]bool)
+	first := true
+	for _, host := range s.hosts {
+		for _, user := range s.users {
+			key := strings.ToLower(user)
+			if skipped[key] || failures[key] >= s.budget {
+				continue
+			}
+			if s.badPwdCount != nil && s.threshold > 0 {
+				count, err := s.badPwdCount(user)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Skipping %s: failed to query badPwdCount: %s\n", user, err)
+					skipped[key] = true
+					continue
+				}
+				// Never make the attempt that would reach the threshold
+				if count+1 >= s.threshold {
+					fmt.Fprintf(os.Stderr, "Skipping %s: badPwdCount %d is too close to the lockout threshold %d\n", user, count, s.threshold)
+					skipped[key] = true
+					continue
+				}
+			}
+
+			if !first {
+				pause := s.delay
+				if s.jitter > 0 {
+					pause += time.Duration(rand.Int63n(int64(s.jitter)))
+				}
+				s.sleep(pause)
+			}
+			first = false
+
+			res := s.login(host, user)
+			switch {
+			case res.Valid:
+				valid++
+			case res.Status == "locked_out":
+				skipped[key] = true
+			case res.Status != "guest":
+				failures[key]++
+			}
+			if res.Valid || s.verbose {
+				s.report(res)
+			}
+			if res.Status == "locked_out" && s.stopOnLockout {
+				return valid, fmt.Errorf("Account %s on %s is locked out, aborting", user, host)
+			}
+		}
+	}
+	return
+}
+
+// sprayLogin attempts a session setup with the credential and classifies the
+// outcome
+func sprayLogin(host, domain, user, password string, hash []byte) (res sprayResult) {
+	res = sprayResult{Time: time.Now(), Host: host, Domain: domain, User: user}
+	conn, err := smb.NewConnection(smb.Options{
+		Host: host,
+		Port: *port,
+		Initiator: &spnego.NTLMInitiator{
+			User:     user,
+			Password: password,
+			Hash:     hash,
+			Domain:   domain,
+		},
+	})
+	if err == nil {
+		defer conn.Close()
+		if conn.IsGuestSession() {
+			// Servers mapping bad logons to guest accept any password
+			res.Status = "guest"
+			return
+		}
+		res.Status, res.Valid = "success", true
+		return
+	}
+	for code, name := range sprayValidStatus {
+		if err == smb.StatusMap[code] {
+			res.Status, res.Valid = name, true
+			return
+		}
+	}
+	for code, name := range sprayFailedStatus {
+		if err == smb.StatusMap[code] {
+			res.Status = name
+			return
+		}
+	}
+	res.Status, res.Error = "error", err.Error()
+	return
+}
+
+// badPwdMonitor reads the badPwdCount of domain accounts over SAMR
+type badPwdMonitor struct {
+	rpccon *mssamr.RPCCon
+	domain *mssamr.SamrHandle
+	rids   map[string]uint32
+}
+
+func newBadPwdMonitor(conn *smb.Connection) (*badPwdMonitor, error) {
+	rpccon, domain, _, err := openAccountDomain(conn)
+	if err != nil {
+		return nil, err
+	}
+	return &badPwdMonitor{rpccon: rpccon, domain: domain, rids: make(map[string]uint32)}, nil
+}
+
+func (m *badPwdMonitor) badPwdCount(user string) (int, error) {
+	rid, found := m.rids[strings.ToLower(user)]
+	if !found {
+		mappings, err := m.rpccon.SamrLookupNamesInDomain(m.domain, []string{user})
+		if err != nil {
+			return 0, err
+		}
+		if len(mappings) != 1 {
+			return 0, fmt.Errorf("User not found")
+		}
+		rid = mappings[0].RID
+		m.rids[strings.ToLower(user)] = rid
+	}
+	info, err := m.rpccon.QueryUserAllInfo(m.domain, rid)
+	if err != nil {
+		return 0, err
+	}
+	return int(info.BadPasswordCount), nil
+}
+
+// readLines returns the non-empty lines of a file
+func readLines(name string) (lines []string, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func runSpray(args []string) error {
+	fs := flag.NewFlagSet("spray", flag.ExitOnError)
+	usersFile := fs.String("users", "", "File with one username per line (required)")
+	sprayPass := fs.String("password", "", "Password to test, defaults to the global -pass")
+	hashHex := fs.String("hash", "", "NT hash to test instead of a password")
+	budget := fs.Int("budget", 1, "Failed attempts allowed per user across all hosts")
+	threshold := fs.Int("threshold", 0, "Lockout threshold of the domain. Users whose badPwdCount would reach it are skipped")
+	delay := fs.Duration("delay", 0, "Pause between attempts")
+	jitter := fs.Duration("jitter", 0, "Random extra pause of up to the given duration between attempts")
+	monitorHost := fs.String("monitor-host", "", "Host, usually a domain controller, to read badPwdCount from over SAMR")
+	monitorUser := fs.String("monitor-user", "", "Username for reading badPwdCount")
+	monitorPass := fs.String("monitor-pass", "", "Password for reading badPwdCount")
+	continueOnLockout := fs.Bool("continue-on-lockout", false, "Keep going after an account is reported as locked out")
+	asJSON := fs.Bool("json", *jsonOutput, "Print results as JSON lines")
+	verbose := fs.Bool("v", false, "Also report failed attempts")
+	fs.Parse(args)
+	if fs.NArg() < 1 || *usersFile == "" {
+		return fmt.Errorf("Usage: spray -users <file> [flags] <host> [host...]")
+	}
+	if *budget < 1 {
+		return fmt.Errorf("-budget must be at least 1")
+	}
+
+	users, err := readLines(*usersFile)
+	if err != nil {
+		return err
+	}
+	secret := *sprayPass
+	if secret == "" {
+		secret = *password
+	}
+	var hash []byte
+	if *hashHex != "" {
+		if hash, err = hex.DecodeString(*hashHex); err != nil || len(hash) != 16 {
+			return fmt.Errorf("Invalid NT hash %s", *hashHex)
+		}
+		secret = ""
+	} else if secret == "" {
+		return fmt.Errorf("A password or -hash is required")
+	}
+
+	s := &sprayer{
+		users:         users,
+		hosts:         fs.Args(),
+		budget:        *budget,
+		threshold:     *threshold,
+		delay:         *delay,
+		jitter:        *jitter,
+		verbose:       *verbose,
+		stopOnLockout: !*continueOnLockout,
+		login: func(host, user string) sprayResult {
+			return sprayLogin(host, *domain, user, secret, hash)
+		},
+		sleep: time.Sleep,
+	}
+	s.report = func(res sprayResult) {
+		if *asJSON {
+			emit(res)
+			return
+		}
+		mark := "[-]"
+		if res.Valid {
+			mark = "[+]"
+		}
+		fmt.Printf("%s %s %s\\%s: %s %s\n", mark, res.Host, res.Domain, res.User, res.Status, res.Error)
+	}
+
+	if *monitorHost != "" {
+		if *threshold == 0 {
+			return fmt.Errorf("-monitor-host requires -threshold")
+		}
+		conn, err := smb.NewConnection(smb.Options{
+			Host: *monitorHost,
+			Port: *port,
+			Initiator: &spnego.NTLMInitiator{
+				User:     *monitorUser,
+				Password: *monitorPass,
+				Domain:   *domain,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to connect to monitor host: %s", err)
+		}
+		defer conn.Close()
+		monitor, err := newBadPwdMonitor(conn)
+		if err != nil {
+			return fmt.Errorf("Failed to read badPwdCount from monitor host: %s", err)
+		}
+		s.badPwdCount = monitor.badPwdCount
+	} else if *threshold > 0 {
+		fmt.Fprintln(os.Stderr, "badPwdCount is not monitored without -monitor-host, only the attempt budget applies")
+	}
+
+	valid, err := s.run()
+	fmt.Fprintf(os.Stderr, "%d valid credentials found\n", valid)
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSprayer(t *testing.T) {
+	var attempts []string
+	var reported []sprayResult
+	var pauses []time.Duration
+	s := &sprayer{
+		users:         []string{"alice", "bob", "carol", "dave"},
+		hosts:         []string{"host1", "host2", "host3"},
+		budget:        2,
+		delay:         time.Second,
+		stopOnLockout: true,
+		login: func(host, user string) sprayResult {
+			attempts = append(attempts, host+"/"+user)
+			res := sprayResult{Host: host, User: user, Status: "logon_failure"}
+			switch user {
+			case "alice":
+				res.Status, res.Valid = "success", true
+			case "dave":
+				if host == "host2" {
+					res.Status = "locked_out"
+				}
+			}
+			return res
+		},
+		// carol is one failed attempt away from the threshold
+		threshold: 5,
+		badPwdCount: func(user string) (int, error) {
+			if user == "carol" {
+				return 4, nil
+			}
+			return 0, nil
+		},
+		sleep:  func(d time.Duration) { pauses = append(pauses, d) },
+		report: func(res sprayResult) { reported = append(reported, res) },
+	}
+	valid, err := s.run()
+	if err == nil {
+		t.Fatal("Fail: lockout did not abort the spray")
+	}
+	expected := []string{"host1/alice", "host1/bob", "host1/dave", "host2/alice", "host2/bob", "host2/dave"}
+	if len(attempts) != len(expected) {
+		t.Fatalf("Fail: %v", attempts)
+	}
+	for i := range expected {
+		if attempts[i] != expected[i] {
+			t.Fatalf("Fail: %v", attempts)
+		}
+	}
+	if valid != 2 || len(reported) != 2 || len(pauses) != len(attempts)-1 || pauses[0] != time.Second {
+		t.Fatalf("Fail: %d %v %v", valid, reported, pauses)
+	}
+
+	// Without aborting, bob runs out of budget and dave stays skipped
+	attempts, reported, pauses = nil, nil, nil
+	s.stopOnLockout = false
+	s.verbose = true
+	if valid, err = s.run(); err != nil || valid != 3 {
+		t.Fatalf("Fail: %d %v", valid, err)
+	}
+	expected = append(expected, "host3/alice")
+	if len(attempts) != len(expected) || attempts[len(attempts)-1] != "host3/alice" || len(reported) != len(attempts) {
+		t.Fatalf("Fail: %v", attempts)
+	}
+}
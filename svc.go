@@ -0,0 +1,262 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/ericblavier/go-smb/smb/dcerpc/msscmr"
+)
+
+// Start types accepted by svc create
+var svcStartTypes = map[string]uint32{
+	"boot":     msscmr.ServiceBootStart,
+	"system":   msscmr.ServiceSystemStart,
+	"auto":     msscmr.ServiceAutoStart,
+	"demand":   msscmr.ServiceDemandStart,
+	"disabled": msscmr.ServiceDisabled,
+}
+
+// Time to wait for a service to reach the requested state after start or stop
+const svcWaitTimeout = 30 * time.Second
+
+// bindServiceManager binds to the svcctl pipe of an established connection
+func bindServiceManager(conn *smb.Connection) (*msscmr.RPCCon, error) {
+	share := "IPC$"
+	if err := conn.TreeConnect(share); err != nil {
+		return nil, err
+	}
+	f, err := conn.OpenFile(share, msscmr.MSRPCSvcCtlPipe)
+	if err != nil {
+		return nil, err
+	}
+	bind, err := dcerpc.Bind(f, msscmr.MSRPCUuidSvcCtl, msscmr.MSRPCSvcCtlMajorVersion, msscmr.MSRPCSvcCtlMinorVersion, dcerpc.MSRPCUuidNdr)
+	if err != nil {
+		f.CloseFile()
+		return nil, err
+	}
+	return msscmr.NewRPCCon(bind), nil
+}
+
+// serviceState returns the name of a service state without the SERVICE_ prefix
+func serviceState(state uint32) string {
+	if name, found := msscmr.ServiceStatusMap[state]; found {
+		return strings.TrimPrefix(name, "SERVICE_")
+	}
+	return fmt.Sprintf("0x%x", state)
+}
+
+// Record of a service printed in JSON mode
+type svcRecord struct {
+	Name             string `json:"name"`
+	DisplayName      string `json:"display_name,omitempty"`
+	State            string `json:"state"`
+	Type             string `json:"type,omitempty"`
+	StartType        string `json:"start_type,omitempty"`
+	ErrorControl     string `json:"error_control,omitempty"`
+	BinaryPathName   string `json:"binary_path_name,omitempty"`
+	LoadOrderGroup   string `json:"load_order_group,omitempty"`
+	Dependencies     string `json:"dependencies,omitempty"`
+	ServiceStartName string `json:"service_start_name,omitempty"`
+}
+
+// printServiceState reports the state of a service after start or stop
+func printServiceState(name string, state uint32) error {
+	if *jsonOutput {
+		return emit(svcRecord{Name: name, State: serviceState(state)})
+	}
+	fmt.Printf("%s: %s\n", name, serviceState(state))
+	return nil
+}
+
+// waitForState polls the state of a service until it reaches the target
+// state or the timeout passes
+func waitForState(rpccon *msscmr.RPCCon, name string, target uint32) (state uint32, err error) {
+	deadline := time.Now().Add(svcWaitTimeout)
+	for {
+		state, err = rpccon.GetServiceStatus(name)
+		if err != nil || state == target || time.Now().After(deadline) {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func runSvc(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("Usage: svc list|query|start|stop|create|delete [flags] <host> [service]")
+	}
+	op := args[0]
+	fs := flag.NewFlagSet("svc "+op, flag.ExitOnError)
+	var (
+		state, binPath, runAs, runAsPass, startType, display string
+		noWait                                               bool
+	)
+	nargs := 2
+	switch op {
+	case "list":
+		fs.StringVar(&state, "state", "all", "List services in state active, inactive or all")
+		nargs = 1
+	case "query", "delete":
+	case "start", "stop":
+		fs.BoolVar(&noWait, "nowait", false, "Return without waiting for the service to reach the new state")
+	case "create":
+		fs.StringVar(&binPath, "binpath", "", "Command line of the service binary (required)")
+		fs.StringVar(&runAs, "runas", "", "Account the service runs as, e.g. .\\user. Defaults to LocalSystem")
+		fs.StringVar(&runAsPass, "runas-pass", "", "Password of the -runas account")
+		fs.StringVar(&startType, "start", "demand", "Start type: boot, system, auto, demand or disabled")
+		fs.StringVar(&display, "display", "", "Display name, defaults to the service name")
+	default:
+		return fmt.Errorf("Unknown svc operation %s", op)
+	}
+	fs.Parse(args[1:])
+	// Arguments after the service name are passed to the service by start
+	if fs.NArg() < nargs || fs.NArg() > nargs && op != "start" {
+		return fmt.Errorf("Expected %d arguments but got %d", nargs, fs.NArg())
+	}
+	host := fs.Arg(0)
+
+	conn, err := connect(host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	rpccon, err := bindServiceManager(conn)
+	if err != nil {
+		return err
+	}
+
+	if op == "list" {
+		states := map[string]uint32{"active": msscmr.ServiceActive, "inactive": msscmr.ServiceInactive, "all": msscmr.ServiceStateAll}
+		enumState, ok := states[state]
+		if !ok {
+			return fmt.Errorf("Invalid service state %s", state)
+		}
+		return svcList(rpccon, enumState)
+	}
+
+	name := fs.Arg(1)
+	switch op {
+	case "query":
+		return svcQuery(rpccon, name)
+	case "start":
+		if err = rpccon.StartService(name, fs.Args()[2:]); err != nil {
+			return err
+		}
+		if noWait {
+			return emitDone("svc start", name)
+		}
+		current, err := waitForState(rpccon, name, msscmr.ServiceRunning)
+		if err != nil {
+			return err
+		}
+		return printServiceState(name, current)
+	case "stop":
+		if err = rpccon.ControlService(name, msscmr.ServiceControlStop); err != nil {
+			return err
+		}
+		if noWait {
+			return emitDone("svc stop", name)
+		}
+		current, err := waitForState(rpccon, name, msscmr.ServiceStopped)
+		if err != nil {
+			return err
+		}
+		return printServiceState(name, current)
+	case "create":
+		if binPath == "" {
+			return fmt.Errorf("-binpath is required")
+		}
+		start, ok := svcStartTypes[startType]
+		if !ok {
+			return fmt.Errorf("Invalid start type %s", startType)
+		}
+		if display == "" {
+			display = name
+		}
+		err = rpccon.CreateService(name, msscmr.ServiceWin32OwnProcess, start, msscmr.ServiceErrorNormal, binPath, runAs, runAsPass, display, false)
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			return emitDone("svc create", name)
+		}
+		fmt.Printf("Created service %s\n", name)
+		return nil
+	default:
+		err = rpccon.DeleteService(name)
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			return emitDone("svc delete", name)
+		}
+		fmt.Printf("Deleted service %s\n", name)
+		return nil
+	}
+}
+
+func svcList(rpccon *msscmr.RPCCon, state uint32) error {
+	services, err := rpccon.EnumServicesStatus(msscmr.ServiceWin32, state)
+	if err != nil {
+		return err
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return strings.ToLower(services[i].ServiceName) < strings.ToLower(services[j].ServiceName)
+	})
+	if !*jsonOutput {
+		fmt.Printf("  %-40s %-16s %s\n", "Name", "State", "Display name")
+	}
+	for _, service := range services {
+		current := "UNKNOWN"
+		if service.ServiceStatus != nil {
+			current = serviceState(service.ServiceStatus.CurrentState)
+		}
+		if *jsonOutput {
+			emit(svcRecord{Name: service.ServiceName, DisplayName: service.DisplayName, State: current})
+			continue
+		}
+		fmt.Printf("  %-40s %-16s %s\n", service.ServiceName, current, service.DisplayName)
+	}
+	return nil
+}
+
+func svcQuery(rpccon *msscmr.RPCCon, name string) error {
+	config, err := rpccon.GetServiceConfig(name)
+	if err != nil {
+		return err
+	}
+	state, err := rpccon.GetServiceStatus(name)
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		return emit(svcRecord{
+			Name:             name,
+			DisplayName:      config.DisplayName,
+			State:            serviceState(state),
+			Type:             config.ServiceType,
+			StartType:        config.StartType,
+			ErrorControl:     config.ErrorControl,
+			BinaryPathName:   config.BinaryPathName,
+			LoadOrderGroup:   config.LoadOrderGroup,
+			Dependencies:     config.Dependencies,
+			ServiceStartName: config.ServiceStartName,
+		})
+	}
+	fmt.Printf("SERVICE_NAME: %s\n", name)
+	fmt.Printf("  %-18s : %s\n", "DISPLAY_NAME", config.DisplayName)
+	fmt.Printf("  %-18s : %s\n", "STATE", serviceState(state))
+	fmt.Printf("  %-18s : %s\n", "TYPE", config.ServiceType)
+	fmt.Printf("  %-18s : %s\n", "START_TYPE", config.StartType)
+	fmt.Printf("  %-18s : %s\n", "ERROR_CONTROL", config.ErrorControl)
+	fmt.Printf("  %-18s : %s\n", "BINARY_PATH_NAME", config.BinaryPathName)
+	fmt.Printf("  %-18s : %s\n", "LOAD_ORDER_GROUP", config.LoadOrderGroup)
+	fmt.Printf("  %-18s : %s\n", "DEPENDENCIES", config.Dependencies)
+	fmt.Printf("  %-18s : %s\n", "SERVICE_START_NAME", config.ServiceStartName)
+	return nil
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+// Largest difference between modification times still considered equal,
+// covering file systems storing times with a two second resolution
+const syncTimeTolerance = 2 * time.Second
+
+// Status of a path in the comparison of a local and a remote tree
+const (
+	syncLocalOnly  = "local"    // Only in the local tree
+	syncRemoteOnly = "remote"   // Only in the remote tree
+	syncChanged    = "changed"  // A file in both trees with different content
+	syncConflict   = "conflict" // A file in one tree and a directory in the other
+)
+
+// A file or directory of a tree compared by sync
+type syncEntry struct {
+	rel      string // Slash separated path relative to the root
+	dir      bool
+	size     uint64
+	modified time.Time
+	file     *smb.SharedFile // Listing of a remote entry
+}
+
+// Entries of a tree by relative path. Paths are lower cased when the share
+// compares names case insensitively, as Windows does by default.
+type syncTree map[string]syncEntry
+
+func (t syncTree) add(e syncEntry, caseSensitive bool) {
+	if caseSensitive {
+		t[e.rel] = e
+		return
+	}
+	t[strings.ToLower(e.rel)] = e
+}
+
+// find returns the entry of a relative path in either kind of tree
+func (t syncTree) find(rel string) syncEntry {
+	if e, found := t[rel]; found {
+		return e
+	}
+	return t[strings.ToLower(rel)]
+}
+
+// A difference between the trees and the action taken for it
+type syncChange struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Dir    bool   `json:"dir,omitempty"`
+	Action string `json:"action,omitempty"` // upload, download, mkdir or delete
+	Error  string `json:"error,omitempty"`
+}
+
+// diffTrees compares a local and a remote tree. Files of the same size are
+// compared by modification time or, when sameContent is set, by calling it.
+func diffTrees(local, remote syncTree, sameContent func(rel string) (bool, error)) (changes []syncChange, err error) {
+	for key, l := range local {
+		r, found := remote[key]
+		switch {
+		case !found:
+			changes = append(changes, syncChange{Path: l.rel, Status: syncLocalOnly, Dir: l.dir})
+		case l.dir != r.dir:
+			changes = append(changes, syncChange{Path: l.rel, Status: syncConflict})
+		case l.dir:
+		case l.size != r.size:
+			changes = append(changes, syncChange{Path: l.rel, Status: syncChanged})
+		case sameContent != nil:
+			same, err := sameContent(l.rel)
+			if err != nil {
+				return nil, err
+			}
+			if !same {
+				changes = append(changes, syncChange{Path: l.rel, Status: syncChanged})
+			}
+		default:
+			if d := l.modified.Sub(r.modified); d > syncTimeTolerance || d < -syncTimeTolerance {
+				changes = append(changes, syncChange{Path: l.rel, Status: syncChanged})
+			}
+		}
+	}
+	for key, r := range remote {
+		if _, found := local[key]; !found {
+			changes = append(changes, syncChange{Path: r.rel, Status: syncRemoteOnly, Dir: r.dir})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return
+}
+
+// planSync sets the action of each change when pushing local changes to the
+// remote tree or pulling remote changes. Files only in the destination are
+// deleted when mirror is set. Deletions are moved last and ordered so that
+// the entries of a directory are deleted before the directory.
+func planSync(changes []syncChange, push, mirror bool) []syncChange {
+	source, destination := syncRemoteOnly, syncLocalOnly
+	transfer := "download"
+	if push {
+		source, destination = syncLocalOnly, syncRemoteOnly
+		transfer = "upload"
+	}
+	var planned, deletes []syncChange
+	for _, c := range changes {
+		switch {
+		case c.Status == source && c.Dir:
+			c.Action = "mkdir"
+		case c.Status == source || c.Status == syncChanged:
+			c.Action = transfer
+		case c.Status == destination && mirror:
+			c.Action = "delete"
+			deletes = append(deletes, c)
+			continue
+		}
+		planned = append(planned, c)
+	}
+	sort.Slice(deletes, func(i, j int) bool { return deletes[i].Path > deletes[j].Path })
+	return append(planned, deletes...)
+}
+
+// localTree lists the files and directories below a local directory. A
+// missing directory is returned as an empty tree.
+func localTree(root string, filter *downloadFilter, caseSensitive bool) (syncTree, error) {
+	tree := syncTree{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root && os.IsNotExist(err) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if filter.excluded(rel) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e := syncEntry{rel: rel, dir: d.IsDir(), modified: info.ModTime()}
+		if !e.dir {
+			e.size = uint64(info.Size())
+		}
+		tree.add(e, caseSensitive)
+		return nil
+	})
+	return tree, err
+}
+
+// remoteTree lists the files and directories below a directory of a share.
+// A missing directory is returned as an empty tree.
+func remoteTree(conn *smb.Connection, t target, filter *downloadFilter, caseSensitive bool) (syncTree, error) {
+	tree := syncTree{}
+	var walk func(dir, rel string) error
+	walk = func(dir, rel string) error {
+		files, err := conn.ListDirectory(t.share, dir, "*")
+		if err != nil {
+			return err
+		}
+		for i := range files {
+			file := &files[i]
+			if file.Name == "." || file.Name == ".." || file.IsJunction {
+				continue
+			}
+			childRel := path.Join(rel, file.Name)
+			if filter.excluded(childRel) {
+				continue
+			}
+			tree.add(syncEntry{rel: childRel, dir: file.IsDir, size: file.Size, modified: file.Modified(), file: file}, caseSensitive)
+			if file.IsDir {
+				if err = walk(file.FullPath, childRel); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err := walk(t.path, "")
+	if err == smb.StatusMap[smb.StatusObjectNameNotFound] || err == smb.StatusMap[smb.StatusObjectPathNotFound] {
+		return tree, nil
+	}
+	return tree, err
+}
+
+// remotePath returns the path on the share of a path relative to the root
+func remotePath(t target, rel string) string {
+	return strings.TrimPrefix(t.path+`\`+strings.ReplaceAll(rel, "/", `\`), `\`)
+}
+
+// sameHash compares the SHA-256 of a local and a remote file
+func sameHash(conn *smb.Connection, t target, local, rel string) (bool, error) {
+	in, err := os.Open(filepath.Join(local, filepath.FromSlash(rel)))
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+	lh := sha256.New()
+	if _, err = io.Copy(lh, in); err != nil {
+		return false, err
+	}
+	rh := sha256.New()
+	if err = conn.RetrieveFile(t.share, remotePath(t, rel), 0, rh.Write); err != nil {
+		return false, err
+	}
+	return bytes.Equal(lh.Sum(nil), rh.Sum(nil)), nil
+}
+
+// applyChange performs the action of a change
+func applyChange(conn *smb.Connection, t target, local string, c syncChange, remote syncTree) error {
+	localPath := filepath.Join(local, filepath.FromSlash(c.Path))
+	rPath := remotePath(t, c.Path)
+	switch c.Action {
+	case "mkdir":
+		if c.Status == syncLocalOnly {
+			return conn.MkdirAll(t.share, rPath)
+		}
+		return os.MkdirAll(localPath, 0755)
+	case "upload":
+		in, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+		info, err := in.Stat()
+		if err == nil {
+			err = conn.PutFile(t.share, rPath, 0, in.Read)
+		}
+		in.Close()
+		if err != nil {
+			return err
+		}
+		// Keep the modification time so the files compare equal afterwards
+		return conn.SetFileTimes(t.share, rPath, time.Time{}, info.ModTime(), time.Time{}, time.Time{})
+	case "download":
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			return err
+		}
+		return downloadFile(conn, t.share, remote.find(c.Path).file, localPath)
+	case "delete":
+		if c.Status == syncRemoteOnly {
+			if c.Dir {
+				return conn.DeleteDir(t.share, rPath)
+			}
+			return conn.DeleteFile(t.share, rPath)
+		}
+		return os.Remove(localPath)
+	}
+	return nil
+}
+
+// probeCaseSensitivity reports whether the share compares the names below
+// the target directory case sensitively, e.g., Samba or a directory with
+// NTFS case sensitivity enabled. A missing directory is probed through the
+// root of the share. Names are compared case insensitively when the probe
+// fails.
+func probeCaseSensitivity(conn *smb.Connection, t target) bool {
+	cs, err := conn.ProbeCaseSensitivity(t.share, t.path)
+	if err == smb.StatusMap[smb.StatusObjectNameNotFound] || err == smb.StatusMap[smb.StatusObjectPathNotFound] {
+		cs, err = conn.ProbeCaseSensitivity(t.share, "")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not probe case sensitivity, comparing names case insensitively: %v\n", err)
+		return false
+	}
+	return cs.Sensitive
+}
+
+func runSync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	var exclude patternList
+	push := fs.Bool("push", false, "Upload new and changed local files")
+	pull := fs.Bool("pull", false, "Download new and changed remote files")
+	mirror := fs.Bool("mirror", false, "Also delete files and directories missing from the source")
+	hash := fs.Bool("hash", false, "Compare files of the same size by SHA-256 instead of modification time")
+	caseMode := fs.String("case", "auto", "Name comparison: auto probes the share, sensitive or insensitive")
+	fs.Var(&exclude, "exclude", "Glob of files and directories to ignore on both sides (repeatable)")
+	fs.Parse(args)
+	if fs.NArg() != 2 || *push && *pull {
+		return fmt.Errorf("Usage: sync [-push|-pull] [-mirror] [-hash] [-case mode] [-exclude glob]... <local dir> //host/share/path")
+	}
+	if *mirror && !*push && !*pull {
+		return fmt.Errorf("-mirror requires -push or -pull")
+	}
+	if *caseMode != "auto" && *caseMode != "sensitive" && *caseMode != "insensitive" {
+		return fmt.Errorf("-case must be auto, sensitive or insensitive")
+	}
+	local := fs.Arg(0)
+	t, err := parseTarget(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	filter, err := newDownloadFilter(nil, exclude, false)
+	if err != nil {
+		return err
+	}
+
+	conn, err := connectShare(t)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	caseSensitive := *caseMode == "sensitive"
+	if *caseMode == "auto" {
+		caseSensitive = probeCaseSensitivity(conn, t)
+	}
+	localEntries, err := localTree(local, filter, caseSensitive)
+	if err != nil {
+		return err
+	}
+	remoteEntries, err := remoteTree(conn, t, filter, caseSensitive)
+	if err != nil {
+		return err
+	}
+	var sameContent func(rel string) (bool, error)
+	if *hash {
+		sameContent = func(rel string) (bool, error) {
+			return sameHash(conn, t, local, rel)
+		}
+	}
+	changes, err := diffTrees(localEntries, remoteEntries, sameContent)
+	if err != nil {
+		return err
+	}
+
+	if *push || *pull {
+		changes = planSync(changes, *push, *mirror)
+		if *push && t.path != "" && len(changes) > 0 {
+			if err = conn.MkdirAll(t.share, t.path); err != nil {
+				return err
+			}
+		}
+	}
+	failed := 0
+	for _, c := range changes {
+		if c.Action != "" {
+			if err := applyChange(conn, t, local, c, remoteEntries); err != nil {
+				c.Error = err.Error()
+				failed++
+			}
+		}
+		if *jsonOutput {
+			emit(c)
+			continue
+		}
+		name := c.Path
+		if c.Dir {
+			name += "/"
+		}
+		fmt.Printf("  %-9s %-9s %s\n", c.Status, c.Action, name)
+		if c.Error != "" {
+			fmt.Fprintf(os.Stderr, "Failed to %s %s: %s\n", c.Action, c.Path, c.Error)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d changes could not be applied", failed, len(changes))
+	}
+	return nil
+}
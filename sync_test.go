@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffTrees(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	local, remote := syncTree{}, syncTree{}
+	for _, e := range []syncEntry{
+		{rel: "docs", dir: true},
+		{rel: "docs/a.txt", size: 10, modified: now},
+		{rel: "docs/b.txt", size: 10, modified: now},
+		{rel: "docs/c.txt", size: 10, modified: now},
+		{rel: "new.txt", size: 1, modified: now},
+		{rel: "x", size: 1, modified: now},
+	} {
+		local.add(e, false)
+	}
+	for _, e := range []syncEntry{
+		{rel: "Docs", dir: true},
+		{rel: "Docs/A.txt", size: 10, modified: now.Add(time.Second)},
+		{rel: "Docs/b.txt", size: 11, modified: now},
+		{rel: "Docs/c.txt", size: 10, modified: now.Add(time.Hour)},
+		{rel: "old", dir: true},
+		{rel: "old/d.txt", size: 1, modified: now},
+		{rel: "x", dir: true},
+	} {
+		remote.add(e, false)
+	}
+
+	changes, err := diffTrees(local, remote, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []syncChange{
+		{Path: "docs/b.txt", Status: syncChanged},
+		{Path: "docs/c.txt", Status: syncChanged},
+		{Path: "new.txt", Status: syncLocalOnly},
+		{Path: "old", Status: syncRemoteOnly, Dir: true},
+		{Path: "old/d.txt", Status: syncRemoteOnly},
+		{Path: "x", Status: syncConflict},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("Fail: %+v", changes)
+	}
+
+	// Comparing content ignores the modification times
+	changes, err = diffTrees(local, remote, func(rel string) (bool, error) {
+		return rel != "docs/a.txt", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 6 || changes[0].Path != "docs/a.txt" || changes[1].Path != "docs/b.txt" || changes[2].Path != "new.txt" {
+		t.Fatalf("Fail: %+v", changes)
+	}
+}
+
+func TestDiffTreesCaseSensitive(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	local, remote := syncTree{}, syncTree{}
+	local.add(syncEntry{rel: "Makefile", size: 1, modified: now}, true)
+	remote.add(syncEntry{rel: "Makefile", size: 1, modified: now}, true)
+	remote.add(syncEntry{rel: "makefile", size: 2, modified: now}, true)
+
+	changes, err := diffTrees(local, remote, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []syncChange{{Path: "makefile", Status: syncRemoteOnly}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("Fail: %+v", changes)
+	}
+	if e := remote.find("makefile"); e.size != 2 {
+		t.Fatalf("Fail: %+v", e)
+	}
+
+	// Insensitive trees are searched by lower case path
+	remote = syncTree{}
+	remote.add(syncEntry{rel: "Makefile", size: 3}, false)
+	if e := remote.find("MAKEFILE"); e.size != 3 {
+		t.Fatalf("Fail: %+v", e)
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	changes := []syncChange{
+		{Path: "a.txt", Status: syncChanged},
+		{Path: "new", Status: syncLocalOnly, Dir: true},
+		{Path: "new/b.txt", Status: syncLocalOnly},
+		{Path: "old", Status: syncRemoteOnly, Dir: true},
+		{Path: "old/c.txt", Status: syncRemoteOnly},
+		{Path: "x", Status: syncConflict},
+	}
+	want := []syncChange{
+		{Path: "a.txt", Status: syncChanged, Action: "upload"},
+		{Path: "new", Status: syncLocalOnly, Dir: true, Action: "mkdir"},
+		{Path: "new/b.txt", Status: syncLocalOnly, Action: "upload"},
+		{Path: "x", Status: syncConflict},
+		{Path: "old/c.txt", Status: syncRemoteOnly, Action: "delete"},
+		{Path: "old", Status: syncRemoteOnly, Dir: true, Action: "delete"},
+	}
+	if got := planSync(changes, true, true); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Fail: %+v", got)
+	}
+
+	want = []syncChange{
+		{Path: "a.txt", Status: syncChanged, Action: "download"},
+		{Path: "new", Status: syncLocalOnly, Dir: true},
+		{Path: "new/b.txt", Status: syncLocalOnly},
+		{Path: "old", Status: syncRemoteOnly, Dir: true, Action: "mkdir"},
+		{Path: "old/c.txt", Status: syncRemoteOnly, Action: "download"},
+		{Path: "x", Status: syncConflict},
+	}
+	if got := planSync(changes, false, false); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Fail: %+v", got)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ericblavier/go-smb/netbios"
+	"github.com/ericblavier/go-smb/ntlmssp"
+	"github.com/ericblavier/go-smb/smb"
+	"github.com/ericblavier/go-smb/smb/dcerpc"
+	"github.com/ericblavier/go-smb/spnego"
+)
+
+// A location on a share given as //host/share/path
+type target struct {
+	host  string
+	share string
+	path  string // Relative to the share and separated by backslashes
+}
+
+// parseTarget parses a //host/share/path or \\host\share\path target. The
+// share may also be a drive such as C: for the local paths of the server.
+func parseTarget(s string) (t target, err error) {
+	s = strings.ReplaceAll(s, `\`, "/")
+	if !strings.HasPrefix(s, "//") {
+		return t, fmt.Errorf("Invalid target %s. Expecting //host/share/path", s)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(s, "//"), "/", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return t, fmt.Errorf("Invalid target %s. Expecting //host/share/path", s)
+	}
+	t.host, t.share = parts[0], parts[1]
+	// Local paths of the server, e.g., //host/C:/Windows, are on the
+	// administrative share of the drive
+	if len(t.share) == 2 && t.share[1] == ':' {
+		if t.share, err = smb.DriveShare(t.share[0]); err != nil {
+			return
+		}
+	}
+	if len(parts) == 3 {
+		t.path = strings.ReplaceAll(strings.Trim(path.Clean("/"+parts[2]), "/"), "/", `\`)
+	}
+	return
+}
+
+// base returns the last element of the path
+func (t target) base() string {
+	return t.path[strings.LastIndex(t.path, `\`)+1:]
+}
+
+// String returns the target in the //host/share/path form
+func (t target) String() string {
+	return "//" + t.host + "/" + t.share + "/" + strings.ReplaceAll(t.path, `\`, "/")
+}
+
+// connect establishes an authenticated connection to host using the
+// credentials from the global flags
+func connect(host string) (*smb.Connection, error) {
+	options := smb.Options{
+		Host: host,
+		Port: *port,
+		Initiator: &spnego.NTLMInitiator{
+			User:     *username,
+			Password: *password,
+			Domain:   *domain,
+		},
+	}
+	options.DisableSMB1 = *disableSMB1
+	switch *signing {
+	case "default":
+	case "required":
+		options.RequireMessageSigning = true
+	case "disabled":
+		options.DisableSigning = true
+	default:
+		return nil, fmt.Errorf("Invalid signing policy %s. Expecting default, required or disabled", *signing)
+	}
+	if *port == netbios.SessionServicePort {
+		options.NetBIOSName = calledName(host)
+	}
+	dialer, err := transcriptDialer()
+	if err != nil {
+		return nil, err
+	}
+	if dialer != nil {
+		options.ProxyDialer = dialer
+	}
+	conn, err := smb.NewConnection(options)
+	if err != nil {
+		return nil, err
+	}
+	if skew, ok := conn.ClockSkew(); ok && skew.Abs() > smb.MaxKerberosClockSkew {
+		fmt.Fprintf(os.Stderr, "Warning: the clock of %s is %v off the local clock, Kerberos authentication will fail\n", host, skew)
+	}
+	return conn, nil
+}
+
+// connectShare connects to the host of the target and its share
+func connectShare(t target) (*smb.Connection, error) {
+	conn, err := connect(t.host)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.TreeConnect(t.share); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// bindPrivacy binds to an RPC interface over a named pipe of an established
+// connection with packet privacy, authenticating with the credentials from
+// the global flags. It is required by interfaces returning secrets.
+func bindPrivacy(conn *smb.Connection, pipe, uuid string, major, minor uint16) (*dcerpc.ServiceBind, error) {
+	f, err := conn.OpenFile("IPC$", pipe)
+	if err != nil {
+		return nil, err
+	}
+	client := &ntlmssp.Client{User: *username, Password: *password, Domain: *domain}
+	bind, err := dcerpc.BindAuth(f, uuid, major, minor, dcerpc.MSRPCUuidNdr, dcerpc.AuthLevelPktPrivacy, client)
+	if err != nil {
+		f.CloseFile()
+		return nil, err
+	}
+	return bind, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestParseTarget(t *testing.T) {
+	for _, test := range []struct {
+		in                string
+		host, share, path string
+	}{
+		{"//host/share", "host", "share", ""},
+		{"//host/share/", "host", "share", ""},
+		{"//10.0.0.1/C$/Windows/System32/", "10.0.0.1", "C$", `Windows\System32`},
+		{`\\host\share\dir\..\file.txt`, "host", "share", "file.txt"},
+		{`\\host\c:\Windows\Temp\x`, "host", "C$", `Windows\Temp\x`},
+	} {
+		target, err := parseTarget(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if target.host != test.host || target.share != test.share || target.path != test.path {
+			t.Fatalf("Fail: %+v", target)
+		}
+	}
+	for _, in := range []string{"host/share", "//host", "///share", "//host//path", "//host/1:/path"} {
+		if _, err := parseTarget(in); err == nil {
+			t.Fatalf("Fail: %s", in)
+		}
+	}
+}
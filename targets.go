@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Placeholder replaced by each host in the arguments of a command run with
+// -targets
+const hostPlaceholder = "{host}"
+
+// Flags that control the execution against multiple hosts and are not
+// passed on to the per-host runs
+var multiHostFlags = map[string]bool{"targets": true, "threads": true, "timeout": true}
+
+// hostArgs returns the arguments of a command for a single host. Arguments
+// containing the placeholder get the host substituted, otherwise the host is
+// appended as the last argument.
+func hostArgs(args []string, host string) []string {
+	res := make([]string, len(args))
+	found := false
+	for i, arg := range args {
+		res[i] = strings.ReplaceAll(arg, hostPlaceholder, host)
+		found = found || res[i] != arg
+	}
+	if !found {
+		res = append(res, host)
+	}
+	return res
+}
+
+// tagJSONLine adds the host to a JSON record lacking it
+func tagJSONLine(line []byte, host string) []byte {
+	var fields map[string]json.RawMessage
+	trimmed := bytes.TrimSpace(line)
+	if json.Unmarshal(trimmed, &fields) != nil {
+		return line
+	}
+	if _, found := fields["host"]; found {
+		return line
+	}
+	hostJSON, _ := json.Marshal(host)
+	tagged := []byte(`{"host":` + string(hostJSON))
+	if len(fields) > 0 {
+		tagged = append(tagged, ',')
+	}
+	return append(tagged, trimmed[1:]...)
+}
+
+// Output of the command for a single host
+type hostResult struct {
+	host   string
+	stdout []byte
+	stderr []byte
+	err    error
+}
+
+// targetRunner runs a command against many hosts with a pool of workers
+type targetRunner struct {
+	hosts   []string
+	threads int
+	timeout time.Duration // Per host, 0 for no limit
+	json    bool          // The output consists of JSON records
+
+	run func(ctx context.Context, host string) hostResult
+	out io.Writer
+	err io.Writer
+}
+
+// report writes the output of a host, prefixing each line with the host or,
+// in JSON mode, adding it to each record
+func (r *targetRunner) report(res hostResult) {
+	scanner := bufio.NewScanner(bytes.NewReader(res.stdout))
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		if r.json {
+			fmt.Fprintf(r.out, "%s\n", tagJSONLine(scanner.Bytes(), res.host))
+		} else {
+			fmt.Fprintf(r.out, "[%s] %s\n", res.host, scanner.Bytes())
+		}
+	}
+	scanner = bufio.NewScanner(bytes.NewReader(res.stderr))
+	for scanner.Scan() {
+		fmt.Fprintf(r.err, "[%s] %s\n", res.host, scanner.Text())
+	}
+	if res.err != nil && len(res.stderr) == 0 {
+		fmt.Fprintf(r.err, "[%s] %s\n", res.host, res.err)
+	}
+}
+
+// runAll runs the command against every host and returns the number of hosts
+// where it failed. The output of a host is written as a whole once it
+// finishes so that the output of concurrent hosts is not interleaved.
+func (r *targetRunner) runAll() (failed int) {
+	hosts := make(chan string)
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+	)
+	for i := 0; i < r.threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range hosts {
+				ctx, cancel := context.Background(), func() {}
+				if r.timeout > 0 {
+					ctx, cancel = context.WithTimeout(ctx, r.timeout)
+				}
+				res := r.run(ctx, host)
+				if ctx.Err() == context.DeadlineExceeded {
+					res.err = fmt.Errorf("Timed out after %s", r.timeout)
+				}
+				cancel()
+				lock.Lock()
+				if res.err != nil {
+					failed++
+				}
+				r.report(res)
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, host := range r.hosts {
+		hosts <- host
+	}
+	close(hosts)
+	wg.Wait()
+	return
+}
+
+// childArgs returns the global flags set on the command line except for the
+// ones controlling the execution against multiple hosts. Flags set from a
+// profile are left out as the child loads the profile itself, which keeps
+// secrets off its command line, and -targets is cleared so that it ignores
+// the hosts of the profile.
+func childArgs() (args []string) {
+	flag.Visit(func(f *flag.Flag) {
+		if !multiHostFlags[f.Name] && explicitFlags[f.Name] {
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	return append(args, "-targets=")
+}
+
+// runTargets runs a command once per host of the targets file, each in a
+// separate process of this program
+func runTargets(args []string) error {
+	hosts := profileHosts
+	if *targetsFile != "" {
+		var err error
+		if hosts, err = readLines(*targetsFile); err != nil {
+			return err
+		}
+		if len(hosts) == 0 {
+			return fmt.Errorf("No hosts in %s", *targetsFile)
+		}
+	}
+	if *threads < 1 {
+		return fmt.Errorf("-threads must be at least 1")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	global := childArgs()
+
+	r := &targetRunner{
+		hosts:   hosts,
+		threads: *threads,
+		timeout: *hostTimeout,
+		json:    *jsonOutput,
+		out:     os.Stdout,
+		err:     os.Stderr,
+		run: func(ctx context.Context, host string) (res hostResult) {
+			var stdout, stderr bytes.Buffer
+			cmdArgs := append(append([]string{}, global...), hostArgs(args, host)...)
+			cmd := exec.CommandContext(ctx, self, cmdArgs...)
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			res.err = cmd.Run()
+			res.host, res.stdout, res.stderr = host, stdout.Bytes(), stderr.Bytes()
+			return
+		},
+	}
+	failed := r.runAll()
+	fmt.Fprintf(os.Stderr, "%d hosts, %d failed\n", len(hosts), failed)
+	if failed > 0 {
+		return fmt.Errorf("The command failed on %d of %d hosts", failed, len(hosts))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostArgs(t *testing.T) {
+	args := hostArgs([]string{"get", "//{host}/C$/file.txt", "{host}-file.txt"}, "10.0.0.1")
+	if strings.Join(args, " ") != "get //10.0.0.1/C$/file.txt 10.0.0.1-file.txt" {
+		t.Fatalf("Fail: %v", args)
+	}
+	args = hostArgs([]string{"shares", "-write"}, "10.0.0.1")
+	if strings.Join(args, " ") != "shares -write 10.0.0.1" {
+		t.Fatalf("Fail: %v", args)
+	}
+}
+
+func TestTagJSONLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{`{"name":"C$"}`, `{"host":"h1","name":"C$"}`},
+		{`{}`, `{"host":"h1"}`},
+		{`{"host":"other","name":"C$"}`, `{"host":"other","name":"C$"}`},
+		{`not json`, `not json`},
+	}
+	for _, tt := range tests {
+		if res := string(tagJSONLine([]byte(tt.line), "h1")); res != tt.expected {
+			t.Fatalf("Fail: %s", res)
+		}
+	}
+}
+
+func TestTargetRunner(t *testing.T) {
+	var out, errOut bytes.Buffer
+	r := &targetRunner{
+		hosts:   []string{"h1", "h2", "h3", "h4"},
+		threads: 2,
+		timeout: 50 * time.Millisecond,
+		out:     &out,
+		err:     &errOut,
+		run: func(ctx context.Context, host string) hostResult {
+			switch host {
+			case "h2":
+				return hostResult{host: host, stderr: []byte("ls: Access denied\n"), err: fmt.Errorf("exit status 1")}
+			case "h3":
+				<-ctx.Done()
+				return hostResult{host: host, err: ctx.Err()}
+			}
+			return hostResult{host: host, stdout: []byte("line1\nline2\n")}
+		},
+	}
+	if failed := r.runAll(); failed != 2 {
+		t.Fatalf("Fail: %d", failed)
+	}
+	for _, host := range []string{"h1", "h4"} {
+		if !strings.Contains(out.String(), "["+host+"] line1\n["+host+"] line2\n") {
+			t.Fatalf("Fail: %s", out.String())
+		}
+	}
+	if !strings.Contains(errOut.String(), "[h2] ls: Access denied\n") || !strings.Contains(errOut.String(), "[h3] Timed out after 50ms\n") {
+		t.Fatalf("Fail: %s", errOut.String())
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/ericblavier/go-smb/smb/replay"
+)
+
+// The transcript of the -replay flag is served to a single connection
+var (
+	replayOnce sync.Once
+	replayer   *replay.Replayer
+	replayErr  error
+)
+
+// transcriptDialer returns the dialer of a connection recording it with the
+// -record flag or replaying it with the -replay flag, nil without them. The
+// transcript only holds one connection, so commands making several, e.g.,
+// audit or -targets, can't be recorded.
+func transcriptDialer() (proxy.Dialer, error) {
+	if *recordFile != "" && *replayFile != "" {
+		return nil, fmt.Errorf("-record and -replay can't be combined")
+	}
+	if *replayFile != "" {
+		replayOnce.Do(func() {
+			var t *replay.Transcript
+			if t, replayErr = replay.LoadTranscript(*replayFile); replayErr == nil {
+				replayer = replay.NewReplayer(t)
+			}
+		})
+		return replayer, replayErr
+	}
+	if *recordFile != "" {
+		f, err := os.OpenFile(*recordFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		// Left open as the connection is used until the command exits
+		return &replay.Recorder{Output: f}, nil
+	}
+	return nil, nil
+}
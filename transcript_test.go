@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb/replay"
+)
+
+func TestTranscriptDialer(t *testing.T) {
+	dir := t.TempDir()
+	defer func() { *recordFile, *replayFile = "", "" }()
+
+	*recordFile = filepath.Join(dir, "session.txt")
+	d, err := transcriptDialer()
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if _, ok := d.(*replay.Recorder); !ok {
+		t.Fatalf("Fail: %T", d)
+	}
+	*replayFile = *recordFile
+	if _, err = transcriptDialer(); err == nil {
+		t.Fatal("Fail")
+	}
+
+	*recordFile = ""
+	if err = os.WriteFile(*replayFile, []byte("+1ms < 0000000102\n"), 0600); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	d, err = transcriptDialer()
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if _, err = d.Dial("tcp", "127.0.0.1:445"); err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	// The transcript is replayed to the first connection only
+	d, err = transcriptDialer()
+	if err != nil {
+		t.Fatalf("Fail: %+v", err)
+	}
+	if _, err = d.Dial("tcp", "127.0.0.1:445"); err == nil || !strings.Contains(err.Error(), "already") {
+		t.Fatalf("Fail: %v", err)
+	}
+}
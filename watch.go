@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+// Changes selectable with the -events flag of watch
+var watchFilters = map[string]uint32{
+	"name":       smb.FileNotifyChangeFileName,
+	"dir":        smb.FileNotifyChangeDirName,
+	"attributes": smb.FileNotifyChangeAttributes,
+	"size":       smb.FileNotifyChangeSize,
+	"write":      smb.FileNotifyChangeLastWrite,
+	"access":     smb.FileNotifyChangeLastAccess,
+	"creation":   smb.FileNotifyChangeCreation,
+	"security":   smb.FileNotifyChangeSecurity,
+}
+
+// A change printed in JSON mode
+type watchEvent struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Path   string    `json:"path"`
+	Polled bool      `json:"polled,omitempty"`
+}
+
+// parseWatchFilter returns the completion filter of comma separated event
+// names
+func parseWatchFilter(events string) (filter uint32, err error) {
+	for _, name := range strings.Split(events, ",") {
+		bit, found := watchFilters[strings.TrimSpace(strings.ToLower(name))]
+		if !found {
+			return 0, fmt.Errorf("Unknown event %s", name)
+		}
+		filter |= bit
+	}
+	return
+}
+
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	recursive := fs.Bool("r", false, "Also watch the subdirectories")
+	events := fs.String("events", "name,dir,size,write", "Comma separated changes to report: name, dir, attributes, size, write, access, creation and security")
+	poll := fs.Bool("poll", false, "Compare directory listings instead of asking the server for changes")
+	interval := fs.Duration("interval", smb.DefaultWatchPollInterval, "Time between directory listings when polling")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Usage: watch [-r] [-events list] [-poll] [-interval duration] //host/share/path")
+	}
+	filter, err := parseWatchFilter(*events)
+	if err != nil {
+		return err
+	}
+	t, err := parseTarget(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	conn, err := connectShare(t)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	w, err := conn.Watch(t.share, t.path, smb.WatchOptions{
+		CompletionFilter: filter,
+		Recursive:        *recursive,
+		PollInterval:     *interval,
+		ForcePolling:     *poll,
+	})
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if w.Polling() {
+		fmt.Fprintf(os.Stderr, "Watching %s by polling every %s\n", t, *interval)
+	} else {
+		fmt.Fprintf(os.Stderr, "Watching %s\n", t)
+	}
+
+	for change := range w.Events() {
+		if change.Overflow {
+			fmt.Fprintf(os.Stderr, "Too many changes at once, some were not reported\n")
+			continue
+		}
+		now := time.Now()
+		p := t
+		p.path = strings.TrimPrefix(t.path+`\`+change.FileName, `\`)
+		action, found := smb.FileActionMap[change.Action]
+		if !found {
+			action = fmt.Sprintf("action %d", change.Action)
+		}
+		if *jsonOutput {
+			emit(watchEvent{Time: now, Action: action, Path: p.String(), Polled: change.Polled})
+			continue
+		}
+		fmt.Printf("%s  %-13s %s\n", now.Format(time.DateTime), action, p)
+	}
+	return w.Err()
+}
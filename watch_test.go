@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ericblavier/go-smb/smb"
+)
+
+func TestParseWatchFilter(t *testing.T) {
+	filter, err := parseWatchFilter("name, Write,dir")
+	if err != nil || filter != smb.FileNotifyChangeFileName|smb.FileNotifyChangeLastWrite|smb.FileNotifyChangeDirName {
+		t.Fatalf("Fail: %x %v", filter, err)
+	}
+	if _, err = parseWatchFilter("name,bogus"); err == nil {
+		t.Fatal("Fail")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ericblavier/go-smb/smb/dcerpc/msdcom"
+	"github.com/ericblavier/go-smb/smb/dcerpc/mswmi"
+	"github.com/ericblavier/go-smb/spnego"
+)
+
+func runWmiexec(args []string) error {
+	fs := flag.NewFlagSet("wmiexec", flag.ExitOnError)
+	dir := fs.String("dir", `C:\`, "Working directory of the command")
+	wait := fs.Duration("wait", 30*time.Second, "Time to wait for the output of the command")
+	noOutput := fs.Bool("no-output", false, "Do not capture the output of the command")
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		return fmt.Errorf("Usage: wmiexec [-dir path] [-wait duration] [-no-output] <host> <command...>")
+	}
+	host := fs.Arg(0)
+	command := strings.Join(fs.Args()[1:], " ")
+	output := ""
+	if !*noOutput {
+		name, err := randomServiceName()
+		if err != nil {
+			return err
+		}
+		output = `Temp\` + name + ".tmp"
+	}
+
+	// WMI is reached over DCOM on TCP while the output is read over SMB
+	dcom, err := msdcom.NewConnection(msdcom.Options{
+		Host: host,
+		Initiator: &spnego.NTLMInitiator{
+			User:     *username,
+			Password: *password,
+			Domain:   *domain,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer dcom.Close()
+	services, err := mswmi.Login(dcom, mswmi.DefaultNamespace)
+	if err != nil {
+		return err
+	}
+	defer services.Release()
+
+	cmdArgs := shellArgs(command, "")
+	if output != "" {
+		cmdArgs = shellArgs(command, `%windir%\`+output)
+	}
+	commandLine := "cmd.exe /Q " + cmdArgs
+	pid, ret, err := services.CreateProcess(commandLine, *dir)
+	if err != nil {
+		return err
+	}
+	if ret != 0 {
+		return fmt.Errorf("Win32_Process.Create returned %d", ret)
+	}
+	fmt.Fprintf(os.Stderr, "Started process %d running %s\n", pid, commandLine)
+
+	var data []byte
+	if output != "" {
+		conn, err := connect(host)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if data, err = readOutput(conn, output, *wait); err != nil {
+			return err
+		}
+		if err = conn.DeleteFile("ADMIN$", output); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove ADMIN$\\%s: %s\n", output, err)
+		}
+	}
+	if *jsonOutput {
+		return emit(execRecord{PID: pid, Command: command, Output: string(data), Status: "ok"})
+	}
+	os.Stdout.Write(data)
+	return nil
+}